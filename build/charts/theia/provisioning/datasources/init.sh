@@ -19,5 +19,6 @@ set -e
 THIS_DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )"
 
 source $THIS_DIR/create_table.sh
-../clickhouse-schema-management
+clickhouse client -h 127.0.0.1 --query "CREATE DATABASE IF NOT EXISTS {{ .Values.clickhouse.database }}"
+../clickhouse-schema-management --bootstrap
 createTable
@@ -0,0 +1,96 @@
+--Drop the names of the rules of the network policies from the policy view
+DROP VIEW IF EXISTS flows_policy_view_local;
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_policy_view_local to policy_view_table_local
+AS SELECT
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleAction,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleAction,
+    sourcePodName,
+    sourceTransportPort,
+    sourcePodNamespace,
+    destinationPodName,
+    destinationTransportPort,
+    destinationPodNamespace,
+    destinationServicePort,
+    destinationServicePortName,
+    destinationIP,
+    sum(octetDeltaCount) AS octetDeltaCount,
+    sum(reverseOctetDeltaCount) AS reverseOctetDeltaCount,
+    sum(throughput) AS throughput,
+    sum(reverseThroughput) AS reverseThroughput,
+    sum(throughputFromSourceNode) AS throughputFromSourceNode,
+    sum(reverseThroughputFromSourceNode) AS reverseThroughputFromSourceNode,
+    sum(throughputFromDestinationNode) AS throughputFromDestinationNode,
+    sum(reverseThroughputFromDestinationNode) AS reverseThroughputFromDestinationNode,
+    clusterUUID
+FROM flows_local
+GROUP BY
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleAction,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleAction,
+    sourcePodName,
+    sourceTransportPort,
+    sourcePodNamespace,
+    destinationPodName,
+    destinationTransportPort,
+    destinationPodNamespace,
+    destinationServicePort,
+    destinationServicePortName,
+    destinationIP,
+    clusterUUID;
+ALTER TABLE flows_policy_view
+    DROP COLUMN IF EXISTS egressNetworkPolicyRuleName,
+    DROP COLUMN IF EXISTS ingressNetworkPolicyRuleName;
+ALTER TABLE policy_view_table_local
+    DROP COLUMN IF EXISTS egressNetworkPolicyRuleName,
+    DROP COLUMN IF EXISTS ingressNetworkPolicyRuleName;
+--Drop the table storing the results of the custom analytics jobs
+DROP TABLE IF EXISTS analytics_job_results;
+DROP TABLE IF EXISTS analytics_job_results_local;
+--Drop the view, the Materialized View and the tables of the latest state of
+--the flows
+DROP VIEW IF EXISTS flows_latest;
+DROP VIEW IF EXISTS flows_latest_records_view_local;
+DROP TABLE IF EXISTS flows_latest_records;
+DROP TABLE IF EXISTS flows_latest_records_local;
+--Drop the traffic class column
+ALTER TABLE flows DROP COLUMN IF EXISTS trafficClass;
+ALTER TABLE flows_local DROP COLUMN IF EXISTS trafficClass;
+--Drop the view, dictionaries and tables used to enrich the flow records
+DROP VIEW IF EXISTS flows_enriched;
+DROP DICTIONARY IF EXISTS node_labels_dict;
+DROP TABLE IF EXISTS node_labels;
+DROP TABLE IF EXISTS node_labels_local;
+DROP DICTIONARY IF EXISTS ip_names_dict;
+DROP TABLE IF EXISTS ip_names;
+DROP TABLE IF EXISTS ip_names_local;
+--Drop the table auditing the deletions of records
+DROP TABLE IF EXISTS deletion_audit;
+DROP TABLE IF EXISTS deletion_audit_local;
+--Drop the table storing the coverage of the recommended policies
+DROP TABLE IF EXISTS recommendation_coverage;
+DROP TABLE IF EXISTS recommendation_coverage_local;
+--Drop the table storing the data window of the recommendation jobs
+DROP TABLE IF EXISTS recommendation_data_window;
+DROP TABLE IF EXISTS recommendation_data_window_local;
+--Drop the Materialized Views and the tables rolling up the flow records
+DROP VIEW IF EXISTS flows_rollup_1m_view_local;
+DROP VIEW IF EXISTS flows_rollup_1h_view_local;
+DROP TABLE IF EXISTS flows_rollup_1m;
+DROP TABLE IF EXISTS flows_rollup_1m_local;
+DROP TABLE IF EXISTS flows_rollup_1h;
+DROP TABLE IF EXISTS flows_rollup_1h_local;
@@ -1,3 +1,92 @@
+{{- define "clickhouse.connection.env" }}
+{{- $connection := .connection }}
+- name: CLICKHOUSE_DEBUG
+  value: {{ $connection.debug | quote }}
+- name: CLICKHOUSE_COMPRESS
+  value: {{ $connection.compress | quote }}
+{{- if $connection.readTimeout }}
+- name: CLICKHOUSE_READ_TIMEOUT
+  value: {{ $connection.readTimeout | quote }}
+{{- end }}
+{{- if $connection.altHosts }}
+- name: CLICKHOUSE_ALT_HOSTS
+  value: {{ join "," $connection.altHosts | quote }}
+{{- end }}
+{{- end }}
+
+{{- define "clickhouse.connection.credentials.env" }}
+{{- if .connection.credentialsFromFiles }}
+- name: CLICKHOUSE_USERNAME_FILE
+  value: "/etc/clickhouse-credentials/username"
+- name: CLICKHOUSE_PASSWORD_FILE
+  value: "/etc/clickhouse-credentials/password"
+{{- else }}
+- name: CLICKHOUSE_USERNAME
+  valueFrom:
+    secretKeyRef:
+      name: clickhouse-secret
+      key: username
+- name: CLICKHOUSE_PASSWORD
+  valueFrom:
+    secretKeyRef:
+      name: clickhouse-secret
+      key: password
+{{- end }}
+{{- end }}
+
+{{- define "clickhouse.connection.credentials.volumeMount" }}
+{{- if .connection.credentialsFromFiles }}
+- name: clickhouse-credentials
+  mountPath: /etc/clickhouse-credentials
+  readOnly: true
+{{- end }}
+{{- end }}
+
+{{- define "clickhouse.connection.credentials.volume" }}
+{{- if .connection.credentialsFromFiles }}
+- name: clickhouse-credentials
+  secret:
+    secretName: clickhouse-secret
+    items:
+      - key: username
+        path: username
+      - key: password
+        path: password
+{{- end }}
+{{- end }}
+
+{{- define "clickhouse.connection.tls.env" }}
+{{- $tls := .connection.tls }}
+{{- if $tls.enable }}
+- name: CLICKHOUSE_TLS_CA_FILE
+  value: "/etc/clickhouse-tls/ca.crt"
+- name: CLICKHOUSE_TLS_CERT_FILE
+  value: "/etc/clickhouse-tls/tls.crt"
+- name: CLICKHOUSE_TLS_KEY_FILE
+  value: "/etc/clickhouse-tls/tls.key"
+- name: CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY
+  value: {{ $tls.insecureSkipVerify | quote }}
+- name: CLICKHOUSE_TLS_SECRET
+  value: {{ $tls.secretName | quote }}
+{{- end }}
+{{- end }}
+
+{{- define "clickhouse.connection.tls.volumeMount" }}
+{{- if .connection.tls.enable }}
+- name: clickhouse-client-tls
+  mountPath: /etc/clickhouse-tls
+  readOnly: true
+{{- end }}
+{{- end }}
+
+{{- define "clickhouse.connection.tls.volume" }}
+{{- if .connection.tls.enable }}
+- name: clickhouse-client-tls
+  secret:
+    secretName: {{ .connection.tls.secretName }}
+{{- end }}
+{{- end }}
+
 {{- define "clickhouse.monitor.container" }}
 {{- $clickhouse := .clickhouse }}
 {{- $Chart := .Chart }}
@@ -7,25 +96,43 @@
   volumeMounts:
     - name: clickhouse-monitor-coverage
       mountPath: /clickhouse-monitor-coverage
+    {{- include "clickhouse.connection.credentials.volumeMount" (dict "connection" $clickhouse.connection) | indent 4 }}
+    {{- include "clickhouse.connection.tls.volumeMount" (dict "connection" $clickhouse.connection) | indent 4 }}
+  {{- if $clickhouse.monitor.metrics.enable }}
+  ports:
+    - name: monitor-metrics
+      containerPort: {{ $clickhouse.monitor.metrics.port }}
+  {{- end }}
   env:
-    - name: CLICKHOUSE_USERNAME
-      valueFrom:
-        secretKeyRef: 
-          name: clickhouse-secret
-          key: username
-    - name: CLICKHOUSE_PASSWORD
-      valueFrom:
-        secretKeyRef:
-          name: clickhouse-secret
-          key: password
+    {{- include "clickhouse.connection.credentials.env" (dict "connection" $clickhouse.connection) | indent 4 }}
     - name: DB_URL
+      {{- if $clickhouse.connection.tls.enable }}
+      value: "tcp://localhost:{{ $clickhouse.service.secureConnection.secureTcpPort }}"
+      {{- else }}
       value: "tcp://localhost:9000"
+      {{- end }}
+    - name: CLICKHOUSE_DATABASE
+      value: {{ $clickhouse.database | quote }}
+    {{- include "clickhouse.connection.env" (dict "connection" $clickhouse.connection) | indent 4 }}
+    {{- include "clickhouse.connection.tls.env" (dict "connection" $clickhouse.connection) | indent 4 }}
+    {{- if $clickhouse.connection.tls.enable }}
+    - name: CLICKHOUSE_TLS_SERVER_NAME
+      value: "clickhouse-clickhouse.{{ .namespace }}.svc"
+    {{- end }}
     - name: TABLE_NAME
-      value: "default.flows_local"
+      value: "{{ $clickhouse.database }}.flows_local"
     - name: MV_NAMES
-      value: "default.pod_view_table_local default.node_view_table_local default.policy_view_table_local"
+      value: "{{ $clickhouse.database }}.pod_view_table_local {{ $clickhouse.database }}.node_view_table_local {{ $clickhouse.database }}.policy_view_table_local {{ $clickhouse.database }}.flows_latest_records_local"
     - name: STORAGE_SIZE
       value: {{ $clickhouse.storage.size | quote }}
+    {{- if $clickhouse.storage.coldStorage.enable }}
+    - name: COLD_DISK
+      value: "cold"
+    {{- if eq $clickhouse.storage.coldStorage.type "Local" }}
+    - name: COLD_STORAGE_SIZE
+      value: {{ $clickhouse.storage.coldStorage.local.size | quote }}
+    {{- end }}
+    {{- end }}
     - name: THRESHOLD
       value: {{ $clickhouse.monitor.threshold | quote }}
     - name: DELETE_PERCENTAGE
@@ -34,6 +141,58 @@
       value: {{ $clickhouse.monitor.execInterval }}
     - name: SKIP_ROUNDS_NUM
       value: {{ $clickhouse.monitor.skipRoundsNum | quote }}
+    - name: JITTER_FACTOR
+      value: {{ $clickhouse.monitor.jitterFactor | quote }}
+    {{- if $clickhouse.maxPartitionsPerRun }}
+    - name: MAX_PARTITIONS_PER_RUN
+      value: {{ $clickhouse.maxPartitionsPerRun | quote }}
+    {{- end }}
+    - name: LEADER_ELECTION
+      value: {{ $clickhouse.monitor.leaderElection.enable | quote }}
+    {{- if $clickhouse.monitor.protectedTables }}
+    - name: PROTECTED_TABLES
+      value: {{ join " " $clickhouse.monitor.protectedTables | quote }}
+    {{- end }}
+    {{- if gt (mul (int $clickhouse.cluster.shards) (int $clickhouse.cluster.replicas)) 1 }}
+    - name: CLICKHOUSE_CLUSTER
+      value: "clickhouse"
+    {{- end }}
+    {{- if $clickhouse.monitor.leaderElection.enable }}
+    - name: POD_NAME
+      valueFrom:
+        fieldRef:
+          fieldPath: metadata.name
+    - name: POD_NAMESPACE
+      valueFrom:
+        fieldRef:
+          fieldPath: metadata.namespace
+    {{- end }}
+    {{- if $clickhouse.monitor.pprof.enable }}
+    - name: PPROF_ADDRESS
+      value: "localhost:{{ $clickhouse.monitor.pprof.port }}"
+    {{- end }}
+    {{- if $clickhouse.monitor.metrics.enable }}
+    - name: METRICS_ADDRESS
+      value: ":{{ $clickhouse.monitor.metrics.port }}"
+    {{- end }}
+    {{- if $clickhouse.monitor.webhook.secretName }}
+    - name: WEBHOOK_URL
+      valueFrom:
+        secretKeyRef:
+          name: {{ $clickhouse.monitor.webhook.secretName }}
+          key: url
+    {{- else if $clickhouse.monitor.webhook.url }}
+    - name: WEBHOOK_URL
+      value: {{ $clickhouse.monitor.webhook.url | quote }}
+    {{- end }}
+    {{- if or $clickhouse.monitor.webhook.secretName $clickhouse.monitor.webhook.url }}
+    - name: WEBHOOK_FORMAT
+      value: {{ $clickhouse.monitor.webhook.format | quote }}
+    {{- end }}
+    {{- if .tracing.otlpEndpoint }}
+    - name: THEIA_OTEL_ENDPOINT
+      value: {{ .tracing.otlpEndpoint | quote }}
+    {{- end }}
     - name: GOCOVERDIR
       value: "/clickhouse-monitor-coverage"
 {{- end }}
@@ -43,6 +202,7 @@
 {{- $enablePV := .enablePV }}
 {{- $Chart := .Chart }}
 {{- $tls := .clickhouse.service.secureConnection }}
+{{- $coldStorage := .clickhouse.storage.coldStorage }}
 - name: clickhouse
   image: {{ include "clickHouseServerImage" . | quote }}
   imagePullPolicy: {{ $clickhouse.image.pullPolicy }}
@@ -57,10 +217,15 @@
       mountPath: /opt/certs/tls.key
       subPath: tls.key
     {{- end }}
+    {{- include "clickhouse.connection.tls.volumeMount" (dict "connection" $clickhouse.connection) | indent 4 }}
     {{- if not $enablePV }}
     - name: clickhouse-storage-volume
       mountPath: /var/lib/clickhouse
     {{- end }}
+    {{- if and $coldStorage.enable (eq $coldStorage.type "Local") }}
+    - name: clickhouse-cold-storage-template
+      mountPath: /var/lib/clickhouse-cold
+    {{- end }}
   env:
     - name: THEIA_VERSION
       value: {{ $Chart.Version }}
@@ -68,6 +233,16 @@
       value: "60"
     - name: DB_URL
       value: "localhost:9000"
+    - name: CLICKHOUSE_DATABASE
+      value: {{ $clickhouse.database | quote }}
+    {{- if gt (mul (int $clickhouse.cluster.shards) (int $clickhouse.cluster.replicas)) 1 }}
+    - name: CLICKHOUSE_CLUSTER
+      value: "clickhouse"
+    {{- end }}
+    {{- if $clickhouse.maxPartitionsPerRun }}
+    - name: MAX_PARTITIONS_PER_RUN
+      value: {{ $clickhouse.maxPartitionsPerRun | quote }}
+    {{- end }}
     - name: MIGRATE_USERNAME
       valueFrom:
         secretKeyRef: 
@@ -78,6 +253,39 @@
         secretKeyRef:
           name: clickhouse-secret
           key: password
+    {{- if $clickhouse.users.enable }}
+    {{- range $role := list "writer" "reader" }}
+    - name: CLICKHOUSE_{{ upper $role }}_USERNAME
+      valueFrom:
+        secretKeyRef:
+          name: clickhouse-secret
+          key: {{ $role }}Username
+    - name: CLICKHOUSE_{{ upper $role }}_PASSWORD
+      valueFrom:
+        secretKeyRef:
+          name: clickhouse-secret
+          key: {{ $role }}Password
+    {{- end }}
+    {{- end }}
+    {{- if and $coldStorage.enable (eq $coldStorage.type "S3") }}
+    - name: POD_NAME
+      valueFrom:
+        fieldRef:
+          fieldPath: metadata.name
+    - name: CLICKHOUSE_COLD_STORAGE_ENDPOINT
+      value: "{{ $coldStorage.s3.endpoint }}$(POD_NAME)/"
+    - name: AWS_ACCESS_KEY_ID
+      valueFrom:
+        secretKeyRef:
+          name: {{ $coldStorage.s3.secretName }}
+          key: accessKeyID
+    - name: AWS_SECRET_ACCESS_KEY
+      valueFrom:
+        secretKeyRef:
+          name: {{ $coldStorage.s3.secretName }}
+          key: secretAccessKey
+    {{- end }}
+    {{- include "clickhouse.connection.env" (dict "connection" $clickhouse.connection) | indent 4 }}
 {{- end }}
 
 {{- define "clickhouse.volume" }}
@@ -103,6 +311,8 @@
     secretName: clickhouse-tls
     optional: true
 {{- end }}
+{{- include "clickhouse.connection.credentials.volume" (dict "connection" $clickhouse.connection) }}
+{{- include "clickhouse.connection.tls.volume" (dict "connection" $clickhouse.connection) }}
 {{- if not $enablePV }}
 - name: clickhouse-storage-volume
   emptyDir:
@@ -124,6 +334,15 @@
 {{- end }}
 {{- end -}}
 
+{{- define "clickhouse.storageConfig" -}}
+{{- $Files := .Files }}
+{{- $Global := .Global }}
+{{- range $path, $_ :=  .Files.Glob  "provisioning/storage/*" }}
+{{ regexReplaceAll "(.*)/" $path "" }}: |
+{{ tpl ($.Files.Get $path) $Global | indent 2 }}
+{{- end }}
+{{- end -}}
+
 {{- define "theiaImageTag" -}}
 {{- $tag := .tag -}}
 {{- $Chart := .Chart -}}
@@ -158,3 +377,14 @@
 {{- define "theiaManagerImage" -}}
 {{- print .Values.theiaManager.image.repository ":" (include "theiaManagerImageTag" .) -}}
 {{- end -}}
+
+{{- /*
+Suffix of the names of cluster-scoped resources, so that several Theia
+instances can be installed in different Namespaces of the same cluster. It is
+empty for the default Namespace "flow-visibility".
+*/}}
+{{- define "clusterScopedNameSuffix" -}}
+{{- if ne .Release.Namespace "flow-visibility" }}
+{{- print "-" .Release.Namespace -}}
+{{- end }}
+{{- end -}}
@@ -39,7 +39,7 @@ function echoerr {
 }
 
 _usage="
-Usage: $0 create CLUSTER_NAME [--pod-cidr POD_CIDR] [--antrea-cni] [--num-workers NUM_WORKERS] [--images IMAGES] [--subnets SUBNETS] [--ip-family ipv4|ipv6]
+Usage: $0 create CLUSTER_NAME [--pod-cidr POD_CIDR] [--antrea-cni] [--num-workers NUM_WORKERS] [--images IMAGES] [--subnets SUBNETS] [--ip-family ipv4|ipv6|dual]
                   destroy CLUSTER_NAME
                   help
 where:
@@ -55,7 +55,8 @@ where:
   --images: specifies images loaded to kind cluster, default is $IMAGES
   --subnets: a subnet creates a separate docker bridge network (named 'antrea-<idx>') with assigned subnet that worker nodes may connect to. Default is empty: all worker
     Node connected to default docker bridge network created by Kind.
-  --ip-family: specifies the ip-family for the kind cluster, default is $IP_FAMILY. A valid pod-cidr must be configured in the same family
+  --ip-family: specifies the ip-family for the kind cluster, default is $IP_FAMILY. A valid pod-cidr must be configured in the same family,
+               or a comma-separated IPv4 and IPv6 pod-cidr for a dual-stack cluster
 "
 
 function print_usage {
@@ -224,8 +225,8 @@ function create {
      exit 1
   fi
 
-  if [[ "$IP_FAMILY" != "ipv4" ]] && [[ "$IP_FAMILY" != "ipv6" ]]; then
-    echoerr "Invalid value for --ip-family \"$IP_FAMILY\", expected \"ipv4\" or \"ipv6\""
+  if [[ "$IP_FAMILY" != "ipv4" ]] && [[ "$IP_FAMILY" != "ipv6" ]] && [[ "$IP_FAMILY" != "dual" ]]; then
+    echoerr "Invalid value for --ip-family \"$IP_FAMILY\", expected \"ipv4\", \"ipv6\" or \"dual\""
     exit 1
   fi
 
@@ -22,8 +22,8 @@ function echoerr {
     >&2 echo "$@"
 }
 
-_usage="Usage: $0 [--ip-family <v4|v6>] [--help|-h]
-        --ip-family                   Configures the ipFamily for the KinD cluster.
+_usage="Usage: $0 [--ip-family <v4|v6|dual>] [--help|-h]
+        --ip-family                   Configures the ipFamily for the KinD cluster, dual for a dual-stack cluster.
         --skip                        A comma-separated list of keywords, with which tests should be skipped.
         --setup-only                  Only perform setting up the cluster and run test.
         --cleanup-only                Only perform cleaning up the cluster.
@@ -145,8 +145,10 @@ function setup_cluster {
 
   if [[ "$ipfamily" == "v6" ]]; then
     args="$args --ip-family ipv6 --pod-cidr fd00:10:244::/56"
+  elif [[ "$ipfamily" == "dual" ]]; then
+    args="$args --ip-family dual --pod-cidr 10.244.0.0/16,fd00:10:244::/56"
   elif [[ "$ipfamily" != "v4" ]]; then
-    echoerr "invalid value for --ip-family \"$ipfamily\", expected \"v4\" or \"v6\""
+    echoerr "invalid value for --ip-family \"$ipfamily\", expected \"v4\", \"v6\" or \"dual\""
     exit 1
   fi
 
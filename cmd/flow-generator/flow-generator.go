@@ -0,0 +1,116 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"antrea.io/antrea/pkg/signals"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	clickhouseutil "antrea.io/theia/pkg/util/clickhouse"
+)
+
+const (
+	// Ping to ClickHouse time out if it fails for 30 seconds.
+	pingTimeout = 30 * time.Second
+	// Retry ping to ClickHouse every second if it fails.
+	pingRetryInterval = 1 * time.Second
+	// Log the progress every 10 seconds.
+	progressInterval = 10 * time.Second
+)
+
+func run(o *Options) error {
+	klog.InfoS("Flow generator starting...")
+	stopCh := signals.RegisterSignalHandlers()
+
+	db, err := connect(o)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	g := newGenerator(o)
+	// The batches are inserted at the interval which writes rate flow records
+	// per second.
+	interval := time.Duration(o.batchSize) * time.Second / time.Duration(o.rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	klog.InfoS("Writing flow records", "rate", o.rate, "batchSize", o.batchSize, "interval", interval, "count", o.count)
+
+	start := time.Now()
+	lastProgress := start
+	written := 0
+	for o.count == 0 || written < o.count {
+		batchSize := o.batchSize
+		if o.count > 0 && o.count-written < batchSize {
+			batchSize = o.count - written
+		}
+		now := time.Now()
+		if err := g.insertFlows(db, o.database, batchSize, now); err != nil {
+			return err
+		}
+		written += batchSize
+		if now.Sub(lastProgress) >= progressInterval {
+			klog.InfoS("Wrote flow records", "count", written, "rate", float64(written)/now.Sub(start).Seconds())
+			lastProgress = now
+		}
+		select {
+		case <-stopCh:
+			klog.InfoS("Stopping flow generator", "count", written)
+			return nil
+		case <-ticker.C:
+		}
+	}
+	klog.InfoS("Wrote flow records", "count", written, "duration", time.Since(start))
+	return nil
+}
+
+// connect connects to the ClickHouse server of the options, with the
+// credentials and the TLS options of the environment variables.
+func connect(o *Options) (*sql.DB, error) {
+	credentials, err := clickhouseutil.NewCredentialsProviderFromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	if credentials == nil {
+		return nil, fmt.Errorf("the credentials of ClickHouse should be set with CLICKHOUSE_USERNAME and CLICKHOUSE_PASSWORD, or CLICKHOUSE_USERNAME_FILE and CLICKHOUSE_PASSWORD_FILE")
+	}
+	options, err := clickhouseutil.NewDSNOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	options.Credentials = credentials
+	options.Database = o.database
+	if err := options.RegisterTLSConfig(); err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(options.Connector(o.clickHouseURL))
+	var pingErr error
+	if err := wait.PollImmediate(pingRetryInterval, pingTimeout, func() (bool, error) {
+		if pingErr = db.Ping(); pingErr != nil {
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to ClickHouse after %s: %s", pingTimeout, clickhouseutil.ScrubDSN(pingErr.Error()))
+	}
+	return db, nil
+}
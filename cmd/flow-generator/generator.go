@@ -0,0 +1,321 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// The columns of the flows table written by the generator, in the order
+	// of the values returned by generator.flow. The other columns have their
+	// default values.
+	insertFlowsQuery = `INSERT INTO %s.flows (
+    flowStartSeconds,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    flowEndReason,
+    sourceIP,
+    destinationIP,
+    sourceTransportPort,
+    destinationTransportPort,
+    protocolIdentifier,
+    packetTotalCount,
+    octetTotalCount,
+    packetDeltaCount,
+    octetDeltaCount,
+    reversePacketTotalCount,
+    reverseOctetTotalCount,
+    reversePacketDeltaCount,
+    reverseOctetDeltaCount,
+    sourcePodName,
+    sourcePodNamespace,
+    sourceNodeName,
+    destinationPodName,
+    destinationPodNamespace,
+    destinationNodeName,
+    destinationClusterIP,
+    destinationServicePort,
+    destinationServicePortName,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleName,
+    ingressNetworkPolicyRuleAction,
+    ingressNetworkPolicyType,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleName,
+    egressNetworkPolicyRuleAction,
+    egressNetworkPolicyType,
+    tcpState,
+    flowType,
+    sourcePodLabels,
+    destinationPodLabels,
+    throughput,
+    reverseThroughput,
+    throughputFromSourceNode,
+    throughputFromDestinationNode,
+    reverseThroughputFromSourceNode,
+    reverseThroughputFromDestinationNode,
+    clusterUUID,
+    egressName,
+    egressIP)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+        ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+        ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+        ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+        ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	// The values of the flow records, as exported by the Flow Aggregator.
+	flowEndReasonActiveTimeout = 2
+	protocolTCP                = 6
+	flowTypeIntraNode          = 1
+	flowTypeInterNode          = 2
+	flowTypeToExternal         = 3
+	ruleActionAllow            = 1
+	policyTypeK8s              = 1
+	// The port the Pods of the applications listen on, and the port of their
+	// Services.
+	appPort     = 8080
+	servicePort = 80
+	// The maximum duration of a flow before its record is exported.
+	maxFlowDuration = 60
+)
+
+// pod is a Pod of the synthetic flow records.
+type pod struct {
+	namespace string
+	name      string
+	// labels is the JSON of the labels of the Pod, as in the flow records.
+	labels string
+	node   string
+	ip     string
+	// app is the index of the application of the Pod in its Namespace.
+	app int
+}
+
+// generator generates the flow records between the Pods of the Namespaces,
+// their Services and external IPs. The Pods, Services and NetworkPolicies
+// only depend on the options, so that the flow records written by several
+// runs with the same options are from the same workloads.
+type generator struct {
+	rand *rand.Rand
+	// pods are the Pods of each Namespace.
+	pods                 [][]pod
+	externalIPs          []string
+	policiesPerNamespace int
+	externalFlowsRatio   float64
+	serviceFlowsRatio    float64
+	timeWindow           time.Duration
+	clusterUUID          string
+}
+
+func newGenerator(o *Options) *generator {
+	r := rand.New(rand.NewSource(o.seed))
+	g := &generator{
+		rand:                 r,
+		pods:                 make([][]pod, o.namespaces),
+		policiesPerNamespace: o.policiesPerNamespace,
+		externalFlowsRatio:   o.externalFlowsRatio,
+		serviceFlowsRatio:    o.serviceFlowsRatio,
+		timeWindow:           o.timeWindow,
+	}
+	clusterUUID, _ := uuid.NewRandomFromReader(r)
+	g.clusterUUID = clusterUUID.String()
+	for ns := 0; ns < o.namespaces; ns++ {
+		for i := 0; i < o.podsPerNamespace; i++ {
+			app := i % o.appsPerNamespace
+			g.pods[ns] = append(g.pods[ns], pod{
+				namespace: namespaceName(ns),
+				name:      fmt.Sprintf("%s-%d", appName(app), i/o.appsPerNamespace),
+				labels:    fmt.Sprintf(`{"app":"%s"}`, appName(app)),
+				node:      fmt.Sprintf("node-%d", (ns*o.podsPerNamespace+i)%o.nodes),
+				ip:        indexToIP(10<<24|uint32(ns)<<16, i+1),
+				app:       app,
+			})
+		}
+	}
+	documentationRanges := []uint32{192<<24 | 2<<8, 198<<24 | 51<<16 | 100<<8, 203<<24 | 113<<8}
+	for i := 0; i < o.externalIPs; i++ {
+		g.externalIPs = append(g.externalIPs, indexToIP(documentationRanges[i/254], i%254+1))
+	}
+	return g
+}
+
+func namespaceName(ns int) string {
+	return fmt.Sprintf("flowgen-%d", ns)
+}
+
+func appName(app int) string {
+	return fmt.Sprintf("app-%d", app)
+}
+
+// policyName returns the name of the NetworkPolicy allowing the ingress
+// traffic of the application, or "" if the application has no
+// NetworkPolicy.
+func (g *generator) policyName(app int) string {
+	if app >= g.policiesPerNamespace {
+		return ""
+	}
+	return fmt.Sprintf("allow-%s", appName(app))
+}
+
+// serviceIP returns the ClusterIP of the Service of the application, in
+// 172.16.0.0/12.
+func serviceIP(ns, app int) string {
+	return indexToIP(172<<24|16<<16, ns<<12|(app+1))
+}
+
+func indexToIP(base uint32, index int) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, base+uint32(index))
+	return ip.String()
+}
+
+// flow returns the values of a random flow record which ends before now, in
+// the order of the columns of insertFlowsQuery.
+func (g *generator) flow(now time.Time) []interface{} {
+	flowEnd := now
+	if g.timeWindow > 0 {
+		flowEnd = now.Add(-time.Duration(g.rand.Int63n(int64(g.timeWindow))))
+	}
+	flowEnd = flowEnd.Truncate(time.Second)
+	duration := 1 + g.rand.Intn(maxFlowDuration)
+	flowStart := flowEnd.Add(-time.Duration(duration) * time.Second)
+
+	namespace := g.pods[g.rand.Intn(len(g.pods))]
+	source := namespace[g.rand.Intn(len(namespace))]
+	var destination pod
+	var destinationIP, destinationClusterIP, destinationServicePortName string
+	var destinationServicePort uint16
+	var flowType uint8
+	if g.rand.Float64() < g.externalFlowsRatio {
+		destinationIP = g.externalIPs[g.rand.Intn(len(g.externalIPs))]
+		flowType = flowTypeToExternal
+	} else {
+		ns := g.rand.Intn(len(g.pods))
+		destination = g.pods[ns][g.rand.Intn(len(g.pods[ns]))]
+		destinationIP = destination.ip
+		flowType = flowTypeInterNode
+		if source.node == destination.node {
+			flowType = flowTypeIntraNode
+		}
+		if g.rand.Float64() < g.serviceFlowsRatio {
+			destinationClusterIP = serviceIP(ns, destination.app)
+			destinationServicePort = servicePort
+			destinationServicePortName = fmt.Sprintf("%s/%s:http", destination.namespace, appName(destination.app))
+		}
+	}
+	var ingressPolicyName, ingressPolicyNamespace string
+	var ingressPolicyAction, ingressPolicyType uint8
+	if destination.name != "" {
+		if ingressPolicyName = g.policyName(destination.app); ingressPolicyName != "" {
+			ingressPolicyNamespace = destination.namespace
+			ingressPolicyAction = ruleActionAllow
+			ingressPolicyType = policyTypeK8s
+		}
+	}
+
+	packets := uint64(1 + g.rand.Intn(1000))
+	octets := packets * uint64(64+g.rand.Intn(1437))
+	reversePackets := packets / 2
+	reverseOctets := octets / 4
+	throughput := octets * 8 / uint64(duration)
+	reverseThroughput := reverseOctets * 8 / uint64(duration)
+	return []interface{}{
+		flowStart,
+		flowEnd,
+		flowEnd,
+		flowEnd,
+		uint8(flowEndReasonActiveTimeout),
+		source.ip,
+		destinationIP,
+		uint16(32768 + g.rand.Intn(28232)),
+		uint16(appPort),
+		uint8(protocolTCP),
+		packets,
+		octets,
+		packets,
+		octets,
+		reversePackets,
+		reverseOctets,
+		reversePackets,
+		reverseOctets,
+		source.name,
+		source.namespace,
+		source.node,
+		destination.name,
+		destination.namespace,
+		destination.node,
+		destinationClusterIP,
+		destinationServicePort,
+		destinationServicePortName,
+		ingressPolicyName,
+		ingressPolicyNamespace,
+		"",
+		ingressPolicyAction,
+		ingressPolicyType,
+		"",
+		"",
+		"",
+		uint8(0),
+		uint8(0),
+		"ESTABLISHED",
+		flowType,
+		source.labels,
+		destination.labels,
+		throughput,
+		reverseThroughput,
+		throughput,
+		throughput,
+		reverseThroughput,
+		reverseThroughput,
+		g.clusterUUID,
+		"",
+		"",
+	}
+}
+
+// insertFlows writes count random flow records in a single insert, which the
+// ClickHouse driver sends as a block when the transaction is committed.
+func (g *generator) insertFlows(db *sql.DB, database string, count int, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf(insertFlowsQuery, database))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare insert: %v", err)
+	}
+	defer stmt.Close()
+	for i := 0; i < count; i++ {
+		if _, err := stmt.Exec(g.flow(now)...); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to insert flow record: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow records: %v", err)
+	}
+	return nil
+}
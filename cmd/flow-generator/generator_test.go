@@ -0,0 +1,146 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratorFlow(t *testing.T) {
+	o := newOptions()
+	o.namespaces = 2
+	o.appsPerNamespace = 2
+	o.podsPerNamespace = 4
+	o.timeWindow = time.Hour
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	columns := strings.Count(insertFlowsQuery, "?")
+
+	g := newGenerator(o)
+	require.Len(t, g.pods, 2)
+	assert.Equal(t, pod{namespace: "flowgen-1", name: "app-1-1", labels: `{"app":"app-1"}`, node: "node-1", ip: "10.1.0.4", app: 1}, g.pods[1][3])
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, g.externalIPs[:2])
+	pods := map[string]bool{}
+	flowTypes := map[uint8]bool{}
+	for i := 0; i < 1000; i++ {
+		flow := g.flow(now)
+		require.Len(t, flow, columns)
+		flowStart, flowEnd := flow[0].(time.Time), flow[1].(time.Time)
+		assert.True(t, flowStart.Before(flowEnd))
+		assert.False(t, flowEnd.After(now))
+		assert.False(t, flowEnd.Before(now.Add(-o.timeWindow)))
+		assert.NotNil(t, net.ParseIP(flow[5].(string)))
+		assert.NotNil(t, net.ParseIP(flow[6].(string)))
+		pods[fmt.Sprintf("%s/%s", flow[19], flow[18])] = true
+		flowType := flow[38].(uint8)
+		flowTypes[flowType] = true
+		destinationPodName := flow[21].(string)
+		if flowType == flowTypeToExternal {
+			assert.Empty(t, destinationPodName)
+			assert.Empty(t, flow[27])
+			continue
+		}
+		// Only the Pods of app-0 are protected by a NetworkPolicy.
+		if strings.HasPrefix(destinationPodName, "app-0-") {
+			assert.Equal(t, "allow-app-0", flow[27])
+			assert.Equal(t, flow[22], flow[28])
+		} else {
+			assert.Empty(t, flow[27])
+		}
+		if destinationServicePortName := flow[26].(string); destinationServicePortName != "" {
+			assert.True(t, strings.HasPrefix(destinationServicePortName, fmt.Sprintf("%s/%s:", flow[22], flow[40].(string)[8:13])))
+		}
+	}
+	assert.Len(t, pods, 8)
+	assert.Len(t, flowTypes, 3)
+
+	// The same seed generates the same flow records.
+	assert.Equal(t, newGenerator(o).flow(now), newGenerator(o).flow(now))
+}
+
+func TestInsertFlows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	g := newGenerator(newOptions())
+
+	mock.ExpectBegin()
+	prepare := mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO default.flows ("))
+	for i := 0; i < 3; i++ {
+		prepare.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	require.NoError(t, g.insertFlows(db, "default", 3, time.Now()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO default.flows (")).ExpectExec().WillReturnError(fmt.Errorf("mock_error"))
+	mock.ExpectRollback()
+	assert.ErrorContains(t, g.insertFlows(db, "default", 3, time.Now()), "failed to insert flow record: mock_error")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name             string
+		update           func(o *Options)
+		expectedErrorMsg string
+	}{
+		{
+			name:   "Valid case",
+			update: func(o *Options) {},
+		},
+		{
+			name:             "Too many Namespaces",
+			update:           func(o *Options) { o.namespaces = 257 },
+			expectedErrorMsg: "namespaces should be an integer between 1 and 256",
+		},
+		{
+			name:             "More applications than Pods",
+			update:           func(o *Options) { o.appsPerNamespace = 11 },
+			expectedErrorMsg: "apps-per-namespace should not be greater than pods-per-namespace",
+		},
+		{
+			name:             "More NetworkPolicies than applications",
+			update:           func(o *Options) { o.policiesPerNamespace = 4 },
+			expectedErrorMsg: "policies-per-namespace should be an integer between 0 and apps-per-namespace",
+		},
+		{
+			name:             "External flows without external IPs",
+			update:           func(o *Options) { o.externalIPs = 0 },
+			expectedErrorMsg: "external-ips should be positive if external-flows-ratio is positive",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions()
+			tt.update(o)
+			err := o.validate(nil)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
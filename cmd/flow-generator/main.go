@@ -0,0 +1,61 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main under directory cmd parses and validates user input,
+// instantiates and initializes objects imported from pkg, and runs
+// the process.
+package main
+
+import (
+	"os"
+
+	"antrea.io/antrea/pkg/log"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+)
+
+func main() {
+	command := newFlowGeneratorCommand()
+	if err := command.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newFlowGeneratorCommand() *cobra.Command {
+	opts := newOptions()
+
+	cmd := &cobra.Command{
+		Use: "flow-generator",
+		Long: `The flow generator, writing synthetic flow records directly into ClickHouse
+at a given rate and cardinality, to load test Theia without a busy cluster.
+The credentials of ClickHouse are read from the CLICKHOUSE_USERNAME and
+CLICKHOUSE_PASSWORD, or CLICKHOUSE_USERNAME_FILE and CLICKHOUSE_PASSWORD_FILE,
+environment variables.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			log.InitLogs(cmd.Flags())
+			defer log.FlushLogs()
+			if err := opts.validate(args); err != nil {
+				klog.Fatalf("Failed to validate args: %v", err)
+			}
+			if err := run(opts); err != nil {
+				klog.Fatalf("Error running flow generator: %v", err)
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	opts.addFlags(flags)
+	log.AddFlags(flags)
+	return cmd
+}
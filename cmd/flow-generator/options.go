@@ -0,0 +1,163 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	defaultClickHouseURL = "tcp://localhost:9000"
+	defaultDatabase      = "default"
+	defaultRate          = 1000
+	defaultBatchSize     = 1000
+	// The number of Pods of a Namespace is limited so that their IPs are in
+	// the /16 of the Namespace.
+	maxPodsPerNamespace = 65534
+	// The number of Namespaces is limited so that the IPs of their Pods are in
+	// 10.0.0.0/8.
+	maxNamespaces = 256
+	// The number of applications of a Namespace is limited so that the
+	// ClusterIPs of their Services are in the /20 of the Namespace in
+	// 172.16.0.0/12.
+	maxAppsPerNamespace = 4094
+	// The external IPs are in the documentation ranges 192.0.2.0/24,
+	// 198.51.100.0/24 and 203.0.113.0/24.
+	maxExternalIPs = 3 * 254
+)
+
+type Options struct {
+	// The address of the ClickHouse server, e.g. tcp://localhost:9000.
+	clickHouseURL string
+	// The database of the flows table.
+	database string
+	// The number of flow records written per second.
+	rate int
+	// The number of flow records written per insert.
+	batchSize int
+	// The number of flow records written before exiting, 0 to write them
+	// until interrupted.
+	count int
+	// The flow records end at a random time of the last timeWindow, 0 for
+	// the flow records to end at the time they are written.
+	timeWindow time.Duration
+	// The cardinality of the flow records.
+	namespaces           int
+	appsPerNamespace     int
+	podsPerNamespace     int
+	nodes                int
+	policiesPerNamespace int
+	externalIPs          int
+	externalFlowsRatio   float64
+	serviceFlowsRatio    float64
+	seed                 int64
+}
+
+func newOptions() *Options {
+	return &Options{
+		clickHouseURL:        defaultClickHouseURL,
+		database:             defaultDatabase,
+		rate:                 defaultRate,
+		batchSize:            defaultBatchSize,
+		namespaces:           10,
+		appsPerNamespace:     3,
+		podsPerNamespace:     10,
+		nodes:                3,
+		policiesPerNamespace: 1,
+		externalIPs:          10,
+		externalFlowsRatio:   0.1,
+		serviceFlowsRatio:    0.5,
+		seed:                 1,
+	}
+}
+
+// addFlags adds flags to fs and binds them to options.
+func (o *Options) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.clickHouseURL, "clickhouse-url", o.clickHouseURL, "The address of the ClickHouse server, e.g. tcp://localhost:9000 when port-forwarding the ClickHouse Service")
+	fs.StringVar(&o.database, "database", o.database, "The ClickHouse database storing the flow records")
+	fs.IntVar(&o.rate, "rate", o.rate, "The number of flow records written per second")
+	fs.IntVar(&o.batchSize, "batch-size", o.batchSize, "The number of flow records written per insert")
+	fs.IntVar(&o.count, "count", o.count, "The number of flow records written before exiting, 0 to write them until interrupted")
+	fs.DurationVar(&o.timeWindow, "time-window", o.timeWindow, "The flow records end at a random time of this last period, e.g. 24h to backfill a day of flow records, 0 for the flow records to end when they are written")
+	fs.IntVar(&o.namespaces, "namespaces", o.namespaces, "The number of Namespaces of the Pods")
+	fs.IntVar(&o.appsPerNamespace, "apps-per-namespace", o.appsPerNamespace, "The number of applications of a Namespace, each with its Pod labels and Service")
+	fs.IntVar(&o.podsPerNamespace, "pods-per-namespace", o.podsPerNamespace, "The number of Pods of a Namespace, spread across its applications")
+	fs.IntVar(&o.nodes, "nodes", o.nodes, "The number of Nodes running the Pods")
+	fs.IntVar(&o.policiesPerNamespace, "policies-per-namespace", o.policiesPerNamespace, "The number of NetworkPolicies of a Namespace, each allowing the ingress traffic of an application, the traffic of the other applications is unprotected")
+	fs.IntVar(&o.externalIPs, "external-ips", o.externalIPs, "The number of external IPs the Pods connect to")
+	fs.Float64Var(&o.externalFlowsRatio, "external-flows-ratio", o.externalFlowsRatio, "The ratio of the flow records from a Pod to an external IP")
+	fs.Float64Var(&o.serviceFlowsRatio, "service-flows-ratio", o.serviceFlowsRatio, "The ratio of the flow records between Pods which go through the Service of the destination")
+	fs.Int64Var(&o.seed, "seed", o.seed, "The seed of the random flow records, the same seed generates the same Pods, Services and NetworkPolicies")
+}
+
+// validate validates all the required options.
+func (o *Options) validate(args []string) error {
+	if len(args) != 0 {
+		return errors.New("no positional arguments are supported")
+	}
+	if o.clickHouseURL == "" {
+		return errors.New("clickhouse-url should not be empty")
+	}
+	if o.database == "" {
+		return errors.New("database should not be empty")
+	}
+	if o.rate <= 0 {
+		return fmt.Errorf("rate should be a positive integer")
+	}
+	if o.batchSize <= 0 {
+		return fmt.Errorf("batch-size should be a positive integer")
+	}
+	if o.count < 0 {
+		return fmt.Errorf("count should be an integer >= 0")
+	}
+	if o.timeWindow < 0 {
+		return fmt.Errorf("time-window should not be negative")
+	}
+	if o.namespaces <= 0 || o.namespaces > maxNamespaces {
+		return fmt.Errorf("namespaces should be an integer between 1 and %d", maxNamespaces)
+	}
+	if o.podsPerNamespace <= 0 || o.podsPerNamespace > maxPodsPerNamespace {
+		return fmt.Errorf("pods-per-namespace should be an integer between 1 and %d", maxPodsPerNamespace)
+	}
+	if o.appsPerNamespace <= 0 || o.appsPerNamespace > maxAppsPerNamespace {
+		return fmt.Errorf("apps-per-namespace should be an integer between 1 and %d", maxAppsPerNamespace)
+	}
+	if o.appsPerNamespace > o.podsPerNamespace {
+		return fmt.Errorf("apps-per-namespace should not be greater than pods-per-namespace")
+	}
+	if o.nodes <= 0 {
+		return fmt.Errorf("nodes should be a positive integer")
+	}
+	if o.policiesPerNamespace < 0 || o.policiesPerNamespace > o.appsPerNamespace {
+		return fmt.Errorf("policies-per-namespace should be an integer between 0 and apps-per-namespace")
+	}
+	if o.externalIPs < 0 || o.externalIPs > maxExternalIPs {
+		return fmt.Errorf("external-ips should be an integer between 0 and %d", maxExternalIPs)
+	}
+	if o.externalFlowsRatio < 0 || o.externalFlowsRatio > 1 {
+		return fmt.Errorf("external-flows-ratio should be between 0 and 1")
+	}
+	if o.externalFlowsRatio > 0 && o.externalIPs == 0 {
+		return fmt.Errorf("external-ips should be positive if external-flows-ratio is positive")
+	}
+	if o.serviceFlowsRatio < 0 || o.serviceFlowsRatio > 1 {
+		return fmt.Errorf("service-flows-ratio should be between 0 and 1")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	defaultPort         = 11348
+	defaultPollInterval = 5 * time.Second
+)
+
+type Options struct {
+	// The port for the gRPC server to serve on.
+	port int
+	// The interval at which each subscription polls ClickHouse for new flow
+	// records.
+	pollInterval time.Duration
+	// The TLS certificate and private key of the gRPC server, which are
+	// required unless insecure is set.
+	tlsCertFile string
+	tlsKeyFile  string
+	// Indicates whether to serve without TLS, in which case the bearer
+	// tokens of the subscribers are sent in plaintext.
+	insecure bool
+}
+
+func newOptions() *Options {
+	return &Options{
+		port:         defaultPort,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// addFlags adds flags to fs and binds them to options.
+func (o *Options) addFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&o.port, "port", o.port, "The port for the gRPC server to serve on")
+	fs.DurationVar(&o.pollInterval, "poll-interval", o.pollInterval, "The interval at which new flow records are polled from ClickHouse")
+	fs.StringVar(&o.tlsCertFile, "tls-cert-file", o.tlsCertFile, "The path to the TLS certificate of the gRPC server")
+	fs.StringVar(&o.tlsKeyFile, "tls-private-key-file", o.tlsKeyFile, "The path to the TLS private key of the gRPC server")
+	fs.BoolVar(&o.insecure, "insecure", o.insecure, "Serve the gRPC server without TLS, sending the bearer tokens of the subscribers in plaintext")
+}
+
+// validate validates all the required options.
+func (o *Options) validate(args []string) error {
+	if len(args) != 0 {
+		return errors.New("no positional arguments are supported")
+	}
+	if o.port <= 0 || o.port > 65535 {
+		return fmt.Errorf("invalid port %d", o.port)
+	}
+	if o.pollInterval < time.Second {
+		return fmt.Errorf("poll-interval should be at least 1s")
+	}
+	if (o.tlsCertFile == "") != (o.tlsKeyFile == "") {
+		return fmt.Errorf("tls-cert-file and tls-private-key-file should be provided together")
+	}
+	if o.tlsCertFile == "" && !o.insecure {
+		return fmt.Errorf("tls-cert-file and tls-private-key-file should be provided unless insecure is set")
+	}
+	if o.tlsCertFile != "" && o.insecure {
+		return fmt.Errorf("tls-cert-file and tls-private-key-file should not be provided when insecure is set")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"antrea.io/antrea/pkg/log"
+	"antrea.io/antrea/pkg/signals"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	exporterv1alpha1 "antrea.io/theia/pkg/apis/exporter/v1alpha1"
+	"antrea.io/theia/pkg/exporter"
+	"antrea.io/theia/pkg/util/tracing"
+)
+
+// Maximum time to wait for the remaining spans to be exported when exiting.
+const tracingShutdownTimeout = 5 * time.Second
+
+func run(o *Options) error {
+	klog.InfoS("Theia exporter starting...")
+	stopCh := signals.RegisterSignalHandlers()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log.StartLogFileNumberMonitor(stopCh)
+
+	shutdownTracing, err := tracing.Setup(ctx, "theia-exporter")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			klog.ErrorS(err, "Error when exporting the traces")
+		}
+	}()
+
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("error when generating KubeConfig: %v", err)
+	}
+	kubeConfig.Wrap(tracing.WrapTransport)
+	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("error when generating kubernetes client: %v", err)
+	}
+
+	var serverOptions []grpc.ServerOption
+	if o.tlsCertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(o.tlsCertFile, o.tlsKeyFile)
+		if err != nil {
+			return fmt.Errorf("error when loading the TLS certificate: %v", err)
+		}
+		serverOptions = append(serverOptions, grpc.Creds(creds))
+	} else {
+		klog.InfoS("Serving without TLS as insecure is set, the bearer tokens of the subscribers are sent in plaintext")
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
+	exporterv1alpha1.RegisterFlowExporterServer(grpcServer, exporter.NewServer(kubeClient, o.pollInterval))
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", o.port))
+	if err != nil {
+		return fmt.Errorf("error when listening on port %d: %v", o.port, err)
+	}
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			klog.ErrorS(err, "gRPC server stopped")
+		}
+	}()
+
+	<-stopCh
+	klog.InfoS("Stopping theia exporter")
+	// Subscriptions without an end time never complete, so they are not waited for.
+	grpcServer.Stop()
+	return nil
+}
@@ -16,13 +16,25 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/pflag"
 	"gopkg.in/yaml.v2"
 
 	"antrea.io/theia/pkg/apis"
 	managerconfig "antrea.io/theia/pkg/config/theiamanager"
+	controllerutil "antrea.io/theia/pkg/controller"
+	"antrea.io/theia/pkg/controller/analyticsjob"
+	"antrea.io/theia/pkg/controller/report"
+	"antrea.io/theia/pkg/resultstore"
+)
+
+const (
+	defaultReverseDNSInterval  = time.Minute
+	defaultReportWindow        = 24 * time.Hour
+	defaultFlowSummaryInterval = 5 * time.Minute
 )
 
 type Options struct {
@@ -61,6 +73,39 @@ func (o *Options) validate(args []string) error {
 	if len(args) != 0 {
 		return errors.New("no positional arguments are supported")
 	}
+	if o.config.FlowEnrichment.ReverseDNSInterval != "" {
+		interval, err := time.ParseDuration(o.config.FlowEnrichment.ReverseDNSInterval)
+		if err != nil {
+			return fmt.Errorf("invalid reverseDNSInterval: %v", err)
+		}
+		if interval < 0 {
+			return fmt.Errorf("reverseDNSInterval should not be negative")
+		}
+	}
+	if err := report.ValidateConfig(o.config.Reports); err != nil {
+		return fmt.Errorf("invalid reports: %v", err)
+	}
+	if err := resultstore.ValidateConfig(o.config.RecommendationResults); err != nil {
+		return fmt.Errorf("invalid recommendationResults: %v", err)
+	}
+	if o.config.RecommendationJobs.MaxConcurrentJobs < 0 {
+		return fmt.Errorf("maxConcurrentJobs should not be negative")
+	}
+	if err := controllerutil.ValidateSparkOperatorConfig(o.config.SparkOperator); err != nil {
+		return fmt.Errorf("invalid sparkOperator: %v", err)
+	}
+	if err := analyticsjob.ValidateJobTemplates(o.config.JobTemplates); err != nil {
+		return fmt.Errorf("invalid jobTemplates: %v", err)
+	}
+	if o.config.OpenTelemetryLogs.FlowSummaryInterval != "" {
+		interval, err := time.ParseDuration(o.config.OpenTelemetryLogs.FlowSummaryInterval)
+		if err != nil {
+			return fmt.Errorf("invalid flowSummaryInterval: %v", err)
+		}
+		if interval < 0 {
+			return fmt.Errorf("flowSummaryInterval should not be negative")
+		}
+	}
 	return nil
 }
 
@@ -84,6 +129,30 @@ func (o *Options) setDefaults() {
 	if o.config.APIServer.SelfSignedCert == nil {
 		o.config.APIServer.SelfSignedCert = ptrBool(true)
 	}
+	if o.config.FlowEnrichment.Enable == nil {
+		o.config.FlowEnrichment.Enable = ptrBool(true)
+	}
+	if o.config.FlowEnrichment.ReverseDNSInterval == "" {
+		o.config.FlowEnrichment.ReverseDNSInterval = defaultReverseDNSInterval.String()
+	}
+	if o.config.OpenTelemetryLogs.FlowSummaryInterval == "" {
+		o.config.OpenTelemetryLogs.FlowSummaryInterval = defaultFlowSummaryInterval.String()
+	}
+	if o.config.SparkOperator.PodLabelSelector == "" {
+		o.config.SparkOperator.PodLabelSelector = controllerutil.DefaultSparkOperatorPodLabelSelector
+	}
+	if o.config.SparkOperator.APIVersion == "" {
+		o.config.SparkOperator.APIVersion = controllerutil.DefaultSparkApplicationAPIVersion
+	}
+	for i := range o.config.Reports.Schedules {
+		schedule := &o.config.Reports.Schedules[i]
+		if schedule.Window == "" {
+			schedule.Window = defaultReportWindow.String()
+		}
+		if schedule.Format == "" {
+			schedule.Format = report.FormatHTML
+		}
+	}
 }
 
 func ptrBool(value bool) *bool {
@@ -27,6 +27,8 @@ import (
 	"antrea.io/antrea/pkg/util/cipher"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
@@ -36,9 +38,18 @@ import (
 	"antrea.io/theia/pkg/apiserver/utils/stats"
 	crdclientset "antrea.io/theia/pkg/client/clientset/versioned"
 	crdinformers "antrea.io/theia/pkg/client/informers/externalversions"
+	controllerutil "antrea.io/theia/pkg/controller"
+	"antrea.io/theia/pkg/controller/analyticsjob"
 	"antrea.io/theia/pkg/controller/anomalydetector"
+	"antrea.io/theia/pkg/controller/flowenrichment"
+	"antrea.io/theia/pkg/controller/flowsummary"
 	"antrea.io/theia/pkg/controller/networkpolicyrecommendation"
+	"antrea.io/theia/pkg/controller/report"
 	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/resultstore"
+	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/util/otellog"
+	"antrea.io/theia/pkg/util/tracing"
 )
 
 // informerDefaultResync is the default resync period if a handler doesn't specify one.
@@ -46,6 +57,10 @@ import (
 // https://github.com/kubernetes/kubernetes/blob/release-1.17/pkg/controller/apis/config/v1alpha1/defaults.go#L120
 const informerDefaultResync = 12 * time.Hour
 
+// Maximum time to wait for the remaining spans and log records to be exported
+// when exiting.
+const tracingShutdownTimeout = 5 * time.Second
+
 func createAPIServerConfig(
 	client kubernetes.Interface,
 	kubeConfig *rest.Config,
@@ -53,9 +68,11 @@ func createAPIServerConfig(
 	bindPort int,
 	cipherSuites []uint16,
 	tlsMinVersion uint16,
+	enableProfiling bool,
 	nprq querier.NPRecommendationQuerier,
 	chq querier.ClickHouseStatQuerier,
 	tadq querier.ThroughputAnomalyDetectorQuerier,
+	ajq querier.AnalyticsJobQuerier,
 ) (*apiserver.Config, error) {
 	secureServing := genericoptions.NewSecureServingOptions().WithLoopback()
 	authentication := genericoptions.NewDelegatingAuthenticationOptions()
@@ -66,7 +83,13 @@ func createAPIServerConfig(
 		return nil, fmt.Errorf("error applying server cert: %v", err)
 	}
 
+	// Listen on the IPv6 addresses when the primary IP of the Pod is an IPv6
+	// address, i.e. in IPv6 and IPv6-primary dual-stack clusters, whose
+	// Services are IPv6 by default.
 	secureServing.BindAddress = net.IPv4zero
+	if podIP := env.GetPodIP(); podIP != nil && podIP.To4() == nil {
+		secureServing.BindAddress = net.IPv6zero
+	}
 	secureServing.BindPort = bindPort
 
 	authentication.WithRequestTimeout(apiserver.AuthenticationTimeout)
@@ -91,6 +114,7 @@ func createAPIServerConfig(
 
 	serverConfig.SecureServing.CipherSuites = cipherSuites
 	serverConfig.SecureServing.MinTLSVersion = tlsMinVersion
+	serverConfig.EnableProfiling = enableProfiling
 
 	return apiserver.NewConfig(
 		serverConfig,
@@ -99,7 +123,8 @@ func createAPIServerConfig(
 		caCertController,
 		nprq,
 		chq,
-		tadq), nil
+		tadq,
+		ajq), nil
 }
 
 func run(o *Options) error {
@@ -116,10 +141,35 @@ func run(o *Options) error {
 
 	log.StartLogFileNumberMonitor(stopCh)
 
+	shutdownTracing, err := tracing.Setup(ctx, "theia-manager")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			klog.ErrorS(err, "Error when exporting the traces")
+		}
+	}()
+
+	shutdownLogs, err := otellog.Setup(o.config.OpenTelemetryLogs.Endpoint, "theia-manager")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownLogs(shutdownCtx); err != nil {
+			klog.ErrorS(err, "Error when exporting the OpenTelemetry logs")
+		}
+	}()
+
 	kubeConfig, err := rest.InClusterConfig()
 	if err != nil {
 		return fmt.Errorf("error when generating KubeConfig: %v", err)
 	}
+	kubeConfig.Wrap(tracing.WrapTransport)
 	kubeClient, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
 		return fmt.Errorf("error when generating kubernetes client: %v", err)
@@ -128,12 +178,50 @@ func run(o *Options) error {
 	if err != nil {
 		return fmt.Errorf("error when generating CRD client: %v", err)
 	}
+	// The dynamic client is only needed, and allowed, to apply the policies
+	// of the canary rollouts.
+	var dynamicClient dynamic.Interface
+	if o.config.RecommendationJobs.EnableCanaryRollouts {
+		dynamicClient, err = dynamic.NewForConfig(kubeConfig)
+		if err != nil {
+			return fmt.Errorf("error when generating dynamic client: %v", err)
+		}
+	}
 	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, informerDefaultResync)
 	npRecommendationInformer := crdInformerFactory.Crd().V1alpha1().NetworkPolicyRecommendations()
-	npRecoController := networkpolicyrecommendation.NewNPRecommendationController(crdClient, kubeClient, npRecommendationInformer)
+	resultStore, err := resultstore.New(o.config.RecommendationResults, kubeClient, env.GetTheiaNamespace())
+	if err != nil {
+		return fmt.Errorf("error when creating recommendation result store: %v", err)
+	}
+	controllerutil.SetSparkOperator(o.config.SparkOperator)
+	npRecoController := networkpolicyrecommendation.NewNPRecommendationController(crdClient, kubeClient, dynamicClient, npRecommendationInformer, resultStore, o.config.RecommendationJobs.MaxConcurrentJobs)
 	taDetectorInformer := crdInformerFactory.Crd().V1alpha1().ThroughputAnomalyDetectors()
 	taDetectorController := anomalydetector.NewAnomalyDetectorController(crdClient, kubeClient, taDetectorInformer)
+	analyticsJobController := analyticsjob.NewAnalyticsJobController(kubeClient, o.config.JobTemplates)
 	clickHouseStatQuerierImpl := stats.NewClickHouseStatQuerierImpl(kubeClient)
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, informerDefaultResync)
+	var flowEnrichmentController *flowenrichment.FlowEnrichmentController
+	if *o.config.FlowEnrichment.Enable {
+		// The interval has been validated in Options.validate.
+		reverseDNSInterval, _ := time.ParseDuration(o.config.FlowEnrichment.ReverseDNSInterval)
+		flowEnrichmentController = flowenrichment.NewFlowEnrichmentController(kubeClient, informerFactory.Core().V1().Services(), informerFactory.Core().V1().Nodes(), reverseDNSInterval)
+	}
+	var reportController *report.ReportController
+	if len(o.config.Reports.Schedules) > 0 {
+		reportController, err = report.NewReportController(clickHouseStatQuerierImpl, o.config.Reports)
+		if err != nil {
+			return fmt.Errorf("error when creating report controller: %v", err)
+		}
+	}
+
+	var flowSummaryController *flowsummary.FlowSummaryController
+	if o.config.OpenTelemetryLogs.Endpoint != "" {
+		// The interval has been validated in Options.validate.
+		flowSummaryInterval, _ := time.ParseDuration(o.config.OpenTelemetryLogs.FlowSummaryInterval)
+		if flowSummaryInterval > 0 {
+			flowSummaryController = flowsummary.NewFlowSummaryController(clickHouseStatQuerierImpl, flowSummaryInterval)
+		}
+	}
 
 	cipherSuites, err := cipher.GenerateCipherSuitesList(o.config.APIServer.TLSCipherSuites)
 	if err != nil {
@@ -147,9 +235,11 @@ func run(o *Options) error {
 		o.config.APIServer.APIPort,
 		cipherSuites,
 		cipher.TLSVersionMap[o.config.APIServer.TLSMinVersion],
+		o.config.APIServer.EnableProfiling,
 		npRecoController,
 		clickHouseStatQuerierImpl,
-		taDetectorController)
+		taDetectorController,
+		analyticsJobController)
 	if err != nil {
 		return fmt.Errorf("error creating API server config: %v", err)
 	}
@@ -159,8 +249,18 @@ func run(o *Options) error {
 	}
 
 	crdInformerFactory.Start(stopCh)
+	informerFactory.Start(stopCh)
 	go npRecoController.Run(stopCh)
 	go taDetectorController.Run(stopCh)
+	if flowEnrichmentController != nil {
+		go flowEnrichmentController.Run(stopCh)
+	}
+	if reportController != nil {
+		go reportController.Run(stopCh)
+	}
+	if flowSummaryController != nil {
+		go flowSummaryController.Run(stopCh)
+	}
 	go apiServer.Run(ctx)
 
 	<-stopCh
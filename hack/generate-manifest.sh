@@ -40,6 +40,8 @@ Kustomize, and print it to stdout.
                                             Ei, Pi, Ti, Gi, Mi, Ki. (default is 8Gi)
         --ch-monitor-threshold <threshold>  Deploy the ClickHouse monitor with a specific threshold. Can
                                             vary from 0 to 1. (default is 0.5)
+        --ch-database <name>                Store the Theia tables in a dedicated ClickHouse database, e.g.
+                                            to share a ClickHouse cluster. (default is 'default')
         --local <path>                      Create the PersistentVolume for Clickhouse DB with a provided
                                             local path.
         --zookeeper-local <path>            Create the PersistentVolume for ZooKeeper with a provided
@@ -67,6 +69,7 @@ NODE_PORT=false
 SECURE=false
 CH_SIZE="8Gi"
 CH_THRESHOLD=0.5
+CH_DATABASE=""
 LOCALPATH=""
 ZK_LOCALPATH=""
 IP_ADDRESS=""
@@ -112,6 +115,10 @@ case $key in
     CH_THRESHOLD="$2"
     shift 2
     ;;
+    --ch-database)
+    CH_DATABASE="$2"
+    shift 2
+    ;;
     --local)
     LOCALPATH="$2"
     shift 2
@@ -201,6 +208,9 @@ fi
 if [ "$SECURE" == true ]; then
     HELM_VALUES+=("clickhouse.service.secureConnection.enable=true")
 fi
+if [[ $CH_DATABASE != "" ]]; then
+    HELM_VALUES+=("clickhouse.database=$CH_DATABASE")
+fi
 if [[ $LOCALPATH != "" ]]; then
     HELM_VALUES+=("clickhouse.storage.createPersistentVolume.type=Local" "clickhouse.storage.createPersistentVolume.local.path=$LOCALPATH")
 fi
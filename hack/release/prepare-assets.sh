@@ -54,7 +54,9 @@ THEIA_BUILDS=(
     "linux arm64 linux-arm64"
     "linux arm linux-arm"
     "windows amd64 windows-x86_64.exe"
+    "windows arm64 windows-arm64.exe"
     "darwin amd64 darwin-x86_64"
+    "darwin arm64 darwin-arm64"
 )
 
 for build in "${THEIA_BUILDS[@]}"; do
@@ -84,4 +86,12 @@ cd -
 # a valid SemVer 2 version.
 VERSION=${VERSION:1} ./hack/generate-helm-release.sh --out "$OUTPUT_DIR"
 
+# The checksums of the assets are published with the release, so that theia
+# self-update can verify the CLI it downloads.
+pushd "$OUTPUT_DIR" > /dev/null
+checksums=$(mktemp)
+sha256sum * > "$checksums"
+mv "$checksums" sha256sums.txt
+popd > /dev/null
+
 ls "$OUTPUT_DIR" | cat
@@ -66,4 +66,11 @@ $GOPATH/bin/deepcopy-gen \
   -O zz_generated.deepcopy \
   --go-header-file hack/boilerplate/license_header.go.txt
 
+# Generate the protobuf messages and the gRPC service of the Theia Exporter API.
+protoc \
+  --proto_path=pkg/apis/exporter/v1alpha1 \
+  --go_out=pkg/apis/exporter/v1alpha1 --go_opt=paths=source_relative \
+  --go-grpc_out=pkg/apis/exporter/v1alpha1 --go-grpc_opt=paths=source_relative \
+  exporter.proto
+
 reset_year_change
@@ -25,11 +25,17 @@ import (
 
 const (
 	NPRecommendationStateNew       string = "NEW"
+	NPRecommendationStateQueued    string = "QUEUED"
 	NPRecommendationStateScheduled string = "SCHEDULED"
 	NPRecommendationStateRunning   string = "RUNNING"
 	NPRecommendationStateCompleted string = "COMPLETED"
 	NPRecommendationStateFailed    string = "FAILED"
 
+	NPRecommendationCanaryPhaseSoaking  string = "SOAKING"
+	NPRecommendationCanaryPhasePromoted string = "PROMOTED"
+	NPRecommendationCanaryPhaseReverted string = "REVERTED"
+	NPRecommendationCanaryPhaseFailed   string = "FAILED"
+
 	ThroughputAnomalyDetectorStateNew       string = "NEW"
 	ThroughputAnomalyDetectorStateScheduled string = "SCHEDULED"
 	ThroughputAnomalyDetectorStateRunning   string = "RUNNING"
@@ -62,6 +68,48 @@ type NetworkPolicyRecommendationSpec struct {
 	DriverMemory        string      `json:"driverMemory,omitempty"`
 	ExecutorCoreRequest string      `json:"executorCoreRequest,omitempty"`
 	ExecutorMemory      string      `json:"executorMemory,omitempty"`
+	// AutoSizeExecutors lets the controller override ExecutorInstances and
+	// ExecutorMemory according to the number of flow records in the
+	// requested time range.
+	AutoSizeExecutors bool `json:"autoSizeExecutors,omitempty"`
+	// Preaggregate lets the controller aggregate the flow records of the
+	// requested time range by source, destination and port in ClickHouse
+	// before the job starts. The job reads the aggregated flows instead of
+	// the flow records.
+	Preaggregate bool `json:"preaggregate,omitempty"`
+	// Submitter is the name of the user who created the job.
+	Submitter string `json:"submitter,omitempty"`
+	// Tags are user-supplied labels added to the Pods of the job, e.g. to
+	// attribute their cost to a team.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Canary enables the canary rollout of the recommended policies of a
+	// single Namespace once the job is completed.
+	Canary *NetworkPolicyRecommendationCanary `json:"canary,omitempty"`
+	// Workload restricts the recommendation to the flows of the Pods of a
+	// single workload, and to the policies applied to them.
+	Workload *NetworkPolicyRecommendationWorkload `json:"workload,omitempty"`
+}
+
+// NetworkPolicyRecommendationWorkload is the workload a policy recommendation
+// job is restricted to. Its Pods are the Pods of Namespace with all the
+// PodLabels, matched against the Pod labels recorded in the flows.
+type NetworkPolicyRecommendationWorkload struct {
+	Namespace string `json:"namespace"`
+	// Name is the workload as <kind>/<name>, e.g. deployment/foo. It is
+	// informational, the Pods are selected by PodLabels.
+	Name      string            `json:"name,omitempty"`
+	PodLabels map[string]string `json:"podLabels"`
+}
+
+// NetworkPolicyRecommendationCanary configures the canary rollout of the
+// recommended policies. The policies are applied in log mode, where the rules
+// which would deny traffic allow and log it instead, for the soak window. They
+// are then enforced if no more than MaxDeniedFlows flows would have been
+// denied, or deleted otherwise.
+type NetworkPolicyRecommendationCanary struct {
+	Namespace      string          `json:"namespace"`
+	SoakWindow     metav1.Duration `json:"soakWindow,omitempty"`
+	MaxDeniedFlows int             `json:"maxDeniedFlows,omitempty"`
 }
 
 type NetworkPolicyRecommendationStatus struct {
@@ -72,6 +120,20 @@ type NetworkPolicyRecommendationStatus struct {
 	ErrorMsg         string      `json:"errorMsg,omitempty"`
 	StartTime        metav1.Time `json:"startTime,omitempty"`
 	EndTime          metav1.Time `json:"endTime,omitempty"`
+	// Canary is the status of the canary rollout, if it is enabled.
+	Canary *NetworkPolicyRecommendationCanaryStatus `json:"canary,omitempty"`
+}
+
+type NetworkPolicyRecommendationCanaryStatus struct {
+	Phase         string      `json:"phase,omitempty"`
+	SoakStartTime metav1.Time `json:"soakStartTime,omitempty"`
+	// DeniedFlows is the number of flows which would have been denied by the
+	// policies since the start of the soak window.
+	DeniedFlows int `json:"deniedFlows,omitempty"`
+	// AppliedPolicies are the policies applied in the cluster, as
+	// <kind>/<name> or <kind>/<namespace>/<name>.
+	AppliedPolicies []string `json:"appliedPolicies,omitempty"`
+	Message         string   `json:"message,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -109,6 +171,10 @@ type ThroughputAnomalyDetectorSpec struct {
 	DriverMemory        string      `json:"driverMemory,omitempty"`
 	ExecutorCoreRequest string      `json:"executorCoreRequest,omitempty"`
 	ExecutorMemory      string      `json:"executorMemory,omitempty"`
+	// AutoSizeExecutors lets the controller override ExecutorInstances and
+	// ExecutorMemory according to the number of flow records in the
+	// requested time range.
+	AutoSizeExecutors bool `json:"autoSizeExecutors,omitempty"`
 }
 
 type ThroughputAnomalyDetectorStatus struct {
@@ -51,6 +51,45 @@ func (in *NetworkPolicyRecommendation) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationCanary) DeepCopyInto(out *NetworkPolicyRecommendationCanary) {
+	*out = *in
+	out.SoakWindow = in.SoakWindow
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationCanary.
+func (in *NetworkPolicyRecommendationCanary) DeepCopy() *NetworkPolicyRecommendationCanary {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationCanary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationCanaryStatus) DeepCopyInto(out *NetworkPolicyRecommendationCanaryStatus) {
+	*out = *in
+	in.SoakStartTime.DeepCopyInto(&out.SoakStartTime)
+	if in.AppliedPolicies != nil {
+		in, out := &in.AppliedPolicies, &out.AppliedPolicies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationCanaryStatus.
+func (in *NetworkPolicyRecommendationCanaryStatus) DeepCopy() *NetworkPolicyRecommendationCanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationCanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkPolicyRecommendationList) DeepCopyInto(out *NetworkPolicyRecommendationList) {
 	*out = *in
@@ -94,6 +133,23 @@ func (in *NetworkPolicyRecommendationSpec) DeepCopyInto(out *NetworkPolicyRecomm
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(NetworkPolicyRecommendationCanary)
+		**out = **in
+	}
+	if in.Workload != nil {
+		in, out := &in.Workload, &out.Workload
+		*out = new(NetworkPolicyRecommendationWorkload)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -112,6 +168,11 @@ func (in *NetworkPolicyRecommendationStatus) DeepCopyInto(out *NetworkPolicyReco
 	*out = *in
 	in.StartTime.DeepCopyInto(&out.StartTime)
 	in.EndTime.DeepCopyInto(&out.EndTime)
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(NetworkPolicyRecommendationCanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -125,6 +186,29 @@ func (in *NetworkPolicyRecommendationStatus) DeepCopy() *NetworkPolicyRecommenda
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationWorkload) DeepCopyInto(out *NetworkPolicyRecommendationWorkload) {
+	*out = *in
+	if in.PodLabels != nil {
+		in, out := &in.PodLabels, &out.PodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationWorkload.
+func (in *NetworkPolicyRecommendationWorkload) DeepCopy() *NetworkPolicyRecommendationWorkload {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationWorkload)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ThroughputAnomalyDetector) DeepCopyInto(out *ThroughputAnomalyDetector) {
 	*out = *in
@@ -15,7 +15,11 @@
 package v1alpha1
 
 import (
+	"net/url"
+	"strconv"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
@@ -36,6 +40,16 @@ var (
 		Group:    SchemeGroupVersion.Group,
 		Version:  SchemeGroupVersion.Version,
 		Resource: "throughputanomalydetectors"}
+
+	JobTemplateResource = schema.GroupVersionResource{
+		Group:    SchemeGroupVersion.Group,
+		Version:  SchemeGroupVersion.Version,
+		Resource: "jobtemplates"}
+
+	AnalyticsJobResource = schema.GroupVersionResource{
+		Group:    SchemeGroupVersion.Group,
+		Version:  SchemeGroupVersion.Version,
+		Resource: "analyticsjobs"}
 )
 
 var (
@@ -45,7 +59,7 @@ var (
 )
 
 func init() {
-	localSchemeBuilder.Register(addKnownTypes)
+	localSchemeBuilder.Register(addKnownTypes, addConversionFuncs)
 }
 
 func Resource(resource string) schema.GroupResource {
@@ -57,10 +71,44 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		SchemeGroupVersion,
 		&NetworkPolicyRecommendation{},
 		&NetworkPolicyRecommendationList{},
+		&NetworkPolicyRecommendationGetOptions{},
 		&ThroughputAnomalyDetector{},
 		&ThroughputAnomalyDetectorList{},
+		&JobTemplate{},
+		&JobTemplateList{},
+		&AnalyticsJob{},
+		&AnalyticsJobList{},
 	)
 
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
 }
+
+func addConversionFuncs(scheme *runtime.Scheme) error {
+	return scheme.AddConversionFunc((*url.Values)(nil), (*NetworkPolicyRecommendationGetOptions)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return convertURLValuesToNetworkPolicyRecommendationGetOptions(a.(*url.Values), b.(*NetworkPolicyRecommendationGetOptions))
+	})
+}
+
+// convertURLValuesToNetworkPolicyRecommendationGetOptions decodes the query
+// parameters of a NetworkPolicyRecommendation Get request.
+func convertURLValuesToNetworkPolicyRecommendationGetOptions(in *url.Values, out *NetworkPolicyRecommendationGetOptions) error {
+	if values, ok := (*in)["limit"]; ok && len(values) > 0 {
+		limit, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		out.Limit = limit
+	}
+	if values, ok := (*in)["continue"]; ok && len(values) > 0 {
+		out.Continue = values[0]
+	}
+	if values, ok := (*in)["report"]; ok && len(values) > 0 {
+		report, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return err
+		}
+		out.Report = report
+	}
+	return nil
+}
@@ -37,7 +37,29 @@ type NetworkPolicyRecommendation struct {
 	DriverMemory        string                            `json:"driverMemory,omitempty"`
 	ExecutorCoreRequest string                            `json:"executorCoreRequest,omitempty"`
 	ExecutorMemory      string                            `json:"executorMemory,omitempty"`
+	AutoSizeExecutors   bool                              `json:"autoSizeExecutors,omitempty"`
+	Preaggregate        bool                              `json:"preaggregate,omitempty"`
+	Submitter           string                            `json:"submitter,omitempty"`
+	Tags                map[string]string                 `json:"tags,omitempty"`
 	Status              NetworkPolicyRecommendationStatus `json:"status,omitempty"`
+	// Canary enables the canary rollout of the recommended policies of a
+	// single Namespace once the job is completed.
+	Canary *NetworkPolicyRecommendationCanary `json:"canary,omitempty"`
+	// Workload restricts the recommendation to the flows of the Pods of a
+	// single workload, and to the policies applied to them.
+	Workload *NetworkPolicyRecommendationWorkload `json:"workload,omitempty"`
+}
+
+type NetworkPolicyRecommendationWorkload struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name,omitempty"`
+	PodLabels map[string]string `json:"podLabels"`
+}
+
+type NetworkPolicyRecommendationCanary struct {
+	Namespace      string          `json:"namespace"`
+	SoakWindow     metav1.Duration `json:"soakWindow,omitempty"`
+	MaxDeniedFlows int             `json:"maxDeniedFlows,omitempty"`
 }
 
 type NetworkPolicyRecommendationStatus struct {
@@ -49,6 +71,79 @@ type NetworkPolicyRecommendationStatus struct {
 	ErrorMsg              string      `json:"errorMsg,omitempty"`
 	StartTime             metav1.Time `json:"startTime,omitempty"`
 	EndTime               metav1.Time `json:"endTime,omitempty"`
+	// Continue is set when RecommendationOutcome only holds a page of the
+	// recommended policies. It should be passed in the GetOptions of the next
+	// request to retrieve the following page.
+	Continue string `json:"continue,omitempty"`
+	// Canary is the status of the canary rollout, if it is enabled.
+	Canary *NetworkPolicyRecommendationCanaryStatus `json:"canary,omitempty"`
+	// Coverage is the number of flows matched and not matched by the
+	// recommended policies, by Namespace. It is only set when the report is
+	// requested in the GetOptions.
+	Coverage []NetworkPolicyRecommendationCoverage `json:"coverage,omitempty"`
+	// DataWindow is the data analyzed by the job. It is only set when the
+	// report is requested in the GetOptions.
+	DataWindow *NetworkPolicyRecommendationDataWindow `json:"dataWindow,omitempty"`
+	// EmptyResultReason is set when the job completed without recommending
+	// any policy, and explains why, e.g. when no flow record was found in its
+	// time range.
+	EmptyResultReason string `json:"emptyResultReason,omitempty"`
+}
+
+type NetworkPolicyRecommendationCanaryStatus struct {
+	Phase           string      `json:"phase,omitempty"`
+	SoakStartTime   metav1.Time `json:"soakStartTime,omitempty"`
+	DeniedFlows     int         `json:"deniedFlows,omitempty"`
+	AppliedPolicies []string    `json:"appliedPolicies,omitempty"`
+	Message         string      `json:"message,omitempty"`
+}
+
+// NetworkPolicyRecommendationCoverage is the number of unprotected flows of a
+// Namespace, over the time range of the recommendation job, which are matched
+// and not matched by the recommended policies. The flows are counted in the
+// Namespace of their source Pod, or of their destination Pod if the source is
+// not a Pod.
+type NetworkPolicyRecommendationCoverage struct {
+	Namespace      string `json:"namespace"`
+	MatchedFlows   int64  `json:"matchedFlows"`
+	UnmatchedFlows int64  `json:"unmatchedFlows"`
+}
+
+// NetworkPolicyRecommendationDataWindow is the data analyzed by a
+// recommendation job: the time range of its flow records, their number and
+// the Nodes they were exported from. Caveats describe what may lower the
+// confidence in the recommended policies, e.g. when the limit on the number of
+// flow records read by the job is lower than their number.
+type NetworkPolicyRecommendationDataWindow struct {
+	MinFlowTime metav1.Time `json:"minFlowTime,omitempty"`
+	MaxFlowTime metav1.Time `json:"maxFlowTime,omitempty"`
+	Flows       int64       `json:"flows"`
+	Nodes       []string    `json:"nodes,omitempty"`
+	Caveats     []string    `json:"caveats,omitempty"`
+	// EmptyResultReason is the reason why the job recommended no policy, if
+	// it did not.
+	EmptyResultReason string `json:"emptyResultReason,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NetworkPolicyRecommendationGetOptions are the query options of a
+// NetworkPolicyRecommendation Get request, used to retrieve the recommended
+// policies in pages.
+type NetworkPolicyRecommendationGetOptions struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Limit is the maximum number of recommended policies to return. The
+	// server caps it at its maximum page size, which is also used when Limit
+	// is 0, so clients should keep requesting pages while Continue is set.
+	Limit int64 `json:"limit,omitempty"`
+	// Continue is the opaque cursor returned in the Status of the previous
+	// request.
+	Continue string `json:"continue,omitempty"`
+	// Report selects the coverage statistics and the data window of the
+	// recommended policies instead of the policies, which are then not
+	// retrieved.
+	Report bool `json:"report,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -83,6 +178,7 @@ type ThroughputAnomalyDetector struct {
 	DriverMemory        string                           `json:"driverMemory,omitempty"`
 	ExecutorCoreRequest string                           `json:"executorCoreRequest,omitempty"`
 	ExecutorMemory      string                           `json:"executorMemory,omitempty"`
+	AutoSizeExecutors   bool                             `json:"autoSizeExecutors,omitempty"`
 	Status              ThroughputAnomalyDetectorStatus  `json:"status,omitempty"`
 	Stats               []ThroughputAnomalyDetectorStats `json:"stats,omitempty"`
 }
@@ -106,21 +202,102 @@ type ThroughputAnomalyDetectorList struct {
 }
 
 type ThroughputAnomalyDetectorStats struct {
-	Id                         string `json:"id,omitempty"`
-	SourceIP                   string `json:"sourceIP,omitempty"`
-	SourceTransportPort        string `json:"sourceTransportPort,omitempty"`
-	DestinationIP              string `json:"destinationIP,omitempty"`
-	DestinationTransportPort   string `json:"destinationTransportPort,omitempty"`
-	FlowStartSeconds           string `json:"FlowStartSeconds,omitempty"`
-	PodNamespace               string `json:"podNamespace,omitempty"`
-	PodLabels                  string `json:"podLabels,omitempty"`
-	PodName                    string `json:"podName,omitempty"`
-	Direction                  string `json:"direction,omitempty"`
-	DestinationServicePortName string `json:"destinationServicePortName,omitempty"`
-	FlowEndSeconds             string `json:"FlowEndSeconds,omitempty"`
-	Throughput                 string `json:"throughput,omitempty"`
-	AggType                    string `json:"aggType,omitempty"`
-	AlgoType                   string `json:"algoType,omitempty"`
-	AlgoCalc                   string `json:"AlgoCalc,omitempty"`
-	Anomaly                    string `json:"anomaly,omitempty"`
+	Id                          string `json:"id,omitempty"`
+	SourceIP                    string `json:"sourceIP,omitempty"`
+	SourceTransportPort         string `json:"sourceTransportPort,omitempty"`
+	DestinationIP               string `json:"destinationIP,omitempty"`
+	DestinationTransportPort    string `json:"destinationTransportPort,omitempty"`
+	FlowStartSeconds            string `json:"FlowStartSeconds,omitempty"`
+	PodNamespace                string `json:"podNamespace,omitempty"`
+	PodLabels                   string `json:"podLabels,omitempty"`
+	PodName                     string `json:"podName,omitempty"`
+	Direction                   string `json:"direction,omitempty"`
+	DestinationServicePortName  string `json:"destinationServicePortName,omitempty"`
+	FlowEndSeconds              string `json:"FlowEndSeconds,omitempty"`
+	Throughput                  string `json:"throughput,omitempty"`
+	ThroughputStandardDeviation string `json:"throughputStandardDeviation,omitempty"`
+	AggType                     string `json:"aggType,omitempty"`
+	AlgoType                    string `json:"algoType,omitempty"`
+	AlgoCalc                    string `json:"AlgoCalc,omitempty"`
+	Anomaly                     string `json:"anomaly,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:onlyVerbs=get,list
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// JobTemplate is a template of custom analytics jobs, registered in the
+// configuration of the Theia Manager.
+type JobTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Description         string           `json:"description,omitempty"`
+	Image               string           `json:"image,omitempty"`
+	MainApplicationFile string           `json:"mainApplicationFile,omitempty"`
+	Args                []JobTemplateArg `json:"args,omitempty"`
+}
+
+type JobTemplateArg struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type JobTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []JobTemplate `json:"items"`
+}
+
+const (
+	AnalyticsJobStateScheduled string = "SCHEDULED"
+	AnalyticsJobStateRunning   string = "RUNNING"
+	AnalyticsJobStateCompleted string = "COMPLETED"
+	AnalyticsJobStateFailed    string = "FAILED"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AnalyticsJob is a custom analytics job, run as a Spark job from the image
+// and the main application file of its JobTemplate.
+type AnalyticsJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Template            string             `json:"template,omitempty"`
+	Args                map[string]string  `json:"args,omitempty"`
+	ExecutorInstances   int                `json:"executorInstances,omitempty"`
+	DriverCoreRequest   string             `json:"driverCoreRequest,omitempty"`
+	DriverMemory        string             `json:"driverMemory,omitempty"`
+	ExecutorCoreRequest string             `json:"executorCoreRequest,omitempty"`
+	ExecutorMemory      string             `json:"executorMemory,omitempty"`
+	Status              AnalyticsJobStatus `json:"status,omitempty"`
+}
+
+type AnalyticsJobStatus struct {
+	State            string      `json:"state,omitempty"`
+	SparkApplication string      `json:"sparkApplication,omitempty"`
+	CompletedStages  int         `json:"completedStages,omitempty"`
+	TotalStages      int         `json:"totalStages,omitempty"`
+	ErrorMsg         string      `json:"errorMsg,omitempty"`
+	StartTime        metav1.Time `json:"startTime,omitempty"`
+	EndTime          metav1.Time `json:"endTime,omitempty"`
+	// Result holds the records written by the job to the
+	// analytics_job_results table, once it is completed.
+	Result []string `json:"result,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type AnalyticsJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AnalyticsJob `json:"items"`
 }
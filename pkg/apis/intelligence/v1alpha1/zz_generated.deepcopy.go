@@ -23,6 +23,176 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalyticsJob) DeepCopyInto(out *AnalyticsJob) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticsJob.
+func (in *AnalyticsJob) DeepCopy() *AnalyticsJob {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalyticsJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AnalyticsJob) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalyticsJobList) DeepCopyInto(out *AnalyticsJobList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AnalyticsJob, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticsJobList.
+func (in *AnalyticsJobList) DeepCopy() *AnalyticsJobList {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalyticsJobList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AnalyticsJobList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalyticsJobStatus) DeepCopyInto(out *AnalyticsJobStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	in.EndTime.DeepCopyInto(&out.EndTime)
+	if in.Result != nil {
+		in, out := &in.Result, &out.Result
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticsJobStatus.
+func (in *AnalyticsJobStatus) DeepCopy() *AnalyticsJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalyticsJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobTemplate) DeepCopyInto(out *JobTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]JobTemplateArg, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobTemplate.
+func (in *JobTemplate) DeepCopy() *JobTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(JobTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *JobTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobTemplateArg) DeepCopyInto(out *JobTemplateArg) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobTemplateArg.
+func (in *JobTemplateArg) DeepCopy() *JobTemplateArg {
+	if in == nil {
+		return nil
+	}
+	out := new(JobTemplateArg)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobTemplateList) DeepCopyInto(out *JobTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]JobTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobTemplateList.
+func (in *JobTemplateList) DeepCopy() *JobTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(JobTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *JobTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkPolicyRecommendation) DeepCopyInto(out *NetworkPolicyRecommendation) {
 	*out = *in
@@ -35,7 +205,24 @@ func (in *NetworkPolicyRecommendation) DeepCopyInto(out *NetworkPolicyRecommenda
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	in.Status.DeepCopyInto(&out.Status)
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(NetworkPolicyRecommendationCanary)
+		**out = **in
+	}
+	if in.Workload != nil {
+		in, out := &in.Workload, &out.Workload
+		*out = new(NetworkPolicyRecommendationWorkload)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -57,6 +244,114 @@ func (in *NetworkPolicyRecommendation) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationCanary) DeepCopyInto(out *NetworkPolicyRecommendationCanary) {
+	*out = *in
+	out.SoakWindow = in.SoakWindow
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationCanary.
+func (in *NetworkPolicyRecommendationCanary) DeepCopy() *NetworkPolicyRecommendationCanary {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationCanary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationCanaryStatus) DeepCopyInto(out *NetworkPolicyRecommendationCanaryStatus) {
+	*out = *in
+	in.SoakStartTime.DeepCopyInto(&out.SoakStartTime)
+	if in.AppliedPolicies != nil {
+		in, out := &in.AppliedPolicies, &out.AppliedPolicies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationCanaryStatus.
+func (in *NetworkPolicyRecommendationCanaryStatus) DeepCopy() *NetworkPolicyRecommendationCanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationCanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationCoverage) DeepCopyInto(out *NetworkPolicyRecommendationCoverage) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationCoverage.
+func (in *NetworkPolicyRecommendationCoverage) DeepCopy() *NetworkPolicyRecommendationCoverage {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationCoverage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationDataWindow) DeepCopyInto(out *NetworkPolicyRecommendationDataWindow) {
+	*out = *in
+	in.MinFlowTime.DeepCopyInto(&out.MinFlowTime)
+	in.MaxFlowTime.DeepCopyInto(&out.MaxFlowTime)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Caveats != nil {
+		in, out := &in.Caveats, &out.Caveats
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationDataWindow.
+func (in *NetworkPolicyRecommendationDataWindow) DeepCopy() *NetworkPolicyRecommendationDataWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationDataWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationGetOptions) DeepCopyInto(out *NetworkPolicyRecommendationGetOptions) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationGetOptions.
+func (in *NetworkPolicyRecommendationGetOptions) DeepCopy() *NetworkPolicyRecommendationGetOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationGetOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NetworkPolicyRecommendationGetOptions) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkPolicyRecommendationList) DeepCopyInto(out *NetworkPolicyRecommendationList) {
 	*out = *in
@@ -95,6 +390,21 @@ func (in *NetworkPolicyRecommendationStatus) DeepCopyInto(out *NetworkPolicyReco
 	*out = *in
 	in.StartTime.DeepCopyInto(&out.StartTime)
 	in.EndTime.DeepCopyInto(&out.EndTime)
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(NetworkPolicyRecommendationCanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Coverage != nil {
+		in, out := &in.Coverage, &out.Coverage
+		*out = make([]NetworkPolicyRecommendationCoverage, len(*in))
+		copy(*out, *in)
+	}
+	if in.DataWindow != nil {
+		in, out := &in.DataWindow, &out.DataWindow
+		*out = new(NetworkPolicyRecommendationDataWindow)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -108,6 +418,29 @@ func (in *NetworkPolicyRecommendationStatus) DeepCopy() *NetworkPolicyRecommenda
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicyRecommendationWorkload) DeepCopyInto(out *NetworkPolicyRecommendationWorkload) {
+	*out = *in
+	if in.PodLabels != nil {
+		in, out := &in.PodLabels, &out.PodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicyRecommendationWorkload.
+func (in *NetworkPolicyRecommendationWorkload) DeepCopy() *NetworkPolicyRecommendationWorkload {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicyRecommendationWorkload)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ThroughputAnomalyDetector) DeepCopyInto(out *ThroughputAnomalyDetector) {
 	*out = *in
@@ -15,7 +15,10 @@
 package v1alpha1
 
 import (
+	"net/url"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
@@ -31,6 +34,21 @@ var (
 		Group:    SchemeGroupVersion.Group,
 		Version:  SchemeGroupVersion.Version,
 		Resource: "clickhouse"}
+
+	FlowStatsResource = schema.GroupVersionResource{
+		Group:    SchemeGroupVersion.Group,
+		Version:  SchemeGroupVersion.Version,
+		Resource: "flows"}
+
+	ColdStorageResource = schema.GroupVersionResource{
+		Group:    SchemeGroupVersion.Group,
+		Version:  SchemeGroupVersion.Version,
+		Resource: "coldstorage"}
+
+	ClickHouseUsersResource = schema.GroupVersionResource{
+		Group:    SchemeGroupVersion.Group,
+		Version:  SchemeGroupVersion.Version,
+		Resource: "clickhouseusers"}
 )
 
 var (
@@ -40,7 +58,7 @@ var (
 )
 
 func init() {
-	localSchemeBuilder.Register(addKnownTypes)
+	localSchemeBuilder.Register(addKnownTypes, addConversionFuncs)
 }
 
 func Resource(resource string) schema.GroupResource {
@@ -51,8 +69,61 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(
 		SchemeGroupVersion,
 		&ClickHouseStats{},
+		&ClickHouseColdStorage{},
+		&ClickHouseUser{},
+		&FlowStats{},
+		&FlowStatsGetOptions{},
 	)
 
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
 }
+
+func addConversionFuncs(scheme *runtime.Scheme) error {
+	return scheme.AddConversionFunc((*url.Values)(nil), (*FlowStatsGetOptions)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		in, out := a.(*url.Values), b.(*FlowStatsGetOptions)
+		if values, ok := (*in)["window"]; ok && len(values) > 0 {
+			out.Window = values[0]
+		}
+		if values, ok := (*in)["trafficClass"]; ok && len(values) > 0 {
+			out.TrafficClass = values[0]
+		}
+		if values, ok := (*in)["resolution"]; ok && len(values) > 0 {
+			out.Resolution = values[0]
+		}
+		if values, ok := (*in)["groupBy"]; ok && len(values) > 0 {
+			out.GroupBy = values[0]
+		}
+		if values, ok := (*in)["sortBy"]; ok && len(values) > 0 {
+			out.SortBy = values[0]
+		}
+		if values, ok := (*in)["limit"]; ok && len(values) > 0 {
+			out.Limit = values[0]
+		}
+		if values, ok := (*in)["startTime"]; ok && len(values) > 0 {
+			out.StartTime = values[0]
+		}
+		if values, ok := (*in)["endTime"]; ok && len(values) > 0 {
+			out.EndTime = values[0]
+		}
+		if values, ok := (*in)["format"]; ok && len(values) > 0 {
+			out.Format = values[0]
+		}
+		if values, ok := (*in)["batchSize"]; ok && len(values) > 0 {
+			out.BatchSize = values[0]
+		}
+		if values, ok := (*in)["compression"]; ok && len(values) > 0 {
+			out.Compression = values[0]
+		}
+		if values, ok := (*in)["namespace"]; ok && len(values) > 0 {
+			out.Namespace = values[0]
+		}
+		if values, ok := (*in)["podName"]; ok && len(values) > 0 {
+			out.PodName = values[0]
+		}
+		if values, ok := (*in)["podSelector"]; ok && len(values) > 0 {
+			out.PodSelector = values[0]
+		}
+		return nil
+	})
+}
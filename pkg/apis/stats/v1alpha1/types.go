@@ -31,30 +31,70 @@ type ClickHouseStats struct {
 	InsertRates []InsertRate `json:"insertRates,omitempty"`
 	StackTraces []StackTrace `json:"stackTraces,omitempty"`
 	ErrorMsg    []string     `json:"errorMsg,omitempty"`
+
+	// RetentionHistory lists the deletions of flow records by the ClickHouse
+	// monitor, the latest first.
+	RetentionHistory []DeletionRecord `json:"retentionHistory,omitempty"`
+	// SystemMetrics are the current values of the key metrics of every
+	// ClickHouse shard.
+	SystemMetrics []SystemMetric `json:"systemMetrics,omitempty"`
+	// SchemaVersions are the versions of the data schema of every ClickHouse
+	// shard.
+	SchemaVersions []SchemaVersion `json:"schemaVersions,omitempty"`
+	// MigrationProgress is the progress of the mutations and of the copies
+	// between tables of the latest data schema migration.
+	MigrationProgress []MigrationProgress `json:"migrationProgress,omitempty"`
 }
 
-type DiskInfo struct {
+// DeletionRecord describes the flow records deleted by the ClickHouse monitor
+// when the storage usage grew above its threshold. BytesReclaimed is estimated
+// when the deletion is issued.
+type DeletionRecord struct {
 	Shard          string `json:"shard,omitempty"`
-	Database       string `json:"name,omitempty"`
-	Path           string `json:"path,omitempty"`
-	FreeSpace      string `json:"freeSpace,omitempty"`
-	TotalSpace     string `json:"totalSpace,omitempty"`
-	UsedPercentage string `json:"usedPercentage,omitempty"`
+	TimeDeleted    string `json:"timeDeleted,omitempty"`
+	TableName      string `json:"tableName,omitempty"`
+	RangeStart     string `json:"rangeStart,omitempty"`
+	RangeEnd       string `json:"rangeEnd,omitempty"`
+	RowCount       string `json:"rowCount,omitempty"`
+	BytesReclaimed string `json:"bytesReclaimed,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// DiskInfo is the usage of a disk of a ClickHouse shard. The sizes and the
+// percentage are human-readable, e.g. "1.84 GiB" and "42.00 %", while the Raw
+// fields hold them as plain numbers of bytes and percent. The Raw fields are
+// empty when returned by older versions of Theia Manager.
+type DiskInfo struct {
+	Shard             string `json:"shard,omitempty"`
+	Database          string `json:"name,omitempty"`
+	Path              string `json:"path,omitempty"`
+	FreeSpace         string `json:"freeSpace,omitempty"`
+	TotalSpace        string `json:"totalSpace,omitempty"`
+	UsedPercentage    string `json:"usedPercentage,omitempty"`
+	FreeSpaceRaw      string `json:"freeSpaceRaw,omitempty"`
+	TotalSpaceRaw     string `json:"totalSpaceRaw,omitempty"`
+	UsedPercentageRaw string `json:"usedPercentageRaw,omitempty"`
 }
 
+// TableInfo is the size of a table of a ClickHouse shard. TotalBytes is
+// human-readable, and TotalBytesRaw is the plain number of bytes.
 type TableInfo struct {
-	Shard      string `json:"shard,omitempty"`
-	Database   string `json:"database,omitempty"`
-	TableName  string `json:"tableName,omitempty"`
-	TotalRows  string `json:"totalRows,omitempty"`
-	TotalBytes string `json:"totalBytes,omitempty"`
-	TotalCols  string `json:"totalCols,omitempty"`
+	Shard         string `json:"shard,omitempty"`
+	Database      string `json:"database,omitempty"`
+	TableName     string `json:"tableName,omitempty"`
+	TotalRows     string `json:"totalRows,omitempty"`
+	TotalBytes    string `json:"totalBytes,omitempty"`
+	TotalCols     string `json:"totalCols,omitempty"`
+	TotalBytesRaw string `json:"totalBytesRaw,omitempty"`
 }
 
+// InsertRate is the insertion rate of a ClickHouse shard. BytesPerSec is
+// human-readable, and BytesPerSecRaw is the plain number of bytes per second.
 type InsertRate struct {
-	Shard       string `json:"shard,omitempty"`
-	RowsPerSec  string `json:"rowsPerSec,omitempty"`
-	BytesPerSec string `json:"bytesPerSec,omitempty"`
+	Shard          string `json:"shard,omitempty"`
+	RowsPerSec     string `json:"rowsPerSec,omitempty"`
+	BytesPerSec    string `json:"bytesPerSec,omitempty"`
+	BytesPerSecRaw string `json:"bytesPerSecRaw,omitempty"`
 }
 
 type StackTrace struct {
@@ -62,3 +102,407 @@ type StackTrace struct {
 	TraceFunctions string `json:"traceFunctions,omitempty"`
 	Count          string `json:"count,omitempty"`
 }
+
+// SchemaVersion is the golang-migrate version number of the data schema of a
+// ClickHouse shard. Dirty is "1" if the last migration failed.
+type SchemaVersion struct {
+	Shard   string `json:"shard,omitempty"`
+	Version string `json:"version,omitempty"`
+	Dirty   string `json:"dirty,omitempty"`
+}
+
+// MigrationProgress is the progress of a mutation, in data parts, or of a copy
+// between tables, in rows, of a data schema migration from one golang-migrate
+// version number to another. ETASeconds is "-1" if the time left is unknown.
+type MigrationProgress struct {
+	FromVersion string `json:"fromVersion,omitempty"`
+	ToVersion   string `json:"toVersion,omitempty"`
+	TableName   string `json:"tableName,omitempty"`
+	Operation   string `json:"operation,omitempty"`
+	Done        string `json:"done,omitempty"`
+	Total       string `json:"total,omitempty"`
+	ETASeconds  string `json:"etaSeconds,omitempty"`
+	TimeUpdated string `json:"timeUpdated,omitempty"`
+}
+
+// SystemMetric is a metric of the system.metrics table of a ClickHouse shard,
+// e.g. the number of queries being executed.
+type SystemMetric struct {
+	Shard  string `json:"shard,omitempty"`
+	Metric string `json:"metric,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:onlyVerbs=create
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClickHouseColdStorage sets the TTL rules of the flow tables which move the
+// flow records to the cold volume of the tiered storage policy of ClickHouse.
+type ClickHouseColdStorage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// MoveAfter is the age after which the flow records are moved to the
+	// cold volume, as a ClickHouse interval, e.g. "7 DAY". If it is empty,
+	// the flow records are only moved when the hot volume is almost full.
+	MoveAfter string `json:"moveAfter,omitempty"`
+	// Tables are the tables whose TTL rules were set.
+	Tables []string `json:"tables,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:onlyVerbs=create
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClickHouseUser creates a ClickHouse user, named after the object, granted a
+// least-privilege role of the Theia database, or replaces the user if it
+// exists.
+type ClickHouseUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Password is the password of the user. It is never returned.
+	Password string `json:"password,omitempty"`
+	// Role is the role of the user, one of writer, reader or admin.
+	Role string `json:"role,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FlowStats reports statistics about the flow records stored in ClickHouse.
+type FlowStats struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Window is the duration before now over which the statistics are computed.
+	Window string `json:"window,omitempty"`
+	// TrafficClass is the traffic class of the flows over which the
+	// statistics are computed, or empty for all the flows.
+	TrafficClass string `json:"trafficClass,omitempty"`
+	// Resolution is the resolution of the flow records from which the
+	// statistics are computed, when they can be computed from their rollups.
+	Resolution  string          `json:"resolution,omitempty"`
+	Cardinality FlowCardinality `json:"cardinality,omitempty"`
+	// TrafficClasses breaks the flows down by traffic class.
+	TrafficClasses []TrafficClassStats `json:"trafficClasses,omitempty"`
+	// Nodes breaks the flows down by the Nodes they were observed on.
+	Nodes []NodeFlowStats `json:"nodes,omitempty"`
+	// TopTalkers lists the pairs of endpoints which exchanged the most
+	// traffic, in decreasing order.
+	TopTalkers []TopTalkerStats `json:"topTalkers,omitempty"`
+	// WorkloadFlows summarizes the traffic of the Pods of a workload by
+	// direction, peer, port and NetworkPolicies, the most traffic first.
+	WorkloadFlows []WorkloadFlowStats `json:"workloadFlows,omitempty"`
+	// PolicyHits lists the NetworkPolicy rules applied to the most flows, in
+	// decreasing order.
+	PolicyHits []PolicyHitStats `json:"policyHits,omitempty"`
+	// Posture breaks the flows down by Namespace, with the numbers of flows
+	// which were not protected by any NetworkPolicy and which were denied.
+	Posture []NamespacePostureStats `json:"posture,omitempty"`
+	// PolicyTraffic lists the NetworkPolicies which were applied to flows,
+	// with the traffic they allowed and denied, the most flows first.
+	PolicyTraffic []PolicyTrafficStats `json:"policyTraffic,omitempty"`
+	// Integrity reports the consistency checks of the flow records.
+	Integrity []FlowIntegrityStats `json:"integrity,omitempty"`
+}
+
+// FlowCardinality holds the approximate numbers of distinct values of the key
+// dimensions of flow records.
+type FlowCardinality struct {
+	Flows       string `json:"flows,omitempty"`
+	Pods        string `json:"pods,omitempty"`
+	Namespaces  string `json:"namespaces,omitempty"`
+	Services    string `json:"services,omitempty"`
+	ExternalIPs string `json:"externalIPs,omitempty"`
+	Ports       string `json:"ports,omitempty"`
+}
+
+// Traffic classes of flows, computed by ClickHouse from the flow type and the
+// endpoints of the flows.
+const (
+	// Flows between Pods of the same Node.
+	TrafficClassIntraNode = "intra-node"
+	// Flows between Pods of different Nodes.
+	TrafficClassInterNode = "inter-node"
+	// Flows from a Pod to a Service.
+	TrafficClassPodToService = "pod-to-service"
+	// Flows from a Pod to an external endpoint.
+	TrafficClassPodToExternal = "pod-to-external"
+	// Flows from an external endpoint to a Pod.
+	TrafficClassExternalToPod = "external-to-pod"
+	// Flows inside the cluster from or to an endpoint which is not a Pod,
+	// e.g. a hostNetwork Pod or a Node.
+	TrafficClassHostNetwork = "host-network"
+	// Flows of unknown type.
+	TrafficClassUnknown = "unknown"
+)
+
+// TrafficClasses lists the traffic classes of flows.
+var TrafficClasses = []string{
+	TrafficClassIntraNode,
+	TrafficClassInterNode,
+	TrafficClassPodToService,
+	TrafficClassPodToExternal,
+	TrafficClassExternalToPod,
+	TrafficClassHostNetwork,
+	TrafficClassUnknown,
+}
+
+// Resolutions of the flow records from which statistics are computed. The
+// rollups of the flow records sum their traffic by time bucket, source and
+// destination, and are kept longer than the flow records.
+const (
+	// The resolution is selected from the window: the flow records for
+	// windows shorter than 1 hour, the 1-minute rollups for windows shorter
+	// than 60 hours, and the 1-hour rollups otherwise.
+	FlowResolutionAuto = "auto"
+	// The flow records.
+	FlowResolutionRaw = "raw"
+	// The rollups of the flow records by minute.
+	FlowResolution1m = "1m"
+	// The rollups of the flow records by hour.
+	FlowResolution1h = "1h"
+)
+
+// FlowResolutions lists the resolutions of the flow records from which
+// statistics are computed.
+var FlowResolutions = []string{
+	FlowResolutionAuto,
+	FlowResolutionRaw,
+	FlowResolution1m,
+	FlowResolution1h,
+}
+
+// TrafficClassStats holds the number of flow records and the number of bytes
+// of a traffic class.
+type TrafficClassStats struct {
+	TrafficClass string `json:"trafficClass,omitempty"`
+	Flows        string `json:"flows,omitempty"`
+	Bytes        string `json:"bytes,omitempty"`
+}
+
+// NodeFlowStats holds the number of flow records of a Node, i.e. of the flows
+// of which the Node is the source or the destination Node, and the end time of
+// its last flow.
+type NodeFlowStats struct {
+	Name        string `json:"name,omitempty"`
+	Flows       string `json:"flows,omitempty"`
+	LastFlowEnd string `json:"lastFlowEnd,omitempty"`
+}
+
+// Groupings of the flows of top talkers.
+const (
+	// Flows are grouped by source and destination Pod. Endpoints which are
+	// not Pods are identified by their Service or IP.
+	TopTalkersGroupByPods = "pods"
+	// Flows are grouped by source and destination Namespace. Endpoints which
+	// are not Pods are identified by their Service or IP.
+	TopTalkersGroupByNamespaces = "namespaces"
+)
+
+// TopTalkersGroupBys lists the groupings of the flows of top talkers.
+var TopTalkersGroupBys = []string{
+	TopTalkersGroupByPods,
+	TopTalkersGroupByNamespaces,
+}
+
+// Sort keys of top talkers.
+const (
+	// Bytes sent from the source to the destination.
+	TopTalkersSortByBytes = "bytes"
+	// Packets sent from the source to the destination.
+	TopTalkersSortByPackets = "packets"
+	// Bytes sent back from the destination to the source.
+	TopTalkersSortByReverseBytes = "reverse-bytes"
+	// Packets sent back from the destination to the source.
+	TopTalkersSortByReversePackets = "reverse-packets"
+)
+
+// TopTalkersSortBys lists the sort keys of top talkers.
+var TopTalkersSortBys = []string{
+	TopTalkersSortByBytes,
+	TopTalkersSortByPackets,
+	TopTalkersSortByReverseBytes,
+	TopTalkersSortByReversePackets,
+}
+
+// TopTalkerStats holds the traffic exchanged by a source and a destination,
+// in both directions, and its average throughput over the window.
+type TopTalkerStats struct {
+	Source         string `json:"source,omitempty"`
+	Destination    string `json:"destination,omitempty"`
+	Flows          string `json:"flows,omitempty"`
+	Bytes          string `json:"bytes,omitempty"`
+	Packets        string `json:"packets,omitempty"`
+	ReverseBytes   string `json:"reverseBytes,omitempty"`
+	ReversePackets string `json:"reversePackets,omitempty"`
+	// Throughput is the average number of bytes per second exchanged in
+	// both directions over the window.
+	Throughput string `json:"throughput,omitempty"`
+}
+
+// Directions of the flows of a workload.
+const (
+	// Flows to the Pods of the workload.
+	WorkloadFlowDirectionIngress = "ingress"
+	// Flows from the Pods of the workload.
+	WorkloadFlowDirectionEgress = "egress"
+)
+
+// WorkloadFlowStats holds the traffic exchanged by the Pods of a workload with
+// a peer on a port, and the NetworkPolicies which were applied to it. Peers
+// which are not Pods are identified by their Service or IP. The policies are
+// formatted as "<namespace>/<name> (<action>)", and are empty if no policy
+// was applied.
+type WorkloadFlowStats struct {
+	Direction string `json:"direction,omitempty"`
+	Peer      string `json:"peer,omitempty"`
+	// Port is the destination port and protocol of the flows, e.g. "80/TCP".
+	Port  string `json:"port,omitempty"`
+	Flows string `json:"flows,omitempty"`
+	// BytesSent and BytesReceived are the bytes sent and received by the
+	// Pods of the workload.
+	BytesSent     string `json:"bytesSent,omitempty"`
+	BytesReceived string `json:"bytesReceived,omitempty"`
+	IngressPolicy string `json:"ingressPolicy,omitempty"`
+	EgressPolicy  string `json:"egressPolicy,omitempty"`
+}
+
+// PolicyHitStats holds the number of flow records and the number of bytes to
+// which a NetworkPolicy rule was applied in one direction. The policy is
+// formatted as "<namespace>/<name>", or "<name>" for cluster-scoped policies,
+// and the action is one of Allow, Drop or Reject.
+type PolicyHitStats struct {
+	Direction string `json:"direction,omitempty"`
+	Policy    string `json:"policy,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Flows     string `json:"flows,omitempty"`
+	Bytes     string `json:"bytes,omitempty"`
+}
+
+// Kinds of NetworkPolicies applied to flows, recorded by Antrea as the
+// ingressNetworkPolicyType and egressNetworkPolicyType of the flows.
+const (
+	PolicyKindK8sNetworkPolicy           = "K8sNetworkPolicy"
+	PolicyKindAntreaNetworkPolicy        = "AntreaNetworkPolicy"
+	PolicyKindAntreaClusterNetworkPolicy = "AntreaClusterNetworkPolicy"
+	PolicyKindUnknown                    = "Unknown"
+)
+
+// PolicyTrafficStats holds the numbers of flows, and their total bytes, which
+// were allowed and which were dropped or rejected by the rules of a
+// NetworkPolicy, in either direction, and the end time of its last flow. The
+// Namespace is empty for cluster-scoped policies.
+type PolicyTrafficStats struct {
+	Kind         string `json:"kind,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+	Name         string `json:"name,omitempty"`
+	AllowedFlows string `json:"allowedFlows,omitempty"`
+	AllowedBytes string `json:"allowedBytes,omitempty"`
+	DeniedFlows  string `json:"deniedFlows,omitempty"`
+	DeniedBytes  string `json:"deniedBytes,omitempty"`
+	LastFlowEnd  string `json:"lastFlowEnd,omitempty"`
+}
+
+// Consistency checks of the stored flow records, which detect bugs of the
+// Flow Exporter or of the Flow Aggregator.
+const (
+	// The total byte counts of the records of a flow, in both directions,
+	// do not decrease as the flow is updated. Flows are identified by their
+	// 5-tuple and start time, and only the flows with several records are
+	// checked.
+	FlowIntegrityCheckMonotonicBytes = "monotonic-bytes"
+	// The start time of a flow record is not after its end time.
+	FlowIntegrityCheckStartBeforeEnd = "start-before-end"
+	// The records of inter-node flows have both their source and
+	// destination Pods, which the Flow Aggregator gets by correlating the
+	// records exported from both Nodes.
+	FlowIntegrityCheckInterNodeCorrelation = "inter-node-correlation"
+)
+
+// FlowIntegrityStats holds the number of flow records, or of flows, on which
+// a consistency check was run, and the number of them which failed it.
+type FlowIntegrityStats struct {
+	Check     string `json:"check,omitempty"`
+	Checked   string `json:"checked,omitempty"`
+	Anomalies string `json:"anomalies,omitempty"`
+}
+
+// NamespacePostureStats holds the number of flows of a Namespace, the number
+// of them to which no NetworkPolicy was applied in either direction, and the
+// number of them which were dropped or rejected. The flows are counted once,
+// from their latest state, in the Namespace of their source Pod, or of their
+// destination Pod if the source is not a Pod.
+type NamespacePostureStats struct {
+	Namespace        string `json:"namespace,omitempty"`
+	Flows            string `json:"flows,omitempty"`
+	UnprotectedFlows string `json:"unprotectedFlows,omitempty"`
+	DeniedFlows      string `json:"deniedFlows,omitempty"`
+}
+
+// Formats of the exported flow records.
+const (
+	// CSV with a header row of the column names.
+	FlowExportFormatCSV = "csv"
+	// Apache Parquet.
+	FlowExportFormatParquet = "parquet"
+)
+
+// FlowExportFormats lists the formats of the exported flow records.
+var FlowExportFormats = []string{
+	FlowExportFormatCSV,
+	FlowExportFormatParquet,
+}
+
+// FlowExportCompressionGzip compresses the stream of the exported flow records
+// with gzip.
+const FlowExportCompressionGzip = "gzip"
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FlowStatsGetOptions are the query options of a FlowStats Get request.
+type FlowStatsGetOptions struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Window is the duration before now over which the statistics are
+	// computed, e.g. "1h".
+	Window string `json:"window,omitempty"`
+	// TrafficClass selects the flows of a traffic class, e.g. "inter-node".
+	TrafficClass string `json:"trafficClass,omitempty"`
+	// Resolution selects the resolution of the flow records from which
+	// traffic classes and top talkers are computed, e.g. "1m".
+	Resolution string `json:"resolution,omitempty"`
+	// GroupBy selects how the flows of top talkers are grouped, "pods" or
+	// "namespaces".
+	GroupBy string `json:"groupBy,omitempty"`
+	// SortBy selects the key top talkers are sorted by, e.g. "bytes".
+	SortBy string `json:"sortBy,omitempty"`
+	// Limit is the maximum number of top talkers, or of peers and ports per
+	// direction in a workload summary, e.g. "10".
+	Limit string `json:"limit,omitempty"`
+	// StartTime and EndTime select the exported flow records which ended in
+	// [StartTime, EndTime), in RFC 3339 format.
+	StartTime string `json:"startTime,omitempty"`
+	EndTime   string `json:"endTime,omitempty"`
+	// Format is the format of the exported flow records, "csv" or "parquet".
+	Format string `json:"format,omitempty"`
+	// BatchSize is the number of flow records read from ClickHouse at once
+	// when exporting them, e.g. "65536".
+	BatchSize string `json:"batchSize,omitempty"`
+	// Compression is the compression of the stream of the exported flow
+	// records, "gzip" or empty for none.
+	Compression string `json:"compression,omitempty"`
+	// Namespace is the Namespace of the Pods of the summarized workload.
+	Namespace string `json:"namespace,omitempty"`
+	// PodName selects the summarized Pod by name.
+	PodName string `json:"podName,omitempty"`
+	// PodSelector selects the Pods of the summarized workload by their
+	// labels recorded in the flows, e.g. "app=web,tier=frontend". Only
+	// equality-based requirements are supported.
+	PodSelector string `json:"podSelector,omitempty"`
+}
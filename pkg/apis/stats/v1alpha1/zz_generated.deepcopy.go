@@ -23,6 +23,63 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClickHouseColdStorage) DeepCopyInto(out *ClickHouseColdStorage) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Tables != nil {
+		in, out := &in.Tables, &out.Tables
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClickHouseColdStorage.
+func (in *ClickHouseColdStorage) DeepCopy() *ClickHouseColdStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(ClickHouseColdStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClickHouseColdStorage) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClickHouseUser) DeepCopyInto(out *ClickHouseUser) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClickHouseUser.
+func (in *ClickHouseUser) DeepCopy() *ClickHouseUser {
+	if in == nil {
+		return nil
+	}
+	out := new(ClickHouseUser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClickHouseUser) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClickHouseStats) DeepCopyInto(out *ClickHouseStats) {
 	*out = *in
@@ -53,6 +110,26 @@ func (in *ClickHouseStats) DeepCopyInto(out *ClickHouseStats) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.RetentionHistory != nil {
+		in, out := &in.RetentionHistory, &out.RetentionHistory
+		*out = make([]DeletionRecord, len(*in))
+		copy(*out, *in)
+	}
+	if in.SystemMetrics != nil {
+		in, out := &in.SystemMetrics, &out.SystemMetrics
+		*out = make([]SystemMetric, len(*in))
+		copy(*out, *in)
+	}
+	if in.SchemaVersions != nil {
+		in, out := &in.SchemaVersions, &out.SchemaVersions
+		*out = make([]SchemaVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.MigrationProgress != nil {
+		in, out := &in.MigrationProgress, &out.MigrationProgress
+		*out = make([]MigrationProgress, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -74,6 +151,22 @@ func (in *ClickHouseStats) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeletionRecord) DeepCopyInto(out *DeletionRecord) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeletionRecord.
+func (in *DeletionRecord) DeepCopy() *DeletionRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(DeletionRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DiskInfo) DeepCopyInto(out *DiskInfo) {
 	*out = *in
@@ -90,6 +183,130 @@ func (in *DiskInfo) DeepCopy() *DiskInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowCardinality) DeepCopyInto(out *FlowCardinality) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowCardinality.
+func (in *FlowCardinality) DeepCopy() *FlowCardinality {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowCardinality)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowIntegrityStats) DeepCopyInto(out *FlowIntegrityStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowIntegrityStats.
+func (in *FlowIntegrityStats) DeepCopy() *FlowIntegrityStats {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowIntegrityStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowStats) DeepCopyInto(out *FlowStats) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Cardinality = in.Cardinality
+	if in.TrafficClasses != nil {
+		in, out := &in.TrafficClasses, &out.TrafficClasses
+		*out = make([]TrafficClassStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]NodeFlowStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.TopTalkers != nil {
+		in, out := &in.TopTalkers, &out.TopTalkers
+		*out = make([]TopTalkerStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.WorkloadFlows != nil {
+		in, out := &in.WorkloadFlows, &out.WorkloadFlows
+		*out = make([]WorkloadFlowStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.PolicyHits != nil {
+		in, out := &in.PolicyHits, &out.PolicyHits
+		*out = make([]PolicyHitStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.Posture != nil {
+		in, out := &in.Posture, &out.Posture
+		*out = make([]NamespacePostureStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.PolicyTraffic != nil {
+		in, out := &in.PolicyTraffic, &out.PolicyTraffic
+		*out = make([]PolicyTrafficStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.Integrity != nil {
+		in, out := &in.Integrity, &out.Integrity
+		*out = make([]FlowIntegrityStats, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowStats.
+func (in *FlowStats) DeepCopy() *FlowStats {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlowStats) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowStatsGetOptions) DeepCopyInto(out *FlowStatsGetOptions) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowStatsGetOptions.
+func (in *FlowStatsGetOptions) DeepCopy() *FlowStatsGetOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowStatsGetOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlowStatsGetOptions) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InsertRate) DeepCopyInto(out *InsertRate) {
 	*out = *in
@@ -106,6 +323,102 @@ func (in *InsertRate) DeepCopy() *InsertRate {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MigrationProgress) DeepCopyInto(out *MigrationProgress) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationProgress.
+func (in *MigrationProgress) DeepCopy() *MigrationProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationProgress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacePostureStats) DeepCopyInto(out *NamespacePostureStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacePostureStats.
+func (in *NamespacePostureStats) DeepCopy() *NamespacePostureStats {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacePostureStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeFlowStats) DeepCopyInto(out *NodeFlowStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeFlowStats.
+func (in *NodeFlowStats) DeepCopy() *NodeFlowStats {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeFlowStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyHitStats) DeepCopyInto(out *PolicyHitStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyHitStats.
+func (in *PolicyHitStats) DeepCopy() *PolicyHitStats {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyHitStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyTrafficStats) DeepCopyInto(out *PolicyTrafficStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyTrafficStats.
+func (in *PolicyTrafficStats) DeepCopy() *PolicyTrafficStats {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyTrafficStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaVersion) DeepCopyInto(out *SchemaVersion) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaVersion.
+func (in *SchemaVersion) DeepCopy() *SchemaVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackTrace) DeepCopyInto(out *StackTrace) {
 	*out = *in
@@ -122,6 +435,22 @@ func (in *StackTrace) DeepCopy() *StackTrace {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SystemMetric) DeepCopyInto(out *SystemMetric) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SystemMetric.
+func (in *SystemMetric) DeepCopy() *SystemMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(SystemMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TableInfo) DeepCopyInto(out *TableInfo) {
 	*out = *in
@@ -137,3 +466,51 @@ func (in *TableInfo) DeepCopy() *TableInfo {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopTalkerStats) DeepCopyInto(out *TopTalkerStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopTalkerStats.
+func (in *TopTalkerStats) DeepCopy() *TopTalkerStats {
+	if in == nil {
+		return nil
+	}
+	out := new(TopTalkerStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficClassStats) DeepCopyInto(out *TrafficClassStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficClassStats.
+func (in *TrafficClassStats) DeepCopy() *TrafficClassStats {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficClassStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadFlowStats) DeepCopyInto(out *WorkloadFlowStats) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadFlowStats.
+func (in *WorkloadFlowStats) DeepCopy() *WorkloadFlowStats {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadFlowStats)
+	in.DeepCopyInto(out)
+	return out
+}
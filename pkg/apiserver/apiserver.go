@@ -35,9 +35,14 @@ import (
 	systeminstall "antrea.io/theia/pkg/apis/system/install"
 	system "antrea.io/theia/pkg/apis/system/v1alpha1"
 	"antrea.io/theia/pkg/apiserver/certificate"
+	"antrea.io/theia/pkg/apiserver/registry/intelligence/analyticsjob"
+	"antrea.io/theia/pkg/apiserver/registry/intelligence/jobtemplate"
 	"antrea.io/theia/pkg/apiserver/registry/intelligence/networkpolicyrecommendation"
 	throughputanomalydetector "antrea.io/theia/pkg/apiserver/registry/intelligence/throughputanomalydetector"
 	clickhouseStatus "antrea.io/theia/pkg/apiserver/registry/stats/clickhouse"
+	"antrea.io/theia/pkg/apiserver/registry/stats/clickhouseuser"
+	"antrea.io/theia/pkg/apiserver/registry/stats/coldstorage"
+	flowStats "antrea.io/theia/pkg/apiserver/registry/stats/flows"
 	"antrea.io/theia/pkg/apiserver/registry/system/supportbundle"
 	"antrea.io/theia/pkg/querier"
 )
@@ -81,6 +86,7 @@ type ExtraConfig struct {
 	npRecommendationQuerier          querier.NPRecommendationQuerier
 	clickHouseStatQuerier            querier.ClickHouseStatQuerier
 	throughputAnomalyDetectorQuerier querier.ThroughputAnomalyDetectorQuerier
+	analyticsJobQuerier              querier.AnalyticsJobQuerier
 }
 
 // Config defines the config for Theia manager apiserver.
@@ -95,6 +101,7 @@ type TheiaManagerAPIServer struct {
 	NPRecommendationQuerier          querier.NPRecommendationQuerier
 	ClickHouseStatusQuerier          querier.ClickHouseStatQuerier
 	ThroughputAnomalyDetectorQuerier querier.ThroughputAnomalyDetectorQuerier
+	AnalyticsJobQuerier              querier.AnalyticsJobQuerier
 }
 
 func (s *TheiaManagerAPIServer) Run(ctx context.Context) error {
@@ -114,6 +121,7 @@ func NewConfig(
 	npRecommendationQuerier querier.NPRecommendationQuerier,
 	clickHouseStatQuerier querier.ClickHouseStatQuerier,
 	throughputAnomalyDetectorQuerier querier.ThroughputAnomalyDetectorQuerier,
+	analyticsJobQuerier querier.AnalyticsJobQuerier,
 ) *Config {
 	return &Config{
 		genericConfig: genericConfig,
@@ -124,6 +132,7 @@ func NewConfig(
 			npRecommendationQuerier:          npRecommendationQuerier,
 			clickHouseStatQuerier:            clickHouseStatQuerier,
 			throughputAnomalyDetectorQuerier: throughputAnomalyDetectorQuerier,
+			analyticsJobQuerier:              analyticsJobQuerier,
 		},
 	}
 }
@@ -131,17 +140,27 @@ func NewConfig(
 func installAPIGroup(s *TheiaManagerAPIServer, c Config) error {
 	npRecommendationStorage := networkpolicyrecommendation.NewREST(s.NPRecommendationQuerier)
 	clickhouseStatusStorage := clickhouseStatus.NewREST(s.ClickHouseStatusQuerier)
+	flowStatsStorage := flowStats.NewREST(s.ClickHouseStatusQuerier)
+	coldStorageStorage := coldstorage.NewREST(s.ClickHouseStatusQuerier)
+	clickHouseUserStorage := clickhouseuser.NewREST(s.ClickHouseStatusQuerier)
 	throughputAnomalyDetectorStorage := throughputanomalydetector.NewREST(s.ThroughputAnomalyDetectorQuerier)
+	jobTemplateStorage := jobtemplate.NewREST(s.AnalyticsJobQuerier)
+	analyticsJobStorage := analyticsjob.NewREST(s.AnalyticsJobQuerier)
 
 	intelligenceGroup := genericapiserver.NewDefaultAPIGroupInfo(intelligence.GroupName, scheme, parameterCodec, Codecs)
 	v1alpha1Storage := map[string]rest.Storage{}
 	v1alpha1Storage["networkpolicyrecommendations"] = npRecommendationStorage
 	v1alpha1Storage["throughputanomalydetectors"] = throughputAnomalyDetectorStorage
+	v1alpha1Storage["jobtemplates"] = jobTemplateStorage
+	v1alpha1Storage["analyticsjobs"] = analyticsJobStorage
 	intelligenceGroup.VersionedResourcesStorageMap["v1alpha1"] = v1alpha1Storage
 
 	statsGroup := genericapiserver.NewDefaultAPIGroupInfo(apistats.GroupName, scheme, parameterCodec, Codecs)
 	statsStorage := map[string]rest.Storage{}
 	statsStorage["clickhouse"] = clickhouseStatusStorage
+	statsStorage["flows"] = flowStatsStorage
+	statsStorage["coldstorage"] = coldStorageStorage
+	statsStorage["clickhouseusers"] = clickHouseUserStorage
 	statsGroup.VersionedResourcesStorageMap["v1alpha1"] = statsStorage
 
 	systemGroup := genericapiserver.NewDefaultAPIGroupInfo(system.GroupName, scheme, parameterCodec, Codecs)
@@ -173,6 +192,7 @@ func (c Config) New() (*TheiaManagerAPIServer, error) {
 		NPRecommendationQuerier:          c.extraConfig.npRecommendationQuerier,
 		ClickHouseStatusQuerier:          c.extraConfig.clickHouseStatQuerier,
 		ThroughputAnomalyDetectorQuerier: c.extraConfig.throughputAnomalyDetectorQuerier,
+		AnalyticsJobQuerier:              c.extraConfig.analyticsJobQuerier,
 	}
 	if err := installAPIGroup(apiServer, c); err != nil {
 		return nil, err
@@ -29,10 +29,15 @@ import (
 	"k8s.io/klog/v2"
 
 	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/version"
 )
 
 const (
 	CAConfigMapKey = "ca.crt"
+	// VersionAnnotation is the annotation of the CA ConfigMap with the
+	// version of the Theia Manager, so that the clients reading the CA
+	// bundle can check that they are compatible with it.
+	VersionAnnotation = "theia.antrea.io/version"
 )
 
 // CACertController is responsible for taking the CA certificate from the
@@ -124,12 +129,17 @@ func (c *CACertController) syncConfigMap(caCert []byte) error {
 			},
 		}
 	}
-	if caConfigMap.Data != nil && caConfigMap.Data[CAConfigMapKey] == string(caCert) {
+	theiaVersion := version.GetFullVersion()
+	if caConfigMap.Data != nil && caConfigMap.Data[CAConfigMapKey] == string(caCert) && caConfigMap.Annotations[VersionAnnotation] == theiaVersion {
 		return nil
 	}
 	caConfigMap.Data = map[string]string{
 		CAConfigMapKey: string(caCert),
 	}
+	if caConfigMap.Annotations == nil {
+		caConfigMap.Annotations = map[string]string{}
+	}
+	caConfigMap.Annotations[VersionAnnotation] = theiaVersion
 	if exists {
 		if _, err := c.client.CoreV1().ConfigMaps(caConfigMapNamespace).Update(context.TODO(), caConfigMap, metav1.UpdateOptions{}); err != nil {
 			return fmt.Errorf("error updating ConfigMap %s: %v", c.caConfig.CAConfigMapName, err)
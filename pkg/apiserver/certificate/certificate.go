@@ -42,7 +42,12 @@ const (
 
 // GetTheiaServerNames returns the DNS names that the TLS certificate will be signed with.
 func GetTheiaServerNames(serviceName string) []string {
-	namespace := env.GetTheiaNamespace()
+	return GetTheiaServerNamesInNamespace(serviceName, env.GetTheiaNamespace())
+}
+
+// GetTheiaServerNamesInNamespace returns the DNS names that the TLS certificate
+// of the Theia instance running in the given Namespace is signed with.
+func GetTheiaServerNamesInNamespace(serviceName, namespace string) []string {
 	theiaServerName := serviceName + "." + namespace + ".svc"
 	// TODO: Add the whole FQDN "theia-manager.<Namespace>.svc.<Cluster Domain>" as an
 	// alternate DNS name when other clients need to access it directly with that name.
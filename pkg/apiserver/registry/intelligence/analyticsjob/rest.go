@@ -0,0 +1,179 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyticsjob
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/apiserver/utils/querylimit"
+	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util"
+	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/util/tracing"
+)
+
+const resultQuery = "SELECT result FROM analytics_job_results WHERE id = (?) ORDER BY timeCreated"
+
+// REST implements rest.Storage for analytics jobs.
+type REST struct {
+	AnalyticsJobQuerier querier.AnalyticsJobQuerier
+	clickhouseConnect   *sql.DB
+	queryLimiter        *querylimit.Limiter
+}
+
+var (
+	_ rest.Scoper          = &REST{}
+	_ rest.Getter          = &REST{}
+	_ rest.Lister          = &REST{}
+	_ rest.Creater         = &REST{}
+	_ rest.GracefulDeleter = &REST{}
+
+	setupClickHouseConnection = clickhouse.SetupConnection
+)
+
+// NewREST returns a REST object that will work against API services.
+func NewREST(q querier.AnalyticsJobQuerier) *REST {
+	return &REST{AnalyticsJobQuerier: q, queryLimiter: querylimit.ResultQueries}
+}
+
+func (r *REST) New() runtime.Object {
+	return &v1alpha1.AnalyticsJob{}
+}
+
+func (r *REST) Destroy() {
+}
+
+// Get returns an analytics job, with its result if it is completed.
+func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	job, err := r.AnalyticsJobQuerier.GetAnalyticsJob(env.GetTheiaNamespace(), name)
+	if err != nil {
+		return nil, errors.NewNotFound(v1alpha1.Resource("analyticsjobs"), name)
+	}
+	if job.Status.State == v1alpha1.AnalyticsJobStateCompleted {
+		release, err := r.queryLimiter.TryAcquire("analyticsjobs")
+		if err != nil {
+			return nil, err
+		}
+		job.Status.Result, err = r.getResult(job.Status.SparkApplication)
+		release()
+		if err != nil {
+			job.Status.ErrorMsg = fmt.Sprintf("Failed to get the result for completed analytics job with id %s, error: %v", job.Status.SparkApplication, err)
+		}
+	}
+	return job, nil
+}
+
+func (r *REST) NewList() runtime.Object {
+	return &v1alpha1.AnalyticsJobList{}
+}
+
+// List returns the analytics jobs, without their results.
+func (r *REST) List(ctx context.Context, options *internalversion.ListOptions) (runtime.Object, error) {
+	jobs, err := r.AnalyticsJobQuerier.ListAnalyticsJob(env.GetTheiaNamespace())
+	if err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("error when getting AnalyticsJobList: %v", err))
+	}
+	items := make([]v1alpha1.AnalyticsJob, 0, len(jobs))
+	for _, job := range jobs {
+		items = append(items, *job)
+	}
+	return &v1alpha1.AnalyticsJobList{Items: items}, nil
+}
+
+func (r *REST) NamespaceScoped() bool {
+	return false
+}
+
+func (r *REST) ConvertToTable(ctx context.Context, obj runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	return rest.NewDefaultTableConvertor(v1alpha1.Resource("analyticsjobs")).ConvertToTable(ctx, obj, tableOptions)
+}
+
+func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	newJob, ok := obj.(*v1alpha1.AnalyticsJob)
+	if !ok {
+		return nil, errors.NewBadRequest(fmt.Sprintf("not an AnalyticsJob object: %T", obj))
+	}
+	existJob, _ := r.AnalyticsJobQuerier.GetAnalyticsJob(env.GetTheiaNamespace(), newJob.Name)
+	if existJob != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("analytics job exists, name: %s", newJob.Name))
+	}
+	correlationID, err := util.GetRequestCorrelationID(newJob.Annotations)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	job := newJob.DeepCopy()
+	job.Annotations = map[string]string{util.CorrelationIDAnnotation: correlationID}
+	job.Status = v1alpha1.AnalyticsJobStatus{}
+	err = r.AnalyticsJobQuerier.CreateAnalyticsJob(env.GetTheiaNamespace(), job)
+	if err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("error when creating analytics job %s: %v", job.Name, err))
+	}
+	klog.InfoS("Created AnalyticsJob", "name", job.Name, "template", job.Template, "correlationID", correlationID)
+	return &metav1.Status{Status: metav1.StatusSuccess}, nil
+}
+
+func (r *REST) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	_, err := r.AnalyticsJobQuerier.GetAnalyticsJob(env.GetTheiaNamespace(), name)
+	if err != nil {
+		return nil, false, errors.NewBadRequest(fmt.Sprintf("analytics job doesn't exist, name: %s", name))
+	}
+	err = r.AnalyticsJobQuerier.DeleteAnalyticsJob(env.GetTheiaNamespace(), name)
+	if err != nil {
+		return nil, false, err
+	}
+	return &metav1.Status{Status: metav1.StatusSuccess}, false, nil
+}
+
+// getResult returns the records written by a job to the
+// analytics_job_results table, in the order in which they were written.
+func (r *REST) getResult(id string) ([]string, error) {
+	var err error
+	if r.clickhouseConnect == nil {
+		r.clickhouseConnect, err = setupClickHouseConnection(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", resultQuery)
+	rows, err := r.clickhouseConnect.Query(resultQuery, id)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get analytics job results with id %s: %v", id, err)
+	}
+	defer rows.Close()
+	var result []string
+	for rows.Next() {
+		var record string
+		if err := rows.Scan(&record); err != nil {
+			return nil, fmt.Errorf("failed to scan analytics job results: %v", err)
+		}
+		result = append(result, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read analytics job results: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyticsjob
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	"antrea.io/theia/pkg/util"
+)
+
+type fakeQuerier struct {
+	created *v1alpha1.AnalyticsJob
+}
+
+func (f *fakeQuerier) ListJobTemplates() []config.JobTemplateConfig {
+	return nil
+}
+
+func (f *fakeQuerier) GetAnalyticsJob(namespace, name string) (*v1alpha1.AnalyticsJob, error) {
+	switch name {
+	case "job-running":
+		return &v1alpha1.AnalyticsJob{
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Template:   "top-talkers",
+			Status:     v1alpha1.AnalyticsJobStatus{State: v1alpha1.AnalyticsJobStateRunning, SparkApplication: "running", CompletedStages: 1, TotalStages: 3},
+		}, nil
+	case "job-completed":
+		return &v1alpha1.AnalyticsJob{
+			ObjectMeta: v1.ObjectMeta{Name: name},
+			Template:   "top-talkers",
+			Status:     v1alpha1.AnalyticsJobStatus{State: v1alpha1.AnalyticsJobStateCompleted, SparkApplication: "completed"},
+		}, nil
+	}
+	return nil, fmt.Errorf("not found")
+}
+
+func (f *fakeQuerier) ListAnalyticsJob(namespace string) ([]*v1alpha1.AnalyticsJob, error) {
+	running, _ := f.GetAnalyticsJob(namespace, "job-running")
+	completed, _ := f.GetAnalyticsJob(namespace, "job-completed")
+	return []*v1alpha1.AnalyticsJob{running, completed}, nil
+}
+
+func (f *fakeQuerier) DeleteAnalyticsJob(namespace, name string) error {
+	return nil
+}
+
+func (f *fakeQuerier) CreateAnalyticsJob(namespace string, job *v1alpha1.AnalyticsJob) error {
+	if job.Template != "top-talkers" {
+		return fmt.Errorf("invalid request: job template %s does not exist", job.Template)
+	}
+	f.created = job
+	return nil
+}
+
+func TestREST_Get(t *testing.T) {
+	tests := []struct {
+		name         string
+		jobName      string
+		setupMock    func(mock sqlmock.Sqlmock)
+		expectErr    error
+		expectResult *v1alpha1.AnalyticsJob
+	}{
+		{
+			name:      "Not Found case",
+			jobName:   "job-unknown",
+			expectErr: errors.NewNotFound(v1alpha1.Resource("analyticsjobs"), "job-unknown"),
+		},
+		{
+			name:    "Running job case",
+			jobName: "job-running",
+			expectResult: &v1alpha1.AnalyticsJob{
+				ObjectMeta: v1.ObjectMeta{Name: "job-running"},
+				Template:   "top-talkers",
+				Status:     v1alpha1.AnalyticsJobStatus{State: v1alpha1.AnalyticsJobStateRunning, SparkApplication: "running", CompletedStages: 1, TotalStages: 3},
+			},
+		},
+		{
+			name:    "Completed job case",
+			jobName: "job-completed",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(resultQuery).WithArgs("completed").WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow(`{"pod":"web"}`).AddRow(`{"pod":"db"}`))
+			},
+			expectResult: &v1alpha1.AnalyticsJob{
+				ObjectMeta: v1.ObjectMeta{Name: "job-completed"},
+				Template:   "top-talkers",
+				Status: v1alpha1.AnalyticsJobStatus{
+					State:            v1alpha1.AnalyticsJobStateCompleted,
+					SparkApplication: "completed",
+					Result:           []string{`{"pod":"web"}`, `{"pod":"db"}`},
+				},
+			},
+		},
+		{
+			name:    "Completed job query error case",
+			jobName: "job-completed",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(resultQuery).WithArgs("completed").WillReturnError(fmt.Errorf("error in database, please retry"))
+			},
+			expectResult: &v1alpha1.AnalyticsJob{
+				ObjectMeta: v1.ObjectMeta{Name: "job-completed"},
+				Template:   "top-talkers",
+				Status: v1alpha1.AnalyticsJobStatus{
+					State:            v1alpha1.AnalyticsJobStateCompleted,
+					SparkApplication: "completed",
+					ErrorMsg:         "Failed to get the result for completed analytics job with id completed, error: failed to get analytics job results with id completed: error in database, please retry",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+			if tt.setupMock != nil {
+				tt.setupMock(mock)
+			}
+			setupClickHouseConnection = func(client kubernetes.Interface) (connect *sql.DB, err error) {
+				return db, nil
+			}
+			r := NewREST(&fakeQuerier{})
+			job, err := r.Get(context.TODO(), tt.jobName, &v1.GetOptions{})
+			assert.Equal(t, tt.expectErr, err)
+			if tt.expectResult != nil {
+				assert.Equal(t, tt.expectResult, job)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestREST_List(t *testing.T) {
+	r := NewREST(&fakeQuerier{})
+	itemList, err := r.List(context.TODO(), &internalversion.ListOptions{})
+	require.NoError(t, err)
+	jobList, ok := itemList.(*v1alpha1.AnalyticsJobList)
+	require.True(t, ok)
+	require.Len(t, jobList.Items, 2)
+	assert.Equal(t, "job-running", jobList.Items[0].Name)
+	assert.Equal(t, "job-completed", jobList.Items[1].Name)
+	// The results are only returned when getting a job.
+	assert.Empty(t, jobList.Items[1].Status.Result)
+}
+
+func TestREST_Create(t *testing.T) {
+	tests := []struct {
+		name         string
+		obj          runtime.Object
+		expectErr    error
+		expectResult runtime.Object
+	}{
+		{
+			name:      "Wrong object case",
+			obj:       &v1alpha1.JobTemplate{},
+			expectErr: errors.NewBadRequest(fmt.Sprintf("not an AnalyticsJob object: %T", &v1alpha1.JobTemplate{})),
+		},
+		{
+			name: "Job already exists case",
+			obj: &v1alpha1.AnalyticsJob{
+				ObjectMeta: v1.ObjectMeta{Name: "job-running"},
+				Template:   "top-talkers",
+			},
+			expectErr: errors.NewBadRequest("analytics job exists, name: job-running"),
+		},
+		{
+			name: "Invalid job case",
+			obj: &v1alpha1.AnalyticsJob{
+				ObjectMeta: v1.ObjectMeta{Name: "job-new"},
+				Template:   "unknown",
+			},
+			expectErr: errors.NewBadRequest("error when creating analytics job job-new: invalid request: job template unknown does not exist"),
+		},
+		{
+			name: "Invalid correlation ID case",
+			obj: &v1alpha1.AnalyticsJob{
+				ObjectMeta: v1.ObjectMeta{Name: "job-new", Annotations: map[string]string{util.CorrelationIDAnnotation: "1234"}},
+				Template:   "top-talkers",
+			},
+			expectErr: errors.NewBadRequest("correlation ID 1234 is not a valid UUID: invalid UUID length: 4"),
+		},
+		{
+			name: "Successful Create case",
+			obj: &v1alpha1.AnalyticsJob{
+				ObjectMeta: v1.ObjectMeta{Name: "job-new"},
+				Template:   "top-talkers",
+				Args:       map[string]string{"limit": "5"},
+			},
+			expectResult: &v1.Status{Status: v1.StatusSuccess},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			querier := &fakeQuerier{}
+			r := NewREST(querier)
+			result, err := r.Create(context.TODO(), tt.obj, nil, &v1.CreateOptions{})
+			assert.Equal(t, tt.expectErr, err)
+			assert.Equal(t, tt.expectResult, result)
+			if tt.expectErr == nil {
+				require.NotNil(t, querier.created)
+				assert.Equal(t, map[string]string{"limit": "5"}, querier.created.Args)
+				assert.NotEmpty(t, querier.created.Annotations[util.CorrelationIDAnnotation])
+			}
+		})
+	}
+}
+
+func TestREST_Delete(t *testing.T) {
+	r := NewREST(&fakeQuerier{})
+	_, _, err := r.Delete(context.TODO(), "job-unknown", nil, &v1.DeleteOptions{})
+	assert.Equal(t, errors.NewBadRequest("analytics job doesn't exist, name: job-unknown"), err)
+	result, _, err := r.Delete(context.TODO(), "job-completed", nil, &v1.DeleteOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.Status{Status: v1.StatusSuccess}, result)
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobtemplate
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+
+	"antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	"antrea.io/theia/pkg/querier"
+)
+
+// REST implements rest.Storage for the templates of the analytics jobs,
+// which are read-only as they are set in the Theia Manager configuration.
+type REST struct {
+	AnalyticsJobQuerier querier.AnalyticsJobQuerier
+}
+
+var (
+	_ rest.Scoper = &REST{}
+	_ rest.Getter = &REST{}
+	_ rest.Lister = &REST{}
+)
+
+// NewREST returns a REST object that will work against API services.
+func NewREST(q querier.AnalyticsJobQuerier) *REST {
+	return &REST{AnalyticsJobQuerier: q}
+}
+
+func (r *REST) New() runtime.Object {
+	return &v1alpha1.JobTemplate{}
+}
+
+func (r *REST) Destroy() {
+}
+
+func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	for _, template := range r.AnalyticsJobQuerier.ListJobTemplates() {
+		if template.Name == name {
+			return copyJobTemplate(template), nil
+		}
+	}
+	return nil, errors.NewNotFound(v1alpha1.Resource("jobtemplates"), name)
+}
+
+func (r *REST) NewList() runtime.Object {
+	return &v1alpha1.JobTemplateList{}
+}
+
+func (r *REST) List(ctx context.Context, options *internalversion.ListOptions) (runtime.Object, error) {
+	templates := r.AnalyticsJobQuerier.ListJobTemplates()
+	items := make([]v1alpha1.JobTemplate, 0, len(templates))
+	for _, template := range templates {
+		items = append(items, *copyJobTemplate(template))
+	}
+	return &v1alpha1.JobTemplateList{Items: items}, nil
+}
+
+func (r *REST) NamespaceScoped() bool {
+	return false
+}
+
+func (r *REST) ConvertToTable(ctx context.Context, obj runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	return rest.NewDefaultTableConvertor(v1alpha1.Resource("jobtemplates")).ConvertToTable(ctx, obj, tableOptions)
+}
+
+// copyJobTemplate is used to copy a template from the Theia Manager
+// configuration to a JobTemplate.
+func copyJobTemplate(template config.JobTemplateConfig) *v1alpha1.JobTemplate {
+	jobTemplate := &v1alpha1.JobTemplate{
+		ObjectMeta:          metav1.ObjectMeta{Name: template.Name},
+		Description:         template.Description,
+		Image:               template.Image,
+		MainApplicationFile: template.MainApplicationFile,
+	}
+	for _, arg := range template.Args {
+		jobTemplate.Args = append(jobTemplate.Args, v1alpha1.JobTemplateArg{
+			Name:        arg.Name,
+			Description: arg.Description,
+			Required:    arg.Required,
+			Default:     arg.Default,
+		})
+	}
+	return jobTemplate
+}
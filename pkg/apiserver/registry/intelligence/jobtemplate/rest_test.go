@@ -0,0 +1,84 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobtemplate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	"antrea.io/theia/pkg/querier"
+)
+
+type fakeQuerier struct {
+	querier.AnalyticsJobQuerier
+}
+
+func (f *fakeQuerier) ListJobTemplates() []config.JobTemplateConfig {
+	return []config.JobTemplateConfig{
+		{
+			Name:                "port-scan",
+			Image:               "my-registry/theia-custom-jobs:latest",
+			MainApplicationFile: "local:///opt/spark/work-dir/port_scan.py",
+		},
+		{
+			Name:                "top-talkers",
+			Description:         "The Pods sending the most bytes",
+			Image:               "my-registry/theia-custom-jobs:latest",
+			MainApplicationFile: "local:///opt/spark/work-dir/top_talkers.py",
+			Args: []config.JobTemplateArgConfig{
+				{Name: "start_time", Description: "The start of the window", Required: true},
+				{Name: "limit", Default: "10"},
+			},
+		},
+	}
+}
+
+func TestREST_Get(t *testing.T) {
+	r := NewREST(&fakeQuerier{})
+	template, err := r.Get(context.TODO(), "top-talkers", &v1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, &v1alpha1.JobTemplate{
+		ObjectMeta:          v1.ObjectMeta{Name: "top-talkers"},
+		Description:         "The Pods sending the most bytes",
+		Image:               "my-registry/theia-custom-jobs:latest",
+		MainApplicationFile: "local:///opt/spark/work-dir/top_talkers.py",
+		Args: []v1alpha1.JobTemplateArg{
+			{Name: "start_time", Description: "The start of the window", Required: true},
+			{Name: "limit", Default: "10"},
+		},
+	}, template)
+
+	_, err = r.Get(context.TODO(), "unknown", &v1.GetOptions{})
+	assert.Equal(t, errors.NewNotFound(v1alpha1.Resource("jobtemplates"), "unknown"), err)
+}
+
+func TestREST_List(t *testing.T) {
+	r := NewREST(&fakeQuerier{})
+	itemList, err := r.List(context.TODO(), &internalversion.ListOptions{})
+	require.NoError(t, err)
+	templateList, ok := itemList.(*v1alpha1.JobTemplateList)
+	require.True(t, ok)
+	require.Len(t, templateList.Items, 2)
+	assert.Equal(t, "port-scan", templateList.Items[0].Name)
+	assert.Equal(t, "top-talkers", templateList.Items[1].Name)
+}
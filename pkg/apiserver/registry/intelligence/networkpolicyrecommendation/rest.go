@@ -17,52 +17,98 @@ package networkpolicyrecommendation
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
 
 	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/apiserver/utils/querylimit"
 	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/resultstore"
+	"antrea.io/theia/pkg/util"
 	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/util/tracing"
 )
 
+// maxRecommendationPageSize is the maximum number of recommended policies
+// returned by a single request, so that the Theia Manager never buffers a whole
+// recommendation result. It is also the page size used when the request does
+// not set a limit.
+const maxRecommendationPageSize int64 = 1000
+
 // REST implements rest.Storage for NetworkPolicyRecommendation.
 type REST struct {
 	npRecommendationQuerier querier.NPRecommendationQuerier
 	clickhouseConnect       *sql.DB
+	queryLimiter            *querylimit.Limiter
 }
 
+// resultCursor is the position of the last recommended policy of a page. The
+// policies are sorted by kind, hash of their yaml and yaml, so that the next
+// page is selected with a range condition rather than by skipping the policies
+// of the previous pages.
+type resultCursor = resultstore.Cursor
+
 var (
-	_ rest.Scoper          = &REST{}
-	_ rest.Getter          = &REST{}
-	_ rest.Lister          = &REST{}
-	_ rest.Creater         = &REST{}
-	_ rest.GracefulDeleter = &REST{}
+	_ rest.Scoper            = &REST{}
+	_ rest.GetterWithOptions = &REST{}
+	_ rest.Lister            = &REST{}
+	_ rest.Creater           = &REST{}
+	_ rest.GracefulDeleter   = &REST{}
 
 	setupClickHouseConnection = clickhouse.SetupConnection
 )
 
-const (
-	defaultNameSpace = "flow-visibility"
-)
-
 // NewREST returns a REST object that will work against API services.
 func NewREST(nprq querier.NPRecommendationQuerier) *REST {
-	return &REST{npRecommendationQuerier: nprq}
+	return &REST{npRecommendationQuerier: nprq, queryLimiter: querylimit.ResultQueries}
 }
 
 func (r *REST) New() runtime.Object {
 	return &intelligence.NetworkPolicyRecommendation{}
 }
 
-func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
-	npReco, err := r.npRecommendationQuerier.GetNetworkPolicyRecommendation(defaultNameSpace, name)
+// NewGetOptions returns the options used to retrieve the recommended policies
+// in pages.
+func (r *REST) NewGetOptions() (runtime.Object, bool, string) {
+	return &intelligence.NetworkPolicyRecommendationGetOptions{}, false, ""
+}
+
+func (r *REST) Get(ctx context.Context, name string, options runtime.Object) (runtime.Object, error) {
+	getOptions, ok := options.(*intelligence.NetworkPolicyRecommendationGetOptions)
+	if !ok || getOptions == nil {
+		getOptions = &intelligence.NetworkPolicyRecommendationGetOptions{}
+	}
+	if getOptions.Limit < 0 {
+		return nil, errors.NewBadRequest(fmt.Sprintf("invalid limit %d, it should not be negative", getOptions.Limit))
+	}
+	limit := getOptions.Limit
+	if limit == 0 || limit > maxRecommendationPageSize {
+		limit = maxRecommendationPageSize
+	}
+	var cursor *resultCursor
+	if getOptions.Continue != "" {
+		var err error
+		cursor, err = decodeResultCursor(getOptions.Continue)
+		if err != nil {
+			return nil, errors.NewBadRequest(fmt.Sprintf("invalid continue token %q", getOptions.Continue))
+		}
+	}
+	npReco, err := r.npRecommendationQuerier.GetNetworkPolicyRecommendation(env.GetTheiaNamespace(), name)
 	if err != nil {
 		return nil, errors.NewNotFound(intelligence.Resource("networkpolicyrecommendations"), name)
 	}
@@ -70,11 +116,45 @@ func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions)
 	r.copyNetworkPolicyRecommendation(intelliNPR, npReco)
 	// Try to retrieve result from ClickHouse in case NPR is completed
 	if npReco.Status.State == crdv1alpha1.NPRecommendationStateCompleted {
-		result, err := r.getRecommendationResult(npReco.Status.SparkApplication)
+		release, err := r.queryLimiter.TryAcquire("networkpolicyrecommendations")
+		if err != nil {
+			return nil, err
+		}
+		if getOptions.Report {
+			coverage, err := r.getRecommendationCoverage(npReco.Status.SparkApplication)
+			if err != nil {
+				release()
+				intelliNPR.Status.ErrorMsg = fmt.Sprintf("Failed to get the coverage for completed NetworkPolicy Recommendation with id %s, error: %v", npReco.Status.SparkApplication, err)
+				return intelliNPR, nil
+			}
+			intelliNPR.Status.Coverage = coverage
+			dataWindow, err := r.getRecommendationDataWindow(npReco.Status.SparkApplication)
+			release()
+			if err != nil {
+				intelliNPR.Status.ErrorMsg = fmt.Sprintf("Failed to get the data window for completed NetworkPolicy Recommendation with id %s, error: %v", npReco.Status.SparkApplication, err)
+			} else if dataWindow != nil {
+				dataWindow.Caveats = getDataWindowCaveats(npReco, dataWindow)
+				intelliNPR.Status.DataWindow = dataWindow
+			}
+			return intelliNPR, nil
+		}
+		defer release()
+		result, next, err := r.getRecommendationResultPage(npReco.Status.SparkApplication, limit, cursor)
 		if err != nil {
 			intelliNPR.Status.ErrorMsg = fmt.Sprintf("Failed to get the result for completed NetworkPolicy Recommendation with id %s, error: %v", npReco.Status.SparkApplication, err)
-		} else {
-			intelliNPR.Status.RecommendationOutcome = result
+			return intelliNPR, nil
+		}
+		intelliNPR.Status.RecommendationOutcome = result
+		intelliNPR.Status.Continue = next
+		// A job which recommended no policy stores the reason with its data
+		// window, so that an empty result is not mistaken for a failure.
+		if result == "" && cursor == nil {
+			dataWindow, err := r.getRecommendationDataWindow(npReco.Status.SparkApplication)
+			if err != nil {
+				intelliNPR.Status.ErrorMsg = fmt.Sprintf("Failed to get the data window for completed NetworkPolicy Recommendation with id %s, error: %v", npReco.Status.SparkApplication, err)
+			} else if dataWindow != nil {
+				intelliNPR.Status.EmptyResultReason = dataWindow.EmptyResultReason
+			}
 		}
 	}
 	return intelliNPR, nil
@@ -88,21 +168,35 @@ func (r *REST) Destroy() {
 }
 
 func (r *REST) List(ctx context.Context, options *internalversion.ListOptions) (runtime.Object, error) {
-	npRecoList, err := r.npRecommendationQuerier.ListNetworkPolicyRecommendation(defaultNameSpace)
+	// The jobs are selected by label before their results are read from
+	// ClickHouse, e.g. by tag with theia.antrea.io/job-type=policy-reco,team=netsec.
+	selector := labels.Everything()
+	if options != nil && options.LabelSelector != nil {
+		selector = options.LabelSelector
+	}
+	npRecoList, err := r.npRecommendationQuerier.ListNetworkPolicyRecommendation(env.GetTheiaNamespace(), selector)
 	if err != nil {
 		return nil, errors.NewBadRequest(fmt.Sprintf("error when getting NetworkPolicyRecommendationsList: %v", err))
 	}
+	release, err := r.queryLimiter.TryAcquire("networkpolicyrecommendations")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	items := make([]intelligence.NetworkPolicyRecommendation, 0, len(npRecoList))
 	for _, npReco := range npRecoList {
 		intelliNPR := new(intelligence.NetworkPolicyRecommendation)
 		r.copyNetworkPolicyRecommendation(intelliNPR, npReco)
-		// Try to retrieve result from ClickHouse in case NPR is completed
+		// Try to retrieve result from ClickHouse in case NPR is completed. Only
+		// the first page of every result is listed, the following pages can be
+		// retrieved with Get using the continue token.
 		if npReco.Status.State == crdv1alpha1.NPRecommendationStateCompleted {
-			result, err := r.getRecommendationResult(npReco.Status.SparkApplication)
+			result, next, err := r.getRecommendationResultPage(npReco.Status.SparkApplication, maxRecommendationPageSize, nil)
 			if err != nil {
 				intelliNPR.Status.ErrorMsg += fmt.Sprintf("Failed to get the result for completed NetworkPolicy Recommedation with id %s, error: %v", npReco.Status.SparkApplication, err)
 			} else {
 				intelliNPR.Status.RecommendationOutcome = result
+				intelliNPR.Status.Continue = next
 			}
 		}
 		items = append(items, *intelliNPR)
@@ -124,12 +218,31 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	if !ok {
 		return nil, errors.NewBadRequest(fmt.Sprintf("not a NetworkPolicyRecommendation object: %T", obj))
 	}
-	existNPReco, _ := r.npRecommendationQuerier.GetNetworkPolicyRecommendation(defaultNameSpace, npReco.Name)
+	existNPReco, _ := r.npRecommendationQuerier.GetNetworkPolicyRecommendation(env.GetTheiaNamespace(), npReco.Name)
 	if existNPReco != nil {
 		return nil, errors.NewBadRequest(fmt.Sprintf("networkPolicyRecommendation job exists, name: %s", npReco.Name))
 	}
+	if err := util.ValidateJobTags(npReco.Tags); err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("invalid tags: %v", err))
+	}
+	if canary := npReco.Canary; canary != nil {
+		if err := util.ValidateRecommendationCanary(npReco.PolicyType, canary.Namespace, canary.SoakWindow.Duration, canary.MaxDeniedFlows); err != nil {
+			return nil, errors.NewBadRequest(err.Error())
+		}
+	}
+	if workload := npReco.Workload; workload != nil {
+		if err := util.ValidateRecommendationWorkload(npReco.PolicyType, workload.Namespace, workload.PodLabels); err != nil {
+			return nil, errors.NewBadRequest(err.Error())
+		}
+	}
+	correlationID, err := util.GetRequestCorrelationID(npReco.Annotations)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
 	job := new(crdv1alpha1.NetworkPolicyRecommendation)
 	job.Name = npReco.Name
+	job.Labels = util.GetJobLabels(util.JobTypePolicyRecommendation, npReco.Tags)
+	job.Annotations = map[string]string{util.CorrelationIDAnnotation: correlationID}
 	job.Spec.JobType = npReco.Type
 	job.Spec.Limit = npReco.Limit
 	job.Spec.PolicyType = npReco.PolicyType
@@ -143,19 +256,42 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	job.Spec.DriverMemory = npReco.DriverMemory
 	job.Spec.ExecutorCoreRequest = npReco.ExecutorCoreRequest
 	job.Spec.ExecutorMemory = npReco.ExecutorMemory
-	_, err := r.npRecommendationQuerier.CreateNetworkPolicyRecommendation(defaultNameSpace, job)
+	job.Spec.AutoSizeExecutors = npReco.AutoSizeExecutors
+	job.Spec.Preaggregate = npReco.Preaggregate
+	// The submitter is the authenticated user of the request, it cannot be
+	// set by clients.
+	if user, ok := genericapirequest.UserFrom(ctx); ok {
+		job.Spec.Submitter = user.GetName()
+	}
+	job.Spec.Tags = npReco.Tags
+	if canary := npReco.Canary; canary != nil {
+		job.Spec.Canary = &crdv1alpha1.NetworkPolicyRecommendationCanary{
+			Namespace:      canary.Namespace,
+			SoakWindow:     canary.SoakWindow,
+			MaxDeniedFlows: canary.MaxDeniedFlows,
+		}
+	}
+	if workload := npReco.Workload; workload != nil {
+		job.Spec.Workload = &crdv1alpha1.NetworkPolicyRecommendationWorkload{
+			Namespace: workload.Namespace,
+			Name:      workload.Name,
+			PodLabels: workload.PodLabels,
+		}
+	}
+	_, err = r.npRecommendationQuerier.CreateNetworkPolicyRecommendation(env.GetTheiaNamespace(), job)
 	if err != nil {
 		return nil, errors.NewBadRequest(fmt.Sprintf("error when creating NetworkPolicyRecommendation CR: %v", err))
 	}
+	klog.InfoS("Created NetworkPolicyRecommendation", "name", job.Name, "submitter", job.Spec.Submitter, "correlationID", correlationID)
 	return &metav1.Status{Status: metav1.StatusSuccess}, nil
 }
 
 func (r *REST) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
-	_, err := r.npRecommendationQuerier.GetNetworkPolicyRecommendation(defaultNameSpace, name)
+	_, err := r.npRecommendationQuerier.GetNetworkPolicyRecommendation(env.GetTheiaNamespace(), name)
 	if err != nil {
 		return nil, false, errors.NewBadRequest(fmt.Sprintf("NetworkPolicyRecommendation job doesn't exist, name: %s", name))
 	}
-	err = r.npRecommendationQuerier.DeleteNetworkPolicyRecommendation(defaultNameSpace, name)
+	err = r.npRecommendationQuerier.DeleteNetworkPolicyRecommendation(env.GetTheiaNamespace(), name)
 	if err != nil {
 		return nil, false, err
 	}
@@ -165,6 +301,9 @@ func (r *REST) Delete(ctx context.Context, name string, deleteValidation rest.Va
 // copyNetworkPolicyRecommendation is used to copy NetworkPolicyRecommendation from crd to intelligence
 func (r *REST) copyNetworkPolicyRecommendation(intelli *intelligence.NetworkPolicyRecommendation, crd *crdv1alpha1.NetworkPolicyRecommendation) error {
 	intelli.Name = crd.Name
+	if correlationID, ok := crd.Annotations[util.CorrelationIDAnnotation]; ok {
+		intelli.Annotations = map[string]string{util.CorrelationIDAnnotation: correlationID}
+	}
 	intelli.Type = crd.Spec.JobType
 	intelli.Limit = crd.Spec.Limit
 	intelli.PolicyType = crd.Spec.PolicyType
@@ -178,6 +317,10 @@ func (r *REST) copyNetworkPolicyRecommendation(intelli *intelligence.NetworkPoli
 	intelli.DriverMemory = crd.Spec.DriverMemory
 	intelli.ExecutorCoreRequest = crd.Spec.ExecutorCoreRequest
 	intelli.ExecutorMemory = crd.Spec.ExecutorMemory
+	intelli.AutoSizeExecutors = crd.Spec.AutoSizeExecutors
+	intelli.Preaggregate = crd.Spec.Preaggregate
+	intelli.Submitter = crd.Spec.Submitter
+	intelli.Tags = crd.Spec.Tags
 	intelli.Status.State = crd.Status.State
 	intelli.Status.SparkApplication = crd.Status.SparkApplication
 	intelli.Status.CompletedStages = crd.Status.CompletedStages
@@ -185,31 +328,177 @@ func (r *REST) copyNetworkPolicyRecommendation(intelli *intelligence.NetworkPoli
 	intelli.Status.ErrorMsg = crd.Status.ErrorMsg
 	intelli.Status.StartTime = crd.Status.StartTime
 	intelli.Status.EndTime = crd.Status.EndTime
+	if canary := crd.Spec.Canary; canary != nil {
+		intelli.Canary = &intelligence.NetworkPolicyRecommendationCanary{
+			Namespace:      canary.Namespace,
+			SoakWindow:     canary.SoakWindow,
+			MaxDeniedFlows: canary.MaxDeniedFlows,
+		}
+	}
+	if workload := crd.Spec.Workload; workload != nil {
+		intelli.Workload = &intelligence.NetworkPolicyRecommendationWorkload{
+			Namespace: workload.Namespace,
+			Name:      workload.Name,
+			PodLabels: workload.PodLabels,
+		}
+	}
+	if canaryStatus := crd.Status.Canary; canaryStatus != nil {
+		intelli.Status.Canary = &intelligence.NetworkPolicyRecommendationCanaryStatus{
+			Phase:           canaryStatus.Phase,
+			SoakStartTime:   canaryStatus.SoakStartTime,
+			DeniedFlows:     canaryStatus.DeniedFlows,
+			AppliedPolicies: canaryStatus.AppliedPolicies,
+			Message:         canaryStatus.Message,
+		}
+	}
 	return nil
 }
 
-func (r *REST) getRecommendationResult(id string) (result string, err error) {
+// getRecommendationResultPage returns at most limit recommended policies,
+// starting after cursor, or from the first policy if cursor is nil. If more
+// policies are available, the cursor of the last returned policy is encoded as
+// the continue token.
+func (r *REST) getRecommendationResultPage(id string, limit int64, cursor *resultCursor) (result string, next string, err error) {
+	// One more policy than requested is listed to know whether a next page
+	// exists.
+	policies, err := r.listRecommendedPolicies(id, limit+1, cursor)
+	if err != nil {
+		return result, next, err
+	}
+	if int64(len(policies)) > limit {
+		policies = policies[:limit]
+		next = encodeResultCursor(resultstore.NextCursor(cursor, policies))
+	}
+	yamls := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		yamls = append(yamls, policy.Policy)
+	}
+	result = strings.Join(yamls, "---\n")
+	return result, next, nil
+}
+
+// listRecommendedPolicies lists the recommended policies from the store to
+// which the results of the completed jobs are copied, if any, and from
+// ClickHouse if the result of the job was not copied. The order of the
+// policies is the same in all the stores, so that the pages of a result can
+// be read from different stores.
+func (r *REST) listRecommendedPolicies(id string, limit int64, cursor *resultCursor) ([]resultstore.Policy, error) {
+	if store := r.npRecommendationQuerier.GetRecommendationResultStore(); store != nil {
+		policies, err := store.List(context.TODO(), id, limit, cursor)
+		if err == nil {
+			return policies, nil
+		}
+		if !stderrors.Is(err, resultstore.ErrNotFound) {
+			return nil, err
+		}
+	}
+	return resultstore.NewClickHouseStore(r.connectClickHouse).List(context.TODO(), id, limit, cursor)
+}
+
+func (r *REST) connectClickHouse() (*sql.DB, error) {
 	if r.clickhouseConnect == nil {
+		var err error
 		r.clickhouseConnect, err = setupClickHouseConnection(nil)
 		if err != nil {
-			return result, err
+			return nil, err
 		}
 	}
-	query := "SELECT policy FROM recommendations WHERE id = (?);"
+	return r.clickhouseConnect, nil
+}
+
+// getRecommendationCoverage returns the number of flows matched and not
+// matched by the recommended policies, by Namespace. The coverage is empty for
+// the results of jobs which did not compute it.
+func (r *REST) getRecommendationCoverage(id string) (coverage []intelligence.NetworkPolicyRecommendationCoverage, err error) {
+	if r.clickhouseConnect == nil {
+		r.clickhouseConnect, err = setupClickHouseConnection(nil)
+		if err != nil {
+			return coverage, err
+		}
+	}
+	query := "SELECT namespace, matchedFlows, unmatchedFlows FROM recommendation_coverage WHERE id = (?) ORDER BY namespace;"
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
 	rows, err := r.clickhouseConnect.Query(query, id)
+	tracing.EndSpan(span, err)
 	if err != nil {
-		return result, fmt.Errorf("failed to get recommendation results with id %s: %v", id, err)
+		return coverage, fmt.Errorf("failed to get recommendation coverage with id %s: %v", id, err)
 	}
 	defer rows.Close()
-	var policies []string
 	for rows.Next() {
-		var policyYaml string
-		err := rows.Scan(&policyYaml)
+		var namespaceCoverage intelligence.NetworkPolicyRecommendationCoverage
+		err := rows.Scan(&namespaceCoverage.Namespace, &namespaceCoverage.MatchedFlows, &namespaceCoverage.UnmatchedFlows)
+		if err != nil {
+			return coverage, fmt.Errorf("failed to scan recommendation coverage: %v", err)
+		}
+		coverage = append(coverage, namespaceCoverage)
+	}
+	return coverage, nil
+}
+
+// getRecommendationDataWindow returns the data analyzed by a recommendation
+// job, or nil for the results of jobs which did not store it.
+func (r *REST) getRecommendationDataWindow(id string) (*intelligence.NetworkPolicyRecommendationDataWindow, error) {
+	var err error
+	if r.clickhouseConnect == nil {
+		r.clickhouseConnect, err = setupClickHouseConnection(nil)
 		if err != nil {
-			return result, fmt.Errorf("failed to scan recommendation results: %v", err)
+			return nil, err
+		}
+	}
+	query := "SELECT minFlowTime, maxFlowTime, flows, nodes, emptyResultReason FROM recommendation_data_window WHERE id = (?);"
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+	rows, err := r.clickhouseConnect.Query(query, id)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recommendation data window with id %s: %v", id, err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var minFlowTime, maxFlowTime time.Time
+	var nodes string
+	dataWindow := new(intelligence.NetworkPolicyRecommendationDataWindow)
+	if err := rows.Scan(&minFlowTime, &maxFlowTime, &dataWindow.Flows, &nodes, &dataWindow.EmptyResultReason); err != nil {
+		return nil, fmt.Errorf("failed to scan recommendation data window: %v", err)
+	}
+	if dataWindow.Flows > 0 {
+		dataWindow.MinFlowTime = metav1.NewTime(minFlowTime)
+		dataWindow.MaxFlowTime = metav1.NewTime(maxFlowTime)
+	}
+	for _, node := range strings.Split(nodes, ",") {
+		if node != "" {
+			dataWindow.Nodes = append(dataWindow.Nodes, node)
 		}
-		policies = append(policies, policyYaml)
 	}
-	result = strings.Join(policies, "---\n")
-	return result, nil
+	return dataWindow, nil
+}
+
+// getDataWindowCaveats returns the caveats of the data analyzed by a
+// recommendation job which can be told from the job and the data.
+func getDataWindowCaveats(npReco *crdv1alpha1.NetworkPolicyRecommendation, dataWindow *intelligence.NetworkPolicyRecommendationDataWindow) []string {
+	var caveats []string
+	if dataWindow.Flows == 0 {
+		caveats = append(caveats, "No flow record was found in the time range of the job, no traffic is allowed by the recommended policies")
+	} else if npReco.Spec.Limit > 0 && dataWindow.Flows > int64(npReco.Spec.Limit) {
+		caveats = append(caveats, fmt.Sprintf("The job read at most %d distinct flows of the %d flow records of the data window because of its limit, part of the traffic may not be allowed by the recommended policies", npReco.Spec.Limit, dataWindow.Flows))
+	}
+	return caveats
+}
+
+func encodeResultCursor(cursor *resultCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeResultCursor(token string) (*resultCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	cursor := new(resultCursor)
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
 }
@@ -19,20 +19,30 @@ import (
 	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 
 	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/apiserver/utils/querylimit"
+	"antrea.io/theia/pkg/resultstore"
+	"antrea.io/theia/pkg/util"
 )
 
-type fakeQuerier struct{}
+type fakeQuerier struct {
+	created     *crdv1alpha1.NetworkPolicyRecommendation
+	resultStore resultstore.Store
+}
 
 func TestREST_Get(t *testing.T) {
 	policy1 := `apiVersion: crd.antrea.io/v1alpha1
@@ -43,6 +53,7 @@ func TestREST_Get(t *testing.T) {
 	tests := []struct {
 		name         string
 		nprName      string
+		options      *intelligence.NetworkPolicyRecommendationGetOptions
 		expectErr    error
 		expectResult *intelligence.NetworkPolicyRecommendation
 	}{
@@ -65,6 +76,89 @@ func TestREST_Get(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:      "Successful Get case first page",
+			nprName:   "npr-2",
+			options:   &intelligence.NetworkPolicyRecommendationGetOptions{Limit: 1},
+			expectErr: nil,
+			expectResult: &intelligence.NetworkPolicyRecommendation{
+				Type:       "NPR",
+				PolicyType: "Allow",
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State:                 crdv1alpha1.NPRecommendationStateCompleted,
+					RecommendationOutcome: policy1,
+					Continue:              encodeResultCursor(&resultCursor{Kind: "acnp", Hash: 11}),
+				},
+			},
+		},
+		{
+			name:      "Successful Get case last page",
+			nprName:   "npr-2",
+			options:   &intelligence.NetworkPolicyRecommendationGetOptions{Limit: 1, Continue: encodeResultCursor(&resultCursor{Kind: "acnp", Hash: 11})},
+			expectErr: nil,
+			expectResult: &intelligence.NetworkPolicyRecommendation{
+				Type:       "NPR",
+				PolicyType: "Allow",
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State:                 crdv1alpha1.NPRecommendationStateCompleted,
+					RecommendationOutcome: policy2,
+				},
+			},
+		},
+		{
+			name:      "Successful Get case limit capped",
+			nprName:   "npr-2",
+			options:   &intelligence.NetworkPolicyRecommendationGetOptions{Limit: maxRecommendationPageSize + 1},
+			expectErr: nil,
+			expectResult: &intelligence.NetworkPolicyRecommendation{
+				Type:       "NPR",
+				PolicyType: "Allow",
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State:                 crdv1alpha1.NPRecommendationStateCompleted,
+					RecommendationOutcome: fmt.Sprintf("%s---\n%s", policy1, policy2),
+				},
+			},
+		},
+		{
+			name:         "Invalid continue token",
+			nprName:      "npr-2",
+			options:      &intelligence.NetworkPolicyRecommendationGetOptions{Limit: 1, Continue: "abc"},
+			expectErr:    errors.NewBadRequest("invalid continue token \"abc\""),
+			expectResult: nil,
+		},
+		{
+			name:         "Legacy offset continue token",
+			nprName:      "npr-2",
+			options:      &intelligence.NetworkPolicyRecommendationGetOptions{Limit: 1, Continue: "1"},
+			expectErr:    errors.NewBadRequest("invalid continue token \"1\""),
+			expectResult: nil,
+		},
+		{
+			name:      "Successful Get case empty result",
+			nprName:   "npr-2",
+			expectErr: nil,
+			expectResult: &intelligence.NetworkPolicyRecommendation{
+				Type:       "NPR",
+				PolicyType: "Allow",
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State:             crdv1alpha1.NPRecommendationStateCompleted,
+					EmptyResultReason: "No flow record was found in the time range of the job",
+				},
+			},
+		},
+		{
+			name:      "Unsuccessful Get case empty result data window error",
+			nprName:   "npr-2",
+			expectErr: nil,
+			expectResult: &intelligence.NetworkPolicyRecommendation{
+				Type:       "NPR",
+				PolicyType: "Allow",
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State:    crdv1alpha1.NPRecommendationStateCompleted,
+					ErrorMsg: "Failed to get the data window for completed NetworkPolicy Recommendation with id , error: failed to get recommendation data window with id : error in database, please retry",
+				},
+			},
+		},
 		{
 			name:      "Unsuccessful Get case query error",
 			nprName:   "npr-2",
@@ -87,7 +181,7 @@ func TestREST_Get(t *testing.T) {
 				PolicyType: "Allow",
 				Status: intelligence.NetworkPolicyRecommendationStatus{
 					State:    crdv1alpha1.NPRecommendationStateCompleted,
-					ErrorMsg: "Failed to get the result for completed NetworkPolicy Recommendation with id , error: failed to scan recommendation results: sql: expected 2 destination arguments in Scan, not 1",
+					ErrorMsg: "Failed to get the result for completed NetworkPolicy Recommendation with id , error: failed to scan recommendation results: sql: expected 2 destination arguments in Scan, not 3",
 				},
 			},
 		},
@@ -99,20 +193,38 @@ func TestREST_Get(t *testing.T) {
 				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 			}
 			defer db.Close()
-			resultRows := sqlmock.NewRows([]string{"policy"}).AddRow(policy1).AddRow(policy2)
+			firstPageQuery := "SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy LIMIT (?);"
+			nextPageQuery := "SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) AND (kind, hash) >= ((?), (?)) ORDER BY kind, hash, policy LIMIT (?);"
+			resultRows := sqlmock.NewRows([]string{"kind", "hash", "policy"}).AddRow("acnp", 11, policy1).AddRow("anp", 22, policy2)
 			if tt.name == "Unsuccessful Get case query error" {
-				mock.ExpectQuery("SELECT policy FROM recommendations WHERE id = (?);").WillReturnError(fmt.Errorf("error in database, please retry"))
+				mock.ExpectQuery(firstPageQuery).WillReturnError(fmt.Errorf("error in database, please retry"))
 			} else if tt.name == "Unsuccessful Get case rows error" {
-				mock.ExpectQuery("SELECT policy FROM recommendations WHERE id = (?);").WillReturnRows(sqlmock.NewRows([]string{"policy", "Id"}).AddRow("mock_policy", "mock_Id"))
+				mock.ExpectQuery(firstPageQuery).WillReturnRows(sqlmock.NewRows([]string{"policy", "Id"}).AddRow("mock_policy", "mock_Id"))
+			} else if tt.name == "Successful Get case empty result" || tt.name == "Unsuccessful Get case empty result data window error" {
+				mock.ExpectQuery(firstPageQuery).WithArgs("", maxRecommendationPageSize+1).WillReturnRows(sqlmock.NewRows([]string{"kind", "hash", "policy"}))
+				dataWindowQuery := mock.ExpectQuery("SELECT minFlowTime, maxFlowTime, flows, nodes, emptyResultReason FROM recommendation_data_window WHERE id = (?);").WithArgs("")
+				if tt.name == "Successful Get case empty result" {
+					dataWindowQuery.WillReturnRows(sqlmock.NewRows([]string{"minFlowTime", "maxFlowTime", "flows", "nodes", "emptyResultReason"}).AddRow(time.Unix(0, 0), time.Unix(0, 0), 0, "", "No flow record was found in the time range of the job"))
+				} else {
+					dataWindowQuery.WillReturnError(fmt.Errorf("error in database, please retry"))
+				}
+			} else if tt.name == "Successful Get case first page" {
+				mock.ExpectQuery(firstPageQuery).WithArgs("", 2).WillReturnRows(resultRows)
+			} else if tt.name == "Successful Get case last page" {
+				mock.ExpectQuery(nextPageQuery).WithArgs("", "acnp", 11, 3).WillReturnRows(sqlmock.NewRows([]string{"kind", "hash", "policy"}).AddRow("acnp", 11, policy1).AddRow("anp", 22, policy2))
 			} else {
-				mock.ExpectQuery("SELECT policy FROM recommendations WHERE id = (?);").WillReturnRows(resultRows)
+				mock.ExpectQuery(firstPageQuery).WithArgs("", maxRecommendationPageSize+1).WillReturnRows(resultRows)
 			}
 
 			setupClickHouseConnection = func(client kubernetes.Interface) (connect *sql.DB, err error) {
 				return db, nil
 			}
 			r := NewREST(&fakeQuerier{})
-			npr, err := r.Get(context.TODO(), tt.nprName, &v1.GetOptions{})
+			options := tt.options
+			if options == nil {
+				options = &intelligence.NetworkPolicyRecommendationGetOptions{}
+			}
+			npr, err := r.Get(context.TODO(), tt.nprName, options)
 			assert.Equal(t, err, tt.expectErr)
 			if npr != nil {
 				assert.Equal(t, tt.expectResult, npr.(*intelligence.NetworkPolicyRecommendation))
@@ -123,6 +235,185 @@ func TestREST_Get(t *testing.T) {
 	}
 }
 
+func TestREST_GetCopiedResult(t *testing.T) {
+	store := resultstore.NewConfigMapStore(fake.NewSimpleClientset(), "flow-visibility")
+	require.NoError(t, store.Save(context.TODO(), "copied", []resultstore.Policy{
+		{Kind: "anp", Hash: 22, Policy: "policy2"},
+		{Kind: "acnp", Hash: 11, Policy: "policy1"},
+	}))
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	setupClickHouseConnection = func(client kubernetes.Interface) (connect *sql.DB, err error) {
+		return db, nil
+	}
+	r := NewREST(&fakeQuerier{resultStore: store})
+
+	// The result is read from the store, one page after the other.
+	result, next, err := r.getRecommendationResultPage("copied", 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "policy1", result)
+	cursor, err := decodeResultCursor(next)
+	require.NoError(t, err)
+	result, next, err = r.getRecommendationResultPage("copied", 1, cursor)
+	require.NoError(t, err)
+	assert.Equal(t, "policy2", result)
+	assert.Empty(t, next)
+
+	// The result of a job which was not copied is read from ClickHouse.
+	mock.ExpectQuery("SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy LIMIT (?);").WithArgs("not-copied", 2).WillReturnRows(
+		sqlmock.NewRows([]string{"kind", "hash", "policy"}).AddRow("knp", 33, "policy3"))
+	result, next, err = r.getRecommendationResultPage("not-copied", 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "policy3", result)
+	assert.Empty(t, next)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestREST_GetDuplicatePolicies(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	setupClickHouseConnection = func(client kubernetes.Interface) (connect *sql.DB, err error) {
+		return db, nil
+	}
+	r := NewREST(&fakeQuerier{})
+
+	// A retried job inserted policy2 twice, and policy3 collides with the
+	// hash of policy2. The page boundaries fall between the policies with
+	// the same kind and hash, which are neither skipped nor repeated.
+	firstPageQuery := "SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy LIMIT (?);"
+	nextPageQuery := "SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) AND (kind, hash) >= ((?), (?)) ORDER BY kind, hash, policy LIMIT (?);"
+	columns := []string{"kind", "hash", "policy"}
+	mock.ExpectQuery(firstPageQuery).WithArgs("duplicates", 3).WillReturnRows(
+		sqlmock.NewRows(columns).AddRow("acnp", 11, "policy1").AddRow("acnp", 22, "policy2").AddRow("acnp", 22, "policy2"))
+	mock.ExpectQuery(nextPageQuery).WithArgs("duplicates", "acnp", 22, 4).WillReturnRows(
+		sqlmock.NewRows(columns).AddRow("acnp", 22, "policy2").AddRow("acnp", 22, "policy2").AddRow("acnp", 22, "policy3"))
+
+	var results []string
+	var cursor *resultCursor
+	for {
+		result, next, err := r.getRecommendationResultPage("duplicates", 2, cursor)
+		require.NoError(t, err)
+		results = append(results, result)
+		if next == "" {
+			break
+		}
+		cursor, err = decodeResultCursor(next)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"policy1---\npolicy2", "policy2---\npolicy3"}, results)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestREST_GetOverloaded(t *testing.T) {
+	r := NewREST(&fakeQuerier{})
+	r.queryLimiter = querylimit.NewLimiter(1, 2)
+	release, err := r.queryLimiter.TryAcquire("tests")
+	require.NoError(t, err)
+	defer release()
+	_, err = r.Get(context.TODO(), "npr-2", &intelligence.NetworkPolicyRecommendationGetOptions{})
+	assert.True(t, errors.IsTooManyRequests(err))
+	retryAfter, ok := errors.SuggestsClientDelay(err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, retryAfter)
+}
+
+func TestREST_GetReport(t *testing.T) {
+	query := "SELECT namespace, matchedFlows, unmatchedFlows FROM recommendation_coverage WHERE id = (?) ORDER BY namespace;"
+	dataWindowQuery := "SELECT minFlowTime, maxFlowTime, flows, nodes, emptyResultReason FROM recommendation_data_window WHERE id = (?);"
+	dataWindowColumns := []string{"minFlowTime", "maxFlowTime", "flows", "nodes", "emptyResultReason"}
+	minFlowTime := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	maxFlowTime := time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		expectQuery  func(mock sqlmock.Sqlmock)
+		expectStatus intelligence.NetworkPolicyRecommendationStatus
+	}{
+		{
+			name: "Successful report",
+			expectQuery: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("").WillReturnRows(sqlmock.NewRows([]string{"namespace", "matchedFlows", "unmatchedFlows"}).AddRow("default", 90, 10).AddRow("kube-system", 20, 0))
+				mock.ExpectQuery(dataWindowQuery).WithArgs("").WillReturnRows(sqlmock.NewRows(dataWindowColumns).AddRow(minFlowTime, maxFlowTime, 120, "node-1,node-2", ""))
+			},
+			expectStatus: intelligence.NetworkPolicyRecommendationStatus{
+				State: crdv1alpha1.NPRecommendationStateCompleted,
+				Coverage: []intelligence.NetworkPolicyRecommendationCoverage{
+					{Namespace: "default", MatchedFlows: 90, UnmatchedFlows: 10},
+					{Namespace: "kube-system", MatchedFlows: 20},
+				},
+				DataWindow: &intelligence.NetworkPolicyRecommendationDataWindow{
+					MinFlowTime: v1.NewTime(minFlowTime),
+					MaxFlowTime: v1.NewTime(maxFlowTime),
+					Flows:       120,
+					Nodes:       []string{"node-1", "node-2"},
+				},
+			},
+		},
+		{
+			name: "No flow record",
+			expectQuery: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("").WillReturnRows(sqlmock.NewRows([]string{"namespace", "matchedFlows", "unmatchedFlows"}))
+				mock.ExpectQuery(dataWindowQuery).WithArgs("").WillReturnRows(sqlmock.NewRows(dataWindowColumns).AddRow(time.Unix(0, 0), time.Unix(0, 0), 0, "", "No flow record was found in the time range of the job"))
+			},
+			expectStatus: intelligence.NetworkPolicyRecommendationStatus{
+				State: crdv1alpha1.NPRecommendationStateCompleted,
+				DataWindow: &intelligence.NetworkPolicyRecommendationDataWindow{
+					Caveats:           []string{"No flow record was found in the time range of the job, no traffic is allowed by the recommended policies"},
+					EmptyResultReason: "No flow record was found in the time range of the job",
+				},
+			},
+		},
+		{
+			name: "Data window query error",
+			expectQuery: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("").WillReturnRows(sqlmock.NewRows([]string{"namespace", "matchedFlows", "unmatchedFlows"}))
+				mock.ExpectQuery(dataWindowQuery).WithArgs("").WillReturnError(fmt.Errorf("error in database, please retry"))
+			},
+			expectStatus: intelligence.NetworkPolicyRecommendationStatus{
+				State:    crdv1alpha1.NPRecommendationStateCompleted,
+				ErrorMsg: "Failed to get the data window for completed NetworkPolicy Recommendation with id , error: failed to get recommendation data window with id : error in database, please retry",
+			},
+		},
+		{
+			name: "No coverage",
+			expectQuery: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("").WillReturnRows(sqlmock.NewRows([]string{"namespace", "matchedFlows", "unmatchedFlows"}))
+				mock.ExpectQuery(dataWindowQuery).WithArgs("").WillReturnRows(sqlmock.NewRows(dataWindowColumns))
+			},
+			expectStatus: intelligence.NetworkPolicyRecommendationStatus{
+				State: crdv1alpha1.NPRecommendationStateCompleted,
+			},
+		},
+		{
+			name: "Query error",
+			expectQuery: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("").WillReturnError(fmt.Errorf("error in database, please retry"))
+			},
+			expectStatus: intelligence.NetworkPolicyRecommendationStatus{
+				State:    crdv1alpha1.NPRecommendationStateCompleted,
+				ErrorMsg: "Failed to get the coverage for completed NetworkPolicy Recommendation with id , error: failed to get recommendation coverage with id : error in database, please retry",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+			tt.expectQuery(mock)
+			setupClickHouseConnection = func(client kubernetes.Interface) (connect *sql.DB, err error) {
+				return db, nil
+			}
+			r := NewREST(&fakeQuerier{})
+			npr, err := r.Get(context.TODO(), "npr-2", &intelligence.NetworkPolicyRecommendationGetOptions{Report: true})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectStatus, npr.(*intelligence.NetworkPolicyRecommendation).Status)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
 func TestREST_Delete(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -155,6 +446,10 @@ func TestREST_Create(t *testing.T) {
 		obj          runtime.Object
 		expectErr    error
 		expectResult runtime.Object
+		expectLabels map[string]string
+		// expectCorrelationID is the correlation ID of the created job, any
+		// ID is expected if it is "generated".
+		expectCorrelationID string
 	}{
 		{
 			name:         "Wrong object case",
@@ -176,17 +471,80 @@ func TestREST_Create(t *testing.T) {
 			obj: &intelligence.NetworkPolicyRecommendation{
 				TypeMeta:   v1.TypeMeta{},
 				ObjectMeta: v1.ObjectMeta{Name: "non-existent-npr"},
+				Tags:       map[string]string{"team": "netsec"},
+			},
+			expectErr:           nil,
+			expectResult:        &v1.Status{Status: v1.StatusSuccess},
+			expectLabels:        map[string]string{"theia.antrea.io/job-type": "policy-reco", "team": "netsec"},
+			expectCorrelationID: "generated",
+		},
+		{
+			name: "Successful Create case with correlation ID",
+			obj: &intelligence.NetworkPolicyRecommendation{
+				TypeMeta:   v1.TypeMeta{},
+				ObjectMeta: v1.ObjectMeta{Name: "non-existent-npr", Annotations: map[string]string{util.CorrelationIDAnnotation: "5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c"}},
 			},
-			expectErr:    nil,
-			expectResult: &v1.Status{Status: v1.StatusSuccess},
+			expectErr:           nil,
+			expectResult:        &v1.Status{Status: v1.StatusSuccess},
+			expectCorrelationID: "5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c",
+		},
+		{
+			name: "Invalid correlation ID case",
+			obj: &intelligence.NetworkPolicyRecommendation{
+				TypeMeta:   v1.TypeMeta{},
+				ObjectMeta: v1.ObjectMeta{Name: "non-existent-npr", Annotations: map[string]string{util.CorrelationIDAnnotation: "1234"}},
+			},
+			expectErr:    errors.NewBadRequest("correlation ID 1234 is not a valid UUID: invalid UUID length: 4"),
+			expectResult: nil,
+		},
+		{
+			name: "Invalid tags case",
+			obj: &intelligence.NetworkPolicyRecommendation{
+				TypeMeta:   v1.TypeMeta{},
+				ObjectMeta: v1.ObjectMeta{Name: "non-existent-npr"},
+				Tags:       map[string]string{"theia.antrea.io/job-id": "1234"},
+			},
+			expectErr:    errors.NewBadRequest("invalid tags: tag key theia.antrea.io/job-id is reserved, it should not start with theia.antrea.io/"),
+			expectResult: nil,
+		},
+		{
+			name: "Invalid canary case",
+			obj: &intelligence.NetworkPolicyRecommendation{
+				TypeMeta:   v1.TypeMeta{},
+				ObjectMeta: v1.ObjectMeta{Name: "non-existent-npr"},
+				PolicyType: "k8s-np",
+				Canary:     &intelligence.NetworkPolicyRecommendationCanary{Namespace: "default", SoakWindow: v1.Duration{Duration: time.Hour}},
+			},
+			expectErr:    errors.NewBadRequest("canary rollout requires policy type anp-deny-applied or anp-deny-all"),
+			expectResult: nil,
+		},
+		{
+			name: "Invalid workload case",
+			obj: &intelligence.NetworkPolicyRecommendation{
+				TypeMeta:   v1.TypeMeta{},
+				ObjectMeta: v1.ObjectMeta{Name: "non-existent-npr"},
+				PolicyType: "anp-deny-all",
+				Workload:   &intelligence.NetworkPolicyRecommendationWorkload{Namespace: "default", PodLabels: map[string]string{"app": "foo"}},
+			},
+			expectErr:    errors.NewBadRequest("workload recommendation requires policy type anp-deny-applied or k8s-np"),
+			expectResult: nil,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := NewREST(&fakeQuerier{})
+			querier := &fakeQuerier{}
+			r := NewREST(querier)
 			result, err := r.Create(context.TODO(), tt.obj, nil, &v1.CreateOptions{})
 			assert.Equal(t, err, tt.expectErr)
 			assert.Equal(t, tt.expectResult, result)
+			if tt.expectLabels != nil {
+				assert.Equal(t, tt.expectLabels, querier.created.Labels)
+			}
+			if tt.expectCorrelationID == "generated" {
+				assert.Len(t, querier.created.Annotations[util.CorrelationIDAnnotation], 36)
+			} else if tt.expectCorrelationID != "" {
+				assert.Equal(t, tt.expectCorrelationID, querier.created.Annotations[util.CorrelationIDAnnotation])
+			}
 		})
 	}
 }
@@ -194,6 +552,7 @@ func TestREST_Create(t *testing.T) {
 func TestREST_List(t *testing.T) {
 	tests := []struct {
 		name         string
+		selector     labels.Selector
 		expectResult []intelligence.NetworkPolicyRecommendation
 	}{
 		{
@@ -203,11 +562,18 @@ func TestREST_List(t *testing.T) {
 				{ObjectMeta: v1.ObjectMeta{Name: "npr-2"}},
 			},
 		},
+		{
+			name:     "List by label case",
+			selector: labels.SelectorFromSet(labels.Set{"team": "netsec"}),
+			expectResult: []intelligence.NetworkPolicyRecommendation{
+				{ObjectMeta: v1.ObjectMeta{Name: "npr-2"}},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := NewREST(&fakeQuerier{})
-			itemList, err := r.List(context.TODO(), &internalversion.ListOptions{})
+			itemList, err := r.List(context.TODO(), &internalversion.ListOptions{LabelSelector: tt.selector})
 			assert.NoError(t, err)
 			nprList, ok := itemList.(*intelligence.NetworkPolicyRecommendationList)
 			assert.True(t, ok)
@@ -231,6 +597,7 @@ func (c *fakeQuerier) GetNetworkPolicyRecommendation(namespace, name string) (*c
 }
 
 func (c *fakeQuerier) CreateNetworkPolicyRecommendation(namespace string, networkPolicyRecommendation *crdv1alpha1.NetworkPolicyRecommendation) (*crdv1alpha1.NetworkPolicyRecommendation, error) {
+	c.created = networkPolicyRecommendation
 	return nil, nil
 }
 
@@ -238,9 +605,19 @@ func (c *fakeQuerier) DeleteNetworkPolicyRecommendation(namespace, name string)
 	return nil
 }
 
-func (c *fakeQuerier) ListNetworkPolicyRecommendation(namespace string) ([]*crdv1alpha1.NetworkPolicyRecommendation, error) {
-	return []*crdv1alpha1.NetworkPolicyRecommendation{
+func (c *fakeQuerier) GetRecommendationResultStore() resultstore.Store {
+	return c.resultStore
+}
+
+func (c *fakeQuerier) ListNetworkPolicyRecommendation(namespace string, selector labels.Selector) ([]*crdv1alpha1.NetworkPolicyRecommendation, error) {
+	var list []*crdv1alpha1.NetworkPolicyRecommendation
+	for _, npr := range []*crdv1alpha1.NetworkPolicyRecommendation{
 		{ObjectMeta: v1.ObjectMeta{Name: "npr-1"}},
-		{ObjectMeta: v1.ObjectMeta{Name: "npr-2"}},
-	}, nil
+		{ObjectMeta: v1.ObjectMeta{Name: "npr-2", Labels: map[string]string{"team": "netsec"}}},
+	} {
+		if selector.Matches(labels.Set(npr.Labels)) {
+			list = append(list, npr)
+		}
+	}
+	return list, nil
 }
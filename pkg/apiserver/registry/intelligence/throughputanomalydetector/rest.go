@@ -24,16 +24,20 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
 
 	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 	"antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/apiserver/utils/querylimit"
 	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util"
 	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/util/tracing"
 )
 
 const (
-	defaultNameSpace     = "flow-visibility"
-	tadQuery         int = iota
+	tadQuery int = iota
 	aggTadExternalQuery
 	aggTadPodLabelQuery
 	aggTadPodNameQuery
@@ -44,6 +48,7 @@ const (
 type REST struct {
 	ThroughputAnomalyDetectorQuerier querier.ThroughputAnomalyDetectorQuerier
 	clickhouseConnect                *sql.DB
+	queryLimiter                     *querylimit.Limiter
 }
 
 var (
@@ -67,6 +72,7 @@ var queryMap = map[int]string{
 		flowStartSeconds,
 		flowEndSeconds,
 		throughput,
+		throughputStandardDeviation,
 		aggType,
 		algoType,
 		algoCalc,
@@ -78,6 +84,7 @@ var queryMap = map[int]string{
 		destinationIP,
 		flowEndSeconds,
 		throughput,
+		throughputStandardDeviation,
 		aggType,
 		algoType,
 		algoCalc,
@@ -91,6 +98,7 @@ var queryMap = map[int]string{
 		direction,
 		flowEndSeconds,
 		throughput,
+		throughputStandardDeviation,
 		aggType,
 		algoType,
 		algoCalc,
@@ -104,6 +112,7 @@ var queryMap = map[int]string{
 		direction,
 		flowEndSeconds,
 		throughput,
+		throughputStandardDeviation,
 		aggType,
 		algoType,
 		algoCalc,
@@ -115,6 +124,7 @@ var queryMap = map[int]string{
 		destinationServicePortName,
 		flowEndSeconds,
 		throughput,
+		throughputStandardDeviation,
 		aggType,
 		algoType,
 		algoCalc,
@@ -124,7 +134,7 @@ var queryMap = map[int]string{
 
 // NewREST returns a REST object that will work against API services.
 func NewREST(tadq querier.ThroughputAnomalyDetectorQuerier) *REST {
-	return &REST{ThroughputAnomalyDetectorQuerier: tadq}
+	return &REST{ThroughputAnomalyDetectorQuerier: tadq, queryLimiter: querylimit.ResultQueries}
 }
 
 func (r *REST) New() runtime.Object {
@@ -132,7 +142,7 @@ func (r *REST) New() runtime.Object {
 }
 
 func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
-	tad, err := r.ThroughputAnomalyDetectorQuerier.GetThroughputAnomalyDetector(defaultNameSpace, name)
+	tad, err := r.ThroughputAnomalyDetectorQuerier.GetThroughputAnomalyDetector(env.GetTheiaNamespace(), name)
 	if err != nil {
 		return nil, errors.NewNotFound(v1alpha1.Resource("throughputanomalydetectors"), name)
 	}
@@ -140,7 +150,12 @@ func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions)
 	r.copyThroughputAnomalyDetector(newTAD, tad)
 	// Try to retrieve result from ClickHouse in case TAD is completed
 	if tad.Status.State == crdv1alpha1.ThroughputAnomalyDetectorStateCompleted {
-		err := r.getTADetectorResult(tad.Status.SparkApplication, newTAD)
+		release, err := r.queryLimiter.TryAcquire("throughputanomalydetectors")
+		if err != nil {
+			return nil, err
+		}
+		err = r.getTADetectorResult(tad.Status.SparkApplication, newTAD)
+		release()
 		if err != nil {
 			newTAD.Status.ErrorMsg = fmt.Sprintf("Failed to get the result for completed Throughput Anomaly Detector with id %s, error: %v", tad.Status.SparkApplication, err)
 		}
@@ -154,6 +169,9 @@ func (r *REST) Destroy() {
 // copyThroughputAnomalyDetector is used to copy ThroughputAnomalyDetector from crd to anomalydetector
 func (r *REST) copyThroughputAnomalyDetector(tad *v1alpha1.ThroughputAnomalyDetector, crd *crdv1alpha1.ThroughputAnomalyDetector) error {
 	tad.Name = crd.Name
+	if correlationID, ok := crd.Annotations[util.CorrelationIDAnnotation]; ok {
+		tad.Annotations = map[string]string{util.CorrelationIDAnnotation: correlationID}
+	}
 	tad.Type = crd.Spec.JobType
 	tad.StartInterval = crd.Spec.StartInterval
 	tad.EndInterval = crd.Spec.EndInterval
@@ -169,6 +187,7 @@ func (r *REST) copyThroughputAnomalyDetector(tad *v1alpha1.ThroughputAnomalyDete
 	tad.DriverMemory = crd.Spec.DriverMemory
 	tad.ExecutorCoreRequest = crd.Spec.ExecutorCoreRequest
 	tad.ExecutorMemory = crd.Spec.ExecutorMemory
+	tad.AutoSizeExecutors = crd.Spec.AutoSizeExecutors
 	tad.Status.State = crd.Status.State
 	tad.Status.SparkApplication = crd.Status.SparkApplication
 	tad.Status.CompletedStages = crd.Status.CompletedStages
@@ -184,10 +203,15 @@ func (r *REST) NewList() runtime.Object {
 }
 
 func (r *REST) List(ctx context.Context, options *internalversion.ListOptions) (runtime.Object, error) {
-	tadList, err := r.ThroughputAnomalyDetectorQuerier.ListThroughputAnomalyDetector(defaultNameSpace)
+	tadList, err := r.ThroughputAnomalyDetectorQuerier.ListThroughputAnomalyDetector(env.GetTheiaNamespace())
 	if err != nil {
 		return nil, errors.NewBadRequest(fmt.Sprintf("error when getting ThroughputAnomalyDetectorsList: %v", err))
 	}
+	release, err := r.queryLimiter.TryAcquire("throughputanomalydetectors")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	items := make([]v1alpha1.ThroughputAnomalyDetector, 0, len(tadList))
 	for _, tad := range tadList {
 		newTAD := new(v1alpha1.ThroughputAnomalyDetector)
@@ -218,12 +242,17 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	if !ok {
 		return nil, errors.NewBadRequest(fmt.Sprintf("not a ThroughputAnomalyDetector object: %T", obj))
 	}
-	existTAD, _ := r.ThroughputAnomalyDetectorQuerier.GetThroughputAnomalyDetector(defaultNameSpace, newTAD.Name)
+	existTAD, _ := r.ThroughputAnomalyDetectorQuerier.GetThroughputAnomalyDetector(env.GetTheiaNamespace(), newTAD.Name)
 	if existTAD != nil {
 		return nil, errors.NewBadRequest(fmt.Sprintf("ThroughputAnomalyDetection job exists, name: %s", newTAD.Name))
 	}
+	correlationID, err := util.GetRequestCorrelationID(newTAD.Annotations)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
 	job := new(crdv1alpha1.ThroughputAnomalyDetector)
 	job.Name = newTAD.Name
+	job.Annotations = map[string]string{util.CorrelationIDAnnotation: correlationID}
 	job.Spec.JobType = newTAD.Type
 	job.Spec.StartInterval = newTAD.StartInterval
 	job.Spec.EndInterval = newTAD.EndInterval
@@ -233,16 +262,18 @@ func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation
 	job.Spec.DriverMemory = newTAD.DriverMemory
 	job.Spec.ExecutorCoreRequest = newTAD.ExecutorCoreRequest
 	job.Spec.ExecutorMemory = newTAD.ExecutorMemory
+	job.Spec.AutoSizeExecutors = newTAD.AutoSizeExecutors
 	job.Spec.AggregatedFlow = newTAD.AggregatedFlow
 	job.Spec.PodLabel = newTAD.PodLabel
 	job.Spec.PodName = newTAD.PodName
 	job.Spec.PodNameSpace = newTAD.PodNameSpace
 	job.Spec.ExternalIP = newTAD.ExternalIP
 	job.Spec.ServicePortName = newTAD.ServicePortName
-	_, err := r.ThroughputAnomalyDetectorQuerier.CreateThroughputAnomalyDetector(defaultNameSpace, job)
+	_, err = r.ThroughputAnomalyDetectorQuerier.CreateThroughputAnomalyDetector(env.GetTheiaNamespace(), job)
 	if err != nil {
 		return nil, errors.NewBadRequest(fmt.Sprintf("error when creating ThroughputAnomalyDetection job: %+v, err: %v", job, err))
 	}
+	klog.InfoS("Created ThroughputAnomalyDetector", "name", job.Name, "correlationID", correlationID)
 	return &metav1.Status{Status: metav1.StatusSuccess}, nil
 }
 
@@ -267,7 +298,9 @@ func (r *REST) getTADetectorResult(id string, tad *v1alpha1.ThroughputAnomalyDet
 			return err
 		}
 	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", queryMap[query])
 	rows, err := r.clickhouseConnect.Query(queryMap[query], id)
+	tracing.EndSpan(span, err)
 	if err != nil {
 		return fmt.Errorf("failed to get Throughput Anomaly Detector results with id %s: %v", id, err)
 	}
@@ -276,35 +309,35 @@ func (r *REST) getTADetectorResult(id string, tad *v1alpha1.ThroughputAnomalyDet
 		switch query {
 		case tadQuery:
 			res := v1alpha1.ThroughputAnomalyDetectorStats{}
-			err := rows.Scan(&res.Id, &res.SourceIP, &res.SourceTransportPort, &res.DestinationIP, &res.DestinationTransportPort, &res.FlowStartSeconds, &res.FlowEndSeconds, &res.Throughput, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
+			err := rows.Scan(&res.Id, &res.SourceIP, &res.SourceTransportPort, &res.DestinationIP, &res.DestinationTransportPort, &res.FlowStartSeconds, &res.FlowEndSeconds, &res.Throughput, &res.ThroughputStandardDeviation, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
 			if err != nil {
 				return fmt.Errorf("failed to scan Throughput Anomaly Detector results: %v", err)
 			}
 			tad.Stats = append(tad.Stats, res)
 		case aggTadExternalQuery:
 			res := v1alpha1.ThroughputAnomalyDetectorStats{}
-			err := rows.Scan(&res.Id, &res.DestinationIP, &res.FlowEndSeconds, &res.Throughput, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
+			err := rows.Scan(&res.Id, &res.DestinationIP, &res.FlowEndSeconds, &res.Throughput, &res.ThroughputStandardDeviation, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
 			if err != nil {
 				return fmt.Errorf("failed to scan Throughput Anomaly Detector External IP Aggregate results: %v", err)
 			}
 			tad.Stats = append(tad.Stats, res)
 		case aggTadPodLabelQuery:
 			res := v1alpha1.ThroughputAnomalyDetectorStats{}
-			err := rows.Scan(&res.Id, &res.PodNamespace, &res.PodLabels, &res.Direction, &res.FlowEndSeconds, &res.Throughput, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
+			err := rows.Scan(&res.Id, &res.PodNamespace, &res.PodLabels, &res.Direction, &res.FlowEndSeconds, &res.Throughput, &res.ThroughputStandardDeviation, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
 			if err != nil {
 				return fmt.Errorf("failed to scan Throughput Anomaly Detector Pod Aggregate results: %v", err)
 			}
 			tad.Stats = append(tad.Stats, res)
 		case aggTadPodNameQuery:
 			res := v1alpha1.ThroughputAnomalyDetectorStats{}
-			err := rows.Scan(&res.Id, &res.PodNamespace, &res.PodName, &res.Direction, &res.FlowEndSeconds, &res.Throughput, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
+			err := rows.Scan(&res.Id, &res.PodNamespace, &res.PodName, &res.Direction, &res.FlowEndSeconds, &res.Throughput, &res.ThroughputStandardDeviation, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
 			if err != nil {
 				return fmt.Errorf("failed to scan Throughput Anomaly Detector Pod Aggregate results: %v", err)
 			}
 			tad.Stats = append(tad.Stats, res)
 		case aggTadSvcQuery:
 			res := v1alpha1.ThroughputAnomalyDetectorStats{}
-			err := rows.Scan(&res.Id, &res.DestinationServicePortName, &res.FlowEndSeconds, &res.Throughput, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
+			err := rows.Scan(&res.Id, &res.DestinationServicePortName, &res.FlowEndSeconds, &res.Throughput, &res.ThroughputStandardDeviation, &res.AggType, &res.AlgoType, &res.AlgoCalc, &res.Anomaly)
 			if err != nil {
 				return fmt.Errorf("failed to scan Throughput Anomaly Detector Service Aggregate results: %v", err)
 			}
@@ -315,11 +348,11 @@ func (r *REST) getTADetectorResult(id string, tad *v1alpha1.ThroughputAnomalyDet
 }
 
 func (r *REST) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
-	_, err := r.ThroughputAnomalyDetectorQuerier.GetThroughputAnomalyDetector(defaultNameSpace, name)
+	_, err := r.ThroughputAnomalyDetectorQuerier.GetThroughputAnomalyDetector(env.GetTheiaNamespace(), name)
 	if err != nil {
 		return nil, false, errors.NewBadRequest(fmt.Sprintf("ThroughputAnomalyDetector job doesn't exist, name: %s", name))
 	}
-	err = r.ThroughputAnomalyDetectorQuerier.DeleteThroughputAnomalyDetector(defaultNameSpace, name)
+	err = r.ThroughputAnomalyDetectorQuerier.DeleteThroughputAnomalyDetector(env.GetTheiaNamespace(), name)
 	if err != nil {
 		return nil, false, err
 	}
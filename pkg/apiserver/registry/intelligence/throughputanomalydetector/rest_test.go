@@ -23,6 +23,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,6 +32,8 @@ import (
 
 	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 	"antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/apiserver/utils/querylimit"
+	"antrea.io/theia/pkg/util"
 )
 
 type fakeQuerier struct{}
@@ -59,18 +62,19 @@ func TestREST_Get(t *testing.T) {
 					State: crdv1alpha1.ThroughputAnomalyDetectorStateCompleted,
 				},
 				Stats: []v1alpha1.ThroughputAnomalyDetectorStats{{
-					Id:                       "mock_Id",
-					SourceIP:                 "mock_SourceIP",
-					SourceTransportPort:      "mock_SourceTransportPort",
-					DestinationIP:            "mock_DestinationIP",
-					DestinationTransportPort: "mock_DestinationTransportPort",
-					FlowStartSeconds:         "mock_FlowStartSeconds",
-					FlowEndSeconds:           "mock_FlowEndSeconds",
-					Throughput:               "mock_Throughput",
-					AggType:                  "mock_AggType",
-					AlgoType:                 "mock_AlgoType",
-					AlgoCalc:                 "mock_AlgoCalc",
-					Anomaly:                  "mock_Anomaly",
+					Id:                          "mock_Id",
+					SourceIP:                    "mock_SourceIP",
+					SourceTransportPort:         "mock_SourceTransportPort",
+					DestinationIP:               "mock_DestinationIP",
+					DestinationTransportPort:    "mock_DestinationTransportPort",
+					FlowStartSeconds:            "mock_FlowStartSeconds",
+					FlowEndSeconds:              "mock_FlowEndSeconds",
+					Throughput:                  "mock_Throughput",
+					ThroughputStandardDeviation: "mock_ThroughputStandardDeviation",
+					AggType:                     "mock_AggType",
+					AlgoType:                    "mock_AlgoType",
+					AlgoCalc:                    "mock_AlgoCalc",
+					Anomaly:                     "mock_Anomaly",
 				}},
 			},
 		},
@@ -94,7 +98,7 @@ func TestREST_Get(t *testing.T) {
 				Type: "TAD",
 				Status: v1alpha1.ThroughputAnomalyDetectorStatus{
 					State:    crdv1alpha1.ThroughputAnomalyDetectorStateCompleted,
-					ErrorMsg: "Failed to get the result for completed Throughput Anomaly Detector with id , error: failed to scan Throughput Anomaly Detector results: sql: expected 1 destination arguments in Scan, not 12",
+					ErrorMsg: "Failed to get the result for completed Throughput Anomaly Detector with id , error: failed to scan Throughput Anomaly Detector results: sql: expected 1 destination arguments in Scan, not 13",
 				},
 			},
 		},
@@ -107,8 +111,8 @@ func TestREST_Get(t *testing.T) {
 			}
 			defer db.Close()
 			resultRows := sqlmock.NewRows([]string{
-				"Id", "SourceIP", "SourceTransportPort", "DestinationIP", "DestinationTransportPort", "FlowStartSeconds", "FlowEndSeconds", "Throughput", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
-				AddRow("mock_Id", "mock_SourceIP", "mock_SourceTransportPort", "mock_DestinationIP", "mock_DestinationTransportPort", "mock_FlowStartSeconds", "mock_FlowEndSeconds", "mock_Throughput", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly")
+				"Id", "SourceIP", "SourceTransportPort", "DestinationIP", "DestinationTransportPort", "FlowStartSeconds", "FlowEndSeconds", "Throughput", "ThroughputStandardDeviation", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
+				AddRow("mock_Id", "mock_SourceIP", "mock_SourceTransportPort", "mock_DestinationIP", "mock_DestinationTransportPort", "mock_FlowStartSeconds", "mock_FlowEndSeconds", "mock_Throughput", "mock_ThroughputStandardDeviation", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly")
 			if tt.name == "Unsuccessful Get case query error" {
 				mock.ExpectQuery(queryMap[tadQuery]).WillReturnError(fmt.Errorf("error in database, please retry"))
 			} else if tt.name == "Unsuccessful Get case rows error" {
@@ -132,6 +136,19 @@ func TestREST_Get(t *testing.T) {
 	}
 }
 
+func TestREST_GetOverloaded(t *testing.T) {
+	r := NewREST(&fakeQuerier{})
+	r.queryLimiter = querylimit.NewLimiter(1, 2)
+	release, err := r.queryLimiter.TryAcquire("tests")
+	require.NoError(t, err)
+	defer release()
+	_, err = r.Get(context.TODO(), "tad-2", &v1.GetOptions{})
+	assert.True(t, errors.IsTooManyRequests(err))
+	retryAfter, ok := errors.SuggestsClientDelay(err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, retryAfter)
+}
+
 func TestREST_Delete(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -190,6 +207,15 @@ func TestREST_Create(t *testing.T) {
 			expectErr:    nil,
 			expectResult: &v1.Status{Status: v1.StatusSuccess},
 		},
+		{
+			name: "Invalid correlation ID case",
+			obj: &v1alpha1.ThroughputAnomalyDetector{
+				TypeMeta:   v1.TypeMeta{},
+				ObjectMeta: v1.ObjectMeta{Name: "non-existent-tad", Annotations: map[string]string{util.CorrelationIDAnnotation: "1234"}},
+			},
+			expectErr:    errors.NewBadRequest("correlation ID 1234 is not a valid UUID: invalid UUID length: 4"),
+			expectResult: nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -240,22 +266,23 @@ func Test_getTadetectorResult(t *testing.T) {
 			id:    "tad-1",
 			query: tadQuery,
 			returnedRow: sqlmock.NewRows([]string{
-				"Id", "SourceIP", "SourceTransportPort", "DestinationIP", "DestinationTransportPort", "FlowStartSeconds", "FlowEndSeconds", "Throughput", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
-				AddRow("mock_Id", "mock_SourceIP", "mock_SourceTransportPort", "mock_DestinationIP", "mock_DestinationTransportPort", "mock_FlowStartSeconds", "mock_FlowEndSeconds", "mock_Throughput", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
+				"Id", "SourceIP", "SourceTransportPort", "DestinationIP", "DestinationTransportPort", "FlowStartSeconds", "FlowEndSeconds", "Throughput", "ThroughputStandardDeviation", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
+				AddRow("mock_Id", "mock_SourceIP", "mock_SourceTransportPort", "mock_DestinationIP", "mock_DestinationTransportPort", "mock_FlowStartSeconds", "mock_FlowEndSeconds", "mock_Throughput", "mock_ThroughputStandardDeviation", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
 			expectedResult: &v1alpha1.ThroughputAnomalyDetector{
 				Stats: []v1alpha1.ThroughputAnomalyDetectorStats{{
-					Id:                       "mock_Id",
-					SourceIP:                 "mock_SourceIP",
-					SourceTransportPort:      "mock_SourceTransportPort",
-					DestinationIP:            "mock_DestinationIP",
-					DestinationTransportPort: "mock_DestinationTransportPort",
-					FlowStartSeconds:         "mock_FlowStartSeconds",
-					FlowEndSeconds:           "mock_FlowEndSeconds",
-					Throughput:               "mock_Throughput",
-					AggType:                  "mock_AggType",
-					AlgoType:                 "mock_AlgoType",
-					AlgoCalc:                 "mock_AlgoCalc",
-					Anomaly:                  "mock_Anomaly",
+					Id:                          "mock_Id",
+					SourceIP:                    "mock_SourceIP",
+					SourceTransportPort:         "mock_SourceTransportPort",
+					DestinationIP:               "mock_DestinationIP",
+					DestinationTransportPort:    "mock_DestinationTransportPort",
+					FlowStartSeconds:            "mock_FlowStartSeconds",
+					FlowEndSeconds:              "mock_FlowEndSeconds",
+					Throughput:                  "mock_Throughput",
+					ThroughputStandardDeviation: "mock_ThroughputStandardDeviation",
+					AggType:                     "mock_AggType",
+					AlgoType:                    "mock_AlgoType",
+					AlgoCalc:                    "mock_AlgoCalc",
+					Anomaly:                     "mock_Anomaly",
 				}},
 			},
 			expecterr: nil,
@@ -265,18 +292,19 @@ func Test_getTadetectorResult(t *testing.T) {
 			id:    "tad-2",
 			query: aggTadExternalQuery,
 			returnedRow: sqlmock.NewRows([]string{
-				"Id", "destinationIP", "FlowEndSeconds", "Throughput", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
-				AddRow("mock_Id", "mock_destinationIP", "mock_FlowEndSeconds", "mock_Throughput", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
+				"Id", "destinationIP", "FlowEndSeconds", "Throughput", "ThroughputStandardDeviation", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
+				AddRow("mock_Id", "mock_destinationIP", "mock_FlowEndSeconds", "mock_Throughput", "mock_ThroughputStandardDeviation", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
 			expectedResult: &v1alpha1.ThroughputAnomalyDetector{
 				Stats: []v1alpha1.ThroughputAnomalyDetectorStats{{
-					Id:             "mock_Id",
-					DestinationIP:  "mock_destinationIP",
-					FlowEndSeconds: "mock_FlowEndSeconds",
-					Throughput:     "mock_Throughput",
-					AggType:        "mock_AggType",
-					AlgoType:       "mock_AlgoType",
-					AlgoCalc:       "mock_AlgoCalc",
-					Anomaly:        "mock_Anomaly",
+					Id:                          "mock_Id",
+					DestinationIP:               "mock_destinationIP",
+					FlowEndSeconds:              "mock_FlowEndSeconds",
+					Throughput:                  "mock_Throughput",
+					ThroughputStandardDeviation: "mock_ThroughputStandardDeviation",
+					AggType:                     "mock_AggType",
+					AlgoType:                    "mock_AlgoType",
+					AlgoCalc:                    "mock_AlgoCalc",
+					Anomaly:                     "mock_Anomaly",
 				}},
 			},
 			expecterr: nil,
@@ -286,20 +314,21 @@ func Test_getTadetectorResult(t *testing.T) {
 			id:    "tad-3",
 			query: aggTadPodLabelQuery,
 			returnedRow: sqlmock.NewRows([]string{
-				"Id", "PodNamespace", "PodLabels", "Direction", "FlowEndSeconds", "Throughput", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
-				AddRow("mock_Id", "mock_PodNamespace", "mock_PodLabels", "mock_Direction", "mock_FlowEndSeconds", "mock_Throughput", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
+				"Id", "PodNamespace", "PodLabels", "Direction", "FlowEndSeconds", "Throughput", "ThroughputStandardDeviation", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
+				AddRow("mock_Id", "mock_PodNamespace", "mock_PodLabels", "mock_Direction", "mock_FlowEndSeconds", "mock_Throughput", "mock_ThroughputStandardDeviation", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
 			expectedResult: &v1alpha1.ThroughputAnomalyDetector{
 				Stats: []v1alpha1.ThroughputAnomalyDetectorStats{{
-					Id:             "mock_Id",
-					PodNamespace:   "mock_PodNamespace",
-					PodLabels:      "mock_PodLabels",
-					Direction:      "mock_Direction",
-					FlowEndSeconds: "mock_FlowEndSeconds",
-					Throughput:     "mock_Throughput",
-					AggType:        "mock_AggType",
-					AlgoType:       "mock_AlgoType",
-					AlgoCalc:       "mock_AlgoCalc",
-					Anomaly:        "mock_Anomaly",
+					Id:                          "mock_Id",
+					PodNamespace:                "mock_PodNamespace",
+					PodLabels:                   "mock_PodLabels",
+					Direction:                   "mock_Direction",
+					FlowEndSeconds:              "mock_FlowEndSeconds",
+					Throughput:                  "mock_Throughput",
+					ThroughputStandardDeviation: "mock_ThroughputStandardDeviation",
+					AggType:                     "mock_AggType",
+					AlgoType:                    "mock_AlgoType",
+					AlgoCalc:                    "mock_AlgoCalc",
+					Anomaly:                     "mock_Anomaly",
 				}},
 			},
 			expecterr: nil,
@@ -309,20 +338,21 @@ func Test_getTadetectorResult(t *testing.T) {
 			id:    "tad-4",
 			query: aggTadPodNameQuery,
 			returnedRow: sqlmock.NewRows([]string{
-				"Id", "PodNamespace", "PodName", "Direction", "FlowEndSeconds", "Throughput", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
-				AddRow("mock_Id", "mock_PodNamespace", "mock_PodName", "mock_Direction", "mock_FlowEndSeconds", "mock_Throughput", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
+				"Id", "PodNamespace", "PodName", "Direction", "FlowEndSeconds", "Throughput", "ThroughputStandardDeviation", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
+				AddRow("mock_Id", "mock_PodNamespace", "mock_PodName", "mock_Direction", "mock_FlowEndSeconds", "mock_Throughput", "mock_ThroughputStandardDeviation", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
 			expectedResult: &v1alpha1.ThroughputAnomalyDetector{
 				Stats: []v1alpha1.ThroughputAnomalyDetectorStats{{
-					Id:             "mock_Id",
-					PodNamespace:   "mock_PodNamespace",
-					PodName:        "mock_PodName",
-					Direction:      "mock_Direction",
-					FlowEndSeconds: "mock_FlowEndSeconds",
-					Throughput:     "mock_Throughput",
-					AggType:        "mock_AggType",
-					AlgoType:       "mock_AlgoType",
-					AlgoCalc:       "mock_AlgoCalc",
-					Anomaly:        "mock_Anomaly",
+					Id:                          "mock_Id",
+					PodNamespace:                "mock_PodNamespace",
+					PodName:                     "mock_PodName",
+					Direction:                   "mock_Direction",
+					FlowEndSeconds:              "mock_FlowEndSeconds",
+					Throughput:                  "mock_Throughput",
+					ThroughputStandardDeviation: "mock_ThroughputStandardDeviation",
+					AggType:                     "mock_AggType",
+					AlgoType:                    "mock_AlgoType",
+					AlgoCalc:                    "mock_AlgoCalc",
+					Anomaly:                     "mock_Anomaly",
 				}},
 			},
 			expecterr: nil,
@@ -332,18 +362,19 @@ func Test_getTadetectorResult(t *testing.T) {
 			id:    "tad-5",
 			query: aggTadSvcQuery,
 			returnedRow: sqlmock.NewRows([]string{
-				"Id", "DestinationServicePortName", "FlowEndSeconds", "Throughput", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
-				AddRow("mock_Id", "mock_DestinationServicePortName", "mock_FlowEndSeconds", "mock_Throughput", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
+				"Id", "DestinationServicePortName", "FlowEndSeconds", "Throughput", "ThroughputStandardDeviation", "AggType", "AlgoType", "AlgoCalc", "Anomaly"}).
+				AddRow("mock_Id", "mock_DestinationServicePortName", "mock_FlowEndSeconds", "mock_Throughput", "mock_ThroughputStandardDeviation", "mock_AggType", "mock_AlgoType", "mock_AlgoCalc", "mock_Anomaly"),
 			expectedResult: &v1alpha1.ThroughputAnomalyDetector{
 				Stats: []v1alpha1.ThroughputAnomalyDetectorStats{{
-					Id:                         "mock_Id",
-					DestinationServicePortName: "mock_DestinationServicePortName",
-					FlowEndSeconds:             "mock_FlowEndSeconds",
-					Throughput:                 "mock_Throughput",
-					AggType:                    "mock_AggType",
-					AlgoType:                   "mock_AlgoType",
-					AlgoCalc:                   "mock_AlgoCalc",
-					Anomaly:                    "mock_Anomaly",
+					Id:                          "mock_Id",
+					DestinationServicePortName:  "mock_DestinationServicePortName",
+					FlowEndSeconds:              "mock_FlowEndSeconds",
+					Throughput:                  "mock_Throughput",
+					ThroughputStandardDeviation: "mock_ThroughputStandardDeviation",
+					AggType:                     "mock_AggType",
+					AlgoType:                    "mock_AlgoType",
+					AlgoCalc:                    "mock_AlgoCalc",
+					Anomaly:                     "mock_Anomaly",
 				}},
 			},
 			expecterr: nil,
@@ -25,10 +25,9 @@ import (
 
 	"antrea.io/theia/pkg/apis/stats/v1alpha1"
 	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util/env"
 )
 
-const defaultNameSpace = "flow-visibility"
-
 // REST implements rest.Storage for clickhouse.
 type REST struct {
 	clickHouseStatusQuerier querier.ClickHouseStatQuerier
@@ -51,7 +50,7 @@ func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions)
 	var status v1alpha1.ClickHouseStats
 	switch name {
 	case "diskInfo":
-		err := r.clickHouseStatusQuerier.GetDiskInfo(defaultNameSpace, &status)
+		err := r.clickHouseStatusQuerier.GetDiskInfo(env.GetTheiaNamespace(), &status)
 		if err != nil {
 			return nil, fmt.Errorf("error when sending diskInfo query to ClickHouse: %s", err)
 		}
@@ -59,7 +58,7 @@ func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions)
 			return nil, fmt.Errorf("no diskInfo data is returned by database")
 		}
 	case "tableInfo":
-		err := r.clickHouseStatusQuerier.GetTableInfo(defaultNameSpace, &status)
+		err := r.clickHouseStatusQuerier.GetTableInfo(env.GetTheiaNamespace(), &status)
 		if err != nil {
 			return nil, fmt.Errorf("error when sending tableInfo query to ClickHouse: %s", err)
 		}
@@ -67,7 +66,7 @@ func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions)
 			return nil, fmt.Errorf("no tableInfo data is returned by database")
 		}
 	case "insertRate":
-		err := r.clickHouseStatusQuerier.GetInsertRate(defaultNameSpace, &status)
+		err := r.clickHouseStatusQuerier.GetInsertRate(env.GetTheiaNamespace(), &status)
 		if err != nil {
 			return nil, fmt.Errorf("error when sending insertRate query to ClickHouse: %s", err)
 		}
@@ -75,13 +74,47 @@ func (r *REST) Get(ctx context.Context, name string, options *metav1.GetOptions)
 			return nil, fmt.Errorf("no insertRate data is returned by database")
 		}
 	case "stackTrace":
-		err := r.clickHouseStatusQuerier.GetStackTrace(defaultNameSpace, &status)
+		err := r.clickHouseStatusQuerier.GetStackTrace(env.GetTheiaNamespace(), &status)
 		if err != nil {
 			return nil, fmt.Errorf("error when sending stackTrace query to ClickHouse: %s", err)
 		}
 		if status.StackTraces == nil {
 			return nil, fmt.Errorf("no stackTrace data is returned by database")
 		}
+	case "retentionHistory":
+		// The history is empty until the monitor deletes records.
+		err := r.clickHouseStatusQuerier.GetRetentionHistory(env.GetTheiaNamespace(), &status)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending retentionHistory query to ClickHouse: %s", err)
+		}
+	case "systemMetrics":
+		err := r.clickHouseStatusQuerier.GetSystemMetrics(env.GetTheiaNamespace(), &status)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending systemMetrics query to ClickHouse: %s", err)
+		}
+		if status.SystemMetrics == nil {
+			return nil, fmt.Errorf("no systemMetrics data is returned by database")
+		}
+	case "schemaVersion":
+		err := r.clickHouseStatusQuerier.GetSchemaVersion(env.GetTheiaNamespace(), &status)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending schemaVersion query to ClickHouse: %s", err)
+		}
+		if status.SchemaVersions == nil {
+			return nil, fmt.Errorf("no schemaVersion data is returned by database")
+		}
+	case "insertRateLastHour":
+		// There is no data when nothing was inserted during the last hour.
+		err := r.clickHouseStatusQuerier.GetInsertRateLastHour(env.GetTheiaNamespace(), &status)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending insertRateLastHour query to ClickHouse: %s", err)
+		}
+	case "migrationProgress":
+		// There is no progress until a migration rewrites or copies a table.
+		err := r.clickHouseStatusQuerier.GetMigrationProgress(env.GetTheiaNamespace(), &status)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending migrationProgress query to ClickHouse: %s", err)
+		}
 	default:
 		return nil, fmt.Errorf("cannot recognize the statua name: %s", name)
 	}
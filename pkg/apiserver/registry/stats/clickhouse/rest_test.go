@@ -17,7 +17,9 @@ package clickhouse
 import (
 	"context"
 	"fmt"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -74,6 +76,56 @@ func TestREST_Get(t *testing.T) {
 				}},
 			},
 		},
+		{
+			name:      "Get retentionHistory",
+			queryName: "retentionHistory",
+			expectErr: nil,
+			expectResult: &stats.ClickHouseStats{
+				RetentionHistory: []stats.DeletionRecord{{
+					Shard: "Shard_test",
+				}},
+			},
+		},
+		{
+			name:      "Get systemMetrics",
+			queryName: "systemMetrics",
+			expectErr: nil,
+			expectResult: &stats.ClickHouseStats{
+				SystemMetrics: []stats.SystemMetric{{
+					Shard: "Shard_test",
+				}},
+			},
+		},
+		{
+			name:      "Get schemaVersion",
+			queryName: "schemaVersion",
+			expectErr: nil,
+			expectResult: &stats.ClickHouseStats{
+				SchemaVersions: []stats.SchemaVersion{{
+					Shard: "Shard_test",
+				}},
+			},
+		},
+		{
+			name:      "Get insertRateLastHour",
+			queryName: "insertRateLastHour",
+			expectErr: nil,
+			expectResult: &stats.ClickHouseStats{
+				InsertRates: []stats.InsertRate{{
+					Shard: "Shard_test",
+				}},
+			},
+		},
+		{
+			name:      "Get migrationProgress",
+			queryName: "migrationProgress",
+			expectErr: nil,
+			expectResult: &stats.ClickHouseStats{
+				MigrationProgress: []stats.MigrationProgress{{
+					TableName: "flows_local",
+				}},
+			},
+		},
 		{
 			name:         "not found",
 			queryName:    "notFound",
@@ -123,3 +175,71 @@ func (c *fakeQuerier) GetStackTrace(namespace string, status *stats.ClickHouseSt
 	}}
 	return nil
 }
+func (c *fakeQuerier) GetRetentionHistory(namespace string, status *stats.ClickHouseStats) error {
+	status.RetentionHistory = []stats.DeletionRecord{{
+		Shard: "Shard_test",
+	}}
+	return nil
+}
+func (c *fakeQuerier) GetSystemMetrics(namespace string, status *stats.ClickHouseStats) error {
+	status.SystemMetrics = []stats.SystemMetric{{
+		Shard: "Shard_test",
+	}}
+	return nil
+}
+func (c *fakeQuerier) GetSchemaVersion(namespace string, status *stats.ClickHouseStats) error {
+	status.SchemaVersions = []stats.SchemaVersion{{
+		Shard: "Shard_test",
+	}}
+	return nil
+}
+func (c *fakeQuerier) GetInsertRateLastHour(namespace string, status *stats.ClickHouseStats) error {
+	status.InsertRates = []stats.InsertRate{{
+		Shard: "Shard_test",
+	}}
+	return nil
+}
+func (c *fakeQuerier) GetMigrationProgress(namespace string, status *stats.ClickHouseStats) error {
+	status.MigrationProgress = []stats.MigrationProgress{{
+		TableName: "flows_local",
+	}}
+	return nil
+}
+func (c *fakeQuerier) GetFlowCardinality(namespace string, window time.Duration, trafficClass string, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetTrafficClasses(namespace string, window time.Duration, resolution string, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetNodeFlows(namespace string, window time.Duration, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetTopTalkers(namespace string, window time.Duration, resolution, trafficClass, groupBy, sortBy string, limit int, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetWorkloadFlows(namespace string, window time.Duration, podNamespace, podName string, podLabels map[string]string, limit int, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetPolicyHits(namespace string, window time.Duration, limit int, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetSecurityPosture(namespace string, window time.Duration, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetPolicyTraffic(namespace string, window time.Duration, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetFlowIntegrity(namespace string, window time.Duration, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) ExportFlows(namespace string, startTime, endTime time.Time, format string, batchSize int) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (c *fakeQuerier) SetColdStorage(namespace, moveAfter string) ([]string, error) {
+	return nil, nil
+}
+
+func (c *fakeQuerier) CreateUser(namespace, name, password, role string) error {
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouseuser
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/clickhouse/schema"
+	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util/env"
+)
+
+// REST implements rest.Storage for the ClickHouse users.
+type REST struct {
+	clickHouseStatQuerier querier.ClickHouseStatQuerier
+}
+
+var (
+	_ rest.Creater = &REST{}
+)
+
+// NewREST returns a REST object that will work against API services.
+func NewREST(chq querier.ClickHouseStatQuerier) *REST {
+	return &REST{clickHouseStatQuerier: chq}
+}
+
+func (r *REST) New() runtime.Object {
+	return &v1alpha1.ClickHouseUser{}
+}
+
+func (r *REST) Destroy() {
+}
+
+// Create creates the ClickHouse user of the request with its role. The
+// password of the user is not returned.
+func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	user, ok := obj.(*v1alpha1.ClickHouseUser)
+	if !ok {
+		return nil, errors.NewBadRequest(fmt.Sprintf("not a ClickHouseUser object: %T", obj))
+	}
+	role, err := schema.ParseRole(user.Role)
+	if err != nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("invalid role: %v", err))
+	}
+	if err := schema.ValidateUser(schema.User{Name: user.Name, Password: user.Password, Role: role}); err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	if err := r.clickHouseStatQuerier.CreateUser(env.GetTheiaNamespace(), user.Name, user.Password, user.Role); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("error when creating the ClickHouse user: %v", err))
+	}
+	klog.InfoS("Created ClickHouse user", "user", user.Name, "role", user.Role)
+	return &v1alpha1.ClickHouseUser{
+		ObjectMeta: metav1.ObjectMeta{Name: user.Name},
+		Role:       user.Role,
+	}, nil
+}
+
+func (r *REST) NamespaceScoped() bool {
+	return false
+}
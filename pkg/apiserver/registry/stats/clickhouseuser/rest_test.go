@@ -0,0 +1,104 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouseuser
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/querier"
+)
+
+// fakeQuerier only implements CreateUser, the other methods of
+// ClickHouseStatQuerier are not called by the REST.
+type fakeQuerier struct {
+	querier.ClickHouseStatQuerier
+	name, password, role string
+	err                  error
+}
+
+func (q *fakeQuerier) CreateUser(namespace, name, password, role string) error {
+	q.name, q.password, q.role = name, password, role
+	return q.err
+}
+
+func TestREST_Create(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         *v1alpha1.ClickHouseUser
+		querierErr   error
+		expectErr    error
+		expectResult *v1alpha1.ClickHouseUser
+	}{
+		{
+			name: "Reader",
+			user: &v1alpha1.ClickHouseUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "grafana"},
+				Password:   "grafana_password",
+				Role:       "reader",
+			},
+			expectResult: &v1alpha1.ClickHouseUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "grafana"},
+				Role:       "reader",
+			},
+		},
+		{
+			name: "Invalid role",
+			user: &v1alpha1.ClickHouseUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "grafana"},
+				Password:   "grafana_password",
+				Role:       "root",
+			},
+			expectErr: errors.NewBadRequest("invalid role: role \"root\" is not valid, it should be one of writer, reader or admin"),
+		},
+		{
+			name: "Invalid name",
+			user: &v1alpha1.ClickHouseUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "grafana-1"},
+				Password:   "grafana_password",
+				Role:       "reader",
+			},
+			expectErr: errors.NewBadRequest("user name \"grafana-1\" is not valid, it should only contain letters, digits and underscores, and not start with a digit"),
+		},
+		{
+			name: "Querier error",
+			user: &v1alpha1.ClickHouseUser{
+				ObjectMeta: metav1.ObjectMeta{Name: "flow_aggregator"},
+				Password:   "writer_password",
+				Role:       "writer",
+			},
+			querierErr: fmt.Errorf("access denied"),
+			expectErr:  errors.NewInternalError(fmt.Errorf("error when creating the ClickHouse user: access denied")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &fakeQuerier{err: tt.querierErr}
+			r := NewREST(q)
+			result, err := r.Create(context.TODO(), tt.user, nil, &metav1.CreateOptions{})
+			assert.Equal(t, tt.expectErr, err)
+			if tt.expectErr == nil {
+				assert.Equal(t, tt.expectResult, result)
+				assert.Equal(t, tt.user.Password, q.password)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coldstorage
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/env"
+)
+
+// REST implements rest.Storage for the cold storage of the flow records.
+type REST struct {
+	clickHouseStatQuerier querier.ClickHouseStatQuerier
+}
+
+var (
+	_ rest.Creater = &REST{}
+)
+
+// NewREST returns a REST object that will work against API services.
+func NewREST(chq querier.ClickHouseStatQuerier) *REST {
+	return &REST{clickHouseStatQuerier: chq}
+}
+
+func (r *REST) New() runtime.Object {
+	return &v1alpha1.ClickHouseColdStorage{}
+}
+
+func (r *REST) Destroy() {
+}
+
+// Create sets the TTL rules moving the flow records to the cold volume after
+// the age of the request.
+func (r *REST) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	coldStorage, ok := obj.(*v1alpha1.ClickHouseColdStorage)
+	if !ok {
+		return nil, errors.NewBadRequest(fmt.Sprintf("not a ClickHouseColdStorage object: %T", obj))
+	}
+	if coldStorage.MoveAfter != "" {
+		if err := clickhouse.ValidateInterval(coldStorage.MoveAfter); err != nil {
+			return nil, errors.NewBadRequest(fmt.Sprintf("invalid moveAfter: %v", err))
+		}
+	}
+	tables, err := r.clickHouseStatQuerier.SetColdStorage(env.GetTheiaNamespace(), coldStorage.MoveAfter)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("error when setting the cold storage of the flow records: %v", err))
+	}
+	klog.InfoS("Set the cold storage of the flow records", "moveAfter", coldStorage.MoveAfter, "tables", tables)
+	return &v1alpha1.ClickHouseColdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: coldStorage.Name},
+		MoveAfter:  coldStorage.MoveAfter,
+		Tables:     tables,
+	}, nil
+}
+
+func (r *REST) NamespaceScoped() bool {
+	return false
+}
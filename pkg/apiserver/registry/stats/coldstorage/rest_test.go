@@ -0,0 +1,97 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coldstorage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/querier"
+)
+
+// fakeQuerier only implements SetColdStorage, the other methods of
+// ClickHouseStatQuerier are not called by the REST.
+type fakeQuerier struct {
+	querier.ClickHouseStatQuerier
+	moveAfter string
+	err       error
+}
+
+func (q *fakeQuerier) SetColdStorage(namespace, moveAfter string) ([]string, error) {
+	q.moveAfter = moveAfter
+	if q.err != nil {
+		return nil, q.err
+	}
+	return []string{"flows_local", "pod_view_table_local"}, nil
+}
+
+func TestREST_Create(t *testing.T) {
+	tests := []struct {
+		name         string
+		moveAfter    string
+		querierErr   error
+		expectErr    error
+		expectResult *v1alpha1.ClickHouseColdStorage
+	}{
+		{
+			name:      "Move after 7 days",
+			moveAfter: "7 DAY",
+			expectResult: &v1alpha1.ClickHouseColdStorage{
+				ObjectMeta: metav1.ObjectMeta{Name: "flows"},
+				MoveAfter:  "7 DAY",
+				Tables:     []string{"flows_local", "pod_view_table_local"},
+			},
+		},
+		{
+			name: "Only move when the hot volume is full",
+			expectResult: &v1alpha1.ClickHouseColdStorage{
+				ObjectMeta: metav1.ObjectMeta{Name: "flows"},
+				Tables:     []string{"flows_local", "pod_view_table_local"},
+			},
+		},
+		{
+			name:      "Invalid interval",
+			moveAfter: "7d",
+			expectErr: errors.NewBadRequest("invalid moveAfter: \"7d\" is not a valid interval, it should be a positive integer followed by one of SECOND, MINUTE, HOUR, DAY, WEEK, MONTH, QUARTER or YEAR"),
+		},
+		{
+			name:       "Cold storage not enabled",
+			moveAfter:  "7 DAY",
+			querierErr: fmt.Errorf("storage policy tiered has no cold volume"),
+			expectErr:  errors.NewInternalError(fmt.Errorf("error when setting the cold storage of the flow records: storage policy tiered has no cold volume")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &fakeQuerier{err: tt.querierErr}
+			r := NewREST(q)
+			result, err := r.Create(context.TODO(), &v1alpha1.ClickHouseColdStorage{
+				ObjectMeta: metav1.ObjectMeta{Name: "flows"},
+				MoveAfter:  tt.moveAfter,
+			}, nil, &metav1.CreateOptions{})
+			assert.Equal(t, tt.expectErr, err)
+			if tt.expectErr == nil {
+				assert.Equal(t, tt.expectResult, result)
+				assert.Equal(t, tt.moveAfter, q.moveAfter)
+			}
+		})
+	}
+}
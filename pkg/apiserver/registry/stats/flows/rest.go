@@ -0,0 +1,349 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flows
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/rest"
+
+	"antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util/env"
+)
+
+const (
+	defaultWindow = time.Hour
+
+	defaultTopTalkersLimit = 10
+	maxTopTalkersLimit     = 1000
+
+	defaultWorkloadFlowsLimit = 20
+	maxWorkloadFlowsLimit     = 1000
+
+	// defaultExportBatchSize is the default block size of ClickHouse.
+	defaultExportBatchSize = 65536
+	maxExportBatchSize     = 1048576
+)
+
+// exportMIMETypes are the MIME types of the exported flow records, by format.
+var exportMIMETypes = map[string]string{
+	v1alpha1.FlowExportFormatCSV:     "text/csv",
+	v1alpha1.FlowExportFormatParquet: "application/vnd.apache.parquet",
+}
+
+// REST implements rest.Storage for flow statistics.
+type REST struct {
+	flowStatQuerier querier.ClickHouseStatQuerier
+}
+
+var (
+	_ rest.GetterWithOptions = &REST{}
+)
+
+// NewREST returns a REST object that will work against API services.
+func NewREST(chq querier.ClickHouseStatQuerier) *REST {
+	return &REST{flowStatQuerier: chq}
+}
+
+func (r *REST) New() runtime.Object {
+	return &v1alpha1.FlowStats{}
+}
+
+// NewGetOptions returns the options used to select the window over which the
+// statistics are computed.
+func (r *REST) NewGetOptions() (runtime.Object, bool, string) {
+	return &v1alpha1.FlowStatsGetOptions{}, false, ""
+}
+
+func (r *REST) Get(ctx context.Context, name string, options runtime.Object) (runtime.Object, error) {
+	window := defaultWindow
+	var trafficClass string
+	resolution := v1alpha1.FlowResolutionAuto
+	getOptions, ok := options.(*v1alpha1.FlowStatsGetOptions)
+	if ok {
+		if getOptions.Window != "" {
+			var err error
+			window, err = time.ParseDuration(getOptions.Window)
+			if err != nil || window <= 0 {
+				return nil, errors.NewBadRequest(fmt.Sprintf("invalid window %q, it should be a positive duration", getOptions.Window))
+			}
+		}
+		trafficClass = getOptions.TrafficClass
+		if trafficClass != "" && !slices.Contains(v1alpha1.TrafficClasses, trafficClass) {
+			return nil, errors.NewBadRequest(fmt.Sprintf("invalid traffic class %q, it should be one of %s", trafficClass, strings.Join(v1alpha1.TrafficClasses, ", ")))
+		}
+		if getOptions.Resolution != "" {
+			if !slices.Contains(v1alpha1.FlowResolutions, getOptions.Resolution) {
+				return nil, errors.NewBadRequest(fmt.Sprintf("invalid resolution %q, it should be one of %s", getOptions.Resolution, strings.Join(v1alpha1.FlowResolutions, ", ")))
+			}
+			if name != "traffic-classes" && name != "top" {
+				return nil, errors.NewBadRequest("resolution can only be selected for traffic classes and top talkers")
+			}
+			resolution = getOptions.Resolution
+		}
+	}
+	var stats v1alpha1.FlowStats
+	switch name {
+	case "cardinality":
+		err := r.flowStatQuerier.GetFlowCardinality(env.GetTheiaNamespace(), window, trafficClass, &stats)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending cardinality query to ClickHouse: %s", err)
+		}
+	case "traffic-classes":
+		if trafficClass != "" {
+			return nil, errors.NewBadRequest("traffic class cannot be selected when breaking the flows down by traffic class")
+		}
+		err := r.flowStatQuerier.GetTrafficClasses(env.GetTheiaNamespace(), window, resolution, &stats)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending traffic classes query to ClickHouse: %s", err)
+		}
+	case "nodes":
+		if trafficClass != "" {
+			return nil, errors.NewBadRequest("traffic class cannot be selected when breaking the flows down by Node")
+		}
+		err := r.flowStatQuerier.GetNodeFlows(env.GetTheiaNamespace(), window, &stats)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending node flows query to ClickHouse: %s", err)
+		}
+	case "top":
+		groupBy, sortBy, limit, err := getTopTalkersOptions(getOptions)
+		if err != nil {
+			return nil, err
+		}
+		err = r.flowStatQuerier.GetTopTalkers(env.GetTheiaNamespace(), window, resolution, trafficClass, groupBy, sortBy, limit, &stats)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending top talkers query to ClickHouse: %s", err)
+		}
+	case "summary":
+		if trafficClass != "" {
+			return nil, errors.NewBadRequest("traffic class cannot be selected when summarizing the flows of a workload")
+		}
+		podNamespace, podName, podLabels, limit, err := getWorkloadFlowsOptions(getOptions)
+		if err != nil {
+			return nil, err
+		}
+		err = r.flowStatQuerier.GetWorkloadFlows(env.GetTheiaNamespace(), window, podNamespace, podName, podLabels, limit, &stats)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending workload flows query to ClickHouse: %s", err)
+		}
+	case "policies":
+		if trafficClass != "" {
+			return nil, errors.NewBadRequest("traffic class cannot be selected when breaking the flows down by NetworkPolicy")
+		}
+		err := r.flowStatQuerier.GetPolicyTraffic(env.GetTheiaNamespace(), window, &stats)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending policy traffic query to ClickHouse: %s", err)
+		}
+	case "integrity":
+		if trafficClass != "" {
+			return nil, errors.NewBadRequest("traffic class cannot be selected when checking the integrity of the flows")
+		}
+		err := r.flowStatQuerier.GetFlowIntegrity(env.GetTheiaNamespace(), window, &stats)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending integrity queries to ClickHouse: %s", err)
+		}
+	case "export":
+		if trafficClass != "" {
+			return nil, errors.NewBadRequest("traffic class cannot be selected when exporting the flows")
+		}
+		startTime, endTime, format, batchSize, err := getExportOptions(getOptions)
+		if err != nil {
+			return nil, err
+		}
+		compression := getOptions.Compression
+		if compression != "" && compression != v1alpha1.FlowExportCompressionGzip {
+			return nil, errors.NewBadRequest(fmt.Sprintf("invalid compression %q, it should be %s", compression, v1alpha1.FlowExportCompressionGzip))
+		}
+		stream, err := r.flowStatQuerier.ExportFlows(env.GetTheiaNamespace(), startTime, endTime, format, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("error when sending export query to ClickHouse: %s", err)
+		}
+		if compression == v1alpha1.FlowExportCompressionGzip {
+			return &exportStream{stream: gzipStream(stream), mimeType: "application/gzip"}, nil
+		}
+		return &exportStream{stream: stream, mimeType: exportMIMETypes[format]}, nil
+	default:
+		return nil, errors.NewNotFound(v1alpha1.Resource("flows"), name)
+	}
+	stats.Name = name
+	return &stats, nil
+}
+
+// getTopTalkersOptions returns the grouping, the sort key and the limit of top
+// talkers selected by the options, or their defaults.
+func getTopTalkersOptions(options *v1alpha1.FlowStatsGetOptions) (string, string, int, error) {
+	groupBy, sortBy, limit := v1alpha1.TopTalkersGroupByPods, v1alpha1.TopTalkersSortByBytes, defaultTopTalkersLimit
+	if options == nil {
+		return groupBy, sortBy, limit, nil
+	}
+	if options.GroupBy != "" {
+		if !slices.Contains(v1alpha1.TopTalkersGroupBys, options.GroupBy) {
+			return "", "", 0, errors.NewBadRequest(fmt.Sprintf("invalid grouping %q, it should be one of %s", options.GroupBy, strings.Join(v1alpha1.TopTalkersGroupBys, ", ")))
+		}
+		groupBy = options.GroupBy
+	}
+	if options.SortBy != "" {
+		if !slices.Contains(v1alpha1.TopTalkersSortBys, options.SortBy) {
+			return "", "", 0, errors.NewBadRequest(fmt.Sprintf("invalid sort key %q, it should be one of %s", options.SortBy, strings.Join(v1alpha1.TopTalkersSortBys, ", ")))
+		}
+		sortBy = options.SortBy
+	}
+	if options.Limit != "" {
+		var err error
+		limit, err = strconv.Atoi(options.Limit)
+		if err != nil || limit <= 0 || limit > maxTopTalkersLimit {
+			return "", "", 0, errors.NewBadRequest(fmt.Sprintf("invalid limit %q, it should be an integer between 1 and %d", options.Limit, maxTopTalkersLimit))
+		}
+	}
+	return groupBy, sortBy, limit, nil
+}
+
+// getWorkloadFlowsOptions returns the Namespace, the name or the labels of the
+// Pods of the summarized workload, and the limit of peers and ports per
+// direction, selected by the options. The Namespace and either the name or the
+// labels are required.
+func getWorkloadFlowsOptions(options *v1alpha1.FlowStatsGetOptions) (string, string, map[string]string, int, error) {
+	if options == nil || options.Namespace == "" {
+		return "", "", nil, 0, errors.NewBadRequest("namespace is required when summarizing the flows of a workload")
+	}
+	if (options.PodName == "") == (options.PodSelector == "") {
+		return "", "", nil, 0, errors.NewBadRequest("exactly one of Pod name and Pod selector is required when summarizing the flows of a workload")
+	}
+	var podLabels map[string]string
+	if options.PodSelector != "" {
+		selector, err := labels.ConvertSelectorToLabelsMap(options.PodSelector)
+		if err != nil {
+			return "", "", nil, 0, errors.NewBadRequest(fmt.Sprintf("invalid Pod selector %q, it should only have equality-based requirements: %v", options.PodSelector, err))
+		}
+		podLabels = selector
+	}
+	limit := defaultWorkloadFlowsLimit
+	if options.Limit != "" {
+		var err error
+		limit, err = strconv.Atoi(options.Limit)
+		if err != nil || limit <= 0 || limit > maxWorkloadFlowsLimit {
+			return "", "", nil, 0, errors.NewBadRequest(fmt.Sprintf("invalid limit %q, it should be an integer between 1 and %d", options.Limit, maxWorkloadFlowsLimit))
+		}
+	}
+	return options.Namespace, options.PodName, podLabels, limit, nil
+}
+
+// getExportOptions returns the time range, the format and the batch size of
+// the exported flow records selected by the options. The start time is
+// required, and the end time is now by default.
+func getExportOptions(options *v1alpha1.FlowStatsGetOptions) (time.Time, time.Time, string, int, error) {
+	var startTime, endTime time.Time
+	if options == nil || options.StartTime == "" {
+		return startTime, endTime, "", 0, errors.NewBadRequest("start time is required when exporting the flows")
+	}
+	startTime, err := time.Parse(time.RFC3339, options.StartTime)
+	if err != nil {
+		return startTime, endTime, "", 0, errors.NewBadRequest(fmt.Sprintf("invalid start time %q, it should be in RFC 3339 format", options.StartTime))
+	}
+	endTime = time.Now()
+	if options.EndTime != "" {
+		endTime, err = time.Parse(time.RFC3339, options.EndTime)
+		if err != nil {
+			return startTime, endTime, "", 0, errors.NewBadRequest(fmt.Sprintf("invalid end time %q, it should be in RFC 3339 format", options.EndTime))
+		}
+	}
+	if !endTime.After(startTime) {
+		return startTime, endTime, "", 0, errors.NewBadRequest("end time should be after start time")
+	}
+	format := v1alpha1.FlowExportFormatCSV
+	if options.Format != "" {
+		if !slices.Contains(v1alpha1.FlowExportFormats, options.Format) {
+			return startTime, endTime, "", 0, errors.NewBadRequest(fmt.Sprintf("invalid format %q, it should be one of %s", options.Format, strings.Join(v1alpha1.FlowExportFormats, ", ")))
+		}
+		format = options.Format
+	}
+	batchSize := defaultExportBatchSize
+	if options.BatchSize != "" {
+		batchSize, err = strconv.Atoi(options.BatchSize)
+		if err != nil || batchSize <= 0 || batchSize > maxExportBatchSize {
+			return startTime, endTime, "", 0, errors.NewBadRequest(fmt.Sprintf("invalid batch size %q, it should be an integer between 1 and %d", options.BatchSize, maxExportBatchSize))
+		}
+	}
+	return startTime, endTime, format, batchSize, nil
+}
+
+var (
+	_ rest.ResourceStreamer = new(exportStream)
+	_ runtime.Object        = new(exportStream)
+)
+
+// exportStream streams the exported flow records to the client as they are
+// received from ClickHouse.
+type exportStream struct {
+	stream   io.ReadCloser
+	mimeType string
+}
+
+// gzipStream returns a stream of the data of stream compressed with gzip. The
+// apiserver does not compress the streamed responses, and the compression
+// reduces the transfer time of the exports through the port-forwards of the
+// CLI. The fastest level is used, as by the apiserver for other responses.
+func gzipStream(stream io.ReadCloser) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		defer stream.Close()
+		gzipWriter, _ := gzip.NewWriterLevel(writer, gzip.BestSpeed)
+		_, err := io.Copy(gzipWriter, stream)
+		if err == nil {
+			err = gzipWriter.Close()
+		}
+		// The reader gets the error of the stream instead of a truncated
+		// but valid gzip stream. Closing the reader stops the copy.
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
+
+func (e *exportStream) GetObjectKind() schema.ObjectKind {
+	return schema.EmptyObjectKind
+}
+
+func (e *exportStream) DeepCopyObject() runtime.Object {
+	panic("exportStream does not have DeepCopyObject")
+}
+
+func (e *exportStream) InputStream(_ context.Context, _, _ string) (stream io.ReadCloser, flush bool, mimeType string, err error) {
+	// stream will be closed by invoker, no need to close in this function.
+	return e.stream, true, e.mimeType, nil
+}
+
+func (r *REST) Destroy() {
+}
+
+func (r *REST) NamespaceScoped() bool {
+	return false
+}
+
+func (r *REST) ConvertToTable(ctx context.Context, obj runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	return rest.NewDefaultTableConvertor(v1alpha1.Resource("flows")).ConvertToTable(ctx, obj, tableOptions)
+}
@@ -0,0 +1,507 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flows
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/registry/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+)
+
+type fakeQuerier struct {
+	window       time.Duration
+	trafficClass string
+	resolution   string
+	groupBy      string
+	sortBy       string
+	limit        int
+	// time range, format and batch size of exported flows
+	export []interface{}
+	// Namespace, name and labels of the Pods of a summarized workload
+	workload []interface{}
+}
+
+func TestREST_Get(t *testing.T) {
+	tests := []struct {
+		name               string
+		statsName          string
+		options            *stats.FlowStatsGetOptions
+		expectWindow       time.Duration
+		expectTrafficClass string
+		expectResolution   string
+		expectErr          error
+		expectResult       *stats.FlowStats
+		// grouping, sort key and limit of top talkers
+		expectTopTalkers []interface{}
+		// Namespace, name and labels of the Pods, and limit of a workload
+		// summary
+		expectWorkload []interface{}
+	}{
+		{
+			name:         "Get cardinality with default window",
+			statsName:    "cardinality",
+			options:      &stats.FlowStatsGetOptions{},
+			expectWindow: time.Hour,
+			expectResult: &stats.FlowStats{
+				ObjectMeta:  v1.ObjectMeta{Name: "cardinality"},
+				Cardinality: stats.FlowCardinality{Pods: "10"},
+			},
+		},
+		{
+			name:         "Get cardinality with window",
+			statsName:    "cardinality",
+			options:      &stats.FlowStatsGetOptions{Window: "30m"},
+			expectWindow: 30 * time.Minute,
+			expectResult: &stats.FlowStats{
+				ObjectMeta:  v1.ObjectMeta{Name: "cardinality"},
+				Cardinality: stats.FlowCardinality{Pods: "10"},
+			},
+		},
+		{
+			name:               "Get cardinality of a traffic class",
+			statsName:          "cardinality",
+			options:            &stats.FlowStatsGetOptions{TrafficClass: "pod-to-service"},
+			expectWindow:       time.Hour,
+			expectTrafficClass: "pod-to-service",
+			expectResult: &stats.FlowStats{
+				ObjectMeta:  v1.ObjectMeta{Name: "cardinality"},
+				Cardinality: stats.FlowCardinality{Pods: "10"},
+			},
+		},
+		{
+			name:      "Invalid traffic class",
+			statsName: "cardinality",
+			options:   &stats.FlowStatsGetOptions{TrafficClass: "east-west"},
+			expectErr: errors.NewBadRequest("invalid traffic class \"east-west\", it should be one of intra-node, inter-node, pod-to-service, pod-to-external, external-to-pod, host-network, unknown"),
+		},
+		{
+			name:             "Get traffic classes",
+			statsName:        "traffic-classes",
+			options:          &stats.FlowStatsGetOptions{Window: "30m"},
+			expectWindow:     30 * time.Minute,
+			expectResolution: "auto",
+			expectResult: &stats.FlowStats{
+				ObjectMeta:     v1.ObjectMeta{Name: "traffic-classes"},
+				TrafficClasses: []stats.TrafficClassStats{{TrafficClass: "inter-node", Flows: "5"}},
+			},
+		},
+		{
+			name:      "Get traffic classes of a traffic class",
+			statsName: "traffic-classes",
+			options:   &stats.FlowStatsGetOptions{TrafficClass: "inter-node"},
+			expectErr: errors.NewBadRequest("traffic class cannot be selected when breaking the flows down by traffic class"),
+		},
+		{
+			name:         "Get node flows",
+			statsName:    "nodes",
+			options:      &stats.FlowStatsGetOptions{Window: "24h"},
+			expectWindow: 24 * time.Hour,
+			expectResult: &stats.FlowStats{
+				ObjectMeta: v1.ObjectMeta{Name: "nodes"},
+				Nodes:      []stats.NodeFlowStats{{Name: "node-1", Flows: "5", LastFlowEnd: "2023-09-01T10:00:00Z"}},
+			},
+		},
+		{
+			name:      "Get node flows of a traffic class",
+			statsName: "nodes",
+			options:   &stats.FlowStatsGetOptions{TrafficClass: "inter-node"},
+			expectErr: errors.NewBadRequest("traffic class cannot be selected when breaking the flows down by Node"),
+		},
+		{
+			name:         "Get policy traffic",
+			statsName:    "policies",
+			options:      &stats.FlowStatsGetOptions{Window: "168h"},
+			expectWindow: 168 * time.Hour,
+			expectResult: &stats.FlowStats{
+				ObjectMeta:    v1.ObjectMeta{Name: "policies"},
+				PolicyTraffic: []stats.PolicyTrafficStats{{Kind: "K8sNetworkPolicy", Namespace: "default", Name: "allow-client", AllowedFlows: "5"}},
+			},
+		},
+		{
+			name:      "Get policy traffic of a traffic class",
+			statsName: "policies",
+			options:   &stats.FlowStatsGetOptions{TrafficClass: "inter-node"},
+			expectErr: errors.NewBadRequest("traffic class cannot be selected when breaking the flows down by NetworkPolicy"),
+		},
+		{
+			name:         "Get flow integrity",
+			statsName:    "integrity",
+			options:      &stats.FlowStatsGetOptions{Window: "15m"},
+			expectWindow: 15 * time.Minute,
+			expectResult: &stats.FlowStats{
+				ObjectMeta: v1.ObjectMeta{Name: "integrity"},
+				Integrity:  []stats.FlowIntegrityStats{{Check: "start-before-end", Checked: "100", Anomalies: "0"}},
+			},
+		},
+		{
+			name:         "Get top talkers with default options",
+			statsName:    "top",
+			options:      &stats.FlowStatsGetOptions{Window: "5m"},
+			expectWindow: 5 * time.Minute,
+			expectResult: &stats.FlowStats{
+				ObjectMeta: v1.ObjectMeta{Name: "top"},
+				TopTalkers: []stats.TopTalkerStats{{Source: "default/client", Destination: "default/nginx", Bytes: "1000"}},
+			},
+			expectTopTalkers: []interface{}{"pods", "bytes", 10},
+		},
+		{
+			name:      "Get top talkers with options",
+			statsName: "top",
+			options: &stats.FlowStatsGetOptions{
+				Window:       "5m",
+				TrafficClass: "inter-node",
+				GroupBy:      "namespaces",
+				SortBy:       "reverse-packets",
+				Limit:        "20",
+				Resolution:   "1m",
+			},
+			expectWindow:       5 * time.Minute,
+			expectTrafficClass: "inter-node",
+			expectResolution:   "1m",
+			expectResult: &stats.FlowStats{
+				ObjectMeta: v1.ObjectMeta{Name: "top"},
+				TopTalkers: []stats.TopTalkerStats{{Source: "default/client", Destination: "default/nginx", Bytes: "1000"}},
+			},
+			expectTopTalkers: []interface{}{"namespaces", "reverse-packets", 20},
+		},
+		{
+			name:      "Invalid resolution",
+			statsName: "top",
+			options:   &stats.FlowStatsGetOptions{Resolution: "1d"},
+			expectErr: errors.NewBadRequest("invalid resolution \"1d\", it should be one of auto, raw, 1m, 1h"),
+		},
+		{
+			name:      "Get node flows with resolution",
+			statsName: "nodes",
+			options:   &stats.FlowStatsGetOptions{Resolution: "1m"},
+			expectErr: errors.NewBadRequest("resolution can only be selected for traffic classes and top talkers"),
+		},
+		{
+			name:      "Invalid grouping of top talkers",
+			statsName: "top",
+			options:   &stats.FlowStatsGetOptions{GroupBy: "nodes"},
+			expectErr: errors.NewBadRequest("invalid grouping \"nodes\", it should be one of pods, namespaces"),
+		},
+		{
+			name:      "Invalid sort key of top talkers",
+			statsName: "top",
+			options:   &stats.FlowStatsGetOptions{SortBy: "flows"},
+			expectErr: errors.NewBadRequest("invalid sort key \"flows\", it should be one of bytes, packets, reverse-bytes, reverse-packets"),
+		},
+		{
+			name:      "Invalid limit of top talkers",
+			statsName: "top",
+			options:   &stats.FlowStatsGetOptions{Limit: "0"},
+			expectErr: errors.NewBadRequest("invalid limit \"0\", it should be an integer between 1 and 1000"),
+		},
+		{
+			name:         "Get workload summary by Pod selector",
+			statsName:    "summary",
+			options:      &stats.FlowStatsGetOptions{Window: "24h", Namespace: "default", PodSelector: "app=web,tier=frontend"},
+			expectWindow: 24 * time.Hour,
+			expectResult: &stats.FlowStats{
+				ObjectMeta:    v1.ObjectMeta{Name: "summary"},
+				WorkloadFlows: []stats.WorkloadFlowStats{{Direction: "ingress", Peer: "default/client", Port: "80/TCP", Flows: "5"}},
+			},
+			expectWorkload: []interface{}{"default", "", map[string]string{"app": "web", "tier": "frontend"}, 20},
+		},
+		{
+			name:         "Get workload summary by Pod name",
+			statsName:    "summary",
+			options:      &stats.FlowStatsGetOptions{Window: "5m", Namespace: "default", PodName: "web-0", Limit: "5"},
+			expectWindow: 5 * time.Minute,
+			expectResult: &stats.FlowStats{
+				ObjectMeta:    v1.ObjectMeta{Name: "summary"},
+				WorkloadFlows: []stats.WorkloadFlowStats{{Direction: "ingress", Peer: "default/client", Port: "80/TCP", Flows: "5"}},
+			},
+			expectWorkload: []interface{}{"default", "web-0", map[string]string(nil), 5},
+		},
+		{
+			name:      "Workload summary without Namespace",
+			statsName: "summary",
+			options:   &stats.FlowStatsGetOptions{PodName: "web-0"},
+			expectErr: errors.NewBadRequest("namespace is required when summarizing the flows of a workload"),
+		},
+		{
+			name:      "Workload summary with Pod name and Pod selector",
+			statsName: "summary",
+			options:   &stats.FlowStatsGetOptions{Namespace: "default", PodName: "web-0", PodSelector: "app=web"},
+			expectErr: errors.NewBadRequest("exactly one of Pod name and Pod selector is required when summarizing the flows of a workload"),
+		},
+		{
+			name:      "Invalid Pod selector",
+			statsName: "summary",
+			options:   &stats.FlowStatsGetOptions{Namespace: "default", PodSelector: "app in (web)"},
+			expectErr: errors.NewBadRequest("invalid Pod selector \"app in (web)\", it should only have equality-based requirements: invalid selector: [app in (web)]"),
+		},
+		{
+			name:      "Workload summary of a traffic class",
+			statsName: "summary",
+			options:   &stats.FlowStatsGetOptions{Namespace: "default", PodName: "web-0", TrafficClass: "inter-node"},
+			expectErr: errors.NewBadRequest("traffic class cannot be selected when summarizing the flows of a workload"),
+		},
+		{
+			name:      "Invalid window",
+			statsName: "cardinality",
+			options:   &stats.FlowStatsGetOptions{Window: "-1h"},
+			expectErr: errors.NewBadRequest("invalid window \"-1h\", it should be a positive duration"),
+		},
+		{
+			name:      "Query error",
+			statsName: "cardinality",
+			options:   &stats.FlowStatsGetOptions{Window: "1s"},
+			expectErr: fmt.Errorf("error when sending cardinality query to ClickHouse: error in database"),
+		},
+		{
+			name:      "Not found",
+			statsName: "notFound",
+			options:   &stats.FlowStatsGetOptions{},
+			expectErr: errors.NewNotFound(stats.Resource("flows"), "notFound"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			querier := &fakeQuerier{}
+			r := NewREST(querier)
+			result, err := r.Get(context.TODO(), tt.statsName, tt.options)
+			if tt.expectErr == nil {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectWindow, querier.window)
+				assert.Equal(t, tt.expectTrafficClass, querier.trafficClass)
+				if tt.expectResolution != "" {
+					assert.Equal(t, tt.expectResolution, querier.resolution)
+				}
+				assert.Equal(t, tt.expectResult, result)
+				if tt.expectTopTalkers != nil {
+					assert.Equal(t, tt.expectTopTalkers, []interface{}{querier.groupBy, querier.sortBy, querier.limit})
+				}
+				if tt.expectWorkload != nil {
+					assert.Equal(t, tt.expectWorkload, append(querier.workload, querier.limit))
+				}
+			} else {
+				assert.Equal(t, tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestREST_GetExport(t *testing.T) {
+	startTime := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	endTime := time.Date(2023, 9, 1, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		options        *stats.FlowStatsGetOptions
+		expectExport   []interface{}
+		expectMIMEType string
+		expectErr      error
+	}{
+		{
+			name:           "Export with default options",
+			options:        &stats.FlowStatsGetOptions{StartTime: "2023-09-01T10:00:00Z", EndTime: "2023-09-01T11:00:00Z"},
+			expectExport:   []interface{}{startTime, endTime, "csv", 65536},
+			expectMIMEType: "text/csv",
+		},
+		{
+			name: "Export with options",
+			options: &stats.FlowStatsGetOptions{
+				StartTime: "2023-09-01T12:00:00+02:00",
+				EndTime:   "2023-09-01T11:00:00Z",
+				Format:    "parquet",
+				BatchSize: "1000",
+			},
+			expectExport:   []interface{}{startTime, endTime, "parquet", 1000},
+			expectMIMEType: "application/vnd.apache.parquet",
+		},
+		{
+			name:           "Export with gzip compression",
+			options:        &stats.FlowStatsGetOptions{StartTime: "2023-09-01T10:00:00Z", EndTime: "2023-09-01T11:00:00Z", Compression: "gzip"},
+			expectExport:   []interface{}{startTime, endTime, "csv", 65536},
+			expectMIMEType: "application/gzip",
+		},
+		{
+			name:      "Invalid compression",
+			options:   &stats.FlowStatsGetOptions{StartTime: "2023-09-01T10:00:00Z", Compression: "zstd"},
+			expectErr: errors.NewBadRequest("invalid compression \"zstd\", it should be gzip"),
+		},
+		{
+			name:      "Missing start time",
+			options:   &stats.FlowStatsGetOptions{EndTime: "2023-09-01T11:00:00Z"},
+			expectErr: errors.NewBadRequest("start time is required when exporting the flows"),
+		},
+		{
+			name:      "Invalid start time",
+			options:   &stats.FlowStatsGetOptions{StartTime: "2023-09-01 10:00:00"},
+			expectErr: errors.NewBadRequest("invalid start time \"2023-09-01 10:00:00\", it should be in RFC 3339 format"),
+		},
+		{
+			name:      "End time before start time",
+			options:   &stats.FlowStatsGetOptions{StartTime: "2023-09-01T11:00:00Z", EndTime: "2023-09-01T10:00:00Z"},
+			expectErr: errors.NewBadRequest("end time should be after start time"),
+		},
+		{
+			name:      "Invalid format",
+			options:   &stats.FlowStatsGetOptions{StartTime: "2023-09-01T10:00:00Z", Format: "json"},
+			expectErr: errors.NewBadRequest("invalid format \"json\", it should be one of csv, parquet"),
+		},
+		{
+			name:      "Invalid batch size",
+			options:   &stats.FlowStatsGetOptions{StartTime: "2023-09-01T10:00:00Z", BatchSize: "0"},
+			expectErr: errors.NewBadRequest("invalid batch size \"0\", it should be an integer between 1 and 1048576"),
+		},
+		{
+			name:      "Traffic class",
+			options:   &stats.FlowStatsGetOptions{StartTime: "2023-09-01T10:00:00Z", TrafficClass: "inter-node"},
+			expectErr: errors.NewBadRequest("traffic class cannot be selected when exporting the flows"),
+		},
+		{
+			name:      "Query error",
+			options:   &stats.FlowStatsGetOptions{StartTime: "2023-09-01T10:00:00Z", BatchSize: "1"},
+			expectErr: fmt.Errorf("error when sending export query to ClickHouse: error in database"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			querier := &fakeQuerier{}
+			r := NewREST(querier)
+			result, err := r.Get(context.TODO(), "export", tt.options)
+			if tt.expectErr != nil {
+				assert.Equal(t, tt.expectErr, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectExport, querier.export)
+			stream, ok := result.(rest.ResourceStreamer)
+			assert.True(t, ok)
+			reader, flush, mimeType, err := stream.InputStream(context.TODO(), "", "")
+			assert.NoError(t, err)
+			assert.True(t, flush)
+			assert.Equal(t, tt.expectMIMEType, mimeType)
+			defer reader.Close()
+			if mimeType == "application/gzip" {
+				reader, err = gzip.NewReader(reader)
+				assert.NoError(t, err)
+			}
+			data, _ := io.ReadAll(reader)
+			assert.Equal(t, "flowStartSeconds,flowEndSeconds\n", string(data))
+		})
+	}
+}
+
+func (c *fakeQuerier) GetDiskInfo(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetTableInfo(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetInsertRate(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetStackTrace(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetRetentionHistory(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetSystemMetrics(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetSchemaVersion(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetInsertRateLastHour(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetMigrationProgress(namespace string, status *stats.ClickHouseStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetFlowCardinality(namespace string, window time.Duration, trafficClass string, status *stats.FlowStats) error {
+	if window == time.Second {
+		return fmt.Errorf("error in database")
+	}
+	c.window = window
+	c.trafficClass = trafficClass
+	status.Cardinality.Pods = "10"
+	return nil
+}
+func (c *fakeQuerier) GetTrafficClasses(namespace string, window time.Duration, resolution string, status *stats.FlowStats) error {
+	c.window = window
+	c.resolution = resolution
+	status.TrafficClasses = []stats.TrafficClassStats{{TrafficClass: "inter-node", Flows: "5"}}
+	return nil
+}
+func (c *fakeQuerier) GetNodeFlows(namespace string, window time.Duration, status *stats.FlowStats) error {
+	c.window = window
+	status.Nodes = []stats.NodeFlowStats{{Name: "node-1", Flows: "5", LastFlowEnd: "2023-09-01T10:00:00Z"}}
+	return nil
+}
+func (c *fakeQuerier) GetTopTalkers(namespace string, window time.Duration, resolution, trafficClass, groupBy, sortBy string, limit int, status *stats.FlowStats) error {
+	c.window = window
+	c.trafficClass = trafficClass
+	c.resolution = resolution
+	c.groupBy = groupBy
+	c.sortBy = sortBy
+	c.limit = limit
+	status.TopTalkers = []stats.TopTalkerStats{{Source: "default/client", Destination: "default/nginx", Bytes: "1000"}}
+	return nil
+}
+func (c *fakeQuerier) GetWorkloadFlows(namespace string, window time.Duration, podNamespace, podName string, podLabels map[string]string, limit int, status *stats.FlowStats) error {
+	c.window = window
+	c.workload = []interface{}{podNamespace, podName, podLabels}
+	c.limit = limit
+	status.WorkloadFlows = []stats.WorkloadFlowStats{{Direction: "ingress", Peer: "default/client", Port: "80/TCP", Flows: "5"}}
+	return nil
+}
+func (c *fakeQuerier) GetPolicyHits(namespace string, window time.Duration, limit int, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetSecurityPosture(namespace string, window time.Duration, status *stats.FlowStats) error {
+	return nil
+}
+func (c *fakeQuerier) GetPolicyTraffic(namespace string, window time.Duration, status *stats.FlowStats) error {
+	c.window = window
+	status.PolicyTraffic = []stats.PolicyTrafficStats{{Kind: "K8sNetworkPolicy", Namespace: "default", Name: "allow-client", AllowedFlows: "5"}}
+	return nil
+}
+func (c *fakeQuerier) GetFlowIntegrity(namespace string, window time.Duration, status *stats.FlowStats) error {
+	c.window = window
+	status.Integrity = []stats.FlowIntegrityStats{{Check: "start-before-end", Checked: "100", Anomalies: "0"}}
+	return nil
+}
+func (c *fakeQuerier) ExportFlows(namespace string, startTime, endTime time.Time, format string, batchSize int) (io.ReadCloser, error) {
+	if batchSize == 1 {
+		return nil, fmt.Errorf("error in database")
+	}
+	c.export = []interface{}{startTime.UTC(), endTime.UTC(), format, batchSize}
+	return io.NopCloser(strings.NewReader("flowStartSeconds,flowEndSeconds\n")), nil
+}
+
+func (c *fakeQuerier) SetColdStorage(namespace, moveAfter string) ([]string, error) {
+	return nil, nil
+}
+
+func (c *fakeQuerier) CreateUser(namespace, name, password, role string) error {
+	return nil
+}
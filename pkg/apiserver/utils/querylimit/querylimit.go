@@ -0,0 +1,65 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querylimit
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// DefaultMaxInFlight is the maximum number of result queries sent to
+	// ClickHouse concurrently by the Theia Manager.
+	DefaultMaxInFlight = 8
+	// DefaultRetryAfterSeconds is the time clients are asked to wait before
+	// retrying a request rejected because of overload.
+	DefaultRetryAfterSeconds = 1
+)
+
+// ResultQueries is shared by the APIs returning the results of the jobs, so
+// that the load they put together on ClickHouse and on the memory of the Theia
+// Manager is bounded.
+var ResultQueries = NewLimiter(DefaultMaxInFlight, DefaultRetryAfterSeconds)
+
+// Limiter bounds the number of queries running concurrently. Requests are
+// rejected rather than queued when the limit is reached, so that the Theia
+// Manager does not buffer the results of queries waiting for their turn.
+type Limiter struct {
+	inFlight          chan struct{}
+	retryAfterSeconds int
+}
+
+// NewLimiter returns a Limiter allowing maxInFlight concurrent queries, which
+// asks the clients of rejected requests to retry after retryAfterSeconds.
+func NewLimiter(maxInFlight, retryAfterSeconds int) *Limiter {
+	return &Limiter{
+		inFlight:          make(chan struct{}, maxInFlight),
+		retryAfterSeconds: retryAfterSeconds,
+	}
+}
+
+// TryAcquire reserves a slot for a query without waiting. The returned
+// function must be called to release the slot once the query results have been
+// read. If all the slots are in use, a TooManyRequests error is returned, which
+// sets the Retry-After header of the response.
+func (l *Limiter) TryAcquire(resource string) (func(), error) {
+	select {
+	case l.inFlight <- struct{}{}:
+		return func() { <-l.inFlight }, nil
+	default:
+		return nil, errors.NewTooManyRequests(fmt.Sprintf("too many concurrent requests for %s results, please retry later", resource), l.retryAfterSeconds)
+	}
+}
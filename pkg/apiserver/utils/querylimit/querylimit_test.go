@@ -0,0 +1,44 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package querylimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(2, 3)
+	release1, err := limiter.TryAcquire("tests")
+	require.NoError(t, err)
+	release2, err := limiter.TryAcquire("tests")
+	require.NoError(t, err)
+
+	_, err = limiter.TryAcquire("tests")
+	require.Error(t, err)
+	assert.True(t, errors.IsTooManyRequests(err))
+	retryAfter, ok := errors.SuggestsClientDelay(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, retryAfter)
+
+	release1()
+	release3, err := limiter.TryAcquire("tests")
+	require.NoError(t, err)
+	release2()
+	release3()
+}
@@ -15,13 +15,21 @@
 package stats
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 
 	"antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/clickhouse/schema"
 	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/tracing"
 )
 
 const (
@@ -30,8 +38,18 @@ const (
 	// average writing rate for all tables per second
 	insertRateQuery
 	stackTraceQuery
+	// latest deletions of records by the ClickHouse monitor
+	retentionHistoryQuery
+	// current values of the key metrics of the shards
+	systemMetricsQuery
+	// current version of the data schema of the shards
+	schemaVersionQuery
+	// average writing rate of the insert queries of the last hour per second
+	insertRateLastHourQuery
 )
 
+// Sizes, rates and percentages are returned both human-readable, as by the
+// previous versions, and as raw numbers for the clients to render them.
 var queryMap = map[int]string{
 	diskQuery: `
 SELECT
@@ -40,7 +58,9 @@ SELECT
 	path as Path,
 	formatReadableSize(free_space) as Free,
 	formatReadableSize(total_space) as Total,
-	TRUNCATE((1 - free_space/total_space) * 100, 2) as Used_Percentage
+	TRUNCATE((1 - free_space/total_space) * 100, 2) as Used_Percentage,
+	free_space as FreeRaw,
+	total_space as TotalRaw
 FROM cluster('{cluster}', system.disks);`,
 	tableInfoQuery: `
 SELECT
@@ -49,15 +69,17 @@ SELECT
 	TableName,
 	TotalRows,
 	TotalBytes,
-	TotalCols
+	TotalCols,
+	TotalBytesRaw
 FROM (
 	SELECT
 		shardNum() as Shard,
 		database AS DatabaseName,
 		name AS TableName,
 		total_rows AS TotalRows,
-		formatReadableSize(total_bytes) AS TotalBytes
-	FROM cluster('{cluster}', system.tables) WHERE database = 'default'
+		formatReadableSize(total_bytes) AS TotalBytes,
+		total_bytes AS TotalBytesRaw
+	FROM cluster('{cluster}', system.tables) WHERE database = currentDatabase()
 	) as t1
 	INNER JOIN (
 		SELECT
@@ -66,7 +88,7 @@ FROM (
 			table_name as TableName,
 			COUNT(*) as TotalCols
 		FROM cluster('{cluster}', INFORMATION_SCHEMA.COLUMNS)
-		WHERE table_catalog == 'default'
+		WHERE table_catalog == currentDatabase()
 		GROUP BY table_name, table_catalog, Shard
 		) as t2
 		ON t1.DatabaseName = t2.DatabaseName and t1.TableName = t2.TableName and t1.Shard = t2.Shard`,
@@ -75,13 +97,14 @@ FROM (
 SELECT
 	sd.Shard,
 	sd.RowsPerSecond,
+	formatReadableSize(sd.BytesPerSecond),
 	sd.BytesPerSecond
 FROM (
 	SELECT
 		shardNum() as Shard,
 		(intDiv(toUInt32(date_trunc('minute', toDateTime(event_time))), 2) * 2) * 1000 as t,
 		TRUNCATE(avg(ProfileEvent_InsertedRows),0) as RowsPerSecond,
-		formatReadableSize(avg(ProfileEvent_InsertedBytes)) as BytesPerSecond,
+		toUInt64(avg(ProfileEvent_InsertedBytes)) as BytesPerSecond,
 		ROW_NUMBER() OVER(PARTITION BY shardNum() ORDER BY t DESC) rowNumber
 	FROM cluster('{cluster}', system.metric_log)
 	GROUP BY t, shardNum()
@@ -97,6 +120,374 @@ FROM cluster('{cluster}', system.stack_trace)
 GROUP BY trace_function, Shard
 ORDER BY count()
 DESC SETTINGS allow_introspection_functions=1`,
+	retentionHistoryQuery: `
+SELECT
+	shardNum() as Shard,
+	toString(timeDeleted) as TimeDeleted,
+	tableName as TableName,
+	toString(rangeStart) as RangeStart,
+	toString(rangeEnd) as RangeEnd,
+	rowCount as RowCount,
+	bytesReclaimed as BytesReclaimed,
+	reason as Reason
+FROM cluster('{cluster}', deletion_audit_local)
+ORDER BY timeDeleted DESC
+LIMIT 100`,
+	systemMetricsQuery: `
+SELECT
+	shardNum() as Shard,
+	metric as Metric,
+	toString(value) as Value
+FROM cluster('{cluster}', system.metrics)
+WHERE metric IN ('Query', 'Merge', 'PartMutation', 'ReplicatedFetch', 'ReplicatedSend', 'DelayedInserts',
+	'TCPConnection', 'HTTPConnection', 'MemoryTracking', 'ZooKeeperSession', 'ReadonlyReplica')
+ORDER BY Shard, Metric`,
+	schemaVersionQuery: `
+SELECT
+	shardNum() as Shard,
+	toString(argMax(version, sequence)) as Version,
+	toString(argMax(dirty, sequence)) as Dirty
+FROM cluster('{cluster}', currentDatabase(), schema_migrations)
+GROUP BY Shard
+ORDER BY Shard`,
+	insertRateLastHourQuery: `
+SELECT
+	shardNum() as Shard,
+	toString(TRUNCATE(SUM(written_rows) / 3600, 0)) as RowsPerSecond,
+	formatReadableSize(SUM(written_bytes) / 3600) as BytesPerSecond,
+	toString(toUInt64(SUM(written_bytes) / 3600)) as BytesPerSecondRaw
+FROM cluster('{cluster}', system.query_log)
+WHERE type = 'QueryFinish' AND query_kind = 'Insert' AND event_time >= now() - toIntervalHour(1)
+GROUP BY Shard
+ORDER BY Shard`,
+}
+
+// flowCardinalityQuery estimates the number of distinct values of the key
+// dimensions of the flows which ended during the last given number of seconds,
+// optionally of a given traffic class. Endpoints which are neither Pods nor
+// Services are counted as external IPs.
+const flowCardinalityQuery = `
+SELECT
+	count() AS Flows,
+	uniqCombinedArray(arrayFilter(x -> x != '/', [
+		concat(sourcePodNamespace, '/', sourcePodName),
+		concat(destinationPodNamespace, '/', destinationPodName)])) AS Pods,
+	uniqCombinedArray(arrayFilter(x -> x != '', [sourcePodNamespace, destinationPodNamespace])) AS Namespaces,
+	uniqCombinedIf(destinationServicePortName, destinationServicePortName != '') AS Services,
+	uniqCombinedArray(arrayFilter(x -> x != '', [
+		if(sourcePodName = '', sourceIP, ''),
+		if(destinationPodName = '' AND destinationServicePortName = '', destinationIP, '')])) AS ExternalIPs,
+	uniqCombined(destinationTransportPort, protocolIdentifier) AS Ports
+FROM flows
+WHERE flowEndSeconds >= now() - toIntervalSecond(?) AND (? = '' OR trafficClass = ?)`
+
+// trafficClassesQuery counts the flow records and the bytes of every traffic
+// class of the flows which ended during the last given number of seconds.
+const trafficClassesQuery = `
+SELECT
+	trafficClass AS TrafficClass,
+	count() AS Flows,
+	SUM(octetDeltaCount + reverseOctetDeltaCount) AS Bytes
+FROM flows
+WHERE flowEndSeconds >= now() - toIntervalSecond(?)
+GROUP BY TrafficClass
+ORDER BY Flows DESC`
+
+// trafficClassesRollupQuery is trafficClassesQuery on a rollup of the flow
+// records. The rollup table and the function computing its time buckets are
+// formatted into the query from rollups. The first time bucket of the window
+// is selected as a whole.
+const trafficClassesRollupQuery = `
+SELECT
+	trafficClass AS TrafficClass,
+	SUM(records) AS Flows,
+	SUM(octetDeltaCount + reverseOctetDeltaCount) AS Bytes
+FROM %s
+WHERE timeBucket >= %s(now() - toIntervalSecond(?))
+GROUP BY TrafficClass
+ORDER BY Flows DESC`
+
+// nodeFlowsQuery counts the flow records of every Node, as the source or the
+// destination Node of the flows which ended during the last given number of
+// seconds, and gets the end time of their last flow.
+const nodeFlowsQuery = `
+SELECT
+	node AS Node,
+	count() AS Flows,
+	max(flowEndSeconds) AS LastFlowEnd
+FROM flows
+ARRAY JOIN arrayDistinct(arrayFilter(x -> x != '', [sourceNodeName, destinationNodeName])) AS node
+WHERE flowEndSeconds >= now() - toIntervalSecond(?)
+GROUP BY Node
+ORDER BY Node`
+
+// topTalkersQuery sums the traffic of the flows which ended during the last
+// given number of seconds, optionally of a given traffic class, by source and
+// destination, and keeps the pairs with the most traffic. The expressions of
+// the source and the destination, and the sort column, are formatted into the
+// query from topTalkersEndpoints and topTalkersSortColumns.
+const topTalkersQuery = `
+SELECT
+	%s AS Source,
+	%s AS Destination,
+	count() AS Flows,
+	SUM(octetDeltaCount) AS Bytes,
+	SUM(packetDeltaCount) AS Packets,
+	SUM(reverseOctetDeltaCount) AS ReverseBytes,
+	SUM(reversePacketDeltaCount) AS ReversePackets,
+	round((Bytes + ReverseBytes) / ?, 2) AS Throughput
+FROM flows
+WHERE flowEndSeconds >= now() - toIntervalSecond(?) AND (? = '' OR trafficClass = ?)
+GROUP BY Source, Destination
+ORDER BY %s DESC, Source, Destination
+LIMIT ?`
+
+// topTalkersRollupQuery is topTalkersQuery on a rollup of the flow records.
+// The rollup table and the function computing its time buckets are formatted
+// into the query from rollups, after the source and the destination.
+const topTalkersRollupQuery = `
+SELECT
+	%s AS Source,
+	%s AS Destination,
+	SUM(records) AS Flows,
+	SUM(octetDeltaCount) AS Bytes,
+	SUM(packetDeltaCount) AS Packets,
+	SUM(reverseOctetDeltaCount) AS ReverseBytes,
+	SUM(reversePacketDeltaCount) AS ReversePackets,
+	round((Bytes + ReverseBytes) / ?, 2) AS Throughput
+FROM %s
+WHERE timeBucket >= %s(now() - toIntervalSecond(?)) AND (? = '' OR trafficClass = ?)
+GROUP BY Source, Destination
+ORDER BY %s DESC, Source, Destination
+LIMIT ?`
+
+// rollups are the tables of the rollups of the flow records, and the functions
+// computing their time buckets, by resolution.
+var rollups = map[string][2]string{
+	v1alpha1.FlowResolution1m: {"flows_rollup_1m", "toStartOfMinute"},
+	v1alpha1.FlowResolution1h: {"flows_rollup_1h", "toStartOfHour"},
+}
+
+// selectResolution returns the resolution of the flow records from which the
+// statistics over window are computed. The auto resolution selects the
+// coarsest resolution which still has at least 60 time buckets in the window.
+func selectResolution(resolution string, window time.Duration) (string, error) {
+	switch resolution {
+	case v1alpha1.FlowResolutionRaw, v1alpha1.FlowResolution1m, v1alpha1.FlowResolution1h:
+		return resolution, nil
+	case "", v1alpha1.FlowResolutionAuto:
+		switch {
+		case window < time.Hour:
+			return v1alpha1.FlowResolutionRaw, nil
+		case window < 60*time.Hour:
+			return v1alpha1.FlowResolution1m, nil
+		default:
+			return v1alpha1.FlowResolution1h, nil
+		}
+	}
+	return "", fmt.Errorf("unknown resolution %q", resolution)
+}
+
+// topTalkersEndpoints are the expressions of the source and the destination of
+// top talkers, by grouping. Endpoints which are not Pods are identified by
+// their Service or IP.
+var topTalkersEndpoints = map[string][2]string{
+	v1alpha1.TopTalkersGroupByPods: {
+		"if(sourcePodName != '', concat(sourcePodNamespace, '/', sourcePodName), sourceIP)",
+		"if(destinationPodName != '', concat(destinationPodNamespace, '/', destinationPodName), if(destinationServicePortName != '', destinationServicePortName, destinationIP))",
+	},
+	v1alpha1.TopTalkersGroupByNamespaces: {
+		"if(sourcePodNamespace != '', sourcePodNamespace, sourceIP)",
+		"if(destinationPodNamespace != '', destinationPodNamespace, if(destinationServicePortName != '', destinationServicePortName, destinationIP))",
+	},
+}
+
+// topTalkersSortColumns are the columns of topTalkersQuery, by sort key.
+var topTalkersSortColumns = map[string]string{
+	v1alpha1.TopTalkersSortByBytes:          "Bytes",
+	v1alpha1.TopTalkersSortByPackets:        "Packets",
+	v1alpha1.TopTalkersSortByReverseBytes:   "ReverseBytes",
+	v1alpha1.TopTalkersSortByReversePackets: "ReversePackets",
+}
+
+// workloadFlowsQuery sums the traffic of the flows which ended during the last
+// given number of seconds between the selected Pods and their peers, in one
+// direction, by peer, port and NetworkPolicies, and keeps the peers and ports
+// with the most traffic. The direction, the expressions of the peer and of the
+// bytes sent and received by the selected Pods, and the conditions selecting
+// the Pods are formatted into the query from workloadFlowsColumns and
+// workloadPodConditions.
+const workloadFlowsQuery = `
+SELECT
+	'%s' AS Direction,
+	%s AS Peer,
+	concat(toString(destinationTransportPort), '/', multiIf(protocolIdentifier = 6, 'TCP', protocolIdentifier = 17, 'UDP', protocolIdentifier = 132, 'SCTP', toString(protocolIdentifier))) AS Port,
+	count() AS Flows,
+	SUM(%s) AS BytesSent,
+	SUM(%s) AS BytesReceived,
+	if(ingressNetworkPolicyName != '', concat(if(ingressNetworkPolicyNamespace != '', concat(ingressNetworkPolicyNamespace, '/'), ''), ingressNetworkPolicyName, ' (', multiIf(ingressNetworkPolicyRuleAction = 2, 'Drop', ingressNetworkPolicyRuleAction = 3, 'Reject', 'Allow'), ')'), '') AS IngressPolicy,
+	if(egressNetworkPolicyName != '', concat(if(egressNetworkPolicyNamespace != '', concat(egressNetworkPolicyNamespace, '/'), ''), egressNetworkPolicyName, ' (', multiIf(egressNetworkPolicyRuleAction = 2, 'Drop', egressNetworkPolicyRuleAction = 3, 'Reject', 'Allow'), ')'), '') AS EgressPolicy
+FROM flows
+WHERE flowEndSeconds >= now() - toIntervalSecond(?) AND %s
+GROUP BY Peer, Port, IngressPolicy, EgressPolicy
+ORDER BY BytesSent + BytesReceived DESC, Peer, Port
+LIMIT ?`
+
+// workloadFlowsColumns are the prefix of the columns of the selected Pods, and
+// the expressions of the peer and of the bytes sent and received by the
+// selected Pods, by direction.
+var workloadFlowsColumns = map[string][4]string{
+	v1alpha1.WorkloadFlowDirectionIngress: {
+		"destination",
+		topTalkersEndpoints[v1alpha1.TopTalkersGroupByPods][0],
+		"reverseOctetDeltaCount",
+		"octetDeltaCount",
+	},
+	v1alpha1.WorkloadFlowDirectionEgress: {
+		"source",
+		topTalkersEndpoints[v1alpha1.TopTalkersGroupByPods][1],
+		"octetDeltaCount",
+		"reverseOctetDeltaCount",
+	},
+}
+
+// policyHitsQuery counts the flow records and the bytes of the flows which
+// ended during the last given number of seconds by the NetworkPolicy rule
+// applied to them in each direction, and keeps the rules applied to the most
+// flows.
+const policyHitsQuery = `
+SELECT
+	policy.1 AS Direction,
+	concat(if(policy.2 != '', concat(policy.2, '/'), ''), policy.3) AS Policy,
+	multiIf(policy.4 = 2, 'Drop', policy.4 = 3, 'Reject', 'Allow') AS Action,
+	count() AS Flows,
+	SUM(octetDeltaCount + reverseOctetDeltaCount) AS Bytes
+FROM flows
+ARRAY JOIN [
+	tuple('ingress', ingressNetworkPolicyNamespace, ingressNetworkPolicyName, ingressNetworkPolicyRuleAction),
+	tuple('egress', egressNetworkPolicyNamespace, egressNetworkPolicyName, egressNetworkPolicyRuleAction)] AS policy
+WHERE flowEndSeconds >= now() - toIntervalSecond(?) AND policy.3 != ''
+GROUP BY Direction, Policy, Action
+ORDER BY Flows DESC, Direction, Policy, Action
+LIMIT ?`
+
+// securityPostureQuery counts, for every Namespace, the flows which ended
+// during the last given number of seconds, the ones to which no NetworkPolicy
+// was applied in either direction and the ones which were dropped or
+// rejected. The flows are counted once, from their latest state, in the
+// Namespace of their source Pod, or of their destination Pod if the source is
+// not a Pod.
+const securityPostureQuery = `
+SELECT
+	if(sourcePodNamespace != '', sourcePodNamespace, destinationPodNamespace) AS Namespace,
+	count() AS Flows,
+	countIf(ingressNetworkPolicyName = '' AND egressNetworkPolicyName = '') AS UnprotectedFlows,
+	countIf(ingressNetworkPolicyRuleAction IN (2, 3) OR egressNetworkPolicyRuleAction IN (2, 3)) AS DeniedFlows
+FROM flows_latest
+WHERE flowEndSeconds >= now() - toIntervalSecond(?) AND Namespace != ''
+GROUP BY Namespace
+ORDER BY Namespace`
+
+// policyTrafficQuery counts, for every NetworkPolicy, the flows which ended
+// during the last given number of seconds and which were allowed, or dropped
+// or rejected, by its rules in either direction, with their total bytes, and
+// gets the end time of its last flow. The flows are counted once, from their
+// latest state, so that the bytes of the flows updated by several flow
+// records are not summed more than once.
+const policyTrafficQuery = `
+SELECT
+	multiIf(policy.1 = 1, 'K8sNetworkPolicy', policy.1 = 2, 'AntreaNetworkPolicy', policy.1 = 3, 'AntreaClusterNetworkPolicy', 'Unknown') AS Kind,
+	policy.2 AS Namespace,
+	policy.3 AS Name,
+	countIf(policy.4 NOT IN (2, 3)) AS AllowedFlows,
+	sumIf(octetTotalCount + reverseOctetTotalCount, policy.4 NOT IN (2, 3)) AS AllowedBytes,
+	countIf(policy.4 IN (2, 3)) AS DeniedFlows,
+	sumIf(octetTotalCount + reverseOctetTotalCount, policy.4 IN (2, 3)) AS DeniedBytes,
+	max(flowEndSeconds) AS LastFlowEnd
+FROM flows_latest
+ARRAY JOIN [
+	tuple(ingressNetworkPolicyType, ingressNetworkPolicyNamespace, ingressNetworkPolicyName, ingressNetworkPolicyRuleAction),
+	tuple(egressNetworkPolicyType, egressNetworkPolicyNamespace, egressNetworkPolicyName, egressNetworkPolicyRuleAction)] AS policy
+WHERE flowEndSeconds >= now() - toIntervalSecond(?) AND policy.3 != ''
+GROUP BY Kind, Namespace, Name
+ORDER BY AllowedFlows + DeniedFlows DESC, Kind, Namespace, Name`
+
+// flowRecordsIntegrityQuery counts the flow records of the flows which ended
+// during the last given number of seconds, the ones whose start time is after
+// their end time, and the records of inter-node flows and the ones missing
+// their source or destination Pod.
+const flowRecordsIntegrityQuery = `
+SELECT
+	count() AS Records,
+	countIf(flowStartSeconds > flowEndSeconds) AS StartAfterEnd,
+	countIf(flowType = 2) AS InterNodeRecords,
+	countIf(flowType = 2 AND (sourcePodName = '' OR destinationPodName = '')) AS Uncorrelated
+FROM flows
+WHERE flowEndSeconds >= now() - toIntervalSecond(?)`
+
+// flowBytesIntegrityQuery counts the flows which ended during the last given
+// number of seconds with several records, and the ones whose total byte
+// counts in either direction decreased from one record to the next, in the
+// order of their end time.
+const flowBytesIntegrityQuery = `
+SELECT
+	count() AS Flows,
+	countIf(NOT (arrayAll((x, y) -> x <= y, arrayPopBack(octets), arrayPopFront(octets))
+		AND arrayAll((x, y) -> x <= y, arrayPopBack(reverseOctets), arrayPopFront(reverseOctets)))) AS Decreasing
+FROM (
+	SELECT
+		arraySort(groupArray((flowEndSeconds, octetTotalCount, reverseOctetTotalCount))) AS records,
+		arrayMap(record -> record.2, records) AS octets,
+		arrayMap(record -> record.3, records) AS reverseOctets
+	FROM flows
+	WHERE flowEndSeconds >= now() - toIntervalSecond(?)
+	GROUP BY sourceIP, destinationIP, sourceTransportPort, destinationTransportPort, protocolIdentifier, flowStartSeconds
+	HAVING count() > 1
+)`
+
+// flowExportQuery selects the flow records which ended in [startTime,
+// endTime), given as Unix timestamps. It is sent through the HTTP interface
+// of ClickHouse, which encodes the records in the format formatted into the
+// query from flowExportFormats.
+const flowExportQuery = `
+SELECT *
+FROM flows
+WHERE flowEndSeconds >= toDateTime({startTime:UInt32}) AND flowEndSeconds < toDateTime({endTime:UInt32})
+FORMAT %s`
+
+// flowExportFormats are the ClickHouse formats of the exported flow records,
+// by export format.
+var flowExportFormats = map[string]string{
+	v1alpha1.FlowExportFormatCSV:     "CSVWithNames",
+	v1alpha1.FlowExportFormatParquet: "Parquet",
+}
+
+// The storage policy and the volume to which the flow records are moved,
+// defined when clickhouse.storage.coldStorage is enabled in the Helm values.
+const (
+	tieredStoragePolicy = "tiered"
+	coldVolume          = "cold"
+)
+
+// coldVolumeQuery checks that the cold volume of the tiered storage policy is
+// defined by the ClickHouse server.
+const coldVolumeQuery = "SELECT count() FROM system.storage_policies WHERE policy_name = ? AND volume_name = ?"
+
+// The DDL statements setting the storage policy and the TTL rules of a local
+// table on all the shards and replicas.
+const (
+	setStoragePolicyQuery = "ALTER TABLE %s ON CLUSTER '{cluster}' MODIFY SETTING storage_policy = '%s'"
+	setTTLQuery           = "ALTER TABLE %s ON CLUSTER '{cluster}' MODIFY TTL %s"
+)
+
+// coldStorageTables are the local tables whose records are deleted after the
+// TTL of clickhouse.ttl, and which can be moved to the cold volume before.
+var coldStorageTables = []string{
+	"flows_local",
+	"pod_view_table_local",
+	"node_view_table_local",
+	"policy_view_table_local",
+	"flows_latest_records_local",
 }
 
 type ClickHouseStatQuerierImpl struct {
@@ -116,7 +507,7 @@ func NewClickHouseStatQuerierImpl(
 func (c *ClickHouseStatQuerierImpl) GetDiskInfo(namespace string, stats *v1alpha1.ClickHouseStats) error {
 	err := c.getDataFromClickHouse(diskQuery, namespace, stats)
 	if err != nil {
-		return fmt.Errorf("error when getting diskInfo from clickhouse: %v", err)
+		return fmt.Errorf("error when getting diskInfo from clickhouse: %v", clickhouse.ClassifyError(err))
 	}
 	return nil
 }
@@ -124,7 +515,7 @@ func (c *ClickHouseStatQuerierImpl) GetDiskInfo(namespace string, stats *v1alpha
 func (c *ClickHouseStatQuerierImpl) GetTableInfo(namespace string, stats *v1alpha1.ClickHouseStats) error {
 	err := c.getDataFromClickHouse(tableInfoQuery, namespace, stats)
 	if err != nil {
-		return fmt.Errorf("error when getting tableInfo from clickhouse: %v", err)
+		return fmt.Errorf("error when getting tableInfo from clickhouse: %v", clickhouse.ClassifyError(err))
 	}
 	return nil
 }
@@ -132,7 +523,7 @@ func (c *ClickHouseStatQuerierImpl) GetTableInfo(namespace string, stats *v1alph
 func (c *ClickHouseStatQuerierImpl) GetInsertRate(namespace string, stats *v1alpha1.ClickHouseStats) error {
 	err := c.getDataFromClickHouse(insertRateQuery, namespace, stats)
 	if err != nil {
-		return fmt.Errorf("error when getting insertRate from clickhouse: %v", err)
+		return fmt.Errorf("error when getting insertRate from clickhouse: %v", clickhouse.ClassifyError(err))
 	}
 	return nil
 }
@@ -140,7 +531,550 @@ func (c *ClickHouseStatQuerierImpl) GetInsertRate(namespace string, stats *v1alp
 func (c *ClickHouseStatQuerierImpl) GetStackTrace(namespace string, stats *v1alpha1.ClickHouseStats) error {
 	err := c.getDataFromClickHouse(stackTraceQuery, namespace, stats)
 	if err != nil {
-		return fmt.Errorf("error when getting stackTrace from clickhouse: %v", err)
+		return fmt.Errorf("error when getting stackTrace from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetRetentionHistory(namespace string, stats *v1alpha1.ClickHouseStats) error {
+	err := c.getDataFromClickHouse(retentionHistoryQuery, namespace, stats)
+	if err != nil {
+		return fmt.Errorf("error when getting retentionHistory from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetSystemMetrics(namespace string, stats *v1alpha1.ClickHouseStats) error {
+	err := c.getDataFromClickHouse(systemMetricsQuery, namespace, stats)
+	if err != nil {
+		return fmt.Errorf("error when getting systemMetrics from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetSchemaVersion(namespace string, stats *v1alpha1.ClickHouseStats) error {
+	err := c.getDataFromClickHouse(schemaVersionQuery, namespace, stats)
+	if err != nil {
+		return fmt.Errorf("error when getting schemaVersion from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetInsertRateLastHour(namespace string, stats *v1alpha1.ClickHouseStats) error {
+	err := c.getDataFromClickHouse(insertRateLastHourQuery, namespace, stats)
+	if err != nil {
+		return fmt.Errorf("error when getting insertRateLastHour from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	return nil
+}
+
+// migrationProgressTableQuery checks whether the migration_progress table
+// exists. It is created by the first migration which rewrites or copies
+// tables, on all the servers of the cluster.
+const migrationProgressTableQuery = "SELECT count() FROM system.tables WHERE database = currentDatabase() AND name = 'migration_progress'"
+
+// migrationProgressQuery gets the latest progress of the mutations and of the
+// copies between tables of the latest migration, which is recorded by the
+// first replica of the cluster.
+const migrationProgressQuery = `
+SELECT
+	toString(fromVersion) as FromVersion,
+	toString(toVersion) as ToVersion,
+	tableName as TableName,
+	operation as Operation,
+	toString(argMax(done, timeUpdated)) as Done,
+	toString(argMax(total, timeUpdated)) as Total,
+	toString(argMax(etaSeconds, timeUpdated)) as ETASeconds,
+	toString(max(timeUpdated)) as TimeUpdated
+FROM cluster('{cluster}', migration_progress)
+WHERE timeStarted = (SELECT max(timeStarted) FROM cluster('{cluster}', migration_progress))
+GROUP BY fromVersion, toVersion, tableName, operation, id
+ORDER BY min(timeUpdated), tableName`
+
+// GetMigrationProgress gets the progress of the mutations and of the copies
+// between tables of the latest data schema migration. There is no progress if
+// no migration rewrote or copied tables yet.
+func (c *ClickHouseStatQuerierImpl) GetMigrationProgress(namespace string, stats *v1alpha1.ClickHouseStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	var tables int
+	if err := c.clickhouseConnect.QueryRow(migrationProgressTableQuery).Scan(&tables); err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when checking the migration_progress table: %v", clickhouse.ClassifyError(err))
+	}
+	if tables == 0 {
+		return nil
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", migrationProgressQuery)
+	result, err := c.clickhouseConnect.Query(migrationProgressQuery)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting migration progress from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	defer result.Close()
+	for result.Next() {
+		var res v1alpha1.MigrationProgress
+		if err := result.Scan(&res.FromVersion, &res.ToVersion, &res.TableName, &res.Operation, &res.Done, &res.Total, &res.ETASeconds, &res.TimeUpdated); err != nil {
+			return fmt.Errorf("failed to parse the data returned by database: %v", err)
+		}
+		stats.MigrationProgress = append(stats.MigrationProgress, res)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("error when getting migration progress from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetFlowCardinality(namespace string, window time.Duration, trafficClass string, stats *v1alpha1.FlowStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	cardinality := &stats.Cardinality
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", flowCardinalityQuery)
+	err = c.clickhouseConnect.QueryRow(flowCardinalityQuery, int64(window.Seconds()), trafficClass, trafficClass).Scan(
+		&cardinality.Flows, &cardinality.Pods, &cardinality.Namespaces, &cardinality.Services, &cardinality.ExternalIPs, &cardinality.Ports)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting flow cardinality from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Window = window.String()
+	stats.TrafficClass = trafficClass
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetTrafficClasses(namespace string, window time.Duration, resolution string, stats *v1alpha1.FlowStats) error {
+	resolution, err := selectResolution(resolution, window)
+	if err != nil {
+		return err
+	}
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	query := trafficClassesQuery
+	if rollup, ok := rollups[resolution]; ok {
+		query = fmt.Sprintf(trafficClassesRollupQuery, rollup[0], rollup[1])
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+	result, err := c.clickhouseConnect.Query(query, int64(window.Seconds()))
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting traffic classes from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	defer result.Close()
+	for result.Next() {
+		var res v1alpha1.TrafficClassStats
+		if err := result.Scan(&res.TrafficClass, &res.Flows, &res.Bytes); err != nil {
+			return fmt.Errorf("failed to parse the data returned by database: %v", err)
+		}
+		stats.TrafficClasses = append(stats.TrafficClasses, res)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("error when getting traffic classes from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Window = window.String()
+	stats.Resolution = resolution
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetNodeFlows(namespace string, window time.Duration, stats *v1alpha1.FlowStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", nodeFlowsQuery)
+	result, err := c.clickhouseConnect.Query(nodeFlowsQuery, int64(window.Seconds()))
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting node flows from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	defer result.Close()
+	for result.Next() {
+		var res v1alpha1.NodeFlowStats
+		var lastFlowEnd time.Time
+		if err := result.Scan(&res.Name, &res.Flows, &lastFlowEnd); err != nil {
+			return fmt.Errorf("failed to parse the data returned by database: %v", err)
+		}
+		res.LastFlowEnd = lastFlowEnd.UTC().Format(time.RFC3339)
+		stats.Nodes = append(stats.Nodes, res)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("error when getting node flows from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Window = window.String()
+	return nil
+}
+
+func (c *ClickHouseStatQuerierImpl) GetTopTalkers(namespace string, window time.Duration, resolution, trafficClass, groupBy, sortBy string, limit int, stats *v1alpha1.FlowStats) error {
+	endpoints, ok := topTalkersEndpoints[groupBy]
+	if !ok {
+		return fmt.Errorf("unknown grouping of top talkers %q", groupBy)
+	}
+	sortColumn, ok := topTalkersSortColumns[sortBy]
+	if !ok {
+		return fmt.Errorf("unknown sort key of top talkers %q", sortBy)
+	}
+	resolution, err := selectResolution(resolution, window)
+	if err != nil {
+		return err
+	}
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	query := fmt.Sprintf(topTalkersQuery, endpoints[0], endpoints[1], sortColumn)
+	if rollup, ok := rollups[resolution]; ok {
+		query = fmt.Sprintf(topTalkersRollupQuery, endpoints[0], endpoints[1], rollup[0], rollup[1], sortColumn)
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+	result, err := c.clickhouseConnect.Query(query, window.Seconds(), int64(window.Seconds()), trafficClass, trafficClass, limit)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting top talkers from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	defer result.Close()
+	for result.Next() {
+		var res v1alpha1.TopTalkerStats
+		if err := result.Scan(&res.Source, &res.Destination, &res.Flows, &res.Bytes, &res.Packets, &res.ReverseBytes, &res.ReversePackets, &res.Throughput); err != nil {
+			return fmt.Errorf("failed to parse the data returned by database: %v", err)
+		}
+		stats.TopTalkers = append(stats.TopTalkers, res)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("error when getting top talkers from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Window = window.String()
+	stats.TrafficClass = trafficClass
+	stats.Resolution = resolution
+	return nil
+}
+
+// GetWorkloadFlows summarizes the ingress and egress traffic of the Pods of
+// podNamespace selected by name, or by the labels recorded in the flows, so
+// that the Pods which do not exist anymore are also selected. At most limit
+// peers and ports are kept per direction.
+func (c *ClickHouseStatQuerierImpl) GetWorkloadFlows(namespace string, window time.Duration, podNamespace, podName string, podLabels map[string]string, limit int, stats *v1alpha1.FlowStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	for _, direction := range []string{v1alpha1.WorkloadFlowDirectionIngress, v1alpha1.WorkloadFlowDirectionEgress} {
+		columns := workloadFlowsColumns[direction]
+		conditions, args := workloadPodConditions(columns[0], podNamespace, podName, podLabels)
+		query := fmt.Sprintf(workloadFlowsQuery, direction, columns[1], columns[2], columns[3], conditions)
+		args = append([]interface{}{int64(window.Seconds())}, append(args, limit)...)
+		_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+		result, err := c.clickhouseConnect.Query(query, args...)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			c.clickhouseConnect = nil
+			return fmt.Errorf("error when getting %s workload flows from clickhouse: %v", direction, err)
+		}
+		defer result.Close()
+		for result.Next() {
+			var res v1alpha1.WorkloadFlowStats
+			if err := result.Scan(&res.Direction, &res.Peer, &res.Port, &res.Flows, &res.BytesSent, &res.BytesReceived, &res.IngressPolicy, &res.EgressPolicy); err != nil {
+				return fmt.Errorf("failed to parse the data returned by database: %v", err)
+			}
+			stats.WorkloadFlows = append(stats.WorkloadFlows, res)
+		}
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("error when getting %s workload flows from clickhouse: %v", direction, err)
+		}
+	}
+	stats.Window = window.String()
+	return nil
+}
+
+// GetPolicyHits gets the NetworkPolicy rules applied to the most flows which
+// ended during the window, at most limit of them.
+func (c *ClickHouseStatQuerierImpl) GetPolicyHits(namespace string, window time.Duration, limit int, stats *v1alpha1.FlowStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", policyHitsQuery)
+	result, err := c.clickhouseConnect.Query(policyHitsQuery, int64(window.Seconds()), limit)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting policy hits from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	defer result.Close()
+	for result.Next() {
+		var res v1alpha1.PolicyHitStats
+		if err := result.Scan(&res.Direction, &res.Policy, &res.Action, &res.Flows, &res.Bytes); err != nil {
+			return fmt.Errorf("failed to parse the data returned by database: %v", err)
+		}
+		stats.PolicyHits = append(stats.PolicyHits, res)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("error when getting policy hits from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Window = window.String()
+	return nil
+}
+
+// GetSecurityPosture gets, for every Namespace, the number of flows which
+// ended during the window, and the numbers of them which were not protected
+// by any NetworkPolicy and which were denied.
+func (c *ClickHouseStatQuerierImpl) GetSecurityPosture(namespace string, window time.Duration, stats *v1alpha1.FlowStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", securityPostureQuery)
+	result, err := c.clickhouseConnect.Query(securityPostureQuery, int64(window.Seconds()))
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting security posture from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	defer result.Close()
+	for result.Next() {
+		var res v1alpha1.NamespacePostureStats
+		if err := result.Scan(&res.Namespace, &res.Flows, &res.UnprotectedFlows, &res.DeniedFlows); err != nil {
+			return fmt.Errorf("failed to parse the data returned by database: %v", err)
+		}
+		stats.Posture = append(stats.Posture, res)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("error when getting security posture from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Window = window.String()
+	return nil
+}
+
+// GetPolicyTraffic gets, for every NetworkPolicy applied to flows which ended
+// during the window, the traffic allowed and denied by its rules.
+func (c *ClickHouseStatQuerierImpl) GetPolicyTraffic(namespace string, window time.Duration, stats *v1alpha1.FlowStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", policyTrafficQuery)
+	result, err := c.clickhouseConnect.Query(policyTrafficQuery, int64(window.Seconds()))
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when getting policy traffic from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	defer result.Close()
+	for result.Next() {
+		var res v1alpha1.PolicyTrafficStats
+		var lastFlowEnd time.Time
+		if err := result.Scan(&res.Kind, &res.Namespace, &res.Name, &res.AllowedFlows, &res.AllowedBytes, &res.DeniedFlows, &res.DeniedBytes, &lastFlowEnd); err != nil {
+			return fmt.Errorf("failed to parse the data returned by database: %v", err)
+		}
+		res.LastFlowEnd = lastFlowEnd.UTC().Format(time.RFC3339)
+		stats.PolicyTraffic = append(stats.PolicyTraffic, res)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("error when getting policy traffic from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Window = window.String()
+	return nil
+}
+
+// GetFlowIntegrity runs consistency checks on the flow records of the flows
+// which ended during the window, and counts the records, or the flows, which
+// failed them.
+func (c *ClickHouseStatQuerierImpl) GetFlowIntegrity(namespace string, window time.Duration, stats *v1alpha1.FlowStats) error {
+	var err error
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	var records, startAfterEnd, interNodeRecords, uncorrelated string
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", flowRecordsIntegrityQuery)
+	err = c.clickhouseConnect.QueryRow(flowRecordsIntegrityQuery, int64(window.Seconds())).Scan(&records, &startAfterEnd, &interNodeRecords, &uncorrelated)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when checking the flow records in clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	var flows, decreasing string
+	_, span = tracing.StartClickHouseSpan(context.TODO(), "query", flowBytesIntegrityQuery)
+	err = c.clickhouseConnect.QueryRow(flowBytesIntegrityQuery, int64(window.Seconds())).Scan(&flows, &decreasing)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		c.clickhouseConnect = nil
+		return fmt.Errorf("error when checking the byte counts of the flows in clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	stats.Integrity = []v1alpha1.FlowIntegrityStats{
+		{Check: v1alpha1.FlowIntegrityCheckMonotonicBytes, Checked: flows, Anomalies: decreasing},
+		{Check: v1alpha1.FlowIntegrityCheckStartBeforeEnd, Checked: records, Anomalies: startAfterEnd},
+		{Check: v1alpha1.FlowIntegrityCheckInterNodeCorrelation, Checked: interNodeRecords, Anomalies: uncorrelated},
+	}
+	stats.Window = window.String()
+	return nil
+}
+
+// workloadPodConditions returns the conditions of workloadFlowsQuery selecting
+// the Pods of podNamespace by name or by labels, on the columns with the given
+// prefix, and their arguments. The labels are sorted by key so that the query
+// is stable.
+func workloadPodConditions(prefix, podNamespace, podName string, podLabels map[string]string) (string, []interface{}) {
+	conditions := []string{prefix + "PodNamespace = ?"}
+	args := []interface{}{podNamespace}
+	if podName != "" {
+		conditions = append(conditions, prefix+"PodName = ?")
+		args = append(args, podName)
+	}
+	keys := make([]string, 0, len(podLabels))
+	for key := range podLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("JSONExtractString(%sPodLabels, ?) = ?", prefix))
+		args = append(args, key, podLabels[key])
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// ExportFlows returns the stream of the flow records which ended in
+// [startTime, endTime), encoded in the given format. ClickHouse reads and
+// sends the records in blocks of batchSize rows, so that they are not all
+// held in memory.
+func (c *ClickHouseStatQuerierImpl) ExportFlows(namespace string, startTime, endTime time.Time, format string, batchSize int) (io.ReadCloser, error) {
+	clickHouseFormat, ok := flowExportFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	query := fmt.Sprintf(flowExportQuery, clickHouseFormat)
+	params := map[string]string{
+		"startTime": strconv.FormatInt(startTime.Unix(), 10),
+		"endTime":   strconv.FormatInt(endTime.Unix(), 10),
+	}
+	settings := map[string]string{
+		"max_block_size": strconv.Itoa(batchSize),
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+	stream, err := clickhouse.StreamQuery(context.TODO(), c.kubeClient, query, params, settings)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("error when exporting flows from clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	return stream, nil
+}
+
+// SetColdStorage sets the TTL rules of the flow tables, so that their records
+// are moved to the cold volume once they are older than moveAfter, and are
+// deleted after the TTL of the flow records. If moveAfter is empty, the
+// records are only moved by the storage policy when the hot volume is almost
+// full. It returns the tables whose TTL rules were set.
+func (c *ClickHouseStatQuerierImpl) SetColdStorage(namespace, moveAfter string) ([]string, error) {
+	if moveAfter != "" {
+		if err := clickhouse.ValidateInterval(moveAfter); err != nil {
+			return nil, err
+		}
+	}
+	ttl, err := clickhouse.GetTTL()
+	if err != nil {
+		return nil, err
+	}
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var volumes int
+	if err := c.clickhouseConnect.QueryRow(coldVolumeQuery, tieredStoragePolicy, coldVolume).Scan(&volumes); err != nil {
+		c.clickhouseConnect = nil
+		return nil, fmt.Errorf("error when getting the storage policies of clickhouse: %v", clickhouse.ClassifyError(err))
+	}
+	if volumes == 0 {
+		return nil, fmt.Errorf("storage policy %s has no %s volume, cold storage should be enabled with clickhouse.storage.coldStorage.enable", tieredStoragePolicy, coldVolume)
+	}
+	ttlRules := fmt.Sprintf("timeInserted + INTERVAL %s", ttl)
+	if moveAfter != "" {
+		ttlRules = fmt.Sprintf("timeInserted + INTERVAL %s TO VOLUME '%s', %s", moveAfter, coldVolume, ttlRules)
+	}
+	var tables []string
+	for _, table := range coldStorageTables {
+		// The storage policy is already set when the tables are created, unless
+		// cold storage was enabled after.
+		for _, query := range []string{
+			fmt.Sprintf(setStoragePolicyQuery, table, tieredStoragePolicy),
+			fmt.Sprintf(setTTLQuery, table, ttlRules),
+		} {
+			_, span := tracing.StartClickHouseSpan(context.TODO(), "exec", query)
+			_, err := c.clickhouseConnect.Exec(query)
+			tracing.EndSpan(span, err)
+			if err != nil {
+				return tables, fmt.Errorf("error when setting the TTL rules of table %s: %v", table, err)
+			}
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// CreateUser creates the roles of the Theia database, and the user with the
+// given role, or replaces the user if it exists. Like the other DDL of the
+// Theia Manager, the statements are executed on the whole cluster.
+func (c *ClickHouseStatQuerierImpl) CreateUser(namespace, name, password, role string) error {
+	userRole, err := schema.ParseRole(role)
+	if err != nil {
+		return err
+	}
+	database := clickhouse.GetDatabase()
+	userStatements, err := schema.UserDDL(schema.User{Name: name, Password: password, Role: userRole}, database, "{cluster}")
+	if err != nil {
+		return err
+	}
+	if c.clickhouseConnect == nil {
+		c.clickhouseConnect, err = clickhouse.SetupConnection(nil)
+		if err != nil {
+			return err
+		}
+	}
+	for _, statement := range append(schema.RolesDDL(database, "{cluster}"), userStatements...) {
+		// The statements creating the user hold its password, which must not
+		// be traced.
+		_, span := tracing.StartClickHouseSpan(context.TODO(), "exec", strings.SplitN(statement, " IDENTIFIED ", 2)[0])
+		_, err := c.clickhouseConnect.Exec(statement)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("error when creating user %s: %s", name, strings.ReplaceAll(err.Error(), password, "***"))
+		}
 	}
 	return nil
 }
@@ -153,10 +1087,12 @@ func (c *ClickHouseStatQuerierImpl) getDataFromClickHouse(query int, namespace s
 			return err
 		}
 	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", queryMap[query])
 	result, err := c.clickhouseConnect.Query(queryMap[query])
+	tracing.EndSpan(span, err)
 	if err != nil {
 		c.clickhouseConnect = nil
-		return fmt.Errorf("failed to get data from clickhouse: %v", err)
+		return fmt.Errorf("failed to get data from clickhouse: %v", clickhouse.ClassifyError(err))
 	}
 	defer result.Close()
 	for result.Next() {
@@ -164,31 +1100,33 @@ func (c *ClickHouseStatQuerierImpl) getDataFromClickHouse(query int, namespace s
 		switch query {
 		case diskQuery:
 			res := v1alpha1.DiskInfo{}
-			err = result.Scan(&res.Shard, &res.Database, &res.Path, &res.FreeSpace, &res.TotalSpace, &res.UsedPercentage)
+			err = result.Scan(&res.Shard, &res.Database, &res.Path, &res.FreeSpace, &res.TotalSpace, &res.UsedPercentageRaw, &res.FreeSpaceRaw, &res.TotalSpaceRaw)
 			if err != nil {
 				stats.ErrorMsg = append(stats.ErrorMsg, fmt.Sprintf("failed to parse the data returned by database: %v", err))
 				continue
 			}
-			res.UsedPercentage = res.UsedPercentage + " %"
+			res.UsedPercentage = res.UsedPercentageRaw + " %"
 			stats.DiskInfos = append(stats.DiskInfos, res)
 		case tableInfoQuery:
 			res := v1alpha1.TableInfo{}
 			var totalRows sql.NullString
 			var totalBytes sql.NullString
-			err = result.Scan(&res.Shard, &res.Database, &res.TableName, &totalRows, &totalBytes, &res.TotalCols)
+			var totalBytesRaw sql.NullString
+			err = result.Scan(&res.Shard, &res.Database, &res.TableName, &totalRows, &totalBytes, &res.TotalCols, &totalBytesRaw)
 			if err != nil {
 				stats.ErrorMsg = append(stats.ErrorMsg, fmt.Sprintf("failed to parse the data returned by database: %v", err))
 				continue
 			}
-			if !totalRows.Valid || !totalBytes.Valid {
+			if !totalRows.Valid || !totalBytes.Valid || !totalBytesRaw.Valid {
 				continue
 			}
 			res.TotalRows = totalRows.String
 			res.TotalBytes = totalBytes.String
+			res.TotalBytesRaw = totalBytesRaw.String
 			stats.TableInfos = append(stats.TableInfos, res)
-		case insertRateQuery:
+		case insertRateQuery, insertRateLastHourQuery:
 			res := v1alpha1.InsertRate{}
-			err = result.Scan(&res.Shard, &res.RowsPerSec, &res.BytesPerSec)
+			err = result.Scan(&res.Shard, &res.RowsPerSec, &res.BytesPerSec, &res.BytesPerSecRaw)
 			if err != nil {
 				stats.ErrorMsg = append(stats.ErrorMsg, fmt.Sprintf("failed to parse the data returned by database: %v", err))
 				continue
@@ -202,6 +1140,30 @@ func (c *ClickHouseStatQuerierImpl) getDataFromClickHouse(query int, namespace s
 				continue
 			}
 			stats.StackTraces = append(stats.StackTraces, res)
+		case retentionHistoryQuery:
+			res := v1alpha1.DeletionRecord{}
+			err = result.Scan(&res.Shard, &res.TimeDeleted, &res.TableName, &res.RangeStart, &res.RangeEnd, &res.RowCount, &res.BytesReclaimed, &res.Reason)
+			if err != nil {
+				stats.ErrorMsg = append(stats.ErrorMsg, fmt.Sprintf("failed to parse the data returned by database: %v", err))
+				continue
+			}
+			stats.RetentionHistory = append(stats.RetentionHistory, res)
+		case systemMetricsQuery:
+			res := v1alpha1.SystemMetric{}
+			err = result.Scan(&res.Shard, &res.Metric, &res.Value)
+			if err != nil {
+				stats.ErrorMsg = append(stats.ErrorMsg, fmt.Sprintf("failed to parse the data returned by database: %v", err))
+				continue
+			}
+			stats.SystemMetrics = append(stats.SystemMetrics, res)
+		case schemaVersionQuery:
+			res := v1alpha1.SchemaVersion{}
+			err = result.Scan(&res.Shard, &res.Version, &res.Dirty)
+			if err != nil {
+				stats.ErrorMsg = append(stats.ErrorMsg, fmt.Sprintf("failed to parse the data returned by database: %v", err))
+				continue
+			}
+			stats.SchemaVersions = append(stats.SchemaVersions, res)
 		}
 	}
 	return nil
@@ -15,14 +15,22 @@
 package stats
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/clickhouse/schema"
 	"antrea.io/theia/pkg/theia/commands/config"
 )
 
@@ -34,14 +42,16 @@ func TestGetDataFromClickHouse(t *testing.T) {
 		returnedRow    *sqlmock.Rows
 	}{
 		{
-			name:        "Get diskInfo",
-			query:       diskQuery,
-			returnedRow: sqlmock.NewRows([]string{"Shard", "DatabaseName", "Path", "Free", "Total", "Used_Percentage"}).AddRow("a", "b", "c", "d", "e", "f"),
+			name:  "Get diskInfo",
+			query: diskQuery,
+			returnedRow: sqlmock.NewRows([]string{"Shard", "DatabaseName", "Path", "Free", "Total", "Used_Percentage", "FreeRaw", "TotalRaw"}).
+				AddRow("1", "default", "/var/lib/clickhouse/", "1.84 GiB", "1.84 GiB", "0.04", "1975140352", "1975971840"),
 			expectedResult: &v1alpha1.ClickHouseStats{
 				TypeMeta:   metav1.TypeMeta{},
 				ObjectMeta: metav1.ObjectMeta{},
 				DiskInfos: []v1alpha1.DiskInfo{
-					{Shard: "a", Database: "b", Path: "c", FreeSpace: "d", TotalSpace: "e", UsedPercentage: "f %"},
+					{Shard: "1", Database: "default", Path: "/var/lib/clickhouse/", FreeSpace: "1.84 GiB", TotalSpace: "1.84 GiB", UsedPercentage: "0.04 %",
+						FreeSpaceRaw: "1975140352", TotalSpaceRaw: "1975971840", UsedPercentageRaw: "0.04"},
 				},
 				TableInfos:  nil,
 				InsertRates: nil,
@@ -51,12 +61,12 @@ func TestGetDataFromClickHouse(t *testing.T) {
 		{
 			name:        "Get tableInfo",
 			query:       tableInfoQuery,
-			returnedRow: sqlmock.NewRows([]string{"Shard", "DatabaseName", "TableName", "TotalRows", "TotalBytes", "TotalCols"}).AddRow("a", "b", "c", "d", "e", "f"),
+			returnedRow: sqlmock.NewRows([]string{"Shard", "DatabaseName", "TableName", "TotalRows", "TotalBytes", "TotalCols", "TotalBytesRaw"}).AddRow("a", "b", "c", "d", "2.00 KiB", "f", "2048"),
 			expectedResult: &v1alpha1.ClickHouseStats{
 				TypeMeta:    metav1.TypeMeta{},
 				ObjectMeta:  metav1.ObjectMeta{},
 				DiskInfos:   nil,
-				TableInfos:  []v1alpha1.TableInfo{{Shard: "a", Database: "b", TableName: "c", TotalRows: "d", TotalBytes: "e", TotalCols: "f"}},
+				TableInfos:  []v1alpha1.TableInfo{{Shard: "a", Database: "b", TableName: "c", TotalRows: "d", TotalBytes: "2.00 KiB", TotalCols: "f", TotalBytesRaw: "2048"}},
 				InsertRates: nil,
 				StackTraces: nil,
 			},
@@ -64,13 +74,13 @@ func TestGetDataFromClickHouse(t *testing.T) {
 		{
 			name:        "Get insertRate",
 			query:       insertRateQuery,
-			returnedRow: sqlmock.NewRows([]string{"Shard", "RowsPerSecond", "BytesPerSecond"}).AddRow("a", "b", "c"),
+			returnedRow: sqlmock.NewRows([]string{"Shard", "RowsPerSecond", "BytesPerSecond", "BytesPerSecondRaw"}).AddRow("a", "b", "6.31 KiB", "6461"),
 			expectedResult: &v1alpha1.ClickHouseStats{
 				TypeMeta:    metav1.TypeMeta{},
 				ObjectMeta:  metav1.ObjectMeta{},
 				DiskInfos:   nil,
 				TableInfos:  nil,
-				InsertRates: []v1alpha1.InsertRate{{Shard: "a", RowsPerSec: "b", BytesPerSec: "c"}},
+				InsertRates: []v1alpha1.InsertRate{{Shard: "a", RowsPerSec: "b", BytesPerSec: "6.31 KiB", BytesPerSecRaw: "6461"}},
 				StackTraces: nil,
 			},
 		},
@@ -87,6 +97,62 @@ func TestGetDataFromClickHouse(t *testing.T) {
 				StackTraces: []v1alpha1.StackTrace{{Shard: "a", TraceFunctions: "b", Count: "c"}},
 			},
 		},
+		{
+			name:  "Get retentionHistory",
+			query: retentionHistoryQuery,
+			returnedRow: sqlmock.NewRows([]string{"Shard", "TimeDeleted", "TableName", "RangeStart", "RangeEnd", "RowCount", "BytesReclaimed", "Reason"}).
+				AddRow("1", "2023-05-01 10:00:00", "default.flows", "2023-04-01 00:00:00", "2023-04-15 00:00:00", "1000", "2048", "storage usage 55.56 % above threshold 50.00 %"),
+			expectedResult: &v1alpha1.ClickHouseStats{
+				TypeMeta:   metav1.TypeMeta{},
+				ObjectMeta: metav1.ObjectMeta{},
+				RetentionHistory: []v1alpha1.DeletionRecord{{
+					Shard:          "1",
+					TimeDeleted:    "2023-05-01 10:00:00",
+					TableName:      "default.flows",
+					RangeStart:     "2023-04-01 00:00:00",
+					RangeEnd:       "2023-04-15 00:00:00",
+					RowCount:       "1000",
+					BytesReclaimed: "2048",
+					Reason:         "storage usage 55.56 % above threshold 50.00 %",
+				}},
+			},
+		},
+		{
+			name:        "Get systemMetrics",
+			query:       systemMetricsQuery,
+			returnedRow: sqlmock.NewRows([]string{"Shard", "Metric", "Value"}).AddRow("1", "Query", "2").AddRow("1", "TCPConnection", "5"),
+			expectedResult: &v1alpha1.ClickHouseStats{
+				TypeMeta:   metav1.TypeMeta{},
+				ObjectMeta: metav1.ObjectMeta{},
+				SystemMetrics: []v1alpha1.SystemMetric{
+					{Shard: "1", Metric: "Query", Value: "2"},
+					{Shard: "1", Metric: "TCPConnection", Value: "5"},
+				},
+			},
+		},
+		{
+			name:        "Get schemaVersion",
+			query:       schemaVersionQuery,
+			returnedRow: sqlmock.NewRows([]string{"Shard", "Version", "Dirty"}).AddRow("1", "6", "0").AddRow("2", "6", "0"),
+			expectedResult: &v1alpha1.ClickHouseStats{
+				TypeMeta:   metav1.TypeMeta{},
+				ObjectMeta: metav1.ObjectMeta{},
+				SchemaVersions: []v1alpha1.SchemaVersion{
+					{Shard: "1", Version: "6", Dirty: "0"},
+					{Shard: "2", Version: "6", Dirty: "0"},
+				},
+			},
+		},
+		{
+			name:        "Get insertRateLastHour",
+			query:       insertRateLastHourQuery,
+			returnedRow: sqlmock.NewRows([]string{"Shard", "RowsPerSecond", "BytesPerSecond", "BytesPerSecondRaw"}).AddRow("1", "120", "4.00 KiB", "4096"),
+			expectedResult: &v1alpha1.ClickHouseStats{
+				TypeMeta:    metav1.TypeMeta{},
+				ObjectMeta:  metav1.ObjectMeta{},
+				InsertRates: []v1alpha1.InsertRate{{Shard: "1", RowsPerSec: "120", BytesPerSec: "4.00 KiB", BytesPerSecRaw: "4096"}},
+			},
+		},
 		{
 			name:        "Empty result",
 			query:       stackTraceQuery,
@@ -130,3 +196,782 @@ func TestGetDataFromClickHouse(t *testing.T) {
 		})
 	}
 }
+
+func TestGetFlowCardinality(t *testing.T) {
+	testCases := []struct {
+		name           string
+		trafficClass   string
+		returnedRow    *sqlmock.Rows
+		returnedErr    error
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name:        "Get flow cardinality",
+			returnedRow: sqlmock.NewRows([]string{"Flows", "Pods", "Namespaces", "Services", "ExternalIPs", "Ports"}).AddRow("1000", "20", "3", "4", "5", "6"),
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "1h0m0s",
+				Cardinality: v1alpha1.FlowCardinality{
+					Flows: "1000", Pods: "20", Namespaces: "3", Services: "4", ExternalIPs: "5", Ports: "6",
+				},
+			},
+		},
+		{
+			name:         "Get flow cardinality of a traffic class",
+			trafficClass: v1alpha1.TrafficClassInterNode,
+			returnedRow:  sqlmock.NewRows([]string{"Flows", "Pods", "Namespaces", "Services", "ExternalIPs", "Ports"}).AddRow("500", "10", "2", "0", "0", "3"),
+			expectedResult: &v1alpha1.FlowStats{
+				Window:       "1h0m0s",
+				TrafficClass: v1alpha1.TrafficClassInterNode,
+				Cardinality: v1alpha1.FlowCardinality{
+					Flows: "500", Pods: "10", Namespaces: "2", Services: "0", ExternalIPs: "0", Ports: "3",
+				},
+			},
+		},
+		{
+			name:           "Query error",
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting flow cardinality from clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(flowCardinalityQuery)).WithArgs(int64(3600), tc.trafficClass, tc.trafficClass)
+			if tc.returnedErr != nil {
+				expectedQuery.WillReturnError(tc.returnedErr)
+			} else {
+				expectedQuery.WillReturnRows(tc.returnedRow)
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetFlowCardinality(config.FlowVisibilityNS, time.Hour, tc.trafficClass, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+		})
+	}
+}
+
+func TestGetTrafficClasses(t *testing.T) {
+	testCases := []struct {
+		name           string
+		window         time.Duration
+		resolution     string
+		returnedRows   *sqlmock.Rows
+		returnedErr    error
+		expectedQuery  string
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name:       "Get traffic classes",
+			window:     time.Hour,
+			resolution: "raw",
+			returnedRows: sqlmock.NewRows([]string{"TrafficClass", "Flows", "Bytes"}).
+				AddRow("inter-node", "600", "1000000").
+				AddRow("pod-to-external", "300", "20000"),
+			expectedQuery: trafficClassesQuery,
+			expectedResult: &v1alpha1.FlowStats{
+				Window:     "1h0m0s",
+				Resolution: "raw",
+				TrafficClasses: []v1alpha1.TrafficClassStats{
+					{TrafficClass: "inter-node", Flows: "600", Bytes: "1000000"},
+					{TrafficClass: "pod-to-external", Flows: "300", Bytes: "20000"},
+				},
+			},
+		},
+		{
+			name:          "Get traffic classes from the 1-minute rollup",
+			window:        time.Hour,
+			resolution:    "auto",
+			returnedRows:  sqlmock.NewRows([]string{"TrafficClass", "Flows", "Bytes"}).AddRow("inter-node", "600", "1000000"),
+			expectedQuery: "FROM flows_rollup_1m\nWHERE timeBucket >= toStartOfMinute(now() - toIntervalSecond(?))",
+			expectedResult: &v1alpha1.FlowStats{
+				Window:         "1h0m0s",
+				Resolution:     "1m",
+				TrafficClasses: []v1alpha1.TrafficClassStats{{TrafficClass: "inter-node", Flows: "600", Bytes: "1000000"}},
+			},
+		},
+		{
+			name:          "Get traffic classes from the 1-hour rollup",
+			window:        7 * 24 * time.Hour,
+			returnedRows:  sqlmock.NewRows([]string{"TrafficClass", "Flows", "Bytes"}).AddRow("inter-node", "600", "1000000"),
+			expectedQuery: "FROM flows_rollup_1h\nWHERE timeBucket >= toStartOfHour(now() - toIntervalSecond(?))",
+			expectedResult: &v1alpha1.FlowStats{
+				Window:         "168h0m0s",
+				Resolution:     "1h",
+				TrafficClasses: []v1alpha1.TrafficClassStats{{TrafficClass: "inter-node", Flows: "600", Bytes: "1000000"}},
+			},
+		},
+		{
+			name:           "Query error",
+			window:         time.Hour,
+			resolution:     "raw",
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedQuery:  trafficClassesQuery,
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting traffic classes from clickhouse: error in database",
+		},
+		{
+			name:           "Unknown resolution",
+			window:         time.Hour,
+			resolution:     "1s",
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "unknown resolution \"1s\"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			if tc.returnedRows != nil || tc.returnedErr != nil {
+				expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(tc.expectedQuery)).WithArgs(int64(tc.window.Seconds()))
+				if tc.returnedErr != nil {
+					expectedQuery.WillReturnError(tc.returnedErr)
+				} else {
+					expectedQuery.WillReturnRows(tc.returnedRows)
+				}
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetTrafficClasses(config.FlowVisibilityNS, tc.window, tc.resolution, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetNodeFlows(t *testing.T) {
+	lastFlowEnd := time.Date(2023, 9, 1, 18, 0, 0, 0, time.FixedZone("UTC+8", 8*60*60))
+	testCases := []struct {
+		name           string
+		returnedRows   *sqlmock.Rows
+		returnedErr    error
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name: "Get node flows",
+			returnedRows: sqlmock.NewRows([]string{"Node", "Flows", "LastFlowEnd"}).
+				AddRow("node-1", "600", lastFlowEnd).
+				AddRow("node-2", "300", lastFlowEnd.Add(-time.Minute)),
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "1h0m0s",
+				Nodes: []v1alpha1.NodeFlowStats{
+					{Name: "node-1", Flows: "600", LastFlowEnd: "2023-09-01T10:00:00Z"},
+					{Name: "node-2", Flows: "300", LastFlowEnd: "2023-09-01T09:59:00Z"},
+				},
+			},
+		},
+		{
+			name:           "Query error",
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting node flows from clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(nodeFlowsQuery)).WithArgs(int64(3600))
+			if tc.returnedErr != nil {
+				expectedQuery.WillReturnError(tc.returnedErr)
+			} else {
+				expectedQuery.WillReturnRows(tc.returnedRows)
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetNodeFlows(config.FlowVisibilityNS, time.Hour, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+		})
+	}
+}
+
+func TestGetTopTalkers(t *testing.T) {
+	testCases := []struct {
+		name           string
+		resolution     string
+		groupBy        string
+		sortBy         string
+		returnedRows   *sqlmock.Rows
+		returnedErr    error
+		expectedQuery  string
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name:    "Get top Pod pairs by bytes",
+			groupBy: "pods",
+			sortBy:  "bytes",
+			returnedRows: sqlmock.NewRows([]string{"Source", "Destination", "Flows", "Bytes", "Packets", "ReverseBytes", "ReversePackets", "Throughput"}).
+				AddRow("default/client", "default/nginx", "20", "3600000", "3000", "360000", "300", "1100").
+				AddRow("default/client", "10.10.1.1", "5", "36000", "30", "0", "0", "10"),
+			expectedQuery: "if(sourcePodName != '', concat(sourcePodNamespace, '/', sourcePodName), sourceIP) AS Source",
+			expectedResult: &v1alpha1.FlowStats{
+				Window:       "1h0m0s",
+				TrafficClass: "inter-node",
+				Resolution:   "1m",
+				TopTalkers: []v1alpha1.TopTalkerStats{
+					{Source: "default/client", Destination: "default/nginx", Flows: "20", Bytes: "3600000", Packets: "3000", ReverseBytes: "360000", ReversePackets: "300", Throughput: "1100"},
+					{Source: "default/client", Destination: "10.10.1.1", Flows: "5", Bytes: "36000", Packets: "30", ReverseBytes: "0", ReversePackets: "0", Throughput: "10"},
+				},
+			},
+		},
+		{
+			name:    "Get top Namespace pairs by reverse packets",
+			groupBy: "namespaces",
+			sortBy:  "reverse-packets",
+			returnedRows: sqlmock.NewRows([]string{"Source", "Destination", "Flows", "Bytes", "Packets", "ReverseBytes", "ReversePackets", "Throughput"}).
+				AddRow("default", "kube-system", "20", "3600000", "3000", "360000", "300", "1100"),
+			expectedQuery: "ORDER BY ReversePackets DESC",
+			expectedResult: &v1alpha1.FlowStats{
+				Window:       "1h0m0s",
+				TrafficClass: "inter-node",
+				Resolution:   "1m",
+				TopTalkers: []v1alpha1.TopTalkerStats{
+					{Source: "default", Destination: "kube-system", Flows: "20", Bytes: "3600000", Packets: "3000", ReverseBytes: "360000", ReversePackets: "300", Throughput: "1100"},
+				},
+			},
+		},
+		{
+			name:       "Get top Pod pairs from the flow records",
+			resolution: "raw",
+			groupBy:    "pods",
+			sortBy:     "bytes",
+			returnedRows: sqlmock.NewRows([]string{"Source", "Destination", "Flows", "Bytes", "Packets", "ReverseBytes", "ReversePackets", "Throughput"}).
+				AddRow("default/client", "default/nginx", "20", "3600000", "3000", "360000", "300", "1100"),
+			expectedQuery: "count() AS Flows",
+			expectedResult: &v1alpha1.FlowStats{
+				Window:       "1h0m0s",
+				TrafficClass: "inter-node",
+				Resolution:   "raw",
+				TopTalkers: []v1alpha1.TopTalkerStats{
+					{Source: "default/client", Destination: "default/nginx", Flows: "20", Bytes: "3600000", Packets: "3000", ReverseBytes: "360000", ReversePackets: "300", Throughput: "1100"},
+				},
+			},
+		},
+		{
+			name:           "Query error",
+			groupBy:        "pods",
+			sortBy:         "bytes",
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting top talkers from clickhouse: error in database",
+		},
+		{
+			name:           "Unknown sort key",
+			groupBy:        "pods",
+			sortBy:         "flows",
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "unknown sort key of top talkers \"flows\"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			if tc.returnedRows != nil || tc.returnedErr != nil {
+				expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(tc.expectedQuery)).WithArgs(float64(3600), int64(3600), "inter-node", "inter-node", 10)
+				if tc.returnedErr != nil {
+					expectedQuery.WillReturnError(tc.returnedErr)
+				} else {
+					expectedQuery.WillReturnRows(tc.returnedRows)
+				}
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetTopTalkers(config.FlowVisibilityNS, time.Hour, tc.resolution, "inter-node", tc.groupBy, tc.sortBy, 10, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetWorkloadFlows(t *testing.T) {
+	columns := []string{"Direction", "Peer", "Port", "Flows", "BytesSent", "BytesReceived", "IngressPolicy", "EgressPolicy"}
+	testCases := []struct {
+		name           string
+		podName        string
+		podLabels      map[string]string
+		expectedArgs   []driver.Value
+		returnedErr    error
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name:         "Get workload flows by Pod labels",
+			podLabels:    map[string]string{"tier": "frontend", "app": "web"},
+			expectedArgs: []driver.Value{int64(86400), "default", "app", "web", "tier", "frontend", 20},
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "24h0m0s",
+				WorkloadFlows: []v1alpha1.WorkloadFlowStats{
+					{Direction: "ingress", Peer: "default/client", Port: "80/TCP", Flows: "10", BytesSent: "50000", BytesReceived: "1000", IngressPolicy: "default/allow-client (Allow)"},
+					{Direction: "egress", Peer: "kube-system/kube-dns:dns", Port: "53/UDP", Flows: "4", BytesSent: "400", BytesReceived: "800", EgressPolicy: "allow-dns (Allow)"},
+					{Direction: "egress", Peer: "10.10.1.1", Port: "443/TCP", Flows: "2", BytesSent: "200", EgressPolicy: "default-deny (Drop)"},
+				},
+			},
+		},
+		{
+			name:         "Get workload flows by Pod name",
+			podName:      "web-0",
+			expectedArgs: []driver.Value{int64(86400), "default", "web-0", 20},
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "24h0m0s",
+				WorkloadFlows: []v1alpha1.WorkloadFlowStats{
+					{Direction: "ingress", Peer: "default/client", Port: "80/TCP", Flows: "10", BytesSent: "50000", BytesReceived: "1000", IngressPolicy: "default/allow-client (Allow)"},
+					{Direction: "egress", Peer: "kube-system/kube-dns:dns", Port: "53/UDP", Flows: "4", BytesSent: "400", BytesReceived: "800", EgressPolicy: "allow-dns (Allow)"},
+					{Direction: "egress", Peer: "10.10.1.1", Port: "443/TCP", Flows: "2", BytesSent: "200", EgressPolicy: "default-deny (Drop)"},
+				},
+			},
+		},
+		{
+			name:           "Query error",
+			podName:        "web-0",
+			expectedArgs:   []driver.Value{int64(86400), "default", "web-0", 20},
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting ingress workload flows from clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			prefixes := map[string]string{"ingress": "destination", "egress": "source"}
+			for _, direction := range []string{"ingress", "egress"} {
+				expectedCondition := prefixes[direction] + "PodNamespace = ?"
+				if tc.podName != "" {
+					expectedCondition += " AND " + prefixes[direction] + "PodName = ?"
+				} else {
+					expectedCondition += fmt.Sprintf(" AND JSONExtractString(%[1]sPodLabels, ?) = ? AND JSONExtractString(%[1]sPodLabels, ?) = ?", prefixes[direction])
+				}
+				expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("'%s' AS Direction", direction)) + ".*" + regexp.QuoteMeta(expectedCondition)).WithArgs(tc.expectedArgs...)
+				if tc.returnedErr != nil {
+					expectedQuery.WillReturnError(tc.returnedErr)
+					break
+				}
+				if direction == "ingress" {
+					expectedQuery.WillReturnRows(sqlmock.NewRows(columns).
+						AddRow("ingress", "default/client", "80/TCP", "10", "50000", "1000", "default/allow-client (Allow)", ""))
+				} else {
+					expectedQuery.WillReturnRows(sqlmock.NewRows(columns).
+						AddRow("egress", "kube-system/kube-dns:dns", "53/UDP", "4", "400", "800", "", "allow-dns (Allow)").
+						AddRow("egress", "10.10.1.1", "443/TCP", "2", "200", "", "", "default-deny (Drop)"))
+				}
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetWorkloadFlows(config.FlowVisibilityNS, 24*time.Hour, "default", tc.podName, tc.podLabels, 20, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetPolicyHits(t *testing.T) {
+	testCases := []struct {
+		name           string
+		returnedRows   *sqlmock.Rows
+		returnedErr    error
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name: "Get policy hits",
+			returnedRows: sqlmock.NewRows([]string{"Direction", "Policy", "Action", "Flows", "Bytes"}).
+				AddRow("ingress", "default/allow-client", "Allow", "600", "1000000").
+				AddRow("egress", "default-deny", "Drop", "20", "2000"),
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "1h0m0s",
+				PolicyHits: []v1alpha1.PolicyHitStats{
+					{Direction: "ingress", Policy: "default/allow-client", Action: "Allow", Flows: "600", Bytes: "1000000"},
+					{Direction: "egress", Policy: "default-deny", Action: "Drop", Flows: "20", Bytes: "2000"},
+				},
+			},
+		},
+		{
+			name:           "Query error",
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting policy hits from clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(policyHitsQuery)).WithArgs(int64(3600), 10)
+			if tc.returnedErr != nil {
+				expectedQuery.WillReturnError(tc.returnedErr)
+			} else {
+				expectedQuery.WillReturnRows(tc.returnedRows)
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetPolicyHits(config.FlowVisibilityNS, time.Hour, 10, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+		})
+	}
+}
+
+func TestGetSecurityPosture(t *testing.T) {
+	testCases := []struct {
+		name           string
+		returnedRows   *sqlmock.Rows
+		returnedErr    error
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name: "Get security posture",
+			returnedRows: sqlmock.NewRows([]string{"Namespace", "Flows", "UnprotectedFlows", "DeniedFlows"}).
+				AddRow("default", "600", "100", "5").
+				AddRow("kube-system", "300", "300", "0"),
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "1h0m0s",
+				Posture: []v1alpha1.NamespacePostureStats{
+					{Namespace: "default", Flows: "600", UnprotectedFlows: "100", DeniedFlows: "5"},
+					{Namespace: "kube-system", Flows: "300", UnprotectedFlows: "300", DeniedFlows: "0"},
+				},
+			},
+		},
+		{
+			name:           "Query error",
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting security posture from clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(securityPostureQuery)).WithArgs(int64(3600))
+			if tc.returnedErr != nil {
+				expectedQuery.WillReturnError(tc.returnedErr)
+			} else {
+				expectedQuery.WillReturnRows(tc.returnedRows)
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetSecurityPosture(config.FlowVisibilityNS, time.Hour, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+		})
+	}
+}
+
+func TestGetPolicyTraffic(t *testing.T) {
+	lastFlowEnd := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name           string
+		returnedRows   *sqlmock.Rows
+		returnedErr    error
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name: "Get policy traffic",
+			returnedRows: sqlmock.NewRows([]string{"Kind", "Namespace", "Name", "AllowedFlows", "AllowedBytes", "DeniedFlows", "DeniedBytes", "LastFlowEnd"}).
+				AddRow("K8sNetworkPolicy", "default", "allow-client", "600", "1000000", "0", "0", lastFlowEnd).
+				AddRow("AntreaClusterNetworkPolicy", "", "default-deny", "0", "0", "20", "2000", lastFlowEnd.Add(-time.Minute)),
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "1h0m0s",
+				PolicyTraffic: []v1alpha1.PolicyTrafficStats{
+					{Kind: "K8sNetworkPolicy", Namespace: "default", Name: "allow-client", AllowedFlows: "600", AllowedBytes: "1000000", DeniedFlows: "0", DeniedBytes: "0", LastFlowEnd: "2023-09-01T10:00:00Z"},
+					{Kind: "AntreaClusterNetworkPolicy", Name: "default-deny", AllowedFlows: "0", AllowedBytes: "0", DeniedFlows: "20", DeniedBytes: "2000", LastFlowEnd: "2023-09-01T09:59:00Z"},
+				},
+			},
+		},
+		{
+			name:           "Query error",
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when getting policy traffic from clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(policyTrafficQuery)).WithArgs(int64(3600))
+			if tc.returnedErr != nil {
+				expectedQuery.WillReturnError(tc.returnedErr)
+			} else {
+				expectedQuery.WillReturnRows(tc.returnedRows)
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetPolicyTraffic(config.FlowVisibilityNS, time.Hour, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+		})
+	}
+}
+
+func TestGetFlowIntegrity(t *testing.T) {
+	testCases := []struct {
+		name           string
+		recordsErr     error
+		bytesErr       error
+		expectedResult *v1alpha1.FlowStats
+		expectedErr    string
+	}{
+		{
+			name: "Get flow integrity",
+			expectedResult: &v1alpha1.FlowStats{
+				Window: "1h0m0s",
+				Integrity: []v1alpha1.FlowIntegrityStats{
+					{Check: v1alpha1.FlowIntegrityCheckMonotonicBytes, Checked: "400", Anomalies: "2"},
+					{Check: v1alpha1.FlowIntegrityCheckStartBeforeEnd, Checked: "1000", Anomalies: "0"},
+					{Check: v1alpha1.FlowIntegrityCheckInterNodeCorrelation, Checked: "300", Anomalies: "15"},
+				},
+			},
+		},
+		{
+			name:           "Records query error",
+			recordsErr:     fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when checking the flow records in clickhouse: error in database",
+		},
+		{
+			name:           "Bytes query error",
+			bytesErr:       fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.FlowStats{},
+			expectedErr:    "error when checking the byte counts of the flows in clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			recordsQuery := mock.ExpectQuery(regexp.QuoteMeta(flowRecordsIntegrityQuery)).WithArgs(int64(3600))
+			if tc.recordsErr != nil {
+				recordsQuery.WillReturnError(tc.recordsErr)
+			} else {
+				recordsQuery.WillReturnRows(sqlmock.NewRows([]string{"Records", "StartAfterEnd", "InterNodeRecords", "Uncorrelated"}).AddRow("1000", "0", "300", "15"))
+				bytesQuery := mock.ExpectQuery(regexp.QuoteMeta(flowBytesIntegrityQuery)).WithArgs(int64(3600))
+				if tc.bytesErr != nil {
+					bytesQuery.WillReturnError(tc.bytesErr)
+				} else {
+					bytesQuery.WillReturnRows(sqlmock.NewRows([]string{"Flows", "Decreasing"}).AddRow("400", "2"))
+				}
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.FlowStats
+			err = controller.GetFlowIntegrity(config.FlowVisibilityNS, time.Hour, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetMigrationProgress(t *testing.T) {
+	testCases := []struct {
+		name           string
+		tables         int
+		returnedRows   *sqlmock.Rows
+		returnedErr    error
+		expectedResult *v1alpha1.ClickHouseStats
+		expectedErr    string
+	}{
+		{
+			name:   "Get migration progress",
+			tables: 1,
+			returnedRows: sqlmock.NewRows([]string{"FromVersion", "ToVersion", "TableName", "Operation", "Done", "Total", "ETASeconds", "TimeUpdated"}).
+				AddRow("4", "6", "flows_local", "mutation", "25", "100", "30", "2023-06-01 08:00:10.000").
+				AddRow("4", "6", "recommendations_local", "copy", "10000", "10000", "0", "2023-06-01 08:00:20.000"),
+			expectedResult: &v1alpha1.ClickHouseStats{
+				MigrationProgress: []v1alpha1.MigrationProgress{
+					{FromVersion: "4", ToVersion: "6", TableName: "flows_local", Operation: "mutation", Done: "25", Total: "100", ETASeconds: "30", TimeUpdated: "2023-06-01 08:00:10.000"},
+					{FromVersion: "4", ToVersion: "6", TableName: "recommendations_local", Operation: "copy", Done: "10000", Total: "10000", ETASeconds: "0", TimeUpdated: "2023-06-01 08:00:20.000"},
+				},
+			},
+		},
+		{
+			name:           "No migration progress table",
+			tables:         0,
+			expectedResult: &v1alpha1.ClickHouseStats{},
+		},
+		{
+			name:           "Query error",
+			tables:         1,
+			returnedErr:    fmt.Errorf("error in database"),
+			expectedResult: &v1alpha1.ClickHouseStats{},
+			expectedErr:    "error when getting migration progress from clickhouse: error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			mock.ExpectQuery(regexp.QuoteMeta(migrationProgressTableQuery)).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(tc.tables))
+			if tc.tables > 0 {
+				expectedQuery := mock.ExpectQuery(regexp.QuoteMeta(migrationProgressQuery))
+				if tc.returnedErr != nil {
+					expectedQuery.WillReturnError(tc.returnedErr)
+				} else {
+					expectedQuery.WillReturnRows(tc.returnedRows)
+				}
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			var result v1alpha1.ClickHouseStats
+			err = controller.GetMigrationProgress(config.FlowVisibilityNS, &result)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedResult, &result)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestExportFlows(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(query), "FORMAT Parquet")
+		assert.Equal(t, "1693562400", r.URL.Query().Get("param_startTime"))
+		assert.Equal(t, "1693566000", r.URL.Query().Get("param_endTime"))
+		assert.Equal(t, "1000", r.URL.Query().Get("max_block_size"))
+		w.Write([]byte("PAR1"))
+	}))
+	defer server.Close()
+	t.Setenv("CLICKHOUSE_USERNAME", "username")
+	t.Setenv("CLICKHOUSE_PASSWORD", "password")
+	t.Setenv("CLICKHOUSE_HTTP_URL", server.URL)
+	startTime := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+	endTime := time.Date(2023, 9, 1, 11, 0, 0, 0, time.UTC)
+
+	chq := NewClickHouseStatQuerierImpl(nil)
+	stream, err := chq.ExportFlows("", startTime, endTime, v1alpha1.FlowExportFormatParquet, 1000)
+	require.NoError(t, err)
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, "PAR1", string(data))
+
+	_, err = chq.ExportFlows("", startTime, endTime, "json", 1000)
+	assert.EqualError(t, err, "unknown export format \"json\"")
+}
+
+func TestSetColdStorage(t *testing.T) {
+	testCases := []struct {
+		name           string
+		moveAfter      string
+		volumes        int
+		expectedTTL    string
+		expectedTables []string
+		expectedErr    string
+	}{
+		{
+			name:           "Move after 7 days",
+			moveAfter:      "7 DAY",
+			volumes:        1,
+			expectedTTL:    "timeInserted + INTERVAL 7 DAY TO VOLUME 'cold', timeInserted + INTERVAL 30 DAY",
+			expectedTables: coldStorageTables,
+		},
+		{
+			name:           "Only move when the hot volume is full",
+			volumes:        1,
+			expectedTTL:    "timeInserted + INTERVAL 30 DAY",
+			expectedTables: coldStorageTables,
+		},
+		{
+			name:        "Cold storage not enabled",
+			moveAfter:   "7 DAY",
+			expectedErr: "storage policy tiered has no cold volume, cold storage should be enabled with clickhouse.storage.coldStorage.enable",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CLICKHOUSE_TTL", "30 DAY")
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			mock.ExpectQuery(regexp.QuoteMeta(coldVolumeQuery)).WithArgs("tiered", "cold").
+				WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(tc.volumes))
+			for _, table := range tc.expectedTables {
+				mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("ALTER TABLE %s ON CLUSTER '{cluster}' MODIFY SETTING storage_policy = 'tiered'", table))).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf("ALTER TABLE %s ON CLUSTER '{cluster}' MODIFY TTL %s", table, tc.expectedTTL))).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+			tables, err := controller.SetColdStorage(config.FlowVisibilityNS, tc.moveAfter)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedTables, tables)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	for _, statement := range schema.RolesDDL("default", "{cluster}") {
+		mock.ExpectExec(statement).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("CREATE USER OR REPLACE grafana ON CLUSTER '{cluster}' IDENTIFIED WITH sha256_password BY 'grafana_password'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("GRANT ON CLUSTER '{cluster}' theia_default_reader TO grafana").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER USER grafana ON CLUSTER '{cluster}' DEFAULT ROLE theia_default_reader").
+		WillReturnError(fmt.Errorf("Syntax error near 'grafana_password'"))
+	controller := ClickHouseStatQuerierImpl{clickhouseConnect: db}
+	err = controller.CreateUser(config.FlowVisibilityNS, "grafana", "grafana_password", "reader")
+	assert.EqualError(t, err, "error when creating user grafana: Syntax error near '***'")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	err = controller.CreateUser(config.FlowVisibilityNS, "grafana", "grafana_password", "root")
+	assert.EqualError(t, err, "role \"root\" is not valid, it should be one of writer, reader or admin")
+}
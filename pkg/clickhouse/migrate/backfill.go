@@ -0,0 +1,434 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/util/clickhouse"
+)
+
+const (
+	// PartitionIDPlaceholder is replaced by the ID of the partition in the
+	// statement of a Backfill.
+	PartitionIDPlaceholder = "{partitionID}"
+
+	// The migration_backfill table records the partitions whose backfill is
+	// completed, so that a failed backfill is resumed from the remaining
+	// partitions by the next migration. A row without partition records that
+	// a backfill is started, or completed.
+	createMigrationBackfillTableQuery = `CREATE TABLE IF NOT EXISTS migration_backfill%s (
+    timeUpdated DateTime64(3) DEFAULT now64(3),
+    name String,
+    partitionID String,
+    completed UInt8
+) ENGINE = MergeTree
+ORDER BY (name, partitionID)`
+	insertMigrationBackfillQuery = "INSERT INTO migration_backfill (name, partitionID, completed) VALUES (?, ?, ?)"
+	// Get the backfills which are started more times than they are completed.
+	pendingBackfillsQuery = "SELECT name FROM migration_backfill WHERE partitionID = '' GROUP BY name HAVING countIf(completed = 0) > countIf(completed = 1)"
+	// Get the partitions completed since the backfill was last started, as
+	// the backfill is started again from scratch when the data schema is
+	// upgraded again after a downgrade.
+	completedPartitionsQuery = "SELECT DISTINCT partitionID FROM migration_backfill WHERE name = ? AND partitionID != '' AND completed = 1 AND timeUpdated >= (SELECT max(timeUpdated) FROM migration_backfill WHERE name = ? AND partitionID = '' AND completed = 0)"
+	// Get the active partitions of a table, from system.parts or from the
+	// table function reading it from all the servers of the cluster.
+	partitionsQuery = "SELECT DISTINCT partition_id FROM %s WHERE database = currentDatabase() AND table = ? AND active ORDER BY partition_id"
+	// Get the number of mutations of a partition which are not done, and the
+	// reason of their latest failure, if any.
+	partitionMutationsQuery = "SELECT countIf(NOT is_done), anyIf(latest_fail_reason, latest_fail_reason != '') FROM %s WHERE database = currentDatabase() AND table = ? AND position(command, ?) > 0"
+)
+
+var (
+	// backfills maps golang-migrate version numbers to the backfills run after
+	// the upgrading migrator reaching the version number, in order.
+	backfills = map[int][]Backfill{}
+
+	mutationStatementRegex = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\b`)
+
+	// Interval and timeout of waiting for the mutation of a partition to be
+	// done.
+	backfillPollInterval = 5 * time.Second
+	backfillPollTimeout  = 6 * time.Hour
+)
+
+// Backfill populates columns of a table from its existing data, one partition
+// at a time, e.g. after a migrator adds the columns. Backfilling large tables
+// partition by partition bounds the amount of data rewritten by each
+// statement, and allows a failed backfill to be resumed from the partitions
+// which are not completed.
+type Backfill struct {
+	// Name identifies the backfill across migrations, e.g.
+	// "0-8-0/flows_local/egressName".
+	Name string
+	// Table is the table whose partitions are backfilled. In a cluster, it
+	// is the local table of the servers.
+	Table string
+	// Statement is executed for each partition, with PartitionIDPlaceholder
+	// replaced by the ID of the partition, e.g. "ALTER TABLE flows_local
+	// UPDATE egressName = ... IN PARTITION ID '{partitionID}' WHERE egressName
+	// = ''", or "INSERT INTO ... SELECT ... WHERE toYYYYMM(timeInserted) =
+	// {partitionID}". It is rewritten for the database and the cluster like the
+	// migrators. The mutations, i.e. the ALTER TABLE statements, are waited
+	// for. The statement must be idempotent, as the backfill of a partition
+	// is run again if it was interrupted.
+	Statement string
+	// Parallelism is the number of partitions backfilled concurrently. It
+	// defaults to 1.
+	Parallelism int
+	// Interval is the minimum time between the beginnings of the backfills of
+	// two partitions, to throttle the load on ClickHouse. The backfills are
+	// not throttled if it is 0.
+	Interval time.Duration
+}
+
+// backfiller runs the backfills of a migration.
+type backfiller struct {
+	connect *sql.DB
+	// partsTable and mutationsTable are system.parts and system.mutations,
+	// or the table functions reading them from all the servers of the
+	// cluster.
+	partsTable     string
+	mutationsTable string
+	// rewrite rewrites the statements for the database and the cluster.
+	rewrite func(statement string) string
+	// maxPartitions is the maximum number of partitions of a backfill
+	// processed by a run, or 0 if there is no limit.
+	maxPartitions int
+}
+
+// newBackfiller connects to ClickHouse and creates the migration_backfill
+// table. The returned backfiller must be closed.
+func (m *Migrator) newBackfiller() (*backfiller, error) {
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return nil, fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	b := &backfiller{
+		connect:        connect,
+		partsTable:     "system.parts",
+		mutationsTable: "system.mutations",
+		rewrite:        func(statement string) string { return statement },
+		maxPartitions:  m.config.MaxPartitionsPerRun,
+	}
+	onCluster := ""
+	database, cluster := m.config.Database, m.config.Cluster
+	if database != "" && database != defaultDatabase {
+		b.rewrite = func(statement string) string { return rewriteForDatabase(statement, database) }
+	}
+	if cluster != "" {
+		onCluster = fmt.Sprintf(" ON CLUSTER '%s'", cluster)
+		b.partsTable = fmt.Sprintf("cluster('%s', system.parts)", cluster)
+		b.mutationsTable = fmt.Sprintf("cluster('%s', system.mutations)", cluster)
+		rewriteForDatabase := b.rewrite
+		b.rewrite = func(statement string) string {
+			// The INSERT INTO ... SELECT statements of the migrators are
+			// matched up to their terminating semicolon.
+			rewritten := rewriteForCluster(rewriteForDatabase(statement)+";", cluster)
+			return strings.TrimSuffix(rewritten, ";")
+		}
+	}
+	if _, err := connect.Exec(fmt.Sprintf(createMigrationBackfillTableQuery, onCluster)); err != nil {
+		connect.Close()
+		return nil, fmt.Errorf("error when creating the migration_backfill table: %v", err)
+	}
+	return b, nil
+}
+
+func (b *backfiller) close() {
+	b.connect.Close()
+}
+
+// runBackfills runs the backfills registered for a golang-migrate version
+// number, once the upgrading migrator reaching it is applied.
+func (m *Migrator) runBackfills(version int) error {
+	if len(backfills[version]) == 0 {
+		return nil
+	}
+	b, err := m.newBackfiller()
+	if err != nil {
+		return err
+	}
+	defer b.close()
+	for _, backfill := range backfills[version] {
+		if err := b.run(backfill, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeBackfills runs again the backfills registered for the golang-migrate
+// version numbers up to the version number of the data schema which were
+// started but not completed, e.g. because the previous migration failed after
+// the migrator preceding them was applied.
+func (m *Migrator) resumeBackfills(dataVersionNumber int) error {
+	registered := map[string]Backfill{}
+	var versions []int
+	for version := range backfills {
+		if version <= dataVersionNumber {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	var names []string
+	for _, version := range versions {
+		for _, backfill := range backfills[version] {
+			registered[backfill.Name] = backfill
+			names = append(names, backfill.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	b, err := m.newBackfiller()
+	if err != nil {
+		return err
+	}
+	defer b.close()
+	pending, err := b.pendingBackfills()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !pending[name] {
+			continue
+		}
+		klog.InfoS("Resume backfill", "name", name)
+		if err := b.run(registered[name], true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingBackfills returns the names of the backfills which are started but
+// not completed.
+func (b *backfiller) pendingBackfills() (map[string]bool, error) {
+	rows, err := b.connect.Query(pendingBackfillsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting the pending backfills: %v", err)
+	}
+	defer rows.Close()
+	pending := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error when scanning the pending backfills: %v", err)
+		}
+		pending[name] = true
+	}
+	return pending, rows.Err()
+}
+
+// run backfills the partitions of the table, or only the partitions which are
+// not completed yet when resuming the backfill, with the parallelism and
+// throttling of the backfill. No more partitions are started once the
+// backfill of a partition fails, and the first error is returned after the
+// running ones end. At most maxPartitions partitions are backfilled, and the
+// backfill is left pending if partitions remain, to be resumed by the next
+// run.
+func (b *backfiller) run(backfill Backfill, resume bool) error {
+	if !resume {
+		if err := b.record(backfill.Name, "", false); err != nil {
+			return err
+		}
+	}
+	partitions, err := b.remainingPartitions(backfill)
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Backfill table", "name", backfill.Name, "table", backfill.Table, "partitions", len(partitions))
+	remaining := 0
+	if b.maxPartitions > 0 && len(partitions) > b.maxPartitions {
+		remaining = len(partitions) - b.maxPartitions
+		partitions = partitions[:b.maxPartitions]
+	}
+	statement := b.rewrite(backfill.Statement)
+	parallelism := backfill.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	partitionCh := make(chan string)
+	stopCh := make(chan struct{})
+	var stopOnce sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partitionID := range partitionCh {
+				if err := b.backfillPartition(backfill, statement, partitionID); err != nil {
+					stopOnce.Do(func() {
+						firstErr = err
+						close(stopCh)
+					})
+				}
+			}
+		}()
+	}
+	var throttle <-chan time.Time
+	if backfill.Interval > 0 {
+		ticker := time.NewTicker(backfill.Interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+dispatch:
+	for i, partitionID := range partitions {
+		if i > 0 && throttle != nil {
+			select {
+			case <-stopCh:
+				break dispatch
+			case <-throttle:
+			}
+		}
+		select {
+		case <-stopCh:
+			break dispatch
+		case partitionCh <- partitionID:
+		}
+	}
+	close(partitionCh)
+	wg.Wait()
+	if firstErr != nil {
+		return fmt.Errorf("error when running backfill %s: %v", backfill.Name, firstErr)
+	}
+	if remaining > 0 {
+		klog.InfoS("Backfill paused after the maximum number of partitions per run", "name", backfill.Name, "table", backfill.Table, "maxPartitions", b.maxPartitions, "remainingPartitions", remaining)
+		return nil
+	}
+	if err := b.record(backfill.Name, "", true); err != nil {
+		return err
+	}
+	klog.InfoS("Backfill completed", "name", backfill.Name, "table", backfill.Table)
+	return nil
+}
+
+// remainingPartitions returns the active partitions of the table whose
+// backfill is not completed since the backfill was last started.
+func (b *backfiller) remainingPartitions(backfill Backfill) ([]string, error) {
+	completed := map[string]bool{}
+	rows, err := b.connect.Query(completedPartitionsQuery, backfill.Name, backfill.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting the completed partitions of backfill %s: %v", backfill.Name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var partitionID string
+		if err := rows.Scan(&partitionID); err != nil {
+			return nil, fmt.Errorf("error when scanning the completed partitions of backfill %s: %v", backfill.Name, err)
+		}
+		completed[partitionID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows, err = b.connect.Query(fmt.Sprintf(partitionsQuery, b.partsTable), backfill.Table)
+	if err != nil {
+		return nil, fmt.Errorf("error when getting the partitions of table %s: %v", backfill.Table, err)
+	}
+	defer rows.Close()
+	var partitions []string
+	for rows.Next() {
+		var partitionID string
+		if err := rows.Scan(&partitionID); err != nil {
+			return nil, fmt.Errorf("error when scanning the partitions of table %s: %v", backfill.Table, err)
+		}
+		if !completed[partitionID] {
+			partitions = append(partitions, partitionID)
+		}
+	}
+	return partitions, rows.Err()
+}
+
+// backfillPartition executes the statement for a partition, waits for its
+// mutation to be done if it is a mutation, and records that the partition is
+// completed.
+func (b *backfiller) backfillPartition(backfill Backfill, statement, partitionID string) error {
+	statement = strings.ReplaceAll(statement, PartitionIDPlaceholder, partitionID)
+	if err := clickhouse.RetryOnConnectionError(func() error {
+		_, err := b.connect.Exec(statement)
+		return err
+	}); err != nil {
+		return fmt.Errorf("error when backfilling partition %s of table %s: %v", partitionID, backfill.Table, err)
+	}
+	if mutationStatementRegex.MatchString(statement) {
+		if err := b.waitForMutation(backfill.Table, partitionID); err != nil {
+			return err
+		}
+	}
+	klog.V(2).InfoS("Backfilled partition", "name", backfill.Name, "table", backfill.Table, "partition", partitionID)
+	return b.record(backfill.Name, partitionID, true)
+}
+
+// waitForMutation waits for the mutations of a partition of the table to be
+// done, and fails as soon as one of them fails.
+func (b *backfiller) waitForMutation(table, partitionID string) error {
+	query := fmt.Sprintf(partitionMutationsQuery, b.mutationsTable)
+	partition := fmt.Sprintf("PARTITION ID '%s'", partitionID)
+	if err := wait.PollImmediate(backfillPollInterval, backfillPollTimeout, func() (bool, error) {
+		var notDone uint64
+		var failReason string
+		if err := b.connect.QueryRow(query, table, partition).Scan(&notDone, &failReason); err != nil {
+			klog.ErrorS(err, "Failed to get the mutations of the partition", "table", table, "partition", partitionID)
+			return false, nil
+		}
+		if failReason != "" {
+			return false, fmt.Errorf("mutation failed: %s", failReason)
+		}
+		return notDone == 0, nil
+	}); err != nil {
+		return fmt.Errorf("error when waiting for the mutation of partition %s of table %s: %v", partitionID, table, err)
+	}
+	return nil
+}
+
+// record inserts in the migration_backfill table that a partition is
+// completed, or that the backfill is started or completed if the partition
+// is empty.
+func (b *backfiller) record(name, partitionID string, completed bool) error {
+	var status uint8
+	if completed {
+		status = 1
+	}
+	tx, err := b.connect.Begin()
+	if err != nil {
+		return fmt.Errorf("error when beginning the insertion of the backfill status: %v", err)
+	}
+	stmt, err := tx.Prepare(insertMigrationBackfillQuery)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error when preparing the insertion of the backfill status: %v", err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(name, partitionID, status); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error when inserting the backfill status: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error when committing the insertion of the backfill status: %v", err)
+	}
+	return nil
+}
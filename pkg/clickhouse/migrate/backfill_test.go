@@ -0,0 +1,207 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBackfillName = "0-8-0/flows_local/egressName"
+	testMutation     = "ALTER TABLE flows_local UPDATE egressName = egressIP IN PARTITION ID '{partitionID}' WHERE egressName = ''"
+)
+
+func expectBackfillRecord(mock sqlmock.Sqlmock, partitionID string, completed uint8) {
+	mock.ExpectBegin()
+	mock.ExpectPrepare(insertMigrationBackfillQuery).ExpectExec().WithArgs(testBackfillName, partitionID, completed).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func expectPartitions(mock sqlmock.Sqlmock, partsTable string, completed []string, partitions []string) {
+	completedRows := sqlmock.NewRows([]string{"partitionID"})
+	for _, partitionID := range completed {
+		completedRows.AddRow(partitionID)
+	}
+	mock.ExpectQuery(completedPartitionsQuery).WithArgs(testBackfillName, testBackfillName).WillReturnRows(completedRows)
+	partitionRows := sqlmock.NewRows([]string{"partition_id"})
+	for _, partitionID := range partitions {
+		partitionRows.AddRow(partitionID)
+	}
+	mock.ExpectQuery(fmt.Sprintf(partitionsQuery, partsTable)).WithArgs("flows_local").WillReturnRows(partitionRows)
+}
+
+func TestBackfill(t *testing.T) {
+	backfillPollInterval = time.Millisecond
+	defer func() { backfillPollInterval = 5 * time.Second }()
+	mutationsQuery := fmt.Sprintf(partitionMutationsQuery, "system.mutations")
+
+	testCases := []struct {
+		name             string
+		config           Config
+		backfill         Backfill
+		resume           bool
+		expectQueries    func(mock sqlmock.Sqlmock)
+		expectedErrorMsg string
+	}{
+		{
+			name:     "Backfill with mutations",
+			backfill: Backfill{Name: testBackfillName, Table: "flows_local", Statement: testMutation},
+			expectQueries: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(fmt.Sprintf(createMigrationBackfillTableQuery, "")).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectBackfillRecord(mock, "", 0)
+				expectPartitions(mock, "system.parts", nil, []string{"202306", "202307"})
+				for _, partitionID := range []string{"202306", "202307"} {
+					mock.ExpectExec(fmt.Sprintf("ALTER TABLE flows_local UPDATE egressName = egressIP IN PARTITION ID '%s' WHERE egressName = ''", partitionID)).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+					partition := fmt.Sprintf("PARTITION ID '%s'", partitionID)
+					mock.ExpectQuery(mutationsQuery).WithArgs("flows_local", partition).
+						WillReturnRows(sqlmock.NewRows([]string{"not_done", "latest_fail_reason"}).AddRow(uint64(1), ""))
+					mock.ExpectQuery(mutationsQuery).WithArgs("flows_local", partition).
+						WillReturnRows(sqlmock.NewRows([]string{"not_done", "latest_fail_reason"}).AddRow(uint64(0), ""))
+					expectBackfillRecord(mock, partitionID, 1)
+				}
+				expectBackfillRecord(mock, "", 1)
+			},
+		},
+		{
+			name:     "Failed mutation",
+			backfill: Backfill{Name: testBackfillName, Table: "flows_local", Statement: testMutation},
+			expectQueries: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(fmt.Sprintf(createMigrationBackfillTableQuery, "")).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectBackfillRecord(mock, "", 0)
+				expectPartitions(mock, "system.parts", nil, []string{"202306", "202307"})
+				mock.ExpectExec("ALTER TABLE flows_local UPDATE egressName = egressIP IN PARTITION ID '202306' WHERE egressName = ''").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mutationsQuery).WithArgs("flows_local", "PARTITION ID '202306'").
+					WillReturnRows(sqlmock.NewRows([]string{"not_done", "latest_fail_reason"}).AddRow(uint64(1), "Memory limit exceeded"))
+			},
+			expectedErrorMsg: "error when running backfill 0-8-0/flows_local/egressName: error when waiting for the mutation of partition 202306 of table flows_local: mutation failed: Memory limit exceeded",
+		},
+		{
+			name:   "Resume on cluster",
+			config: Config{Cluster: "clickhouse"},
+			backfill: Backfill{
+				Name:      testBackfillName,
+				Table:     "flows_local",
+				Statement: "INSERT INTO flows_local SELECT * FROM flows_old_local WHERE toYYYYMM(timeInserted) = {partitionID}",
+			},
+			resume: true,
+			expectQueries: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(fmt.Sprintf(createMigrationBackfillTableQuery, " ON CLUSTER 'clickhouse'")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(pendingBackfillsQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(testBackfillName))
+				expectPartitions(mock, "cluster('clickhouse', system.parts)", []string{"202306"}, []string{"202306", "202307"})
+				mock.ExpectExec("INSERT INTO FUNCTION cluster('clickhouse', currentDatabase(), 'flows_local', rand()) SELECT * FROM cluster('clickhouse', currentDatabase(), 'flows_old_local') WHERE toYYYYMM(timeInserted) = 202307").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectBackfillRecord(mock, "202307", 1)
+				expectBackfillRecord(mock, "", 1)
+			},
+		},
+		{
+			name:   "Maximum partitions per run",
+			config: Config{MaxPartitionsPerRun: 1},
+			backfill: Backfill{
+				Name:      testBackfillName,
+				Table:     "flows_local",
+				Statement: "INSERT INTO flows_local SELECT * FROM flows_old_local WHERE toYYYYMM(timeInserted) = {partitionID}",
+			},
+			expectQueries: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(fmt.Sprintf(createMigrationBackfillTableQuery, "")).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectBackfillRecord(mock, "", 0)
+				expectPartitions(mock, "system.parts", nil, []string{"202306", "202307"})
+				mock.ExpectExec("INSERT INTO flows_local SELECT * FROM flows_old_local WHERE toYYYYMM(timeInserted) = 202306").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectBackfillRecord(mock, "202306", 1)
+				// The backfill is left pending for the next run.
+			},
+		},
+		{
+			name:     "Nothing to resume",
+			backfill: Backfill{Name: testBackfillName, Table: "flows_local", Statement: testMutation},
+			resume:   true,
+			expectQueries: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(fmt.Sprintf(createMigrationBackfillTableQuery, "")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(pendingBackfillsQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			backfills = map[int][]Backfill{5: {tc.backfill}}
+			defer func() { backfills = map[int][]Backfill{} }()
+			var mock sqlmock.Sqlmock
+			openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
+				var db *sql.DB
+				var err error
+				db, mock, err = sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					return db, err
+				}
+				mock.ExpectPing()
+				tc.expectQueries(mock)
+				return db, err
+			}
+			m := &Migrator{config: tc.config, clickHouseURL: "localhost:9000"}
+			var err error
+			if tc.resume {
+				err = m.resumeBackfills(5)
+			} else {
+				err = m.runBackfills(5)
+			}
+			if tc.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErrorMsg)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBackfillParallelism(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	defer db.Close()
+	b := &backfiller{
+		connect:        db,
+		partsTable:     "system.parts",
+		mutationsTable: "system.mutations",
+		rewrite:        func(statement string) string { return statement },
+	}
+	backfill := Backfill{
+		Name:        testBackfillName,
+		Table:       "flows_local",
+		Statement:   "INSERT INTO flows_local SELECT * FROM flows_old_local WHERE toYYYYMM(timeInserted) = {partitionID}",
+		Parallelism: 2,
+		Interval:    time.Millisecond,
+	}
+	partitions := []string{"202305", "202306", "202307"}
+	expectBackfillRecord(mock, "", 0)
+	expectPartitions(mock, "system.parts", nil, partitions)
+	mock.MatchExpectationsInOrder(false)
+	for _, partitionID := range partitions {
+		mock.ExpectExec(fmt.Sprintf("INSERT INTO flows_local SELECT * FROM flows_old_local WHERE toYYYYMM(timeInserted) = %s", partitionID)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectBackfillRecord(mock, partitionID, 1)
+	}
+	expectBackfillRecord(mock, "", 1)
+	assert.NoError(t, b.run(backfill, false))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
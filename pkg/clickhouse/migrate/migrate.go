@@ -0,0 +1,904 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate migrates the data schema of the Theia ClickHouse database
+// between Theia versions, using the migrators shipped with the ClickHouse
+// server image.
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	clickhousego "github.com/ClickHouse/clickhouse-go"
+	"github.com/golang-migrate/migrate"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/clickhouse/schema"
+	"antrea.io/theia/pkg/util/clickhouse"
+
+	_ "github.com/golang-migrate/migrate/database/clickhouse"
+	_ "github.com/golang-migrate/migrate/source/file"
+)
+
+const (
+	migratorTmpPath        = "/docker-entrypoint-initdb.d/migrators"
+	migratorPersistentPath = "/var/lib/clickhouse/migrators"
+	// defaultDatabase is the database the migrators refer to in qualified
+	// names, e.g. in the source query of a dictionary.
+	defaultDatabase = "default"
+
+	// Get the first replica of the first shard of the cluster, which applies
+	// the migrations for the whole cluster.
+	clusterLeaderQuery = "SELECT is_local, host_name, port FROM system.clusters WHERE cluster = ? ORDER BY shard_num, replica_num LIMIT 1"
+	// Get the data schema version of the first replica of the cluster.
+	leaderVersionQuery = "SELECT version, dirty FROM remote(?, currentDatabase(), schema_migrations, ?, ?) ORDER BY sequence DESC LIMIT 1"
+	// The migration_status table tells the ClickHouse monitor whether a
+	// migration is in progress, so that it does not delete records while the
+	// migrators mutate the tables. The monitor ignores an in-progress status
+	// which is not refreshed for a while, in case the migration was aborted.
+	createMigrationStatusTableQuery = `CREATE TABLE IF NOT EXISTS migration_status%s (
+    timeUpdated DateTime DEFAULT now(),
+    inProgress UInt8,
+    fromVersion Int32,
+    toVersion Int32
+) ENGINE = MergeTree
+ORDER BY (timeUpdated)
+TTL timeUpdated + INTERVAL 7 DAY`
+	insertMigrationStatusQuery = "INSERT INTO migration_status (inProgress, fromVersion, toVersion) VALUES (?, ?, ?)"
+)
+
+// Direction restricts the migrations which can be applied.
+type Direction string
+
+const (
+	// DirectionAny allows both upgrading and downgrading the data schema.
+	DirectionAny Direction = ""
+	// DirectionUp only allows upgrading the data schema.
+	DirectionUp Direction = "up"
+	// DirectionDown only allows downgrading the data schema.
+	DirectionDown Direction = "down"
+)
+
+var (
+	execCommand = exec.Command
+	readDir     = os.ReadDir
+	getEnv      = os.Getenv
+	mkdirAll    = os.MkdirAll
+	openSql     = sql.Open
+	newMigrate  = migrate.New
+	readFile    = os.ReadFile
+	writeFile   = os.WriteFile
+
+	defaultDatabaseRegex = regexp.MustCompile(`\b` + defaultDatabase + `\.`)
+	// distributedDatabaseRegex matches the database argument of the
+	// Distributed table engine.
+	distributedDatabaseRegex = regexp.MustCompile(`(Distributed\('[^']*',\s*)` + defaultDatabase + `\b`)
+	// ddlRegex matches the beginning of the DDL statements up to the name of
+	// the table, view or dictionary, followed by the ON CLUSTER clause if the
+	// statement is already executed on the cluster.
+	ddlRegex = regexp.MustCompile(`\b(CREATE\s+(?:TABLE|VIEW|MATERIALIZED\s+VIEW|DICTIONARY)\s+(?:IF\s+NOT\s+EXISTS\s+)?|DROP\s+(?:TABLE|VIEW|DICTIONARY)\s+(?:IF\s+EXISTS\s+)?|ALTER\s+TABLE\s+)((?:\w+\.)?(?:"[^"]+"|\w+))(\s+ON\s+CLUSTER\b)?`)
+	// insertRegex matches the INSERT INTO ... SELECT statements copying data
+	// between tables.
+	insertRegex = regexp.MustCompile(`(?s)\bINSERT\s+INTO\s+("[^"]+"|\w+)(.*?;)`)
+	fromRegex   = regexp.MustCompile(`\bFROM\s+("[^"]+"|\w+)`)
+
+	// schemaDDL creates the data schema of the latest version, i.e. the schema
+	// reached after applying all the upgrading migrators.
+	schemaDDL = schema.DDL()
+
+	// Interval and timeout of waiting for the first replica of the cluster to
+	// migrate the data schema.
+	leaderPollInterval = 5 * time.Second
+	leaderPollTimeout  = 10 * time.Minute
+	// Interval of refreshing the in-progress migration status, which must be
+	// shorter than the time after which the ClickHouse monitor ignores it.
+	migrationStatusInterval = 30 * time.Second
+)
+
+// Config is the configuration of a data schema migration.
+type Config struct {
+	Username    string
+	Password    string
+	DatabaseURL string
+	// Database is the ClickHouse database storing the Theia tables. The
+	// default database is used if it is empty.
+	Database string
+	// Cluster is the name of the ClickHouse cluster. If it is set, the
+	// migrations are applied once for the whole cluster, by the first replica
+	// of the first shard, using ON CLUSTER DDL.
+	Cluster string
+	// TargetVersion is the Theia version whose data schema is migrated to.
+	TargetVersion string
+	Direction     Direction
+	// Bootstrap creates the data schema of the target version from the
+	// embedded DDL if no data schema exists. Otherwise, creating the data
+	// schema is left to the init scripts of the ClickHouse server.
+	Bootstrap bool
+	// MaxPartitionsPerRun is the maximum number of partitions of each
+	// backfill processed by a run, so that the backfills of large tables can
+	// be spread across maintenance windows. The backfills with more remaining
+	// partitions are left pending, and resumed by the next runs. There is no
+	// limit if it is 0.
+	MaxPartitionsPerRun int
+	// DSNOptions are the driver options of the connections to ClickHouse. The
+	// credentials and the database are set from the fields above.
+	DSNOptions clickhouse.DSNOptions
+	// Users are created, or updated, with their least-privilege roles after
+	// the migration, so that the components of Theia do not share the
+	// credentials of the migration.
+	Users []schema.User
+}
+
+// NewConfigFromEnv returns the Config defined by the MIGRATE_USERNAME,
+// MIGRATE_PASSWORD, DB_URL, CLICKHOUSE_DATABASE, CLICKHOUSE_CLUSTER,
+// THEIA_VERSION and MAX_PARTITIONS_PER_RUN environment variables, the users
+// defined by the CLICKHOUSE_<ROLE>_USERNAME and CLICKHOUSE_<ROLE>_PASSWORD
+// environment variables, e.g. CLICKHOUSE_WRITER_USERNAME, and the driver
+// options defined by the CLICKHOUSE_DEBUG, CLICKHOUSE_COMPRESS,
+// CLICKHOUSE_READ_TIMEOUT, CLICKHOUSE_ALT_HOSTS and CLICKHOUSE_TLS_*
+// environment variables.
+func NewConfigFromEnv() (Config, error) {
+	dsnOptions, err := clickhouse.NewDSNOptionsFromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	var maxPartitionsPerRun int
+	if value := getEnv("MAX_PARTITIONS_PER_RUN"); value != "" {
+		maxPartitionsPerRun, err = strconv.Atoi(value)
+		if err != nil || maxPartitionsPerRun < 0 {
+			return Config{}, fmt.Errorf("MAX_PARTITIONS_PER_RUN should be a non-negative integer, got %q", value)
+		}
+	}
+	var users []schema.User
+	for _, role := range schema.Roles {
+		prefix := fmt.Sprintf("CLICKHOUSE_%s_", strings.ToUpper(string(role)))
+		if name := getEnv(prefix + "USERNAME"); name != "" {
+			users = append(users, schema.User{Name: name, Password: getEnv(prefix + "PASSWORD"), Role: role})
+		}
+	}
+	return Config{
+		Username:            getEnv("MIGRATE_USERNAME"),
+		Password:            getEnv("MIGRATE_PASSWORD"),
+		DatabaseURL:         getEnv("DB_URL"),
+		Database:            getEnv("CLICKHOUSE_DATABASE"),
+		Cluster:             getEnv("CLICKHOUSE_CLUSTER"),
+		TargetVersion:       getEnv("THEIA_VERSION"),
+		MaxPartitionsPerRun: maxPartitionsPerRun,
+		DSNOptions:          dsnOptions,
+		Users:               users,
+	}, nil
+}
+
+// migrator describes the migrator files sharing a golang-migrate version number.
+type migrator struct {
+	theiaVersion string
+	up           bool
+	down         bool
+}
+
+// Migrator migrates the data schema of a ClickHouse database.
+type Migrator struct {
+	config        Config
+	migrate       *migrate.Migrate
+	clickHouseURL string
+	// versionMap maps Theia version strings to golang-migrate version numbers.
+	versionMap map[string]int
+	// latestVersionNumber is the golang-migrate version number reached after
+	// applying all the upgrading migrators.
+	latestVersionNumber int
+}
+
+// New returns a Migrator for the given configuration, after making the
+// migrators shipped with the image available for future downgrades.
+func New(config Config) (*Migrator, error) {
+	if config.Direction != DirectionAny && config.Direction != DirectionUp && config.Direction != DirectionDown {
+		return nil, fmt.Errorf("invalid direction %q, it should be %q or %q", config.Direction, DirectionUp, DirectionDown)
+	}
+	m := &Migrator{config: config}
+	// Copy migrators from tmp path to persistent path for the downgrading usage in the future
+	if err := copyMigrators(); err != nil {
+		return nil, fmt.Errorf("error when copying migrators: %v", err)
+	}
+	if config.Database != "" && config.Database != defaultDatabase {
+		if err := rewriteMigrators(migratorPersistentPath, config.Database); err != nil {
+			return nil, fmt.Errorf("error when rewriting migrators for database %s: %v", config.Database, err)
+		}
+	}
+	if config.Cluster != "" {
+		if err := rewriteMigratorsForCluster(migratorPersistentPath, config.Cluster); err != nil {
+			return nil, fmt.Errorf("error when rewriting migrators for cluster %s: %v", config.Cluster, err)
+		}
+	}
+	if err := m.initializeVersionMap(); err != nil {
+		return nil, fmt.Errorf("error when generating version number map: %v", err)
+	}
+	if len(config.Username) == 0 || len(config.Password) == 0 || len(config.DatabaseURL) == 0 {
+		return nil, fmt.Errorf("unable to load environment variables, MIGRATE_USERNAME, MIGRATE_PASSWORD and DB_URL must be defined")
+	}
+	for _, user := range config.Users {
+		if err := schema.ValidateUser(user); err != nil {
+			return nil, err
+		}
+	}
+	dsnOptions := config.DSNOptions
+	dsnOptions.Credentials = &clickhouse.StaticCredentials{Username: config.Username, Password: config.Password}
+	dsnOptions.Database = config.Database
+	if err := dsnOptions.RegisterTLSConfig(); err != nil {
+		return nil, err
+	}
+	clickHouseURL, err := dsnOptions.DSN(config.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	m.clickHouseURL = clickHouseURL
+	migrateDatabaseURL := fmt.Sprintf("clickhouse://%s&x-multi-statement=true", m.clickHouseURL)
+	migrateSourceURL := fmt.Sprintf("file://%s", migratorPersistentPath)
+	clickhouseMigrate, err := newMigrate(migrateSourceURL, migrateDatabaseURL)
+	if err != nil {
+		// The errors of golang-migrate may include the URL of the database.
+		return nil, fmt.Errorf("error when creating a Migrate instance for ClickHouse: %s", clickhouse.ScrubDSN(err.Error()))
+	}
+	m.migrate = clickhouseMigrate
+	return m, nil
+}
+
+// Close releases the source and database connections of the Migrator.
+func (m *Migrator) Close() error {
+	sourceErr, databaseErr := m.migrate.Close()
+	if sourceErr != nil {
+		return sourceErr
+	}
+	return databaseErr
+}
+
+// Run gets the target and data version numbers, and migrates if they are
+// different.
+func (m *Migrator) Run() error {
+	targetVersionNumber, err := m.getTargetVersionNumber()
+	if err != nil {
+		return fmt.Errorf("error when getting Theia version: %v", err)
+	}
+	if m.config.Cluster != "" {
+		isLeader, leaderAddress, err := m.getClusterLeader()
+		if err != nil {
+			return fmt.Errorf("error when getting the first replica of cluster %s: %v", m.config.Cluster, err)
+		}
+		if !isLeader {
+			klog.InfoS("Data schema is migrated by the first replica of the cluster", "cluster", m.config.Cluster, "address", leaderAddress)
+			if err := m.waitForLeader(leaderAddress, targetVersionNumber); err != nil {
+				return err
+			}
+			if err := m.migrate.Force(targetVersionNumber); err != nil {
+				return fmt.Errorf("error when setting version: %v", err)
+			}
+			return nil
+		}
+	}
+	dataVersionNumber, err := m.getDataVersionNumber()
+	if err != nil {
+		return fmt.Errorf("error when getting the data version: %v", err)
+	}
+	if dataVersionNumber >= 0 {
+		if err := m.resumeBackfills(dataVersionNumber); err != nil {
+			return fmt.Errorf("error when resuming the backfills: %v", err)
+		}
+	}
+	if targetVersionNumber == dataVersionNumber {
+		klog.InfoS("Data schema version is the same as Theia version. Migration skipped.")
+	} else if dataVersionNumber == -1 {
+		if m.config.Bootstrap {
+			klog.InfoS("No existing data schema. Bootstrap data schema", "version", targetVersionNumber)
+			resume, err := m.pauseMonitor(dataVersionNumber, targetVersionNumber)
+			if err != nil {
+				return fmt.Errorf("error when pausing the deletions of the ClickHouse monitor: %v", err)
+			}
+			err = m.bootstrap(targetVersionNumber)
+			resume()
+			if err != nil {
+				return fmt.Errorf("error when bootstrapping the data schema: %v", err)
+			}
+		} else {
+			klog.InfoS("No existing data schema. Migration skipped.")
+		}
+	} else {
+		if m.config.Direction == DirectionUp && targetVersionNumber < dataVersionNumber {
+			return fmt.Errorf("migrating from version %d to %d is a downgrade, but direction is %s", dataVersionNumber, targetVersionNumber, m.config.Direction)
+		}
+		if m.config.Direction == DirectionDown && targetVersionNumber > dataVersionNumber {
+			return fmt.Errorf("migrating from version %d to %d is an upgrade, but direction is %s", dataVersionNumber, targetVersionNumber, m.config.Direction)
+		}
+		klog.InfoS("Migrate data schema", "from", dataVersionNumber, "to", targetVersionNumber)
+		resume, err := m.pauseMonitor(dataVersionNumber, targetVersionNumber)
+		if err != nil {
+			return fmt.Errorf("error when pausing the deletions of the ClickHouse monitor: %v", err)
+		}
+		// The migration is not blocked by a failure to report its progress.
+		stopTracking, err := m.trackProgress(dataVersionNumber, targetVersionNumber)
+		if err != nil {
+			klog.ErrorS(err, "Failed to track the progress of the migration")
+			stopTracking = func() {}
+		}
+		err = m.applyMigrations(dataVersionNumber, targetVersionNumber)
+		stopTracking()
+		resume()
+		if err != nil {
+			return fmt.Errorf("error when applying migrations: %v", err)
+		}
+	}
+	// Set the data schema version to the target version anyway, as we expect
+	// initial data will be created even if the migration is skipped.
+	err = m.migrate.Force(targetVersionNumber)
+	if err != nil {
+		return fmt.Errorf("error when setting version: %v", err)
+	}
+	if len(m.config.Users) > 0 {
+		if err := m.createUsers(); err != nil {
+			return fmt.Errorf("error when creating users: %v", err)
+		}
+	}
+	return nil
+}
+
+// createUsers creates the roles of the database, and the users of the
+// configuration with their roles. In a cluster, they are created on all the
+// servers by the first replica, like the migrations.
+func (m *Migrator) createUsers() error {
+	statements := schema.RolesDDL(m.config.Database, m.config.Cluster)
+	for _, user := range m.config.Users {
+		userStatements, err := schema.UserDDL(user, m.config.Database, m.config.Cluster)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, userStatements...)
+	}
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	defer connect.Close()
+	for _, statement := range statements {
+		if _, err := connect.Exec(statement); err != nil {
+			// The statements creating the users hold their passwords.
+			message := err.Error()
+			for _, user := range m.config.Users {
+				message = strings.ReplaceAll(message, user.Password, "***")
+			}
+			return fmt.Errorf("error when executing %q: %s", strings.SplitN(statement, " IDENTIFIED ", 2)[0], message)
+		}
+	}
+	for _, user := range m.config.Users {
+		klog.InfoS("Created ClickHouse user", "user", user.Name, "role", user.Role)
+	}
+	return nil
+}
+
+// pauseMonitor records in the migration_status table that a migration from one
+// golang-migrate version number to another is in progress, so that the
+// ClickHouse monitor does not delete records while the migrators mutate the
+// tables and change the data schema. The status is refreshed periodically
+// until the returned function is called, which records that the migration is
+// completed and resumes the deletions.
+func (m *Migrator) pauseMonitor(from, to int) (func(), error) {
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return nil, fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	onCluster := ""
+	if m.config.Cluster != "" {
+		onCluster = fmt.Sprintf(" ON CLUSTER '%s'", m.config.Cluster)
+	}
+	if _, err := connect.Exec(fmt.Sprintf(createMigrationStatusTableQuery, onCluster)); err != nil {
+		connect.Close()
+		return nil, fmt.Errorf("error when creating the migration_status table: %v", err)
+	}
+	if err := setMigrationStatus(connect, true, from, to); err != nil {
+		connect.Close()
+		return nil, err
+	}
+	klog.InfoS("Paused the deletions of the ClickHouse monitor during the migration")
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(migrationStatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := setMigrationStatus(connect, true, from, to); err != nil {
+					klog.ErrorS(err, "Failed to refresh the migration status")
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+		defer connect.Close()
+		// The monitor resumes the deletions anyway once the in-progress
+		// status is not refreshed anymore.
+		if err := setMigrationStatus(connect, false, from, to); err != nil {
+			klog.ErrorS(err, "Failed to resume the deletions of the ClickHouse monitor")
+			return
+		}
+		klog.InfoS("Resumed the deletions of the ClickHouse monitor after the migration")
+	}, nil
+}
+
+// setMigrationStatus inserts the status of the migration from one
+// golang-migrate version number to another in the migration_status table.
+func setMigrationStatus(connect *sql.DB, inProgress bool, from, to int) error {
+	var status uint8
+	if inProgress {
+		status = 1
+	}
+	tx, err := connect.Begin()
+	if err != nil {
+		return fmt.Errorf("error when beginning the insertion of the migration status: %v", err)
+	}
+	stmt, err := tx.Prepare(insertMigrationStatusQuery)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error when preparing the insertion of the migration status: %v", err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(status, int32(from), int32(to)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error when inserting the migration status: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error when committing the insertion of the migration status: %v", err)
+	}
+	return nil
+}
+
+// applyMigrations migrates the data schema from one golang-migrate version
+// number to another, one version at a time. Upgrading migrators are applied in
+// ascending order and downgrading migrators in descending order, so that
+// versions can be skipped in both directions. The backfills registered for a
+// version number are run once the upgrading migrator reaching it is applied.
+func (m *Migrator) applyMigrations(from, to int) error {
+	if from < 0 || to < 0 || from > m.latestVersionNumber || to > m.latestVersionNumber {
+		return fmt.Errorf("no migrators to migrate from version %d to %d, the latest version is %d", from, to, m.latestVersionNumber)
+	}
+	step := 1
+	if to < from {
+		step = -1
+	}
+	for version := from; version != to; version += step {
+		klog.V(2).InfoS("Applying migration", "version", version, "step", step)
+		if err := m.migrate.Steps(step); err != nil {
+			return fmt.Errorf("error when migrating from version %d to %d: %v", version, version+step, err)
+		}
+		// The backfills populate the columns added by upgrading migrators.
+		if step > 0 {
+			if err := m.runBackfills(version + step); err != nil {
+				return fmt.Errorf("error when backfilling version %d: %v", version+step, err)
+			}
+		}
+	}
+	return nil
+}
+
+// bootstrap creates the data schema of the latest version from the embedded
+// DDL, rewritten for the database and the cluster like the migrators, then
+// downgrades it to the target version if it is an earlier version.
+func (m *Migrator) bootstrap(targetVersionNumber int) error {
+	ddl := schemaDDL
+	if m.config.Database != "" && m.config.Database != defaultDatabase {
+		ddl = rewriteForDatabase(ddl, m.config.Database)
+	}
+	if m.config.Cluster != "" {
+		ddl = rewriteForCluster(ddl, m.config.Cluster)
+	}
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	defer connect.Close()
+	for _, statement := range schema.SplitStatements(ddl) {
+		if _, err := connect.Exec(statement); err != nil {
+			return fmt.Errorf("error when executing %q: %v", strings.SplitN(statement, "\n", 2)[0], err)
+		}
+	}
+	if err := m.migrate.Force(m.latestVersionNumber); err != nil {
+		return fmt.Errorf("error when setting version: %v", err)
+	}
+	if targetVersionNumber < m.latestVersionNumber {
+		klog.InfoS("Migrate bootstrapped data schema", "from", m.latestVersionNumber, "to", targetVersionNumber)
+		if err := m.applyMigrations(m.latestVersionNumber, targetVersionNumber); err != nil {
+			return fmt.Errorf("error when applying migrations: %v", err)
+		}
+	}
+	return nil
+}
+
+func copyMigrators() error {
+	if err := mkdirAll(migratorPersistentPath, os.ModeDir); err != nil {
+		return fmt.Errorf("error when creating folder: %s, error: %v", migratorPersistentPath, err)
+	}
+	// Not sanitize migratorTmpPath and migratorPersistentPath as they are constant.
+	sourcePath := fmt.Sprintf("%s/.", migratorTmpPath)
+	cmd := execCommand("cp", "-r", sourcePath, migratorPersistentPath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error when copying files, error: %v", err)
+	}
+	return nil
+}
+
+// rewriteMigrators replaces the default database in the qualified names, and in
+// the Distributed table engines, of the migrators in dir with the given
+// database. Unqualified names refer to the database of the connection, and do
+// not need to be rewritten.
+func rewriteMigrators(dir, database string) error {
+	files, err := readDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to get files in folder migrators: %v", err)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		content, err := readFile(path)
+		if err != nil {
+			return fmt.Errorf("error when reading migrator %s: %v", file.Name(), err)
+		}
+		rewritten := rewriteForDatabase(string(content), database)
+		if err := writeFile(path, []byte(rewritten), 0644); err != nil {
+			return fmt.Errorf("error when writing migrator %s: %v", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// rewriteForDatabase replaces the default database in the qualified names, and
+// in the Distributed table engines, of the DDL with the given database.
+func rewriteForDatabase(ddl, database string) string {
+	rewritten := defaultDatabaseRegex.ReplaceAllString(ddl, database+".")
+	return distributedDatabaseRegex.ReplaceAllString(rewritten, "${1}"+database)
+}
+
+// rewriteMigratorsForCluster adds the ON CLUSTER clause to the DDL statements of
+// the migrators in dir, so that they are executed on all the servers of the
+// cluster. The INSERT INTO ... SELECT statements, which cannot be executed on
+// the cluster, are rewritten to read the data of all the shards and to write
+// the data distributed across the shards, with the cluster table function.
+// Migrators which are already rewritten are left unchanged.
+func rewriteMigratorsForCluster(dir, cluster string) error {
+	files, err := readDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to get files in folder migrators: %v", err)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		content, err := readFile(path)
+		if err != nil {
+			return fmt.Errorf("error when reading migrator %s: %v", file.Name(), err)
+		}
+		rewritten := rewriteForCluster(string(content), cluster)
+		if err := writeFile(path, []byte(rewritten), 0644); err != nil {
+			return fmt.Errorf("error when writing migrator %s: %v", file.Name(), err)
+		}
+	}
+	return nil
+}
+
+// rewriteForCluster adds the ON CLUSTER clause to the DDL statements, and
+// rewrites the INSERT INTO ... SELECT statements with the cluster table
+// function. Statements which are already rewritten are left unchanged.
+func rewriteForCluster(ddl, cluster string) string {
+	clusterTable := func(name string) string {
+		return fmt.Sprintf("cluster('%s', currentDatabase(), '%s'", cluster, strings.Trim(name, `"`))
+	}
+	rewritten := ddlRegex.ReplaceAllStringFunc(ddl, func(statement string) string {
+		groups := ddlRegex.FindStringSubmatch(statement)
+		if groups[3] != "" {
+			return statement
+		}
+		return fmt.Sprintf("%s%s ON CLUSTER '%s'", groups[1], groups[2], cluster)
+	})
+	return insertRegex.ReplaceAllStringFunc(rewritten, func(statement string) string {
+		groups := insertRegex.FindStringSubmatch(statement)
+		if groups[1] == "FUNCTION" {
+			return statement
+		}
+		body := fromRegex.ReplaceAllStringFunc(groups[2], func(from string) string {
+			return fmt.Sprintf("FROM %s)", clusterTable(fromRegex.FindStringSubmatch(from)[1]))
+		})
+		return fmt.Sprintf("INSERT INTO FUNCTION %s, rand())%s", clusterTable(groups[1]), body)
+	})
+}
+
+// Use the file names to map the Theia version string to golang-migrate version number
+func (m *Migrator) initializeVersionMap() error {
+	files, err := readDir(migratorPersistentPath)
+	if err != nil {
+		return fmt.Errorf("unable to get files in folder migrators: %v", err)
+	}
+	m.versionMap = make(map[string]int)
+	migrators := make(map[int]*migrator)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		// fileName example: 000001_0-1-0.down.sql
+		versionNumber, version, err := schema.ParseMigratorFileName(file.Name())
+		if err != nil {
+			return err
+		}
+		mi, ok := migrators[versionNumber]
+		if !ok {
+			mi = &migrator{theiaVersion: version}
+			migrators[versionNumber] = mi
+		} else if mi.theiaVersion != version {
+			return fmt.Errorf("migrators for version %s and %s have the same version number %d", mi.theiaVersion, version, versionNumber)
+		}
+		if strings.HasSuffix(file.Name(), ".up.sql") {
+			mi.up = true
+		} else if strings.HasSuffix(file.Name(), ".down.sql") {
+			mi.down = true
+		}
+		// File <golang-migrate-version>_<theia-version>.up.sql is expected to be
+		// applied when upgrading from <theia-version>.
+		// golang-migrate applies this file when upgrading from <golang-migrate-version> - 1.
+		m.versionMap[version] = versionNumber - 1
+	}
+	return m.validateMigrators(migrators)
+}
+
+// validateMigrators checks that the migrators form a single chain: version
+// numbers start from 1 without gaps, every version number has both an
+// upgrading and a downgrading migrator, and Theia versions increase with
+// version numbers.
+func (m *Migrator) validateMigrators(migrators map[int]*migrator) error {
+	for versionNumber := 1; versionNumber <= len(migrators); versionNumber++ {
+		mi, ok := migrators[versionNumber]
+		if !ok {
+			return fmt.Errorf("migrators for version number %d are missing", versionNumber)
+		}
+		if !mi.up || !mi.down {
+			return fmt.Errorf("both upgrading and downgrading migrators are required for version %s", mi.theiaVersion)
+		}
+		if versionNumber == 1 {
+			continue
+		}
+		previous := migrators[versionNumber-1].theiaVersion
+		less, err := versionLessThan(previous, mi.theiaVersion)
+		if err != nil {
+			return fmt.Errorf("error when comparing version %s and %s: %v", previous, mi.theiaVersion, err)
+		}
+		if !less {
+			return fmt.Errorf("version %s should be later than version %s as its migrators have a higher version number", mi.theiaVersion, previous)
+		}
+	}
+	m.latestVersionNumber = len(migrators)
+	return nil
+}
+
+// Get the version number of the target Theia version
+func (m *Migrator) getTargetVersionNumber() (int, error) {
+	targetVersion := m.config.TargetVersion
+	if len(targetVersion) == 0 {
+		return 0, fmt.Errorf("unable to load environment variables, THEIA_VERSION must be defined")
+	}
+	targetVersionNumber, err := m.getVersionNumber(targetVersion)
+	if err != nil {
+		return targetVersionNumber, fmt.Errorf("error when getting theia version number for %s: %v", targetVersion, err)
+	}
+	return targetVersionNumber, nil
+}
+
+// From v0.3, get data version based on version table
+// For v0.1 and v0.2, determine version based on tables in database
+func (m *Migrator) getDataVersionNumber() (int, error) {
+	var version int
+	// Get data version for version before v0.3
+	versionStr, err := m.getDataVersionBasedOnTables()
+	if err != nil {
+		return 0, fmt.Errorf("error when getting data version based on tables: %v", err)
+	}
+	// Get data version for version after v0.3
+	uintVersion, _, err := m.migrate.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return version, fmt.Errorf("error when getting migration version: %v", err)
+	}
+	// The tables of v0.1 and v0.2 remain after upgrading to v0.3 or later,
+	// when golang-migrate records the version.
+	if err == nil {
+		return int(uintVersion), nil
+	}
+	if versionStr != "" {
+		version, err = m.getVersionNumber(versionStr)
+		if err != nil {
+			return version, fmt.Errorf("error when getting version number for %s: %v", versionStr, err)
+		}
+		if version > 0 {
+			// Set data version for golang-migrate tool
+			err = m.migrate.Force(version)
+			if err != nil {
+				return 0, fmt.Errorf("error when collarating data version: %v", err)
+			}
+		}
+		return version, nil
+	}
+	// No data schema created before
+	return -1, nil
+}
+
+func (m *Migrator) getVersionNumber(version string) (int, error) {
+	versionNumber, ok := m.versionMap[version]
+	if !ok {
+		var err error
+		// In case data schema does not change between version A and B (assuming B is the later version)
+		// we will not have file xxx_A.up.sql and xxx_A.down.sql
+		// In migration, we can treat version A the same as version C,
+		// which is the first version after A having data schema changes comparing its next version.
+		versionNumber, err = m.roundUpVersion(version)
+		if err != nil {
+			return versionNumber, fmt.Errorf("error when rounding up version: %v", err)
+		}
+	}
+	return versionNumber, nil
+}
+
+func (m *Migrator) roundUpVersion(version string) (int, error) {
+	var versionNumber int
+	for key, value := range m.versionMap {
+		less, err := versionLessThan(key, version)
+		if err != nil {
+			return versionNumber, fmt.Errorf("error when comparing version %s and %s: %v", key, version, err)
+		}
+		if less && (versionNumber < value+1) {
+			versionNumber = value + 1
+		}
+	}
+	return versionNumber, nil
+}
+
+// Return true if version a is earlier than version b.
+func versionLessThan(a, b string) (bool, error) {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as); i++ {
+		xi, err := strconv.Atoi(as[i])
+		if err != nil {
+			return false, fmt.Errorf("error when parsing version %s: %v", a, err)
+		}
+		yi, err := strconv.Atoi(bs[i])
+		if err != nil {
+			return false, fmt.Errorf("error when parsing version %s: %v", b, err)
+		}
+		if xi == yi {
+			continue
+		}
+		return (xi < yi), nil
+	}
+	return false, nil
+}
+
+// getDataVersionBasedOnTables returns the data schema version of Theia v0.1
+// and v0.2, which do not use golang-migrate, based on the tables in the
+// database. It returns an empty string if no such data schema is found.
+func (m *Migrator) getDataVersionBasedOnTables() (string, error) {
+	// Query to ClickHouse time out if it fails for 10 seconds.
+	queryTimeout := 10 * time.Second
+	// Retry query to ClickHouse every second if it fails.
+	queryRetryInterval := 1 * time.Second
+
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return "", fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	defer connect.Close()
+	var version string
+	var detectErr error
+	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
+		version, detectErr = detectLegacyVersion(connect)
+		return detectErr == nil, nil
+	}); err != nil {
+		if detectErr != nil {
+			return "", detectErr
+		}
+		return "", err
+	}
+	return version, nil
+}
+
+// getClusterLeader returns whether this server is the first replica of the
+// first shard of the cluster, and the address of that replica.
+func (m *Migrator) getClusterLeader() (bool, string, error) {
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return false, "", fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	defer connect.Close()
+	var isLocal uint8
+	var host string
+	var port uint16
+	if err := connect.QueryRow(clusterLeaderQuery, m.config.Cluster).Scan(&isLocal, &host, &port); err != nil {
+		return false, "", err
+	}
+	return isLocal == 1, net.JoinHostPort(host, fmt.Sprint(port)), nil
+}
+
+// waitForLeader waits until the first replica of the cluster has migrated the
+// data schema to the target version. As the migrations are applied with
+// ON CLUSTER DDL, the data schema of this server is migrated as well.
+func (m *Migrator) waitForLeader(leaderAddress string, targetVersionNumber int) error {
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	defer connect.Close()
+	if err := wait.PollImmediate(leaderPollInterval, leaderPollTimeout, func() (bool, error) {
+		var version int
+		var dirty uint8
+		if err := connect.QueryRow(leaderVersionQuery, leaderAddress, m.config.Username, m.config.Password).Scan(&version, &dirty); err != nil {
+			klog.V(2).InfoS("Failed to get the data version of the first replica of the cluster", "address", leaderAddress, "error", err)
+			return false, nil
+		}
+		return version == targetVersionNumber && dirty == 0, nil
+	}); err != nil {
+		return fmt.Errorf("error when waiting for %s to migrate the data schema to version %d: %v", leaderAddress, targetVersionNumber, err)
+	}
+	return nil
+}
+
+func (m *Migrator) connectClickHouse() (*sql.DB, error) {
+	var connect *sql.DB
+	var connErr error
+	connRetryInterval := 1 * time.Second
+	connTimeout := 10 * time.Second
+
+	// Connect to ClickHouse in a loop
+	if err := wait.PollImmediate(connRetryInterval, connTimeout, func() (bool, error) {
+		// Open the database and ping it
+		var err error
+		url := fmt.Sprintf("tcp://%s", m.clickHouseURL)
+		connect, err = openSql("clickhouse", url)
+		if err != nil {
+			connErr = fmt.Errorf("failed to open ClickHouse: %s", clickhouse.ScrubDSN(err.Error()))
+			return false, nil
+		}
+		if err := connect.Ping(); err != nil {
+			if exception, ok := err.(*clickhousego.Exception); ok {
+				connErr = fmt.Errorf("failed to ping ClickHouse: %v", exception.Message)
+			} else {
+				connErr = fmt.Errorf("failed to ping ClickHouse: %s", clickhouse.ScrubDSN(err.Error()))
+			}
+			return false, nil
+		} else {
+			return true, nil
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("failed to connect to ClickHouse after %s: %v", connTimeout, connErr)
+	}
+	return connect, nil
+}
@@ -0,0 +1,839 @@
+// Copyright 2022 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-migrate/migrate"
+	"github.com/golang-migrate/migrate/database"
+	dStub "github.com/golang-migrate/migrate/database/stub"
+	"github.com/golang-migrate/migrate/source"
+	sStub "github.com/golang-migrate/migrate/source/stub"
+	"github.com/stretchr/testify/assert"
+
+	"antrea.io/theia/pkg/clickhouse/schema"
+)
+
+// fakeDirEntry implements os.DirEntry interface
+type fakeDirEntry struct {
+	name  string
+	isDir bool
+}
+
+func (f fakeDirEntry) Name() string {
+	return f.name
+}
+func (f fakeDirEntry) IsDir() bool {
+	return f.isDir
+}
+func (f fakeDirEntry) Type() fs.FileMode {
+	return 0
+}
+func (f fakeDirEntry) Info() (fs.FileInfo, error) {
+	return nil, nil
+}
+
+type migrationSequence []*migrate.Migration
+
+func (m *migrationSequence) bodySequence() []string {
+	r := make([]string, 0)
+	for _, v := range *m {
+		if v.Body != nil {
+			body, err := io.ReadAll(v.Body)
+			if err != nil {
+				panic(err)
+			}
+			v.Body = io.NopCloser(bytes.NewReader(body))
+
+			r = append(r, string(body[:]))
+		} else {
+			r = append(r, "<empty>")
+		}
+	}
+	return r
+}
+
+// mr is a convenience func to create a new *Migration from the raw database query
+func mr(value string) *migrate.Migration {
+	return &migrate.Migration{
+		Body: io.NopCloser(strings.NewReader(value)),
+	}
+}
+
+var (
+	sourceInstance   source.Driver
+	databaseInstance database.Driver
+	fakeExecCommand  = func(name string, arg ...string) *exec.Cmd {
+		cmdArr := []string{name}
+		cmdArr = append(cmdArr, arg...)
+		return exec.Command("echo", cmdArr...)
+	}
+
+	fakeReadDir = func(name string) ([]os.DirEntry, error) {
+		fileUpEntry1 := fakeDirEntry{name: "000001_0-1-0.up.sql", isDir: false}
+		fileDownEntry1 := fakeDirEntry{name: "000001_0-1-0.down.sql", isDir: false}
+		fileUpEntry2 := fakeDirEntry{name: "000002_0-3-0.up.sql", isDir: false}
+		fileDownEntry2 := fakeDirEntry{name: "000002_0-3-0.down.sql", isDir: false}
+		fileUpEntry3 := fakeDirEntry{name: "000003_0-5-0.up.sql", isDir: false}
+		fileDownEntry3 := fakeDirEntry{name: "000003_0-5-0.down.sql", isDir: false}
+		folderEntry := fakeDirEntry{name: "folder", isDir: true}
+		return []os.DirEntry{fileUpEntry1, fileDownEntry1, fileUpEntry2, fileDownEntry2, fileUpEntry3, fileDownEntry3, folderEntry}, nil
+	}
+
+	fakeGetEnv = func(key string) string {
+		switch key {
+		case "MIGRATE_USERNAME":
+			return "username"
+		case "MIGRATE_PASSWORD":
+			return "password"
+		case "DB_URL":
+			return "localhost:9000"
+		case "THEIA_VERSION":
+			return "0.4.0"
+		default:
+			return ""
+		}
+	}
+
+	fakeMkdirAll = func(path string, perm fs.FileMode) error {
+		return nil
+	}
+
+	fakeNewMigrate = func(sourceURL, databaseURL string) (*migrate.Migrate, error) {
+		sourceStubMigrations := source.NewMigrations()
+		sourceStubMigrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+		sourceStubMigrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+		sourceStubMigrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+		sourceStubMigrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP 2"})
+		sourceStubMigrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+		sourceStubMigrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+		sourceInstance.(*sStub.Stub).Migrations = sourceStubMigrations
+
+		return migrate.NewWithInstance("stub://", sourceInstance, "stub://", databaseInstance)
+	}
+)
+
+// expectTrackProgress expects the migration_progress table to be created,
+// and the progress to be polled once when the migration is completed, without
+// any mutation or copy.
+func expectTrackProgress(mock sqlmock.Sqlmock, onCluster, mutationsTable string) {
+	mock.ExpectExec(fmt.Sprintf(createMigrationProgressTableQuery, onCluster)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(fmt.Sprintf(mutationProgressQuery, mutationsTable)).WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"table", "mutation_id", "parts_to_do"}))
+	mock.ExpectQuery(copyProgressQuery).WillReturnRows(sqlmock.NewRows([]string{"table", "query_id", "read_rows", "total_rows_approx"}))
+}
+
+// expectPauseMonitor expects the migration_status table to be created, and
+// the migration to be recorded as in progress and then as completed.
+func expectPauseMonitor(mock sqlmock.Sqlmock, onCluster string, from, to interface{}) {
+	mock.ExpectExec(fmt.Sprintf(createMigrationStatusTableQuery, onCluster)).WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, inProgress := range []uint8{1, 0} {
+		mock.ExpectBegin()
+		mock.ExpectPrepare(insertMigrationStatusQuery).ExpectExec().WithArgs(inProgress, from, to).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+}
+
+func TestSchemaManagement(t *testing.T) {
+	execCommand = fakeExecCommand
+	readDir = fakeReadDir
+	getEnv = fakeGetEnv
+	mkdirAll = fakeMkdirAll
+	newMigrate = fakeNewMigrate
+	checkMigrations(t)
+	checkErrorMsg(t)
+}
+
+func checkMigrations(t *testing.T) {
+	testcases := []struct {
+		name                string
+		theiaVersion        string
+		direction           Direction
+		ms                  migrationSequence
+		setDataVersion      func()
+		legacyTablesRows    *sqlmock.Rows
+		oldVersionTablesRow *sqlmock.Rows
+	}{
+		{
+			name:             "No existing data schema",
+			ms:               migrationSequence{},
+			setDataVersion:   func() {},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}),
+		},
+		{
+			name:             "Upgrading from v0.1.0 to v0.4.0",
+			ms:               migrationSequence{mr("CREATE 1"), mr("CREATE 2")},
+			setDataVersion:   func() {},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}).AddRow("flows"),
+		},
+		{
+			name:                "Upgrading from v0.2.0 to v0.4.0",
+			ms:                  migrationSequence{mr("CREATE 2")},
+			setDataVersion:      func() {},
+			legacyTablesRows:    sqlmock.NewRows([]string{"name"}).AddRow("flows").AddRow("migrate_version").AddRow("flows_local"),
+			oldVersionTablesRow: sqlmock.NewRows([]string{"version"}).AddRow("0.2.0"),
+		},
+		{
+			name:             "Downgrading from v0.6.0 to v0.4.0",
+			ms:               migrationSequence{mr("DROP 3")},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}),
+			setDataVersion: func() {
+				databaseInstance.SetVersion(3, false)
+			},
+		},
+		{
+			name:             "Upgrading from v0.1.0 to v0.6.0",
+			theiaVersion:     "0.6.0",
+			ms:               migrationSequence{mr("CREATE 1"), mr("CREATE 2"), mr("CREATE 3")},
+			setDataVersion:   func() {},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}).AddRow("flows"),
+		},
+		{
+			name:             "Upgrading from v0.1.0 to v0.6.0 with direction up",
+			theiaVersion:     "0.6.0",
+			direction:        DirectionUp,
+			ms:               migrationSequence{mr("CREATE 1"), mr("CREATE 2"), mr("CREATE 3")},
+			setDataVersion:   func() {},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}).AddRow("flows"),
+		},
+		{
+			name:             "Downgrading from v0.6.0 to v0.2.0",
+			theiaVersion:     "0.2.0",
+			direction:        DirectionDown,
+			ms:               migrationSequence{mr("DROP 3"), mr("DROP 2")},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}),
+			setDataVersion: func() {
+				databaseInstance.SetVersion(3, false)
+			},
+		},
+		{
+			name:             "Downgrading from v0.6.0 to v0.1.0",
+			theiaVersion:     "0.1.0",
+			ms:               migrationSequence{mr("DROP 3"), mr("DROP 2"), mr("DROP 1")},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}),
+			setDataVersion: func() {
+				databaseInstance.SetVersion(3, false)
+			},
+		},
+		{
+			name:                "No migration after upgrading from v0.2.0",
+			ms:                  migrationSequence{},
+			legacyTablesRows:    sqlmock.NewRows([]string{"name"}).AddRow("flows").AddRow("migrate_version").AddRow("flows_local"),
+			oldVersionTablesRow: sqlmock.NewRows([]string{"version"}).AddRow("0.2.0"),
+			setDataVersion: func() {
+				databaseInstance.SetVersion(2, false)
+			},
+		},
+		{
+			name:             "No migration",
+			ms:               migrationSequence{},
+			legacyTablesRows: sqlmock.NewRows([]string{"name"}).AddRow("flows").AddRow("flows_local"),
+			setDataVersion: func() {
+				databaseInstance.SetVersion(2, false)
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			getEnv = fakeGetEnv
+			if tc.theiaVersion != "" {
+				getEnv = func(key string) string {
+					if key == "THEIA_VERSION" {
+						return tc.theiaVersion
+					}
+					return fakeGetEnv(key)
+				}
+			}
+			var mocks []sqlmock.Sqlmock
+			openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
+				db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					return db, err
+				}
+				mock.ExpectPing()
+				if len(mocks) == 0 {
+					mock.ExpectQuery(legacyTablesQuery).WillReturnRows(tc.legacyTablesRows)
+					if tc.oldVersionTablesRow != nil {
+						mock.ExpectQuery(legacyVersionColumnQuery).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(1))
+						mock.ExpectQuery(legacyVersionQuery).WillReturnRows(tc.oldVersionTablesRow)
+					}
+				} else if len(mocks) == 1 {
+					expectPauseMonitor(mock, "", sqlmock.AnyArg(), sqlmock.AnyArg())
+				} else {
+					expectTrackProgress(mock, "", "system.mutations")
+				}
+				mocks = append(mocks, mock)
+				return db, err
+			}
+			var err error
+			sourceInstance, err = source.Open("stub://")
+			assert.NoError(t, err, "error when creating stub source migrate")
+			databaseInstance, err = database.Open("stub://")
+			assert.NoError(t, err, "error when creating stub database migrate")
+			config, err := NewConfigFromEnv()
+			assert.NoError(t, err)
+			config.Direction = tc.direction
+			migrator, err := New(config)
+			assert.NoErrorf(t, err, "error when initializing migrator: %v", err)
+			assert.Equalf(t, 0, migrator.versionMap["0.1.0"], "version 0.1.0 should map to version 0")
+			assert.Equalf(t, 1, migrator.versionMap["0.3.0"], "version 0.3.0 should map to version 1")
+			assert.Equalf(t, 2, migrator.versionMap["0.5.0"], "version 0.5.0 should map to version 2")
+			assert.Equalf(t, 3, migrator.latestVersionNumber, "the latest version should be 3")
+			tc.setDataVersion()
+			err = migrator.Run()
+			assert.NoError(t, err, "error when migrating: %v", err)
+			bs := tc.ms.bodySequence()
+			assert.True(t, databaseInstance.(*dStub.Stub).EqualSequence(bs), "error in migration sequence")
+			// The deletions of the monitor are paused, and the progress is
+			// tracked, only if migrations are applied.
+			if len(tc.ms) > 0 {
+				assert.Len(t, mocks, 3)
+			} else {
+				assert.Len(t, mocks, 1)
+			}
+			for _, mock := range mocks {
+				assert.NoError(t, mock.ExpectationsWereMet())
+			}
+		})
+	}
+}
+
+func checkErrorMsg(t *testing.T) {
+	testcases := []struct {
+		name                  string
+		execCommand           func(name string, arg ...string) *exec.Cmd
+		readDir               func(name string) ([]fs.DirEntry, error)
+		getEnv                func(key string) string
+		newMigrate            func(sourceURL string, databaseURL string) (*migrate.Migrate, error)
+		direction             Direction
+		setDataVersion        func()
+		legacyTablesRows      *sqlmock.Rows
+		initExpectedErrorMsg  string
+		startExpectedErrorMsg string
+	}{
+		{
+			name:                 "Environment variable not set",
+			getEnv:               func(key string) string { return "" },
+			initExpectedErrorMsg: "unable to load environment variables, MIGRATE_USERNAME, MIGRATE_PASSWORD and DB_URL must be defined",
+		},
+		{
+			name: "Fail to create migration instance",
+			newMigrate: func(sourceURL, databaseURL string) (*migrate.Migrate, error) {
+				return nil, fmt.Errorf("")
+			},
+			initExpectedErrorMsg: "error when creating a Migrate instance for ClickHouse: ",
+		},
+		{
+			name: "Fail to read directory",
+			readDir: func(name string) ([]fs.DirEntry, error) {
+				return nil, fmt.Errorf("")
+			},
+			initExpectedErrorMsg: "error when generating version number map: unable to get files in folder migrators: ",
+		},
+		{
+			name: "Wrong migrator file name",
+			readDir: func(name string) ([]fs.DirEntry, error) {
+				file := fakeDirEntry{name: "0-1-0.up.sql", isDir: false}
+				return []os.DirEntry{file}, nil
+			},
+			initExpectedErrorMsg: "error when generating version number map: error when parsing the version number: ",
+		},
+		{
+			name: "Missing downgrading migrator",
+			readDir: func(name string) ([]fs.DirEntry, error) {
+				fileUpEntry1 := fakeDirEntry{name: "000001_0-1-0.up.sql", isDir: false}
+				fileUpEntry2 := fakeDirEntry{name: "000002_0-3-0.up.sql", isDir: false}
+				fileDownEntry2 := fakeDirEntry{name: "000002_0-3-0.down.sql", isDir: false}
+				return []os.DirEntry{fileUpEntry1, fileUpEntry2, fileDownEntry2}, nil
+			},
+			initExpectedErrorMsg: "error when generating version number map: both upgrading and downgrading migrators are required for version 0.1.0",
+		},
+		{
+			name: "Missing version number",
+			readDir: func(name string) ([]fs.DirEntry, error) {
+				fileUpEntry1 := fakeDirEntry{name: "000001_0-1-0.up.sql", isDir: false}
+				fileDownEntry1 := fakeDirEntry{name: "000001_0-1-0.down.sql", isDir: false}
+				fileUpEntry3 := fakeDirEntry{name: "000003_0-5-0.up.sql", isDir: false}
+				fileDownEntry3 := fakeDirEntry{name: "000003_0-5-0.down.sql", isDir: false}
+				return []os.DirEntry{fileUpEntry1, fileDownEntry1, fileUpEntry3, fileDownEntry3}, nil
+			},
+			initExpectedErrorMsg: "error when generating version number map: migrators for version number 2 are missing",
+		},
+		{
+			name: "Unordered migrator versions",
+			readDir: func(name string) ([]fs.DirEntry, error) {
+				fileUpEntry1 := fakeDirEntry{name: "000001_0-3-0.up.sql", isDir: false}
+				fileDownEntry1 := fakeDirEntry{name: "000001_0-3-0.down.sql", isDir: false}
+				fileUpEntry2 := fakeDirEntry{name: "000002_0-1-0.up.sql", isDir: false}
+				fileDownEntry2 := fakeDirEntry{name: "000002_0-1-0.down.sql", isDir: false}
+				return []os.DirEntry{fileUpEntry1, fileDownEntry1, fileUpEntry2, fileDownEntry2}, nil
+			},
+			initExpectedErrorMsg: "error when generating version number map: version 0.1.0 should be later than version 0.3.0",
+		},
+		{
+			name: "Invalid theia version",
+			getEnv: func(key string) string {
+				if key == "THEIA_VERSION" {
+					return "v0.1.0"
+				} else {
+					return fakeGetEnv(key)
+				}
+			},
+			startExpectedErrorMsg: "error when getting Theia version: error when getting theia version number for v0.1.0: error when rounding up version: ",
+		},
+		{
+			name:                 "Invalid direction",
+			direction:            Direction("sideways"),
+			initExpectedErrorMsg: "invalid direction \"sideways\"",
+		},
+		{
+			name:      "Downgrading with direction up",
+			direction: DirectionUp,
+			setDataVersion: func() {
+				databaseInstance.SetVersion(3, false)
+			},
+			legacyTablesRows:      sqlmock.NewRows([]string{"name"}),
+			startExpectedErrorMsg: "migrating from version 3 to 2 is a downgrade, but direction is up",
+		},
+		{
+			name:      "Upgrading with direction down",
+			direction: DirectionDown,
+			setDataVersion: func() {
+				databaseInstance.SetVersion(1, false)
+			},
+			legacyTablesRows:      sqlmock.NewRows([]string{"name"}),
+			startExpectedErrorMsg: "migrating from version 1 to 2 is an upgrade, but direction is down",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			execCommand = fakeExecCommand
+			readDir = fakeReadDir
+			getEnv = fakeGetEnv
+			newMigrate = fakeNewMigrate
+			if tc.execCommand != nil {
+				execCommand = tc.execCommand
+			}
+			if tc.readDir != nil {
+				readDir = tc.readDir
+			}
+			if tc.getEnv != nil {
+				getEnv = tc.getEnv
+			}
+			if tc.newMigrate != nil {
+				newMigrate = tc.newMigrate
+			}
+			openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
+				db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					return db, err
+				}
+				mock.ExpectPing()
+				if tc.legacyTablesRows != nil {
+					mock.ExpectQuery(legacyTablesQuery).WillReturnRows(tc.legacyTablesRows)
+				} else {
+					mock.ExpectQuery(legacyTablesQuery)
+				}
+				return db, err
+			}
+			var err error
+			sourceInstance, err = source.Open("stub://")
+			assert.NoError(t, err, "error when creating stub source migrate")
+			databaseInstance, err = database.Open("stub://")
+			assert.NoError(t, err, "error when creating stub database migrate")
+			config, err := NewConfigFromEnv()
+			assert.NoError(t, err)
+			config.Direction = tc.direction
+			migrator, err := New(config)
+			if tc.initExpectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tc.initExpectedErrorMsg)
+			} else {
+				assert.Nil(t, err)
+				if tc.setDataVersion != nil {
+					tc.setDataVersion()
+				}
+				err = migrator.Run()
+				if tc.startExpectedErrorMsg != "" {
+					assert.ErrorContains(t, err, tc.startExpectedErrorMsg)
+				} else {
+					assert.Nil(t, err)
+				}
+			}
+
+		})
+	}
+}
+
+func TestRewriteMigrators(t *testing.T) {
+	oldReadDir := readDir
+	readDir = os.ReadDir
+	defer func() { readDir = oldReadDir }()
+
+	dir := t.TempDir()
+	migrator := `CREATE DICTIONARY IF NOT EXISTS ip_names_dict (ip String, name String)
+SOURCE(CLICKHOUSE(QUERY 'SELECT ip, name FROM default.ip_names'));
+ALTER TABLE flows_local ADD COLUMN IF NOT EXISTS destinationName String DEFAULT dictGetOrDefault('default.ip_names_dict', 'name', tuple(destinationIP), '');
+CREATE TABLE IF NOT EXISTS ip_names AS ip_names_local
+    engine=Distributed('{cluster}', default, ip_names_local, cityHash64(ip));
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "000006_0-7-0.up.sql"), []byte(migrator), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "default.d"), 0755))
+
+	assert.NoError(t, rewriteMigrators(dir, "theia"))
+	content, err := os.ReadFile(filepath.Join(dir, "000006_0-7-0.up.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE DICTIONARY IF NOT EXISTS ip_names_dict (ip String, name String)
+SOURCE(CLICKHOUSE(QUERY 'SELECT ip, name FROM theia.ip_names'));
+ALTER TABLE flows_local ADD COLUMN IF NOT EXISTS destinationName String DEFAULT dictGetOrDefault('theia.ip_names_dict', 'name', tuple(destinationIP), '');
+CREATE TABLE IF NOT EXISTS ip_names AS ip_names_local
+    engine=Distributed('{cluster}', theia, ip_names_local, cityHash64(ip));
+`, string(content))
+}
+
+func TestRewriteMigratorsForCluster(t *testing.T) {
+	oldReadDir := readDir
+	readDir = os.ReadDir
+	defer func() { readDir = oldReadDir }()
+
+	dir := t.TempDir()
+	migrator := `--Create a table
+CREATE TABLE IF NOT EXISTS pod_view_table_local (
+    timeInserted DateTime DEFAULT now()
+) ENGINE = ReplicatedSummingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted);
+CREATE TABLE IF NOT EXISTS pod_view_table AS pod_view_table_local
+    engine=Distributed('{cluster}', default, pod_view_table_local, rand());
+INSERT INTO pod_view_table_local SELECT * FROM ".inner.flows_pod_view_local";
+INSERT INTO recommendations_local (id, yamls)
+SELECT id, arrayStringConcat(groupArray(policy), '\n---\n') AS yamls FROM recommendations_local GROUP BY id;
+ALTER TABLE recommendations_local DELETE WHERE yamls='';
+DROP VIEW flows_pod_view_local;
+DROP DICTIONARY IF EXISTS ip_names_dict;
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_pod_view_local
+ENGINE = ReplicatedSummingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted)
+POPULATE
+AS SELECT timeInserted FROM flows_local;
+`
+	expected := `--Create a table
+CREATE TABLE IF NOT EXISTS pod_view_table_local ON CLUSTER 'clickhouse' (
+    timeInserted DateTime DEFAULT now()
+) ENGINE = ReplicatedSummingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted);
+CREATE TABLE IF NOT EXISTS pod_view_table ON CLUSTER 'clickhouse' AS pod_view_table_local
+    engine=Distributed('{cluster}', default, pod_view_table_local, rand());
+INSERT INTO FUNCTION cluster('clickhouse', currentDatabase(), 'pod_view_table_local', rand()) SELECT * FROM cluster('clickhouse', currentDatabase(), '.inner.flows_pod_view_local');
+INSERT INTO FUNCTION cluster('clickhouse', currentDatabase(), 'recommendations_local', rand()) (id, yamls)
+SELECT id, arrayStringConcat(groupArray(policy), '\n---\n') AS yamls FROM cluster('clickhouse', currentDatabase(), 'recommendations_local') GROUP BY id;
+ALTER TABLE recommendations_local ON CLUSTER 'clickhouse' DELETE WHERE yamls='';
+DROP VIEW flows_pod_view_local ON CLUSTER 'clickhouse';
+DROP DICTIONARY IF EXISTS ip_names_dict ON CLUSTER 'clickhouse';
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_pod_view_local ON CLUSTER 'clickhouse'
+ENGINE = ReplicatedSummingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted)
+POPULATE
+AS SELECT timeInserted FROM flows_local;
+`
+	path := filepath.Join(dir, "000005_0-6-0.up.sql")
+	assert.NoError(t, os.WriteFile(path, []byte(migrator), 0644))
+
+	assert.NoError(t, rewriteMigratorsForCluster(dir, "clickhouse"))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+
+	// Rewritten migrators are left unchanged.
+	assert.NoError(t, rewriteMigratorsForCluster(dir, "clickhouse"))
+	content, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+}
+
+func TestClusterMigration(t *testing.T) {
+	oldReadFile, oldWriteFile, oldLeaderPollInterval := readFile, writeFile, leaderPollInterval
+	defer func() {
+		readFile, writeFile, leaderPollInterval = oldReadFile, oldWriteFile, oldLeaderPollInterval
+	}()
+	execCommand = fakeExecCommand
+	readDir = fakeReadDir
+	mkdirAll = fakeMkdirAll
+	newMigrate = fakeNewMigrate
+	readFile = func(name string) ([]byte, error) {
+		return []byte("ALTER TABLE flows ADD COLUMN egressName String;"), nil
+	}
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		assert.Equal(t, "ALTER TABLE flows ON CLUSTER 'clickhouse' ADD COLUMN egressName String;", string(data))
+		return nil
+	}
+	leaderPollInterval = 10 * time.Millisecond
+	getEnv = func(key string) string {
+		if key == "CLICKHOUSE_CLUSTER" {
+			return "clickhouse"
+		}
+		return fakeGetEnv(key)
+	}
+	defer func() { getEnv = fakeGetEnv }()
+
+	testcases := []struct {
+		name        string
+		isLocal     uint8
+		expectQuery func(mock sqlmock.Sqlmock, connection int)
+		ms          migrationSequence
+	}{
+		{
+			name:    "First replica of the cluster",
+			isLocal: 1,
+			expectQuery: func(mock sqlmock.Sqlmock, connection int) {
+				if connection == 1 {
+					mock.ExpectQuery(legacyTablesQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("flows"))
+				} else if connection == 2 {
+					expectPauseMonitor(mock, " ON CLUSTER 'clickhouse'", int32(0), int32(2))
+				} else {
+					expectTrackProgress(mock, " ON CLUSTER 'clickhouse'", "cluster('clickhouse', system.mutations)")
+				}
+			},
+			ms: migrationSequence{mr("CREATE 1"), mr("CREATE 2")},
+		},
+		{
+			name:    "Other replica of the cluster",
+			isLocal: 0,
+			expectQuery: func(mock sqlmock.Sqlmock, connection int) {
+				mock.ExpectQuery(leaderVersionQuery).WithArgs("chi-clickhouse-clickhouse-0-0:9000", "username", "password").
+					WillReturnError(fmt.Errorf("connection refused"))
+				mock.ExpectQuery(leaderVersionQuery).WithArgs("chi-clickhouse-clickhouse-0-0:9000", "username", "password").
+					WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(2, 0))
+			},
+			ms: migrationSequence{},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			connections := 0
+			openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
+				db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					return db, err
+				}
+				mock.ExpectPing()
+				if connections == 0 {
+					mock.ExpectQuery(clusterLeaderQuery).WithArgs("clickhouse").WillReturnRows(
+						sqlmock.NewRows([]string{"is_local", "host_name", "port"}).AddRow(tc.isLocal, "chi-clickhouse-clickhouse-0-0", 9000))
+				} else {
+					tc.expectQuery(mock, connections)
+				}
+				connections++
+				return db, err
+			}
+			var err error
+			sourceInstance, err = source.Open("stub://")
+			assert.NoError(t, err)
+			databaseInstance, err = database.Open("stub://")
+			assert.NoError(t, err)
+			config, err := NewConfigFromEnv()
+			assert.NoError(t, err)
+			migrator, err := New(config)
+			assert.NoError(t, err)
+			assert.NoError(t, migrator.Run())
+			assert.True(t, databaseInstance.(*dStub.Stub).EqualSequence(tc.ms.bodySequence()), "error in migration sequence")
+			version, dirty, err := databaseInstance.Version()
+			assert.NoError(t, err)
+			assert.Equal(t, 2, version)
+			assert.False(t, dirty)
+		})
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	oldSchemaDDL := schemaDDL
+	defer func() { schemaDDL = oldSchemaDDL }()
+	schemaDDL = `--Create a table to store records
+CREATE TABLE IF NOT EXISTS flows_local (
+    timeInserted DateTime DEFAULT now()
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted);
+
+CREATE TABLE IF NOT EXISTS flows AS flows_local
+engine=Distributed('{cluster}', default, flows_local, rand());
+`
+	execCommand = fakeExecCommand
+	readDir = fakeReadDir
+	mkdirAll = fakeMkdirAll
+	newMigrate = fakeNewMigrate
+	defer func() { getEnv = fakeGetEnv }()
+
+	testcases := []struct {
+		name               string
+		theiaVersion       string
+		database           string
+		bootstrap          bool
+		expectedStatements []string
+		ms                 migrationSequence
+		expectedVersion    int
+	}{
+		{
+			name:         "Bootstrap latest version",
+			theiaVersion: "0.6.0",
+			bootstrap:    true,
+			expectedStatements: []string{
+				`CREATE TABLE IF NOT EXISTS flows_local (
+    timeInserted DateTime DEFAULT now()
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted)`,
+				`CREATE TABLE IF NOT EXISTS flows AS flows_local
+engine=Distributed('{cluster}', default, flows_local, rand())`,
+			},
+			ms:              migrationSequence{},
+			expectedVersion: 3,
+		},
+		{
+			name:         "Bootstrap earlier version in another database",
+			theiaVersion: "0.4.0",
+			database:     "theia",
+			bootstrap:    true,
+			expectedStatements: []string{
+				`CREATE TABLE IF NOT EXISTS flows_local (
+    timeInserted DateTime DEFAULT now()
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted)`,
+				`CREATE TABLE IF NOT EXISTS flows AS flows_local
+engine=Distributed('{cluster}', theia, flows_local, rand())`,
+			},
+			ms:              migrationSequence{mr("DROP 3")},
+			expectedVersion: 2,
+		},
+		{
+			name:            "Bootstrap disabled",
+			theiaVersion:    "0.6.0",
+			ms:              migrationSequence{},
+			expectedVersion: 3,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldReadFile, oldWriteFile := readFile, writeFile
+			defer func() { readFile, writeFile = oldReadFile, oldWriteFile }()
+			readFile = func(name string) ([]byte, error) { return nil, nil }
+			writeFile = func(name string, data []byte, perm os.FileMode) error { return nil }
+			getEnv = func(key string) string {
+				switch key {
+				case "THEIA_VERSION":
+					return tc.theiaVersion
+				case "CLICKHOUSE_DATABASE":
+					return tc.database
+				}
+				return fakeGetEnv(key)
+			}
+			var mocks []sqlmock.Sqlmock
+			openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
+				db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					return db, err
+				}
+				mock.ExpectPing()
+				switch len(mocks) {
+				case 0:
+					mock.ExpectQuery(legacyTablesQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+				case 1:
+					expectPauseMonitor(mock, "", int32(-1), int32(tc.expectedVersion))
+				default:
+					for _, statement := range tc.expectedStatements {
+						mock.ExpectExec(statement).WillReturnResult(sqlmock.NewResult(0, 0))
+					}
+				}
+				mocks = append(mocks, mock)
+				return db, err
+			}
+			var err error
+			sourceInstance, err = source.Open("stub://")
+			assert.NoError(t, err)
+			databaseInstance, err = database.Open("stub://")
+			assert.NoError(t, err)
+			config, err := NewConfigFromEnv()
+			assert.NoError(t, err)
+			config.Bootstrap = tc.bootstrap
+			migrator, err := New(config)
+			assert.NoError(t, err)
+			assert.NoError(t, migrator.Run())
+			if tc.bootstrap {
+				assert.Len(t, mocks, 3)
+			} else {
+				assert.Len(t, mocks, 1)
+			}
+			for _, mock := range mocks {
+				assert.NoError(t, mock.ExpectationsWereMet())
+			}
+			assert.True(t, databaseInstance.(*dStub.Stub).EqualSequence(tc.ms.bodySequence()), "error in migration sequence")
+			version, dirty, err := databaseInstance.Version()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedVersion, version)
+			assert.False(t, dirty)
+		})
+	}
+}
+
+func TestCreateUsers(t *testing.T) {
+	getEnv = func(key string) string {
+		switch key {
+		case "CLICKHOUSE_CLUSTER":
+			return "clickhouse"
+		case "CLICKHOUSE_WRITER_USERNAME":
+			return "flow_aggregator"
+		case "CLICKHOUSE_WRITER_PASSWORD":
+			return "writer_password"
+		}
+		return fakeGetEnv(key)
+	}
+	defer func() { getEnv = fakeGetEnv }()
+	config, err := NewConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, []schema.User{{Name: "flow_aggregator", Password: "writer_password", Role: schema.RoleWriter}}, config.Users)
+
+	var mock sqlmock.Sqlmock
+	openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
+		var db *sql.DB
+		var err error
+		db, mock, err = sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			return db, err
+		}
+		mock.ExpectPing()
+		for _, statement := range schema.RolesDDL("", "clickhouse") {
+			mock.ExpectExec(statement).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec("CREATE USER OR REPLACE flow_aggregator ON CLUSTER 'clickhouse' IDENTIFIED WITH sha256_password BY 'writer_password'").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("GRANT ON CLUSTER 'clickhouse' theia_default_writer TO flow_aggregator").
+			WillReturnError(fmt.Errorf("mock_error"))
+		return db, err
+	}
+	m := &Migrator{config: config, clickHouseURL: "localhost:9000"}
+	err = m.createUsers()
+	assert.EqualError(t, err, `error when executing "GRANT ON CLUSTER 'clickhouse' theia_default_writer TO flow_aggregator": mock_error`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,288 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// The migration_progress table records the progress of the mutations and
+	// of the copies between tables of a migration, so that the progress of
+	// the migrators rewriting large tables can be followed with the theia
+	// upgrade status command. The progress of a migration is identified by
+	// the time it started.
+	createMigrationProgressTableQuery = `CREATE TABLE IF NOT EXISTS migration_progress%s (
+    timeUpdated DateTime64(3) DEFAULT now64(3),
+    timeStarted DateTime,
+    fromVersion Int32,
+    toVersion Int32,
+    tableName String,
+    operation String,
+    id String,
+    done UInt64,
+    total UInt64,
+    etaSeconds Int64
+) ENGINE = MergeTree
+ORDER BY (timeUpdated)
+TTL toDateTime(timeUpdated) + INTERVAL 7 DAY`
+	insertMigrationProgressQuery = "INSERT INTO migration_progress (timeStarted, fromVersion, toVersion, tableName, operation, id, done, total, etaSeconds) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	// Get the number of data parts left to rewrite by the mutations created
+	// since the beginning of the migration, including the completed ones.
+	mutationProgressQuery = "SELECT table, mutation_id, toUInt64(sum(parts_to_do)) FROM %s WHERE database = currentDatabase() AND create_time >= ? GROUP BY table, mutation_id"
+	// Get the numbers of rows read by the running copies between tables, and
+	// the estimated numbers of rows to read.
+	copyProgressQuery = `SELECT extract(query, '(?i)INSERT\\s+INTO\\s+"?(\\w+)'), query_id, read_rows, total_rows_approx FROM system.processes WHERE current_database = currentDatabase() AND match(query, '(?is)^\\s*INSERT\\s+INTO\\s.*\\bSELECT\\b')`
+
+	operationMutation = "mutation"
+	operationCopy     = "copy"
+)
+
+// Interval of reporting the progress of the mutations and copies of a
+// migration.
+var progressInterval = 10 * time.Second
+
+// progressItem is the progress of a mutation, in data parts, or of a copy
+// between tables, in rows.
+type progressItem struct {
+	table     string
+	operation string
+	id        string
+	done      uint64
+	total     uint64
+	// The progress when the item is first seen, from which its rate and ETA
+	// are computed.
+	firstSeen time.Time
+	firstDone uint64
+	completed bool
+}
+
+// etaSeconds returns the estimated number of seconds left to complete the
+// item, based on its rate since it was first seen, or -1 if it is unknown.
+func (item *progressItem) etaSeconds(now time.Time) int64 {
+	if item.completed || item.done >= item.total {
+		return 0
+	}
+	elapsed := now.Sub(item.firstSeen).Seconds()
+	if item.done <= item.firstDone || elapsed <= 0 {
+		return -1
+	}
+	rate := float64(item.done-item.firstDone) / elapsed
+	return int64(float64(item.total-item.done) / rate)
+}
+
+// progressTracker polls ClickHouse for the progress of the mutations and of
+// the copies between tables of a migration.
+type progressTracker struct {
+	connect *sql.DB
+	// mutationsTable is system.mutations, or the table function reading it
+	// from all the servers of the cluster.
+	mutationsTable string
+	from, to       int
+	start          time.Time
+	items          map[string]*progressItem
+	now            func() time.Time
+}
+
+// trackProgress records the progress of the mutations and of the copies
+// between tables of the migration from one golang-migrate version number to
+// another in the migration_progress table, and logs it periodically until the
+// returned function is called. The mutations are rewritten asynchronously by
+// ClickHouse, so they may not be completed when the returned function is
+// called, and their last known progress is recorded.
+func (m *Migrator) trackProgress(from, to int) (func(), error) {
+	connect, err := m.connectClickHouse()
+	if err != nil {
+		return nil, fmt.Errorf("error when connecting to ClickHouse: %v", err)
+	}
+	onCluster := ""
+	mutationsTable := "system.mutations"
+	if m.config.Cluster != "" {
+		onCluster = fmt.Sprintf(" ON CLUSTER '%s'", m.config.Cluster)
+		mutationsTable = fmt.Sprintf("cluster('%s', system.mutations)", m.config.Cluster)
+	}
+	if _, err := connect.Exec(fmt.Sprintf(createMigrationProgressTableQuery, onCluster)); err != nil {
+		connect.Close()
+		return nil, fmt.Errorf("error when creating the migration_progress table: %v", err)
+	}
+	tracker := &progressTracker{
+		connect:        connect,
+		mutationsTable: mutationsTable,
+		from:           from,
+		to:             to,
+		// The create_time of the mutations has a precision of one second.
+		start: time.Now().Truncate(time.Second),
+		items: map[string]*progressItem{},
+		now:   time.Now,
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := tracker.report(); err != nil {
+					klog.ErrorS(err, "Failed to report the migration progress")
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+		defer connect.Close()
+		if err := tracker.report(); err != nil {
+			klog.ErrorS(err, "Failed to report the migration progress")
+		}
+	}, nil
+}
+
+// report polls the progress of the mutations and of the copies, then logs and
+// records the progress of the items which are not completed, and of the items
+// completed since the last report.
+func (t *progressTracker) report() error {
+	now := t.now()
+	seen := map[string]bool{}
+	if err := t.pollMutations(now, seen); err != nil {
+		return err
+	}
+	if err := t.pollCopies(now, seen); err != nil {
+		return err
+	}
+	var items []*progressItem
+	for key, item := range t.items {
+		if item.completed {
+			continue
+		}
+		// The copies are completed when they are not running anymore.
+		if !seen[key] && item.operation == operationCopy {
+			item.done = item.total
+		}
+		if item.done >= item.total {
+			item.completed = true
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].table != items[j].table {
+			return items[i].table < items[j].table
+		}
+		return items[i].id < items[j].id
+	})
+	for _, item := range items {
+		klog.InfoS("Migration progress", "from", t.from, "to", t.to, "table", item.table, "operation", item.operation,
+			"done", item.done, "total", item.total, "etaSeconds", item.etaSeconds(now))
+	}
+	return t.record(items, now)
+}
+
+// pollMutations updates the progress of the mutations created since the
+// beginning of the migration. The total number of data parts of a mutation is
+// the highest number of parts left to rewrite seen, so it is underestimated if
+// parts are rewritten before the mutation is first seen.
+func (t *progressTracker) pollMutations(now time.Time, seen map[string]bool) error {
+	rows, err := t.connect.Query(fmt.Sprintf(mutationProgressQuery, t.mutationsTable), t.start)
+	if err != nil {
+		return fmt.Errorf("error when getting the progress of the mutations: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, id string
+		var partsToDo uint64
+		if err := rows.Scan(&table, &id, &partsToDo); err != nil {
+			return fmt.Errorf("error when scanning the progress of the mutations: %v", err)
+		}
+		key := operationMutation + "/" + table + "/" + id
+		seen[key] = true
+		item, ok := t.items[key]
+		if !ok {
+			item = &progressItem{table: table, operation: operationMutation, id: id, total: partsToDo, firstSeen: now}
+			t.items[key] = item
+		}
+		if partsToDo > item.total {
+			item.total = partsToDo
+		}
+		item.done = item.total - partsToDo
+	}
+	return rows.Err()
+}
+
+// pollCopies updates the progress of the running copies between tables.
+func (t *progressTracker) pollCopies(now time.Time, seen map[string]bool) error {
+	rows, err := t.connect.Query(copyProgressQuery)
+	if err != nil {
+		return fmt.Errorf("error when getting the progress of the copies: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, id string
+		var readRows, totalRows uint64
+		if err := rows.Scan(&table, &id, &readRows, &totalRows); err != nil {
+			return fmt.Errorf("error when scanning the progress of the copies: %v", err)
+		}
+		key := operationCopy + "/" + table + "/" + id
+		seen[key] = true
+		item, ok := t.items[key]
+		if !ok {
+			item = &progressItem{table: table, operation: operationCopy, id: id, firstSeen: now, firstDone: readRows}
+			t.items[key] = item
+		}
+		// The number of rows to read is estimated, and may be lower than
+		// the number of rows read.
+		item.total = totalRows
+		if readRows > item.total {
+			item.total = readRows
+		}
+		item.done = readRows
+	}
+	return rows.Err()
+}
+
+// record inserts the progress of the items in the migration_progress table.
+func (t *progressTracker) record(items []*progressItem, now time.Time) error {
+	tx, err := t.connect.Begin()
+	if err != nil {
+		return fmt.Errorf("error when beginning the insertion of the migration progress: %v", err)
+	}
+	stmt, err := tx.Prepare(insertMigrationProgressQuery)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error when preparing the insertion of the migration progress: %v", err)
+	}
+	defer stmt.Close()
+	for _, item := range items {
+		if _, err := stmt.Exec(t.start, int32(t.from), int32(t.to), item.table, item.operation, item.id, item.done, item.total, item.etaSeconds(now)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error when inserting the migration progress: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error when committing the insertion of the migration progress: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	start := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+	now := start
+	tracker := &progressTracker{
+		connect:        db,
+		mutationsTable: "system.mutations",
+		from:           4,
+		to:             6,
+		start:          start,
+		items:          map[string]*progressItem{},
+		now:            func() time.Time { return now },
+	}
+	mutationQuery := fmt.Sprintf(mutationProgressQuery, "system.mutations")
+	mutationColumns := []string{"table", "mutation_id", "parts_to_do"}
+	copyColumns := []string{"table", "query_id", "read_rows", "total_rows_approx"}
+	expectRecord := func(rows ...[]interface{}) {
+		mock.ExpectBegin()
+		prepare := mock.ExpectPrepare(insertMigrationProgressQuery)
+		for _, row := range rows {
+			args := []driver.Value{start, int32(4), int32(6)}
+			for _, arg := range row {
+				args = append(args, arg)
+			}
+			prepare.ExpectExec().WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+	}
+
+	// First report, the rates are unknown.
+	mock.ExpectQuery(mutationQuery).WithArgs(start).WillReturnRows(sqlmock.NewRows(mutationColumns).AddRow("flows_local", "0000000001", uint64(100)))
+	mock.ExpectQuery(copyProgressQuery).WillReturnRows(sqlmock.NewRows(copyColumns).AddRow("recommendations_local", "query-1", uint64(1000), uint64(10000)))
+	expectRecord(
+		[]interface{}{"flows_local", operationMutation, "0000000001", uint64(0), uint64(100), int64(-1)},
+		[]interface{}{"recommendations_local", operationCopy, "query-1", uint64(1000), uint64(10000), int64(-1)},
+	)
+	require.NoError(t, tracker.report())
+
+	// Second report, 25 parts and 3000 rows are processed in 10 seconds.
+	now = start.Add(10 * time.Second)
+	mock.ExpectQuery(mutationQuery).WithArgs(start).WillReturnRows(sqlmock.NewRows(mutationColumns).AddRow("flows_local", "0000000001", uint64(75)))
+	mock.ExpectQuery(copyProgressQuery).WillReturnRows(sqlmock.NewRows(copyColumns).AddRow("recommendations_local", "query-1", uint64(4000), uint64(10000)))
+	expectRecord(
+		[]interface{}{"flows_local", operationMutation, "0000000001", uint64(25), uint64(100), int64(30)},
+		[]interface{}{"recommendations_local", operationCopy, "query-1", uint64(4000), uint64(10000), int64(20)},
+	)
+	require.NoError(t, tracker.report())
+
+	// Third report, the copy is completed and not running anymore.
+	now = start.Add(20 * time.Second)
+	mock.ExpectQuery(mutationQuery).WithArgs(start).WillReturnRows(sqlmock.NewRows(mutationColumns).AddRow("flows_local", "0000000001", uint64(50)))
+	mock.ExpectQuery(copyProgressQuery).WillReturnRows(sqlmock.NewRows(copyColumns))
+	expectRecord(
+		[]interface{}{"flows_local", operationMutation, "0000000001", uint64(50), uint64(100), int64(20)},
+		[]interface{}{"recommendations_local", operationCopy, "query-1", uint64(10000), uint64(10000), int64(0)},
+	)
+	require.NoError(t, tracker.report())
+
+	// Fourth report, the mutation is completed and the completed items are
+	// not recorded anymore.
+	now = start.Add(30 * time.Second)
+	mock.ExpectQuery(mutationQuery).WithArgs(start).WillReturnRows(sqlmock.NewRows(mutationColumns).AddRow("flows_local", "0000000001", uint64(0)))
+	mock.ExpectQuery(copyProgressQuery).WillReturnRows(sqlmock.NewRows(copyColumns))
+	expectRecord(
+		[]interface{}{"flows_local", operationMutation, "0000000001", uint64(100), uint64(100), int64(0)},
+	)
+	require.NoError(t, tracker.report())
+
+	now = start.Add(40 * time.Second)
+	mock.ExpectQuery(mutationQuery).WithArgs(start).WillReturnRows(sqlmock.NewRows(mutationColumns).AddRow("flows_local", "0000000001", uint64(0)))
+	mock.ExpectQuery(copyProgressQuery).WillReturnRows(sqlmock.NewRows(copyColumns))
+	require.NoError(t, tracker.report())
+
+	// The progress is not recorded if it cannot be polled.
+	mock.ExpectQuery(mutationQuery).WithArgs(start).WillReturnError(fmt.Errorf("connection reset"))
+	assert.EqualError(t, tracker.report(), "error when getting the progress of the mutations: connection reset")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
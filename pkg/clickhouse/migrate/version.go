@@ -0,0 +1,108 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const (
+	// Get the tables telling the data schema version of Theia v0.1 and v0.2.
+	// The tables are looked up in the system tables rather than queried
+	// directly, so that a missing table is not told apart by the message of
+	// the error, which depends on the locale of the server.
+	legacyTablesQuery = "SELECT name FROM system.tables WHERE database = currentDatabase() AND name IN ('flows', 'flows_local', 'migrate_version')"
+	// Check the column of the version table created by Theia v0.2.
+	legacyVersionColumnQuery = "SELECT count() FROM system.columns WHERE database = currentDatabase() AND table = 'migrate_version' AND name = 'version'"
+	legacyVersionQuery       = "SELECT version FROM migrate_version"
+	// The only data schema version recorded in the migrate_version table.
+	legacyVersionTableVersion = "0.2.0"
+)
+
+// detectLegacyVersion returns the data schema version created by Theia v0.1
+// or v0.2, which do not use golang-migrate, or an empty string if none of
+// their tables are found:
+//   - if table migrate_version records version 0.2.0, the version is v0.2
+//   - if table flows exists but not table flows_local, the version is v0.1
+//
+// The tables of these versions may remain after upgrading to later versions,
+// so the version recorded by golang-migrate, if any, takes precedence.
+func detectLegacyVersion(connect *sql.DB) (string, error) {
+	rows, err := connect.Query(legacyTablesQuery)
+	if err != nil {
+		return "", fmt.Errorf("error when getting the tables: %v", err)
+	}
+	defer rows.Close()
+	tables := map[string]bool{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return "", fmt.Errorf("error when scanning the tables: %v", err)
+		}
+		tables[table] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error when getting the tables: %v", err)
+	}
+	if tables["migrate_version"] {
+		version, err := getVersionFromVersionTable(connect)
+		if err != nil {
+			return "", err
+		}
+		if version != "" {
+			return version, nil
+		}
+	}
+	if tables["flows"] && !tables["flows_local"] {
+		return "0.1.0", nil
+	}
+	return "", nil
+}
+
+// getVersionFromVersionTable returns the version recorded in the
+// migrate_version table, or an empty string if the table does not have the
+// layout of Theia v0.2 or does not record its version.
+func getVersionFromVersionTable(connect *sql.DB) (string, error) {
+	var columns uint64
+	if err := connect.QueryRow(legacyVersionColumnQuery).Scan(&columns); err != nil {
+		return "", fmt.Errorf("error when getting the columns of table migrate_version: %v", err)
+	}
+	if columns == 0 {
+		return "", nil
+	}
+	rows, err := connect.Query(legacyVersionQuery)
+	if err != nil {
+		return "", fmt.Errorf("error when getting the version from table migrate_version: %v", err)
+	}
+	defer rows.Close()
+	var found bool
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return "", fmt.Errorf("error when scanning the version from table migrate_version: %v", err)
+		}
+		if version == legacyVersionTableVersion {
+			found = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error when getting the version from table migrate_version: %v", err)
+	}
+	if !found {
+		return "", nil
+	}
+	return legacyVersionTableVersion, nil
+}
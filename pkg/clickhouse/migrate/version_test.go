@@ -0,0 +1,134 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLegacyVersion(t *testing.T) {
+	testcases := []struct {
+		name             string
+		tables           []string
+		tablesErr        error
+		versionColumns   int
+		versions         []string
+		versionErr       error
+		expectedVersion  string
+		expectedErrorMsg string
+	}{
+		{
+			name:            "No data schema",
+			expectedVersion: "",
+		},
+		{
+			name:            "v0.1.0",
+			tables:          []string{"flows"},
+			expectedVersion: "0.1.0",
+		},
+		{
+			name:            "v0.2.0",
+			tables:          []string{"flows", "flows_local", "migrate_version"},
+			versionColumns:  1,
+			versions:        []string{"0.2.0"},
+			expectedVersion: "0.2.0",
+		},
+		{
+			name:            "Version table with other versions",
+			tables:          []string{"flows", "flows_local", "migrate_version"},
+			versionColumns:  1,
+			versions:        []string{"0.1.0", "0.2.0"},
+			expectedVersion: "0.2.0",
+		},
+		{
+			name:            "Version table with unknown version",
+			tables:          []string{"flows", "migrate_version"},
+			versionColumns:  1,
+			versions:        []string{"0.0.1"},
+			expectedVersion: "0.1.0",
+		},
+		{
+			name:            "Version table without version column",
+			tables:          []string{"flows", "flows_local", "migrate_version"},
+			expectedVersion: "",
+		},
+		{
+			name:            "v0.3.0 or later",
+			tables:          []string{"flows", "flows_local"},
+			expectedVersion: "",
+		},
+		{
+			// The error message of the server depends on its locale and is
+			// not interpreted.
+			name:             "Failed to get the tables",
+			tablesErr:        fmt.Errorf("Таблица default.flows не существует"),
+			expectedErrorMsg: "error when getting the tables: Таблица default.flows не существует",
+		},
+		{
+			name:             "Failed to get the version",
+			tables:           []string{"flows", "flows_local", "migrate_version"},
+			versionColumns:   1,
+			versionErr:       fmt.Errorf("connection reset"),
+			expectedErrorMsg: "error when getting the version from table migrate_version: connection reset",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close()
+			if tc.tablesErr != nil {
+				mock.ExpectQuery(legacyTablesQuery).WillReturnError(tc.tablesErr)
+			} else {
+				tableRows := sqlmock.NewRows([]string{"name"})
+				for _, table := range tc.tables {
+					tableRows.AddRow(table)
+				}
+				mock.ExpectQuery(legacyTablesQuery).WillReturnRows(tableRows)
+			}
+			for _, table := range tc.tables {
+				if table != "migrate_version" {
+					continue
+				}
+				mock.ExpectQuery(legacyVersionColumnQuery).WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(tc.versionColumns))
+				if tc.versionColumns == 0 {
+					break
+				}
+				if tc.versionErr != nil {
+					mock.ExpectQuery(legacyVersionQuery).WillReturnError(tc.versionErr)
+					break
+				}
+				versionRows := sqlmock.NewRows([]string{"version"})
+				for _, version := range tc.versions {
+					versionRows.AddRow(version)
+				}
+				mock.ExpectQuery(legacyVersionQuery).WillReturnRows(versionRows)
+			}
+			version, err := detectLegacyVersion(db)
+			if tc.expectedErrorMsg != "" {
+				assert.EqualError(t, err, tc.expectedErrorMsg)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedVersion, version)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+var (
+	alterTableRegex = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(\S+)\s+(.*)$`)
+	// Mutations rewriting the data parts of the altered table. Adding and
+	// dropping columns only change the metadata and the files of the columns.
+	rewritingMutationRegex = regexp.MustCompile(`(?i)\b(UPDATE|DELETE|MODIFY|MATERIALIZE)\b`)
+	dropColumnRegex        = regexp.MustCompile(`(?i)\bDROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?(\w+)`)
+	renameColumnRegex      = regexp.MustCompile(`(?i)\bRENAME\s+COLUMN\s+(?:IF\s+EXISTS\s+)?(\w+)`)
+	insertSelectRegex      = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+.*?\bSELECT\b.*?\bFROM\s+("[^"]+"|\S+)`)
+	dropTableRegex         = regexp.MustCompile(`(?is)^\s*DROP\s+(?:(?:TABLE|VIEW|DICTIONARY)\s+)?(?:IF\s+EXISTS\s+)?(\S+)\s*$`)
+)
+
+// Impact describes how migrators affect the existing data.
+type Impact struct {
+	// RewrittenTables are the tables whose data parts are rewritten by
+	// mutations or copied to other tables.
+	RewrittenTables []string
+	// DroppedColumns are the columns which are dropped or renamed, as
+	// <table>.<column>.
+	DroppedColumns []string
+	// DroppedTables are the tables, views and dictionaries which are dropped.
+	DroppedTables []string
+}
+
+// VersionNumber returns the golang-migrate version number of the data schema
+// of a Theia version. A Theia version without migrators shares the data
+// schema of the next version having migrators, or of the latest version.
+func VersionNumber(theiaVersion string) (int, error) {
+	target, err := semver.ParseTolerant(theiaVersion)
+	if err != nil {
+		return 0, fmt.Errorf("error when parsing version %s: %v", theiaVersion, err)
+	}
+	var number int
+	for _, version := range versions {
+		v, err := semver.Parse(version.TheiaVersion)
+		if err != nil {
+			return 0, fmt.Errorf("error when parsing version %s: %v", version.TheiaVersion, err)
+		}
+		if v.EQ(target) {
+			// The upgrading migrator of a version is applied when upgrading
+			// from it.
+			return version.Number - 1, nil
+		}
+		if v.LT(target) && number < version.Number {
+			number = version.Number
+		}
+	}
+	return number, nil
+}
+
+// Migrators returns the migrators applied, in order, when migrating the data
+// schema from version number from to version number to. The upgrading
+// migrators are returned if from is lower than to, and the downgrading ones
+// otherwise.
+func Migrators(from, to int) ([]string, error) {
+	latest := LatestVersion().Number
+	for _, number := range []int{from, to} {
+		if number < 0 || number > latest {
+			return nil, fmt.Errorf("no migrator for version number %d, the latest version number is %d", number, latest)
+		}
+	}
+	var migrators []string
+	for number := from + 1; number <= to; number++ {
+		migrators = append(migrators, versions[number-1].Up)
+	}
+	for number := from; number > to; number-- {
+		migrators = append(migrators, versions[number-1].Down)
+	}
+	return migrators, nil
+}
+
+// AnalyzeMigrators returns the impact of migrators on the existing data.
+func AnalyzeMigrators(migrators []string) Impact {
+	var impact Impact
+	add := func(list *[]string, item string) {
+		for _, existing := range *list {
+			if existing == item {
+				return
+			}
+		}
+		*list = append(*list, item)
+	}
+	for _, migrator := range migrators {
+		for _, statement := range SplitStatements(migrator) {
+			if match := alterTableRegex.FindStringSubmatch(statement); match != nil {
+				table, clauses := match[1], match[2]
+				if rewritingMutationRegex.MatchString(clauses) {
+					add(&impact.RewrittenTables, table)
+				}
+				for _, regex := range []*regexp.Regexp{dropColumnRegex, renameColumnRegex} {
+					for _, column := range regex.FindAllStringSubmatch(clauses, -1) {
+						switch strings.ToUpper(column[1]) {
+						case "INDEX", "PROJECTION", "CONSTRAINT", "PARTITION":
+						default:
+							add(&impact.DroppedColumns, table+"."+column[1])
+						}
+					}
+				}
+			} else if match := insertSelectRegex.FindStringSubmatch(statement); match != nil {
+				add(&impact.RewrittenTables, strings.Trim(match[1], `"`))
+			} else if match := dropTableRegex.FindStringSubmatch(statement); match != nil {
+				add(&impact.DroppedTables, match[1])
+			}
+		}
+	}
+	return impact
+}
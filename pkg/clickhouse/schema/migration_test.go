@@ -0,0 +1,129 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionNumber(t *testing.T) {
+	for theiaVersion, expectedNumber := range map[string]int{
+		"0.0.1":  0,
+		"v0.1.0": 0,
+		"0.2.0":  1,
+		// 0.5.0 has no migrators and shares the data schema of 0.6.0.
+		"0.5.0":  4,
+		"0.6.0":  4,
+		"0.7.0":  5,
+		"v0.8.0": LatestVersion().Number,
+	} {
+		number, err := VersionNumber(theiaVersion)
+		require.NoError(t, err)
+		assert.Equal(t, expectedNumber, number, "version %s", theiaVersion)
+	}
+	_, err := VersionNumber("latest")
+	assert.ErrorContains(t, err, "error when parsing version latest")
+}
+
+func TestMigrators(t *testing.T) {
+	migrators, err := Migrators(2, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{versions[2].Up, versions[3].Up}, migrators)
+
+	migrators, err = Migrators(4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{versions[3].Down, versions[2].Down}, migrators)
+
+	migrators, err = Migrators(3, 3)
+	require.NoError(t, err)
+	assert.Empty(t, migrators)
+
+	_, err = Migrators(LatestVersion().Number, LatestVersion().Number+1)
+	assert.ErrorContains(t, err, "no migrator for version number")
+	_, err = Migrators(-1, 2)
+	assert.ErrorContains(t, err, "no migrator for version number -1")
+}
+
+func TestMigratorsTraversal(t *testing.T) {
+	latest := LatestVersion().Number
+	for from := 0; from <= latest; from++ {
+		for to := 0; to <= latest; to++ {
+			migrators, err := Migrators(from, to)
+			require.NoError(t, err)
+			steps := to - from
+			if steps < 0 {
+				steps = -steps
+			}
+			assert.Len(t, migrators, steps, "migrating from %d to %d", from, to)
+			// Migrating one version at a time applies the same migrators.
+			var stepped []string
+			for number := from; number != to; {
+				next := number + 1
+				if to < from {
+					next = number - 1
+				}
+				step, err := Migrators(number, next)
+				require.NoError(t, err)
+				stepped = append(stepped, step...)
+				number = next
+			}
+			assert.Equal(t, stepped, migrators, "migrating from %d to %d", from, to)
+		}
+	}
+	// Downgrading applies the downgrading migrators in the reverse order of
+	// the upgrading ones.
+	up, err := Migrators(0, latest)
+	require.NoError(t, err)
+	down, err := Migrators(latest, 0)
+	require.NoError(t, err)
+	require.Len(t, down, len(up))
+	for i := range up {
+		assert.Equal(t, versions[i].Up, up[i])
+		assert.Equal(t, versions[i].Down, down[len(down)-1-i])
+	}
+}
+
+func TestAnalyzeMigrators(t *testing.T) {
+	impact := AnalyzeMigrators([]string{`
+--Alter table
+ALTER TABLE t1 ADD COLUMN c1 String;
+ALTER TABLE t1_local ADD COLUMN c1 String, DROP COLUMN IF EXISTS c2, DROP INDEX i1;
+ALTER TABLE t1_local UPDATE c1='a' WHERE c3 = 1;
+ALTER TABLE t1_local RENAME COLUMN c3 TO c4;
+INSERT INTO t2_local SELECT * FROM ".inner.t3";
+`, `
+ALTER TABLE t1_local DELETE WHERE c1='';
+DROP VIEW IF EXISTS v1;
+DROP TABLE t3;
+CREATE TABLE IF NOT EXISTS t4 AS t2_local;
+`})
+	assert.Equal(t, Impact{
+		RewrittenTables: []string{"t1_local", ".inner.t3"},
+		DroppedColumns:  []string{"t1_local.c2", "t1_local.c3"},
+		DroppedTables:   []string{"v1", "t3"},
+	}, impact)
+
+	// Upgrading from 0.2.0 to 0.3.0 moves the recommended policies to a
+	// new column and drops the old one.
+	migrators, err := Migrators(2, 3)
+	require.NoError(t, err)
+	impact = AnalyzeMigrators(migrators)
+	assert.Equal(t, []string{"recommendations_local"}, impact.RewrittenTables)
+	assert.Equal(t, []string{"recommendations.yamls", "recommendations_local.yamls"}, impact.DroppedColumns)
+	assert.Empty(t, impact.DroppedTables)
+}
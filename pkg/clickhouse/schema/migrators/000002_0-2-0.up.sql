@@ -0,0 +1,5 @@
+--Alter table to add new columns
+ALTER TABLE flows
+ADD COLUMN clusterUUID String;
+ALTER TABLE flows_local
+ADD COLUMN clusterUUID String;
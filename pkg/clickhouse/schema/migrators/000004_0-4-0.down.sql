@@ -0,0 +1,2 @@
+--Drop table
+DROP tadetector_local
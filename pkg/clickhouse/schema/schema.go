@@ -0,0 +1,296 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema holds the canonical DDL of the Theia ClickHouse data schema:
+// the DDL creating the schema of the latest version, and the migrators
+// upgrading and downgrading the schema one version at a time. It is shared by
+// the schema migration tool and by the unit and e2e tests. The init scripts
+// and the migrators of the Theia Helm chart are checked against it by the
+// tests of this package.
+package schema
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+const migratorsDir = "migrators"
+
+var (
+	//go:embed schema.sql
+	ddl string
+
+	//go:embed migrators/*.sql
+	migratorFiles embed.FS
+
+	// versions are parsed from the embedded migrators, and validated when
+	// the package is initialized so that an inconsistent chain of migrators
+	// aborts the program instead of being applied.
+	versions = mustParseVersions()
+)
+
+// Version is a version of the data schema, as numbered by golang-migrate.
+type Version struct {
+	// Number is the golang-migrate version number of the data schema after
+	// applying the upgrading migrator.
+	Number int
+	// TheiaVersion is the Theia version upgraded from by the upgrading
+	// migrator, i.e. the data schema of TheiaVersion has version number
+	// Number - 1.
+	TheiaVersion string
+	// Up upgrades the data schema from version number Number - 1 to Number.
+	Up string
+	// Down downgrades the data schema from version number Number to Number - 1.
+	Down string
+}
+
+// Table is a table created with an explicit list of columns by the DDL.
+type Table struct {
+	Name    string
+	Columns []string
+}
+
+// DDL returns the DDL creating the data schema of the latest version, i.e.
+// the schema reached after applying all the upgrading migrators.
+func DDL() string {
+	return ddl
+}
+
+// Statements returns the statements of DDL.
+func Statements() []string {
+	return SplitStatements(ddl)
+}
+
+// Versions returns the versions of the data schema in ascending order.
+func Versions() []Version {
+	return append([]Version(nil), versions...)
+}
+
+// LatestVersion returns the version of the data schema created by DDL.
+func LatestVersion() Version {
+	return versions[len(versions)-1]
+}
+
+// Tables returns the tables created with an explicit list of columns by DDL,
+// in the order of creation. Distributed tables, views and dictionaries are
+// not included.
+func Tables() []Table {
+	var tables []Table
+	for _, statement := range Statements() {
+		if table, ok := parseCreateTable(statement); ok {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// Columns returns the columns of a table created by DDL, or nil if DDL does
+// not create the table with an explicit list of columns.
+func Columns(table string) []string {
+	for _, t := range Tables() {
+		if t.Name == table {
+			return t.Columns
+		}
+	}
+	return nil
+}
+
+// SplitStatements splits DDL into its statements, which end with a semicolon
+// at the end of a line, and removes their comment lines.
+func SplitStatements(ddl string) []string {
+	var statements []string
+	for _, chunk := range strings.Split(ddl, ";\n") {
+		var lines []string
+		for _, line := range strings.Split(chunk, "\n") {
+			if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			statements = append(statements, strings.TrimSuffix(strings.Join(lines, "\n"), ";"))
+		}
+	}
+	return statements
+}
+
+// ParseMigratorFileName returns the golang-migrate version number and the
+// Theia version of a migrator file name, e.g. 6 and "0.7.0" for
+// 000006_0-7-0.up.sql.
+func ParseMigratorFileName(name string) (int, string, error) {
+	fileNameArr := strings.Split(strings.Split(name, ".")[0], "_")
+	versionNumber, err := strconv.ParseInt(fileNameArr[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("error when parsing the version number: %v", err)
+	}
+	if len(fileNameArr) != 2 {
+		return 0, "", fmt.Errorf("unexpected migrator file name %s", name)
+	}
+	return int(versionNumber), strings.Replace(fileNameArr[1], "-", ".", -1), nil
+}
+
+// parseVersions returns the versions of the migrators in the migrators
+// directory of fsys, in ascending order, after validating them with
+// validateVersions.
+func parseVersions(fsys fs.FS) ([]Version, error) {
+	files, err := fs.ReadDir(fsys, migratorsDir)
+	if err != nil {
+		return nil, err
+	}
+	type versionFiles struct {
+		Version
+		up, down bool
+	}
+	versionsByNumber := make(map[int]*versionFiles)
+	for _, file := range files {
+		number, theiaVersion, err := ParseMigratorFileName(file.Name())
+		if err != nil {
+			return nil, err
+		}
+		version, ok := versionsByNumber[number]
+		if !ok {
+			version = &versionFiles{Version: Version{Number: number, TheiaVersion: theiaVersion}}
+			versionsByNumber[number] = version
+		} else if version.TheiaVersion != theiaVersion {
+			return nil, fmt.Errorf("migrators for version %s and %s have the same version number %d", version.TheiaVersion, theiaVersion, number)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(migratorsDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasSuffix(file.Name(), ".up.sql"):
+			version.Up, version.up = string(content), true
+		case strings.HasSuffix(file.Name(), ".down.sql"):
+			version.Down, version.down = string(content), true
+		default:
+			return nil, fmt.Errorf("unexpected migrator file name %s", file.Name())
+		}
+	}
+	var result []Version
+	for number := 1; number <= len(versionsByNumber); number++ {
+		version, ok := versionsByNumber[number]
+		if !ok {
+			return nil, fmt.Errorf("migrators for version number %d are missing", number)
+		}
+		if !version.up || !version.down {
+			return nil, fmt.Errorf("both upgrading and downgrading migrators are required for version %s", version.TheiaVersion)
+		}
+		result = append(result, version.Version)
+	}
+	if err := validateVersions(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// validateVersions checks that versions form a single chain which can be
+// traversed in both directions: they are numbered from 1 without gaps, and
+// their Theia versions increase with their numbers, so that the migrators are
+// applied in the order of the releases.
+func validateVersions(versions []Version) error {
+	if len(versions) == 0 {
+		return fmt.Errorf("no migrators")
+	}
+	var previous semver.Version
+	for i, version := range versions {
+		if version.Number != i+1 {
+			return fmt.Errorf("version %s has version number %d, expected %d", version.TheiaVersion, version.Number, i+1)
+		}
+		theiaVersion, err := semver.Parse(version.TheiaVersion)
+		if err != nil {
+			return fmt.Errorf("error when parsing version %s: %v", version.TheiaVersion, err)
+		}
+		if i > 0 && !previous.LT(theiaVersion) {
+			return fmt.Errorf("version %s should be later than version %s as its migrators have a higher version number", version.TheiaVersion, versions[i-1].TheiaVersion)
+		}
+		previous = theiaVersion
+	}
+	return nil
+}
+
+func mustParseVersions() []Version {
+	versions, err := parseVersions(migratorFiles)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded migrators: %v", err))
+	}
+	return versions
+}
+
+// parseCreateTable returns the table created by a CREATE TABLE statement with
+// an explicit list of columns. Indexes, projections and constraints in the
+// list are not columns.
+func parseCreateTable(statement string) (Table, bool) {
+	fields := strings.Fields(statement)
+	if len(fields) < 3 || !strings.EqualFold(fields[0], "CREATE") || !strings.EqualFold(fields[1], "TABLE") {
+		return Table{}, false
+	}
+	fields = fields[2:]
+	if len(fields) > 3 && strings.EqualFold(fields[0], "IF") && strings.EqualFold(fields[1], "NOT") && strings.EqualFold(fields[2], "EXISTS") {
+		fields = fields[3:]
+	}
+	table := Table{Name: strings.SplitN(fields[0], "(", 2)[0]}
+	nameEnd := strings.Index(statement, table.Name) + len(table.Name)
+	if !strings.HasPrefix(strings.TrimSpace(statement[nameEnd:]), "(") {
+		return Table{}, false
+	}
+	depth := 0
+	quoted := false
+	definitionStart := 0
+	addColumn := func(definition string) {
+		column := strings.Fields(definition)
+		if len(column) == 0 {
+			return
+		}
+		switch strings.ToUpper(column[0]) {
+		case "INDEX", "PROJECTION", "CONSTRAINT":
+		default:
+			table.Columns = append(table.Columns, column[0])
+		}
+	}
+	for i := nameEnd; i < len(statement); i++ {
+		c := statement[i]
+		if c == '\'' {
+			quoted = !quoted
+		}
+		if quoted {
+			continue
+		}
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				definitionStart = i + 1
+			}
+		case ',':
+			if depth == 1 {
+				addColumn(statement[definitionStart:i])
+				definitionStart = i + 1
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				addColumn(statement[definitionStart:i])
+				return table, true
+			}
+		}
+	}
+	return Table{}, false
+}
@@ -0,0 +1,816 @@
+--The data schema of the latest Theia version, i.e. the schema reached after
+--applying all the upgrading migrators. The createTable function of
+--create_table.sh in the Theia Helm chart creates the same schema, apart from the
+--TTL of the tables.
+
+--Create a table to store records
+CREATE TABLE IF NOT EXISTS flows_local (
+    timeInserted DateTime DEFAULT now(),
+    flowStartSeconds DateTime,
+    flowEndSeconds DateTime,
+    flowEndSecondsFromSourceNode DateTime,
+    flowEndSecondsFromDestinationNode DateTime,
+    flowEndReason UInt8,
+    sourceIP String,
+    destinationIP String,
+    sourceTransportPort UInt16,
+    destinationTransportPort UInt16,
+    protocolIdentifier UInt8,
+    packetTotalCount UInt64,
+    octetTotalCount UInt64,
+    packetDeltaCount UInt64,
+    octetDeltaCount UInt64,
+    reversePacketTotalCount UInt64,
+    reverseOctetTotalCount UInt64,
+    reversePacketDeltaCount UInt64,
+    reverseOctetDeltaCount UInt64,
+    sourcePodName String,
+    sourcePodNamespace String,
+    sourceNodeName String,
+    destinationPodName String,
+    destinationPodNamespace String,
+    destinationNodeName String,
+    destinationClusterIP String,
+    destinationServicePort UInt16,
+    destinationServicePortName String,
+    ingressNetworkPolicyName String,
+    ingressNetworkPolicyNamespace String,
+    ingressNetworkPolicyRuleName String,
+    ingressNetworkPolicyRuleAction UInt8,
+    ingressNetworkPolicyType UInt8,
+    egressNetworkPolicyName String,
+    egressNetworkPolicyNamespace String,
+    egressNetworkPolicyRuleName String,
+    egressNetworkPolicyRuleAction UInt8,
+    egressNetworkPolicyType UInt8,
+    tcpState String,
+    flowType UInt8,
+    sourcePodLabels String,
+    destinationPodLabels String,
+    throughput UInt64,
+    reverseThroughput UInt64,
+    throughputFromSourceNode UInt64,
+    throughputFromDestinationNode UInt64,
+    reverseThroughputFromSourceNode UInt64,
+    reverseThroughputFromDestinationNode UInt64,
+    clusterUUID String,
+    egressName String,
+    egressIP String,
+    trusted UInt8 DEFAULT 0,
+    --Traffic class of the flow, computed at query time so that existing
+    --records are classified as well
+    trafficClass String ALIAS multiIf(
+        flowType IN (1, 2) AND (sourcePodName = '' OR (destinationPodName = '' AND destinationServicePortName = '')), 'host-network',
+        destinationServicePortName != '', 'pod-to-service',
+        flowType = 1, 'intra-node',
+        flowType = 2, 'inter-node',
+        flowType = 3, 'pod-to-external',
+        flowType = 4, 'external-to-pod',
+        'unknown')
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeInserted, flowEndSeconds);
+
+--Create a Materialized View to aggregate data for Pods and save the data
+--to default.pod_view_table_local
+CREATE TABLE IF NOT EXISTS pod_view_table_local (
+    timeInserted DateTime DEFAULT now(),
+    flowEndSeconds DateTime,
+    flowEndSecondsFromSourceNode DateTime,
+    flowEndSecondsFromDestinationNode DateTime,
+    sourcePodName String,
+    destinationPodName String,
+    destinationIP String,
+    destinationServicePort UInt16,
+    destinationServicePortName String,
+    flowType UInt8,
+    sourcePodNamespace String,
+    destinationPodNamespace String,
+    sourceTransportPort UInt16,
+    destinationTransportPort UInt16,
+    octetDeltaCount UInt64,
+    reverseOctetDeltaCount UInt64,
+    throughput UInt64,
+    reverseThroughput UInt64,
+    throughputFromSourceNode UInt64,
+    throughputFromDestinationNode UInt64,
+    clusterUUID String
+) ENGINE = ReplicatedSummingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    sourcePodName,
+    destinationPodName,
+    destinationIP,
+    destinationServicePort,
+    destinationServicePortName,
+    flowType,
+    sourcePodNamespace,
+    destinationPodNamespace,
+    sourceTransportPort,
+    destinationTransportPort,
+    clusterUUID);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_pod_view_local TO pod_view_table_local
+AS SELECT
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    sourcePodName,
+    destinationPodName,
+    destinationIP,
+    destinationServicePort,
+    destinationServicePortName,
+    flowType,
+    sourcePodNamespace,
+    destinationPodNamespace,
+    sourceTransportPort,
+    destinationTransportPort,
+    sum(octetDeltaCount) AS octetDeltaCount,
+    sum(reverseOctetDeltaCount) AS reverseOctetDeltaCount,
+    sum(throughput) AS throughput,
+    sum(reverseThroughput) AS reverseThroughput,
+    sum(throughputFromSourceNode) AS throughputFromSourceNode,
+    sum(throughputFromDestinationNode) AS throughputFromDestinationNode,
+    clusterUUID
+FROM flows_local
+GROUP BY
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    sourcePodName,
+    destinationPodName,
+    destinationIP,
+    destinationServicePort,
+    destinationServicePortName,
+    flowType,
+    sourcePodNamespace,
+    destinationPodNamespace,
+    sourceTransportPort,
+    destinationTransportPort,
+    clusterUUID;
+
+--Create a Materialized View to aggregate data for Nodes and save the data
+--to default.node_view_table_local
+CREATE TABLE IF NOT EXISTS node_view_table_local (
+    timeInserted DateTime DEFAULT now(),
+    flowEndSeconds DateTime,
+    flowEndSecondsFromSourceNode DateTime,
+    flowEndSecondsFromDestinationNode DateTime,
+    sourceNodeName String,
+    destinationNodeName String,
+    sourcePodNamespace String,
+    destinationPodNamespace String,
+    octetDeltaCount UInt64,
+    reverseOctetDeltaCount UInt64,
+    throughput UInt64,
+    reverseThroughput UInt64,
+    throughputFromSourceNode UInt64,
+    reverseThroughputFromSourceNode UInt64,
+    throughputFromDestinationNode UInt64,
+    reverseThroughputFromDestinationNode UInt64,
+    clusterUUID String
+) ENGINE = ReplicatedSummingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    sourceNodeName,
+    destinationNodeName,
+    sourcePodNamespace,
+    destinationPodNamespace,
+    clusterUUID);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_node_view_local TO node_view_table_local
+AS SELECT
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    sourceNodeName,
+    destinationNodeName,
+    sourcePodNamespace,
+    destinationPodNamespace,
+    sum(octetDeltaCount) AS octetDeltaCount,
+    sum(reverseOctetDeltaCount) AS reverseOctetDeltaCount,
+    sum(throughput) AS throughput,
+    sum(reverseThroughput) AS reverseThroughput,
+    sum(throughputFromSourceNode) AS throughputFromSourceNode,
+    sum(reverseThroughputFromSourceNode) AS reverseThroughputFromSourceNode,
+    sum(throughputFromDestinationNode) AS throughputFromDestinationNode,
+    sum(reverseThroughputFromDestinationNode) AS reverseThroughputFromDestinationNode,
+    clusterUUID
+FROM flows_local
+GROUP BY
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    sourceNodeName,
+    destinationNodeName,
+    sourcePodNamespace,
+    destinationPodNamespace,
+    clusterUUID;
+
+--Create a Materialized View to aggregate data for network policies and
+--save the data to default.policy_view_table_local
+CREATE TABLE IF NOT EXISTS policy_view_table_local (
+    timeInserted DateTime DEFAULT now(),
+    flowEndSeconds DateTime,
+    flowEndSecondsFromSourceNode DateTime,
+    flowEndSecondsFromDestinationNode DateTime,
+    egressNetworkPolicyName String,
+    egressNetworkPolicyNamespace String,
+    egressNetworkPolicyRuleAction UInt8,
+    ingressNetworkPolicyName String,
+    ingressNetworkPolicyNamespace String,
+    ingressNetworkPolicyRuleAction UInt8,
+    sourcePodName String,
+    sourceTransportPort UInt16,
+    sourcePodNamespace String,
+    destinationPodName String,
+    destinationTransportPort UInt16,
+    destinationPodNamespace String,
+    destinationServicePort UInt16,
+    destinationServicePortName String,
+    destinationIP String,
+    octetDeltaCount UInt64,
+    reverseOctetDeltaCount UInt64,
+    throughput UInt64,
+    reverseThroughput UInt64,
+    throughputFromSourceNode UInt64,
+    reverseThroughputFromSourceNode UInt64,
+    throughputFromDestinationNode UInt64,
+    reverseThroughputFromDestinationNode UInt64,
+    clusterUUID String,
+    egressNetworkPolicyRuleName String,
+    ingressNetworkPolicyRuleName String
+) ENGINE = ReplicatedSummingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleAction,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleAction,
+    sourcePodName,
+    sourceTransportPort,
+    sourcePodNamespace,
+    destinationPodName,
+    destinationTransportPort,
+    destinationPodNamespace,
+    destinationServicePort,
+    destinationServicePortName,
+    destinationIP,
+    clusterUUID);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_policy_view_local to policy_view_table_local
+AS SELECT
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleAction,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleAction,
+    sourcePodName,
+    sourceTransportPort,
+    sourcePodNamespace,
+    destinationPodName,
+    destinationTransportPort,
+    destinationPodNamespace,
+    destinationServicePort,
+    destinationServicePortName,
+    destinationIP,
+    sum(octetDeltaCount) AS octetDeltaCount,
+    sum(reverseOctetDeltaCount) AS reverseOctetDeltaCount,
+    sum(throughput) AS throughput,
+    sum(reverseThroughput) AS reverseThroughput,
+    sum(throughputFromSourceNode) AS throughputFromSourceNode,
+    sum(reverseThroughputFromSourceNode) AS reverseThroughputFromSourceNode,
+    sum(throughputFromDestinationNode) AS throughputFromDestinationNode,
+    sum(reverseThroughputFromDestinationNode) AS reverseThroughputFromDestinationNode,
+    clusterUUID,
+    egressNetworkPolicyRuleName,
+    ingressNetworkPolicyRuleName
+FROM flows_local
+GROUP BY
+    timeInserted,
+    flowEndSeconds,
+    flowEndSecondsFromSourceNode,
+    flowEndSecondsFromDestinationNode,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleAction,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleAction,
+    sourcePodName,
+    sourceTransportPort,
+    sourcePodNamespace,
+    destinationPodName,
+    destinationTransportPort,
+    destinationPodNamespace,
+    destinationServicePort,
+    destinationServicePortName,
+    destinationIP,
+    egressNetworkPolicyRuleName,
+    ingressNetworkPolicyRuleName,
+    clusterUUID;
+
+--Create a table to store the network policy recommendation results
+CREATE TABLE IF NOT EXISTS recommendations_local (
+    id String,
+    type String,
+    timeCreated DateTime,
+    policy String,
+    kind String
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeCreated);
+
+--Create a table to store the coverage of the recommended policies by the
+--flows of every Namespace, to judge the time range of a recommendation job
+CREATE TABLE IF NOT EXISTS recommendation_coverage_local (
+    id String,
+    namespace String,
+    matchedFlows UInt64,
+    unmatchedFlows UInt64,
+    timeCreated DateTime
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeCreated);
+
+--Create a table to store the data window analyzed by a recommendation job:
+--the time range and the number of its flow records, and the Nodes they
+--were exported from, a comma-separated list
+CREATE TABLE IF NOT EXISTS recommendation_data_window_local (
+    id String,
+    minFlowTime DateTime,
+    maxFlowTime DateTime,
+    flows UInt64,
+    nodes String,
+    emptyResultReason String,
+    timeCreated DateTime
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeCreated);
+
+--Create a table to store the Throughput Anomaly Detector results
+CREATE TABLE IF NOT EXISTS tadetector_local (
+    sourceIP String,
+    sourceTransportPort UInt16,
+    destinationIP String,
+    destinationTransportPort UInt16,
+    protocolIdentifier UInt16,
+    flowStartSeconds DateTime,
+    podNamespace String,
+    podLabels String,
+    podName String,
+    destinationServicePortName String,
+    direction String,
+    flowEndSeconds DateTime,
+    throughputStandardDeviation Float64,
+    aggType String,
+    algoType String,
+    algoCalc Float64,
+    throughput Float64,
+    anomaly String,
+    id String
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (flowStartSeconds);
+
+--Create a table to store the results of the custom analytics jobs: a row
+--per record written by the job, e.g. a JSON document
+CREATE TABLE IF NOT EXISTS analytics_job_results_local (
+    id String,
+    template String,
+    result String,
+    timeCreated DateTime DEFAULT now()
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeCreated);
+
+--Create a table to store the names of IPs, e.g. Service names of ClusterIPs
+--and reverse-DNS names of external IPs, used to enrich the flow records
+CREATE TABLE IF NOT EXISTS ip_names_local (
+    ip String,
+    name String,
+    kind String,
+    timeUpdated DateTime DEFAULT now()
+) engine=ReplicatedReplacingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}', timeUpdated)
+ORDER BY (ip);
+
+--Create a table to store the labels of the Nodes, as JSON objects, used to
+--enrich the flow records
+CREATE TABLE IF NOT EXISTS node_labels_local (
+    nodeName String,
+    labels String,
+    timeUpdated DateTime DEFAULT now()
+) engine=ReplicatedReplacingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}', timeUpdated)
+ORDER BY (nodeName);
+
+--Create a table to audit the deletions of records by the ClickHouse monitor
+CREATE TABLE IF NOT EXISTS deletion_audit_local (
+    timeDeleted DateTime DEFAULT now(),
+    tableName String,
+    rangeStart DateTime,
+    rangeEnd DateTime,
+    rowCount UInt64,
+    bytesReclaimed UInt64,
+    reason String
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (timeDeleted);
+
+--Create tables storing the flow records rolled up into 1-minute and 1-hour
+--buckets, so that long time ranges are queried without scanning the flow
+--records. A connection exported in several flow records of a bucket is
+--counted once by connections
+CREATE TABLE IF NOT EXISTS flows_rollup_1m_local (
+    timeBucket DateTime,
+    sourcePodNamespace String,
+    sourcePodName String,
+    sourceIP String,
+    sourceNodeName String,
+    destinationPodNamespace String,
+    destinationPodName String,
+    destinationIP String,
+    destinationNodeName String,
+    destinationServicePortName String,
+    flowType UInt8,
+    trafficClass String,
+    records SimpleAggregateFunction(sum, UInt64),
+    connections AggregateFunction(uniq, UInt64),
+    octetDeltaCount SimpleAggregateFunction(sum, UInt64),
+    packetDeltaCount SimpleAggregateFunction(sum, UInt64),
+    reverseOctetDeltaCount SimpleAggregateFunction(sum, UInt64),
+    reversePacketDeltaCount SimpleAggregateFunction(sum, UInt64),
+    lastFlowEndSeconds SimpleAggregateFunction(max, DateTime)
+) engine=ReplicatedAggregatingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (
+    timeBucket,
+    sourcePodNamespace,
+    sourcePodName,
+    sourceIP,
+    sourceNodeName,
+    destinationPodNamespace,
+    destinationPodName,
+    destinationIP,
+    destinationNodeName,
+    destinationServicePortName,
+    flowType,
+    trafficClass)
+TTL timeBucket + INTERVAL 30 DAY;
+
+CREATE TABLE IF NOT EXISTS flows_rollup_1h_local (
+    timeBucket DateTime,
+    sourcePodNamespace String,
+    sourcePodName String,
+    sourceIP String,
+    sourceNodeName String,
+    destinationPodNamespace String,
+    destinationPodName String,
+    destinationIP String,
+    destinationNodeName String,
+    destinationServicePortName String,
+    flowType UInt8,
+    trafficClass String,
+    records SimpleAggregateFunction(sum, UInt64),
+    connections AggregateFunction(uniq, UInt64),
+    octetDeltaCount SimpleAggregateFunction(sum, UInt64),
+    packetDeltaCount SimpleAggregateFunction(sum, UInt64),
+    reverseOctetDeltaCount SimpleAggregateFunction(sum, UInt64),
+    reversePacketDeltaCount SimpleAggregateFunction(sum, UInt64),
+    lastFlowEndSeconds SimpleAggregateFunction(max, DateTime)
+) engine=ReplicatedAggregatingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (
+    timeBucket,
+    sourcePodNamespace,
+    sourcePodName,
+    sourceIP,
+    sourceNodeName,
+    destinationPodNamespace,
+    destinationPodName,
+    destinationIP,
+    destinationNodeName,
+    destinationServicePortName,
+    flowType,
+    trafficClass)
+TTL timeBucket + INTERVAL 365 DAY;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_rollup_1m_view_local TO flows_rollup_1m_local
+AS SELECT
+    toStartOfMinute(flowEndSeconds) AS timeBucket,
+    sourcePodNamespace,
+    sourcePodName,
+    sourceIP,
+    sourceNodeName,
+    destinationPodNamespace,
+    destinationPodName,
+    destinationIP,
+    destinationNodeName,
+    destinationServicePortName,
+    flowType,
+    trafficClass,
+    count() AS records,
+    uniqState(cityHash64(sourceIP, destinationIP, sourceTransportPort, destinationTransportPort, protocolIdentifier, flowStartSeconds)) AS connections,
+    sum(octetDeltaCount) AS octetDeltaCount,
+    sum(packetDeltaCount) AS packetDeltaCount,
+    sum(reverseOctetDeltaCount) AS reverseOctetDeltaCount,
+    sum(reversePacketDeltaCount) AS reversePacketDeltaCount,
+    max(flowEndSeconds) AS lastFlowEndSeconds
+FROM flows_local
+GROUP BY
+    timeBucket,
+    sourcePodNamespace,
+    sourcePodName,
+    sourceIP,
+    sourceNodeName,
+    destinationPodNamespace,
+    destinationPodName,
+    destinationIP,
+    destinationNodeName,
+    destinationServicePortName,
+    flowType,
+    trafficClass;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_rollup_1h_view_local TO flows_rollup_1h_local
+AS SELECT
+    toStartOfHour(flowEndSeconds) AS timeBucket,
+    sourcePodNamespace,
+    sourcePodName,
+    sourceIP,
+    sourceNodeName,
+    destinationPodNamespace,
+    destinationPodName,
+    destinationIP,
+    destinationNodeName,
+    destinationServicePortName,
+    flowType,
+    trafficClass,
+    count() AS records,
+    uniqState(cityHash64(sourceIP, destinationIP, sourceTransportPort, destinationTransportPort, protocolIdentifier, flowStartSeconds)) AS connections,
+    sum(octetDeltaCount) AS octetDeltaCount,
+    sum(packetDeltaCount) AS packetDeltaCount,
+    sum(reverseOctetDeltaCount) AS reverseOctetDeltaCount,
+    sum(reversePacketDeltaCount) AS reversePacketDeltaCount,
+    max(flowEndSeconds) AS lastFlowEndSeconds
+FROM flows_local
+GROUP BY
+    timeBucket,
+    sourcePodNamespace,
+    sourcePodName,
+    sourceIP,
+    sourceNodeName,
+    destinationPodNamespace,
+    destinationPodName,
+    destinationIP,
+    destinationNodeName,
+    destinationServicePortName,
+    flowType,
+    trafficClass;
+
+--Create a table to store the last flow record of every flow, i.e. of every
+--connection identified by its 5-tuple and start time, so that the flows
+--updated by several flow records are counted once. Older records of a flow
+--are only replaced when parts are merged, query the flows_latest view instead
+CREATE TABLE IF NOT EXISTS flows_latest_records_local (
+    timeInserted DateTime DEFAULT now(),
+    flowStartSeconds DateTime,
+    flowEndSeconds DateTime,
+    flowEndReason UInt8,
+    sourceIP String,
+    destinationIP String,
+    sourceTransportPort UInt16,
+    destinationTransportPort UInt16,
+    protocolIdentifier UInt8,
+    packetTotalCount UInt64,
+    octetTotalCount UInt64,
+    reversePacketTotalCount UInt64,
+    reverseOctetTotalCount UInt64,
+    sourcePodName String,
+    sourcePodNamespace String,
+    sourceNodeName String,
+    destinationPodName String,
+    destinationPodNamespace String,
+    destinationNodeName String,
+    destinationServicePortName String,
+    ingressNetworkPolicyName String,
+    ingressNetworkPolicyNamespace String,
+    ingressNetworkPolicyRuleAction UInt8,
+    ingressNetworkPolicyType UInt8,
+    egressNetworkPolicyName String,
+    egressNetworkPolicyNamespace String,
+    egressNetworkPolicyRuleAction UInt8,
+    egressNetworkPolicyType UInt8,
+    tcpState String,
+    flowType UInt8,
+    trafficClass String
+) engine=ReplicatedReplacingMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}', flowEndSeconds)
+ORDER BY (
+    sourceIP,
+    destinationIP,
+    sourceTransportPort,
+    destinationTransportPort,
+    protocolIdentifier,
+    flowStartSeconds);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS flows_latest_records_view_local TO flows_latest_records_local
+AS SELECT
+    timeInserted,
+    flowStartSeconds,
+    flowEndSeconds,
+    flowEndReason,
+    sourceIP,
+    destinationIP,
+    sourceTransportPort,
+    destinationTransportPort,
+    protocolIdentifier,
+    packetTotalCount,
+    octetTotalCount,
+    reversePacketTotalCount,
+    reverseOctetTotalCount,
+    sourcePodName,
+    sourcePodNamespace,
+    sourceNodeName,
+    destinationPodName,
+    destinationPodNamespace,
+    destinationNodeName,
+    destinationServicePortName,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleAction,
+    ingressNetworkPolicyType,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleAction,
+    egressNetworkPolicyType,
+    tcpState,
+    flowType,
+    trafficClass
+FROM flows_local;
+
+--Create distributed tables for cluster
+CREATE TABLE IF NOT EXISTS flows AS flows_local
+engine=Distributed('{cluster}', default, flows_local, rand());
+
+CREATE TABLE IF NOT EXISTS flows_pod_view AS flows_pod_view_local
+engine=Distributed('{cluster}', default, flows_pod_view_local, rand());
+
+CREATE TABLE IF NOT EXISTS flows_node_view AS flows_node_view_local
+engine=Distributed('{cluster}', default, flows_node_view_local, rand());
+
+CREATE TABLE IF NOT EXISTS flows_policy_view AS flows_policy_view_local
+engine=Distributed('{cluster}', default, flows_policy_view_local, rand());
+
+CREATE TABLE IF NOT EXISTS recommendations AS recommendations_local
+engine=Distributed('{cluster}', default, recommendations_local, rand());
+
+CREATE TABLE IF NOT EXISTS recommendation_coverage AS recommendation_coverage_local
+engine=Distributed('{cluster}', default, recommendation_coverage_local, rand());
+
+CREATE TABLE IF NOT EXISTS recommendation_data_window AS recommendation_data_window_local
+engine=Distributed('{cluster}', default, recommendation_data_window_local, rand());
+
+CREATE TABLE IF NOT EXISTS tadetector AS tadetector_local
+engine=Distributed('{cluster}', default, tadetector_local, rand());
+
+CREATE TABLE IF NOT EXISTS analytics_job_results AS analytics_job_results_local
+engine=Distributed('{cluster}', default, analytics_job_results_local, rand());
+
+CREATE TABLE IF NOT EXISTS ip_names AS ip_names_local
+engine=Distributed('{cluster}', default, ip_names_local, cityHash64(ip));
+
+CREATE TABLE IF NOT EXISTS node_labels AS node_labels_local
+engine=Distributed('{cluster}', default, node_labels_local, cityHash64(nodeName));
+
+CREATE TABLE IF NOT EXISTS deletion_audit AS deletion_audit_local
+engine=Distributed('{cluster}', default, deletion_audit_local, rand());
+
+CREATE TABLE IF NOT EXISTS flows_rollup_1m AS flows_rollup_1m_local
+engine=Distributed('{cluster}', default, flows_rollup_1m_local, rand());
+
+CREATE TABLE IF NOT EXISTS flows_rollup_1h AS flows_rollup_1h_local
+engine=Distributed('{cluster}', default, flows_rollup_1h_local, rand());
+
+CREATE TABLE IF NOT EXISTS flows_latest_records AS flows_latest_records_local
+engine=Distributed('{cluster}', default, flows_latest_records_local, rand());
+
+--Create a dictionary to look up the latest name of an IP at query time
+CREATE DICTIONARY IF NOT EXISTS ip_names_dict (
+    ip String,
+    name String,
+    kind String
+)
+PRIMARY KEY ip
+SOURCE(CLICKHOUSE(QUERY 'SELECT ip, argMax(name, timeUpdated) AS name, argMax(kind, timeUpdated) AS kind FROM default.ip_names GROUP BY ip'))
+LIFETIME(MIN 60 MAX 300)
+LAYOUT(COMPLEX_KEY_HASHED());
+
+--Create a dictionary to look up the latest labels of a Node at query time
+CREATE DICTIONARY IF NOT EXISTS node_labels_dict (
+    nodeName String,
+    labels String
+)
+PRIMARY KEY nodeName
+SOURCE(CLICKHOUSE(QUERY 'SELECT nodeName, argMax(labels, timeUpdated) AS labels FROM default.node_labels GROUP BY nodeName'))
+LIFETIME(MIN 60 MAX 300)
+LAYOUT(COMPLEX_KEY_HASHED());
+
+--Create a view of the flow records enriched with the names of their
+--destinations and the labels of their Nodes
+CREATE VIEW IF NOT EXISTS flows_enriched AS
+SELECT
+    *,
+    dictGetOrDefault('default.ip_names_dict', 'name', tuple(destinationIP), '') AS destinationName,
+    dictGetOrDefault('default.ip_names_dict', 'kind', tuple(destinationIP), '') AS destinationNameKind,
+    dictGetOrDefault('default.node_labels_dict', 'labels', tuple(sourceNodeName), '') AS sourceNodeLabels,
+    dictGetOrDefault('default.node_labels_dict', 'labels', tuple(destinationNodeName), '') AS destinationNodeLabels
+FROM flows;
+
+--Create a view of the latest state of every flow, from its last flow record:
+--one row per flow, with the total counts of packets and bytes of the flow
+--and the attributes of its last record. The last record is the one which
+--ended last, or was inserted last
+CREATE VIEW IF NOT EXISTS flows_latest AS
+SELECT
+    sourceIP,
+    destinationIP,
+    sourceTransportPort,
+    destinationTransportPort,
+    protocolIdentifier,
+    flowStartSeconds,
+    latest.1 AS flowEndSeconds,
+    latest.2 AS timeInserted,
+    latest.3 AS flowEndReason,
+    latest.4 AS packetTotalCount,
+    latest.5 AS octetTotalCount,
+    latest.6 AS reversePacketTotalCount,
+    latest.7 AS reverseOctetTotalCount,
+    latest.8 AS sourcePodName,
+    latest.9 AS sourcePodNamespace,
+    latest.10 AS sourceNodeName,
+    latest.11 AS destinationPodName,
+    latest.12 AS destinationPodNamespace,
+    latest.13 AS destinationNodeName,
+    latest.14 AS destinationServicePortName,
+    latest.15 AS ingressNetworkPolicyName,
+    latest.16 AS ingressNetworkPolicyNamespace,
+    latest.17 AS ingressNetworkPolicyRuleAction,
+    latest.18 AS ingressNetworkPolicyType,
+    latest.19 AS egressNetworkPolicyName,
+    latest.20 AS egressNetworkPolicyNamespace,
+    latest.21 AS egressNetworkPolicyRuleAction,
+    latest.22 AS egressNetworkPolicyType,
+    latest.23 AS tcpState,
+    latest.24 AS flowType,
+    latest.25 AS trafficClass
+FROM (
+    SELECT
+        sourceIP,
+        destinationIP,
+        sourceTransportPort,
+        destinationTransportPort,
+        protocolIdentifier,
+        flowStartSeconds,
+        argMax(tuple(
+            flowEndSeconds,
+            timeInserted,
+            flowEndReason,
+            packetTotalCount,
+            octetTotalCount,
+            reversePacketTotalCount,
+            reverseOctetTotalCount,
+            sourcePodName,
+            sourcePodNamespace,
+            sourceNodeName,
+            destinationPodName,
+            destinationPodNamespace,
+            destinationNodeName,
+            destinationServicePortName,
+            ingressNetworkPolicyName,
+            ingressNetworkPolicyNamespace,
+            ingressNetworkPolicyRuleAction,
+            ingressNetworkPolicyType,
+            egressNetworkPolicyName,
+            egressNetworkPolicyNamespace,
+            egressNetworkPolicyRuleAction,
+            egressNetworkPolicyType,
+            tcpState,
+            flowType,
+            trafficClass), tuple(flowEndSeconds, timeInserted)) AS latest
+    FROM flows_latest_records
+    GROUP BY
+        sourceIP,
+        destinationIP,
+        sourceTransportPort,
+        destinationTransportPort,
+        protocolIdentifier,
+        flowStartSeconds);
@@ -0,0 +1,213 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chartDatasourcesPath = "../../../build/charts/theia/provisioning/datasources"
+
+func TestVersions(t *testing.T) {
+	versions := Versions()
+	require.NotEmpty(t, versions)
+	for i, version := range versions {
+		assert.Equal(t, i+1, version.Number)
+		assert.NotEmpty(t, version.Up, "upgrading migrator of version %s", version.TheiaVersion)
+	}
+	assert.Equal(t, Version{Number: 1, TheiaVersion: "0.1.0", Up: versions[0].Up, Down: versions[0].Down}, versions[0])
+	assert.Equal(t, versions[len(versions)-1], LatestVersion())
+}
+
+func TestParseVersions(t *testing.T) {
+	migrators := func(names ...string) fstest.MapFS {
+		fsys := fstest.MapFS{}
+		for _, name := range names {
+			fsys[path.Join(migratorsDir, name)] = &fstest.MapFile{Data: []byte(name)}
+		}
+		return fsys
+	}
+	for _, tc := range []struct {
+		name             string
+		fsys             fstest.MapFS
+		expectedVersions []Version
+		expectedErrorMsg string
+	}{
+		{
+			name: "Valid migrators",
+			fsys: migrators("000001_0-1-0.up.sql", "000001_0-1-0.down.sql", "000002_0-3-0.up.sql", "000002_0-3-0.down.sql"),
+			expectedVersions: []Version{
+				{Number: 1, TheiaVersion: "0.1.0", Up: "000001_0-1-0.up.sql", Down: "000001_0-1-0.down.sql"},
+				{Number: 2, TheiaVersion: "0.3.0", Up: "000002_0-3-0.up.sql", Down: "000002_0-3-0.down.sql"},
+			},
+		},
+		{
+			name:             "No migrators",
+			fsys:             fstest.MapFS{migratorsDir: &fstest.MapFile{Mode: fs.ModeDir}},
+			expectedErrorMsg: "no migrators",
+		},
+		{
+			name:             "Missing downgrading migrator",
+			fsys:             migrators("000001_0-1-0.up.sql", "000002_0-3-0.up.sql", "000002_0-3-0.down.sql"),
+			expectedErrorMsg: "both upgrading and downgrading migrators are required for version 0.1.0",
+		},
+		{
+			name:             "Missing version number",
+			fsys:             migrators("000001_0-1-0.up.sql", "000001_0-1-0.down.sql", "000003_0-5-0.up.sql", "000003_0-5-0.down.sql"),
+			expectedErrorMsg: "migrators for version number 2 are missing",
+		},
+		{
+			name:             "Duplicate version number",
+			fsys:             migrators("000001_0-1-0.up.sql", "000001_0-2-0.down.sql"),
+			expectedErrorMsg: "migrators for version 0.1.0 and 0.2.0 have the same version number 1",
+		},
+		{
+			name:             "Unordered migrator versions",
+			fsys:             migrators("000001_0-3-0.up.sql", "000001_0-3-0.down.sql", "000002_0-1-0.up.sql", "000002_0-1-0.down.sql"),
+			expectedErrorMsg: "version 0.1.0 should be later than version 0.3.0 as its migrators have a higher version number",
+		},
+		{
+			name:             "Same Theia version",
+			fsys:             migrators("000001_0-3-0.up.sql", "000001_0-3-0.down.sql", "000002_0-3-0.up.sql", "000002_0-3-0.down.sql"),
+			expectedErrorMsg: "version 0.3.0 should be later than version 0.3.0",
+		},
+		{
+			name:             "Invalid Theia version",
+			fsys:             migrators("000001_latest.up.sql", "000001_latest.down.sql"),
+			expectedErrorMsg: "error when parsing version latest",
+		},
+		{
+			name:             "Unexpected file",
+			fsys:             migrators("000001_0-1-0.sql"),
+			expectedErrorMsg: "unexpected migrator file name 000001_0-1-0.sql",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			versions, err := parseVersions(tc.fsys)
+			if tc.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedVersions, versions)
+		})
+	}
+}
+
+func TestParseMigratorFileName(t *testing.T) {
+	number, theiaVersion, err := ParseMigratorFileName("000006_0-7-0.up.sql")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, number)
+	assert.Equal(t, "0.7.0", theiaVersion)
+
+	_, _, err = ParseMigratorFileName("0-7-0.up.sql")
+	assert.ErrorContains(t, err, "error when parsing the version number")
+	_, _, err = ParseMigratorFileName("000006_0-7-0_1.up.sql")
+	assert.EqualError(t, err, "unexpected migrator file name 000006_0-7-0_1.up.sql")
+}
+
+func TestTables(t *testing.T) {
+	var names []string
+	for _, table := range Tables() {
+		names = append(names, table.Name)
+	}
+	assert.Equal(t, []string{
+		"flows_local", "pod_view_table_local", "node_view_table_local", "policy_view_table_local",
+		"recommendations_local", "recommendation_coverage_local", "recommendation_data_window_local", "tadetector_local", "analytics_job_results_local", "ip_names_local", "node_labels_local", "deletion_audit_local",
+		"flows_rollup_1m_local", "flows_rollup_1h_local", "flows_latest_records_local",
+	}, names)
+	assert.Equal(t, []string{"id", "type", "timeCreated", "policy", "kind"}, Columns("recommendations_local"))
+	flowsColumns := Columns("flows_local")
+	assert.Equal(t, "timeInserted", flowsColumns[0])
+	assert.Equal(t, "trafficClass", flowsColumns[len(flowsColumns)-1])
+	assert.Nil(t, Columns("flows"))
+	assert.Nil(t, Columns("flows_enriched"))
+}
+
+func TestParseCreateTable(t *testing.T) {
+	table, ok := parseCreateTable(`CREATE TABLE test(
+    a String DEFAULT 'x,(y',
+    b UInt8 ALIAS if(a = '', 0, 1),
+    INDEX idx b TYPE minmax GRANULARITY 1
+) engine=MergeTree() ORDER BY (a, b)`)
+	assert.True(t, ok)
+	assert.Equal(t, Table{Name: "test", Columns: []string{"a", "b"}}, table)
+
+	_, ok = parseCreateTable("CREATE TABLE IF NOT EXISTS flows AS flows_local\nengine=Distributed('{cluster}', default, flows_local, rand())")
+	assert.False(t, ok)
+	_, ok = parseCreateTable("CREATE VIEW IF NOT EXISTS flows_enriched AS SELECT * FROM flows")
+	assert.False(t, ok)
+}
+
+// TestMigratorsMatchChart checks that the migrators shipped with the Helm
+// chart are the embedded migrators.
+func TestMigratorsMatchChart(t *testing.T) {
+	chartFiles, err := filepath.Glob(filepath.Join(chartDatasourcesPath, "migrators", "*.sql"))
+	require.NoError(t, err)
+	embeddedFiles, err := migratorFiles.ReadDir(migratorsDir)
+	require.NoError(t, err)
+	var chartNames, embeddedNames []string
+	for _, file := range chartFiles {
+		chartNames = append(chartNames, filepath.Base(file))
+	}
+	for _, file := range embeddedFiles {
+		embeddedNames = append(embeddedNames, file.Name())
+	}
+	require.Equal(t, embeddedNames, chartNames)
+	for _, name := range embeddedNames {
+		embedded, err := migratorFiles.ReadFile(path.Join(migratorsDir, name))
+		require.NoError(t, err)
+		chart, err := os.ReadFile(filepath.Join(chartDatasourcesPath, "migrators", name))
+		require.NoError(t, err)
+		assert.Equal(t, string(embedded), string(chart), "migrator %s", name)
+	}
+}
+
+// TestDDLMatchesCreateTable checks that the embedded DDL creates the same data
+// schema as the init scripts of the Helm chart, apart from the TTL and the
+// storage policy of the tables.
+func TestDDLMatchesCreateTable(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join(chartDatasourcesPath, "create_table.sh"))
+	require.NoError(t, err)
+	script := string(content)
+	start := strings.Index(script, "<<-EOSQL\n")
+	end := strings.LastIndex(script, "\nEOSQL")
+	require.True(t, start >= 0 && end > start, "createTable should run a heredoc")
+	ddl := strings.ReplaceAll(script[start+len("<<-EOSQL\n"):end], "{{ .Values.clickhouse.database }}", "default")
+	var statements []string
+	for _, statement := range SplitStatements(ddl) {
+		if strings.Contains(statement, "MODIFY TTL") || strings.Contains(statement, "merge_with_ttl_timeout") || strings.Contains(statement, "storage_policy") {
+			continue
+		}
+		statements = append(statements, statement)
+	}
+	normalize := func(statements []string) []string {
+		normalized := make([]string, 0, len(statements))
+		for _, statement := range statements {
+			normalized = append(normalized, strings.Join(strings.Fields(statement), " "))
+		}
+		return normalized
+	}
+	assert.Equal(t, normalize(statements), normalize(Statements()))
+}
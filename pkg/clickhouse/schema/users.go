@@ -0,0 +1,143 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Role is a least-privilege role of the users of the Theia ClickHouse
+// database.
+type Role string
+
+const (
+	// RoleWriter can only insert flow records, e.g. for the Flow Aggregator.
+	RoleWriter Role = "writer"
+	// RoleReader can only read the Theia tables and dictionaries, e.g. for
+	// Grafana.
+	RoleReader Role = "reader"
+	// RoleAdmin can read, alter and delete the Theia tables, and read the
+	// system tables, e.g. for the ClickHouse monitor.
+	RoleAdmin Role = "admin"
+
+	defaultDatabase = "default"
+)
+
+var (
+	// Roles are the valid roles, in the order of creation.
+	Roles = []Role{RoleWriter, RoleReader, RoleAdmin}
+
+	// userNameRegex matches the names of the users created by UsersDDL,
+	// which are not quoted in the DDL.
+	userNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// User is a ClickHouse user granted one of the Theia roles.
+type User struct {
+	Name     string
+	Password string
+	Role     Role
+}
+
+// ParseRole returns the Role of the given name.
+func ParseRole(name string) (Role, error) {
+	for _, role := range Roles {
+		if string(role) == name {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("role %q is not valid, it should be one of writer, reader or admin", name)
+}
+
+// ValidateUser validates the name, the password and the role of a user.
+func ValidateUser(user User) error {
+	if !userNameRegex.MatchString(user.Name) {
+		return fmt.Errorf("user name %q is not valid, it should only contain letters, digits and underscores, and not start with a digit", user.Name)
+	}
+	if user.Password == "" {
+		return fmt.Errorf("password of user %s should not be empty", user.Name)
+	}
+	_, err := ParseRole(string(user.Role))
+	return err
+}
+
+// RoleName returns the name of the ClickHouse role of a Theia role in a
+// database, which is qualified by the database so that several Theia
+// databases of a ClickHouse server have their own roles.
+func RoleName(role Role, database string) string {
+	if database == "" {
+		database = defaultDatabase
+	}
+	return fmt.Sprintf("theia_%s_%s", database, role)
+}
+
+// RolesDDL returns the statements creating the roles of the database and
+// granting their privileges. The statements are executed on the cluster if it
+// is not empty. They can be executed again to restore the privileges of the
+// roles.
+func RolesDDL(database, cluster string) []string {
+	if database == "" {
+		database = defaultDatabase
+	}
+	onCluster := onClusterClause(cluster)
+	grants := map[Role][]string{
+		RoleWriter: {fmt.Sprintf("INSERT ON %s.*", database)},
+		RoleReader: {fmt.Sprintf("SELECT, dictGet ON %s.*", database)},
+		RoleAdmin: {
+			fmt.Sprintf("ALL ON %s.*", database),
+			"SELECT ON system.*",
+			"REMOTE ON *.*",
+		},
+	}
+	var statements []string
+	for _, role := range Roles {
+		roleName := RoleName(role, database)
+		statements = append(statements, fmt.Sprintf("CREATE ROLE IF NOT EXISTS %s%s", roleName, onCluster))
+		for _, grant := range grants[role] {
+			statements = append(statements, fmt.Sprintf("GRANT%s %s TO %s", onCluster, grant, roleName))
+		}
+	}
+	return statements
+}
+
+// UserDDL returns the statements creating the user, or replacing it with the
+// given password if it exists, and granting it its role in the database. The
+// roles must have been created with RolesDDL.
+func UserDDL(user User, database, cluster string) ([]string, error) {
+	if err := ValidateUser(user); err != nil {
+		return nil, err
+	}
+	roleName := RoleName(user.Role, database)
+	onCluster := onClusterClause(cluster)
+	return []string{
+		fmt.Sprintf("CREATE USER OR REPLACE %s%s IDENTIFIED WITH sha256_password BY %s", user.Name, onCluster, quoteString(user.Password)),
+		fmt.Sprintf("GRANT%s %s TO %s", onCluster, roleName, user.Name),
+		fmt.Sprintf("ALTER USER %s%s DEFAULT ROLE %s", user.Name, onCluster, roleName),
+	}, nil
+}
+
+func onClusterClause(cluster string) string {
+	if cluster == "" {
+		return ""
+	}
+	return fmt.Sprintf(" ON CLUSTER '%s'", cluster)
+}
+
+// quoteString returns the ClickHouse string literal of s.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRolesDDL(t *testing.T) {
+	assert.Equal(t, []string{
+		"CREATE ROLE IF NOT EXISTS theia_default_writer",
+		"GRANT INSERT ON default.* TO theia_default_writer",
+		"CREATE ROLE IF NOT EXISTS theia_default_reader",
+		"GRANT SELECT, dictGet ON default.* TO theia_default_reader",
+		"CREATE ROLE IF NOT EXISTS theia_default_admin",
+		"GRANT ALL ON default.* TO theia_default_admin",
+		"GRANT SELECT ON system.* TO theia_default_admin",
+		"GRANT REMOTE ON *.* TO theia_default_admin",
+	}, RolesDDL("", ""))
+
+	statements := RolesDDL("theia", "clickhouse")
+	assert.Equal(t, "CREATE ROLE IF NOT EXISTS theia_theia_writer ON CLUSTER 'clickhouse'", statements[0])
+	assert.Equal(t, "GRANT ON CLUSTER 'clickhouse' INSERT ON theia.* TO theia_theia_writer", statements[1])
+}
+
+func TestUserDDL(t *testing.T) {
+	statements, err := UserDDL(User{Name: "grafana", Password: `it's\secret`, Role: RoleReader}, "default", "clickhouse")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`CREATE USER OR REPLACE grafana ON CLUSTER 'clickhouse' IDENTIFIED WITH sha256_password BY 'it\'s\\secret'`,
+		"GRANT ON CLUSTER 'clickhouse' theia_default_reader TO grafana",
+		"ALTER USER grafana ON CLUSTER 'clickhouse' DEFAULT ROLE theia_default_reader",
+	}, statements)
+
+	testCases := []struct {
+		name             string
+		user             User
+		expectedErrorMsg string
+	}{
+		{
+			name:             "Invalid name",
+			user:             User{Name: "grafana; DROP TABLE flows", Password: "password", Role: RoleReader},
+			expectedErrorMsg: "user name \"grafana; DROP TABLE flows\" is not valid",
+		},
+		{
+			name:             "Empty password",
+			user:             User{Name: "grafana", Role: RoleReader},
+			expectedErrorMsg: "password of user grafana should not be empty",
+		},
+		{
+			name:             "Invalid role",
+			user:             User{Name: "grafana", Password: "password", Role: "root"},
+			expectedErrorMsg: "role \"root\" is not valid",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UserDDL(tt.user, "default", "")
+			assert.ErrorContains(t, err, tt.expectedErrorMsg)
+		})
+	}
+}
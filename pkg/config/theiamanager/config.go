@@ -17,6 +17,27 @@ package config
 type TheiaManagerConfig struct {
 	// apiServer contains APIServer related configuration options.
 	APIServer APIServerConfig `yaml:"apiServer,omitempty"`
+	// flowEnrichment contains options for the enrichment of flow records with
+	// the names of their destination IPs and the labels of their Nodes.
+	FlowEnrichment FlowEnrichmentConfig `yaml:"flowEnrichment,omitempty"`
+	// reports contains options for the scheduled reports delivered to the
+	// notification integrations.
+	Reports ReportsConfig `yaml:"reports,omitempty"`
+	// recommendationResults contains options for the storage of the results
+	// of the policy recommendation jobs.
+	RecommendationResults RecommendationResultsConfig `yaml:"recommendationResults,omitempty"`
+	// recommendationJobs contains options for the scheduling of the policy
+	// recommendation jobs.
+	RecommendationJobs RecommendationJobsConfig `yaml:"recommendationJobs,omitempty"`
+	// openTelemetryLogs contains options for the export of the lifecycle
+	// events of the jobs and of the flow summaries as OpenTelemetry logs.
+	OpenTelemetryLogs OpenTelemetryLogsConfig `yaml:"openTelemetryLogs,omitempty"`
+	// sparkOperator contains options for the Spark Operator which runs the
+	// policy recommendation and throughput anomaly detection jobs.
+	SparkOperator SparkOperatorConfig `yaml:"sparkOperator,omitempty"`
+	// jobTemplates contains the templates of the custom analytics jobs,
+	// which are run as Spark jobs like the built-in ones.
+	JobTemplates []JobTemplateConfig `yaml:"jobTemplates,omitempty"`
 }
 
 type APIServerConfig struct {
@@ -34,4 +55,162 @@ type APIServerConfig struct {
 	TLSCipherSuites string `yaml:"tlsCipherSuites,omitempty"`
 	// TLS min version.
 	TLSMinVersion string `yaml:"tlsMinVersion,omitempty"`
+	// Indicates whether to serve the pprof endpoints under /debug/pprof, to
+	// capture CPU and memory profiles. Access to the endpoints is
+	// authenticated and authorized as for the other APIs.
+	// Defaults to false.
+	EnableProfiling bool `yaml:"enableProfiling,omitempty"`
+}
+
+type FlowEnrichmentConfig struct {
+	// Indicates whether to maintain the names of Service IPs and external IPs,
+	// and the labels of Nodes, used to enrich flow records in ClickHouse.
+	// Defaults to true.
+	Enable *bool `yaml:"enable,omitempty"`
+	// The interval at which the external destination IPs of recent flows are
+	// resolved to their reverse-DNS names, as a duration string. "0" disables
+	// the reverse-DNS resolution.
+	// Defaults to "1m".
+	ReverseDNSInterval string `yaml:"reverseDNSInterval,omitempty"`
+}
+
+type ReportsConfig struct {
+	// The notification integrations to which the reports are delivered.
+	Notifiers []ReportNotifierConfig `yaml:"notifiers,omitempty"`
+	// The reports to generate and deliver periodically.
+	Schedules []ReportScheduleConfig `yaml:"schedules,omitempty"`
+}
+
+type ReportNotifierConfig struct {
+	// The name of the notifier, by which the schedules refer to it.
+	Name string `yaml:"name"`
+	// The type of the notifier: "webhook" posts the rendered report as the
+	// body of the request, while "emailGateway" posts a JSON email message
+	// with the from, to, subject, contentType and body fields, to be sent by
+	// an email gateway.
+	Type string `yaml:"type"`
+	// The URL to which the reports are posted.
+	URL string `yaml:"url"`
+	// The sender and the recipients of the emails, for the "emailGateway"
+	// type.
+	From string   `yaml:"from,omitempty"`
+	To   []string `yaml:"to,omitempty"`
+}
+
+type ReportScheduleConfig struct {
+	// The name of the schedule, used in the subject of the reports.
+	Name string `yaml:"name"`
+	// The kind of report: "usage", "security-posture" or "policy-hits".
+	Report string `yaml:"report"`
+	// The cron expression of the times at which the report is generated, in
+	// UTC, e.g. "0 8 * * 1" for every Monday at 08:00.
+	Schedule string `yaml:"schedule"`
+	// The window before the generation of the report over which the flows
+	// are reported, as a duration string.
+	// Defaults to "24h".
+	Window string `yaml:"window,omitempty"`
+	// The format of the report: "html" or "csv".
+	// Defaults to "html".
+	Format string `yaml:"format,omitempty"`
+	// The names of the notifiers to which the report is delivered.
+	Notifiers []string `yaml:"notifiers"`
+}
+
+type RecommendationResultsConfig struct {
+	// The storage to which the results of the completed policy recommendation
+	// jobs are copied, so that they can still be retrieved after ClickHouse
+	// purged them: "clickhouse" only keeps them in ClickHouse, "configMap"
+	// copies them to a ConfigMap per job in the Theia Namespace, and "s3" to
+	// an object per job in an S3 bucket.
+	// Defaults to "clickhouse".
+	Storage string `yaml:"storage,omitempty"`
+	// The S3 bucket, for the "s3" storage.
+	S3 RecommendationResultsS3Config `yaml:"s3,omitempty"`
+}
+
+type RecommendationResultsS3Config struct {
+	// The URL of the S3 endpoint, e.g. "https://s3.us-west-2.amazonaws.com"
+	// or the URL of a MinIO server. The objects are addressed path-style.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// The region of the bucket.
+	// Defaults to "us-east-1".
+	Region string `yaml:"region,omitempty"`
+	// The name of the bucket.
+	Bucket string `yaml:"bucket,omitempty"`
+	// The prefix of the names of the objects, e.g. "theia/".
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+type RecommendationJobsConfig struct {
+	// The maximum number of policy recommendation jobs whose Spark
+	// Applications are scheduled or running at the same time, so that
+	// concurrent jobs do not starve small clusters of resources. The jobs
+	// created while the maximum is reached are queued, and started in order
+	// of creation as the running jobs end. 0 means no maximum.
+	// Defaults to 0.
+	MaxConcurrentJobs int `yaml:"maxConcurrentJobs,omitempty"`
+	// Indicates whether the jobs can roll out their recommended policies as a
+	// canary, which requires Theia Manager to create, update and delete
+	// Antrea-native policies and ClusterGroups.
+	// Defaults to false.
+	EnableCanaryRollouts bool `yaml:"enableCanaryRollouts,omitempty"`
+}
+
+type OpenTelemetryLogsConfig struct {
+	// The address of the OTLP gRPC collector to which the log records are
+	// exported, e.g. "otel-collector.monitoring.svc:4317". The connection is
+	// insecure unless the address starts with "https://". The logs are not
+	// exported if it is empty.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// The interval at which a summary of the flows of the last interval is
+	// exported, as a duration string. "0" disables the flow summaries, while
+	// the lifecycle events of the jobs are still exported.
+	// Defaults to "5m".
+	FlowSummaryInterval string `yaml:"flowSummaryInterval,omitempty"`
+}
+
+type SparkOperatorConfig struct {
+	// The Namespace of the Spark Operator, e.g. the Namespace of an existing
+	// cluster-wide installation. The Spark Operator must watch the Namespace
+	// of the jobs.
+	// Defaults to the Namespace of the jobs.
+	Namespace string `yaml:"namespace,omitempty"`
+	// The label selector of the Pods of the Spark Operator, e.g.
+	// "app.kubernetes.io/name=spark-operator,app.kubernetes.io/instance=spark".
+	// Defaults to "app.kubernetes.io/name=spark-operator".
+	PodLabelSelector string `yaml:"podLabelSelector,omitempty"`
+	// The API group and version of the SparkApplication CRD, which must have
+	// the same schema as sparkoperator.k8s.io/v1beta2.
+	// Defaults to "sparkoperator.k8s.io/v1beta2".
+	APIVersion string `yaml:"apiVersion,omitempty"`
+}
+
+type JobTemplateConfig struct {
+	// The name of the template, with which the jobs are started. It must be
+	// a valid DNS label.
+	Name string `yaml:"name"`
+	// The description of the analytics performed by the jobs.
+	Description string `yaml:"description,omitempty"`
+	// The image of the Python Spark jobs, e.g. an image built from the
+	// theia-spark-jobs image.
+	Image string `yaml:"image"`
+	// The main application file of the jobs, e.g.
+	// "local:///opt/spark/work-dir/my_analysis.py".
+	MainApplicationFile string `yaml:"mainApplicationFile"`
+	// The arguments accepted by the jobs, which are passed to the main
+	// application file as "--<name> <value>".
+	Args []JobTemplateArgConfig `yaml:"args,omitempty"`
+}
+
+type JobTemplateArgConfig struct {
+	// The name of the argument. It must be a lowercase identifier, e.g.
+	// "start_time".
+	Name string `yaml:"name"`
+	// The description of the argument.
+	Description string `yaml:"description,omitempty"`
+	// Indicates whether the argument must be set when a job is started.
+	Required bool `yaml:"required,omitempty"`
+	// The value of the argument when it is not set, if it is not required.
+	// The argument is not passed to the job if it has no default value.
+	Default string `yaml:"default,omitempty"`
 }
@@ -0,0 +1,394 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyticsjob
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	controllerutil "antrea.io/theia/pkg/controller"
+	"antrea.io/theia/pkg/util"
+	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/env"
+	sparkv1 "antrea.io/theia/third_party/sparkoperator/v1beta2"
+)
+
+const (
+	// argsAnnotation is the annotation holding the arguments of a job,
+	// encoded in JSON, on its SparkApplication.
+	argsAnnotation = "theia.antrea.io/job-args"
+	// Resources of the driver and the executors of a job when they are not
+	// set.
+	defaultCoreRequest = "200m"
+	defaultMemory      = "512M"
+)
+
+var (
+	// Spark Application CRUD functions, for unit tests
+	CreateSparkApplication = controllerutil.CreateSparkApplication
+	DeleteSparkApplication = controllerutil.DeleteSparkApplication
+	ListSparkApplication   = controllerutil.ListSparkApplicationWithLabel
+	GetSparkApplication    = controllerutil.GetSparkApplication
+	GetSparkAppProgress    = controllerutil.GetSparkAppProgress
+	ValidateCluster        = controllerutil.ValidateCluster
+
+	argNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	// reservedArgs are the arguments passed by Theia to every job, which the
+	// templates cannot declare.
+	reservedArgs = map[string]bool{"id": true, "correlation_id": true, "db_jdbc_url": true, "database": true}
+	// jobSelector selects the SparkApplications of the custom analytics jobs.
+	jobSelector = fmt.Sprintf("%s=%s", util.JobTypeLabel, util.JobTypeAnalytics)
+)
+
+// AnalyticsJobController runs the custom analytics jobs of the templates of
+// the Theia Manager configuration. A job has no CR: it is the SparkApplication
+// created from its template, from which its status and progress are read.
+type AnalyticsJobController struct {
+	kubeClient        kubernetes.Interface
+	templates         map[string]config.JobTemplateConfig
+	clickhouseConnect *sql.DB
+}
+
+func NewAnalyticsJobController(kubeClient kubernetes.Interface, templates []config.JobTemplateConfig) *AnalyticsJobController {
+	c := &AnalyticsJobController{
+		kubeClient: kubeClient,
+		templates:  make(map[string]config.JobTemplateConfig, len(templates)),
+	}
+	for _, template := range templates {
+		c.templates[template.Name] = template
+	}
+	return c
+}
+
+// ValidateJobTemplates checks the templates of the custom analytics jobs.
+func ValidateJobTemplates(templates []config.JobTemplateConfig) error {
+	names := make(map[string]bool, len(templates))
+	for _, template := range templates {
+		if errs := validation.IsDNS1123Label(template.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid job template name %q: %s", template.Name, strings.Join(errs, "; "))
+		}
+		if names[template.Name] {
+			return fmt.Errorf("duplicate job template %s", template.Name)
+		}
+		names[template.Name] = true
+		if template.Image == "" {
+			return fmt.Errorf("image of job template %s should not be empty", template.Name)
+		}
+		if template.MainApplicationFile == "" {
+			return fmt.Errorf("mainApplicationFile of job template %s should not be empty", template.Name)
+		}
+		argNames := make(map[string]bool, len(template.Args))
+		for _, arg := range template.Args {
+			if !argNameRegex.MatchString(arg.Name) {
+				return fmt.Errorf("invalid argument name %q of job template %s, it should match %s", arg.Name, template.Name, argNameRegex)
+			}
+			if reservedArgs[arg.Name] {
+				return fmt.Errorf("argument %s of job template %s is reserved", arg.Name, template.Name)
+			}
+			if argNames[arg.Name] {
+				return fmt.Errorf("duplicate argument %s of job template %s", arg.Name, template.Name)
+			}
+			argNames[arg.Name] = true
+		}
+	}
+	return nil
+}
+
+// ListJobTemplates returns the templates of the custom analytics jobs, sorted
+// by name.
+func (c *AnalyticsJobController) ListJobTemplates() []config.JobTemplateConfig {
+	templates := make([]config.JobTemplateConfig, 0, len(c.templates))
+	for _, template := range c.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+func (c *AnalyticsJobController) GetAnalyticsJob(namespace, name string) (*intelligence.AnalyticsJob, error) {
+	sparkApp, err := GetSparkApplication(c.kubeClient, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if sparkApp.Labels[util.JobTypeLabel] != util.JobTypeAnalytics {
+		return nil, apimachineryerrors.NewNotFound(intelligence.Resource("analyticsjobs"), name)
+	}
+	job := getAnalyticsJob(&sparkApp)
+	if job.Status.State == intelligence.AnalyticsJobStateRunning {
+		endpoint := fmt.Sprintf("http://%s-ui-svc.%s.svc:%d", name, namespace, controllerutil.SparkPort)
+		completedStages, totalStages, err := GetSparkAppProgress(endpoint)
+		if err != nil {
+			// The Spark Monitoring Service may not be started yet, or may be
+			// stopped already, the job is reported without its progress.
+			klog.V(4).ErrorS(err, "Failed to get the progress of the analytics job", "name", name)
+		} else {
+			job.Status.CompletedStages = completedStages
+			job.Status.TotalStages = totalStages
+		}
+	}
+	return job, nil
+}
+
+func (c *AnalyticsJobController) ListAnalyticsJob(namespace string) ([]*intelligence.AnalyticsJob, error) {
+	sparkAppList, err := ListSparkApplication(c.kubeClient, namespace, jobSelector)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*intelligence.AnalyticsJob, 0, len(sparkAppList.Items))
+	for i := range sparkAppList.Items {
+		jobs = append(jobs, getAnalyticsJob(&sparkAppList.Items[i]))
+	}
+	return jobs, nil
+}
+
+// CreateAnalyticsJob validates the arguments of a job against its template,
+// and submits the SparkApplication of the job. The job is passed its ID,
+// its correlation ID and the address of the ClickHouse database, as the
+// built-in jobs, followed by its arguments.
+func (c *AnalyticsJobController) CreateAnalyticsJob(namespace string, job *intelligence.AnalyticsJob) error {
+	if err := util.ParseAnalyticsJobName(job.Name); err != nil {
+		return fmt.Errorf("invalid request: %v", err)
+	}
+	template, ok := c.templates[job.Template]
+	if !ok {
+		return fmt.Errorf("invalid request: job template %s does not exist", job.Template)
+	}
+	args, err := getTemplateArgs(template, job.Args)
+	if err != nil {
+		return fmt.Errorf("invalid request: %v", err)
+	}
+	if job.ExecutorInstances < 0 {
+		return fmt.Errorf("invalid request: ExecutorInstances should be an integer >= 0")
+	}
+	for _, resource := range []struct {
+		name         string
+		value        *string
+		defaultValue string
+	}{
+		{"DriverCoreRequest", &job.DriverCoreRequest, defaultCoreRequest},
+		{"DriverMemory", &job.DriverMemory, defaultMemory},
+		{"ExecutorCoreRequest", &job.ExecutorCoreRequest, defaultCoreRequest},
+		{"ExecutorMemory", &job.ExecutorMemory, defaultMemory},
+	} {
+		if *resource.value == "" {
+			*resource.value = resource.defaultValue
+		}
+		if matchResult, err := regexp.MatchString(controllerutil.K8sQuantitiesReg, *resource.value); err != nil || !matchResult {
+			return fmt.Errorf("invalid request: %s should conform to the Kubernetes resource quantity convention", resource.name)
+		}
+	}
+	if err := ValidateCluster(c.kubeClient, namespace); err != nil {
+		return err
+	}
+
+	jobID := job.Name[4:]
+	correlationID := util.GetCorrelationID(job.Annotations, jobID)
+	jobArgs := []string{"--id", jobID, "--correlation_id", correlationID}
+	jobArgs = append(jobArgs, controllerutil.GetSparkJobDatabaseArgs(env.GetTheiaNamespace())...)
+	argNames := make([]string, 0, len(args))
+	for name := range args {
+		argNames = append(argNames, name)
+	}
+	sort.Strings(argNames)
+	for _, name := range argNames {
+		jobArgs = append(jobArgs, "--"+name, args[name])
+	}
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to encode the arguments of the job: %v", err)
+	}
+
+	labels := util.GetJobLabels(util.JobTypeAnalytics, nil)
+	labels[util.JobTemplateLabel] = template.Name
+	podLabels := controllerutil.GetSparkPodLabels(jobID, "", nil)
+	envSecretKeyRefs := map[string]sparkv1.NameKey{
+		"CH_USERNAME": {
+			Name: "clickhouse-secret",
+			Key:  "username",
+		},
+		"CH_PASSWORD": {
+			Name: "clickhouse-secret",
+			Key:  "password",
+		},
+	}
+	sparkApp := &sparkv1.SparkApplication{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: controllerutil.SparkApplicationAPIVersion(),
+			Kind:       "SparkApplication",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: namespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				util.CorrelationIDAnnotation: correlationID,
+				argsAnnotation:               string(encodedArgs),
+			},
+		},
+		Spec: sparkv1.SparkApplicationSpec{
+			Type:                sparkv1.PythonApplicationType,
+			SparkVersion:        controllerutil.SparkVersion,
+			Mode:                "cluster",
+			Image:               controllerutil.ConstStrToPointer(template.Image),
+			ImagePullPolicy:     controllerutil.ConstStrToPointer(controllerutil.SparkImagePullPolicy),
+			MainApplicationFile: controllerutil.ConstStrToPointer(template.MainApplicationFile),
+			Arguments:           jobArgs,
+			Driver: sparkv1.DriverSpec{
+				CoreRequest: &job.DriverCoreRequest,
+				SparkPodSpec: sparkv1.SparkPodSpec{
+					Memory:           &job.DriverMemory,
+					Labels:           podLabels,
+					EnvSecretKeyRefs: envSecretKeyRefs,
+					ServiceAccount:   controllerutil.ConstStrToPointer(controllerutil.SparkServiceAccount),
+				},
+			},
+			Executor: sparkv1.ExecutorSpec{
+				CoreRequest: &job.ExecutorCoreRequest,
+				SparkPodSpec: sparkv1.SparkPodSpec{
+					Memory:           &job.ExecutorMemory,
+					Labels:           podLabels,
+					EnvSecretKeyRefs: envSecretKeyRefs,
+				},
+			},
+		},
+	}
+	if job.ExecutorInstances > 0 {
+		executorInstances := int32(job.ExecutorInstances)
+		sparkApp.Spec.Executor.Instances = &executorInstances
+	}
+	controllerutil.SetSparkJobClickHouseTLS(sparkApp)
+	if err := CreateSparkApplication(c.kubeClient, namespace, sparkApp); err != nil {
+		if apimachineryerrors.IsAlreadyExists(err) {
+			return fmt.Errorf("invalid request: analytics job %s already exists", job.Name)
+		}
+		return fmt.Errorf("failed to create Spark Application: %v", err)
+	}
+	klog.InfoS("Start SparkApplication", "id", jobID, "AnalyticsJob", job.Name, "template", template.Name, "correlationID", correlationID)
+	return nil
+}
+
+// DeleteAnalyticsJob deletes the SparkApplication of a job, which stops it if
+// it is running, and the results written by the job.
+func (c *AnalyticsJobController) DeleteAnalyticsJob(namespace, name string) error {
+	DeleteSparkApplication(c.kubeClient, name, namespace)
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return err
+		}
+	}
+	id := name[4:]
+	query := "ALTER TABLE analytics_job_results_local ON CLUSTER '{cluster}' DELETE WHERE id = ('" + id + "');"
+	return controllerutil.RunClickHouseQuery(c.clickhouseConnect, query, id)
+}
+
+// getTemplateArgs returns the arguments of a job, with the default values of
+// the arguments of its template which are not set. Unknown arguments and
+// missing required arguments are rejected.
+func getTemplateArgs(template config.JobTemplateConfig, args map[string]string) (map[string]string, error) {
+	templateArgs := make(map[string]config.JobTemplateArgConfig, len(template.Args))
+	for _, arg := range template.Args {
+		templateArgs[arg.Name] = arg
+	}
+	for name := range args {
+		if _, ok := templateArgs[name]; !ok {
+			return nil, fmt.Errorf("argument %s is not an argument of job template %s", name, template.Name)
+		}
+	}
+	result := make(map[string]string, len(template.Args))
+	for _, arg := range template.Args {
+		value, ok := args[arg.Name]
+		if !ok {
+			if arg.Required {
+				return nil, fmt.Errorf("argument %s of job template %s is required", arg.Name, template.Name)
+			}
+			if arg.Default == "" {
+				continue
+			}
+			value = arg.Default
+		}
+		result[arg.Name] = value
+	}
+	return result, nil
+}
+
+// getAnalyticsJob returns the job of a SparkApplication, whose state is
+// derived from the state of the SparkApplication.
+func getAnalyticsJob(sparkApp *sparkv1.SparkApplication) *intelligence.AnalyticsJob {
+	job := &intelligence.AnalyticsJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              sparkApp.Name,
+			CreationTimestamp: sparkApp.CreationTimestamp,
+		},
+		Template: sparkApp.Labels[util.JobTemplateLabel],
+		Status: intelligence.AnalyticsJobStatus{
+			SparkApplication: strings.TrimPrefix(sparkApp.Name, "job-"),
+			StartTime:        sparkApp.CreationTimestamp,
+		},
+	}
+	if correlationID, ok := sparkApp.Annotations[util.CorrelationIDAnnotation]; ok {
+		job.Annotations = map[string]string{util.CorrelationIDAnnotation: correlationID}
+	}
+	if encodedArgs, ok := sparkApp.Annotations[argsAnnotation]; ok {
+		if err := json.Unmarshal([]byte(encodedArgs), &job.Args); err != nil {
+			klog.ErrorS(err, "Failed to decode the arguments of the analytics job", "name", sparkApp.Name)
+		}
+	}
+	if sparkApp.Spec.Executor.Instances != nil {
+		job.ExecutorInstances = int(*sparkApp.Spec.Executor.Instances)
+	}
+	if sparkApp.Spec.Driver.CoreRequest != nil {
+		job.DriverCoreRequest = *sparkApp.Spec.Driver.CoreRequest
+	}
+	if sparkApp.Spec.Driver.Memory != nil {
+		job.DriverMemory = *sparkApp.Spec.Driver.Memory
+	}
+	if sparkApp.Spec.Executor.CoreRequest != nil {
+		job.ExecutorCoreRequest = *sparkApp.Spec.Executor.CoreRequest
+	}
+	if sparkApp.Spec.Executor.Memory != nil {
+		job.ExecutorMemory = *sparkApp.Spec.Executor.Memory
+	}
+	state := sparkApp.Status.AppState.State
+	switch state {
+	case sparkv1.RunningState, sparkv1.SucceedingState:
+		job.Status.State = intelligence.AnalyticsJobStateRunning
+	case sparkv1.CompletedState:
+		job.Status.State = intelligence.AnalyticsJobStateCompleted
+		job.Status.EndTime = sparkApp.Status.TerminationTime
+	case sparkv1.FailedState, sparkv1.FailedSubmissionState, sparkv1.FailingState, sparkv1.InvalidatingState:
+		job.Status.State = intelligence.AnalyticsJobStateFailed
+		job.Status.EndTime = sparkApp.Status.TerminationTime
+		job.Status.ErrorMsg = fmt.Sprintf("Analytics job failed, state: %s, error message: %v", state, strings.TrimSpace(sparkApp.Status.AppState.ErrorMessage))
+	default:
+		job.Status.State = intelligence.AnalyticsJobStateScheduled
+	}
+	return job
+}
@@ -0,0 +1,375 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyticsjob
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	"antrea.io/theia/pkg/util"
+	sparkv1 "antrea.io/theia/third_party/sparkoperator/v1beta2"
+)
+
+const testJobName = "job-1234abcd-1234-abcd-12ab-12345678abcd"
+
+var testTemplates = []config.JobTemplateConfig{
+	{
+		Name:                "top-talkers",
+		Image:               "my-registry/theia-custom-jobs:latest",
+		MainApplicationFile: "local:///opt/spark/work-dir/top_talkers.py",
+		Args: []config.JobTemplateArgConfig{
+			{Name: "start_time", Required: true},
+			{Name: "limit", Default: "10"},
+			{Name: "namespace"},
+		},
+	},
+}
+
+// fakeSparkApplications replaces the Spark Application CRUD functions with
+// functions backed by a map, and returns the map.
+func fakeSparkApplications(t *testing.T) map[string]*sparkv1.SparkApplication {
+	sparkApps := map[string]*sparkv1.SparkApplication{}
+	oldCreate, oldGet, oldList, oldDelete, oldValidate := CreateSparkApplication, GetSparkApplication, ListSparkApplication, DeleteSparkApplication, ValidateCluster
+	t.Cleanup(func() {
+		CreateSparkApplication, GetSparkApplication, ListSparkApplication, DeleteSparkApplication, ValidateCluster = oldCreate, oldGet, oldList, oldDelete, oldValidate
+	})
+	CreateSparkApplication = func(client kubernetes.Interface, namespace string, sparkApp *sparkv1.SparkApplication) error {
+		if _, ok := sparkApps[sparkApp.Name]; ok {
+			return apimachineryerrors.NewAlreadyExists(schema.GroupResource{Resource: "sparkapplications"}, sparkApp.Name)
+		}
+		sparkApps[sparkApp.Name] = sparkApp
+		return nil
+	}
+	GetSparkApplication = func(client kubernetes.Interface, name, namespace string) (sparkv1.SparkApplication, error) {
+		sparkApp, ok := sparkApps[name]
+		if !ok {
+			return sparkv1.SparkApplication{}, apimachineryerrors.NewNotFound(schema.GroupResource{Resource: "sparkapplications"}, name)
+		}
+		return *sparkApp, nil
+	}
+	ListSparkApplication = func(client kubernetes.Interface, namespace, label string) (*sparkv1.SparkApplicationList, error) {
+		list := &sparkv1.SparkApplicationList{}
+		for _, sparkApp := range sparkApps {
+			if sparkApp.Labels[util.JobTypeLabel] == util.JobTypeAnalytics {
+				list.Items = append(list.Items, *sparkApp)
+			}
+		}
+		return list, nil
+	}
+	DeleteSparkApplication = func(client kubernetes.Interface, name, namespace string) {
+		delete(sparkApps, name)
+	}
+	ValidateCluster = func(client kubernetes.Interface, namespace string) error {
+		return nil
+	}
+	return sparkApps
+}
+
+func TestValidateJobTemplates(t *testing.T) {
+	validTemplate := func(mutate func(template *config.JobTemplateConfig)) []config.JobTemplateConfig {
+		template := config.JobTemplateConfig{
+			Name:                "my-analysis",
+			Image:               "my-image",
+			MainApplicationFile: "local:///my_analysis.py",
+			Args:                []config.JobTemplateArgConfig{{Name: "window"}},
+		}
+		if mutate != nil {
+			mutate(&template)
+		}
+		return []config.JobTemplateConfig{template}
+	}
+	testCases := []struct {
+		name             string
+		templates        []config.JobTemplateConfig
+		expectedErrorMsg string
+	}{
+		{
+			name:      "Valid templates",
+			templates: append(validTemplate(nil), testTemplates...),
+		},
+		{
+			name:             "Invalid name",
+			templates:        validTemplate(func(template *config.JobTemplateConfig) { template.Name = "My_Analysis" }),
+			expectedErrorMsg: "invalid job template name",
+		},
+		{
+			name:             "Duplicate template",
+			templates:        append(validTemplate(nil), validTemplate(nil)...),
+			expectedErrorMsg: "duplicate job template my-analysis",
+		},
+		{
+			name:             "Missing image",
+			templates:        validTemplate(func(template *config.JobTemplateConfig) { template.Image = "" }),
+			expectedErrorMsg: "image of job template my-analysis should not be empty",
+		},
+		{
+			name:             "Missing main application file",
+			templates:        validTemplate(func(template *config.JobTemplateConfig) { template.MainApplicationFile = "" }),
+			expectedErrorMsg: "mainApplicationFile of job template my-analysis should not be empty",
+		},
+		{
+			name: "Invalid argument name",
+			templates: validTemplate(func(template *config.JobTemplateConfig) {
+				template.Args = []config.JobTemplateArgConfig{{Name: "start-time"}}
+			}),
+			expectedErrorMsg: "invalid argument name \"start-time\"",
+		},
+		{
+			name: "Reserved argument",
+			templates: validTemplate(func(template *config.JobTemplateConfig) {
+				template.Args = []config.JobTemplateArgConfig{{Name: "db_jdbc_url"}}
+			}),
+			expectedErrorMsg: "argument db_jdbc_url of job template my-analysis is reserved",
+		},
+		{
+			name: "Duplicate argument",
+			templates: validTemplate(func(template *config.JobTemplateConfig) {
+				template.Args = []config.JobTemplateArgConfig{{Name: "window"}, {Name: "window"}}
+			}),
+			expectedErrorMsg: "duplicate argument window",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateJobTemplates(tc.templates)
+			if tc.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestCreateAnalyticsJob(t *testing.T) {
+	testCases := []struct {
+		name             string
+		job              *intelligence.AnalyticsJob
+		expectedArgs     []string
+		expectedErrorMsg string
+	}{
+		{
+			name: "Valid job with default arguments",
+			job: &intelligence.AnalyticsJob{
+				ObjectMeta: metav1.ObjectMeta{Name: testJobName},
+				Template:   "top-talkers",
+				Args:       map[string]string{"start_time": "2023-09-01 00:00:00"},
+			},
+			expectedArgs: []string{"--limit", "10", "--start_time", "2023-09-01 00:00:00"},
+		},
+		{
+			name: "Valid job with all arguments",
+			job: &intelligence.AnalyticsJob{
+				ObjectMeta: metav1.ObjectMeta{Name: testJobName},
+				Template:   "top-talkers",
+				Args:       map[string]string{"start_time": "2023-09-01 00:00:00", "limit": "5", "namespace": "shop"},
+			},
+			expectedArgs: []string{"--limit", "5", "--namespace", "shop", "--start_time", "2023-09-01 00:00:00"},
+		},
+		{
+			name: "Invalid name",
+			job: &intelligence.AnalyticsJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-job"},
+				Template:   "top-talkers",
+			},
+			expectedErrorMsg: "not a valid analytics job name",
+		},
+		{
+			name: "Unknown template",
+			job: &intelligence.AnalyticsJob{
+				ObjectMeta: metav1.ObjectMeta{Name: testJobName},
+				Template:   "unknown",
+			},
+			expectedErrorMsg: "job template unknown does not exist",
+		},
+		{
+			name: "Missing required argument",
+			job: &intelligence.AnalyticsJob{
+				ObjectMeta: metav1.ObjectMeta{Name: testJobName},
+				Template:   "top-talkers",
+				Args:       map[string]string{"limit": "5"},
+			},
+			expectedErrorMsg: "argument start_time of job template top-talkers is required",
+		},
+		{
+			name: "Unknown argument",
+			job: &intelligence.AnalyticsJob{
+				ObjectMeta: metav1.ObjectMeta{Name: testJobName},
+				Template:   "top-talkers",
+				Args:       map[string]string{"start_time": "2023-09-01 00:00:00", "end_time": "2023-09-02 00:00:00"},
+			},
+			expectedErrorMsg: "argument end_time is not an argument of job template top-talkers",
+		},
+		{
+			name: "Invalid resources",
+			job: &intelligence.AnalyticsJob{
+				ObjectMeta:   metav1.ObjectMeta{Name: testJobName},
+				Template:     "top-talkers",
+				Args:         map[string]string{"start_time": "2023-09-01 00:00:00"},
+				DriverMemory: "lots",
+			},
+			expectedErrorMsg: "DriverMemory should conform to the Kubernetes resource quantity convention",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sparkApps := fakeSparkApplications(t)
+			c := NewAnalyticsJobController(fake.NewSimpleClientset(), testTemplates)
+			err := c.CreateAnalyticsJob("flow-visibility", tc.job)
+			if tc.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+				assert.Empty(t, sparkApps)
+				return
+			}
+			require.NoError(t, err)
+			sparkApp := sparkApps[testJobName]
+			require.NotNil(t, sparkApp)
+			assert.Equal(t, util.JobTypeAnalytics, sparkApp.Labels[util.JobTypeLabel])
+			assert.Equal(t, "top-talkers", sparkApp.Labels[util.JobTemplateLabel])
+			assert.Equal(t, testTemplates[0].Image, *sparkApp.Spec.Image)
+			assert.Equal(t, testTemplates[0].MainApplicationFile, *sparkApp.Spec.MainApplicationFile)
+			assert.Equal(t, []string{"--id", "1234abcd-1234-abcd-12ab-12345678abcd"}, sparkApp.Spec.Arguments[:2])
+			assert.Equal(t, tc.expectedArgs, sparkApp.Spec.Arguments[len(sparkApp.Spec.Arguments)-len(tc.expectedArgs):])
+			assert.Equal(t, defaultMemory, *sparkApp.Spec.Driver.Memory)
+
+			job, err := c.GetAnalyticsJob("flow-visibility", testJobName)
+			require.NoError(t, err)
+			assert.Equal(t, "top-talkers", job.Template)
+			assert.Equal(t, intelligence.AnalyticsJobStateScheduled, job.Status.State)
+			for i := 0; i < len(tc.expectedArgs); i += 2 {
+				assert.Equal(t, tc.expectedArgs[i+1], job.Args[tc.expectedArgs[i][2:]])
+			}
+
+			err = c.CreateAnalyticsJob("flow-visibility", tc.job)
+			assert.ErrorContains(t, err, "already exists")
+		})
+	}
+}
+
+func TestGetAnalyticsJob(t *testing.T) {
+	terminationTime := metav1.Now()
+	testCases := []struct {
+		name           string
+		appState       sparkv1.ApplicationState
+		progressErr    error
+		expectedStatus intelligence.AnalyticsJobStatus
+	}{
+		{
+			name:     "Submitted job",
+			appState: sparkv1.ApplicationState{State: sparkv1.SubmittedState},
+			expectedStatus: intelligence.AnalyticsJobStatus{
+				State: intelligence.AnalyticsJobStateScheduled,
+			},
+		},
+		{
+			name:     "Running job",
+			appState: sparkv1.ApplicationState{State: sparkv1.RunningState},
+			expectedStatus: intelligence.AnalyticsJobStatus{
+				State:           intelligence.AnalyticsJobStateRunning,
+				CompletedStages: 2,
+				TotalStages:     5,
+			},
+		},
+		{
+			name:        "Running job without progress",
+			appState:    sparkv1.ApplicationState{State: sparkv1.RunningState},
+			progressErr: fmt.Errorf("connection refused"),
+			expectedStatus: intelligence.AnalyticsJobStatus{
+				State: intelligence.AnalyticsJobStateRunning,
+			},
+		},
+		{
+			name:     "Completed job",
+			appState: sparkv1.ApplicationState{State: sparkv1.CompletedState},
+			expectedStatus: intelligence.AnalyticsJobStatus{
+				State:   intelligence.AnalyticsJobStateCompleted,
+				EndTime: terminationTime,
+			},
+		},
+		{
+			name:     "Failed job",
+			appState: sparkv1.ApplicationState{State: sparkv1.FailedState, ErrorMessage: "driver OOMKilled"},
+			expectedStatus: intelligence.AnalyticsJobStatus{
+				State:    intelligence.AnalyticsJobStateFailed,
+				EndTime:  terminationTime,
+				ErrorMsg: "Analytics job failed, state: FAILED, error message: driver OOMKilled",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sparkApps := fakeSparkApplications(t)
+			sparkApps[testJobName] = &sparkv1.SparkApplication{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   testJobName,
+					Labels: map[string]string{util.JobTypeLabel: util.JobTypeAnalytics, util.JobTemplateLabel: "top-talkers"},
+				},
+				Status: sparkv1.SparkApplicationStatus{AppState: tc.appState, TerminationTime: terminationTime},
+			}
+			sparkApps["pr-1234abcd-1234-abcd-12ab-12345678abcd"] = &sparkv1.SparkApplication{
+				ObjectMeta: metav1.ObjectMeta{Name: "pr-1234abcd-1234-abcd-12ab-12345678abcd"},
+			}
+			oldProgress := GetSparkAppProgress
+			defer func() { GetSparkAppProgress = oldProgress }()
+			GetSparkAppProgress = func(baseUrl string) (int, int, error) {
+				assert.Equal(t, "http://"+testJobName+"-ui-svc.flow-visibility.svc:4040", baseUrl)
+				if tc.progressErr != nil {
+					return 0, 0, tc.progressErr
+				}
+				return 2, 5, nil
+			}
+			c := NewAnalyticsJobController(fake.NewSimpleClientset(), testTemplates)
+			job, err := c.GetAnalyticsJob("flow-visibility", testJobName)
+			require.NoError(t, err)
+			tc.expectedStatus.SparkApplication = "1234abcd-1234-abcd-12ab-12345678abcd"
+			assert.Equal(t, tc.expectedStatus, job.Status)
+
+			jobs, err := c.ListAnalyticsJob("flow-visibility")
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.Equal(t, testJobName, jobs[0].Name)
+
+			// The SparkApplications of other jobs are not analytics jobs.
+			_, err = c.GetAnalyticsJob("flow-visibility", "pr-1234abcd-1234-abcd-12ab-12345678abcd")
+			assert.True(t, apimachineryerrors.IsNotFound(err))
+		})
+	}
+}
+
+func TestDeleteAnalyticsJob(t *testing.T) {
+	sparkApps := fakeSparkApplications(t)
+	sparkApps[testJobName] = &sparkv1.SparkApplication{ObjectMeta: metav1.ObjectMeta{Name: testJobName}}
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE analytics_job_results_local ON CLUSTER '{cluster}' DELETE WHERE id = ('1234abcd-1234-abcd-12ab-12345678abcd');")).WillReturnResult(sqlmock.NewResult(0, 1))
+	c := NewAnalyticsJobController(fake.NewSimpleClientset(), testTemplates)
+	c.clickhouseConnect = db
+	require.NoError(t, c.DeleteAnalyticsJob("flow-visibility", testJobName))
+	assert.Empty(t, sparkApps)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
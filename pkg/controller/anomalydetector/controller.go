@@ -30,7 +30,9 @@ import (
 	apimachinerytypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
@@ -77,6 +79,8 @@ type AnomalyDetectorController struct {
 	periodicResyncSetMutex sync.Mutex
 	periodicResyncSet      map[apimachinerytypes.NamespacedName]struct{}
 	clickhouseConnect      *sql.DB
+	eventBroadcaster       record.EventBroadcaster
+	eventRecorder          record.EventRecorder
 }
 
 type NamespacedId struct {
@@ -89,6 +93,7 @@ func NewAnomalyDetectorController(
 	kubeClient kubernetes.Interface,
 	taDetectorInformer crdv1a1informers.ThroughputAnomalyDetectorInformer,
 ) *AnomalyDetectorController {
+	eventBroadcaster, eventRecorder := controllerutil.NewEventBroadcaster()
 	c := &AnomalyDetectorController{
 		crdClient:               crdClient,
 		kubeClient:              kubeClient,
@@ -99,6 +104,8 @@ func NewAnomalyDetectorController(
 		anomalyDetectorLister:   taDetectorInformer.Lister(),
 		anomalyDetectorSynced:   taDetectorInformer.Informer().HasSynced,
 		periodicResyncSet:       make(map[apimachinerytypes.NamespacedName]struct{}),
+		eventBroadcaster:        eventBroadcaster,
+		eventRecorder:           eventRecorder,
 	}
 
 	c.anomalyDetectorInformer.AddEventHandlerWithResyncPeriod(
@@ -185,6 +192,9 @@ func (c *AnomalyDetectorController) Run(stopCh <-chan struct{}) {
 		return
 	}
 
+	c.eventBroadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: c.kubeClient.CoreV1().Events("")})
+	defer c.eventBroadcaster.Shutdown()
+
 	c.gcQueue.Add(controllerutil.GcKey{
 		RemoveStaleDbEntries: true,
 		RemoveStaleSparkApp:  true,
@@ -464,7 +474,17 @@ func (c *AnomalyDetectorController) checkSparkApplicationStatus(newTAD *crdv1alp
 	}
 
 	state, errorMessage, err := getTADetectorStatus(c.kubeClient, newTAD.Status.SparkApplication, newTAD.Namespace)
-	if err != nil {
+	if apimachineryerrors.IsNotFound(err) {
+		// The Spark Application was deleted while the Theia Manager was not
+		// tracking it, e.g. during a restart, so the job cannot complete.
+		return state, c.updateTADetectorStatus(
+			newTAD,
+			crdv1alpha1.ThroughputAnomalyDetectorStatus{
+				State:    crdv1alpha1.ThroughputAnomalyDetectorStateFailed,
+				ErrorMsg: fmt.Sprintf("Spark Application tad-%s of the anomaly detection job is not found", newTAD.Status.SparkApplication),
+			},
+		)
+	} else if err != nil {
 		return state, err
 	}
 	klog.V(4).InfoS("Got Spark Application state", "state", state, "ThroughputAnomalyDetector", newTAD.Name)
@@ -566,7 +586,11 @@ func (c *AnomalyDetectorController) startSparkApplication(newTAD *crdv1alpha1.Th
 		case "external":
 			newTADJobArgs = append(newTADJobArgs, "--agg-flow", newTAD.Spec.AggregatedFlow)
 			if newTAD.Spec.ExternalIP != "" {
-				newTADJobArgs = append(newTADJobArgs, "--external-ip", newTAD.Spec.ExternalIP)
+				externalIP, err := util.NormalizeIPOrCIDR(newTAD.Spec.ExternalIP)
+				if err != nil {
+					return illeagelArguementError{fmt.Errorf("invalid request: 'external-ip' argument should be an IPv4 or IPv6 address or CIDR: %v", err)}
+				}
+				newTADJobArgs = append(newTADJobArgs, "--external-ip", externalIP)
 			}
 		case "svc":
 			newTADJobArgs = append(newTADJobArgs, "--agg-flow", newTAD.Spec.AggregatedFlow)
@@ -577,6 +601,7 @@ func (c *AnomalyDetectorController) startSparkApplication(newTAD *crdv1alpha1.Th
 			return illeagelArguementError{fmt.Errorf("invalid request: Throughput Anomaly Detector aggregated flow type should be 'pod' or 'external' or 'svc'")}
 		}
 	}
+	newTADJobArgs = append(newTADJobArgs, controllerutil.GetSparkJobDatabaseArgs(env.GetTheiaNamespace())...)
 
 	sparkResourceArgs := struct {
 		executorInstances   int32
@@ -615,21 +640,36 @@ func (c *AnomalyDetectorController) startSparkApplication(newTAD *crdv1alpha1.Th
 	}
 	sparkResourceArgs.executorMemory = newTAD.Spec.ExecutorMemory
 
+	if newTAD.Spec.AutoSizeExecutors {
+		instances, memory, err := c.sizeExecutors(newTAD.Spec.StartInterval.Time, newTAD.Spec.EndInterval.Time)
+		if err != nil {
+			// The requested resources are kept when the flow records cannot
+			// be counted, rather than failing the job.
+			klog.ErrorS(err, "Failed to size Spark executors, using the requested resources", "ThroughputAnomalyDetector", newTAD.Name)
+		} else {
+			sparkResourceArgs.executorInstances = instances
+			sparkResourceArgs.executorMemory = memory
+		}
+	}
+
 	err = util.ParseADAlgorithmID(newTAD.Name)
 	if err != nil {
 		return illeagelArguementError{fmt.Errorf("invalid request: Throughput Anomaly Detector Querier job name is invalid: %s", err)}
 	}
 	taDetectorID := newTAD.Name[4:]
 	newTADJobArgs = append(newTADJobArgs, "--id", taDetectorID)
+	correlationID := util.GetCorrelationID(newTAD.Annotations, taDetectorID)
+	newTADJobArgs = append(newTADJobArgs, "--correlation_id", correlationID)
 	taDetectorApplication := &sparkv1.SparkApplication{
 		TypeMeta: metav1.TypeMeta{
-			APIVersion: "sparkoperator.k8s.io/v1beta2",
+			APIVersion: controllerutil.SparkApplicationAPIVersion(),
 			Kind:       "SparkApplication",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      newTAD.Name,
-			Namespace: newTAD.Namespace,
-			Labels:    sparkAppLabelMap,
+			Name:        newTAD.Name,
+			Namespace:   newTAD.Namespace,
+			Labels:      sparkAppLabelMap,
+			Annotations: map[string]string{util.CorrelationIDAnnotation: correlationID},
 		},
 		Spec: sparkv1.SparkApplicationSpec{
 			Type:                "Python",
@@ -662,7 +702,7 @@ func (c *AnomalyDetectorController) startSparkApplication(newTAD *crdv1alpha1.Th
 			Executor: sparkv1.ExecutorSpec{
 				CoreRequest: &newTAD.Spec.ExecutorCoreRequest,
 				SparkPodSpec: sparkv1.SparkPodSpec{
-					Memory: &newTAD.Spec.ExecutorMemory,
+					Memory: &sparkResourceArgs.executorMemory,
 					Labels: map[string]string{
 						"version": controllerutil.SparkVersion,
 					},
@@ -681,22 +721,46 @@ func (c *AnomalyDetectorController) startSparkApplication(newTAD *crdv1alpha1.Th
 			},
 		},
 	}
+	controllerutil.SetSparkJobClickHouseTLS(taDetectorApplication)
+	startTime := metav1.NewTime(time.Now())
 	err = CreateSparkApplication(c.kubeClient, newTAD.Namespace, taDetectorApplication)
-	if err != nil {
+	if apimachineryerrors.IsAlreadyExists(err) {
+		// The Theia Manager restarted after creating the Spark Application and
+		// before recording it in the status of the job. The existing Spark
+		// Application is tracked rather than submitted again.
+		klog.InfoS("Resume tracking existing SparkApplication", "id", taDetectorID, "ThroughputAnomalyDetector", newTAD.Name, "correlationID", correlationID)
+		if sparkApp, err := GetSparkApplication(c.kubeClient, newTAD.Name, newTAD.Namespace); err == nil && !sparkApp.CreationTimestamp.IsZero() {
+			startTime = sparkApp.CreationTimestamp
+		}
+	} else if err != nil {
 		return fmt.Errorf("failed to create Spark Application: %v", err)
+	} else {
+		klog.InfoS("Start SparkApplication", "id", taDetectorID, "ThroughputAnomalyDetector", newTAD.Name, "correlationID", correlationID)
 	}
-	klog.V(2).InfoS("Start SparkApplication", "id", taDetectorID, "ThroughputAnomalyDetector", newTAD.Name)
 
 	return c.updateTADetectorStatus(
 		newTAD,
 		crdv1alpha1.ThroughputAnomalyDetectorStatus{
 			State:            crdv1alpha1.ThroughputAnomalyDetectorStateScheduled,
 			SparkApplication: taDetectorID,
-			StartTime:        metav1.NewTime(time.Now()),
+			StartTime:        startTime,
 		},
 	)
 }
 
+// sizeExecutors sizes the executors of a Spark job according to the number of
+// flow records between startTime and endTime.
+func (c *AnomalyDetectorController) sizeExecutors(startTime, endTime time.Time) (int32, string, error) {
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	return controllerutil.SizeExecutors(c.clickhouseConnect, startTime, endTime)
+}
+
 func (c *AnomalyDetectorController) updateTADetectorStatus(newTAD *crdv1alpha1.ThroughputAnomalyDetector, status crdv1alpha1.ThroughputAnomalyDetectorStatus) error {
 	update := newTAD.DeepCopy()
 	update.Status.State = status.State
@@ -718,8 +782,15 @@ func (c *AnomalyDetectorController) updateTADetectorStatus(newTAD *crdv1alpha1.T
 	if !status.EndTime.IsZero() {
 		update.Status.EndTime = status.EndTime
 	}
-	_, err := c.crdClient.CrdV1alpha1().ThroughputAnomalyDetectors(newTAD.Namespace).UpdateStatus(context.TODO(), update, metav1.UpdateOptions{})
-	return err
+	updated, err := c.crdClient.CrdV1alpha1().ThroughputAnomalyDetectors(newTAD.Namespace).UpdateStatus(context.TODO(), update, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	if newTAD.Status.State != update.Status.State {
+		klog.InfoS("Updated state of ThroughputAnomalyDetector", "name", newTAD.Name, "state", update.Status.State, "correlationID", util.GetCorrelationID(newTAD.Annotations, update.Status.SparkApplication))
+	}
+	controllerutil.RecordJobStateEvent(c.eventRecorder, updated, "throughput anomaly detection", update.Status.SparkApplication, newTAD.Status.State, update.Status.State, update.Status.ErrorMsg)
+	return nil
 }
 
 func (c *AnomalyDetectorController) addPeriodicSync(key apimachinerytypes.NamespacedName) {
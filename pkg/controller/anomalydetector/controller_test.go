@@ -35,6 +35,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
 	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
@@ -155,7 +156,7 @@ func (f *fakeSparkApplicationClient) delete(client kubernetes.Interface, name, n
 	delete(f.sparkApplications, namespacedName)
 }
 
-func (f *fakeSparkApplicationClient) list(client kubernetes.Interface, namespace string) (*v1beta2.SparkApplicationList, error) {
+func (f *fakeSparkApplicationClient) list(client kubernetes.Interface, namespace, label string) (*v1beta2.SparkApplicationList, error) {
 	f.mapMutex.Lock()
 	defer f.mapMutex.Unlock()
 	list := make([]v1beta2.SparkApplication, len(f.sparkApplications))
@@ -431,6 +432,19 @@ func TestTADetection(t *testing.T) {
 			},
 			expectedErrorMsg: "invalid request: 'pod-namespace' argument can not be used alone",
 		},
+		{
+			name:    "invalid Aggregatedflow external-ip",
+			tadName: "tad-invalid-agg-flow-external-ip",
+			tad: &crdv1alpha1.ThroughputAnomalyDetector{
+				ObjectMeta: metav1.ObjectMeta{Name: "tad-invalid-agg-flow-external-ip", Namespace: testNamespace},
+				Spec: crdv1alpha1.ThroughputAnomalyDetectorSpec{
+					JobType:        "ARIMA",
+					AggregatedFlow: "external",
+					ExternalIP:     "fd00::1/129",
+				},
+			},
+			expectedErrorMsg: "invalid request: 'external-ip' argument should be an IPv4 or IPv6 address or CIDR",
+		},
 		{
 			name:    "invalid Aggregatedflow",
 			tadName: "tad-invalid-agg-flow",
@@ -464,3 +478,33 @@ func TestTADetection(t *testing.T) {
 		})
 	}
 }
+
+func TestTADetectorEvents(t *testing.T) {
+	obj := &crdv1alpha1.ThroughputAnomalyDetector{
+		ObjectMeta: metav1.ObjectMeta{Name: tadName, Namespace: testNamespace},
+	}
+	crdClient := fakecrd.NewSimpleClientset(obj)
+	recorder := record.NewFakeRecorder(10)
+	c := &AnomalyDetectorController{crdClient: crdClient, eventRecorder: recorder}
+	id := tadName[4:]
+
+	for _, status := range []crdv1alpha1.ThroughputAnomalyDetectorStatus{
+		{State: crdv1alpha1.ThroughputAnomalyDetectorStateScheduled, SparkApplication: id},
+		{State: crdv1alpha1.ThroughputAnomalyDetectorStateRunning},
+		{State: crdv1alpha1.ThroughputAnomalyDetectorStateFailed, ErrorMsg: "throughput anomaly detection job failed"},
+	} {
+		assert.NoError(t, c.updateTADetectorStatus(obj, status))
+		var err error
+		obj, err = crdClient.CrdV1alpha1().ThroughputAnomalyDetectors(testNamespace).Get(context.TODO(), tadName, metav1.GetOptions{})
+		assert.NoError(t, err)
+	}
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	assert.Equal(t, []string{
+		"Normal JobSubmitted Submitted throughput anomaly detection job " + id,
+		"Warning JobFailed Failed throughput anomaly detection job " + id + ": throughput anomaly detection job failed",
+	}, events)
+}
@@ -0,0 +1,490 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowenrichment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	controllerutil "antrea.io/theia/pkg/controller"
+	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/tracing"
+)
+
+const (
+	controllerName = "FlowEnrichmentController"
+	// Kinds of the names stored in the ip_names table.
+	KindService = "service"
+	KindDNS     = "dns"
+	// Maximum number of external IPs resolved in each round.
+	reverseDNSBatchSize = 50
+	// Timeout of the reverse-DNS lookup of a single IP.
+	reverseDNSTimeout = 2 * time.Second
+
+	insertIPNameQuery     = "INSERT INTO ip_names (ip, name, kind) VALUES (?, ?, ?)"
+	insertNodeLabelsQuery = "INSERT INTO node_labels (nodeName, labels) VALUES (?, ?)"
+	// Select the destination IPs of the recent flows to external networks
+	// which have no name yet. Names resolved by DNS are refreshed after a day,
+	// while names of Services are only updated by the Service events. Only the
+	// latest row of each IP is considered, as the rows replaced in the table
+	// may not be merged yet, so that the IPs no longer used by a Service, whose
+	// latest row has no kind, are resolved by DNS again.
+	unresolvedIPsQuery = `SELECT DISTINCT destinationIP FROM flows
+WHERE flowType = 3
+AND timeInserted > now() - INTERVAL 1 HOUR
+AND destinationIP GLOBAL NOT IN (
+    SELECT ip FROM ip_names
+    GROUP BY ip
+    HAVING argMax(kind, timeUpdated) = 'service'
+    OR (argMax(kind, timeUpdated) = 'dns' AND max(timeUpdated) > now() - INTERVAL 1 DAY)
+)
+LIMIT ?`
+)
+
+var (
+	// Functions to connect to ClickHouse and to resolve IPs, for unit tests
+	setupClickHouseConnection = clickhouse.SetupConnection
+	lookupAddr                = net.DefaultResolver.LookupAddr
+)
+
+type ipName struct {
+	ip   string
+	name string
+	kind string
+}
+
+// FlowEnrichmentController maintains the ip_names table in ClickHouse, which
+// maps the IPs found in the flow records to human-readable names: the
+// ClusterIPs, external IPs and load balancer IPs of Services are mapped to the
+// Namespaced names of the Services, and the external destination IPs of the
+// flows are mapped to their reverse-DNS names. The table is loaded into the
+// ip_names_dict dictionary to enrich the flow records at query time. It also
+// maintains the node_labels table, which maps the names of the Nodes to their
+// labels and is loaded into the node_labels_dict dictionary.
+type FlowEnrichmentController struct {
+	kubeClient kubernetes.Interface
+
+	serviceInformer cache.SharedIndexInformer
+	serviceLister   corelisters.ServiceLister
+	serviceSynced   cache.InformerSynced
+	// queue maintains the keys of the Services that need to be synced.
+	queue workqueue.RateLimitingInterface
+	// serviceIPsMutex protects serviceIPs.
+	serviceIPsMutex sync.Mutex
+	// serviceIPs maps the key of a Service to the IPs written for it, so that
+	// the IPs no longer used by the Service can be cleared.
+	serviceIPs         map[string]sets.String
+	reverseDNSInterval time.Duration
+
+	nodeInformer cache.SharedIndexInformer
+	nodeLister   corelisters.NodeLister
+	nodeSynced   cache.InformerSynced
+	// nodeQueue maintains the names of the Nodes that need to be synced.
+	nodeQueue workqueue.RateLimitingInterface
+	// nodeLabelsMutex protects nodeLabels.
+	nodeLabelsMutex sync.Mutex
+	// nodeLabels maps the name of a Node to the labels written for it, so
+	// that the labels are only written when they change.
+	nodeLabels map[string]string
+
+	clickhouseMutex   sync.Mutex
+	clickhouseConnect *sql.DB
+}
+
+func NewFlowEnrichmentController(
+	kubeClient kubernetes.Interface,
+	serviceInformer coreinformers.ServiceInformer,
+	nodeInformer coreinformers.NodeInformer,
+	reverseDNSInterval time.Duration,
+) *FlowEnrichmentController {
+	c := &FlowEnrichmentController{
+		kubeClient:         kubeClient,
+		serviceInformer:    serviceInformer.Informer(),
+		serviceLister:      serviceInformer.Lister(),
+		serviceSynced:      serviceInformer.Informer().HasSynced,
+		queue:              workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(controllerutil.MinRetryDelay, controllerutil.MaxRetryDelay), "flowEnrichment"),
+		serviceIPs:         make(map[string]sets.String),
+		reverseDNSInterval: reverseDNSInterval,
+		nodeInformer:       nodeInformer.Informer(),
+		nodeLister:         nodeInformer.Lister(),
+		nodeSynced:         nodeInformer.Informer().HasSynced,
+		nodeQueue:          workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(controllerutil.MinRetryDelay, controllerutil.MaxRetryDelay), "flowEnrichmentNode"),
+		nodeLabels:         make(map[string]string),
+	}
+
+	c.serviceInformer.AddEventHandlerWithResyncPeriod(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.enqueueService,
+			UpdateFunc: func(_, new interface{}) { c.enqueueService(new) },
+			DeleteFunc: c.enqueueService,
+		},
+		controllerutil.ResyncPeriod,
+	)
+	c.nodeInformer.AddEventHandlerWithResyncPeriod(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.enqueueNode,
+			UpdateFunc: func(_, new interface{}) { c.enqueueNode(new) },
+			DeleteFunc: c.enqueueNode,
+		},
+		controllerutil.ResyncPeriod,
+	)
+
+	return c
+}
+
+func (c *FlowEnrichmentController) enqueueService(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get key of Service", "object", obj)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *FlowEnrichmentController) enqueueNode(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get key of Node", "object", obj)
+		return
+	}
+	c.nodeQueue.Add(key)
+}
+
+// Run will create defaultWorkers workers (go routines) which will process the
+// Service and Node events from the workqueues, and resolve the external IPs
+// periodically if reverse-DNS resolution is enabled.
+func (c *FlowEnrichmentController) Run(stopCh <-chan struct{}) {
+	defer c.queue.ShutDown()
+	defer c.nodeQueue.ShutDown()
+
+	klog.InfoS("Starting controller", "name", controllerName)
+	defer klog.InfoS("Shutting down controller", "name", controllerName)
+
+	if !cache.WaitForNamedCacheSync(controllerName, stopCh, c.serviceSynced, c.nodeSynced) {
+		return
+	}
+
+	if c.reverseDNSInterval > 0 {
+		go wait.Until(c.resolveExternalIPs, c.reverseDNSInterval, stopCh)
+	}
+
+	for i := 0; i < controllerutil.DefaultWorkers; i++ {
+		go wait.Until(c.worker, time.Second, stopCh)
+		go wait.Until(c.nodeWorker, time.Second, stopCh)
+	}
+	<-stopCh
+}
+
+// worker is a long-running function that will continually call the processNextWorkItem function in
+// order to read and process a message on the workqueue.
+func (c *FlowEnrichmentController) worker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *FlowEnrichmentController) processNextWorkItem() bool {
+	obj, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(obj)
+	if key, ok := obj.(string); !ok {
+		c.queue.Forget(obj)
+		klog.ErrorS(nil, "Expected Service key in work queue", "got", obj)
+		return true
+	} else if err := c.syncService(key); err == nil {
+		c.queue.Forget(key)
+	} else {
+		// Put the item back on the workqueue to handle any transient errors.
+		c.queue.AddRateLimited(key)
+		klog.ErrorS(err, "Error when syncing Service names, requeuing", "key", key)
+	}
+	return true
+}
+
+func (c *FlowEnrichmentController) syncService(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	ips := sets.NewString()
+	service, err := c.serviceLister.Services(namespace).Get(name)
+	if err != nil && !apimachineryerrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		ips = getServiceIPs(service)
+	}
+
+	c.serviceIPsMutex.Lock()
+	oldIPs, synced := c.serviceIPs[key]
+	c.serviceIPsMutex.Unlock()
+	if synced && oldIPs.Equal(ips) {
+		return nil
+	}
+
+	var names []ipName
+	for _, ip := range ips.List() {
+		names = append(names, ipName{ip: ip, name: key, kind: KindService})
+	}
+	// Clear the names of the IPs no longer used by the Service. The kind is
+	// cleared as well, so that the IPs are resolved by DNS if they are still
+	// found in flows to external networks.
+	for _, ip := range oldIPs.Difference(ips).List() {
+		names = append(names, ipName{ip: ip})
+	}
+	if len(names) > 0 {
+		if err := c.writeIPNames(names); err != nil {
+			return err
+		}
+	}
+
+	c.serviceIPsMutex.Lock()
+	defer c.serviceIPsMutex.Unlock()
+	if ips.Len() == 0 {
+		delete(c.serviceIPs, key)
+	} else {
+		c.serviceIPs[key] = ips
+	}
+	return nil
+}
+
+func (c *FlowEnrichmentController) nodeWorker() {
+	for c.processNextNodeWorkItem() {
+	}
+}
+
+func (c *FlowEnrichmentController) processNextNodeWorkItem() bool {
+	obj, quit := c.nodeQueue.Get()
+	if quit {
+		return false
+	}
+	defer c.nodeQueue.Done(obj)
+	if name, ok := obj.(string); !ok {
+		c.nodeQueue.Forget(obj)
+		klog.ErrorS(nil, "Expected Node name in work queue", "got", obj)
+		return true
+	} else if err := c.syncNode(name); err == nil {
+		c.nodeQueue.Forget(name)
+	} else {
+		// Put the item back on the workqueue to handle any transient errors.
+		c.nodeQueue.AddRateLimited(name)
+		klog.ErrorS(err, "Error when syncing Node labels, requeuing", "node", name)
+	}
+	return true
+}
+
+// syncNode writes the labels of a Node, encoded as a JSON object, when they
+// change. Empty labels are written when the Node is deleted.
+func (c *FlowEnrichmentController) syncNode(name string) error {
+	labels := ""
+	node, err := c.nodeLister.Get(name)
+	if err != nil && !apimachineryerrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && len(node.Labels) > 0 {
+		// The keys of the map are sorted by the encoding, so that the same
+		// labels are always encoded the same way.
+		encoded, err := json.Marshal(node.Labels)
+		if err != nil {
+			return fmt.Errorf("failed to encode the labels of Node %s: %v", name, err)
+		}
+		labels = string(encoded)
+	}
+
+	c.nodeLabelsMutex.Lock()
+	oldLabels, synced := c.nodeLabels[name]
+	c.nodeLabelsMutex.Unlock()
+	if synced && exists && oldLabels == labels {
+		return nil
+	}
+	if err := c.writeNodeLabels(name, labels); err != nil {
+		return err
+	}
+
+	c.nodeLabelsMutex.Lock()
+	defer c.nodeLabelsMutex.Unlock()
+	if exists {
+		c.nodeLabels[name] = labels
+	} else {
+		delete(c.nodeLabels, name)
+	}
+	return nil
+}
+
+// getServiceIPs returns the ClusterIPs, external IPs and load balancer IPs of
+// a Service.
+func getServiceIPs(service *v1.Service) sets.String {
+	ips := sets.NewString()
+	for _, ip := range service.Spec.ClusterIPs {
+		if ip != "" && ip != v1.ClusterIPNone {
+			ips.Insert(ip)
+		}
+	}
+	if service.Spec.ClusterIP != "" && service.Spec.ClusterIP != v1.ClusterIPNone {
+		ips.Insert(service.Spec.ClusterIP)
+	}
+	ips.Insert(service.Spec.ExternalIPs...)
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips.Insert(ingress.IP)
+		}
+	}
+	return ips
+}
+
+// resolveExternalIPs looks up the reverse-DNS names of the external
+// destination IPs of the recent flows and writes them to ClickHouse. An empty
+// name is written for the IPs which cannot be resolved, so that they are not
+// looked up again until the name expires.
+func (c *FlowEnrichmentController) resolveExternalIPs() {
+	ips, err := c.getUnresolvedIPs()
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the external IPs to resolve")
+		return
+	}
+	if len(ips) == 0 {
+		return
+	}
+	names := make([]ipName, 0, len(ips))
+	for _, ip := range ips {
+		names = append(names, ipName{ip: ip, name: reverseLookup(ip), kind: KindDNS})
+	}
+	if err := c.writeIPNames(names); err != nil {
+		klog.ErrorS(err, "Failed to write the names of external IPs")
+		return
+	}
+	klog.V(2).InfoS("Resolved the names of external IPs", "count", len(names))
+}
+
+func reverseLookup(ip string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	defer cancel()
+	hostnames, err := lookupAddr(ctx, ip)
+	if err != nil || len(hostnames) == 0 {
+		klog.V(4).InfoS("Failed to resolve IP", "ip", ip, "err", err)
+		return ""
+	}
+	sort.Strings(hostnames)
+	return strings.TrimSuffix(hostnames[0], ".")
+}
+
+func (c *FlowEnrichmentController) getUnresolvedIPs() ([]string, error) {
+	connect, err := c.getClickHouseConnection()
+	if err != nil {
+		return nil, err
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", unresolvedIPsQuery)
+	rows, err := connect.Query(unresolvedIPsQuery, reverseDNSBatchSize)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the unresolved IPs: %v", err)
+	}
+	defer rows.Close()
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("failed to scan the unresolved IPs: %v", err)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, rows.Err()
+}
+
+// writeIPNames inserts the names in a single batch.
+func (c *FlowEnrichmentController) writeIPNames(names []ipName) error {
+	connect, err := c.getClickHouseConnection()
+	if err != nil {
+		return err
+	}
+	tx, err := connect.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin the insertion of IP names: %v", err)
+	}
+	stmt, err := tx.Prepare(insertIPNameQuery)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare the insertion of IP names: %v", err)
+	}
+	defer stmt.Close()
+	for _, n := range names {
+		if _, err := stmt.Exec(n.ip, n.name, n.kind); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to insert the name of IP %s: %v", n.ip, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the insertion of IP names: %v", err)
+	}
+	return nil
+}
+
+func (c *FlowEnrichmentController) writeNodeLabels(name, labels string) error {
+	connect, err := c.getClickHouseConnection()
+	if err != nil {
+		return err
+	}
+	tx, err := connect.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin the insertion of Node labels: %v", err)
+	}
+	stmt, err := tx.Prepare(insertNodeLabelsQuery)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare the insertion of Node labels: %v", err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(name, labels); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to insert the labels of Node %s: %v", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the insertion of Node labels: %v", err)
+	}
+	return nil
+}
+
+func (c *FlowEnrichmentController) getClickHouseConnection() (*sql.DB, error) {
+	c.clickhouseMutex.Lock()
+	defer c.clickhouseMutex.Unlock()
+	if c.clickhouseConnect == nil {
+		connect, err := setupClickHouseConnection(c.kubeClient)
+		if err != nil {
+			return nil, err
+		}
+		c.clickhouseConnect = connect
+	}
+	return c.clickhouseConnect, nil
+}
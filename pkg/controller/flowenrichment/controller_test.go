@@ -0,0 +1,240 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowenrichment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newFakeController(t *testing.T) (*FlowEnrichmentController, cache.Store, cache.Store, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	oldSetup := setupClickHouseConnection
+	setupClickHouseConnection = func(client kubernetes.Interface) (*sql.DB, error) {
+		return db, nil
+	}
+	t.Cleanup(func() { setupClickHouseConnection = oldSetup })
+
+	kubeClient := fake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	serviceInformer := informerFactory.Core().V1().Services()
+	nodeInformer := informerFactory.Core().V1().Nodes()
+	c := NewFlowEnrichmentController(kubeClient, serviceInformer, nodeInformer, time.Minute)
+	return c, serviceInformer.Informer().GetStore(), nodeInformer.Informer().GetStore(), mock
+}
+
+func expectIPNames(mock sqlmock.Sqlmock, names ...ipName) {
+	mock.ExpectBegin()
+	prepare := mock.ExpectPrepare(insertIPNameQuery)
+	for _, n := range names {
+		prepare.ExpectExec().WithArgs(n.ip, n.name, n.kind).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestGetServiceIPs(t *testing.T) {
+	testCases := []struct {
+		name        string
+		service     *v1.Service
+		expectedIPs []string
+	}{
+		{
+			name: "ClusterIP Service",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{
+					ClusterIP:  "10.96.0.10",
+					ClusterIPs: []string{"10.96.0.10", "fd00:10:96::a"},
+				},
+			},
+			expectedIPs: []string{"10.96.0.10", "fd00:10:96::a"},
+		},
+		{
+			name: "Headless Service",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{
+					ClusterIP:  v1.ClusterIPNone,
+					ClusterIPs: []string{v1.ClusterIPNone},
+				},
+			},
+			expectedIPs: []string{},
+		},
+		{
+			name: "LoadBalancer Service with external IPs",
+			service: &v1.Service{
+				Spec: v1.ServiceSpec{
+					ClusterIP:   "10.96.0.20",
+					ExternalIPs: []string{"192.168.1.10"},
+				},
+				Status: v1.ServiceStatus{
+					LoadBalancer: v1.LoadBalancerStatus{
+						Ingress: []v1.LoadBalancerIngress{{IP: "172.18.0.100"}, {Hostname: "lb.example.com"}},
+					},
+				},
+			},
+			expectedIPs: []string{"10.96.0.20", "172.18.0.100", "192.168.1.10"},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedIPs, getServiceIPs(tt.service).List())
+		})
+	}
+}
+
+func TestSyncService(t *testing.T) {
+	c, store, _, mock := newFakeController(t)
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			ClusterIP:  "10.96.0.20",
+			ClusterIPs: []string{"10.96.0.20"},
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{{IP: "172.18.0.100"}},
+			},
+		},
+	}
+	key := "default/frontend"
+
+	// The names of all the IPs are written when the Service is added.
+	require.NoError(t, store.Add(service))
+	expectIPNames(mock,
+		ipName{ip: "10.96.0.20", name: key, kind: KindService},
+		ipName{ip: "172.18.0.100", name: key, kind: KindService},
+	)
+	require.NoError(t, c.syncService(key))
+	assert.Equal(t, sets.NewString("10.96.0.20", "172.18.0.100"), c.serviceIPs[key])
+
+	// Nothing is written when the IPs do not change.
+	require.NoError(t, c.syncService(key))
+
+	// The name of an IP no longer used by the Service is cleared.
+	updatedService := service.DeepCopy()
+	updatedService.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "172.18.0.101"}}
+	require.NoError(t, store.Update(updatedService))
+	expectIPNames(mock,
+		ipName{ip: "10.96.0.20", name: key, kind: KindService},
+		ipName{ip: "172.18.0.101", name: key, kind: KindService},
+		ipName{ip: "172.18.0.100"},
+	)
+	require.NoError(t, c.syncService(key))
+
+	// The names of all the IPs are cleared when the Service is deleted.
+	require.NoError(t, store.Delete(updatedService))
+	expectIPNames(mock,
+		ipName{ip: "10.96.0.20"},
+		ipName{ip: "172.18.0.101"},
+	)
+	require.NoError(t, c.syncService(key))
+	assert.NotContains(t, c.serviceIPs, key)
+
+	// A failed write is retried with the same IPs.
+	require.NoError(t, store.Add(service))
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("connection refused"))
+	err := c.syncService(key)
+	assert.ErrorContains(t, err, "failed to begin the insertion of IP names")
+	assert.NotContains(t, c.serviceIPs, key)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectNodeLabels(mock sqlmock.Sqlmock, name, labels string) {
+	mock.ExpectBegin()
+	mock.ExpectPrepare(insertNodeLabelsQuery).ExpectExec().WithArgs(name, labels).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestSyncNode(t *testing.T) {
+	c, _, store, mock := newFakeController(t)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "worker-1",
+			Labels: map[string]string{"topology.kubernetes.io/zone": "zone-a", "kubernetes.io/os": "linux"},
+		},
+	}
+
+	// The labels are written when the Node is added.
+	require.NoError(t, store.Add(node))
+	expectNodeLabels(mock, "worker-1", `{"kubernetes.io/os":"linux","topology.kubernetes.io/zone":"zone-a"}`)
+	require.NoError(t, c.syncNode("worker-1"))
+
+	// Nothing is written when the labels do not change.
+	require.NoError(t, c.syncNode("worker-1"))
+
+	// The labels are written again when they change.
+	updatedNode := node.DeepCopy()
+	updatedNode.Labels["topology.kubernetes.io/zone"] = "zone-b"
+	require.NoError(t, store.Update(updatedNode))
+	expectNodeLabels(mock, "worker-1", `{"kubernetes.io/os":"linux","topology.kubernetes.io/zone":"zone-b"}`)
+	require.NoError(t, c.syncNode("worker-1"))
+
+	// The labels are cleared when the Node is deleted.
+	require.NoError(t, store.Delete(updatedNode))
+	expectNodeLabels(mock, "worker-1", "")
+	require.NoError(t, c.syncNode("worker-1"))
+	assert.NotContains(t, c.nodeLabels, "worker-1")
+
+	// A failed write is retried.
+	require.NoError(t, store.Add(node))
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("connection refused"))
+	err := c.syncNode("worker-1")
+	assert.ErrorContains(t, err, "failed to begin the insertion of Node labels")
+	assert.NotContains(t, c.nodeLabels, "worker-1")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveExternalIPs(t *testing.T) {
+	c, _, _, mock := newFakeController(t)
+	oldLookupAddr := lookupAddr
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		switch addr {
+		case "93.184.216.34":
+			return []string{"www.example.com.", "example.com."}, nil
+		default:
+			return nil, fmt.Errorf("no such host")
+		}
+	}
+	defer func() { lookupAddr = oldLookupAddr }()
+
+	mock.ExpectQuery(unresolvedIPsQuery).WithArgs(reverseDNSBatchSize).WillReturnRows(
+		sqlmock.NewRows([]string{"destinationIP"}).AddRow("93.184.216.34").AddRow("198.51.100.1"))
+	expectIPNames(mock,
+		ipName{ip: "93.184.216.34", name: "example.com", kind: KindDNS},
+		ipName{ip: "198.51.100.1", name: "", kind: KindDNS},
+	)
+	c.resolveExternalIPs()
+
+	// Nothing is written when all the IPs are resolved.
+	mock.ExpectQuery(unresolvedIPsQuery).WithArgs(reverseDNSBatchSize).WillReturnRows(
+		sqlmock.NewRows([]string{"destinationIP"}))
+	c.resolveExternalIPs()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowsummary
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/util/format"
+	"antrea.io/theia/pkg/util/otellog"
+)
+
+const (
+	controllerName = "FlowSummaryController"
+	// Event names of the log records of the flow summaries.
+	EventTrafficClass = "theia.flow.traffic_class"
+	EventTopTalker    = "theia.flow.top_talker"
+	// Maximum number of top talkers in each summary.
+	topTalkersLimit = 10
+)
+
+// emitLog exports the log records, for unit tests.
+var emitLog = otellog.Emit
+
+// FlowSummaryController periodically summarizes the flows of the last interval
+// and exports the summary as OpenTelemetry log records: one record for each
+// traffic class, and one for each pair of Pods among the top talkers.
+type FlowSummaryController struct {
+	querier  querier.ClickHouseStatQuerier
+	interval time.Duration
+}
+
+func NewFlowSummaryController(chq querier.ClickHouseStatQuerier, interval time.Duration) *FlowSummaryController {
+	return &FlowSummaryController{
+		querier:  chq,
+		interval: interval,
+	}
+}
+
+func (c *FlowSummaryController) Run(stopCh <-chan struct{}) {
+	klog.InfoS("Starting controller", "name", controllerName, "interval", format.Duration(c.interval))
+	defer klog.InfoS("Shutting down controller", "name", controllerName)
+
+	// The first summary covers a full interval.
+	wait.JitterUntil(func() {
+		if err := c.exportSummary(time.Now()); err != nil {
+			klog.ErrorS(err, "Failed to export the flow summary")
+		}
+	}, c.interval, 0, false, stopCh)
+}
+
+// exportSummary exports the summary of the flows over the interval before now.
+// The records of a summary share the same timestamp, so that they can be
+// grouped by the collector.
+func (c *FlowSummaryController) exportSummary(now time.Time) error {
+	namespace := env.GetTheiaNamespace()
+	var flowStats stats.FlowStats
+	if err := c.querier.GetTrafficClasses(namespace, c.interval, stats.FlowResolutionAuto, &flowStats); err != nil {
+		return fmt.Errorf("error when getting the traffic classes: %v", err)
+	}
+	if err := c.querier.GetTopTalkers(namespace, c.interval, stats.FlowResolutionAuto, "", stats.TopTalkersGroupByPods, stats.TopTalkersSortByBytes, topTalkersLimit, &flowStats); err != nil {
+		return fmt.Errorf("error when getting the top talkers: %v", err)
+	}
+	window := attribute.String("theia.flow.window", format.Duration(c.interval))
+	for _, trafficClass := range flowStats.TrafficClasses {
+		emitLog(otellog.Record{
+			EventName: EventTrafficClass,
+			Severity:  otellog.SeverityInfo,
+			Body:      fmt.Sprintf("%s flows over the last %s", trafficClass.TrafficClass, format.Duration(c.interval)),
+			Attributes: []attribute.KeyValue{
+				window,
+				attribute.String("theia.flow.traffic_class", trafficClass.TrafficClass),
+				parseCount("theia.flow.count", trafficClass.Flows),
+				parseCount("theia.flow.bytes", trafficClass.Bytes),
+			},
+			Timestamp: now,
+		})
+	}
+	for i, topTalker := range flowStats.TopTalkers {
+		emitLog(otellog.Record{
+			EventName: EventTopTalker,
+			Severity:  otellog.SeverityInfo,
+			Body:      fmt.Sprintf("Top talker %d over the last %s: %s to %s", i+1, format.Duration(c.interval), topTalker.Source, topTalker.Destination),
+			Attributes: []attribute.KeyValue{
+				window,
+				attribute.Int("theia.flow.rank", i+1),
+				attribute.String("theia.flow.source", topTalker.Source),
+				attribute.String("theia.flow.destination", topTalker.Destination),
+				parseCount("theia.flow.count", topTalker.Flows),
+				parseCount("theia.flow.bytes", topTalker.Bytes),
+				parseCount("theia.flow.packets", topTalker.Packets),
+				parseCount("theia.flow.reverse_bytes", topTalker.ReverseBytes),
+				parseCount("theia.flow.reverse_packets", topTalker.ReversePackets),
+			},
+			Timestamp: now,
+		})
+	}
+	klog.V(4).InfoS("Exported the flow summary", "trafficClasses", len(flowStats.TrafficClasses), "topTalkers", len(flowStats.TopTalkers))
+	return nil
+}
+
+// parseCount returns the attribute of a count returned by the querier as a
+// string, as an integer so that it can be aggregated by the collector, or as
+// is if it is not an integer.
+func parseCount(key, value string) attribute.KeyValue {
+	if count, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return attribute.Int64(key, count)
+	}
+	return attribute.String(key, value)
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowsummary
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util/otellog"
+)
+
+// fakeQuerier only implements the methods of ClickHouseStatQuerier called by
+// the controller.
+type fakeQuerier struct {
+	querier.ClickHouseStatQuerier
+	window time.Duration
+	err    error
+}
+
+func (q *fakeQuerier) GetTrafficClasses(namespace string, window time.Duration, resolution string, flowStats *stats.FlowStats) error {
+	q.window = window
+	flowStats.TrafficClasses = []stats.TrafficClassStats{
+		{TrafficClass: stats.TrafficClassInterNode, Flows: "120", Bytes: "4096"},
+		{TrafficClass: stats.TrafficClassPodToExternal, Flows: "3", Bytes: "512"},
+	}
+	return q.err
+}
+
+func (q *fakeQuerier) GetTopTalkers(namespace string, window time.Duration, resolution, trafficClass, groupBy, sortBy string, limit int, flowStats *stats.FlowStats) error {
+	if groupBy != stats.TopTalkersGroupByPods || limit != topTalkersLimit {
+		return fmt.Errorf("unexpected groupBy %s or limit %d", groupBy, limit)
+	}
+	flowStats.TopTalkers = []stats.TopTalkerStats{
+		{Source: "default/client", Destination: "default/server", Flows: "100", Bytes: "4000", Packets: "40", ReverseBytes: "8000", ReversePackets: "80"},
+	}
+	return nil
+}
+
+func TestExportSummary(t *testing.T) {
+	var records []otellog.Record
+	emitLog = func(r otellog.Record) { records = append(records, r) }
+	defer func() { emitLog = otellog.Emit }()
+
+	q := &fakeQuerier{}
+	c := NewFlowSummaryController(q, 5*time.Minute)
+	now := time.Now()
+	require.NoError(t, c.exportSummary(now))
+	assert.Equal(t, 5*time.Minute, q.window)
+	require.Len(t, records, 3)
+	assert.Equal(t, EventTrafficClass, records[0].EventName)
+	assert.Equal(t, now, records[0].Timestamp)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("theia.flow.window", "5m0s"),
+		attribute.String("theia.flow.traffic_class", "inter-node"),
+		attribute.Int64("theia.flow.count", 120),
+		attribute.Int64("theia.flow.bytes", 4096),
+	}, records[0].Attributes)
+	assert.Equal(t, EventTopTalker, records[2].EventName)
+	assert.Equal(t, "Top talker 1 over the last 5m0s: default/client to default/server", records[2].Body)
+	assert.Contains(t, records[2].Attributes, attribute.Int64("theia.flow.reverse_bytes", 8000))
+
+	records = nil
+	q.err = fmt.Errorf("connection refused")
+	assert.EqualError(t, c.exportSummary(now), "error when getting the traffic classes: connection refused")
+	assert.Empty(t, records)
+}
@@ -0,0 +1,416 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkpolicyrecommendation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apimachinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	"antrea.io/theia/pkg/util/clickhouse"
+)
+
+const (
+	// canaryJobLabel is set on the policies applied in log mode by a canary
+	// rollout, with the id of the job as value, so that they can be deleted
+	// when the rollout is reverted.
+	canaryJobLabel = "theia.antrea.io/canary-job"
+	// canaryRuleNamePrefix prefixes the names of the rules which would deny
+	// traffic, so that the flows they log can be counted.
+	canaryRuleNamePrefix = "theia-canary-deny-"
+	// canaryPolicyTier and canaryPolicyPriority are the tier of the ACNPs and
+	// the priority of the policies applied in log mode: the lowest priority
+	// of Antrea-native policies, in the Baseline tier for ACNPs, so that their
+	// rules only match the traffic which no other policy matches.
+	canaryPolicyTier     = "Baseline"
+	canaryPolicyPriority = float64(10000)
+	// namespaceNameLabel is the label set by K8s on every Namespace with the
+	// name of the Namespace, which the recommended ACNPs select Namespaces by.
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+
+	canaryDeniedFlowsQuery = `SELECT COUNT() FROM flows
+WHERE flowEndSeconds >= (?)
+AND (startsWith(ingressNetworkPolicyRuleName, (?)) OR startsWith(egressNetworkPolicyRuleName, (?)));`
+)
+
+var (
+	// errPolicyNotApplied is returned when a recommended policy already
+	// exists and was not applied by the canary rollout, in which case the
+	// rollout fails instead of overwriting it.
+	errPolicyNotApplied = errors.New("already exists and was not applied by the canary rollout")
+	// errCanaryRolloutsDisabled is returned for the jobs with a canary
+	// rollout when Theia Manager is not allowed to apply Antrea-native
+	// policies.
+	errCanaryRolloutsDisabled = errors.New("canary rollouts are not enabled in Theia Manager")
+
+	yamlSeparatorRegex = regexp.MustCompile(`(?m)^---[ \t]*$`)
+	// antreaPolicyResources are the resources of the Antrea-native policies
+	// which can be recommended, by kind.
+	antreaPolicyResources = map[string]string{
+		"NetworkPolicy":        "networkpolicies",
+		"ClusterNetworkPolicy": "clusternetworkpolicies",
+		"ClusterGroup":         "clustergroups",
+	}
+	// canaryPolicyResources are the resources deleted when a canary rollout
+	// is reverted, with the versions used by the recommended policies.
+	canaryPolicyResources = []struct {
+		resource   schema.GroupVersionResource
+		namespaced bool
+	}{
+		{schema.GroupVersionResource{Group: "crd.antrea.io", Version: "v1alpha1", Resource: "networkpolicies"}, true},
+		{schema.GroupVersionResource{Group: "crd.antrea.io", Version: "v1alpha1", Resource: "clusternetworkpolicies"}, false},
+		{schema.GroupVersionResource{Group: "crd.antrea.io", Version: "v1alpha2", Resource: "clustergroups"}, false},
+	}
+)
+
+// syncCanary drives the canary rollout of a completed job: the recommended
+// policies of the canary Namespace are applied in log mode, then promoted to
+// enforcing or reverted at the end of the soak window.
+func (c *NPRecommendationController) syncCanary(npReco *crdv1alpha1.NetworkPolicyRecommendation) error {
+	if c.dynamicClient == nil {
+		if npReco.Status.Canary != nil && npReco.Status.Canary.Phase != crdv1alpha1.NPRecommendationCanaryPhaseSoaking {
+			return nil
+		}
+		status := npReco.Status.Canary.DeepCopy()
+		if status == nil {
+			status = &crdv1alpha1.NetworkPolicyRecommendationCanaryStatus{}
+		}
+		status.Phase = crdv1alpha1.NPRecommendationCanaryPhaseFailed
+		status.Message = errCanaryRolloutsDisabled.Error()
+		return c.updateCanaryStatus(npReco, status)
+	}
+	if npReco.Status.Canary == nil {
+		return c.startCanary(npReco)
+	}
+	if npReco.Status.Canary.Phase == crdv1alpha1.NPRecommendationCanaryPhaseSoaking {
+		return c.checkCanary(npReco)
+	}
+	return nil
+}
+
+func (c *NPRecommendationController) startCanary(npReco *crdv1alpha1.NetworkPolicyRecommendation) error {
+	canary := npReco.Spec.Canary
+	policies, err := c.getCanaryPolicies(npReco)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return c.updateCanaryStatus(npReco, &crdv1alpha1.NetworkPolicyRecommendationCanaryStatus{
+			Phase:   crdv1alpha1.NPRecommendationCanaryPhaseFailed,
+			Message: fmt.Sprintf("no Antrea-native policy is recommended for Namespace %s", canary.Namespace),
+		})
+	}
+	var appliedPolicies []string
+	for _, policy := range policies {
+		if err := applyAntreaPolicy(c.dynamicClient, toLogMode(policy, npReco.Status.SparkApplication), npReco.Status.SparkApplication); errors.Is(err, errPolicyNotApplied) {
+			return c.failCanary(npReco, npReco.Status.Canary, err)
+		} else if err != nil {
+			return fmt.Errorf("failed to apply policy %s in log mode: %v", policyReference(policy), err)
+		}
+		appliedPolicies = append(appliedPolicies, policyReference(policy))
+	}
+	klog.InfoS("Applied recommended policies in log mode", "NetworkPolicyRecommendation", npReco.Name, "namespace", canary.Namespace, "policies", appliedPolicies)
+	c.addPeriodicSync(apimachinerytypes.NamespacedName{
+		Name:      npReco.Name,
+		Namespace: npReco.Namespace,
+	})
+	return c.updateCanaryStatus(npReco, &crdv1alpha1.NetworkPolicyRecommendationCanaryStatus{
+		Phase:           crdv1alpha1.NPRecommendationCanaryPhaseSoaking,
+		SoakStartTime:   metav1.NewTime(time.Now()),
+		AppliedPolicies: appliedPolicies,
+		Message:         fmt.Sprintf("Policies applied in log mode for a soak window of %s", canary.SoakWindow.Duration),
+	})
+}
+
+// checkCanary counts the flows which would have been denied since the start
+// of the soak window. The rollout is reverted as soon as there are too many of
+// them, and promoted at the end of the soak window otherwise.
+func (c *NPRecommendationController) checkCanary(npReco *crdv1alpha1.NetworkPolicyRecommendation) error {
+	canary := npReco.Spec.Canary
+	status := npReco.Status.Canary.DeepCopy()
+	deniedFlows, err := c.countCanaryDeniedFlows(npReco.Status.SparkApplication, status.SoakStartTime.Time)
+	if err != nil {
+		return err
+	}
+	status.DeniedFlows = deniedFlows
+	namespacedName := apimachinerytypes.NamespacedName{
+		Name:      npReco.Name,
+		Namespace: npReco.Namespace,
+	}
+	if deniedFlows > canary.MaxDeniedFlows {
+		if err := deleteCanaryPolicies(c.dynamicClient, canary.Namespace, npReco.Status.SparkApplication); err != nil {
+			return fmt.Errorf("failed to delete policies applied in log mode: %v", err)
+		}
+		c.stopPeriodicSync(namespacedName)
+		status.Phase = crdv1alpha1.NPRecommendationCanaryPhaseReverted
+		status.Message = fmt.Sprintf("Policies reverted as %d flows would have been denied, more than the maximum of %d", deniedFlows, canary.MaxDeniedFlows)
+		return c.updateCanaryStatus(npReco, status)
+	}
+	if time.Now().Before(status.SoakStartTime.Add(canary.SoakWindow.Duration)) {
+		if deniedFlows == npReco.Status.Canary.DeniedFlows {
+			return nil
+		}
+		return c.updateCanaryStatus(npReco, status)
+	}
+	policies, err := c.getCanaryPolicies(npReco)
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if err := applyAntreaPolicy(c.dynamicClient, policy, npReco.Status.SparkApplication); errors.Is(err, errPolicyNotApplied) {
+			c.stopPeriodicSync(namespacedName)
+			return c.failCanary(npReco, status, err)
+		} else if err != nil {
+			return fmt.Errorf("failed to enforce policy %s: %v", policyReference(policy), err)
+		}
+	}
+	c.stopPeriodicSync(namespacedName)
+	status.Phase = crdv1alpha1.NPRecommendationCanaryPhasePromoted
+	status.Message = fmt.Sprintf("Policies enforced after a soak window of %s with %d flows which would have been denied", canary.SoakWindow.Duration, deniedFlows)
+	return c.updateCanaryStatus(npReco, status)
+}
+
+// failCanary deletes the policies applied in log mode by the canary rollout and
+// sets its phase to FAILED, when a recommended policy conflicts with an
+// existing one.
+func (c *NPRecommendationController) failCanary(npReco *crdv1alpha1.NetworkPolicyRecommendation, status *crdv1alpha1.NetworkPolicyRecommendationCanaryStatus, err error) error {
+	if err := deleteCanaryPolicies(c.dynamicClient, npReco.Spec.Canary.Namespace, npReco.Status.SparkApplication); err != nil {
+		return fmt.Errorf("failed to delete policies applied in log mode: %v", err)
+	}
+	if status == nil {
+		status = &crdv1alpha1.NetworkPolicyRecommendationCanaryStatus{}
+	}
+	status.Phase = crdv1alpha1.NPRecommendationCanaryPhaseFailed
+	status.Message = err.Error()
+	return c.updateCanaryStatus(npReco, status)
+}
+
+func (c *NPRecommendationController) updateCanaryStatus(npReco *crdv1alpha1.NetworkPolicyRecommendation, status *crdv1alpha1.NetworkPolicyRecommendationCanaryStatus) error {
+	update := npReco.DeepCopy()
+	update.Status.Canary = status
+	_, err := c.crdClient.CrdV1alpha1().NetworkPolicyRecommendations(npReco.Namespace).UpdateStatus(context.TODO(), update, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *NPRecommendationController) countCanaryDeniedFlows(id string, since time.Time) (int, error) {
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return 0, err
+		}
+	}
+	ruleNamePrefix := canaryRuleNamePrefix + id
+	var deniedFlows int
+	if err := c.clickhouseConnect.QueryRow(canaryDeniedFlowsQuery, since, ruleNamePrefix, ruleNamePrefix).Scan(&deniedFlows); err != nil {
+		return 0, fmt.Errorf("failed to count the flows denied by the policies applied in log mode: %v", err)
+	}
+	return deniedFlows, nil
+}
+
+// getCanaryPolicies returns the recommended Antrea-native policies applied to
+// the canary Namespace, and the ClusterGroups of its Services. The ACNPs
+// applied to all the Namespaces are restricted to the canary Namespace.
+func (c *NPRecommendationController) getCanaryPolicies(npReco *crdv1alpha1.NetworkPolicyRecommendation) ([]*unstructured.Unstructured, error) {
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows, err := c.clickhouseConnect.Query("SELECT policy FROM recommendations WHERE id = (?);", npReco.Status.SparkApplication)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recommended policies: %v", err)
+	}
+	defer rows.Close()
+	var policies []*unstructured.Unstructured
+	for rows.Next() {
+		var outcome string
+		if err := rows.Scan(&outcome); err != nil {
+			return nil, fmt.Errorf("failed to scan recommended policy: %v", err)
+		}
+		for _, document := range yamlSeparatorRegex.Split(outcome, -1) {
+			if strings.TrimSpace(document) == "" {
+				continue
+			}
+			policy := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal([]byte(document), &policy.Object); err != nil {
+				return nil, fmt.Errorf("failed to parse recommended policy: %v", err)
+			}
+			if scopeToNamespace(policy, npReco.Spec.Canary.Namespace) {
+				policies = append(policies, policy)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get recommended policies: %v", err)
+	}
+	return policies, nil
+}
+
+// scopeToNamespace checks whether the policy belongs to the canary rollout of
+// namespace, and restricts the ACNPs applied to all the Namespaces to it.
+func scopeToNamespace(policy *unstructured.Unstructured, namespace string) bool {
+	if !strings.HasPrefix(policy.GetAPIVersion(), "crd.antrea.io/") {
+		return false
+	}
+	switch policy.GetKind() {
+	case "NetworkPolicy":
+		return policy.GetNamespace() == namespace
+	case "ClusterGroup":
+		serviceNamespace, _, _ := unstructured.NestedString(policy.Object, "spec", "serviceReference", "namespace")
+		return serviceNamespace == namespace
+	case "ClusterNetworkPolicy":
+		appliedTo, _, _ := unstructured.NestedSlice(policy.Object, "spec", "appliedTo")
+		selected := false
+		for _, peer := range appliedTo {
+			peerMap, ok := peer.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			namespaceSelector, found, _ := unstructured.NestedMap(peerMap, "namespaceSelector")
+			if !found {
+				continue
+			}
+			if len(namespaceSelector) == 0 {
+				peerMap["namespaceSelector"] = map[string]interface{}{
+					"matchLabels": map[string]interface{}{namespaceNameLabel: namespace},
+				}
+				selected = true
+			} else if name, _, _ := unstructured.NestedString(namespaceSelector, "matchLabels", namespaceNameLabel); name == namespace {
+				selected = true
+			}
+		}
+		if selected {
+			unstructured.SetNestedSlice(policy.Object, appliedTo, "spec", "appliedTo")
+		}
+		return selected
+	}
+	return false
+}
+
+// toLogMode returns a copy of the policy in log mode: its rules which would
+// drop or reject traffic allow and log it instead, and are named after the
+// job so that the flows they match can be counted. As allowing traffic at the
+// recommended priority would also let through the traffic denied by the
+// policies of lower priority, the policy is moved to the lowest priority, in
+// the Baseline tier for an ACNP. An ANP cannot be in the Baseline tier, so its
+// rules still take precedence over the policies of the lower tiers and the K8s
+// NetworkPolicies.
+func toLogMode(policy *unstructured.Unstructured, id string) *unstructured.Unstructured {
+	logPolicy := policy.DeepCopy()
+	labels := logPolicy.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[canaryJobLabel] = id
+	logPolicy.SetLabels(labels)
+	switch logPolicy.GetKind() {
+	case "ClusterNetworkPolicy":
+		unstructured.SetNestedField(logPolicy.Object, canaryPolicyTier, "spec", "tier")
+		unstructured.SetNestedField(logPolicy.Object, canaryPolicyPriority, "spec", "priority")
+	case "NetworkPolicy":
+		unstructured.SetNestedField(logPolicy.Object, canaryPolicyPriority, "spec", "priority")
+	}
+	for _, direction := range []string{"ingress", "egress"} {
+		rules, found, _ := unstructured.NestedSlice(logPolicy.Object, "spec", direction)
+		if !found {
+			continue
+		}
+		for i, rule := range rules {
+			ruleMap, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if action, _ := ruleMap["action"].(string); action == "Drop" || action == "Reject" {
+				ruleMap["action"] = "Allow"
+				ruleMap["enableLogging"] = true
+				ruleMap["name"] = fmt.Sprintf("%s%s-%s-%d", canaryRuleNamePrefix, id, direction, i)
+			}
+		}
+		unstructured.SetNestedSlice(logPolicy.Object, rules, "spec", direction)
+	}
+	return logPolicy
+}
+
+// policyReference returns the reference of a policy in the canary status, as
+// <kind>/<name> or <kind>/<namespace>/<name>.
+func policyReference(policy *unstructured.Unstructured) string {
+	if policy.GetNamespace() == "" {
+		return policy.GetKind() + "/" + policy.GetName()
+	}
+	return policy.GetKind() + "/" + policy.GetNamespace() + "/" + policy.GetName()
+}
+
+// applyAntreaPolicy creates the Antrea-native policy, or replaces it if it
+// already exists and was applied in log mode by the canary rollout of the job
+// with the given id. Any other existing policy is left untouched, so that the
+// rollout never overwrites, and then deletes when it is reverted, a policy it
+// did not create.
+func applyAntreaPolicy(client dynamic.Interface, policy *unstructured.Unstructured, id string) error {
+	resource, ok := antreaPolicyResources[policy.GetKind()]
+	if !ok {
+		return fmt.Errorf("kind %s is not an Antrea-native policy", policy.GetKind())
+	}
+	gvr := policy.GroupVersionKind().GroupVersion().WithResource(resource)
+	resourceClient := client.Resource(gvr).Namespace(policy.GetNamespace())
+	_, err := resourceClient.Create(context.TODO(), policy, metav1.CreateOptions{})
+	if !apimachineryerrors.IsAlreadyExists(err) {
+		return err
+	}
+	existing, err := resourceClient.Get(context.TODO(), policy.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if existing.GetLabels()[canaryJobLabel] != id {
+		return fmt.Errorf("policy %s %w", policyReference(policy), errPolicyNotApplied)
+	}
+	update := policy.DeepCopy()
+	update.SetResourceVersion(existing.GetResourceVersion())
+	_, err = resourceClient.Update(context.TODO(), update, metav1.UpdateOptions{})
+	return err
+}
+
+// deleteCanaryPolicies deletes the policies applied in log mode by the canary
+// rollout of the job with the given id.
+func deleteCanaryPolicies(client dynamic.Interface, namespace string, id string) error {
+	for _, canaryResource := range canaryPolicyResources {
+		var resourceClient dynamic.ResourceInterface = client.Resource(canaryResource.resource)
+		if canaryResource.namespaced {
+			resourceClient = client.Resource(canaryResource.resource).Namespace(namespace)
+		}
+		err := resourceClient.DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{
+			LabelSelector: canaryJobLabel + "=" + id,
+		})
+		if err != nil && !apimachineryerrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s: %v", canaryResource.resource.Resource, err)
+		}
+	}
+	return nil
+}
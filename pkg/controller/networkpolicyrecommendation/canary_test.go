@@ -0,0 +1,426 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkpolicyrecommendation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	fakecrd "antrea.io/theia/pkg/client/clientset/versioned/fake"
+	crdinformers "antrea.io/theia/pkg/client/informers/externalversions"
+)
+
+const (
+	canaryTestID = "364a180e-2d83-4502-8063-0c3db36cbcd3"
+
+	canaryTestANP = `apiVersion: crd.antrea.io/v1alpha1
+kind: NetworkPolicy
+metadata:
+  name: recommend-allow-anp-nxvqg
+  namespace: default
+spec:
+  appliedTo:
+  - podSelector:
+      matchLabels:
+        app: nginx
+  ingress:
+  - action: Allow
+    from:
+    - podSelector:
+        matchLabels:
+          app: client
+  priority: 5
+  tier: Application
+`
+	canaryTestOtherNamespaceANP = `apiVersion: crd.antrea.io/v1alpha1
+kind: NetworkPolicy
+metadata:
+  name: recommend-allow-anp-abcde
+  namespace: kube-system
+spec:
+  appliedTo:
+  - podSelector: {}
+  priority: 5
+  tier: Application
+`
+	canaryTestRejectAllACNP = `apiVersion: crd.antrea.io/v1alpha1
+kind: ClusterNetworkPolicy
+metadata:
+  name: recommend-reject-all-acnp
+spec:
+  appliedTo:
+  - namespaceSelector: {}
+    podSelector: {}
+  egress:
+  - action: Reject
+    to:
+    - podSelector: {}
+  ingress:
+  - action: Reject
+    from:
+    - podSelector: {}
+  priority: 5
+  tier: Baseline
+`
+)
+
+func parseTestPolicy(t *testing.T, document string) *unstructured.Unstructured {
+	policy := &unstructured.Unstructured{}
+	require.NoError(t, yaml.Unmarshal([]byte(document), &policy.Object))
+	return policy
+}
+
+func TestScopeToNamespace(t *testing.T) {
+	assert.True(t, scopeToNamespace(parseTestPolicy(t, canaryTestANP), "default"))
+	assert.False(t, scopeToNamespace(parseTestPolicy(t, canaryTestOtherNamespaceANP), "default"))
+
+	acnp := parseTestPolicy(t, canaryTestRejectAllACNP)
+	assert.True(t, scopeToNamespace(acnp, "default"))
+	appliedTo, _, _ := unstructured.NestedSlice(acnp.Object, "spec", "appliedTo")
+	require.Len(t, appliedTo, 1)
+	namespace, _, _ := unstructured.NestedString(appliedTo[0].(map[string]interface{}), "namespaceSelector", "matchLabels", namespaceNameLabel)
+	assert.Equal(t, "default", namespace)
+
+	k8sNP := parseTestPolicy(t, `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: recommend-k8s-np-kdjq2
+  namespace: default
+`)
+	assert.False(t, scopeToNamespace(k8sNP, "default"))
+}
+
+func TestToLogMode(t *testing.T) {
+	acnp := parseTestPolicy(t, canaryTestRejectAllACNP)
+	logACNP := toLogMode(acnp, canaryTestID)
+	assert.Equal(t, map[string]string{canaryJobLabel: canaryTestID}, logACNP.GetLabels())
+	for _, direction := range []string{"ingress", "egress"} {
+		rules, _, _ := unstructured.NestedSlice(logACNP.Object, "spec", direction)
+		require.Len(t, rules, 1)
+		rule := rules[0].(map[string]interface{})
+		assert.Equal(t, "Allow", rule["action"])
+		assert.Equal(t, true, rule["enableLogging"])
+		assert.Equal(t, canaryRuleNamePrefix+canaryTestID+"-"+direction+"-0", rule["name"])
+	}
+	tier, _, _ := unstructured.NestedString(logACNP.Object, "spec", "tier")
+	assert.Equal(t, "Baseline", tier)
+	priority, _, _ := unstructured.NestedFloat64(logACNP.Object, "spec", "priority")
+	assert.Equal(t, canaryPolicyPriority, priority)
+	// The enforcing policy is left unchanged.
+	rules, _, _ := unstructured.NestedSlice(acnp.Object, "spec", "ingress")
+	assert.Equal(t, "Reject", rules[0].(map[string]interface{})["action"])
+	assert.Empty(t, acnp.GetLabels())
+	priority, _, _ = unstructured.NestedFloat64(acnp.Object, "spec", "priority")
+	assert.Equal(t, float64(5), priority)
+
+	anp := parseTestPolicy(t, canaryTestANP)
+	logANP := toLogMode(anp, canaryTestID)
+	rules, _, _ = unstructured.NestedSlice(logANP.Object, "spec", "ingress")
+	assert.Equal(t, "Allow", rules[0].(map[string]interface{})["action"])
+	assert.NotContains(t, rules[0].(map[string]interface{}), "name")
+	// An ANP keeps its tier, as it cannot be in the Baseline tier.
+	tier, _, _ = unstructured.NestedString(logANP.Object, "spec", "tier")
+	assert.Equal(t, "Application", tier)
+	priority, _, _ = unstructured.NestedFloat64(logANP.Object, "spec", "priority")
+	assert.Equal(t, canaryPolicyPriority, priority)
+}
+
+var (
+	canaryTestANPResource  = schema.GroupVersionResource{Group: "crd.antrea.io", Version: "v1alpha1", Resource: "networkpolicies"}
+	canaryTestACNPResource = schema.GroupVersionResource{Group: "crd.antrea.io", Version: "v1alpha1", Resource: "clusternetworkpolicies"}
+)
+
+func TestApplyAntreaPolicy(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	anp := parseTestPolicy(t, canaryTestANP)
+	require.NoError(t, applyAntreaPolicy(client, toLogMode(anp, canaryTestID), canaryTestID))
+	applied, err := client.Resource(canaryTestANPResource).Namespace("default").Get(context.TODO(), anp.GetName(), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, canaryTestID, applied.GetLabels()[canaryJobLabel])
+
+	// The policy applied in log mode by the same job is replaced.
+	client.ClearActions()
+	require.NoError(t, applyAntreaPolicy(client, anp, canaryTestID))
+	var verbs []string
+	for _, action := range client.Actions() {
+		verbs = append(verbs, action.GetVerb())
+	}
+	assert.Equal(t, []string{"create", "get", "update"}, verbs)
+	applied, err = client.Resource(canaryTestANPResource).Namespace("default").Get(context.TODO(), anp.GetName(), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, applied.GetLabels())
+
+	// Any other existing policy is left untouched.
+	client.ClearActions()
+	err = applyAntreaPolicy(client, toLogMode(anp, canaryTestID), canaryTestID)
+	assert.ErrorIs(t, err, errPolicyNotApplied)
+	assert.EqualError(t, err, "policy NetworkPolicy/default/recommend-allow-anp-nxvqg already exists and was not applied by the canary rollout")
+	for _, action := range client.Actions() {
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+
+	service := parseTestPolicy(t, `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: default
+`)
+	assert.EqualError(t, applyAntreaPolicy(client, service, canaryTestID), "kind Service is not an Antrea-native policy")
+}
+
+func TestDeleteCanaryPolicies(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	require.NoError(t, deleteCanaryPolicies(client, "default", canaryTestID))
+	assertCanaryPoliciesDeleted(t, client)
+
+	client.PrependReactor("delete-collection", "clustergroups", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("forbidden")
+	})
+	assert.EqualError(t, deleteCanaryPolicies(client, "default", canaryTestID), "failed to delete clustergroups: forbidden")
+}
+
+// assertCanaryPoliciesDeleted checks that the policies applied in log mode by
+// the canary rollout of the test job were deleted, in the canary Namespace for
+// the namespaced ones.
+func assertCanaryPoliciesDeleted(t *testing.T, client *dynamicfake.FakeDynamicClient) {
+	var deleted []string
+	for _, action := range client.Actions() {
+		deleteAction, ok := action.(k8stesting.DeleteCollectionAction)
+		if !ok {
+			continue
+		}
+		assert.Equal(t, canaryJobLabel+"="+canaryTestID, deleteAction.GetListRestrictions().Labels.String())
+		deleted = append(deleted, deleteAction.GetNamespace()+"/"+deleteAction.GetResource().Resource)
+	}
+	assert.Equal(t, []string{"default/networkpolicies", "/clusternetworkpolicies", "/clustergroups"}, deleted)
+}
+
+func TestCanaryRollout(t *testing.T) {
+	testCases := []struct {
+		name            string
+		maxDeniedFlows  int
+		deniedFlows     int
+		soakElapsed     bool
+		expectedPhase   string
+		expectedUpdates []string
+		expectReverted  bool
+	}{
+		{
+			name:          "Soaking",
+			deniedFlows:   0,
+			expectedPhase: crdv1alpha1.NPRecommendationCanaryPhaseSoaking,
+		},
+		{
+			name:            "Promoted",
+			maxDeniedFlows:  2,
+			deniedFlows:     2,
+			soakElapsed:     true,
+			expectedPhase:   crdv1alpha1.NPRecommendationCanaryPhasePromoted,
+			expectedUpdates: []string{"NetworkPolicy/default/recommend-allow-anp-nxvqg", "ClusterNetworkPolicy/recommend-reject-all-acnp"},
+		},
+		{
+			name:           "Reverted",
+			maxDeniedFlows: 2,
+			deniedFlows:    3,
+			expectedPhase:  crdv1alpha1.NPRecommendationCanaryPhaseReverted,
+			expectReverted: true,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			kubeClient := fake.NewSimpleClientset()
+			crdClient := fakecrd.NewSimpleClientset()
+			crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, informerDefaultResync)
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+			c := NewNPRecommendationController(crdClient, kubeClient, dynamicClient, crdInformerFactory.Crd().V1alpha1().NetworkPolicyRecommendations(), nil, 0)
+			c.clickhouseConnect = db
+
+			npReco := &crdv1alpha1.NetworkPolicyRecommendation{
+				ObjectMeta: metav1.ObjectMeta{Name: "pr-" + canaryTestID, Namespace: testNamespace},
+				Spec: crdv1alpha1.NetworkPolicyRecommendationSpec{
+					PolicyType: "anp-deny-all",
+					Canary: &crdv1alpha1.NetworkPolicyRecommendationCanary{
+						Namespace:      "default",
+						SoakWindow:     metav1.Duration{Duration: time.Hour},
+						MaxDeniedFlows: tt.maxDeniedFlows,
+					},
+				},
+				Status: crdv1alpha1.NetworkPolicyRecommendationStatus{
+					State:            crdv1alpha1.NPRecommendationStateCompleted,
+					SparkApplication: canaryTestID,
+					EndTime:          metav1.NewTime(time.Now()),
+				},
+			}
+			npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Create(context.TODO(), npReco, metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			recommendationsQuery := regexp.QuoteMeta("SELECT policy FROM recommendations WHERE id = (?);")
+			recommendations := sqlmock.NewRows([]string{"policy"}).
+				AddRow(canaryTestANP).
+				AddRow(canaryTestOtherNamespaceANP).
+				AddRow(canaryTestRejectAllACNP)
+			mock.ExpectQuery(recommendationsQuery).WithArgs(canaryTestID).WillReturnRows(recommendations)
+			require.NoError(t, c.syncCanary(npReco))
+			npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), npReco.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.NotNil(t, npReco.Status.Canary)
+			assert.Equal(t, crdv1alpha1.NPRecommendationCanaryPhaseSoaking, npReco.Status.Canary.Phase)
+			assert.Equal(t, []string{"NetworkPolicy/default/recommend-allow-anp-nxvqg", "ClusterNetworkPolicy/recommend-reject-all-acnp"}, npReco.Status.Canary.AppliedPolicies)
+			anp, err := dynamicClient.Resource(canaryTestANPResource).Namespace("default").Get(context.TODO(), "recommend-allow-anp-nxvqg", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, canaryTestID, anp.GetLabels()[canaryJobLabel])
+			acnp, err := dynamicClient.Resource(canaryTestACNPResource).Get(context.TODO(), "recommend-reject-all-acnp", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, canaryTestID, acnp.GetLabels()[canaryJobLabel])
+			_, err = dynamicClient.Resource(canaryTestANPResource).Namespace("kube-system").Get(context.TODO(), "recommend-allow-anp-abcde", metav1.GetOptions{})
+			assert.True(t, apimachineryerrors.IsNotFound(err))
+			dynamicClient.ClearActions()
+
+			if tt.soakElapsed {
+				npReco.Status.Canary.SoakStartTime = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+				recommendations := sqlmock.NewRows([]string{"policy"}).
+					AddRow(canaryTestANP).
+					AddRow(canaryTestRejectAllACNP)
+				mock.ExpectQuery(regexp.QuoteMeta(canaryDeniedFlowsQuery)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.deniedFlows))
+				mock.ExpectQuery(recommendationsQuery).WithArgs(canaryTestID).WillReturnRows(recommendations)
+			} else {
+				mock.ExpectQuery(regexp.QuoteMeta(canaryDeniedFlowsQuery)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.deniedFlows))
+			}
+			require.NoError(t, c.syncCanary(npReco))
+			npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), npReco.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedPhase, npReco.Status.Canary.Phase)
+			var updatedPolicies []string
+			for _, action := range dynamicClient.Actions() {
+				updateAction, ok := action.(k8stesting.UpdateAction)
+				if !ok || action.GetVerb() != "update" {
+					continue
+				}
+				policy := updateAction.GetObject().(*unstructured.Unstructured)
+				updatedPolicies = append(updatedPolicies, policyReference(policy))
+				assert.Empty(t, policy.GetLabels())
+			}
+			assert.Equal(t, tt.expectedUpdates, updatedPolicies)
+			if tt.expectReverted {
+				assertCanaryPoliciesDeleted(t, dynamicClient)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCanaryRolloutExistingPolicy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	kubeClient := fake.NewSimpleClientset()
+	crdClient := fakecrd.NewSimpleClientset()
+	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, informerDefaultResync)
+	// The ACNP recommended for all the Namespaces already exists, e.g. it
+	// was applied by hand from the result of the job.
+	existingACNP := parseTestPolicy(t, canaryTestRejectAllACNP)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), existingACNP)
+	c := NewNPRecommendationController(crdClient, kubeClient, dynamicClient, crdInformerFactory.Crd().V1alpha1().NetworkPolicyRecommendations(), nil, 0)
+	c.clickhouseConnect = db
+
+	npReco := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: "pr-" + canaryTestID, Namespace: testNamespace},
+		Spec: crdv1alpha1.NetworkPolicyRecommendationSpec{
+			PolicyType: "anp-deny-all",
+			Canary: &crdv1alpha1.NetworkPolicyRecommendationCanary{
+				Namespace:  "default",
+				SoakWindow: metav1.Duration{Duration: time.Hour},
+			},
+		},
+		Status: crdv1alpha1.NetworkPolicyRecommendationStatus{
+			State:            crdv1alpha1.NPRecommendationStateCompleted,
+			SparkApplication: canaryTestID,
+			EndTime:          metav1.NewTime(time.Now()),
+		},
+	}
+	npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Create(context.TODO(), npReco, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	recommendations := sqlmock.NewRows([]string{"policy"}).
+		AddRow(canaryTestANP).
+		AddRow(canaryTestRejectAllACNP)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT policy FROM recommendations WHERE id = (?);")).WithArgs(canaryTestID).WillReturnRows(recommendations)
+	require.NoError(t, c.syncCanary(npReco))
+	npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), npReco.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, npReco.Status.Canary)
+	assert.Equal(t, crdv1alpha1.NPRecommendationCanaryPhaseFailed, npReco.Status.Canary.Phase)
+	assert.Equal(t, "policy ClusterNetworkPolicy/recommend-reject-all-acnp already exists and was not applied by the canary rollout", npReco.Status.Canary.Message)
+	// The existing ACNP is not overwritten, and the ANP applied in log mode
+	// is deleted.
+	for _, action := range dynamicClient.Actions() {
+		assert.NotEqual(t, "update", action.GetVerb())
+	}
+	assertCanaryPoliciesDeleted(t, dynamicClient)
+	acnp, err := dynamicClient.Resource(canaryTestACNPResource).Get(context.TODO(), "recommend-reject-all-acnp", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, acnp.GetLabels())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCanaryRolloutsDisabled(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	crdClient := fakecrd.NewSimpleClientset()
+	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, informerDefaultResync)
+	c := NewNPRecommendationController(crdClient, kubeClient, nil, crdInformerFactory.Crd().V1alpha1().NetworkPolicyRecommendations(), nil, 0)
+
+	npReco := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: "pr-" + canaryTestID, Namespace: testNamespace},
+		Spec: crdv1alpha1.NetworkPolicyRecommendationSpec{
+			PolicyType: "anp-deny-all",
+			Canary: &crdv1alpha1.NetworkPolicyRecommendationCanary{
+				Namespace:  "default",
+				SoakWindow: metav1.Duration{Duration: time.Hour},
+			},
+		},
+		Status: crdv1alpha1.NetworkPolicyRecommendationStatus{
+			State:            crdv1alpha1.NPRecommendationStateCompleted,
+			SparkApplication: canaryTestID,
+		},
+	}
+	npReco, err := crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Create(context.TODO(), npReco, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, c.syncCanary(npReco))
+	npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), npReco.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotNil(t, npReco.Status.Canary)
+	assert.Equal(t, crdv1alpha1.NPRecommendationCanaryPhaseFailed, npReco.Status.Canary.Phase)
+	assert.Equal(t, "canary rollouts are not enabled in Theia Manager", npReco.Status.Canary.Message)
+}
@@ -17,6 +17,7 @@ package networkpolicyrecommendation
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -30,8 +31,11 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	apimachinerytypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
@@ -40,6 +44,7 @@ import (
 	crdv1a1informers "antrea.io/theia/pkg/client/informers/externalversions/crd/v1alpha1"
 	"antrea.io/theia/pkg/client/listers/crd/v1alpha1"
 	controllerutil "antrea.io/theia/pkg/controller"
+	"antrea.io/theia/pkg/resultstore"
 	"antrea.io/theia/pkg/util"
 	"antrea.io/theia/pkg/util/clickhouse"
 	"antrea.io/theia/pkg/util/env"
@@ -68,6 +73,9 @@ var (
 type NPRecommendationController struct {
 	crdClient  versioned.Interface
 	kubeClient kubernetes.Interface
+	// dynamicClient applies and deletes the Antrea-native policies of the
+	// canary rollouts. It is nil when canary rollouts are not enabled.
+	dynamicClient dynamic.Interface
 
 	npRecommendationInformer cache.SharedIndexInformer
 	npRecommendationLister   v1alpha1.NetworkPolicyRecommendationLister
@@ -79,21 +87,44 @@ type NPRecommendationController struct {
 	periodicResyncSetMutex sync.Mutex
 	periodicResyncSet      map[apimachinerytypes.NamespacedName]struct{}
 	clickhouseConnect      *sql.DB
+	eventBroadcaster       record.EventBroadcaster
+	eventRecorder          record.EventRecorder
+	// resultStore is the store to which the results of the completed jobs
+	// are copied, or nil if they are only stored in ClickHouse.
+	resultStore resultstore.Store
+	// maxConcurrentJobs is the maximum number of jobs which are scheduled or
+	// running at the same time, or 0 if there is no maximum.
+	maxConcurrentJobs int
+	// jobSlotsMutex serializes the admission of the new and queued jobs
+	// across the workers, so that no more than maxConcurrentJobs jobs are
+	// started.
+	jobSlotsMutex sync.Mutex
 }
 
 type NamespacedId struct {
 	Namespace string
 	Id        string
+	// CanaryNamespace is set when the policies of the job are applied in log
+	// mode to this Namespace, and should be deleted along with the job.
+	CanaryNamespace string
+	// Preaggregated is set when the flows of the job were aggregated into a
+	// table of the job, which should be dropped along with the job.
+	Preaggregated bool
 }
 
 func NewNPRecommendationController(
 	crdClient versioned.Interface,
 	kubeClient kubernetes.Interface,
+	dynamicClient dynamic.Interface,
 	npRecommendationInformer crdv1a1informers.NetworkPolicyRecommendationInformer,
+	resultStore resultstore.Store,
+	maxConcurrentJobs int,
 ) *NPRecommendationController {
+	eventBroadcaster, eventRecorder := controllerutil.NewEventBroadcaster()
 	c := &NPRecommendationController{
 		crdClient:                crdClient,
 		kubeClient:               kubeClient,
+		dynamicClient:            dynamicClient,
 		queue:                    workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(controllerutil.MinRetryDelay, controllerutil.MaxRetryDelay), "npRecommendation"),
 		deletionQueue:            workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(controllerutil.MinRetryDelay, controllerutil.MaxRetryDelay), "npRecommendationCleanup"),
 		gcQueue:                  workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(controllerutil.MinRetryDelay, controllerutil.MaxRetryDelay), "npRecommendationGarbageCollection"),
@@ -101,6 +132,10 @@ func NewNPRecommendationController(
 		npRecommendationLister:   npRecommendationInformer.Lister(),
 		npRecommendationSynced:   npRecommendationInformer.Informer().HasSynced,
 		periodicResyncSet:        make(map[apimachinerytypes.NamespacedName]struct{}),
+		eventBroadcaster:         eventBroadcaster,
+		eventRecorder:            eventRecorder,
+		resultStore:              resultStore,
+		maxConcurrentJobs:        maxConcurrentJobs,
 	}
 
 	c.npRecommendationInformer.AddEventHandlerWithResyncPeriod(
@@ -169,6 +204,10 @@ func (c *NPRecommendationController) deleteNPRecommendation(old interface{}) {
 			Namespace: npReco.Namespace,
 			Id:        npReco.Status.SparkApplication,
 		}
+		if npReco.Status.Canary != nil && npReco.Status.Canary.Phase == crdv1alpha1.NPRecommendationCanaryPhaseSoaking {
+			namespacedId.CanaryNamespace = npReco.Spec.Canary.Namespace
+		}
+		namespacedId.Preaggregated = npReco.Spec.Preaggregate
 		c.deletionQueue.Add(namespacedId)
 	}
 }
@@ -187,6 +226,9 @@ func (c *NPRecommendationController) Run(stopCh <-chan struct{}) {
 		return
 	}
 
+	c.eventBroadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: c.kubeClient.CoreV1().Events("")})
+	defer c.eventBroadcaster.Shutdown()
+
 	c.gcQueue.Add(controllerutil.GcKey{
 		RemoveStaleDbEntries: true,
 		RemoveStaleSparkApp:  true,
@@ -218,13 +260,14 @@ func (c *NPRecommendationController) IfNPRexists(namespace, id string) error {
 func (c *NPRecommendationController) handleStaleResources(key controllerutil.GcKey) (updatedKey controllerutil.GcKey, err error) {
 	var errorList []error
 	if key.AddResync {
-		// Add scheduled/running NPR back to resycn list
-		nprList, err := c.ListNetworkPolicyRecommendation(env.GetTheiaNamespace())
+		// Add queued/scheduled/running NPR back to resycn list
+		nprList, err := c.ListNetworkPolicyRecommendation(env.GetTheiaNamespace(), labels.Everything())
 		if err != nil {
 			errorList = append(errorList, fmt.Errorf("failed to list NetworkPolicyRecommendations: %v", err))
 		} else {
 			for _, npr := range nprList {
-				if npr.Status.State == crdv1alpha1.NPRecommendationStateScheduled || npr.Status.State == crdv1alpha1.NPRecommendationStateRunning {
+				soaking := npr.Status.Canary != nil && npr.Status.Canary.Phase == crdv1alpha1.NPRecommendationCanaryPhaseSoaking
+				if npr.Status.State == crdv1alpha1.NPRecommendationStateQueued || npr.Status.State == crdv1alpha1.NPRecommendationStateScheduled || npr.Status.State == crdv1alpha1.NPRecommendationStateRunning || soaking {
 					c.addPeriodicSync(apimachinerytypes.NamespacedName{
 						Namespace: npr.Namespace,
 						Name:      npr.Name,
@@ -237,6 +280,14 @@ func (c *NPRecommendationController) handleStaleResources(key controllerutil.GcK
 	if key.RemoveStaleDbEntries {
 		err = controllerutil.HandleStaleDbEntries(
 			c.clickhouseConnect, c.kubeClient, "recommendations", "recommendations_local", c.IfNPRexists, "pr-")
+		if err == nil {
+			err = controllerutil.HandleStaleDbEntries(
+				c.clickhouseConnect, c.kubeClient, "recommendation_coverage", "recommendation_coverage_local", c.IfNPRexists, "pr-")
+		}
+		if err == nil {
+			err = controllerutil.HandleStaleDbEntries(
+				c.clickhouseConnect, c.kubeClient, "recommendation_data_window", "recommendation_data_window_local", c.IfNPRexists, "pr-")
+		}
 		if err != nil {
 			errorList = append(errorList, err)
 		} else {
@@ -302,7 +353,7 @@ func (c *NPRecommendationController) processNextDeletionWorkItem() bool {
 		c.queue.Forget(obj)
 		klog.ErrorS(nil, "Expected Spark Application namespaced id in work queue", "got", obj)
 		return true
-	} else if err := c.cleanupNPRecommendation(key.Namespace, key.Id); err == nil {
+	} else if err := c.cleanupNPRecommendation(key.Namespace, key.Id, key.CanaryNamespace, key.Preaggregated); err == nil {
 		// If no error occurs we forget this item so it does not get queued again until
 		// another change happens.
 		c.deletionQueue.Forget(key)
@@ -373,8 +424,8 @@ func (c *NPRecommendationController) syncNPRecommendation(key apimachinerytypes.
 	klog.V(4).Infof("Syncing NP Recommendation", "npReco", npReco)
 
 	switch npReco.Status.State {
-	case "", crdv1alpha1.NPRecommendationStateNew:
-		err = c.startJob(npReco)
+	case "", crdv1alpha1.NPRecommendationStateNew, crdv1alpha1.NPRecommendationStateQueued:
+		err = c.admitJob(npReco)
 	case crdv1alpha1.NPRecommendationStateScheduled:
 		_, err = c.checkSparkApplicationStatus(npReco)
 	case crdv1alpha1.NPRecommendationStateRunning:
@@ -382,23 +433,45 @@ func (c *NPRecommendationController) syncNPRecommendation(key apimachinerytypes.
 	case crdv1alpha1.NPRecommendationStateCompleted:
 		if npReco.Status.EndTime.IsZero() {
 			err = c.finishJob(npReco)
+		} else if npReco.Spec.Canary != nil {
+			err = c.syncCanary(npReco)
 		}
 	}
 	return err
 }
 
-func (c *NPRecommendationController) cleanupNPRecommendation(namespace string, sparkApplicationId string) error {
+func (c *NPRecommendationController) cleanupNPRecommendation(namespace string, sparkApplicationId string, canaryNamespace string, preaggregated bool) error {
 	// Delete the Spark Application if exists
 	DeleteSparkApplication(c.kubeClient, "pr-"+sparkApplicationId, namespace)
-	// Delete the result from the ClickHouse
-	if c.clickhouseConnect == nil {
-		var err error
-		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
-		if err != nil {
+	// Delete the policies applied in log mode if the canary rollout is soaking
+	if canaryNamespace != "" && c.dynamicClient != nil {
+		if err := deleteCanaryPolicies(c.dynamicClient, canaryNamespace, sparkApplicationId); err != nil {
+			return err
+		}
+	}
+	// Drop the aggregated flows if the job did not complete
+	if preaggregated {
+		if err := c.dropPreaggregatedFlows(sparkApplicationId); err != nil {
 			return err
 		}
 	}
+	// Delete the result from the result store
+	if err := c.deleteCopiedResult(sparkApplicationId); err != nil {
+		return err
+	}
+	// Delete the result from the ClickHouse
+	if _, err := c.connectClickHouse(); err != nil {
+		return err
+	}
 	query := "ALTER TABLE recommendations_local ON CLUSTER '{cluster}' DELETE WHERE id = (" + sparkApplicationId + ");"
+	if err := controllerutil.RunClickHouseQuery(c.clickhouseConnect, query, sparkApplicationId); err != nil {
+		return err
+	}
+	query = "ALTER TABLE recommendation_coverage_local ON CLUSTER '{cluster}' DELETE WHERE id = (" + sparkApplicationId + ");"
+	if err := controllerutil.RunClickHouseQuery(c.clickhouseConnect, query, sparkApplicationId); err != nil {
+		return err
+	}
+	query = "ALTER TABLE recommendation_data_window_local ON CLUSTER '{cluster}' DELETE WHERE id = (" + sparkApplicationId + ");"
 	return controllerutil.RunClickHouseQuery(c.clickhouseConnect, query, sparkApplicationId)
 }
 
@@ -420,6 +493,12 @@ func (c *NPRecommendationController) finishJob(npReco *crdv1alpha1.NetworkPolicy
 	}
 	// Delete related SparkApplication CR
 	DeleteSparkApplication(c.kubeClient, "pr-"+npReco.Status.SparkApplication, npReco.Namespace)
+	if npReco.Spec.Preaggregate {
+		if err := c.dropPreaggregatedFlows(npReco.Status.SparkApplication); err != nil {
+			return err
+		}
+	}
+	c.copyResult(npReco)
 	return c.updateNPRecommendationStatus(npReco, crdv1alpha1.NetworkPolicyRecommendationStatus{
 		State:   crdv1alpha1.NPRecommendationStateCompleted,
 		EndTime: metav1.NewTime(time.Now()),
@@ -467,7 +546,17 @@ func (c *NPRecommendationController) checkSparkApplicationStatus(npReco *crdv1al
 	}
 
 	state, errorMessage, err := getPolicyRecommendationStatus(c.kubeClient, npReco.Status.SparkApplication, npReco.Namespace)
-	if err != nil {
+	if apimachineryerrors.IsNotFound(err) {
+		// The Spark Application was deleted while the Theia Manager was not
+		// tracking it, e.g. during a restart, so the job cannot complete.
+		return state, c.updateNPRecommendationStatus(
+			npReco,
+			crdv1alpha1.NetworkPolicyRecommendationStatus{
+				State:    crdv1alpha1.NPRecommendationStateFailed,
+				ErrorMsg: fmt.Sprintf("Spark Application pr-%s of the policy recommendation job is not found", npReco.Status.SparkApplication),
+			},
+		)
+	} else if err != nil {
 		return state, err
 	}
 	klog.V(4).InfoS("Got Spark Application state", "state", state, "NetworkRecommendationPolicy", npReco.Name)
@@ -488,6 +577,13 @@ func (c *NPRecommendationController) checkSparkApplicationStatus(npReco *crdv1al
 			},
 		)
 	} else if state == "FAILED" || state == "SUBMISSION_FAILED" || state == "FAILING" || state == "INVALIDATING" {
+		if npReco.Spec.Preaggregate {
+			// The aggregated flows are dropped again when the job is deleted,
+			// the failure of the job is recorded anyway.
+			if err := c.dropPreaggregatedFlows(npReco.Status.SparkApplication); err != nil {
+				klog.ErrorS(err, "Failed to drop the aggregated flows of the failed job", "NetworkPolicyRecommendation", npReco.Name)
+			}
+		}
 		return state, c.updateNPRecommendationStatus(
 			npReco,
 			crdv1alpha1.NetworkPolicyRecommendationStatus{
@@ -499,6 +595,64 @@ func (c *NPRecommendationController) checkSparkApplicationStatus(npReco *crdv1al
 	return state, nil
 }
 
+// admitJob starts a new or queued job if a job slot is available, and queues
+// it otherwise. The queued jobs are synced periodically, so that they are
+// started as the scheduled and running jobs end.
+func (c *NPRecommendationController) admitJob(npReco *crdv1alpha1.NetworkPolicyRecommendation) error {
+	if c.maxConcurrentJobs <= 0 {
+		return c.startJob(npReco)
+	}
+	c.jobSlotsMutex.Lock()
+	defer c.jobSlotsMutex.Unlock()
+	available, activeJobs, err := c.jobSlotAvailable(npReco)
+	if err != nil {
+		return err
+	}
+	if available {
+		return c.startJob(npReco)
+	}
+	c.addPeriodicSync(apimachinerytypes.NamespacedName{
+		Name:      npReco.Name,
+		Namespace: npReco.Namespace,
+	})
+	if npReco.Status.State == crdv1alpha1.NPRecommendationStateQueued {
+		return nil
+	}
+	klog.InfoS("Queue policy recommendation job", "NetworkPolicyRecommendation", npReco.Name, "activeJobs", activeJobs, "maxConcurrentJobs", c.maxConcurrentJobs)
+	return c.updateNPRecommendationStatus(
+		npReco,
+		crdv1alpha1.NetworkPolicyRecommendationStatus{
+			State: crdv1alpha1.NPRecommendationStateQueued,
+		},
+	)
+}
+
+// jobSlotAvailable returns whether a new or queued job can be started, along
+// with the number of scheduled and running jobs. The jobs waiting to be
+// started are started in order of creation, so a job can only be started if
+// the jobs created before it and the active jobs leave a slot. The jobs are
+// listed from the K8s API rather than from the informer cache, which may not
+// have observed the jobs just started yet.
+func (c *NPRecommendationController) jobSlotAvailable(npReco *crdv1alpha1.NetworkPolicyRecommendation) (bool, int, error) {
+	nprList, err := c.crdClient.CrdV1alpha1().NetworkPolicyRecommendations(npReco.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to list NetworkPolicyRecommendations: %v", err)
+	}
+	activeJobs, waitingBefore := 0, 0
+	for _, npr := range nprList.Items {
+		switch npr.Status.State {
+		case crdv1alpha1.NPRecommendationStateScheduled, crdv1alpha1.NPRecommendationStateRunning:
+			activeJobs++
+		case "", crdv1alpha1.NPRecommendationStateNew, crdv1alpha1.NPRecommendationStateQueued:
+			if npr.CreationTimestamp.Before(&npReco.CreationTimestamp) ||
+				(npr.CreationTimestamp.Equal(&npReco.CreationTimestamp) && npr.Name < npReco.Name) {
+				waitingBefore++
+			}
+		}
+	}
+	return activeJobs+waitingBefore < c.maxConcurrentJobs, activeJobs, nil
+}
+
 func (c *NPRecommendationController) startJob(npReco *crdv1alpha1.NetworkPolicyRecommendation) error {
 	// Validate Cluster readiness
 	if err := controllerutil.ValidateCluster(c.kubeClient, npReco.Namespace); err != nil {
@@ -550,6 +704,15 @@ func (c *NPRecommendationController) startSparkApplication(npReco *crdv1alpha1.N
 	}
 	recoJobArgs = append(recoJobArgs, "--option", strconv.Itoa(policyTypeArg))
 
+	if canary := npReco.Spec.Canary; canary != nil {
+		if c.dynamicClient == nil {
+			return illeagelArguementError{fmt.Errorf("invalid request: %v", errCanaryRolloutsDisabled)}
+		}
+		if err := util.ValidateRecommendationCanary(npReco.Spec.PolicyType, canary.Namespace, canary.SoakWindow.Duration, canary.MaxDeniedFlows); err != nil {
+			return illeagelArguementError{fmt.Errorf("invalid request: %v", err)}
+		}
+	}
+
 	if !npReco.Spec.StartInterval.IsZero() {
 		recoJobArgs = append(recoJobArgs, "--start_time", npReco.Spec.StartInterval.Format(controllerutil.InputTimeFormat))
 	}
@@ -570,6 +733,21 @@ func (c *NPRecommendationController) startSparkApplication(npReco *crdv1alpha1.N
 	recoJobArgs = append(recoJobArgs, "--rm_labels", strconv.FormatBool(npReco.Spec.ExcludeLabels))
 	recoJobArgs = append(recoJobArgs, "--to_services", strconv.FormatBool(npReco.Spec.ToServices))
 
+	if workload := npReco.Spec.Workload; workload != nil {
+		if err := util.ValidateRecommendationWorkload(npReco.Spec.PolicyType, workload.Namespace, workload.PodLabels); err != nil {
+			return illeagelArguementError{fmt.Errorf("invalid request: %v", err)}
+		}
+		workloadArg, err := json.Marshal(map[string]interface{}{
+			"namespace": workload.Namespace,
+			"podLabels": workload.PodLabels,
+		})
+		if err != nil {
+			return illeagelArguementError{fmt.Errorf("invalid request: workload cannot be encoded: %v", err)}
+		}
+		recoJobArgs = append(recoJobArgs, "--workload", string(workloadArg))
+	}
+	recoJobArgs = append(recoJobArgs, controllerutil.GetSparkJobDatabaseArgs(env.GetTheiaNamespace())...)
+
 	sparkResourceArgs := struct {
 		executorInstances   int32
 		driverCoreRequest   string
@@ -613,15 +791,56 @@ func (c *NPRecommendationController) startSparkApplication(npReco *crdv1alpha1.N
 	}
 	recommendationID := npReco.Name[3:]
 	recoJobArgs = append(recoJobArgs, "--id", recommendationID)
+	correlationID := util.GetCorrelationID(npReco.Annotations, recommendationID)
+	recoJobArgs = append(recoJobArgs, "--correlation_id", correlationID)
+
+	// preaggregatedFlows is the number of rows read by the job when the flows
+	// are aggregated beforehand.
+	var preaggregatedFlows *uint64
+	if npReco.Spec.Preaggregate {
+		// The flows are not aggregated again if the Spark Application of the
+		// job already exists, as it may be reading them.
+		if _, err := GetSparkApplication(c.kubeClient, npReco.Name, npReco.Namespace); apimachineryerrors.IsNotFound(err) {
+			_, count, err := c.preaggregateFlows(npReco, recommendationID, correlationID)
+			if err != nil {
+				return err
+			}
+			preaggregatedFlows = &count
+		} else if err != nil {
+			return fmt.Errorf("failed to get Spark Application: %v", err)
+		}
+		recoJobArgs = append(recoJobArgs, "--preaggregated_table", getPreaggregatedTableName(recommendationID))
+	}
+
+	if npReco.Spec.AutoSizeExecutors {
+		var instances int32
+		var memory string
+		var err error
+		if preaggregatedFlows != nil {
+			instances, memory = controllerutil.GetExecutorSize(*preaggregatedFlows)
+		} else {
+			instances, memory, err = c.sizeExecutors(npReco.Spec.StartInterval.Time, npReco.Spec.EndInterval.Time)
+		}
+		if err != nil {
+			// The requested resources are kept when the flow records cannot
+			// be counted, rather than failing the job.
+			klog.ErrorS(err, "Failed to size Spark executors, using the requested resources", "NetworkPolicyRecommendation", npReco.Name, "correlationID", correlationID)
+		} else {
+			sparkResourceArgs.executorInstances = instances
+			sparkResourceArgs.executorMemory = memory
+		}
+	}
+	podLabels := controllerutil.GetSparkPodLabels(recommendationID, npReco.Spec.Submitter, npReco.Spec.Tags)
 	recommendationApplication := &sparkv1.SparkApplication{
 		TypeMeta: metav1.TypeMeta{
-			APIVersion: "sparkoperator.k8s.io/v1beta2",
+			APIVersion: controllerutil.SparkApplicationAPIVersion(),
 			Kind:       "SparkApplication",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      npReco.Name,
-			Namespace: npReco.Namespace,
-			Labels:    sparkAppLabelMap,
+			Name:        npReco.Name,
+			Namespace:   npReco.Namespace,
+			Labels:      getSparkAppLabels(npReco),
+			Annotations: map[string]string{util.CorrelationIDAnnotation: correlationID},
 		},
 		Spec: sparkv1.SparkApplicationSpec{
 			Type:                "Python",
@@ -635,9 +854,7 @@ func (c *NPRecommendationController) startSparkApplication(npReco *crdv1alpha1.N
 				CoreRequest: &npReco.Spec.DriverCoreRequest,
 				SparkPodSpec: sparkv1.SparkPodSpec{
 					Memory: &npReco.Spec.DriverMemory,
-					Labels: map[string]string{
-						"version": controllerutil.SparkVersion,
-					},
+					Labels: podLabels,
 					EnvSecretKeyRefs: map[string]sparkv1.NameKey{
 						"CH_USERNAME": {
 							Name: "clickhouse-secret",
@@ -654,10 +871,8 @@ func (c *NPRecommendationController) startSparkApplication(npReco *crdv1alpha1.N
 			Executor: sparkv1.ExecutorSpec{
 				CoreRequest: &npReco.Spec.ExecutorCoreRequest,
 				SparkPodSpec: sparkv1.SparkPodSpec{
-					Memory: &npReco.Spec.ExecutorMemory,
-					Labels: map[string]string{
-						"version": controllerutil.SparkVersion,
-					},
+					Memory: &sparkResourceArgs.executorMemory,
+					Labels: podLabels,
 					EnvSecretKeyRefs: map[string]sparkv1.NameKey{
 						"CH_USERNAME": {
 							Name: "clickhouse-secret",
@@ -673,22 +888,46 @@ func (c *NPRecommendationController) startSparkApplication(npReco *crdv1alpha1.N
 			},
 		},
 	}
+	controllerutil.SetSparkJobClickHouseTLS(recommendationApplication)
+	startTime := metav1.NewTime(time.Now())
 	err = CreateSparkApplication(c.kubeClient, npReco.Namespace, recommendationApplication)
-	if err != nil {
+	if apimachineryerrors.IsAlreadyExists(err) {
+		// The Theia Manager restarted after creating the Spark Application and
+		// before recording it in the status of the job. The existing Spark
+		// Application is tracked rather than submitted again.
+		klog.InfoS("Resume tracking existing SparkApplication", "id", recommendationID, "NetworkPolicyRecommendation", npReco.Name, "correlationID", correlationID)
+		if sparkApp, err := GetSparkApplication(c.kubeClient, npReco.Name, npReco.Namespace); err == nil && !sparkApp.CreationTimestamp.IsZero() {
+			startTime = sparkApp.CreationTimestamp
+		}
+	} else if err != nil {
 		return fmt.Errorf("failed to create Spark Application: %v", err)
+	} else {
+		klog.InfoS("Start SparkApplication", "id", recommendationID, "NetworkPolicyRecommendation", npReco.Name, "correlationID", correlationID)
 	}
-	klog.V(2).InfoS("Start SparkApplication", "id", recommendationID, "NetworkPolicyRecommendation", npReco.Name)
 
 	return c.updateNPRecommendationStatus(
 		npReco,
 		crdv1alpha1.NetworkPolicyRecommendationStatus{
 			State:            crdv1alpha1.NPRecommendationStateScheduled,
 			SparkApplication: recommendationID,
-			StartTime:        metav1.NewTime(time.Now()),
+			StartTime:        startTime,
 		},
 	)
 }
 
+// sizeExecutors sizes the executors of a Spark job according to the number of
+// flow records between startTime and endTime.
+func (c *NPRecommendationController) sizeExecutors(startTime, endTime time.Time) (int32, string, error) {
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	return controllerutil.SizeExecutors(c.clickhouseConnect, startTime, endTime)
+}
+
 func (c *NPRecommendationController) updateNPRecommendationStatus(npReco *crdv1alpha1.NetworkPolicyRecommendation, status crdv1alpha1.NetworkPolicyRecommendationStatus) error {
 	update := npReco.DeepCopy()
 	update.Status.State = status.State
@@ -710,8 +949,27 @@ func (c *NPRecommendationController) updateNPRecommendationStatus(npReco *crdv1a
 	if !status.EndTime.IsZero() {
 		update.Status.EndTime = status.EndTime
 	}
-	_, err := c.crdClient.CrdV1alpha1().NetworkPolicyRecommendations(npReco.Namespace).UpdateStatus(context.TODO(), update, metav1.UpdateOptions{})
-	return err
+	updated, err := c.crdClient.CrdV1alpha1().NetworkPolicyRecommendations(npReco.Namespace).UpdateStatus(context.TODO(), update, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	if npReco.Status.State != update.Status.State {
+		klog.InfoS("Updated state of NetworkPolicyRecommendation", "name", npReco.Name, "state", update.Status.State, "correlationID", util.GetCorrelationID(npReco.Annotations, update.Status.SparkApplication))
+	}
+	controllerutil.RecordJobStateEvent(c.eventRecorder, updated, "policy recommendation", update.Status.SparkApplication, npReco.Status.State, update.Status.State, update.Status.ErrorMsg)
+	return nil
+}
+
+// getSparkAppLabels returns the labels of the SparkApplication of a job: the
+// labels of the job, so that it can be listed by type and by tag, and the
+// label selecting the SparkApplications of the controller, which takes
+// precedence over a tag with the same key.
+func getSparkAppLabels(npReco *crdv1alpha1.NetworkPolicyRecommendation) map[string]string {
+	sparkAppLabels := util.GetJobLabels(util.JobTypePolicyRecommendation, npReco.Spec.Tags)
+	for key, value := range sparkAppLabelMap {
+		sparkAppLabels[key] = value
+	}
+	return sparkAppLabels
 }
 
 func (c *NPRecommendationController) addPeriodicSync(key apimachinerytypes.NamespacedName) {
@@ -730,8 +988,8 @@ func (c *NPRecommendationController) GetNetworkPolicyRecommendation(namespace, n
 	return c.npRecommendationLister.NetworkPolicyRecommendations(namespace).Get(name)
 }
 
-func (c *NPRecommendationController) ListNetworkPolicyRecommendation(namespace string) ([]*crdv1alpha1.NetworkPolicyRecommendation, error) {
-	return c.npRecommendationLister.NetworkPolicyRecommendations(namespace).List(labels.Everything())
+func (c *NPRecommendationController) ListNetworkPolicyRecommendation(namespace string, selector labels.Selector) ([]*crdv1alpha1.NetworkPolicyRecommendation, error) {
+	return c.npRecommendationLister.NetworkPolicyRecommendations(namespace).List(selector)
 }
 
 func (c *NPRecommendationController) DeleteNetworkPolicyRecommendation(namespace, name string) error {
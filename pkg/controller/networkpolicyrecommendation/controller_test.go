@@ -29,12 +29,17 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	apimachinerytypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
 	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
@@ -70,10 +75,12 @@ func newFakeController(t *testing.T) (*fakeController, *sql.DB) {
 	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, informerDefaultResync)
 	npRecommendationInformer := crdInformerFactory.Crd().V1alpha1().NetworkPolicyRecommendations()
 
-	nprController := NewNPRecommendationController(crdClient, kubeClient, npRecommendationInformer)
+	nprController := NewNPRecommendationController(crdClient, kubeClient, nil, npRecommendationInformer, nil, 0)
 
 	mock.ExpectQuery("SELECT DISTINCT id FROM recommendations;").WillReturnRows(sqlmock.NewRows([]string{}))
 	mock.ExpectExec("ALTER TABLE recommendations_local ON CLUSTER '{cluster}' DELETE WHERE id = (?);").WithArgs(prName[3:]).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE recommendation_coverage_local ON CLUSTER '{cluster}' DELETE WHERE id = (?);").WithArgs(prName[3:]).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("ALTER TABLE recommendation_data_window_local ON CLUSTER '{cluster}' DELETE WHERE id = (?);").WithArgs(prName[3:]).WillReturnResult(sqlmock.NewResult(0, 1))
 	return &fakeController{
 		nprController,
 		crdClient,
@@ -139,9 +146,12 @@ func (f *fakeSparkApplicationClient) create(client kubernetes.Interface, namespa
 		Namespace: namespace,
 		Name:      recommendationApplication.Name,
 	}
-	klog.InfoS("Spark Application created", "name", recommendationApplication.ObjectMeta.Name, "namespace", namespace)
 	f.mapMutex.Lock()
 	defer f.mapMutex.Unlock()
+	if _, ok := f.sparkApplications[namespacedName]; ok {
+		return apimachineryerrors.NewAlreadyExists(schema.GroupResource{Group: "sparkoperator.k8s.io", Resource: "sparkapplications"}, recommendationApplication.Name)
+	}
+	klog.InfoS("Spark Application created", "name", recommendationApplication.ObjectMeta.Name, "namespace", namespace)
 	f.sparkApplications[namespacedName] = recommendationApplication
 	return nil
 }
@@ -156,7 +166,7 @@ func (f *fakeSparkApplicationClient) delete(client kubernetes.Interface, name, n
 	delete(f.sparkApplications, namespacedName)
 }
 
-func (f *fakeSparkApplicationClient) list(client kubernetes.Interface, namespace string) (*v1beta2.SparkApplicationList, error) {
+func (f *fakeSparkApplicationClient) list(client kubernetes.Interface, namespace, label string) (*v1beta2.SparkApplicationList, error) {
 	f.mapMutex.Lock()
 	defer f.mapMutex.Unlock()
 	list := make([]v1beta2.SparkApplication, len(f.sparkApplications))
@@ -178,7 +188,11 @@ func (f *fakeSparkApplicationClient) get(client kubernetes.Interface, name, name
 	}
 	f.mapMutex.Lock()
 	defer f.mapMutex.Unlock()
-	return *f.sparkApplications[namespacedName], nil
+	sa, ok := f.sparkApplications[namespacedName]
+	if !ok {
+		return sparkApp, apimachineryerrors.NewNotFound(schema.GroupResource{Group: "sparkoperator.k8s.io", Resource: "sparkapplications"}, name)
+	}
+	return *sa, nil
 }
 
 func (f *fakeSparkApplicationClient) step(name, namespace string) {
@@ -280,7 +294,7 @@ func TestNPRecommendation(t *testing.T) {
 		assert.Equal(t, 5, npr.Status.TotalStages)
 		assert.True(t, npr.Status.StartTime.Before(&npr.Status.EndTime))
 
-		nprList, err := nprController.ListNetworkPolicyRecommendation(testNamespace)
+		nprList, err := nprController.ListNetworkPolicyRecommendation(testNamespace, labels.Everything())
 		assert.NoError(t, err)
 		assert.Equal(t, 1, len(nprList), "Expected exactly one NetworkPolicyRecommendation, got %d", len(nprList))
 		assert.Equal(t, npr, nprList[0])
@@ -344,6 +358,19 @@ func TestNPRecommendation(t *testing.T) {
 			},
 			expectedErrorMsg: "invalid request: EndInterval should be after StartInterval",
 		},
+		{
+			name:    "invalid Workload",
+			nprName: "npr-invalid-workload",
+			npr: &crdv1alpha1.NetworkPolicyRecommendation{
+				ObjectMeta: metav1.ObjectMeta{Name: "npr-invalid-workload", Namespace: testNamespace},
+				Spec: crdv1alpha1.NetworkPolicyRecommendationSpec{
+					JobType:    "initial",
+					PolicyType: "k8s-np",
+					Workload:   &crdv1alpha1.NetworkPolicyRecommendationWorkload{Namespace: "default"},
+				},
+			},
+			expectedErrorMsg: "invalid request: workload Pod labels should not be empty",
+		},
 		{
 			name:    "invalid ExecutorInstances",
 			nprName: "npr-invalid-executor-instances",
@@ -440,3 +467,186 @@ func TestNPRecommendation(t *testing.T) {
 		})
 	}
 }
+
+func TestNPRecommendationEvents(t *testing.T) {
+	obj := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: prName, Namespace: testNamespace},
+	}
+	crdClient := fakecrd.NewSimpleClientset(obj)
+	recorder := record.NewFakeRecorder(10)
+	c := &NPRecommendationController{crdClient: crdClient, eventRecorder: recorder}
+	id := prName[3:]
+
+	for _, status := range []crdv1alpha1.NetworkPolicyRecommendationStatus{
+		{State: crdv1alpha1.NPRecommendationStateScheduled, SparkApplication: id},
+		{State: crdv1alpha1.NPRecommendationStateRunning},
+		{State: crdv1alpha1.NPRecommendationStateFailed, ErrorMsg: "policy recommendation job failed"},
+	} {
+		assert.NoError(t, c.updateNPRecommendationStatus(obj, status))
+		var err error
+		obj, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), prName, metav1.GetOptions{})
+		assert.NoError(t, err)
+	}
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	assert.Equal(t, []string{
+		"Normal JobSubmitted Submitted policy recommendation job " + id,
+		"Warning JobFailed Failed policy recommendation job " + id + ": policy recommendation job failed",
+	}, events)
+}
+
+// TestStartJobWithExistingSparkApplication covers a restart of the Theia
+// Manager after the Spark Application of a job was created and before the job
+// was marked as scheduled.
+func TestStartJobWithExistingSparkApplication(t *testing.T) {
+	fakeSAClient := fakeSparkApplicationClient{
+		sparkApplications: make(map[apimachinerytypes.NamespacedName]*v1beta2.SparkApplication),
+	}
+	oldCreate, oldGet := CreateSparkApplication, GetSparkApplication
+	CreateSparkApplication = fakeSAClient.create
+	GetSparkApplication = fakeSAClient.get
+	defer func() {
+		CreateSparkApplication, GetSparkApplication = oldCreate, oldGet
+	}()
+
+	nprController, db := newFakeController(t)
+	if db != nil {
+		defer db.Close()
+	}
+	npr := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: prName, Namespace: testNamespace},
+		Spec: crdv1alpha1.NetworkPolicyRecommendationSpec{
+			JobType:             "initial",
+			PolicyType:          "anp-deny-applied",
+			ExecutorInstances:   1,
+			DriverCoreRequest:   "200m",
+			DriverMemory:        "512M",
+			ExecutorCoreRequest: "200m",
+			ExecutorMemory:      "512M",
+		},
+	}
+	npr, err := nprController.crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Create(context.TODO(), npr, metav1.CreateOptions{})
+	require.NoError(t, err)
+	creationTime := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	require.NoError(t, fakeSAClient.create(nil, testNamespace, &v1beta2.SparkApplication{
+		ObjectMeta: metav1.ObjectMeta{Name: prName, Namespace: testNamespace, CreationTimestamp: creationTime},
+	}))
+
+	require.NoError(t, nprController.startJob(npr))
+	npr, err = nprController.crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), prName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, crdv1alpha1.NPRecommendationStateScheduled, npr.Status.State)
+	assert.Equal(t, prName[3:], npr.Status.SparkApplication)
+	assert.True(t, creationTime.Equal(&npr.Status.StartTime))
+	assert.Contains(t, nprController.periodicResyncSet, apimachinerytypes.NamespacedName{Namespace: testNamespace, Name: prName})
+}
+
+func TestJobSlotAvailable(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	newJob := func(name, state string, created time.Time) *crdv1alpha1.NetworkPolicyRecommendation {
+		return &crdv1alpha1.NetworkPolicyRecommendation{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, CreationTimestamp: metav1.NewTime(created)},
+			Status:     crdv1alpha1.NetworkPolicyRecommendationStatus{State: state},
+		}
+	}
+	job := newJob(prName, crdv1alpha1.NPRecommendationStateNew, now)
+	for _, tc := range []struct {
+		name               string
+		maxConcurrentJobs  int
+		jobs               []*crdv1alpha1.NetworkPolicyRecommendation
+		expectedAvailable  bool
+		expectedActiveJobs int
+	}{
+		{
+			name:              "No other job",
+			maxConcurrentJobs: 1,
+			expectedAvailable: true,
+		},
+		{
+			name:              "Slot left by the active jobs",
+			maxConcurrentJobs: 2,
+			jobs: []*crdv1alpha1.NetworkPolicyRecommendation{
+				newJob("pr-running", crdv1alpha1.NPRecommendationStateRunning, now.Add(-time.Hour)),
+				newJob("pr-completed", crdv1alpha1.NPRecommendationStateCompleted, now.Add(-time.Hour)),
+				newJob("pr-failed", crdv1alpha1.NPRecommendationStateFailed, now.Add(-time.Hour)),
+			},
+			expectedAvailable:  true,
+			expectedActiveJobs: 1,
+		},
+		{
+			name:              "Maximum reached by the active jobs",
+			maxConcurrentJobs: 2,
+			jobs: []*crdv1alpha1.NetworkPolicyRecommendation{
+				newJob("pr-running", crdv1alpha1.NPRecommendationStateRunning, now.Add(-time.Hour)),
+				newJob("pr-scheduled", crdv1alpha1.NPRecommendationStateScheduled, now.Add(-time.Minute)),
+			},
+			expectedActiveJobs: 2,
+		},
+		{
+			name:              "Slot taken by a job queued before",
+			maxConcurrentJobs: 2,
+			jobs: []*crdv1alpha1.NetworkPolicyRecommendation{
+				newJob("pr-running", crdv1alpha1.NPRecommendationStateRunning, now.Add(-time.Hour)),
+				newJob("pr-queued", crdv1alpha1.NPRecommendationStateQueued, now.Add(-time.Minute)),
+			},
+			expectedActiveJobs: 1,
+		},
+		{
+			name:              "Slot left by a job queued after",
+			maxConcurrentJobs: 2,
+			jobs: []*crdv1alpha1.NetworkPolicyRecommendation{
+				newJob("pr-running", crdv1alpha1.NPRecommendationStateRunning, now.Add(-time.Hour)),
+				newJob("pr-queued", crdv1alpha1.NPRecommendationStateQueued, now.Add(time.Minute)),
+				newJob("pr-zzz", crdv1alpha1.NPRecommendationStateNew, now),
+			},
+			expectedAvailable:  true,
+			expectedActiveJobs: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			crdClient := fakecrd.NewSimpleClientset(job)
+			for _, npr := range tc.jobs {
+				_, err := crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Create(context.TODO(), npr, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			c := &NPRecommendationController{crdClient: crdClient, maxConcurrentJobs: tc.maxConcurrentJobs}
+			available, activeJobs, err := c.jobSlotAvailable(job)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedAvailable, available)
+			assert.Equal(t, tc.expectedActiveJobs, activeJobs)
+		})
+	}
+}
+
+func TestAdmitJobQueued(t *testing.T) {
+	job := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: prName, Namespace: testNamespace, CreationTimestamp: metav1.Now()},
+	}
+	running := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: "pr-running", Namespace: testNamespace},
+		Status:     crdv1alpha1.NetworkPolicyRecommendationStatus{State: crdv1alpha1.NPRecommendationStateRunning},
+	}
+	crdClient := fakecrd.NewSimpleClientset(job, running)
+	c := &NPRecommendationController{
+		crdClient:         crdClient,
+		eventRecorder:     record.NewFakeRecorder(10),
+		periodicResyncSet: make(map[apimachinerytypes.NamespacedName]struct{}),
+		maxConcurrentJobs: 1,
+	}
+
+	require.NoError(t, c.admitJob(job))
+	job, err := crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), prName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, crdv1alpha1.NPRecommendationStateQueued, job.Status.State)
+	assert.Empty(t, job.Status.SparkApplication)
+	assert.Contains(t, c.periodicResyncSet, apimachinerytypes.NamespacedName{Namespace: testNamespace, Name: prName})
+
+	// The queued job stays queued while the running job is not done.
+	require.NoError(t, c.admitJob(job))
+	job, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), prName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, crdv1alpha1.NPRecommendationStateQueued, job.Status.State)
+}
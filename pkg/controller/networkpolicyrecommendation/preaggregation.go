@@ -0,0 +1,155 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkpolicyrecommendation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	controllerutil "antrea.io/theia/pkg/controller"
+	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/tracing"
+)
+
+const (
+	// preaggregatedTablePrefix prefixes the names of the tables storing the
+	// flows aggregated for a job, followed by the id of the job.
+	preaggregatedTablePrefix = "preaggregated_flows_"
+
+	// preaggregatedFlowColumns are the columns of the flow records read by
+	// the policy recommendation job, which the flows are aggregated by.
+	preaggregatedFlowColumns = `sourcePodNamespace, sourcePodLabels, destinationIP, destinationPodNamespace,
+destinationPodLabels, destinationServicePortName, destinationTransportPort, protocolIdentifier, flowType`
+
+	createPreaggregatedLocalTableQuery = `CREATE TABLE IF NOT EXISTS %s_local ON CLUSTER '{cluster}' (
+    sourcePodNamespace String,
+    sourcePodLabels String,
+    destinationIP String,
+    destinationPodNamespace String,
+    destinationPodLabels String,
+    destinationServicePortName String,
+    destinationTransportPort UInt16,
+    protocolIdentifier UInt8,
+    flowType UInt8,
+    unprotected UInt8,
+    trusted UInt8,
+    flowStartSeconds DateTime,
+    flowEndSeconds DateTime,
+    flowRecords UInt64,
+    nodeNames Array(String)
+) engine=ReplicatedMergeTree('/clickhouse/tables/{shard}/{database}/{table}', '{replica}')
+ORDER BY (sourcePodNamespace, destinationPodNamespace);`
+	createPreaggregatedTableQuery = `CREATE TABLE IF NOT EXISTS %[1]s ON CLUSTER '{cluster}' AS %[1]s_local
+engine=Distributed('{cluster}', %[2]s, %[1]s_local, rand());`
+	truncatePreaggregatedTableQuery = "TRUNCATE TABLE IF EXISTS %s_local ON CLUSTER '{cluster}' SYNC;"
+	// The flows are aggregated with the first and last time they were seen,
+	// their number of flow records and their Nodes, so that the job computes
+	// its data window and its coverage as from the flow records. Only the
+	// unprotected flows and the trusted denied flows are read by the job.
+	insertPreaggregatedFlowsQuery = `INSERT INTO %s
+SELECT %s,
+    ingressNetworkPolicyName == '' AND egressNetworkPolicyName == '' AS unprotected,
+    trusted,
+    min(flowStartSeconds),
+    max(flowEndSeconds),
+    count(),
+    groupUniqArrayArray([sourceNodeName, destinationNodeName])
+FROM flows
+WHERE (unprotected OR trusted == 1)%s
+GROUP BY %s, unprotected, trusted
+SETTINGS insert_distributed_sync = 1, log_comment = '%s';`
+	countPreaggregatedFlowsQuery = "SELECT count() FROM %s SETTINGS log_comment = '%s';"
+	dropPreaggregatedTableQuery  = "DROP TABLE IF EXISTS %s ON CLUSTER '{cluster}' SYNC;"
+)
+
+// getPreaggregatedTableName returns the name of the table storing the flows
+// aggregated for the job with the given id.
+func getPreaggregatedTableName(id string) string {
+	return preaggregatedTablePrefix + strings.ReplaceAll(id, "-", "_")
+}
+
+// preaggregateFlows aggregates the flow records of the time range of a job by
+// source, destination and port into a table of the job, and returns the name
+// of the table and its number of rows. The table replaces the flows table as
+// the input of the job. The correlation ID of the job is the log_comment of
+// the queries reading the flow records, so that they can be found in the
+// query log of ClickHouse.
+func (c *NPRecommendationController) preaggregateFlows(npReco *crdv1alpha1.NetworkPolicyRecommendation, id, correlationID string) (string, uint64, error) {
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	tableName := getPreaggregatedTableName(id)
+	var timeConditions string
+	if !npReco.Spec.StartInterval.IsZero() {
+		timeConditions += fmt.Sprintf(" AND flowStartSeconds >= '%s'", npReco.Spec.StartInterval.Format(controllerutil.InputTimeFormat))
+	}
+	if !npReco.Spec.EndInterval.IsZero() {
+		timeConditions += fmt.Sprintf(" AND flowEndSeconds < '%s'", npReco.Spec.EndInterval.Format(controllerutil.InputTimeFormat))
+	}
+	// The table is emptied first in case the flows were aggregated before the
+	// Spark Application of the job failed to be created.
+	queries := []string{
+		fmt.Sprintf(createPreaggregatedLocalTableQuery, tableName),
+		fmt.Sprintf(createPreaggregatedTableQuery, tableName, clickhouse.GetDatabase()),
+		fmt.Sprintf(truncatePreaggregatedTableQuery, tableName),
+		fmt.Sprintf(insertPreaggregatedFlowsQuery, tableName, preaggregatedFlowColumns, timeConditions, preaggregatedFlowColumns, correlationID),
+	}
+	startTime := time.Now()
+	for _, query := range queries {
+		if err := controllerutil.RunClickHouseQuery(c.clickhouseConnect, query, id); err != nil {
+			return "", 0, fmt.Errorf("failed to aggregate flow records: %v", err)
+		}
+	}
+	var count uint64
+	query := fmt.Sprintf(countPreaggregatedFlowsQuery, tableName, correlationID)
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+	err := clickhouse.RetryOnConnectionError(func() error {
+		return c.clickhouseConnect.QueryRow(query).Scan(&count)
+	})
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to count aggregated flows: %v", err)
+	}
+	klog.V(2).InfoS("Aggregated flow records", "NetworkPolicyRecommendation", npReco.Name, "table", tableName, "flows", count, "duration", time.Since(startTime), "correlationID", correlationID)
+	return tableName, count, nil
+}
+
+// dropPreaggregatedFlows drops the table storing the flows aggregated for the
+// job with the given id, if any.
+func (c *NPRecommendationController) dropPreaggregatedFlows(id string) error {
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return err
+		}
+	}
+	tableName := getPreaggregatedTableName(id)
+	for _, table := range []string{tableName, tableName + "_local"} {
+		if err := controllerutil.RunClickHouseQuery(c.clickhouseConnect, fmt.Sprintf(dropPreaggregatedTableQuery, table), id); err != nil {
+			return fmt.Errorf("failed to drop aggregated flows: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkpolicyrecommendation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachinerytypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	fakecrd "antrea.io/theia/pkg/client/clientset/versioned/fake"
+	crdinformers "antrea.io/theia/pkg/client/informers/externalversions"
+	"antrea.io/theia/pkg/util"
+	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/third_party/sparkoperator/v1beta2"
+)
+
+func TestPreaggregateFlows(t *testing.T) {
+	fakeSAClient := fakeSparkApplicationClient{
+		sparkApplications: make(map[apimachinerytypes.NamespacedName]*v1beta2.SparkApplication),
+	}
+	oldCreate, oldDelete, oldGet := CreateSparkApplication, DeleteSparkApplication, GetSparkApplication
+	CreateSparkApplication = fakeSAClient.create
+	DeleteSparkApplication = fakeSAClient.delete
+	GetSparkApplication = fakeSAClient.get
+	defer func() {
+		CreateSparkApplication, DeleteSparkApplication, GetSparkApplication = oldCreate, oldDelete, oldGet
+	}()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	crdClient := fakecrd.NewSimpleClientset()
+	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, informerDefaultResync)
+	c := NewNPRecommendationController(crdClient, fake.NewSimpleClientset(), nil, crdInformerFactory.Crd().V1alpha1().NetworkPolicyRecommendations(), nil, 0)
+	c.clickhouseConnect = db
+
+	correlationID := "5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c"
+	npReco := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        prName,
+			Namespace:   testNamespace,
+			Annotations: map[string]string{util.CorrelationIDAnnotation: correlationID},
+		},
+		Spec: crdv1alpha1.NetworkPolicyRecommendationSpec{
+			JobType:             "initial",
+			PolicyType:          "anp-deny-applied",
+			StartInterval:       metav1.NewTime(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)),
+			EndInterval:         metav1.NewTime(time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC)),
+			ExecutorInstances:   1,
+			DriverCoreRequest:   "200m",
+			DriverMemory:        "512M",
+			ExecutorCoreRequest: "200m",
+			ExecutorMemory:      "512M",
+			AutoSizeExecutors:   true,
+			Preaggregate:        true,
+		},
+	}
+	npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Create(context.TODO(), npReco, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	tableName := "preaggregated_flows_364a180e_2d83_4502_8063_0c3db36cbcd3"
+	mock.ExpectExec(fmt.Sprintf(createPreaggregatedLocalTableQuery, tableName)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(fmt.Sprintf(createPreaggregatedTableQuery, tableName, clickhouse.GetDatabase())).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(fmt.Sprintf(truncatePreaggregatedTableQuery, tableName)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(fmt.Sprintf(insertPreaggregatedFlowsQuery, tableName, preaggregatedFlowColumns,
+		" AND flowStartSeconds >= '2023-05-01 10:00:00' AND flowEndSeconds < '2023-05-01 11:00:00'", preaggregatedFlowColumns, correlationID)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT count() FROM " + tableName + " SETTINGS log_comment = '" + correlationID + "';").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2000000))
+	require.NoError(t, c.startSparkApplication(npReco))
+
+	sparkApp, err := fakeSAClient.get(nil, prName, testNamespace)
+	require.NoError(t, err)
+	assert.Contains(t, sparkApp.Spec.Arguments, "--preaggregated_table")
+	assert.Contains(t, sparkApp.Spec.Arguments, tableName)
+	assert.Contains(t, sparkApp.Spec.Arguments, correlationID)
+	assert.Equal(t, correlationID, sparkApp.Annotations[util.CorrelationIDAnnotation])
+	// The executors are sized according to the number of aggregated flows.
+	assert.Equal(t, int32(2), *sparkApp.Spec.Executor.Instances)
+	assert.Equal(t, "1G", *sparkApp.Spec.Executor.Memory)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), prName, metav1.GetOptions{})
+	require.NoError(t, err)
+	mock.ExpectExec(fmt.Sprintf(dropPreaggregatedTableQuery, tableName)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(fmt.Sprintf(dropPreaggregatedTableQuery, tableName+"_local")).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, c.finishJob(npReco))
+	npReco, err = crdClient.CrdV1alpha1().NetworkPolicyRecommendations(testNamespace).Get(context.TODO(), prName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, crdv1alpha1.NPRecommendationStateCompleted, npReco.Status.State)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
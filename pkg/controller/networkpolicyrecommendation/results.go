@@ -0,0 +1,82 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkpolicyrecommendation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	"antrea.io/theia/pkg/resultstore"
+	"antrea.io/theia/pkg/util/clickhouse"
+)
+
+// EventReasonResultNotCopied is the reason of the event recorded when the
+// result of a completed job could not be copied to the result store.
+const EventReasonResultNotCopied = "ResultNotCopied"
+
+func (c *NPRecommendationController) connectClickHouse() (*sql.DB, error) {
+	if c.clickhouseConnect == nil {
+		var err error
+		c.clickhouseConnect, err = clickhouse.SetupConnection(c.kubeClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.clickhouseConnect, nil
+}
+
+// copyResult copies the recommended policies of a completed job from
+// ClickHouse to the result store, if any, so that they can still be retrieved
+// after ClickHouse purged them. The job is completed even if the copy fails,
+// as the result can still be retrieved from ClickHouse, and a warning event
+// is recorded instead.
+func (c *NPRecommendationController) copyResult(npReco *crdv1alpha1.NetworkPolicyRecommendation) {
+	if c.resultStore == nil {
+		return
+	}
+	id := npReco.Status.SparkApplication
+	if err := c.saveResult(id); err != nil {
+		klog.ErrorS(err, "Failed to copy the recommendation result", "id", id, "storage", c.resultStore.Name())
+		c.eventRecorder.Eventf(npReco, corev1.EventTypeWarning, EventReasonResultNotCopied, "Failed to copy the result of policy recommendation job %s to the %s storage: %v", id, c.resultStore.Name(), err)
+		return
+	}
+	klog.InfoS("Copied the recommendation result", "id", id, "storage", c.resultStore.Name())
+}
+
+func (c *NPRecommendationController) saveResult(id string) error {
+	policies, err := resultstore.NewClickHouseStore(c.connectClickHouse).List(context.TODO(), id, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read the result from ClickHouse: %v", err)
+	}
+	return c.resultStore.Save(context.TODO(), id, policies)
+}
+
+// deleteCopiedResult deletes the result of a job from the result store, if
+// any.
+func (c *NPRecommendationController) deleteCopiedResult(id string) error {
+	if c.resultStore == nil {
+		return nil
+	}
+	return c.resultStore.Delete(context.TODO(), id)
+}
+
+func (c *NPRecommendationController) GetRecommendationResultStore() resultstore.Store {
+	return c.resultStore
+}
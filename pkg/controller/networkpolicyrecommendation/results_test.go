@@ -0,0 +1,69 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package networkpolicyrecommendation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	fakecrd "antrea.io/theia/pkg/client/clientset/versioned/fake"
+	crdinformers "antrea.io/theia/pkg/client/informers/externalversions"
+	"antrea.io/theia/pkg/resultstore"
+)
+
+func TestCopyResult(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	crdClient := fakecrd.NewSimpleClientset()
+	crdInformerFactory := crdinformers.NewSharedInformerFactory(crdClient, informerDefaultResync)
+	store := resultstore.NewConfigMapStore(fake.NewSimpleClientset(), testNamespace)
+	c := NewNPRecommendationController(crdClient, fake.NewSimpleClientset(), nil, crdInformerFactory.Crd().V1alpha1().NetworkPolicyRecommendations(), store, 0)
+	c.clickhouseConnect = db
+	recorder := record.NewFakeRecorder(1)
+	c.eventRecorder = recorder
+	id := prName[3:]
+	npReco := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: prName, Namespace: testNamespace},
+		Status:     crdv1alpha1.NetworkPolicyRecommendationStatus{SparkApplication: id},
+	}
+	query := "SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy;"
+
+	mock.ExpectQuery(query).WithArgs(id).WillReturnRows(sqlmock.NewRows([]string{"kind", "hash", "policy"}).AddRow("acnp", 10, "policy1"))
+	c.copyResult(npReco)
+	policies, err := store.List(context.TODO(), id, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []resultstore.Policy{{Kind: "acnp", Hash: 10, Policy: "policy1"}}, policies)
+	assert.Same(t, store, c.GetRecommendationResultStore())
+
+	require.NoError(t, c.deleteCopiedResult(id))
+	_, err = store.List(context.TODO(), id, 0, nil)
+	assert.ErrorIs(t, err, resultstore.ErrNotFound)
+
+	// A failure to copy the result is recorded as an event.
+	mock.ExpectQuery(query).WithArgs(id).WillReturnError(fmt.Errorf("connection refused"))
+	c.copyResult(npReco)
+	assert.Equal(t, fmt.Sprintf("Warning ResultNotCopied Failed to copy the result of policy recommendation job %s to the configMap storage: failed to read the result from ClickHouse: failed to get recommendation results with id %s: connection refused", id, id), <-recorder.Events)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,354 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	"antrea.io/theia/pkg/querier"
+	"antrea.io/theia/pkg/util/cron"
+	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/util/format"
+)
+
+const (
+	controllerName = "ReportController"
+	// Kinds of reports.
+	ReportUsage           = "usage"
+	ReportSecurityPosture = "security-posture"
+	ReportPolicyHits      = "policy-hits"
+	// Formats of the rendered reports.
+	FormatHTML = "html"
+	FormatCSV  = "csv"
+	// Types of notifiers.
+	NotifierWebhook      = "webhook"
+	NotifierEmailGateway = "emailGateway"
+	// Maximum number of top talkers in the usage reports.
+	topTalkersLimit = 10
+	// Maximum number of NetworkPolicy rules in the policy-hits reports.
+	policyHitsLimit = 50
+)
+
+// reportKinds lists the kinds of reports.
+var reportKinds = []string{ReportUsage, ReportSecurityPosture, ReportPolicyHits}
+
+// Section is a table of a report.
+type Section struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// Report holds the tables of a report generated for a schedule. The values
+// are rendered for display in HTML reports, and raw in CSV reports so that
+// they can be processed by other programs.
+type Report struct {
+	Name        string
+	Kind        string
+	Window      time.Duration
+	GeneratedAt time.Time
+	Sections    []Section
+}
+
+// Subject returns the subject of the messages delivering the report.
+func (r *Report) Subject() string {
+	return fmt.Sprintf("Theia %s report %s over the last %s, generated at %s", r.Kind, r.Name, format.Duration(r.Window), r.GeneratedAt.UTC().Format("2006-01-02 15:04:05 MST"))
+}
+
+type schedule struct {
+	name      string
+	report    string
+	cron      *cron.Schedule
+	window    time.Duration
+	format    string
+	notifiers []notifier
+}
+
+// ReportController generates the reports configured in the reports section of
+// the theia-manager configuration on their cron schedules, renders them to
+// HTML or CSV, and delivers them to the configured notification integrations,
+// so that the statistics of the flows are received periodically without
+// running the theia CLI.
+type ReportController struct {
+	querier   querier.ClickHouseStatQuerier
+	schedules []*schedule
+}
+
+// ValidateConfig validates the reports configuration, whose defaults must
+// have been set.
+func ValidateConfig(reportsConfig config.ReportsConfig) error {
+	_, err := newSchedules(reportsConfig)
+	return err
+}
+
+func NewReportController(statQuerier querier.ClickHouseStatQuerier, reportsConfig config.ReportsConfig) (*ReportController, error) {
+	schedules, err := newSchedules(reportsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &ReportController{
+		querier:   statQuerier,
+		schedules: schedules,
+	}, nil
+}
+
+func newSchedules(reportsConfig config.ReportsConfig) ([]*schedule, error) {
+	notifiers := make(map[string]notifier)
+	for _, notifierConfig := range reportsConfig.Notifiers {
+		if notifierConfig.Name == "" {
+			return nil, fmt.Errorf("the name of a report notifier should not be empty")
+		}
+		if _, ok := notifiers[notifierConfig.Name]; ok {
+			return nil, fmt.Errorf("duplicate report notifier %s", notifierConfig.Name)
+		}
+		n, err := newNotifier(notifierConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid report notifier %s: %v", notifierConfig.Name, err)
+		}
+		notifiers[notifierConfig.Name] = n
+	}
+	names := sets.New[string]()
+	var schedules []*schedule
+	for _, scheduleConfig := range reportsConfig.Schedules {
+		if scheduleConfig.Name == "" {
+			return nil, fmt.Errorf("the name of a report schedule should not be empty")
+		}
+		if names.Has(scheduleConfig.Name) {
+			return nil, fmt.Errorf("duplicate report schedule %s", scheduleConfig.Name)
+		}
+		names.Insert(scheduleConfig.Name)
+		s, err := newSchedule(scheduleConfig, notifiers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid report schedule %s: %v", scheduleConfig.Name, err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+func newSchedule(scheduleConfig config.ReportScheduleConfig, notifiers map[string]notifier) (*schedule, error) {
+	if !sets.New[string](reportKinds...).Has(scheduleConfig.Report) {
+		return nil, fmt.Errorf("unknown report %q, it should be one of %v", scheduleConfig.Report, reportKinds)
+	}
+	cronSchedule, err := cron.Parse(scheduleConfig.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	window, err := time.ParseDuration(scheduleConfig.Window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window: %v", err)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("window should be a positive duration")
+	}
+	if scheduleConfig.Format != FormatHTML && scheduleConfig.Format != FormatCSV {
+		return nil, fmt.Errorf("unknown format %q, it should be %s or %s", scheduleConfig.Format, FormatHTML, FormatCSV)
+	}
+	if len(scheduleConfig.Notifiers) == 0 {
+		return nil, fmt.Errorf("at least one notifier should be specified")
+	}
+	s := &schedule{
+		name:   scheduleConfig.Name,
+		report: scheduleConfig.Report,
+		cron:   cronSchedule,
+		window: window,
+		format: scheduleConfig.Format,
+	}
+	for _, name := range scheduleConfig.Notifiers {
+		n, ok := notifiers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown notifier %s", name)
+		}
+		s.notifiers = append(s.notifiers, n)
+	}
+	return s, nil
+}
+
+// Run generates and delivers the reports of every schedule until stopCh is
+// closed.
+func (c *ReportController) Run(stopCh <-chan struct{}) {
+	klog.InfoS("Starting controller", "name", controllerName)
+	defer klog.InfoS("Shutting down controller", "name", controllerName)
+
+	for _, s := range c.schedules {
+		go c.runSchedule(s, stopCh)
+	}
+	<-stopCh
+}
+
+func (c *ReportController) runSchedule(s *schedule, stopCh <-chan struct{}) {
+	for {
+		next := s.cron.Next(time.Now().UTC())
+		if next.IsZero() {
+			klog.InfoS("Report schedule is never due", "schedule", s.name)
+			return
+		}
+		klog.V(2).InfoS("Next report", "schedule", s.name, "time", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		c.deliverReport(s, next)
+	}
+}
+
+// deliverReport generates the report of a schedule, renders it and delivers it
+// to the notifiers of the schedule. Failures are logged, and the report is
+// generated again at the next time of the schedule.
+func (c *ReportController) deliverReport(s *schedule, generatedAt time.Time) {
+	report, err := c.generateReport(s, generatedAt)
+	if err != nil {
+		klog.ErrorS(err, "Failed to generate report", "schedule", s.name)
+		return
+	}
+	body, contentType, err := render(report, s.format)
+	if err != nil {
+		klog.ErrorS(err, "Failed to render report", "schedule", s.name)
+		return
+	}
+	for _, n := range s.notifiers {
+		if err := notifyWithRetries(context.TODO(), n, report, contentType, body); err != nil {
+			klog.ErrorS(err, "Failed to deliver report", "schedule", s.name, "notifier", n.name())
+			continue
+		}
+		klog.InfoS("Delivered report", "schedule", s.name, "notifier", n.name())
+	}
+}
+
+func (c *ReportController) generateReport(s *schedule, generatedAt time.Time) (*Report, error) {
+	report := &Report{
+		Name:        s.name,
+		Kind:        s.report,
+		Window:      s.window,
+		GeneratedAt: generatedAt,
+	}
+	printer := format.Printer{Raw: s.format == FormatCSV}
+	var err error
+	switch s.report {
+	case ReportUsage:
+		report.Sections, err = c.generateUsageSections(s.window, printer)
+	case ReportSecurityPosture:
+		report.Sections, err = c.generateSecurityPostureSections(s.window, printer)
+	case ReportPolicyHits:
+		report.Sections, err = c.generatePolicyHitsSections(s.window, printer)
+	default:
+		err = fmt.Errorf("unknown report %q", s.report)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// generateUsageSections reports the disk usage and the tables of ClickHouse,
+// and the traffic classes and the Namespaces with the most traffic over the
+// window.
+func (c *ReportController) generateUsageSections(window time.Duration, printer format.Printer) ([]Section, error) {
+	namespace := env.GetTheiaNamespace()
+	var clickHouseStats stats.ClickHouseStats
+	if err := c.querier.GetDiskInfo(namespace, &clickHouseStats); err != nil {
+		return nil, err
+	}
+	if err := c.querier.GetTableInfo(namespace, &clickHouseStats); err != nil {
+		return nil, err
+	}
+	var flowStats stats.FlowStats
+	if err := c.querier.GetTrafficClasses(namespace, window, stats.FlowResolutionAuto, &flowStats); err != nil {
+		return nil, err
+	}
+	if err := c.querier.GetTopTalkers(namespace, window, stats.FlowResolutionAuto, "", stats.TopTalkersGroupByNamespaces, stats.TopTalkersSortByBytes, topTalkersLimit, &flowStats); err != nil {
+		return nil, err
+	}
+	disks := Section{Title: "Disk usage", Header: []string{"Shard", "DatabaseName", "Path", "Free", "Total", "Used"}}
+	for _, diskInfo := range clickHouseStats.DiskInfos {
+		disks.Rows = append(disks.Rows, []string{diskInfo.Shard, diskInfo.Database, diskInfo.Path, printer.Bytes(diskInfo.FreeSpaceRaw), printer.Bytes(diskInfo.TotalSpaceRaw), printer.Percentage(diskInfo.UsedPercentageRaw)})
+	}
+	tables := Section{Title: "Tables", Header: []string{"Shard", "DatabaseName", "TableName", "TotalRows", "TotalBytes", "TotalCols"}}
+	for _, tableInfo := range clickHouseStats.TableInfos {
+		tables.Rows = append(tables.Rows, []string{tableInfo.Shard, tableInfo.Database, tableInfo.TableName, tableInfo.TotalRows, printer.Bytes(tableInfo.TotalBytesRaw), tableInfo.TotalCols})
+	}
+	trafficClasses := Section{Title: "Traffic classes", Header: []string{"TrafficClass", "Flows", "Bytes"}}
+	for _, trafficClass := range flowStats.TrafficClasses {
+		trafficClasses.Rows = append(trafficClasses.Rows, []string{trafficClass.TrafficClass, trafficClass.Flows, printer.Bytes(trafficClass.Bytes)})
+	}
+	topTalkers := Section{Title: "Top talkers by Namespace", Header: []string{"Source", "Destination", "Flows", "Bytes", "ReverseBytes", "Throughput"}}
+	for _, topTalker := range flowStats.TopTalkers {
+		topTalkers.Rows = append(topTalkers.Rows, []string{topTalker.Source, topTalker.Destination, topTalker.Flows, printer.Bytes(topTalker.Bytes), printer.Bytes(topTalker.ReverseBytes), printer.Rate(topTalker.Throughput)})
+	}
+	return []Section{disks, tables, trafficClasses, topTalkers}, nil
+}
+
+// generateSecurityPostureSections reports the flows over the window which were
+// not protected by any NetworkPolicy and which were denied, in total and by
+// Namespace.
+func (c *ReportController) generateSecurityPostureSections(window time.Duration, printer format.Printer) ([]Section, error) {
+	var flowStats stats.FlowStats
+	if err := c.querier.GetSecurityPosture(env.GetTheiaNamespace(), window, &flowStats); err != nil {
+		return nil, err
+	}
+	header := []string{"Namespace", "Flows", "UnprotectedFlows", "Unprotected", "DeniedFlows"}
+	namespaces := Section{Title: "Namespaces", Header: header}
+	var totalFlows, totalUnprotected, totalDenied int64
+	for _, posture := range flowStats.Posture {
+		flows, _ := strconv.ParseInt(posture.Flows, 10, 64)
+		unprotected, _ := strconv.ParseInt(posture.UnprotectedFlows, 10, 64)
+		denied, _ := strconv.ParseInt(posture.DeniedFlows, 10, 64)
+		totalFlows += flows
+		totalUnprotected += unprotected
+		totalDenied += denied
+		namespaces.Rows = append(namespaces.Rows, []string{posture.Namespace, posture.Flows, posture.UnprotectedFlows, formatRatio(unprotected, flows, printer), posture.DeniedFlows})
+	}
+	summary := Section{Title: "Summary", Header: header, Rows: [][]string{{
+		"Total",
+		strconv.FormatInt(totalFlows, 10),
+		strconv.FormatInt(totalUnprotected, 10),
+		formatRatio(totalUnprotected, totalFlows, printer),
+		strconv.FormatInt(totalDenied, 10),
+	}}}
+	return []Section{summary, namespaces}, nil
+}
+
+// generatePolicyHitsSections reports the NetworkPolicy rules applied to the
+// most flows over the window.
+func (c *ReportController) generatePolicyHitsSections(window time.Duration, printer format.Printer) ([]Section, error) {
+	var flowStats stats.FlowStats
+	if err := c.querier.GetPolicyHits(env.GetTheiaNamespace(), window, policyHitsLimit, &flowStats); err != nil {
+		return nil, err
+	}
+	policyHits := Section{Title: "NetworkPolicy rules", Header: []string{"Direction", "Policy", "Action", "Flows", "Bytes"}}
+	for _, policyHit := range flowStats.PolicyHits {
+		policyHits.Rows = append(policyHits.Rows, []string{policyHit.Direction, policyHit.Policy, policyHit.Action, policyHit.Flows, printer.Bytes(policyHit.Bytes)})
+	}
+	return []Section{policyHits}, nil
+}
+
+// formatRatio returns the percentage of part in total, or N/A if total is 0.
+func formatRatio(part, total int64, printer format.Printer) string {
+	if total == 0 {
+		return "N/A"
+	}
+	return printer.Percentage(strconv.FormatFloat(float64(part)*100/float64(total), 'f', 2, 64))
+}
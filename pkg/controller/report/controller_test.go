@@ -0,0 +1,315 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+)
+
+type fakeQuerier struct {
+	err error
+}
+
+func (q *fakeQuerier) GetDiskInfo(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	clickHouseStats.DiskInfos = []stats.DiskInfo{{Shard: "1", Database: "default", Path: "/var/lib/clickhouse/", FreeSpace: "1.00 GiB", TotalSpace: "2.00 GiB", UsedPercentage: "50.00 %",
+		FreeSpaceRaw: "1073741824", TotalSpaceRaw: "2147483648", UsedPercentageRaw: "50.00"}}
+	return q.err
+}
+func (q *fakeQuerier) GetTableInfo(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	clickHouseStats.TableInfos = []stats.TableInfo{{Shard: "1", Database: "default", TableName: "flows", TotalRows: "1000", TotalBytes: "1.00 KiB", TotalCols: "50", TotalBytesRaw: "1024"}}
+	return nil
+}
+func (q *fakeQuerier) GetInsertRate(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetStackTrace(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetRetentionHistory(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetSystemMetrics(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetSchemaVersion(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetInsertRateLastHour(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetMigrationProgress(namespace string, clickHouseStats *stats.ClickHouseStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetFlowCardinality(namespace string, window time.Duration, trafficClass string, flowStats *stats.FlowStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetTrafficClasses(namespace string, window time.Duration, resolution string, flowStats *stats.FlowStats) error {
+	flowStats.TrafficClasses = []stats.TrafficClassStats{{TrafficClass: "inter-node", Flows: "600", Bytes: "2048"}}
+	return nil
+}
+func (q *fakeQuerier) GetNodeFlows(namespace string, window time.Duration, flowStats *stats.FlowStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetTopTalkers(namespace string, window time.Duration, resolution, trafficClass, groupBy, sortBy string, limit int, flowStats *stats.FlowStats) error {
+	flowStats.TopTalkers = []stats.TopTalkerStats{{Source: "default", Destination: "kube-system", Flows: "10", Bytes: "1024", ReverseBytes: "0", Throughput: "1000"}}
+	return nil
+}
+func (q *fakeQuerier) GetWorkloadFlows(namespace string, window time.Duration, podNamespace, podName string, podLabels map[string]string, limit int, flowStats *stats.FlowStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetPolicyHits(namespace string, window time.Duration, limit int, flowStats *stats.FlowStats) error {
+	flowStats.PolicyHits = []stats.PolicyHitStats{{Direction: "ingress", Policy: "default/allow-client", Action: "Allow", Flows: "600", Bytes: "1024"}}
+	return q.err
+}
+func (q *fakeQuerier) GetSecurityPosture(namespace string, window time.Duration, flowStats *stats.FlowStats) error {
+	flowStats.Posture = []stats.NamespacePostureStats{
+		{Namespace: "default", Flows: "600", UnprotectedFlows: "150", DeniedFlows: "5"},
+		{Namespace: "kube-system", Flows: "400", UnprotectedFlows: "400", DeniedFlows: "0"},
+	}
+	return q.err
+}
+func (q *fakeQuerier) GetPolicyTraffic(namespace string, window time.Duration, flowStats *stats.FlowStats) error {
+	return nil
+}
+func (q *fakeQuerier) GetFlowIntegrity(namespace string, window time.Duration, flowStats *stats.FlowStats) error {
+	return nil
+}
+func (q *fakeQuerier) ExportFlows(namespace string, startTime, endTime time.Time, format string, batchSize int) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func newTestReportsConfig(url string) config.ReportsConfig {
+	return config.ReportsConfig{
+		Notifiers: []config.ReportNotifierConfig{
+			{Name: "hook", Type: NotifierWebhook, URL: url},
+			{Name: "mail", Type: NotifierEmailGateway, URL: url, From: "theia@example.com", To: []string{"ops@example.com"}},
+		},
+		Schedules: []config.ReportScheduleConfig{
+			{Name: "daily-usage", Report: ReportUsage, Schedule: "@daily", Window: "24h", Format: FormatHTML, Notifiers: []string{"hook"}},
+		},
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	testCases := []struct {
+		name             string
+		update           func(c *config.ReportsConfig)
+		expectedErrorMsg string
+	}{
+		{
+			name:   "Valid config",
+			update: func(c *config.ReportsConfig) {},
+		},
+		{
+			name:   "No schedule",
+			update: func(c *config.ReportsConfig) { c.Schedules = nil },
+		},
+		{
+			name:             "Duplicate notifier",
+			update:           func(c *config.ReportsConfig) { c.Notifiers[1].Name = "hook" },
+			expectedErrorMsg: "duplicate report notifier hook",
+		},
+		{
+			name:             "Unknown notifier type",
+			update:           func(c *config.ReportsConfig) { c.Notifiers[0].Type = "slack" },
+			expectedErrorMsg: "invalid report notifier hook: unknown type \"slack\", it should be webhook or emailGateway",
+		},
+		{
+			name:             "Invalid URL",
+			update:           func(c *config.ReportsConfig) { c.Notifiers[0].URL = "example.com/hook" },
+			expectedErrorMsg: "invalid report notifier hook: url \"example.com/hook\" should be an absolute http or https URL",
+		},
+		{
+			name:             "Email gateway without recipients",
+			update:           func(c *config.ReportsConfig) { c.Notifiers[1].To = nil },
+			expectedErrorMsg: "invalid report notifier mail: from and to should be specified for the emailGateway type",
+		},
+		{
+			name: "Duplicate schedule",
+			update: func(c *config.ReportsConfig) {
+				c.Schedules = append(c.Schedules, c.Schedules[0])
+			},
+			expectedErrorMsg: "duplicate report schedule daily-usage",
+		},
+		{
+			name:             "Unknown report",
+			update:           func(c *config.ReportsConfig) { c.Schedules[0].Report = "costs" },
+			expectedErrorMsg: "invalid report schedule daily-usage: unknown report \"costs\"",
+		},
+		{
+			name:             "Invalid cron expression",
+			update:           func(c *config.ReportsConfig) { c.Schedules[0].Schedule = "0 25 * * *" },
+			expectedErrorMsg: "invalid report schedule daily-usage: invalid hour in cron expression",
+		},
+		{
+			name:             "Invalid window",
+			update:           func(c *config.ReportsConfig) { c.Schedules[0].Window = "-1h" },
+			expectedErrorMsg: "invalid report schedule daily-usage: window should be a positive duration",
+		},
+		{
+			name:             "Unknown format",
+			update:           func(c *config.ReportsConfig) { c.Schedules[0].Format = "pdf" },
+			expectedErrorMsg: "invalid report schedule daily-usage: unknown format \"pdf\", it should be html or csv",
+		},
+		{
+			name:             "No notifier",
+			update:           func(c *config.ReportsConfig) { c.Schedules[0].Notifiers = nil },
+			expectedErrorMsg: "invalid report schedule daily-usage: at least one notifier should be specified",
+		},
+		{
+			name:             "Unknown notifier",
+			update:           func(c *config.ReportsConfig) { c.Schedules[0].Notifiers = []string{"pager"} },
+			expectedErrorMsg: "invalid report schedule daily-usage: unknown notifier pager",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reportsConfig := newTestReportsConfig("https://example.com/hook")
+			tc.update(&reportsConfig)
+			err := ValidateConfig(reportsConfig)
+			if tc.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestGenerateReport(t *testing.T) {
+	generatedAt := time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name             string
+		report           string
+		format           string
+		querierErr       error
+		expectedSections []Section
+		expectedErrorMsg string
+	}{
+		{
+			name:   "Usage",
+			report: ReportUsage,
+			format: FormatHTML,
+			expectedSections: []Section{
+				{Title: "Disk usage", Header: []string{"Shard", "DatabaseName", "Path", "Free", "Total", "Used"}, Rows: [][]string{{"1", "default", "/var/lib/clickhouse/", "1.00 GiB", "2.00 GiB", "50.00 %"}}},
+				{Title: "Tables", Header: []string{"Shard", "DatabaseName", "TableName", "TotalRows", "TotalBytes", "TotalCols"}, Rows: [][]string{{"1", "default", "flows", "1000", "1.00 KiB", "50"}}},
+				{Title: "Traffic classes", Header: []string{"TrafficClass", "Flows", "Bytes"}, Rows: [][]string{{"inter-node", "600", "2.00 KiB"}}},
+				{Title: "Top talkers by Namespace", Header: []string{"Source", "Destination", "Flows", "Bytes", "ReverseBytes", "Throughput"}, Rows: [][]string{{"default", "kube-system", "10", "1.00 KiB", "0.00 B", "1.00 KB/s"}}},
+			},
+		},
+		{
+			name:   "Security posture in CSV",
+			report: ReportSecurityPosture,
+			format: FormatCSV,
+			expectedSections: []Section{
+				{Title: "Summary", Header: []string{"Namespace", "Flows", "UnprotectedFlows", "Unprotected", "DeniedFlows"}, Rows: [][]string{{"Total", "1000", "550", "55.00", "5"}}},
+				{Title: "Namespaces", Header: []string{"Namespace", "Flows", "UnprotectedFlows", "Unprotected", "DeniedFlows"}, Rows: [][]string{
+					{"default", "600", "150", "25.00", "5"},
+					{"kube-system", "400", "400", "100.00", "0"},
+				}},
+			},
+		},
+		{
+			name:   "Policy hits",
+			report: ReportPolicyHits,
+			format: FormatHTML,
+			expectedSections: []Section{
+				{Title: "NetworkPolicy rules", Header: []string{"Direction", "Policy", "Action", "Flows", "Bytes"}, Rows: [][]string{{"ingress", "default/allow-client", "Allow", "600", "1.00 KiB"}}},
+			},
+		},
+		{
+			name:             "Querier error",
+			report:           ReportPolicyHits,
+			format:           FormatHTML,
+			querierErr:       fmt.Errorf("error in database"),
+			expectedErrorMsg: "error in database",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &ReportController{querier: &fakeQuerier{err: tc.querierErr}}
+			s := &schedule{name: "test", report: tc.report, window: time.Hour, format: tc.format}
+			report, err := c.generateReport(s, generatedAt)
+			if tc.expectedErrorMsg != "" {
+				assert.EqualError(t, err, tc.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &Report{Name: "test", Kind: tc.report, Window: time.Hour, GeneratedAt: generatedAt, Sections: tc.expectedSections}, report)
+		})
+	}
+}
+
+func TestDeliverReport(t *testing.T) {
+	oldBackoff := deliveryBackoff
+	deliveryBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 2}
+	defer func() { deliveryBackoff = oldBackoff }()
+
+	type request struct {
+		contentType string
+		body        string
+	}
+	var requests []request
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first delivery to check that it is retried.
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{contentType: r.Header.Get("Content-Type"), body: string(body)})
+	}))
+	defer server.Close()
+
+	reportsConfig := newTestReportsConfig(server.URL)
+	reportsConfig.Schedules[0] = config.ReportScheduleConfig{Name: "weekly-hits", Report: ReportPolicyHits, Schedule: "@weekly", Window: "168h", Format: FormatCSV, Notifiers: []string{"hook", "mail"}}
+	c, err := NewReportController(&fakeQuerier{}, reportsConfig)
+	require.NoError(t, err)
+	c.deliverReport(c.schedules[0], time.Date(2023, 5, 7, 0, 0, 0, 0, time.UTC))
+
+	expectedCSV := "NetworkPolicy rules\nDirection,Policy,Action,Flows,Bytes\ningress,default/allow-client,Allow,600,1024\n\n"
+	require.Len(t, requests, 2)
+	assert.Equal(t, request{contentType: contentTypeCSV, body: expectedCSV}, requests[0])
+	assert.Equal(t, "application/json", requests[1].contentType)
+	assert.JSONEq(t, `{
+		"from": "theia@example.com",
+		"to": ["ops@example.com"],
+		"subject": "Theia policy-hits report weekly-hits over the last 168h0m0s, generated at 2023-05-07 00:00:00 UTC",
+		"contentType": "text/csv; charset=utf-8",
+		"body": "NetworkPolicy rules\nDirection,Policy,Action,Flows,Bytes\ningress,default/allow-client,Allow,600,1024\n\n"
+	}`, requests[1].body)
+}
+
+func (q *fakeQuerier) SetColdStorage(namespace, moveAfter string) ([]string, error) {
+	return nil, nil
+}
+
+func (q *fakeQuerier) CreateUser(namespace, name, password, role string) error {
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	config "antrea.io/theia/pkg/config/theiamanager"
+)
+
+const (
+	// Timeout of a single delivery of a report.
+	deliveryTimeout = 30 * time.Second
+	// Maximum number of bytes of the response body included in errors.
+	maxErrorBodySize = 512
+)
+
+// deliveryBackoff is the backoff between the attempts to deliver a report to a
+// notifier. It is a variable so that unit tests can shorten it.
+var deliveryBackoff = wait.Backoff{
+	Duration: 10 * time.Second,
+	Factor:   2,
+	Steps:    3,
+}
+
+// notifier delivers rendered reports to a notification integration.
+type notifier interface {
+	name() string
+	notify(ctx context.Context, report *Report, contentType string, body []byte) error
+}
+
+func newNotifier(notifierConfig config.ReportNotifierConfig) (notifier, error) {
+	if err := validateURL(notifierConfig.URL); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: deliveryTimeout}
+	switch notifierConfig.Type {
+	case NotifierWebhook:
+		return &webhookNotifier{notifierName: notifierConfig.Name, url: notifierConfig.URL, client: client}, nil
+	case NotifierEmailGateway:
+		if notifierConfig.From == "" || len(notifierConfig.To) == 0 {
+			return nil, fmt.Errorf("from and to should be specified for the %s type", NotifierEmailGateway)
+		}
+		return &emailGatewayNotifier{notifierName: notifierConfig.Name, url: notifierConfig.URL, from: notifierConfig.From, to: notifierConfig.To, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q, it should be %s or %s", notifierConfig.Type, NotifierWebhook, NotifierEmailGateway)
+	}
+}
+
+// validateURL checks that the URL of a notifier is an absolute HTTP or HTTPS
+// URL.
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q should be an absolute http or https URL", rawURL)
+	}
+	return nil
+}
+
+// notifyWithRetries delivers a report to a notifier, and retries with
+// deliveryBackoff if the delivery fails.
+func notifyWithRetries(ctx context.Context, n notifier, report *Report, contentType string, body []byte) error {
+	var lastErr error
+	err := wait.ExponentialBackoff(deliveryBackoff, func() (bool, error) {
+		if lastErr = n.notify(ctx, report, contentType, body); lastErr != nil {
+			klog.V(2).InfoS("Failed to deliver report, retrying", "notifier", n.name(), "err", lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// webhookNotifier posts the rendered report as the body of the request, with
+// the name, the kind and the subject of the report as headers.
+type webhookNotifier struct {
+	notifierName string
+	url          string
+	client       *http.Client
+}
+
+func (n *webhookNotifier) name() string {
+	return n.notifierName
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, report *Report, contentType string, body []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("X-Theia-Report-Name", report.Name)
+	header.Set("X-Theia-Report-Kind", report.Kind)
+	header.Set("X-Theia-Report-Subject", report.Subject())
+	return post(ctx, n.client, n.url, header, body)
+}
+
+// emailMessage is the JSON message posted to email gateways.
+type emailMessage struct {
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	Subject     string   `json:"subject"`
+	ContentType string   `json:"contentType"`
+	Body        string   `json:"body"`
+}
+
+// emailGatewayNotifier posts the rendered report as an email message to an
+// email gateway, which sends it to the recipients.
+type emailGatewayNotifier struct {
+	notifierName string
+	url          string
+	from         string
+	to           []string
+	client       *http.Client
+}
+
+func (n *emailGatewayNotifier) name() string {
+	return n.notifierName
+}
+
+func (n *emailGatewayNotifier) notify(ctx context.Context, report *Report, contentType string, body []byte) error {
+	message, err := json.Marshal(emailMessage{
+		From:        n.from,
+		To:          n.to,
+		Subject:     report.Subject(),
+		ContentType: contentType,
+		Body:        string(body),
+	})
+	if err != nil {
+		return fmt.Errorf("error when encoding email message: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return post(ctx, n.client, n.url, header, message)
+}
+
+// post posts a body to a URL, and returns an error if the response status is
+// not 2xx.
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error when creating request: %v", err)
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error when posting report: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return fmt.Errorf("unexpected response status %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
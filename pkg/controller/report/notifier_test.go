@@ -0,0 +1,55 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	config "antrea.io/theia/pkg/config/theiamanager"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	oldBackoff := deliveryBackoff
+	deliveryBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 3}
+	defer func() { deliveryBackoff = oldBackoff }()
+
+	attempts := 0
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		header = r.Header
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	n, err := newNotifier(config.ReportNotifierConfig{Name: "hook", Type: NotifierWebhook, URL: server.URL})
+	require.NoError(t, err)
+	report := &Report{Name: "daily", Kind: ReportUsage, Window: time.Hour, GeneratedAt: time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)}
+	err = notifyWithRetries(context.TODO(), n, report, contentTypeHTML, []byte("<html></html>"))
+	assert.EqualError(t, err, "unexpected response status 401 Unauthorized: invalid token")
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, contentTypeHTML, header.Get("Content-Type"))
+	assert.Equal(t, "daily", header.Get("X-Theia-Report-Name"))
+	assert.Equal(t, ReportUsage, header.Get("X-Theia-Report-Kind"))
+	assert.Equal(t, "Theia usage report daily over the last 1h0m0s, generated at 2023-05-01 08:00:00 UTC", header.Get("X-Theia-Report-Subject"))
+}
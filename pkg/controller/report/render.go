@@ -0,0 +1,84 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+)
+
+const (
+	contentTypeHTML = "text/html; charset=utf-8"
+	contentTypeCSV  = "text/csv; charset=utf-8"
+)
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Subject }}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background-color: #eee; }
+</style>
+</head>
+<body>
+<h1>{{ .Subject }}</h1>
+{{- range .Sections }}
+<h2>{{ .Title }}</h2>
+{{- if .Rows }}
+<table>
+<tr>{{ range .Header }}<th>{{ . }}</th>{{ end }}</tr>
+{{- range .Rows }}
+<tr>{{ range . }}<td>{{ . }}</td>{{ end }}</tr>
+{{- end }}
+</table>
+{{- else }}
+<p>No data during the window</p>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
+
+// render renders a report in the given format, and returns it along with its
+// content type. In CSV, every section is written as a row with its title, a
+// row with its header and its rows, followed by an empty row.
+func render(report *Report, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatHTML:
+		if err := htmlTemplate.Execute(&buf, report); err != nil {
+			return nil, "", fmt.Errorf("error when rendering HTML report: %v", err)
+		}
+		return buf.Bytes(), contentTypeHTML, nil
+	case FormatCSV:
+		w := csv.NewWriter(&buf)
+		for _, section := range report.Sections {
+			records := append([][]string{{section.Title}, section.Header}, section.Rows...)
+			records = append(records, []string{""})
+			if err := w.WriteAll(records); err != nil {
+				return nil, "", fmt.Errorf("error when rendering CSV report: %v", err)
+			}
+		}
+		return buf.Bytes(), contentTypeCSV, nil
+	default:
+		return nil, "", fmt.Errorf("unknown format %q", format)
+	}
+}
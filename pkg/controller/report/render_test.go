@@ -0,0 +1,54 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	report := &Report{
+		Name:        "daily",
+		Kind:        ReportPolicyHits,
+		Window:      24 * time.Hour,
+		GeneratedAt: time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC),
+		Sections: []Section{
+			{Title: "NetworkPolicy rules", Header: []string{"Policy", "Flows"}, Rows: [][]string{{"<script>", "1"}, {"a,b", "2"}}},
+			{Title: "Empty", Header: []string{"Policy"}},
+		},
+	}
+
+	body, contentType, err := render(report, FormatHTML)
+	require.NoError(t, err)
+	assert.Equal(t, contentTypeHTML, contentType)
+	html := string(body)
+	assert.Contains(t, html, "<title>Theia policy-hits report daily over the last 24h0m0s, generated at 2023-05-01 08:00:00 UTC</title>")
+	assert.Contains(t, html, "<h2>NetworkPolicy rules</h2>")
+	assert.Contains(t, html, "<tr><th>Policy</th><th>Flows</th></tr>")
+	assert.Contains(t, html, "<tr><td>&lt;script&gt;</td><td>1</td></tr>")
+	assert.Contains(t, html, "<h2>Empty</h2>\n<p>No data during the window</p>")
+
+	body, contentType, err = render(report, FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, contentTypeCSV, contentType)
+	assert.Equal(t, "NetworkPolicy rules\nPolicy,Flows\n<script>,1\n\"a,b\",2\n\nEmpty\nPolicy\n\n", string(body))
+
+	_, _, err = render(report, "pdf")
+	assert.EqualError(t, err, "unknown format \"pdf\"")
+}
@@ -20,16 +20,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	crdscheme "antrea.io/theia/pkg/client/clientset/versioned/scheme"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	"antrea.io/theia/pkg/util"
 	"antrea.io/theia/pkg/util/clickhouse"
 	"antrea.io/theia/pkg/util/env"
+	"antrea.io/theia/pkg/util/otellog"
+	"antrea.io/theia/pkg/util/tracing"
 	sparkv1 "antrea.io/theia/third_party/sparkoperator/v1beta2"
 )
 
@@ -51,6 +68,27 @@ const (
 	SparkServiceAccount  = "theia-spark"
 	SparkVersion         = "3.1.1"
 	SparkPort            = 4040
+	// Default label selector of the Spark Operator Pods, and API version of
+	// the SparkApplication CRD.
+	DefaultSparkOperatorPodLabelSelector = "app.kubernetes.io/name=spark-operator"
+	DefaultSparkApplicationAPIVersion    = "sparkoperator.k8s.io/v1beta2"
+	// HTTP port of the ClickHouse Service, used by the JDBC driver of Spark jobs
+	ClickHouseHTTPPort = 8123
+	// HTTPS port of the ClickHouse Service, used instead when TLS is enabled
+	ClickHouseHTTPSPort = 8443
+	// Path at which the ClickHouse TLS Secret is mounted in the Pods of Spark
+	// jobs
+	SparkClickHouseTLSPath = "/etc/clickhouse-tls"
+	// Labels added to the driver and executor Pods of Spark jobs, so that
+	// cluster cost tools can attribute the analytics spend.
+	SparkJobIDLabel        = "theia.antrea.io/job-id"
+	SparkJobSubmitterLabel = "theia.antrea.io/submitter"
+	// Component and reasons of the Events recorded on the lifecycle of
+	// Spark jobs.
+	EventComponent          = "theia-manager"
+	EventReasonJobSubmitted = "JobSubmitted"
+	EventReasonJobCompleted = "JobCompleted"
+	EventReasonJobFailed    = "JobFailed"
 )
 
 type GcKey struct {
@@ -62,18 +100,216 @@ type GcKey struct {
 var (
 	ListSparkApplication = ListSparkApplicationWithLabel
 	getSparkJobIds       = GetSparkJobIds
+	emitLog              = otellog.Emit
+)
+
+// The Spark Operator running the Spark jobs, set with SetSparkOperator. An
+// empty Namespace is the Namespace of the jobs.
+var (
+	sparkOperatorNamespace        = ""
+	sparkOperatorPodLabelSelector = DefaultSparkOperatorPodLabelSelector
+	sparkApplicationAPIVersion    = DefaultSparkApplicationAPIVersion
 )
 
 func ConstStrToPointer(constStr string) *string {
 	return &constStr
 }
 
+// NewEventBroadcaster creates the broadcaster of the Events recorded by a
+// controller on its CRs, and the recorder of these Events. The controller
+// starts recording the Events to the K8s API when it runs.
+func NewEventBroadcaster() (record.EventBroadcaster, record.EventRecorder) {
+	eventBroadcaster := record.NewBroadcaster()
+	recorder := eventBroadcaster.NewRecorder(crdscheme.Scheme, corev1.EventSource{Component: EventComponent})
+	return eventBroadcaster, recorder
+}
+
+// RecordJobStateEvent records an Event on the CR of a Spark job when the job
+// is submitted, completes or fails, so that cluster operators notice failed
+// jobs through their Event monitoring. jobType describes the job, e.g. "policy
+// recommendation", and id is the ID of its SparkApplication, which may be
+// empty if the job failed before being submitted. The states of throughput
+// anomaly detection jobs have the same values as the ones of policy
+// recommendation jobs.
+func RecordJobStateEvent(recorder record.EventRecorder, object runtime.Object, jobType, id, oldState, newState, errorMsg string) {
+	if oldState == newState {
+		return
+	}
+	job := jobType + " job"
+	if id != "" {
+		job += " " + id
+	}
+	switch newState {
+	case crdv1alpha1.NPRecommendationStateScheduled:
+		recorder.Eventf(object, corev1.EventTypeNormal, EventReasonJobSubmitted, "Submitted %s", job)
+	case crdv1alpha1.NPRecommendationStateCompleted:
+		recorder.Eventf(object, corev1.EventTypeNormal, EventReasonJobCompleted, "Completed %s", job)
+	case crdv1alpha1.NPRecommendationStateFailed:
+		recorder.Eventf(object, corev1.EventTypeWarning, EventReasonJobFailed, "Failed %s: %s", job, errorMsg)
+	}
+	emitJobStateLog(object, jobType, id, oldState, newState, errorMsg)
+}
+
+// emitJobStateLog exports a state change of a Spark job as an OpenTelemetry
+// log record, if the export of logs is enabled. Unlike the Events, every state
+// change is exported, including the job starting to run.
+func emitJobStateLog(object runtime.Object, jobType, id, oldState, newState, errorMsg string) {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return
+	}
+	attributes := []attribute.KeyValue{
+		attribute.String("theia.job.type", jobType),
+		attribute.String("theia.job.name", accessor.GetName()),
+		attribute.String("k8s.namespace.name", accessor.GetNamespace()),
+		attribute.String("theia.job.id", id),
+		attribute.String("theia.job.state", newState),
+		attribute.String("theia.job.previous_state", oldState),
+		attribute.String("theia.correlation_id", util.GetCorrelationID(accessor.GetAnnotations(), id)),
+	}
+	severity, body := otellog.SeverityInfo, fmt.Sprintf("%s job %s is %s", jobType, accessor.GetName(), newState)
+	if newState == crdv1alpha1.NPRecommendationStateFailed {
+		severity, body = otellog.SeverityWarn, fmt.Sprintf("%s: %s", body, errorMsg)
+		attributes = append(attributes, attribute.String("theia.job.error", errorMsg))
+	}
+	emitLog(otellog.Record{
+		EventName:  "theia.job.state",
+		Severity:   severity,
+		Body:       body,
+		Attributes: attributes,
+	})
+}
+
+// GetSparkPodLabels returns the labels of the driver and executor Pods of a
+// Spark job: the Spark version, the job ID, the submitter of the job and the
+// user-supplied tags. The submitter is sanitized to be a valid label value.
+func GetSparkPodLabels(jobID, submitter string, tags map[string]string) map[string]string {
+	labels := map[string]string{
+		"version":       SparkVersion,
+		SparkJobIDLabel: jobID,
+	}
+	if submitter = sanitizeLabelValue(submitter); submitter != "" {
+		labels[SparkJobSubmitterLabel] = submitter
+	}
+	for key, value := range tags {
+		labels[key] = value
+	}
+	return labels
+}
+
+// GetSparkJobDatabaseArgs returns the arguments of a Spark job to read the flow
+// records from, and to write its result to, the ClickHouse database of the
+// Theia instance running in the given Namespace.
+// The HTTPS port is used if TLS is enabled.
+func GetSparkJobDatabaseArgs(namespace string) []string {
+	port := ClickHouseHTTPPort
+	if clickhouse.GetTLSSecret() != "" {
+		port = ClickHouseHTTPSPort
+	}
+	return []string{
+		"--db_jdbc_url", fmt.Sprintf("jdbc:clickhouse://%s.%s.svc:%d", clickhouse.ServiceName, namespace, port),
+		"--database", clickhouse.GetDatabase(),
+	}
+}
+
+// SetSparkJobClickHouseTLS mounts the ClickHouse TLS Secret in the driver and
+// executor Pods of a Spark job, and sets the CH_TLS_* environment variables
+// with which the job connects to ClickHouse over TLS, presenting the client
+// certificate of the Secret. It does nothing if TLS is disabled.
+func SetSparkJobClickHouseTLS(app *sparkv1.SparkApplication) {
+	secretName := clickhouse.GetTLSSecret()
+	if secretName == "" {
+		return
+	}
+	envVars := map[string]string{
+		"CH_TLS_CA_FILE":              SparkClickHouseTLSPath + "/ca.crt",
+		"CH_TLS_CERT_FILE":            SparkClickHouseTLSPath + "/tls.crt",
+		"CH_TLS_KEY_FILE":             SparkClickHouseTLSPath + "/tls.key",
+		"CH_TLS_INSECURE_SKIP_VERIFY": fmt.Sprint(clickhouse.GetTLSInsecureSkipVerify()),
+	}
+	for _, podSpec := range []*sparkv1.SparkPodSpec{&app.Spec.Driver.SparkPodSpec, &app.Spec.Executor.SparkPodSpec} {
+		// Secrets are mounted by Spark itself, unlike volumes which require
+		// the webhook of the Spark Operator.
+		podSpec.Secrets = append(podSpec.Secrets, sparkv1.SecretInfo{
+			Name: secretName,
+			Path: SparkClickHouseTLSPath,
+			Type: sparkv1.GenericType,
+		})
+		if podSpec.EnvVars == nil {
+			podSpec.EnvVars = map[string]string{}
+		}
+		for key, value := range envVars {
+			podSpec.EnvVars[key] = value
+		}
+	}
+}
+
+// sanitizeLabelValue replaces the characters which are not allowed in a label
+// value, e.g. the ':' of ServiceAccount user names or the '@' of emails, with
+// '_', and truncates the value to the maximum label value length.
+func sanitizeLabelValue(value string) string {
+	sanitized := []byte(value)
+	for i, c := range sanitized {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			sanitized[i] = '_'
+		}
+	}
+	if len(sanitized) > validation.LabelValueMaxLength {
+		sanitized = sanitized[:validation.LabelValueMaxLength]
+	}
+	// Label values must begin and end with an alphanumeric character.
+	return strings.Trim(string(sanitized), "-_.")
+}
+
+// ValidateSparkOperatorConfig checks the label selector of the Spark Operator
+// Pods and the API version of the SparkApplication CRD.
+func ValidateSparkOperatorConfig(operatorConfig config.SparkOperatorConfig) error {
+	if operatorConfig.PodLabelSelector != "" {
+		if _, err := labels.Parse(operatorConfig.PodLabelSelector); err != nil {
+			return fmt.Errorf("invalid podLabelSelector %q: %v", operatorConfig.PodLabelSelector, err)
+		}
+	}
+	if operatorConfig.APIVersion != "" {
+		gv, err := schema.ParseGroupVersion(operatorConfig.APIVersion)
+		if err != nil {
+			return fmt.Errorf("invalid apiVersion %q: %v", operatorConfig.APIVersion, err)
+		}
+		if gv.Group == "" || gv.Version == "" {
+			return fmt.Errorf("invalid apiVersion %q, it should be <group>/<version>", operatorConfig.APIVersion)
+		}
+	}
+	return nil
+}
+
+// SetSparkOperator sets the Spark Operator running the Spark jobs, so that an
+// existing installation, e.g. a cluster-wide one, can be reused. The empty
+// fields keep their default values.
+func SetSparkOperator(operatorConfig config.SparkOperatorConfig) {
+	sparkOperatorNamespace = operatorConfig.Namespace
+	if operatorConfig.PodLabelSelector != "" {
+		sparkOperatorPodLabelSelector = operatorConfig.PodLabelSelector
+	}
+	if operatorConfig.APIVersion != "" {
+		sparkApplicationAPIVersion = operatorConfig.APIVersion
+	}
+}
+
+// SparkApplicationAPIVersion returns the API version of the SparkApplication
+// CRD handled by the Spark Operator.
+func SparkApplicationAPIVersion() string {
+	return sparkApplicationAPIVersion
+}
+
 func ValidateCluster(client kubernetes.Interface, namespace string) error {
 	err := CheckPodByLabel(client, namespace, "app=clickhouse")
 	if err != nil {
 		return fmt.Errorf("failed to find the ClickHouse Pod, please check the deployment, error: %v", err)
 	}
-	err = CheckPodByLabel(client, namespace, "app.kubernetes.io/name=spark-operator")
+	operatorNamespace := sparkOperatorNamespace
+	if operatorNamespace == "" {
+		operatorNamespace = namespace
+	}
+	err = CheckPodByLabel(client, operatorNamespace, sparkOperatorPodLabelSelector)
 	if err != nil {
 		return fmt.Errorf("failed to find the Spark Operator Pod, please check the deployment, error: %v", err)
 	}
@@ -158,8 +394,15 @@ func GetSparkAppProgress(baseUrl string) (completedStages int, totalStages int,
 	return completedStages, totalStages, nil
 }
 
+// RunClickHouseQuery runs the query on ClickHouse. The query is retried while
+// the ClickHouse server is unreachable, e.g. when the ClickHouse Pod restarts.
 func RunClickHouseQuery(connect *sql.DB, query string, id string) (err error) {
-	_, err = connect.Exec(query)
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "exec", query)
+	defer func() { tracing.EndSpan(span, err) }()
+	err = clickhouse.RetryOnConnectionError(func() error {
+		_, err := connect.Exec(query)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("query failed for Spark Application id %s, error: %v", id, err)
 	}
@@ -168,7 +411,14 @@ func RunClickHouseQuery(connect *sql.DB, query string, id string) (err error) {
 
 func GetSparkJobIds(connect *sql.DB, tableName string) ([]string, error) {
 	query := `SELECT DISTINCT id FROM %s;`
-	rows, err := connect.Query(query, tableName)
+	var rows *sql.Rows
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+	err := clickhouse.RetryOnConnectionError(func() error {
+		var err error
+		rows, err = connect.Query(query, tableName)
+		return err
+	})
+	tracing.EndSpan(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from ClickHouse: %v", err)
 	}
@@ -185,9 +435,81 @@ func GetSparkJobIds(connect *sql.DB, tableName string) ([]string, error) {
 	return idList, nil
 }
 
+// executorSize is the number of executors and the memory of each executor
+// of a Spark job reading up to maxFlowRecords flow records.
+type executorSize struct {
+	maxFlowRecords uint64
+	instances      int32
+	memory         string
+}
+
+// executorSizes are sorted by maxFlowRecords. The largest size applies to
+// any number of flow records above the previous ones.
+var executorSizes = []executorSize{
+	{maxFlowRecords: 1000000, instances: 1, memory: "512M"},
+	{maxFlowRecords: 10000000, instances: 2, memory: "1G"},
+	{maxFlowRecords: 50000000, instances: 4, memory: "2G"},
+	{maxFlowRecords: 200000000, instances: 8, memory: "4G"},
+	{maxFlowRecords: math.MaxUint64, instances: 16, memory: "4G"},
+}
+
+// GetExecutorSize returns the number of executors and the memory of each
+// executor of a Spark job reading the given number of flow records.
+func GetExecutorSize(flowRecords uint64) (int32, string) {
+	for _, size := range executorSizes {
+		if flowRecords < size.maxFlowRecords {
+			return size.instances, size.memory
+		}
+	}
+	size := executorSizes[len(executorSizes)-1]
+	return size.instances, size.memory
+}
+
+// CountFlowRecords returns the number of flow records read by a Spark job
+// between startTime and endTime. A zero time leaves the range open on its
+// side, as the jobs do.
+func CountFlowRecords(connect *sql.DB, startTime, endTime time.Time) (count uint64, err error) {
+	query := "SELECT count() FROM flows"
+	var conditions []string
+	var args []interface{}
+	if !startTime.IsZero() {
+		conditions = append(conditions, "flowStartSeconds >= ?")
+		args = append(args, startTime.Format(InputTimeFormat))
+	}
+	if !endTime.IsZero() {
+		conditions = append(conditions, "flowEndSeconds < ?")
+		args = append(args, endTime.Format(InputTimeFormat))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	_, span := tracing.StartClickHouseSpan(context.TODO(), "query", query)
+	defer func() { tracing.EndSpan(span, err) }()
+	err = clickhouse.RetryOnConnectionError(func() error {
+		return connect.QueryRow(query, args...).Scan(&count)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count flow records: %v", err)
+	}
+	return count, nil
+}
+
+// SizeExecutors returns the number of executors and the memory of each
+// executor of a Spark job according to the number of flow records it reads
+// between startTime and endTime.
+func SizeExecutors(connect *sql.DB, startTime, endTime time.Time) (int32, string, error) {
+	flowRecords, err := CountFlowRecords(connect, startTime, endTime)
+	if err != nil {
+		return 0, "", err
+	}
+	instances, memory := GetExecutorSize(flowRecords)
+	klog.V(2).InfoS("Sized Spark executors", "flowRecords", flowRecords, "executorInstances", instances, "executorMemory", memory)
+	return instances, memory, nil
+}
+
 func GetSparkApplication(client kubernetes.Interface, name string, namespace string) (sparkApp sparkv1.SparkApplication, err error) {
 	err = client.CoreV1().RESTClient().Get().
-		AbsPath("/apis/sparkoperator.k8s.io/v1beta2").
+		AbsPath("/apis", sparkApplicationAPIVersion).
 		Namespace(namespace).
 		Resource("sparkapplications").
 		Name(name).
@@ -199,10 +521,14 @@ func GetSparkApplication(client kubernetes.Interface, name string, namespace str
 	return sparkApp, nil
 }
 
-func ListSparkApplicationWithLabel(client kubernetes.Interface, label string) (*sparkv1.SparkApplicationList, error) {
+// ListSparkApplicationWithLabel lists the SparkApplications of a Namespace
+// selected by label, which are filtered by the API server so that the
+// unrelated Spark jobs of the cluster are not retrieved.
+func ListSparkApplicationWithLabel(client kubernetes.Interface, namespace, label string) (*sparkv1.SparkApplicationList, error) {
 	sparkApplicationList := &sparkv1.SparkApplicationList{}
 	err := client.CoreV1().RESTClient().Get().
-		AbsPath("/apis/sparkoperator.k8s.io/v1beta2").
+		AbsPath("/apis", sparkApplicationAPIVersion).
+		Namespace(namespace).
 		Resource("sparkapplications").
 		VersionedParams(&metav1.ListOptions{
 			LabelSelector: label,
@@ -213,22 +539,27 @@ func ListSparkApplicationWithLabel(client kubernetes.Interface, label string) (*
 
 func DeleteSparkApplication(client kubernetes.Interface, name string, namespace string) {
 	client.CoreV1().RESTClient().Delete().
-		AbsPath("/apis/sparkoperator.k8s.io/v1beta2").
+		AbsPath("/apis", sparkApplicationAPIVersion).
 		Namespace(namespace).
 		Resource("sparkapplications").
 		Name(name).
 		Do(context.TODO())
 }
 
-func CreateSparkApplication(client kubernetes.Interface, namespace string, sparkApplication *sparkv1.SparkApplication) error {
+func CreateSparkApplication(client kubernetes.Interface, namespace string, sparkApplication *sparkv1.SparkApplication) (err error) {
+	ctx, span := tracing.StartSpan(context.TODO(), "spark.submit",
+		attribute.String("spark.application.namespace", namespace),
+		attribute.String("spark.application.name", sparkApplication.Name),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
 	response := &sparkv1.SparkApplication{}
 	return client.CoreV1().RESTClient().
 		Post().
-		AbsPath("/apis/sparkoperator.k8s.io/v1beta2").
+		AbsPath("/apis", sparkApplicationAPIVersion).
 		Namespace(namespace).
 		Resource("sparkapplications").
 		Body(sparkApplication).
-		Do(context.TODO()).
+		Do(ctx).
 		Into(response)
 }
 
@@ -270,7 +601,7 @@ func HandleStaleDbEntries(clickhouseConnect *sql.DB, client kubernetes.Interface
 }
 
 func HandleStaleSparkApp(client kubernetes.Interface, sparkAppLabel string, ifResourceExists func(string, string) error) error {
-	saList, err := ListSparkApplication(client, sparkAppLabel)
+	saList, err := ListSparkApplication(client, env.GetTheiaNamespace(), sparkAppLabel)
 	if err != nil {
 		return fmt.Errorf("failed to list Spark Application: %v", err)
 	}
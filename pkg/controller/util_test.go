@@ -15,21 +15,33 @@
 package controller
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
 	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/otellog"
 	sparkv1 "antrea.io/theia/third_party/sparkoperator/v1beta2"
 )
 
@@ -83,7 +95,7 @@ func TestHandleStaleSparkApp(t *testing.T) {
 		name                 string
 		setupClient          func(kubernetes.Interface)
 		mock_arg_func        func(string, string) error
-		ListSparkApplication func(client kubernetes.Interface, sparkAppLabel string) (*sparkv1.SparkApplicationList, error)
+		ListSparkApplication func(client kubernetes.Interface, namespace, sparkAppLabel string) (*sparkv1.SparkApplicationList, error)
 		expectedErrorMsg     string
 	}{
 		{
@@ -91,7 +103,7 @@ func TestHandleStaleSparkApp(t *testing.T) {
 			mock_arg_func: func(str1 string, str2 string) error {
 				return errors.New("mock_error")
 			},
-			ListSparkApplication: func(client kubernetes.Interface, sparkAppLabel string) (*sparkv1.SparkApplicationList, error) {
+			ListSparkApplication: func(client kubernetes.Interface, namespace, sparkAppLabel string) (*sparkv1.SparkApplicationList, error) {
 				return &sparkv1.SparkApplicationList{}, errors.New("mock_error")
 			},
 			expectedErrorMsg: "failed to list Spark Application",
@@ -101,7 +113,7 @@ func TestHandleStaleSparkApp(t *testing.T) {
 			mock_arg_func: func(str1 string, str2 string) error {
 				return errors.New("mock_error")
 			},
-			ListSparkApplication: func(client kubernetes.Interface, sparkAppLabel string) (*sparkv1.SparkApplicationList, error) {
+			ListSparkApplication: func(client kubernetes.Interface, namespace, sparkAppLabel string) (*sparkv1.SparkApplicationList, error) {
 				list := make([]sparkv1.SparkApplication, 1)
 				saList := &sparkv1.SparkApplicationList{
 					Items: list,
@@ -122,8 +134,16 @@ func TestHandleStaleSparkApp(t *testing.T) {
 }
 
 func TestValidateCluster(t *testing.T) {
+	createSparkOperatorPod := func(client kubernetes.Interface, namespace string, labels map[string]string) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "spark-operator", Namespace: namespace, Labels: labels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		client.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	}
 	testCases := []struct {
 		name             string
+		operatorConfig   config.SparkOperatorConfig
 		setupClient      func(kubernetes.Interface)
 		expectedErrorMsg string
 	}{
@@ -140,13 +160,99 @@ func TestValidateCluster(t *testing.T) {
 			},
 			expectedErrorMsg: "failed to find the Spark Operator Pod, please check the deployment",
 		},
+		{
+			name: "spark operator pod found",
+			setupClient: func(client kubernetes.Interface) {
+				db, _ := clickhouse.CreateFakeClickHouse(t, client, testNamespace)
+				db.Close()
+				createSparkOperatorPod(client, testNamespace, map[string]string{"app.kubernetes.io/name": "spark-operator"})
+			},
+		},
+		{
+			name: "cluster-wide spark operator pod found",
+			operatorConfig: config.SparkOperatorConfig{
+				Namespace:        "spark-operator",
+				PodLabelSelector: "app.kubernetes.io/name=spark-operator,app.kubernetes.io/instance=spark",
+			},
+			setupClient: func(client kubernetes.Interface) {
+				db, _ := clickhouse.CreateFakeClickHouse(t, client, testNamespace)
+				db.Close()
+				createSparkOperatorPod(client, "spark-operator", map[string]string{"app.kubernetes.io/name": "spark-operator", "app.kubernetes.io/instance": "spark"})
+			},
+		},
+		{
+			name: "cluster-wide spark operator pod not found in the job namespace",
+			operatorConfig: config.SparkOperatorConfig{
+				Namespace: "spark-operator",
+			},
+			setupClient: func(client kubernetes.Interface) {
+				db, _ := clickhouse.CreateFakeClickHouse(t, client, testNamespace)
+				db.Close()
+				createSparkOperatorPod(client, testNamespace, map[string]string{"app.kubernetes.io/name": "spark-operator"})
+			},
+			expectedErrorMsg: "failed to find the Spark Operator Pod, please check the deployment",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			SetSparkOperator(tc.operatorConfig)
+			defer SetSparkOperator(config.SparkOperatorConfig{
+				PodLabelSelector: DefaultSparkOperatorPodLabelSelector,
+				APIVersion:       DefaultSparkApplicationAPIVersion,
+			})
 			kubeClient := fake.NewSimpleClientset()
 			tc.setupClient(kubeClient)
 			err := ValidateCluster(kubeClient, testNamespace)
-			assert.Contains(t, err.Error(), tc.expectedErrorMsg)
+			if tc.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestValidateSparkOperatorConfig(t *testing.T) {
+	testCases := []struct {
+		name             string
+		operatorConfig   config.SparkOperatorConfig
+		expectedErrorMsg string
+	}{
+		{
+			name: "default config",
+		},
+		{
+			name: "valid config",
+			operatorConfig: config.SparkOperatorConfig{
+				Namespace:        "spark-operator",
+				PodLabelSelector: "app.kubernetes.io/name=spark-operator,app.kubernetes.io/instance=spark",
+				APIVersion:       "sparkoperator.k8s.io/v1beta2",
+			},
+		},
+		{
+			name:             "invalid label selector",
+			operatorConfig:   config.SparkOperatorConfig{PodLabelSelector: "app.kubernetes.io/name in spark-operator"},
+			expectedErrorMsg: "invalid podLabelSelector",
+		},
+		{
+			name:             "API version without group",
+			operatorConfig:   config.SparkOperatorConfig{APIVersion: "v1beta2"},
+			expectedErrorMsg: "it should be <group>/<version>",
+		},
+		{
+			name:             "invalid API version",
+			operatorConfig:   config.SparkOperatorConfig{APIVersion: "sparkoperator.k8s.io/v1beta2/sparkapplications"},
+			expectedErrorMsg: "invalid apiVersion",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateSparkOperatorConfig(tc.operatorConfig)
+			if tc.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+			}
 		})
 	}
 }
@@ -304,3 +410,250 @@ func TestRunClickHouseQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestGetExecutorSize(t *testing.T) {
+	testCases := []struct {
+		flowRecords       uint64
+		expectedInstances int32
+		expectedMemory    string
+	}{
+		{flowRecords: 0, expectedInstances: 1, expectedMemory: "512M"},
+		{flowRecords: 999999, expectedInstances: 1, expectedMemory: "512M"},
+		{flowRecords: 1000000, expectedInstances: 2, expectedMemory: "1G"},
+		{flowRecords: 20000000, expectedInstances: 4, expectedMemory: "2G"},
+		{flowRecords: 100000000, expectedInstances: 8, expectedMemory: "4G"},
+		{flowRecords: 200000000, expectedInstances: 16, expectedMemory: "4G"},
+		{flowRecords: math.MaxUint64, expectedInstances: 16, expectedMemory: "4G"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d flow records", tc.flowRecords), func(t *testing.T) {
+			instances, memory := GetExecutorSize(tc.flowRecords)
+			assert.Equal(t, tc.expectedInstances, instances)
+			assert.Equal(t, tc.expectedMemory, memory)
+		})
+	}
+}
+
+func TestCountFlowRecords(t *testing.T) {
+	startTime := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	endTime := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name             string
+		startTime        time.Time
+		endTime          time.Time
+		expectedQuery    string
+		expectedArgs     []driver.Value
+		expectedErrorMsg string
+	}{
+		{
+			name:          "No time range",
+			expectedQuery: "SELECT count() FROM flows",
+		},
+		{
+			name:          "Time range",
+			startTime:     startTime,
+			endTime:       endTime,
+			expectedQuery: "SELECT count() FROM flows WHERE flowStartSeconds >= ? AND flowEndSeconds < ?",
+			expectedArgs:  []driver.Value{"2023-01-01 00:00:00", "2023-01-02 00:00:00"},
+		},
+		{
+			name:             "Failed to count",
+			expectedQuery:    "SELECT count() FROM flows",
+			expectedErrorMsg: "failed to count flow records",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			assert.NoError(t, err)
+			expected := mock.ExpectQuery(tc.expectedQuery).WithArgs(tc.expectedArgs...)
+			if tc.expectedErrorMsg != "" {
+				expected.WillReturnError(errors.New("mock_error"))
+			} else {
+				expected.WillReturnRows(sqlmock.NewRows([]string{"count()"}).AddRow(uint64(1234)))
+			}
+			count, err := CountFlowRecords(db, tc.startTime, tc.endTime)
+			if tc.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, uint64(1234), count)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetSparkPodLabels(t *testing.T) {
+	testCases := []struct {
+		name           string
+		submitter      string
+		tags           map[string]string
+		expectedLabels map[string]string
+	}{
+		{
+			name:      "Labels with submitter and tags",
+			submitter: "system:serviceaccount:flow-visibility:theia-cli",
+			tags:      map[string]string{"team": "netsec"},
+			expectedLabels: map[string]string{
+				"version":              SparkVersion,
+				SparkJobIDLabel:        "1234abcd",
+				SparkJobSubmitterLabel: "system_serviceaccount_flow-visibility_theia-cli",
+				"team":                 "netsec",
+			},
+		},
+		{
+			name:      "Labels without submitter",
+			submitter: "",
+			expectedLabels: map[string]string{
+				"version":       SparkVersion,
+				SparkJobIDLabel: "1234abcd",
+			},
+		},
+		{
+			name:      "Submitter truncated",
+			submitter: "@" + strings.Repeat("a", 62) + "@b",
+			expectedLabels: map[string]string{
+				"version":              SparkVersion,
+				SparkJobIDLabel:        "1234abcd",
+				SparkJobSubmitterLabel: strings.Repeat("a", 62),
+			},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedLabels, GetSparkPodLabels("1234abcd", tt.submitter, tt.tags))
+		})
+	}
+}
+
+func TestGetSparkJobDatabaseArgs(t *testing.T) {
+	assert.Equal(t, []string{
+		"--db_jdbc_url", "jdbc:clickhouse://clickhouse-clickhouse.flow-visibility.svc:8123",
+		"--database", "default",
+	}, GetSparkJobDatabaseArgs("flow-visibility"))
+
+	t.Setenv("CLICKHOUSE_DATABASE", "theia")
+	assert.Equal(t, []string{
+		"--db_jdbc_url", "jdbc:clickhouse://clickhouse-clickhouse.theia-staging.svc:8123",
+		"--database", "theia",
+	}, GetSparkJobDatabaseArgs("theia-staging"))
+
+	t.Setenv("CLICKHOUSE_TLS_SECRET", "clickhouse-client-tls")
+	assert.Equal(t, []string{
+		"--db_jdbc_url", "jdbc:clickhouse://clickhouse-clickhouse.theia-staging.svc:8443",
+		"--database", "theia",
+	}, GetSparkJobDatabaseArgs("theia-staging"))
+}
+
+func TestSetSparkJobClickHouseTLS(t *testing.T) {
+	app := &sparkv1.SparkApplication{}
+	SetSparkJobClickHouseTLS(app)
+	assert.Equal(t, &sparkv1.SparkApplication{}, app)
+
+	t.Setenv("CLICKHOUSE_TLS_SECRET", "clickhouse-client-tls")
+	t.Setenv("CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY", "true")
+	app = &sparkv1.SparkApplication{
+		Spec: sparkv1.SparkApplicationSpec{
+			Driver: sparkv1.DriverSpec{SparkPodSpec: sparkv1.SparkPodSpec{
+				EnvVars: map[string]string{"FOO": "bar"},
+			}},
+		},
+	}
+	SetSparkJobClickHouseTLS(app)
+	expectedEnvVars := map[string]string{
+		"CH_TLS_CA_FILE":              "/etc/clickhouse-tls/ca.crt",
+		"CH_TLS_CERT_FILE":            "/etc/clickhouse-tls/tls.crt",
+		"CH_TLS_KEY_FILE":             "/etc/clickhouse-tls/tls.key",
+		"CH_TLS_INSECURE_SKIP_VERIFY": "true",
+	}
+	expectedSecrets := []sparkv1.SecretInfo{{Name: "clickhouse-client-tls", Path: "/etc/clickhouse-tls", Type: sparkv1.GenericType}}
+	assert.Equal(t, expectedSecrets, app.Spec.Executor.Secrets)
+	assert.Equal(t, expectedEnvVars, app.Spec.Executor.EnvVars)
+	assert.Equal(t, expectedSecrets, app.Spec.Driver.Secrets)
+	expectedEnvVars["FOO"] = "bar"
+	assert.Equal(t, expectedEnvVars, app.Spec.Driver.EnvVars)
+}
+
+func TestRecordJobStateEvent(t *testing.T) {
+	npr := &crdv1alpha1.NetworkPolicyRecommendation{
+		ObjectMeta: metav1.ObjectMeta{Name: "pr-1234abcd", Namespace: testNamespace},
+	}
+	testCases := []struct {
+		name          string
+		id            string
+		oldState      string
+		newState      string
+		errorMsg      string
+		expectedEvent string
+	}{
+		{
+			name:          "Submitted",
+			id:            "1234abcd",
+			newState:      crdv1alpha1.NPRecommendationStateScheduled,
+			expectedEvent: "Normal JobSubmitted Submitted policy recommendation job 1234abcd",
+		},
+		{
+			name:     "Running",
+			id:       "1234abcd",
+			oldState: crdv1alpha1.NPRecommendationStateScheduled,
+			newState: crdv1alpha1.NPRecommendationStateRunning,
+		},
+		{
+			name:          "Completed",
+			id:            "1234abcd",
+			oldState:      crdv1alpha1.NPRecommendationStateRunning,
+			newState:      crdv1alpha1.NPRecommendationStateCompleted,
+			expectedEvent: "Normal JobCompleted Completed policy recommendation job 1234abcd",
+		},
+		{
+			name:     "Still completed",
+			id:       "1234abcd",
+			oldState: crdv1alpha1.NPRecommendationStateCompleted,
+			newState: crdv1alpha1.NPRecommendationStateCompleted,
+		},
+		{
+			name:          "Failed",
+			id:            "1234abcd",
+			oldState:      crdv1alpha1.NPRecommendationStateRunning,
+			newState:      crdv1alpha1.NPRecommendationStateFailed,
+			errorMsg:      "policy recommendation job failed",
+			expectedEvent: "Warning JobFailed Failed policy recommendation job 1234abcd: policy recommendation job failed",
+		},
+		{
+			name:          "Failed before submission",
+			newState:      crdv1alpha1.NPRecommendationStateFailed,
+			errorMsg:      "invalid request",
+			expectedEvent: "Warning JobFailed Failed policy recommendation job: invalid request",
+		},
+	}
+	defer func() { emitLog = otellog.Emit }()
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []otellog.Record
+			emitLog = func(r otellog.Record) { records = append(records, r) }
+			recorder := record.NewFakeRecorder(1)
+			RecordJobStateEvent(recorder, npr, "policy recommendation", tt.id, tt.oldState, tt.newState, tt.errorMsg)
+			if tt.expectedEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				assert.Equal(t, tt.expectedEvent, <-recorder.Events)
+			}
+			// Every state change is exported as a log record.
+			if tt.oldState == tt.newState {
+				assert.Empty(t, records)
+				return
+			}
+			require.Len(t, records, 1)
+			assert.Equal(t, "theia.job.state", records[0].EventName)
+			assert.Contains(t, records[0].Attributes, attribute.String("theia.job.name", "pr-1234abcd"))
+			assert.Contains(t, records[0].Attributes, attribute.String("theia.job.state", tt.newState))
+			if tt.newState == crdv1alpha1.NPRecommendationStateFailed {
+				assert.Equal(t, otellog.SeverityWarn, records[0].Severity)
+				assert.Contains(t, records[0].Attributes, attribute.String("theia.job.error", tt.errorMsg))
+			} else {
+				assert.Equal(t, otellog.SeverityInfo, records[0].Severity)
+			}
+		})
+	}
+}
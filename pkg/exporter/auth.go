@@ -0,0 +1,107 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "Bearer "
+
+	// Subscribers are authorized with the Kubernetes RBAC, as if they watched
+	// the virtual resource flows of this API group.
+	AuthorizationGroup    = "exporter.theia.antrea.io"
+	AuthorizationResource = "flows"
+	AuthorizationVerb     = "watch"
+)
+
+// authenticate validates the bearer token of the call, e.g. the token of a
+// ServiceAccount, with a TokenReview and returns the user it belongs to.
+func (s *Server) authenticate(ctx context.Context) (*authenticationv1.UserInfo, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(authorizationHeader)) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	header := md.Get(authorizationHeader)[0]
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization header, expected a bearer token")
+	}
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: strings.TrimPrefix(header, bearerPrefix),
+		},
+	}
+	review, err := s.kubeClient.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		klog.ErrorS(err, "Failed to review the bearer token")
+		return nil, status.Error(codes.Unavailable, "failed to review the bearer token")
+	}
+	if !review.Status.Authenticated {
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return &review.Status.User, nil
+}
+
+// authorize checks with SubjectAccessReviews that the user may watch the
+// flows of all the given Namespaces, or of the whole cluster if no Namespace
+// is given.
+func (s *Server) authorize(ctx context.Context, user *authenticationv1.UserInfo, namespaces []string) error {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	for _, namespace := range namespaces {
+		review := &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      AuthorizationVerb,
+					Group:     AuthorizationGroup,
+					Resource:  AuthorizationResource,
+				},
+				User:   user.Username,
+				Groups: user.Groups,
+				UID:    user.UID,
+				Extra:  extra,
+			},
+		}
+		review, err := s.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Failed to review the access to flow records", "user", user.Username)
+			return status.Error(codes.Unavailable, "failed to review the access to flow records")
+		}
+		if !review.Status.Allowed {
+			if namespace == metav1.NamespaceAll {
+				return status.Errorf(codes.PermissionDenied, "user %s cannot watch the flows of the cluster", user.Username)
+			}
+			return status.Errorf(codes.PermissionDenied, "user %s cannot watch the flows of Namespace %s", user.Username, namespace)
+		}
+	}
+	return nil
+}
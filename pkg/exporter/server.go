@@ -0,0 +1,286 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	exporterv1alpha1 "antrea.io/theia/pkg/apis/exporter/v1alpha1"
+	"antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/tracing"
+)
+
+const (
+	// The flows inserted during the last seconds are not streamed yet, as
+	// ClickHouse may still be inserting records with the same timeInserted,
+	// which has a precision of one second.
+	insertionLag = 5 * time.Second
+
+	flowsQuery = `SELECT
+    timeInserted,
+    flowStartSeconds,
+    flowEndSeconds,
+    sourceIP,
+    sourceTransportPort,
+    destinationIP,
+    destinationTransportPort,
+    protocolIdentifier,
+    sourcePodName,
+    sourcePodNamespace,
+    sourcePodLabels,
+    sourceNodeName,
+    destinationPodName,
+    destinationPodNamespace,
+    destinationPodLabels,
+    destinationNodeName,
+    destinationServicePortName,
+    destinationName,
+    destinationNameKind,
+    ingressNetworkPolicyName,
+    ingressNetworkPolicyNamespace,
+    ingressNetworkPolicyRuleName,
+    ingressNetworkPolicyRuleAction,
+    egressNetworkPolicyName,
+    egressNetworkPolicyNamespace,
+    egressNetworkPolicyRuleName,
+    egressNetworkPolicyRuleAction,
+    flowType,
+    packetDeltaCount,
+    octetDeltaCount,
+    throughput,
+    clusterUUID
+FROM flows_enriched
+WHERE timeInserted >= ? AND timeInserted < ?`
+)
+
+var (
+	// Functions to connect to ClickHouse and to get the current time, for unit tests
+	setupClickHouseConnection = clickhouse.SetupConnection
+	now                       = time.Now
+)
+
+// Server implements the FlowExporter gRPC service. Each subscription polls the
+// flows_enriched view of ClickHouse for the records inserted since its last
+// poll, so that consumers do not need credentials of the database.
+type Server struct {
+	exporterv1alpha1.UnimplementedFlowExporterServer
+	kubeClient   kubernetes.Interface
+	pollInterval time.Duration
+
+	connectMutex      sync.Mutex
+	clickhouseConnect *sql.DB
+}
+
+func NewServer(kubeClient kubernetes.Interface, pollInterval time.Duration) *Server {
+	return &Server{
+		kubeClient:   kubeClient,
+		pollInterval: pollInterval,
+	}
+}
+
+func (s *Server) getClickHouseConnection() (*sql.DB, error) {
+	s.connectMutex.Lock()
+	defer s.connectMutex.Unlock()
+	if s.clickhouseConnect == nil {
+		connect, err := setupClickHouseConnection(s.kubeClient)
+		if err != nil {
+			return nil, err
+		}
+		s.clickhouseConnect = connect
+	}
+	return s.clickhouseConnect, nil
+}
+
+// Subscribe streams the flow records matching the request until its end time
+// is reached or the stream is cancelled by the client.
+func (s *Server) Subscribe(req *exporterv1alpha1.SubscribeRequest, stream exporterv1alpha1.FlowExporter_SubscribeServer) error {
+	if err := validateSubscribeRequest(req); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	user, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(stream.Context(), user, req.Namespaces); err != nil {
+		return err
+	}
+	connect, err := s.getClickHouseConnection()
+	if err != nil {
+		klog.ErrorS(err, "Failed to connect to ClickHouse")
+		return status.Error(codes.Unavailable, "failed to connect to ClickHouse")
+	}
+	from := now().Add(-insertionLag).Truncate(time.Second)
+	if req.StartTime != nil {
+		from = req.StartTime.AsTime()
+	}
+	var end time.Time
+	if req.EndTime != nil {
+		end = req.EndTime.AsTime()
+	}
+	klog.V(2).InfoS("Flow record subscription started", "user", user.Username, "namespaces", req.Namespaces, "podNames", req.PodNames, "policyNames", req.PolicyNames, "from", from)
+	ctx := stream.Context()
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		to := now().Add(-insertionLag).Truncate(time.Second)
+		if !end.IsZero() && to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			if err := s.streamFlows(ctx, connect, req, from, to, stream); err != nil {
+				return err
+			}
+			from = to
+		}
+		if !end.IsZero() && !from.Before(end) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// streamFlows sends the flow records inserted in [from, to) which match the
+// request.
+func (s *Server) streamFlows(ctx context.Context, connect *sql.DB, req *exporterv1alpha1.SubscribeRequest, from, to time.Time, stream exporterv1alpha1.FlowExporter_SubscribeServer) error {
+	query, args := buildFlowsQuery(req, from, to)
+	ctx, span := tracing.StartClickHouseSpan(ctx, "query", query)
+	var err error
+	defer func() { tracing.EndSpan(span, err) }()
+	rows, err := connect.QueryContext(ctx, query, args...)
+	if err != nil {
+		klog.ErrorS(err, "Failed to query flow records")
+		return status.Error(codes.Unavailable, "failed to query flow records")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var record *exporterv1alpha1.FlowRecord
+		record, err = scanFlowRecord(rows)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err = stream.Send(record); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		klog.ErrorS(err, "Failed to read flow records")
+		return status.Error(codes.Unavailable, "failed to read flow records")
+	}
+	return nil
+}
+
+func validateSubscribeRequest(req *exporterv1alpha1.SubscribeRequest) error {
+	if req.StartTime != nil {
+		if err := req.StartTime.CheckValid(); err != nil {
+			return fmt.Errorf("invalid start time: %v", err)
+		}
+	}
+	if req.EndTime != nil {
+		if err := req.EndTime.CheckValid(); err != nil {
+			return fmt.Errorf("invalid end time: %v", err)
+		}
+		if req.StartTime != nil && !req.EndTime.AsTime().After(req.StartTime.AsTime()) {
+			return fmt.Errorf("end time should be after start time")
+		}
+	}
+	return nil
+}
+
+// buildFlowsQuery returns the query selecting the flow records inserted in
+// [from, to) which match the filters of the request, and its arguments.
+func buildFlowsQuery(req *exporterv1alpha1.SubscribeRequest, from, to time.Time) (string, []interface{}) {
+	var query strings.Builder
+	query.WriteString(flowsQuery)
+	args := []interface{}{from, to}
+	addFilter := func(values []string, columns ...string) {
+		if len(values) == 0 {
+			return
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		conditions := make([]string, 0, len(columns))
+		for _, column := range columns {
+			conditions = append(conditions, fmt.Sprintf("%s IN (%s)", column, placeholders))
+			for _, value := range values {
+				args = append(args, value)
+			}
+		}
+		fmt.Fprintf(&query, "\nAND (%s)", strings.Join(conditions, " OR "))
+	}
+	addFilter(req.Namespaces, "sourcePodNamespace", "destinationPodNamespace")
+	addFilter(req.PodNames, "sourcePodName", "destinationPodName")
+	addFilter(req.PolicyNames, "ingressNetworkPolicyName", "egressNetworkPolicyName")
+	query.WriteString("\nORDER BY timeInserted")
+	return query.String(), args
+}
+
+func scanFlowRecord(rows *sql.Rows) (*exporterv1alpha1.FlowRecord, error) {
+	var timeInserted, flowStartTime, flowEndTime time.Time
+	record := &exporterv1alpha1.FlowRecord{}
+	if err := rows.Scan(
+		&timeInserted,
+		&flowStartTime,
+		&flowEndTime,
+		&record.SourceIp,
+		&record.SourceTransportPort,
+		&record.DestinationIp,
+		&record.DestinationTransportPort,
+		&record.ProtocolIdentifier,
+		&record.SourcePodName,
+		&record.SourcePodNamespace,
+		&record.SourcePodLabels,
+		&record.SourceNodeName,
+		&record.DestinationPodName,
+		&record.DestinationPodNamespace,
+		&record.DestinationPodLabels,
+		&record.DestinationNodeName,
+		&record.DestinationServicePortName,
+		&record.DestinationName,
+		&record.DestinationNameKind,
+		&record.IngressNetworkPolicyName,
+		&record.IngressNetworkPolicyNamespace,
+		&record.IngressNetworkPolicyRuleName,
+		&record.IngressNetworkPolicyRuleAction,
+		&record.EgressNetworkPolicyName,
+		&record.EgressNetworkPolicyNamespace,
+		&record.EgressNetworkPolicyRuleName,
+		&record.EgressNetworkPolicyRuleAction,
+		&record.FlowType,
+		&record.PacketDeltaCount,
+		&record.OctetDeltaCount,
+		&record.Throughput,
+		&record.ClusterUuid,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan flow record: %v", err)
+	}
+	record.TimeInserted = timestamppb.New(timeInserted)
+	record.FlowStartTime = timestamppb.New(flowStartTime)
+	record.FlowEndTime = timestamppb.New(flowEndTime)
+	return record, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	exporterv1alpha1 "antrea.io/theia/pkg/apis/exporter/v1alpha1"
+	"antrea.io/theia/pkg/util/clickhouse"
+)
+
+const testToken = "test-token"
+
+var flowColumns = []string{
+	"timeInserted", "flowStartSeconds", "flowEndSeconds", "sourceIP", "sourceTransportPort",
+	"destinationIP", "destinationTransportPort", "protocolIdentifier", "sourcePodName",
+	"sourcePodNamespace", "sourcePodLabels", "sourceNodeName", "destinationPodName",
+	"destinationPodNamespace", "destinationPodLabels", "destinationNodeName",
+	"destinationServicePortName", "destinationName", "destinationNameKind",
+	"ingressNetworkPolicyName", "ingressNetworkPolicyNamespace", "ingressNetworkPolicyRuleName",
+	"ingressNetworkPolicyRuleAction", "egressNetworkPolicyName", "egressNetworkPolicyNamespace",
+	"egressNetworkPolicyRuleName", "egressNetworkPolicyRuleAction", "flowType",
+	"packetDeltaCount", "octetDeltaCount", "throughput", "clusterUUID",
+}
+
+// newFakeKubeClient returns a client which authenticates testToken as user
+// "siem" and allows it to watch the flows of the given Namespaces.
+func newFakeKubeClient(allowedNamespaces ...string) kubernetes.Interface {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == testToken {
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "siem"}
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		for _, namespace := range allowedNamespaces {
+			if review.Spec.User == "siem" && attributes.Namespace == namespace &&
+				attributes.Group == AuthorizationGroup && attributes.Resource == AuthorizationResource && attributes.Verb == AuthorizationVerb {
+				review.Status.Allowed = true
+			}
+		}
+		return true, review, nil
+	})
+	return client
+}
+
+func startTestServer(t *testing.T, kubeClient kubernetes.Interface, db *sql.DB) exporterv1alpha1.FlowExporterClient {
+	setupClickHouseConnection = func(client kubernetes.Interface) (*sql.DB, error) {
+		return db, nil
+	}
+	t.Cleanup(func() {
+		setupClickHouseConnection = clickhouse.SetupConnection
+	})
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	exporterv1alpha1.RegisterFlowExporterServer(grpcServer, NewServer(kubeClient, 10*time.Millisecond))
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return exporterv1alpha1.NewFlowExporterClient(conn)
+}
+
+func receiveAll(stream exporterv1alpha1.FlowExporter_SubscribeClient) ([]*exporterv1alpha1.FlowRecord, error) {
+	var records []*exporterv1alpha1.FlowRecord
+	for {
+		record, err := stream.Recv()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	startTime := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	endTime := startTime.Add(time.Minute)
+	now = func() time.Time { return startTime.Add(time.Hour) }
+	defer func() { now = time.Now }()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	rows := sqlmock.NewRows(flowColumns).
+		AddRow(startTime.Add(time.Second), startTime.Add(-time.Minute), startTime, "10.10.0.1", 34567,
+			"10.10.0.2", 80, 6, "client", "default", `{"app":"client"}`, "node-1", "nginx",
+			"default", `{"app":"nginx"}`, "node-2", "", "", "",
+			"allow-nginx", "default", "ingress-0", 1, "", "", "", 0, 2,
+			10, 1000, 8000, "5a8b5c83-6b8a-44e5-a4f1-4b2e3c7e3fd1").
+		AddRow(startTime.Add(2*time.Second), startTime.Add(-time.Minute), startTime, "10.10.0.1", 34568,
+			"93.184.216.34", 443, 6, "client", "default", `{"app":"client"}`, "node-1", "",
+			"", "", "", "", "example.com", "dns",
+			"", "", "", 0, "", "", "", 0, 3,
+			20, 2000, 16000, "5a8b5c83-6b8a-44e5-a4f1-4b2e3c7e3fd1")
+	query := regexp.QuoteMeta(flowsQuery + `
+AND (sourcePodNamespace IN (?) OR destinationPodNamespace IN (?))
+ORDER BY timeInserted`)
+	mock.ExpectQuery(query).WithArgs(startTime, endTime, "default", "default").WillReturnRows(rows)
+
+	client := startTestServer(t, newFakeKubeClient("default"), db)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authorizationHeader, bearerPrefix+testToken)
+	stream, err := client.Subscribe(ctx, &exporterv1alpha1.SubscribeRequest{
+		Namespaces: []string{"default"},
+		StartTime:  timestamppb.New(startTime),
+		EndTime:    timestamppb.New(endTime),
+	})
+	require.NoError(t, err)
+	records, err := receiveAll(stream)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, startTime.Add(time.Second), records[0].TimeInserted.AsTime())
+	assert.Equal(t, "10.10.0.2", records[0].DestinationIp)
+	assert.Equal(t, uint32(80), records[0].DestinationTransportPort)
+	assert.Equal(t, "allow-nginx", records[0].IngressNetworkPolicyName)
+	assert.Equal(t, uint32(1), records[0].IngressNetworkPolicyRuleAction)
+	assert.Equal(t, "example.com", records[1].DestinationName)
+	assert.Equal(t, "dns", records[1].DestinationNameKind)
+	assert.Equal(t, uint64(2000), records[1].OctetDeltaCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	startTime := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name         string
+		token        string
+		request      *exporterv1alpha1.SubscribeRequest
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Missing token",
+			request:      &exporterv1alpha1.SubscribeRequest{},
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "Invalid token",
+			token:        "other-token",
+			request:      &exporterv1alpha1.SubscribeRequest{},
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "Cluster-wide subscription not allowed",
+			token:        testToken,
+			request:      &exporterv1alpha1.SubscribeRequest{},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "Namespace not allowed",
+			token:        testToken,
+			request:      &exporterv1alpha1.SubscribeRequest{Namespaces: []string{"default", "kube-system"}},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:  "End time before start time",
+			token: testToken,
+			request: &exporterv1alpha1.SubscribeRequest{
+				Namespaces: []string{"default"},
+				StartTime:  timestamppb.New(startTime),
+				EndTime:    timestamppb.New(startTime.Add(-time.Minute)),
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			client := startTestServer(t, newFakeKubeClient("default"), db)
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, authorizationHeader, bearerPrefix+tt.token)
+			}
+			stream, err := client.Subscribe(ctx, tt.request)
+			require.NoError(t, err)
+			_, err = receiveAll(stream)
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBuildFlowsQuery(t *testing.T) {
+	from := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(5 * time.Second)
+	query, args := buildFlowsQuery(&exporterv1alpha1.SubscribeRequest{
+		PodNames:    []string{"client", "nginx"},
+		PolicyNames: []string{"allow-nginx"},
+	}, from, to)
+	assert.Equal(t, flowsQuery+`
+AND (sourcePodName IN (?, ?) OR destinationPodName IN (?, ?))
+AND (ingressNetworkPolicyName IN (?) OR egressNetworkPolicyName IN (?))
+ORDER BY timeInserted`, query)
+	assert.Equal(t, []interface{}{from, to, "client", "nginx", "client", "nginx", "allow-nginx", "allow-nginx"}, args)
+}
@@ -15,15 +15,27 @@
 package querier
 
 import (
+	"io"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
 	"antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 	statsV1 "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	config "antrea.io/theia/pkg/config/theiamanager"
+	"antrea.io/theia/pkg/resultstore"
 )
 
 type NPRecommendationQuerier interface {
 	GetNetworkPolicyRecommendation(namespace, name string) (*v1alpha1.NetworkPolicyRecommendation, error)
-	ListNetworkPolicyRecommendation(namespace string) ([]*v1alpha1.NetworkPolicyRecommendation, error)
+	ListNetworkPolicyRecommendation(namespace string, selector labels.Selector) ([]*v1alpha1.NetworkPolicyRecommendation, error)
 	DeleteNetworkPolicyRecommendation(namespace, name string) error
 	CreateNetworkPolicyRecommendation(namespace string, networkPolicyRecommendation *v1alpha1.NetworkPolicyRecommendation) (*v1alpha1.NetworkPolicyRecommendation, error)
+	// GetRecommendationResultStore returns the store to which the results of
+	// the completed jobs are copied, or nil if they are only stored in
+	// ClickHouse.
+	GetRecommendationResultStore() resultstore.Store
 }
 
 type ClickHouseStatQuerier interface {
@@ -31,6 +43,23 @@ type ClickHouseStatQuerier interface {
 	GetTableInfo(namespace string, stats *statsV1.ClickHouseStats) error
 	GetInsertRate(namespace string, stats *statsV1.ClickHouseStats) error
 	GetStackTrace(namespace string, stats *statsV1.ClickHouseStats) error
+	GetRetentionHistory(namespace string, stats *statsV1.ClickHouseStats) error
+	GetSystemMetrics(namespace string, stats *statsV1.ClickHouseStats) error
+	GetSchemaVersion(namespace string, stats *statsV1.ClickHouseStats) error
+	GetInsertRateLastHour(namespace string, stats *statsV1.ClickHouseStats) error
+	GetMigrationProgress(namespace string, stats *statsV1.ClickHouseStats) error
+	GetFlowCardinality(namespace string, window time.Duration, trafficClass string, stats *statsV1.FlowStats) error
+	GetTrafficClasses(namespace string, window time.Duration, resolution string, stats *statsV1.FlowStats) error
+	GetNodeFlows(namespace string, window time.Duration, stats *statsV1.FlowStats) error
+	GetTopTalkers(namespace string, window time.Duration, resolution, trafficClass, groupBy, sortBy string, limit int, stats *statsV1.FlowStats) error
+	GetWorkloadFlows(namespace string, window time.Duration, podNamespace, podName string, podLabels map[string]string, limit int, stats *statsV1.FlowStats) error
+	GetPolicyHits(namespace string, window time.Duration, limit int, stats *statsV1.FlowStats) error
+	GetSecurityPosture(namespace string, window time.Duration, stats *statsV1.FlowStats) error
+	GetPolicyTraffic(namespace string, window time.Duration, stats *statsV1.FlowStats) error
+	GetFlowIntegrity(namespace string, window time.Duration, stats *statsV1.FlowStats) error
+	ExportFlows(namespace string, startTime, endTime time.Time, format string, batchSize int) (io.ReadCloser, error)
+	SetColdStorage(namespace, moveAfter string) ([]string, error)
+	CreateUser(namespace, name, password, role string) error
 }
 
 type ThroughputAnomalyDetectorQuerier interface {
@@ -39,3 +68,11 @@ type ThroughputAnomalyDetectorQuerier interface {
 	DeleteThroughputAnomalyDetector(namespace, name string) error
 	CreateThroughputAnomalyDetector(namespace string, anomalydetector *v1alpha1.ThroughputAnomalyDetector) (*v1alpha1.ThroughputAnomalyDetector, error)
 }
+
+type AnalyticsJobQuerier interface {
+	ListJobTemplates() []config.JobTemplateConfig
+	GetAnalyticsJob(namespace, name string) (*intelligence.AnalyticsJob, error)
+	ListAnalyticsJob(namespace string) ([]*intelligence.AnalyticsJob, error)
+	DeleteAnalyticsJob(namespace, name string) error
+	CreateAnalyticsJob(namespace string, job *intelligence.AnalyticsJob) error
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resultstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"antrea.io/theia/pkg/util/tracing"
+)
+
+// ClickHouseStore reads the results from the recommendations table of
+// ClickHouse, to which the jobs write them.
+type ClickHouseStore struct {
+	// connect returns the connection to ClickHouse, which is set up on first
+	// use.
+	connect func() (*sql.DB, error)
+}
+
+func NewClickHouseStore(connect func() (*sql.DB, error)) *ClickHouseStore {
+	return &ClickHouseStore{connect: connect}
+}
+
+func (s *ClickHouseStore) Name() string {
+	return StorageClickHouse
+}
+
+// Save is not supported, as the results are written to ClickHouse by the jobs.
+func (s *ClickHouseStore) Save(ctx context.Context, id string, policies []Policy) error {
+	return fmt.Errorf("the results are written to ClickHouse by the recommendation jobs")
+}
+
+// List never returns ErrNotFound, as a job which recommended no policy has no
+// rows either.
+func (s *ClickHouseStore) List(ctx context.Context, id string, limit int64, cursor *Cursor) ([]Policy, error) {
+	var query string
+	args := []interface{}{id}
+	if cursor == nil {
+		query = "SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy"
+	} else {
+		// The policies with the same kind and hash as cursor are read
+		// again, and the ones up to cursor are skipped.
+		query = "SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) AND (kind, hash) >= ((?), (?)) ORDER BY kind, hash, policy"
+		args = append(args, cursor.Kind, cursor.Hash)
+	}
+	if limit > 0 {
+		query += " LIMIT (?)"
+		if cursor != nil {
+			args = append(args, limit+cursor.Index+1)
+		} else {
+			args = append(args, limit)
+		}
+	}
+	query += ";"
+	connect, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	_, span := tracing.StartClickHouseSpan(ctx, "query", query)
+	rows, err := connect.Query(query, args...)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recommendation results with id %s: %v", id, err)
+	}
+	defer rows.Close()
+	var policies []Policy
+	for rows.Next() {
+		var policy Policy
+		if err := rows.Scan(&policy.Kind, &policy.Hash, &policy.Policy); err != nil {
+			return nil, fmt.Errorf("failed to scan recommendation results: %v", err)
+		}
+		policies = append(policies, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		policies = skipCursor(policies, cursor)
+	}
+	if limit > 0 && int64(len(policies)) > limit {
+		policies = policies[:limit]
+	}
+	return policies, nil
+}
+
+// Delete does nothing, as the results are deleted from ClickHouse along with
+// the other data of the job by the NetworkPolicyRecommendation controller.
+func (s *ClickHouseStore) Delete(ctx context.Context, id string) error {
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resultstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClickHouseStoreList(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	store := NewClickHouseStore(func() (*sql.DB, error) { return db, nil })
+	columns := []string{"kind", "hash", "policy"}
+
+	mock.ExpectQuery("SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy;").WithArgs("job-1").WillReturnRows(
+		sqlmock.NewRows(columns).AddRow("acnp", 10, "policy1").AddRow("anp", 30, "policy3"))
+	policies, err := store.List(context.TODO(), "job-1", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{{Kind: "acnp", Hash: 10, Policy: "policy1"}, {Kind: "anp", Hash: 30, Policy: "policy3"}}, policies)
+
+	mock.ExpectQuery("SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) AND (kind, hash) >= ((?), (?)) ORDER BY kind, hash, policy LIMIT (?);").WithArgs("job-1", "acnp", 10, 2).WillReturnRows(
+		sqlmock.NewRows(columns).AddRow("acnp", 10, "policy1").AddRow("anp", 30, "policy3"))
+	policies, err = store.List(context.TODO(), "job-1", 1, &Cursor{Kind: "acnp", Hash: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{{Kind: "anp", Hash: 30, Policy: "policy3"}}, policies)
+
+	// The policies with the same kind and hash are paged with the index of
+	// the cursor, without skipping or repeating any of them.
+	duplicates := func() *sqlmock.Rows {
+		return sqlmock.NewRows(columns).AddRow("acnp", 10, "policy1").AddRow("acnp", 10, "policy1").AddRow("acnp", 10, "policy1").AddRow("anp", 30, "policy3")
+	}
+	mock.ExpectQuery("SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy LIMIT (?);").WithArgs("job-1", 2).WillReturnRows(duplicates())
+	policies, err = store.List(context.TODO(), "job-1", 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{{Kind: "acnp", Hash: 10, Policy: "policy1"}, {Kind: "acnp", Hash: 10, Policy: "policy1"}}, policies)
+	cursor := NextCursor(nil, policies)
+	assert.Equal(t, &Cursor{Kind: "acnp", Hash: 10, Index: 1}, cursor)
+	mock.ExpectQuery("SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) AND (kind, hash) >= ((?), (?)) ORDER BY kind, hash, policy LIMIT (?);").WithArgs("job-1", "acnp", 10, 4).WillReturnRows(duplicates())
+	policies, err = store.List(context.TODO(), "job-1", 2, cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{{Kind: "acnp", Hash: 10, Policy: "policy1"}, {Kind: "anp", Hash: 30, Policy: "policy3"}}, policies)
+
+	mock.ExpectQuery("SELECT kind, cityHash64(policy) AS hash, policy FROM recommendations WHERE id = (?) ORDER BY kind, hash, policy;").WithArgs("job-2").WillReturnError(fmt.Errorf("connection refused"))
+	_, err = store.List(context.TODO(), "job-2", 0, nil)
+	assert.EqualError(t, err, "failed to get recommendation results with id job-2: connection refused")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Error(t, store.Save(context.TODO(), "job-1", nil))
+}
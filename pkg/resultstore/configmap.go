@@ -0,0 +1,110 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resultstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// The key of the ConfigMap data holding the policies, as a JSON list.
+	configMapPoliciesKey = "policies.json"
+	// The label of the ConfigMaps holding the id of their job.
+	configMapIDLabel = "theia.antrea.io/recommendation-id"
+	// The size of the data of a ConfigMap cannot exceed 1 MiB.
+	maxConfigMapDataSize = 1024 * 1024
+)
+
+// ConfigMapStore stores the result of every job in a ConfigMap named
+// recommendation-result-<id>.
+type ConfigMapStore struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+}
+
+func NewConfigMapStore(kubeClient kubernetes.Interface, namespace string) *ConfigMapStore {
+	return &ConfigMapStore{kubeClient: kubeClient, namespace: namespace}
+}
+
+func configMapName(id string) string {
+	return "recommendation-result-" + id
+}
+
+func (s *ConfigMapStore) Name() string {
+	return StorageConfigMap
+}
+
+func (s *ConfigMapStore) Save(ctx context.Context, id string, policies []Policy) error {
+	if policies == nil {
+		policies = []Policy{}
+	}
+	data, err := json.Marshal(policies)
+	if err != nil {
+		return fmt.Errorf("error when encoding the recommendation result: %v", err)
+	}
+	if len(data) > maxConfigMapDataSize {
+		return fmt.Errorf("the recommendation result of %d bytes exceeds the maximum size of a ConfigMap", len(data))
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName(id),
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				"app":            "theia-manager",
+				configMapIDLabel: id,
+			},
+		},
+		Data: map[string]string{configMapPoliciesKey: string(data)},
+	}
+	_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("error when saving the recommendation result to ConfigMap %s: %v", configMap.Name, err)
+	}
+	return nil
+}
+
+func (s *ConfigMapStore) List(ctx context.Context, id string, limit int64, cursor *Cursor) ([]Policy, error) {
+	configMap, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, configMapName(id), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error when getting the recommendation result from ConfigMap %s: %v", configMapName(id), err)
+	}
+	var policies []Policy
+	if err := json.Unmarshal([]byte(configMap.Data[configMapPoliciesKey]), &policies); err != nil {
+		return nil, fmt.Errorf("error when decoding the recommendation result of ConfigMap %s: %v", configMapName(id), err)
+	}
+	sortPolicies(policies)
+	return page(policies, limit, cursor), nil
+}
+
+func (s *ConfigMapStore) Delete(ctx context.Context, id string) error {
+	err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Delete(ctx, configMapName(id), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error when deleting ConfigMap %s: %v", configMapName(id), err)
+	}
+	return nil
+}
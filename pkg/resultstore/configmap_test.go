@@ -0,0 +1,86 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resultstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testPolicies = []Policy{
+	{Kind: "knp", Hash: 5, Policy: "policy5"},
+	{Kind: "acnp", Hash: 20, Policy: "policy2"},
+	{Kind: "acnp", Hash: 10, Policy: "policy1"},
+	{Kind: "anp", Hash: 30, Policy: "policy3"},
+}
+
+func TestConfigMapStore(t *testing.T) {
+	ctx := context.TODO()
+	kubeClient := fake.NewSimpleClientset()
+	store := NewConfigMapStore(kubeClient, "flow-visibility")
+
+	_, err := store.List(ctx, "job-1", 0, nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.Save(ctx, "job-1", testPolicies[:2]))
+	// Saving the result again replaces the one stored before.
+	require.NoError(t, store.Save(ctx, "job-1", testPolicies))
+	configMap, err := kubeClient.CoreV1().ConfigMaps("flow-visibility").Get(ctx, "recommendation-result-job-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", configMap.Labels[configMapIDLabel])
+
+	policies, err := store.List(ctx, "job-1", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{testPolicies[2], testPolicies[1], testPolicies[3], testPolicies[0]}, policies)
+	policies, err = store.List(ctx, "job-1", 2, &Cursor{Kind: "acnp", Hash: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{testPolicies[1], testPolicies[3]}, policies)
+	policies, err = store.List(ctx, "job-1", 2, &Cursor{Kind: "knp", Hash: 5})
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+
+	// A job which recommended no policy has an empty result.
+	require.NoError(t, store.Save(ctx, "job-2", nil))
+	policies, err = store.List(ctx, "job-2", 0, nil)
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+
+	// The policies with the same kind and hash are sorted by yaml, and
+	// paged with the index of the cursor.
+	duplicates := []Policy{testPolicies[2], testPolicies[2], {Kind: "acnp", Hash: 10, Policy: "policy0"}, testPolicies[3]}
+	require.NoError(t, store.Save(ctx, "job-3", duplicates))
+	policies, err = store.List(ctx, "job-3", 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{duplicates[2], duplicates[0]}, policies)
+	cursor := NextCursor(nil, policies)
+	assert.Equal(t, &Cursor{Kind: "acnp", Hash: 10, Index: 1}, cursor)
+	policies, err = store.List(ctx, "job-3", 2, cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{duplicates[1], duplicates[3]}, policies)
+
+	require.NoError(t, store.Delete(ctx, "job-1"))
+	require.NoError(t, store.Delete(ctx, "job-1"))
+	_, err = store.List(ctx, "job-1", 0, nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = store.Save(ctx, "job-3", []Policy{{Kind: "acnp", Policy: strings.Repeat("a", maxConfigMapDataSize)}})
+	assert.ErrorContains(t, err, "exceeds the maximum size of a ConfigMap")
+}
@@ -0,0 +1,244 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resultstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	config "antrea.io/theia/pkg/config/theiamanager"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	// Timeout of a single request to the S3 endpoint.
+	s3RequestTimeout = 30 * time.Second
+	// Maximum number of bytes of the response body included in errors.
+	maxS3ErrorBodySize = 512
+	// The layouts of the dates of the AWS Signature Version 4.
+	amzDateLayout  = "20060102T150405Z"
+	amzShortLayout = "20060102"
+)
+
+// s3Store stores the result of every job as a JSON object named <prefix><id>.json
+// in an S3 bucket. The requests are addressed path-style, which is supported
+// by AWS and by the S3-compatible servers, e.g. MinIO, and signed with the AWS
+// Signature Version 4, using the credentials of the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type s3Store struct {
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	prefix          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	client          *http.Client
+	// now returns the time at which the requests are signed. It is a field so
+	// that unit tests can set it.
+	now func() time.Time
+}
+
+func newS3Store(s3Config config.RecommendationResultsS3Config) (*s3Store, error) {
+	endpoint, err := url.Parse(s3Config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("the S3 endpoint %q should be an absolute http or https URL", s3Config.Endpoint)
+	}
+	if s3Config.Bucket == "" {
+		return nil, fmt.Errorf("the S3 bucket should be specified")
+	}
+	store := &s3Store{
+		endpoint:        endpoint,
+		region:          s3Config.Region,
+		bucket:          s3Config.Bucket,
+		prefix:          s3Config.Prefix,
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		client:          &http.Client{Timeout: s3RequestTimeout},
+		now:             time.Now,
+	}
+	if store.region == "" {
+		store.region = defaultS3Region
+	}
+	if store.accessKeyID == "" || store.secretAccessKey == "" {
+		return nil, fmt.Errorf("the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables should be set for the S3 storage")
+	}
+	return store, nil
+}
+
+func (s *s3Store) Name() string {
+	return StorageS3
+}
+
+func (s *s3Store) objectKey(id string) string {
+	return s.prefix + id + ".json"
+}
+
+func (s *s3Store) Save(ctx context.Context, id string, policies []Policy) error {
+	if policies == nil {
+		policies = []Policy{}
+	}
+	data, err := json.Marshal(policies)
+	if err != nil {
+		return fmt.Errorf("error when encoding the recommendation result: %v", err)
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectKey(id), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError(resp, "saving", id)
+	}
+	return nil
+}
+
+func (s *s3Store) List(ctx context.Context, id string, limit int64, cursor *Cursor) ([]Policy, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectKey(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.responseError(resp, "getting", id)
+	}
+	var policies []Policy
+	if err := json.NewDecoder(resp.Body).Decode(&policies); err != nil {
+		return nil, fmt.Errorf("error when decoding the recommendation result of object %s: %v", s.objectKey(id), err)
+	}
+	sortPolicies(policies)
+	return page(policies, limit, cursor), nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, id string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectKey(id), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 responds with 204 No Content whether the object existed or not.
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s.responseError(resp, "deleting", id)
+	}
+	return nil
+}
+
+func (s *s3Store) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	objectURL := *s.endpoint
+	objectURL.Path = strings.TrimSuffix(s.endpoint.Path, "/") + "/" + s.bucket + "/" + key
+	objectURL.RawPath = escapeS3Path(objectURL.Path)
+	req, err := http.NewRequestWithContext(ctx, method, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error when creating the S3 request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	s.sign(req, body, s.now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error when sending the request to the S3 endpoint: %v", err)
+	}
+	return resp, nil
+}
+
+func (s *s3Store) responseError(resp *http.Response, action, id string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxS3ErrorBodySize))
+	return fmt.Errorf("error when %s the recommendation result of object %s: S3 responded with status %s: %s", action, s.objectKey(id), resp.Status, strings.TrimSpace(string(body)))
+}
+
+// sign adds the Authorization header of the AWS Signature Version 4 to the
+// request, signing all its headers.
+func (s *s3Store) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	req.Header.Set("X-Amz-Date", now.Format(amzDateLayout))
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := strings.Join([]string{now.Format(amzShortLayout), s.region, "s3", "aws4_request"}, "/")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateLayout),
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+	key := []byte("AWS4" + s.secretAccessKey)
+	for _, part := range []string{now.Format(amzShortLayout), s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapeS3Path escapes every byte of the path but the unreserved characters
+// and the slashes, as required by the AWS Signature Version 4.
+func escapeS3Path(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resultstore stores the policies recommended by the policy
+// recommendation jobs. The jobs write their results to ClickHouse, and the
+// results of the completed jobs can be copied to another storage, e.g. a
+// ConfigMap or an S3 bucket, so that they can still be retrieved after
+// ClickHouse purged them.
+package resultstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/kubernetes"
+
+	config "antrea.io/theia/pkg/config/theiamanager"
+)
+
+const (
+	// The results are only stored in ClickHouse.
+	StorageClickHouse = "clickhouse"
+	// The results are copied to a ConfigMap per job.
+	StorageConfigMap = "configMap"
+	// The results are copied to an object per job in an S3 bucket.
+	StorageS3 = "s3"
+)
+
+// ErrNotFound is returned when a store has no result for a job.
+var ErrNotFound = errors.New("recommendation result not found")
+
+// Policy is a policy recommended by a job. Hash is the cityHash64 of the yaml
+// of the policy computed by ClickHouse. The policies are sorted by kind, hash
+// and yaml, so that the results are paged in the same order whatever the store
+// they are read from.
+type Policy struct {
+	Kind   string `json:"kind"`
+	Hash   uint64 `json:"hash"`
+	Policy string `json:"policy"`
+}
+
+// Cursor is the position of a policy in the result of a job. The kind and hash
+// of the policies are not unique, e.g. when a retried job inserted the same
+// policy twice, so Index is the position of the policy among the policies with
+// the same kind and hash, starting from 0.
+type Cursor struct {
+	Kind  string `json:"kind"`
+	Hash  uint64 `json:"hash"`
+	Index int64  `json:"index,omitempty"`
+}
+
+// NextCursor returns the cursor of the last policy of a page read after
+// cursor, or from the first policy if cursor is nil.
+func NextCursor(cursor *Cursor, policies []Policy) *Cursor {
+	last := policies[len(policies)-1]
+	next := &Cursor{Kind: last.Kind, Hash: last.Hash}
+	for i := len(policies) - 2; i >= 0 && policies[i].Kind == last.Kind && policies[i].Hash == last.Hash; i-- {
+		next.Index++
+	}
+	if next.Index == int64(len(policies)-1) && cursor != nil && cursor.Kind == last.Kind && cursor.Hash == last.Hash {
+		// The page started among the policies of the same kind and hash.
+		next.Index += cursor.Index + 1
+	}
+	return next
+}
+
+// skipCursor skips the policies at or before cursor from the policies sorted
+// from the first one with the same kind and hash as cursor.
+func skipCursor(policies []Policy, cursor *Cursor) []Policy {
+	skipped := int64(0)
+	for len(policies) > 0 && skipped <= cursor.Index && policies[0].Kind == cursor.Kind && policies[0].Hash == cursor.Hash {
+		policies = policies[1:]
+		skipped++
+	}
+	return policies
+}
+
+// Store stores the results of the policy recommendation jobs.
+type Store interface {
+	// Name returns the storage of the store, e.g. StorageConfigMap.
+	Name() string
+	// Save stores the recommended policies of a job, replacing the ones
+	// stored before.
+	Save(ctx context.Context, id string, policies []Policy) error
+	// List returns at most limit recommended policies of a job, sorted by
+	// kind, hash and yaml, starting after cursor, or from the first policy if
+	// cursor is nil. All the policies are returned if limit is 0. ErrNotFound
+	// is returned if the store has no result for the job.
+	List(ctx context.Context, id string, limit int64, cursor *Cursor) ([]Policy, error)
+	// Delete deletes the recommended policies of a job, if any.
+	Delete(ctx context.Context, id string) error
+}
+
+// ValidateConfig checks the configuration of the storage of the results.
+func ValidateConfig(resultsConfig config.RecommendationResultsConfig) error {
+	switch resultsConfig.Storage {
+	case "", StorageClickHouse, StorageConfigMap:
+		return nil
+	case StorageS3:
+		_, err := newS3Store(resultsConfig.S3)
+		return err
+	default:
+		return fmt.Errorf("unknown storage %q, it should be %s, %s or %s", resultsConfig.Storage, StorageClickHouse, StorageConfigMap, StorageS3)
+	}
+}
+
+// New returns the store to which the results of the completed jobs are
+// copied, or nil if they are only stored in ClickHouse. The ConfigMaps are
+// created in namespace.
+func New(resultsConfig config.RecommendationResultsConfig, kubeClient kubernetes.Interface, namespace string) (Store, error) {
+	switch resultsConfig.Storage {
+	case "", StorageClickHouse:
+		return nil, nil
+	case StorageConfigMap:
+		return NewConfigMapStore(kubeClient, namespace), nil
+	case StorageS3:
+		return newS3Store(resultsConfig.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage %q, it should be %s, %s or %s", resultsConfig.Storage, StorageClickHouse, StorageConfigMap, StorageS3)
+	}
+}
+
+// sortPolicies sorts the policies by kind, hash and yaml.
+func sortPolicies(policies []Policy) {
+	sort.Slice(policies, func(i, j int) bool {
+		if policies[i].Kind != policies[j].Kind {
+			return policies[i].Kind < policies[j].Kind
+		}
+		if policies[i].Hash != policies[j].Hash {
+			return policies[i].Hash < policies[j].Hash
+		}
+		return policies[i].Policy < policies[j].Policy
+	})
+}
+
+// page returns at most limit of the sorted policies after cursor, for the
+// stores which read the whole result of a job at once.
+func page(policies []Policy, limit int64, cursor *Cursor) []Policy {
+	start := 0
+	if cursor != nil {
+		start = sort.Search(len(policies), func(i int) bool {
+			return policies[i].Kind > cursor.Kind || (policies[i].Kind == cursor.Kind && policies[i].Hash >= cursor.Hash)
+		})
+	}
+	policies = policies[start:]
+	if cursor != nil {
+		policies = skipCursor(policies, cursor)
+	}
+	if limit > 0 && int64(len(policies)) > limit {
+		policies = policies[:limit]
+	}
+	return policies
+}
@@ -26,18 +26,19 @@ var throughputanomalyDetectionCmd = &cobra.Command{
 	Aliases: []string{"tad"},
 	Short:   "Commands of Theia throughput anomaly detection feature",
 	Long: `Command group of Theia throughput anomaly detection feature.
-	Must specify a subcommand like run, list, delete, status or retrieve`,
+	Must specify a subcommand like run, list, delete, status, logs or retrieve`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Error: Must also specify a subcommand like run, list, delete, status or retrieve")
+		fmt.Println("Error: Must also specify a subcommand like run, list, delete, status, logs or retrieve")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(throughputanomalyDetectionCmd)
-	throughputanomalyDetectionCmd.PersistentFlags().Bool(
-		"use-cluster-ip",
-		false,
-		`Enable this option will use ClusterIP instead of port forwarding when connecting to the Theia
-Manager Service. It can only be used when running in cluster.`,
-	)
+	addUseClusterIPFlag(throughputanomalyDetectionCmd)
+	throughputanomalyDetectionCmd.AddCommand(newJobLogsCommand(anomalyDetectionJobs, `
+Print the logs of the anomaly detection job with name tad-e998433e-accb-4888-9fc8-06563f073e86
+$ theia throughput-anomaly-detection logs tad-e998433e-accb-4888-9fc8-06563f073e86
+Print the last 100 lines of the logs and stream the new lines
+$ theia throughput-anomaly-detection logs tad-e998433e-accb-4888-9fc8-06563f073e86 --tail 100 -f
+`))
 }
@@ -15,13 +15,7 @@
 package commands
 
 import (
-	"context"
-	"fmt"
-	"strings"
-
 	"github.com/spf13/cobra"
-
-	"antrea.io/theia/pkg/util"
 )
 
 // anomalyDetectionDeleteCmd represents the anomaly detection delete command
@@ -41,21 +35,7 @@ $ theia throughput-anomaly-detection delete "tad-e998433e-accb-4888-9fc8-06563f0
 }
 
 func anomalyDetectionDelete(cmd *cobra.Command, args []string) error {
-	tadName, err := cmd.Flags().GetString("name")
-	if err != nil {
-		return err
-	}
-	if tadName == "" && len(args) == 1 {
-		tadName = args[0]
-	}
-	tadNameList := strings.Fields(tadName)
-	for _, tadName := range tadNameList {
-		err = deleteTADId(cmd, tadName)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return anomalyDetectionJobs.runDelete(cmd, args)
 }
 
 func init() {
@@ -66,33 +46,6 @@ func init() {
 		"",
 		"Name of the anomaly detection job.",
 	)
-}
-
-func deleteTADId(cmd *cobra.Command, tadName string) error {
-	err := util.ParseADAlgorithmID(tadName)
-	if err != nil {
-		return err
-	}
-	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
-	if err != nil {
-		return err
-	}
-	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
-	if err != nil {
-		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
-	}
-	if pf != nil {
-		defer pf.Stop()
-	}
-	err = theiaClient.Delete().
-		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
-		Resource("throughputanomalydetectors").
-		Name(tadName).
-		Do(context.TODO()).
-		Error()
-	if err != nil {
-		return fmt.Errorf("error when deleting anomaly detection job: %v", err)
-	}
-	fmt.Printf("Successfully deleted anomaly detection job with name: %s\n", tadName)
-	return nil
+	anomalyDetectionDeleteCmd.RegisterFlagCompletionFunc("name", completeJobNames(anomalyDetectorResource))
+	anomalyDetectionDeleteCmd.ValidArgsFunction = completeJobNameArg(anomalyDetectorResource)
 }
@@ -15,12 +15,7 @@
 package commands
 
 import (
-	"context"
-	"fmt"
-
 	"github.com/spf13/cobra"
-
-	anomalydetector "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 )
 
 // anomalyDetectionListCmd represents the anomaly-detection list command
@@ -41,41 +36,5 @@ func init() {
 }
 
 func anomalyDetectionList(cmd *cobra.Command, args []string) error {
-	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
-	if err != nil {
-		return err
-	}
-	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
-	if err != nil {
-		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
-	}
-	if pf != nil {
-		defer pf.Stop()
-	}
-	tadList := &anomalydetector.ThroughputAnomalyDetectorList{}
-	err = theiaClient.Get().
-		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
-		Resource("throughputanomalydetectors").
-		Do(context.TODO()).Into(tadList)
-	if err != nil {
-		return fmt.Errorf("error when getting anomaly detection job list: %v", err)
-	}
-
-	sparkApplicationTable := [][]string{
-		{"CreationTime", "CompletionTime", "Name", "Status"},
-	}
-	for _, tad := range tadList.Items {
-		if tad.Status.SparkApplication == "" {
-			continue
-		}
-		sparkApplicationTable = append(sparkApplicationTable,
-			[]string{
-				FormatTimestamp(tad.Status.StartTime.Time),
-				FormatTimestamp(tad.Status.EndTime.Time),
-				tad.Name,
-				tad.Status.State,
-			})
-	}
-	TableOutput(sparkApplicationTable)
-	return nil
+	return anomalyDetectionJobs.runList(cmd, args)
 }
@@ -0,0 +1,287 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/util"
+)
+
+const (
+	severityWarning  = "warning"
+	severityCritical = "critical"
+	// An anomaly is critical if its throughput deviates from the value
+	// calculated by the algorithm by more than criticalDeviation standard
+	// deviations. All the anomalies deviate by more than one standard
+	// deviation.
+	criticalDeviation = 3
+)
+
+// throughputAnomalyDetectionResultCmd represents the throughput-anomaly-detection result command
+var throughputAnomalyDetectionResultCmd = &cobra.Command{
+	Use:   "result",
+	Short: "Get the anomalies of an anomaly detection job grouped by source and destination",
+	Long: `Get the anomalies detected by an anomaly detection job, grouped by source and destination, in
+JSON format suitable for alerting pipelines.
+An anomaly is critical if its throughput deviates from the value calculated by the algorithm by more
+than 3 standard deviations, and a warning otherwise. The anomalies detected by DBSCAN are warnings,
+as it does not calculate an expected throughput. A group has the severity of its most severe
+anomaly. The groups are sorted by severity, then by number of anomalies.
+The source or destination of a group is the source or destination IP of a connection, the external
+IP or the Service as NAMESPACE/NAME:PORT of the anomalies towards them, or the Pod as NAMESPACE/NAME
+or NAMESPACE/LABELS in the direction of the anomalies.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Get the anomalies of job tad-e998433e-accb-4888-9fc8-06563f073e86
+$ theia throughput-anomaly-detection result tad-e998433e-accb-4888-9fc8-06563f073e86
+Only get the groups of critical anomalies
+$ theia throughput-anomaly-detection result tad-e998433e-accb-4888-9fc8-06563f073e86 --severity critical
+Save the anomalies to file
+$ theia throughput-anomaly-detection result tad-e998433e-accb-4888-9fc8-06563f073e86 --file anomalies.json
+`,
+	RunE: throughputAnomalyDetectionResult,
+}
+
+// anomalyGroup is the anomalies of an anomaly detection job with the same
+// source and destination.
+type anomalyGroup struct {
+	JobName     string `json:"jobName"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	AggType     string `json:"aggType"`
+	AlgoType    string `json:"algoType"`
+	Severity    string `json:"severity"`
+	Anomalies   int    `json:"anomalies"`
+	// MaxThroughput is the highest throughput of the anomalies.
+	MaxThroughput float64 `json:"maxThroughput"`
+	// MaxDeviation is the highest deviation of the throughput of the
+	// anomalies from the calculated value, in standard deviations. It is 0
+	// if the standard deviation is not known.
+	MaxDeviation        float64 `json:"maxDeviation"`
+	FirstFlowEndSeconds string  `json:"firstFlowEndSeconds"`
+	LastFlowEndSeconds  string  `json:"lastFlowEndSeconds"`
+}
+
+func init() {
+	throughputanomalyDetectionCmd.AddCommand(throughputAnomalyDetectionResultCmd)
+	throughputAnomalyDetectionResultCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the anomaly detection job.",
+	)
+	throughputAnomalyDetectionResultCmd.RegisterFlagCompletionFunc("name", completeJobNames(anomalyDetectorResource))
+	throughputAnomalyDetectionResultCmd.ValidArgsFunction = completeJobNameArg(anomalyDetectorResource)
+	throughputAnomalyDetectionResultCmd.Flags().String(
+		"severity",
+		severityWarning,
+		"Minimum severity of the groups of anomalies, warning or critical.",
+	)
+	throughputAnomalyDetectionResultCmd.RegisterFlagCompletionFunc("severity", cobra.FixedCompletions([]string{
+		severityWarning, severityCritical,
+	}, cobra.ShellCompDirectiveNoFileComp))
+	throughputAnomalyDetectionResultCmd.Flags().StringP(
+		"file",
+		"f",
+		"",
+		"The file path where you want to save the result.",
+	)
+}
+
+func throughputAnomalyDetectionResult(cmd *cobra.Command, args []string) error {
+	tadName, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	if tadName == "" && len(args) == 1 {
+		tadName = args[0]
+	}
+	err = util.ParseADAlgorithmID(tadName)
+	if err != nil {
+		return err
+	}
+	severity, err := cmd.Flags().GetString("severity")
+	if err != nil {
+		return err
+	}
+	if severity != severityWarning && severity != severityCritical {
+		return fmt.Errorf("severity should be %s or %s, got %q", severityWarning, severityCritical, severity)
+	}
+	filePath, err := getPathFlag(cmd, "file")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	tad, err := GetThroughputAnomalyDetectorByID(theiaClient, tadName)
+	if err != nil {
+		return fmt.Errorf("error when getting anomaly detection job by job name: %v", err)
+	}
+	if tad.Status.State != "COMPLETED" {
+		return fmt.Errorf("anomaly detection job %s is not completed, its status is %s", tadName, tad.Status.State)
+	}
+	groups, err := groupAnomalies(tadName, tad.Stats)
+	if err != nil {
+		return err
+	}
+	// The output is an empty list rather than null when there is no anomaly,
+	// so that it can always be iterated over.
+	filtered := []anomalyGroup{}
+	for _, group := range groups {
+		if severity == severityCritical && group.Severity != severityCritical {
+			continue
+		}
+		filtered = append(filtered, group)
+	}
+	data, err := json.MarshalIndent(filtered, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error when marshalling anomalies: %v", err)
+	}
+	data = append(data, '\n')
+	if filePath != "" {
+		if err := os.WriteFile(filePath, data, 0600); err != nil {
+			return fmt.Errorf("error when writing anomalies to file: %v", err)
+		}
+		return nil
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// groupAnomalies groups the anomalies of an anomaly detection job by source
+// and destination. The groups are sorted by severity and number of
+// anomalies, then in the order their first anomaly is found.
+func groupAnomalies(tadName string, stats []intelligence.ThroughputAnomalyDetectorStats) ([]anomalyGroup, error) {
+	var groups []anomalyGroup
+	indexes := map[string]int{}
+	for _, stat := range stats {
+		if stat.Anomaly == "NO ANOMALY DETECTED" {
+			continue
+		}
+		source, destination, err := anomalyPeers(stat)
+		if err != nil {
+			return nil, err
+		}
+		throughput, err := strconv.ParseFloat(stat.Throughput, 64)
+		if err != nil {
+			return nil, fmt.Errorf("throughput %q of anomaly is not a number: %v", stat.Throughput, err)
+		}
+		severity, deviation := anomalySeverity(stat, throughput)
+		key := strings.Join([]string{stat.AggType, source, destination}, " ")
+		index, ok := indexes[key]
+		if !ok {
+			index = len(groups)
+			indexes[key] = index
+			groups = append(groups, anomalyGroup{
+				JobName:             tadName,
+				Source:              source,
+				Destination:         destination,
+				AggType:             stat.AggType,
+				AlgoType:            stat.AlgoType,
+				Severity:            severityWarning,
+				FirstFlowEndSeconds: stat.FlowEndSeconds,
+				LastFlowEndSeconds:  stat.FlowEndSeconds,
+			})
+		}
+		group := &groups[index]
+		group.Anomalies++
+		if severity == severityCritical {
+			group.Severity = severityCritical
+		}
+		group.MaxThroughput = math.Max(group.MaxThroughput, throughput)
+		group.MaxDeviation = math.Max(group.MaxDeviation, deviation)
+		// The times are formatted alike, so that they are compared as
+		// strings.
+		if stat.FlowEndSeconds < group.FirstFlowEndSeconds {
+			group.FirstFlowEndSeconds = stat.FlowEndSeconds
+		}
+		if stat.FlowEndSeconds > group.LastFlowEndSeconds {
+			group.LastFlowEndSeconds = stat.FlowEndSeconds
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Severity != groups[j].Severity {
+			return groups[i].Severity == severityCritical
+		}
+		return groups[i].Anomalies > groups[j].Anomalies
+	})
+	return groups, nil
+}
+
+// anomalyPeers returns the source and destination of an anomaly, based on its
+// aggregation type.
+func anomalyPeers(stat intelligence.ThroughputAnomalyDetectorStats) (string, string, error) {
+	switch stat.AggType {
+	case "None":
+		return stat.SourceIP, stat.DestinationIP, nil
+	case "external":
+		return "", stat.DestinationIP, nil
+	case "svc":
+		return "", stat.DestinationServicePortName, nil
+	case "pod":
+		pod := stat.PodNamespace + "/" + stat.PodName
+		if stat.PodName == "" {
+			pod = stat.PodNamespace + "/" + stat.PodLabels
+		}
+		if stat.Direction == "inbound" {
+			return "", pod, nil
+		}
+		return pod, "", nil
+	}
+	return "", "", fmt.Errorf("unknown aggregation type %q of anomaly", stat.AggType)
+}
+
+// anomalySeverity returns the severity of an anomaly and the deviation of its
+// throughput from the calculated value, in standard deviations. The anomalies
+// of Theia Manager versions which do not return the standard deviation are
+// warnings, as well as the anomalies detected by DBSCAN, which does not
+// calculate an expected throughput.
+func anomalySeverity(stat intelligence.ThroughputAnomalyDetectorStats, throughput float64) (string, float64) {
+	if stat.AlgoType == "DBSCAN" {
+		return severityWarning, 0
+	}
+	calculated, err := strconv.ParseFloat(stat.AlgoCalc, 64)
+	if err != nil {
+		return severityWarning, 0
+	}
+	stddev, err := strconv.ParseFloat(stat.ThroughputStandardDeviation, 64)
+	if err != nil || stddev <= 0 {
+		return severityWarning, 0
+	}
+	deviation := math.Abs(throughput-calculated) / stddev
+	if deviation > criticalDeviation {
+		return severityCritical, deviation
+	}
+	return severityWarning, deviation
+}
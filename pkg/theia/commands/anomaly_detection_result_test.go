@@ -0,0 +1,195 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	anomalydetector "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestAnomalyDetectorResult(t *testing.T) {
+	tadName := "tad-1234abcd-1234-abcd-12ab-12345678abcd"
+	stats := []anomalydetector.ThroughputAnomalyDetectorStats{
+		{Id: tadName, Anomaly: "true", AggType: "None", AlgoType: "EWMA", SourceIP: "10.10.0.5", DestinationIP: "10.10.1.6",
+			FlowEndSeconds: "2023-06-01T08:02:00Z", Throughput: "5000", AlgoCalc: "3000", ThroughputStandardDeviation: "1000"},
+		{Id: tadName, Anomaly: "true", AggType: "external", AlgoType: "EWMA", DestinationIP: "203.0.113.5",
+			FlowEndSeconds: "2023-06-01T08:01:00Z", Throughput: "9000", AlgoCalc: "3000", ThroughputStandardDeviation: "1000"},
+		{Id: tadName, Anomaly: "true", AggType: "None", AlgoType: "EWMA", SourceIP: "10.10.0.5", DestinationIP: "10.10.1.6",
+			FlowEndSeconds: "2023-06-01T08:00:00Z", Throughput: "1000", AlgoCalc: "3000", ThroughputStandardDeviation: "1000"},
+	}
+	testCases := []struct {
+		name             string
+		state            string
+		stats            []anomalydetector.ThroughputAnomalyDetectorStats
+		severity         string
+		expectedGroups   []anomalyGroup
+		expectedErrorMsg string
+	}{
+		{
+			name:     "All anomalies",
+			state:    "COMPLETED",
+			stats:    stats,
+			severity: "warning",
+			expectedGroups: []anomalyGroup{
+				{JobName: tadName, Destination: "203.0.113.5", AggType: "external", AlgoType: "EWMA", Severity: "critical", Anomalies: 1,
+					MaxThroughput: 9000, MaxDeviation: 6, FirstFlowEndSeconds: "2023-06-01T08:01:00Z", LastFlowEndSeconds: "2023-06-01T08:01:00Z"},
+				{JobName: tadName, Source: "10.10.0.5", Destination: "10.10.1.6", AggType: "None", AlgoType: "EWMA", Severity: "warning", Anomalies: 2,
+					MaxThroughput: 5000, MaxDeviation: 2, FirstFlowEndSeconds: "2023-06-01T08:00:00Z", LastFlowEndSeconds: "2023-06-01T08:02:00Z"},
+			},
+		},
+		{
+			name:     "Critical anomalies",
+			state:    "COMPLETED",
+			stats:    stats,
+			severity: "critical",
+			expectedGroups: []anomalyGroup{
+				{JobName: tadName, Destination: "203.0.113.5", AggType: "external", AlgoType: "EWMA", Severity: "critical", Anomalies: 1,
+					MaxThroughput: 9000, MaxDeviation: 6, FirstFlowEndSeconds: "2023-06-01T08:01:00Z", LastFlowEndSeconds: "2023-06-01T08:01:00Z"},
+			},
+		},
+		{
+			name:           "No anomaly",
+			state:          "COMPLETED",
+			stats:          []anomalydetector.ThroughputAnomalyDetectorStats{{Id: tadName, Anomaly: "NO ANOMALY DETECTED"}},
+			severity:       "warning",
+			expectedGroups: []anomalyGroup{},
+		},
+		{
+			name:             "Invalid severity",
+			severity:         "info",
+			expectedErrorMsg: "severity should be warning or critical, got \"info\"",
+		},
+		{
+			name:             "Job not completed",
+			state:            "RUNNING",
+			severity:         "warning",
+			expectedErrorMsg: fmt.Sprintf("anomaly detection job %s is not completed, its status is RUNNING", tadName),
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			severity:         "warning",
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/throughputanomalydetectors/%s", tadName):
+					tad := &anomalydetector.ThroughputAnomalyDetector{
+						Status: anomalydetector.ThroughputAnomalyDetectorStatus{State: tt.state},
+						Stats:  tt.stats,
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(tad)
+				}
+			}))
+			defer testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("name", tadName, "")
+			cmd.Flags().String("severity", tt.severity, "")
+			cmd.Flags().String("file", "", "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := throughputAnomalyDetectionResult(cmd, []string{})
+			outcome := readStdouttad(t, r, w)
+			if tt.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			var groups []anomalyGroup
+			require.NoError(t, json.Unmarshal([]byte(outcome), &groups), "outcome: %s", outcome)
+			assert.Equal(t, tt.expectedGroups, groups)
+		})
+	}
+}
+
+func TestAnomalySeverity(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		stat              anomalydetector.ThroughputAnomalyDetectorStats
+		throughput        float64
+		expectedSeverity  string
+		expectedDeviation float64
+	}{
+		{
+			name:              "Critical",
+			stat:              anomalydetector.ThroughputAnomalyDetectorStats{AlgoType: "ARIMA", AlgoCalc: "500", ThroughputStandardDeviation: "100"},
+			throughput:        100,
+			expectedSeverity:  "critical",
+			expectedDeviation: 4,
+		},
+		{
+			name:              "Warning",
+			stat:              anomalydetector.ThroughputAnomalyDetectorStats{AlgoType: "EWMA", AlgoCalc: "500", ThroughputStandardDeviation: "100"},
+			throughput:        700,
+			expectedSeverity:  "warning",
+			expectedDeviation: 2,
+		},
+		{
+			name:             "Unknown standard deviation",
+			stat:             anomalydetector.ThroughputAnomalyDetectorStats{AlgoType: "EWMA", AlgoCalc: "500"},
+			throughput:       7000,
+			expectedSeverity: "warning",
+		},
+		{
+			name:             "DBSCAN",
+			stat:             anomalydetector.ThroughputAnomalyDetectorStats{AlgoType: "DBSCAN", AlgoCalc: "0", ThroughputStandardDeviation: "100"},
+			throughput:       7000,
+			expectedSeverity: "warning",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			severity, deviation := anomalySeverity(tc.stat, tc.throughput)
+			assert.Equal(t, tc.expectedSeverity, severity)
+			assert.Equal(t, tc.expectedDeviation, deviation)
+		})
+	}
+}
@@ -20,8 +20,6 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-
-	"antrea.io/theia/pkg/util"
 )
 
 // throughputAnomalyDetectionRetrieveCmd represents the throughput-anomaly-detection retrieve command
@@ -50,8 +48,10 @@ func init() {
 		"name",
 		"",
 		"",
-		"Name of the anomaly detection job.",
+		"Name of the anomaly detection job, or latest for the most recently created one.",
 	)
+	throughputAnomalyDetectionRetrieveCmd.RegisterFlagCompletionFunc("name", completeJobNames(anomalyDetectorResource))
+	throughputAnomalyDetectionRetrieveCmd.ValidArgsFunction = completeJobNameArg(anomalyDetectorResource)
 	throughputAnomalyDetectionRetrieveCmd.Flags().StringP(
 		"file",
 		"f",
@@ -61,32 +61,29 @@ func init() {
 }
 
 func throughputAnomalyDetectionRetrieve(cmd *cobra.Command, args []string) error {
-	tadName, err := cmd.Flags().GetString("name")
+	tadName, err := getJobName(cmd, args)
 	if err != nil {
 		return err
 	}
-	if tadName == "" && len(args) == 1 {
-		tadName = args[0]
-	}
-	err = util.ParseADAlgorithmID(tadName)
+	err = anomalyDetectionJobs.validateName(tadName)
 	if err != nil {
 		return err
 	}
-	filePath, err := cmd.Flags().GetString("file")
+	filePath, err := getPathFlag(cmd, "file")
 	if err != nil {
 		return err
 	}
-	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	theiaClient, pf, err := connectTheiaManager(cmd)
 	if err != nil {
 		return err
 	}
-	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
-	if err != nil {
-		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
-	}
 	if pf != nil {
 		defer pf.Stop()
 	}
+	tadName, err = anomalyDetectionJobs.resolveName(theiaClient, tadName)
+	if err != nil {
+		return err
+	}
 	tad, err := GetThroughputAnomalyDetectorByID(theiaClient, tadName)
 	if err != nil {
 		return fmt.Errorf("error when getting anomaly detection job by job name: %v", err)
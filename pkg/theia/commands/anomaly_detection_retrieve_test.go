@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -216,7 +217,7 @@ func TestAnomalyDetectorRetrieve(t *testing.T) {
 			tadName:          tadName,
 			expectedMsg:      []string{},
 			expectedErrorMsg: "",
-			filePath:         "/tmp/testResult",
+			filePath:         filepath.Join(t.TempDir(), "testResult"),
 		},
 		{
 			name: "Throughput Anomaly Detection not found",
@@ -15,19 +15,17 @@
 package commands
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
 
 	anomalydetector "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
-	"antrea.io/theia/pkg/theia/commands/config"
 	"antrea.io/theia/pkg/util"
 )
 
@@ -102,54 +100,22 @@ be a list of namespace string, for example: '["kube-system","flow-aggregator","f
 		throughputAnomalyDetection.NSIgnoreList = parsednsIgnoreList
 	}
 
-	executorInstances, err := cmd.Flags().GetInt32("executor-instances")
+	resources, err := getSparkResources(cmd)
 	if err != nil {
 		return err
 	}
-	if executorInstances < 0 {
-		return fmt.Errorf("executor-instances should be an integer >= 0")
-	}
-	throughputAnomalyDetection.ExecutorInstances = int(executorInstances)
-
-	driverCoreRequest, err := cmd.Flags().GetString("driver-core-request")
-	if err != nil {
-		return err
-	}
-	matchResult, err := regexp.MatchString(config.K8sQuantitiesReg, driverCoreRequest)
-	if err != nil || !matchResult {
-		return fmt.Errorf("driver-core-request should conform to the Kubernetes resource quantity convention")
-	}
-	throughputAnomalyDetection.DriverCoreRequest = driverCoreRequest
+	throughputAnomalyDetection.ExecutorInstances = resources.executorInstances
+	throughputAnomalyDetection.DriverCoreRequest = resources.driverCoreRequest
+	throughputAnomalyDetection.DriverMemory = resources.driverMemory
+	throughputAnomalyDetection.ExecutorCoreRequest = resources.executorCoreRequest
+	throughputAnomalyDetection.ExecutorMemory = resources.executorMemory
 
-	driverMemory, err := cmd.Flags().GetString("driver-memory")
+	autoSizeExecutors, err := cmd.Flags().GetBool("auto-size-executors")
 	if err != nil {
 		return err
 	}
-	matchResult, err = regexp.MatchString(config.K8sQuantitiesReg, driverMemory)
-	if err != nil || !matchResult {
-		return fmt.Errorf("driver-memory should conform to the Kubernetes resource quantity convention")
-	}
-	throughputAnomalyDetection.DriverMemory = driverMemory
-
-	executorCoreRequest, err := cmd.Flags().GetString("executor-core-request")
-	if err != nil {
-		return err
-	}
-	matchResult, err = regexp.MatchString(config.K8sQuantitiesReg, executorCoreRequest)
-	if err != nil || !matchResult {
-		return fmt.Errorf("executor-core-request should conform to the Kubernetes resource quantity convention")
-	}
-	throughputAnomalyDetection.ExecutorCoreRequest = executorCoreRequest
-
-	executorMemory, err := cmd.Flags().GetString("executor-memory")
-	if err != nil {
-		return err
-	}
-	matchResult, err = regexp.MatchString(config.K8sQuantitiesReg, executorMemory)
-	if err != nil || !matchResult {
-		return fmt.Errorf("executor-memory should conform to the Kubernetes resource quantity convention")
-	}
-	throughputAnomalyDetection.ExecutorMemory = executorMemory
+	// Explicitly requested executor resources are not overridden.
+	throughputAnomalyDetection.AutoSizeExecutors = autoSizeExecutors && !cmd.Flags().Changed("executor-instances") && !cmd.Flags().Changed("executor-memory")
 
 	aggregatedFlow, err := cmd.Flags().GetString("agg-flow")
 	if err != nil {
@@ -190,7 +156,10 @@ be a list of namespace string, for example: '["kube-system","flow-aggregator","f
 				return err
 			}
 			if externalIp != "" {
-				throughputAnomalyDetection.ExternalIP = externalIp
+				throughputAnomalyDetection.ExternalIP, err = util.NormalizeIPOrCIDR(externalIp)
+				if err != nil {
+					return fmt.Errorf("invalid external-ip: %v", err)
+				}
 			}
 			throughputAnomalyDetection.AggregatedFlow = aggregatedFlow
 		case "svc":
@@ -209,28 +178,21 @@ be a list of namespace string, for example: '["kube-system","flow-aggregator","f
 
 	tadID := uuid.New().String()
 	throughputAnomalyDetection.Name = "tad-" + tadID
-	throughputAnomalyDetection.Namespace = config.FlowVisibilityNS
+	throughputAnomalyDetection.Namespace = theiaNamespace
+	throughputAnomalyDetection.Annotations = map[string]string{util.CorrelationIDAnnotation: getCorrelationID()}
 
-	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	theiaClient, pf, err := connectTheiaManager(cmd)
 	if err != nil {
 		return err
 	}
-	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
-	if err != nil {
-		return fmt.Errorf("throughput anomaly detection couldn't setup Theia manager client, %v", err)
-	}
 	if pf != nil {
 		defer pf.Stop()
 	}
-	err = theiaClient.Post().
-		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
-		Resource("throughputanomalydetectors").
-		Body(&throughputAnomalyDetection).
-		Do(context.TODO()).
-		Error()
+	err = anomalyDetectionJobs.submit(theiaClient, &throughputAnomalyDetection)
 	if err != nil {
-		return fmt.Errorf("failed to Post Throughput Anomaly Detection job: %v", err)
+		return err
 	}
+	klog.V(2).InfoS("Created Throughput Anomaly Detection job", "name", throughputAnomalyDetection.Name, "correlationID", getCorrelationID())
 	fmt.Printf("Successfully started Throughput Anomaly Detection job with name: %s\n", throughputAnomalyDetection.Name)
 	return nil
 }
@@ -267,34 +229,12 @@ Format is YYYY-MM-DD hh:mm:ss in UTC timezone. No limit of the end time of flow
 		`List of default drop Namespaces. Use this to ignore traffic from selected namespaces
 If no Namespaces provided, Traffic from all namespaces present in flows table will be allowed by default.`,
 	)
-	throughputAnomalyDetectionAlgoCmd.Flags().Int32(
-		"executor-instances",
-		1,
-		"Specify the number of executors for the Spark application. Example values include 1, 2, 8, etc.",
-	)
-	throughputAnomalyDetectionAlgoCmd.Flags().String(
-		"driver-core-request",
-		"200m",
-		`Specify the CPU request for the driver Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 0.1, 500m, 1.5, 5, etc.`,
-	)
-	throughputAnomalyDetectionAlgoCmd.Flags().String(
-		"driver-memory",
-		"512M",
-		`Specify the memory request for the driver Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 512M, 1G, 8G, etc.`,
-	)
-	throughputAnomalyDetectionAlgoCmd.Flags().String(
-		"executor-core-request",
-		"200m",
-		`Specify the CPU request for the executor Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 0.1, 500m, 1.5, 5, etc.`,
-	)
-	throughputAnomalyDetectionAlgoCmd.Flags().String(
-		"executor-memory",
-		"512M",
-		`Specify the memory request for the executor Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 512M, 1G, 8G, etc.`,
+	addSparkResourceFlags(throughputAnomalyDetectionAlgoCmd)
+	throughputAnomalyDetectionAlgoCmd.Flags().Bool(
+		"auto-size-executors",
+		true,
+		`Size the executors according to the number of flow records in the time range of the job,
+unless executor-instances or executor-memory is specified.`,
 	)
 	throughputAnomalyDetectionAlgoCmd.Flags().String(
 		"agg-flow",
@@ -319,7 +259,7 @@ Example values include 512M, 1G, 8G, etc.`,
 	throughputAnomalyDetectionAlgoCmd.Flags().String(
 		"external-ip",
 		"",
-		`On choosing agg-flow as external, user has option to specify external-ip for inbound throughput, default would be all IPs`,
+		`On choosing agg-flow as external, user has option to specify external-ip for inbound throughput, as an IPv4 or IPv6 address or CIDR, default would be all IPs`,
 	)
 	throughputAnomalyDetectionAlgoCmd.Flags().String(
 		"svc-port-name",
@@ -71,7 +71,7 @@ func TestAnomalyDetectionRun(t *testing.T) {
 				}
 			})),
 			expectedMsg:      []string{},
-			expectedErrorMsg: "failed to Post Throughput Anomaly Detection job",
+			expectedErrorMsg: "failed to post anomaly detection job",
 		},
 		{
 			name:             TheiaClientSetupDeniedTestCase,
@@ -140,6 +140,7 @@ func TestAnomalyDetectionRun(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			if tt.name == "Valid case with args" {
 				err = throughputAnomalyDetectionAlgo(cmd, []string{"tadName"})
 			} else {
@@ -264,6 +265,10 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			name:             "Unspecified svc-port-name",
 			expectedErrorMsg: ErrorMsgUnspecifiedCase,
 		},
+		{
+			name:             "Invalid external-ip",
+			expectedErrorMsg: "invalid external-ip: 10.0.0.1/33 is not a valid IPv4 or IPv6 CIDR",
+		},
 		{
 			name:             "Invalid agg-flow",
 			expectedErrorMsg: "aggregated flow type should be 'pod' or 'external' or 'svc'",
@@ -378,6 +383,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "mock_executor-memory", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 		case "Unspecified agg-flow":
 			cmd.Flags().String("algo", "ARIMA", "")
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
@@ -388,6 +394,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 		case "Unspecified pod-label":
 			cmd.Flags().String("algo", "ARIMA", "")
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
@@ -398,6 +405,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "pod", "")
 		case "Unspecified pod-name":
 			cmd.Flags().String("algo", "ARIMA", "")
@@ -409,6 +417,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "pod", "")
 			cmd.Flags().String("pod-label", "mock_pod-label", "")
 		case "Unspecified pod-namespace":
@@ -421,6 +430,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "pod", "")
 			cmd.Flags().String("pod-label", "mock_pod_label", "")
 			cmd.Flags().String("pod-name", "mock_pod-name", "")
@@ -434,6 +444,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "pod", "")
 			cmd.Flags().String("pod-label", "", "")
 			cmd.Flags().String("pod-name", "", "")
@@ -448,6 +459,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "external", "")
 		case "Unspecified svc-port-name":
 			cmd.Flags().String("algo", "ARIMA", "")
@@ -459,7 +471,21 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "svc", "")
+		case "Invalid external-ip":
+			cmd.Flags().String("algo", "ARIMA", "")
+			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
+			cmd.Flags().String("end-time", "2006-01-03 16:04:05", "")
+			cmd.Flags().String("ns-ignore-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "1", "")
+			cmd.Flags().String("driver-memory", "1m", "")
+			cmd.Flags().String("executor-core-request", "1", "")
+			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().String("agg-flow", "external", "")
+			cmd.Flags().String("external-ip", "10.0.0.1/33", "")
 		case "Invalid agg-flow":
 			cmd.Flags().String("algo", "ARIMA", "")
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
@@ -470,6 +496,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "mock_agg-flow", "")
 		case "Unspecified use-cluster-ip":
 			cmd.Flags().String("algo", "ARIMA", "")
@@ -481,6 +508,7 @@ func TestThroughputAnomalyDetectionAlgo(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
 			cmd.Flags().String("agg-flow", "svc", "")
 			cmd.Flags().String("svc-port-name", "mock_svc_name", "")
 		}
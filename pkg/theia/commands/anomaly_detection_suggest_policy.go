@@ -0,0 +1,335 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/util"
+)
+
+const (
+	// suggestedPolicyTier is the tier of the suggested policies, which take
+	// precedence over the policies of the application developers.
+	suggestedPolicyTier     = "SecurityOps"
+	suggestedPolicyPriority = 5
+	// suggestedPolicyAnnotation is the annotation of the suggested policies
+	// with the name of the anomaly detection job they are suggested by.
+	suggestedPolicyAnnotation = "theia.antrea.io/throughput-anomaly-detector"
+)
+
+// throughputAnomalyDetectionSuggestPolicyCmd represents the throughput-anomaly-detection suggest-policy command
+var throughputAnomalyDetectionSuggestPolicyCmd = &cobra.Command{
+	Use:   "suggest-policy",
+	Short: "Suggest policies dropping the traffic of the anomalies of an anomaly detection job",
+	Long: `Suggest Antrea-native policies dropping the traffic of the anomalies detected by an anomaly
+detection job, once they are classified as unwanted traffic.
+The anomalies of the Pods are dropped by Antrea NetworkPolicies applied to the Pods, in the direction
+of the anomaly. As the Namespace of the other peers is not known, the anomalies of the connections,
+of the external IPs and of the Services are dropped by Antrea ClusterNetworkPolicies applied to all
+the Pods, which drop the traffic from the source IP and to the destination IP, to the external IP,
+or to the Service.
+All the anomalies are considered as unwanted traffic, unless --peer is specified. The suggested
+policies should be reviewed before they are applied.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Suggest policies for the anomalies of job tad-e998433e-accb-4888-9fc8-06563f073e86
+$ theia throughput-anomaly-detection suggest-policy tad-e998433e-accb-4888-9fc8-06563f073e86
+Only suggest policies for the anomalies of an external IP and of a Pod, and apply them
+$ theia throughput-anomaly-detection suggest-policy tad-e998433e-accb-4888-9fc8-06563f073e86 --peer 203.0.113.5 --peer default/backend-0 | kubectl apply -f -
+Save the suggested policies to a file
+$ theia throughput-anomaly-detection suggest-policy tad-e998433e-accb-4888-9fc8-06563f073e86 --file policies.yaml
+`,
+	RunE: throughputAnomalyDetectionSuggestPolicy,
+}
+
+// suggestedPolicy is an Antrea NetworkPolicy or ClusterNetworkPolicy
+// suggested for the anomalies of an anomaly detection job.
+type suggestedPolicy struct {
+	APIVersion string                  `yaml:"apiVersion"`
+	Kind       string                  `yaml:"kind"`
+	Metadata   suggestedPolicyMetadata `yaml:"metadata"`
+	Spec       suggestedPolicySpec     `yaml:"spec"`
+}
+
+type suggestedPolicyMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type suggestedPolicySpec struct {
+	Tier      string          `yaml:"tier"`
+	Priority  int             `yaml:"priority"`
+	AppliedTo []suggestedPeer `yaml:"appliedTo"`
+	Ingress   []suggestedRule `yaml:"ingress,omitempty"`
+	Egress    []suggestedRule `yaml:"egress,omitempty"`
+}
+
+type suggestedRule struct {
+	Action     string             `yaml:"action"`
+	From       []suggestedPeer    `yaml:"from,omitempty"`
+	To         []suggestedPeer    `yaml:"to,omitempty"`
+	ToServices []suggestedService `yaml:"toServices,omitempty"`
+}
+
+type suggestedPeer struct {
+	PodSelector       *labelSelector    `yaml:"podSelector,omitempty"`
+	NamespaceSelector *labelSelector    `yaml:"namespaceSelector,omitempty"`
+	IPBlock           *suggestedIPBlock `yaml:"ipBlock,omitempty"`
+}
+
+type suggestedIPBlock struct {
+	CIDR string `yaml:"cidr"`
+}
+
+type suggestedService struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+func init() {
+	throughputanomalyDetectionCmd.AddCommand(throughputAnomalyDetectionSuggestPolicyCmd)
+	throughputAnomalyDetectionSuggestPolicyCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the anomaly detection job.",
+	)
+	throughputAnomalyDetectionSuggestPolicyCmd.RegisterFlagCompletionFunc("name", completeJobNames(anomalyDetectorResource))
+	throughputAnomalyDetectionSuggestPolicyCmd.ValidArgsFunction = completeJobNameArg(anomalyDetectorResource)
+	throughputAnomalyDetectionSuggestPolicyCmd.Flags().StringArray(
+		"peer",
+		nil,
+		`A peer of the anomalies classified as unwanted traffic: the source or destination IP of a connection,
+an external IP, a Pod as NAMESPACE/NAME or NAMESPACE/LABELS with the labels in json format, or a Service
+as NAMESPACE/NAME. This flag can be repeated to specify multiple peers. All the anomalies by default.`,
+	)
+	throughputAnomalyDetectionSuggestPolicyCmd.Flags().StringP(
+		"file",
+		"f",
+		"",
+		"The file path where you want to save the suggested policies.",
+	)
+}
+
+func throughputAnomalyDetectionSuggestPolicy(cmd *cobra.Command, args []string) error {
+	tadName, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	if tadName == "" && len(args) == 1 {
+		tadName = args[0]
+	}
+	err = util.ParseADAlgorithmID(tadName)
+	if err != nil {
+		return err
+	}
+	peers, err := cmd.Flags().GetStringArray("peer")
+	if err != nil {
+		return err
+	}
+	filePath, err := getPathFlag(cmd, "file")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	tad, err := GetThroughputAnomalyDetectorByID(theiaClient, tadName)
+	if err != nil {
+		return fmt.Errorf("error when getting anomaly detection job by job name: %v", err)
+	}
+	if tad.Status.State != "COMPLETED" {
+		return fmt.Errorf("anomaly detection job %s is not completed, its status is %s", tadName, tad.Status.State)
+	}
+	for _, stat := range tad.Stats {
+		if stat.Anomaly == "NO ANOMALY DETECTED" {
+			fmt.Printf("No Anomaly found in id: %v\n", stat.Id)
+			return nil
+		}
+	}
+	// The Kubernetes client is only created to get the labels of the Pods
+	// of the anomalies aggregated by Pod name.
+	var k8sClient kubernetes.Interface
+	getPodLabels := func(namespace, name string) (map[string]string, error) {
+		if k8sClient == nil {
+			kubeconfig, err := ResolveKubeConfig(cmd)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+			}
+			if k8sClient, err = CreateK8sClient(kubeconfig); err != nil {
+				return nil, fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+			}
+		}
+		return getWorkloadPodLabels(k8sClient, "pod", namespace, name)
+	}
+	policies, err := suggestPolicies(tadName, tad.Stats, sets.New(peers...), getPodLabels)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		fmt.Printf("No policy suggested for the anomalies of job %s\n", tadName)
+		return nil
+	}
+	var documents []string
+	for _, policy := range policies {
+		data, err := yaml.Marshal(policy)
+		if err != nil {
+			return fmt.Errorf("error when marshalling suggested policy %s: %v", policy.Metadata.Name, err)
+		}
+		documents = append(documents, string(data))
+	}
+	result := strings.Join(documents, "---\n")
+	if filePath != "" {
+		if err := os.WriteFile(filePath, []byte(result), 0600); err != nil {
+			return fmt.Errorf("error when writing suggested policies to file: %v", err)
+		}
+		return nil
+	}
+	fmt.Print(result)
+	return nil
+}
+
+// suggestPolicies returns a policy dropping the traffic of each peer of the
+// anomalies, in the order the peers are first found in the anomalies. When
+// unwanted is not empty, only the anomalies of these peers are considered.
+func suggestPolicies(tadName string, stats []intelligence.ThroughputAnomalyDetectorStats, unwanted sets.Set[string], getPodLabels func(namespace, name string) (map[string]string, error)) ([]suggestedPolicy, error) {
+	var policies []suggestedPolicy
+	suggested := sets.New[string]()
+	for _, stat := range stats {
+		var keys []string
+		switch stat.AggType {
+		case "None":
+			keys = []string{stat.SourceIP, stat.DestinationIP}
+		case "external":
+			keys = []string{stat.DestinationIP}
+		case "svc":
+			keys = []string{strings.SplitN(stat.DestinationServicePortName, ":", 2)[0]}
+		case "pod":
+			if stat.PodName != "" {
+				keys = []string{stat.PodNamespace + "/" + stat.PodName}
+			} else {
+				keys = []string{stat.PodNamespace + "/" + stat.PodLabels}
+			}
+		default:
+			return nil, fmt.Errorf("unknown aggregation type %q of anomaly", stat.AggType)
+		}
+		if unwanted.Len() > 0 && !unwanted.HasAny(keys...) {
+			continue
+		}
+		key := strings.Join(append([]string{stat.AggType, stat.Direction}, keys...), " ")
+		if suggested.Has(key) {
+			continue
+		}
+		suggested.Insert(key)
+		policy, err := suggestPolicy(stat, getPodLabels)
+		if err != nil {
+			return nil, err
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		policy.Metadata.Name = fmt.Sprintf("%s-%08x", policy.Metadata.Name, hash.Sum32())
+		policy.Metadata.Annotations = map[string]string{suggestedPolicyAnnotation: tadName}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// suggestPolicy returns the policy dropping the traffic of the peer of an
+// anomaly, named by its kind, without the suffix making its name unique.
+func suggestPolicy(stat intelligence.ThroughputAnomalyDetectorStats, getPodLabels func(namespace, name string) (map[string]string, error)) (suggestedPolicy, error) {
+	allPods := []suggestedPeer{{NamespaceSelector: &labelSelector{}}}
+	acnp := suggestedPolicy{
+		APIVersion: "crd.antrea.io/v1alpha1",
+		Kind:       "ClusterNetworkPolicy",
+		Metadata:   suggestedPolicyMetadata{Name: "suggest-drop-acnp"},
+		Spec: suggestedPolicySpec{
+			Tier:      suggestedPolicyTier,
+			Priority:  suggestedPolicyPriority,
+			AppliedTo: allPods,
+		},
+	}
+	switch stat.AggType {
+	case "None":
+		acnp.Spec.Ingress = []suggestedRule{{Action: "Drop", From: []suggestedPeer{ipBlockPeer(stat.SourceIP)}}}
+		acnp.Spec.Egress = []suggestedRule{{Action: "Drop", To: []suggestedPeer{ipBlockPeer(stat.DestinationIP)}}}
+		return acnp, nil
+	case "external":
+		acnp.Spec.Egress = []suggestedRule{{Action: "Drop", To: []suggestedPeer{ipBlockPeer(stat.DestinationIP)}}}
+		return acnp, nil
+	case "svc":
+		namespace, name, ok := strings.Cut(strings.SplitN(stat.DestinationServicePortName, ":", 2)[0], "/")
+		if !ok {
+			return suggestedPolicy{}, fmt.Errorf("destination Service port name %q of anomaly should be NAMESPACE/NAME:PORT", stat.DestinationServicePortName)
+		}
+		acnp.Spec.Egress = []suggestedRule{{Action: "Drop", ToServices: []suggestedService{{Name: name, Namespace: namespace}}}}
+		return acnp, nil
+	}
+	var podLabels map[string]string
+	if stat.PodName != "" {
+		var err error
+		if podLabels, err = getPodLabels(stat.PodNamespace, stat.PodName); err != nil {
+			return suggestedPolicy{}, fmt.Errorf("failed to get the labels of Pod %s/%s of anomaly: %v", stat.PodNamespace, stat.PodName, err)
+		}
+	} else if err := json.Unmarshal([]byte(stat.PodLabels), &podLabels); err != nil {
+		return suggestedPolicy{}, fmt.Errorf("labels %s of anomaly are not in json format: %v", stat.PodLabels, err)
+	}
+	anp := suggestedPolicy{
+		APIVersion: "crd.antrea.io/v1alpha1",
+		Kind:       "NetworkPolicy",
+		Metadata:   suggestedPolicyMetadata{Name: "suggest-drop-anp", Namespace: stat.PodNamespace},
+		Spec: suggestedPolicySpec{
+			Tier:      suggestedPolicyTier,
+			Priority:  suggestedPolicyPriority,
+			AppliedTo: []suggestedPeer{{PodSelector: &labelSelector{MatchLabels: podLabels}}},
+		},
+	}
+	// A rule without peers drops the traffic of all the peers.
+	if stat.Direction == "inbound" {
+		anp.Spec.Ingress = []suggestedRule{{Action: "Drop"}}
+	} else {
+		anp.Spec.Egress = []suggestedRule{{Action: "Drop"}}
+	}
+	return anp, nil
+}
+
+// ipBlockPeer returns the peer selecting a single IP.
+func ipBlockPeer(ip string) suggestedPeer {
+	prefixLength := 32
+	if parsedIP := net.ParseIP(ip); parsedIP != nil && parsedIP.To4() == nil {
+		prefixLength = 128
+	}
+	return suggestedPeer{IPBlock: &suggestedIPBlock{CIDR: fmt.Sprintf("%s/%d", ip, prefixLength)}}
+}
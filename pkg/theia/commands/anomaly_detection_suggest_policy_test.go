@@ -0,0 +1,248 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+
+	anomalydetector "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestAnomalyDetectorSuggestPolicy(t *testing.T) {
+	tadName := "tad-1234abcd-1234-abcd-12ab-12345678abcd"
+	stats := []anomalydetector.ThroughputAnomalyDetectorStats{
+		{Id: tadName, Anomaly: "true", AggType: "None", SourceIP: "10.10.0.5", DestinationIP: "10.10.1.6"},
+		// The anomalies of a peer at several times get a single policy.
+		{Id: tadName, Anomaly: "true", AggType: "None", SourceIP: "10.10.0.5", DestinationIP: "10.10.1.6"},
+		{Id: tadName, Anomaly: "true", AggType: "external", DestinationIP: "2001:db8::1"},
+		{Id: tadName, Anomaly: "true", AggType: "svc", DestinationServicePortName: "default/backend:http"},
+		{Id: tadName, Anomaly: "true", AggType: "pod", PodNamespace: "default", PodLabels: `{"app":"client"}`, Direction: "outbound"},
+		{Id: tadName, Anomaly: "true", AggType: "pod", PodNamespace: "default", PodName: "backend-0", Direction: "inbound"},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "backend-0", Namespace: "default", Labels: map[string]string{"app": "backend"}}}
+	testCases := []struct {
+		name             string
+		state            string
+		stats            []anomalydetector.ThroughputAnomalyDetectorStats
+		peers            []string
+		objects          []runtime.Object
+		expectedCount    int
+		expectedPolicies []string
+		expectedMsg      string
+		expectedErrorMsg string
+	}{
+		{
+			name:          "Valid case",
+			state:         "COMPLETED",
+			stats:         stats,
+			objects:       []runtime.Object{pod},
+			expectedCount: 5,
+			expectedPolicies: []string{
+				`apiVersion: crd.antrea.io/v1alpha1
+kind: ClusterNetworkPolicy
+metadata:
+  name: suggest-drop-acnp-f58cb07b
+  annotations:
+    theia.antrea.io/throughput-anomaly-detector: tad-1234abcd-1234-abcd-12ab-12345678abcd
+spec:
+  tier: SecurityOps
+  priority: 5
+  appliedTo:
+  - namespaceSelector:
+      matchLabels: {}
+  ingress:
+  - action: Drop
+    from:
+    - ipBlock:
+        cidr: 10.10.0.5/32
+  egress:
+  - action: Drop
+    to:
+    - ipBlock:
+        cidr: 10.10.1.6/32
+`,
+				`egress:
+  - action: Drop
+    to:
+    - ipBlock:
+        cidr: 2001:db8::1/128
+`,
+				`egress:
+  - action: Drop
+    toServices:
+    - name: backend
+      namespace: default
+`,
+				`kind: NetworkPolicy
+metadata:
+  name: suggest-drop-anp-`,
+				`  namespace: default
+  annotations:
+    theia.antrea.io/throughput-anomaly-detector: tad-1234abcd-1234-abcd-12ab-12345678abcd
+spec:
+  tier: SecurityOps
+  priority: 5
+  appliedTo:
+  - podSelector:
+      matchLabels:
+        app: client
+  egress:
+  - action: Drop
+`,
+				`  appliedTo:
+  - podSelector:
+      matchLabels:
+        app: backend
+  ingress:
+  - action: Drop
+`,
+			},
+		},
+		{
+			name:          "Only the anomalies of the unwanted peers",
+			state:         "COMPLETED",
+			stats:         stats,
+			peers:         []string{"2001:db8::1", `default/{"app":"client"}`},
+			expectedCount: 2,
+			expectedPolicies: []string{
+				"cidr: 2001:db8::1/128",
+				"app: client",
+			},
+		},
+		{
+			name:        "No unwanted peer in the anomalies",
+			state:       "COMPLETED",
+			stats:       stats,
+			peers:       []string{"192.0.2.1"},
+			expectedMsg: fmt.Sprintf("No policy suggested for the anomalies of job %s\n", tadName),
+		},
+		{
+			name:        "No anomaly",
+			state:       "COMPLETED",
+			stats:       []anomalydetector.ThroughputAnomalyDetectorStats{{Id: tadName, Anomaly: "NO ANOMALY DETECTED"}},
+			expectedMsg: fmt.Sprintf("No Anomaly found in id: %s\n", tadName),
+		},
+		{
+			name:             "Job not completed",
+			state:            "RUNNING",
+			expectedErrorMsg: fmt.Sprintf("anomaly detection job %s is not completed, its status is RUNNING", tadName),
+		},
+		{
+			name:             "Pod not found",
+			state:            "COMPLETED",
+			stats:            stats[5:],
+			expectedErrorMsg: "failed to get the labels of Pod default/backend-0 of anomaly",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/throughputanomalydetectors/%s", tadName):
+					tad := &anomalydetector.ThroughputAnomalyDetector{
+						Status: anomalydetector.ThroughputAnomalyDetectorStatus{State: tt.state},
+						Stats:  tt.stats,
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(tad)
+				}
+			}))
+			defer testServer.Close()
+			oldSetupFunc := SetupTheiaClientAndConnection
+			oldCreateFunc := CreateK8sClient
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tt.objects...), nil
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldSetupFunc
+				CreateK8sClient = oldCreateFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("name", tadName, "")
+			cmd.Flags().StringArray("peer", tt.peers, "")
+			cmd.Flags().String("file", "", "")
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := throughputAnomalyDetectionSuggestPolicy(cmd, []string{})
+			outcome := readStdouttad(t, r, w)
+			if tt.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expectedMsg != "" {
+				assert.Equal(t, tt.expectedMsg, outcome)
+				return
+			}
+			documents := strings.Split(outcome, "---\n")
+			require.Len(t, documents, tt.expectedCount, "outcome: %s", outcome)
+			for _, policy := range tt.expectedPolicies {
+				assert.Contains(t, outcome, policy)
+			}
+		})
+	}
+}
+
+func TestSuggestPolicyNames(t *testing.T) {
+	stats := []anomalydetector.ThroughputAnomalyDetectorStats{{Anomaly: "true", AggType: "external", DestinationIP: "203.0.113.5"}}
+	policies, err := suggestPolicies("tad-1234abcd-1234-abcd-12ab-12345678abcd", stats, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	// The names of the policies only depend on the peers of the anomalies, so
+	// that the policies suggested by several jobs for the same peer replace
+	// each other when applied.
+	again, err := suggestPolicies("tad-5678abcd-1234-abcd-12ab-12345678abcd", stats, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, policies[0].Metadata.Name, again[0].Metadata.Name)
+	assert.Equal(t, "tad-5678abcd-1234-abcd-12ab-12345678abcd", again[0].Metadata.Annotations[suggestedPolicyAnnotation])
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/clickhouse/schema"
+)
+
+// generatedPasswordBytes is the number of random bytes of the generated
+// passwords, which are 32 characters long once encoded.
+const generatedPasswordBytes = 24
+
+// clickHouseCreateUserCmd represents the clickhouse create-user command
+var clickHouseCreateUserCmd = &cobra.Command{
+	Use:   "create-user NAME",
+	Short: "Create a ClickHouse user with a least-privilege role",
+	Long: `Create a ClickHouse user granted one of the least-privilege roles of the
+Theia database, or replace the user and its password if it exists, so that the
+components of Theia and the other clients of ClickHouse do not share the same
+credentials. The roles are:
+  writer: can only insert flow records, e.g. for the Flow Aggregator
+  reader: can only read the Theia tables, e.g. for Grafana
+  admin:  can read, alter and delete the Theia tables and read the system tables
+The password is read from the first line of the standard input with
+--password-stdin, otherwise a random password is generated and printed.`,
+	Args: cobra.ExactArgs(1),
+	Example: `
+Create a user for the Flow Aggregator with a generated password
+$ theia clickhouse create-user flow_aggregator --role writer
+Create a user for Grafana with the password of a file
+$ theia clickhouse create-user grafana --role reader --password-stdin < password.txt
+`,
+	RunE: clickHouseCreateUser,
+}
+
+func init() {
+	clickHouseCmd.AddCommand(clickHouseCreateUserCmd)
+	clickHouseCreateUserCmd.Flags().String(
+		"role",
+		"",
+		"The role of the user, one of writer, reader or admin.",
+	)
+	clickHouseCreateUserCmd.RegisterFlagCompletionFunc("role", cobra.FixedCompletions([]string{
+		string(schema.RoleWriter), string(schema.RoleReader), string(schema.RoleAdmin),
+	}, cobra.ShellCompDirectiveNoFileComp))
+	clickHouseCreateUserCmd.Flags().Bool(
+		"password-stdin",
+		false,
+		"Read the password of the user from the standard input, instead of generating it.",
+	)
+}
+
+func clickHouseCreateUser(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	roleName, err := cmd.Flags().GetString("role")
+	if err != nil {
+		return err
+	}
+	role, err := schema.ParseRole(roleName)
+	if err != nil {
+		return err
+	}
+	passwordStdin, err := cmd.Flags().GetBool("password-stdin")
+	if err != nil {
+		return err
+	}
+	var password string
+	if passwordStdin {
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("error when reading the password from the standard input: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	} else if password, err = generatePassword(); err != nil {
+		return err
+	}
+	if err := schema.ValidateUser(schema.User{Name: name, Password: password, Role: role}); err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	if err := createClickHouseUser(theiaClient, name, password, role); err != nil {
+		return err
+	}
+	fmt.Printf("ClickHouse user %s is created with role %s\n", name, role)
+	if !passwordStdin {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, generatedPasswordBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error when generating the password: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func createClickHouseUser(theiaClient restclient.Interface, name, password string, role schema.Role) error {
+	request := stats.ClickHouseUser{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Password:   password,
+		Role:       string(role),
+	}
+	var user stats.ClickHouseUser
+	err := theiaClient.Post().
+		AbsPath("/apis/stats.theia.antrea.io/v1alpha1/").
+		Resource("clickhouseusers").
+		Body(&request).
+		Do(context.TODO()).
+		Into(&user)
+	if apierrors.IsForbidden(err) {
+		return fmt.Errorf("failed to create the ClickHouse user, the theia-cli-admin ClusterRole must be bound to the theia-cli ServiceAccount: %v", err)
+	} else if err != nil {
+		return fmt.Errorf("failed to create the ClickHouse user: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestClickHouseCreateUser(t *testing.T) {
+	testCases := []struct {
+		name             string
+		userName         string
+		role             string
+		passwordStdin    bool
+		stdin            string
+		expectedPassword string
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:             "Password from stdin",
+			userName:         "grafana",
+			role:             "reader",
+			passwordStdin:    true,
+			stdin:            "grafana_password\n",
+			expectedPassword: "grafana_password",
+			expectedMsg:      []string{"ClickHouse user grafana is created with role reader"},
+		},
+		{
+			name:        "Generated password",
+			userName:    "flow_aggregator",
+			role:        "writer",
+			expectedMsg: []string{"ClickHouse user flow_aggregator is created with role writer", "Password: "},
+		},
+		{
+			name:             "Invalid role",
+			userName:         "grafana",
+			role:             "root",
+			expectedErrorMsg: "role \"root\" is not valid",
+		},
+		{
+			name:             "Invalid name",
+			userName:         "grafana'",
+			role:             "reader",
+			expectedErrorMsg: "user name \"grafana'\" is not valid",
+		},
+		{
+			name:             "Empty password",
+			userName:         "grafana",
+			role:             "reader",
+			passwordStdin:    true,
+			stdin:            "\n",
+			expectedErrorMsg: "password of user grafana should not be empty",
+		},
+		{
+			name:             "Access management disabled",
+			userName:         "admin",
+			role:             "admin",
+			expectedErrorMsg: "failed to create the ClickHouse user",
+		},
+		{
+			name:             "Admin ClusterRole not bound",
+			userName:         "forbidden",
+			role:             "reader",
+			expectedErrorMsg: "the theia-cli-admin ClusterRole must be bound to the theia-cli ServiceAccount",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			userName:         "grafana",
+			role:             "reader",
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || strings.TrimSpace(r.URL.Path) != "/apis/stats.theia.antrea.io/v1alpha1/clickhouseusers" {
+					http.NotFound(w, r)
+					return
+				}
+				var request stats.ClickHouseUser
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				assert.Equal(t, tt.userName, request.Name)
+				assert.Equal(t, tt.role, request.Role)
+				if tt.expectedPassword != "" {
+					assert.Equal(t, tt.expectedPassword, request.Password)
+				} else {
+					assert.Len(t, request.Password, 32)
+				}
+				if request.Name == "forbidden" {
+					status := apierrors.NewForbidden(stats.Resource("clickhouseusers"), request.Name, errors.New("access denied")).ErrStatus
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(status)
+					return
+				}
+				if request.Role == "admin" {
+					http.Error(w, "not enough privileges", http.StatusInternalServerError)
+					return
+				}
+				request.Password = ""
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(request)
+			}))
+			defer testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("role", tt.role, "")
+			cmd.Flags().Bool("password-stdin", tt.passwordStdin, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			cmd.SetIn(strings.NewReader(tt.stdin))
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := clickHouseCreateUser(cmd, []string{tt.userName})
+			outcome := readStdout(t, r, w)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+				if tt.passwordStdin {
+					assert.NotContains(t, outcome, "Password: ")
+				}
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/clickhouse"
+)
+
+// clickHouseMoveToColdStorageCmd represents the clickhouse move-to-cold-storage command
+var clickHouseMoveToColdStorageCmd = &cobra.Command{
+	Use:   "move-to-cold-storage",
+	Short: "Move the old flow records of ClickHouse to cold storage",
+	Long: `Set the TTL rules of the flow tables of ClickHouse, so that the flow records
+are moved to the cold volume of the tiered storage policy once they are older
+than the given interval, instead of staying on the hot volume until they are
+deleted. Cold storage must be enabled with clickhouse.storage.coldStorage.enable
+in the Helm values. The rules are set back to clickhouse.storage.coldStorage.moveAfter
+when ClickHouse restarts, which should be updated as well to keep them.`,
+	Args: cobra.NoArgs,
+	Example: `
+Move the flow records to cold storage after 7 days
+$ theia clickhouse move-to-cold-storage --after "7 DAY"
+Only move the flow records to cold storage when the hot volume is almost full
+$ theia clickhouse move-to-cold-storage --disable
+`,
+	RunE: clickHouseMoveToColdStorage,
+}
+
+func init() {
+	clickHouseCmd.AddCommand(clickHouseMoveToColdStorageCmd)
+	clickHouseMoveToColdStorageCmd.Flags().String(
+		"after",
+		"",
+		`The age after which the flow records are moved to cold storage, as a
+positive integer followed by one of SECOND, MINUTE, HOUR, DAY, WEEK, MONTH,
+QUARTER or YEAR, e.g. "7 DAY".`,
+	)
+	clickHouseMoveToColdStorageCmd.Flags().Bool(
+		"disable",
+		false,
+		"Remove the age after which the flow records are moved, so that they are only moved when the hot volume is almost full.",
+	)
+}
+
+func clickHouseMoveToColdStorage(cmd *cobra.Command, args []string) error {
+	after, err := cmd.Flags().GetString("after")
+	if err != nil {
+		return err
+	}
+	disable, err := cmd.Flags().GetBool("disable")
+	if err != nil {
+		return err
+	}
+	if disable == (after != "") {
+		return fmt.Errorf("exactly one of --after and --disable should be given")
+	}
+	after = strings.ToUpper(strings.TrimSpace(after))
+	if after != "" {
+		if err := clickhouse.ValidateInterval(after); err != nil {
+			return fmt.Errorf("invalid --after: %v", err)
+		}
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	coldStorage, err := setColdStorage(theiaClient, after)
+	if err != nil {
+		return err
+	}
+	if after != "" {
+		fmt.Printf("Flow records are moved to cold storage after %s in tables: %s\n", after, strings.Join(coldStorage.Tables, ", "))
+	} else {
+		fmt.Printf("Flow records are moved to cold storage when the hot volume is almost full in tables: %s\n", strings.Join(coldStorage.Tables, ", "))
+	}
+	fmt.Printf("Set clickhouse.storage.coldStorage.moveAfter to %q in the Helm values to keep this setting when ClickHouse restarts\n", after)
+	return nil
+}
+
+func setColdStorage(theiaClient restclient.Interface, moveAfter string) (coldStorage stats.ClickHouseColdStorage, err error) {
+	request := stats.ClickHouseColdStorage{
+		ObjectMeta: metav1.ObjectMeta{Name: "flows"},
+		MoveAfter:  moveAfter,
+	}
+	err = theiaClient.Post().
+		AbsPath("/apis/stats.theia.antrea.io/v1alpha1/").
+		Resource("coldstorage").
+		Body(&request).
+		Do(context.TODO()).
+		Into(&coldStorage)
+	if err != nil {
+		return coldStorage, fmt.Errorf("failed to set the cold storage of the flow records: %v", err)
+	}
+	return coldStorage, nil
+}
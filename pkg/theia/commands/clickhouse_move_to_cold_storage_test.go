@@ -0,0 +1,145 @@
+// Copyright 2022 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestClickHouseMoveToColdStorage(t *testing.T) {
+	testCases := []struct {
+		name              string
+		after             string
+		disable           bool
+		expectedMoveAfter string
+		expectedMsg       []string
+		expectedErrorMsg  string
+	}{
+		{
+			name:              "Move after 7 days",
+			after:             "7 day",
+			expectedMoveAfter: "7 DAY",
+			expectedMsg: []string{
+				"Flow records are moved to cold storage after 7 DAY in tables: flows_local, pod_view_table_local",
+				`Set clickhouse.storage.coldStorage.moveAfter to "7 DAY" in the Helm values`,
+			},
+		},
+		{
+			name:    "Disable",
+			disable: true,
+			expectedMsg: []string{
+				"Flow records are moved to cold storage when the hot volume is almost full in tables: flows_local, pod_view_table_local",
+				`Set clickhouse.storage.coldStorage.moveAfter to "" in the Helm values`,
+			},
+		},
+		{
+			name:             "Neither after nor disable",
+			expectedErrorMsg: "exactly one of --after and --disable should be given",
+		},
+		{
+			name:             "Both after and disable",
+			after:            "7 DAY",
+			disable:          true,
+			expectedErrorMsg: "exactly one of --after and --disable should be given",
+		},
+		{
+			name:             "Invalid interval",
+			after:            "7d",
+			expectedErrorMsg: "invalid --after: \"7D\" is not a valid interval",
+		},
+		{
+			name:              "Cold storage not enabled",
+			after:             "1 MONTH",
+			expectedMoveAfter: "1 MONTH",
+			expectedErrorMsg:  "failed to set the cold storage of the flow records",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			after:            "7 DAY",
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || strings.TrimSpace(r.URL.Path) != "/apis/stats.theia.antrea.io/v1alpha1/coldstorage" {
+					http.NotFound(w, r)
+					return
+				}
+				var request stats.ClickHouseColdStorage
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				assert.Equal(t, tt.expectedMoveAfter, request.MoveAfter)
+				if request.MoveAfter == "1 MONTH" {
+					http.Error(w, "storage policy tiered has no cold volume", http.StatusInternalServerError)
+					return
+				}
+				request.Tables = []string{"flows_local", "pod_view_table_local"}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(request)
+			}))
+			defer testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("after", tt.after, "")
+			cmd.Flags().Bool("disable", tt.disable, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := clickHouseMoveToColdStorage(cmd, []string{})
+			outcome := readStdout(t, r, w)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
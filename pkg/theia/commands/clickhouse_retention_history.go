@@ -0,0 +1,87 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"antrea.io/theia/pkg/util/format"
+)
+
+// clickHouseRetentionHistoryCmd represents the clickhouse retention-history command
+var clickHouseRetentionHistoryCmd = &cobra.Command{
+	Use:   "retention-history",
+	Short: "List the deletions of flow records by the ClickHouse monitor",
+	Long: `List the latest deletions of flow records by the ClickHouse monitor, which
+deletes the oldest records when the storage usage grows above its threshold.
+Each deletion shows the time range of the deleted records, their number, the
+estimated bytes reclaimed and the reason of the deletion, which explains the
+gaps in the dashboards.`,
+	Args: cobra.NoArgs,
+	Example: `
+List the deletions of flow records
+$ theia clickhouse retention-history
+List the deletions of flow records, with bytes as raw numbers
+$ theia clickhouse retention-history --raw
+`,
+	RunE: clickHouseRetentionHistory,
+}
+
+func init() {
+	clickHouseCmd.AddCommand(clickHouseRetentionHistoryCmd)
+	clickHouseRetentionHistoryCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print bytes as raw numbers instead of human-readable values.",
+	)
+}
+
+func clickHouseRetentionHistory(cmd *cobra.Command, args []string) error {
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	data, err := getClickHouseStatusByCategory(theiaClient, "retentionHistory")
+	if err != nil {
+		return fmt.Errorf("error when getting clickhouse retention history: %v", err)
+	}
+	for _, errorMsg := range data.ErrorMsg {
+		fmt.Printf("Error message: %s\n", errorMsg)
+	}
+	if len(data.RetentionHistory) == 0 {
+		fmt.Println("No flow records have been deleted by the ClickHouse monitor")
+		return nil
+	}
+	printer := format.Printer{Raw: raw}
+	result := [][]string{{"Shard", "TimeDeleted", "TableName", "RangeStart", "RangeEnd", "RowCount", "BytesReclaimed", "Reason"}}
+	for _, record := range data.RetentionHistory {
+		result = append(result, []string{record.Shard, record.TimeDeleted, record.TableName, record.RangeStart, record.RangeEnd, record.RowCount, printer.Bytes(record.BytesReclaimed), record.Reason})
+	}
+	TableOutput(result)
+	return nil
+}
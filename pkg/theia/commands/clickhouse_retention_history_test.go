@@ -0,0 +1,133 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestClickHouseRetentionHistory(t *testing.T) {
+	testServer := func(history []stats.DeletionRecord) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/retentionHistory":
+				status := &stats.ClickHouseStats{RetentionHistory: history}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(status)
+			}
+		}))
+	}
+	history := []stats.DeletionRecord{{
+		Shard:          "1",
+		TimeDeleted:    "2023-05-01 10:00:00",
+		TableName:      "default.flows",
+		RangeStart:     "2023-04-01 00:00:00",
+		RangeEnd:       "2023-04-15 00:00:00",
+		RowCount:       "1000",
+		BytesReclaimed: "1536",
+		Reason:         "storage usage 55.56 % above threshold 50.00 %",
+	}}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		raw              bool
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			testServer: testServer(history),
+			expectedMsg: []string{"TimeDeleted", "RangeStart", "RangeEnd", "RowCount", "BytesReclaimed", "Reason",
+				"2023-05-01 10:00:00", "default.flows", "2023-04-01 00:00:00", "2023-04-15 00:00:00", "1000", "1.50 KiB", "storage usage 55.56 % above threshold 50.00 %"},
+		},
+		{
+			name:        "Valid case with raw bytes",
+			testServer:  testServer(history),
+			raw:         true,
+			expectedMsg: []string{"default.flows", "1536"},
+		},
+		{
+			name:        "Empty history",
+			testServer:  testServer(nil),
+			expectedMsg: []string{"No flow records have been deleted by the ClickHouse monitor"},
+		},
+		{
+			name: "Failed to get retention history",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			expectedErrorMsg: "error when getting clickhouse retention history",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().Bool("raw", tt.raw, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := clickHouseRetentionHistory(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
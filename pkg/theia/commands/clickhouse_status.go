@@ -19,44 +19,71 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
 )
 
 type chOptions struct {
-	diskInfo   bool
-	tableInfo  bool
-	insertRate bool
-	stackTrace bool
+	diskInfo           bool
+	tableInfo          bool
+	insertRate         bool
+	insertRateLastHour bool
+	merges             bool
+	schemaVersion      bool
+	stackTrace         bool
+	raw                bool
 }
 
 var options *chOptions
 
 var clickHouseStatusCmd = &cobra.Command{
-	Use:     "status",
-	Short:   "Get diagnostic infos of ClickHouse database",
+	Use:   "status",
+	Short: "Get diagnostic infos of ClickHouse database",
+	Long: `Get diagnostic infos of ClickHouse database. Without any metric related
+flag, report the health of ClickHouse: the disk usage of every shard, the rows
+and the disk usage of every table, the insert rate over the last hour, the
+merges and mutations in progress and the version of the data schema. The
+command fails if any of them cannot be retrieved, after reporting the others.`,
 	Example: example,
 	Args:    cobra.NoArgs,
 	RunE:    getStatus,
 }
 
 var example = strings.Trim(`
+theia clickhouse status
 theia clickhouse status --diskInfo
 theia clickhouse status --diskInfo --tableInfo
 theia clickhouse status --diskInfo --tableInfo --insertRate
+theia clickhouse status --merges --schemaVersion
+theia clickhouse status --diskInfo --raw
 `, "\n")
 
+// clickHouseHealthSections are the metrics reported, with their titles, when
+// no metric related flag is specified.
+var clickHouseHealthSections = [][2]string{
+	{"diskInfo", "Disk usage"},
+	{"tableInfo", "Tables"},
+	{"insertRateLastHour", "Insert rate over the last hour"},
+	{"merges", "Merges in progress"},
+	{"schemaVersion", "Data schema version"},
+}
+
 func init() {
 	clickHouseCmd.AddCommand(clickHouseStatusCmd)
 	options = &chOptions{}
 	clickHouseStatusCmd.Flags().BoolVar(&options.diskInfo, "diskInfo", false, "check disk usage information")
 	clickHouseStatusCmd.Flags().BoolVar(&options.tableInfo, "tableInfo", false, "check basic table information")
 	clickHouseStatusCmd.Flags().BoolVar(&options.insertRate, "insertRate", false, "check the insertion-rate of clickhouse")
+	clickHouseStatusCmd.Flags().BoolVar(&options.insertRateLastHour, "insertRateLastHour", false, "check the average insertion-rate of clickhouse over the last hour")
+	clickHouseStatusCmd.Flags().BoolVar(&options.merges, "merges", false, "check the merges and mutations in progress")
+	clickHouseStatusCmd.Flags().BoolVar(&options.schemaVersion, "schemaVersion", false, "check the version of the data schema")
 	clickHouseStatusCmd.Flags().BoolVar(&options.stackTrace, "stackTrace", false, "check stacktrace of clickhouse")
+	clickHouseStatusCmd.Flags().BoolVar(&options.raw, "raw", false, "print sizes and rates as raw numbers instead of human-readable values")
 }
 
 func getStatus(cmd *cobra.Command, args []string) error {
-	if !options.diskInfo && !options.tableInfo && !options.insertRate && !options.stackTrace {
-		return fmt.Errorf("no metric related flag is specified")
-	}
 	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
 	if err != nil {
 		return err
@@ -68,6 +95,7 @@ func getStatus(cmd *cobra.Command, args []string) error {
 	if pf != nil {
 		defer pf.Stop()
 	}
+	printer := format.Printer{Raw: options.raw}
 	var names []string
 	if options.diskInfo {
 		names = append(names, "diskInfo")
@@ -78,11 +106,23 @@ func getStatus(cmd *cobra.Command, args []string) error {
 	if options.insertRate {
 		names = append(names, "insertRate")
 	}
+	if options.insertRateLastHour {
+		names = append(names, "insertRateLastHour")
+	}
+	if options.merges {
+		names = append(names, "merges")
+	}
+	if options.schemaVersion {
+		names = append(names, "schemaVersion")
+	}
 	if options.stackTrace {
 		names = append(names, "stackTrace")
 	}
+	if len(names) == 0 {
+		return printClickHouseHealth(theiaClient, printer)
+	}
 	for _, name := range names {
-		data, err := getClickHouseStatusByCategory(theiaClient, name)
+		data, err := getClickHouseStatusByCategory(theiaClient, clickHouseStatusCategory(name))
 		if err != nil {
 			return fmt.Errorf("error when getting clickhouse %v status: %s", name, err)
 		}
@@ -91,29 +131,7 @@ func getStatus(cmd *cobra.Command, args []string) error {
 				fmt.Printf("Error message: %s\n", errorMsg)
 			}
 		}
-		var result [][]string
-		switch name {
-		case "diskInfo":
-			result = append(result, []string{"Shard", "DatabaseName", "Path", "Free", "Total", "Used_Percentage"})
-			for _, diskInfo := range data.DiskInfos {
-				result = append(result, []string{diskInfo.Shard, diskInfo.Database, diskInfo.Path, diskInfo.FreeSpace, diskInfo.TotalSpace, diskInfo.UsedPercentage})
-			}
-		case "tableInfo":
-			result = append(result, []string{"Shard", "DatabaseName", "TableName", "TotalRows", "TotalBytes", "TotalCols"})
-			for _, tableInfo := range data.TableInfos {
-				result = append(result, []string{tableInfo.Shard, tableInfo.Database, tableInfo.TableName, tableInfo.TotalRows, tableInfo.TotalBytes, tableInfo.TotalCols})
-			}
-		case "insertRate":
-			result = append(result, []string{"Shard", "RowsPerSecond", "BytesPerSecond"})
-			for _, insertRate := range data.InsertRates {
-				result = append(result, []string{insertRate.Shard, insertRate.RowsPerSec, insertRate.BytesPerSec})
-			}
-		case "stackTrace":
-			result = append(result, []string{"Shard", "TraceFunctions", "Count()"})
-			for _, stackTrace := range data.StackTraces {
-				result = append(result, []string{stackTrace.Shard, stackTrace.TraceFunctions, stackTrace.Count})
-			}
-		}
+		result := clickHouseStatusTable(name, data, printer)
 		if name == "stackTrace" {
 			TableOutputVertical(result)
 		} else {
@@ -122,3 +140,101 @@ func getStatus(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+// printClickHouseHealth prints a section for every metric of
+// clickHouseHealthSections. The errors of a section are printed in place of
+// its table, and returned once all the sections are printed.
+func printClickHouseHealth(theiaClient restclient.Interface, printer format.Printer) error {
+	var failed []string
+	for _, section := range clickHouseHealthSections {
+		name := section[0]
+		err := printUsageSection(theiaClient, clickHouseStatusCategory(name), section[1], func(data stats.ClickHouseStats) [][]string {
+			return clickHouseStatusTable(name, data, printer)
+		})
+		if err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to get clickhouse %s status", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// clickHouseStatusCategory returns the category of the ClickHouse stats from
+// which a metric is computed.
+func clickHouseStatusCategory(name string) string {
+	if name == "merges" {
+		return "systemMetrics"
+	}
+	return name
+}
+
+// rawStat returns the raw value of a statistic, or its human-readable value
+// when the raw value is not returned by the Theia Manager, e.g. by older
+// versions.
+func rawStat(raw, formatted string) string {
+	if raw != "" {
+		return raw
+	}
+	return formatted
+}
+
+func clickHouseStatusTable(name string, data stats.ClickHouseStats, printer format.Printer) [][]string {
+	var result [][]string
+	switch name {
+	case "diskInfo":
+		result = append(result, []string{"Shard", "DatabaseName", "Path", "Free", "Total", "Used_Percentage"})
+		for _, diskInfo := range data.DiskInfos {
+			result = append(result, []string{diskInfo.Shard, diskInfo.Database, diskInfo.Path, printer.Bytes(rawStat(diskInfo.FreeSpaceRaw, diskInfo.FreeSpace)),
+				printer.Bytes(rawStat(diskInfo.TotalSpaceRaw, diskInfo.TotalSpace)), printer.Percentage(rawStat(diskInfo.UsedPercentageRaw, diskInfo.UsedPercentage))})
+		}
+	case "tableInfo":
+		result = append(result, []string{"Shard", "DatabaseName", "TableName", "TotalRows", "TotalBytes", "TotalCols"})
+		for _, tableInfo := range data.TableInfos {
+			result = append(result, []string{tableInfo.Shard, tableInfo.Database, tableInfo.TableName, tableInfo.TotalRows, printer.Bytes(rawStat(tableInfo.TotalBytesRaw, tableInfo.TotalBytes)), tableInfo.TotalCols})
+		}
+	case "insertRate", "insertRateLastHour":
+		result = append(result, []string{"Shard", "RowsPerSecond", "BytesPerSecond"})
+		for _, insertRate := range data.InsertRates {
+			result = append(result, []string{insertRate.Shard, insertRate.RowsPerSec, printer.Rate(rawStat(insertRate.BytesPerSecRaw, insertRate.BytesPerSec))})
+		}
+	case "merges":
+		result = clickHouseMergesTable(data)
+	case "schemaVersion":
+		result = append(result, []string{"Shard", "Version", "Dirty"})
+		for _, schemaVersion := range data.SchemaVersions {
+			result = append(result, []string{schemaVersion.Shard, schemaVersion.Version, schemaVersion.Dirty})
+		}
+	case "stackTrace":
+		result = append(result, []string{"Shard", "TraceFunctions", "Count()"})
+		for _, stackTrace := range data.StackTraces {
+			result = append(result, []string{stackTrace.Shard, stackTrace.TraceFunctions, stackTrace.Count})
+		}
+	}
+	return result
+}
+
+// clickHouseMergesTable returns the number of merges and mutations in
+// progress on every shard, from the system metrics of ClickHouse.
+func clickHouseMergesTable(data stats.ClickHouseStats) [][]string {
+	var shards []string
+	merges, mutations := map[string]string{}, map[string]string{}
+	for _, metric := range data.SystemMetrics {
+		if _, ok := merges[metric.Shard]; !ok {
+			shards = append(shards, metric.Shard)
+			merges[metric.Shard], mutations[metric.Shard] = "0", "0"
+		}
+		switch metric.Metric {
+		case "Merge":
+			merges[metric.Shard] = metric.Value
+		case "PartMutation":
+			mutations[metric.Shard] = metric.Value
+		}
+	}
+	result := [][]string{{"Shard", "Merges", "Mutations"}}
+	for _, shard := range shards {
+		result = append(result, []string{shard, merges[shard], mutations[shard]})
+	}
+	return result
+}
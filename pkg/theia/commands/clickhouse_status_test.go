@@ -65,6 +65,84 @@ func TestGetStatus(t *testing.T) {
 			expectedMsg: []string{"Shard", "DatabaseName", "Path", "Free", "Total", "Used_Percentage",
 				"Shard_test", "Database_test", "Path_test", "FreeSpace_test", "TotalSpace", "UsedPercentage_test"},
 		},
+		{
+			name: "Get diskInfo in human-readable format",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/diskInfo":
+					status := &stats.ClickHouseStats{
+						DiskInfos: []stats.DiskInfo{{
+							Shard:             "1",
+							Database:          "default",
+							Path:              "/var/lib/clickhouse/",
+							FreeSpace:         "888.00 KiB",
+							TotalSpace:        "100.00 MiB",
+							UsedPercentage:    "99.13 %",
+							FreeSpaceRaw:      "909312",
+							TotalSpaceRaw:     "104857600",
+							UsedPercentageRaw: "99.13",
+						}},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(status)
+				}
+			})),
+			options:          &chOptions{diskInfo: true},
+			expectedErrorMsg: "",
+			expectedMsg:      []string{"888.00 KiB", "100.00 MiB", "99.13 %"},
+		},
+		{
+			name: "Get diskInfo in raw format",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/diskInfo":
+					status := &stats.ClickHouseStats{
+						DiskInfos: []stats.DiskInfo{{
+							Shard:             "1",
+							Database:          "default",
+							Path:              "/var/lib/clickhouse/",
+							FreeSpace:         "888.00 KiB",
+							TotalSpace:        "100.00 MiB",
+							UsedPercentage:    "99.13 %",
+							FreeSpaceRaw:      "909312",
+							TotalSpaceRaw:     "104857600",
+							UsedPercentageRaw: "99.13",
+						}},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(status)
+				}
+			})),
+			options:          &chOptions{diskInfo: true, raw: true},
+			expectedErrorMsg: "",
+			expectedMsg:      []string{"909312", "104857600", "99.13"},
+		},
+		{
+			name: "Get diskInfo without raw values",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/diskInfo":
+					status := &stats.ClickHouseStats{
+						DiskInfos: []stats.DiskInfo{{
+							Shard:          "1",
+							Database:       "default",
+							Path:           "/var/lib/clickhouse/",
+							FreeSpace:      "888.00 KiB",
+							TotalSpace:     "100.00 MiB",
+							UsedPercentage: "99.13 %",
+						}},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(status)
+				}
+			})),
+			options:          &chOptions{diskInfo: true},
+			expectedErrorMsg: "",
+			expectedMsg:      []string{"888.00 KiB", "100.00 MiB", "99.13 %"},
+		},
 		{
 			name: "Get tableInfo",
 			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -135,10 +213,79 @@ func TestGetStatus(t *testing.T) {
 				"Shard_test", "TraceFunctions_test", "Count_test"},
 		},
 		{
-			name:             "No metrics specified",
-			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			name: "Get merges and schemaVersion",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var status *stats.ClickHouseStats
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/systemMetrics":
+					status = &stats.ClickHouseStats{
+						SystemMetrics: []stats.SystemMetric{
+							{Shard: "1", Metric: "Merge", Value: "3"},
+							{Shard: "1", Metric: "PartMutation", Value: "1"},
+						},
+					}
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/schemaVersion":
+					status = &stats.ClickHouseStats{
+						SchemaVersions: []stats.SchemaVersion{{Shard: "1", Version: "6", Dirty: "0"}},
+					}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(status)
+			})),
+			options:          &chOptions{merges: true, schemaVersion: true},
+			expectedErrorMsg: "",
+			expectedMsg:      []string{"Merges", "Mutations", "Version", "Dirty", "6"},
+		},
+		{
+			name: "No metrics specified",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var status *stats.ClickHouseStats
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/diskInfo":
+					status = &stats.ClickHouseStats{
+						DiskInfos: []stats.DiskInfo{{Shard: "1", Database: "default", Path: "/var/lib/clickhouse/", FreeSpace: "888.00 KiB", TotalSpace: "100.00 MiB", UsedPercentage: "99.13 %",
+							FreeSpaceRaw: "909312", TotalSpaceRaw: "104857600", UsedPercentageRaw: "99.13"}},
+					}
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/tableInfo":
+					status = &stats.ClickHouseStats{
+						TableInfos: []stats.TableInfo{{Shard: "1", Database: "default", TableName: "flows_local", TotalRows: "1000", TotalBytes: "2.00 KiB", TotalCols: "50", TotalBytesRaw: "2048"}},
+					}
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/insertRateLastHour":
+					status = &stats.ClickHouseStats{
+						InsertRates: []stats.InsertRate{{Shard: "1", RowsPerSec: "120", BytesPerSec: "4.00 KiB", BytesPerSecRaw: "4096"}},
+					}
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/systemMetrics":
+					status = &stats.ClickHouseStats{
+						SystemMetrics: []stats.SystemMetric{{Shard: "1", Metric: "Merge", Value: "2"}},
+					}
+				case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/schemaVersion":
+					status = &stats.ClickHouseStats{
+						SchemaVersions: []stats.SchemaVersion{{Shard: "1", Version: "6", Dirty: "0"}},
+					}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(status)
+			})),
+			options:          &chOptions{},
+			expectedErrorMsg: "",
+			expectedMsg: []string{"Disk usage", "99.13 %", "Tables", "flows_local", "2.00 KiB",
+				"Insert rate over the last hour", "120", "4.10 KB/s", "Merges in progress", "Data schema version"},
+		},
+		{
+			name: "No metrics specified with an unavailable metric",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.TrimSpace(r.URL.Path) == "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/insertRateLastHour" {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(&stats.ClickHouseStats{})
+			})),
 			options:          &chOptions{},
-			expectedErrorMsg: "no metric related flag is specified",
+			expectedErrorMsg: "failed to get clickhouse insertRateLastHour status",
 			expectedMsg:      nil,
 		},
 		{
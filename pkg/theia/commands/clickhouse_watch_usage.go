@@ -0,0 +1,223 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
+)
+
+// clickHouseWatchUsageCmd represents the clickhouse watch-usage command
+var clickHouseWatchUsageCmd = &cobra.Command{
+	Use:   "watch-usage",
+	Short: "Watch the storage usage of ClickHouse",
+	Long: `Show the disk usage of every ClickHouse shard and how close it is to the
+threshold of the ClickHouse monitor, the insert rate, the merges and mutations
+in progress and the largest tables, and refresh the view periodically until
+interrupted, e.g. to watch the storage during a load test or an incident. The
+headroom is the difference between the threshold, given by --threshold as
+clickhouse.monitor.threshold in the Helm chart, and the used percentage of the
+disk, above which the monitor deletes the oldest records. A section which
+cannot be refreshed shows the error, and the other sections are still
+refreshed.`,
+	Args: cobra.NoArgs,
+	Example: `
+Watch the storage usage of ClickHouse every 5 seconds
+$ theia clickhouse watch-usage
+Watch the storage usage every 30 seconds, for a monitor threshold of 0.8
+$ theia clickhouse watch-usage --interval 30s --threshold 0.8
+Show the storage usage and the 20 largest tables once
+$ theia clickhouse watch-usage --limit 20 --once
+`,
+	RunE: clickHouseWatchUsage,
+}
+
+func init() {
+	clickHouseCmd.AddCommand(clickHouseWatchUsageCmd)
+	clickHouseWatchUsageCmd.Flags().Duration(
+		"interval",
+		5*time.Second,
+		"The interval between two refreshes of the view.",
+	)
+	clickHouseWatchUsageCmd.Flags().Float64(
+		"threshold",
+		0.5,
+		"The storage percentage at which the ClickHouse monitor deletes old records, from 0 to 1.",
+	)
+	clickHouseWatchUsageCmd.Flags().Int(
+		"limit",
+		10,
+		"The maximum number of tables to show, the largest first.",
+	)
+	clickHouseWatchUsageCmd.Flags().Bool(
+		"once",
+		false,
+		"Print the view once instead of refreshing it.",
+	)
+	clickHouseWatchUsageCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print sizes, rates and percentages as raw numbers instead of human-readable values.",
+	)
+}
+
+func clickHouseWatchUsage(cmd *cobra.Command, args []string) error {
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval should be a positive duration")
+	}
+	threshold, err := cmd.Flags().GetFloat64("threshold")
+	if err != nil {
+		return err
+	}
+	if threshold <= 0 || threshold > 1 {
+		return fmt.Errorf("threshold should be a number in (0, 1]")
+	}
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+	if limit <= 0 {
+		return fmt.Errorf("limit should be a positive integer")
+	}
+	once, err := cmd.Flags().GetBool("once")
+	if err != nil {
+		return err
+	}
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	// Stop refreshing on interrupt, so that the port forwarding is stopped.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	printer := format.Printer{Raw: raw}
+	for {
+		if !once {
+			fmt.Print(clearScreen)
+			fmt.Printf("ClickHouse usage, refreshed every %s at %s\n\n", interval, time.Now().Format(time.TimeOnly))
+		}
+		printClickHouseUsage(theiaClient, threshold, limit, printer)
+		if once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// printClickHouseUsage prints the sections of the view. The errors of a
+// section are printed in place of its table.
+func printClickHouseUsage(theiaClient restclient.Interface, threshold float64, limit int, printer format.Printer) {
+	thresholdPercentage := threshold * 100
+	printUsageSection(theiaClient, "diskInfo", fmt.Sprintf("Disk usage (monitor threshold %s)", format.Percentage(thresholdPercentage)), func(data stats.ClickHouseStats) [][]string {
+		result := [][]string{{"Shard", "Path", "Free", "Total", "Used_Percentage", "Headroom"}}
+		for _, diskInfo := range data.DiskInfos {
+			result = append(result, []string{diskInfo.Shard, diskInfo.Path, printer.Bytes(rawStat(diskInfo.FreeSpaceRaw, diskInfo.FreeSpace)),
+				printer.Bytes(rawStat(diskInfo.TotalSpaceRaw, diskInfo.TotalSpace)), printer.Percentage(rawStat(diskInfo.UsedPercentageRaw, diskInfo.UsedPercentage)),
+				formatHeadroom(rawStat(diskInfo.UsedPercentageRaw, diskInfo.UsedPercentage), thresholdPercentage, printer)})
+		}
+		return result
+	})
+	printUsageSection(theiaClient, "insertRate", "Insert rate", func(data stats.ClickHouseStats) [][]string {
+		result := [][]string{{"Shard", "RowsPerSecond", "BytesPerSecond"}}
+		for _, insertRate := range data.InsertRates {
+			result = append(result, []string{insertRate.Shard, insertRate.RowsPerSec, printer.Rate(rawStat(insertRate.BytesPerSecRaw, insertRate.BytesPerSec))})
+		}
+		return result
+	})
+	printUsageSection(theiaClient, "systemMetrics", "Merges in progress", clickHouseMergesTable)
+	printUsageSection(theiaClient, "tableInfo", fmt.Sprintf("Largest tables (top %d)", limit), func(data stats.ClickHouseStats) [][]string {
+		tables := data.TableInfos
+		sort.SliceStable(tables, func(i, j int) bool {
+			return parseBytes(rawStat(tables[i].TotalBytesRaw, tables[i].TotalBytes)) > parseBytes(rawStat(tables[j].TotalBytesRaw, tables[j].TotalBytes))
+		})
+		if len(tables) > limit {
+			tables = tables[:limit]
+		}
+		result := [][]string{{"Shard", "DatabaseName", "TableName", "TotalRows", "TotalBytes"}}
+		for _, tableInfo := range tables {
+			result = append(result, []string{tableInfo.Shard, tableInfo.Database, tableInfo.TableName, tableInfo.TotalRows, printer.Bytes(rawStat(tableInfo.TotalBytesRaw, tableInfo.TotalBytes))})
+		}
+		return result
+	})
+}
+
+// printUsageSection prints the title and the table of a section, or the error
+// getting its data, which is returned.
+func printUsageSection(theiaClient restclient.Interface, name, title string, table func(data stats.ClickHouseStats) [][]string) error {
+	fmt.Println(title)
+	data, err := getClickHouseStatusByCategory(theiaClient, name)
+	if err != nil {
+		fmt.Printf("Error message: %v\n\n", err)
+		return err
+	}
+	for _, errorMsg := range data.ErrorMsg {
+		fmt.Printf("Error message: %s\n", errorMsg)
+	}
+	TableOutput(table(data))
+	fmt.Println()
+	return nil
+}
+
+// formatHeadroom returns the difference between the threshold and the used
+// percentage of a disk, in percentage points.
+func formatHeadroom(usedPercentage string, thresholdPercentage float64, printer format.Printer) string {
+	used, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(usedPercentage, "%")), 64)
+	if err != nil {
+		return "N/A"
+	}
+	headroom := thresholdPercentage - used
+	if headroom < 0 && !printer.Raw {
+		return "above threshold"
+	}
+	return printer.Percentage(strconv.FormatFloat(headroom, 'f', 2, 64))
+}
+
+func parseBytes(value string) uint64 {
+	n, _ := format.ParseBytes(value)
+	return n
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestClickHouseWatchUsage(t *testing.T) {
+	usageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status *stats.ClickHouseStats
+		switch strings.TrimSpace(r.URL.Path) {
+		case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/diskInfo":
+			status = &stats.ClickHouseStats{DiskInfos: []stats.DiskInfo{
+				{Shard: "1", Database: "default", Path: "/var/lib/clickhouse/", FreeSpace: "6.00 GiB", TotalSpace: "8.00 GiB", UsedPercentage: "25.00 %",
+					FreeSpaceRaw: "6442450944", TotalSpaceRaw: "8589934592", UsedPercentageRaw: "25.00"},
+				{Shard: "2", Database: "default", Path: "/var/lib/clickhouse/", FreeSpace: "2.00 GiB", TotalSpace: "8.00 GiB", UsedPercentage: "75.00 %",
+					FreeSpaceRaw: "2147483648", TotalSpaceRaw: "8589934592", UsedPercentageRaw: "75.00"},
+			}}
+		case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/tableInfo":
+			status = &stats.ClickHouseStats{TableInfos: []stats.TableInfo{
+				{Shard: "1", Database: "default", TableName: "pod_view_table_local", TotalRows: "100", TotalBytes: "1.00 KiB", TotalCols: "20", TotalBytesRaw: "1024"},
+				{Shard: "1", Database: "default", TableName: "flows_local", TotalRows: "5000", TotalBytes: "1.50 GiB", TotalCols: "50", TotalBytesRaw: "1610612736"},
+				{Shard: "2", Database: "default", TableName: "flows_local", TotalRows: "4000", TotalBytes: "1.00 GiB", TotalCols: "50", TotalBytesRaw: "1073741824"},
+			}}
+		case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/systemMetrics":
+			status = &stats.ClickHouseStats{SystemMetrics: []stats.SystemMetric{
+				{Shard: "1", Metric: "Merge", Value: "3"},
+				{Shard: "1", Metric: "PartMutation", Value: "1"},
+				{Shard: "1", Metric: "Query", Value: "2"},
+				{Shard: "2", Metric: "Query", Value: "1"},
+			}}
+		default:
+			http.Error(w, "no insertRate data is returned by database", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(status)
+	}))
+	defer usageServer.Close()
+	testCases := []struct {
+		name             string
+		threshold        float64
+		limit            int
+		raw              bool
+		expectedMsg      []string
+		unexpectedMsg    []string
+		expectedErrorMsg string
+	}{
+		{
+			name:      "Valid case",
+			threshold: 0.5,
+			limit:     2,
+			expectedMsg: []string{
+				"Disk usage (monitor threshold 50.00 %)",
+				"Shard", "Path", "Free", "Total", "Used_Percentage", "Headroom",
+				"6.00 GiB", "8.00 GiB", "25.00 %", "above threshold",
+				"Insert rate", "Error message: failed to get clickhouse insertRate status",
+				"Merges in progress", "Merges", "Mutations",
+				"Largest tables (top 2)", "flows_local", "1.50 GiB", "1.00 GiB",
+			},
+			unexpectedMsg: []string{"pod_view_table_local"},
+		},
+		{
+			name:        "Valid case with raw numbers",
+			threshold:   0.5,
+			limit:       10,
+			raw:         true,
+			expectedMsg: []string{"6442450944", "25.00", "-25.00", "pod_view_table_local", "1024"},
+		},
+		{
+			name:             "Invalid threshold",
+			threshold:        50,
+			limit:            10,
+			expectedErrorMsg: "threshold should be a number in (0, 1]",
+		},
+		{
+			name:             "Invalid limit",
+			threshold:        0.5,
+			expectedErrorMsg: "limit should be a positive integer",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			threshold:        0.5,
+			limit:            10,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: usageServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().Duration("interval", time.Second, "")
+			cmd.Flags().Float64("threshold", tt.threshold, "")
+			cmd.Flags().Int("limit", tt.limit, "")
+			cmd.Flags().Bool("once", true, "")
+			cmd.Flags().Bool("raw", tt.raw, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := clickHouseWatchUsage(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				assert.NotContains(t, outcome, clearScreen)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+				for _, msg := range tt.unexpectedMsg {
+					assert.NotContains(t, outcome, msg)
+				}
+				if !tt.raw {
+					assert.Regexp(t, `1\s+3\s+1`, outcome)
+					assert.Regexp(t, `2\s+0\s+0`, outcome)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
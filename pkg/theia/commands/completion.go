@@ -0,0 +1,171 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	policyRecommendationResource = "networkpolicyrecommendations"
+	anomalyDetectorResource      = "throughputanomalydetectors"
+	analyticsJobResource         = "analyticsjobs"
+)
+
+// completionCmd represents the completion command
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish]",
+	Short: "Generate the shell completion script",
+	Long: `Generate the completion script of theia for the specified shell.
+Besides commands and flags, the completion completes the names of the policy
+recommendation, anomaly detection and analytics jobs of the Theia instance, as well as the
+names of the Theia contexts.
+
+Bash: the completion script depends on the bash-completion package.
+  $ source <(theia completion bash)
+  To load the completion for each session, execute once:
+  $ theia completion bash > /etc/bash_completion.d/theia
+
+Zsh: if shell completion is not already enabled, execute once:
+  $ echo "autoload -U compinit; compinit" >> ~/.zshrc
+  To load the completion for each session, execute once:
+  $ theia completion zsh > "${fpath[1]}/_theia"
+
+Fish:
+  $ theia completion fish | source
+  To load the completion for each session, execute once:
+  $ theia completion fish > ~/.config/fish/completions/theia.fish`,
+	Example: `
+Load the bash completion in the current shell
+$ source <(theia completion bash)
+`,
+	DisableFlagsInUseLine: true,
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	RunE:                  completion,
+}
+
+func init() {
+	// The completion command of cobra is replaced by ours, which documents
+	// the supported shells only.
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(completionCmd)
+}
+
+func completion(cmd *cobra.Command, args []string) error {
+	out := cmd.OutOrStdout()
+	switch args[0] {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(out, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(out)
+	case "fish":
+		return rootCmd.GenFishCompletion(out, true)
+	}
+	return fmt.Errorf("unsupported shell %q", args[0])
+}
+
+// completeJobNames completes the names of the jobs of the given resource,
+// one of the resources of jobKinds.
+func completeJobNames(resource string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		names, err := listJobNames(cmd, resource)
+		if err != nil {
+			cobra.CompErrorln(err.Error())
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return filterCompletions(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeJobNameArg completes the job name given as the only argument of a
+// command.
+func completeJobNameArg(resource string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	complete := completeJobNames(resource)
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		if name, _ := cmd.Flags().GetString("name"); name != "" {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return complete(cmd, args, toComplete)
+	}
+}
+
+// listJobNames lists the names of the jobs of the given resource. As it is
+// called during completion, before the root command selected the Theia
+// instance, the Theia context is applied first.
+func listJobNames(cmd *cobra.Command, resource string) ([]string, error) {
+	if err := applyTheiaContext(cmd); err != nil {
+		return nil, err
+	}
+	kind, ok := jobKinds[resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown job resource %q", resource)
+	}
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	jobs, err := kind.list(theiaClient, "")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, job := range jobs {
+		names = append(names, kind.status(job).name)
+	}
+	return names, nil
+}
+
+// completeContextNames completes the names of the Theia contexts.
+func completeContextNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c, err := loadTheiaConfig()
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for _, context := range c.Contexts {
+		names = append(names, context.Name)
+	}
+	return filterCompletions(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeContextNameArg completes the context name given as the only
+// argument of a command.
+func completeContextNameArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeContextNames(cmd, args, toComplete)
+}
+
+func filterCompletions(candidates []string, toComplete string) []string {
+	var completions []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, toComplete) {
+			completions = append(completions, candidate)
+		}
+	}
+	return completions
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			var b bytes.Buffer
+			cmd := new(cobra.Command)
+			cmd.SetOut(&b)
+			require.NoError(t, completion(cmd, []string{shell}))
+			assert.Contains(t, b.String(), "theia")
+		})
+	}
+}
+
+func TestCompleteJobNames(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var list interface{}
+		switch strings.TrimSpace(r.URL.Path) {
+		case "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations":
+			list = &intelligence.NetworkPolicyRecommendationList{
+				Items: []intelligence.NetworkPolicyRecommendation{
+					{ObjectMeta: metav1.ObjectMeta{Name: "pr-e292395c-3de1-11ed-b878-0242ac120002"}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "pr-f3a5e0d4-3de1-11ed-b878-0242ac120002"}},
+				},
+			}
+		case "/apis/intelligence.theia.antrea.io/v1alpha1/throughputanomalydetectors":
+			list = &intelligence.ThroughputAnomalyDetectorList{
+				Items: []intelligence.ThroughputAnomalyDetector{
+					{ObjectMeta: metav1.ObjectMeta{Name: "tad-e292395c-3de1-11ed-b878-0242ac120002"}},
+				},
+			}
+		default:
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(list)
+	}))
+	defer testServer.Close()
+	oldFunc := SetupTheiaClientAndConnection
+	SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+		clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+		clientset, _ := kubernetes.NewForConfig(clientConfig)
+		return clientset.CoreV1().RESTClient(), nil, nil
+	}
+	defer func() {
+		SetupTheiaClientAndConnection = oldFunc
+	}()
+	t.Setenv(theiaConfigEnvKey, filepath.Join(t.TempDir(), "config"))
+
+	testCases := []struct {
+		name                string
+		resource            string
+		args                []string
+		nameFlag            string
+		toComplete          string
+		expectedCompletions []string
+		expectedDirective   cobra.ShellCompDirective
+	}{
+		{
+			name:       "Policy recommendation jobs",
+			resource:   policyRecommendationResource,
+			toComplete: "pr-",
+			expectedCompletions: []string{
+				"pr-e292395c-3de1-11ed-b878-0242ac120002",
+				"pr-f3a5e0d4-3de1-11ed-b878-0242ac120002",
+			},
+			expectedDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:                "Policy recommendation jobs with prefix",
+			resource:            policyRecommendationResource,
+			toComplete:          "pr-f",
+			expectedCompletions: []string{"pr-f3a5e0d4-3de1-11ed-b878-0242ac120002"},
+			expectedDirective:   cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:                "Anomaly detection jobs",
+			resource:            anomalyDetectorResource,
+			expectedCompletions: []string{"tad-e292395c-3de1-11ed-b878-0242ac120002"},
+			expectedDirective:   cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:              "Job name already given as argument",
+			resource:          policyRecommendationResource,
+			args:              []string{"pr-e292395c-3de1-11ed-b878-0242ac120002"},
+			expectedDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:              "Job name already given by flag",
+			resource:          policyRecommendationResource,
+			nameFlag:          "pr-e292395c-3de1-11ed-b878-0242ac120002",
+			expectedDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:              "Failed to list jobs",
+			resource:          "unknown",
+			expectedDirective: cobra.ShellCompDirectiveError,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := new(cobra.Command)
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			cmd.Flags().String("name", tt.nameFlag, "")
+			completions, directive := completeJobNameArg(tt.resource)(cmd, tt.args, tt.toComplete)
+			assert.Equal(t, tt.expectedCompletions, completions)
+			assert.Equal(t, tt.expectedDirective, directive)
+		})
+	}
+}
+
+func TestCompleteContextNames(t *testing.T) {
+	t.Setenv(theiaConfigEnvKey, filepath.Join(t.TempDir(), "config"))
+	require.NoError(t, saveTheiaConfig(&theiaConfig{
+		Contexts: []theiaContext{
+			{Name: "prod", Namespace: "flow-visibility"},
+			{Name: "staging", Namespace: "theia-staging"},
+		},
+	}))
+
+	completions, directive := completeContextNameArg(contextUseCmd, nil, "")
+	assert.Equal(t, []string{"prod", "staging"}, completions)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	completions, _ = completeContextNames(rootCmd, nil, "st")
+	assert.Equal(t, []string{"staging"}, completions)
+
+	completions, _ = completeContextNameArg(contextUseCmd, []string{"prod"}, "")
+	assert.Empty(t, completions)
+}
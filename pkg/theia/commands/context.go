@@ -0,0 +1,295 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"antrea.io/theia/pkg/theia/commands/config"
+)
+
+const (
+	// theiaConfigEnvKey is the environment variable overriding the path of
+	// the theia configuration file.
+	theiaConfigEnvKey = "THEIACONFIG"
+)
+
+// Name of the Theia context to use, set by the --context flag.
+var theiaContextName string
+
+// theiaContext selects a Theia instance: the Namespace it is installed in
+// and, optionally, the kubeconfig file used to access its cluster.
+type theiaContext struct {
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace"`
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+}
+
+// theiaConfig is the content of the theia configuration file.
+type theiaConfig struct {
+	CurrentContext string         `yaml:"currentContext,omitempty"`
+	Contexts       []theiaContext `yaml:"contexts,omitempty"`
+}
+
+func (c *theiaConfig) getContext(name string) *theiaContext {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i]
+		}
+	}
+	return nil
+}
+
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Commands to select the Theia instance to access",
+	Long: `Command group to manage the contexts of the theia configuration file.
+A context selects a Theia instance by the Namespace it is installed in, and
+optionally by the kubeconfig file of its cluster, so that several Theia
+instances can be accessed, e.g. staging and production ones.
+Must specify a subcommand like set, use, list or delete.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Error: must also specify a subcommand to run like set, use, list or delete")
+	},
+}
+
+var contextSetCmd = &cobra.Command{
+	Use:   "set NAME",
+	Short: "Create or update a Theia context",
+	Long: `Create or update a Theia context with the Namespace given by
+--theia-namespace and the kubeconfig file given by --kubeconfig.`,
+	Example: `
+Create a context for a Theia instance installed in Namespace theia-staging
+$ theia context set staging --theia-namespace theia-staging
+Create a context for a Theia instance of another cluster
+$ theia context set prod --theia-namespace flow-visibility --kubeconfig ~/.kube/prod
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: contextSet,
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use NAME",
+	Short: "Set the current Theia context",
+	Example: `
+Access the Theia instance of context staging by default
+$ theia context use staging
+Access the Theia instance of context prod for a single command
+$ theia policy-recommendation list --context prod
+`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeContextNameArg,
+	RunE:              contextUse,
+}
+
+var contextListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the Theia contexts",
+	Args:    cobra.NoArgs,
+	RunE:    contextList,
+}
+
+var contextDeleteCmd = &cobra.Command{
+	Use:               "delete NAME",
+	Short:             "Delete a Theia context",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeContextNameArg,
+	RunE:              contextDelete,
+}
+
+func getTheiaConfigPath() (string, error) {
+	if path := os.Getenv(theiaConfigEnvKey); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error when getting the home directory: %v", err)
+	}
+	return filepath.Join(home, ".theia", "config"), nil
+}
+
+// loadTheiaConfig loads the theia configuration file. An empty configuration
+// is returned if the file does not exist.
+func loadTheiaConfig() (*theiaConfig, error) {
+	path, err := getTheiaConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	c := &theiaConfig{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error when reading the theia configuration file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("error when parsing the theia configuration file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+func saveTheiaConfig(c *theiaConfig) error {
+	path, err := getTheiaConfigPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("error when encoding the theia configuration: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error when creating the directory of the theia configuration file: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error when writing the theia configuration file: %v", err)
+	}
+	return nil
+}
+
+// applyTheiaContext selects the Theia instance to access from the context
+// given by --context, or from the current context. The --theia-namespace and
+// --kubeconfig flags take precedence over the context.
+func applyTheiaContext(cmd *cobra.Command) error {
+	c, err := loadTheiaConfig()
+	if err != nil {
+		return err
+	}
+	name := theiaContextName
+	if name == "" {
+		name = c.CurrentContext
+	}
+	if name == "" {
+		return nil
+	}
+	context := c.getContext(name)
+	if context == nil {
+		return fmt.Errorf("context %q not found in the theia configuration file", name)
+	}
+	if flag := cmd.Flags().Lookup("theia-namespace"); flag == nil || !flag.Changed {
+		theiaNamespace = context.Namespace
+	}
+	contextKubeconfig = context.Kubeconfig
+	return nil
+}
+
+func contextSet(cmd *cobra.Command, args []string) error {
+	c, err := loadTheiaConfig()
+	if err != nil {
+		return err
+	}
+	context := c.getContext(args[0])
+	if context == nil {
+		c.Contexts = append(c.Contexts, theiaContext{Name: args[0], Namespace: config.FlowVisibilityNS})
+		context = &c.Contexts[len(c.Contexts)-1]
+	}
+	if cmd.Flags().Changed("theia-namespace") {
+		context.Namespace, err = cmd.Flags().GetString("theia-namespace")
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("kubeconfig") {
+		context.Kubeconfig, err = cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+	}
+	if err := saveTheiaConfig(c); err != nil {
+		return err
+	}
+	fmt.Printf("Theia context %q set to Namespace %s\n", context.Name, context.Namespace)
+	return nil
+}
+
+func contextUse(cmd *cobra.Command, args []string) error {
+	c, err := loadTheiaConfig()
+	if err != nil {
+		return err
+	}
+	if c.getContext(args[0]) == nil {
+		return fmt.Errorf("context %q not found in the theia configuration file", args[0])
+	}
+	c.CurrentContext = args[0]
+	if err := saveTheiaConfig(c); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to Theia context %q\n", args[0])
+	return nil
+}
+
+func contextList(cmd *cobra.Command, args []string) error {
+	c, err := loadTheiaConfig()
+	if err != nil {
+		return err
+	}
+	if len(c.Contexts) == 0 {
+		fmt.Printf("No Theia context found, Namespace %s is used by default\n", config.FlowVisibilityNS)
+		return nil
+	}
+	table := [][]string{{"Current", "Name", "Namespace", "Kubeconfig"}}
+	for _, context := range c.Contexts {
+		current := ""
+		if context.Name == c.CurrentContext {
+			current = "*"
+		}
+		kubeconfig := context.Kubeconfig
+		if kubeconfig == "" {
+			kubeconfig = "N/A"
+		}
+		table = append(table, []string{current, context.Name, context.Namespace, kubeconfig})
+	}
+	TableOutput(table)
+	return nil
+}
+
+func contextDelete(cmd *cobra.Command, args []string) error {
+	c, err := loadTheiaConfig()
+	if err != nil {
+		return err
+	}
+	if c.getContext(args[0]) == nil {
+		return fmt.Errorf("context %q not found in the theia configuration file", args[0])
+	}
+	contexts := c.Contexts[:0]
+	for _, context := range c.Contexts {
+		if context.Name != args[0] {
+			contexts = append(contexts, context)
+		}
+	}
+	c.Contexts = contexts
+	if c.CurrentContext == args[0] {
+		c.CurrentContext = ""
+	}
+	if err := saveTheiaConfig(c); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted Theia context %q\n", args[0])
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextSetCmd)
+	contextCmd.AddCommand(contextUseCmd)
+	contextCmd.AddCommand(contextListCmd)
+	contextCmd.AddCommand(contextDeleteCmd)
+}
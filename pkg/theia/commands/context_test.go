@@ -0,0 +1,182 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"antrea.io/theia/pkg/theia/commands/config"
+)
+
+func newContextTestCommand(namespace, kubeconfig string) *cobra.Command {
+	cmd := new(cobra.Command)
+	cmd.Flags().String("theia-namespace", config.FlowVisibilityNS, "")
+	cmd.Flags().String("kubeconfig", "", "")
+	if namespace != "" {
+		cmd.Flags().Set("theia-namespace", namespace)
+	}
+	if kubeconfig != "" {
+		cmd.Flags().Set("kubeconfig", kubeconfig)
+	}
+	return cmd
+}
+
+func TestContextCommands(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "theia", "config")
+	t.Setenv(theiaConfigEnvKey, configPath)
+
+	orig := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	require.NoError(t, contextList(new(cobra.Command), nil))
+	assert.Contains(t, readStdout(t, r, w), "No Theia context found, Namespace flow-visibility is used by default")
+
+	require.NoError(t, contextSet(newContextTestCommand("theia-staging", ""), []string{"staging"}))
+	require.NoError(t, contextSet(newContextTestCommand("", "/tmp/prod-kubeconfig"), []string{"prod"}))
+	// Updating a context keeps the values which are not specified.
+	require.NoError(t, contextSet(newContextTestCommand("", "/tmp/staging-kubeconfig"), []string{"staging"}))
+	assert.ErrorContains(t, contextUse(new(cobra.Command), []string{"dev"}), `context "dev" not found`)
+	require.NoError(t, contextUse(new(cobra.Command), []string{"staging"}))
+
+	c, err := loadTheiaConfig()
+	require.NoError(t, err)
+	assert.Equal(t, &theiaConfig{
+		CurrentContext: "staging",
+		Contexts: []theiaContext{
+			{Name: "staging", Namespace: "theia-staging", Kubeconfig: "/tmp/staging-kubeconfig"},
+			{Name: "prod", Namespace: config.FlowVisibilityNS, Kubeconfig: "/tmp/prod-kubeconfig"},
+		},
+	}, c)
+
+	r, w, _ = os.Pipe()
+	os.Stdout = w
+	require.NoError(t, contextList(new(cobra.Command), nil))
+	outcome := readStdout(t, r, w)
+	assert.Contains(t, outcome, "Current")
+	assert.Regexp(t, `\*\s+staging\s+theia-staging\s+/tmp/staging-kubeconfig`, outcome)
+	assert.Regexp(t, `\s+prod\s+flow-visibility\s+/tmp/prod-kubeconfig`, outcome)
+
+	// Deleting the current context unsets it.
+	require.NoError(t, contextDelete(new(cobra.Command), []string{"staging"}))
+	assert.ErrorContains(t, contextDelete(new(cobra.Command), []string{"staging"}), `context "staging" not found`)
+	c, err = loadTheiaConfig()
+	require.NoError(t, err)
+	assert.Equal(t, &theiaConfig{
+		Contexts: []theiaContext{
+			{Name: "prod", Namespace: config.FlowVisibilityNS, Kubeconfig: "/tmp/prod-kubeconfig"},
+		},
+	}, c)
+}
+
+func TestApplyTheiaContext(t *testing.T) {
+	testCases := []struct {
+		name               string
+		configContent      string
+		contextName        string
+		namespaceFlag      string
+		expectedNamespace  string
+		expectedKubeconfig string
+		expectedErrorMsg   string
+	}{
+		{
+			name:              "No configuration file",
+			expectedNamespace: config.FlowVisibilityNS,
+		},
+		{
+			name: "Current context",
+			configContent: `currentContext: staging
+contexts:
+- name: staging
+  namespace: theia-staging
+  kubeconfig: /tmp/staging-kubeconfig
+- name: prod
+  namespace: theia-prod
+`,
+			expectedNamespace:  "theia-staging",
+			expectedKubeconfig: "/tmp/staging-kubeconfig",
+		},
+		{
+			name: "Context given by flag",
+			configContent: `currentContext: staging
+contexts:
+- name: staging
+  namespace: theia-staging
+- name: prod
+  namespace: theia-prod
+`,
+			contextName:       "prod",
+			expectedNamespace: "theia-prod",
+		},
+		{
+			name: "Namespace given by flag",
+			configContent: `currentContext: staging
+contexts:
+- name: staging
+  namespace: theia-staging
+`,
+			namespaceFlag:     "theia-dev",
+			expectedNamespace: "theia-dev",
+		},
+		{
+			name: "Context not found",
+			configContent: `contexts:
+- name: staging
+  namespace: theia-staging
+`,
+			contextName:      "prod",
+			expectedErrorMsg: `context "prod" not found in the theia configuration file`,
+		},
+		{
+			name:             "Invalid configuration file",
+			configContent:    "current-context: staging\n",
+			expectedErrorMsg: "error when parsing the theia configuration file",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config")
+			if tt.configContent != "" {
+				require.NoError(t, os.WriteFile(configPath, []byte(tt.configContent), 0600))
+			}
+			t.Setenv(theiaConfigEnvKey, configPath)
+			oldContextName, oldNamespace, oldKubeconfig := theiaContextName, theiaNamespace, contextKubeconfig
+			defer func() {
+				theiaContextName, theiaNamespace, contextKubeconfig = oldContextName, oldNamespace, oldKubeconfig
+			}()
+			theiaContextName = tt.contextName
+			cmd := new(cobra.Command)
+			cmd.Flags().StringVar(&theiaNamespace, "theia-namespace", config.FlowVisibilityNS, "")
+			if tt.namespaceFlag != "" {
+				cmd.Flags().Set("theia-namespace", tt.namespaceFlag)
+			}
+
+			err := applyTheiaContext(cmd)
+			if tt.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedNamespace, theiaNamespace)
+			assert.Equal(t, tt.expectedKubeconfig, contextKubeconfig)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// resolutionUsage is the usage of the --resolution flag of the flows
+// subcommands which can be computed from the rollups of the flow records.
+const resolutionUsage = `The resolution of the flow records the statistics are computed from, one of
+auto, raw, 1m and 1h. raw selects the flow records, 1m and 1h their rollups by
+minute and by hour, and auto selects raw for windows shorter than 1 hour, 1m
+for windows shorter than 60 hours and 1h otherwise.`
+
+// flowsCmd represents the flows command group
+var flowsCmd = &cobra.Command{
+	Use:   "flows",
+	Short: "Commands to inspect the flow records stored by Theia",
+	Long: `Command group to inspect the flow records stored by Theia.
+	Must specify a subcommand like count-distinct or traffic-classes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Error: Must also specify a subcommand like count-distinct or traffic-classes")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(flowsCmd)
+	flowsCmd.PersistentFlags().Bool(
+		"use-cluster-ip",
+		false,
+		`Enable this option will use ClusterIP instead of port forwarding when connecting to the Theia
+Manager Service. It can only be used when running in cluster.`,
+	)
+}
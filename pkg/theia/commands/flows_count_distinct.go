@@ -0,0 +1,101 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+)
+
+// flowsCountDistinctCmd represents the flows count-distinct command
+var flowsCountDistinctCmd = &cobra.Command{
+	Use:   "count-distinct",
+	Short: "Count the distinct values of the key dimensions of flows",
+	Long: `Count the distinct Pods, Namespaces, Services, external IPs and ports
+seen in the flows which ended during the given window. The counts are
+approximated by ClickHouse and help anticipating the size of policy
+recommendation jobs and the cardinality of dashboards. The flows can be
+restricted to a traffic class with --traffic-class.`,
+	Args: cobra.NoArgs,
+	Example: `
+Count the distinct values of the flows in the last hour
+$ theia flows count-distinct
+Count the distinct values of the flows in the last 24 hours
+$ theia flows count-distinct --window 24h
+Count the distinct values of the inter-Node flows in the last hour
+$ theia flows count-distinct --traffic-class inter-node
+`,
+	RunE: flowsCountDistinct,
+}
+
+func init() {
+	flowsCmd.AddCommand(flowsCountDistinctCmd)
+	flowsCountDistinctCmd.Flags().Duration(
+		"window",
+		time.Hour,
+		"The duration before now over which the flows are counted.",
+	)
+	flowsCountDistinctCmd.Flags().String(
+		"traffic-class",
+		"",
+		fmt.Sprintf("Only count the flows of the given traffic class, one of %s.", strings.Join(stats.TrafficClasses, ", ")),
+	)
+	flowsCountDistinctCmd.RegisterFlagCompletionFunc("traffic-class", cobra.FixedCompletions(stats.TrafficClasses, cobra.ShellCompDirectiveNoFileComp))
+}
+
+func flowsCountDistinct(cmd *cobra.Command, args []string) error {
+	window, err := cmd.Flags().GetDuration("window")
+	if err != nil {
+		return err
+	}
+	if window <= 0 {
+		return fmt.Errorf("window should be a positive duration")
+	}
+	trafficClass, err := cmd.Flags().GetString("traffic-class")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	flowStats, err := getFlowStatsByCategory(theiaClient, "cardinality", window, trafficClass, "")
+	if err != nil {
+		return fmt.Errorf("error when getting flow cardinality: %v", err)
+	}
+	cardinality := flowStats.Cardinality
+	result := [][]string{
+		{"Window", "Flows", "Pods", "Namespaces", "Services", "ExternalIPs", "Ports"},
+		{flowStats.Window, cardinality.Flows, cardinality.Pods, cardinality.Namespaces, cardinality.Services, cardinality.ExternalIPs, cardinality.Ports},
+	}
+	if trafficClass != "" {
+		result[0] = append(result[0], "TrafficClass")
+		result[1] = append(result[1], flowStats.TrafficClass)
+	}
+	TableOutput(result)
+	return nil
+}
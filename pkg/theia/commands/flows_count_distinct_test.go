@@ -0,0 +1,160 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestFlowsCountDistinct(t *testing.T) {
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		window           time.Duration
+		trafficClass     string
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name: "Valid case",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/stats.theia.antrea.io/v1alpha1/flows/cardinality":
+					flowStats := &stats.FlowStats{
+						Window: r.URL.Query().Get("window"),
+						Cardinality: stats.FlowCardinality{
+							Flows:       "1000",
+							Pods:        "20",
+							Namespaces:  "3",
+							Services:    "4",
+							ExternalIPs: "5",
+							Ports:       "6",
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(flowStats)
+				}
+			})),
+			window: 24 * time.Hour,
+			expectedMsg: []string{"Window", "Flows", "Pods", "Namespaces", "Services", "ExternalIPs", "Ports",
+				"24h0m0s", "1000", "20", "3", "4", "5", "6"},
+			expectedErrorMsg: "",
+		},
+		{
+			name: "Valid case with traffic class",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/stats.theia.antrea.io/v1alpha1/flows/cardinality":
+					flowStats := &stats.FlowStats{
+						Window:       r.URL.Query().Get("window"),
+						TrafficClass: r.URL.Query().Get("trafficClass"),
+						Cardinality: stats.FlowCardinality{
+							Flows:       "100",
+							Pods:        "10",
+							Namespaces:  "2",
+							Services:    "0",
+							ExternalIPs: "0",
+							Ports:       "3",
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(flowStats)
+				}
+			})),
+			window:       time.Hour,
+			trafficClass: stats.TrafficClassInterNode,
+			expectedMsg: []string{"Window", "Flows", "TrafficClass",
+				"1h0m0s", "100", "inter-node"},
+			expectedErrorMsg: "",
+		},
+		{
+			name: "Failed to get flow cardinality",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			window:           time.Hour,
+			expectedErrorMsg: "error when getting flow cardinality",
+		},
+		{
+			name:             "Invalid window",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           -time.Hour,
+			expectedErrorMsg: "window should be a positive duration",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           time.Hour,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().Duration("window", tt.window, "")
+			cmd.Flags().String("traffic-class", tt.trafficClass, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := flowsCountDistinct(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
+)
+
+// flowsExportCmd represents the flows export command
+var flowsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the flow records to a local file",
+	Long: `Export the flow records which ended during a time range to a local file,
+in CSV format with a header row or in Apache Parquet format, for offline
+analysis, e.g. with pandas, or for the ingestion into a data lake. ClickHouse
+reads and encodes the flow records in batches, which are streamed to the file
+through Theia Manager, so that the records are never all held in memory. The
+stream is compressed with gzip between Theia Manager and the CLI unless
+--compress=false is set.`,
+	Args: cobra.NoArgs,
+	Example: `
+Export the flow records of an hour in CSV format
+$ theia flows export --start-time 2023-09-01T10:00:00 --end-time 2023-09-01T11:00:00 --output flows.csv
+Export the flow records since a given time in Parquet format
+$ theia flows export --start-time 2023-09-01T10:00:00 --format parquet --output flows.parquet
+`,
+	RunE: flowsExport,
+}
+
+func init() {
+	flowsCmd.AddCommand(flowsExportCmd)
+	flowsExportCmd.Flags().StringP(
+		"start-time",
+		"s",
+		"",
+		`The start time of the exported flow records, which ended at or after it.
+Format is YYYY-MM-DD hh:mm:ss in UTC timezone.`,
+	)
+	flowsExportCmd.Flags().StringP(
+		"end-time",
+		"e",
+		"",
+		`The end time of the exported flow records, which ended before it.
+Format is YYYY-MM-DD hh:mm:ss in UTC timezone. Now by default.`,
+	)
+	flowsExportCmd.Flags().String(
+		"format",
+		stats.FlowExportFormatCSV,
+		fmt.Sprintf("The format of the exported flow records, one of %s.", strings.Join(stats.FlowExportFormats, ", ")),
+	)
+	flowsExportCmd.Flags().StringP(
+		"output",
+		"o",
+		"",
+		"The path of the file the flow records are exported to. It is overwritten if it exists.",
+	)
+	flowsExportCmd.Flags().Int(
+		"batch-size",
+		65536,
+		"The number of flow records read from ClickHouse at once.",
+	)
+	flowsExportCmd.Flags().Bool(
+		"compress",
+		true,
+		"Compress the flow records streamed from Theia Manager, which reduces the transfer time through port forwarding.",
+	)
+	flowsExportCmd.MarkFlagRequired("start-time")
+	flowsExportCmd.MarkFlagRequired("output")
+	flowsExportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(stats.FlowExportFormats, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// parseExportTime parses a time in 'YYYY-MM-DD hh:mm:ss' format, in UTC,
+// with the date and the time optionally separated by a T.
+func parseExportTime(flag, value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02 15:04:05", strings.Replace(value, "T", " ", 1))
+	if err != nil {
+		return t, fmt.Errorf("parsing %s: %v, %s should be in 'YYYY-MM-DDThh:mm:ss' format, for example: 2006-01-02T15:04:05", flag, err, flag)
+	}
+	return t, nil
+}
+
+func flowsExport(cmd *cobra.Command, args []string) error {
+	startTimeFlag, err := cmd.Flags().GetString("start-time")
+	if err != nil {
+		return err
+	}
+	startTime, err := parseExportTime("start-time", startTimeFlag)
+	if err != nil {
+		return err
+	}
+	endTimeFlag, err := cmd.Flags().GetString("end-time")
+	if err != nil {
+		return err
+	}
+	endTime := time.Now().UTC().Truncate(time.Second)
+	if endTimeFlag != "" {
+		endTime, err = parseExportTime("end-time", endTimeFlag)
+		if err != nil {
+			return err
+		}
+	}
+	if !endTime.After(startTime) {
+		return fmt.Errorf("end-time should be after start-time")
+	}
+	exportFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(stats.FlowExportFormats, exportFormat) {
+		return fmt.Errorf("invalid format %q, it should be one of %s", exportFormat, strings.Join(stats.FlowExportFormats, ", "))
+	}
+	output, err := getPathFlag(cmd, "output")
+	if err != nil {
+		return err
+	}
+	batchSize, err := cmd.Flags().GetInt("batch-size")
+	if err != nil {
+		return err
+	}
+	if batchSize <= 0 {
+		return fmt.Errorf("batch-size should be a positive integer")
+	}
+	compress, err := cmd.Flags().GetBool("compress")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	var compression string
+	if compress {
+		compression = stats.FlowExportCompressionGzip
+	}
+	stream, err := exportFlows(theiaClient, startTime, endTime, exportFormat, batchSize, compression)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	var reader io.Reader = stream
+	if compress {
+		gzipReader, err := gzip.NewReader(stream)
+		if err != nil {
+			return fmt.Errorf("error when exporting flows: %v", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("error when creating output file %s: %v", output, err)
+	}
+	written, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// A partial export would be mistaken for a complete one.
+		os.Remove(output)
+		return fmt.Errorf("error when exporting flows to %s: %v", output, err)
+	}
+	fmt.Printf("Exported %s of flow records to %s\n", format.Printer{}.Bytes(strconv.FormatInt(written, 10)), output)
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestFlowsExport(t *testing.T) {
+	exportServer := func(t *testing.T, expectedQuery url.Values) *httptest.Server {
+		data := []byte("flowStartSeconds,flowEndSeconds\n2023-09-01 10:00:00,2023-09-01 10:00:05\n")
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/apis/stats.theia.antrea.io/v1alpha1/flows/export" {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			assert.Equal(t, expectedQuery, r.URL.Query())
+			if r.URL.Query().Get("compression") == "gzip" {
+				w.Header().Set("Content-Type", "application/gzip")
+				w.WriteHeader(http.StatusOK)
+				gzipWriter := gzip.NewWriter(w)
+				gzipWriter.Write(data)
+				gzipWriter.Close()
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.WriteHeader(http.StatusOK)
+			w.Write(data)
+		}))
+	}
+	testCases := []struct {
+		name             string
+		testServer       func(t *testing.T) *httptest.Server
+		startTime        string
+		endTime          string
+		format           string
+		compress         bool
+		expectedOutput   string
+		expectedMsg      string
+		expectedErrorMsg string
+	}{
+		{
+			name: "Valid case",
+			testServer: func(t *testing.T) *httptest.Server {
+				return exportServer(t, url.Values{
+					"startTime": {"2023-09-01T10:00:00Z"},
+					"endTime":   {"2023-09-01T11:00:00Z"},
+					"format":    {"csv"},
+					"batchSize": {"1000"},
+				})
+			},
+			startTime:      "2023-09-01T10:00:00",
+			endTime:        "2023-09-01 11:00:00",
+			format:         "csv",
+			expectedOutput: "flowStartSeconds,flowEndSeconds\n2023-09-01 10:00:00,2023-09-01 10:00:05\n",
+			expectedMsg:    "Exported 72.00 B of flow records to",
+		},
+		{
+			name: "Valid case with compression",
+			testServer: func(t *testing.T) *httptest.Server {
+				return exportServer(t, url.Values{
+					"startTime":   {"2023-09-01T10:00:00Z"},
+					"endTime":     {"2023-09-01T11:00:00Z"},
+					"format":      {"parquet"},
+					"batchSize":   {"1000"},
+					"compression": {"gzip"},
+				})
+			},
+			startTime:      "2023-09-01T10:00:00",
+			endTime:        "2023-09-01T11:00:00",
+			format:         "parquet",
+			compress:       true,
+			expectedOutput: "flowStartSeconds,flowEndSeconds\n2023-09-01 10:00:00,2023-09-01 10:00:05\n",
+			expectedMsg:    "Exported 72.00 B of flow records to",
+		},
+		{
+			name: "Export error",
+			testServer: func(t *testing.T) *httptest.Server {
+				return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}))
+			},
+			startTime:        "2023-09-01T10:00:00",
+			format:           "parquet",
+			expectedErrorMsg: "failed to export flows",
+		},
+		{
+			name:             "Invalid start time",
+			startTime:        "2023-09-01",
+			format:           "csv",
+			expectedErrorMsg: "parsing start-time",
+		},
+		{
+			name:             "End time before start time",
+			startTime:        "2023-09-01T10:00:00",
+			endTime:          "2023-09-01T09:00:00",
+			format:           "csv",
+			expectedErrorMsg: "end-time should be after start-time",
+		},
+		{
+			name:             "Invalid format",
+			startTime:        "2023-09-01T10:00:00",
+			format:           "json",
+			expectedErrorMsg: "invalid format \"json\", it should be one of csv, parquet",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			startTime:        "2023-09-01T10:00:00",
+			format:           "csv",
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.testServer == nil {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				testServer := tt.testServer(t)
+				defer testServer.Close()
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			output := filepath.Join(t.TempDir(), "flows")
+			cmd := new(cobra.Command)
+			cmd.Flags().String("start-time", tt.startTime, "")
+			cmd.Flags().String("end-time", tt.endTime, "")
+			cmd.Flags().String("format", tt.format, "")
+			cmd.Flags().String("output", output, "")
+			cmd.Flags().Int("batch-size", 1000, "")
+			cmd.Flags().Bool("compress", tt.compress, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := flowsExport(cmd, []string{})
+			outcome := readStdout(t, r, w)
+			if tt.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+				assert.NoFileExists(t, output)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, outcome, tt.expectedMsg)
+			data, err := os.ReadFile(output)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedOutput, string(data))
+		})
+	}
+}
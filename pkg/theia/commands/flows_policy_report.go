@@ -0,0 +1,211 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
+)
+
+// policyResources are the API paths of the NetworkPolicies listed from the
+// cluster to find the ones which were not applied to any flow, by kind. The
+// Antrea policies are listed from the first served API version.
+var policyResources = []struct {
+	kind  string
+	paths []string
+}{
+	{stats.PolicyKindK8sNetworkPolicy, []string{"/apis/networking.k8s.io/v1/networkpolicies"}},
+	{stats.PolicyKindAntreaNetworkPolicy, []string{"/apis/crd.antrea.io/v1beta1/networkpolicies", "/apis/crd.antrea.io/v1alpha1/networkpolicies"}},
+	{stats.PolicyKindAntreaClusterNetworkPolicy, []string{"/apis/crd.antrea.io/v1beta1/clusternetworkpolicies", "/apis/crd.antrea.io/v1alpha1/clusternetworkpolicies"}},
+}
+
+// flowsPolicyReportCmd represents the flows policy-report command
+var flowsPolicyReportCmd = &cobra.Command{
+	Use:   "policy-report",
+	Short: "Report the traffic matched by every NetworkPolicy",
+	Long: `Report the NetworkPolicies which were applied to the flows which ended
+during the given window: the flows and bytes allowed, and dropped or rejected,
+by their rules in either direction, and the end time of their last flow.
+The K8s NetworkPolicies, Antrea NetworkPolicies and Antrea ClusterNetworkPolicies
+of the cluster which were not applied to any flow during the window are
+reported separately, as they may be stale. Policies created during the window
+may also be reported there, see their creation time. The policies which cannot
+be listed with the given kubeconfig are not checked.`,
+	Args: cobra.NoArgs,
+	Example: `
+Report the traffic matched by NetworkPolicies during the last hour
+$ theia flows policy-report
+Report the traffic matched by NetworkPolicies during the last 7 days, with bytes as raw numbers
+$ theia flows policy-report --window 168h --raw
+`,
+	RunE: flowsPolicyReport,
+}
+
+func init() {
+	flowsCmd.AddCommand(flowsPolicyReportCmd)
+	flowsPolicyReportCmd.Flags().Duration(
+		"window",
+		time.Hour,
+		"The duration before now over which the flows are counted.",
+	)
+	flowsPolicyReportCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print bytes as raw numbers instead of human-readable values.",
+	)
+}
+
+func flowsPolicyReport(cmd *cobra.Command, args []string) error {
+	window, err := cmd.Flags().GetDuration("window")
+	if err != nil {
+		return err
+	}
+	if window <= 0 {
+		return fmt.Errorf("window should be a positive duration")
+	}
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	flowStats, err := getFlowStatsByCategory(theiaClient, "policies", window, "", "")
+	if err != nil {
+		return fmt.Errorf("error when getting the traffic of NetworkPolicies: %v", err)
+	}
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+	}
+	k8sClient, err := CreateK8sClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+	}
+
+	fmt.Printf("NetworkPolicies applied to flows over the last %s:\n", window)
+	printer := format.Printer{Raw: raw}
+	if len(flowStats.PolicyTraffic) == 0 {
+		fmt.Println("No flow was matched by a NetworkPolicy during the window")
+	} else {
+		result := [][]string{{"Kind", "Namespace", "Name", "AllowedFlows", "AllowedBytes", "DeniedFlows", "DeniedBytes", "LastFlowEnd"}}
+		for _, policy := range flowStats.PolicyTraffic {
+			result = append(result, []string{
+				policy.Kind,
+				formatPolicyNamespace(policy.Namespace),
+				policy.Name,
+				policy.AllowedFlows,
+				printer.Bytes(policy.AllowedBytes),
+				policy.DeniedFlows,
+				printer.Bytes(policy.DeniedBytes),
+				policy.LastFlowEnd,
+			})
+		}
+		TableOutput(result)
+	}
+
+	matched := make(map[string]bool, len(flowStats.PolicyTraffic))
+	for _, policy := range flowStats.PolicyTraffic {
+		matched[policy.Kind+"/"+policy.Namespace+"/"+policy.Name] = true
+	}
+	var unused []metav1.PartialObjectMetadata
+	for _, resource := range policyResources {
+		policies, err := listPolicies(k8sClient, resource.paths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't list the %s of the cluster, they are not checked: %v\n", resource.kind, err)
+			continue
+		}
+		for _, policy := range policies {
+			if !matched[resource.kind+"/"+policy.Namespace+"/"+policy.Name] {
+				policy.Kind = resource.kind
+				unused = append(unused, policy)
+			}
+		}
+	}
+	fmt.Printf("\nNetworkPolicies not applied to any flow over the last %s:\n", window)
+	if len(unused) == 0 {
+		fmt.Println("None")
+		return nil
+	}
+	result := [][]string{{"Kind", "Namespace", "Name", "Created"}}
+	for _, policy := range unused {
+		result = append(result, []string{
+			policy.Kind,
+			formatPolicyNamespace(policy.Namespace),
+			policy.Name,
+			FormatTimestamp(policy.CreationTimestamp.Time),
+		})
+	}
+	TableOutput(result)
+	return nil
+}
+
+// listPolicies lists the NetworkPolicies of a kind from the first of their
+// API paths served by the cluster, sorted by Namespace and name. Only their
+// metadata is decoded.
+func listPolicies(k8sClient kubernetes.Interface, paths []string) ([]metav1.PartialObjectMetadata, error) {
+	var err error
+	for _, path := range paths {
+		var data []byte
+		data, err = k8sClient.Discovery().RESTClient().Get().AbsPath(path).DoRaw(context.TODO())
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var policies metav1.PartialObjectMetadataList
+		if err := json.Unmarshal(data, &policies); err != nil {
+			return nil, fmt.Errorf("failed to decode the list of %s: %v", path, err)
+		}
+		sort.Slice(policies.Items, func(i, j int) bool {
+			if policies.Items[i].Namespace != policies.Items[j].Namespace {
+				return policies.Items[i].Namespace < policies.Items[j].Namespace
+			}
+			return policies.Items[i].Name < policies.Items[j].Name
+		})
+		return policies.Items, nil
+	}
+	return nil, err
+}
+
+// formatPolicyNamespace returns the Namespace of a NetworkPolicy, or N/A for
+// cluster-scoped policies.
+func formatPolicyNamespace(namespace string) string {
+	if namespace == "" {
+		return "N/A"
+	}
+	return namespace
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestFlowsPolicyReport(t *testing.T) {
+	created := metav1.NewTime(time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC))
+	policyList := func(policies ...[2]string) *metav1.PartialObjectMetadataList {
+		list := &metav1.PartialObjectMetadataList{}
+		for _, policy := range policies {
+			list.Items = append(list.Items, metav1.PartialObjectMetadata{
+				ObjectMeta: metav1.ObjectMeta{Namespace: policy[0], Name: policy[1], CreationTimestamp: created},
+			})
+		}
+		return list
+	}
+	testServer := func(policyTraffic []stats.PolicyTrafficStats, antreaPolicies bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var response interface{}
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/stats.theia.antrea.io/v1alpha1/flows/policies":
+				response = &stats.FlowStats{Window: r.URL.Query().Get("window"), PolicyTraffic: policyTraffic}
+			case "/apis/networking.k8s.io/v1/networkpolicies":
+				response = policyList([2]string{"default", "allow-client"}, [2]string{"default", "allow-legacy"})
+			case "/apis/crd.antrea.io/v1alpha1/networkpolicies":
+				if !antreaPolicies {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				response = policyList([2]string{"shop", "allow-web"})
+			case "/apis/crd.antrea.io/v1beta1/clusternetworkpolicies":
+				if !antreaPolicies {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				response = policyList([2]string{"", "default-deny"})
+			default:
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(response)
+		}))
+	}
+	policyTraffic := []stats.PolicyTrafficStats{
+		{Kind: stats.PolicyKindK8sNetworkPolicy, Namespace: "default", Name: "allow-client", AllowedFlows: "600", AllowedBytes: "1610612736", DeniedFlows: "0", DeniedBytes: "0", LastFlowEnd: "2023-09-01T10:00:00Z"},
+		{Kind: stats.PolicyKindAntreaClusterNetworkPolicy, Name: "default-deny", AllowedFlows: "0", AllowedBytes: "0", DeniedFlows: "20", DeniedBytes: "1536", LastFlowEnd: "2023-09-01T09:59:00Z"},
+	}
+	testCases := []struct {
+		name              string
+		testServer        *httptest.Server
+		window            time.Duration
+		raw               bool
+		expectedMsg       []string
+		unexpectedMsg     []string
+		expectedStderrMsg []string
+		expectedErrorMsg  string
+	}{
+		{
+			name:       "Valid case",
+			testServer: testServer(policyTraffic, true),
+			window:     24 * time.Hour,
+			expectedMsg: []string{
+				"NetworkPolicies applied to flows over the last 24h0m0s",
+				"K8sNetworkPolicy", "allow-client", "600", "1.50 GiB", "2023-09-01T10:00:00Z",
+				"AntreaClusterNetworkPolicy", "N/A", "default-deny", "20", "1.50 KiB",
+				"NetworkPolicies not applied to any flow over the last 24h0m0s",
+				"allow-legacy", "2023-09-01 08:00:00",
+				"AntreaNetworkPolicy", "shop", "allow-web",
+			},
+		},
+		{
+			name:          "Valid case with raw bytes",
+			testServer:    testServer(policyTraffic, true),
+			window:        time.Hour,
+			raw:           true,
+			expectedMsg:   []string{"1610612736", "1536"},
+			unexpectedMsg: []string{"1.50 GiB"},
+		},
+		{
+			name:              "Antrea policies cannot be listed",
+			testServer:        testServer(policyTraffic, false),
+			window:            time.Hour,
+			expectedMsg:       []string{"allow-legacy"},
+			unexpectedMsg:     []string{"allow-web"},
+			expectedStderrMsg: []string{"Couldn't list the AntreaNetworkPolicy of the cluster", "Couldn't list the AntreaClusterNetworkPolicy of the cluster"},
+		},
+		{
+			name:        "No traffic",
+			testServer:  testServer(nil, true),
+			window:      time.Hour,
+			expectedMsg: []string{"No flow was matched by a NetworkPolicy during the window", "allow-client", "default-deny"},
+		},
+		{
+			name: "Failed to get the traffic of NetworkPolicies",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			window:           time.Hour,
+			expectedErrorMsg: "error when getting the traffic of NetworkPolicies",
+		},
+		{
+			name:             "Invalid window",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           -time.Hour,
+			expectedErrorMsg: "window should be a positive duration",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           time.Hour,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+			clientset, _ := kubernetes.NewForConfig(clientConfig)
+			oldSetupFunc := SetupTheiaClientAndConnection
+			oldCreateFunc := CreateK8sClient
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return clientset, nil
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldSetupFunc
+				CreateK8sClient = oldCreateFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().Duration("window", tt.window, "")
+			cmd.Flags().Bool("raw", tt.raw, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			cmd.Flags().String("kubeconfig", "", "")
+
+			orig, origStderr := os.Stdout, os.Stderr
+			r, w, _ := os.Pipe()
+			rStderr, wStderr, _ := os.Pipe()
+			os.Stdout, os.Stderr = w, wStderr
+			defer func() { os.Stdout, os.Stderr = orig, origStderr }()
+			err := flowsPolicyReport(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+				for _, msg := range tt.unexpectedMsg {
+					assert.NotContains(t, outcome, msg)
+				}
+				stderr := readStdout(t, rStderr, wStderr)
+				for _, msg := range tt.expectedStderrMsg {
+					assert.Contains(t, stderr, msg)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
+)
+
+// workloadKinds maps the kinds of workloads which can be summarized, and their
+// short names, to their canonical kind.
+var workloadKinds = map[string]string{
+	"pod":          "pod",
+	"pods":         "pod",
+	"po":           "pod",
+	"deployment":   "deployment",
+	"deployments":  "deployment",
+	"deploy":       "deployment",
+	"statefulset":  "statefulset",
+	"statefulsets": "statefulset",
+	"sts":          "statefulset",
+	"daemonset":    "daemonset",
+	"daemonsets":   "daemonset",
+	"ds":           "daemonset",
+	"replicaset":   "replicaset",
+	"replicasets":  "replicaset",
+	"rs":           "replicaset",
+	"job":          "job",
+	"jobs":         "job",
+}
+
+// flowsSummarizeCmd represents the flows summarize command
+var flowsSummarizeCmd = &cobra.Command{
+	Use:   "summarize [TYPE/NAME]",
+	Short: "Summarize the ingress and egress traffic of a workload",
+	Long: `Summarize the ingress and egress traffic of a workload during a window
+before now: its peers, the ports and the bytes sent and received by its Pods,
+and the NetworkPolicies which allowed or denied the traffic. Peers which are
+not Pods are shown as their Service or IP.
+The workload is a Pod, Deployment, StatefulSet, DaemonSet, ReplicaSet or Job.
+Its Pods are selected by the matchLabels of the selector of the workload, read
+from the cluster, against the Pod labels recorded in the flows, so that the
+Pods which were deleted during the window are also summarized. The Flow
+Aggregator must record the Pod labels for the selection to work. Workloads
+which do not exist anymore can be summarized with --selector instead.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Summarize the traffic of the Deployment foo in Namespace ns during the last day
+$ theia flows summarize deployment/foo -n ns --last 24h
+Summarize the traffic of the Pod foo-0 during the last hour
+$ theia flows summarize pod/foo-0 -n ns
+Summarize the traffic of the Pods with label app=foo, including deleted ones
+$ theia flows summarize --selector app=foo -n ns --last 24h
+`,
+	RunE: flowsSummarize,
+}
+
+func init() {
+	flowsCmd.AddCommand(flowsSummarizeCmd)
+	flowsSummarizeCmd.Flags().StringP(
+		"namespace",
+		"n",
+		metav1.NamespaceDefault,
+		"The Namespace of the workload.",
+	)
+	flowsSummarizeCmd.Flags().StringP(
+		"selector",
+		"l",
+		"",
+		"Summarize the Pods with the given labels instead of a workload, e.g. app=foo,tier=web.",
+	)
+	flowsSummarizeCmd.Flags().Duration(
+		"last",
+		time.Hour,
+		"The duration of the window before now over which the traffic is summarized.",
+	)
+	flowsSummarizeCmd.Flags().Int(
+		"limit",
+		20,
+		"The maximum number of peers and ports to show per direction.",
+	)
+	flowsSummarizeCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print bytes as raw numbers instead of human-readable values.",
+	)
+}
+
+func flowsSummarize(cmd *cobra.Command, args []string) error {
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		return err
+	}
+	podSelector, err := cmd.Flags().GetString("selector")
+	if err != nil {
+		return err
+	}
+	if (len(args) == 0) == (podSelector == "") {
+		return fmt.Errorf("exactly one of a workload and --selector should be specified")
+	}
+	last, err := cmd.Flags().GetDuration("last")
+	if err != nil {
+		return err
+	}
+	if last <= 0 {
+		return fmt.Errorf("last should be a positive duration")
+	}
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+	if limit <= 0 {
+		return fmt.Errorf("limit should be a positive integer")
+	}
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	var podName string
+	workload := podSelector
+	if len(args) == 1 {
+		kind, name, err := parseWorkload(args[0])
+		if err != nil {
+			return err
+		}
+		workload = kind + "/" + name
+		if kind == "pod" {
+			podName = name
+		} else {
+			kubeconfig, err := ResolveKubeConfig(cmd)
+			if err != nil {
+				return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+			}
+			k8sClient, err := CreateK8sClient(kubeconfig)
+			if err != nil {
+				return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+			}
+			podLabels, err := getWorkloadPodLabels(k8sClient, kind, namespace, name)
+			if err != nil {
+				return err
+			}
+			podSelector = labels.SelectorFromSet(podLabels).String()
+			workload = fmt.Sprintf("%s (%s)", workload, podSelector)
+		}
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	flowStats, err := getWorkloadFlows(theiaClient, last, namespace, podName, podSelector, limit)
+	if err != nil {
+		return fmt.Errorf("error when getting workload flows: %v", err)
+	}
+	fmt.Printf("Traffic of %s in Namespace %s over the last %s\n", workload, namespace, last)
+	printer := format.Printer{Raw: raw}
+	for _, direction := range []string{stats.WorkloadFlowDirectionIngress, stats.WorkloadFlowDirectionEgress} {
+		var workloadFlows []stats.WorkloadFlowStats
+		for _, workloadFlow := range flowStats.WorkloadFlows {
+			if workloadFlow.Direction == direction {
+				workloadFlows = append(workloadFlows, workloadFlow)
+			}
+		}
+		fmt.Printf("\n%s:\n", strings.ToUpper(direction[:1])+direction[1:])
+		printWorkloadFlows(workloadFlows, printer)
+	}
+	return nil
+}
+
+// parseWorkload parses a workload given as TYPE/NAME, and returns its
+// canonical kind and its name.
+func parseWorkload(workload string) (string, string, error) {
+	kind, name, ok := strings.Cut(workload, "/")
+	kind, known := workloadKinds[strings.ToLower(kind)]
+	if !ok || !known || name == "" {
+		return "", "", fmt.Errorf("workload %q should be TYPE/NAME, where TYPE is one of pod, deployment, statefulset, daemonset, replicaset or job", workload)
+	}
+	return kind, name, nil
+}
+
+// getWorkloadPodLabels returns the labels of the Pods of a workload: the
+// labels of a Pod, or the matchLabels of the selector of other workloads.
+// Workloads selecting their Pods with matchExpressions are not supported.
+func getWorkloadPodLabels(k8sClient kubernetes.Interface, kind, namespace, name string) (map[string]string, error) {
+	var selector *metav1.LabelSelector
+	var err error
+	switch kind {
+	case "pod":
+		var pod *corev1.Pod
+		if pod, err = k8sClient.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{}); err == nil {
+			if len(pod.Labels) == 0 {
+				return nil, fmt.Errorf("pod/%s has no labels", name)
+			}
+			return pod.Labels, nil
+		}
+	case "deployment":
+		var deployment *appsv1.Deployment
+		if deployment, err = k8sClient.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{}); err == nil {
+			selector = deployment.Spec.Selector
+		}
+	case "statefulset":
+		var statefulSet *appsv1.StatefulSet
+		if statefulSet, err = k8sClient.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{}); err == nil {
+			selector = statefulSet.Spec.Selector
+		}
+	case "daemonset":
+		var daemonSet *appsv1.DaemonSet
+		if daemonSet, err = k8sClient.AppsV1().DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{}); err == nil {
+			selector = daemonSet.Spec.Selector
+		}
+	case "replicaset":
+		var replicaSet *appsv1.ReplicaSet
+		if replicaSet, err = k8sClient.AppsV1().ReplicaSets(namespace).Get(context.TODO(), name, metav1.GetOptions{}); err == nil {
+			selector = replicaSet.Spec.Selector
+		}
+	case "job":
+		var job *batchv1.Job
+		if job, err = k8sClient.BatchV1().Jobs(namespace).Get(context.TODO(), name, metav1.GetOptions{}); err == nil {
+			selector = job.Spec.Selector
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind of workload %q", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error when getting %s/%s: %v", kind, name, err)
+	}
+	podLabels, err := metav1.LabelSelectorAsMap(selector)
+	if err != nil || len(podLabels) == 0 {
+		return nil, fmt.Errorf("the selector of %s/%s is not supported, only matchLabels are supported", kind, name)
+	}
+	return podLabels, nil
+}
+
+func printWorkloadFlows(workloadFlows []stats.WorkloadFlowStats, printer format.Printer) {
+	if len(workloadFlows) == 0 {
+		fmt.Println("No flow during the window")
+		return
+	}
+	result := [][]string{{"Peer", "Port", "Flows", "BytesSent", "BytesReceived", "IngressPolicy", "EgressPolicy"}}
+	for _, workloadFlow := range workloadFlows {
+		result = append(result, []string{
+			workloadFlow.Peer,
+			workloadFlow.Port,
+			workloadFlow.Flows,
+			printer.Bytes(workloadFlow.BytesSent),
+			printer.Bytes(workloadFlow.BytesReceived),
+			formatPolicy(workloadFlow.IngressPolicy),
+			formatPolicy(workloadFlow.EgressPolicy),
+		})
+	}
+	TableOutput(result)
+}
+
+// formatPolicy returns the NetworkPolicy applied to flows, or None.
+func formatPolicy(policy string) string {
+	if policy == "" {
+		return "None"
+	}
+	return policy
+}
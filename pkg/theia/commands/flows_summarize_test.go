@@ -0,0 +1,217 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestFlowsSummarize(t *testing.T) {
+	workloadFlows := []stats.WorkloadFlowStats{
+		{Direction: "ingress", Peer: "default/client", Port: "80/TCP", Flows: "10", BytesSent: "1610612736", BytesReceived: "1536", IngressPolicy: "ns/allow-client (Allow)"},
+		{Direction: "egress", Peer: "10.10.1.1", Port: "443/TCP", Flows: "2", BytesSent: "200", BytesReceived: "0", EgressPolicy: "default-deny (Drop)"},
+	}
+	testServer := func(expectedQuery map[string]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/stats.theia.antrea.io/v1alpha1/flows/summary":
+				query := r.URL.Query()
+				for key, value := range expectedQuery {
+					if query.Get(key) != value {
+						http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+						return
+					}
+				}
+				flowStats := &stats.FlowStats{
+					Window:        query.Get("window"),
+					WorkloadFlows: workloadFlows,
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(flowStats)
+			}
+		}))
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "ns"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo", "tier": "web"}},
+		},
+	}
+	expressionDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "ns"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"bar", "baz"}},
+			}},
+		},
+	}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		args             []string
+		selector         string
+		last             time.Duration
+		objects          []runtime.Object
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case with a Deployment",
+			testServer: testServer(map[string]string{"window": "24h0m0s", "namespace": "ns", "podSelector": "app=foo,tier=web", "limit": "20"}),
+			args:       []string{"deployment/foo"},
+			objects:    []runtime.Object{deployment},
+			expectedMsg: []string{
+				"Traffic of deployment/foo (app=foo,tier=web) in Namespace ns over the last 24h0m0s",
+				"Ingress:",
+				"Peer", "Port", "Flows", "BytesSent", "BytesReceived", "IngressPolicy", "EgressPolicy",
+				"default/client", "80/TCP", "10", "1.50 GiB", "1.50 KiB", "ns/allow-client (Allow)", "None",
+				"Egress:",
+				"10.10.1.1", "443/TCP", "2", "200.00 B", "0.00 B", "default-deny (Drop)",
+			},
+		},
+		{
+			name:        "Valid case with a Pod",
+			testServer:  testServer(map[string]string{"namespace": "ns", "podName": "foo-0"}),
+			args:        []string{"po/foo-0"},
+			expectedMsg: []string{"Traffic of pod/foo-0 in Namespace ns over the last 24h0m0s"},
+		},
+		{
+			name:        "Valid case with a selector",
+			testServer:  testServer(map[string]string{"namespace": "ns", "podSelector": "app=foo"}),
+			selector:    "app=foo",
+			expectedMsg: []string{"Traffic of app=foo in Namespace ns over the last 24h0m0s"},
+		},
+		{
+			name:             "Workload and selector",
+			testServer:       testServer(nil),
+			args:             []string{"deployment/foo"},
+			selector:         "app=foo",
+			expectedErrorMsg: "exactly one of a workload and --selector should be specified",
+		},
+		{
+			name:             "Invalid workload",
+			testServer:       testServer(nil),
+			args:             []string{"service/foo"},
+			expectedErrorMsg: "workload \"service/foo\" should be TYPE/NAME",
+		},
+		{
+			name:             "Workload not found",
+			testServer:       testServer(nil),
+			args:             []string{"sts/foo"},
+			expectedErrorMsg: "error when getting statefulset/foo",
+		},
+		{
+			name:             "Workload with matchExpressions",
+			testServer:       testServer(nil),
+			args:             []string{"deployment/bar"},
+			objects:          []runtime.Object{expressionDeployment},
+			expectedErrorMsg: "the selector of deployment/bar is not supported, only matchLabels are supported",
+		},
+		{
+			name:             "Invalid last",
+			testServer:       testServer(nil),
+			args:             []string{"pod/foo-0"},
+			last:             -time.Hour,
+			expectedErrorMsg: "last should be a positive duration",
+		},
+		{
+			name: "Server error",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			args:             []string{"pod/foo-0"},
+			expectedErrorMsg: "error when getting workload flows",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       testServer(nil),
+			args:             []string{"pod/foo-0"},
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldSetupFunc := SetupTheiaClientAndConnection
+			oldCreateFunc := CreateK8sClient
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tt.objects...), nil
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldSetupFunc
+				CreateK8sClient = oldCreateFunc
+			}()
+			last := tt.last
+			if last == 0 {
+				last = 24 * time.Hour
+			}
+			cmd := new(cobra.Command)
+			cmd.Flags().String("namespace", "ns", "")
+			cmd.Flags().String("selector", tt.selector, "")
+			cmd.Flags().Duration("last", last, "")
+			cmd.Flags().Int("limit", 20, "")
+			cmd.Flags().Bool("raw", false, "")
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := flowsSummarize(cmd, tt.args)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
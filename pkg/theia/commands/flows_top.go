@@ -0,0 +1,237 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
+)
+
+// clearScreen moves the cursor to the top left corner of the terminal and
+// clears it, so that each refresh replaces the previous table.
+const clearScreen = "\033[H\033[2J"
+
+// flowsTopCmd represents the flows top command
+var flowsTopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show the endpoints exchanging the most traffic",
+	Long: `Show the pairs of Pods or Namespaces which exchanged the most traffic
+during a sliding window before now, and refresh the table periodically until
+interrupted. Endpoints which are not Pods are shown as their Service or IP.
+The pairs are sorted by the bytes or packets sent from the source to the
+destination, or sent back in the reverse direction. The throughput is the
+average number of bytes per second exchanged in both directions over the
+window. The traffic is summed from the flow records, or from their rollups by
+minute or by hour for longer windows, see --resolution.`,
+	Args: cobra.NoArgs,
+	Example: `
+Show the 10 Pod pairs which sent the most bytes during the last minute
+$ theia flows top
+Show the 20 Namespace pairs which sent the most packets during the last 5 minutes
+$ theia flows top --group-by namespaces --sort-by packets --window 5m --limit 20
+Show the Pod pairs of inter-Node flows with the most reply traffic once
+$ theia flows top --traffic-class inter-node --sort-by reverse-bytes --once
+Show the 10 Pod pairs which sent the most bytes during the last 30 days once
+$ theia flows top --window 720h --once
+`,
+	RunE: flowsTop,
+}
+
+func init() {
+	flowsCmd.AddCommand(flowsTopCmd)
+	flowsTopCmd.Flags().Duration(
+		"window",
+		time.Minute,
+		"The duration of the sliding window before now over which the traffic is summed.",
+	)
+	flowsTopCmd.Flags().Duration(
+		"interval",
+		5*time.Second,
+		"The interval between two refreshes of the table.",
+	)
+	flowsTopCmd.Flags().Int(
+		"limit",
+		10,
+		"The maximum number of pairs to show.",
+	)
+	flowsTopCmd.Flags().String(
+		"group-by",
+		stats.TopTalkersGroupByPods,
+		fmt.Sprintf("How the flows are grouped, one of %s.", strings.Join(stats.TopTalkersGroupBys, ", ")),
+	)
+	flowsTopCmd.Flags().String(
+		"sort-by",
+		stats.TopTalkersSortByBytes,
+		fmt.Sprintf("The key the pairs are sorted by, one of %s.", strings.Join(stats.TopTalkersSortBys, ", ")),
+	)
+	flowsTopCmd.Flags().String(
+		"traffic-class",
+		"",
+		fmt.Sprintf("Only sum the flows of the given traffic class, one of %s.", strings.Join(stats.TrafficClasses, ", ")),
+	)
+	flowsTopCmd.Flags().String(
+		"resolution",
+		stats.FlowResolutionAuto,
+		resolutionUsage,
+	)
+	flowsTopCmd.Flags().Bool(
+		"once",
+		false,
+		"Print the table once instead of refreshing it.",
+	)
+	flowsTopCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print bytes and throughputs as raw numbers instead of human-readable values.",
+	)
+	flowsTopCmd.RegisterFlagCompletionFunc("group-by", cobra.FixedCompletions(stats.TopTalkersGroupBys, cobra.ShellCompDirectiveNoFileComp))
+	flowsTopCmd.RegisterFlagCompletionFunc("sort-by", cobra.FixedCompletions(stats.TopTalkersSortBys, cobra.ShellCompDirectiveNoFileComp))
+	flowsTopCmd.RegisterFlagCompletionFunc("traffic-class", cobra.FixedCompletions(stats.TrafficClasses, cobra.ShellCompDirectiveNoFileComp))
+	flowsTopCmd.RegisterFlagCompletionFunc("resolution", cobra.FixedCompletions(stats.FlowResolutions, cobra.ShellCompDirectiveNoFileComp))
+}
+
+func flowsTop(cmd *cobra.Command, args []string) error {
+	window, err := cmd.Flags().GetDuration("window")
+	if err != nil {
+		return err
+	}
+	if window <= 0 {
+		return fmt.Errorf("window should be a positive duration")
+	}
+	interval, err := cmd.Flags().GetDuration("interval")
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval should be a positive duration")
+	}
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+	if limit <= 0 {
+		return fmt.Errorf("limit should be a positive integer")
+	}
+	groupBy, err := cmd.Flags().GetString("group-by")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(stats.TopTalkersGroupBys, groupBy) {
+		return fmt.Errorf("group-by should be one of %s", strings.Join(stats.TopTalkersGroupBys, ", "))
+	}
+	sortBy, err := cmd.Flags().GetString("sort-by")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(stats.TopTalkersSortBys, sortBy) {
+		return fmt.Errorf("sort-by should be one of %s", strings.Join(stats.TopTalkersSortBys, ", "))
+	}
+	trafficClass, err := cmd.Flags().GetString("traffic-class")
+	if err != nil {
+		return err
+	}
+	resolution, err := cmd.Flags().GetString("resolution")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(stats.FlowResolutions, resolution) {
+		return fmt.Errorf("resolution should be one of %s", strings.Join(stats.FlowResolutions, ", "))
+	}
+	once, err := cmd.Flags().GetBool("once")
+	if err != nil {
+		return err
+	}
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	// Stop refreshing on interrupt, so that the port forwarding is stopped.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	printer := format.Printer{Raw: raw}
+	for {
+		flowStats, err := getTopTalkers(theiaClient, window, resolution, trafficClass, groupBy, sortBy, limit)
+		if err != nil {
+			return fmt.Errorf("error when getting top talkers: %v", err)
+		}
+		if !once {
+			fmt.Print(clearScreen)
+			fmt.Printf("Top %s by %s over the last %s%s, refreshed every %s at %s\n\n",
+				groupBy, sortBy, window, formatResolution(flowStats.Resolution), interval, time.Now().Format(time.TimeOnly))
+		}
+		printTopTalkers(flowStats.TopTalkers, printer)
+		if once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// formatResolution returns the resolution of the top talkers to append to the
+// header of the table, or nothing if the Theia manager did not report it.
+func formatResolution(resolution string) string {
+	if resolution == "" {
+		return ""
+	}
+	return fmt.Sprintf(" at resolution %s", resolution)
+}
+
+func printTopTalkers(topTalkers []stats.TopTalkerStats, printer format.Printer) {
+	if len(topTalkers) == 0 {
+		fmt.Println("No flow during the window")
+		return
+	}
+	result := [][]string{{"Source", "Destination", "Flows", "Bytes", "Packets", "ReverseBytes", "ReversePackets", "Throughput"}}
+	for _, topTalker := range topTalkers {
+		result = append(result, []string{
+			topTalker.Source,
+			topTalker.Destination,
+			topTalker.Flows,
+			printer.Bytes(topTalker.Bytes),
+			topTalker.Packets,
+			printer.Bytes(topTalker.ReverseBytes),
+			topTalker.ReversePackets,
+			printer.Rate(topTalker.Throughput),
+		})
+	}
+	TableOutput(result)
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestFlowsTop(t *testing.T) {
+	testServer := func(topTalkers []stats.TopTalkerStats) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/stats.theia.antrea.io/v1alpha1/flows/top":
+				query := r.URL.Query()
+				if query.Get("window") != "5m0s" || query.Get("groupBy") != "namespaces" || query.Get("sortBy") != "reverse-bytes" ||
+					query.Get("limit") != "20" || query.Get("trafficClass") != "inter-node" || query.Get("resolution") != "raw" {
+					http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+					return
+				}
+				flowStats := &stats.FlowStats{
+					Window:     query.Get("window"),
+					Resolution: query.Get("resolution"),
+					TopTalkers: topTalkers,
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(flowStats)
+			}
+		}))
+	}
+	topTalkers := []stats.TopTalkerStats{
+		{Source: "default", Destination: "kube-system", Flows: "20", Bytes: "1610612736", Packets: "3000", ReverseBytes: "1536", ReversePackets: "30", Throughput: "5368714.24"},
+		{Source: "default", Destination: "10.10.1.1", Flows: "5", Bytes: "36000", Packets: "30", ReverseBytes: "0", ReversePackets: "0", Throughput: "120"},
+	}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		window           time.Duration
+		limit            int
+		groupBy          string
+		resolution       string
+		raw              bool
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			testServer: testServer(topTalkers),
+			expectedMsg: []string{
+				"Source", "Destination", "Flows", "Bytes", "Packets", "ReverseBytes", "ReversePackets", "Throughput",
+				"default", "kube-system", "20", "1.50 GiB", "3000", "1.50 KiB", "30", "5.37 MB/s",
+				"10.10.1.1", "35.16 KiB", "0.00 B", "120.00 B/s",
+			},
+		},
+		{
+			name:        "Valid case with raw numbers",
+			testServer:  testServer(topTalkers),
+			raw:         true,
+			expectedMsg: []string{"1610612736", "1536", "5368714.24", "36000", "120"},
+		},
+		{
+			name:        "No flow",
+			testServer:  testServer(nil),
+			expectedMsg: []string{"No flow during the window"},
+		},
+		{
+			name: "Failed to get top talkers",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			expectedErrorMsg: "error when getting top talkers",
+		},
+		{
+			name:             "Invalid window",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           -time.Minute,
+			expectedErrorMsg: "window should be a positive duration",
+		},
+		{
+			name:             "Invalid limit",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			limit:            -1,
+			expectedErrorMsg: "limit should be a positive integer",
+		},
+		{
+			name:             "Invalid grouping",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			groupBy:          "nodes",
+			expectedErrorMsg: "group-by should be one of pods, namespaces",
+		},
+		{
+			name:             "Invalid resolution",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			resolution:       "1d",
+			expectedErrorMsg: "resolution should be one of auto, raw, 1m, 1h",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			window := tt.window
+			if window == 0 {
+				window = 5 * time.Minute
+			}
+			limit := tt.limit
+			if limit == 0 {
+				limit = 20
+			}
+			groupBy := tt.groupBy
+			if groupBy == "" {
+				groupBy = "namespaces"
+			}
+			cmd := new(cobra.Command)
+			cmd.Flags().Duration("window", window, "")
+			cmd.Flags().Duration("interval", time.Second, "")
+			cmd.Flags().Int("limit", limit, "")
+			cmd.Flags().String("group-by", groupBy, "")
+			cmd.Flags().String("sort-by", "reverse-bytes", "")
+			cmd.Flags().String("traffic-class", "inter-node", "")
+			resolution := tt.resolution
+			if resolution == "" {
+				resolution = "raw"
+			}
+			cmd.Flags().String("resolution", resolution, "")
+			cmd.Flags().Bool("once", true, "")
+			cmd.Flags().Bool("raw", tt.raw, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := flowsTop(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				assert.NotContains(t, outcome, clearScreen)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
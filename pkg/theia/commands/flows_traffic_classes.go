@@ -0,0 +1,115 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
+)
+
+// flowsTrafficClassesCmd represents the flows traffic-classes command
+var flowsTrafficClassesCmd = &cobra.Command{
+	Use:   "traffic-classes",
+	Short: "Break down the flows by traffic class",
+	Long: `Count the flows which ended during the given window, and the bytes they
+carried, for each traffic class. A flow is classified as intra-node,
+inter-node, pod-to-service, pod-to-external, external-to-pod or host-network
+based on its flow type and on its source and destination Pods and Services.
+The flows are counted from the flow records, or from their rollups by minute
+or by hour for longer windows, see --resolution.`,
+	Args: cobra.NoArgs,
+	Example: `
+Break down the flows of the last hour by traffic class
+$ theia flows traffic-classes
+Break down the flows of the last 24 hours by traffic class, with bytes as raw numbers
+$ theia flows traffic-classes --window 24h --raw
+Break down the flows of the last 7 days by traffic class, from the rollups by hour
+$ theia flows traffic-classes --window 168h --resolution 1h
+`,
+	RunE: flowsTrafficClasses,
+}
+
+func init() {
+	flowsCmd.AddCommand(flowsTrafficClassesCmd)
+	flowsTrafficClassesCmd.Flags().Duration(
+		"window",
+		time.Hour,
+		"The duration before now over which the flows are counted.",
+	)
+	flowsTrafficClassesCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print bytes as raw numbers instead of human-readable values.",
+	)
+	flowsTrafficClassesCmd.Flags().String(
+		"resolution",
+		stats.FlowResolutionAuto,
+		resolutionUsage,
+	)
+	flowsTrafficClassesCmd.RegisterFlagCompletionFunc("resolution", cobra.FixedCompletions(stats.FlowResolutions, cobra.ShellCompDirectiveNoFileComp))
+}
+
+func flowsTrafficClasses(cmd *cobra.Command, args []string) error {
+	window, err := cmd.Flags().GetDuration("window")
+	if err != nil {
+		return err
+	}
+	if window <= 0 {
+		return fmt.Errorf("window should be a positive duration")
+	}
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	resolution, err := cmd.Flags().GetString("resolution")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(stats.FlowResolutions, resolution) {
+		return fmt.Errorf("resolution should be one of %s", strings.Join(stats.FlowResolutions, ", "))
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	flowStats, err := getFlowStatsByCategory(theiaClient, "traffic-classes", window, "", resolution)
+	if err != nil {
+		return fmt.Errorf("error when getting flow traffic classes: %v", err)
+	}
+	printer := format.Printer{Raw: raw}
+	result := [][]string{{"TrafficClass", "Flows", "Bytes"}}
+	for _, trafficClass := range flowStats.TrafficClasses {
+		result = append(result, []string{trafficClass.TrafficClass, trafficClass.Flows, printer.Bytes(trafficClass.Bytes)})
+	}
+	TableOutput(result)
+	if flowStats.Resolution != "" {
+		fmt.Printf("\nResolution: %s\n", flowStats.Resolution)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestFlowsTrafficClasses(t *testing.T) {
+	testServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/stats.theia.antrea.io/v1alpha1/flows/traffic-classes":
+				// The Theia manager selects the 1-minute rollups for the
+				// auto resolution of the windows of the tests.
+				resolution := r.URL.Query().Get("resolution")
+				if resolution == stats.FlowResolutionAuto {
+					resolution = stats.FlowResolution1m
+				}
+				flowStats := &stats.FlowStats{
+					Window:     r.URL.Query().Get("window"),
+					Resolution: resolution,
+					TrafficClasses: []stats.TrafficClassStats{
+						{TrafficClass: stats.TrafficClassInterNode, Flows: "800", Bytes: "1610612736"},
+						{TrafficClass: stats.TrafficClassPodToService, Flows: "150", Bytes: "1536"},
+					},
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(flowStats)
+			}
+		}))
+	}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		window           time.Duration
+		raw              bool
+		resolution       string
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:        "Valid case",
+			testServer:  testServer(),
+			window:      24 * time.Hour,
+			expectedMsg: []string{"TrafficClass", "Flows", "Bytes", "inter-node", "800", "1.50 GiB", "pod-to-service", "150", "1.50 KiB", "Resolution: 1m"},
+		},
+		{
+			name:        "Valid case with resolution",
+			testServer:  testServer(),
+			window:      24 * time.Hour,
+			resolution:  "raw",
+			expectedMsg: []string{"inter-node", "800", "Resolution: raw"},
+		},
+		{
+			name:             "Invalid resolution",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           time.Hour,
+			resolution:       "1d",
+			expectedErrorMsg: "resolution should be one of auto, raw, 1m, 1h",
+		},
+		{
+			name:        "Valid case with raw bytes",
+			testServer:  testServer(),
+			window:      time.Hour,
+			raw:         true,
+			expectedMsg: []string{"inter-node", "1610612736", "pod-to-service", "1536"},
+		},
+		{
+			name: "Failed to get flow traffic classes",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			window:           time.Hour,
+			expectedErrorMsg: "error when getting flow traffic classes",
+		},
+		{
+			name:             "Invalid window",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           -time.Hour,
+			expectedErrorMsg: "window should be a positive duration",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           time.Hour,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().Duration("window", tt.window, "")
+			cmd.Flags().Bool("raw", tt.raw, "")
+			resolution := tt.resolution
+			if resolution == "" {
+				resolution = stats.FlowResolutionAuto
+			}
+			cmd.Flags().String("resolution", resolution, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := flowsTrafficClasses(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"antrea.io/theia/pkg/util/format"
+)
+
+// flowsVerifyIntegrityCmd represents the flows verify-integrity command
+var flowsVerifyIntegrityCmd = &cobra.Command{
+	Use:   "verify-integrity",
+	Short: "Check the consistency of the stored flow records",
+	Long: `Run consistency checks on the flow records of the flows which ended during
+the given window, and report how many records, or flows, failed each of them.
+Anomalies point to bugs of the Flow Exporter or of the Flow Aggregator, and
+are detected from the stored flow records alone. The checks are:
+  monotonic-bytes         the total byte counts of a flow, in both directions,
+                          do not decrease as the flow is updated. Flows are
+                          identified by their 5-tuple and start time, and only
+                          the flows with several records are checked.
+  start-before-end        the start time of a flow record is not after its
+                          end time.
+  inter-node-correlation  the records of inter-node flows have both their
+                          source and destination Pods, which the Flow
+                          Aggregator gets by correlating the records exported
+                          from both Nodes.
+The checks scan all the flow records of the window, so prefer short windows on
+large clusters.`,
+	Args: cobra.NoArgs,
+	Example: `
+Check the flow records of the last hour
+$ theia flows verify-integrity
+Check the flow records of the last 10 minutes, with anomaly rates as raw numbers
+$ theia flows verify-integrity --window 10m --raw
+`,
+	RunE: flowsVerifyIntegrity,
+}
+
+func init() {
+	flowsCmd.AddCommand(flowsVerifyIntegrityCmd)
+	flowsVerifyIntegrityCmd.Flags().Duration(
+		"window",
+		time.Hour,
+		"The duration before now over which the flow records are checked.",
+	)
+	flowsVerifyIntegrityCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print anomaly rates as raw numbers instead of human-readable values.",
+	)
+}
+
+func flowsVerifyIntegrity(cmd *cobra.Command, args []string) error {
+	window, err := cmd.Flags().GetDuration("window")
+	if err != nil {
+		return err
+	}
+	if window <= 0 {
+		return fmt.Errorf("window should be a positive duration")
+	}
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	flowStats, err := getFlowStatsByCategory(theiaClient, "integrity", window, "", "")
+	if err != nil {
+		return fmt.Errorf("error when checking the integrity of the flows: %v", err)
+	}
+	printer := format.Printer{Raw: raw}
+	result := [][]string{{"Check", "Checked", "Anomalies", "AnomalyRate"}}
+	var anomalies bool
+	for _, check := range flowStats.Integrity {
+		rate := anomalyRate(check.Checked, check.Anomalies)
+		if rate != "N/A" {
+			rate = printer.Percentage(rate)
+		}
+		result = append(result, []string{check.Check, check.Checked, check.Anomalies, rate})
+		if check.Anomalies != "" && check.Anomalies != "0" {
+			anomalies = true
+		}
+	}
+	TableOutput(result)
+	if anomalies {
+		fmt.Println("\nAnomalies were found, see theia flows verify-integrity --help for the checks")
+	}
+	return nil
+}
+
+// anomalyRate returns the percentage of the checked flow records which failed
+// a check, or N/A if no record was checked.
+func anomalyRate(checked, anomalies string) string {
+	total, err := strconv.ParseFloat(checked, 64)
+	if err != nil || total == 0 {
+		return "N/A"
+	}
+	failed, err := strconv.ParseFloat(anomalies, 64)
+	if err != nil {
+		return "N/A"
+	}
+	return strconv.FormatFloat(failed/total*100, 'f', -1, 64)
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestFlowsVerifyIntegrity(t *testing.T) {
+	testServer := func(integrity []stats.FlowIntegrityStats) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.TrimSpace(r.URL.Path) != "/apis/stats.theia.antrea.io/v1alpha1/flows/integrity" {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(&stats.FlowStats{Window: r.URL.Query().Get("window"), Integrity: integrity})
+		}))
+	}
+	integrity := []stats.FlowIntegrityStats{
+		{Check: stats.FlowIntegrityCheckMonotonicBytes, Checked: "400", Anomalies: "2"},
+		{Check: stats.FlowIntegrityCheckStartBeforeEnd, Checked: "1000", Anomalies: "0"},
+		{Check: stats.FlowIntegrityCheckInterNodeCorrelation, Checked: "0", Anomalies: "0"},
+	}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		window           time.Duration
+		raw              bool
+		expectedMsg      []string
+		unexpectedMsg    []string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			testServer: testServer(integrity),
+			window:     10 * time.Minute,
+			expectedMsg: []string{
+				"Check", "Checked", "Anomalies", "AnomalyRate",
+				"monotonic-bytes", "400", "0.50 %",
+				"start-before-end", "1000", "0.00 %",
+				"inter-node-correlation", "N/A",
+				"Anomalies were found",
+			},
+		},
+		{
+			name:          "Valid case with raw rates",
+			testServer:    testServer(integrity),
+			window:        time.Hour,
+			raw:           true,
+			expectedMsg:   []string{"0.5"},
+			unexpectedMsg: []string{"0.50 %"},
+		},
+		{
+			name: "No anomaly",
+			testServer: testServer([]stats.FlowIntegrityStats{
+				{Check: stats.FlowIntegrityCheckStartBeforeEnd, Checked: "1000", Anomalies: "0"},
+			}),
+			window:        time.Hour,
+			expectedMsg:   []string{"start-before-end", "0.00 %"},
+			unexpectedMsg: []string{"Anomalies were found"},
+		},
+		{
+			name: "Failed to check the integrity of the flows",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			window:           time.Hour,
+			expectedErrorMsg: "error when checking the integrity of the flows",
+		},
+		{
+			name:             "Invalid window",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           0,
+			expectedErrorMsg: "window should be a positive duration",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           time.Hour,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().Duration("window", tt.window, "")
+			cmd.Flags().Bool("raw", tt.raw, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := flowsVerifyIntegrity(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+				for _, msg := range tt.unexpectedMsg {
+					assert.NotContains(t, outcome, msg)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
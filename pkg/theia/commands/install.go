@@ -0,0 +1,355 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"antrea.io/theia/pkg/version"
+)
+
+const (
+	releaseManifestURL     = "https://github.com/antrea-io/theia/releases/download/%s/flow-visibility.yml"
+	devManifestURL         = "https://raw.githubusercontent.com/antrea-io/theia/main/build/yamls/flow-visibility.yml"
+	clickHouseOperatorURL  = "https://raw.githubusercontent.com/antrea-io/theia/%s/build/charts/theia/crds/clickhouse-operator-install-bundle.yaml"
+	customResourcesTimeout = 5 * time.Minute
+)
+
+// installCmd represents the install command group
+var installCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Commands to install Theia",
+	Long: `Command group to install Theia.
+	Must specify a subcommand like flow-visibility`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Error: Must also specify a subcommand like flow-visibility")
+	},
+}
+
+// uninstallCmd represents the uninstall command group
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Commands to uninstall Theia",
+	Long: `Command group to uninstall Theia.
+	Must specify a subcommand like flow-visibility`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Error: Must also specify a subcommand like flow-visibility")
+	},
+}
+
+// installFlowVisibilityCmd represents the install flow-visibility command
+var installFlowVisibilityCmd = &cobra.Command{
+	Use:   "flow-visibility",
+	Short: "Install the flow visibility components of Theia",
+	Long: `Install the ClickHouse Operator and the flow visibility components of Theia:
+the ClickHouse cluster, Grafana, and the Spark Operator and Theia Manager if
+they are enabled in the Theia manifest. By default, the manifests of the same
+version as this CLI are downloaded from the Theia repository. The objects of
+the manifests can be overridden with --set before they are applied with
+server-side apply.`,
+	Args: cobra.NoArgs,
+	Example: `
+Install flow visibility
+$ theia install flow-visibility
+Install flow visibility from a manifest generated with the Spark Operator and Theia Manager
+$ theia install flow-visibility --manifest flow-visibility.yml
+Install flow visibility with 2 ClickHouse shards and a different Grafana image tag
+$ theia install flow-visibility --set ClickHouseInstallation/clickhouse:spec.configuration.clusters.0.layout.shardsCount=2 \
+  --set Deployment/grafana:spec.template.spec.containers.0.image=grafana/grafana:8.3.3
+Print the objects to install without applying them
+$ theia install flow-visibility --dry-run
+`,
+	RunE: installFlowVisibility,
+}
+
+// uninstallFlowVisibilityCmd represents the uninstall flow-visibility command
+var uninstallFlowVisibilityCmd = &cobra.Command{
+	Use:   "flow-visibility",
+	Short: "Uninstall the flow visibility components of Theia",
+	Long: `Uninstall the flow visibility components of Theia and the ClickHouse Operator,
+by deleting the objects of the manifests which were installed, in the reverse
+order. The custom resources, e.g. the ClickHouse cluster, are deleted first,
+and their deletion is awaited so that their operators can clean them up. The
+objects to delete are listed and must be confirmed, unless --yes is given.
+
+The CustomResourceDefinitions of the manifests, e.g. of the ClickHouse Operator,
+are only deleted with --delete-crds, as deleting them deletes all their custom
+resources in the cluster. A development build of the CLI requires the manifests
+which were installed to be given with --manifest.`,
+	Args: cobra.NoArgs,
+	Example: `
+Uninstall flow visibility
+$ theia uninstall flow-visibility
+Uninstall flow visibility installed from a manifest, keeping the ClickHouse Operator
+$ theia uninstall flow-visibility --manifest flow-visibility.yml --skip-clickhouse-operator
+Uninstall flow visibility and the CRDs of the ClickHouse Operator without confirmation
+$ theia uninstall flow-visibility --delete-crds --yes
+`,
+	RunE: uninstallFlowVisibility,
+}
+
+func init() {
+	rootCmd.AddCommand(installCmd)
+	rootCmd.AddCommand(uninstallCmd)
+	installCmd.AddCommand(installFlowVisibilityCmd)
+	uninstallCmd.AddCommand(uninstallFlowVisibilityCmd)
+	for _, cmd := range []*cobra.Command{installFlowVisibilityCmd, uninstallFlowVisibilityCmd} {
+		cmd.Flags().StringSlice(
+			"manifest",
+			nil,
+			`Paths or URLs of the Theia manifests, e.g. generated with hack/generate-manifest.sh.
+The manifest of the same version as this CLI is used by default.`,
+		)
+		cmd.Flags().Bool(
+			"skip-clickhouse-operator",
+			false,
+			"Do not apply or delete the ClickHouse Operator, e.g. when it is shared with another Theia installation.",
+		)
+	}
+	uninstallFlowVisibilityCmd.Flags().Bool(
+		"delete-crds",
+		false,
+		"Also delete the CustomResourceDefinitions of the manifests, and thereby all their custom resources in the cluster.",
+	)
+	uninstallFlowVisibilityCmd.Flags().BoolP(
+		"yes",
+		"y",
+		false,
+		"Delete the objects without asking for confirmation.",
+	)
+	installFlowVisibilityCmd.Flags().StringArray(
+		"set",
+		nil,
+		`Override a field of an object of the manifests, as <kind>/<name>:<field path>=<value>.
+The indices of list items are numbers in the field path, and the value is parsed as YAML.`,
+	)
+	installFlowVisibilityCmd.Flags().Bool(
+		"dry-run",
+		false,
+		"Print the objects to install without applying them.",
+	)
+}
+
+// defaultManifestRef returns the git reference of the manifests of the same
+// version as the CLI.
+func defaultManifestRef() string {
+	if version.ReleaseStatus == "released" {
+		return version.Version
+	}
+	return "main"
+}
+
+// loadFlowVisibilityObjects returns the objects of the ClickHouse Operator and
+// of the Theia manifests given by the flags.
+func loadFlowVisibilityObjects(cmd *cobra.Command) ([]*unstructured.Unstructured, error) {
+	manifests, err := cmd.Flags().GetStringSlice("manifest")
+	if err != nil {
+		return nil, err
+	}
+	skipOperator, err := cmd.Flags().GetBool("skip-clickhouse-operator")
+	if err != nil {
+		return nil, err
+	}
+	ref := defaultManifestRef()
+	if len(manifests) == 0 {
+		if ref == "main" {
+			manifests = []string{devManifestURL}
+		} else {
+			manifests = []string{fmt.Sprintf(releaseManifestURL, ref)}
+		}
+	}
+	if !skipOperator {
+		manifests = append([]string{fmt.Sprintf(clickHouseOperatorURL, ref)}, manifests...)
+	}
+	var objects []*unstructured.Unstructured
+	for _, manifest := range manifests {
+		data, err := loadManifest(manifest)
+		if err != nil {
+			return nil, err
+		}
+		manifestObjects, err := parseManifest(data)
+		if err != nil {
+			return nil, fmt.Errorf("error when parsing manifest %s: %v", manifest, err)
+		}
+		objects = append(objects, manifestObjects...)
+	}
+	return objects, nil
+}
+
+func installFlowVisibility(cmd *cobra.Command, args []string) error {
+	sets, err := cmd.Flags().GetStringArray("set")
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	var overrides []manifestOverride
+	for _, set := range sets {
+		override, err := parseOverride(set)
+		if err != nil {
+			return err
+		}
+		overrides = append(overrides, override)
+	}
+	objects, err := loadFlowVisibilityObjects(cmd)
+	if err != nil {
+		return err
+	}
+	if err := applyOverrides(objects, overrides); err != nil {
+		return err
+	}
+	sortForApply(objects)
+	if dryRun {
+		for _, object := range objects {
+			data, err := yaml.Marshal(object.Object)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("---\n%s", data)
+		}
+		return nil
+	}
+
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+	}
+	client, err := newManifestClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+	}
+	for _, object := range objects {
+		if err := client.apply(object); err != nil {
+			return fmt.Errorf("error when applying %s: %v", objectRef(object), err)
+		}
+		fmt.Printf("%s applied\n", objectRef(object))
+	}
+	fmt.Println("Flow visibility is installed. The Pods may take a few minutes to be ready, check them with:")
+	fmt.Println("  kubectl get pods -n flow-visibility")
+	return nil
+}
+
+func uninstallFlowVisibility(cmd *cobra.Command, args []string) error {
+	manifests, err := cmd.Flags().GetStringSlice("manifest")
+	if err != nil {
+		return err
+	}
+	deleteCRDs, err := cmd.Flags().GetBool("delete-crds")
+	if err != nil {
+		return err
+	}
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+	// The manifests on the main branch may not match what was installed
+	if len(manifests) == 0 && defaultManifestRef() == "main" {
+		return fmt.Errorf("the manifests which were installed must be given with --manifest to uninstall with a development build of the CLI")
+	}
+	loadedObjects, err := loadFlowVisibilityObjects(cmd)
+	if err != nil {
+		return err
+	}
+	var objects []*unstructured.Unstructured
+	for _, object := range loadedObjects {
+		if object.GetKind() == "CustomResourceDefinition" && !deleteCRDs {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	sortForApply(objects)
+	if !yes {
+		confirmed, err := confirmDeletion(cmd, objects)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("Flow visibility is not uninstalled")
+			return nil
+		}
+	}
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+	}
+	client, err := newManifestClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+	}
+
+	// The custom resources are deleted before their operators, which remove
+	// their finalizers.
+	kinds := customKinds(objects)
+	var others []*unstructured.Unstructured
+	for _, object := range objects {
+		if !kinds[object.GroupVersionKind().GroupKind()] {
+			others = append(others, object)
+			continue
+		}
+		if err := deleteObject(client, object); err != nil {
+			return err
+		}
+		if err := client.waitForDeletion(object, customResourcesTimeout); err != nil {
+			return fmt.Errorf("error when waiting for the deletion of %s: %v", objectRef(object), err)
+		}
+	}
+	for i := len(others) - 1; i >= 0; i-- {
+		if err := deleteObject(client, others[i]); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Flow visibility is uninstalled")
+	return nil
+}
+
+// confirmDeletion lists the objects to delete and asks for confirmation on the
+// input of the command.
+func confirmDeletion(cmd *cobra.Command, objects []*unstructured.Unstructured) (bool, error) {
+	fmt.Println("The following objects will be deleted:")
+	for _, object := range objects {
+		fmt.Printf("  %s\n", objectRef(object))
+	}
+	fmt.Print("Do you want to continue? [y/N] ")
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("error when reading the confirmation: %v", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func deleteObject(client *manifestClient, object *unstructured.Unstructured) error {
+	deleted, err := client.delete(object)
+	if err != nil {
+		return fmt.Errorf("error when deleting %s: %v", objectRef(object), err)
+	}
+	if deleted {
+		fmt.Printf("%s deleted\n", objectRef(object))
+	} else {
+		fmt.Printf("%s not found\n", objectRef(object))
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testOperatorManifest = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clickhouseinstallations.clickhouse.altinity.com
+spec:
+  group: clickhouse.altinity.com
+  names:
+    kind: ClickHouseInstallation
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: clickhouse-operator
+  namespace: kube-system
+`
+
+const testTheiaManifest = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: flow-visibility
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: grafana
+  namespace: flow-visibility
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: grafana
+        image: grafana/grafana:8.3.3
+---
+apiVersion: clickhouse.altinity.com/v1
+kind: ClickHouseInstallation
+metadata:
+  name: clickhouse
+  namespace: flow-visibility
+`
+
+// testRESTMapper only maps the ClickHouseInstallations after it is reset,
+// like a discovery mapper before the CRD is served.
+type testRESTMapper struct {
+	*meta.DefaultRESTMapper
+}
+
+func (m testRESTMapper) Reset() {
+	m.Add(schema.GroupVersionKind{Group: "clickhouse.altinity.com", Version: "v1", Kind: "ClickHouseInstallation"}, meta.RESTScopeNamespace)
+}
+
+func newTestManifestClient() (*manifestClient, *dynamicfake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	return &manifestClient{client: client, mapper: testRESTMapper{mapper}}, client
+}
+
+func newInstallTestCommand(t *testing.T, manifest string) *cobra.Command {
+	manifestPath := filepath.Join(t.TempDir(), "flow-visibility.yml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte(manifest), 0600))
+	cmd := new(cobra.Command)
+	cmd.Flags().StringSlice("manifest", []string{manifestPath}, "")
+	cmd.Flags().Bool("skip-clickhouse-operator", false, "")
+	cmd.Flags().StringArray("set", nil, "")
+	cmd.Flags().Bool("dry-run", false, "")
+	cmd.Flags().Bool("delete-crds", false, "")
+	cmd.Flags().Bool("yes", false, "")
+	cmd.Flags().String("kubeconfig", "", "")
+	return cmd
+}
+
+func setupInstallTest(t *testing.T) *dynamicfake.FakeDynamicClient {
+	client, fakeClient := newTestManifestClient()
+	oldHTTPGet, oldNewManifestClient, oldInterval := httpGet, newManifestClient, resourcePollInterval
+	httpGet = func(url string) (*http.Response, error) {
+		assert.Contains(t, url, "clickhouse-operator-install-bundle.yaml")
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(testOperatorManifest))}, nil
+	}
+	newManifestClient = func(kubeconfig string) (*manifestClient, error) {
+		return client, nil
+	}
+	resourcePollInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		httpGet, newManifestClient, resourcePollInterval = oldHTTPGet, oldNewManifestClient, oldInterval
+	})
+	return fakeClient
+}
+
+func TestInstallFlowVisibility(t *testing.T) {
+	fakeClient := setupInstallTest(t)
+	var applied []string
+	var grafanaPatch string
+	fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		applied = append(applied, patchAction.GetResource().Resource+"/"+patchAction.GetName())
+		if patchAction.GetName() == "grafana" {
+			grafanaPatch = string(patchAction.GetPatch())
+		}
+		return true, nil, nil
+	})
+	cmd := newInstallTestCommand(t, testTheiaManifest)
+	cmd.Flags().Set("set", "Deployment/grafana:spec.replicas=2")
+	cmd.Flags().Set("set", "deployment/grafana:spec.template.spec.containers.0.image=grafana/grafana:9.1.6")
+
+	orig := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	require.NoError(t, installFlowVisibility(cmd, nil))
+	outcome := readStdout(t, r, w)
+
+	assert.Equal(t, []string{
+		"namespaces/flow-visibility",
+		"customresourcedefinitions/clickhouseinstallations.clickhouse.altinity.com",
+		"deployments/clickhouse-operator",
+		"deployments/grafana",
+		"clickhouseinstallations/clickhouse",
+	}, applied)
+	assert.Contains(t, grafanaPatch, `"replicas":2`)
+	assert.Contains(t, grafanaPatch, `"image":"grafana/grafana:9.1.6"`)
+	assert.Contains(t, outcome, "ClickHouseInstallation/clickhouse applied")
+	assert.Contains(t, outcome, "Flow visibility is installed")
+}
+
+func TestInstallFlowVisibilityDryRun(t *testing.T) {
+	fakeClient := setupInstallTest(t)
+	cmd := newInstallTestCommand(t, testTheiaManifest)
+	cmd.Flags().Set("skip-clickhouse-operator", "true")
+	cmd.Flags().Set("dry-run", "true")
+
+	orig := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	require.NoError(t, installFlowVisibility(cmd, nil))
+	outcome := readStdout(t, r, w)
+
+	assert.Empty(t, fakeClient.Actions())
+	assert.NotContains(t, outcome, "clickhouse-operator")
+	assert.Equal(t, 3, strings.Count(outcome, "---\n"))
+	assert.Contains(t, outcome, "image: grafana/grafana:8.3.3")
+}
+
+func TestInstallFlowVisibilityInvalidOverride(t *testing.T) {
+	for _, tc := range []struct {
+		set              string
+		expectedErrorMsg string
+	}{
+		{set: "Deployment/grafana.spec.replicas=2", expectedErrorMsg: "invalid override"},
+		{set: "Deployment/grafana:spec.replicas", expectedErrorMsg: "invalid override"},
+		{set: "Deployment/theia-manager:spec.replicas=2", expectedErrorMsg: "no object Deployment/theia-manager in the manifests"},
+		{set: "Deployment/grafana:spec.template.spec.containers.1.image=grafana", expectedErrorMsg: "invalid index 1 of a list of 1 items"},
+		{set: "Deployment/grafana:spec.replicas.value=2", expectedErrorMsg: "field value is not in a map or a list"},
+	} {
+		t.Run(tc.set, func(t *testing.T) {
+			setupInstallTest(t)
+			cmd := newInstallTestCommand(t, testTheiaManifest)
+			cmd.Flags().Set("set", tc.set)
+			assert.ErrorContains(t, installFlowVisibility(cmd, nil), tc.expectedErrorMsg)
+		})
+	}
+}
+
+func TestUninstallFlowVisibility(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		deleteCRDs      bool
+		yes             bool
+		input           string
+		expectedDeleted []string
+		expectedOutcome string
+	}{
+		{
+			name:       "Delete CRDs without confirmation",
+			deleteCRDs: true,
+			yes:        true,
+			expectedDeleted: []string{
+				"clickhouseinstallations/clickhouse",
+				"deployments/clickhouse-operator",
+				"customresourcedefinitions/clickhouseinstallations.clickhouse.altinity.com",
+				"namespaces/flow-visibility",
+			},
+			expectedOutcome: "Flow visibility is uninstalled",
+		},
+		{
+			name:  "Keep CRDs with confirmation",
+			input: "y\n",
+			expectedDeleted: []string{
+				"clickhouseinstallations/clickhouse",
+				"deployments/clickhouse-operator",
+				"namespaces/flow-visibility",
+			},
+			expectedOutcome: "Flow visibility is uninstalled",
+		},
+		{
+			name:            "Not confirmed",
+			input:           "n\n",
+			expectedOutcome: "Flow visibility is not uninstalled",
+		},
+		{
+			name:            "No input",
+			expectedOutcome: "Flow visibility is not uninstalled",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fakeClient := setupInstallTest(t)
+			var deleted []string
+			fakeClient.PrependReactor("delete", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				deleteAction := action.(k8stesting.DeleteAction)
+				if deleteAction.GetName() == "grafana" {
+					return true, nil, apierrors.NewNotFound(deleteAction.GetResource().GroupResource(), "grafana")
+				}
+				deleted = append(deleted, deleteAction.GetResource().Resource+"/"+deleteAction.GetName())
+				return true, nil, nil
+			})
+			cmd := newInstallTestCommand(t, testTheiaManifest)
+			if tc.deleteCRDs {
+				cmd.Flags().Set("delete-crds", "true")
+			}
+			if tc.yes {
+				cmd.Flags().Set("yes", "true")
+			}
+			cmd.SetIn(strings.NewReader(tc.input))
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			require.NoError(t, uninstallFlowVisibility(cmd, nil))
+			outcome := readStdout(t, r, w)
+
+			assert.Equal(t, tc.expectedDeleted, deleted)
+			assert.Contains(t, outcome, tc.expectedOutcome)
+			if tc.yes {
+				assert.NotContains(t, outcome, "Do you want to continue?")
+			} else {
+				assert.Contains(t, outcome, "  Deployment/grafana\n")
+			}
+			if len(tc.expectedDeleted) > 0 {
+				assert.Contains(t, outcome, "Deployment/grafana not found")
+			}
+		})
+	}
+}
+
+func TestUninstallFlowVisibilityDevelopmentBuild(t *testing.T) {
+	fakeClient := setupInstallTest(t)
+	cmd := newInstallTestCommand(t, testTheiaManifest)
+	cmd.Flags().Set("yes", "true")
+	// No manifest is given
+	require.NoError(t, cmd.Flags().Lookup("manifest").Value.(pflag.SliceValue).Replace(nil))
+	assert.EqualError(t, uninstallFlowVisibility(cmd, nil), "the manifests which were installed must be given with --manifest to uninstall with a development build of the CLI")
+	assert.Empty(t, fakeClient.Actions())
+}
+
+func TestParseManifest(t *testing.T) {
+	objects, err := parseManifest([]byte("---\n" + testOperatorManifest + "\n---\n---\n"))
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "CustomResourceDefinition", objects[0].GetKind())
+	assert.Equal(t, "clickhouse-operator", objects[1].GetName())
+	assert.Equal(t, map[schema.GroupKind]bool{{Group: "clickhouse.altinity.com", Kind: "ClickHouseInstallation"}: true}, customKinds(objects))
+
+	_, err = parseManifest([]byte("apiVersion: v1\nmetadata:\n  name: test\n"))
+	assert.ErrorContains(t, err, "object without kind or name")
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// jobCmd represents the analytics job command group
+var jobCmd = &cobra.Command{
+	Use:   "job",
+	Short: "Commands of the custom analytics jobs",
+	Long: `Command group of the custom analytics jobs, which run the Spark job templates
+registered in the Theia Manager configuration.
+	Must specify a subcommand like templates, start, list, delete, status, logs or retrieve`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Error: Must also specify a subcommand like templates, start, list, delete, status, logs or retrieve")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(jobCmd)
+	addUseClusterIPFlag(jobCmd)
+	jobCmd.AddCommand(newJobLogsCommand(analyticsJobs, `
+Print the logs of the analytics job with name job-e998433e-accb-4888-9fc8-06563f073e86
+$ theia job logs job-e998433e-accb-4888-9fc8-06563f073e86
+Print the last 100 lines of the logs and stream the new lines
+$ theia job logs job-e998433e-accb-4888-9fc8-06563f073e86 --tail 100 -f
+`))
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// jobDeleteCmd represents the job delete command
+var jobDeleteCmd = &cobra.Command{
+	Use:     "delete",
+	Short:   "Delete an analytics job",
+	Long:    `Delete an analytics job by name, along with its result.`,
+	Aliases: []string{"del"},
+	Args:    cobra.RangeArgs(0, 1),
+	Example: `
+Delete the analytics job with name job-e998433e-accb-4888-9fc8-06563f073e86
+$ theia job delete job-e998433e-accb-4888-9fc8-06563f073e86
+`,
+	RunE: jobDelete,
+}
+
+func init() {
+	jobCmd.AddCommand(jobDeleteCmd)
+	jobDeleteCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the analytics job.",
+	)
+	jobDeleteCmd.RegisterFlagCompletionFunc("name", completeJobNames(analyticsJobResource))
+	jobDeleteCmd.ValidArgsFunction = completeJobNameArg(analyticsJobResource)
+}
+
+func jobDelete(cmd *cobra.Command, args []string) error {
+	return analyticsJobs.runDelete(cmd, args)
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// jobListCmd represents the job list command
+var jobListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List all analytics jobs",
+	Long:    `List all analytics jobs with name, template, creation time, completion time and status.`,
+	Aliases: []string{"ls"},
+	Example: `
+List all analytics jobs
+$ theia job list
+`,
+	RunE: jobList,
+}
+
+func init() {
+	jobCmd.AddCommand(jobListCmd)
+}
+
+func jobList(cmd *cobra.Command, args []string) error {
+	return analyticsJobs.runList(cmd, args)
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+)
+
+// jobRetrieveCmd represents the job retrieve command
+var jobRetrieveCmd = &cobra.Command{
+	Use:   "retrieve",
+	Short: "Get the result of an analytics job",
+	Long: `Get the result of a completed analytics job by name. The result is made of
+the records written by the job, one per line.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Get the result of the analytics job with name job-e998433e-accb-4888-9fc8-06563f073e86
+$ theia job retrieve job-e998433e-accb-4888-9fc8-06563f073e86
+Get the result of the analytics job and save it to a file
+$ theia job retrieve job-e998433e-accb-4888-9fc8-06563f073e86 -f output.json
+`,
+	RunE: jobRetrieve,
+}
+
+func init() {
+	jobCmd.AddCommand(jobRetrieveCmd)
+	jobRetrieveCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the analytics job, or latest for the most recently created one.",
+	)
+	jobRetrieveCmd.Flags().StringP(
+		"file",
+		"f",
+		"",
+		"The file path where you want to save the result.",
+	)
+	jobRetrieveCmd.RegisterFlagCompletionFunc("name", completeJobNames(analyticsJobResource))
+	jobRetrieveCmd.ValidArgsFunction = completeJobNameArg(analyticsJobResource)
+}
+
+func jobRetrieve(cmd *cobra.Command, args []string) error {
+	jobName, err := getJobName(cmd, args)
+	if err != nil {
+		return err
+	}
+	err = analyticsJobs.validateName(jobName)
+	if err != nil {
+		return err
+	}
+	filePath, err := getPathFlag(cmd, "file")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return err
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	jobName, err = analyticsJobs.resolveName(theiaClient, jobName)
+	if err != nil {
+		return err
+	}
+	obj, err := analyticsJobs.get(theiaClient, jobName)
+	if err != nil {
+		return fmt.Errorf("error when getting analytics job by using job name: %v", err)
+	}
+	job := obj.(*intelligence.AnalyticsJob)
+	if job.Status.State != "COMPLETED" {
+		return fmt.Errorf("analytics job %s is not completed, its status is %s", jobName, job.Status.State)
+	}
+	if job.Status.ErrorMsg != "" {
+		return fmt.Errorf("error when getting the result of analytics job %s: %s", jobName, job.Status.ErrorMsg)
+	}
+	var result string
+	if len(job.Status.Result) > 0 {
+		result = strings.Join(job.Status.Result, "\n") + "\n"
+	}
+	if filePath != "" {
+		if err := os.WriteFile(filePath, []byte(result), 0600); err != nil {
+			return fmt.Errorf("error when writing analytics job result to file: %v", err)
+		}
+	} else {
+		fmt.Print(result)
+	}
+	return nil
+}
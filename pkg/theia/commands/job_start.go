@@ -0,0 +1,123 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/util"
+)
+
+// jobStartCmd represents the job start command
+var jobStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a new analytics job",
+	Long: `Start a new analytics job from one of the job templates registered in the
+Theia Manager configuration. The arguments of the template are given with
+--arg, the arguments which are not given take the default of the template.`,
+	Example: `
+Start an analytics job from the template top-talkers
+$ theia job start --template top-talkers --arg start_time="2023-01-01 00:00:00" --arg limit=5
+Start an analytics job with 2 executors of 1G of memory
+$ theia job start --template top-talkers --executor-instances 2 --executor-memory 1G
+`,
+	RunE: jobStart,
+}
+
+func init() {
+	jobCmd.AddCommand(jobStartCmd)
+	jobStartCmd.Flags().StringP(
+		"template",
+		"t",
+		"",
+		"Name of the job template, as listed by theia job templates.",
+	)
+	err := jobStartCmd.MarkFlagRequired("template")
+	if err != nil {
+		fmt.Printf("Template not specified: %v", err)
+	}
+	jobStartCmd.Flags().StringArray(
+		"arg",
+		nil,
+		`An argument of the job template, as name=value. The flag can be repeated
+to give several arguments.`,
+	)
+	addSparkResourceFlags(jobStartCmd)
+}
+
+func jobStart(cmd *cobra.Command, args []string) error {
+	job := intelligence.AnalyticsJob{}
+	template, err := cmd.Flags().GetString("template")
+	if err != nil {
+		return err
+	}
+	if template == "" {
+		return fmt.Errorf("template should be specified")
+	}
+	job.Template = template
+
+	jobArgs, err := cmd.Flags().GetStringArray("arg")
+	if err != nil {
+		return err
+	}
+	for _, arg := range jobArgs {
+		name, value, found := strings.Cut(arg, "=")
+		if !found || name == "" {
+			return fmt.Errorf("arg %q should be in the name=value format", arg)
+		}
+		if job.Args == nil {
+			job.Args = make(map[string]string)
+		}
+		if _, ok := job.Args[name]; ok {
+			return fmt.Errorf("arg %s is given more than once", name)
+		}
+		job.Args[name] = value
+	}
+
+	resources, err := getSparkResources(cmd)
+	if err != nil {
+		return err
+	}
+	job.ExecutorInstances = resources.executorInstances
+	job.DriverCoreRequest = resources.driverCoreRequest
+	job.DriverMemory = resources.driverMemory
+	job.ExecutorCoreRequest = resources.executorCoreRequest
+	job.ExecutorMemory = resources.executorMemory
+
+	job.Name = "job-" + uuid.New().String()
+	job.Namespace = theiaNamespace
+	job.Annotations = map[string]string{util.CorrelationIDAnnotation: getCorrelationID()}
+
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return err
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	err = analyticsJobs.submit(theiaClient, &job)
+	if err != nil {
+		return err
+	}
+	klog.V(2).InfoS("Created analytics job", "name", job.Name, "template", job.Template, "correlationID", getCorrelationID())
+	fmt.Printf("Successfully started analytics job with name: %s\n", job.Name)
+	return nil
+}
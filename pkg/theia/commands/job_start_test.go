@@ -0,0 +1,142 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestJobStart(t *testing.T) {
+	testCases := []struct {
+		name             string
+		jobArgs          []string
+		executorMemory   string
+		expectedArgs     map[string]string
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:         "Valid case",
+			jobArgs:      []string{"start_time=2023-01-01 00:00:00", "limit=5"},
+			expectedArgs: map[string]string{"start_time": "2023-01-01 00:00:00", "limit": "5"},
+			expectedMsg:  []string{"Successfully started analytics job with name: job-"},
+		},
+		{
+			name:        "Valid case without args",
+			expectedMsg: []string{"Successfully started analytics job with name: job-"},
+		},
+		{
+			name:             "Invalid arg",
+			jobArgs:          []string{"limit"},
+			expectedErrorMsg: `arg "limit" should be in the name=value format`,
+		},
+		{
+			name:             "Duplicated arg",
+			jobArgs:          []string{"limit=5", "limit=6"},
+			expectedErrorMsg: "arg limit is given more than once",
+		},
+		{
+			name:             "Invalid executor-memory",
+			executorMemory:   "1GB",
+			expectedErrorMsg: "executor-memory should conform to the Kubernetes resource quantity convention",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var postedJob *intelligence.AnalyticsJob
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/intelligence.theia.antrea.io/v1alpha1/analyticsjobs":
+					if r.Method == "POST" {
+						postedJob = &intelligence.AnalyticsJob{}
+						json.NewDecoder(r.Body).Decode(postedJob)
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+					}
+				}
+			}))
+			defer testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("template", "top-talkers", "")
+			cmd.Flags().StringArray("arg", tt.jobArgs, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "200m", "")
+			cmd.Flags().String("driver-memory", "512M", "")
+			cmd.Flags().String("executor-core-request", "200m", "")
+			executorMemory := tt.executorMemory
+			if executorMemory == "" {
+				executorMemory = "512M"
+			}
+			cmd.Flags().String("executor-memory", executorMemory, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := jobStart(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+				require.NotNil(t, postedJob)
+				assert.Equal(t, "top-talkers", postedJob.Template)
+				assert.Equal(t, tt.expectedArgs, postedJob.Args)
+				assert.Equal(t, "512M", postedJob.ExecutorMemory)
+				assert.True(t, strings.HasPrefix(postedJob.Name, "job-"))
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+				assert.Nil(t, postedJob)
+			}
+		})
+	}
+}
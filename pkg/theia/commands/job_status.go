@@ -0,0 +1,60 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// jobStatusCmd represents the job status command
+var jobStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check the status of an analytics job",
+	Long: `Check the current status of an analytics job by name.
+It will return the status of this analytics job like SCHEDULED, RUNNING, COMPLETED, or FAILED.
+Without a name, or with --all, the status and the progress of all the analytics
+jobs are returned in a table.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Check the current status of job with name job-e998433e-accb-4888-9fc8-06563f073e86
+$ theia job status --name job-e998433e-accb-4888-9fc8-06563f073e86
+Or
+$ theia job status job-e998433e-accb-4888-9fc8-06563f073e86
+Check the current status of all the jobs
+$ theia job status --all
+`,
+	RunE: jobStatus,
+}
+
+func init() {
+	jobCmd.AddCommand(jobStatusCmd)
+	jobStatusCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the analytics job, or latest for the most recently created one.",
+	)
+	jobStatusCmd.Flags().Bool(
+		"all",
+		false,
+		"Check the status of all the analytics jobs.",
+	)
+	jobStatusCmd.RegisterFlagCompletionFunc("name", completeJobNames(analyticsJobResource))
+	jobStatusCmd.ValidArgsFunction = completeJobNameArg(analyticsJobResource)
+}
+
+func jobStatus(cmd *cobra.Command, args []string) error {
+	return analyticsJobs.runStatus(cmd, args)
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestJobStatus(t *testing.T) {
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		expectedMsg      []string
+		expectedErrorMsg string
+		jobName          string
+	}{
+		{
+			name: "Valid case",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/analyticsjobs/%s", jobName):
+					job := &intelligence.AnalyticsJob{
+						Template: "top-talkers",
+						Status: intelligence.AnalyticsJobStatus{
+							State:           "RUNNING",
+							CompletedStages: 1,
+							TotalStages:     4,
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(job)
+				}
+			})),
+			jobName: jobName,
+			expectedMsg: []string{
+				"Status of this analytics job is RUNNING: 1/4 (25%) stages completed",
+				"Template: top-talkers",
+			},
+		},
+		{
+			name: "Failed job",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/analyticsjobs/%s", jobName):
+					job := &intelligence.AnalyticsJob{
+						Template: "top-talkers",
+						Status: intelligence.AnalyticsJobStatus{
+							State:    "FAILED",
+							ErrorMsg: "testErrorMsg",
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(job)
+				}
+			})),
+			jobName: jobName,
+			expectedMsg: []string{
+				"Status of this analytics job is FAILED",
+				"Error message: testErrorMsg",
+			},
+		},
+		{
+			name: "Job failed with a ClickHouse error",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/analyticsjobs/%s", jobName):
+					job := &intelligence.AnalyticsJob{
+						Template: "top-talkers",
+						Status: intelligence.AnalyticsJobStatus{
+							State:    "FAILED",
+							ErrorMsg: "Code: 241. DB::Exception: Memory limit (for query) exceeded",
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(job)
+				}
+			})),
+			jobName: jobName,
+			expectedMsg: []string{
+				"Error message: Code: 241. DB::Exception: Memory limit (for query) exceeded",
+				"Hint: narrow the time range or lower the limit of the request",
+			},
+		},
+		{
+			name: "Analytics job not found",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			})),
+			jobName:          jobName,
+			expectedMsg:      []string{},
+			expectedErrorMsg: "error when getting analytics job by using job name",
+		},
+		{
+			name:             "Invalid job name",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			jobName:          "mock_jobName",
+			expectedMsg:      []string{},
+			expectedErrorMsg: "not a valid analytics job name",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			jobName:          jobName,
+			expectedMsg:      []string{},
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("name", "", "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := jobStatus(cmd, []string{tt.jobName})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+)
+
+// jobTemplatesCmd represents the job templates command
+var jobTemplatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List the templates of the analytics jobs",
+	Long: `List the templates of the analytics jobs registered in the Theia Manager
+configuration, with the arguments accepted by each of them.`,
+	Example: `
+List the job templates
+$ theia job templates
+`,
+	RunE: jobTemplates,
+}
+
+func init() {
+	jobCmd.AddCommand(jobTemplatesCmd)
+}
+
+func jobTemplates(cmd *cobra.Command, args []string) error {
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	templateList := &intelligence.JobTemplateList{}
+	err = theiaClient.Get().
+		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
+		Resource("jobtemplates").
+		Do(context.TODO()).Into(templateList)
+	if err != nil {
+		return fmt.Errorf("error when getting job template list: %v", err)
+	}
+
+	templateTable := [][]string{
+		{"Name", "Arguments", "Description"},
+	}
+	for _, template := range templateList.Items {
+		templateTable = append(templateTable,
+			[]string{
+				template.Name,
+				formatJobTemplateArgs(template.Args),
+				template.Description,
+			})
+	}
+	TableOutput(templateTable)
+	return nil
+}
+
+// formatJobTemplateArgs formats the arguments of a template as they are
+// given to the start command, marking the required ones and the defaults.
+func formatJobTemplateArgs(args []intelligence.JobTemplateArg) string {
+	var formatted []string
+	for _, arg := range args {
+		switch {
+		case arg.Required:
+			formatted = append(formatted, arg.Name+" (required)")
+		case arg.Default != "":
+			formatted = append(formatted, fmt.Sprintf("%s=%s", arg.Name, arg.Default))
+		default:
+			formatted = append(formatted, arg.Name)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,691 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	restclient "k8s.io/client-go/rest"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/commands/config"
+	"antrea.io/theia/pkg/theia/portforwarder"
+	"antrea.io/theia/pkg/util"
+	"antrea.io/theia/pkg/util/clickhouse"
+)
+
+// latestJobName can be given instead of the name of a job to the commands
+// which get a job, to refer to the job with the most recently created Spark
+// application.
+const latestJobName = "latest"
+
+// jobKind describes a kind of Spark job run by the Theia Manager, i.e. the
+// policy recommendation, throughput anomaly detection and custom analytics
+// jobs. The commands common to all the kinds (status, list, delete and logs)
+// are implemented once on top of it, while the arguments and the results of
+// the jobs are handled by the commands of each kind.
+type jobKind struct {
+	// resource is the resource of the jobs in the intelligence API group.
+	resource string
+	// description names a job of this kind in the messages of the commands.
+	description string
+	// sparkApplicationPrefix is prepended to the ID of the Spark application
+	// of a job to get the name of the SparkApplication.
+	sparkApplicationPrefix string
+	// parseName validates the name of a job.
+	parseName func(name string) error
+	// newJob returns an empty job to decode a job into.
+	newJob func() runtime.Object
+	// newList returns an empty list to decode the jobs into.
+	newList func() runtime.Object
+	// status returns the status common to all the kinds of a job.
+	status func(job runtime.Object) jobSummary
+	// items returns the jobs of a list.
+	items func(list runtime.Object) []runtime.Object
+	// selectable indicates whether the jobs can be deleted by tags or label
+	// selector.
+	selectable bool
+	// printDetails prints the status specific to the kind of a job, if set.
+	printDetails func(job runtime.Object)
+	// listColumns are the columns specific to the kind in the job list, and
+	// listRow returns their values for a job.
+	listColumns []string
+	listRow     func(job runtime.Object) []string
+}
+
+// jobSummary is the status common to all the kinds of jobs.
+type jobSummary struct {
+	name             string
+	state            string
+	sparkApplication string
+	completedStages  int
+	totalStages      int
+	errorMsg         string
+	startTime        time.Time
+	endTime          time.Time
+	correlationID    string
+}
+
+var (
+	policyRecommendationJobs = &jobKind{
+		resource:               policyRecommendationResource,
+		description:            "policy recommendation job",
+		sparkApplicationPrefix: "pr-",
+		parseName:              util.ParseRecommendationName,
+		newJob:                 func() runtime.Object { return &intelligence.NetworkPolicyRecommendation{} },
+		newList:                func() runtime.Object { return &intelligence.NetworkPolicyRecommendationList{} },
+		status: func(job runtime.Object) jobSummary {
+			npr := job.(*intelligence.NetworkPolicyRecommendation)
+			s := npr.Status
+			return newJobStatus(npr.ObjectMeta, s.State, s.SparkApplication, s.CompletedStages, s.TotalStages, s.ErrorMsg, s.StartTime, s.EndTime)
+		},
+		items: func(list runtime.Object) []runtime.Object {
+			nprList := list.(*intelligence.NetworkPolicyRecommendationList)
+			items := make([]runtime.Object, 0, len(nprList.Items))
+			for i := range nprList.Items {
+				items = append(items, &nprList.Items[i])
+			}
+			return items
+		},
+		selectable:   true,
+		printDetails: printPolicyRecommendationCanary,
+	}
+	anomalyDetectionJobs = &jobKind{
+		resource:               anomalyDetectorResource,
+		description:            "anomaly detection job",
+		sparkApplicationPrefix: "tad-",
+		parseName:              util.ParseADAlgorithmID,
+		newJob:                 func() runtime.Object { return &intelligence.ThroughputAnomalyDetector{} },
+		newList:                func() runtime.Object { return &intelligence.ThroughputAnomalyDetectorList{} },
+		status: func(job runtime.Object) jobSummary {
+			tad := job.(*intelligence.ThroughputAnomalyDetector)
+			s := tad.Status
+			return newJobStatus(tad.ObjectMeta, s.State, s.SparkApplication, s.CompletedStages, s.TotalStages, s.ErrorMsg, s.StartTime, s.EndTime)
+		},
+		items: func(list runtime.Object) []runtime.Object {
+			tadList := list.(*intelligence.ThroughputAnomalyDetectorList)
+			items := make([]runtime.Object, 0, len(tadList.Items))
+			for i := range tadList.Items {
+				items = append(items, &tadList.Items[i])
+			}
+			return items
+		},
+	}
+	analyticsJobs = &jobKind{
+		resource:               analyticsJobResource,
+		description:            "analytics job",
+		sparkApplicationPrefix: "job-",
+		parseName:              util.ParseAnalyticsJobName,
+		newJob:                 func() runtime.Object { return &intelligence.AnalyticsJob{} },
+		newList:                func() runtime.Object { return &intelligence.AnalyticsJobList{} },
+		status: func(job runtime.Object) jobSummary {
+			analyticsJob := job.(*intelligence.AnalyticsJob)
+			s := analyticsJob.Status
+			return newJobStatus(analyticsJob.ObjectMeta, s.State, s.SparkApplication, s.CompletedStages, s.TotalStages, s.ErrorMsg, s.StartTime, s.EndTime)
+		},
+		items: func(list runtime.Object) []runtime.Object {
+			jobList := list.(*intelligence.AnalyticsJobList)
+			items := make([]runtime.Object, 0, len(jobList.Items))
+			for i := range jobList.Items {
+				items = append(items, &jobList.Items[i])
+			}
+			return items
+		},
+		printDetails: func(job runtime.Object) {
+			fmt.Printf("Template: %s\n", job.(*intelligence.AnalyticsJob).Template)
+		},
+		listColumns: []string{"Template"},
+		listRow: func(job runtime.Object) []string {
+			return []string{job.(*intelligence.AnalyticsJob).Template}
+		},
+	}
+
+	// jobKinds are the kinds of jobs by resource.
+	jobKinds = map[string]*jobKind{
+		policyRecommendationResource: policyRecommendationJobs,
+		anomalyDetectorResource:      anomalyDetectionJobs,
+		analyticsJobResource:         analyticsJobs,
+	}
+)
+
+func newJobStatus(meta metav1.ObjectMeta, state, sparkApplication string, completedStages, totalStages int, errorMsg string, startTime, endTime metav1.Time) jobSummary {
+	return jobSummary{
+		name:             meta.Name,
+		state:            state,
+		sparkApplication: sparkApplication,
+		completedStages:  completedStages,
+		totalStages:      totalStages,
+		errorMsg:         errorMsg,
+		startTime:        startTime.Time,
+		endTime:          endTime.Time,
+		correlationID:    meta.Annotations[util.CorrelationIDAnnotation],
+	}
+}
+
+// started returns whether a job has a Spark application or is queued until
+// one can be started, as opposed to a job which is still being created.
+func (s jobSummary) started() bool {
+	return s.sparkApplication != "" || s.state == crdv1alpha1.NPRecommendationStateQueued
+}
+
+// addUseClusterIPFlag adds the use-cluster-ip flag to the command group of a
+// kind of jobs.
+func addUseClusterIPFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool(
+		"use-cluster-ip",
+		false,
+		`Enable this option will use ClusterIP instead of port forwarding when connecting to the Theia
+Manager Service. It can only be used when running in cluster.`,
+	)
+}
+
+// connectTheiaManager sets up the client of the Theia Manager according to
+// the use-cluster-ip flag of a command. The returned port forwarder, if not
+// nil, must be stopped by the caller.
+func connectTheiaManager(cmd *cobra.Command) (restclient.Interface, *portforwarder.PortForwarder, error) {
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return nil, nil, err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	return theiaClient, pf, nil
+}
+
+// getJobName returns the name of the job given by the name flag of a command,
+// or else as its argument.
+func getJobName(cmd *cobra.Command, args []string) (string, error) {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return "", err
+	}
+	if name == "" && len(args) == 1 {
+		name = args[0]
+	}
+	return name, nil
+}
+
+// validateName checks the name of a job given to a command, which may be
+// latestJobName to refer to the most recently created job.
+func (k *jobKind) validateName(name string) error {
+	if name == latestJobName {
+		return nil
+	}
+	return k.parseName(name)
+}
+
+// resolveName returns the name of the job with the most recently created
+// Spark application if name is latestJobName, or else name itself.
+func (k *jobKind) resolveName(theiaClient restclient.Interface, name string) (string, error) {
+	if name != latestJobName {
+		return name, nil
+	}
+	jobs, err := k.list(theiaClient, "")
+	if err != nil {
+		return "", err
+	}
+	var latest *jobSummary
+	for _, job := range jobs {
+		status := k.status(job)
+		// The start time of a job is the creation time of its Spark
+		// application.
+		if status.sparkApplication == "" {
+			continue
+		}
+		if latest == nil || status.startTime.After(latest.startTime) ||
+			(status.startTime.Equal(latest.startTime) && status.name > latest.name) {
+			latest = &status
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("no %s with a Spark application found", k.description)
+	}
+	fmt.Fprintf(os.Stderr, "Using the latest %s %s\n", k.description, latest.name)
+	return latest.name, nil
+}
+
+func (k *jobKind) submit(theiaClient restclient.Interface, job runtime.Object) error {
+	err := theiaClient.Post().
+		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
+		Resource(k.resource).
+		Body(job).
+		Do(context.TODO()).
+		Error()
+	if err != nil {
+		return fmt.Errorf("failed to post %s: %v", k.description, err)
+	}
+	return nil
+}
+
+func (k *jobKind) get(theiaClient restclient.Interface, name string) (runtime.Object, error) {
+	job := k.newJob()
+	err := theiaClient.Get().
+		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
+		Resource(k.resource).
+		Name(name).
+		Do(context.TODO()).
+		Into(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %v", k.description, name, err)
+	}
+	return job, nil
+}
+
+// list returns the jobs matching a label selector, or all the jobs if the
+// selector is empty.
+func (k *jobKind) list(theiaClient restclient.Interface, selector string) ([]runtime.Object, error) {
+	list := k.newList()
+	request := theiaClient.Get().
+		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
+		Resource(k.resource)
+	if selector != "" {
+		request = request.Param("labelSelector", selector)
+	}
+	if err := request.Do(context.TODO()).Into(list); err != nil {
+		return nil, fmt.Errorf("error when getting %s list: %v", k.description, err)
+	}
+	return k.items(list), nil
+}
+
+// runStatus prints the status of the job given as argument of a command, or
+// the status of all the jobs without a name or with the all flag.
+func (k *jobKind) runStatus(cmd *cobra.Command, args []string) error {
+	name, err := getJobName(cmd, args)
+	if err != nil {
+		return err
+	}
+	all, _ := cmd.Flags().GetBool("all")
+	if all && name != "" {
+		return fmt.Errorf("a job name cannot be specified with --all")
+	}
+	if name != "" {
+		if err := k.validateName(name); err != nil {
+			return err
+		}
+	}
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return err
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	if name == "" {
+		return k.printStatusAll(theiaClient)
+	}
+	name, err = k.resolveName(theiaClient, name)
+	if err != nil {
+		return err
+	}
+	job, err := k.get(theiaClient, name)
+	if err != nil {
+		return fmt.Errorf("error when getting %s by using job name: %v", k.description, err)
+	}
+	status := k.status(job)
+	state := status.state
+	if state == crdv1alpha1.NPRecommendationStateRunning {
+		state += ": " + formatStageProgress(status.completedStages, status.totalStages) + " stages completed"
+	}
+	fmt.Printf("Status of this %s is %s\n", k.description, state)
+	if status.errorMsg != "" {
+		fmt.Printf("Error message: %s\n", status.errorMsg)
+		if hint := clickhouse.GetHint(status.errorMsg); hint != "" {
+			fmt.Printf("Hint: %s\n", hint)
+		}
+	}
+	if status.correlationID != "" {
+		fmt.Printf("Correlation ID: %s\n", status.correlationID)
+	}
+	if k.printDetails != nil {
+		k.printDetails(job)
+	}
+	return nil
+}
+
+// printStatusAll prints the status and the progress of all the started jobs.
+func (k *jobKind) printStatusAll(theiaClient restclient.Interface) error {
+	jobs, err := k.list(theiaClient, "")
+	if err != nil {
+		return err
+	}
+	statusTable := [][]string{
+		{"Name", "Status", "Progress", "StartTime", "ErrorMessage"},
+	}
+	for _, job := range jobs {
+		status := k.status(job)
+		if !status.started() {
+			continue
+		}
+		progress := "N/A"
+		if status.state == crdv1alpha1.NPRecommendationStateRunning {
+			progress = formatStageProgress(status.completedStages, status.totalStages)
+		}
+		errorMessage := status.errorMsg
+		if errorMessage == "" {
+			errorMessage = "N/A"
+		}
+		statusTable = append(statusTable, []string{status.name, status.state, progress, FormatTimestamp(status.startTime), errorMessage})
+	}
+	if len(statusTable) == 1 {
+		fmt.Printf("No %s found\n", k.description)
+		return nil
+	}
+	TableOutput(statusTable)
+	return nil
+}
+
+// formatStageProgress formats the number of completed stages of a running
+// job along with their percentage.
+func formatStageProgress(completedStages, totalStages int) string {
+	if totalStages == 0 {
+		return "0/0 (0%)"
+	}
+	return fmt.Sprintf("%d/%d (%d%%)", completedStages, totalStages, completedStages*100/totalStages)
+}
+
+// runList prints the started jobs with their creation time, completion time
+// and status, followed by the columns specific to the kind.
+func (k *jobKind) runList(cmd *cobra.Command, args []string) error {
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return err
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	jobs, err := k.list(theiaClient, "")
+	if err != nil {
+		return err
+	}
+	jobTable := [][]string{
+		append([]string{"CreationTime", "CompletionTime", "Name", "Status"}, k.listColumns...),
+	}
+	for _, job := range jobs {
+		status := k.status(job)
+		if !status.started() {
+			continue
+		}
+		row := []string{
+			FormatTimestamp(status.startTime),
+			FormatTimestamp(status.endTime),
+			status.name,
+			status.state,
+		}
+		if k.listRow != nil {
+			row = append(row, k.listRow(job)...)
+		}
+		jobTable = append(jobTable, row)
+	}
+	TableOutput(jobTable)
+	return nil
+}
+
+// runDelete deletes the jobs given as argument of a command, separated by
+// spaces, or the jobs matching its tags or label selector if the kind is
+// selectable and no name is given.
+func (k *jobKind) runDelete(cmd *cobra.Command, args []string) error {
+	name, err := getJobName(cmd, args)
+	if err != nil {
+		return err
+	}
+	names := strings.Fields(name)
+	var selector string
+	if len(names) == 0 && k.selectable {
+		selector, err = getJobSelector(cmd)
+		if err != nil {
+			return err
+		}
+	}
+	if selector == "" {
+		if len(names) == 0 {
+			// Report the missing name as an invalid one.
+			names = []string{name}
+		}
+		for _, name := range names {
+			if err := k.parseName(name); err != nil {
+				return err
+			}
+		}
+	}
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return err
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	if selector != "" {
+		jobs, err := k.list(theiaClient, selector)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return fmt.Errorf("no %s matches selector %s", k.description, selector)
+		}
+		names = names[:0]
+		for _, job := range jobs {
+			names = append(names, k.status(job).name)
+		}
+	}
+	for _, name := range names {
+		err = theiaClient.Delete().
+			AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
+			Resource(k.resource).
+			Name(name).
+			Do(context.TODO()).
+			Error()
+		if err != nil {
+			return fmt.Errorf("error when deleting %s %s: %v", k.description, name, err)
+		}
+		fmt.Printf("Successfully deleted %s with name: %s\n", k.description, name)
+	}
+	return nil
+}
+
+// runLogs prints the logs of the Spark driver of the job given as argument
+// of a command.
+func (k *jobKind) runLogs(cmd *cobra.Command, args []string) error {
+	name, err := getJobName(cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := k.validateName(name); err != nil {
+		return err
+	}
+	tail, err := cmd.Flags().GetInt64("tail")
+	if err != nil {
+		return err
+	}
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return err
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	name, err = k.resolveName(theiaClient, name)
+	if err != nil {
+		return err
+	}
+	job, err := k.get(theiaClient, name)
+	if err != nil {
+		return fmt.Errorf("error when getting %s by using job name: %v", k.description, err)
+	}
+	status := k.status(job)
+	if status.sparkApplication == "" {
+		return fmt.Errorf("%s %s has no Spark application, its status is %s", k.description, name, status.state)
+	}
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return err
+	}
+	k8sClient, err := CreateK8sClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+	}
+	// The driver Pod is labeled by the Spark Operator with the name of its
+	// SparkApplication.
+	selector := fmt.Sprintf("spark-role=driver,sparkoperator.k8s.io/app-name=%s%s", k.sparkApplicationPrefix, status.sparkApplication)
+	pods, err := k8sClient.CoreV1().Pods(theiaNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("error when getting the Spark driver of %s %s: %v", k.description, name, err)
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("the Spark driver of %s %s was not found, it may not be started or may be deleted", k.description, name)
+	}
+	logOptions := &v1.PodLogOptions{Follow: follow}
+	if tail >= 0 {
+		logOptions.TailLines = &tail
+	}
+	stream, err := k8sClient.CoreV1().Pods(theiaNamespace).GetLogs(pods.Items[0].Name, logOptions).Stream(context.TODO())
+	if err != nil {
+		return fmt.Errorf("error when getting the logs of the Spark driver of %s %s: %v", k.description, name, err)
+	}
+	defer stream.Close()
+	if _, err := io.Copy(os.Stdout, stream); err != nil {
+		return fmt.Errorf("error when reading the logs of the Spark driver of %s %s: %v", k.description, name, err)
+	}
+	return nil
+}
+
+// newJobLogsCommand returns the logs command of a kind of jobs.
+func newJobLogsCommand(k *jobKind, example string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: fmt.Sprintf("Print the logs of a %s", k.description),
+		Long: fmt.Sprintf(`Print the logs of the Spark driver of a %s by name, to troubleshoot a
+failed or slow job. Reading the logs requires the permission to get the logs of
+the Pods of the Theia Namespace.`, k.description),
+		Args:    cobra.RangeArgs(0, 1),
+		Example: example,
+		RunE:    k.runLogs,
+	}
+	cmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		fmt.Sprintf("Name of the %s, or %s for the most recently created one.", k.description, latestJobName),
+	)
+	cmd.Flags().Int64(
+		"tail",
+		-1,
+		"Number of lines to print from the end of the logs. All the lines are printed by default.",
+	)
+	cmd.Flags().BoolP(
+		"follow",
+		"f",
+		false,
+		"Stream the logs until the driver terminates.",
+	)
+	cmd.RegisterFlagCompletionFunc("name", completeJobNames(k.resource))
+	cmd.ValidArgsFunction = completeJobNameArg(k.resource)
+	return cmd
+}
+
+// sparkResources are the resources requested by the Spark application of a
+// job.
+type sparkResources struct {
+	executorInstances   int
+	driverCoreRequest   string
+	driverMemory        string
+	executorCoreRequest string
+	executorMemory      string
+}
+
+// addSparkResourceFlags adds the flags of the resources requested by the
+// Spark application of a job to the command which starts it.
+func addSparkResourceFlags(cmd *cobra.Command) {
+	cmd.Flags().Int32(
+		"executor-instances",
+		1,
+		"Specify the number of executors for the Spark application. Example values include 1, 2, 8, etc.",
+	)
+	cmd.Flags().String(
+		"driver-core-request",
+		"200m",
+		`Specify the CPU request for the driver Pod. Values conform to the Kubernetes resource quantity convention.
+Example values include 0.1, 500m, 1.5, 5, etc.`,
+	)
+	cmd.Flags().String(
+		"driver-memory",
+		"512M",
+		`Specify the memory request for the driver Pod. Values conform to the Kubernetes resource quantity convention.
+Example values include 512M, 1G, 8G, etc.`,
+	)
+	cmd.Flags().String(
+		"executor-core-request",
+		"200m",
+		`Specify the CPU request for the executor Pod. Values conform to the Kubernetes resource quantity convention.
+Example values include 0.1, 500m, 1.5, 5, etc.`,
+	)
+	cmd.Flags().String(
+		"executor-memory",
+		"512M",
+		`Specify the memory request for the executor Pod. Values conform to the Kubernetes resource quantity convention.
+Example values include 512M, 1G, 8G, etc.`,
+	)
+}
+
+// getSparkResources returns the resources set by the flags added with
+// addSparkResourceFlags.
+func getSparkResources(cmd *cobra.Command) (sparkResources, error) {
+	var resources sparkResources
+	executorInstances, err := cmd.Flags().GetInt32("executor-instances")
+	if err != nil {
+		return resources, err
+	}
+	if executorInstances < 0 {
+		return resources, fmt.Errorf("executor-instances should be an integer >= 0")
+	}
+	resources.executorInstances = int(executorInstances)
+	quantities := []struct {
+		flag  string
+		value *string
+	}{
+		{"driver-core-request", &resources.driverCoreRequest},
+		{"driver-memory", &resources.driverMemory},
+		{"executor-core-request", &resources.executorCoreRequest},
+		{"executor-memory", &resources.executorMemory},
+	}
+	for _, quantity := range quantities {
+		value, err := cmd.Flags().GetString(quantity.flag)
+		if err != nil {
+			return resources, err
+		}
+		matchResult, err := regexp.MatchString(config.K8sQuantitiesReg, value)
+		if err != nil || !matchResult {
+			return resources, fmt.Errorf("%s should conform to the Kubernetes resource quantity convention", quantity.flag)
+		}
+		*quantity.value = value
+	}
+	return resources, nil
+}
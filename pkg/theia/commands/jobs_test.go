@@ -0,0 +1,293 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func setupTestTheiaClient(t *testing.T, handler http.HandlerFunc) {
+	testServer := httptest.NewServer(handler)
+	oldFunc := SetupTheiaClientAndConnection
+	SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+		clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+		clientset, _ := kubernetes.NewForConfig(clientConfig)
+		return clientset.CoreV1().RESTClient(), nil, nil
+	}
+	t.Cleanup(func() {
+		SetupTheiaClientAndConnection = oldFunc
+		testServer.Close()
+	})
+}
+
+func writeTestJob(w http.ResponseWriter, job runtime.Object) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+func TestJobLogs(t *testing.T) {
+	driverPod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tad-1234abcd-1234-abcd-12ab-12345678abcd-driver",
+			Namespace: theiaNamespace,
+			Labels: map[string]string{
+				"spark-role":                    "driver",
+				"sparkoperator.k8s.io/app-name": "tad-1234abcd-1234-abcd-12ab-12345678abcd",
+			},
+		},
+	}
+	testCases := []struct {
+		name             string
+		jobName          string
+		job              *intelligence.ThroughputAnomalyDetector
+		objects          []runtime.Object
+		expectedMsg      string
+		expectedErrorMsg string
+	}{
+		{
+			name:    "Valid case",
+			jobName: tadName,
+			job: &intelligence.ThroughputAnomalyDetector{
+				Status: intelligence.ThroughputAnomalyDetectorStatus{State: "RUNNING", SparkApplication: "1234abcd-1234-abcd-12ab-12345678abcd"},
+			},
+			objects:     []runtime.Object{driverPod},
+			expectedMsg: "fake logs",
+		},
+		{
+			name:    "Job without Spark application",
+			jobName: tadName,
+			job: &intelligence.ThroughputAnomalyDetector{
+				Status: intelligence.ThroughputAnomalyDetectorStatus{State: "NEW"},
+			},
+			expectedErrorMsg: fmt.Sprintf("anomaly detection job %s has no Spark application, its status is NEW", tadName),
+		},
+		{
+			name:    "Driver not found",
+			jobName: tadName,
+			job: &intelligence.ThroughputAnomalyDetector{
+				Status: intelligence.ThroughputAnomalyDetectorStatus{State: "COMPLETED", SparkApplication: "1234abcd-1234-abcd-12ab-12345678abcd"},
+			},
+			expectedErrorMsg: fmt.Sprintf("the Spark driver of anomaly detection job %s was not found", tadName),
+		},
+		{
+			name:             "Job not found",
+			jobName:          tadName,
+			expectedErrorMsg: "error when getting anomaly detection job by using job name",
+		},
+		{
+			name:             "Invalid job name",
+			jobName:          "mock_tadName",
+			expectedErrorMsg: "not a valid Throughput Anomaly Detection job name",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestTheiaClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.job != nil && strings.TrimSpace(r.URL.Path) == "/apis/intelligence.theia.antrea.io/v1alpha1/throughputanomalydetectors/"+tt.jobName {
+					writeTestJob(w, tt.job)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			})
+			oldCreateFunc := CreateK8sClient
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tt.objects...), nil
+			}
+			defer func() {
+				CreateK8sClient = oldCreateFunc
+			}()
+			cmd := newJobLogsCommand(anomalyDetectionJobs, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			cmd.Flags().String("kubeconfig", "", "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := cmd.RunE(cmd, []string{tt.jobName})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				assert.Contains(t, readStdout(t, r, w), tt.expectedMsg)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestJobStatusAll(t *testing.T) {
+	setupTestTheiaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeTestJob(w, &intelligence.ThroughputAnomalyDetectorList{
+			Items: []intelligence.ThroughputAnomalyDetector{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "tad-running"},
+					Status:     intelligence.ThroughputAnomalyDetectorStatus{State: "RUNNING", SparkApplication: "running", CompletedStages: 1, TotalStages: 4},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "tad-new"},
+					Status:     intelligence.ThroughputAnomalyDetectorStatus{State: "NEW"},
+				},
+			},
+		})
+	})
+	cmd := new(cobra.Command)
+	cmd.Flags().String("name", "", "")
+	cmd.Flags().Bool("use-cluster-ip", true, "")
+	cmd.Flags().Bool("all", true, "")
+
+	orig := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	require.NoError(t, anomalyDetectionStatus(cmd, nil))
+	outcome := readStdout(t, r, w)
+	assert.Contains(t, outcome, "tad-running    RUNNING        1/4 (25%)")
+	assert.NotContains(t, outcome, "tad-new")
+}
+
+func TestGetSparkResources(t *testing.T) {
+	testCases := []struct {
+		name              string
+		args              []string
+		expectedResources sparkResources
+		expectedErrorMsg  string
+	}{
+		{
+			name: "Default resources",
+			expectedResources: sparkResources{
+				executorInstances:   1,
+				driverCoreRequest:   "200m",
+				driverMemory:        "512M",
+				executorCoreRequest: "200m",
+				executorMemory:      "512M",
+			},
+		},
+		{
+			name: "Custom resources",
+			args: []string{"--executor-instances", "4", "--driver-memory", "1G", "--executor-core-request", "1.5"},
+			expectedResources: sparkResources{
+				executorInstances:   4,
+				driverCoreRequest:   "200m",
+				driverMemory:        "1G",
+				executorCoreRequest: "1.5",
+				executorMemory:      "512M",
+			},
+		},
+		{
+			name:             "Negative executor instances",
+			args:             []string{"--executor-instances", "-1"},
+			expectedErrorMsg: "executor-instances should be an integer >= 0",
+		},
+		{
+			name:             "Invalid driver core request",
+			args:             []string{"--driver-core-request", "200mc"},
+			expectedErrorMsg: "driver-core-request should conform to the Kubernetes resource quantity convention",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := new(cobra.Command)
+			addSparkResourceFlags(cmd)
+			require.NoError(t, cmd.Flags().Parse(tt.args))
+			resources, err := getSparkResources(cmd)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResources, resources)
+			} else {
+				assert.EqualError(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestResolveLatestJobName(t *testing.T) {
+	startTime := metav1.NewTime(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC))
+	testCases := []struct {
+		name             string
+		jobName          string
+		jobs             []intelligence.NetworkPolicyRecommendation
+		expectedName     string
+		expectedErrorMsg string
+	}{
+		{
+			name:    "Latest job",
+			jobName: latestJobName,
+			jobs: []intelligence.NetworkPolicyRecommendation{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "pr-old"},
+					Status:     intelligence.NetworkPolicyRecommendationStatus{State: "COMPLETED", SparkApplication: "old", StartTime: startTime},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "pr-new"},
+					Status:     intelligence.NetworkPolicyRecommendationStatus{State: "RUNNING", SparkApplication: "new", StartTime: metav1.NewTime(startTime.Add(time.Hour))},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "pr-queued"},
+					Status:     intelligence.NetworkPolicyRecommendationStatus{State: "QUEUED"},
+				},
+			},
+			expectedName: "pr-new",
+		},
+		{
+			name:             "No job with a Spark application",
+			jobName:          latestJobName,
+			jobs:             []intelligence.NetworkPolicyRecommendation{{ObjectMeta: metav1.ObjectMeta{Name: "pr-queued"}}},
+			expectedErrorMsg: "no policy recommendation job with a Spark application found",
+		},
+		{
+			name:         "Job name",
+			jobName:      nprName,
+			expectedName: nprName,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestTheiaClient(t, func(w http.ResponseWriter, r *http.Request) {
+				writeTestJob(w, &intelligence.NetworkPolicyRecommendationList{Items: tt.jobs})
+			})
+			theiaClient, _, err := SetupTheiaClientAndConnection(nil, false)
+			require.NoError(t, err)
+			name, err := policyRecommendationJobs.resolveName(theiaClient, tt.jobName)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedName, name)
+			} else {
+				assert.EqualError(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
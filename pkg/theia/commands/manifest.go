@@ -0,0 +1,335 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+)
+
+// fieldManager is the field manager of the objects applied by theia.
+const fieldManager = "theia-cli"
+
+var (
+	httpGet = http.Get
+	// Interval and timeout of waiting for the API server to serve the
+	// resources of newly applied CRDs.
+	resourcePollInterval = time.Second
+	resourcePollTimeout  = 30 * time.Second
+	newManifestClient    = func(kubeconfig string) (*manifestClient, error) {
+		config, err := buildConfig(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		dynamicClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		return &manifestClient{
+			client: dynamicClient,
+			mapper: restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)),
+		}, nil
+	}
+)
+
+// loadManifest reads a manifest from a local file or from an HTTP(S) URL.
+func loadManifest(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		path, err := expandHome(source)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error when reading manifest %s: %v", source, err)
+		}
+		return data, nil
+	}
+	resp, err := httpGet(source)
+	if err != nil {
+		return nil, fmt.Errorf("error when downloading manifest %s: %v", source, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error when downloading manifest %s: %s", source, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error when downloading manifest %s: %v", source, err)
+	}
+	return data, nil
+}
+
+// parseManifest decodes the objects of a multi-document YAML manifest. Empty
+// documents are skipped.
+func parseManifest(data []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		object := map[string]interface{}{}
+		if err := decoder.Decode(&object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("error when decoding manifest: %v", err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{Object: object}
+		if u.GetKind() == "" || u.GetName() == "" {
+			return nil, fmt.Errorf("error when decoding manifest: object without kind or name")
+		}
+		objects = append(objects, u)
+	}
+	return objects, nil
+}
+
+// manifestOverride sets a field of the objects of a kind and a name, given as
+// <kind>/<name>:<field path>=<value>, e.g.
+// Deployment/grafana:spec.replicas=2. The indices of list items are given as
+// numbers in the field path, and the value is parsed as YAML.
+type manifestOverride struct {
+	kind  string
+	name  string
+	path  []string
+	value interface{}
+}
+
+func parseOverride(override string) (manifestOverride, error) {
+	var result manifestOverride
+	target, assignment, found := strings.Cut(override, ":")
+	if !found {
+		return result, fmt.Errorf("invalid override %q, it should be <kind>/<name>:<field path>=<value>", override)
+	}
+	path, value, found := strings.Cut(assignment, "=")
+	kind, name, kindFound := strings.Cut(target, "/")
+	if !found || !kindFound || kind == "" || name == "" || path == "" {
+		return result, fmt.Errorf("invalid override %q, it should be <kind>/<name>:<field path>=<value>", override)
+	}
+	if err := yaml.Unmarshal([]byte(value), &result.value); err != nil {
+		return result, fmt.Errorf("invalid value of override %q: %v", override, err)
+	}
+	result.kind, result.name, result.path = kind, name, strings.Split(path, ".")
+	return result, nil
+}
+
+// applyOverrides sets the fields of the objects given by the overrides. An
+// override which matches no object is an error, as it is likely a typo.
+func applyOverrides(objects []*unstructured.Unstructured, overrides []manifestOverride) error {
+	for _, override := range overrides {
+		matched := false
+		for _, object := range objects {
+			if !strings.EqualFold(object.GetKind(), override.kind) || object.GetName() != override.name {
+				continue
+			}
+			matched = true
+			if err := setField(object.Object, override.path, override.value); err != nil {
+				return fmt.Errorf("error when overriding %s of %s/%s: %v", strings.Join(override.path, "."), override.kind, override.name, err)
+			}
+		}
+		if !matched {
+			return fmt.Errorf("no object %s/%s in the manifests", override.kind, override.name)
+		}
+	}
+	return nil
+}
+
+// setField sets the field at path in an object, creating the missing maps.
+// List items are addressed by their index, and must exist.
+func setField(object interface{}, path []string, value interface{}) error {
+	key := path[0]
+	switch current := object.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			current[key] = value
+			return nil
+		}
+		child, ok := current[key]
+		if !ok || child == nil {
+			child = map[string]interface{}{}
+			current[key] = child
+		}
+		return setField(child, path[1:], value)
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(current) {
+			return fmt.Errorf("invalid index %s of a list of %d items", key, len(current))
+		}
+		if len(path) == 1 {
+			current[index] = value
+			return nil
+		}
+		return setField(current[index], path[1:], value)
+	default:
+		return fmt.Errorf("field %s is not in a map or a list", key)
+	}
+}
+
+// sortForApply orders the objects so that Namespaces and CRDs are applied
+// before the objects which depend on them, keeping the order of the manifests
+// otherwise.
+func sortForApply(objects []*unstructured.Unstructured) {
+	priority := func(object *unstructured.Unstructured) int {
+		switch object.GroupVersionKind().GroupKind() {
+		case schema.GroupKind{Kind: "Namespace"}:
+			return 0
+		case schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return priority(objects[i]) < priority(objects[j])
+	})
+}
+
+// customKinds returns the kinds of the custom resources defined by the CRDs
+// among the objects.
+func customKinds(objects []*unstructured.Unstructured) map[schema.GroupKind]bool {
+	kinds := make(map[schema.GroupKind]bool)
+	for _, object := range objects {
+		if object.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(object.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(object.Object, "spec", "names", "kind")
+		kinds[schema.GroupKind{Group: group, Kind: kind}] = true
+	}
+	return kinds
+}
+
+// objectRef returns the kind and the name of an object, e.g. Deployment/grafana.
+func objectRef(object *unstructured.Unstructured) string {
+	return object.GetKind() + "/" + object.GetName()
+}
+
+// manifestClient applies and deletes the objects of manifests.
+type manifestClient struct {
+	client dynamic.Interface
+	mapper meta.ResettableRESTMapper
+}
+
+// resourceFor returns the client of the resource of an object. The mapper is
+// reset if it does not know the resource, which may be defined by a CRD
+// applied after it cached the discovery, and then, if waitForResource is
+// true, the API server is polled until it serves the resource.
+func (c *manifestClient) resourceFor(object *unstructured.Unstructured, waitForResource bool) (dynamic.ResourceInterface, error) {
+	gvk := object.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) && waitForResource {
+			err = wait.PollImmediate(resourcePollInterval, resourcePollTimeout, func() (bool, error) {
+				c.mapper.Reset()
+				mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+				if meta.IsNoMatchError(err) {
+					return false, nil
+				}
+				return err == nil, err
+			})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error when getting the resource of %s: %w", gvk.Kind, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.client.Resource(mapping.Resource), nil
+	}
+	namespace := object.GetNamespace()
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return c.client.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// apply creates or updates an object with server-side apply.
+func (c *manifestClient) apply(object *unstructured.Unstructured) error {
+	resource, err := c.resourceFor(object, true)
+	if err != nil {
+		return err
+	}
+	data, err := object.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	force := true
+	_, err = resource.Patch(context.TODO(), object.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
+	return err
+}
+
+// delete deletes an object. It returns false if the object or its resource
+// does not exist.
+func (c *manifestClient) delete(object *unstructured.Unstructured) (bool, error) {
+	resource, err := c.resourceFor(object, false)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = resource.Delete(context.TODO(), object.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// waitForDeletion waits until an object does not exist anymore, e.g. after
+// its finalizers are removed by its controller.
+func (c *manifestClient) waitForDeletion(object *unstructured.Unstructured, timeout time.Duration) error {
+	resource, err := c.resourceFor(object, false)
+	if meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return wait.PollImmediate(resourcePollInterval, timeout, func() (bool, error) {
+		_, err := resource.Get(context.TODO(), object.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
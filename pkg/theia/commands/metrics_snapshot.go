@@ -0,0 +1,322 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+const (
+	clickHouseMonitorContainer   = "clickhouse-monitor"
+	clickHouseMonitorMetricsPort = "monitor-metrics"
+	// Metrics of the Theia components are all prefixed with theia_.
+	theiaMetricPrefix = "theia_"
+)
+
+// Metrics of the processes which are part of the snapshot, besides the
+// metrics of the Theia components, unless all the metrics are requested.
+var processMetricNames = map[string]bool{
+	"process_resident_memory_bytes": true,
+	"process_cpu_seconds_total":     true,
+	"process_open_fds":              true,
+	"go_goroutines":                 true,
+}
+
+// Function to get the current time, for unit tests
+var snapshotTime = time.Now
+
+// metricsSnapshotCmd represents the metrics snapshot command
+var metricsSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Capture a point-in-time snapshot of the metrics of Theia",
+	Long: `Scrape the Prometheus metrics of the Theia Manager and of the ClickHouse
+monitors, along with the key metrics of every ClickHouse shard, and print them
+or write them as JSON. Only the metrics of the Theia components and of their
+processes are captured, unless --all is set. The ClickHouse monitors are only
+scraped if clickhouse.monitor.metrics.enable is set in the Helm values. A source
+which cannot be scraped is reported in the snapshot, without failing the
+command, so that the snapshot can be captured during incidents.`,
+	Args: cobra.NoArgs,
+	Example: `
+Print a snapshot of the metrics of Theia
+$ theia metrics snapshot
+Write a snapshot of all the metrics of Theia as JSON
+$ theia metrics snapshot --all --output-file snapshot.json
+`,
+	RunE: metricsSnapshot,
+}
+
+func init() {
+	metricsCmd.AddCommand(metricsSnapshotCmd)
+	metricsSnapshotCmd.Flags().Bool(
+		"all",
+		false,
+		"Capture all the metrics of the components instead of the key ones.",
+	)
+	metricsSnapshotCmd.Flags().StringP(
+		"output-file",
+		"f",
+		"",
+		"The file path where the snapshot is written as JSON.",
+	)
+}
+
+type metricsSnapshotResult struct {
+	Time    string          `json:"time"`
+	Sources []metricsSource `json:"sources"`
+}
+
+// metricsSource holds the metrics scraped from a component, or the error
+// which prevented it.
+type metricsSource struct {
+	Name    string         `json:"name"`
+	Error   string         `json:"error,omitempty"`
+	Metrics []metricSample `json:"metrics,omitempty"`
+}
+
+type metricSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+func metricsSnapshot(cmd *cobra.Command, args []string) error {
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+	filePath, err := getPathFlag(cmd, "output-file")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+	}
+	k8sClient, err := CreateK8sClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+	}
+	snapshot := &metricsSnapshotResult{Time: snapshotTime().UTC().Format(time.RFC3339)}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		err = fmt.Errorf("couldn't setup Theia manager client, %v", err)
+		snapshot.Sources = append(snapshot.Sources,
+			metricsSource{Name: "theia-manager", Error: err.Error()},
+			metricsSource{Name: "clickhouse", Error: err.Error()})
+	} else {
+		if pf != nil {
+			defer pf.Stop()
+		}
+		snapshot.Sources = append(snapshot.Sources, scrapeTheiaManager(theiaClient, all), getClickHouseSystemMetrics(theiaClient))
+	}
+	snapshot.Sources = append(snapshot.Sources, scrapeClickHouseMonitors(k8sClient, all)...)
+
+	if filePath != "" {
+		data, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error when encoding the metrics snapshot: %v", err)
+		}
+		if err := os.WriteFile(filePath, data, 0600); err != nil {
+			return fmt.Errorf("error when writing the metrics snapshot to %s: %v", filePath, err)
+		}
+		fmt.Printf("Metrics snapshot written to %s\n", filePath)
+		return nil
+	}
+	printMetricsSnapshot(snapshot)
+	return nil
+}
+
+func scrapeTheiaManager(theiaClient restclient.Interface, all bool) metricsSource {
+	source := metricsSource{Name: "theia-manager"}
+	data, err := theiaClient.Get().
+		AbsPath("/metrics").
+		SetHeader("Accept", string(expfmt.FmtText)).
+		DoRaw(context.TODO())
+	if err != nil {
+		source.Error = fmt.Sprintf("failed to scrape the metrics of the Theia Manager: %v", err)
+		return source
+	}
+	source.Metrics, err = parseMetrics(data, all)
+	if err != nil {
+		source.Error = err.Error()
+	}
+	return source
+}
+
+func getClickHouseSystemMetrics(theiaClient restclient.Interface) metricsSource {
+	source := metricsSource{Name: "clickhouse"}
+	data, err := getClickHouseStatusByCategory(theiaClient, "systemMetrics")
+	if err != nil {
+		source.Error = err.Error()
+		return source
+	}
+	if len(data.ErrorMsg) != 0 {
+		source.Error = strings.Join(data.ErrorMsg, "; ")
+	}
+	for _, metric := range data.SystemMetrics {
+		value, err := strconv.ParseFloat(metric.Value, 64)
+		if err != nil {
+			continue
+		}
+		source.Metrics = append(source.Metrics, metricSample{
+			Name:   metric.Metric,
+			Labels: map[string]string{"shard": metric.Shard},
+			Value:  value,
+		})
+	}
+	return source
+}
+
+// scrapeClickHouseMonitors scrapes the ClickHouse monitors serving their
+// metrics through the proxy of the Kubernetes API server, as they are not
+// exposed by a Service.
+func scrapeClickHouseMonitors(k8sClient kubernetes.Interface, all bool) []metricsSource {
+	pods, err := k8sClient.CoreV1().Pods(theiaNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "app=clickhouse"})
+	if err != nil {
+		return []metricsSource{{Name: clickHouseMonitorContainer, Error: fmt.Sprintf("failed to list the ClickHouse Pods: %v", err)}}
+	}
+	var sources []metricsSource
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		port := getMonitorMetricsPort(pod)
+		if port == 0 {
+			continue
+		}
+		source := metricsSource{Name: fmt.Sprintf("%s/%s", clickHouseMonitorContainer, pod.Name)}
+		data, err := k8sClient.CoreV1().Pods(pod.Namespace).ProxyGet("http", pod.Name, strconv.Itoa(int(port)), "/metrics", nil).DoRaw(context.TODO())
+		if err != nil {
+			source.Error = fmt.Sprintf("failed to scrape the metrics of the ClickHouse monitor: %v", err)
+		} else if source.Metrics, err = parseMetrics(data, all); err != nil {
+			source.Error = err.Error()
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return []metricsSource{{Name: clickHouseMonitorContainer, Error: "no ClickHouse monitor serves its metrics, set clickhouse.monitor.metrics.enable to serve them"}}
+	}
+	return sources
+}
+
+func getMonitorMetricsPort(pod *corev1.Pod) int32 {
+	for _, container := range pod.Spec.Containers {
+		if container.Name != clickHouseMonitorContainer {
+			continue
+		}
+		for _, port := range container.Ports {
+			if port.Name == clickHouseMonitorMetricsPort {
+				return port.ContainerPort
+			}
+		}
+	}
+	return 0
+}
+
+// parseMetrics parses metrics in the Prometheus text format. Summaries and
+// histograms are reduced to their sum and count.
+func parseMetrics(data []byte, all bool) ([]metricSample, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the metrics: %v", err)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		if all || strings.HasPrefix(name, theiaMetricPrefix) || processMetricNames[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var samples []metricSample
+	for _, name := range names {
+		family := families[name]
+		for _, metric := range family.GetMetric() {
+			var labels map[string]string
+			if len(metric.GetLabel()) > 0 {
+				labels = make(map[string]string, len(metric.GetLabel()))
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				samples = append(samples, metricSample{Name: name, Labels: labels, Value: metric.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				samples = append(samples, metricSample{Name: name, Labels: labels, Value: metric.GetGauge().GetValue()})
+			case dto.MetricType_SUMMARY:
+				samples = append(samples,
+					metricSample{Name: name + "_sum", Labels: labels, Value: metric.GetSummary().GetSampleSum()},
+					metricSample{Name: name + "_count", Labels: labels, Value: float64(metric.GetSummary().GetSampleCount())})
+			case dto.MetricType_HISTOGRAM:
+				samples = append(samples,
+					metricSample{Name: name + "_sum", Labels: labels, Value: metric.GetHistogram().GetSampleSum()},
+					metricSample{Name: name + "_count", Labels: labels, Value: float64(metric.GetHistogram().GetSampleCount())})
+			default:
+				samples = append(samples, metricSample{Name: name, Labels: labels, Value: metric.GetUntyped().GetValue()})
+			}
+		}
+	}
+	return samples, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func printMetricsSnapshot(snapshot *metricsSnapshotResult) {
+	fmt.Printf("Metrics snapshot taken at %s\n", snapshot.Time)
+	for _, source := range snapshot.Sources {
+		fmt.Printf("\n%s:\n", source.Name)
+		if source.Error != "" {
+			fmt.Printf("Error message: %s\n", source.Error)
+		}
+		if len(source.Metrics) == 0 {
+			continue
+		}
+		result := [][]string{{"Metric", "Labels", "Value"}}
+		for _, sample := range source.Metrics {
+			result = append(result, []string{sample.Name, formatLabels(sample.Labels), strconv.FormatFloat(sample.Value, 'f', -1, 64)})
+		}
+		TableOutput(result)
+	}
+}
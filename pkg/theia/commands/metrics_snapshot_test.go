@@ -0,0 +1,247 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/commands/config"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+const (
+	managerMetrics = `# HELP apiserver_request_total Counter of apiserver requests.
+# TYPE apiserver_request_total counter
+apiserver_request_total{code="200",verb="GET"} 42
+# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 87
+# HELP theia_manager_request_duration_seconds Duration of the requests.
+# TYPE theia_manager_request_duration_seconds histogram
+theia_manager_request_duration_seconds_bucket{le="1"} 3
+theia_manager_request_duration_seconds_bucket{le="+Inf"} 4
+theia_manager_request_duration_seconds_sum 2.5
+theia_manager_request_duration_seconds_count 4
+`
+	monitorMetrics = `# HELP theia_clickhouse_monitor_round_panics_total Number of rounds of monitoring which panicked.
+# TYPE theia_clickhouse_monitor_round_panics_total counter
+theia_clickhouse_monitor_round_panics_total 1
+`
+)
+
+// fakeResponseWrapper returns the given data as the response of a request
+// proxied to a Pod.
+type fakeResponseWrapper struct {
+	data []byte
+	err  error
+}
+
+func (f *fakeResponseWrapper) DoRaw(context.Context) ([]byte, error) {
+	return f.data, f.err
+}
+
+func (f *fakeResponseWrapper) Stream(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(f.data))), f.err
+}
+
+func newTestClickHousePod(name string, metricsPort int32) *corev1.Pod {
+	container := corev1.Container{Name: clickHouseMonitorContainer}
+	if metricsPort != 0 {
+		container.Ports = []corev1.ContainerPort{{Name: clickHouseMonitorMetricsPort, ContainerPort: metricsPort}}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.FlowVisibilityNS,
+			Labels:    map[string]string{"app": "clickhouse"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "clickhouse"}, container},
+		},
+	}
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	snapshotTime = func() time.Time { return time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC) }
+	defer func() { snapshotTime = time.Now }()
+	testServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/metrics":
+				w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(managerMetrics))
+			case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/systemMetrics":
+				status := &stats.ClickHouseStats{
+					SystemMetrics: []stats.SystemMetric{{Shard: "1", Metric: "Query", Value: "3"}},
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(status)
+			}
+		}))
+	}
+	testCases := []struct {
+		name           string
+		testServer     *httptest.Server
+		pods           []*corev1.Pod
+		all            bool
+		outputFile     bool
+		expectedMsg    []string
+		notExpectedMsg []string
+	}{
+		{
+			name:       "Key metrics",
+			testServer: testServer(),
+			pods:       []*corev1.Pod{newTestClickHousePod("chi-clickhouse-0-0-0", 9091)},
+			expectedMsg: []string{
+				"Metrics snapshot taken at 2023-05-01T10:00:00Z",
+				"theia-manager:", "go_goroutines", "87",
+				"theia_manager_request_duration_seconds_sum", "2.5", "theia_manager_request_duration_seconds_count",
+				"clickhouse:", "Query", "shard=1",
+				"clickhouse-monitor/chi-clickhouse-0-0-0:", "theia_clickhouse_monitor_round_panics_total",
+			},
+			notExpectedMsg: []string{"apiserver_request_total"},
+		},
+		{
+			name:        "All metrics",
+			testServer:  testServer(),
+			pods:        []*corev1.Pod{newTestClickHousePod("chi-clickhouse-0-0-0", 9091)},
+			all:         true,
+			expectedMsg: []string{"apiserver_request_total", "code=200,verb=GET", "42"},
+		},
+		{
+			name:        "Monitor metrics not enabled",
+			testServer:  testServer(),
+			pods:        []*corev1.Pod{newTestClickHousePod("chi-clickhouse-0-0-0", 0)},
+			expectedMsg: []string{"theia-manager:", "go_goroutines", "clickhouse-monitor:", "set clickhouse.monitor.metrics.enable to serve them"},
+		},
+		{
+			name: "Failed to scrape the Theia Manager",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			})),
+			pods:        []*corev1.Pod{newTestClickHousePod("chi-clickhouse-0-0-0", 9091)},
+			expectedMsg: []string{"failed to scrape the metrics of the Theia Manager", "theia_clickhouse_monitor_round_panics_total"},
+		},
+		{
+			name:        TheiaClientSetupDeniedTestCase,
+			testServer:  httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			pods:        []*corev1.Pod{newTestClickHousePod("chi-clickhouse-0-0-0", 9091)},
+			expectedMsg: []string{TheiaClientSetupDeniedErr, "theia_clickhouse_monitor_round_panics_total"},
+		},
+		{
+			name:        "Write JSON",
+			testServer:  testServer(),
+			pods:        []*corev1.Pod{newTestClickHousePod("chi-clickhouse-0-0-0", 9091)},
+			outputFile:  true,
+			expectedMsg: []string{"Metrics snapshot written to"},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldSetupFunc := SetupTheiaClientAndConnection
+			oldCreateFunc := CreateK8sClient
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				var objects []runtime.Object
+				for _, pod := range tt.pods {
+					objects = append(objects, pod)
+				}
+				client := fake.NewSimpleClientset(objects...)
+				client.PrependProxyReactor("pods", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+					proxyAction := action.(k8stesting.ProxyGetAction)
+					if proxyAction.GetPort() != "9091" || proxyAction.GetPath() != "/metrics" {
+						return true, &fakeResponseWrapper{err: errors.New("connection refused")}, nil
+					}
+					return true, &fakeResponseWrapper{data: []byte(monitorMetrics)}, nil
+				})
+				return client, nil
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldSetupFunc
+				CreateK8sClient = oldCreateFunc
+			}()
+			var filePath string
+			if tt.outputFile {
+				filePath = filepath.Join(t.TempDir(), "snapshot.json")
+			}
+			cmd := new(cobra.Command)
+			cmd.Flags().Bool("all", tt.all, "")
+			cmd.Flags().String("output-file", filePath, "")
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := metricsSnapshot(cmd, []string{})
+			assert.NoError(t, err)
+			outcome := readStdout(t, r, w)
+			for _, msg := range tt.expectedMsg {
+				assert.Contains(t, outcome, msg)
+			}
+			for _, msg := range tt.notExpectedMsg {
+				assert.NotContains(t, outcome, msg)
+			}
+			if tt.outputFile {
+				data, err := os.ReadFile(filePath)
+				require.NoError(t, err)
+				var snapshot metricsSnapshotResult
+				require.NoError(t, json.Unmarshal(data, &snapshot))
+				assert.Equal(t, "2023-05-01T10:00:00Z", snapshot.Time)
+				require.Len(t, snapshot.Sources, 3)
+				assert.Equal(t, "theia-manager", snapshot.Sources[0].Name)
+				assert.Contains(t, snapshot.Sources[0].Metrics, metricSample{Name: "go_goroutines", Value: 87})
+				assert.Equal(t, []metricSample{{Name: "Query", Labels: map[string]string{"shard": "1"}, Value: 3}}, snapshot.Sources[1].Metrics)
+				assert.Equal(t, []metricSample{{Name: "theia_clickhouse_monitor_round_panics_total", Value: 1}}, snapshot.Sources[2].Metrics)
+			}
+		})
+	}
+}
@@ -26,18 +26,21 @@ var policyRecommendationCmd = &cobra.Command{
 	Aliases: []string{"pr"},
 	Short:   "Commands of Theia policy recommendation feature",
 	Long: `Command group of Theia policy recommendation feature.
-Must specify a subcommand like run, status or retrieve.`,
+Must specify a subcommand like run, status, logs or retrieve.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Error: must also specify a subcommand like run, status or retrieve")
+		fmt.Println("Error: must also specify a subcommand like run, status, logs or retrieve")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(policyRecommendationCmd)
-	policyRecommendationCmd.PersistentFlags().Bool(
-		"use-cluster-ip",
-		false,
-		`Enable this option will use ClusterIP instead of port forwarding when connecting to the Theia
-Manager Service. It can only be used when running in cluster.`,
-	)
+	addUseClusterIPFlag(policyRecommendationCmd)
+	policyRecommendationCmd.AddCommand(newJobLogsCommand(policyRecommendationJobs, `
+Print the logs of the policy recommendation job with name pr-e998433e-accb-4888-9fc8-06563f073e86
+$ theia policy-recommendation logs pr-e998433e-accb-4888-9fc8-06563f073e86
+Print the last 100 lines of the logs and stream the new lines
+$ theia policy-recommendation logs pr-e998433e-accb-4888-9fc8-06563f073e86 --tail 100 -f
+Print the logs of the most recently created policy recommendation job
+$ theia policy-recommendation logs latest
+`))
 }
@@ -15,62 +15,28 @@
 package commands
 
 import (
-	"context"
-	"fmt"
-
 	"github.com/spf13/cobra"
-
-	"antrea.io/theia/pkg/util"
 )
 
 // policyRecommendationDeleteCmd represents the policy-recommendation delete command
 var policyRecommendationDeleteCmd = &cobra.Command{
-	Use:     "delete",
-	Short:   "Delete a policy recommendation job",
-	Long:    `Delete a policy recommendation job by Name.`,
+	Use:   "delete",
+	Short: "Delete policy recommendation jobs",
+	Long: `Delete a policy recommendation job by Name, or all the policy recommendation
+jobs matching tags or a label selector when no Name is given.`,
 	Aliases: []string{"del"},
 	Args:    cobra.RangeArgs(0, 1),
 	Example: `
 Delete the network policy recommendation job with Name pr-e998433e-accb-4888-9fc8-06563f073e86
 $ theia policy-recommendation delete pr-e998433e-accb-4888-9fc8-06563f073e86
+Delete all the network policy recommendation jobs with tag env=staging
+$ theia policy-recommendation delete --tags env=staging
 `,
 	RunE: policyRecommendationDelete,
 }
 
 func policyRecommendationDelete(cmd *cobra.Command, args []string) error {
-	prName, err := cmd.Flags().GetString("name")
-	if err != nil {
-		return err
-	}
-	if prName == "" && len(args) == 1 {
-		prName = args[0]
-	}
-	err = util.ParseRecommendationName(prName)
-	if err != nil {
-		return err
-	}
-	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
-	if err != nil {
-		return err
-	}
-	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
-	if err != nil {
-		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
-	}
-	if pf != nil {
-		defer pf.Stop()
-	}
-	err = theiaClient.Delete().
-		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
-		Resource("networkpolicyrecommendations").
-		Name(prName).
-		Do(context.TODO()).
-		Error()
-	if err != nil {
-		return fmt.Errorf("error when deleting policy recommendation job: %v", err)
-	}
-	fmt.Printf("Successfully deleted policy recommendation job with name: %s\n", prName)
-	return nil
+	return policyRecommendationJobs.runDelete(cmd, args)
 }
 
 func init() {
@@ -81,4 +47,17 @@ func init() {
 		"",
 		"Name of the policy recommendation job.",
 	)
+	policyRecommendationDeleteCmd.Flags().StringP(
+		"selector",
+		"l",
+		"",
+		"Label selector of the jobs to delete when no Name is given, e.g. -l 'env=staging'.",
+	)
+	policyRecommendationDeleteCmd.Flags().StringToString(
+		"tags",
+		nil,
+		"Tags of the jobs to delete when no Name is given. Example: --tags env=staging",
+	)
+	policyRecommendationDeleteCmd.RegisterFlagCompletionFunc("name", completeJobNames(policyRecommendationResource))
+	policyRecommendationDeleteCmd.ValidArgsFunction = completeJobNameArg(policyRecommendationResource)
 }
@@ -15,6 +15,7 @@
 package commands
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -24,9 +25,11 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 	"antrea.io/theia/pkg/theia/portforwarder"
 )
 
@@ -66,6 +69,46 @@ func TestPolicyRecommendationDelete(t *testing.T) {
 			})),
 			expectedErrorMsg: "",
 		},
+		{
+			name: "Valid case with tags",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations":
+					if r.URL.Query().Get("labelSelector") != "env=staging" {
+						http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+						return
+					}
+					nprList := &intelligence.NetworkPolicyRecommendationList{
+						Items: []intelligence.NetworkPolicyRecommendation{
+							{ObjectMeta: metav1.ObjectMeta{Name: nprName}},
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(nprList)
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+					if r.Method == "DELETE" {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+					} else {
+						http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+					}
+				}
+			})),
+			expectedErrorMsg: "",
+		},
+		{
+			name: "No job matching tags",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations":
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(&intelligence.NetworkPolicyRecommendationList{})
+				}
+			})),
+			expectedErrorMsg: "no policy recommendation job matches selector env=staging",
+		},
 		{
 			name: "SparkApplication not found",
 			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +170,11 @@ func TestPolicyRecommendationDelete(t *testing.T) {
 				cmd.Flags().Bool("use-cluster-ip", true, "")
 			case "Invalid prName":
 				cmd.Flags().String("name", "mock_nprName", "")
+			case "Valid case with tags", "No job matching tags":
+				cmd.Flags().String("name", "", "")
+				cmd.Flags().Bool("use-cluster-ip", true, "")
+				cmd.Flags().String("selector", "", "")
+				cmd.Flags().StringToString("tags", map[string]string{"env": "staging"}, "")
 			default:
 				cmd.Flags().String("name", nprName, "")
 				cmd.Flags().Bool("use-cluster-ip", true, "")
@@ -0,0 +1,311 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	restclient "k8s.io/client-go/rest"
+
+	"antrea.io/theia/pkg/util"
+)
+
+// yamlSeparatorRegex matches the yaml document separators of a
+// recommendation result.
+var yamlSeparatorRegex = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// policyRecommendationExportCmd represents the policy-recommendation export command
+var policyRecommendationExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the recommendation result of a policy recommendation job to a Git repository",
+	Long: `Export the recommended NetworkPolicies of a policy recommendation job to a
+Git repository, so that they can be deployed by GitOps tools like Argo CD or Flux.
+The repository given by --git-repo is cloned, every recommended policy is written
+to its own file named after its kind, Namespace and name in the directory given
+by --path, and the change is committed and pushed to the branch given by
+--git-branch, which is created if it does not exist. The yaml files previously
+present in the directory are removed, so that the directory only holds the
+policies of the last exported job.
+The git command must be installed, and configured with the credentials and the
+identity used to push to the repository.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Export the recommendation result with job name pr-e998433e-accb-4888-9fc8-06563f073e86 to the network-policies directory of branch main
+$ theia policy-recommendation export pr-e998433e-accb-4888-9fc8-06563f073e86 --git-repo git@github.com:example/gitops.git --path network-policies
+Export the recommendation result to a new branch, to be merged through a pull request
+$ theia policy-recommendation export pr-e998433e-accb-4888-9fc8-06563f073e86 --git-repo git@github.com:example/gitops.git --git-branch theia-recommendation
+`,
+	RunE: policyRecommendationExport,
+}
+
+func init() {
+	policyRecommendationCmd.AddCommand(policyRecommendationExportCmd)
+	policyRecommendationExportCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the policy recommendation job.",
+	)
+	policyRecommendationExportCmd.RegisterFlagCompletionFunc("name", completeJobNames(policyRecommendationResource))
+	policyRecommendationExportCmd.ValidArgsFunction = completeJobNameArg(policyRecommendationResource)
+	policyRecommendationExportCmd.Flags().String(
+		"git-repo",
+		"",
+		"URL of the Git repository to export the recommended policies to.",
+	)
+	policyRecommendationExportCmd.MarkFlagRequired("git-repo")
+	policyRecommendationExportCmd.Flags().String(
+		"git-branch",
+		"main",
+		"Branch of the Git repository to commit the recommended policies to.",
+	)
+	policyRecommendationExportCmd.Flags().String(
+		"path",
+		"",
+		"Directory of the Git repository to write the recommended policies to. Defaults to a directory named after the job.",
+	)
+	policyRecommendationExportCmd.Flags().String(
+		"commit-message",
+		"",
+		"Message of the commit of the recommended policies.",
+	)
+	policyRecommendationExportCmd.Flags().Int64(
+		"page-size",
+		defaultRecommendationPageSize,
+		"The number of recommended policies retrieved per request. Set to 0 to retrieve all of them in a single request.",
+	)
+}
+
+// gitExportOptions selects where the recommended policies are exported to.
+type gitExportOptions struct {
+	repo          string
+	branch        string
+	path          string
+	commitMessage string
+}
+
+func policyRecommendationExport(cmd *cobra.Command, args []string) error {
+	prName, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	if prName == "" && len(args) == 1 {
+		prName = args[0]
+	}
+	err = util.ParseRecommendationName(prName)
+	if err != nil {
+		return err
+	}
+	var options gitExportOptions
+	if options.repo, err = cmd.Flags().GetString("git-repo"); err != nil {
+		return err
+	}
+	if options.repo == "" {
+		return fmt.Errorf("git-repo should not be empty")
+	}
+	if options.branch, err = cmd.Flags().GetString("git-branch"); err != nil {
+		return err
+	}
+	if options.branch == "" {
+		return fmt.Errorf("git-branch should not be empty")
+	}
+	if options.path, err = cmd.Flags().GetString("path"); err != nil {
+		return err
+	}
+	if options.path == "" {
+		options.path = prName
+	}
+	if !filepath.IsLocal(options.path) {
+		return fmt.Errorf("path %q should be a relative path inside the Git repository", options.path)
+	}
+	if options.commitMessage, err = cmd.Flags().GetString("commit-message"); err != nil {
+		return err
+	}
+	if options.commitMessage == "" {
+		options.commitMessage = fmt.Sprintf("Update NetworkPolicies recommended by Theia job %s", prName)
+	}
+	pageSize, err := cmd.Flags().GetInt64("page-size")
+	if err != nil {
+		return err
+	}
+	if pageSize < 0 {
+		return fmt.Errorf("page-size should not be negative")
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	return exportPolicyRecommendationResult(theiaClient, prName, pageSize, options)
+}
+
+func exportPolicyRecommendationResult(theiaClient restclient.Interface, prName string, pageSize int64, options gitExportOptions) error {
+	var result bytes.Buffer
+	if err := streamPolicyRecommendationResult(theiaClient, prName, pageSize, nil, &result); err != nil {
+		return err
+	}
+	files, err := splitRecommendedPolicies(result.String())
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("policy recommendation job %s has no recommended policies, check that it has completed", prName)
+	}
+
+	repoDir, err := os.MkdirTemp("", "theia-export-")
+	if err != nil {
+		return fmt.Errorf("error when creating a directory to clone the Git repository: %v", err)
+	}
+	defer os.RemoveAll(repoDir)
+	if err := runGit("", "clone", "--quiet", "--depth", "1", options.repo, repoDir); err != nil {
+		return err
+	}
+	exists, err := gitBranchExists(repoDir, options.branch)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := runGit(repoDir, "fetch", "--quiet", "--depth", "1", "origin", options.branch); err != nil {
+			return err
+		}
+		if err := runGit(repoDir, "checkout", "--quiet", "-B", options.branch, "FETCH_HEAD"); err != nil {
+			return err
+		}
+	} else if err := runGit(repoDir, "checkout", "--quiet", "-B", options.branch); err != nil {
+		return err
+	}
+
+	if err := writeRecommendedPolicies(filepath.Join(repoDir, options.path), files); err != nil {
+		return err
+	}
+	if err := runGit(repoDir, "add", "--all", "--", filepath.ToSlash(options.path)); err != nil {
+		return err
+	}
+	if err := runGit(repoDir, "diff", "--cached", "--quiet"); err == nil {
+		fmt.Printf("The recommended policies of job %s are already up to date in branch %s of %s\n", prName, options.branch, options.repo)
+		return nil
+	}
+	if err := runGit(repoDir, "commit", "--quiet", "-m", options.commitMessage); err != nil {
+		return err
+	}
+	if err := runGit(repoDir, "push", "--quiet", "origin", "HEAD:refs/heads/"+options.branch); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d recommended policies of job %s to %s in branch %s of %s\n", len(files), prName, options.path, options.branch, options.repo)
+	return nil
+}
+
+// splitRecommendedPolicies splits a recommendation result into one yaml
+// document per policy, indexed by a file name made of the kind, the Namespace
+// and the name of the policy, which is stable across exports.
+func splitRecommendedPolicies(result string) (map[string]string, error) {
+	return splitRecommendedPoliciesWithSeparator(result, "-")
+}
+
+// splitRecommendedPoliciesWithSeparator is like splitRecommendedPolicies, with
+// the kind, the Namespace and the name of the policy joined by separator in
+// the file names.
+func splitRecommendedPoliciesWithSeparator(result, separator string) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, document := range yamlSeparatorRegex.Split(result, -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+		var policy struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(document), &policy); err != nil {
+			return nil, fmt.Errorf("error when parsing recommended policy: %v", err)
+		}
+		if policy.Kind == "" || policy.Metadata.Name == "" {
+			return nil, fmt.Errorf("recommended policy has no kind or name: %q", document)
+		}
+		fileName := strings.ToLower(policy.Kind)
+		if policy.Metadata.Namespace != "" {
+			fileName += separator + policy.Metadata.Namespace
+		}
+		fileName += separator + policy.Metadata.Name + ".yaml"
+		if _, ok := files[fileName]; ok {
+			return nil, fmt.Errorf("duplicate recommended policy %s", fileName)
+		}
+		files[fileName] = strings.TrimLeft(document, "\n")
+	}
+	return files, nil
+}
+
+// writeRecommendedPolicies replaces the yaml files of dir with the given
+// policy files.
+func writeRecommendedPolicies(dir string, files map[string]string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error when creating directory %s: %v", dir, err)
+	}
+	previousFiles, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, file := range previousFiles {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("error when removing previous policy file: %v", err)
+		}
+	}
+	for fileName, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, fileName), []byte(content), 0644); err != nil {
+			return fmt.Errorf("error when writing policy file: %v", err)
+		}
+	}
+	return nil
+}
+
+// gitBranchExists checks whether the branch exists in the origin repository.
+func gitBranchExists(repoDir, branch string) (bool, error) {
+	err := runGit(repoDir, "ls-remote", "--exit-code", "--heads", "origin", "refs/heads/"+branch)
+	var exitErr *exec.ExitError
+	// git ls-remote exits with code 2 when no matching ref is found.
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// runGit runs a git command in dir, or in the current directory if dir is
+// empty. The returned error wraps the error of the command, so that its exit
+// code can be checked.
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error when running git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
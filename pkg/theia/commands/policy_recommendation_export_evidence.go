@@ -0,0 +1,485 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	restclient "k8s.io/client-go/rest"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util"
+	"antrea.io/theia/pkg/version"
+)
+
+const (
+	// evidenceArchiveVersion is the version of the layout of the evidence
+	// archives, which is checked by the inspect command.
+	evidenceArchiveVersion = 1
+	evidenceManifestFile   = "MANIFEST.json"
+	evidenceSignatureFile  = "MANIFEST.json.sig"
+	evidenceMetadataFile   = "metadata.json"
+	evidenceCoverageFile   = "coverage.csv"
+	evidenceFlowsFile      = "flows.csv"
+	evidencePoliciesDir    = "policies"
+)
+
+// policyRecommendationExportEvidenceCmd represents the policy-recommendation export-evidence command
+var policyRecommendationExportEvidenceCmd = &cobra.Command{
+	Use:   "export-evidence",
+	Short: "Export the evidence of a policy recommendation job to a signed archive",
+	Long: `Export the recommended policies of a completed policy recommendation job,
+together with the evidence they were recommended from, to a single signed
+archive which can be attached to a security review or a change request.
+The archive is a gzipped tarball holding:
+  metadata.json   the job, with its parameters, coverage and data window
+  coverage.csv    the number of flows matched by the policies, by Namespace
+  policies/       one yaml file per recommended policy
+  flows.csv       the flow records which ended in the time range of the job
+  MANIFEST.json   the size and SHA-256 digest of every other file
+  MANIFEST.json.sig
+                  the Ed25519 signature of MANIFEST.json, in base64
+The signing key given by --signing-key is an Ed25519 private key in PKCS #8
+PEM format, which can be generated with 'openssl genpkey -algorithm ed25519'.
+The archive can be viewed and verified offline with
+'theia policy-recommendation inspect'.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Export the evidence of the job with name pr-e998433e-accb-4888-9fc8-06563f073e86
+$ theia policy-recommendation export-evidence pr-e998433e-accb-4888-9fc8-06563f073e86 --signing-key review.key --output evidence.tar.gz
+Export the evidence without the flow records
+$ theia policy-recommendation export-evidence pr-e998433e-accb-4888-9fc8-06563f073e86 --signing-key review.key --output evidence.tar.gz --flows=false
+`,
+	RunE: policyRecommendationExportEvidence,
+}
+
+func init() {
+	policyRecommendationCmd.AddCommand(policyRecommendationExportEvidenceCmd)
+	policyRecommendationExportEvidenceCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the policy recommendation job.",
+	)
+	policyRecommendationExportEvidenceCmd.RegisterFlagCompletionFunc("name", completeJobNames(policyRecommendationResource))
+	policyRecommendationExportEvidenceCmd.ValidArgsFunction = completeJobNameArg(policyRecommendationResource)
+	policyRecommendationExportEvidenceCmd.Flags().StringP(
+		"output",
+		"o",
+		"",
+		"The path of the archive the evidence is exported to. It is overwritten if it exists.",
+	)
+	policyRecommendationExportEvidenceCmd.MarkFlagRequired("output")
+	policyRecommendationExportEvidenceCmd.Flags().String(
+		"signing-key",
+		"",
+		"The path of the Ed25519 private key, in PKCS #8 PEM format, the archive is signed with.",
+	)
+	policyRecommendationExportEvidenceCmd.MarkFlagRequired("signing-key")
+	policyRecommendationExportEvidenceCmd.Flags().Bool(
+		"flows",
+		true,
+		"Include the flow records of the time range of the job in the archive.",
+	)
+	policyRecommendationExportEvidenceCmd.Flags().Int64(
+		"page-size",
+		defaultRecommendationPageSize,
+		"The number of recommended policies retrieved per request. Set to 0 to retrieve all of them in a single request.",
+	)
+	policyRecommendationExportEvidenceCmd.Flags().Int(
+		"batch-size",
+		65536,
+		"The number of flow records read from ClickHouse at once.",
+	)
+}
+
+// evidenceMetadata is the content of the metadata.json file of an evidence
+// archive.
+type evidenceMetadata struct {
+	// Job is the policy recommendation job, with its coverage statistics and
+	// its data window but without its recommended policies.
+	Job intelligence.NetworkPolicyRecommendation `json:"job"`
+	// FlowsStartTime and FlowsEndTime are the time range of the flow records
+	// of the archive, which are not set if they are not included.
+	FlowsStartTime *time.Time `json:"flowsStartTime,omitempty"`
+	FlowsEndTime   *time.Time `json:"flowsEndTime,omitempty"`
+	ExportTime     time.Time  `json:"exportTime"`
+	TheiaVersion   string     `json:"theiaVersion"`
+}
+
+// evidenceManifest is the content of the MANIFEST.json file of an evidence
+// archive, whose signature covers the digests of all the other files.
+type evidenceManifest struct {
+	Version int `json:"version"`
+	// PublicKeySHA256 is the fingerprint of the public key matching the
+	// signing key, so that reviewers can tell which key to verify with.
+	PublicKeySHA256 string         `json:"publicKeySHA256"`
+	Files           []evidenceFile `json:"files"`
+}
+
+type evidenceFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// evidenceExportOptions selects what is exported to an evidence archive.
+type evidenceExportOptions struct {
+	output       string
+	signingKey   ed25519.PrivateKey
+	includeFlows bool
+	pageSize     int64
+	batchSize    int
+}
+
+func policyRecommendationExportEvidence(cmd *cobra.Command, args []string) error {
+	prName, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	if prName == "" && len(args) == 1 {
+		prName = args[0]
+	}
+	err = util.ParseRecommendationName(prName)
+	if err != nil {
+		return err
+	}
+	var options evidenceExportOptions
+	if options.output, err = getPathFlag(cmd, "output"); err != nil {
+		return err
+	}
+	if options.output == "" {
+		return fmt.Errorf("output should not be empty")
+	}
+	signingKeyPath, err := getPathFlag(cmd, "signing-key")
+	if err != nil {
+		return err
+	}
+	if options.signingKey, err = loadEvidenceSigningKey(signingKeyPath); err != nil {
+		return err
+	}
+	if options.includeFlows, err = cmd.Flags().GetBool("flows"); err != nil {
+		return err
+	}
+	if options.pageSize, err = cmd.Flags().GetInt64("page-size"); err != nil {
+		return err
+	}
+	if options.pageSize < 0 {
+		return fmt.Errorf("page-size should not be negative")
+	}
+	if options.batchSize, err = cmd.Flags().GetInt("batch-size"); err != nil {
+		return err
+	}
+	if options.batchSize <= 0 {
+		return fmt.Errorf("batch-size should be a positive integer")
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	return exportPolicyRecommendationEvidence(theiaClient, prName, options)
+}
+
+// loadEvidenceSigningKey reads an Ed25519 private key in PKCS #8 PEM format.
+func loadEvidenceSigningKey(keyPath string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading signing key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not in PEM format", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error when parsing signing key %s: %v", keyPath, err)
+	}
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is a %T, it should be an Ed25519 key", keyPath, key)
+	}
+	return signingKey, nil
+}
+
+// publicKeyFingerprint returns the SHA-256 digest of the DER encoding of a
+// public key, in hexadecimal.
+func publicKeyFingerprint(publicKey ed25519.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func exportPolicyRecommendationEvidence(theiaClient restclient.Interface, prName string, options evidenceExportOptions) error {
+	npr, err := getPolicyRecommendationReport(theiaClient, prName)
+	if err != nil {
+		return fmt.Errorf("error when getting policy recommendation job by job name: %v", err)
+	}
+	if npr.Status.State != crdv1alpha1.NPRecommendationStateCompleted {
+		return fmt.Errorf("policy recommendation job %s is %s, the evidence is only available once it is COMPLETED", prName, npr.Status.State)
+	}
+	if npr.Status.ErrorMsg != "" {
+		return fmt.Errorf("error when getting recommendation report: %s", npr.Status.ErrorMsg)
+	}
+	var result bytes.Buffer
+	if err := streamPolicyRecommendationResult(theiaClient, prName, options.pageSize, nil, &result); err != nil {
+		return err
+	}
+	policies, err := splitRecommendedPolicies(result.String())
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return fmt.Errorf("policy recommendation job %s has no recommended policies", prName)
+	}
+
+	metadata := evidenceMetadata{
+		Job:          npr,
+		ExportTime:   time.Now().UTC().Truncate(time.Second),
+		TheiaVersion: version.GetFullVersion(),
+	}
+	var flowsFile *os.File
+	if options.includeFlows {
+		startTime, endTime, err := getEvidenceFlowsTimeRange(&npr, metadata.ExportTime)
+		if err != nil {
+			return err
+		}
+		metadata.FlowsStartTime, metadata.FlowsEndTime = &startTime, &endTime
+		if flowsFile, err = downloadEvidenceFlows(theiaClient, startTime, endTime, options.batchSize); err != nil {
+			return err
+		}
+		defer func() {
+			flowsFile.Close()
+			os.Remove(flowsFile.Name())
+		}()
+	}
+
+	file, err := os.Create(options.output)
+	if err != nil {
+		return fmt.Errorf("error when creating output file %s: %v", options.output, err)
+	}
+	err = writeEvidenceArchive(file, &metadata, policies, flowsFile, options.signingKey)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// A partial archive would fail the verification.
+		os.Remove(options.output)
+		return fmt.Errorf("error when exporting evidence to %s: %v", options.output, err)
+	}
+	fmt.Printf("Exported the evidence of %d recommended policies of job %s to %s\n", len(policies), prName, options.output)
+	return nil
+}
+
+// getEvidenceFlowsTimeRange returns the time range of the flow records read
+// by a job: the time range of the job if it was set, and otherwise the data
+// window it analyzed, up to the time it ran.
+func getEvidenceFlowsTimeRange(npr *intelligence.NetworkPolicyRecommendation, now time.Time) (time.Time, time.Time, error) {
+	startTime, endTime := npr.StartInterval.Time.UTC(), npr.EndInterval.Time.UTC()
+	if npr.StartInterval.IsZero() {
+		if npr.Status.DataWindow == nil || npr.Status.DataWindow.Flows == 0 {
+			return startTime, endTime, fmt.Errorf("policy recommendation job %s has no time range and no data window, set --flows=false to export its evidence without flow records", npr.Name)
+		}
+		startTime = npr.Status.DataWindow.MinFlowTime.Time.UTC()
+	}
+	if npr.EndInterval.IsZero() {
+		endTime = now
+		if !npr.Status.StartTime.IsZero() {
+			endTime = npr.Status.StartTime.Time.UTC()
+		}
+	}
+	if !endTime.After(startTime) {
+		return startTime, endTime, fmt.Errorf("policy recommendation job %s has an empty time range", npr.Name)
+	}
+	return startTime, endTime, nil
+}
+
+// downloadEvidenceFlows downloads the flow records in CSV format to a
+// temporary file, as their size must be known before they are added to the
+// archive. The caller must remove the file.
+func downloadEvidenceFlows(theiaClient restclient.Interface, startTime, endTime time.Time, batchSize int) (*os.File, error) {
+	stream, err := exportFlows(theiaClient, startTime, endTime, stats.FlowExportFormatCSV, batchSize, stats.FlowExportCompressionGzip)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	gzipReader, err := gzip.NewReader(stream)
+	if err != nil {
+		return nil, fmt.Errorf("error when exporting flows: %v", err)
+	}
+	defer gzipReader.Close()
+	file, err := os.CreateTemp("", "theia-evidence-flows-")
+	if err != nil {
+		return nil, fmt.Errorf("error when creating a file for the flow records: %v", err)
+	}
+	if _, err := io.Copy(file, gzipReader); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("error when exporting flows: %v", err)
+	}
+	return file, nil
+}
+
+// evidenceArchiveWriter writes the files of an evidence archive and records
+// their digests in its manifest.
+type evidenceArchiveWriter struct {
+	tarWriter *tar.Writer
+	modTime   time.Time
+	manifest  evidenceManifest
+}
+
+func (w *evidenceArchiveWriter) writeFile(name string, size int64, content io.Reader) (string, error) {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  w.modTime,
+	}
+	if err := w.tarWriter.WriteHeader(header); err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w.tarWriter, hash), content); err != nil {
+		return "", fmt.Errorf("error when writing %s: %v", name, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// addFile writes a file and adds it to the manifest.
+func (w *evidenceArchiveWriter) addFile(name string, size int64, content io.Reader) error {
+	digest, err := w.writeFile(name, size, content)
+	if err != nil {
+		return err
+	}
+	w.manifest.Files = append(w.manifest.Files, evidenceFile{Name: name, Size: size, SHA256: digest})
+	return nil
+}
+
+func (w *evidenceArchiveWriter) addBytes(name string, data []byte) error {
+	return w.addFile(name, int64(len(data)), bytes.NewReader(data))
+}
+
+// writeEvidenceArchive writes the files of an evidence archive, followed by
+// its manifest and the signature of the manifest.
+func writeEvidenceArchive(out io.Writer, metadata *evidenceMetadata, policies map[string]string, flowsFile *os.File, signingKey ed25519.PrivateKey) error {
+	fingerprint, err := publicKeyFingerprint(signingKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+	gzipWriter := gzip.NewWriter(out)
+	w := &evidenceArchiveWriter{
+		tarWriter: tar.NewWriter(gzipWriter),
+		modTime:   metadata.ExportTime,
+		manifest:  evidenceManifest{Version: evidenceArchiveVersion, PublicKeySHA256: fingerprint},
+	}
+	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.addBytes(evidenceMetadataFile, append(metadataJSON, '\n')); err != nil {
+		return err
+	}
+	coverageCSV, err := encodeEvidenceCoverage(metadata.Job.Status.Coverage)
+	if err != nil {
+		return err
+	}
+	if err := w.addBytes(evidenceCoverageFile, coverageCSV); err != nil {
+		return err
+	}
+	fileNames := make([]string, 0, len(policies))
+	for fileName := range policies {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		if err := w.addBytes(path.Join(evidencePoliciesDir, fileName), []byte(policies[fileName])); err != nil {
+			return err
+		}
+	}
+	if flowsFile != nil {
+		info, err := flowsFile.Stat()
+		if err != nil {
+			return err
+		}
+		if _, err := flowsFile.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := w.addFile(evidenceFlowsFile, info.Size(), flowsFile); err != nil {
+			return err
+		}
+	}
+	manifestJSON, err := json.MarshalIndent(&w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestJSON = append(manifestJSON, '\n')
+	if _, err := w.writeFile(evidenceManifestFile, int64(len(manifestJSON)), bytes.NewReader(manifestJSON)); err != nil {
+		return err
+	}
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(signingKey, manifestJSON)) + "\n")
+	if _, err := w.writeFile(evidenceSignatureFile, int64(len(signature)), bytes.NewReader(signature)); err != nil {
+		return err
+	}
+	if err := w.tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// encodeEvidenceCoverage encodes the coverage statistics of a job in CSV
+// format with a header row.
+func encodeEvidenceCoverage(coverages []intelligence.NetworkPolicyRecommendationCoverage) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"namespace", "matchedFlows", "unmatchedFlows"})
+	for _, coverage := range coverages {
+		writer.Write([]string{coverage.Namespace, strconv.FormatInt(coverage.MatchedFlows, 10), strconv.FormatInt(coverage.UnmatchedFlows, 10)})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("error when encoding coverage: %v", err)
+	}
+	return buf.Bytes(), nil
+}
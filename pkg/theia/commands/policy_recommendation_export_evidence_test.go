@@ -0,0 +1,242 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+const testEvidenceFlows = "flowStartSeconds,flowEndSeconds\n2023-05-01 10:00:00,2023-05-01 10:00:05\n"
+
+// newTestEvidenceKey generates an Ed25519 key, and writes its private key and
+// its public key in PEM format to files whose paths are returned.
+func newTestEvidenceKey(t *testing.T) (ed25519.PrivateKey, string, string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	privateKeyPath, publicKeyPath := filepath.Join(dir, "review.key"), filepath.Join(dir, "review.pub")
+	require.NoError(t, os.WriteFile(privateKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+	require.NoError(t, os.WriteFile(publicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644))
+	return privateKey, privateKeyPath, publicKeyPath
+}
+
+func newTestEvidenceJob(state string) intelligence.NetworkPolicyRecommendation {
+	return intelligence.NetworkPolicyRecommendation{
+		ObjectMeta:    metav1.ObjectMeta{Name: nprName},
+		PolicyType:    "anp-deny-applied",
+		StartInterval: metav1.NewTime(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)),
+		EndInterval:   metav1.NewTime(time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC)),
+		Status: intelligence.NetworkPolicyRecommendationStatus{
+			State: state,
+			Coverage: []intelligence.NetworkPolicyRecommendationCoverage{
+				{Namespace: "default", MatchedFlows: 90, UnmatchedFlows: 10},
+			},
+			DataWindow: &intelligence.NetworkPolicyRecommendationDataWindow{
+				MinFlowTime: metav1.NewTime(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)),
+				MaxFlowTime: metav1.NewTime(time.Date(2023, 5, 1, 10, 59, 0, 0, time.UTC)),
+				Flows:       120,
+				Nodes:       []string{"node-1"},
+			},
+		},
+	}
+}
+
+func TestPolicyRecommendationExportEvidence(t *testing.T) {
+	evidenceServer := func(t *testing.T, job intelligence.NetworkPolicyRecommendation) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+				npr := job
+				if r.URL.Query().Get("report") != "true" {
+					npr.Status.Coverage, npr.Status.DataWindow = nil, nil
+					npr.Status.RecommendationOutcome = recommendedANP + "---\n" + recommendedACNP
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(&npr)
+			case "/apis/stats.theia.antrea.io/v1alpha1/flows/export":
+				assert.Equal(t, "2023-05-01T10:00:00Z", r.URL.Query().Get("startTime"))
+				assert.Equal(t, "2023-05-01T11:00:00Z", r.URL.Query().Get("endTime"))
+				assert.Equal(t, "csv", r.URL.Query().Get("format"))
+				w.Header().Set("Content-Type", "application/gzip")
+				w.WriteHeader(http.StatusOK)
+				gzipWriter := gzip.NewWriter(w)
+				gzipWriter.Write([]byte(testEvidenceFlows))
+				gzipWriter.Close()
+			default:
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			}
+		}))
+	}
+	_, privateKeyPath, publicKeyPath := newTestEvidenceKey(t)
+	noTimeRangeJob := newTestEvidenceJob(crdv1alpha1.NPRecommendationStateCompleted)
+	noTimeRangeJob.StartInterval = metav1.Time{}
+	noTimeRangeJob.Status.DataWindow = nil
+	testCases := []struct {
+		name             string
+		job              intelligence.NetworkPolicyRecommendation
+		signingKey       string
+		noFlows          bool
+		expectedFiles    []string
+		expectedErrorMsg string
+	}{
+		{
+			name:          "Valid case",
+			job:           newTestEvidenceJob(crdv1alpha1.NPRecommendationStateCompleted),
+			signingKey:    privateKeyPath,
+			expectedFiles: []string{"metadata.json", "coverage.csv", "policies/clusternetworkpolicy-recommend-reject-all-acnp.yaml", "policies/networkpolicy-default-recommend-allow-anp-nxvqg.yaml", "flows.csv"},
+		},
+		{
+			name:          "Without flows",
+			job:           noTimeRangeJob,
+			signingKey:    privateKeyPath,
+			noFlows:       true,
+			expectedFiles: []string{"metadata.json", "coverage.csv", "policies/clusternetworkpolicy-recommend-reject-all-acnp.yaml", "policies/networkpolicy-default-recommend-allow-anp-nxvqg.yaml"},
+		},
+		{
+			name:             "No time range",
+			job:              noTimeRangeJob,
+			signingKey:       privateKeyPath,
+			expectedErrorMsg: "has no time range and no data window",
+		},
+		{
+			name:             "Job not completed",
+			job:              newTestEvidenceJob(crdv1alpha1.NPRecommendationStateRunning),
+			signingKey:       privateKeyPath,
+			expectedErrorMsg: fmt.Sprintf("policy recommendation job %s is RUNNING", nprName),
+		},
+		{
+			name:             "Public key as signing key",
+			job:              newTestEvidenceJob(crdv1alpha1.NPRecommendationStateCompleted),
+			signingKey:       publicKeyPath,
+			expectedErrorMsg: "error when parsing signing key",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			job:              newTestEvidenceJob(crdv1alpha1.NPRecommendationStateCompleted),
+			signingKey:       privateKeyPath,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := evidenceServer(t, tt.job)
+			defer testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() { SetupTheiaClientAndConnection = oldFunc }()
+			output := filepath.Join(t.TempDir(), "evidence.tar.gz")
+			cmd := new(cobra.Command)
+			cmd.Flags().String("name", nprName, "")
+			cmd.Flags().String("output", output, "")
+			cmd.Flags().String("signing-key", tt.signingKey, "")
+			cmd.Flags().Bool("flows", !tt.noFlows, "")
+			cmd.Flags().Int64("page-size", 1, "")
+			cmd.Flags().Int("batch-size", 1000, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := policyRecommendationExportEvidence(cmd, nil)
+			if tt.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+				assert.NoFileExists(t, output)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, readStdout(t, r, w), fmt.Sprintf("Exported the evidence of 2 recommended policies of job %s to %s", nprName, output))
+
+			archive, err := readEvidenceArchive(output, evidenceFlowsFile)
+			require.NoError(t, err)
+			publicKey, err := loadEvidencePublicKey(publicKeyPath)
+			require.NoError(t, err)
+			manifest, err := verifyEvidenceArchive(archive, publicKey)
+			require.NoError(t, err)
+			var files []string
+			for _, file := range manifest.Files {
+				files = append(files, file.Name)
+			}
+			assert.Equal(t, tt.expectedFiles, files)
+			assert.Equal(t, nprName, archive.metadata.Job.Name)
+			assert.Equal(t, tt.job.Status.Coverage, archive.metadata.Job.Status.Coverage)
+			assert.Empty(t, archive.metadata.Job.Status.RecommendationOutcome)
+			if tt.noFlows {
+				assert.Nil(t, archive.metadata.FlowsStartTime)
+			} else {
+				assert.Equal(t, testEvidenceFlows, string(archive.content))
+				assert.Equal(t, tt.job.StartInterval.Time, archive.metadata.FlowsStartTime.UTC())
+			}
+		})
+	}
+}
+
+func TestGetEvidenceFlowsTimeRange(t *testing.T) {
+	now := time.Date(2023, 5, 2, 0, 0, 0, 0, time.UTC)
+	job := newTestEvidenceJob(crdv1alpha1.NPRecommendationStateCompleted)
+	job.StartInterval, job.EndInterval = metav1.Time{}, metav1.Time{}
+	startTime, endTime, err := getEvidenceFlowsTimeRange(&job, now)
+	require.NoError(t, err)
+	assert.Equal(t, job.Status.DataWindow.MinFlowTime.Time, startTime)
+	assert.Equal(t, now, endTime)
+
+	job.Status.StartTime = metav1.NewTime(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC))
+	_, endTime, err = getEvidenceFlowsTimeRange(&job, now)
+	require.NoError(t, err)
+	assert.Equal(t, job.Status.StartTime.Time, endTime)
+
+	job.Status.StartTime = metav1.NewTime(time.Date(2023, 5, 1, 9, 0, 0, 0, time.UTC))
+	_, _, err = getEvidenceFlowsTimeRange(&job, now)
+	assert.ErrorContains(t, err, "empty time range")
+}
@@ -0,0 +1,224 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+)
+
+const (
+	recommendedANP = `apiVersion: crd.antrea.io/v1alpha1
+kind: NetworkPolicy
+metadata:
+  name: recommend-allow-anp-nxvqg
+  namespace: default
+spec:
+  appliedTo:
+  - podSelector:
+      matchLabels:
+        app: nginx
+`
+	recommendedACNP = `apiVersion: crd.antrea.io/v1alpha1
+kind: ClusterNetworkPolicy
+metadata:
+  name: recommend-reject-all-acnp
+spec:
+  appliedTo:
+  - podSelector: {}
+`
+)
+
+// gitOutput runs a git command in dir and returns its output.
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(string(output))
+}
+
+// newTestGitRepo creates a bare Git repository with a main branch holding a
+// README and a previously exported policy, and returns its path, which git
+// accepts as a URL on all the OSes unlike a file:// URL built from it.
+func newTestGitRepo(t *testing.T) string {
+	t.Setenv("GIT_AUTHOR_NAME", "theia")
+	t.Setenv("GIT_AUTHOR_EMAIL", "theia@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "theia")
+	t.Setenv("GIT_COMMITTER_EMAIL", "theia@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	remoteDir := filepath.Join(t.TempDir(), "remote.git")
+	gitOutput(t, "", "init", "--quiet", "--bare", "--initial-branch", "main", remoteDir)
+	workDir := t.TempDir()
+	gitOutput(t, workDir, "init", "--quiet", "--initial-branch", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "README.md"), []byte("GitOps\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(workDir, "network-policies"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "network-policies", "networkpolicy-default-old.yaml"), []byte("kind: NetworkPolicy\n"), 0644))
+	gitOutput(t, workDir, "add", "--all")
+	gitOutput(t, workDir, "commit", "--quiet", "-m", "Initial commit")
+	gitOutput(t, workDir, "push", "--quiet", remoteDir, "main")
+	return remoteDir
+}
+
+func newTestRecommendationClient(t *testing.T, nprName string) restclient.Interface {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSpace(r.URL.Path) {
+		case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+			npr := &intelligence.NetworkPolicyRecommendation{
+				ObjectMeta: metav1.ObjectMeta{Name: nprName},
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State: crdv1alpha1.NPRecommendationStateCompleted,
+				},
+			}
+			if r.URL.Query().Get("continue") == "" {
+				npr.Status.RecommendationOutcome = recommendedANP
+				npr.Status.Continue = "1"
+			} else {
+				npr.Status.RecommendationOutcome = recommendedACNP
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(npr)
+		default:
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(testServer.Close)
+	clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+	clientset, err := kubernetes.NewForConfig(clientConfig)
+	require.NoError(t, err)
+	return clientset.CoreV1().RESTClient()
+}
+
+func TestExportPolicyRecommendationResult(t *testing.T) {
+	nprName := "pr-e292395c-3de1-11ed-b878-0242ac120002"
+	remoteDir := newTestGitRepo(t)
+	theiaClient := newTestRecommendationClient(t, nprName)
+
+	options := gitExportOptions{
+		repo:          remoteDir,
+		branch:        "main",
+		path:          "network-policies",
+		commitMessage: "Update recommended policies",
+	}
+	require.NoError(t, exportPolicyRecommendationResult(theiaClient, nprName, 1, options))
+	assert.Equal(t, "Update recommended policies", gitOutput(t, remoteDir, "log", "-1", "--format=%s", "main"))
+	assert.Equal(t, []string{
+		"README.md",
+		"network-policies/clusternetworkpolicy-recommend-reject-all-acnp.yaml",
+		"network-policies/networkpolicy-default-recommend-allow-anp-nxvqg.yaml",
+	}, strings.Split(gitOutput(t, remoteDir, "ls-tree", "-r", "--name-only", "main"), "\n"))
+	assert.Equal(t, strings.TrimSpace(recommendedANP), gitOutput(t, remoteDir, "show", "main:network-policies/networkpolicy-default-recommend-allow-anp-nxvqg.yaml"))
+	assert.Equal(t, strings.TrimSpace(recommendedACNP), gitOutput(t, remoteDir, "show", "main:network-policies/clusternetworkpolicy-recommend-reject-all-acnp.yaml"))
+
+	// Exporting the same result again does not create an empty commit.
+	head := gitOutput(t, remoteDir, "rev-parse", "main")
+	require.NoError(t, exportPolicyRecommendationResult(theiaClient, nprName, 1, options))
+	assert.Equal(t, head, gitOutput(t, remoteDir, "rev-parse", "main"))
+
+	// A branch which does not exist is created from the default branch.
+	options.branch = "theia-recommendation"
+	options.path = nprName
+	require.NoError(t, exportPolicyRecommendationResult(theiaClient, nprName, 0, options))
+	assert.Equal(t, head, gitOutput(t, remoteDir, "rev-parse", "theia-recommendation~1"))
+	assert.Contains(t, gitOutput(t, remoteDir, "ls-tree", "-r", "--name-only", "theia-recommendation"),
+		nprName+"/networkpolicy-default-recommend-allow-anp-nxvqg.yaml")
+
+	options.repo = filepath.Join(t.TempDir(), "missing.git")
+	err := exportPolicyRecommendationResult(theiaClient, nprName, 0, options)
+	assert.ErrorContains(t, err, "error when running git clone")
+}
+
+func TestPolicyRecommendationExport(t *testing.T) {
+	nprName := "pr-e292395c-3de1-11ed-b878-0242ac120002"
+	testCases := []struct {
+		name             string
+		nprName          string
+		gitRepo          string
+		path             string
+		expectedErrorMsg string
+	}{
+		{
+			name:             "Invalid nprName",
+			nprName:          "mock_nprName",
+			gitRepo:          "git@github.com:example/gitops.git",
+			expectedErrorMsg: "not a valid policy recommendation job name",
+		},
+		{
+			name:             "Empty git-repo",
+			nprName:          nprName,
+			expectedErrorMsg: "git-repo should not be empty",
+		},
+		{
+			name:             "Path outside of the repository",
+			nprName:          nprName,
+			gitRepo:          "git@github.com:example/gitops.git",
+			path:             "../policies",
+			expectedErrorMsg: "should be a relative path inside the Git repository",
+		},
+		{
+			name:             "Absolute path",
+			nprName:          nprName,
+			gitRepo:          "git@github.com:example/gitops.git",
+			path:             "/policies",
+			expectedErrorMsg: "should be a relative path inside the Git repository",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := new(cobra.Command)
+			cmd.Flags().String("name", tt.nprName, "")
+			cmd.Flags().String("git-repo", tt.gitRepo, "")
+			cmd.Flags().String("git-branch", "main", "")
+			cmd.Flags().String("path", tt.path, "")
+			cmd.Flags().String("commit-message", "", "")
+			cmd.Flags().Int64("page-size", 1, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			err := policyRecommendationExport(cmd, []string{})
+			assert.ErrorContains(t, err, tt.expectedErrorMsg)
+		})
+	}
+}
+
+func TestSplitRecommendedPolicies(t *testing.T) {
+	files, err := splitRecommendedPolicies(recommendedANP + "---\n" + recommendedACNP)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"networkpolicy-default-recommend-allow-anp-nxvqg.yaml": recommendedANP,
+		"clusternetworkpolicy-recommend-reject-all-acnp.yaml":  recommendedACNP,
+	}, files)
+
+	_, err = splitRecommendedPolicies(recommendedANP + "---\n" + recommendedANP)
+	assert.ErrorContains(t, err, "duplicate recommended policy")
+	_, err = splitRecommendedPolicies("spec: {}\n")
+	assert.ErrorContains(t, err, "has no kind or name")
+}
@@ -0,0 +1,251 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	policyKindK8sNP = "K8sNP"
+	policyKindANP   = "ANP"
+	policyKindACNP  = "ACNP"
+	// namespaceNameLabel is the label set by K8s on every Namespace with the
+	// name of the Namespace, which the recommended ACNPs select Namespaces by.
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+var validPolicyKinds = []string{policyKindK8sNP, policyKindANP, policyKindACNP}
+
+// recommendationFilter selects the recommended policies of a recommendation
+// result by Namespace, kind and appliedTo Pod labels. The zero value selects
+// all the policies. The ClusterGroups are only selected if a selected policy
+// refers to them, which may be in a later page of the result, so the filter
+// holds the ClusterGroups not referred to yet across pages.
+type recommendationFilter struct {
+	namespace string
+	kinds     sets.Set[string]
+	appliedTo labels.Selector
+	// referencedGroups are the names of the ClusterGroups referred to by the
+	// selected policies.
+	referencedGroups sets.Set[string]
+	// pendingGroups maps the names of the ClusterGroups which are not
+	// referred to yet to their yaml documents.
+	pendingGroups map[string]string
+}
+
+// recommendedPolicy is the subset of a recommended policy, or of a ClusterGroup
+// referred to by a recommended ACNP, used to filter the recommendation result.
+type recommendedPolicy struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		// PodSelector is the appliedTo of a K8s NetworkPolicy.
+		PodSelector *labelSelector `yaml:"podSelector"`
+		AppliedTo   []struct {
+			PodSelector       *labelSelector `yaml:"podSelector"`
+			NamespaceSelector *labelSelector `yaml:"namespaceSelector"`
+		} `yaml:"appliedTo"`
+		ServiceReference *struct {
+			Namespace string `yaml:"namespace"`
+		} `yaml:"serviceReference"`
+		Ingress []struct {
+			From []groupPeer `yaml:"from"`
+		} `yaml:"ingress"`
+		Egress []struct {
+			To []groupPeer `yaml:"to"`
+		} `yaml:"egress"`
+	} `yaml:"spec"`
+}
+
+// groupPeer is the peer of a rule of a recommended Antrea-native policy, which
+// may refer to a ClusterGroup.
+type groupPeer struct {
+	Group string `yaml:"group"`
+}
+
+type labelSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+// newRecommendationFilter validates the filters given to the command.
+func newRecommendationFilter(namespace, kinds, appliedTo string) (*recommendationFilter, error) {
+	filter := &recommendationFilter{
+		namespace:        namespace,
+		referencedGroups: sets.New[string](),
+		pendingGroups:    make(map[string]string),
+	}
+	if kinds != "" {
+		filter.kinds = sets.New[string]()
+		for _, kind := range strings.Split(kinds, ",") {
+			kind = strings.TrimSpace(kind)
+			if !sets.New(validPolicyKinds...).Has(kind) {
+				return nil, fmt.Errorf("kind %q is not valid, it should be one of %s", kind, strings.Join(validPolicyKinds, ", "))
+			}
+			filter.kinds.Insert(kind)
+		}
+	}
+	if appliedTo != "" {
+		selector, err := labels.Parse(appliedTo)
+		if err != nil {
+			return nil, fmt.Errorf("applied-to %q is not a valid label selector: %v", appliedTo, err)
+		}
+		filter.appliedTo = selector
+	}
+	return filter, nil
+}
+
+// isEmpty checks whether the filter selects all the policies.
+func (f *recommendationFilter) isEmpty() bool {
+	return f == nil || (f.namespace == "" && f.kinds == nil && f.appliedTo == nil)
+}
+
+// filterOutcome returns the yaml documents of a page of recommended policies
+// which are selected by the filter, separated by yaml document separators. A
+// ClusterGroup is returned before the first selected policy referring to it,
+// or in place if a policy of a previous page already referred to it, and is
+// dropped if no selected policy refers to it.
+func (f *recommendationFilter) filterOutcome(outcome string) (string, error) {
+	if f.isEmpty() {
+		return outcome, nil
+	}
+	var documents []string
+	for _, document := range yamlSeparatorRegex.Split(outcome, -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+		document = strings.Trim(document, "\n") + "\n"
+		var policy recommendedPolicy
+		if err := yaml.Unmarshal([]byte(document), &policy); err != nil {
+			return "", fmt.Errorf("error when parsing recommended policy: %v", err)
+		}
+		if !f.matches(&policy) {
+			continue
+		}
+		if policy.Kind == "ClusterGroup" {
+			if f.referencedGroups.Has(policy.Metadata.Name) {
+				documents = append(documents, document)
+			} else {
+				f.pendingGroups[policy.Metadata.Name] = document
+			}
+			continue
+		}
+		for _, group := range policy.groups() {
+			f.referencedGroups.Insert(group)
+			if groupDocument, ok := f.pendingGroups[group]; ok {
+				documents = append(documents, groupDocument)
+				delete(f.pendingGroups, group)
+			}
+		}
+		documents = append(documents, document)
+	}
+	return strings.Join(documents, "---\n"), nil
+}
+
+// matches checks whether the policy is selected by the filter. The
+// ClusterGroups referred to by the recommended ACNPs are kept along with the
+// ACNPs, as long as their Service is in the selected Namespace.
+func (f *recommendationFilter) matches(policy *recommendedPolicy) bool {
+	if f.kinds != nil && !f.kinds.Has(policy.policyKind()) {
+		return false
+	}
+	if f.namespace != "" && !policy.namespaces().Has(f.namespace) {
+		return false
+	}
+	if f.appliedTo != nil && policy.Kind != "ClusterGroup" {
+		for _, podSelector := range policy.podSelectors() {
+			if podSelector != nil && f.appliedTo.Matches(labels.Set(podSelector.MatchLabels)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// policyKind returns the kind of the policy, as given to --kind.
+func (p *recommendedPolicy) policyKind() string {
+	switch p.Kind {
+	case "NetworkPolicy":
+		if strings.HasPrefix(p.APIVersion, "networking.k8s.io/") {
+			return policyKindK8sNP
+		}
+		return policyKindANP
+	case "ClusterNetworkPolicy", "ClusterGroup":
+		return policyKindACNP
+	}
+	return p.Kind
+}
+
+// namespaces returns the Namespaces the policy applies to.
+func (p *recommendedPolicy) namespaces() sets.Set[string] {
+	namespaces := sets.New[string]()
+	if p.Metadata.Namespace != "" {
+		namespaces.Insert(p.Metadata.Namespace)
+	}
+	for _, appliedTo := range p.Spec.AppliedTo {
+		if appliedTo.NamespaceSelector != nil {
+			if namespace, ok := appliedTo.NamespaceSelector.MatchLabels[namespaceNameLabel]; ok {
+				namespaces.Insert(namespace)
+			}
+		}
+	}
+	if p.Spec.ServiceReference != nil {
+		namespaces.Insert(p.Spec.ServiceReference.Namespace)
+	}
+	return namespaces
+}
+
+// groups returns the names of the ClusterGroups the rules of the policy refer
+// to.
+func (p *recommendedPolicy) groups() []string {
+	var groups []string
+	for _, rule := range p.Spec.Ingress {
+		for _, peer := range rule.From {
+			if peer.Group != "" {
+				groups = append(groups, peer.Group)
+			}
+		}
+	}
+	for _, rule := range p.Spec.Egress {
+		for _, peer := range rule.To {
+			if peer.Group != "" {
+				groups = append(groups, peer.Group)
+			}
+		}
+	}
+	return groups
+}
+
+// podSelectors returns the selectors of the Pods the policy applies to.
+func (p *recommendedPolicy) podSelectors() []*labelSelector {
+	if p.Spec.PodSelector != nil {
+		return []*labelSelector{p.Spec.PodSelector}
+	}
+	var podSelectors []*labelSelector
+	for _, appliedTo := range p.Spec.AppliedTo {
+		podSelectors = append(podSelectors, appliedTo.PodSelector)
+	}
+	return podSelectors
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	recommendedK8sNP = `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: recommend-k8s-np-kdjq2
+  namespace: kube-system
+spec:
+  podSelector:
+    matchLabels:
+      app: coredns
+`
+	recommendedSvcACNP = `apiVersion: crd.antrea.io/v1alpha1
+kind: ClusterNetworkPolicy
+metadata:
+  name: recommend-svc-allow-acnp-8x4bm
+spec:
+  appliedTo:
+  - namespaceSelector:
+      matchLabels:
+        kubernetes.io/metadata.name: default
+    podSelector:
+      matchLabels:
+        app: client
+  egress:
+  - action: Allow
+    ports:
+    - port: 80
+      protocol: TCP
+    to:
+    - group: cg-default-nginx
+`
+	recommendedSvcClusterGroup = `apiVersion: crd.antrea.io/v1alpha2
+kind: ClusterGroup
+metadata:
+  name: cg-default-nginx
+spec:
+  serviceReference:
+    name: nginx
+    namespace: default
+`
+)
+
+func TestRecommendationFilter(t *testing.T) {
+	outcome := strings.Join([]string{recommendedANP, recommendedK8sNP, recommendedSvcClusterGroup, recommendedSvcACNP, recommendedACNP}, "---\n")
+	testCases := []struct {
+		name             string
+		namespace        string
+		kinds            string
+		appliedTo        string
+		expectedPolicies []string
+		expectedErrorMsg string
+	}{
+		{
+			name:             "No filter",
+			expectedPolicies: []string{recommendedANP, recommendedK8sNP, recommendedSvcClusterGroup, recommendedSvcACNP, recommendedACNP},
+		},
+		{
+			name:             "Filter by Namespace",
+			namespace:        "default",
+			expectedPolicies: []string{recommendedANP, recommendedSvcClusterGroup, recommendedSvcACNP},
+		},
+		{
+			name:             "Filter by kinds",
+			kinds:            "K8sNP, ACNP",
+			expectedPolicies: []string{recommendedK8sNP, recommendedSvcClusterGroup, recommendedSvcACNP, recommendedACNP},
+		},
+		{
+			name:             "Filter by appliedTo",
+			appliedTo:        "app in (nginx, client)",
+			expectedPolicies: []string{recommendedANP, recommendedSvcClusterGroup, recommendedSvcACNP},
+		},
+		{
+			name:             "Filter by Namespace, kind and appliedTo",
+			namespace:        "default",
+			kinds:            "ANP",
+			appliedTo:        "app=nginx",
+			expectedPolicies: []string{recommendedANP},
+		},
+		{
+			name:             "ClusterGroup not referred to by a selected policy",
+			kinds:            "ACNP",
+			appliedTo:        "app=nginx",
+			expectedPolicies: nil,
+		},
+		{
+			name:      "No policy selected",
+			namespace: "kube-system",
+			kinds:     "ANP",
+		},
+		{
+			name:             "Invalid kind",
+			kinds:            "ANP,CNP",
+			expectedErrorMsg: "kind \"CNP\" is not valid, it should be one of K8sNP, ANP, ACNP",
+		},
+		{
+			name:             "Invalid appliedTo",
+			appliedTo:        "app in nginx",
+			expectedErrorMsg: "applied-to \"app in nginx\" is not a valid label selector",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newRecommendationFilter(tt.namespace, tt.kinds, tt.appliedTo)
+			if tt.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			result, err := filter.filterOutcome(outcome)
+			require.NoError(t, err)
+			assert.Equal(t, strings.Join(tt.expectedPolicies, "---\n"), result)
+		})
+	}
+}
+
+func TestRecommendationFilterAcrossPages(t *testing.T) {
+	testCases := []struct {
+		name          string
+		pages         []string
+		expectedPages []string
+	}{
+		{
+			name:          "ClusterGroup before the policy referring to it",
+			pages:         []string{recommendedSvcClusterGroup, recommendedANP, recommendedSvcACNP},
+			expectedPages: []string{"", recommendedANP, recommendedSvcClusterGroup + "---\n" + recommendedSvcACNP},
+		},
+		{
+			name:          "ClusterGroup after the policy referring to it",
+			pages:         []string{recommendedSvcACNP, recommendedSvcClusterGroup},
+			expectedPages: []string{recommendedSvcACNP, recommendedSvcClusterGroup},
+		},
+		{
+			name:          "ClusterGroup not referred to",
+			pages:         []string{recommendedSvcClusterGroup, recommendedANP},
+			expectedPages: []string{"", recommendedANP},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newRecommendationFilter("default", "", "")
+			require.NoError(t, err)
+			for i, page := range tt.pages {
+				result, err := filter.filterOutcome(page)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedPages[i], result, "page %d", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+)
+
+// Run "go test ./pkg/theia/commands -run Golden -update" to regenerate the
+// golden files after an intended change of the output.
+var updateGolden = flag.Bool("update", false, "Update the golden files under testdata instead of comparing with them")
+
+const (
+	recommendationTestdataDir = "testdata/policy-recommendation"
+	goldenNPRName             = "pr-e292395c-3de1-11ed-b878-0242ac120002"
+)
+
+// checkGolden compares actual with the golden file at
+// testdata/policy-recommendation/golden/<name>, or writes actual to the golden
+// file if -update is set.
+func checkGolden(t *testing.T, name string, actual []byte) {
+	goldenPath := filepath.Join(recommendationTestdataDir, "golden", name)
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(goldenPath, actual, 0644))
+		return
+	}
+	expected, err := os.ReadFile(goldenPath)
+	require.NoError(t, err, "Golden file %s is missing, run the test with -update to create it", goldenPath)
+	assert.Equal(t, string(expected), string(actual), "Output differs from golden file %s, run the test with -update if the change is intended", goldenPath)
+}
+
+// newGoldenRecommendationClient returns a client of a Theia Manager serving
+// the recommendation result stored in the result-page-*.yaml files of the
+// testdata, one page per file.
+func newGoldenRecommendationClient(t *testing.T) restclient.Interface {
+	pageFiles, err := filepath.Glob(filepath.Join(recommendationTestdataDir, "result-page-*.yaml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, pageFiles)
+	sort.Strings(pageFiles)
+	var pages []string
+	for _, pageFile := range pageFiles {
+		page, err := os.ReadFile(pageFile)
+		require.NoError(t, err)
+		pages = append(pages, string(page))
+	}
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimSpace(r.URL.Path) != fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", goldenNPRName) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		page := 0
+		if continueToken := r.URL.Query().Get("continue"); continueToken != "" {
+			fmt.Sscan(continueToken, &page)
+		}
+		npr := &intelligence.NetworkPolicyRecommendation{
+			ObjectMeta: metav1.ObjectMeta{Name: goldenNPRName},
+			Status: intelligence.NetworkPolicyRecommendationStatus{
+				State:                 crdv1alpha1.NPRecommendationStateCompleted,
+				RecommendationOutcome: pages[page],
+			},
+		}
+		if page+1 < len(pages) {
+			npr.Status.Continue = fmt.Sprint(page + 1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(npr)
+	}))
+	t.Cleanup(testServer.Close)
+	clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+	clientset, err := kubernetes.NewForConfig(clientConfig)
+	require.NoError(t, err)
+	return clientset.CoreV1().RESTClient()
+}
+
+func TestPolicyRecommendationRetrieveGolden(t *testing.T) {
+	theiaClient := newGoldenRecommendationClient(t)
+	testCases := []struct {
+		golden    string
+		namespace string
+		kinds     string
+		appliedTo string
+	}{
+		{golden: "retrieve.yaml"},
+		{golden: "retrieve-namespace-default.yaml", namespace: "default"},
+		{golden: "retrieve-kind-k8snp-acnp.yaml", kinds: "K8sNP,ACNP"},
+		{golden: "retrieve-applied-to-app-nginx.yaml", appliedTo: "app=nginx"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.golden, func(t *testing.T) {
+			filter, err := newRecommendationFilter(tt.namespace, tt.kinds, tt.appliedTo)
+			require.NoError(t, err)
+			var result bytes.Buffer
+			require.NoError(t, streamPolicyRecommendationResult(theiaClient, goldenNPRName, 0, filter, &result))
+			checkGolden(t, tt.golden, result.Bytes())
+		})
+	}
+}
+
+func TestPolicyRecommendationExportGolden(t *testing.T) {
+	theiaClient := newGoldenRecommendationClient(t)
+	var result bytes.Buffer
+	require.NoError(t, streamPolicyRecommendationResult(theiaClient, goldenNPRName, 0, nil, &result))
+	files, err := splitRecommendedPolicies(result.String())
+	require.NoError(t, err)
+	// The exported files are concatenated in the order of their names, each
+	// one preceded by its name, so that the layout of the exported directory
+	// is checked along with the content of the files.
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	var layout bytes.Buffer
+	for _, fileName := range fileNames {
+		fmt.Fprintf(&layout, "# %s\n%s", fileName, files[fileName])
+	}
+	checkGolden(t, "export.txt", layout.Bytes())
+}
@@ -0,0 +1,307 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// policyRecommendationInspectCmd represents the policy-recommendation inspect command
+var policyRecommendationInspectCmd = &cobra.Command{
+	Use:   "inspect ARCHIVE",
+	Short: "View and verify an evidence archive of a policy recommendation job",
+	Long: `View an evidence archive exported by 'theia policy-recommendation
+export-evidence', without connecting to the cluster. The size and the digest of
+every file of the archive are checked against its manifest, and the signature
+of the manifest is verified with the Ed25519 public key, in PEM format, given
+by --public-key. The public key of a signing key can be extracted with
+'openssl pkey -in review.key -pubout'. Without --public-key, the fingerprint of
+the signing key is displayed but the signature is not verified.
+The job, its coverage and the files of the archive are displayed, or the
+content of a single file of the archive if --file is set.`,
+	Args: cobra.ExactArgs(1),
+	Example: `
+View and verify an evidence archive
+$ theia policy-recommendation inspect evidence.tar.gz --public-key review.pub
+Print a recommended policy of an evidence archive
+$ theia policy-recommendation inspect evidence.tar.gz --file policies/networkpolicy-default-recommend-allow-anp-nxvqg.yaml
+`,
+	RunE: policyRecommendationInspect,
+}
+
+func init() {
+	policyRecommendationCmd.AddCommand(policyRecommendationInspectCmd)
+	policyRecommendationInspectCmd.Flags().String(
+		"public-key",
+		"",
+		"The path of the Ed25519 public key, in PEM format, the signature of the archive is verified with.",
+	)
+	policyRecommendationInspectCmd.Flags().String(
+		"file",
+		"",
+		"The name of a file of the archive whose content is printed, e.g. metadata.json.",
+	)
+}
+
+// evidenceArchive is the content of an evidence archive read for inspection.
+// Only the small files are held in memory, the other files are only hashed.
+type evidenceArchive struct {
+	manifestJSON []byte
+	signature    []byte
+	metadata     evidenceMetadata
+	// files are the size and the digest of the files of the archive other
+	// than the manifest and its signature, by name.
+	files map[string]evidenceFile
+	// content is the content of the requested file.
+	content []byte
+}
+
+func policyRecommendationInspect(cmd *cobra.Command, args []string) error {
+	archivePath, err := expandHome(args[0])
+	if err != nil {
+		return err
+	}
+	publicKeyPath, err := getPathFlag(cmd, "public-key")
+	if err != nil {
+		return err
+	}
+	var publicKey ed25519.PublicKey
+	if publicKeyPath != "" {
+		if publicKey, err = loadEvidencePublicKey(publicKeyPath); err != nil {
+			return err
+		}
+	}
+	fileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return err
+	}
+	archive, err := readEvidenceArchive(archivePath, fileName)
+	if err != nil {
+		return err
+	}
+	manifest, err := verifyEvidenceArchive(archive, publicKey)
+	if err != nil {
+		return fmt.Errorf("evidence archive %s failed verification: %v", archivePath, err)
+	}
+	if fileName != "" {
+		if _, ok := archive.files[fileName]; !ok {
+			return fmt.Errorf("evidence archive %s has no file %s", archivePath, fileName)
+		}
+		_, err := os.Stdout.Write(archive.content)
+		return err
+	}
+	printEvidenceArchive(archive, manifest, publicKey != nil)
+	return nil
+}
+
+// loadEvidencePublicKey reads an Ed25519 public key in PKIX PEM format.
+func loadEvidencePublicKey(keyPath string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading public key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key %s is not in PEM format", keyPath)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error when parsing public key %s: %v", keyPath, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is a %T, it should be an Ed25519 key", keyPath, key)
+	}
+	return publicKey, nil
+}
+
+// readEvidenceArchive reads an evidence archive, keeping the content of the
+// manifest, of its signature, of the metadata and of the file named fileName.
+func readEvidenceArchive(archivePath, fileName string) (*evidenceArchive, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error when opening evidence archive: %v", err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error when reading evidence archive %s: %v", archivePath, err)
+	}
+	defer gzipReader.Close()
+	archive := &evidenceArchive{files: make(map[string]evidenceFile)}
+	var metadataJSON []byte
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error when reading evidence archive %s: %v", archivePath, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("evidence archive %s has an unexpected entry %s", archivePath, header.Name)
+		}
+		if _, ok := archive.files[header.Name]; ok {
+			return nil, fmt.Errorf("evidence archive %s has duplicate file %s", archivePath, header.Name)
+		}
+		var content bytes.Buffer
+		hash := sha256.New()
+		var writer io.Writer = hash
+		switch header.Name {
+		case evidenceManifestFile, evidenceSignatureFile, evidenceMetadataFile, fileName:
+			writer = io.MultiWriter(hash, &content)
+		}
+		size, err := io.Copy(writer, tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("error when reading %s of evidence archive %s: %v", header.Name, archivePath, err)
+		}
+		switch header.Name {
+		case evidenceManifestFile:
+			archive.manifestJSON = content.Bytes()
+			continue
+		case evidenceSignatureFile:
+			archive.signature = content.Bytes()
+			continue
+		case evidenceMetadataFile:
+			metadataJSON = content.Bytes()
+		}
+		if header.Name == fileName {
+			archive.content = content.Bytes()
+		}
+		archive.files[header.Name] = evidenceFile{Name: header.Name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	}
+	if metadataJSON == nil {
+		return nil, fmt.Errorf("evidence archive %s has no %s", archivePath, evidenceMetadataFile)
+	}
+	if err := json.Unmarshal(metadataJSON, &archive.metadata); err != nil {
+		return nil, fmt.Errorf("error when parsing %s of evidence archive %s: %v", evidenceMetadataFile, archivePath, err)
+	}
+	return archive, nil
+}
+
+// verifyEvidenceArchive checks that the files of an archive are exactly the
+// files of its manifest, and verifies the signature of the manifest if
+// publicKey is not nil.
+func verifyEvidenceArchive(archive *evidenceArchive, publicKey ed25519.PublicKey) (*evidenceManifest, error) {
+	if archive.manifestJSON == nil {
+		return nil, fmt.Errorf("no %s", evidenceManifestFile)
+	}
+	var manifest evidenceManifest
+	if err := json.Unmarshal(archive.manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("error when parsing %s: %v", evidenceManifestFile, err)
+	}
+	if manifest.Version != evidenceArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d, this version of theia supports version %d", manifest.Version, evidenceArchiveVersion)
+	}
+	if publicKey != nil {
+		if archive.signature == nil {
+			return nil, fmt.Errorf("no %s", evidenceSignatureFile)
+		}
+		signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(archive.signature)))
+		if err != nil {
+			return nil, fmt.Errorf("error when decoding %s: %v", evidenceSignatureFile, err)
+		}
+		fingerprint, err := publicKeyFingerprint(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if fingerprint != manifest.PublicKeySHA256 {
+			return nil, fmt.Errorf("the archive is signed by key SHA256:%s, not by the given public key SHA256:%s", manifest.PublicKeySHA256, fingerprint)
+		}
+		if !ed25519.Verify(publicKey, archive.manifestJSON, signature) {
+			return nil, fmt.Errorf("invalid signature of %s", evidenceManifestFile)
+		}
+	}
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, expected := range manifest.Files {
+		listed[expected.Name] = true
+		actual, ok := archive.files[expected.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing file %s", expected.Name)
+		}
+		if actual != expected {
+			return nil, fmt.Errorf("file %s does not match the manifest", expected.Name)
+		}
+	}
+	for name := range archive.files {
+		if !listed[name] {
+			return nil, fmt.Errorf("file %s is not in the manifest", name)
+		}
+	}
+	return &manifest, nil
+}
+
+func printEvidenceArchive(archive *evidenceArchive, manifest *evidenceManifest, verified bool) {
+	metadata := &archive.metadata
+	job := &metadata.Job
+	fmt.Printf("Job:            %s\n", job.Name)
+	fmt.Printf("State:          %s\n", job.Status.State)
+	fmt.Printf("Policy type:    %s\n", job.PolicyType)
+	fmt.Printf("Time range:     %s to %s\n", FormatTimestamp(job.StartInterval.Time), FormatTimestamp(job.EndInterval.Time))
+	if dataWindow := job.Status.DataWindow; dataWindow != nil {
+		fmt.Printf("Data window:    %s to %s, %d flow records from %d Nodes\n", FormatTimestamp(dataWindow.MinFlowTime.Time), FormatTimestamp(dataWindow.MaxFlowTime.Time), dataWindow.Flows, len(dataWindow.Nodes))
+	}
+	if metadata.FlowsStartTime != nil && metadata.FlowsEndTime != nil {
+		fmt.Printf("Flow records:   %s to %s\n", FormatTimestamp(*metadata.FlowsStartTime), FormatTimestamp(*metadata.FlowsEndTime))
+	} else {
+		fmt.Printf("Flow records:   not included\n")
+	}
+	fmt.Printf("Exported at:    %s\n", FormatTimestamp(metadata.ExportTime))
+	fmt.Printf("Theia version:  %s\n", metadata.TheiaVersion)
+	fmt.Printf("Signing key:    SHA256:%s\n", manifest.PublicKeySHA256)
+	if verified {
+		fmt.Printf("Signature:      verified\n")
+	} else {
+		fmt.Printf("Signature:      not verified, set --public-key to verify it\n")
+	}
+	if dataWindow := job.Status.DataWindow; dataWindow != nil && len(dataWindow.Caveats) > 0 {
+		fmt.Println("Caveats:")
+		for _, caveat := range dataWindow.Caveats {
+			fmt.Printf("  - %s\n", caveat)
+		}
+	}
+	if len(job.Status.Coverage) > 0 {
+		fmt.Println()
+		result := [][]string{{"Namespace", "MatchedFlows", "UnmatchedFlows", "Coverage"}}
+		for _, coverage := range job.Status.Coverage {
+			result = append(result, []string{coverage.Namespace, strconv.FormatInt(coverage.MatchedFlows, 10), strconv.FormatInt(coverage.UnmatchedFlows, 10), formatCoverage(coverage.MatchedFlows, coverage.UnmatchedFlows)})
+		}
+		TableOutput(result)
+	}
+	fmt.Println()
+	files := [][]string{{"File", "Size", "SHA256"}}
+	for _, file := range manifest.Files {
+		files = append(files, []string{file.Name, strconv.FormatInt(file.Size, 10), file.SHA256})
+	}
+	TableOutput(files)
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+)
+
+// newTestEvidenceArchive writes an evidence archive without flow records, and
+// returns its path.
+func newTestEvidenceArchive(t *testing.T, signingKeyPath string) string {
+	signingKey, err := loadEvidenceSigningKey(signingKeyPath)
+	require.NoError(t, err)
+	policies, err := splitRecommendedPolicies(recommendedANP)
+	require.NoError(t, err)
+	metadata := &evidenceMetadata{
+		Job:          newTestEvidenceJob(crdv1alpha1.NPRecommendationStateCompleted),
+		ExportTime:   time.Date(2023, 5, 2, 0, 0, 0, 0, time.UTC),
+		TheiaVersion: "v0.7.0",
+	}
+	archivePath := filepath.Join(t.TempDir(), "evidence.tar.gz")
+	file, err := os.Create(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, writeEvidenceArchive(file, metadata, policies, nil, signingKey))
+	return archivePath
+}
+
+// rewriteEvidenceArchive copies an evidence archive, with the content of the
+// file named name replaced, or the file removed if content is nil.
+func rewriteEvidenceArchive(t *testing.T, archivePath, name string, content []byte) string {
+	in, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer in.Close()
+	gzipReader, err := gzip.NewReader(in)
+	require.NoError(t, err)
+	tarReader := tar.NewReader(gzipReader)
+	outPath := filepath.Join(t.TempDir(), "rewritten.tar.gz")
+	out, err := os.Create(outPath)
+	require.NoError(t, err)
+	defer out.Close()
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		if header.Name == name {
+			if content == nil {
+				continue
+			}
+			data = content
+		}
+		header.Size = int64(len(data))
+		require.NoError(t, tarWriter.WriteHeader(header))
+		_, err = tarWriter.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return outPath
+}
+
+func TestPolicyRecommendationInspect(t *testing.T) {
+	_, privateKeyPath, publicKeyPath := newTestEvidenceKey(t)
+	_, _, otherPublicKeyPath := newTestEvidenceKey(t)
+	archivePath := newTestEvidenceArchive(t, privateKeyPath)
+	policyFile := "policies/networkpolicy-default-recommend-allow-anp-nxvqg.yaml"
+	testCases := []struct {
+		name             string
+		archive          string
+		publicKey        string
+		file             string
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:      "Valid case",
+			archive:   archivePath,
+			publicKey: publicKeyPath,
+			expectedMsg: []string{
+				"Job:            " + nprName,
+				"Time range:     2023-05-01 10:00:00 to 2023-05-01 11:00:00",
+				"Data window:    2023-05-01 10:00:00 to 2023-05-01 10:59:00, 120 flow records from 1 Nodes",
+				"Flow records:   not included",
+				"Theia version:  v0.7.0",
+				"Signature:      verified",
+				"default        90             10             90.00%",
+				"metadata.json",
+				policyFile,
+			},
+		},
+		{
+			name:        "Without public key",
+			archive:     archivePath,
+			expectedMsg: []string{"Signature:      not verified, set --public-key to verify it"},
+		},
+		{
+			name:        "Print a file",
+			archive:     archivePath,
+			publicKey:   publicKeyPath,
+			file:        policyFile,
+			expectedMsg: []string{recommendedANP},
+		},
+		{
+			name:             "Unknown file",
+			archive:          archivePath,
+			file:             "flows.csv",
+			expectedErrorMsg: "has no file flows.csv",
+		},
+		{
+			name:             "Other public key",
+			archive:          archivePath,
+			publicKey:        otherPublicKeyPath,
+			expectedErrorMsg: "not by the given public key",
+		},
+		{
+			name:             "Modified file",
+			archive:          rewriteEvidenceArchive(t, archivePath, policyFile, []byte("kind: NetworkPolicy\n")),
+			expectedErrorMsg: "file " + policyFile + " does not match the manifest",
+		},
+		{
+			name:             "Removed file",
+			archive:          rewriteEvidenceArchive(t, archivePath, evidenceCoverageFile, nil),
+			expectedErrorMsg: "missing file coverage.csv",
+		},
+		{
+			name:             "Modified manifest",
+			archive:          rewriteEvidenceArchive(t, archivePath, evidenceManifestFile, []byte(`{"version": 1, "files": []}`)),
+			publicKey:        publicKeyPath,
+			expectedErrorMsg: "not by the given public key",
+		},
+		{
+			name:             "Removed signature",
+			archive:          rewriteEvidenceArchive(t, archivePath, evidenceSignatureFile, nil),
+			publicKey:        publicKeyPath,
+			expectedErrorMsg: "no MANIFEST.json.sig",
+		},
+		{
+			name:             "Missing archive",
+			archive:          filepath.Join(t.TempDir(), "missing.tar.gz"),
+			expectedErrorMsg: "error when opening evidence archive",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := new(cobra.Command)
+			cmd.Flags().String("public-key", tt.publicKey, "")
+			cmd.Flags().String("file", tt.file, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := policyRecommendationInspect(cmd, []string{tt.archive})
+			if tt.expectedErrorMsg == "" {
+				require.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
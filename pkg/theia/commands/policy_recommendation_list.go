@@ -15,67 +15,264 @@
 package commands
 
 import (
-	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 )
 
+const noTags = "<none>"
+
+var (
+	// timeNow is used to estimate the resource usage of running jobs.
+	timeNow = time.Now
+	// sparkMemoryUnitsGiB are the units of Spark memory amounts in GiB. Spark
+	// memory amounts use binary units, whichever the case of the suffix.
+	sparkMemoryUnitsGiB = map[byte]float64{'k': 1.0 / 1024 / 1024, 'm': 1.0 / 1024, 'g': 1, 't': 1024}
+)
+
 // policyRecommendationListCmd represents the policy-recommendation list command
 var policyRecommendationListCmd = &cobra.Command{
-	Use:     "list",
-	Short:   "List all policy recommendation jobs",
-	Long:    `List all policy recommendation jobs with name, creation time, completion time and status.`,
+	Use:   "list",
+	Short: "List all policy recommendation jobs",
+	Long: `List all policy recommendation jobs with name, creation time, completion time and status.
+With the wide output format, the submitter, the tags and the resource usage of
+each job are also listed, followed by the resource usage aggregated per tag.
+The resource usage is estimated in core-hours and GiB-hours from the resources
+requested by the driver and executor Pods of the job and its running time.
+The jobs can be filtered by tags or by a label selector, which is applied by
+the Theia Manager. Jobs are labeled with their tags and with
+theia.antrea.io/job-type=policy-reco.`,
 	Aliases: []string{"ls"},
 	Example: `
 List all policy recommendation jobs
 $ theia policy-recommendation list
+List all policy recommendation jobs with their tags and estimated resource usage
+$ theia policy-recommendation list -o wide
+List the policy recommendation jobs with tag team=netsec
+$ theia policy-recommendation list --tags team=netsec
+List the policy recommendation jobs whose env tag is not prod
+$ theia policy-recommendation list -l 'env!=prod'
 `,
 	RunE: policyRecommendationList,
 }
 
 func init() {
 	policyRecommendationCmd.AddCommand(policyRecommendationListCmd)
+	policyRecommendationListCmd.Flags().StringP(
+		"output",
+		"o",
+		"",
+		"Output format. One of: (wide).",
+	)
+	policyRecommendationListCmd.Flags().StringP(
+		"selector",
+		"l",
+		"",
+		"Label selector to filter the jobs on, e.g. -l 'team=netsec,env!=prod'.",
+	)
+	policyRecommendationListCmd.Flags().StringToString(
+		"tags",
+		nil,
+		"Tags which the jobs should have. Example: --tags team=netsec,env=prod",
+	)
+}
+
+// getJobSelector returns the label selector made of the --tags and --selector
+// flags of a command, or an empty string if neither is set.
+func getJobSelector(cmd *cobra.Command) (string, error) {
+	tags, err := cmd.Flags().GetStringToString("tags")
+	if err != nil {
+		return "", err
+	}
+	selector, err := cmd.Flags().GetString("selector")
+	if err != nil {
+		return "", err
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return "", fmt.Errorf("error when parsing label selector: %v", err)
+	}
+	if len(tags) > 0 {
+		tagsSelector, err := labels.ValidatedSelectorFromSet(tags)
+		if err != nil {
+			return "", fmt.Errorf("error when parsing tags: %v", err)
+		}
+		requirements, _ := tagsSelector.Requirements()
+		parsed = parsed.Add(requirements...)
+	}
+	return parsed.String(), nil
 }
 
 func policyRecommendationList(cmd *cobra.Command, args []string) error {
-	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	output, err := cmd.Flags().GetString("output")
 	if err != nil {
 		return err
 	}
-	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if output != "" && output != "wide" {
+		return fmt.Errorf("output format should be wide or unspecified")
+	}
+	wide := output == "wide"
+	selector, err := getJobSelector(cmd)
 	if err != nil {
-		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+		return err
+	}
+	theiaClient, pf, err := connectTheiaManager(cmd)
+	if err != nil {
+		return err
 	}
 	if pf != nil {
 		defer pf.Stop()
 	}
-	nprList := &intelligence.NetworkPolicyRecommendationList{}
-	err = theiaClient.Get().
-		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
-		Resource("networkpolicyrecommendations").
-		Do(context.TODO()).Into(nprList)
+	jobs, err := policyRecommendationJobs.list(theiaClient, selector)
 	if err != nil {
-		return fmt.Errorf("error when getting policy recommendation job list: %v", err)
+		return err
 	}
 
 	sparkApplicationTable := [][]string{
 		{"CreationTime", "CompletionTime", "Name", "Status"},
 	}
-	for _, npr := range nprList.Items {
+	if wide {
+		sparkApplicationTable[0] = append(sparkApplicationTable[0], "Submitter", "Tags", "CPU(core-hours)", "Memory(GiB-hours)")
+	}
+	tagUsages := make(map[string]*resourceUsage)
+	for _, job := range jobs {
+		npr := job.(*intelligence.NetworkPolicyRecommendation)
 		if npr.Status.SparkApplication == "" {
 			continue
 		}
-		sparkApplicationTable = append(sparkApplicationTable,
-			[]string{
-				FormatTimestamp(npr.Status.StartTime.Time),
-				FormatTimestamp(npr.Status.EndTime.Time),
-				npr.Name,
-				npr.Status.State,
-			})
+		row := []string{
+			FormatTimestamp(npr.Status.StartTime.Time),
+			FormatTimestamp(npr.Status.EndTime.Time),
+			npr.Name,
+			npr.Status.State,
+		}
+		if wide {
+			usage := estimateResourceUsage(npr)
+			tags := formatTags(npr.Tags)
+			submitter := npr.Submitter
+			if submitter == "" {
+				submitter = "N/A"
+			}
+			row = append(row, submitter, strings.Join(tags, ","), formatUsage(usage.coreHours), formatUsage(usage.memoryGiBHours))
+			for _, tag := range tags {
+				if tagUsages[tag] == nil {
+					tagUsages[tag] = &resourceUsage{}
+				}
+				tagUsages[tag].add(usage)
+			}
+		}
+		sparkApplicationTable = append(sparkApplicationTable, row)
 	}
 	TableOutput(sparkApplicationTable)
+	if wide && len(tagUsages) > 0 {
+		tagTable := [][]string{
+			{"Tag", "Jobs", "CPU(core-hours)", "Memory(GiB-hours)"},
+		}
+		tags := make([]string, 0, len(tagUsages))
+		for tag := range tagUsages {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			usage := tagUsages[tag]
+			tagTable = append(tagTable, []string{tag, strconv.Itoa(usage.jobs), formatUsage(usage.coreHours), formatUsage(usage.memoryGiBHours)})
+		}
+		fmt.Println()
+		TableOutput(tagTable)
+	}
 	return nil
 }
+
+// resourceUsage is the estimated resource usage of one or more jobs.
+type resourceUsage struct {
+	jobs           int
+	coreHours      float64
+	memoryGiBHours float64
+}
+
+func (u *resourceUsage) add(other resourceUsage) {
+	u.jobs += other.jobs
+	u.coreHours += other.coreHours
+	u.memoryGiBHours += other.memoryGiBHours
+}
+
+// estimateResourceUsage estimates the resource usage of a job from the
+// resources requested by its driver and executor Pods, and its running time.
+// The running time of jobs which are not finished is counted until now.
+// Requests which cannot be parsed are not counted.
+func estimateResourceUsage(npr *intelligence.NetworkPolicyRecommendation) resourceUsage {
+	usage := resourceUsage{jobs: 1}
+	if npr.Status.StartTime.IsZero() {
+		return usage
+	}
+	endTime := npr.Status.EndTime.Time
+	if endTime.IsZero() {
+		if npr.Status.State == crdv1alpha1.NPRecommendationStateCompleted || npr.Status.State == crdv1alpha1.NPRecommendationStateFailed {
+			return usage
+		}
+		endTime = timeNow()
+	}
+	hours := endTime.Sub(npr.Status.StartTime.Time).Hours()
+	if hours <= 0 {
+		return usage
+	}
+	executors := float64(npr.ExecutorInstances)
+	cores := parseCores(npr.DriverCoreRequest) + executors*parseCores(npr.ExecutorCoreRequest)
+	memory := parseSparkMemoryGiB(npr.DriverMemory) + executors*parseSparkMemoryGiB(npr.ExecutorMemory)
+	usage.coreHours = cores * hours
+	usage.memoryGiBHours = memory * hours
+	return usage
+}
+
+func parseCores(cores string) float64 {
+	quantity, err := resource.ParseQuantity(cores)
+	if err != nil {
+		return 0
+	}
+	return quantity.AsApproximateFloat64()
+}
+
+// parseSparkMemoryGiB parses a Spark memory amount, e.g. 512m or 2g, in GiB.
+func parseSparkMemoryGiB(memory string) float64 {
+	memory = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(memory)), "b")
+	// Amounts without unit are in MiB.
+	unit := sparkMemoryUnitsGiB['m']
+	if n := len(memory); n > 0 {
+		if suffixUnit, ok := sparkMemoryUnitsGiB[memory[n-1]]; ok {
+			unit = suffixUnit
+			memory = memory[:n-1]
+		}
+	}
+	value, err := strconv.ParseFloat(memory, 64)
+	if err != nil {
+		return 0
+	}
+	return value * unit
+}
+
+// formatTags returns the sorted key=value representations of the tags of a
+// job, or noTags if the job has no tags.
+func formatTags(tags map[string]string) []string {
+	if len(tags) == 0 {
+		return []string{noTags}
+	}
+	formatted := make([]string, 0, len(tags))
+	for key, value := range tags {
+		formatted = append(formatted, key+"="+value)
+	}
+	sort.Strings(formatted)
+	return formatted
+}
+
+func formatUsage(usage float64) string {
+	return strconv.FormatFloat(usage, 'f', 2, 64)
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
@@ -37,6 +38,9 @@ func TestPolicyRecommendationList(t *testing.T) {
 	testCases := []struct {
 		name             string
 		testServer       *httptest.Server
+		output           string
+		selector         string
+		tags             map[string]string
 		expectedMsg      []string
 		expectedErrorMsg string
 	}{
@@ -64,6 +68,103 @@ func TestPolicyRecommendationList(t *testing.T) {
 			expectedMsg:      []string{"pr-test1"},
 			expectedErrorMsg: "",
 		},
+		{
+			name: "Valid case with wide output",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations":
+					startTime := metav1.NewTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+					nprList := &intelligence.NetworkPolicyRecommendationList{
+						Items: []intelligence.NetworkPolicyRecommendation{
+							{
+								ObjectMeta:          metav1.ObjectMeta{Name: "pr-test1"},
+								ExecutorInstances:   2,
+								DriverCoreRequest:   "200m",
+								DriverMemory:        "512M",
+								ExecutorCoreRequest: "1",
+								ExecutorMemory:      "1g",
+								Submitter:           "alice",
+								Tags:                map[string]string{"team": "netsec", "env": "prod"},
+								Status: intelligence.NetworkPolicyRecommendationStatus{
+									SparkApplication: "test1",
+									State:            "COMPLETED",
+									StartTime:        startTime,
+									EndTime:          metav1.NewTime(startTime.Add(2 * time.Hour)),
+								},
+							},
+							{
+								ObjectMeta:          metav1.ObjectMeta{Name: "pr-test2"},
+								ExecutorInstances:   1,
+								DriverCoreRequest:   "1",
+								DriverMemory:        "1024m",
+								ExecutorCoreRequest: "1",
+								ExecutorMemory:      "1g",
+								Tags:                map[string]string{"team": "netsec"},
+								Status: intelligence.NetworkPolicyRecommendationStatus{
+									SparkApplication: "test2",
+									State:            "COMPLETED",
+									StartTime:        startTime,
+									EndTime:          metav1.NewTime(startTime.Add(30 * time.Minute)),
+								},
+							},
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(nprList)
+				}
+			})),
+			output: "wide",
+			expectedMsg: []string{
+				"Submitter", "Tags", "CPU(core-hours)", "Memory(GiB-hours)",
+				// pr-test1: (0.2 + 2 * 1) cores and (0.5 + 2 * 1) GiB for 2 hours.
+				"alice", "env=prod,team=netsec", "4.40", "5.00",
+				// Per tag aggregation, with pr-test2: 2 cores and 2 GiB for 0.5 hour.
+				"env=prod       1", "team=netsec    2", "5.40", "6.00",
+			},
+			expectedErrorMsg: "",
+		},
+		{
+			name: "Valid case with tags and selector",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations":
+					if r.URL.Query().Get("labelSelector") != "env!=prod,team=netsec" {
+						http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+						return
+					}
+					nprList := &intelligence.NetworkPolicyRecommendationList{
+						Items: []intelligence.NetworkPolicyRecommendation{
+							{
+								ObjectMeta: metav1.ObjectMeta{Name: "pr-test1"},
+								Tags:       map[string]string{"team": "netsec"},
+								Status: intelligence.NetworkPolicyRecommendationStatus{
+									SparkApplication: "test1",
+								}},
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(nprList)
+				}
+			})),
+			selector:    "env!=prod",
+			tags:        map[string]string{"team": "netsec"},
+			expectedMsg: []string{"pr-test1"},
+		},
+		{
+			name:             "Invalid selector",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			selector:         "team in netsec",
+			expectedErrorMsg: "error when parsing label selector",
+		},
+		{
+			name:             "Invalid output",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			output:           "json",
+			expectedMsg:      []string{},
+			expectedErrorMsg: "output format should be wide or unspecified",
+		},
 		{
 			name: "NetworkPolicyRecommendationList not found",
 			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -109,6 +210,9 @@ func TestPolicyRecommendationList(t *testing.T) {
 			cmd := new(cobra.Command)
 			if tt.name != "Unspecified use-cluster-ip" {
 				cmd.Flags().Bool("use-cluster-ip", true, "")
+				cmd.Flags().String("output", tt.output, "")
+				cmd.Flags().String("selector", tt.selector, "")
+				cmd.Flags().StringToString("tags", tt.tags, "")
 			}
 
 			orig := os.Stdout
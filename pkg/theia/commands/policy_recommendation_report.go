@@ -0,0 +1,189 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/util"
+)
+
+// policyRecommendationReportCmd represents the policy-recommendation report command
+var policyRecommendationReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Get the quality report of a policy recommendation job",
+	Long: `Get the quality report of a completed policy recommendation job by name
+or by id. The report gives, for every Namespace, the number of unprotected flow
+records of the time range of the job which are matched and not matched by the
+recommended policies. The flows are counted in the Namespace of their source
+Pod, or of their destination Pod if the source is not a Pod.
+A low coverage means that the recommended policies would deny part of the
+traffic of the time range, e.g. because of the limit on the number of flow
+records read by the job. It also hints that the time range may be too short to
+observe the traffic which happens less often, in which case the policies
+should be recommended again over a longer time range.
+The report also gives the data window actually analyzed by the job: the times
+of its first and last flow records, their number and the Nodes they were
+exported from, along with caveats on the confidence in the recommended
+policies, e.g. when Nodes of the cluster exported no flow record.`,
+	Args: cobra.RangeArgs(0, 1),
+	Example: `
+Get the quality report of the job with name pr-e998433e-accb-4888-9fc8-06563f073e86
+$ theia policy-recommendation report --name pr-e998433e-accb-4888-9fc8-06563f073e86
+Or
+$ theia policy-recommendation report --id e998433e-accb-4888-9fc8-06563f073e86
+Or
+$ theia policy-recommendation report pr-e998433e-accb-4888-9fc8-06563f073e86
+`,
+	RunE: policyRecommendationReport,
+}
+
+func init() {
+	policyRecommendationCmd.AddCommand(policyRecommendationReportCmd)
+	policyRecommendationReportCmd.Flags().StringP(
+		"name",
+		"",
+		"",
+		"Name of the policy recommendation job.",
+	)
+	policyRecommendationReportCmd.Flags().String(
+		"id",
+		"",
+		"ID of the policy recommendation job, which is its name without the pr- prefix.",
+	)
+	policyRecommendationReportCmd.RegisterFlagCompletionFunc("name", completeJobNames(policyRecommendationResource))
+	policyRecommendationReportCmd.ValidArgsFunction = completeJobNameArg(policyRecommendationResource)
+}
+
+func policyRecommendationReport(cmd *cobra.Command, args []string) error {
+	prName, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	if prID, _ := cmd.Flags().GetString("id"); prName == "" && prID != "" {
+		prName = "pr-" + prID
+	}
+	if prName == "" && len(args) == 1 {
+		prName = args[0]
+	}
+	err = util.ParseRecommendationName(prName)
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	npr, err := getPolicyRecommendationReport(theiaClient, prName)
+	if err != nil {
+		return fmt.Errorf("error when getting policy recommendation job by job name: %v", err)
+	}
+	if npr.Status.State != crdv1alpha1.NPRecommendationStateCompleted {
+		return fmt.Errorf("policy recommendation job %s is %s, the report is only available once it is COMPLETED", prName, npr.Status.State)
+	}
+	if npr.Status.ErrorMsg != "" {
+		return fmt.Errorf("error when getting recommendation report: %s", npr.Status.ErrorMsg)
+	}
+	if len(npr.Status.Coverage) == 0 {
+		fmt.Printf("No coverage statistics for policy recommendation job %s, it may have been run by a version of Theia which did not compute them\n", prName)
+	} else {
+		result := [][]string{{"Namespace", "MatchedFlows", "UnmatchedFlows", "Coverage"}}
+		var totalMatched, totalUnmatched int64
+		for _, coverage := range npr.Status.Coverage {
+			result = append(result, []string{coverage.Namespace, strconv.FormatInt(coverage.MatchedFlows, 10), strconv.FormatInt(coverage.UnmatchedFlows, 10), formatCoverage(coverage.MatchedFlows, coverage.UnmatchedFlows)})
+			totalMatched += coverage.MatchedFlows
+			totalUnmatched += coverage.UnmatchedFlows
+		}
+		result = append(result, []string{"Total", strconv.FormatInt(totalMatched, 10), strconv.FormatInt(totalUnmatched, 10), formatCoverage(totalMatched, totalUnmatched)})
+		TableOutput(result)
+	}
+	dataWindow := npr.Status.DataWindow
+	if dataWindow == nil {
+		fmt.Printf("No data window for policy recommendation job %s, it may have been run by a version of Theia which did not record it\n", prName)
+		return nil
+	}
+	caveats := append(append([]string{}, dataWindow.Caveats...), getClusterCaveats(cmd, dataWindow)...)
+	fmt.Println()
+	if dataWindow.Flows > 0 {
+		fmt.Printf("Data window:  %s to %s\n", FormatTimestamp(dataWindow.MinFlowTime.Time), FormatTimestamp(dataWindow.MaxFlowTime.Time))
+	}
+	fmt.Printf("Flow records: %d\n", dataWindow.Flows)
+	fmt.Printf("Nodes:        %d", len(dataWindow.Nodes))
+	if len(dataWindow.Nodes) > 0 {
+		fmt.Printf(" (%s)", strings.Join(dataWindow.Nodes, ", "))
+	}
+	fmt.Println()
+	if len(caveats) > 0 {
+		fmt.Println("Caveats:")
+		for _, caveat := range caveats {
+			fmt.Printf("  - %s\n", caveat)
+		}
+	}
+	return nil
+}
+
+// getClusterCaveats returns the caveats on the data window of a job which
+// depend on the current state of the cluster: the Nodes which exported no
+// flow record during the window. A caveat is returned instead if they cannot
+// be checked.
+func getClusterCaveats(cmd *cobra.Command, dataWindow *intelligence.NetworkPolicyRecommendationDataWindow) []string {
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return []string{fmt.Sprintf("Couldn't check the Nodes: couldn't resolve kubeconfig: %v", err)}
+	}
+	k8sClient, err := CreateK8sClient(kubeconfig)
+	if err != nil {
+		return []string{fmt.Sprintf("Couldn't check the Nodes: couldn't create k8s client using given kubeconfig, %v", err)}
+	}
+	nodes, err := k8sClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return []string{fmt.Sprintf("Couldn't check the Nodes: error when listing Nodes: %v", err)}
+	}
+	coveredNodes := sets.New[string](dataWindow.Nodes...)
+	var missingNodes []string
+	for _, node := range nodes.Items {
+		if !coveredNodes.Has(node.Name) {
+			missingNodes = append(missingNodes, node.Name)
+		}
+	}
+	if len(missingNodes) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%d of the %d Nodes of the cluster exported no flow record in the data window (%s), their traffic may be denied by the recommended policies", len(missingNodes), len(nodes.Items), strings.Join(missingNodes, ", "))}
+}
+
+// formatCoverage returns the percentage of the matched flows.
+func formatCoverage(matched, unmatched int64) string {
+	if matched+unmatched == 0 {
+		return "N/A"
+	}
+	return fmt.Sprintf("%.2f%%", float64(matched)*100/float64(matched+unmatched))
+}
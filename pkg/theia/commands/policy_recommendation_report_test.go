@@ -0,0 +1,218 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestPolicyRecommendationReport(t *testing.T) {
+	reportServer := func(status intelligence.NetworkPolicyRecommendationStatus) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+				if r.URL.Query().Get("report") != "true" {
+					http.Error(w, "report not requested", http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(&intelligence.NetworkPolicyRecommendation{Status: status})
+			}
+		}))
+	}
+	completedStatus := intelligence.NetworkPolicyRecommendationStatus{
+		State: crdv1alpha1.NPRecommendationStateCompleted,
+		Coverage: []intelligence.NetworkPolicyRecommendationCoverage{
+			{Namespace: "default", MatchedFlows: 90, UnmatchedFlows: 10},
+			{Namespace: "kube-system", MatchedFlows: 50},
+		},
+	}
+	dataWindowStatus := intelligence.NetworkPolicyRecommendationStatus{
+		State: crdv1alpha1.NPRecommendationStateCompleted,
+		DataWindow: &intelligence.NetworkPolicyRecommendationDataWindow{
+			MinFlowTime: metav1.NewTime(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)),
+			MaxFlowTime: metav1.NewTime(time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC)),
+			Flows:       120,
+			Nodes:       []string{"node-1", "node-2"},
+			Caveats:     []string{"The job read at most 100 distinct flows"},
+		},
+	}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		flags            map[string]string
+		args             []string
+		objects          []runtime.Object
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			testServer: reportServer(completedStatus),
+			flags:      map[string]string{"name": nprName},
+			expectedMsg: []string{
+				"Namespace      MatchedFlows   UnmatchedFlows Coverage",
+				"default        90             10             90.00%",
+				"kube-system    50             0              100.00%",
+				"Total          140            10             93.33%",
+			},
+		},
+		{
+			name:        "Valid case with id",
+			testServer:  reportServer(completedStatus),
+			flags:       map[string]string{"id": strings.TrimPrefix(nprName, "pr-")},
+			expectedMsg: []string{"Total          140            10             93.33%"},
+		},
+		{
+			name:        "Valid case with args",
+			testServer:  reportServer(completedStatus),
+			args:        []string{nprName},
+			expectedMsg: []string{"Total          140            10             93.33%"},
+		},
+		{
+			name:        "No coverage",
+			testServer:  reportServer(intelligence.NetworkPolicyRecommendationStatus{State: crdv1alpha1.NPRecommendationStateCompleted}),
+			flags:       map[string]string{"name": nprName},
+			expectedMsg: []string{fmt.Sprintf("No coverage statistics for policy recommendation job %s", nprName)},
+		},
+		{
+			name:       "Data window",
+			testServer: reportServer(dataWindowStatus),
+			flags:      map[string]string{"name": nprName},
+			objects:    []runtime.Object{newTestNode("node-1"), newTestNode("node-2")},
+			expectedMsg: []string{
+				"Data window:  2023-05-01 10:00:00 to 2023-05-01 11:00:00",
+				"Flow records: 120",
+				"Nodes:        2 (node-1, node-2)",
+				"Caveats:\n  - The job read at most 100 distinct flows\n",
+			},
+		},
+		{
+			name:        "Data window with missing Nodes",
+			testServer:  reportServer(dataWindowStatus),
+			flags:       map[string]string{"name": nprName},
+			objects:     []runtime.Object{newTestNode("node-1"), newTestNode("node-2"), newTestNode("node-3")},
+			expectedMsg: []string{"  - 1 of the 3 Nodes of the cluster exported no flow record in the data window (node-3)"},
+		},
+		{
+			name:        "No data window",
+			testServer:  reportServer(completedStatus),
+			flags:       map[string]string{"name": nprName},
+			expectedMsg: []string{fmt.Sprintf("No data window for policy recommendation job %s", nprName)},
+		},
+		{
+			name:             "Job not completed",
+			testServer:       reportServer(intelligence.NetworkPolicyRecommendationStatus{State: crdv1alpha1.NPRecommendationStateRunning}),
+			flags:            map[string]string{"name": nprName},
+			expectedErrorMsg: fmt.Sprintf("policy recommendation job %s is RUNNING, the report is only available once it is COMPLETED", nprName),
+		},
+		{
+			name: "Coverage error",
+			testServer: reportServer(intelligence.NetworkPolicyRecommendationStatus{
+				State:    crdv1alpha1.NPRecommendationStateCompleted,
+				ErrorMsg: "Failed to get the coverage",
+			}),
+			flags:            map[string]string{"name": nprName},
+			expectedErrorMsg: "error when getting recommendation report: Failed to get the coverage",
+		},
+		{
+			name: "NetworkPolicyRecommendation not found",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			})),
+			flags:            map[string]string{"name": nprName},
+			expectedErrorMsg: "error when getting policy recommendation job",
+		},
+		{
+			name:             "Invalid nprName",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			flags:            map[string]string{"name": "mock_nprName"},
+			expectedErrorMsg: "not a valid policy recommendation job name",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			flags:            map[string]string{"name": nprName},
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			oldCreateFunc := CreateK8sClient
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tt.objects...), nil
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+				CreateK8sClient = oldCreateFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("name", tt.flags["name"], "")
+			cmd.Flags().String("id", tt.flags["id"], "")
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := policyRecommendationReport(cmd, tt.args)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -15,20 +15,44 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
+	restclient "k8s.io/client-go/rest"
 
-	"antrea.io/theia/pkg/util"
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 )
 
+const defaultRecommendationPageSize = 500
+
 // policyRecommendationRetrieveCmd represents the policy-recommendation retrieve command
 var policyRecommendationRetrieveCmd = &cobra.Command{
 	Use:   "retrieve",
 	Short: "Get the recommendation result of a policy recommendation job",
 	Long: `Get the recommendation result of a policy recommendation job by name.
-It will return the recommended NetworkPolicies described in yaml.`,
+It will return the recommended NetworkPolicies described in yaml.
+The name latest refers to the job with the most recently created Spark
+application.
+The result is retrieved in pages of --page-size policies and streamed to the
+output, so that large results do not need to be held in memory at once. Pages
+are written as soon as they are received, separated by yaml document
+separators, so that the output can be piped to "kubectl apply -f -". The
+command fails if the result could not be retrieved completely.
+The result can be restricted to the policies applied to a Namespace with
+--namespace, to some kinds of policies with --kind, and to the policies applied
+to the Pods selected by a label selector with --applied-to. The ClusterGroups
+are kept along with the selected ACNPs which refer to them, and dropped
+otherwise.
+With --output-dir, every recommended policy is written to its own file named
+<kind>_<namespace>_<name>.yaml, or <kind>_<name>.yaml for the cluster-scoped
+policies, so that the policies can be reviewed and applied one by one. The
+other files of the directory are kept.`,
 	Args: cobra.RangeArgs(0, 1),
 	Example: `
 Get the recommendation result with job name pr-e998433e-accb-4888-9fc8-06563f073e86
@@ -38,7 +62,17 @@ $ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86
 Use Service ClusterIP when getting the result
 $ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86 --use-cluster-ip
 Save the recommendation result to file
-$ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86 --use-cluster-ip --file output.yaml
+$ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86 --use-cluster-ip --output-file output.yaml
+Save every recommended policy to its own file in directory policies
+$ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86 --output-dir policies
+Retrieve the recommendation result in pages of 100 policies
+$ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86 --page-size 100
+Get the recommended ANPs and ACNPs applied to the Pods with label app=nginx in Namespace default
+$ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86 --namespace default --kind ANP,ACNP --applied-to app=nginx
+Get the recommendation result of the most recently created job
+$ theia policy-recommendation retrieve latest
+Apply the recommended policies to the cluster
+$ theia policy-recommendation retrieve pr-e998433e-accb-4888-9fc8-06563f073e86 | kubectl apply -f -
 `,
 	RunE: policyRecommendationRetrieve,
 }
@@ -49,14 +83,48 @@ func init() {
 		"name",
 		"",
 		"",
-		"Name of the policy recommendation job.",
+		"Name of the policy recommendation job, or latest for the most recently created one.",
 	)
+	policyRecommendationRetrieveCmd.RegisterFlagCompletionFunc("name", completeJobNames(policyRecommendationResource))
+	policyRecommendationRetrieveCmd.ValidArgsFunction = completeJobNameArg(policyRecommendationResource)
 	policyRecommendationRetrieveCmd.Flags().StringP(
-		"file",
+		"output-file",
 		"f",
 		"",
 		"The file path where you want to save the result.",
 	)
+	policyRecommendationRetrieveCmd.Flags().String(
+		"file",
+		"",
+		"The file path where you want to save the result.",
+	)
+	policyRecommendationRetrieveCmd.Flags().MarkDeprecated("file", "use --output-file instead")
+	policyRecommendationRetrieveCmd.Flags().String(
+		"output-dir",
+		"",
+		"The directory where you want to save every recommended policy to its own file.",
+	)
+	policyRecommendationRetrieveCmd.MarkFlagsMutuallyExclusive("output-file", "output-dir")
+	policyRecommendationRetrieveCmd.Flags().Int64(
+		"page-size",
+		defaultRecommendationPageSize,
+		"The number of recommended policies retrieved per request. Set to 0 to use the maximum page size of the Theia Manager, which also caps larger values.",
+	)
+	policyRecommendationRetrieveCmd.Flags().String(
+		"namespace",
+		"",
+		"Only get the recommended policies applied to this Namespace.",
+	)
+	policyRecommendationRetrieveCmd.Flags().String(
+		"kind",
+		"",
+		fmt.Sprintf("Only get the recommended policies of these kinds, as a comma-separated list of %s.", strings.Join(validPolicyKinds, ", ")),
+	)
+	policyRecommendationRetrieveCmd.Flags().String(
+		"applied-to",
+		"",
+		"Only get the recommended policies applied to the Pods selected by this label selector, e.g. app=nginx.",
+	)
 }
 
 func policyRecommendationRetrieve(cmd *cobra.Command, args []string) error {
@@ -67,11 +135,47 @@ func policyRecommendationRetrieve(cmd *cobra.Command, args []string) error {
 	if prName == "" && len(args) == 1 {
 		prName = args[0]
 	}
-	err = util.ParseRecommendationName(prName)
+	err = policyRecommendationJobs.validateName(prName)
+	if err != nil {
+		return err
+	}
+	filePath, err := getPathFlag(cmd, "output-file")
+	if err != nil {
+		return err
+	}
+	// Keep supporting the deprecated --file flag.
+	if deprecatedFlag := cmd.Flags().Lookup("file"); filePath == "" && deprecatedFlag != nil {
+		if filePath, err = expandHome(deprecatedFlag.Value.String()); err != nil {
+			return err
+		}
+	}
+	outputDir, err := getPathFlag(cmd, "output-dir")
+	if err != nil {
+		return err
+	}
+	if outputDir != "" && filePath != "" {
+		return fmt.Errorf("only one of output-file and output-dir can be set")
+	}
+	pageSize, err := cmd.Flags().GetInt64("page-size")
+	if err != nil {
+		return err
+	}
+	if pageSize < 0 {
+		return fmt.Errorf("page-size should not be negative")
+	}
+	namespace, err := cmd.Flags().GetString("namespace")
+	if err != nil {
+		return err
+	}
+	kinds, err := cmd.Flags().GetString("kind")
+	if err != nil {
+		return err
+	}
+	appliedTo, err := cmd.Flags().GetString("applied-to")
 	if err != nil {
 		return err
 	}
-	filePath, err := cmd.Flags().GetString("file")
+	filter, err := newRecommendationFilter(namespace, kinds, appliedTo)
 	if err != nil {
 		return err
 	}
@@ -86,18 +190,124 @@ func policyRecommendationRetrieve(cmd *cobra.Command, args []string) error {
 	if pf != nil {
 		defer pf.Stop()
 	}
-	npr, err := getPolicyRecommendationByName(theiaClient, prName)
+	prName, err = policyRecommendationJobs.resolveName(theiaClient, prName)
 	if err != nil {
-		return fmt.Errorf("error when getting policy recommendation job by job name: %v", err)
+		return err
+	}
+	if outputDir != "" {
+		return writePolicyRecommendationFiles(theiaClient, prName, pageSize, filter, outputDir)
+	}
+	return writePolicyRecommendationResult(theiaClient, prName, pageSize, filter, filePath)
+}
+
+// writePolicyRecommendationResult retrieves the result of a policy
+// recommendation job in pages of pageSize policies, and writes the policies of
+// every page selected by filter as soon as it is received to the file at
+// filePath, or to stdout if filePath is empty. An error is returned if the
+// result could not be retrieved completely.
+func writePolicyRecommendationResult(theiaClient restclient.Interface, prName string, pageSize int64, filter *recommendationFilter, filePath string) error {
+	if filePath == "" {
+		return streamPolicyRecommendationResult(theiaClient, prName, pageSize, filter, os.Stdout)
+	}
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error when writing recommendation result to file: %v", err)
+	}
+	defer file.Close()
+	return streamPolicyRecommendationResult(theiaClient, prName, pageSize, filter, file)
+}
+
+// writePolicyRecommendationFiles retrieves the result of a policy
+// recommendation job, and writes every policy selected by filter to its own
+// file in dir, which is created if it does not exist. The files of previous
+// results with the same names are overwritten.
+func writePolicyRecommendationFiles(theiaClient restclient.Interface, prName string, pageSize int64, filter *recommendationFilter, dir string) error {
+	var result bytes.Buffer
+	if err := streamPolicyRecommendationResult(theiaClient, prName, pageSize, filter, &result); err != nil {
+		return err
+	}
+	files, err := splitRecommendedPoliciesWithSeparator(result.String(), "_")
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Printf("No recommended policies of job %s to save\n", prName)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error when creating directory %s: %v", dir, err)
+	}
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
 	}
-	if filePath != "" {
-		if err := os.WriteFile(filePath, []byte(npr.Status.RecommendationOutcome), 0600); err != nil {
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		if err := os.WriteFile(filepath.Join(dir, fileName), []byte(files[fileName]), 0600); err != nil {
 			return fmt.Errorf("error when writing recommendation result to file: %v", err)
 		}
+	}
+	fmt.Printf("Saved %d recommended policies of job %s to %s\n", len(files), prName, dir)
+	return nil
+}
+
+// streamPolicyRecommendationResult retrieves the result of a policy
+// recommendation job in pages of pageSize policies, and writes the policies of
+// every page selected by filter, or all of them if filter is nil, to out as
+// soon as it is received. Nothing is written if the job recommended no policy.
+func streamPolicyRecommendationResult(theiaClient restclient.Interface, prName string, pageSize int64, filter *recommendationFilter, out io.Writer) error {
+	npr, err := getPolicyRecommendationPage(theiaClient, prName, pageSize, "")
+	if err != nil {
+		return fmt.Errorf("error when getting policy recommendation job by job name: %v", err)
+	}
+	if npr.Status.State == crdv1alpha1.NPRecommendationStateCompleted && npr.Status.ErrorMsg != "" {
+		return fmt.Errorf("error when getting recommendation result: %s", npr.Status.ErrorMsg)
+	}
+	// A job which recommended no policy is not an error. The explanation is
+	// printed to stderr, so that out still holds a valid, empty, yaml stream.
+	if npr.Status.EmptyResultReason != "" {
+		fmt.Fprintf(os.Stderr, "Policy recommendation job %s completed without recommending any policy: %s\n", prName, npr.Status.EmptyResultReason)
 		return nil
 	}
-	if npr.Status.RecommendationOutcome != "" {
-		fmt.Print(npr.Status.RecommendationOutcome)
+	written := false
+	for pages := 1; ; pages++ {
+		outcome, err := filter.filterOutcome(npr.Status.RecommendationOutcome)
+		if err != nil {
+			return err
+		}
+		if outcome != "" {
+			if err := writeRecommendationOutcome(out, outcome, written); err != nil {
+				return fmt.Errorf("error when writing recommendation result: %v", err)
+			}
+			written = true
+		}
+		if npr.Status.Continue == "" {
+			return nil
+		}
+		continueToken := npr.Status.Continue
+		npr, err = getPolicyRecommendationPage(theiaClient, prName, pageSize, continueToken)
+		if err != nil {
+			return fmt.Errorf("recommendation result is truncated after %d page(s): %v", pages, err)
+		}
+		// A page which is expected to exist but has no policies means that the
+		// result could not be read from the database.
+		if npr.Status.ErrorMsg != "" || npr.Status.RecommendationOutcome == "" {
+			return fmt.Errorf("recommendation result is truncated after %d page(s): failed to get the page with continue token %q: %s", pages, continueToken, npr.Status.ErrorMsg)
+		}
+	}
+}
+
+// writeRecommendationOutcome writes a page of recommended policies, separated
+// from the previous page by a yaml document separator. Every page is written
+// with a single call and ends with a newline, so that a consumer reading the
+// output as a stream only sees complete yaml documents.
+func writeRecommendationOutcome(out io.Writer, outcome string, separate bool) error {
+	if separate {
+		outcome = "---\n" + outcome
 	}
-	return nil
+	if !strings.HasSuffix(outcome, "\n") {
+		outcome += "\n"
+	}
+	_, err := io.WriteString(out, outcome)
+	return err
 }
@@ -23,23 +23,30 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 
+	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 	"antrea.io/theia/pkg/theia/portforwarder"
 )
 
 func TestPolicyRecommendationRetrieve(t *testing.T) {
+	// The Theia Manager rejects the request for the second page once because
+	// of overload, which the client retries after the Retry-After delay.
+	overloaded := false
 	testCases := []struct {
 		name             string
 		testServer       *httptest.Server
 		expectedMsg      []string
+		expectedStderr   string
 		expectedErrorMsg string
 		nprName          string
 		filePath         string
@@ -63,6 +70,110 @@ func TestPolicyRecommendationRetrieve(t *testing.T) {
 			expectedMsg:      []string{"testOutcome"},
 			expectedErrorMsg: "",
 		},
+		{
+			name: "Valid case with pagination",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+					npr := &intelligence.NetworkPolicyRecommendation{}
+					if r.URL.Query().Get("continue") == "" {
+						npr.Status.RecommendationOutcome = "testOutcome1\n"
+						npr.Status.Continue = "1"
+					} else {
+						npr.Status.RecommendationOutcome = "testOutcome2\n"
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(npr)
+				}
+			})),
+			nprName:          nprName,
+			expectedMsg:      []string{"testOutcome1\n---\ntestOutcome2\n"},
+			expectedErrorMsg: "",
+		},
+		{
+			name: "Valid case with pagination and overload",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+					npr := &intelligence.NetworkPolicyRecommendation{}
+					if r.URL.Query().Get("continue") == "" {
+						npr.Status.RecommendationOutcome = "testOutcome1\n"
+						npr.Status.Continue = "1"
+					} else if !overloaded {
+						overloaded = true
+						w.Header().Set("Retry-After", "1")
+						http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+						return
+					} else {
+						npr.Status.RecommendationOutcome = "testOutcome2\n"
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(npr)
+				}
+			})),
+			nprName:          nprName,
+			expectedMsg:      []string{"testOutcome1\n---\ntestOutcome2\n"},
+			expectedErrorMsg: "",
+		},
+		{
+			name: "Truncated result",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+					npr := &intelligence.NetworkPolicyRecommendation{}
+					npr.Status.State = crdv1alpha1.NPRecommendationStateCompleted
+					if r.URL.Query().Get("continue") == "" {
+						npr.Status.RecommendationOutcome = "testOutcome1\n"
+						npr.Status.Continue = "1"
+					} else {
+						npr.Status.ErrorMsg = "mock_error"
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(npr)
+				}
+			})),
+			nprName:          nprName,
+			expectedMsg:      []string{},
+			expectedErrorMsg: "recommendation result is truncated after 1 page(s): failed to get the page with continue token \"1\": mock_error",
+		},
+		{
+			name: "Failed to get result of completed job",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+					npr := &intelligence.NetworkPolicyRecommendation{}
+					npr.Status.State = crdv1alpha1.NPRecommendationStateCompleted
+					npr.Status.ErrorMsg = "mock_error"
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(npr)
+				}
+			})),
+			nprName:          nprName,
+			expectedMsg:      []string{},
+			expectedErrorMsg: "error when getting recommendation result: mock_error",
+		},
+		{
+			name: "Completed job without recommended policy",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+					npr := &intelligence.NetworkPolicyRecommendation{}
+					npr.Status.State = crdv1alpha1.NPRecommendationStateCompleted
+					npr.Status.EmptyResultReason = "No flow record was found in the time range of the job"
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(npr)
+				}
+			})),
+			nprName:          nprName,
+			expectedMsg:      []string{},
+			expectedStderr:   fmt.Sprintf("Policy recommendation job %s completed without recommending any policy: No flow record was found in the time range of the job\n", nprName),
+			expectedErrorMsg: "",
+		},
 		{
 			name: "Valid case with filePath",
 			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -81,7 +192,7 @@ func TestPolicyRecommendationRetrieve(t *testing.T) {
 			nprName:          nprName,
 			expectedMsg:      []string{"testOutcome"},
 			expectedErrorMsg: "",
-			filePath:         "/tmp/testResult",
+			filePath:         filepath.Join(t.TempDir(), "testResult"),
 		},
 		{
 			name: "NetworkPolicyRecommendation not found",
@@ -152,23 +263,35 @@ func TestPolicyRecommendationRetrieve(t *testing.T) {
 			cmd := new(cobra.Command)
 			switch tt.name {
 			case "Unspecified name":
-				cmd.Flags().String("file", tt.filePath, "")
+				cmd.Flags().String("output-file", tt.filePath, "")
 			case "Unspecified file":
 				cmd.Flags().String("name", tt.nprName, "")
 			case "Unspecified use-cluster-ip":
 				cmd.Flags().String("name", tt.nprName, "")
-				cmd.Flags().String("file", tt.filePath, "")
+				cmd.Flags().String("output-file", tt.filePath, "")
+				cmd.Flags().String("output-dir", "", "")
+				cmd.Flags().Int64("page-size", 1, "")
+				cmd.Flags().String("namespace", "", "")
+				cmd.Flags().String("kind", "", "")
+				cmd.Flags().String("applied-to", "", "")
 			default:
 				cmd.Flags().String("name", tt.nprName, "")
-				cmd.Flags().String("file", tt.filePath, "")
+				cmd.Flags().String("output-file", tt.filePath, "")
+				cmd.Flags().String("output-dir", "", "")
+				cmd.Flags().Int64("page-size", 1, "")
+				cmd.Flags().String("namespace", "", "")
+				cmd.Flags().String("kind", "", "")
+				cmd.Flags().String("applied-to", "", "")
 				cmd.Flags().Bool("use-cluster-ip", true, "")
 			}
 
-			orig := os.Stdout
+			orig, origStderr := os.Stdout, os.Stderr
 			r, w, _ := os.Pipe()
-			os.Stdout = w
-			defer func() { os.Stdout = orig }()
+			stderrReader, stderrWriter, _ := os.Pipe()
+			os.Stdout, os.Stderr = w, stderrWriter
+			defer func() { os.Stdout, os.Stderr = orig, origStderr }()
 			err := policyRecommendationRetrieve(cmd, []string{})
+			assert.Equal(t, tt.expectedStderr, readStdout(t, stderrReader, stderrWriter))
 			if tt.expectedErrorMsg == "" {
 				if tt.filePath != "" {
 					result, err := os.ReadFile(tt.filePath)
@@ -192,6 +315,47 @@ func TestPolicyRecommendationRetrieve(t *testing.T) {
 	}
 }
 
+func TestWritePolicyRecommendationFiles(t *testing.T) {
+	nprName := "pr-e292395c-3de1-11ed-b878-0242ac120002"
+	theiaClient := newTestRecommendationClient(t, nprName)
+	dir := filepath.Join(t.TempDir(), "policies")
+
+	orig := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	err := writePolicyRecommendationFiles(theiaClient, nprName, 1, nil, dir)
+	assert.Equal(t, fmt.Sprintf("Saved 2 recommended policies of job %s to %s\n", nprName, dir), readStdout(t, r, w))
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var fileNames []string
+	for _, entry := range entries {
+		fileNames = append(fileNames, entry.Name())
+	}
+	assert.Equal(t, []string{
+		"clusternetworkpolicy_recommend-reject-all-acnp.yaml",
+		"networkpolicy_default_recommend-allow-anp-nxvqg.yaml",
+	}, fileNames)
+	content, err := os.ReadFile(filepath.Join(dir, "networkpolicy_default_recommend-allow-anp-nxvqg.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, recommendedANP, string(content))
+
+	// The filter applies to the saved policies.
+	filter, err := newRecommendationFilter("", policyKindANP, "")
+	require.NoError(t, err)
+	dir = filepath.Join(t.TempDir(), "anps")
+	r, w, _ = os.Pipe()
+	os.Stdout = w
+	err = writePolicyRecommendationFiles(theiaClient, nprName, 1, filter, dir)
+	readStdout(t, r, w)
+	require.NoError(t, err)
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "networkpolicy_default_recommend-allow-anp-nxvqg.yaml", entries[0].Name())
+}
+
 func readStdout(t *testing.T, r *os.File, w *os.File) string {
 	var buf bytes.Buffer
 	exit := make(chan bool)
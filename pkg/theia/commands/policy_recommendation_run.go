@@ -19,20 +19,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
 
 	crdv1alpha1 "antrea.io/theia/pkg/apis/crd/v1alpha1"
 	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 	"antrea.io/theia/pkg/theia/commands/config"
+	"antrea.io/theia/pkg/util"
 )
 
+// policyRecommendationNameSpace prefixes the names given by the users, from
+// which the UUIDs of the jobs are derived.
+const policyRecommendationNameSpace = "theia.antrea.io/networkpolicyrecommendations/"
+
 // policyRecommendationRunCmd represents the policy recommendation run command
 var policyRecommendationRunCmd = &cobra.Command{
 	Use:   "run",
@@ -47,11 +62,37 @@ Run an initial policy recommendation job with policy type anp-deny-applied and l
 $ theia policy-recommendation run --type initial --policy-type anp-deny-applied --start-time '2022-01-01 00:00:00' --end-time '2022-01-31 23:59:59'
 Run a policy recommendation job with default configuration but doesn't recommend toServices ANPs
 $ theia policy-recommendation run --to-services=false
+Run a policy recommendation job allowing the traffic inside the system Namespaces discovered in the cluster
+$ theia policy-recommendation run --auto-allow-system-ns
+Run a policy recommendation job with its cost attributed to the netsec team
+$ theia policy-recommendation run --tags team=netsec
+Run a policy recommendation job, wait for it to complete and apply its result
+$ theia policy-recommendation run --wait | kubectl apply -f -
+Run a policy recommendation job, then apply the policies recommended for the default Namespace in log mode
+for 2 hours and enforce them if no flow would have been denied
+$ theia policy-recommendation run --canary-namespace default --canary-soak-window 2h
+Run a policy recommendation job for the Deployment foo in Namespace ns only, and wait for its policies
+$ theia policy-recommendation run --workload deployment/foo --namespace ns --wait
+Run a policy recommendation job on the flow records since 2022-01-24 00:00:00, aggregated in ClickHouse beforehand
+$ theia policy-recommendation run --start-time '2022-01-24 00:00:00' --preaggregate
+Run a policy recommendation job with the options of a job file, overriding its limit
+$ theia policy-recommendation run -f job.yaml --limit 10000
+Run a policy recommendation job at most once for the nightly run of a pipeline, even if it is retried
+$ theia policy-recommendation run --name nightly-2022-01-24
 `,
 	RunE: policyRecommendationRun,
 }
 
 func policyRecommendationRun(cmd *cobra.Command, args []string) error {
+	jobFile, err := getPathFlag(cmd, "filename")
+	if err != nil {
+		return err
+	}
+	if jobFile != "" {
+		if err := applyJobFile(cmd, jobFile); err != nil {
+			return err
+		}
+	}
 	networkPolicyRecommendation := intelligence.NetworkPolicyRecommendation{}
 	recoType, err := cmd.Flags().GetString("type")
 	if err != nil {
@@ -126,6 +167,28 @@ be a list of namespace string, for example: '["kube-system","flow-aggregator","f
 		networkPolicyRecommendation.NSAllowList = parsedNsAllowList
 	}
 
+	autoAllowSystemNs, err := cmd.Flags().GetBool("auto-allow-system-ns")
+	if err != nil {
+		return err
+	}
+	if autoAllowSystemNs {
+		kubeconfig, err := ResolveKubeConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+		}
+		k8sClient, err := CreateK8sClient(kubeconfig)
+		if err != nil {
+			return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+		}
+		systemNamespaces, err := discoverSystemNamespaces(k8sClient)
+		if err != nil {
+			return fmt.Errorf("error when discovering system Namespaces: %v", explainForbidden(k8sClient, systemNamespaceDiscoveryAccess, err))
+		}
+		nsAllowList := sets.NewString(networkPolicyRecommendation.NSAllowList...).Insert(systemNamespaces...)
+		networkPolicyRecommendation.NSAllowList = nsAllowList.List()
+		fmt.Fprintf(os.Stderr, "Namespaces allowed by default: %s\n", strings.Join(networkPolicyRecommendation.NSAllowList, ", "))
+	}
+
 	excludeLabels, err := cmd.Flags().GetBool("exclude-labels")
 	if err != nil {
 		return err
@@ -138,59 +201,106 @@ be a list of namespace string, for example: '["kube-system","flow-aggregator","f
 	}
 	networkPolicyRecommendation.ToServices = toServices
 
-	executorInstances, err := cmd.Flags().GetInt32("executor-instances")
+	resources, err := getSparkResources(cmd)
 	if err != nil {
 		return err
 	}
-	if executorInstances < 0 {
-		return fmt.Errorf("executor-instances should be an integer >= 0")
-	}
-	networkPolicyRecommendation.ExecutorInstances = int(executorInstances)
+	networkPolicyRecommendation.ExecutorInstances = resources.executorInstances
+	networkPolicyRecommendation.DriverCoreRequest = resources.driverCoreRequest
+	networkPolicyRecommendation.DriverMemory = resources.driverMemory
+	networkPolicyRecommendation.ExecutorCoreRequest = resources.executorCoreRequest
+	networkPolicyRecommendation.ExecutorMemory = resources.executorMemory
 
-	driverCoreRequest, err := cmd.Flags().GetString("driver-core-request")
+	autoSizeExecutors, err := cmd.Flags().GetBool("auto-size-executors")
 	if err != nil {
 		return err
 	}
-	matchResult, err := regexp.MatchString(config.K8sQuantitiesReg, driverCoreRequest)
-	if err != nil || !matchResult {
-		return fmt.Errorf("driver-core-request should conform to the Kubernetes resource quantity convention")
+	// Explicitly requested executor resources are not overridden.
+	networkPolicyRecommendation.AutoSizeExecutors = autoSizeExecutors && !cmd.Flags().Changed("executor-instances") && !cmd.Flags().Changed("executor-memory")
+
+	preaggregate, err := cmd.Flags().GetBool("preaggregate")
+	if err != nil {
+		return err
 	}
-	networkPolicyRecommendation.DriverCoreRequest = driverCoreRequest
+	networkPolicyRecommendation.Preaggregate = preaggregate
 
-	driverMemory, err := cmd.Flags().GetString("driver-memory")
+	tags, err := cmd.Flags().GetStringToString("tags")
 	if err != nil {
 		return err
 	}
-	matchResult, err = regexp.MatchString(config.K8sQuantitiesReg, driverMemory)
-	if err != nil || !matchResult {
-		return fmt.Errorf("driver-memory should conform to the Kubernetes resource quantity convention")
+	if err := util.ValidateJobTags(tags); err != nil {
+		return err
 	}
-	networkPolicyRecommendation.DriverMemory = driverMemory
+	networkPolicyRecommendation.Tags = tags
 
-	executorCoreRequest, err := cmd.Flags().GetString("executor-core-request")
+	canaryNamespace, err := cmd.Flags().GetString("canary-namespace")
 	if err != nil {
 		return err
 	}
-	matchResult, err = regexp.MatchString(config.K8sQuantitiesReg, executorCoreRequest)
-	if err != nil || !matchResult {
-		return fmt.Errorf("executor-core-request should conform to the Kubernetes resource quantity convention")
+	if canaryNamespace != "" {
+		soakWindow, err := cmd.Flags().GetDuration("canary-soak-window")
+		if err != nil {
+			return err
+		}
+		maxDeniedFlows, err := cmd.Flags().GetInt("canary-max-denied-flows")
+		if err != nil {
+			return err
+		}
+		if err := util.ValidateRecommendationCanary(policyType, canaryNamespace, soakWindow, maxDeniedFlows); err != nil {
+			return err
+		}
+		networkPolicyRecommendation.Canary = &intelligence.NetworkPolicyRecommendationCanary{
+			Namespace:      canaryNamespace,
+			SoakWindow:     metav1.Duration{Duration: soakWindow},
+			MaxDeniedFlows: maxDeniedFlows,
+		}
 	}
-	networkPolicyRecommendation.ExecutorCoreRequest = executorCoreRequest
 
-	executorMemory, err := cmd.Flags().GetString("executor-memory")
+	workload, err := cmd.Flags().GetString("workload")
 	if err != nil {
 		return err
 	}
-	matchResult, err = regexp.MatchString(config.K8sQuantitiesReg, executorMemory)
-	if err != nil || !matchResult {
-		return fmt.Errorf("executor-memory should conform to the Kubernetes resource quantity convention")
+	if workload != "" {
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			return err
+		}
+		kind, name, err := parseWorkload(workload)
+		if err != nil {
+			return err
+		}
+		kubeconfig, err := ResolveKubeConfig(cmd)
+		if err != nil {
+			return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+		}
+		k8sClient, err := CreateK8sClient(kubeconfig)
+		if err != nil {
+			return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+		}
+		podLabels, err := getWorkloadPodLabels(k8sClient, kind, namespace, name)
+		if err != nil {
+			return err
+		}
+		if err := util.ValidateRecommendationWorkload(policyType, namespace, podLabels); err != nil {
+			return err
+		}
+		networkPolicyRecommendation.Workload = &intelligence.NetworkPolicyRecommendationWorkload{
+			Namespace: namespace,
+			Name:      kind + "/" + name,
+			PodLabels: podLabels,
+		}
 	}
-	networkPolicyRecommendation.ExecutorMemory = executorMemory
 
-	filePath, err := cmd.Flags().GetString("file")
+	filePath, err := getPathFlag(cmd, "output-file")
 	if err != nil {
 		return err
 	}
+	// Keep supporting the deprecated --file flag.
+	if deprecatedFlag := cmd.Flags().Lookup("file"); filePath == "" && deprecatedFlag != nil {
+		if filePath, err = expandHome(deprecatedFlag.Value.String()); err != nil {
+			return err
+		}
+	}
 	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
 	if err != nil {
 		return err
@@ -208,22 +318,35 @@ be a list of namespace string, for example: '["kube-system","flow-aggregator","f
 		return err
 	}
 
-	recoID := uuid.New().String()
-	networkPolicyRecommendation.Name = "pr-" + recoID
-	networkPolicyRecommendation.Namespace = config.FlowVisibilityNS
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		networkPolicyRecommendation.Name = policyRecommendationJobName(name)
+	} else {
+		networkPolicyRecommendation.Name = "pr-" + uuid.New().String()
+	}
+	networkPolicyRecommendation.Namespace = theiaNamespace
+	networkPolicyRecommendation.Annotations = map[string]string{util.CorrelationIDAnnotation: getCorrelationID()}
 
-	err = theiaClient.Post().
-		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
-		Resource("networkpolicyrecommendations").
-		Body(&networkPolicyRecommendation).
-		Do(context.TODO()).Error()
+	created, err := submitPolicyRecommendation(theiaClient, &networkPolicyRecommendation, name)
 	if err != nil {
-		return fmt.Errorf("failed to post policy recommendation job: %v", err)
+		return err
+	}
+	if created {
+		klog.V(2).InfoS("Created policy recommendation job", "name", networkPolicyRecommendation.Name, "correlationID", getCorrelationID())
+	} else {
+		fmt.Fprintf(os.Stderr, "Policy recommendation job %s already exists for name %s with the same options\n", networkPolicyRecommendation.Name, name)
 	}
 	if waitFlag {
-		var npr intelligence.NetworkPolicyRecommendation
+		// Progress is reported on stderr so that stdout only holds the
+		// recommended policies, e.g. when piped to "kubectl apply -f -".
+		fmt.Fprintf(os.Stderr, "Waiting for policy recommendation job %s to complete\n", networkPolicyRecommendation.Name)
 		err = wait.Poll(config.StatusCheckPollInterval, config.StatusCheckPollTimeout, func() (bool, error) {
-			npr, err = getPolicyRecommendationByName(theiaClient, networkPolicyRecommendation.Name)
+			// Only the state is needed here, limit the result to a single
+			// policy to avoid transferring it on every poll.
+			npr, err := getPolicyRecommendationPage(theiaClient, networkPolicyRecommendation.Name, 1, "")
 			if err != nil {
 				return false, fmt.Errorf("error when getting policy recommendation job by job name: %v", err)
 			}
@@ -244,27 +367,103 @@ be a list of namespace string, for example: '["kube-system","flow-aggregator","f
 			}
 			return err
 		}
-		if npr.Status.RecommendationOutcome != "" {
-			fmt.Print(npr.Status.RecommendationOutcome)
+		return writePolicyRecommendationResult(theiaClient, networkPolicyRecommendation.Name, defaultRecommendationPageSize, nil, filePath)
+	} else if created {
+		fmt.Printf("Successfully created policy recommendation job with name %s\n", networkPolicyRecommendation.Name)
+	} else {
+		fmt.Printf("Found existing policy recommendation job with name %s\n", networkPolicyRecommendation.Name)
+	}
+	return nil
+}
+
+// policyRecommendationJobName returns the name of the policy recommendation
+// job submitted with a name given by the user. The name is used as is if it is
+// a valid job name, otherwise the UUID of the job is derived from it, so that
+// the same name always refers to the same job.
+func policyRecommendationJobName(name string) string {
+	if util.ParseRecommendationName(name) == nil {
+		return name
+	}
+	return "pr-" + uuid.NewSHA1(uuid.NameSpaceURL, []byte(policyRecommendationNameSpace+name)).String()
+}
+
+// submitPolicyRecommendation creates the policy recommendation job. If the
+// job is submitted with a name given by the user and a job with the same name
+// exists, e.g. because automation retried the submission, the existing job is
+// reused if it has the same options, and an error is returned otherwise. It
+// returns whether the job is created.
+func submitPolicyRecommendation(theiaClient restclient.Interface, npr *intelligence.NetworkPolicyRecommendation, name string) (bool, error) {
+	if name != "" {
+		if exists, err := checkExistingPolicyRecommendation(theiaClient, npr, name); err != nil || exists {
+			return false, err
 		}
-		if filePath != "" {
-			if err := os.WriteFile(filePath, []byte(npr.Status.RecommendationOutcome), 0600); err != nil {
-				return fmt.Errorf("error when writing recommendation result to file: %v", err)
+	}
+	err := policyRecommendationJobs.submit(theiaClient, npr)
+	if err != nil {
+		// The job may have been created concurrently by another submission
+		// with the same name.
+		if name != "" {
+			if exists, existsErr := checkExistingPolicyRecommendation(theiaClient, npr, name); existsErr != nil || exists {
+				return false, existsErr
 			}
-			return nil
 		}
-		if npr.Status.RecommendationOutcome != "" {
-			fmt.Print(npr.Status.RecommendationOutcome)
+		return false, err
+	}
+	return true, nil
+}
+
+// checkExistingPolicyRecommendation returns whether the job exists, and an
+// error if it exists with options different from the submitted ones.
+func checkExistingPolicyRecommendation(theiaClient restclient.Interface, npr *intelligence.NetworkPolicyRecommendation, name string) (bool, error) {
+	var existing intelligence.NetworkPolicyRecommendation
+	// Only the options are needed, limit the result to a single policy.
+	err := theiaClient.Get().
+		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
+		Resource("networkpolicyrecommendations").
+		Name(npr.Name).
+		Param("limit", "1").
+		Do(context.TODO()).
+		Into(&existing)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get policy recommendation job %s: %v", npr.Name, err)
+	}
+	if !samePolicyRecommendationOptions(&existing, npr) {
+		return true, fmt.Errorf(`policy recommendation job %s already exists for name %s with different options,
+please use another name, or delete the existing job with "theia policy-recommendation delete %s"`, npr.Name, name, npr.Name)
+	}
+	return true, nil
+}
+
+// samePolicyRecommendationOptions returns whether two policy recommendation
+// jobs have the same options. The labels of the Pods of the workload are read
+// from the cluster when the job is submitted, and are not compared.
+func samePolicyRecommendationOptions(a, b *intelligence.NetworkPolicyRecommendation) bool {
+	options := func(npr *intelligence.NetworkPolicyRecommendation) intelligence.NetworkPolicyRecommendation {
+		job := *npr
+		job.TypeMeta = metav1.TypeMeta{}
+		job.ObjectMeta = metav1.ObjectMeta{}
+		job.Submitter = ""
+		job.Status = intelligence.NetworkPolicyRecommendationStatus{}
+		if npr.Workload != nil {
+			job.Workload = &intelligence.NetworkPolicyRecommendationWorkload{Namespace: npr.Workload.Namespace, Name: npr.Workload.Name}
 		}
-		return nil
-	} else {
-		fmt.Printf("Successfully created policy recommendation job with name %s\n", networkPolicyRecommendation.Name)
+		return job
 	}
-	return nil
+	return apiequality.Semantic.DeepEqual(options(a), options(b))
 }
 
 func init() {
 	policyRecommendationCmd.AddCommand(policyRecommendationRunCmd)
+	policyRecommendationRunCmd.Flags().StringP(
+		"filename",
+		"f",
+		"",
+		`A YAML file with the options of the job, keyed by the names of the flags, e.g. "policy-type: anp-deny-all".
+Lists and maps can be used for ns-allow-list and tags. The flags which are set override the options of the file.`,
+	)
 	policyRecommendationRunCmd.Flags().StringP(
 		"type",
 		"t",
@@ -308,6 +507,13 @@ Format is YYYY-MM-DD hh:mm:ss in UTC timezone. No limit of the end time of flow
 		`List of default allow Namespaces.
 If no Namespaces provided, Traffic inside Antrea CNI related Namespaces: ['kube-system', 'flow-aggregator',
 'flow-visibility'] will be allowed by default.`,
+	)
+	policyRecommendationRunCmd.Flags().Bool(
+		"auto-allow-system-ns",
+		false,
+		`Enable this option will discover the system Namespaces in the cluster, including Kubernetes, CNI,
+Theia and monitoring Namespaces, and add them to the default allow Namespaces. The final list is printed
+before the job is created.`,
 	)
 	policyRecommendationRunCmd.Flags().Bool(
 		"exclude-labels",
@@ -321,44 +527,210 @@ If no Namespaces provided, Traffic inside Antrea CNI related Namespaces: ['kube-
 		`Use the toServices feature in ANP and recommendation toServices rules for Pod-to-Service flows,
 only works when option is anp-deny-applied or anp-deny-all.`,
 	)
-	policyRecommendationRunCmd.Flags().Int32(
-		"executor-instances",
-		1,
-		"Specify the number of executors for the Spark application. Example values include 1, 2, 8, etc.",
+	addSparkResourceFlags(policyRecommendationRunCmd)
+	policyRecommendationRunCmd.Flags().Bool(
+		"auto-size-executors",
+		true,
+		`Size the executors according to the number of flow records in the time range of the job,
+unless executor-instances or executor-memory is specified.`,
+	)
+	policyRecommendationRunCmd.Flags().Bool(
+		"preaggregate",
+		false,
+		`Aggregate the flow records of the time range by source, destination and port in ClickHouse
+before the job starts, so that the Spark job reads much fewer rows on clusters with many
+short-lived connections. The aggregated flows are deleted when the job ends.`,
+	)
+	policyRecommendationRunCmd.Flags().StringToString(
+		"tags",
+		nil,
+		`Tags added as labels to the driver and executor Pods of the job, e.g. to attribute
+its cost to a team with cluster cost tools. Example: --tags team=netsec,env=prod`,
 	)
 	policyRecommendationRunCmd.Flags().String(
-		"driver-core-request",
-		"200m",
-		`Specify the CPU request for the driver Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 0.1, 500m, 1.5, 5, etc.`,
+		"canary-namespace",
+		"",
+		`Enable the canary rollout of the policies recommended for this Namespace. Once the job is completed,
+the Theia Manager applies them in log mode, where the rules which would deny traffic allow and log it
+instead, then enforces them at the end of the soak window, or deletes them if too many flows would have
+been denied. Only works when policy-type is anp-deny-applied or anp-deny-all.`,
+	)
+	policyRecommendationRunCmd.Flags().Duration(
+		"canary-soak-window",
+		time.Hour,
+		"The time the policies are applied in log mode during the canary rollout.",
+	)
+	policyRecommendationRunCmd.Flags().Int(
+		"canary-max-denied-flows",
+		0,
+		"The maximum number of flows which would have been denied during the soak window for the policies to be enforced.",
 	)
 	policyRecommendationRunCmd.Flags().String(
-		"driver-memory",
-		"512M",
-		`Specify the memory request for the driver Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 512M, 1G, 8G, etc.`,
+		"workload",
+		"",
+		`Restrict the recommendation to the flows of the Pods of a workload, given as TYPE/NAME where TYPE is one of
+pod, deployment, statefulset, daemonset, replicaset or job, and only recommend the policies applied to them.
+The Pods are selected by the labels of the Pod, or the matchLabels of the selector of the workload, read from
+the cluster. Does not work when policy-type is anp-deny-all.`,
 	)
 	policyRecommendationRunCmd.Flags().String(
-		"executor-core-request",
-		"200m",
-		`Specify the CPU request for the executor Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 0.1, 500m, 1.5, 5, etc.`,
+		"namespace",
+		metav1.NamespaceDefault,
+		"The Namespace of the workload.",
 	)
 	policyRecommendationRunCmd.Flags().String(
-		"executor-memory",
-		"512M",
-		`Specify the memory request for the executor Pod. Values conform to the Kubernetes resource quantity convention.
-Example values include 512M, 1G, 8G, etc.`,
+		"name",
+		"",
+		`A name identifying the job, e.g. to make the retries of automation idempotent. Submitting a job with the
+name of an existing job returns the existing job if it has the same options, and fails otherwise. The job
+name is derived from it, unless it is already a valid job name.`,
 	)
 	policyRecommendationRunCmd.Flags().Bool(
 		"wait",
 		false,
-		"Enable this option will hold and wait the whole policy recommendation job finishes.",
+		`Enable this option will hold and wait the whole policy recommendation job finishes,
+then print its result, or save it to the file specified by --output-file.`,
 	)
-	policyRecommendationRunCmd.Flags().StringP(
+	policyRecommendationRunCmd.Flags().String(
+		"output-file",
+		"",
+		"The file path where you want to save the result. It can only be used when wait is enabled.",
+	)
+	policyRecommendationRunCmd.Flags().String(
 		"file",
-		"f",
 		"",
 		"The file path where you want to save the result. It can only be used when wait is enabled.",
 	)
+	policyRecommendationRunCmd.Flags().MarkDeprecated("file", "use --output-file instead")
+}
+
+// jobFileExcludedFlags are the flags of the run command which are not options
+// of the job, and cannot be set by a job file.
+var jobFileExcludedFlags = sets.NewString("filename", "wait", "output-file", "file", "use-cluster-ip", "kubeconfig")
+
+// applyJobFile sets the flags of the run command which are not set on the
+// command line to the values of the job file at path. The job file is a YAML
+// mapping of the names of the flags to their values.
+func applyJobFile(cmd *cobra.Command, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error when reading job file: %v", err)
+	}
+	var options map[string]interface{}
+	if err := yaml.Unmarshal(data, &options); err != nil {
+		return fmt.Errorf("error when parsing job file %s: %v", path, err)
+	}
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || jobFileExcludedFlags.Has(name) {
+			return fmt.Errorf("unknown option %q in job file %s", name, path)
+		}
+		if flag.Changed {
+			continue
+		}
+		value, err := getJobFileFlagValue(flag, options[name])
+		if err != nil {
+			return fmt.Errorf("invalid option %q in job file %s: %v", name, path, err)
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid option %q in job file %s: %v", name, path, err)
+		}
+	}
+	return nil
+}
+
+// getJobFileFlagValue returns the value of an option of a job file as the
+// value of its flag on the command line.
+func getJobFileFlagValue(flag *pflag.Flag, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		// Lists are given to the flags as JSON, e.g. ns-allow-list.
+		if flag.Value.Type() != "string" {
+			break
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case map[string]interface{}:
+		// Maps are given to the flags as key=value pairs, e.g. tags.
+		if flag.Value.Type() != "stringToString" {
+			break
+		}
+		pairs := make([]string, 0, len(v))
+		for key, value := range v {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+	}
+	return "", fmt.Errorf("unexpected value %v for a flag of type %s", value, flag.Value.Type())
+}
+
+var (
+	// systemNamespaceNames are well-known Namespaces of Kubernetes, CNIs,
+	// Theia and monitoring components.
+	systemNamespaceNames = sets.NewString(
+		"kube-system",
+		"kube-public",
+		"kube-node-lease",
+		"flow-aggregator",
+		config.FlowVisibilityNS,
+		"calico-system",
+		"tigera-operator",
+		"kube-flannel",
+		"cilium",
+		"monitoring",
+	)
+	// systemPodSelectors select the Pods of system components, which can be
+	// deployed in Namespaces with arbitrary names.
+	systemPodSelectors = []string{
+		"app in (antrea, flow-aggregator, theia-manager)",
+		"k8s-app in (kube-dns, kube-proxy, calico-node, cilium)",
+		"app.kubernetes.io/name in (prometheus, alertmanager, grafana)",
+	}
+	// systemNamespaceDiscoveryAccess are the actions performed to discover
+	// the system Namespaces.
+	systemNamespaceDiscoveryAccess = []authorizationv1.ResourceAttributes{
+		{Verb: "list", Resource: "namespaces"},
+		{Verb: "list", Resource: "pods"},
+	}
+)
+
+// discoverSystemNamespaces returns the sorted list of Namespaces which are
+// either well-known system Namespaces, prefixed with "kube-", or running Pods
+// of system components.
+func discoverSystemNamespaces(k8sClient kubernetes.Interface) ([]string, error) {
+	namespaces, err := k8sClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error when listing Namespaces: %w", err)
+	}
+	systemNamespaces := sets.NewString()
+	for _, namespace := range namespaces.Items {
+		if systemNamespaceNames.Has(namespace.Name) || strings.HasPrefix(namespace.Name, "kube-") {
+			systemNamespaces.Insert(namespace.Name)
+		}
+	}
+	for _, selector := range systemPodSelectors {
+		pods, err := k8sClient.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("error when listing Pods with selector %s: %w", selector, err)
+		}
+		for _, pod := range pods.Items {
+			systemNamespaces.Insert(pod.Namespace)
+		}
+	}
+	return systemNamespaces.List(), nil
 }
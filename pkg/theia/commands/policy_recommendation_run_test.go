@@ -17,19 +17,29 @@ package commands
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	restclient "k8s.io/client-go/rest"
 
 	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 	"antrea.io/theia/pkg/theia/portforwarder"
+	"antrea.io/theia/pkg/util"
 )
 
 func TestPolicyRecommendationRun(t *testing.T) {
@@ -39,6 +49,7 @@ func TestPolicyRecommendationRun(t *testing.T) {
 		expectedMsg      []string
 		expectedErrorMsg string
 		waitFlag         bool
+		jobName          string
 	}{
 		{
 			name: "Valid case",
@@ -66,6 +77,30 @@ func TestPolicyRecommendationRun(t *testing.T) {
 			expectedErrorMsg: "",
 			waitFlag:         true,
 		},
+		{
+			name: "Job failed with waitFlag",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations":
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+				}
+				if r.Method == "GET" && strings.Contains(r.URL.Path, "networkpolicyrecommendations/pr-") {
+					npr := &intelligence.NetworkPolicyRecommendation{
+						Status: intelligence.NetworkPolicyRecommendationStatus{
+							State:    "FAILED",
+							ErrorMsg: "mock_error",
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(npr)
+				}
+			})),
+			expectedMsg:      []string{},
+			expectedErrorMsg: "policy recommendation job failed, Error Message: mock_error",
+			waitFlag:         true,
+		},
 		{
 			name: "waitFlag is false",
 			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -128,6 +163,7 @@ func TestPolicyRecommendationRun(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -135,8 +171,15 @@ func TestPolicyRecommendationRun(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", nil, "")
+			cmd.Flags().String("canary-namespace", "", "")
+			cmd.Flags().String("workload", "", "")
 			cmd.Flags().Bool("wait", tt.waitFlag, "")
-			cmd.Flags().String("file", "", "")
+			cmd.Flags().String("name", tt.jobName, "")
+			cmd.Flags().String("filename", "", "")
+			cmd.Flags().String("output-file", "", "")
 
 			orig := os.Stdout
 			r, w, _ := os.Pipe()
@@ -157,6 +200,120 @@ func TestPolicyRecommendationRun(t *testing.T) {
 	}
 }
 
+func TestPolicyRecommendationRunWithName(t *testing.T) {
+	jobs := map[string]intelligence.NetworkPolicyRecommendation{}
+	posts := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSpace(r.URL.Path)
+		if r.Method == "POST" && path == "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations" {
+			var npr intelligence.NetworkPolicyRecommendation
+			json.NewDecoder(r.Body).Decode(&npr)
+			posts++
+			if _, ok := jobs[npr.Name]; ok {
+				http.Error(w, "networkPolicyRecommendation job exists", http.StatusBadRequest)
+				return
+			}
+			jobs[npr.Name] = npr
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method == "GET" {
+			npr, ok := jobs[strings.TrimPrefix(path, "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/")]
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			npr.Submitter = "system:serviceaccount:default:ci"
+			npr.Status.State = "RUNNING"
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(npr)
+		}
+	}))
+	defer testServer.Close()
+	oldFunc := SetupTheiaClientAndConnection
+	SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+		clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+		clientset, _ := kubernetes.NewForConfig(clientConfig)
+		return clientset.CoreV1().RESTClient(), nil, nil
+	}
+	defer func() { SetupTheiaClientAndConnection = oldFunc }()
+
+	jobName := policyRecommendationJobName("nightly-2022-01-24")
+	assert.NoError(t, util.ParseRecommendationName(jobName))
+	assert.Equal(t, jobName, policyRecommendationJobName("nightly-2022-01-24"))
+	assert.NotEqual(t, jobName, policyRecommendationJobName("nightly-2022-01-25"))
+	assert.Equal(t, "pr-e498bf0f-b0ed-4cf6-9b02-8e3b0fa55e7c", policyRecommendationJobName("pr-e498bf0f-b0ed-4cf6-9b02-8e3b0fa55e7c"))
+
+	testCases := []struct {
+		name             string
+		limit            int
+		expectedMsg      string
+		expectedErrorMsg string
+		expectedPosts    int
+	}{
+		{
+			name:          "Create the job",
+			expectedMsg:   "Successfully created policy recommendation job with name " + jobName,
+			expectedPosts: 1,
+		},
+		{
+			name:          "Resubmit the job with the same options",
+			expectedMsg:   "Found existing policy recommendation job with name " + jobName,
+			expectedPosts: 1,
+		},
+		{
+			name:             "Resubmit the job with different options",
+			limit:            10000,
+			expectedErrorMsg: fmt.Sprintf("policy recommendation job %s already exists for name nightly-2022-01-24 with different options", jobName),
+			expectedPosts:    1,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := new(cobra.Command)
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", tt.limit, "")
+			cmd.Flags().String("policy-type", "anp-deny-applied", "")
+			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
+			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
+			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
+			cmd.Flags().Bool("exclude-labels", true, "")
+			cmd.Flags().Bool("to-services", true, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "1", "")
+			cmd.Flags().String("driver-memory", "1m", "")
+			cmd.Flags().String("executor-core-request", "1", "")
+			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", map[string]string{"team": "netsec"}, "")
+			cmd.Flags().String("canary-namespace", "", "")
+			cmd.Flags().String("workload", "", "")
+			cmd.Flags().Bool("wait", false, "")
+			cmd.Flags().String("name", "nightly-2022-01-24", "")
+			cmd.Flags().String("filename", "", "")
+			cmd.Flags().String("output-file", "", "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := policyRecommendationRun(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				assert.Contains(t, readStdout(t, r, w), tt.expectedMsg)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+			assert.Equal(t, tt.expectedPosts, posts)
+		})
+	}
+}
+
 func TestPolicyRecommendationRunErrs(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -210,6 +367,10 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			name:             "Invalid ns-allow-list",
 			expectedErrorMsg: "ns-allow-list should \nbe a list of namespace string",
 		},
+		{
+			name:             "Unspecified auto-allow-system-ns",
+			expectedErrorMsg: ErrorMsgUnspecifiedCase,
+		},
 		{
 			name:             "Unspecified exclude-labels",
 			expectedErrorMsg: ErrorMsgUnspecifiedCase,
@@ -258,6 +419,22 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			name:             "Invalid executor-memory",
 			expectedErrorMsg: "executor-memory should conform to the Kubernetes resource quantity convention",
 		},
+		{
+			name:             "Unspecified tags",
+			expectedErrorMsg: ErrorMsgUnspecifiedCase,
+		},
+		{
+			name:             "Invalid tags",
+			expectedErrorMsg: "tag value net sec of key team is not a valid label value",
+		},
+		{
+			name:             "Unspecified canary-namespace",
+			expectedErrorMsg: ErrorMsgUnspecifiedCase,
+		},
+		{
+			name:             "Invalid canary-soak-window",
+			expectedErrorMsg: "canary soak window should be a positive duration",
+		},
 		{
 			name:             "Unspecified file",
 			expectedErrorMsg: ErrorMsgUnspecifiedCase,
@@ -273,6 +450,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 	}
 	for _, tt := range testCases {
 		cmd := new(cobra.Command)
+		cmd.Flags().String("filename", "", "")
 		switch tt.name {
 		case "Invalid type":
 			cmd.Flags().String("type", "mock_wrong_type", "")
@@ -321,6 +499,13 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "mock_wrong_ns-allow-list", "")
+		case "Unspecified auto-allow-system-ns":
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", 0, "")
+			cmd.Flags().String("policy-type", "anp-deny-applied", "")
+			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
+			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
+			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
 		case "Unspecified exclude-labels":
 			cmd.Flags().String("type", "initial", "")
 			cmd.Flags().Int("limit", 0, "")
@@ -328,6 +513,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 		case "Unspecified to-services":
 			cmd.Flags().String("type", "initial", "")
 			cmd.Flags().Int("limit", 0, "")
@@ -335,6 +521,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 		case "Unspecified executor-instances":
 			cmd.Flags().Bool("use-cluster-ip", true, "")
@@ -344,6 +531,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 		case "Invalid executor-instances":
@@ -353,6 +541,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", -1, "")
@@ -363,6 +552,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -373,6 +563,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -384,6 +575,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -395,6 +587,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -407,6 +600,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -419,6 +613,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -432,6 +627,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -445,6 +641,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -452,6 +649,82 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "mock_executor-memory", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+		case "Unspecified tags":
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", 0, "")
+			cmd.Flags().String("policy-type", "anp-deny-applied", "")
+			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
+			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
+			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
+			cmd.Flags().Bool("exclude-labels", true, "")
+			cmd.Flags().Bool("to-services", true, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "1", "")
+			cmd.Flags().String("driver-memory", "1m", "")
+			cmd.Flags().String("executor-core-request", "1", "")
+			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+		case "Invalid tags":
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", 0, "")
+			cmd.Flags().String("policy-type", "anp-deny-applied", "")
+			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
+			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
+			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
+			cmd.Flags().Bool("exclude-labels", true, "")
+			cmd.Flags().Bool("to-services", true, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "1", "")
+			cmd.Flags().String("driver-memory", "1m", "")
+			cmd.Flags().String("executor-core-request", "1", "")
+			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", map[string]string{"team": "net sec"}, "")
+		case "Unspecified canary-namespace":
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", 0, "")
+			cmd.Flags().String("policy-type", "anp-deny-applied", "")
+			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
+			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
+			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
+			cmd.Flags().Bool("exclude-labels", true, "")
+			cmd.Flags().Bool("to-services", true, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "1", "")
+			cmd.Flags().String("driver-memory", "1m", "")
+			cmd.Flags().String("executor-core-request", "1", "")
+			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", nil, "")
+		case "Invalid canary-soak-window":
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", 0, "")
+			cmd.Flags().String("policy-type", "anp-deny-applied", "")
+			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
+			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
+			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
+			cmd.Flags().Bool("exclude-labels", true, "")
+			cmd.Flags().Bool("to-services", true, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "1", "")
+			cmd.Flags().String("driver-memory", "1m", "")
+			cmd.Flags().String("executor-core-request", "1", "")
+			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", nil, "")
+			cmd.Flags().String("canary-namespace", "default", "")
+			cmd.Flags().Duration("canary-soak-window", 0, "")
+			cmd.Flags().Int("canary-max-denied-flows", 0, "")
 		case "Unspecified file":
 			cmd.Flags().String("type", "initial", "")
 			cmd.Flags().Int("limit", 0, "")
@@ -459,6 +732,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -466,6 +740,11 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", nil, "")
+			cmd.Flags().String("canary-namespace", "", "")
+			cmd.Flags().String("workload", "", "")
 		case "Unspecified use-cluster-ip":
 			cmd.Flags().String("type", "initial", "")
 			cmd.Flags().Int("limit", 0, "")
@@ -473,6 +752,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -480,7 +760,12 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
-			cmd.Flags().String("file", "filename", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", nil, "")
+			cmd.Flags().String("canary-namespace", "", "")
+			cmd.Flags().String("workload", "", "")
+			cmd.Flags().String("output-file", "filename", "")
 		case "Unspecified waitFlag":
 			cmd.Flags().String("type", "initial", "")
 			cmd.Flags().Int("limit", 0, "")
@@ -488,6 +773,7 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("start-time", "2006-01-02 15:04:05", "")
 			cmd.Flags().String("end-time", "2006-01-03 15:04:05", "")
 			cmd.Flags().String("ns-allow-list", "[\"kube-system\",\"flow-aggregator\",\"flow-visibility\"]", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
 			cmd.Flags().Bool("exclude-labels", true, "")
 			cmd.Flags().Bool("to-services", true, "")
 			cmd.Flags().Int32("executor-instances", 1, "")
@@ -495,7 +781,12 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 			cmd.Flags().String("driver-memory", "1m", "")
 			cmd.Flags().String("executor-core-request", "1", "")
 			cmd.Flags().String("executor-memory", "1m", "")
-			cmd.Flags().String("file", "filename", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", nil, "")
+			cmd.Flags().String("canary-namespace", "", "")
+			cmd.Flags().String("workload", "", "")
+			cmd.Flags().String("output-file", "filename", "")
 			cmd.Flags().Bool("use-cluster-ip", true, "")
 		}
 
@@ -508,3 +799,299 @@ func TestPolicyRecommendationRunErrs(t *testing.T) {
 		}
 	}
 }
+
+func TestPolicyRecommendationRunWorkload(t *testing.T) {
+	testCases := []struct {
+		name             string
+		workload         string
+		policyType       string
+		objects          []runtime.Object
+		expectedWorkload *intelligence.NetworkPolicyRecommendationWorkload
+		expectedErrorMsg string
+	}{
+		{
+			name:     "Deployment",
+			workload: "deploy/foo",
+			objects: []runtime.Object{&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+				},
+			}},
+			expectedWorkload: &intelligence.NetworkPolicyRecommendationWorkload{
+				Namespace: "ns",
+				Name:      "deployment/foo",
+				PodLabels: map[string]string{"app": "foo"},
+			},
+		},
+		{
+			name:     "Pod",
+			workload: "pod/foo-0",
+			objects: []runtime.Object{&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo-0", Namespace: "ns", Labels: map[string]string{"app": "foo", "tier": "web"}},
+			}},
+			expectedWorkload: &intelligence.NetworkPolicyRecommendationWorkload{
+				Namespace: "ns",
+				Name:      "pod/foo-0",
+				PodLabels: map[string]string{"app": "foo", "tier": "web"},
+			},
+		},
+		{
+			name:             "StatefulSet not found",
+			workload:         "statefulset/foo",
+			expectedErrorMsg: "error when getting statefulset/foo",
+		},
+		{
+			name:             "Invalid workload",
+			workload:         "service/foo",
+			expectedErrorMsg: "workload \"service/foo\" should be TYPE/NAME",
+		},
+		{
+			name:       "Deny all policies",
+			workload:   "pod/foo-0",
+			policyType: "anp-deny-all",
+			objects: []runtime.Object{&v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo-0", Namespace: "ns", Labels: map[string]string{"app": "foo"}},
+			}},
+			expectedErrorMsg: "workload recommendation requires policy type anp-deny-applied or k8s-np",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var npr intelligence.NetworkPolicyRecommendation
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "POST" && strings.TrimSpace(r.URL.Path) == "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations" {
+					json.NewDecoder(r.Body).Decode(&npr)
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+				}
+			}))
+			defer testServer.Close()
+			oldSetupFunc := SetupTheiaClientAndConnection
+			oldCreateFunc := CreateK8sClient
+			SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+				clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+				clientset, _ := kubernetes.NewForConfig(clientConfig)
+				return clientset.CoreV1().RESTClient(), nil, nil
+			}
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tt.objects...), nil
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldSetupFunc
+				CreateK8sClient = oldCreateFunc
+			}()
+			policyType := tt.policyType
+			if policyType == "" {
+				policyType = "anp-deny-applied"
+			}
+			cmd := new(cobra.Command)
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", 0, "")
+			cmd.Flags().String("policy-type", policyType, "")
+			cmd.Flags().String("start-time", "", "")
+			cmd.Flags().String("end-time", "", "")
+			cmd.Flags().String("ns-allow-list", "", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
+			cmd.Flags().Bool("exclude-labels", true, "")
+			cmd.Flags().Bool("to-services", true, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "1", "")
+			cmd.Flags().String("driver-memory", "1m", "")
+			cmd.Flags().String("executor-core-request", "1", "")
+			cmd.Flags().String("executor-memory", "1m", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", true, "")
+			cmd.Flags().StringToString("tags", nil, "")
+			cmd.Flags().String("canary-namespace", "", "")
+			cmd.Flags().String("workload", tt.workload, "")
+			cmd.Flags().String("namespace", "ns", "")
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().Bool("wait", false, "")
+			cmd.Flags().String("name", "", "")
+			cmd.Flags().String("filename", "", "")
+			cmd.Flags().String("output-file", "", "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := policyRecommendationRun(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				readStdout(t, r, w)
+				assert.Equal(t, tt.expectedWorkload, npr.Workload)
+				assert.True(t, npr.Preaggregate)
+				assert.Equal(t, getCorrelationID(), npr.Annotations[util.CorrelationIDAnnotation])
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestPolicyRecommendationRunJobFile(t *testing.T) {
+	jobFile := `type: subsequent
+policy-type: k8s-np
+limit: 1000000
+start-time: "2022-01-01 00:00:00"
+ns-allow-list: [kube-system, monitoring]
+executor-instances: 2
+executor-memory: 2G
+tags:
+  team: netsec
+  env: prod
+`
+	testCases := []struct {
+		name             string
+		jobFile          string
+		flags            map[string]string
+		expectedNPR      intelligence.NetworkPolicyRecommendation
+		expectedErrorMsg string
+	}{
+		{
+			name:    "Options of the job file",
+			jobFile: jobFile,
+			expectedNPR: intelligence.NetworkPolicyRecommendation{
+				Type:                "subsequent",
+				PolicyType:          "k8s-np",
+				Limit:               1000000,
+				StartInterval:       metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+				NSAllowList:         []string{"kube-system", "monitoring"},
+				ExecutorInstances:   2,
+				DriverCoreRequest:   "200m",
+				DriverMemory:        "512M",
+				ExecutorCoreRequest: "200m",
+				ExecutorMemory:      "2G",
+				Tags:                map[string]string{"env": "prod", "team": "netsec"},
+			},
+		},
+		{
+			name:    "Flags override the job file",
+			jobFile: jobFile,
+			flags:   map[string]string{"limit": "100", "executor-memory": "1G"},
+			expectedNPR: intelligence.NetworkPolicyRecommendation{
+				Type:                "subsequent",
+				PolicyType:          "k8s-np",
+				Limit:               100,
+				StartInterval:       metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+				NSAllowList:         []string{"kube-system", "monitoring"},
+				ExecutorInstances:   2,
+				DriverCoreRequest:   "200m",
+				DriverMemory:        "512M",
+				ExecutorCoreRequest: "200m",
+				ExecutorMemory:      "1G",
+				Tags:                map[string]string{"env": "prod", "team": "netsec"},
+			},
+		},
+		{
+			name:             "Unknown option",
+			jobFile:          "policyType: k8s-np\n",
+			expectedErrorMsg: "unknown option \"policyType\" in job file",
+		},
+		{
+			name:             "Option which is not a job option",
+			jobFile:          "wait: true\n",
+			expectedErrorMsg: "unknown option \"wait\" in job file",
+		},
+		{
+			name:             "Invalid option",
+			jobFile:          "executor-instances: two\n",
+			expectedErrorMsg: "invalid option \"executor-instances\" in job file",
+		},
+		{
+			name:             "Invalid list",
+			jobFile:          "limit: [1, 2]\n",
+			expectedErrorMsg: "unexpected value [1 2] for a flag of type int",
+		},
+		{
+			name:             "Invalid YAML",
+			jobFile:          "type: [initial\n",
+			expectedErrorMsg: "error when parsing job file",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var npr intelligence.NetworkPolicyRecommendation
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "POST" && strings.TrimSpace(r.URL.Path) == "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations" {
+					json.NewDecoder(r.Body).Decode(&npr)
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+				}
+			}))
+			defer testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+				clientConfig := &restclient.Config{Host: testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+				clientset, _ := kubernetes.NewForConfig(clientConfig)
+				return clientset.CoreV1().RESTClient(), nil, nil
+			}
+			defer func() { SetupTheiaClientAndConnection = oldFunc }()
+			jobFilePath := filepath.Join(t.TempDir(), "job.yaml")
+			require.NoError(t, os.WriteFile(jobFilePath, []byte(tt.jobFile), 0644))
+
+			cmd := new(cobra.Command)
+			cmd.Flags().String("filename", jobFilePath, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+			cmd.Flags().String("type", "initial", "")
+			cmd.Flags().Int("limit", 0, "")
+			cmd.Flags().String("policy-type", "anp-deny-applied", "")
+			cmd.Flags().String("start-time", "", "")
+			cmd.Flags().String("end-time", "", "")
+			cmd.Flags().String("ns-allow-list", "", "")
+			cmd.Flags().Bool("auto-allow-system-ns", false, "")
+			cmd.Flags().Bool("exclude-labels", false, "")
+			cmd.Flags().Bool("to-services", false, "")
+			cmd.Flags().Int32("executor-instances", 1, "")
+			cmd.Flags().String("driver-core-request", "200m", "")
+			cmd.Flags().String("driver-memory", "512M", "")
+			cmd.Flags().String("executor-core-request", "200m", "")
+			cmd.Flags().String("executor-memory", "512M", "")
+			cmd.Flags().Bool("auto-size-executors", true, "")
+			cmd.Flags().Bool("preaggregate", false, "")
+			cmd.Flags().StringToString("tags", nil, "")
+			cmd.Flags().String("canary-namespace", "", "")
+			cmd.Flags().String("workload", "", "")
+			cmd.Flags().Bool("wait", false, "")
+			cmd.Flags().String("name", "", "")
+			cmd.Flags().String("output-file", "", "")
+			for name, value := range tt.flags {
+				require.NoError(t, cmd.Flags().Set(name, value))
+			}
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := policyRecommendationRun(cmd, []string{})
+			if tt.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			readStdout(t, r, w)
+			npr.TypeMeta, npr.ObjectMeta = metav1.TypeMeta{}, metav1.ObjectMeta{}
+			npr.StartInterval = metav1.NewTime(npr.StartInterval.UTC())
+			assert.Equal(t, tt.expectedNPR, npr)
+		})
+	}
+}
+
+func TestDiscoverSystemNamespaces(t *testing.T) {
+	fakeClientset := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-custom"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "flow-visibility"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "antrea-system"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "observability"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "antrea-agent", Namespace: "antrea-system", Labels: map[string]string{"app": "antrea"}}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "prometheus", Namespace: "observability", Labels: map[string]string{"app.kubernetes.io/name": "prometheus"}}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "default", Labels: map[string]string{"app": "frontend"}}},
+	)
+	namespaces, err := discoverSystemNamespaces(fakeClientset)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"antrea-system", "flow-visibility", "kube-custom", "kube-system", "observability"}, namespaces)
+}
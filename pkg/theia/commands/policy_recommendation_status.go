@@ -16,10 +16,12 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
 
-	"antrea.io/theia/pkg/util"
+	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 )
 
 // policyRecommendationStatusCmd represents the policy-recommendation status command
@@ -27,7 +29,14 @@ var policyRecommendationStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Check the status of a policy recommendation job",
 	Long: `Check the current status of a policy recommendation job by name.
-It will return the status of this policy recommendation job like SUBMITTED, RUNNING, COMPLETED, or FAILED.`,
+It will return the status of this policy recommendation job like SUBMITTED, RUNNING, COMPLETED, or FAILED,
+and the status of its canary rollout if it is enabled. Jobs are QUEUED when the
+maximum number of concurrent jobs of Theia Manager is reached, until a running
+job ends.
+Without a name, or with --all, the status and the progress of all the policy
+recommendation jobs are returned in a table, to triage several jobs at a glance.
+The name latest refers to the job with the most recently created Spark
+application.`,
 	Args: cobra.RangeArgs(0, 1),
 	Example: `
 Check the current status of job with name pr-e998433e-accb-4888-9fc8-06563f073e86
@@ -36,6 +45,10 @@ Or
 $ theia policy-recommendation status pr-e998433e-accb-4888-9fc8-06563f073e86
 Use Service ClusterIP when checking the current status of job with name pr-e998433e-accb-4888-9fc8-06563f073e86
 $ theia policy-recommendation status pr-e998433e-accb-4888-9fc8-06563f073e86 --use-cluster-ip
+Check the current status of all the jobs
+$ theia policy-recommendation status --all
+Check the current status of the most recently created job
+$ theia policy-recommendation status latest
 `,
 	RunE: policyRecommendationStatus,
 }
@@ -46,53 +59,38 @@ func init() {
 		"name",
 		"",
 		"",
-		"Name of the policy recommendation job.",
+		"Name of the policy recommendation job, or latest for the most recently created one.",
 	)
+	policyRecommendationStatusCmd.Flags().Bool(
+		"all",
+		false,
+		"Check the status of all the policy recommendation jobs.",
+	)
+	policyRecommendationStatusCmd.RegisterFlagCompletionFunc("name", completeJobNames(policyRecommendationResource))
+	policyRecommendationStatusCmd.ValidArgsFunction = completeJobNameArg(policyRecommendationResource)
 }
 
 func policyRecommendationStatus(cmd *cobra.Command, args []string) error {
-	prName, err := cmd.Flags().GetString("name")
-	if err != nil {
-		return err
-	}
-	if prName == "" && len(args) == 1 {
-		prName = args[0]
-	}
-	err = util.ParseRecommendationName(prName)
-	if err != nil {
-		return err
-	}
-	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
-	if err != nil {
-		return err
-	}
-	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
-	if err != nil {
-		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
-	}
-	if pf != nil {
-		defer pf.Stop()
+	return policyRecommendationJobs.runStatus(cmd, args)
+}
+
+// printPolicyRecommendationCanary prints the status of the canary rollout of
+// a policy recommendation job, if it is enabled.
+func printPolicyRecommendationCanary(job runtime.Object) {
+	npr := job.(*intelligence.NetworkPolicyRecommendation)
+	canary := npr.Status.Canary
+	if canary == nil {
+		return
 	}
-	npr, err := getPolicyRecommendationByName(theiaClient, prName)
-	if err != nil {
-		return fmt.Errorf("error when getting policy recommendation job by using job name: %v", err)
+	fmt.Printf("Canary rollout in Namespace %s is %s\n", npr.Canary.Namespace, canary.Phase)
+	if !canary.SoakStartTime.IsZero() {
+		fmt.Printf("Soak window: %s starting at %s\n", npr.Canary.SoakWindow.Duration, canary.SoakStartTime.UTC().Format("2006-01-02 15:04:05"))
+		fmt.Printf("Flows which would have been denied: %d (maximum %d)\n", canary.DeniedFlows, npr.Canary.MaxDeniedFlows)
 	}
-	state := npr.Status.State
-	if state == "RUNNING" {
-		completedStages := npr.Status.CompletedStages
-		totalStages := npr.Status.TotalStages
-		var stateProgress string
-		if totalStages == 0 {
-			stateProgress = ": 0/0 (0%) stages completed"
-		} else {
-			stateProgress = fmt.Sprintf(": %d/%d (%d%%) stages completed", completedStages, totalStages, completedStages*100/totalStages)
-		}
-		state += stateProgress
+	if len(canary.AppliedPolicies) > 0 {
+		fmt.Printf("Applied policies: %s\n", strings.Join(canary.AppliedPolicies, ", "))
 	}
-	errorMessage := npr.Status.ErrorMsg
-	fmt.Printf("Status of this policy recommendation job is %s\n", state)
-	if errorMessage != "" {
-		fmt.Printf("Error message: %s\n", errorMessage)
+	if canary.Message != "" {
+		fmt.Printf("Canary message: %s\n", canary.Message)
 	}
-	return nil
 }
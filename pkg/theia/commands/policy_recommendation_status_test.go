@@ -23,23 +23,69 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 
 	intelligence "antrea.io/theia/pkg/apis/intelligence/v1alpha1"
 	"antrea.io/theia/pkg/theia/portforwarder"
+	"antrea.io/theia/pkg/util"
 )
 
 func TestPolicyRecommendationStatus(t *testing.T) {
+	listServer := func(nprList *intelligence.NetworkPolicyRecommendationList) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations":
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(nprList)
+			}
+		}))
+	}
+	nprList := &intelligence.NetworkPolicyRecommendationList{
+		Items: []intelligence.NetworkPolicyRecommendation{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "pr-running"},
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State:            "RUNNING",
+					SparkApplication: "pr-running",
+					CompletedStages:  2,
+					TotalStages:      8,
+					StartTime:        metav1.NewTime(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)),
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "pr-failed"},
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State:            "FAILED",
+					SparkApplication: "pr-failed",
+					ErrorMsg:         "driver OOMKilled",
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "pr-queued"},
+				Status: intelligence.NetworkPolicyRecommendationStatus{
+					State: "QUEUED",
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "pr-new"},
+			},
+		},
+	}
 	testCases := []struct {
 		name             string
 		testServer       *httptest.Server
 		expectedMsg      []string
+		unexpectedMsg    []string
 		expectedErrorMsg string
 		nprName          string
+		all              bool
 	}{
 		{
 			name: "Valid case",
@@ -47,6 +93,9 @@ func TestPolicyRecommendationStatus(t *testing.T) {
 				switch strings.TrimSpace(r.URL.Path) {
 				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
 					npr := &intelligence.NetworkPolicyRecommendation{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{util.CorrelationIDAnnotation: "5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c"},
+						},
 						Status: intelligence.NetworkPolicyRecommendationStatus{
 							State:           "RUNNING",
 							CompletedStages: 1,
@@ -63,6 +112,7 @@ func TestPolicyRecommendationStatus(t *testing.T) {
 			expectedMsg: []string{
 				"Status of this policy recommendation job is RUNNING: 1/5 (20%) stages completed",
 				"Error message: testErrorMsg",
+				"Correlation ID: 5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c",
 			},
 			expectedErrorMsg: "",
 		},
@@ -86,6 +136,80 @@ func TestPolicyRecommendationStatus(t *testing.T) {
 			expectedMsg:      []string{"Status of this policy recommendation job is RUNNING: 0/0 (0%) stages completed"},
 			expectedErrorMsg: "",
 		},
+		{
+			name: "Valid case with canary rollout",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch strings.TrimSpace(r.URL.Path) {
+				case fmt.Sprintf("/apis/intelligence.theia.antrea.io/v1alpha1/networkpolicyrecommendations/%s", nprName):
+					npr := &intelligence.NetworkPolicyRecommendation{
+						Canary: &intelligence.NetworkPolicyRecommendationCanary{
+							Namespace:      "default",
+							SoakWindow:     metav1.Duration{Duration: time.Hour},
+							MaxDeniedFlows: 10,
+						},
+						Status: intelligence.NetworkPolicyRecommendationStatus{
+							State: "COMPLETED",
+							Canary: &intelligence.NetworkPolicyRecommendationCanaryStatus{
+								Phase:           "SOAKING",
+								SoakStartTime:   metav1.NewTime(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)),
+								DeniedFlows:     3,
+								AppliedPolicies: []string{"NetworkPolicy/default/recommend-allow-anp-nxvqg", "ClusterNetworkPolicy/recommend-reject-all-acnp"},
+							},
+						},
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(npr)
+				}
+			})),
+			nprName: nprName,
+			expectedMsg: []string{
+				"Status of this policy recommendation job is COMPLETED",
+				"Canary rollout in Namespace default is SOAKING",
+				"Soak window: 1h0m0s starting at 2023-05-01 10:00:00",
+				"Flows which would have been denied: 3 (maximum 10)",
+				"Applied policies: NetworkPolicy/default/recommend-allow-anp-nxvqg, ClusterNetworkPolicy/recommend-reject-all-acnp",
+			},
+			expectedErrorMsg: "",
+		},
+		{
+			name:       "All jobs",
+			testServer: listServer(nprList),
+			all:        true,
+			expectedMsg: []string{
+				"Name           Status         Progress       StartTime           ErrorMessage",
+				"pr-running     RUNNING        2/8 (25%)      2023-05-01 10:00:00 N/A",
+				"pr-failed      FAILED         N/A            N/A                 driver OOMKilled",
+				"pr-queued      QUEUED         N/A            N/A                 N/A",
+			},
+			unexpectedMsg: []string{"pr-new"},
+		},
+		{
+			name:        "All jobs without name",
+			testServer:  listServer(nprList),
+			expectedMsg: []string{"pr-running     RUNNING        2/8 (25%)"},
+		},
+		{
+			name:        "No job",
+			testServer:  listServer(&intelligence.NetworkPolicyRecommendationList{}),
+			all:         true,
+			expectedMsg: []string{"No policy recommendation job found"},
+		},
+		{
+			name:             "Name with all",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			nprName:          nprName,
+			all:              true,
+			expectedErrorMsg: "a job name cannot be specified with --all",
+		},
+		{
+			name: "List error",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			all:              true,
+			expectedErrorMsg: "error when getting policy recommendation job list",
+		},
 		{
 			name: "NetworkPolicyRecommendation not found",
 			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -174,6 +298,7 @@ func TestPolicyRecommendationStatus(t *testing.T) {
 			default:
 				cmd.Flags().String("name", tt.nprName, "")
 				cmd.Flags().Bool("use-cluster-ip", true, "")
+				cmd.Flags().Bool("all", tt.all, "")
 			}
 
 			orig := os.Stdout
@@ -191,6 +316,9 @@ func TestPolicyRecommendationStatus(t *testing.T) {
 				for _, msg := range tt.expectedMsg {
 					assert.Contains(t, outcome, msg)
 				}
+				for _, msg := range tt.unexpectedMsg {
+					assert.NotContains(t, outcome, msg)
+				}
 			} else {
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
@@ -18,14 +18,22 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/util/clickhouse"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var (
 	verbose = 0
-	rootCmd = &cobra.Command{
+	// correlationID identifies the running command. It is set on the jobs
+	// created by the command, so that they can be traced in the logs of the
+	// Theia Manager and of the Spark jobs, and in the query log of ClickHouse.
+	correlationID string
+	rootCmd       = &cobra.Command{
 		Use:   "theia",
 		Short: "theia is the command line tool for Theia",
 		Long: `theia is the command line tool for Theia which provides access 
@@ -37,7 +45,12 @@ to Theia network flow visibility capabilities`,
 			}
 			var l klog.Level
 			l.Set(fmt.Sprint(verboseLevel))
-			return nil
+			correlationID = uuid.New().String()
+			startCommandSpan(cmd)
+			if len(impersonateGroups) > 0 && impersonateUser == "" {
+				return fmt.Errorf("--as-group requires --as to be specified")
+			}
+			return applyTheiaContext(cmd)
 		},
 	}
 )
@@ -46,17 +59,104 @@ to Theia network flow visibility capabilities`,
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := rootCmd.Execute()
+	endCommandSpan(err)
 	if err != nil {
+		printClickHouseHint(err)
 		os.Exit(1)
 	}
 }
 
+// ExecuteArgs runs the command given by args, e.g. "policy-recommendation
+// status NAME", like Execute but without exiting, and returns its error. It
+// allows to run several commands in the same process, e.g. in the e2e tests,
+// and resets the flags set by the previous commands before running it.
+func ExecuteArgs(args []string) error {
+	if err := resetFlags(rootCmd); err != nil {
+		return err
+	}
+	rootCmd.SetArgs(args)
+	defer rootCmd.SetArgs(nil)
+	err := rootCmd.Execute()
+	endCommandSpan(err)
+	printClickHouseHint(err)
+	return err
+}
+
+// printClickHouseHint prints after the error of a command, as printed by
+// cobra, how to remediate the ClickHouse error it is caused by, if any. The
+// errors classified by the Theia Manager already include their hint.
+func printClickHouseHint(err error) {
+	if err == nil {
+		return
+	}
+	if hint := clickhouse.GetHint(err.Error()); hint != "" {
+		fmt.Fprintf(os.Stderr, "Hint: %s\n", hint)
+	}
+}
+
+// resetFlags restores the default values of the flags of the command and of
+// its subcommands which were set by a previous execution, as cobra keeps them.
+func resetFlags(cmd *cobra.Command) error {
+	var err error
+	reset := func(flag *pflag.Flag) {
+		if !flag.Changed || err != nil {
+			return
+		}
+		if value, ok := flag.Value.(pflag.SliceValue); ok {
+			err = value.Replace(nil)
+		} else {
+			err = flag.Value.Set(flag.DefValue)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to reset flag %s of command %s: %v", flag.Name, cmd.Name(), err)
+			return
+		}
+		flag.Changed = false
+	}
+	cmd.PersistentFlags().VisitAll(reset)
+	cmd.Flags().VisitAll(reset)
+	if err != nil {
+		return err
+	}
+	for _, child := range cmd.Commands() {
+		if err := resetFlags(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.PersistentFlags().IntVarP(&verbose, "verbose", "v", 0, "set verbose level")
 	rootCmd.PersistentFlags().StringP(
 		"kubeconfig",
 		"k",
 		"",
-		"absolute path to the k8s config file, will use $KUBECONFIG if not specified",
+		"path to the k8s config file, will use $KUBECONFIG, ~/.kube/config or the in-cluster config if not specified",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&impersonateUser,
+		"as",
+		"",
+		"username to impersonate when accessing the cluster, the user can be a regular user or a service account",
+	)
+	rootCmd.PersistentFlags().StringArrayVar(
+		&impersonateGroups,
+		"as-group",
+		nil,
+		"group to impersonate when accessing the cluster, this flag can be repeated to specify multiple groups",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&theiaNamespace,
+		"theia-namespace",
+		theiaNamespace,
+		"Namespace of the Theia instance to access, will use the Namespace of the current Theia context if not specified",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&theiaContextName,
+		"context",
+		"",
+		"name of the Theia context to use, will use the current Theia context if not specified",
 	)
+	rootCmd.RegisterFlagCompletionFunc("context", completeContextNames)
 }
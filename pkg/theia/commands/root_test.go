@@ -0,0 +1,58 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetFlags(t *testing.T) {
+	var names []string
+	var limit int
+	var wait bool
+	root := &cobra.Command{Use: "theia"}
+	root.PersistentFlags().StringArray("as-group", nil, "")
+	child := &cobra.Command{
+		Use: "run",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, _ = cmd.Flags().GetStringArray("as-group")
+			limit, _ = cmd.Flags().GetInt("limit")
+			wait, _ = cmd.Flags().GetBool("wait")
+			return nil
+		},
+	}
+	child.Flags().Int("limit", 10, "")
+	child.Flags().Bool("wait", false, "")
+	root.AddCommand(child)
+
+	root.SetArgs([]string{"run", "--as-group", "a", "--limit", "5", "--wait"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, []string{"a"}, names)
+	assert.Equal(t, 5, limit)
+	assert.True(t, wait)
+
+	// The flags of the previous execution are not kept.
+	require.NoError(t, resetFlags(root))
+	root.SetArgs([]string{"run", "--as-group", "b"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, []string{"b"}, names)
+	assert.Equal(t, 10, limit)
+	assert.False(t, wait)
+	assert.False(t, child.Flags().Changed("limit"))
+}
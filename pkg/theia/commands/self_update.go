@@ -0,0 +1,235 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/spf13/cobra"
+)
+
+const (
+	releaseBinaryURL = "https://github.com/antrea-io/theia/releases/download/%s/theia-%s"
+	// The SHA-256 checksums of the release assets, in the format of
+	// sha256sum.
+	releaseChecksumsURL = "https://github.com/antrea-io/theia/releases/download/%s/sha256sums.txt"
+)
+
+var (
+	executablePath = os.Executable
+	goos, goarch   = runtime.GOOS, runtime.GOARCH
+)
+
+// selfUpdateCmd represents the self-update command
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Replace this CLI with the CLI of another Theia release",
+	Long: `Replace this CLI with the CLI of another Theia release, downloaded from the
+Theia repository. With --to-match-cluster, the CLI of the same version as the
+Theia deployed in the cluster is installed, which the Theia Manager publishes.
+The downloaded CLI is verified against the SHA-256 checksum published with the
+release, and not installed if the release publishes no checksum, unless
+--skip-verify is given.`,
+	Args: cobra.NoArgs,
+	Example: `
+Install the CLI of the same version as Theia
+$ theia self-update --to-match-cluster
+Install the CLI of Theia v0.8.0
+$ theia self-update --version v0.8.0
+`,
+	RunE: selfUpdate,
+}
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+	selfUpdateCmd.Flags().String(
+		"version",
+		"",
+		"The Theia release of the CLI to install, e.g. v0.8.0.",
+	)
+	selfUpdateCmd.Flags().Bool(
+		"to-match-cluster",
+		false,
+		"Install the CLI of the same version as the Theia deployed in the cluster.",
+	)
+	selfUpdateCmd.Flags().Bool(
+		"skip-verify",
+		false,
+		"Install the CLI without verifying its checksum, e.g. for the releases which publish no checksum.",
+	)
+}
+
+func selfUpdate(cmd *cobra.Command, args []string) error {
+	targetVersion, err := cmd.Flags().GetString("version")
+	if err != nil {
+		return err
+	}
+	toMatchCluster, err := cmd.Flags().GetBool("to-match-cluster")
+	if err != nil {
+		return err
+	}
+	skipVerify, err := cmd.Flags().GetBool("skip-verify")
+	if err != nil {
+		return err
+	}
+	if (targetVersion != "" && toMatchCluster) || (targetVersion == "" && !toMatchCluster) {
+		return fmt.Errorf("exactly one of --version and --to-match-cluster should be specified")
+	}
+	if toMatchCluster {
+		if targetVersion, err = getTheiaVersion(cmd); err != nil {
+			return fmt.Errorf("error when getting the Theia version: %v", err)
+		}
+	}
+	target, err := semver.ParseTolerant(targetVersion)
+	if err != nil {
+		return fmt.Errorf("invalid version %s: %v", targetVersion, err)
+	}
+	// Only the released versions have a CLI binary, and they have no
+	// pre-release or build information.
+	if len(target.Pre) > 0 || len(target.Build) > 0 {
+		return fmt.Errorf("version %s is not a Theia release", targetVersion)
+	}
+	release := "v" + target.String()
+	if cliVersion() == release {
+		fmt.Printf("theia is already at version %s\n", release)
+		return nil
+	}
+	suffix, err := releaseBinarySuffix(goos, goarch)
+	if err != nil {
+		return err
+	}
+	executable, err := executablePath()
+	if err != nil {
+		return fmt.Errorf("error when getting the path of theia: %v", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fmt.Errorf("error when getting the path of theia: %v", err)
+	}
+	checksum := ""
+	if !skipVerify {
+		if checksum, err = getReleaseChecksum(release, "theia-"+suffix); err != nil {
+			return err
+		}
+	}
+	if err := downloadExecutable(fmt.Sprintf(releaseBinaryURL, release, suffix), executable, checksum); err != nil {
+		return err
+	}
+	fmt.Printf("theia is updated to version %s\n", release)
+	return nil
+}
+
+// releaseBinarySuffix returns the suffix of the name of the CLI binary of a
+// platform among the release assets.
+func releaseBinarySuffix(goos, goarch string) (string, error) {
+	arch := goarch
+	if goarch == "amd64" {
+		arch = "x86_64"
+	}
+	switch goos + "/" + goarch {
+	case "linux/amd64", "linux/arm64", "linux/arm", "darwin/amd64", "darwin/arm64":
+		return goos + "-" + arch, nil
+	case "windows/amd64", "windows/arm64":
+		return goos + "-" + arch + ".exe", nil
+	}
+	return "", fmt.Errorf("no Theia release of the CLI for %s/%s", goos, goarch)
+}
+
+// getReleaseChecksum returns the SHA-256 checksum of an asset of a release,
+// from the checksums published with the release.
+func getReleaseChecksum(release, asset string) (string, error) {
+	url := fmt.Sprintf(releaseChecksumsURL, release)
+	resp, err := httpGet(url)
+	if err != nil {
+		return "", fmt.Errorf("error when downloading %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("release %s publishes no checksum, use --skip-verify to install the CLI without verifying it", release)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error when downloading %s: %s", url, resp.Status)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		// Each line is the checksum and the name of an asset, which is
+		// prefixed with * for the checksums computed in binary mode.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error when downloading %s: %v", url, err)
+	}
+	return "", fmt.Errorf("release %s publishes no checksum of %s, use --skip-verify to install the CLI without verifying it", release, asset)
+}
+
+// downloadExecutable downloads the executable at url and replaces the
+// executable at path with it, after verifying its SHA-256 checksum unless
+// checksum is empty. The executable is downloaded next to the replaced one,
+// so that it is renamed on the same filesystem and the replaced executable is
+// left unchanged if the download or the verification fails.
+func downloadExecutable(url, path, checksum string) error {
+	resp, err := httpGet(url)
+	if err != nil {
+		return fmt.Errorf("error when downloading %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error when downloading %s: %s", url, resp.Status)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error when creating the new executable: %v", err)
+	}
+	defer os.Remove(file.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error when downloading %s: %v", url, err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); checksum != "" && actual != checksum {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, checksum, actual)
+	}
+	if err := os.Chmod(file.Name(), 0755); err != nil {
+		return fmt.Errorf("error when making the new executable executable: %v", err)
+	}
+	// A running executable cannot be replaced on Windows, but it can be
+	// renamed.
+	if goos == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("error when moving the current executable: %v", err)
+		}
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("error when replacing the current executable: %v", err)
+	}
+	return nil
+}
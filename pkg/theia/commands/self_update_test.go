@@ -0,0 +1,207 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"antrea.io/theia/pkg/apiserver/certificate"
+	"antrea.io/theia/pkg/theia/commands/config"
+)
+
+func TestSelfUpdate(t *testing.T) {
+	newTheiaSum := sha256.Sum256([]byte("new theia"))
+	newTheiaChecksum := hex.EncodeToString(newTheiaSum[:])
+	checksums := newTheiaChecksum + "  theia-linux-x86_64\n" + newTheiaChecksum + " *theia-windows-x86_64.exe\n"
+	for _, tc := range []struct {
+		name             string
+		version          string
+		toMatchCluster   bool
+		skipVerify       bool
+		goos             string
+		checksums        string
+		statusCode       int
+		expectedURL      string
+		expectedMsg      string
+		expectedErrorMsg string
+	}{
+		{
+			name:        "Given version",
+			version:     "0.9.0",
+			goos:        "linux",
+			checksums:   checksums,
+			statusCode:  http.StatusOK,
+			expectedURL: "https://github.com/antrea-io/theia/releases/download/v0.9.0/theia-linux-x86_64",
+			expectedMsg: "theia is updated to version v0.9.0\n",
+		},
+		{
+			name:           "Version of the cluster",
+			toMatchCluster: true,
+			goos:           "windows",
+			checksums:      checksums,
+			statusCode:     http.StatusOK,
+			expectedURL:    "https://github.com/antrea-io/theia/releases/download/v0.8.1/theia-windows-x86_64.exe",
+			expectedMsg:    "theia is updated to version v0.8.1\n",
+		},
+		{
+			name:        "Same version",
+			version:     "v0.7.0",
+			goos:        "linux",
+			expectedMsg: "theia is already at version v0.7.0\n",
+		},
+		{
+			name:             "Checksum mismatch",
+			version:          "v0.9.0",
+			goos:             "linux",
+			checksums:        strings.Repeat("0", 64) + "  theia-linux-x86_64\n",
+			statusCode:       http.StatusOK,
+			expectedURL:      "https://github.com/antrea-io/theia/releases/download/v0.9.0/theia-linux-x86_64",
+			expectedErrorMsg: "checksum mismatch for https://github.com/antrea-io/theia/releases/download/v0.9.0/theia-linux-x86_64: expected " + strings.Repeat("0", 64) + ", got " + newTheiaChecksum,
+		},
+		{
+			name:             "No checksum published",
+			version:          "v0.9.0",
+			goos:             "linux",
+			statusCode:       http.StatusOK,
+			expectedErrorMsg: "release v0.9.0 publishes no checksum, use --skip-verify to install the CLI without verifying it",
+		},
+		{
+			name:             "No checksum of the platform",
+			version:          "v0.9.0",
+			goos:             "darwin",
+			checksums:        checksums,
+			statusCode:       http.StatusOK,
+			expectedErrorMsg: "release v0.9.0 publishes no checksum of theia-darwin-x86_64, use --skip-verify to install the CLI without verifying it",
+		},
+		{
+			name:        "Verification skipped",
+			version:     "v0.9.0",
+			skipVerify:  true,
+			goos:        "linux",
+			statusCode:  http.StatusOK,
+			expectedURL: "https://github.com/antrea-io/theia/releases/download/v0.9.0/theia-linux-x86_64",
+			expectedMsg: "theia is updated to version v0.9.0\n",
+		},
+		{
+			name:             "Release not found",
+			version:          "v0.9.0",
+			goos:             "darwin",
+			skipVerify:       true,
+			statusCode:       http.StatusNotFound,
+			expectedURL:      "https://github.com/antrea-io/theia/releases/download/v0.9.0/theia-darwin-x86_64",
+			expectedErrorMsg: "error when downloading https://github.com/antrea-io/theia/releases/download/v0.9.0/theia-darwin-x86_64: 404 Not Found",
+		},
+		{
+			name:             "Unreleased version",
+			version:          "v0.9.0-dev",
+			expectedErrorMsg: "version v0.9.0-dev is not a Theia release",
+		},
+		{
+			name:             "No version",
+			expectedErrorMsg: "exactly one of --version and --to-match-cluster should be specified",
+		},
+		{
+			name:             "Unsupported platform",
+			version:          "v0.9.0",
+			goos:             "freebsd",
+			expectedErrorMsg: "no Theia release of the CLI for freebsd/amd64",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			executable := filepath.Join(t.TempDir(), "theia")
+			require.NoError(t, os.WriteFile(executable, []byte("v0.7.0"), 0755))
+			var requestedURL string
+			oldHTTPGet, oldExecutablePath, oldCLIVersion, oldCreateK8sClient := httpGet, executablePath, cliVersion, CreateK8sClient
+			oldGOOS, oldGOARCH := goos, goarch
+			defer func() {
+				httpGet, executablePath, cliVersion, CreateK8sClient = oldHTTPGet, oldExecutablePath, oldCLIVersion, oldCreateK8sClient
+				goos, goarch = oldGOOS, oldGOARCH
+			}()
+			httpGet = func(url string) (*http.Response, error) {
+				if strings.HasSuffix(url, "/sha256sums.txt") {
+					if tc.checksums == "" {
+						return &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: io.NopCloser(strings.NewReader(""))}, nil
+					}
+					return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: io.NopCloser(strings.NewReader(tc.checksums))}, nil
+				}
+				requestedURL = url
+				return &http.Response{
+					StatusCode: tc.statusCode,
+					Status:     fmt.Sprintf("%d %s", tc.statusCode, http.StatusText(tc.statusCode)),
+					Body:       io.NopCloser(strings.NewReader("new theia")),
+				}, nil
+			}
+			executablePath = func() (string, error) { return executable, nil }
+			cliVersion = func() string { return "v0.7.0" }
+			goos, goarch = tc.goos, "amd64"
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(&v1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        config.CAConfigMapName,
+						Namespace:   config.FlowVisibilityNS,
+						Annotations: map[string]string{certificate.VersionAnnotation: "v0.8.1"},
+					},
+				}), nil
+			}
+			cmd := new(cobra.Command)
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().String("version", tc.version, "")
+			cmd.Flags().Bool("to-match-cluster", tc.toMatchCluster, "")
+			cmd.Flags().Bool("skip-verify", tc.skipVerify, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := selfUpdate(cmd, nil)
+			outcome := readStdout(t, r, w)
+			assert.Equal(t, tc.expectedURL, requestedURL)
+			data, readErr := os.ReadFile(executable)
+			require.NoError(t, readErr)
+			if tc.expectedErrorMsg != "" {
+				assert.EqualError(t, err, tc.expectedErrorMsg)
+				assert.Equal(t, "v0.7.0", string(data))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedMsg, outcome)
+			if tc.expectedURL != "" {
+				assert.Equal(t, "new theia", string(data))
+			}
+			files, _ := os.ReadDir(filepath.Dir(executable))
+			if tc.goos == "windows" {
+				assert.Len(t, files, 2)
+			} else {
+				assert.Len(t, files, 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/util/format"
+)
+
+const (
+	antreaAgentLabelSelector = "app=antrea,component=antrea-agent"
+	antreaAgentConfigKey     = "antrea-agent.conf"
+	antreaAgentReady         = "Ready"
+	antreaAgentNotReady      = "NotReady"
+	antreaAgentMissing       = "Missing"
+	antreaAgentUnknown       = "Unknown"
+)
+
+// statusNodesCmd represents the status nodes command
+var statusNodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "Check the flow visibility coverage of the Nodes",
+	Long: `Compare the Nodes of the cluster with the Nodes seen in the flows which
+ended during the given window, and report the percentage of Nodes with flow
+visibility, along with the Nodes which lack it. A Node lacks visibility when
+none of its flows was stored in Theia during the window, e.g. because its
+Antrea Agent is not running or does not export flows. The Antrea Agent of
+every Node, and whether the FlowExporter is enabled in the configuration of
+the Antrea Agents, are reported too. Policy recommendation and anomaly
+detection jobs only consider the flows of the Nodes with visibility.`,
+	Args: cobra.NoArgs,
+	Example: `
+Check the flow visibility coverage of the Nodes over the last hour
+$ theia status nodes
+Check the flow visibility coverage of the Nodes over the last 24 hours
+$ theia status nodes --window 24h
+`,
+	RunE: statusNodes,
+}
+
+func init() {
+	statusCmd.AddCommand(statusNodesCmd)
+	statusNodesCmd.Flags().Duration(
+		"window",
+		time.Hour,
+		"The duration before now over which the flows of the Nodes are looked for.",
+	)
+	statusNodesCmd.Flags().String(
+		"antrea-namespace",
+		"kube-system",
+		"The Namespace of the Antrea Agents.",
+	)
+}
+
+// nodeCoverage is the flow visibility status of a Node.
+type nodeCoverage struct {
+	name        string
+	antreaAgent string
+	flows       string
+	lastFlowEnd string
+}
+
+func (n *nodeCoverage) covered() bool {
+	return n.flows != ""
+}
+
+func statusNodes(cmd *cobra.Command, args []string) error {
+	window, err := cmd.Flags().GetDuration("window")
+	if err != nil {
+		return err
+	}
+	if window <= 0 {
+		return fmt.Errorf("window should be a positive duration")
+	}
+	antreaNamespace, err := cmd.Flags().GetString("antrea-namespace")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+	}
+	k8sClient, err := CreateK8sClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+	}
+	nodes, err := k8sClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error when listing Nodes: %v", err)
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	flowStats, err := getFlowStatsByCategory(theiaClient, "nodes", window, "", "")
+	if err != nil {
+		return fmt.Errorf("error when getting the flows of the Nodes: %v", err)
+	}
+
+	// The status of the Antrea Agents is informative only, so that the
+	// coverage is reported even if the user cannot read them.
+	agents, err := getAntreaAgentStatus(k8sClient, antreaNamespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't get the status of the Antrea Agents: %v\n", err)
+	}
+	flowExporter, err := getFlowExporterStatus(k8sClient, antreaNamespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't get the configuration of the Antrea Agents: %v\n", err)
+	}
+
+	coverages := getNodeCoverages(nodes.Items, flowStats.Nodes, agents)
+	result := [][]string{{"Node", "AntreaAgent", "Flows", "LastFlowEnd", "Visibility"}}
+	var uncoveredNodes []string
+	for _, node := range coverages {
+		visibility := "Yes"
+		if !node.covered() {
+			visibility = "No"
+			uncoveredNodes = append(uncoveredNodes, node.name)
+		}
+		flows, lastFlowEnd := node.flows, node.lastFlowEnd
+		if !node.covered() {
+			flows, lastFlowEnd = "0", "N/A"
+		}
+		result = append(result, []string{node.name, node.antreaAgent, flows, lastFlowEnd, visibility})
+	}
+	TableOutput(result)
+	fmt.Println()
+	coveredNodes := len(coverages) - len(uncoveredNodes)
+	var percentage float64
+	if len(coverages) > 0 {
+		percentage = float64(coveredNodes) * 100 / float64(len(coverages))
+	}
+	fmt.Printf("Flow visibility coverage in the last %s: %d/%d Nodes (%s)\n", flowStats.Window, coveredNodes, len(coverages), format.Percentage(percentage))
+	if len(uncoveredNodes) > 0 {
+		fmt.Printf("Nodes lacking flow visibility: %s\n", strings.Join(uncoveredNodes, ", "))
+	}
+	if flowExporter != "" {
+		fmt.Printf("FlowExporter of the Antrea Agents: %s\n", flowExporter)
+	}
+	return nil
+}
+
+// getNodeCoverages joins the Nodes of the cluster with the Nodes seen in the
+// flows and the status of their Antrea Agents. Nodes seen in the flows which
+// are no longer part of the cluster are ignored.
+func getNodeCoverages(nodes []corev1.Node, nodeFlows []stats.NodeFlowStats, agents map[string]string) []*nodeCoverage {
+	flowsByNode := make(map[string]stats.NodeFlowStats, len(nodeFlows))
+	for _, nodeFlow := range nodeFlows {
+		flowsByNode[nodeFlow.Name] = nodeFlow
+	}
+	coverages := make([]*nodeCoverage, 0, len(nodes))
+	for _, node := range nodes {
+		coverage := &nodeCoverage{name: node.Name, antreaAgent: antreaAgentUnknown}
+		if agents != nil {
+			coverage.antreaAgent = antreaAgentMissing
+			if agent, ok := agents[node.Name]; ok {
+				coverage.antreaAgent = agent
+			}
+		}
+		if nodeFlow, ok := flowsByNode[node.Name]; ok {
+			coverage.flows = nodeFlow.Flows
+			coverage.lastFlowEnd = nodeFlow.LastFlowEnd
+			if lastFlowEnd, err := time.Parse(time.RFC3339, nodeFlow.LastFlowEnd); err == nil {
+				coverage.lastFlowEnd = FormatTimestamp(lastFlowEnd)
+			}
+		}
+		coverages = append(coverages, coverage)
+	}
+	sort.Slice(coverages, func(i, j int) bool {
+		return coverages[i].name < coverages[j].name
+	})
+	return coverages
+}
+
+// getAntreaAgentStatus returns the readiness of the Antrea Agent of every
+// Node.
+func getAntreaAgentStatus(k8sClient kubernetes.Interface, namespace string) (map[string]string, error) {
+	pods, err := k8sClient.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: antreaAgentLabelSelector})
+	if err != nil {
+		return nil, err
+	}
+	agents := make(map[string]string, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		agents[pod.Spec.NodeName] = antreaAgentNotReady
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				agents[pod.Spec.NodeName] = antreaAgentReady
+			}
+		}
+	}
+	return agents, nil
+}
+
+// getFlowExporterStatus tells whether the FlowExporter is enabled in the
+// configuration of the Antrea Agents. It is enabled when the FlowExporter
+// feature gate is enabled and, starting with Antrea v1.13, when
+// flowExporter.enable is true.
+func getFlowExporterStatus(k8sClient kubernetes.Interface, namespace string) (string, error) {
+	configMaps, err := k8sClient.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "app=antrea"})
+	if err != nil {
+		return "", err
+	}
+	for _, configMap := range configMaps.Items {
+		agentConfig, ok := configMap.Data[antreaAgentConfigKey]
+		if !ok {
+			continue
+		}
+		var config struct {
+			FeatureGates map[string]bool `yaml:"featureGates"`
+			FlowExporter struct {
+				Enable *bool `yaml:"enable"`
+			} `yaml:"flowExporter"`
+		}
+		if err := yaml.Unmarshal([]byte(agentConfig), &config); err != nil {
+			return "", fmt.Errorf("error when parsing %s of ConfigMap %s: %v", antreaAgentConfigKey, configMap.Name, err)
+		}
+		if !config.FeatureGates["FlowExporter"] {
+			return "disabled, the FlowExporter feature gate is not enabled", nil
+		}
+		if config.FlowExporter.Enable != nil && !*config.FlowExporter.Enable {
+			return "disabled, flowExporter.enable is false", nil
+		}
+		return "enabled", nil
+	}
+	return "", fmt.Errorf("no ConfigMap with %s found in Namespace %s", antreaAgentConfigKey, namespace)
+}
@@ -0,0 +1,254 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func newTestNode(name string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func newTestAntreaAgent(nodeName string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "antrea-agent-" + nodeName,
+			Namespace: "kube-system",
+			Labels:    map[string]string{"app": "antrea", "component": "antrea-agent"},
+		},
+		Spec: v1.PodSpec{NodeName: nodeName},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
+
+func newTestAntreaConfig(agentConfig string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "antrea-config",
+			Namespace: "kube-system",
+			Labels:    map[string]string{"app": "antrea"},
+		},
+		Data: map[string]string{"antrea-agent.conf": agentConfig},
+	}
+}
+
+func TestStatusNodes(t *testing.T) {
+	nodeFlowsServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/stats.theia.antrea.io/v1alpha1/flows/nodes":
+				flowStats := &stats.FlowStats{
+					Window: r.URL.Query().Get("window"),
+					Nodes: []stats.NodeFlowStats{
+						{Name: "node-1", Flows: "1200", LastFlowEnd: "2023-09-01T10:00:00Z"},
+						{Name: "node-2", Flows: "300", LastFlowEnd: "2023-09-01T09:59:00Z"},
+						{Name: "deleted-node", Flows: "10", LastFlowEnd: "2023-09-01T09:00:00Z"},
+					},
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(flowStats)
+			}
+		}))
+	}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		objects          []runtime.Object
+		window           time.Duration
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			testServer: nodeFlowsServer(),
+			objects: []runtime.Object{
+				newTestNode("node-1"), newTestNode("node-2"), newTestNode("node-3"),
+				newTestAntreaAgent("node-1", true), newTestAntreaAgent("node-2", true), newTestAntreaAgent("node-3", false),
+				newTestAntreaConfig("featureGates:\n  FlowExporter: true\nflowExporter:\n  enable: true\n"),
+			},
+			window: 24 * time.Hour,
+			expectedMsg: []string{
+				"Node", "AntreaAgent", "Flows", "LastFlowEnd", "Visibility",
+				"node-1", "Ready", "1200", "2023-09-01 10:00:00", "Yes",
+				"node-3", "NotReady", "N/A", "No",
+				"Flow visibility coverage in the last 24h0m0s: 2/3 Nodes (66.67 %)",
+				"Nodes lacking flow visibility: node-3",
+				"FlowExporter of the Antrea Agents: enabled",
+			},
+		},
+		{
+			name:       "FlowExporter disabled",
+			testServer: nodeFlowsServer(),
+			objects: []runtime.Object{
+				newTestNode("node-1"), newTestNode("node-4"),
+				newTestAntreaAgent("node-1", true),
+				newTestAntreaConfig("featureGates:\n  FlowExporter: true\nflowExporter:\n  enable: false\n"),
+			},
+			window: time.Hour,
+			expectedMsg: []string{
+				"node-4", "Missing",
+				"Flow visibility coverage in the last 1h0m0s: 1/2 Nodes (50.00 %)",
+				"Nodes lacking flow visibility: node-4",
+				"FlowExporter of the Antrea Agents: disabled, flowExporter.enable is false",
+			},
+		},
+		{
+			name:       "Antrea Agents not found",
+			testServer: nodeFlowsServer(),
+			objects:    []runtime.Object{newTestNode("node-1"), newTestNode("node-2")},
+			window:     time.Hour,
+			expectedMsg: []string{
+				"node-1", "Missing",
+				"Flow visibility coverage in the last 1h0m0s: 2/2 Nodes (100.00 %)",
+			},
+		},
+		{
+			name: "Failed to get the flows of the Nodes",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			objects:          []runtime.Object{newTestNode("node-1")},
+			window:           time.Hour,
+			expectedErrorMsg: "error when getting the flows of the Nodes",
+		},
+		{
+			name:             "Invalid window",
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           -time.Hour,
+			expectedErrorMsg: "window should be a positive duration",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			window:           time.Hour,
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldSetupFunc := SetupTheiaClientAndConnection
+			oldCreateFunc := CreateK8sClient
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tt.objects...), nil
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldSetupFunc
+				CreateK8sClient = oldCreateFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().Duration("window", tt.window, "")
+			cmd.Flags().String("antrea-namespace", "kube-system", "")
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := statusNodes(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+				assert.NotContains(t, outcome, "deleted-node")
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestGetFlowExporterStatus(t *testing.T) {
+	testCases := []struct {
+		name             string
+		objects          []runtime.Object
+		expectedStatus   string
+		expectedErrorMsg string
+	}{
+		{
+			name:           "Enabled before Antrea v1.13",
+			objects:        []runtime.Object{newTestAntreaConfig("featureGates:\n  FlowExporter: true\n")},
+			expectedStatus: "enabled",
+		},
+		{
+			name:           "Feature gate disabled",
+			objects:        []runtime.Object{newTestAntreaConfig("featureGates:\n  Multicast: true\n")},
+			expectedStatus: "disabled, the FlowExporter feature gate is not enabled",
+		},
+		{
+			name:             "Invalid configuration",
+			objects:          []runtime.Object{newTestAntreaConfig("featureGates: [")},
+			expectedErrorMsg: "error when parsing antrea-agent.conf of ConfigMap antrea-config",
+		},
+		{
+			name:             "No configuration",
+			expectedErrorMsg: "no ConfigMap with antrea-agent.conf found in Namespace kube-system",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := getFlowExporterStatus(fake.NewSimpleClientset(tt.objects...), "kube-system")
+			if tt.expectedErrorMsg == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedStatus, status)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -19,7 +19,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -39,6 +38,9 @@ const (
 // Command is the support bundle command implementation.
 var Command *cobra.Command
 
+// Interval between two checks of the status of the support bundle collection.
+var supportBundlePollInterval = time.Second
+
 var option = &struct {
 	dir          string
 	since        string
@@ -76,6 +78,8 @@ Manager Service. It can only be used when running in cluster.`,
 	rootCmd.AddCommand(supportBundleCollectCmd)
 }
 
+// download waits for the support bundle to be collected by the Theia Manager,
+// and saves it as theia-support-bundle.tar.gz in downloadPath.
 func download(downloadPath string, client rest.Interface) error {
 	for {
 		var supportBundle v1alpha1.SupportBundle
@@ -87,47 +91,63 @@ func download(downloadPath string, client rest.Interface) error {
 		if err != nil {
 			return fmt.Errorf("error when getting support bundle status: %w", err)
 		}
-		if supportBundle.Status == v1alpha1.SupportBundleStatusCollected {
+		switch supportBundle.Status {
+		case v1alpha1.SupportBundleStatusCollected:
 			if len(downloadPath) == 0 {
-				break
-			}
-			fileName := path.Join(downloadPath, fmt.Sprintf("%s.tar.gz", "theia-support-bundle"))
-
-			f, err := os.Create(fileName)
-			if err != nil {
-				return fmt.Errorf("error when creating the support bundle tar gz: %w", err)
-			}
-			defer f.Close()
-			stream, err := client.Get().
-				AbsPath("/apis/system.theia.antrea.io/v1alpha1").
-				Resource("supportbundles").
-				Name(supportBundleResourceName).
-				SubResource("download").
-				Stream(context.TODO())
-			if err != nil {
-				return fmt.Errorf("error when downloading the support bundle: %w", err)
-			}
-			defer stream.Close()
-			if _, err := io.Copy(f, stream); err != nil {
-				return fmt.Errorf("error when downloading the support bundle: %w", err)
+				return nil
 			}
-			break
+			return saveSupportBundle(downloadPath, client)
+		case v1alpha1.SupportBundleStatusNone:
+			// The status is reset to None when the collection fails.
+			return fmt.Errorf("failed to collect the support bundle, check the logs of the Theia Manager")
 		}
+		time.Sleep(supportBundlePollInterval)
+	}
+}
+
+func saveSupportBundle(downloadPath string, client rest.Interface) error {
+	fileName := filepath.Join(downloadPath, fmt.Sprintf("%s.tar.gz", "theia-support-bundle"))
+	f, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("error when creating the support bundle tar gz: %w", err)
+	}
+	defer f.Close()
+	stream, err := client.Get().
+		AbsPath("/apis/system.theia.antrea.io/v1alpha1").
+		Resource("supportbundles").
+		Name(supportBundleResourceName).
+		SubResource("download").
+		Stream(context.TODO())
+	if err != nil {
+		return fmt.Errorf("error when downloading the support bundle: %w", err)
+	}
+	defer stream.Close()
+	if _, err := io.Copy(f, stream); err != nil {
+		return fmt.Errorf("error when downloading the support bundle: %w", err)
 	}
 	return nil
 }
 
 func collectSupportBundleRunE(cmd *cobra.Command, args []string) error {
+	if option.since != "" {
+		if since, err := time.ParseDuration(option.since); err != nil || since <= 0 {
+			return fmt.Errorf("since %q is not valid, it should be a positive duration like 5s, 2m or 3h", option.since)
+		}
+	}
 	if option.dir == "" {
 		cwd, _ := os.Getwd()
 		option.dir = filepath.Join(cwd, "support-bundles_"+time.Now().Format(timeFormat))
 	}
 
-	dir, err := filepath.Abs(option.dir)
+	dir, err := expandHome(option.dir)
+	if err != nil {
+		return err
+	}
+	dir, err = filepath.Abs(dir)
 	if err != nil {
 		return fmt.Errorf("error when resolving path '%s': %w", option.dir, err)
 	}
-	if err := os.MkdirAll(option.dir, 0700|os.ModeDir); err != nil {
+	if err := os.MkdirAll(dir, 0700|os.ModeDir); err != nil {
 		return fmt.Errorf("error when creating output dir: %w", err)
 	}
 
@@ -0,0 +1,143 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	"antrea.io/theia/pkg/apis/system/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+const supportBundlePath = "/apis/system.theia.antrea.io/v1alpha1/supportbundles"
+
+// newSupportBundleTestServer returns a Theia Manager which reports the given
+// statuses of the support bundle collection one after the other, the last one
+// being reported to all the following requests.
+func newSupportBundleTestServer(postStatus int, statuses ...v1alpha1.BundleStatus) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSpace(r.URL.Path) {
+		case supportBundlePath:
+			if postStatus != http.StatusCreated {
+				http.Error(w, http.StatusText(postStatus), postStatus)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(&v1alpha1.SupportBundle{Status: v1alpha1.SupportBundleStatusCollecting})
+		case supportBundlePath + "/" + supportBundleResourceName:
+			status := statuses[0]
+			if len(statuses) > 1 {
+				statuses = statuses[1:]
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(&v1alpha1.SupportBundle{Status: status})
+		case supportBundlePath + "/" + supportBundleResourceName + "/download":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("bundle content"))
+		default:
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCollectSupportBundle(t *testing.T) {
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		since            string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			testServer: newSupportBundleTestServer(http.StatusCreated, v1alpha1.SupportBundleStatusCollecting, v1alpha1.SupportBundleStatusCollected),
+			since:      "1h",
+		},
+		{
+			name:             "Invalid since",
+			testServer:       newSupportBundleTestServer(http.StatusCreated, v1alpha1.SupportBundleStatusCollected),
+			since:            "-1h",
+			expectedErrorMsg: "since \"-1h\" is not valid",
+		},
+		{
+			name:             "Failed to request support bundle",
+			testServer:       newSupportBundleTestServer(http.StatusForbidden),
+			expectedErrorMsg: "failed to request support bundle",
+		},
+		{
+			name:             "Failed to collect support bundle",
+			testServer:       newSupportBundleTestServer(http.StatusCreated, v1alpha1.SupportBundleStatusCollecting, v1alpha1.SupportBundleStatusNone),
+			expectedErrorMsg: "failed to collect the support bundle",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       newSupportBundleTestServer(http.StatusCreated, v1alpha1.SupportBundleStatusCollected),
+			expectedErrorMsg: "couldn't setup Theia manager client",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			oldInterval := supportBundlePollInterval
+			supportBundlePollInterval = 10 * time.Millisecond
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+				supportBundlePollInterval = oldInterval
+				option.dir = ""
+				option.since = ""
+			}()
+			option.dir = t.TempDir()
+			option.since = tt.since
+
+			err := collectSupportBundleRunE(new(cobra.Command), []string{})
+			if tt.expectedErrorMsg == "" {
+				require.NoError(t, err)
+				content, err := os.ReadFile(filepath.Join(option.dir, "theia-support-bundle.tar.gz"))
+				require.NoError(t, err)
+				assert.Equal(t, "bundle content", string(content))
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/util/tracing"
+)
+
+// Maximum time to wait for the spans of a command to be exported.
+const tracingShutdownTimeout = 5 * time.Second
+
+var (
+	// commandSpan is the span of the running command, which the spans of
+	// the K8s API calls are children of.
+	commandSpan     trace.Span
+	shutdownTracing func(context.Context) error
+)
+
+// startCommandSpan sets up the export of the traces if THEIA_OTEL_ENDPOINT is
+// set, and starts the span of the command.
+func startCommandSpan(cmd *cobra.Command) {
+	shutdown, err := tracing.Setup(context.Background(), "theia")
+	if err != nil {
+		klog.ErrorS(err, "Error when setting up the export of the traces")
+		return
+	}
+	shutdownTracing = shutdown
+	ctx, span := tracing.StartSpan(cmd.Context(), cmd.CommandPath(), attribute.String("theia.correlation_id", correlationID))
+	cmd.SetContext(ctx)
+	commandSpan = span
+}
+
+// getCorrelationID returns the correlation ID of the running command, which is
+// generated when the command starts.
+func getCorrelationID() string {
+	if correlationID == "" {
+		correlationID = uuid.New().String()
+	}
+	return correlationID
+}
+
+// endCommandSpan ends the span of the command, and exports the spans which
+// are not exported yet.
+func endCommandSpan(err error) {
+	if commandSpan != nil {
+		tracing.EndSpan(commandSpan, err)
+	}
+	if shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			klog.ErrorS(err, "Error when exporting the traces")
+		}
+	}
+}
+
+// commandSpanTransport makes the spans of the requests sent without a span in
+// their context, like the K8s API calls made with context.TODO(), children of
+// the span of the command.
+type commandSpanTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *commandSpanTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if commandSpan != nil && !trace.SpanContextFromContext(req.Context()).IsValid() {
+		req = req.WithContext(trace.ContextWithSpan(req.Context(), commandSpan))
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// wrapTransport records a span for every request sent to the K8s API.
+func wrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &commandSpanTransport{rt: tracing.WrapTransport(rt)}
+}
@@ -0,0 +1,294 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/spf13/cobra"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/clickhouse/schema"
+	"antrea.io/theia/pkg/util/format"
+	"antrea.io/theia/pkg/version"
+)
+
+// migrationBytesPerSecond is a conservative estimate of the rate at which a
+// ClickHouse shard rewrites data parts for mutations and copies between
+// tables, used to estimate the duration of a migration.
+const migrationBytesPerSecond = 50 * 1000 * 1000
+
+const (
+	preCheckPassed  = "OK"
+	preCheckWarning = "WARNING"
+	preCheckFailed  = "FAILED"
+)
+
+type preCheck struct {
+	name    string
+	status  string
+	details string
+}
+
+// shardEstimate is the estimated cost of a migration on a ClickHouse shard.
+type shardEstimate struct {
+	shard          string
+	rewrittenBytes uint64
+	tablesBytes    uint64
+	freeSpace      uint64
+}
+
+// upgradePreCheckCmd represents the upgrade pre-check command
+var upgradePreCheckCmd = &cobra.Command{
+	Use:   "pre-check",
+	Short: "Check that the data schema can be migrated to a Theia version",
+	Long: `Check that the ClickHouse data schema can be migrated to the given Theia
+version before upgrading Theia. The command verifies that the data schema is
+clean and that this CLI knows the migrators from its version to the target
+version, estimates the duration of the migration from the sizes of the tables
+it rewrites, checks that every shard has enough free disk space for the
+mutations and for a local backup of its tables, and lists the columns and
+tables dropped by the migration. It fails if any check fails.`,
+	Args: cobra.NoArgs,
+	Example: `
+Check the upgrade to Theia v0.8.0
+$ theia upgrade pre-check --to v0.8.0
+Check the upgrade to Theia v0.8.0, with bytes and durations as raw numbers
+$ theia upgrade pre-check --to v0.8.0 --raw
+`,
+	RunE: upgradePreCheck,
+}
+
+func init() {
+	upgradeCmd.AddCommand(upgradePreCheckCmd)
+	upgradePreCheckCmd.Flags().String(
+		"to",
+		"",
+		"The Theia version to upgrade to, e.g. v0.8.0.",
+	)
+	upgradePreCheckCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print bytes and durations as raw numbers instead of human-readable values.",
+	)
+	upgradePreCheckCmd.MarkFlagRequired("to")
+}
+
+func upgradePreCheck(cmd *cobra.Command, args []string) error {
+	to, err := cmd.Flags().GetString("to")
+	if err != nil {
+		return err
+	}
+	targetVersion, err := semver.ParseTolerant(to)
+	if err != nil {
+		return fmt.Errorf("invalid version %s: %v", to, err)
+	}
+	targetNumber, err := schema.VersionNumber(to)
+	if err != nil {
+		return err
+	}
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	schemaVersions, err := getClickHouseStatusByCategory(theiaClient, "schemaVersion")
+	if err != nil {
+		return fmt.Errorf("error when getting the schema version: %v", err)
+	}
+	tableInfo, err := getClickHouseStatusByCategory(theiaClient, "tableInfo")
+	if err != nil {
+		return fmt.Errorf("error when getting the table sizes: %v", err)
+	}
+	diskInfo, err := getClickHouseStatusByCategory(theiaClient, "diskInfo")
+	if err != nil {
+		return fmt.Errorf("error when getting the free disk space: %v", err)
+	}
+
+	currentNumber, versionCheck := checkSchemaVersion(schemaVersions.SchemaVersions)
+	checks := []preCheck{versionCheck}
+	var impact schema.Impact
+	pathCheck := preCheck{name: "Migration path"}
+	if versionCheck.status == preCheckFailed {
+		pathCheck.status, pathCheck.details = preCheckFailed, "the schema version is unknown"
+	} else if migrators, err := schema.Migrators(currentNumber, targetNumber); err != nil {
+		pathCheck.status, pathCheck.details = preCheckFailed, err.Error()
+	} else {
+		impact = schema.AnalyzeMigrators(migrators)
+		pathCheck.status = preCheckPassed
+		switch {
+		case currentNumber < targetNumber:
+			pathCheck.details = fmt.Sprintf("upgrade from schema version %d to %d", currentNumber, targetNumber)
+		case currentNumber > targetNumber:
+			pathCheck.details = fmt.Sprintf("downgrade from schema version %d to %d", currentNumber, targetNumber)
+		default:
+			pathCheck.details = fmt.Sprintf("no migration, the schema version is already %d", targetNumber)
+		}
+		// The migrators of the versions later than the CLI are unknown.
+		if cliVersion, err := semver.ParseTolerant(version.Version); err == nil {
+			cliVersion.Pre = nil
+			if targetVersion.GT(cliVersion) {
+				pathCheck.status = preCheckWarning
+				pathCheck.details += fmt.Sprintf(", the migrators of versions later than %s are unknown to this CLI, run the pre-check with the CLI of version %s", cliVersion, to)
+			}
+		}
+	}
+	checks = append(checks, pathCheck)
+	estimates := estimateShards(impact, tableInfo.TableInfos, diskInfo.DiskInfos)
+	printer := format.Printer{Raw: raw}
+	checks = append(checks, checkDiskSpace(estimates, printer))
+
+	result := [][]string{{"Check", "Status", "Details"}}
+	for _, check := range checks {
+		result = append(result, []string{check.name, check.status, check.details})
+	}
+	TableOutput(result)
+	fmt.Println()
+	result = [][]string{{"Shard", "RewrittenBytes", "EstimatedDuration", "TablesBytes", "FreeSpace"}}
+	for _, estimate := range estimates {
+		duration := time.Duration(float64(estimate.rewrittenBytes) / migrationBytesPerSecond * float64(time.Second))
+		result = append(result, []string{
+			estimate.shard,
+			printer.Bytes(strconv.FormatUint(estimate.rewrittenBytes, 10)),
+			printer.Duration(duration),
+			printer.Bytes(strconv.FormatUint(estimate.tablesBytes, 10)),
+			printer.Bytes(strconv.FormatUint(estimate.freeSpace, 10)),
+		})
+	}
+	TableOutput(result)
+	fmt.Println()
+	if len(impact.DroppedColumns) == 0 && len(impact.DroppedTables) == 0 {
+		fmt.Println("No breaking change")
+	} else {
+		fmt.Println("Breaking changes:")
+		for _, column := range impact.DroppedColumns {
+			fmt.Printf("  column %s is dropped or renamed\n", column)
+		}
+		for _, table := range impact.DroppedTables {
+			fmt.Printf("  table %s is dropped\n", table)
+		}
+	}
+	for _, check := range checks {
+		if check.status == preCheckFailed {
+			return fmt.Errorf("the upgrade pre-check failed")
+		}
+	}
+	return nil
+}
+
+// checkSchemaVersion returns the schema version shared by all the shards. The
+// check fails if the shards have different versions or if the last migration
+// of a shard failed.
+func checkSchemaVersion(schemaVersions []stats.SchemaVersion) (int, preCheck) {
+	check := preCheck{name: "Schema version", status: preCheckFailed}
+	if len(schemaVersions) == 0 {
+		check.details = "no schema version is recorded"
+		return 0, check
+	}
+	number := -1
+	for _, schemaVersion := range schemaVersions {
+		shardNumber, err := strconv.Atoi(schemaVersion.Version)
+		if err != nil {
+			check.details = fmt.Sprintf("invalid schema version %s of shard %s", schemaVersion.Version, schemaVersion.Shard)
+			return 0, check
+		}
+		if schemaVersion.Dirty == "1" {
+			check.details = fmt.Sprintf("the last migration of shard %s to schema version %d failed", schemaVersion.Shard, shardNumber)
+			return 0, check
+		}
+		if number != -1 && number != shardNumber {
+			check.details = fmt.Sprintf("shards have different schema versions %d and %d", number, shardNumber)
+			return 0, check
+		}
+		number = shardNumber
+	}
+	check.status = preCheckPassed
+	check.details = fmt.Sprintf("schema version %d on %d shard(s)", number, len(schemaVersions))
+	return number, check
+}
+
+// estimateShards returns the bytes rewritten by the migration, the bytes of
+// all the tables and the free disk space of every shard.
+func estimateShards(impact schema.Impact, tableInfos []stats.TableInfo, diskInfos []stats.DiskInfo) []shardEstimate {
+	rewritten := make(map[string]bool)
+	for _, table := range impact.RewrittenTables {
+		rewritten[table] = true
+	}
+	estimates := make(map[string]*shardEstimate)
+	getEstimate := func(shard string) *shardEstimate {
+		estimate, ok := estimates[shard]
+		if !ok {
+			estimate = &shardEstimate{shard: shard}
+			estimates[shard] = estimate
+		}
+		return estimate
+	}
+	for _, tableInfo := range tableInfos {
+		estimate := getEstimate(tableInfo.Shard)
+		bytes, _ := format.ParseBytes(rawStat(tableInfo.TotalBytesRaw, tableInfo.TotalBytes))
+		estimate.tablesBytes += bytes
+		if rewritten[tableInfo.TableName] {
+			estimate.rewrittenBytes += bytes
+		}
+	}
+	for _, diskInfo := range diskInfos {
+		freeSpace, _ := format.ParseBytes(rawStat(diskInfo.FreeSpaceRaw, diskInfo.FreeSpace))
+		getEstimate(diskInfo.Shard).freeSpace += freeSpace
+	}
+	var result []shardEstimate
+	for _, estimate := range estimates {
+		result = append(result, *estimate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].shard < result[j].shard
+	})
+	return result
+}
+
+// checkDiskSpace fails if a shard does not have enough free space for the
+// mutations, which write the new data parts before removing the old ones, and
+// warns if it does not have enough free space for a local backup of all its
+// tables in addition.
+func checkDiskSpace(estimates []shardEstimate, printer format.Printer) preCheck {
+	check := preCheck{name: "Disk space", status: preCheckPassed, details: "enough free space for the mutations and a backup"}
+	for _, estimate := range estimates {
+		if estimate.freeSpace < estimate.rewrittenBytes {
+			check.status = preCheckFailed
+			check.details = fmt.Sprintf("shard %s needs %s of free space for the mutations but has %s",
+				estimate.shard, printer.Bytes(strconv.FormatUint(estimate.rewrittenBytes, 10)), printer.Bytes(strconv.FormatUint(estimate.freeSpace, 10)))
+			return check
+		}
+		if estimate.freeSpace < estimate.rewrittenBytes+estimate.tablesBytes {
+			check.status = preCheckWarning
+			check.details = fmt.Sprintf("shard %s needs %s of free space for the mutations and a backup but has %s",
+				estimate.shard, printer.Bytes(strconv.FormatUint(estimate.rewrittenBytes+estimate.tablesBytes, 10)), printer.Bytes(strconv.FormatUint(estimate.freeSpace, 10)))
+		}
+	}
+	return check
+}
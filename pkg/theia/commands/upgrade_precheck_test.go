@@ -0,0 +1,193 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	stats "antrea.io/theia/pkg/apis/stats/v1alpha1"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+func TestUpgradePreCheck(t *testing.T) {
+	testServer := func(schemaVersions []stats.SchemaVersion, freeSpace string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var status *stats.ClickHouseStats
+			switch strings.TrimSpace(r.URL.Path) {
+			case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/schemaVersion":
+				status = &stats.ClickHouseStats{SchemaVersions: schemaVersions}
+			case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/tableInfo":
+				status = &stats.ClickHouseStats{TableInfos: []stats.TableInfo{
+					{Shard: "1", TableName: "flows_local", TotalBytes: "2.79 GiB", TotalBytesRaw: "3000000000"},
+					{Shard: "1", TableName: "recommendations_local", TotalBytes: "953.67 MiB", TotalBytesRaw: "1000000000"},
+				}}
+			case "/apis/stats.theia.antrea.io/v1alpha1/clickhouse/diskInfo":
+				status = &stats.ClickHouseStats{DiskInfos: []stats.DiskInfo{
+					{Shard: "1", Database: "default", FreeSpaceRaw: freeSpace},
+				}}
+			default:
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(status)
+		}))
+	}
+	testCases := []struct {
+		name             string
+		testServer       *httptest.Server
+		to               string
+		raw              bool
+		expectedMsg      []string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			testServer: testServer([]stats.SchemaVersion{{Shard: "1", Version: "2", Dirty: "0"}}, "10000000000"),
+			to:         "v0.4.0",
+			expectedMsg: []string{
+				"Schema version", "OK", "schema version 2 on 1 shard(s)",
+				"Migration path", "upgrade from schema version 2 to 3",
+				"Disk space", "enough free space for the mutations and a backup",
+				"953.67 MiB", "20s", "3.73 GiB", "9.31 GiB",
+				"column recommendations_local.yamls is dropped or renamed",
+			},
+		},
+		{
+			name:        "Valid case with raw numbers",
+			testServer:  testServer([]stats.SchemaVersion{{Shard: "1", Version: "2", Dirty: "0"}}, "10000000000"),
+			to:          "v0.4.0",
+			raw:         true,
+			expectedMsg: []string{"1000000000", "20", "4000000000", "10000000000"},
+		},
+		{
+			name:        "No migration",
+			testServer:  testServer([]stats.SchemaVersion{{Shard: "1", Version: "3", Dirty: "0"}}, "10000000000"),
+			to:          "0.4.0",
+			expectedMsg: []string{"no migration, the schema version is already 3", "No breaking change"},
+		},
+		{
+			name:        "Not enough free space for a backup",
+			testServer:  testServer([]stats.SchemaVersion{{Shard: "1", Version: "2", Dirty: "0"}}, "2000000000"),
+			to:          "v0.4.0",
+			expectedMsg: []string{"WARNING", "shard 1 needs 4.66 GiB of free space for the mutations and a backup but has 1.86 GiB"},
+		},
+		{
+			name:             "Not enough free space for the mutations",
+			testServer:       testServer([]stats.SchemaVersion{{Shard: "1", Version: "2", Dirty: "0"}}, "500000000"),
+			to:               "v0.4.0",
+			expectedMsg:      []string{"shard 1 needs 953.67 MiB of free space for the mutations but has 476.84 MiB"},
+			expectedErrorMsg: "the upgrade pre-check failed",
+		},
+		{
+			name:             "Dirty schema",
+			testServer:       testServer([]stats.SchemaVersion{{Shard: "1", Version: "3", Dirty: "1"}}, "10000000000"),
+			to:               "v0.4.0",
+			expectedMsg:      []string{"the last migration of shard 1 to schema version 3 failed", "the schema version is unknown"},
+			expectedErrorMsg: "the upgrade pre-check failed",
+		},
+		{
+			name: "Different schema versions",
+			testServer: testServer([]stats.SchemaVersion{
+				{Shard: "1", Version: "3", Dirty: "0"},
+				{Shard: "2", Version: "2", Dirty: "0"},
+			}, "10000000000"),
+			to:               "v0.4.0",
+			expectedMsg:      []string{"shards have different schema versions 3 and 2"},
+			expectedErrorMsg: "the upgrade pre-check failed",
+		},
+		{
+			name:             "Unknown schema version",
+			testServer:       testServer([]stats.SchemaVersion{{Shard: "1", Version: "100", Dirty: "0"}}, "10000000000"),
+			to:               "v0.4.0",
+			expectedMsg:      []string{"no migrator for version number 100"},
+			expectedErrorMsg: "the upgrade pre-check failed",
+		},
+		{
+			name:             "Invalid version",
+			testServer:       testServer(nil, "10000000000"),
+			to:               "latest",
+			expectedErrorMsg: "invalid version latest",
+		},
+		{
+			name: "Failed to get schema version",
+			testServer: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			})),
+			to:               "v0.3.0",
+			expectedErrorMsg: "error when getting the schema version",
+		},
+		{
+			name:             TheiaClientSetupDeniedTestCase,
+			testServer:       httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+			to:               "v0.3.0",
+			expectedErrorMsg: TheiaClientSetupDeniedErr,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.testServer.Close()
+			oldFunc := SetupTheiaClientAndConnection
+			if tt.name == TheiaClientSetupDeniedTestCase {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					return nil, nil, errors.New("mock_error")
+				}
+			} else {
+				SetupTheiaClientAndConnection = func(cmd *cobra.Command, useClusterIP bool) (restclient.Interface, *portforwarder.PortForwarder, error) {
+					clientConfig := &restclient.Config{Host: tt.testServer.URL, TLSClientConfig: restclient.TLSClientConfig{Insecure: true}}
+					clientset, _ := kubernetes.NewForConfig(clientConfig)
+					return clientset.CoreV1().RESTClient(), nil, nil
+				}
+			}
+			defer func() {
+				SetupTheiaClientAndConnection = oldFunc
+			}()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("to", tt.to, "")
+			cmd.Flags().Bool("raw", tt.raw, "")
+			cmd.Flags().Bool("use-cluster-ip", true, "")
+
+			orig := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+			defer func() { os.Stdout = orig }()
+			err := upgradePreCheck(cmd, []string{})
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorMsg)
+			}
+			if len(tt.expectedMsg) > 0 {
+				outcome := readStdout(t, r, w)
+				for _, msg := range tt.expectedMsg {
+					assert.Contains(t, outcome, msg)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"antrea.io/theia/pkg/util/format"
+)
+
+// upgradeStatusCmd represents the upgrade status command
+var upgradeStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the progress of the latest data schema migration",
+	Long: `Show the progress of the mutations and of the copies between tables of the
+latest ClickHouse data schema migration, as recorded by the migrator every 10
+seconds. The progress of a mutation is counted in data parts, and the progress
+of a copy in rows. The ETA is estimated from the rate since the mutation or
+copy was first seen, and is unknown until some progress is made. The mutations
+are rewritten by ClickHouse in the background, and their progress is not
+recorded anymore once the migrator exits.`,
+	Args: cobra.NoArgs,
+	Example: `
+Show the progress of the latest migration
+$ theia upgrade status
+Show the progress with durations as raw numbers
+$ theia upgrade status --raw
+`,
+	RunE: upgradeStatus,
+}
+
+func init() {
+	upgradeCmd.AddCommand(upgradeStatusCmd)
+	upgradeStatusCmd.Flags().Bool(
+		"raw",
+		false,
+		"Print durations as raw numbers instead of human-readable values.",
+	)
+}
+
+func upgradeStatus(cmd *cobra.Command, args []string) error {
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return err
+	}
+	useClusterIP, err := cmd.Flags().GetBool("use-cluster-ip")
+	if err != nil {
+		return err
+	}
+	theiaClient, pf, err := SetupTheiaClientAndConnection(cmd, useClusterIP)
+	if err != nil {
+		return fmt.Errorf("couldn't setup Theia manager client, %v", err)
+	}
+	if pf != nil {
+		defer pf.Stop()
+	}
+	status, err := getClickHouseStatusByCategory(theiaClient, "migrationProgress")
+	if err != nil {
+		return fmt.Errorf("error when getting the migration progress: %v", err)
+	}
+	if len(status.MigrationProgress) == 0 {
+		fmt.Println("No migration progress is recorded")
+		return nil
+	}
+	first := status.MigrationProgress[0]
+	fmt.Printf("Migration from schema version %s to %s\n\n", first.FromVersion, first.ToVersion)
+	printer := format.Printer{Raw: raw}
+	result := [][]string{{"Table", "Operation", "Done", "Total", "Progress", "ETA", "Updated"}}
+	for _, progress := range status.MigrationProgress {
+		result = append(result, []string{
+			progress.TableName,
+			progress.Operation,
+			progress.Done,
+			progress.Total,
+			progressPercentage(progress.Done, progress.Total),
+			progressETA(progress.ETASeconds, printer),
+			progress.TimeUpdated,
+		})
+	}
+	TableOutput(result)
+	return nil
+}
+
+// progressPercentage returns the percentage of the work done, or "-" if the
+// total is unknown.
+func progressPercentage(done, total string) string {
+	doneNumber, err := strconv.ParseUint(done, 10, 64)
+	if err != nil {
+		return "-"
+	}
+	totalNumber, err := strconv.ParseUint(total, 10, 64)
+	if err != nil {
+		return "-"
+	}
+	if totalNumber == 0 {
+		return format.Percentage(100)
+	}
+	return format.Percentage(float64(doneNumber) / float64(totalNumber) * 100)
+}
+
+// progressETA returns the estimated time left, or "unknown" if it cannot be
+// estimated yet.
+func progressETA(etaSeconds string, printer format.Printer) string {
+	seconds, err := strconv.ParseInt(etaSeconds, 10, 64)
+	if err != nil || seconds < 0 {
+		return "unknown"
+	}
+	return printer.Duration(time.Duration(seconds) * time.Second)
+}
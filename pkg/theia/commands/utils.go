@@ -17,14 +17,19 @@ package commands
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
@@ -39,13 +44,62 @@ import (
 	"antrea.io/theia/pkg/util/k8s"
 )
 
+// Maximum number of times a request rejected by the Theia Manager because of
+// overload is retried.
+const overloadMaxRetries = 10
+
 var (
 	SetupTheiaClientAndConnection = setupTheiaClientAndConnection
 	CreateK8sClient               = createK8sClient
+	// User and groups to impersonate when accessing the cluster, set by the
+	// --as and --as-group flags.
+	impersonateUser   string
+	impersonateGroups []string
+	// Namespace of the Theia instance to access, set by the --theia-namespace
+	// flag or by the Theia context in use.
+	theiaNamespace = config.FlowVisibilityNS
+	// kubeconfig file of the Theia context in use, if any.
+	contextKubeconfig string
+	// inClusterConfig returns the config of the service account of the Pod
+	// theia runs in.
+	inClusterConfig = restclient.InClusterConfig
+	userHomeDir     = os.UserHomeDir
+	// defaultKubeconfig is used when no kubeconfig file is given.
+	defaultKubeconfig = clientcmd.RecommendedHomeFile
 )
 
+// buildConfig builds the client config from the kubeconfig file, with the
+// user and groups to impersonate if any. The kubeconfig may be a list of files,
+// which are merged like kubectl does, and the in-cluster config is used if it
+// is empty.
+func buildConfig(kubeconfig string) (*restclient.Config, error) {
+	var config *restclient.Config
+	var err error
+	switch paths := filepath.SplitList(kubeconfig); len(paths) {
+	case 0:
+		config, err = inClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("no kubeconfig file is found and theia is not running in a Pod: %v", err)
+		}
+	case 1:
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	default:
+		loadingRules := &clientcmd.ClientConfigLoadingRules{Precedence: paths}
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	config.Impersonate = restclient.ImpersonationConfig{
+		UserName: impersonateUser,
+		Groups:   impersonateGroups,
+	}
+	config.Wrap(wrapTransport)
+	return config, nil
+}
+
 func createK8sClient(kubeconfig string) (kubernetes.Interface, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	config, err := buildConfig(kubeconfig)
 	if err != nil {
 		return nil, err
 	}
@@ -68,27 +122,32 @@ func setupTheiaClientAndConnection(cmd *cobra.Command, useClusterIP bool) (restc
 	}
 	theiaClient, portForward, err := CreateTheiaManagerClient(clientset, kubeconfig, useClusterIP)
 	if err != nil {
-		return nil, nil, fmt.Errorf("couldn't create Theia manager client: %v", err)
+		return nil, nil, fmt.Errorf("couldn't create Theia manager client: %v", explainForbidden(clientset, theiaManagerAccess(useClusterIP), err))
 	}
 	return theiaClient.CoreV1().RESTClient(), portForward, err
 }
 
 func CreateTheiaManagerClient(k8sClient kubernetes.Interface, kubeconfig string, useClusterIP bool) (kubernetes.Interface, *portforwarder.PortForwarder, error) {
 	// check and get ca-cert.pem file
-	caCrt, err := GetCaCrt(k8sClient)
+	caConfigMap, err := getCAConfigMap(k8sClient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error when getting ca-crt: %w", err)
+	}
+	caCrt, err := getCaCrtFromConfigMap(caConfigMap)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error when getting ca-crt: %v", err)
+		return nil, nil, fmt.Errorf("error when getting ca-crt: %w", err)
 	}
+	warnVersionSkew(caConfigMap.Annotations[certificate.VersionAnnotation])
 	// check and get token
 	token, err := GetToken(k8sClient)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error when getting token: %v", err)
+		return nil, nil, fmt.Errorf("error when getting token: %w", err)
 	}
 	var host string
 	var portForward *portforwarder.PortForwarder
-	serviceIP, servicePort, err := k8s.GetServiceAddr(k8sClient, config.TheiaManagerServiceName, config.FlowVisibilityNS, v1.ProtocolTCP)
+	serviceIP, servicePort, err := k8s.GetServiceAddr(k8sClient, config.TheiaManagerServiceName, theiaNamespace, v1.ProtocolTCP)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error when getting the Theia Manager Service address: %v", err)
+		return nil, nil, fmt.Errorf("error when getting the Theia Manager Service address: %w", err)
 	}
 	if useClusterIP {
 		host = net.JoinHostPort(serviceIP, fmt.Sprint(servicePort))
@@ -98,7 +157,7 @@ func CreateTheiaManagerClient(k8sClient kubernetes.Interface, kubeconfig string,
 		// Forward the Theia Manager service port
 		portForward, err = StartPortForward(kubeconfig, config.TheiaManagerServiceName, servicePort, listenAddress, listenPort)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error when forwarding port: %v", err)
+			return nil, nil, fmt.Errorf("error when forwarding port: %w", err)
 		}
 		host = net.JoinHostPort(listenAddress, fmt.Sprint(listenPort))
 	}
@@ -108,9 +167,10 @@ func CreateTheiaManagerClient(k8sClient kubernetes.Interface, kubeconfig string,
 		BearerToken: token,
 		TLSClientConfig: restclient.TLSClientConfig{
 			Insecure:   false,
-			ServerName: certificate.GetTheiaServerNames(certificate.TheiaServiceName)[0],
+			ServerName: certificate.GetTheiaServerNamesInNamespace(certificate.TheiaServiceName, theiaNamespace)[0],
 			CAData:     []byte(caCrt),
 		},
+		WrapTransport: wrapTransport,
 	}
 	clientset, err := kubernetes.NewForConfig(clientConfig)
 	if err != nil {
@@ -119,22 +179,111 @@ func CreateTheiaManagerClient(k8sClient kubernetes.Interface, kubeconfig string,
 	return clientset, portForward, nil
 }
 
+// theiaManagerAccess returns the actions performed with the user credentials
+// to connect to the Theia Manager: reading the CA certificate, the token of
+// the Theia CLI account and the Theia Manager Service, and forwarding the
+// Service port unless the ClusterIP is used.
+func theiaManagerAccess(useClusterIP bool) []authorizationv1.ResourceAttributes {
+	access := []authorizationv1.ResourceAttributes{
+		{Namespace: theiaNamespace, Verb: "get", Resource: "configmaps", Name: config.CAConfigMapName},
+		{Namespace: theiaNamespace, Verb: "get", Resource: "secrets", Name: config.TheiaCliAccountName},
+		{Namespace: theiaNamespace, Verb: "get", Resource: "services", Name: config.TheiaManagerServiceName},
+	}
+	if !useClusterIP {
+		access = append(access,
+			authorizationv1.ResourceAttributes{Namespace: theiaNamespace, Verb: "list", Resource: "pods"},
+			authorizationv1.ResourceAttributes{Namespace: theiaNamespace, Verb: "create", Resource: "pods", Subresource: "portforward"},
+		)
+	}
+	return access
+}
+
+// explainForbidden checks with SelfSubjectAccessReviews which of the given
+// actions the user, or the impersonated user, is not allowed to perform when a
+// request failed with err because it was forbidden, so that all the missing
+// permissions are reported at once instead of the first one only. The
+// permissions are only checked in that case, as the reviews add a request per
+// action and may not be allowed themselves. err is returned if it is not
+// forbidden, or if no missing permission is found.
+func explainForbidden(clientset kubernetes.Interface, access []authorizationv1.ResourceAttributes, err error) error {
+	if !apierrors.IsForbidden(err) {
+		return err
+	}
+	denied, checkErr := deniedAccess(clientset, access)
+	if checkErr != nil || len(denied) == 0 {
+		return err
+	}
+	subject := "you lack"
+	if impersonateUser != "" {
+		subject = fmt.Sprintf("user %q lacks", impersonateUser)
+	}
+	return fmt.Errorf("%s permission to %s", subject, strings.Join(denied, ", "))
+}
+
+// deniedAccess returns the descriptions of the given actions which the user is
+// not allowed to perform.
+func deniedAccess(clientset kubernetes.Interface, access []authorizationv1.ResourceAttributes) ([]string, error) {
+	var denied []string
+	for i := range access {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &access[i]},
+		}
+		result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error when checking permission to %s: %v", describeAccess(access[i]), err)
+		}
+		if !result.Status.Allowed {
+			denied = append(denied, describeAccess(access[i]))
+		}
+	}
+	return denied, nil
+}
+
+func describeAccess(attributes authorizationv1.ResourceAttributes) string {
+	resource := attributes.Resource
+	if attributes.Subresource != "" {
+		resource += "/" + attributes.Subresource
+	}
+	description := attributes.Verb + " " + resource
+	if attributes.Name != "" {
+		description += fmt.Sprintf(" %q", attributes.Name)
+	}
+	if attributes.Namespace != "" {
+		description += " in Namespace " + attributes.Namespace
+	}
+	return description
+}
+
 func GetCaCrt(clientset kubernetes.Interface) (string, error) {
-	caConfigMap, err := clientset.CoreV1().ConfigMaps(config.FlowVisibilityNS).Get(context.TODO(), config.CAConfigMapName, metav1.GetOptions{})
+	caConfigMap, err := getCAConfigMap(clientset)
 	if err != nil {
-		return "", fmt.Errorf("error when getting ConfigMap theia-ca: %v", err)
+		return "", err
 	}
+	return getCaCrtFromConfigMap(caConfigMap)
+}
+
+// getCAConfigMap returns the ConfigMap the Theia Manager publishes its CA
+// bundle and its version to.
+func getCAConfigMap(clientset kubernetes.Interface) (*v1.ConfigMap, error) {
+	caConfigMap, err := clientset.CoreV1().ConfigMaps(theiaNamespace).Get(context.TODO(), config.CAConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error when getting ConfigMap theia-ca: %w", err)
+	}
+	return caConfigMap, nil
+}
+
+func getCaCrtFromConfigMap(caConfigMap *v1.ConfigMap) (string, error) {
 	caCrt, ok := caConfigMap.Data[config.CAConfigMapKey]
 	if !ok {
-		return "", fmt.Errorf("error when checking ca.crt in data: %v", err)
+		return "", fmt.Errorf("error when checking ca.crt in data: key %s not found", config.CAConfigMapKey)
 	}
 	return caCrt, nil
 }
 
 func GetToken(clientset kubernetes.Interface) (string, error) {
-	secret, err := clientset.CoreV1().Secrets(config.FlowVisibilityNS).Get(context.TODO(), config.TheiaCliAccountName, metav1.GetOptions{})
+	secret, err := clientset.CoreV1().Secrets(theiaNamespace).Get(context.TODO(), config.TheiaCliAccountName, metav1.GetOptions{})
 	if err != nil {
-		return "", fmt.Errorf("error when getting secret %s: %v", config.TheiaCliAccountName, err)
+		return "", fmt.Errorf("error when getting secret %s: %w", config.TheiaCliAccountName, err)
 	}
 	token := string(secret.Data[config.ServiceAccountTokenKey])
 	if len(token) == 0 {
@@ -144,12 +293,12 @@ func GetToken(clientset kubernetes.Interface) (string, error) {
 }
 
 func StartPortForward(kubeconfig string, service string, servicePort int, listenAddress string, listenPort int) (*portforwarder.PortForwarder, error) {
-	configuration, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	configuration, err := buildConfig(kubeconfig)
 	if err != nil {
 		return nil, err
 	}
 	// Forward the service port
-	pf, err := portforwarder.NewServicePortForwarder(configuration, config.FlowVisibilityNS, service, servicePort, listenAddress, listenPort)
+	pf, err := portforwarder.NewServicePortForwarder(configuration, theiaNamespace, service, servicePort, listenAddress, listenPort)
 	if err != nil {
 		return nil, err
 	}
@@ -160,6 +309,12 @@ func StartPortForward(kubeconfig string, service string, servicePort int, listen
 	return pf, nil
 }
 
+// ResolveKubeConfig returns the kubeconfig file given by the --kubeconfig flag,
+// by the Theia context in use or by $KUBECONFIG, which may be a list of files,
+// and ~/.kube/config otherwise. A leading ~ in the paths is expanded to the
+// home directory. If no kubeconfig file is given and ~/.kube/config does not
+// exist, an empty path is returned so that the in-cluster config is used, e.g.
+// when theia runs in a Pod.
 func ResolveKubeConfig(cmd *cobra.Command) (string, error) {
 	var err error
 	kubeconfigPath, err := cmd.Flags().GetString("kubeconfig")
@@ -167,13 +322,49 @@ func ResolveKubeConfig(cmd *cobra.Command) (string, error) {
 		return "", err
 	}
 	if len(kubeconfigPath) == 0 {
-		var hasIt bool
-		kubeconfigPath, hasIt = os.LookupEnv("KUBECONFIG")
-		if !hasIt || len(strings.TrimSpace(kubeconfigPath)) == 0 {
-			kubeconfigPath = clientcmd.RecommendedHomeFile
+		kubeconfigPath = contextKubeconfig
+	}
+	if len(kubeconfigPath) == 0 {
+		kubeconfigPath = strings.TrimSpace(os.Getenv("KUBECONFIG"))
+	}
+	if len(kubeconfigPath) == 0 {
+		if _, err := os.Stat(defaultKubeconfig); err != nil {
+			return "", nil
+		}
+		return defaultKubeconfig, nil
+	}
+	paths := filepath.SplitList(kubeconfigPath)
+	for i := range paths {
+		paths[i], err = expandHome(paths[i])
+		if err != nil {
+			return "", err
 		}
 	}
-	return kubeconfigPath, nil
+	return strings.Join(paths, string(filepath.ListSeparator)), nil
+}
+
+// expandHome replaces the leading ~ of a path with the home directory. The ~
+// may be followed by / or by the path separator of the OS, e.g. ~\.kube\config
+// on Windows, whose shells don't expand it in the arguments of theia.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path, nil
+	}
+	home, err := userHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error when getting the home directory to expand %s: %v", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// getPathFlag returns the value of a flag which is a file or directory path,
+// with its leading ~ expanded to the home directory.
+func getPathFlag(cmd *cobra.Command, name string) (string, error) {
+	path, err := cmd.Flags().GetString(name)
+	if err != nil {
+		return "", err
+	}
+	return expandHome(path)
 }
 
 func TableOutput(table [][]string) {
@@ -205,11 +396,37 @@ func FormatTimestamp(timestamp time.Time) string {
 	return timestamp.UTC().Format("2006-01-02 15:04:05")
 }
 
-func getPolicyRecommendationByName(theiaClient restclient.Interface, name string) (npr intelligence.NetworkPolicyRecommendation, err error) {
+// getPolicyRecommendationPage gets a policy recommendation job with at most
+// limit recommended policies in its outcome, starting from the position given
+// by continueToken.
+func getPolicyRecommendationPage(theiaClient restclient.Interface, name string, limit int64, continueToken string) (npr intelligence.NetworkPolicyRecommendation, err error) {
+	req := theiaClient.Get().
+		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
+		Resource("networkpolicyrecommendations").
+		Name(name)
+	if limit > 0 {
+		req = req.Param("limit", strconv.FormatInt(limit, 10))
+	}
+	if continueToken != "" {
+		req = req.Param("continue", continueToken)
+	}
+	// Requests rejected by the Theia Manager because of overload are retried
+	// after the delay given by their Retry-After header.
+	err = req.MaxRetries(overloadMaxRetries).Do(context.TODO()).Into(&npr)
+	if err != nil {
+		return npr, fmt.Errorf("failed to get policy recommendation job %s: %v", name, err)
+	}
+	return npr, nil
+}
+
+// getPolicyRecommendationReport gets a policy recommendation job with the
+// coverage statistics of its recommended policies instead of the policies.
+func getPolicyRecommendationReport(theiaClient restclient.Interface, name string) (npr intelligence.NetworkPolicyRecommendation, err error) {
 	err = theiaClient.Get().
 		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
 		Resource("networkpolicyrecommendations").
 		Name(name).
+		Param("report", "true").
 		Do(context.TODO()).
 		Into(&npr)
 	if err != nil {
@@ -218,6 +435,92 @@ func getPolicyRecommendationByName(theiaClient restclient.Interface, name string
 	return npr, nil
 }
 
+func getFlowStatsByCategory(theiaClient restclient.Interface, name string, window time.Duration, trafficClass, resolution string) (flowStats stats.FlowStats, err error) {
+	req := theiaClient.Get().
+		AbsPath("/apis/stats.theia.antrea.io/v1alpha1/").
+		Resource("flows").
+		Name(name).
+		Param("window", window.String())
+	if trafficClass != "" {
+		req = req.Param("trafficClass", trafficClass)
+	}
+	if resolution != "" {
+		req = req.Param("resolution", resolution)
+	}
+	err = req.Do(context.TODO()).Into(&flowStats)
+	if err != nil {
+		return flowStats, fmt.Errorf("failed to get flow %s stats: %v", name, err)
+	}
+	return flowStats, nil
+}
+
+func getTopTalkers(theiaClient restclient.Interface, window time.Duration, resolution, trafficClass, groupBy, sortBy string, limit int) (flowStats stats.FlowStats, err error) {
+	req := theiaClient.Get().
+		AbsPath("/apis/stats.theia.antrea.io/v1alpha1/").
+		Resource("flows").
+		Name("top").
+		Param("window", window.String()).
+		Param("groupBy", groupBy).
+		Param("sortBy", sortBy).
+		Param("limit", strconv.Itoa(limit))
+	if trafficClass != "" {
+		req = req.Param("trafficClass", trafficClass)
+	}
+	if resolution != "" {
+		req = req.Param("resolution", resolution)
+	}
+	err = req.Do(context.TODO()).Into(&flowStats)
+	if err != nil {
+		return flowStats, fmt.Errorf("failed to get top talkers: %v", err)
+	}
+	return flowStats, nil
+}
+
+// getWorkloadFlows returns the summary of the ingress and egress traffic of the
+// Pods of namespace selected by name or by labels, with at most limit peers
+// and ports per direction.
+func getWorkloadFlows(theiaClient restclient.Interface, window time.Duration, namespace, podName, podSelector string, limit int) (flowStats stats.FlowStats, err error) {
+	req := theiaClient.Get().
+		AbsPath("/apis/stats.theia.antrea.io/v1alpha1/").
+		Resource("flows").
+		Name("summary").
+		Param("window", window.String()).
+		Param("namespace", namespace).
+		Param("limit", strconv.Itoa(limit))
+	if podName != "" {
+		req = req.Param("podName", podName)
+	} else {
+		req = req.Param("podSelector", podSelector)
+	}
+	err = req.Do(context.TODO()).Into(&flowStats)
+	if err != nil {
+		return flowStats, fmt.Errorf("failed to get workload flows: %v", err)
+	}
+	return flowStats, nil
+}
+
+// exportFlows returns the stream of the flow records which ended in
+// [startTime, endTime), encoded in the given format, and compressed if
+// compression is not empty.
+func exportFlows(theiaClient restclient.Interface, startTime, endTime time.Time, format string, batchSize int, compression string) (io.ReadCloser, error) {
+	req := theiaClient.Get().
+		AbsPath("/apis/stats.theia.antrea.io/v1alpha1/").
+		Resource("flows").
+		Name("export").
+		Param("startTime", startTime.Format(time.RFC3339)).
+		Param("endTime", endTime.Format(time.RFC3339)).
+		Param("format", format).
+		Param("batchSize", strconv.Itoa(batchSize))
+	if compression != "" {
+		req = req.Param("compression", compression)
+	}
+	stream, err := req.Stream(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("failed to export flows: %v", err)
+	}
+	return stream, nil
+}
+
 func getClickHouseStatusByCategory(theiaClient restclient.Interface, name string) (status stats.ClickHouseStats, err error) {
 	err = theiaClient.Get().
 		AbsPath("/apis/stats.theia.antrea.io/v1alpha1/").
@@ -232,14 +535,9 @@ func getClickHouseStatusByCategory(theiaClient restclient.Interface, name string
 }
 
 func GetThroughputAnomalyDetectorByID(theiaClient restclient.Interface, name string) (tad intelligence.ThroughputAnomalyDetector, err error) {
-	err = theiaClient.Get().
-		AbsPath("/apis/intelligence.theia.antrea.io/v1alpha1/").
-		Resource("throughputanomalydetectors").
-		Name(name).
-		Do(context.TODO()).
-		Into(&tad)
+	job, err := anomalyDetectionJobs.get(theiaClient, name)
 	if err != nil {
-		return tad, fmt.Errorf("failed to get Throughput Anomaly Detector job %s: %v", name, err)
+		return tad, err
 	}
-	return tad, nil
+	return *job.(*intelligence.ThroughputAnomalyDetector), nil
 }
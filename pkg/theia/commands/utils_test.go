@@ -15,14 +15,23 @@
 package commands
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 
 	"antrea.io/theia/pkg/apis"
 	"antrea.io/theia/pkg/theia/commands/config"
@@ -34,6 +43,7 @@ const (
 	TheiaClientSetupDeniedErr      = "couldn't setup Theia manager client"
 	tadName                        = "tad-1234abcd-1234-abcd-12ab-12345678abcd"
 	nprName                        = "pr-e292395c-3de1-11ed-b878-0242ac120002"
+	jobName                        = "job-e998433e-accb-4888-9fc8-06563f073e86"
 )
 
 func TestGetCaCrt(t *testing.T) {
@@ -165,7 +175,11 @@ func TestSetupTheiaClientAndConnection(t *testing.T) {
 		},
 		{
 			name:             "Unable to create TheiaManagerClient",
-			expectedErrorMsg: "couldn't create Theia manager client",
+			expectedErrorMsg: "couldn't create Theia manager client: error when getting ca-crt",
+		},
+		{
+			name:             "Permission denied",
+			expectedErrorMsg: `you lack permission to get secrets "theia-cli-account-token" in Namespace flow-visibility, create pods/portforward in Namespace flow-visibility`,
 		},
 	}
 	for _, tt := range testCases {
@@ -180,6 +194,21 @@ func TestSetupTheiaClientAndConnection(t *testing.T) {
 			case "Unable to create TheiaManagerClient":
 				cmd.Flags().String("kubeconfig", "", "")
 				fakeClientset := fake.NewSimpleClientset()
+				// The permissions are not checked when no request is forbidden.
+				fakeClientset.PrependReactor("create", "selfsubjectaccessreviews", accessReviewReactor("secrets"))
+				CreateK8sClient = func(kubeconfig string) (client kubernetes.Interface, err error) {
+					return fakeClientset, nil
+				}
+			case "Permission denied":
+				cmd.Flags().String("kubeconfig", "", "")
+				fakeClientset := fake.NewSimpleClientset(&v1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: config.CAConfigMapName, Namespace: config.FlowVisibilityNS},
+					Data:       map[string]string{config.CAConfigMapKey: "key"},
+				})
+				fakeClientset.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, apierrors.NewForbidden(v1.Resource("secrets"), config.TheiaCliAccountName, fmt.Errorf("access denied"))
+				})
+				fakeClientset.PrependReactor("create", "selfsubjectaccessreviews", accessReviewReactor("secrets", "pods/portforward"))
 				CreateK8sClient = func(kubeconfig string) (client kubernetes.Interface, err error) {
 					return fakeClientset, nil
 				}
@@ -197,6 +226,258 @@ func TestSetupTheiaClientAndConnection(t *testing.T) {
 	}
 }
 
+func TestResolveKubeConfig(t *testing.T) {
+	home := t.TempDir()
+	existingKubeconfig := filepath.Join(home, "config")
+	require.NoError(t, os.WriteFile(existingKubeconfig, nil, 0600))
+	oldUserHomeDir, oldDefaultKubeconfig := userHomeDir, defaultKubeconfig
+	defer func() {
+		userHomeDir, defaultKubeconfig = oldUserHomeDir, oldDefaultKubeconfig
+	}()
+	userHomeDir = func() (string, error) { return home, nil }
+
+	testCases := []struct {
+		name               string
+		flag               string
+		contextKubeconfig  string
+		env                string
+		defaultKubeconfig  string
+		expectedKubeconfig string
+	}{
+		{
+			name:               "Flag",
+			flag:               "/etc/kubeconfig",
+			contextKubeconfig:  "/etc/context",
+			env:                "/etc/env",
+			expectedKubeconfig: "/etc/kubeconfig",
+		},
+		{
+			name:               "Flag with home directory",
+			flag:               "~/.kube/prod",
+			expectedKubeconfig: filepath.Join(home, ".kube/prod"),
+		},
+		{
+			name:               "Theia context",
+			contextKubeconfig:  "~/.kube/context",
+			env:                "/etc/env",
+			expectedKubeconfig: filepath.Join(home, ".kube/context"),
+		},
+		{
+			name:               "KUBECONFIG with a list of files",
+			env:                "~/.kube/a" + string(filepath.ListSeparator) + "/etc/b",
+			expectedKubeconfig: filepath.Join(home, ".kube/a") + string(filepath.ListSeparator) + "/etc/b",
+		},
+		{
+			name:               "Default kubeconfig",
+			defaultKubeconfig:  existingKubeconfig,
+			expectedKubeconfig: existingKubeconfig,
+		},
+		{
+			name:               "In-cluster config",
+			defaultKubeconfig:  filepath.Join(home, "missing"),
+			expectedKubeconfig: "",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tt.env)
+			contextKubeconfig, defaultKubeconfig = tt.contextKubeconfig, tt.defaultKubeconfig
+			defer func() { contextKubeconfig = "" }()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("kubeconfig", tt.flag, "")
+			kubeconfig, err := ResolveKubeConfig(cmd)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedKubeconfig, kubeconfig)
+		})
+	}
+}
+
+func TestGetPathFlag(t *testing.T) {
+	home := t.TempDir()
+	oldUserHomeDir := userHomeDir
+	defer func() { userHomeDir = oldUserHomeDir }()
+	userHomeDir = func() (string, error) { return home, nil }
+
+	testCases := []struct {
+		name         string
+		flag         string
+		expectedPath string
+	}{
+		{
+			name:         "Home directory",
+			flag:         "~",
+			expectedPath: home,
+		},
+		{
+			name:         "Path in home directory",
+			flag:         "~/theia/result.json",
+			expectedPath: filepath.Join(home, "theia", "result.json"),
+		},
+		{
+			name:         "Path in home directory with the separator of the OS",
+			flag:         "~" + string(filepath.Separator) + "result.json",
+			expectedPath: filepath.Join(home, "result.json"),
+		},
+		{
+			name:         "Path of another user",
+			flag:         "~theia/result.json",
+			expectedPath: "~theia/result.json",
+		},
+		{
+			name:         "Relative path",
+			flag:         filepath.Join("theia", "result.json"),
+			expectedPath: filepath.Join("theia", "result.json"),
+		},
+		{
+			name:         "Empty path",
+			expectedPath: "",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := new(cobra.Command)
+			cmd.Flags().String("file", tt.flag, "")
+			path, err := getPathFlag(cmd, "file")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedPath, path)
+		})
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeKubeconfig := func(name, context, server string) string {
+		path := filepath.Join(dir, name)
+		content := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: %[2]s
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+current-context: %[1]s
+`, context, server)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+	a := writeKubeconfig("a", "a", "https://a:6443")
+	b := writeKubeconfig("b", "b", "https://b:6443")
+	oldInClusterConfig := inClusterConfig
+	defer func() { inClusterConfig = oldInClusterConfig }()
+
+	config, err := buildConfig(a)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a:6443", config.Host)
+
+	// The first file setting the current context takes precedence.
+	config, err = buildConfig(b + string(filepath.ListSeparator) + a)
+	require.NoError(t, err)
+	assert.Equal(t, "https://b:6443", config.Host)
+
+	inClusterConfig = func() (*restclient.Config, error) {
+		return &restclient.Config{Host: "https://10.96.0.1:443"}, nil
+	}
+	config, err = buildConfig("")
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.96.0.1:443", config.Host)
+
+	inClusterConfig = func() (*restclient.Config, error) {
+		return nil, restclient.ErrNotInCluster
+	}
+	_, err = buildConfig("")
+	assert.ErrorContains(t, err, "no kubeconfig file is found and theia is not running in a Pod")
+}
+
+// accessReviewReactor returns a reactor which allows the SelfSubjectAccessReviews
+// of all the resources except the denied ones.
+func accessReviewReactor(deniedResources ...string) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+		resource := review.Spec.ResourceAttributes.Resource
+		if review.Spec.ResourceAttributes.Subresource != "" {
+			resource += "/" + review.Spec.ResourceAttributes.Subresource
+		}
+		review.Status.Allowed = true
+		for _, denied := range deniedResources {
+			if resource == denied {
+				review.Status.Allowed = false
+			}
+		}
+		return true, review, nil
+	}
+}
+
+func TestExplainForbidden(t *testing.T) {
+	access := []authorizationv1.ResourceAttributes{
+		{Verb: "list", Resource: "namespaces"},
+		{Verb: "list", Resource: "pods"},
+	}
+	forbiddenErr := fmt.Errorf("error when listing Pods: %w", apierrors.NewForbidden(v1.Resource("pods"), "", fmt.Errorf("access denied")))
+	testCases := []struct {
+		name             string
+		err              error
+		reactor          k8stesting.ReactionFunc
+		impersonateUser  string
+		expectedReviews  int
+		expectedErrorMsg string
+	}{
+		{
+			name:             "Not forbidden",
+			err:              fmt.Errorf("connection refused"),
+			reactor:          accessReviewReactor("pods"),
+			expectedErrorMsg: "connection refused",
+		},
+		{
+			name:             "Allowed",
+			err:              forbiddenErr,
+			reactor:          accessReviewReactor(),
+			expectedReviews:  2,
+			expectedErrorMsg: forbiddenErr.Error(),
+		},
+		{
+			name:             "Denied",
+			err:              forbiddenErr,
+			reactor:          accessReviewReactor("pods"),
+			expectedReviews:  2,
+			expectedErrorMsg: "you lack permission to list pods",
+		},
+		{
+			name:             "Denied to impersonated user",
+			err:              forbiddenErr,
+			reactor:          accessReviewReactor("namespaces", "pods"),
+			impersonateUser:  "alice",
+			expectedReviews:  2,
+			expectedErrorMsg: `user "alice" lacks permission to list namespaces, list pods`,
+		},
+		{
+			name: "Failed to review access",
+			err:  forbiddenErr,
+			reactor: func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, fmt.Errorf("impersonation is forbidden")
+			},
+			expectedReviews:  1,
+			expectedErrorMsg: forbiddenErr.Error(),
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeClientset := fake.NewSimpleClientset()
+			fakeClientset.PrependReactor("create", "selfsubjectaccessreviews", tt.reactor)
+			oldUser := impersonateUser
+			impersonateUser = tt.impersonateUser
+			defer func() {
+				impersonateUser = oldUser
+			}()
+			err := explainForbidden(fakeClientset, access, tt.err)
+			assert.EqualError(t, err, tt.expectedErrorMsg)
+			assert.Len(t, fakeClientset.Actions(), tt.expectedReviews)
+		})
+	}
+}
+
 func TestCreateTheiaManagerClient(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -16,9 +16,12 @@ package commands
 
 import (
 	"fmt"
+	"os"
 
+	"github.com/blang/semver"
 	"github.com/spf13/cobra"
 
+	"antrea.io/theia/pkg/apiserver/certificate"
 	"antrea.io/theia/pkg/version"
 )
 
@@ -27,12 +30,107 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show Theia CLI version",
 	Long: `Show Theia CLI version, which is the Theia version for which this
-CLI was built.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println(version.GetFullVersionWithRuntimeInfo())
-	},
+CLI was built, and the version of Theia deployed in the cluster, which is
+published by the Theia Manager. A warning is shown if the minor versions
+differ by more than one, or if the version of Theia cannot be read, in which
+case only the version of the CLI is shown.`,
+	Example: `
+Show the versions of the CLI and of Theia
+$ theia version
+Only show the version of the CLI
+$ theia version --client
+`,
+	RunE: showVersion,
 }
 
+var (
+	// versionSkewWarned is set once the version skew warning is shown, so
+	// that it is shown once per run.
+	versionSkewWarned bool
+	// cliVersion returns the version of the CLI.
+	cliVersion = func() string { return version.Version }
+)
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().Bool(
+		"client",
+		false,
+		"Only show the version of the CLI, without connecting to the cluster.",
+	)
+}
+
+func showVersion(cmd *cobra.Command, args []string) error {
+	fmt.Println(version.GetFullVersionWithRuntimeInfo())
+	client, err := cmd.Flags().GetBool("client")
+	if err != nil {
+		return err
+	}
+	if client {
+		return nil
+	}
+	// The version of the CLI is still useful when the cluster cannot be
+	// reached, e.g. to report a bug.
+	theiaVersion, err := getTheiaVersion(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't get the Theia version: %v\n", err)
+		return nil
+	}
+	fmt.Printf("Theia version: %s\n", theiaVersion)
+	warnVersionSkew(theiaVersion)
+	return nil
+}
+
+// getTheiaVersion returns the version of Theia deployed in the cluster, which
+// the Theia Manager publishes as an annotation of the CA ConfigMap.
+func getTheiaVersion(cmd *cobra.Command) (string, error) {
+	kubeconfig, err := ResolveKubeConfig(cmd)
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve kubeconfig: %v", err)
+	}
+	clientset, err := CreateK8sClient(kubeconfig)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create k8s client using given kubeconfig, %v", err)
+	}
+	caConfigMap, err := getCAConfigMap(clientset)
+	if err != nil {
+		return "", err
+	}
+	theiaVersion := caConfigMap.Annotations[certificate.VersionAnnotation]
+	if theiaVersion == "" {
+		return "", fmt.Errorf("the Theia Manager does not publish its version, it may be older than this CLI")
+	}
+	return theiaVersion, nil
+}
+
+// warnVersionSkew prints a warning to stderr, once per run, if the minor
+// versions of the CLI and of Theia differ by more than one.
+func warnVersionSkew(theiaVersion string) {
+	if versionSkewWarned {
+		return
+	}
+	if warning := versionSkewWarning(cliVersion(), theiaVersion); warning != "" {
+		versionSkewWarned = true
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
+
+// versionSkewWarning returns a warning if the major versions of the CLI and
+// of Theia differ, or if their minor versions differ by more than one. No
+// warning is returned if a version is unknown.
+func versionSkewWarning(cliVersion, theiaVersion string) string {
+	cli, err := semver.ParseTolerant(cliVersion)
+	if err != nil {
+		return ""
+	}
+	theia, err := semver.ParseTolerant(theiaVersion)
+	if err != nil {
+		return ""
+	}
+	minorSkew := int64(cli.Minor) - int64(theia.Minor)
+	if cli.Major == theia.Major && minorSkew >= -1 && minorSkew <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("the version %s of this CLI is not compatible with the version %s of Theia, the versions should not differ by more than one minor version. "+
+		"Run \"theia self-update --to-match-cluster\" to install the CLI of the same version as Theia", cliVersion, theiaVersion)
 }
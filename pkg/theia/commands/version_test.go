@@ -0,0 +1,161 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"antrea.io/theia/pkg/apiserver/certificate"
+	"antrea.io/theia/pkg/theia/commands/config"
+	"antrea.io/theia/pkg/version"
+)
+
+func TestVersionSkewWarning(t *testing.T) {
+	for _, tc := range []struct {
+		cliVersion    string
+		theiaVersion  string
+		expectWarning bool
+	}{
+		{cliVersion: "v0.8.0", theiaVersion: "v0.8.0"},
+		{cliVersion: "v0.8.0", theiaVersion: "v0.7.1"},
+		{cliVersion: "v0.8.0-dev", theiaVersion: "v0.9.0-dev-d3adb33f.dirty"},
+		{cliVersion: "v0.8.0", theiaVersion: "v0.6.0", expectWarning: true},
+		{cliVersion: "v0.6.0", theiaVersion: "v0.8.0", expectWarning: true},
+		{cliVersion: "v1.0.0", theiaVersion: "v0.9.0", expectWarning: true},
+		{cliVersion: "", theiaVersion: "v0.6.0"},
+		{cliVersion: "v0.8.0", theiaVersion: "UNKNOWN"},
+	} {
+		warning := versionSkewWarning(tc.cliVersion, tc.theiaVersion)
+		if tc.expectWarning {
+			assert.Contains(t, warning, "theia self-update --to-match-cluster", "CLI version %s, Theia version %s", tc.cliVersion, tc.theiaVersion)
+		} else {
+			assert.Empty(t, warning, "CLI version %s, Theia version %s", tc.cliVersion, tc.theiaVersion)
+		}
+	}
+}
+
+func TestGetTheiaVersion(t *testing.T) {
+	caConfigMap := func(annotations map[string]string) *v1.ConfigMap {
+		return &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        config.CAConfigMapName,
+				Namespace:   config.FlowVisibilityNS,
+				Annotations: annotations,
+			},
+			Data: map[string]string{config.CAConfigMapKey: "key"},
+		}
+	}
+	for _, tc := range []struct {
+		name             string
+		objects          []runtime.Object
+		expectedVersion  string
+		expectedErrorMsg string
+	}{
+		{
+			name:            "Version published",
+			objects:         []runtime.Object{caConfigMap(map[string]string{certificate.VersionAnnotation: "v0.8.0"})},
+			expectedVersion: "v0.8.0",
+		},
+		{
+			name:             "Version not published",
+			objects:          []runtime.Object{caConfigMap(nil)},
+			expectedErrorMsg: "the Theia Manager does not publish its version",
+		},
+		{
+			name:             "ConfigMap not found",
+			expectedErrorMsg: "error when getting ConfigMap theia-ca",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			oldFunc := CreateK8sClient
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tc.objects...), nil
+			}
+			defer func() { CreateK8sClient = oldFunc }()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("kubeconfig", "", "")
+			theiaVersion, err := getTheiaVersion(cmd)
+			if tc.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedVersion, theiaVersion)
+			}
+		})
+	}
+}
+
+func TestShowVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		objects        []runtime.Object
+		expectedStdout []string
+		expectedStderr string
+	}{
+		{
+			name: "Version published",
+			objects: []runtime.Object{&v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        config.CAConfigMapName,
+					Namespace:   config.FlowVisibilityNS,
+					Annotations: map[string]string{certificate.VersionAnnotation: "v0.8.0"},
+				},
+			}},
+			expectedStdout: []string{version.GetFullVersionWithRuntimeInfo(), "Theia version: v0.8.0"},
+		},
+		{
+			name:           "ConfigMap not found",
+			expectedStdout: []string{version.GetFullVersionWithRuntimeInfo()},
+			expectedStderr: "Warning: couldn't get the Theia version: error when getting ConfigMap theia-ca",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			oldFunc := CreateK8sClient
+			CreateK8sClient = func(kubeconfig string) (kubernetes.Interface, error) {
+				return fake.NewSimpleClientset(tc.objects...), nil
+			}
+			defer func() { CreateK8sClient = oldFunc }()
+			cmd := new(cobra.Command)
+			cmd.Flags().String("kubeconfig", "", "")
+			cmd.Flags().Bool("client", false, "")
+
+			origStdout, origStderr := os.Stdout, os.Stderr
+			rOut, wOut, _ := os.Pipe()
+			rErr, wErr, _ := os.Pipe()
+			os.Stdout, os.Stderr = wOut, wErr
+			defer func() { os.Stdout, os.Stderr = origStdout, origStderr }()
+			assert.NoError(t, showVersion(cmd, nil))
+			stdout := readStdout(t, rOut, wOut)
+			stderr := readStdout(t, rErr, wErr)
+
+			for _, msg := range tc.expectedStdout {
+				assert.Contains(t, stdout, msg)
+			}
+			if tc.expectedStderr != "" {
+				assert.Contains(t, stderr, tc.expectedStderr)
+				assert.NotContains(t, stdout, "Theia version:")
+			}
+		})
+	}
+}
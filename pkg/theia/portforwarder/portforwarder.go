@@ -87,7 +87,7 @@ func NewServicePortForwarder(config *rest.Config, namespace string, service stri
 
 	serviceObj, err := pf.clientset.CoreV1().Services(pf.namespace).Get(context.TODO(), service, metav1.GetOptions{})
 	if err != nil {
-		return pf, fmt.Errorf("failed to read Service %s: %v", service, err)
+		return pf, fmt.Errorf("failed to read Service %s: %w", service, err)
 	}
 
 	klog.V(2).Infof("Port forwarder requested for service %s/%s: %s:%d -> %d", namespace, service, listenAddress, listenPort, pf.targetPort)
@@ -101,7 +101,7 @@ func NewServicePortForwarder(config *rest.Config, namespace string, service stri
 	pods, err := pf.clientset.CoreV1().Pods(pf.namespace).List(context.TODO(), listOptions)
 
 	if err != nil {
-		return pf, fmt.Errorf("failed to read Pods for Service %s: %v", service, err)
+		return pf, fmt.Errorf("failed to read Pods for Service %s: %w", service, err)
 	}
 	if len(pods.Items) == 0 {
 		return pf, fmt.Errorf("no Pods found for Service %s: %v", service, err)
@@ -17,8 +17,13 @@ package clickhouse
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -26,6 +31,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 
 	"antrea.io/theia/pkg/util/env"
 	"antrea.io/theia/pkg/util/k8s"
@@ -35,8 +41,16 @@ const (
 	usernameKey         = "CLICKHOUSE_USERNAME"
 	passwordKey         = "CLICKHOUSE_PASSWORD"
 	urlKey              = "CLICKHOUSE_URL"
+	databaseKey         = "CLICKHOUSE_DATABASE"
+	ttlKey              = "CLICKHOUSE_TTL"
 	ServiceName         = "clickhouse-clickhouse"
 	ServicePortProtocal = "TCP"
+	// secureServicePortName is the name of the port of the secure native
+	// interface in the ClickHouse Service, used when TLS is enabled.
+	secureServicePortName = "secureclient"
+	// DefaultDatabase is the ClickHouse database storing the Theia tables
+	// when CLICKHOUSE_DATABASE is not set.
+	DefaultDatabase = "default"
 	// #nosec G101: false positive triggered by variable name which includes "secret"
 	SecretName = "clickhouse-secret"
 	// Ping to ClickHouse time out if it fails for 30 seconds.
@@ -46,48 +60,101 @@ const (
 )
 
 var (
+	// intervalRegex matches the intervals of the TTL rules, e.g. "12 HOUR",
+	// with the units of clickhouse.ttl in the Helm values.
+	intervalRegex   = regexp.MustCompile(`^[1-9][0-9]* (SECOND|MINUTE|HOUR|DAY|WEEK|MONTH|QUARTER|YEAR)$`)
 	openSql         = sql.Open
+	openDB          = sql.OpenDB
 	createK8sClient = k8s.CreateK8sClient
+	// connectionRetryBackoff is the backoff of the queries retried by
+	// RetryOnConnectionError. It retries for about 30 seconds, which covers
+	// the restart of the ClickHouse server.
+	connectionRetryBackoff = wait.Backoff{
+		Steps:    5,
+		Duration: 1 * time.Second,
+		Factor:   2.0,
+		Jitter:   0.1,
+	}
 )
 
+// SetupConnection connects to the ClickHouse server. The credentials are
+// requested again for every new connection of the returned pool, so that the
+// rotated credentials of CLICKHOUSE_USERNAME_FILE and CLICKHOUSE_PASSWORD_FILE
+// are used without a restart.
 func SetupConnection(client kubernetes.Interface) (connect *sql.DB, err error) {
-	url, err := getClickHouseURL(client)
+	address, options, err := getClickHouseAddress(client)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get ClickHouse URL: %v", err)
 	}
-	connect, err = Connect(url)
+	connect, err = ping(openDB(options.Connector(address)))
 	if err != nil {
 		return nil, fmt.Errorf("error when connecting to ClickHouse, %v", err)
 	}
 	return connect, nil
 }
 
+// Connect connects to the ClickHouse server with a DSN, which includes the
+// credentials.
 func Connect(url string) (*sql.DB, error) {
-	var connect *sql.DB
 	// Open the database and ping it
-	var err error
-	connect, err = openSql("clickhouse", url)
+	connect, err := openSql("clickhouse", url)
 	if err != nil {
 		return connect, fmt.Errorf("failed to open ClickHouse: %v", err)
 	}
+	return ping(connect)
+}
+
+// ping pings the ClickHouse server until it succeeds or times out. The errors
+// are scrubbed, as the driver includes the DSN in some of them, and the error
+// returned on timeout is classified after the last one, e.g. to hint at the
+// credentials when the authentication fails.
+func ping(connect *sql.DB) (*sql.DB, error) {
 	var errMessages []string
-	if err = wait.PollImmediate(pingRetryInterval, pingTimeout, func() (done bool, err error) {
+	var lastErr error
+	if err := wait.PollImmediate(pingRetryInterval, pingTimeout, func() (done bool, err error) {
 		if err := connect.Ping(); err != nil {
+			lastErr = err
 			if exception, ok := err.(*clickhouse.Exception); ok {
 				errMessages = append(errMessages, fmt.Errorf("error message: %v", exception.Message).Error())
 			} else {
-				errMessages = append(errMessages, err.Error())
+				errMessages = append(errMessages, ScrubDSN(err.Error()))
 			}
 			return false, nil
 		}
 		return true, nil
 	}); err != nil {
-		return nil, fmt.Errorf("failed to connect to ClickHouse after %s, error list: [\n%v]", pingTimeout, strings.Join(errMessages, ",\n"))
+		err = fmt.Errorf("failed to connect to ClickHouse after %s, error list: [\n%v]", pingTimeout, strings.Join(errMessages, ",\n"))
+		if class, ok := classifyErrorCode(lastErr); ok {
+			return nil, &Error{Class: class, err: err}
+		}
+		return nil, err
 	}
 
 	return connect, nil
 }
 
+// IsConnectionError checks whether err is caused by the connection to the
+// ClickHouse server, e.g. when the ClickHouse Pod is restarted, rather than by
+// the query itself.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryOnConnectionError runs fn, and runs it again with a backoff as long as
+// it fails because of the connection to the ClickHouse server. database/sql
+// replaces the broken connections of the pool, so that the queries succeed
+// again once the ClickHouse server is back.
+func RetryOnConnectionError(fn func() error) error {
+	return retry.OnError(connectionRetryBackoff, IsConnectionError, fn)
+}
+
 func GetSecret(client kubernetes.Interface, namespace string) (username string, password string, err error) {
 	secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), SecretName, metav1.GetOptions{})
 	if err != nil {
@@ -106,28 +173,80 @@ func GetSecret(client kubernetes.Interface, namespace string) (username string,
 	return username, password, nil
 }
 
-func getClickHouseURL(client kubernetes.Interface) (url string, err error) {
-	baseURL := os.Getenv(urlKey)
-	username := os.Getenv(usernameKey)
-	password := os.Getenv(passwordKey)
+// getClickHouseAddress returns the address of the ClickHouse server and the
+// options of the connections, including the credentials, from the environment
+// variables or else from the ClickHouse Service and Secret.
+func getClickHouseAddress(client kubernetes.Interface) (baseURL string, options DSNOptions, err error) {
+	baseURL = os.Getenv(urlKey)
+	options, err = NewDSNOptionsFromEnv()
+	if err != nil {
+		return "", options, err
+	}
+	options.Credentials, err = NewCredentialsProviderFromEnv(os.Getenv)
+	if err != nil {
+		return "", options, err
+	}
 
-	if baseURL == "" || username == "" || password == "" {
+	if baseURL == "" || options.Credentials == nil {
 		if client == nil {
 			client, err = createK8sClient()
 			if err != nil {
-				return url, fmt.Errorf("failed to create k8s client: %v", err)
+				return "", options, fmt.Errorf("failed to create k8s client: %v", err)
 			}
 		}
-		serviceIP, servicePort, err := k8s.GetServiceAddr(client, ServiceName, env.GetTheiaNamespace(), ServicePortProtocal)
+		var serviceIP string
+		var servicePort int
+		if options.TLS != nil {
+			serviceIP, servicePort, err = k8s.GetServiceAddrByPortName(client, ServiceName, env.GetTheiaNamespace(), secureServicePortName)
+		} else {
+			serviceIP, servicePort, err = k8s.GetServiceAddr(client, ServiceName, env.GetTheiaNamespace(), ServicePortProtocal)
+		}
 		if err != nil {
-			return url, fmt.Errorf("error when getting the ClickHouse Service address: %v", err)
+			return "", options, fmt.Errorf("error when getting the ClickHouse Service address: %v", err)
 		}
-		baseURL = fmt.Sprintf("tcp://%s:%d", serviceIP, servicePort)
-		username, password, err = GetSecret(client, env.GetTheiaNamespace())
+		baseURL = fmt.Sprintf("tcp://%s", net.JoinHostPort(serviceIP, fmt.Sprint(servicePort)))
+		username, password, err := GetSecret(client, env.GetTheiaNamespace())
 		if err != nil {
-			return url, err
+			return "", options, err
 		}
+		options.Credentials = &StaticCredentials{Username: username, Password: password}
+	}
+	if err := options.RegisterTLSConfig(); err != nil {
+		return "", options, err
+	}
+	options.Database = os.Getenv(databaseKey)
+	return baseURL, options, nil
+}
+
+// GetDatabase returns the ClickHouse database storing the Theia tables, given
+// by the CLICKHOUSE_DATABASE environment variable. Unqualified table names in
+// the queries of a connection returned by SetupConnection refer to this
+// database.
+func GetDatabase() string {
+	if database := os.Getenv(databaseKey); database != "" {
+		return database
+	}
+	return DefaultDatabase
+}
+
+// GetTTL returns the time to live of the flow records, given by the
+// CLICKHOUSE_TTL environment variable, e.g. "12 HOUR".
+func GetTTL() (string, error) {
+	ttl := os.Getenv(ttlKey)
+	if ttl == "" {
+		return "", fmt.Errorf("the time to live of the flow records is unknown, %s is not set", ttlKey)
+	}
+	if err := ValidateInterval(ttl); err != nil {
+		return "", fmt.Errorf("error when parsing %s: %v", ttlKey, err)
+	}
+	return ttl, nil
+}
+
+// ValidateInterval checks that interval is a ClickHouse interval which can be
+// used in the TTL rules, e.g. "7 DAY".
+func ValidateInterval(interval string) error {
+	if !intervalRegex.MatchString(interval) {
+		return fmt.Errorf("%q is not a valid interval, it should be a positive integer followed by one of SECOND, MINUTE, HOUR, DAY, WEEK, MONTH, QUARTER or YEAR", interval)
 	}
-	url = fmt.Sprintf("%s?debug=false&username=%s&password=%s", baseURL, username, password)
-	return url, nil
+	return nil
 }
@@ -16,13 +16,21 @@ package clickhouse
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -48,10 +56,9 @@ func TestSetupConnection(t *testing.T) {
 				if err != nil {
 					t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 				}
-				openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
-					assert.Equal(t, driverName, "clickhouse")
-					assert.Equal(t, dataSourceName, "tcp://localhost:9000?debug=false&username=username&password=password")
-					return db, nil
+				openDB = func(c driver.Connector) *sql.DB {
+					assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=password", connectorDSN(t, c))
+					return db
 				}
 				mock.ExpectPing()
 				return db, mock
@@ -62,6 +69,59 @@ func TestSetupConnection(t *testing.T) {
 				os.Unsetenv(urlKey)
 			},
 		},
+		{
+			name: "Read credentials from files",
+			setup: func() (*sql.DB, sqlmock.Sqlmock) {
+				dir := t.TempDir()
+				os.WriteFile(filepath.Join(dir, "username"), []byte("username"), 0600)
+				os.WriteFile(filepath.Join(dir, "password"), []byte("password\n"), 0600)
+				os.Setenv(usernameFileKey, filepath.Join(dir, "username"))
+				os.Setenv(passwordFileKey, filepath.Join(dir, "password"))
+				os.Setenv(urlKey, "tcp://localhost:9000")
+				db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+				}
+				openDB = func(c driver.Connector) *sql.DB {
+					assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=password", connectorDSN(t, c))
+					os.WriteFile(filepath.Join(dir, "password"), []byte("rotated"), 0600)
+					assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=rotated", connectorDSN(t, c))
+					return db
+				}
+				mock.ExpectPing()
+				return db, mock
+			},
+			cleanup: func() {
+				os.Unsetenv(usernameFileKey)
+				os.Unsetenv(passwordFileKey)
+				os.Unsetenv(urlKey)
+			},
+		},
+		{
+			name: "Read database from environment",
+			setup: func() (*sql.DB, sqlmock.Sqlmock) {
+				os.Setenv(usernameKey, "username")
+				os.Setenv(passwordKey, "password")
+				os.Setenv(urlKey, "tcp://localhost:9000")
+				os.Setenv(databaseKey, "theia")
+				db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual), sqlmock.MonitorPingsOption(true))
+				if err != nil {
+					t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+				}
+				openDB = func(c driver.Connector) *sql.DB {
+					assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=password&database=theia", connectorDSN(t, c))
+					return db
+				}
+				mock.ExpectPing()
+				return db, mock
+			},
+			cleanup: func() {
+				os.Unsetenv(usernameKey)
+				os.Unsetenv(passwordKey)
+				os.Unsetenv(urlKey)
+				os.Unsetenv(databaseKey)
+			},
+		},
 		{
 			name: "Get address from K8s client",
 			setup: func() (*sql.DB, sqlmock.Sqlmock) {
@@ -94,8 +154,8 @@ func TestSetupConnection(t *testing.T) {
 				if err != nil {
 					t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 				}
-				openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
-					return db, nil
+				openDB = func(c driver.Connector) *sql.DB {
+					return db
 				}
 				mock.ExpectPing().WillReturnError(&clickhouse.Exception{Message: "first error"})
 				mock.ExpectPing().WillReturnError(fmt.Errorf("second error"))
@@ -134,3 +194,86 @@ func TestSetupConnection(t *testing.T) {
 	}
 
 }
+
+func TestRetryOnConnectionError(t *testing.T) {
+	defaultBackoff := connectionRetryBackoff
+	connectionRetryBackoff = wait.Backoff{Steps: 3, Duration: time.Millisecond}
+	defer func() {
+		connectionRetryBackoff = defaultBackoff
+	}()
+	testCases := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectedError error
+	}{
+		{
+			name:          "Succeeded after the ClickHouse server is back",
+			errs:          []error{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, driver.ErrBadConn, nil},
+			expectedCalls: 3,
+		},
+		{
+			name:          "Connection lost for too long",
+			errs:          []error{io.EOF, io.EOF, io.EOF, nil},
+			expectedCalls: 3,
+			expectedError: io.EOF,
+		},
+		{
+			name:          "Query error not retried",
+			errs:          []error{errors.New("syntax error"), nil},
+			expectedCalls: 1,
+			expectedError: errors.New("syntax error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			err := RetryOnConnectionError(func() error {
+				err := tc.errs[calls]
+				calls++
+				return err
+			})
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
+
+func TestGetTTL(t *testing.T) {
+	testCases := []struct {
+		name             string
+		ttl              string
+		expectedErrorMsg string
+	}{
+		{
+			name: "Valid case",
+			ttl:  "12 HOUR",
+		},
+		{
+			name:             "Not set",
+			expectedErrorMsg: "CLICKHOUSE_TTL is not set",
+		},
+		{
+			name:             "Invalid unit",
+			ttl:              "12 HOURS",
+			expectedErrorMsg: "error when parsing CLICKHOUSE_TTL: \"12 HOURS\" is not a valid interval",
+		},
+		{
+			name:             "SQL in interval",
+			ttl:              "1 DAY DELETE, timeInserted + INTERVAL 1 SECOND",
+			expectedErrorMsg: "is not a valid interval",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(ttlKey, tc.ttl)
+			ttl, err := GetTTL()
+			if tc.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.ttl, ttl)
+			} else {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+			}
+		})
+	}
+}
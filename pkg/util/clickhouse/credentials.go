@@ -0,0 +1,173 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go"
+)
+
+const (
+	usernameFileKey = "CLICKHOUSE_USERNAME_FILE"
+	passwordFileKey = "CLICKHOUSE_PASSWORD_FILE"
+	// redactedPassword replaces the passwords in the DSNs which are logged
+	// or returned in errors.
+	redactedPassword = "xxxxx"
+)
+
+// dsnPasswordRegexp matches the password parameter of a DSN, in a DSN or in
+// any text including one, e.g. the error of parsing a DSN.
+var dsnPasswordRegexp = regexp.MustCompile(`(password=)[^&\s"']*`)
+
+// CredentialsProvider provides the credentials of the connections to the
+// ClickHouse server. They are requested for every new connection, so that a
+// provider can return rotated credentials without a restart.
+type CredentialsProvider interface {
+	Credentials() (username string, password string, err error)
+}
+
+// StaticCredentials are credentials which never change, e.g. read once from
+// environment variables or from a Secret.
+type StaticCredentials struct {
+	Username string
+	Password string
+}
+
+func (c *StaticCredentials) Credentials() (string, string, error) {
+	return c.Username, c.Password, nil
+}
+
+// FileCredentials are credentials read from files, e.g. the keys of a Secret
+// mounted as a volume, which the kubelet updates when the Secret is rotated.
+// The files are read again for every new connection.
+type FileCredentials struct {
+	UsernameFile string
+	PasswordFile string
+}
+
+func (c *FileCredentials) Credentials() (string, string, error) {
+	username, err := readCredentialFile(c.UsernameFile)
+	if err != nil {
+		return "", "", fmt.Errorf("error when reading the ClickHouse username: %v", err)
+	}
+	password, err := readCredentialFile(c.PasswordFile)
+	if err != nil {
+		return "", "", fmt.Errorf("error when reading the ClickHouse password: %v", err)
+	}
+	return username, password, nil
+}
+
+func readCredentialFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Files created by hand usually end with a new line, which is not part
+	// of the credential.
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("file %s is empty", path)
+	}
+	return value, nil
+}
+
+// NewCredentialsProviderFromEnv returns the credentials defined by the
+// CLICKHOUSE_USERNAME_FILE and CLICKHOUSE_PASSWORD_FILE environment variables,
+// which take precedence, or by the CLICKHOUSE_USERNAME and CLICKHOUSE_PASSWORD
+// ones, as returned by getenv. It returns nil if neither pair is set, so that
+// the caller can fall back to the ClickHouse Secret.
+func NewCredentialsProviderFromEnv(getenv func(string) string) (CredentialsProvider, error) {
+	usernameFile, passwordFile := getenv(usernameFileKey), getenv(passwordFileKey)
+	if usernameFile != "" || passwordFile != "" {
+		if usernameFile == "" || passwordFile == "" {
+			return nil, fmt.Errorf("%s and %s should be set together", usernameFileKey, passwordFileKey)
+		}
+		return &FileCredentials{UsernameFile: usernameFile, PasswordFile: passwordFile}, nil
+	}
+	username, password := getenv(usernameKey), getenv(passwordKey)
+	if username == "" || password == "" {
+		return nil, nil
+	}
+	return &StaticCredentials{Username: username, Password: password}, nil
+}
+
+// ScrubDSN replaces the passwords of the DSNs in s, so that s can be logged.
+func ScrubDSN(s string) string {
+	return dsnPasswordRegexp.ReplaceAllString(s, "${1}"+redactedPassword)
+}
+
+// scrubDSNError removes the password of the DSN from the errors of the
+// driver which include it, i.e. the errors of parsing the DSN.
+func scrubDSNError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = ScrubDSN(urlErr.URL)
+	}
+	return err
+}
+
+// connector opens the connections to the ClickHouse server with a DSN built
+// for every connection from the current credentials. The DSN, the only way
+// to pass the credentials to the driver, is never stored nor returned.
+type connector struct {
+	options DSNOptions
+	address string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := c.options.DSN(c.address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := clickhouse.Open(dsn)
+	if err != nil {
+		return nil, scrubDSNError(err)
+	}
+	return conn, nil
+}
+
+// String returns the DSN of the next connection without its password, so that
+// the connector can be logged.
+func (c *connector) String() string {
+	dsn, err := c.options.DSN(c.address)
+	if err != nil {
+		return c.address
+	}
+	return ScrubDSN(dsn)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return dsnDriver{}
+}
+
+// dsnDriver is the driver of the connector, used by database/sql only to
+// open connections from a DSN when the connector is not used.
+type dsnDriver struct{}
+
+func (dsnDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := clickhouse.Open(dsn)
+	if err != nil {
+		return nil, scrubDSNError(err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCredentialsProviderFromEnv(t *testing.T) {
+	testCases := []struct {
+		name             string
+		env              map[string]string
+		expected         CredentialsProvider
+		expectedErrorMsg string
+	}{
+		{
+			name:     "No credentials",
+			env:      map[string]string{usernameKey: "username"},
+			expected: nil,
+		},
+		{
+			name:     "Static credentials",
+			env:      map[string]string{usernameKey: "username", passwordKey: "password"},
+			expected: &StaticCredentials{Username: "username", Password: "password"},
+		},
+		{
+			name: "File credentials",
+			env: map[string]string{
+				usernameKey:     "username",
+				passwordKey:     "password",
+				usernameFileKey: "/etc/clickhouse/username",
+				passwordFileKey: "/etc/clickhouse/password",
+			},
+			expected: &FileCredentials{UsernameFile: "/etc/clickhouse/username", PasswordFile: "/etc/clickhouse/password"},
+		},
+		{
+			name:             "Password file without username file",
+			env:              map[string]string{passwordFileKey: "/etc/clickhouse/password"},
+			expectedErrorMsg: "CLICKHOUSE_USERNAME_FILE and CLICKHOUSE_PASSWORD_FILE should be set together",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credentials, err := NewCredentialsProviderFromEnv(func(key string) string { return tc.env[key] })
+			if tc.expectedErrorMsg != "" {
+				assert.EqualError(t, err, tc.expectedErrorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, credentials)
+		})
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	dir := t.TempDir()
+	credentials := &FileCredentials{UsernameFile: filepath.Join(dir, "username"), PasswordFile: filepath.Join(dir, "password")}
+	_, _, err := credentials.Credentials()
+	assert.ErrorContains(t, err, "error when reading the ClickHouse username")
+
+	require.NoError(t, os.WriteFile(credentials.UsernameFile, []byte("username\n"), 0600))
+	require.NoError(t, os.WriteFile(credentials.PasswordFile, []byte(""), 0600))
+	_, _, err = credentials.Credentials()
+	assert.ErrorContains(t, err, "error when reading the ClickHouse password: file "+credentials.PasswordFile+" is empty")
+
+	require.NoError(t, os.WriteFile(credentials.PasswordFile, []byte("password\r\n"), 0600))
+	username, password, err := credentials.Credentials()
+	require.NoError(t, err)
+	assert.Equal(t, "username", username)
+	assert.Equal(t, "password", password)
+
+	require.NoError(t, os.WriteFile(credentials.PasswordFile, []byte("rotated"), 0600))
+	_, password, err = credentials.Credentials()
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", password)
+}
+
+func TestScrubDSN(t *testing.T) {
+	assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=xxxxx&database=theia",
+		ScrubDSN("tcp://localhost:9000?debug=false&username=username&password=p%26ss&database=theia"))
+	assert.Equal(t, `parse "tcp://local host?password=xxxxx": invalid character " " in host name`,
+		ScrubDSN(`parse "tcp://local host?password=secret": invalid character " " in host name`))
+	assert.Equal(t, "no DSN", ScrubDSN("no DSN"))
+}
+
+func TestConnectorScrubsDSN(t *testing.T) {
+	options := DSNOptions{Credentials: &StaticCredentials{Username: "username", Password: "secret"}}
+	_, err := options.Connector("tcp://local host:9000").Connect(context.TODO())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+	assert.Contains(t, err.Error(), "password=xxxxx")
+
+	assert.Equal(t, "tcp://local host:9000?debug=false&username=username&password=xxxxx", fmt.Sprint(options.Connector("tcp://local host:9000")))
+
+	_, err = DSNOptions{}.Connector("tcp://localhost:9000").Connect(context.TODO())
+	assert.EqualError(t, err, "no ClickHouse credentials")
+}
@@ -0,0 +1,264 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go"
+)
+
+const (
+	debugKey       = "CLICKHOUSE_DEBUG"
+	compressKey    = "CLICKHOUSE_COMPRESS"
+	readTimeoutKey = "CLICKHOUSE_READ_TIMEOUT"
+	altHostsKey    = "CLICKHOUSE_ALT_HOSTS"
+
+	tlsCAFileKey             = "CLICKHOUSE_TLS_CA_FILE"
+	tlsCertFileKey           = "CLICKHOUSE_TLS_CERT_FILE"
+	tlsKeyFileKey            = "CLICKHOUSE_TLS_KEY_FILE"
+	tlsServerNameKey         = "CLICKHOUSE_TLS_SERVER_NAME"
+	tlsInsecureSkipVerifyKey = "CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY"
+	tlsSecretKey             = "CLICKHOUSE_TLS_SECRET"
+	// tlsConfigName is the name under which the TLS configuration of the
+	// connections is registered in the driver.
+	tlsConfigName = "theia"
+)
+
+// DSNOptions are the options of the connections to the ClickHouse server,
+// encoded in the DSN of the ClickHouse driver.
+type DSNOptions struct {
+	// Credentials provide the username and the password of the connections.
+	Credentials CredentialsProvider
+	// Database is the database of the connections. The default database of
+	// the user is used if it is empty.
+	Database string
+	// Debug enables the debug logs of the driver, which include every query.
+	Debug bool
+	// Compress enables the compression of the data blocks exchanged with the
+	// server, with LZ4, the only codec of the driver.
+	Compress bool
+	// ReadTimeout is the timeout of reading the responses of the server. The
+	// default timeout of the driver is used if it is 0.
+	ReadTimeout time.Duration
+	// AltHosts are the addresses, as host:port, of the servers to connect to
+	// if the server of the DSN is unavailable.
+	AltHosts []string
+	// TLS enables TLS on the connections, which must then be made to the
+	// secure port of the server. It is nil if TLS is disabled.
+	TLS *TLSOptions
+}
+
+// TLSOptions are the options of the TLS connections to the ClickHouse server.
+type TLSOptions struct {
+	// CAFile is the file of the CA certificate verifying the certificate of
+	// the server. The CA certificates of the system are used if it is empty.
+	CAFile string
+	// CertFile and KeyFile are the files of the client certificate and of its
+	// private key, presented to servers which require mutual TLS. They are
+	// read again for every connection, so that renewed certificates are used
+	// without a restart.
+	CertFile string
+	KeyFile  string
+	// ServerName is the name verified in the certificate of the server, if
+	// it differs from the host of the DSN, e.g. localhost.
+	ServerName string
+	// InsecureSkipVerify disables the verification of the certificate of the
+	// server.
+	InsecureSkipVerify bool
+}
+
+// NewDSNOptionsFromEnv returns the DSNOptions defined by the
+// CLICKHOUSE_DEBUG, CLICKHOUSE_COMPRESS, CLICKHOUSE_READ_TIMEOUT and
+// CLICKHOUSE_ALT_HOSTS environment variables, and by the CLICKHOUSE_TLS_*
+// ones, which are all optional. TLS is enabled if any of the latter is set.
+// The credentials and the database are left to the caller, see
+// NewCredentialsProviderFromEnv.
+func NewDSNOptionsFromEnv() (DSNOptions, error) {
+	var options DSNOptions
+	var err error
+	if value := os.Getenv(debugKey); value != "" {
+		if options.Debug, err = strconv.ParseBool(value); err != nil {
+			return options, fmt.Errorf("error when parsing %s: %v", debugKey, err)
+		}
+	}
+	if value := os.Getenv(compressKey); value != "" {
+		if options.Compress, err = strconv.ParseBool(value); err != nil {
+			return options, fmt.Errorf("error when parsing %s: %v", compressKey, err)
+		}
+	}
+	if value := os.Getenv(readTimeoutKey); value != "" {
+		if options.ReadTimeout, err = time.ParseDuration(value); err != nil {
+			return options, fmt.Errorf("error when parsing %s: %v", readTimeoutKey, err)
+		}
+		if options.ReadTimeout < 0 {
+			return options, fmt.Errorf("error when parsing %s: it should not be negative", readTimeoutKey)
+		}
+	}
+	options.AltHosts = ParseAltHosts(os.Getenv(altHostsKey))
+	if options.TLS, err = newTLSOptionsFromEnv(); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+func newTLSOptionsFromEnv() (*TLSOptions, error) {
+	options := TLSOptions{
+		CAFile:     os.Getenv(tlsCAFileKey),
+		CertFile:   os.Getenv(tlsCertFileKey),
+		KeyFile:    os.Getenv(tlsKeyFileKey),
+		ServerName: os.Getenv(tlsServerNameKey),
+	}
+	if value := os.Getenv(tlsInsecureSkipVerifyKey); value != "" {
+		var err error
+		if options.InsecureSkipVerify, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("error when parsing %s: %v", tlsInsecureSkipVerifyKey, err)
+		}
+	}
+	if (options.CertFile == "") != (options.KeyFile == "") {
+		return nil, fmt.Errorf("%s and %s should be set together", tlsCertFileKey, tlsKeyFileKey)
+	}
+	if options == (TLSOptions{}) {
+		return nil, nil
+	}
+	return &options, nil
+}
+
+// GetTLSSecret returns the name of the Secret holding the CA certificate and
+// the client certificate of the TLS connections, given by the
+// CLICKHOUSE_TLS_SECRET environment variable, so that it can be mounted in the
+// Pods of the Spark jobs. It is empty if TLS is disabled.
+func GetTLSSecret() string {
+	return os.Getenv(tlsSecretKey)
+}
+
+// GetTLSInsecureSkipVerify returns whether the verification of the certificate
+// of the server is disabled by CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY. An invalid
+// value is reported by NewDSNOptionsFromEnv, and is false here.
+func GetTLSInsecureSkipVerify() bool {
+	insecureSkipVerify, _ := strconv.ParseBool(os.Getenv(tlsInsecureSkipVerifyKey))
+	return insecureSkipVerify
+}
+
+// Config returns the TLS configuration of the connections. It fails if the
+// CA certificate or the client certificate cannot be loaded.
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: o.ServerName,
+		// #nosec G402: the verification is only skipped when requested
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		caCert, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error when reading the ClickHouse CA certificate: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("error when reading the ClickHouse CA certificate: no certificate found in %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile); err != nil {
+			return nil, fmt.Errorf("error when loading the ClickHouse client certificate: %v", err)
+		}
+		certFile, keyFile := o.CertFile, o.KeyFile
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("error when loading the ClickHouse client certificate: %v", err)
+			}
+			return &cert, nil
+		}
+	}
+	return config, nil
+}
+
+// RegisterTLSConfig registers the TLS configuration referred to by the DSN in
+// the driver. It must be called before opening the connections if TLS is
+// enabled, and does nothing otherwise.
+func (o DSNOptions) RegisterTLSConfig() error {
+	if o.TLS == nil {
+		return nil
+	}
+	config, err := o.TLS.Config()
+	if err != nil {
+		return err
+	}
+	return clickhouse.RegisterTLSConfig(tlsConfigName, config)
+}
+
+// ParseAltHosts returns the addresses of a comma-separated list.
+func ParseAltHosts(value string) []string {
+	var altHosts []string
+	for _, host := range strings.Split(value, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			altHosts = append(altHosts, host)
+		}
+	}
+	return altHosts
+}
+
+// DSN returns the DSN of the ClickHouse server at address, e.g.
+// tcp://localhost:9000, with the options and the current credentials as query
+// parameters. The DSN includes the password, and must not be logged without
+// ScrubDSN.
+func (o DSNOptions) DSN(address string) (string, error) {
+	if o.Credentials == nil {
+		return "", fmt.Errorf("no ClickHouse credentials")
+	}
+	username, password, err := o.Credentials.Credentials()
+	if err != nil {
+		return "", err
+	}
+	params := []string{
+		"debug=" + strconv.FormatBool(o.Debug),
+		"username=" + url.QueryEscape(username),
+		"password=" + url.QueryEscape(password),
+	}
+	if o.Database != "" {
+		params = append(params, "database="+url.QueryEscape(o.Database))
+	}
+	if o.Compress {
+		params = append(params, "compress=true")
+	}
+	if o.ReadTimeout > 0 {
+		params = append(params, "read_timeout="+strconv.FormatFloat(o.ReadTimeout.Seconds(), 'f', -1, 64))
+	}
+	if len(o.AltHosts) > 0 {
+		params = append(params, "alt_hosts="+url.QueryEscape(strings.Join(o.AltHosts, ",")))
+	}
+	if o.TLS != nil {
+		params = append(params, "secure=true", "tls_config="+tlsConfigName)
+	}
+	return address + "?" + strings.Join(params, "&"), nil
+}
+
+// Connector returns the connector of the connections to the ClickHouse server
+// at address, to be opened with sql.OpenDB. Unlike a DSN, it gets the
+// credentials again for every new connection, so that rotated credentials are
+// used without a restart.
+func (o DSNOptions) Connector(address string) driver.Connector {
+	return &connector{options: o, address: address}
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	certutil "k8s.io/client-go/util/cert"
+)
+
+func TestNewDSNOptionsFromEnv(t *testing.T) {
+	testCases := []struct {
+		name             string
+		env              map[string]string
+		expectedOptions  DSNOptions
+		expectedErrorMsg string
+	}{
+		{
+			name:            "Defaults",
+			expectedOptions: DSNOptions{},
+		},
+		{
+			name: "All options",
+			env: map[string]string{
+				debugKey:       "true",
+				compressKey:    "1",
+				readTimeoutKey: "1m30s",
+				altHostsKey:    "clickhouse-1:9000, clickhouse-2:9000,",
+			},
+			expectedOptions: DSNOptions{
+				Debug:       true,
+				Compress:    true,
+				ReadTimeout: 90 * time.Second,
+				AltHosts:    []string{"clickhouse-1:9000", "clickhouse-2:9000"},
+			},
+		},
+		{
+			name: "TLS with client certificate",
+			env: map[string]string{
+				tlsCAFileKey:     "/etc/clickhouse-tls/ca.crt",
+				tlsCertFileKey:   "/etc/clickhouse-tls/tls.crt",
+				tlsKeyFileKey:    "/etc/clickhouse-tls/tls.key",
+				tlsServerNameKey: "clickhouse-clickhouse.flow-visibility.svc",
+			},
+			expectedOptions: DSNOptions{
+				TLS: &TLSOptions{
+					CAFile:     "/etc/clickhouse-tls/ca.crt",
+					CertFile:   "/etc/clickhouse-tls/tls.crt",
+					KeyFile:    "/etc/clickhouse-tls/tls.key",
+					ServerName: "clickhouse-clickhouse.flow-visibility.svc",
+				},
+			},
+		},
+		{
+			name:            "TLS without verification",
+			env:             map[string]string{tlsInsecureSkipVerifyKey: "true"},
+			expectedOptions: DSNOptions{TLS: &TLSOptions{InsecureSkipVerify: true}},
+		},
+		{
+			name:             "Client certificate without key",
+			env:              map[string]string{tlsCertFileKey: "/etc/clickhouse-tls/tls.crt"},
+			expectedErrorMsg: "CLICKHOUSE_TLS_CERT_FILE and CLICKHOUSE_TLS_KEY_FILE should be set together",
+		},
+		{
+			name:             "Invalid TLS insecure skip verify",
+			env:              map[string]string{tlsInsecureSkipVerifyKey: "yes please"},
+			expectedErrorMsg: "error when parsing CLICKHOUSE_TLS_INSECURE_SKIP_VERIFY",
+		},
+		{
+			name:             "Invalid debug",
+			env:              map[string]string{debugKey: "verbose"},
+			expectedErrorMsg: "error when parsing CLICKHOUSE_DEBUG",
+		},
+		{
+			name:             "Invalid compress",
+			env:              map[string]string{compressKey: "lz4"},
+			expectedErrorMsg: "error when parsing CLICKHOUSE_COMPRESS",
+		},
+		{
+			name:             "Invalid read timeout",
+			env:              map[string]string{readTimeoutKey: "30"},
+			expectedErrorMsg: "error when parsing CLICKHOUSE_READ_TIMEOUT",
+		},
+		{
+			name:             "Negative read timeout",
+			env:              map[string]string{readTimeoutKey: "-1s"},
+			expectedErrorMsg: "error when parsing CLICKHOUSE_READ_TIMEOUT: it should not be negative",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			options, err := NewDSNOptionsFromEnv()
+			if tc.expectedErrorMsg != "" {
+				assert.ErrorContains(t, err, tc.expectedErrorMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOptions, options)
+		})
+	}
+}
+
+func TestDSN(t *testing.T) {
+	credentials := &StaticCredentials{Username: "username", Password: "password"}
+	options := DSNOptions{Credentials: credentials}
+	dsn, err := options.DSN("tcp://localhost:9000")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=password", dsn)
+
+	options = DSNOptions{
+		Credentials: &StaticCredentials{Username: "username", Password: "p&ss=word"},
+		Database:    "theia",
+		Debug:       true,
+		Compress:    true,
+		ReadTimeout: 1500 * time.Millisecond,
+		AltHosts:    []string{"clickhouse-1:9000", "clickhouse-2:9000"},
+	}
+	dsn, err = options.DSN("tcp://localhost:9000")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://localhost:9000?debug=true&username=username&password=p%26ss%3Dword&database=theia&compress=true&read_timeout=1.5&alt_hosts=clickhouse-1%3A9000%2Cclickhouse-2%3A9000", dsn)
+
+	options = DSNOptions{Credentials: credentials, TLS: &TLSOptions{CertFile: "tls.crt", KeyFile: "tls.key"}}
+	dsn, err = options.DSN("tcp://localhost:9440")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://localhost:9440?debug=false&username=username&password=password&secure=true&tls_config=theia", dsn)
+
+	_, err = DSNOptions{}.DSN("tcp://localhost:9000")
+	assert.EqualError(t, err, "no ClickHouse credentials")
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, err := certutil.GenerateSelfSignedCertKey("theia-manager", nil, nil)
+	require.NoError(t, err)
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(caFile, cert, 0600))
+	require.NoError(t, os.WriteFile(certFile, cert, 0600))
+	require.NoError(t, os.WriteFile(keyFile, key, 0600))
+
+	options := &TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "theia-manager"}
+	config, err := options.Config()
+	require.NoError(t, err)
+	assert.NotNil(t, config.RootCAs)
+	assert.Equal(t, "theia-manager", config.ServerName)
+	assert.False(t, config.InsecureSkipVerify)
+	clientCert, err := config.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, clientCert.Certificate)
+	assert.NoError(t, DSNOptions{TLS: options}.RegisterTLSConfig())
+
+	options = &TLSOptions{InsecureSkipVerify: true}
+	config, err = options.Config()
+	require.NoError(t, err)
+	assert.Nil(t, config.RootCAs)
+	assert.Nil(t, config.GetClientCertificate)
+	assert.True(t, config.InsecureSkipVerify)
+
+	_, err = (&TLSOptions{CAFile: keyFile}).Config()
+	assert.ErrorContains(t, err, "error when reading the ClickHouse CA certificate: no certificate found in")
+	_, err = (&TLSOptions{CertFile: certFile, KeyFile: caFile}).Config()
+	assert.ErrorContains(t, err, "error when loading the ClickHouse client certificate")
+	_, err = (&TLSOptions{CAFile: filepath.Join(dir, "missing.crt")}).Config()
+	assert.ErrorContains(t, err, "error when reading the ClickHouse CA certificate")
+}
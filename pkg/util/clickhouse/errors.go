@@ -0,0 +1,158 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go"
+)
+
+// ErrorClass is the class of the errors returned by the ClickHouse server
+// which the users can remediate.
+type ErrorClass string
+
+const (
+	ErrorClassAuthenticationFailed ErrorClass = "AuthenticationFailed"
+	ErrorClassTableMissing         ErrorClass = "TableMissing"
+	ErrorClassMemoryLimitExceeded  ErrorClass = "MemoryLimitExceeded"
+	ErrorClassReadOnlyReplica      ErrorClass = "ReadOnlyReplica"
+	ErrorClassTooManyParts         ErrorClass = "TooManyParts"
+)
+
+// The codes of the ClickHouse errors, from src/Common/ErrorCodes.cpp of the
+// ClickHouse server.
+const (
+	unknownTableErrorCode         = 60
+	unknownDatabaseErrorCode      = 81
+	readOnlyErrorCode             = 164
+	unknownUserErrorCode          = 192
+	wrongPasswordErrorCode        = 193
+	requiredPasswordErrorCode     = 194
+	memoryLimitExceededErrorCode  = 241
+	tableIsReadOnlyErrorCode      = 242
+	tooManyPartsErrorCode         = 252
+	authenticationFailedErrorCode = 516
+)
+
+// hintPrefix separates the hint from the error in the message of an Error.
+const hintPrefix = "; hint: "
+
+var (
+	errorClasses = map[int32]ErrorClass{
+		unknownTableErrorCode:         ErrorClassTableMissing,
+		unknownDatabaseErrorCode:      ErrorClassTableMissing,
+		readOnlyErrorCode:             ErrorClassReadOnlyReplica,
+		unknownUserErrorCode:          ErrorClassAuthenticationFailed,
+		wrongPasswordErrorCode:        ErrorClassAuthenticationFailed,
+		requiredPasswordErrorCode:     ErrorClassAuthenticationFailed,
+		memoryLimitExceededErrorCode:  ErrorClassMemoryLimitExceeded,
+		tableIsReadOnlyErrorCode:      ErrorClassReadOnlyReplica,
+		tooManyPartsErrorCode:         ErrorClassTooManyParts,
+		authenticationFailedErrorCode: ErrorClassAuthenticationFailed,
+	}
+	errorHints = map[ErrorClass]string{
+		ErrorClassAuthenticationFailed: "check that the username and password of the clickhouse-secret Secret, or of the files of CLICKHOUSE_USERNAME_FILE and CLICKHOUSE_PASSWORD_FILE, match a ClickHouse user",
+		ErrorClassTableMissing:         `the data schema may not be created or migrated yet, check the data schema version with "theia clickhouse status --schemaVersion" and the logs of the ClickHouse schema management`,
+		ErrorClassMemoryLimitExceeded:  "narrow the time range or lower the limit of the request, or give more memory to the ClickHouse server",
+		ErrorClassReadOnlyReplica:      "the ClickHouse replica is read-only, which happens when it loses its connection to ZooKeeper, check the ZooKeeper Pods and retry once the replica is writable",
+		ErrorClassTooManyParts:         `inserts are too frequent for the merges to keep up, send fewer and larger batches of records, and check the merges in progress with "theia clickhouse status --merges"`,
+	}
+	// errorCodeRegex matches the code of the ClickHouse errors in their
+	// messages, as returned by the HTTP interface and the JDBC driver, e.g.
+	// "Code: 60. DB::Exception: Table default.flows doesn't exist", or by the
+	// native driver, e.g. "code: 60, message: Table default.flows doesn't
+	// exist".
+	errorCodeRegex = regexp.MustCompile(`(?i)\bcode: ([0-9]+)[.,]`)
+)
+
+// Error is an error returned by the ClickHouse server with a class which the
+// users can remediate. Its message includes a hint at the remediation.
+type Error struct {
+	Class ErrorClass
+	err   error
+}
+
+func (e *Error) Error() string {
+	return e.err.Error() + hintPrefix + e.Hint()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Hint returns how the users can remediate the error.
+func (e *Error) Hint() string {
+	return errorHints[e.Class]
+}
+
+// ClassifyError returns err as an Error if it is a ClickHouse error of a known
+// class, or else err itself. The ClickHouse errors are recognized as returned
+// by the driver or by their code in the message of err, so that the errors
+// which were already formatted are classified too.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	// The error may already have been classified, and then formatted.
+	if strings.Contains(err.Error(), hintPrefix) {
+		return err
+	}
+	class, ok := classifyErrorCode(err)
+	if !ok {
+		return err
+	}
+	return &Error{Class: class, err: err}
+}
+
+// GetHint returns the hint at the remediation of the ClickHouse error in
+// message, e.g. the error message of a job, or an empty string if the error is
+// not of a known class or if message already includes a hint.
+func GetHint(message string) string {
+	if strings.Contains(message, hintPrefix) {
+		return ""
+	}
+	class, ok := classifyErrorCode(errors.New(message))
+	if !ok {
+		return ""
+	}
+	return errorHints[class]
+}
+
+func classifyErrorCode(err error) (ErrorClass, bool) {
+	if err == nil {
+		return "", false
+	}
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) {
+		class, ok := errorClasses[exception.Code]
+		return class, ok
+	}
+	// The code of the first error is the one of the server, the others
+	// being the ones of the nested errors.
+	matches := errorCodeRegex.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return "", false
+	}
+	code, err := strconv.ParseInt(matches[1], 10, 32)
+	if err != nil {
+		return "", false
+	}
+	class, ok := errorClasses[int32(code)]
+	return class, ok
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		err           error
+		expectedClass ErrorClass
+	}{
+		{
+			name:          "Driver exception",
+			err:           fmt.Errorf("error when querying: %w", &clickhouse.Exception{Code: 516, Message: "default: Authentication failed"}),
+			expectedClass: ErrorClassAuthenticationFailed,
+		},
+		{
+			name:          "Formatted driver exception",
+			err:           fmt.Errorf("error when getting diskInfo from clickhouse: %v", &clickhouse.Exception{Code: 60, Message: "Table default.flows doesn't exist."}),
+			expectedClass: ErrorClassTableMissing,
+		},
+		{
+			name:          "HTTP interface error",
+			err:           fmt.Errorf("error when sending query to ClickHouse: 500 Internal Server Error: Code: 241. DB::Exception: Memory limit (for query) exceeded"),
+			expectedClass: ErrorClassMemoryLimitExceeded,
+		},
+		{
+			name:          "Read-only replica",
+			err:           &clickhouse.Exception{Code: 242, Message: "Table is in readonly mode"},
+			expectedClass: ErrorClassReadOnlyReplica,
+		},
+		{
+			name:          "Too many parts",
+			err:           fmt.Errorf("Code: 252. DB::Exception: Too many parts (300). Merges are processing significantly slower than inserts"),
+			expectedClass: ErrorClassTooManyParts,
+		},
+		{
+			name: "Other ClickHouse error",
+			err:  &clickhouse.Exception{Code: 62, Message: "Syntax error"},
+		},
+		{
+			name: "Other error",
+			err:  fmt.Errorf("connection refused"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ClassifyError(tc.err)
+			if tc.expectedClass == "" {
+				assert.Equal(t, tc.err, err)
+				return
+			}
+			var chErr *Error
+			require.ErrorAs(t, err, &chErr)
+			assert.Equal(t, tc.expectedClass, chErr.Class)
+			assert.Equal(t, tc.err.Error()+"; hint: "+errorHints[tc.expectedClass], err.Error())
+			assert.ErrorIs(t, err, tc.err)
+			// A classified error is not classified again once formatted.
+			formattedErr := fmt.Errorf("error when getting stats: %v", err)
+			assert.Equal(t, formattedErr, ClassifyError(formattedErr))
+		})
+	}
+	assert.NoError(t, ClassifyError(nil))
+}
+
+func TestGetHint(t *testing.T) {
+	assert.Equal(t, errorHints[ErrorClassMemoryLimitExceeded], GetHint("Failed to run the job: Code: 241. DB::Exception: Memory limit (total) exceeded"))
+	assert.Empty(t, GetHint("Failed to run the job: out of disk"))
+	assert.Empty(t, GetHint(ClassifyError(fmt.Errorf("Code: 241. DB::Exception: Memory limit (total) exceeded")).Error()))
+}
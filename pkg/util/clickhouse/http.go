@@ -0,0 +1,149 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"antrea.io/theia/pkg/util/env"
+)
+
+const (
+	httpURLKey = "CLICKHOUSE_HTTP_URL"
+	// httpPortName is the name of the port of the HTTP interface in the
+	// ClickHouse Service.
+	httpPortName = "http"
+	// httpsPortName is the name of the port of the HTTPS interface, used
+	// when TLS is enabled.
+	httpsPortName = "https"
+)
+
+var httpClient = http.DefaultClient
+
+// StreamQuery runs a query through the HTTP interface of the ClickHouse
+// server, and returns the body of the response, which the server streams in
+// the format of the FORMAT clause of the query. The query parameters, referred
+// to as {name:Type} in the query, and the settings are sent as URL parameters.
+// Like the native connections, the response is compressed if
+// CLICKHOUSE_COMPRESS is true, with gzip, which the HTTP client decompresses
+// transparently. If TLS is enabled, the query is sent to the HTTPS interface
+// with the TLS configuration of the native connections. The caller must close
+// the body.
+func StreamQuery(ctx context.Context, client kubernetes.Interface, query string, params, settings map[string]string) (io.ReadCloser, error) {
+	options, err := NewDSNOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	baseURL, username, password, err := getClickHouseHTTPURL(client, options.TLS != nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ClickHouse HTTP URL: %v", err)
+	}
+	queryClient := httpClient
+	if options.TLS != nil {
+		tlsConfig, err := options.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		queryClient = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}}
+	}
+	values := url.Values{}
+	for name, value := range params {
+		values.Set("param_"+name, value)
+	}
+	for name, value := range settings {
+		values.Set(name, value)
+	}
+	if database := os.Getenv(databaseKey); database != "" {
+		values.Set("database", database)
+	}
+	if options.Compress {
+		values.Set("enable_http_compression", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/?"+values.Encode(), strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-ClickHouse-User", username)
+	req.Header.Set("X-ClickHouse-Key", password)
+	resp, err := queryClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error when sending query to ClickHouse: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, ClassifyError(fmt.Errorf("error when sending query to ClickHouse: %s: %s", resp.Status, strings.TrimSpace(string(message))))
+	}
+	return resp.Body, nil
+}
+
+// getClickHouseHTTPURL returns the URL of the HTTP interface of the ClickHouse
+// server and the current credentials, from the environment variables or else
+// from the ClickHouse Service and Secret, in which case the port of the HTTPS
+// interface is used if secure is true.
+func getClickHouseHTTPURL(client kubernetes.Interface, secure bool) (baseURL, username, password string, err error) {
+	baseURL = os.Getenv(httpURLKey)
+	credentials, err := NewCredentialsProviderFromEnv(os.Getenv)
+	if err != nil {
+		return "", "", "", err
+	}
+	if baseURL != "" && credentials != nil {
+		username, password, err = credentials.Credentials()
+		if err != nil {
+			return "", "", "", err
+		}
+		return baseURL, username, password, nil
+	}
+	if client == nil {
+		client, err = createK8sClient()
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to create k8s client: %v", err)
+		}
+	}
+	service, err := client.CoreV1().Services(env.GetTheiaNamespace()).Get(context.TODO(), ServiceName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", "", fmt.Errorf("error when finding the Service %s: %v", ServiceName, err)
+	}
+	scheme, portName := "http", httpPortName
+	if secure {
+		scheme, portName = "https", httpsPortName
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Name == portName {
+			baseURL = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(service.Spec.ClusterIP, fmt.Sprint(port.Port)))
+		}
+	}
+	if baseURL == "" {
+		return "", "", "", fmt.Errorf("error when finding the Service %s: no %s service port", ServiceName, portName)
+	}
+	username, password, err = GetSecret(client, env.GetTheiaNamespace())
+	if err != nil {
+		return "", "", "", err
+	}
+	return baseURL, username, password, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStreamQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-ClickHouse-User") != "username" || r.Header.Get("X-ClickHouse-Key") != "password" {
+			http.Error(w, "Code: 516. DB::Exception: username: Authentication failed", http.StatusUnauthorized)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "SELECT * FROM flows WHERE flowEndSeconds >= toDateTime({startTime:UInt32}) FORMAT CSVWithNames", string(query))
+		values := r.URL.Query()
+		compress := values.Get("enable_http_compression") == "1"
+		values.Del("enable_http_compression")
+		assert.Equal(t, url.Values{
+			"param_startTime": {"1693562400"},
+			"max_block_size":  {"1000"},
+			"database":        {"theia"},
+		}, values)
+		if compress && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gzipWriter := gzip.NewWriter(w)
+			defer gzipWriter.Close()
+			gzipWriter.Write([]byte("flowStartSeconds,flowEndSeconds\n"))
+			return
+		}
+		w.Write([]byte("flowStartSeconds,flowEndSeconds\n"))
+	}))
+	defer server.Close()
+	query := "SELECT * FROM flows WHERE flowEndSeconds >= toDateTime({startTime:UInt32}) FORMAT CSVWithNames"
+	params := map[string]string{"startTime": "1693562400"}
+	settings := map[string]string{"max_block_size": "1000"}
+	t.Setenv(databaseKey, "theia")
+
+	t.Run("Read address from environment", func(t *testing.T) {
+		t.Setenv(usernameKey, "username")
+		t.Setenv(passwordKey, "password")
+		t.Setenv(httpURLKey, server.URL)
+		stream, err := StreamQuery(context.TODO(), nil, query, params, settings)
+		require.NoError(t, err)
+		defer stream.Close()
+		data, err := io.ReadAll(stream)
+		assert.NoError(t, err)
+		assert.Equal(t, "flowStartSeconds,flowEndSeconds\n", string(data))
+	})
+
+	t.Run("Compression", func(t *testing.T) {
+		t.Setenv(usernameKey, "username")
+		t.Setenv(passwordKey, "password")
+		t.Setenv(httpURLKey, server.URL)
+		t.Setenv(compressKey, "true")
+		stream, err := StreamQuery(context.TODO(), nil, query, params, settings)
+		require.NoError(t, err)
+		defer stream.Close()
+		data, err := io.ReadAll(stream)
+		assert.NoError(t, err)
+		assert.Equal(t, "flowStartSeconds,flowEndSeconds\n", string(data))
+	})
+
+	t.Run("Get address from K8s client", func(t *testing.T) {
+		fakeClientset := fake.NewSimpleClientset()
+		// The ClickHouse Service and Secret of CreateFakeClickHouse, with
+		// the port of the HTTP interface.
+		CreateFakeClickHouse(t, fakeClientset, testNamespace)
+		host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+		httpPort, _ := strconv.Atoi(port)
+		service, _ := fakeClientset.CoreV1().Services(testNamespace).Get(context.TODO(), ServiceName, metav1.GetOptions{})
+		service.Spec.ClusterIP = host
+		service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{Name: httpPortName, Port: int32(httpPort), Protocol: ServicePortProtocal})
+		fakeClientset.CoreV1().Services(testNamespace).Update(context.TODO(), service, metav1.UpdateOptions{})
+		stream, err := StreamQuery(context.TODO(), fakeClientset, query, params, settings)
+		require.NoError(t, err)
+		stream.Close()
+	})
+
+	t.Run("Query error", func(t *testing.T) {
+		t.Setenv(usernameKey, "username")
+		t.Setenv(passwordKey, "wrong")
+		t.Setenv(httpURLKey, server.URL)
+		_, err := StreamQuery(context.TODO(), nil, query, params, settings)
+		assert.ErrorContains(t, err, "error when sending query to ClickHouse: 401 Unauthorized: Code: 516. DB::Exception: username: Authentication failed; hint: ")
+		var chErr *Error
+		require.ErrorAs(t, err, &chErr)
+		assert.Equal(t, ErrorClassAuthenticationFailed, chErr.Class)
+	})
+
+	t.Run("No HTTP port", func(t *testing.T) {
+		fakeClientset := fake.NewSimpleClientset()
+		CreateFakeClickHouse(t, fakeClientset, testNamespace)
+		_, err := StreamQuery(context.TODO(), fakeClientset, query, params, settings)
+		assert.EqualError(t, err, "failed to get ClickHouse HTTP URL: error when finding the Service clickhouse-clickhouse: no http service port")
+	})
+
+	t.Run("No HTTPS port", func(t *testing.T) {
+		fakeClientset := fake.NewSimpleClientset()
+		CreateFakeClickHouse(t, fakeClientset, testNamespace)
+		t.Setenv(tlsInsecureSkipVerifyKey, "true")
+		_, err := StreamQuery(context.TODO(), fakeClientset, query, params, settings)
+		assert.EqualError(t, err, "failed to get ClickHouse HTTP URL: error when finding the Service clickhouse-clickhouse: no https service port")
+	})
+}
+
+func TestStreamQueryTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("flowStartSeconds,flowEndSeconds\n"))
+	}))
+	defer server.Close()
+	t.Setenv(usernameKey, "username")
+	t.Setenv(passwordKey, "password")
+	t.Setenv(httpURLKey, server.URL)
+
+	_, err := StreamQuery(context.TODO(), nil, "SELECT 1", nil, nil)
+	assert.ErrorContains(t, err, "certificate")
+
+	t.Setenv(tlsInsecureSkipVerifyKey, "true")
+	stream, err := StreamQuery(context.TODO(), nil, "SELECT 1", nil, nil)
+	require.NoError(t, err)
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, "flowStartSeconds,flowEndSeconds\n", string(data))
+}
@@ -17,6 +17,7 @@ package clickhouse
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -31,10 +32,9 @@ func CreateFakeClickHouse(t *testing.T, kubeClient kubernetes.Interface, namespa
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
-	openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
-		assert.Equal(t, driverName, "clickhouse")
-		assert.Equal(t, dataSourceName, "tcp://localhost:9000?debug=false&username=username&password=password")
-		return db, nil
+	openDB = func(c driver.Connector) *sql.DB {
+		assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=password", connectorDSN(t, c))
+		return db
 	}
 	clickHousePod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -72,3 +72,17 @@ func CreateFakeClickHouse(t *testing.T, kubeClient kubernetes.Interface, namespa
 	mock.ExpectPing()
 	return db, mock
 }
+
+// connectorDSN returns the DSN of the next connection opened by a connector
+// returned by DSNOptions.Connector.
+func connectorDSN(t *testing.T, c driver.Connector) string {
+	dsnConnector, ok := c.(*connector)
+	if !ok {
+		t.Fatalf("unexpected connector %T", c)
+	}
+	dsn, err := dsnConnector.options.DSN(dsnConnector.address)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when getting the DSN", err)
+	}
+	return dsn
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		spec             string
+		expectedErrorMsg string
+	}{
+		{"* * * *", "should have 5 fields, got 4"},
+		{"60 * * * *", "invalid minute in cron expression \"60 * * * *\": value 60 out of range [0, 59]"},
+		{"* 24 * * *", "invalid hour"},
+		{"* * 0 * *", "invalid day of month"},
+		{"* * * 13 *", "invalid month"},
+		{"* * * * 8", "invalid day of week"},
+		{"*/0 * * * *", "invalid step \"0\""},
+		{"10-5 * * * *", "invalid range \"10-5\""},
+		{"a * * * *", "invalid value \"a\""},
+		{"@every", "should have 5 fields, got 1"},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			_, err := Parse(tc.spec)
+			assert.ErrorContains(t, err, tc.expectedErrorMsg)
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// A Monday.
+	now := time.Date(2023, 5, 1, 10, 30, 15, 0, time.UTC)
+	for _, tc := range []struct {
+		spec     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"* * * * *", now, time.Date(2023, 5, 1, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", now, time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", now, time.Date(2023, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", now, time.Date(2023, 5, 7, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", now, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", now, time.Date(2023, 5, 1, 10, 45, 0, 0, time.UTC)},
+		{"5,35 8-18/2 * * *", now, time.Date(2023, 5, 1, 10, 35, 0, 0, time.UTC)},
+		{"5 9-17/2 * * *", now, time.Date(2023, 5, 1, 11, 5, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", now, time.Date(2023, 5, 2, 9, 0, 0, 0, time.UTC)},
+		// Sunday as 7.
+		{"0 9 * * 7", now, time.Date(2023, 5, 7, 9, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week.
+		{"0 0 15 * 5", now, time.Date(2023, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", now, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Never due.
+		{"0 0 30 2 *", now, time.Time{}},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			schedule, err := Parse(tc.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, schedule.Next(tc.from))
+		})
+	}
+}
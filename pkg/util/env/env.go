@@ -15,6 +15,7 @@
 package env
 
 import (
+	"net"
 	"os"
 
 	"k8s.io/klog/v2"
@@ -22,6 +23,7 @@ import (
 
 const (
 	podNamespaceEnvKey = "POD_NAMESPACE"
+	podIPEnvKey        = "POD_IP"
 
 	defaultTheiaNamespace = "flow-visibility"
 )
@@ -46,3 +48,19 @@ func GetTheiaNamespace() string {
 	}
 	return namespace
 }
+
+// GetPodIP returns the primary IP of the Pod where the code executes, read from
+// the POD_IP environment variable, or nil if the variable is not set or is not
+// a valid IP.
+func GetPodIP() net.IP {
+	podIP := os.Getenv(podIPEnvKey)
+	if podIP == "" {
+		klog.V(2).InfoS("Environment variable not found", "Environment Key", podIPEnvKey)
+		return nil
+	}
+	ip := net.ParseIP(podIP)
+	if ip == nil {
+		klog.InfoS("Invalid Pod IP in environment", "Environment Key", podIPEnvKey, "value", podIP)
+	}
+	return ip
+}
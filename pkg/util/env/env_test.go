@@ -63,3 +63,28 @@ func compareTheiaNamespace(k, v string, t *testing.T) {
 		t.Errorf("Failed to retrieve pod namespace, want: %s, get: %s", v, podNamespace)
 	}
 }
+
+func TestGetPodIP(t *testing.T) {
+	testTable := map[string]string{
+		"10.10.0.1":    "10.10.0.1",
+		"fd00:10::1":   "fd00:10::1",
+		"fd00:10:0::1": "fd00:10::1",
+		"invalid":      "<nil>",
+		"":             "<nil>",
+	}
+
+	for k, v := range testTable {
+		comparePodIP(k, v, t)
+	}
+}
+
+func comparePodIP(k, v string, t *testing.T) {
+	if k != "" {
+		_ = os.Setenv(podIPEnvKey, k)
+		defer os.Unsetenv(podIPEnvKey)
+	}
+	podIP := GetPodIP().String()
+	if podIP != v {
+		t.Errorf("Failed to retrieve pod IP, want: %s, get: %s", v, podIP)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	binaryUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	decimalUnits = []string{"B/s", "KB/s", "MB/s", "GB/s", "TB/s", "PB/s", "EB/s"}
+)
+
+// Bytes renders a number of bytes with binary units, e.g. "1.50 GiB".
+func Bytes(bytes uint64) string {
+	return scale(float64(bytes), 1024, binaryUnits)
+}
+
+// ParseBytes parses a number of bytes, either plain or rendered with binary
+// units like by Bytes and by the formatReadableSize function of ClickHouse,
+// e.g. "1.50 GiB". Rendered sizes are rounded, so the result is approximate.
+func ParseBytes(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	if bytes, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return bytes, nil
+	}
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	number, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	for i, unit := range binaryUnits {
+		if fields[1] == unit {
+			return uint64(number * math.Pow(1024, float64(i))), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid unit of size %q", value)
+}
+
+// Rate renders a number of bytes per second with decimal units, e.g. "12.34 MB/s".
+func Rate(bytesPerSecond float64) string {
+	return scale(bytesPerSecond, 1000, decimalUnits)
+}
+
+// Percentage renders a ratio expressed in percent, e.g. "42.00 %".
+func Percentage(percentage float64) string {
+	return fmt.Sprintf("%.2f %%", percentage)
+}
+
+// Duration renders a duration rounded to the second, e.g. "1h2m3s". Durations
+// shorter than a second are rounded to the millisecond instead.
+func Duration(d time.Duration) string {
+	if d < 0 {
+		return "-" + Duration(-d)
+	}
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func scale(value float64, base float64, units []string) string {
+	i := 0
+	for value >= base && i < len(units)-1 {
+		value /= base
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", value, units[i])
+}
+
+// Printer renders the numeric values returned by Theia APIs, which are
+// serialized as strings, for command output. When Raw is true, values are
+// printed unchanged so that the output can be consumed by other programs.
+// Values which cannot be parsed as numbers are always printed unchanged.
+type Printer struct {
+	Raw bool
+}
+
+// Bytes renders a number of bytes. See Bytes.
+func (p Printer) Bytes(value string) string {
+	if p.Raw {
+		return value
+	}
+	bytes, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return value
+	}
+	return Bytes(bytes)
+}
+
+// Rate renders a number of bytes per second. See Rate.
+func (p Printer) Rate(value string) string {
+	if p.Raw {
+		return value
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value
+	}
+	return Rate(rate)
+}
+
+// Percentage renders a ratio expressed in percent. See Percentage.
+func (p Printer) Percentage(value string) string {
+	if p.Raw {
+		return value
+	}
+	percentage, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value
+	}
+	return Percentage(percentage)
+}
+
+// Duration renders a duration. In raw mode, the duration is printed as a
+// number of seconds.
+func (p Printer) Duration(d time.Duration) string {
+	if p.Raw {
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	}
+	return Duration(d)
+}
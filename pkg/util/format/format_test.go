@@ -0,0 +1,108 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytes(t *testing.T) {
+	testCases := []struct {
+		bytes    uint64
+		expected string
+	}{
+		{0, "0.00 B"},
+		{1023, "1023.00 B"},
+		{1024, "1.00 KiB"},
+		{1536 * 1024 * 1024, "1.50 GiB"},
+		{1 << 62, "4.00 EiB"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, Bytes(tc.bytes))
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	testCases := []struct {
+		value         string
+		expected      uint64
+		expectedError string
+	}{
+		{value: "2048", expected: 2048},
+		{value: "1.00 KiB", expected: 1024},
+		{value: " 1.50 GiB ", expected: 1536 * 1024 * 1024},
+		{value: "0.00 B", expected: 0},
+		{value: "1.50", expectedError: "invalid size"},
+		{value: "1.50 GB", expectedError: "invalid unit of size"},
+		{value: "-1.00 KiB", expectedError: "invalid size"},
+	}
+	for _, tc := range testCases {
+		bytes, err := ParseBytes(tc.value)
+		if tc.expectedError != "" {
+			assert.ErrorContains(t, err, tc.expectedError, tc.value)
+		} else {
+			assert.NoError(t, err, tc.value)
+			assert.Equal(t, tc.expected, bytes, tc.value)
+		}
+	}
+}
+
+func TestRate(t *testing.T) {
+	testCases := []struct {
+		rate     float64
+		expected string
+	}{
+		{0, "0.00 B/s"},
+		{999, "999.00 B/s"},
+		{12345678, "12.35 MB/s"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, Rate(tc.rate))
+	}
+}
+
+func TestDuration(t *testing.T) {
+	testCases := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{0, "0s"},
+		{1234567 * time.Microsecond, "1s"},
+		{1500 * time.Microsecond, "2ms"},
+		{3723 * time.Second, "1h2m3s"},
+		{-90 * time.Second, "-1m30s"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, Duration(tc.duration))
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	printer := Printer{}
+	assert.Equal(t, "1.00 MiB", printer.Bytes("1048576"))
+	assert.Equal(t, "1.50 KB/s", printer.Rate("1500"))
+	assert.Equal(t, "99.13 %", printer.Percentage("99.13"))
+	assert.Equal(t, "2m0s", printer.Duration(2*time.Minute))
+	assert.Equal(t, "N/A", printer.Bytes("N/A"))
+
+	rawPrinter := Printer{Raw: true}
+	assert.Equal(t, "1048576", rawPrinter.Bytes("1048576"))
+	assert.Equal(t, "1500", rawPrinter.Rate("1500"))
+	assert.Equal(t, "99.13", rawPrinter.Percentage("99.13"))
+	assert.Equal(t, "120", rawPrinter.Duration(2*time.Minute))
+}
@@ -22,6 +22,8 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+
+	"antrea.io/theia/pkg/util/tracing"
 )
 
 func GetServiceAddr(client kubernetes.Interface, serviceName, serviceNamespace string, protocol v1.Protocol) (string, int, error) {
@@ -29,7 +31,7 @@ func GetServiceAddr(client kubernetes.Interface, serviceName, serviceNamespace s
 	var servicePort int
 	service, err := client.CoreV1().Services(serviceNamespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
 	if err != nil {
-		return serviceIP, servicePort, fmt.Errorf("error when finding the Service %s: %v", serviceName, err)
+		return serviceIP, servicePort, fmt.Errorf("error when finding the Service %s: %w", serviceName, err)
 	}
 	serviceIP = service.Spec.ClusterIP
 	for _, port := range service.Spec.Ports {
@@ -43,11 +45,27 @@ func GetServiceAddr(client kubernetes.Interface, serviceName, serviceNamespace s
 	return serviceIP, servicePort, nil
 }
 
+// GetServiceAddrByPortName returns the ClusterIP of a Service and its port with
+// the given name.
+func GetServiceAddrByPortName(client kubernetes.Interface, serviceName, serviceNamespace, portName string) (string, int, error) {
+	service, err := client.CoreV1().Services(serviceNamespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, fmt.Errorf("error when finding the Service %s: %v", serviceName, err)
+	}
+	for _, port := range service.Spec.Ports {
+		if port.Name == portName {
+			return service.Spec.ClusterIP, int(port.Port), nil
+		}
+	}
+	return service.Spec.ClusterIP, 0, fmt.Errorf("error when finding the Service %s: no %s service port", serviceName, portName)
+}
+
 func CreateK8sClient() (client kubernetes.Interface, err error) {
 	kubeConfig, err := rest.InClusterConfig()
 	if err != nil {
 		return client, fmt.Errorf("error when generating KubeConfig: %v", err)
 	}
+	kubeConfig.Wrap(tracing.WrapTransport)
 	client, err = kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
 		return client, fmt.Errorf("error when generating kubernetes client: %v", err)
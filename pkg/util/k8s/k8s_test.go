@@ -91,3 +91,31 @@ func TestGetServiceAddr(t *testing.T) {
 		})
 	}
 }
+
+func TestGetServiceAddrByPortName(t *testing.T) {
+	fakeClientset := fake.NewSimpleClientset(
+		&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      serviceName,
+				Namespace: serviceNamespace,
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{
+					{Name: "tcp", Port: int32(port), Protocol: protocol},
+					{Name: "secureclient", Port: 9440, Protocol: protocol},
+				},
+				ClusterIP: "10.98.208.26",
+			},
+		},
+	)
+	ip, port, err := GetServiceAddrByPortName(fakeClientset, serviceName, serviceNamespace, "secureclient")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.98.208.26", ip)
+	assert.Equal(t, 9440, port)
+
+	_, _, err = GetServiceAddrByPortName(fakeClientset, serviceName, serviceNamespace, "https")
+	assert.EqualError(t, err, fmt.Sprintf("error when finding the Service %s: no https service port", serviceName))
+
+	_, _, err = GetServiceAddrByPortName(fake.NewSimpleClientset(), serviceName, serviceNamespace, "secureclient")
+	assert.EqualError(t, err, fmt.Sprintf("error when finding the Service %s: services \"%s\" not found", serviceName, serviceName))
+}
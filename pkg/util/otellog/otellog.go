@@ -0,0 +1,276 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otellog
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EventNameKey is the attribute identifying the kind of event of a log
+	// record, e.g. "theia.job.state".
+	EventNameKey = attribute.Key("event.name")
+
+	instrumentationName = "antrea.io/theia"
+	// The records are exported in batches of at most maxBatchSize records,
+	// at least every flushInterval.
+	maxBatchSize  = 512
+	flushInterval = 5 * time.Second
+	// Records emitted while this number of records are waiting to be
+	// exported are dropped, so that a slow collector does not block the
+	// components emitting them.
+	queueSize = 2048
+	// Exporting a batch times out after 10 seconds.
+	exportTimeout = 10 * time.Second
+)
+
+// Severity is the severity of a log record, with the values of the
+// SeverityNumber of OTLP.
+type Severity int32
+
+const (
+	SeverityInfo  = Severity(logspb.SeverityNumber_SEVERITY_NUMBER_INFO)
+	SeverityWarn  = Severity(logspb.SeverityNumber_SEVERITY_NUMBER_WARN)
+	SeverityError = Severity(logspb.SeverityNumber_SEVERITY_NUMBER_ERROR)
+)
+
+var severityTexts = map[Severity]string{
+	SeverityInfo:  "INFO",
+	SeverityWarn:  "WARN",
+	SeverityError: "ERROR",
+}
+
+// Record is an event exported as an OTLP log record.
+type Record struct {
+	// EventName is exported as the event.name attribute.
+	EventName  string
+	Severity   Severity
+	Body       string
+	Attributes []attribute.KeyValue
+	// Timestamp defaults to the time the record is emitted.
+	Timestamp time.Time
+}
+
+// Exporter exports the records emitted by a component to an OTLP gRPC
+// collector, in batches.
+type Exporter struct {
+	client   collogspb.LogsServiceClient
+	resource *resourcepb.Resource
+	records  chan Record
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+	dropped  atomic.Uint64
+}
+
+var defaultExporter atomic.Pointer[Exporter]
+
+// Setup starts exporting the records emitted with Emit by serviceName to the
+// collector at endpoint, e.g. otel-collector.monitoring:4317. The connection is
+// insecure unless the endpoint starts with https://. If endpoint is empty, the
+// records are not exported. The returned function exports the records which
+// are not exported yet and closes the connection.
+func Setup(endpoint, serviceName string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	transportCredentials := insecure.NewCredentials()
+	if strings.HasPrefix(endpoint, "https://") {
+		endpoint = strings.TrimPrefix(endpoint, "https://")
+		transportCredentials = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	} else {
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+	}
+	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("error when connecting to the OTLP collector %s: %v", endpoint, err)
+	}
+	exporter := newExporter(collogspb.NewLogsServiceClient(conn), serviceName)
+	go exporter.run()
+	defaultExporter.Store(exporter)
+	klog.V(2).InfoS("Exporting OpenTelemetry logs", "endpoint", endpoint, "service", serviceName)
+	return func(ctx context.Context) error {
+		defaultExporter.CompareAndSwap(exporter, nil)
+		err := exporter.shutdown(ctx)
+		conn.Close()
+		return err
+	}, nil
+}
+
+// Emit exports the record with the exporter set up by Setup, if any.
+func Emit(record Record) {
+	if exporter := defaultExporter.Load(); exporter != nil {
+		exporter.Emit(record)
+	}
+}
+
+func newExporter(client collogspb.LogsServiceClient, serviceName string) *Exporter {
+	return &Exporter{
+		client: client,
+		resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{{
+			Key:   "service.name",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: serviceName}},
+		}}},
+		records: make(chan Record, queueSize),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+// Emit queues the record to be exported. The record is dropped if the queue
+// is full.
+func (e *Exporter) Emit(record Record) {
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	select {
+	case e.records <- record:
+	default:
+		if e.dropped.Add(1) == 1 {
+			klog.InfoS("Dropping OpenTelemetry log records as the queue is full", "queueSize", queueSize)
+		}
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.doneCh)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []Record
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			klog.ErrorS(err, "Failed to export OpenTelemetry log records", "records", len(batch))
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case record := <-e.records:
+			batch = append(batch, record)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stopCh:
+			for {
+				select {
+				case record := <-e.records:
+					batch = append(batch, record)
+					if len(batch) >= maxBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown exports the queued records and stops the exporter, or gives up
+// when ctx is done.
+func (e *Exporter) shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stopCh) })
+	select {
+	case <-e.doneCh:
+		if dropped := e.dropped.Load(); dropped > 0 {
+			klog.InfoS("Dropped OpenTelemetry log records", "records", dropped)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error when exporting the remaining log records: %v", ctx.Err())
+	}
+}
+
+func (e *Exporter) export(records []Record) error {
+	logRecords := make([]*logspb.LogRecord, 0, len(records))
+	for _, record := range records {
+		logRecords = append(logRecords, toLogRecord(record))
+	}
+	request := &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: instrumentationName},
+				LogRecords: logRecords,
+			}},
+		}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	response, err := e.client.Export(ctx, request)
+	if err != nil {
+		return err
+	}
+	if partialSuccess := response.GetPartialSuccess(); partialSuccess != nil && partialSuccess.RejectedLogRecords > 0 {
+		return fmt.Errorf("collector rejected %d log records: %s", partialSuccess.RejectedLogRecords, partialSuccess.ErrorMessage)
+	}
+	return nil
+}
+
+func toLogRecord(record Record) *logspb.LogRecord {
+	attributes := make([]*commonpb.KeyValue, 0, len(record.Attributes)+1)
+	if record.EventName != "" {
+		attributes = append(attributes, toKeyValue(EventNameKey.String(record.EventName)))
+	}
+	for _, kv := range record.Attributes {
+		attributes = append(attributes, toKeyValue(kv))
+	}
+	timestamp := uint64(record.Timestamp.UnixNano())
+	return &logspb.LogRecord{
+		TimeUnixNano:         timestamp,
+		ObservedTimeUnixNano: timestamp,
+		SeverityNumber:       logspb.SeverityNumber(record.Severity),
+		SeverityText:         severityTexts[record.Severity],
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: record.Body}},
+		Attributes:           attributes,
+	}
+}
+
+func toKeyValue(kv attribute.KeyValue) *commonpb.KeyValue {
+	value := &commonpb.AnyValue{}
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		value.Value = &commonpb.AnyValue_BoolValue{BoolValue: kv.Value.AsBool()}
+	case attribute.INT64:
+		value.Value = &commonpb.AnyValue_IntValue{IntValue: kv.Value.AsInt64()}
+	case attribute.FLOAT64:
+		value.Value = &commonpb.AnyValue_DoubleValue{DoubleValue: kv.Value.AsFloat64()}
+	default:
+		value.Value = &commonpb.AnyValue_StringValue{StringValue: kv.Value.Emit()}
+	}
+	return &commonpb.KeyValue{Key: string(kv.Key), Value: value}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otellog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+)
+
+type fakeLogsServiceClient struct {
+	mutex    sync.Mutex
+	requests []*collogspb.ExportLogsServiceRequest
+}
+
+func (c *fakeLogsServiceClient) Export(ctx context.Context, in *collogspb.ExportLogsServiceRequest, opts ...grpc.CallOption) (*collogspb.ExportLogsServiceResponse, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requests = append(c.requests, in)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestExporter(t *testing.T) {
+	client := &fakeLogsServiceClient{}
+	exporter := newExporter(client, "theia-manager")
+	go exporter.run()
+	timestamp := time.Date(2023, 6, 1, 8, 0, 0, 0, time.UTC)
+	exporter.Emit(Record{
+		EventName:  "theia.job.state",
+		Severity:   SeverityWarn,
+		Body:       "Failed policy recommendation job",
+		Attributes: []attribute.KeyValue{attribute.String("theia.job.state", "FAILED"), attribute.Int64("theia.job.stages", 3)},
+		Timestamp:  timestamp,
+	})
+	exporter.Emit(Record{EventName: "theia.flow.traffic_class", Severity: SeverityInfo, Body: "inter-node"})
+	require.NoError(t, exporter.shutdown(context.Background()))
+
+	require.Len(t, client.requests, 1)
+	resourceLogs := client.requests[0].ResourceLogs
+	require.Len(t, resourceLogs, 1)
+	assert.Equal(t, "service.name", resourceLogs[0].Resource.Attributes[0].Key)
+	assert.Equal(t, "theia-manager", resourceLogs[0].Resource.Attributes[0].Value.GetStringValue())
+	logRecords := resourceLogs[0].ScopeLogs[0].LogRecords
+	require.Len(t, logRecords, 2)
+	assert.Equal(t, uint64(timestamp.UnixNano()), logRecords[0].TimeUnixNano)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, logRecords[0].SeverityNumber)
+	assert.Equal(t, "WARN", logRecords[0].SeverityText)
+	assert.Equal(t, "Failed policy recommendation job", logRecords[0].Body.GetStringValue())
+	require.Len(t, logRecords[0].Attributes, 3)
+	assert.Equal(t, "event.name", logRecords[0].Attributes[0].Key)
+	assert.Equal(t, "theia.job.state", logRecords[0].Attributes[0].Value.GetStringValue())
+	assert.Equal(t, "FAILED", logRecords[0].Attributes[1].Value.GetStringValue())
+	assert.Equal(t, int64(3), logRecords[0].Attributes[2].Value.GetIntValue())
+	assert.NotZero(t, logRecords[1].TimeUnixNano)
+}
+
+func TestExporterDropsRecords(t *testing.T) {
+	exporter := newExporter(&fakeLogsServiceClient{}, "theia-manager")
+	for i := 0; i < queueSize+10; i++ {
+		exporter.Emit(Record{Body: "record"})
+	}
+	assert.Equal(t, uint64(10), exporter.dropped.Load())
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup("", "theia-manager")
+	require.NoError(t, err)
+	assert.Nil(t, defaultExporter.Load())
+	// Records are not exported without an endpoint.
+	Emit(Record{Body: "record"})
+	assert.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Setup("localhost:4317", "theia-manager")
+	require.NoError(t, err)
+	assert.NotNil(t, defaultExporter.Load())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, shutdown(ctx))
+	assert.Nil(t, defaultExporter.Load())
+}
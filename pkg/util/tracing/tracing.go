@@ -0,0 +1,112 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// EndpointEnvKey is the environment variable giving the address of the
+	// OTLP gRPC collector the spans are exported to. Tracing is disabled if
+	// it is not set.
+	EndpointEnvKey = "THEIA_OTEL_ENDPOINT"
+
+	instrumentationName = "antrea.io/theia"
+)
+
+// Setup configures the global TracerProvider to export the spans of
+// serviceName to the collector given by THEIA_OTEL_ENDPOINT, e.g.
+// otel-collector.monitoring:4317. The connection is insecure unless the
+// endpoint starts with https://. If THEIA_OTEL_ENDPOINT is not set, the global
+// TracerProvider is left as is, so that spans are not recorded. The returned
+// function flushes the spans which are not exported yet and stops the
+// exporter.
+func Setup(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	endpoint := os.Getenv(EndpointEnvKey)
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	options := []otlptracegrpc.Option{}
+	if strings.HasPrefix(endpoint, "https://") {
+		endpoint = strings.TrimPrefix(endpoint, "https://")
+	} else {
+		endpoint = strings.TrimPrefix(endpoint, "http://")
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	options = append(options, otlptracegrpc.WithEndpoint(endpoint))
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error when creating the OTLP exporter for %s: %v", endpoint, err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("error when creating the OpenTelemetry resource: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	klog.V(2).InfoS("Exporting OpenTelemetry traces", "endpoint", endpoint, "service", serviceName)
+	return provider.Shutdown, nil
+}
+
+// StartSpan starts a span of the Theia tracer. The span must be ended with
+// EndSpan.
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan records err, if not nil, as the error of the span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// StartClickHouseSpan starts a span for a ClickHouse query.
+func StartClickHouseSpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	return StartSpan(ctx, "clickhouse."+operation,
+		semconv.DBSystemKey.String("clickhouse"),
+		semconv.DBOperationKey.String(operation),
+		semconv.DBStatementKey.String(query),
+	)
+}
+
+// WrapTransport wraps rt to record a span for every HTTP request, e.g. to the
+// K8s API. It can be used as the WrapTransport of a K8s client config.
+func WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(rt)
+}
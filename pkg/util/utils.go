@@ -16,11 +16,37 @@ package util
 
 import (
 	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+const (
+	// JobTypeLabel is the label holding the type of a job on its CR and on
+	// its SparkApplication, so that the jobs of a type can be listed with a
+	// label selector among unrelated Spark jobs.
+	JobTypeLabel                = "theia.antrea.io/job-type"
+	JobTypePolicyRecommendation = "policy-reco"
+	JobTypeAnalytics            = "analytics"
+	// JobTemplateLabel is the label holding the name of the template of a
+	// custom analytics job on its SparkApplication.
+	JobTemplateLabel = "theia.antrea.io/job-template"
+	// CorrelationIDAnnotation is the annotation holding the correlation ID of
+	// a job on its CR and on its SparkApplication. The ID is logged by the
+	// theia CLI, the Theia Manager and the Spark job, and is the log_comment
+	// of the ClickHouse queries of the job, so that a job can be traced
+	// across them.
+	CorrelationIDAnnotation = "theia.antrea.io/correlation-id"
+)
+
+// reservedTagPrefixes are the prefixes of the label keys which are set by
+// Theia, Spark or the Spark Operator on the Pods of analytics jobs, and which
+// cannot be used as tags.
+var reservedTagPrefixes = []string{"theia.antrea.io/", "sparkoperator.k8s.io/", "spark-"}
+
 func ParseRecommendationName(npName string) error {
 	if !strings.HasPrefix(npName, "pr-") {
 		return fmt.Errorf("input name %s is not a valid policy recommendation job name", npName)
@@ -56,3 +82,139 @@ func ParseADAlgorithmID(tadName string) error {
 	}
 	return nil
 }
+
+// ParseAnalyticsJobName checks that the name of a custom analytics job is the
+// "job-" prefix followed by a UUID, the ID of the job.
+func ParseAnalyticsJobName(jobName string) error {
+	if !strings.HasPrefix(jobName, "job-") {
+		return fmt.Errorf("input name %s is not a valid analytics job name", jobName)
+	}
+	id := jobName[4:]
+	_, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("input name %s does not contain a valid UUID, parsing error: %v", jobName, err)
+	}
+	return nil
+}
+
+// GetRequestCorrelationID returns the correlation ID set by the client in the
+// annotations of a job it creates, or a new one if the client did not set
+// it. The ID should be a UUID, as it is added to the ClickHouse queries of the
+// job.
+func GetRequestCorrelationID(annotations map[string]string) (string, error) {
+	correlationID, ok := annotations[CorrelationIDAnnotation]
+	if !ok {
+		return uuid.New().String(), nil
+	}
+	if _, err := uuid.Parse(correlationID); err != nil {
+		return "", fmt.Errorf("correlation ID %s is not a valid UUID: %v", correlationID, err)
+	}
+	return correlationID, nil
+}
+
+// GetCorrelationID returns the correlation ID in the annotations of a job, or
+// the ID of the job if the job was created without a valid one, e.g. when its
+// CR was created directly rather than through the Theia Manager API.
+func GetCorrelationID(annotations map[string]string, jobID string) string {
+	correlationID := annotations[CorrelationIDAnnotation]
+	if _, err := uuid.Parse(correlationID); err != nil {
+		return jobID
+	}
+	return correlationID
+}
+
+// ValidateJobTags checks that the user-supplied tags of a job can be added as
+// labels to the Pods of the job.
+func ValidateJobTags(tags map[string]string) error {
+	for key, value := range tags {
+		if key == "version" {
+			return fmt.Errorf("tag key %s is reserved", key)
+		}
+		for _, prefix := range reservedTagPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				return fmt.Errorf("tag key %s is reserved, it should not start with %s", key, prefix)
+			}
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("tag key %s is not a valid label key: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("tag value %s of key %s is not a valid label value: %s", value, key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// GetJobLabels returns the labels of the CR and of the SparkApplication of a
+// job: its type and its user-supplied tags, which cannot conflict as the tags
+// are validated by ValidateJobTags.
+func GetJobLabels(jobType string, tags map[string]string) map[string]string {
+	labels := map[string]string{JobTypeLabel: jobType}
+	for key, value := range tags {
+		labels[key] = value
+	}
+	return labels
+}
+
+// ValidateRecommendationCanary checks the canary rollout settings of a policy
+// recommendation job. Only the Antrea-native policies can be applied in log
+// mode, so the job should recommend them.
+func ValidateRecommendationCanary(policyType, namespace string, soakWindow time.Duration, maxDeniedFlows int) error {
+	if policyType != "anp-deny-applied" && policyType != "anp-deny-all" {
+		return fmt.Errorf("canary rollout requires policy type anp-deny-applied or anp-deny-all")
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("canary Namespace %q is not valid: %s", namespace, strings.Join(errs, "; "))
+	}
+	if soakWindow <= 0 {
+		return fmt.Errorf("canary soak window should be a positive duration")
+	}
+	if maxDeniedFlows < 0 {
+		return fmt.Errorf("canary max denied flows should be an integer >= 0")
+	}
+	return nil
+}
+
+// ValidateRecommendationWorkload checks the workload a policy recommendation
+// job is restricted to. The policies denying the traffic of the whole cluster
+// would not only apply to the workload, so the job should not recommend them.
+func ValidateRecommendationWorkload(policyType, namespace string, podLabels map[string]string) error {
+	if policyType == "anp-deny-all" {
+		return fmt.Errorf("workload recommendation requires policy type anp-deny-applied or k8s-np")
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("workload Namespace %q is not valid: %s", namespace, strings.Join(errs, "; "))
+	}
+	if len(podLabels) == 0 {
+		return fmt.Errorf("workload Pod labels should not be empty")
+	}
+	for key, value := range podLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("workload Pod label key %s is not valid: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("workload Pod label value %s of key %s is not valid: %s", value, key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// NormalizeIPOrCIDR checks that the given value is an IPv4 or IPv6 address or
+// CIDR, and returns it in the canonical form used in the flow records, e.g.
+// "fd00:10::1" for "FD00:10:0::1", so that it can be compared to the IPs of
+// the flow records as strings. The address of a CIDR is masked, e.g.
+// "10.0.0.0/24" is returned for "10.0.0.5/24".
+func NormalizeIPOrCIDR(value string) (string, error) {
+	if strings.Contains(value, "/") {
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", fmt.Errorf("%s is not a valid IPv4 or IPv6 CIDR", value)
+		}
+		return ipNet.String(), nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", fmt.Errorf("%s is not a valid IPv4 or IPv6 address", value)
+	}
+	return ip.String(), nil
+}
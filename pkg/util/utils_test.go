@@ -16,6 +16,7 @@ package util
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -23,6 +24,7 @@ import (
 var (
 	npName  = "pr-1234abcd-1234-abcd-12ab-12345678abcd"
 	tadName = "tad-1234abcd-1234-abcd-12ab-12345678abcd"
+	jobName = "job-1234abcd-1234-abcd-12ab-12345678abcd"
 )
 
 func TestParseRecommendationName(t *testing.T) {
@@ -85,6 +87,38 @@ func TestParseADAlgorithmID(t *testing.T) {
 	}
 }
 
+func TestParseAnalyticsJobName(t *testing.T) {
+	testCases := []struct {
+		name             string
+		jobName          string
+		expectedErrorMsg string
+	}{
+		{
+			name:             "Valid case",
+			jobName:          jobName,
+			expectedErrorMsg: "",
+		},
+		{
+			name:             "Invalid name",
+			jobName:          "mock_name",
+			expectedErrorMsg: "not a valid analytics job name",
+		},
+		{
+			name:             "Invalid uuid",
+			jobName:          "job-name",
+			expectedErrorMsg: "does not contain a valid UUID",
+		},
+	}
+	for _, tt := range testCases {
+		err := ParseAnalyticsJobName(tt.jobName)
+		if tt.expectedErrorMsg == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorContains(t, err, tt.expectedErrorMsg)
+		}
+	}
+}
+
 func TestParseADAlgorithmName(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -109,3 +143,241 @@ func TestParseADAlgorithmName(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateJobTags(t *testing.T) {
+	testCases := []struct {
+		name             string
+		tags             map[string]string
+		expectedErrorMsg string
+	}{
+		{
+			name: "Valid case",
+			tags: map[string]string{"team": "netsec", "example.com/cost-center": "cc-1234"},
+		},
+		{
+			name:             "Reserved key",
+			tags:             map[string]string{"theia.antrea.io/job-id": "1234"},
+			expectedErrorMsg: "tag key theia.antrea.io/job-id is reserved",
+		},
+		{
+			name:             "Spark version key",
+			tags:             map[string]string{"version": "1.0"},
+			expectedErrorMsg: "tag key version is reserved",
+		},
+		{
+			name:             "Invalid key",
+			tags:             map[string]string{"team name": "netsec"},
+			expectedErrorMsg: "tag key team name is not a valid label key",
+		},
+		{
+			name:             "Invalid value",
+			tags:             map[string]string{"team": "net sec"},
+			expectedErrorMsg: "tag value net sec of key team is not a valid label value",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJobTags(tt.tags)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestGetJobLabels(t *testing.T) {
+	assert.Equal(t, map[string]string{JobTypeLabel: JobTypePolicyRecommendation}, GetJobLabels(JobTypePolicyRecommendation, nil))
+	assert.Equal(t, map[string]string{
+		JobTypeLabel: JobTypePolicyRecommendation,
+		"team":       "netsec",
+	}, GetJobLabels(JobTypePolicyRecommendation, map[string]string{"team": "netsec"}))
+}
+
+func TestCorrelationID(t *testing.T) {
+	correlationID := "5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c"
+	jobID := "1234abcd-1234-abcd-12ab-12345678abcd"
+
+	id, err := GetRequestCorrelationID(map[string]string{CorrelationIDAnnotation: correlationID})
+	assert.NoError(t, err)
+	assert.Equal(t, correlationID, id)
+	id, err = GetRequestCorrelationID(nil)
+	assert.NoError(t, err)
+	assert.Len(t, id, 36)
+	_, err = GetRequestCorrelationID(map[string]string{CorrelationIDAnnotation: "x' OR '1'='1"})
+	assert.ErrorContains(t, err, "is not a valid UUID")
+
+	assert.Equal(t, correlationID, GetCorrelationID(map[string]string{CorrelationIDAnnotation: correlationID}, jobID))
+	assert.Equal(t, jobID, GetCorrelationID(nil, jobID))
+	assert.Equal(t, jobID, GetCorrelationID(map[string]string{CorrelationIDAnnotation: "x' OR '1'='1"}, jobID))
+}
+
+func TestValidateRecommendationCanary(t *testing.T) {
+	testCases := []struct {
+		name             string
+		policyType       string
+		namespace        string
+		soakWindow       time.Duration
+		maxDeniedFlows   int
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			policyType: "anp-deny-applied",
+			namespace:  "default",
+			soakWindow: time.Hour,
+		},
+		{
+			name:             "K8s NetworkPolicies",
+			policyType:       "k8s-np",
+			namespace:        "default",
+			soakWindow:       time.Hour,
+			expectedErrorMsg: "canary rollout requires policy type anp-deny-applied or anp-deny-all",
+		},
+		{
+			name:             "Missing Namespace",
+			policyType:       "anp-deny-all",
+			soakWindow:       time.Hour,
+			expectedErrorMsg: "canary Namespace \"\" is not valid",
+		},
+		{
+			name:             "Zero soak window",
+			policyType:       "anp-deny-all",
+			namespace:        "default",
+			expectedErrorMsg: "canary soak window should be a positive duration",
+		},
+		{
+			name:             "Negative max denied flows",
+			policyType:       "anp-deny-all",
+			namespace:        "default",
+			soakWindow:       time.Hour,
+			maxDeniedFlows:   -1,
+			expectedErrorMsg: "canary max denied flows should be an integer >= 0",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRecommendationCanary(tt.policyType, tt.namespace, tt.soakWindow, tt.maxDeniedFlows)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestValidateRecommendationWorkload(t *testing.T) {
+	testCases := []struct {
+		name             string
+		policyType       string
+		namespace        string
+		podLabels        map[string]string
+		expectedErrorMsg string
+	}{
+		{
+			name:       "Valid case",
+			policyType: "anp-deny-applied",
+			namespace:  "default",
+			podLabels:  map[string]string{"app": "foo"},
+		},
+		{
+			name:             "Deny all",
+			policyType:       "anp-deny-all",
+			namespace:        "default",
+			podLabels:        map[string]string{"app": "foo"},
+			expectedErrorMsg: "workload recommendation requires policy type anp-deny-applied or k8s-np",
+		},
+		{
+			name:             "Missing Namespace",
+			policyType:       "k8s-np",
+			podLabels:        map[string]string{"app": "foo"},
+			expectedErrorMsg: "workload Namespace \"\" is not valid",
+		},
+		{
+			name:             "Missing Pod labels",
+			policyType:       "k8s-np",
+			namespace:        "default",
+			expectedErrorMsg: "workload Pod labels should not be empty",
+		},
+		{
+			name:             "Invalid Pod label value",
+			policyType:       "k8s-np",
+			namespace:        "default",
+			podLabels:        map[string]string{"app": "foo'"},
+			expectedErrorMsg: "workload Pod label value foo' of key app is not valid",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRecommendationWorkload(tt.policyType, tt.namespace, tt.podLabels)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestNormalizeIPOrCIDR(t *testing.T) {
+	testCases := []struct {
+		name             string
+		value            string
+		expectedValue    string
+		expectedErrorMsg string
+	}{
+		{
+			name:          "IPv4 address",
+			value:         "10.0.0.1",
+			expectedValue: "10.0.0.1",
+		},
+		{
+			name:          "IPv6 address",
+			value:         "FD00:10:0::1",
+			expectedValue: "fd00:10::1",
+		},
+		{
+			name:          "IPv4-mapped IPv6 address",
+			value:         "::ffff:10.0.0.1",
+			expectedValue: "10.0.0.1",
+		},
+		{
+			name:          "IPv4 CIDR",
+			value:         "10.0.0.5/24",
+			expectedValue: "10.0.0.0/24",
+		},
+		{
+			name:          "IPv6 CIDR",
+			value:         "fd00:10:0:0::5/64",
+			expectedValue: "fd00:10::/64",
+		},
+		{
+			name:             "Invalid address",
+			value:            "10.0.0.256",
+			expectedErrorMsg: "10.0.0.256 is not a valid IPv4 or IPv6 address",
+		},
+		{
+			name:             "Invalid CIDR",
+			value:            "fd00::/129",
+			expectedErrorMsg: "fd00::/129 is not a valid IPv4 or IPv6 CIDR",
+		},
+		{
+			name:             "SQL in address",
+			value:            "10.0.0.1' OR '1'='1",
+			expectedErrorMsg: "is not a valid IPv4 or IPv6 address",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := NormalizeIPOrCIDR(tt.value)
+			if tt.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedValue, value)
+			} else {
+				assert.ErrorContains(t, err, tt.expectedErrorMsg)
+			}
+		})
+	}
+}
@@ -45,6 +45,10 @@ formatter = logging.Formatter(
 ch.setFormatter(formatter)
 logger.addHandler(ch)
 
+# The correlation ID of the job, set by the Theia Manager to trace the job
+# across the logs of the Theia components and the query log of ClickHouse.
+correlation_id = ""
+
 table_name = "default.flows"
 
 # Column names of flow record table in Clickhouse database used in anomaly
@@ -588,7 +592,13 @@ def generate_tad_sql_query(start_time, end_time, ns_ignore_list,
             if agg_flow == "external":
                 # TODO agg=destination IP, change the name to external
                 sql_query_extension.append("flowType = 3")
-                if external_ip:
+                if external_ip and "/" in external_ip:
+                    # IPv4 and IPv6 CIDRs are matched with the ClickHouse
+                    # function, as the IPs are stored as strings.
+                    sql_query_extension.append(
+                        "isIPAddressInRange(destinationIP, '{}')".format(
+                            external_ip))
+                elif external_ip:
                     sql_query_extension.append("destinationIP = '{}'".format(
                         external_ip))
             elif agg_flow == "svc":
@@ -644,6 +654,49 @@ def remove_meaningless_labels(podLabels):
     return json.dumps(labels_dict, sort_keys=True)
 
 
+def get_jdbc_tls_options():
+    # The options of the ClickHouse JDBC driver to connect over TLS with the
+    # client certificate mounted by the Theia Manager, empty if TLS is
+    # disabled.
+    cert_file = os.getenv("CH_TLS_CERT_FILE")
+    if not cert_file:
+        return {}
+    options = {
+        "ssl": "true",
+        "sslcert": cert_file,
+        "sslkey": os.getenv("CH_TLS_KEY_FILE"),
+    }
+    if os.getenv("CH_TLS_INSECURE_SKIP_VERIFY", "").lower() == "true":
+        options["sslmode"] = "none"
+        return options
+    options["sslmode"] = "strict"
+    ca_file = os.getenv("CH_TLS_CA_FILE")
+    if ca_file and os.path.exists(ca_file):
+        options["sslrootcert"] = ca_file
+    return options
+
+
+def set_correlation_id(value):
+    # The correlation ID is added to the logs of the job, and is the
+    # log_comment of its ClickHouse queries.
+    global correlation_id
+    correlation_id = value
+    ch.setFormatter(logging.Formatter(
+        '%(asctime)s - %(name)s - %(levelname)s - correlation_id={} - '
+        '%(message)s'.format(value)))
+
+
+def get_jdbc_options():
+    # The options of the ClickHouse JDBC driver: the TLS options, and the
+    # correlation ID of the job as the log_comment setting of its queries,
+    # which the driver sends as a parameter of its HTTP requests.
+    options = get_jdbc_tls_options()
+    if correlation_id:
+        options["custom_http_params"] = "log_comment={}".format(
+            correlation_id)
+    return options
+
+
 def anomaly_detection(algo_type, db_jdbc_address, start_time, end_time,
                       tad_id_input, ns_ignore_list, agg_flow=None,
                       pod_label=None, external_ip=None, svc_port_name=None,
@@ -655,7 +708,8 @@ def anomaly_detection(algo_type, db_jdbc_address, start_time, end_time,
     initDF = (
         spark.read.format("jdbc").option(
             'driver', "ru.yandex.clickhouse.ClickHouseDriver").option(
-            "url", db_jdbc_address).option(
+            "url", db_jdbc_address).options(
+            **get_jdbc_options()).option(
             "user", os.getenv("CH_USERNAME")).option(
             "password", os.getenv("CH_PASSWORD")).option(
             "query", sql_query).load()
@@ -719,7 +773,8 @@ def write_anomaly_detection_result(
 
     result_df.write.mode("append").format("jdbc").option(
         "driver", "ru.yandex.clickhouse.ClickHouseDriver").option(
-        "url", db_jdbc_address).option(
+        "url", db_jdbc_address).options(
+        **get_jdbc_options()).option(
         "user", os.getenv("CH_USERNAME")).option(
         "password", os.getenv("CH_PASSWORD")).option(
         "dbtable", result_table_name).save()
@@ -727,9 +782,10 @@ def write_anomaly_detection_result(
 
 
 def main():
+    global table_name
     db_jdbc_address = (
         "jdbc:clickhouse://clickhouse-clickhouse.flow-visibility.svc:8123")
-    result_table_name = "default.tadetector"
+    database = "default"
     algo_type = ""
     start_time = ""
     end_time = ""
@@ -751,6 +807,8 @@ def main():
             the ClickHouse database for reading flow records and writing
             result. jdbc:clickhouse://clickhouse-clickhouse.flow-visibility
             .svc:8123 is the ClickHouse JDBC URL used by default.
+        -D, --database=default: The ClickHouse database storing the flow
+            records and the anomaly detection results.
         -s, --start_time=None: The start time of the flow records
             considered for the Throughput Anomaly Detection. Format is
             YYYY-MM-DD hh:mm:ss in UTC timezone. Default value is None,
@@ -772,16 +830,19 @@ def main():
         -P, --pod-namespace=None: Aggregated Flow Throughput Anomaly Detection
             to/from Pod using pod namespace
         -x, --external-ip=None: Aggregated Flow Throughput Anomaly Detection
-            to Destination IP
+            to Destination IP, given as an IPv4 or IPv6 address or CIDR
         -p, --svc-port-name=None: Aggregated Flow Throughput Anomaly Detection
             to Destination Service Port
+        --correlation_id=None: The correlation ID of the job in UUID format,
+            added to the logs of the job and set as the log_comment of its
+            ClickHouse queries.
         """
 
     # TODO: change to use argparse instead of getopt for options
     try:
         opts, _ = getopt.getopt(
             sys.argv[1:],
-            "ht:d:s:e:i:n:f:l:d:x:p:N:P",
+            "ht:d:s:e:i:n:f:l:d:x:p:N:P:D:",
             [
                 "help",
                 "algo=",
@@ -796,6 +857,8 @@ def main():
                 "svc-port-name=",
                 "pod-name=",
                 "pod-namespace=",
+                "database=",
+                "correlation_id=",
             ],
         )
     except getopt.GetoptError as e:
@@ -819,7 +882,7 @@ def main():
                 sys.exit(2)
             algo_type = arg
         elif opt in ("-d", "--db_jdbc_url"):
-            parse_url = urlparse("arg")
+            parse_url = urlparse(arg)
             if parse_url.scheme != "jdbc":
                 logger.error(
                     "Please provide a valid JDBC url for ClickHouse database"
@@ -868,6 +931,23 @@ def main():
             external_ip = arg
         elif opt in ("-", "--svc-port-name"):
             svc_port_name = arg
+        elif opt in ("-D", "--database"):
+            if not arg:
+                logger.error("database should not be empty.")
+                logger.info(help_message)
+                sys.exit(2)
+            database = arg
+        elif opt == "--correlation_id":
+            try:
+                uuid.UUID(arg)
+            except ValueError:
+                logger.error("correlation_id should be a UUID.")
+                logger.info(help_message)
+                sys.exit(2)
+            set_correlation_id(arg)
+
+    table_name = "{}.flows".format(database)
+    result_table_name = "{}.tadetector".format(database)
 
     func_start_time = time.time()
     logger.info("Script started at {}".format(
@@ -107,6 +107,29 @@ outbound_condition_podnamespace = (
                         ad.DF_AGG_GRP_COLUMNS_EXTERNAL + ['flowEndSeconds']),
                 )
         ),
+        (
+                ("", "", [], "external", "", "fd00:10::1", "", "", ""),
+                "SELECT {} FROM {} WHERE "
+                "flowType = 3 AND destinationIP = 'fd00:10::1' "
+                "GROUP BY {} ".format(
+                    ", ".join(ad.AGG_FLOW_TABLE_COLUMNS_EXTERNAL),
+                    table_name,
+                    ", ".join(
+                        ad.DF_AGG_GRP_COLUMNS_EXTERNAL + ['flowEndSeconds']),
+                )
+        ),
+        (
+                ("", "", [], "external", "", "fd00:10::/64", "", "", ""),
+                "SELECT {} FROM {} WHERE "
+                "flowType = 3 AND "
+                "isIPAddressInRange(destinationIP, 'fd00:10::/64') "
+                "GROUP BY {} ".format(
+                    ", ".join(ad.AGG_FLOW_TABLE_COLUMNS_EXTERNAL),
+                    table_name,
+                    ", ".join(
+                        ad.DF_AGG_GRP_COLUMNS_EXTERNAL + ['flowEndSeconds']),
+                )
+        ),
         (
                 ("", "", [], "pod", "\"app\":\"clickhouse\"", "", "", "",
                 ""),
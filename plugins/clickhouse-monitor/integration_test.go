@@ -0,0 +1,318 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+
+// The integration tests run the monitor against a real ClickHouse server, to
+// catch the SQL dialect issues which the tests with sqlmock cannot. They are
+// run with "make test-integration", or:
+//
+//	go test -tags integration -run Integration antrea.io/theia/plugins/clickhouse-monitor/...
+//
+// A ClickHouse container is started with docker from CLICKHOUSE_TEST_IMAGE,
+// unless CLICKHOUSE_TEST_URL gives the address of a ClickHouse server, e.g.
+// tcp://127.0.0.1:9000, with the credentials CLICKHOUSE_TEST_USERNAME and
+// CLICKHOUSE_TEST_PASSWORD. The tests create and drop their own database.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// The ClickHouse server image which the Theia ClickHouse server image
+	// is built from.
+	defaultTestImage = "clickhouse/clickhouse-server:23.4"
+	testUsername     = "theia"
+	testPassword     = "theia"
+	testDatabase     = "theia_monitor_test"
+	// The timezone of the ClickHouse container, which is not UTC so that
+	// the tests catch the time boundaries which depend on the timezone of
+	// the server.
+	testTimezone = "Asia/Shanghai"
+	// The number of flow records inserted by the tests, one per second.
+	testRecords = 100
+	// Timeout of the startup of the ClickHouse server and of the
+	// completion of the mutations.
+	testTimeout = 2 * time.Minute
+)
+
+var (
+	startOnce   sync.Once
+	containerID string
+	testURL     string
+	startErr    error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if containerID != "" {
+		exec.Command("docker", "rm", "-f", containerID).Run()
+	}
+	os.Exit(code)
+}
+
+// startClickHouseContainer starts a ClickHouse container listening on a random
+// port of the loopback interface, and returns its URL.
+func startClickHouseContainer() (string, error) {
+	image := os.Getenv("CLICKHOUSE_TEST_IMAGE")
+	if image == "" {
+		image = defaultTestImage
+	}
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "CLICKHOUSE_USER="+testUsername,
+		"-e", "CLICKHOUSE_PASSWORD="+testPassword,
+		"-e", "TZ="+testTimezone,
+		"-p", "127.0.0.1::9000",
+		image).Output()
+	if err != nil {
+		return "", fmt.Errorf("error when starting the ClickHouse container from image %s: %v", image, err)
+	}
+	containerID = strings.TrimSpace(string(out))
+	out, err = exec.Command("docker", "port", containerID, "9000/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("error when getting the port of the ClickHouse container: %v", err)
+	}
+	address := strings.TrimSpace(strings.Split(string(out), "\n")[0])
+	return "tcp://" + address, nil
+}
+
+// setupClickHouse connects to the ClickHouse server, starting its container on
+// the first call, and creates the test database with the flow records table,
+// the materialized views and the deletion audit table. The monitor connects to
+// the test database through connectLoop.
+func setupClickHouse(t *testing.T) *sql.DB {
+	url := os.Getenv("CLICKHOUSE_TEST_URL")
+	username, password := os.Getenv("CLICKHOUSE_TEST_USERNAME"), os.Getenv("CLICKHOUSE_TEST_PASSWORD")
+	if url == "" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			t.Skip("docker is not available and CLICKHOUSE_TEST_URL is not set")
+		}
+		startOnce.Do(func() {
+			testURL, startErr = startClickHouseContainer()
+		})
+		require.NoError(t, startErr)
+		url, username, password = testURL, testUsername, testPassword
+	}
+
+	admin, err := sql.Open("clickhouse", fmt.Sprintf("%s?username=%s&password=%s", url, username, password))
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+	err = wait.PollImmediate(time.Second, testTimeout, func() (bool, error) {
+		return admin.Ping() == nil, nil
+	})
+	require.NoError(t, err, "ClickHouse server is not ready")
+	execQueries(t, admin,
+		"DROP DATABASE IF EXISTS "+testDatabase,
+		"CREATE DATABASE "+testDatabase,
+	)
+	t.Cleanup(func() { admin.Exec("DROP DATABASE IF EXISTS " + testDatabase) })
+
+	oldGetEnv := getEnv
+	getEnv = func(key string) string {
+		switch key {
+		case "CLICKHOUSE_USERNAME":
+			return username
+		case "CLICKHOUSE_PASSWORD":
+			return password
+		case "DB_URL":
+			return url
+		case "CLICKHOUSE_DATABASE":
+			return testDatabase
+		default:
+			return ""
+		}
+	}
+	t.Cleanup(func() { getEnv = oldGetEnv })
+	connect, err := connectLoop()
+	require.NoError(t, err)
+	t.Cleanup(func() { connect.Close() })
+
+	initEnv()
+	clusterName, shard, coldDisk = "", "", ""
+	remainingRoundsNum, aboveThreshold = 0, false
+	execQueries(t, connect,
+		"CREATE TABLE flows (timeInserted DateTime DEFAULT now(), sourcePodName String, octetDeltaCount UInt64) ENGINE = MergeTree ORDER BY (timeInserted)",
+		"CREATE TABLE deletion_audit (timeDeleted DateTime DEFAULT now(), tableName String, rangeStart DateTime, rangeEnd DateTime, rowCount UInt64, bytesReclaimed UInt64, reason String) ENGINE = MergeTree ORDER BY (timeDeleted)",
+	)
+	for _, view := range mvNames {
+		execQueries(t, connect, fmt.Sprintf("CREATE TABLE %s (timeInserted DateTime, sourcePodName String, octetDeltaCount UInt64) ENGINE = SummingMergeTree ORDER BY (timeInserted, sourcePodName)", view))
+	}
+	return connect
+}
+
+func execQueries(t *testing.T, connect *sql.DB, queries ...string) {
+	for _, query := range queries {
+		_, err := connect.Exec(query)
+		require.NoError(t, err, "query: %s", query)
+	}
+}
+
+// insertRecords inserts testRecords flow records, inserted one per second from
+// start, in the flow records table and in the materialized views.
+func insertRecords(t *testing.T, connect *sql.DB, start time.Time) {
+	_, err := connect.Exec("INSERT INTO flows (timeInserted, sourcePodName, octetDeltaCount) SELECT toDateTime(? + number), concat('pod-', toString(number % 10)), number FROM numbers(?)", start.Unix(), testRecords)
+	require.NoError(t, err)
+	for _, view := range mvNames {
+		_, err := connect.Exec(fmt.Sprintf("INSERT INTO %s SELECT timeInserted, sourcePodName, octetDeltaCount FROM flows", view))
+		require.NoError(t, err)
+	}
+}
+
+func countRecords(t *testing.T, connect *sql.DB, table string) uint64 {
+	var count uint64
+	require.NoError(t, connect.QueryRow(fmt.Sprintf("SELECT COUNT() FROM %s", table)).Scan(&count))
+	return count
+}
+
+// waitForMutations waits for the mutations of the test database to be done.
+func waitForMutations(t *testing.T, connect *sql.DB) {
+	err := wait.PollImmediate(time.Second, testTimeout, func() (bool, error) {
+		var pending uint64
+		if err := connect.QueryRow("SELECT COUNT() FROM system.mutations WHERE database = ? AND is_done = 0", testDatabase).Scan(&pending); err != nil {
+			return false, err
+		}
+		return pending == 0, nil
+	})
+	require.NoError(t, err, "mutations are not done")
+}
+
+func TestIntegrationStorageUsage(t *testing.T) {
+	connect := setupClickHouse(t)
+	insertRecords(t, connect, time.Now().Add(-time.Hour))
+
+	var usedSpace, freeSpace, totalSpace uint64
+	require.NoError(t, connect.QueryRow(clickHouseUsageQuery, hotDisk).Scan(&usedSpace))
+	require.NoError(t, connect.QueryRow(diskUsageQuery, hotDisk).Scan(&freeSpace, &totalSpace))
+	require.NotZero(t, usedSpace)
+
+	// The system tables of the server keep growing, so the usage is only
+	// compared approximately.
+	usage, err := getStorageUsage(connect, hotDisk, 4*usedSpace)
+	require.NoError(t, err)
+	assert.Equal(t, 4*usedSpace, usage.totalSpace)
+	assert.InDelta(t, 0.25, usage.percentage, 0.05)
+	assert.InDelta(t, float64(usage.usedSpace)/float64(usage.totalSpace), usage.percentage, 1e-9)
+
+	// Without allocated space, the usage is relative to the space of the
+	// disk available to ClickHouse.
+	usage, err = getStorageUsage(connect, hotDisk, 0)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(freeSpace+usedSpace), float64(usage.totalSpace), float64(freeSpace+usedSpace)*0.01)
+	assert.InDelta(t, float64(usage.usedSpace)/float64(usage.totalSpace), usage.percentage, 1e-9)
+}
+
+func TestIntegrationMonitorMemoryWithDeletion(t *testing.T) {
+	connect := setupClickHouse(t)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	insertRecords(t, connect, start)
+	var usedSpace uint64
+	require.NoError(t, connect.QueryRow(clickHouseUsageQuery, hotDisk).Scan(&usedSpace))
+	// The usage is about 100 %, above the threshold of 50 %.
+	allocatedSpace = usedSpace
+
+	monitorMemory(connect)
+	assert.Equal(t, skipRoundsNum, remainingRoundsNum)
+	waitForMutations(t, connect)
+	pendingDeletions, err := getPendingDeletions(connect)
+	require.NoError(t, err)
+	assert.Zero(t, pendingDeletions)
+
+	// Half of the records are selected for deletion, and the records
+	// inserted before the last of them are deleted from all the tables.
+	deleted := uint64(float64(testRecords)*deletePercentage) - 1
+	for _, table := range append([]string{tableName}, mvNames...) {
+		assert.Equal(t, testRecords-deleted, countRecords(t, connect, table), "table %s", table)
+	}
+	var auditTable, reason string
+	var rangeStart, rangeEnd time.Time
+	var rowCount, bytesReclaimed uint64
+	require.NoError(t, connect.QueryRow("SELECT tableName, rangeStart, rangeEnd, rowCount, bytesReclaimed, reason FROM deletion_audit").
+		Scan(&auditTable, &rangeStart, &rangeEnd, &rowCount, &bytesReclaimed, &reason))
+	assert.Equal(t, tableName, auditTable)
+	assert.True(t, start.Equal(rangeStart), "rangeStart %s should be %s", rangeStart, start)
+	boundary := start.Add(time.Duration(deleted) * time.Second)
+	assert.True(t, boundary.Equal(rangeEnd), "rangeEnd %s should be %s", rangeEnd, boundary)
+	assert.Equal(t, deleted, rowCount)
+	assert.InDelta(t, float64(usedSpace)*deletePercentage, float64(bytesReclaimed), float64(usedSpace)*0.05)
+	assert.True(t, strings.HasPrefix(reason, "storage usage "), reason)
+	assert.True(t, strings.HasSuffix(reason, " above threshold 50.00 %"), reason)
+}
+
+func TestIntegrationMonitorMemoryWithoutDeletion(t *testing.T) {
+	connect := setupClickHouse(t)
+	insertRecords(t, connect, time.Now().Add(-time.Hour))
+	var usedSpace uint64
+	require.NoError(t, connect.QueryRow(clickHouseUsageQuery, hotDisk).Scan(&usedSpace))
+	// The usage is about 1 %, below the threshold of 50 %.
+	allocatedSpace = 100 * usedSpace
+
+	monitorMemory(connect)
+	assert.Zero(t, remainingRoundsNum)
+	for _, table := range append([]string{tableName}, mvNames...) {
+		assert.Equal(t, uint64(testRecords), countRecords(t, connect, table), "table %s", table)
+	}
+	assert.Zero(t, countRecords(t, connect, deletionAuditTable))
+}
+
+func TestIntegrationMigrationInProgress(t *testing.T) {
+	connect := setupClickHouse(t)
+	insertRecords(t, connect, time.Now().Add(-time.Hour))
+
+	// No migration is in progress when the status table does not exist.
+	inProgress, err := isMigrationInProgress(connect)
+	require.NoError(t, err)
+	assert.False(t, inProgress)
+
+	execQueries(t, connect,
+		"CREATE TABLE migration_status (timeUpdated DateTime DEFAULT now(), inProgress UInt8, fromVersion Int32, toVersion Int32) ENGINE = MergeTree ORDER BY (timeUpdated)",
+		"INSERT INTO migration_status (timeUpdated, inProgress, fromVersion, toVersion) VALUES (now() - 10, 1, 5, 6)",
+	)
+	inProgress, err = isMigrationInProgress(connect)
+	require.NoError(t, err)
+	assert.True(t, inProgress)
+
+	// Records are not deleted while the migration is in progress.
+	var usedSpace uint64
+	require.NoError(t, connect.QueryRow(clickHouseUsageQuery, hotDisk).Scan(&usedSpace))
+	allocatedSpace = usedSpace
+	monitorMemory(connect)
+	assert.Zero(t, remainingRoundsNum)
+	assert.Equal(t, uint64(testRecords), countRecords(t, connect, tableName))
+
+	// A status which is not refreshed anymore is left by an aborted
+	// migration.
+	execQueries(t, connect, "TRUNCATE TABLE migration_status",
+		fmt.Sprintf("INSERT INTO migration_status (timeUpdated, inProgress, fromVersion, toVersion) VALUES (now() - %d, 1, 5, 6)", int(2*migrationStatusTimeout.Seconds())))
+	inProgress, err = isMigrationInProgress(connect)
+	require.NoError(t, err)
+	assert.False(t, inProgress)
+
+	execQueries(t, connect, "INSERT INTO migration_status (inProgress, fromVersion, toVersion) VALUES (0, 5, 6)")
+	inProgress, err = isMigrationInProgress(connect)
+	require.NoError(t, err)
+	assert.False(t, inProgress)
+}
@@ -15,21 +15,38 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"antrea.io/antrea/pkg/signals"
 
 	"github.com/ClickHouse/clickhouse-go"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
+
+	clickhouseutil "antrea.io/theia/pkg/util/clickhouse"
+	"antrea.io/theia/pkg/util/format"
+	"antrea.io/theia/pkg/util/tracing"
 )
 
 const (
@@ -41,25 +58,139 @@ const (
 	queryTimeout = 10 * time.Second
 	// Retry query to ClickHouse every second if it fails.
 	queryRetryInterval = 1 * time.Second
-	// Time format for timeInserted
-	timeFormat = "2006-01-02 15:04:05"
+	// Timeout for reading the headers of the requests to the pprof and
+	// metrics endpoints.
+	readHeaderTimeout = 10 * time.Second
+	// The monitor exits after this number of consecutive rounds panicked, so
+	// that the container is restarted.
+	maxConsecutivePanics = 5
+	// Maximum time to wait before the next round after a round panicked.
+	maxPanicBackoff = 5 * time.Minute
+	// Leader election parameters of the monitors running in the replicas of
+	// a ClickHouse shard.
+	leaseNamePrefix    = "clickhouse-monitor-"
+	leaseDuration      = 15 * time.Second
+	leaseRenewDeadline = 10 * time.Second
+	leaseRetryPeriod   = 2 * time.Second
+	// Count the deletions issued by a monitor which are not completed yet.
+	pendingDeletionsQuery = "SELECT COUNT() FROM system.mutations WHERE is_done = 0 AND command LIKE 'DELETE WHERE timeInserted%'"
+	// The disk storing the recent parts. When the tiered storage policy is
+	// used, the old parts are moved to the cold disk given by COLD_DISK.
+	hotDisk = "default"
+	// Get the disk and ClickHouse usage of a disk of the replica.
+	diskUsageQuery       = "SELECT free_space, total_space FROM system.disks WHERE name = ?"
+	clickHouseUsageQuery = "SELECT SUM(bytes) FROM system.parts WHERE disk_name = ?"
+	// Get the disk and ClickHouse usage of a disk of all the replicas of a
+	// shard.
+	shardDiskUsageQuery  = "SELECT getMacro('replica') AS replica, free_space, total_space FROM clusterAllReplicas(?, system.disks) WHERE getMacro('shard') = ? AND name = ?"
+	shardClickHouseQuery = "SELECT getMacro('replica') AS replica, SUM(bytes) FROM clusterAllReplicas(?, system.parts) WHERE getMacro('shard') = ? AND disk_name = ? GROUP BY replica"
+	// Get the active parts of a local table on a disk, oldest first. The
+	// tables are not partitioned, so the parts are moved one by one.
+	diskPartsQuery = "SELECT name, bytes_on_disk FROM system.parts WHERE database = if(? = '', currentDatabase(), ?) AND table = ? AND active AND disk_name = ? ORDER BY min_block_number"
+	// Get the partitions of a local table partitioned by timeInserted which
+	// hold records inserted before a boundary, oldest first, and whether all
+	// their records were inserted before the boundary. The partitions are
+	// found from the metadata of the parts, without scanning the records.
+	expiredPartitionsQuery = "SELECT partition_id, max(max_time) < ? FROM system.parts WHERE database = if(? = '', currentDatabase(), ?) AND table = ? AND active AND (database, table) IN (SELECT database, name FROM system.tables WHERE partition_key LIKE '%timeInserted%') GROUP BY partition_id HAVING min(min_time) < ? ORDER BY min(min_time)"
+	// Get the engine of a Distributed table, which refers to its local table.
+	distributedTableQuery = "SELECT engine_full FROM system.tables WHERE database = if(? = '', currentDatabase(), ?) AND name = ? AND engine = 'Distributed'"
+	// The table auditing the deletions of records, in the database of
+	// TABLE_NAME.
+	deletionAuditTable = "deletion_audit"
+	// The table recording the status of the data schema migrations, in the
+	// database of TABLE_NAME.
+	migrationStatusTable = "migration_status"
+	// Check whether the latest migration status is in progress and was
+	// refreshed recently. The schema management tool refreshes it every 30
+	// seconds while migrating, so a status which is not refreshed for longer
+	// is left by an aborted migration and ignored.
+	migrationInProgressQuery = "SELECT argMax(inProgress, timeUpdated) = 1 AND max(timeUpdated) > now() - toIntervalSecond(?) FROM %s"
+	// The status of a migration is ignored after this time without refresh.
+	migrationStatusTimeout = 5 * time.Minute
+	// ClickHouse error code of a table which does not exist.
+	unknownTableErrorCode = 60
 )
 
 var (
 	getEnv   = os.Getenv
-	openSql  = sql.Open
-	runUntil = wait.Until
+	openDB   = sql.OpenDB
+	exit     = os.Exit
+	runUntil = func(f func(), period time.Duration, stopCh <-chan struct{}) {
+		wait.JitterUntil(f, period, jitterFactor, true, stopCh)
+	}
+	// Time to wait before the next round after a round panicked, doubled
+	// after every consecutive panic.
+	initialPanicBackoff = 10 * time.Second
+	newKubeClient       = func() (kubernetes.Interface, error) {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+		return kubernetes.NewForConfig(config)
+	}
 )
 
+// defaultProtectedTables are the tables which the monitor must never delete
+// records from, whatever TABLE_NAME and MV_NAMES are set to: the results of
+// the recommendation, anomaly detection and custom analytics jobs, the version
+// and the migration status of the schema, the names of the IPs and the labels
+// of the Nodes, which do not store flow records, and the rollups of the flow
+// records, whose retention is bounded by their TTL and which have no
+// timeInserted column.
+var defaultProtectedTables = []string{
+	"recommendations",
+	"recommendations_local",
+	"recommendation_coverage",
+	"recommendation_coverage_local",
+	"recommendation_data_window",
+	"recommendation_data_window_local",
+	"tadetector",
+	"tadetector_local",
+	"analytics_job_results",
+	"analytics_job_results_local",
+	"migrate_version",
+	"schema_migrations",
+	"ip_names",
+	"ip_names_local",
+	"node_labels",
+	"node_labels_local",
+	"deletion_audit",
+	"deletion_audit_local",
+	"migration_status",
+	"migration_progress",
+	"migration_backfill",
+	"flows_rollup_1m",
+	"flows_rollup_1m_local",
+	"flows_rollup_1h",
+	"flows_rollup_1h_local",
+}
+
 var (
 	// Storage size allocated for the ClickHouse in number of bytes
 	allocatedSpace uint64
+	// The cold disk of the tiered storage policy, empty if the policy is not
+	// used.
+	coldDisk string
+	// Storage size allocated for the cold disk in number of bytes. The size
+	// of the disk is used if it is 0, e.g. for an S3 disk.
+	coldAllocatedSpace uint64
+	// The maximum number of partitions dropped from each table in a round, 0
+	// for no limit.
+	maxPartitionsPerRun int
 	// identifierPartRegex is used to validate ClickHouse SQL identifiers coming from the environment.
 	identifierPartRegex = regexp.MustCompile("^[a-zA-Z_][0-9a-zA-Z_]*$")
+	// partNameRegex is used to validate the names of the parts and the IDs of
+	// the partitions read from system.parts, which are quoted into the
+	// queries: the driver only binds the parameters following an operator or
+	// some keywords, not the ones of PARTITION ID or MOVE PART.
+	partNameRegex = regexp.MustCompile("^[0-9a-zA-Z_-]+$")
 	// The name of the table to store the flow records
 	tableName string
 	// The names of the materialized views
 	mvNames []string
+	// The tables which the monitor never deletes records from, the default
+	// ones and the ones given by PROTECTED_TABLES.
+	protectedTables []string
 	// The remaining number of rounds to be skipped
 	remainingRoundsNum = 0
 	// The storage percentage at which the monitor starts to delete old records.
@@ -70,6 +201,42 @@ var (
 	skipRoundsNum int
 	// The time interval between two round of monitoring.
 	monitorExecInterval time.Duration
+	// The maximum factor by which the interval between two rounds of
+	// monitoring is randomly extended.
+	jitterFactor float64
+	// Whether the monitors running in the replicas of a shard elect a leader,
+	// which is the only one to monitor the shard and delete records.
+	leaderElection bool
+	// The name of the ClickHouse cluster. If it is set, the usage of all the
+	// replicas of the shard is monitored, instead of the local one only.
+	clusterName string
+	// The shard of the ClickHouse server, set if clusterName is set.
+	shard string
+	// The address to serve the pprof endpoints on. The endpoints are disabled
+	// if it is empty.
+	pprofAddress string
+	// The address to serve the Prometheus metrics on. The metrics are not
+	// served if it is empty.
+	metricsAddress string
+	// The number of consecutive rounds which panicked.
+	consecutivePanics = 0
+	// roundPanics counts the rounds of monitoring which panicked and were
+	// recovered.
+	roundPanics = metrics.NewCounter(&metrics.CounterOpts{
+		Namespace:      "theia",
+		Subsystem:      "clickhouse_monitor",
+		Name:           "round_panics_total",
+		Help:           "Number of rounds of monitoring which panicked and were recovered.",
+		StabilityLevel: metrics.ALPHA,
+	})
+	// distributedEngineRegex extracts the database and the local table from
+	// the engine of a Distributed table, e.g.
+	// Distributed('{cluster}', 'default', 'flows_local', rand()).
+	distributedEngineRegex = regexp.MustCompile(`^Distributed\('[^']*',\s*'?(\w+)'?,\s*'?(\w+)'?`)
+	// roundMutex ensures that rounds of monitoring, and the update of
+	// remainingRoundsNum, never run concurrently, e.g. when the leadership is
+	// lost and acquired again while a round is still running.
+	roundMutex sync.Mutex
 )
 
 var errNotAValidIdentifier = errors.New("not a valid identifier")
@@ -91,38 +258,298 @@ func sanitizeIdentifier(identifier string) (string, error) {
 	return identifier, nil
 }
 
+func init() {
+	legacyregistry.MustRegister(roundPanics)
+}
+
 func main() {
 	if err := loadEnvVariables(); err != nil {
 		klog.ErrorS(err, "Error when loading environment variables")
+		os.Exit(1)
+	}
+	if len(pprofAddress) > 0 {
+		go serve("pprof", pprofAddress, newPprofHandler())
+	}
+	if len(metricsAddress) > 0 {
+		go serve("metrics", metricsAddress, newMetricsHandler())
+	}
+	if _, err := tracing.Setup(context.Background(), "clickhouse-monitor"); err != nil {
+		klog.ErrorS(err, "Error when setting up the export of the traces")
 	}
 	connect, err := connectLoop()
 	if err != nil {
 		klog.ErrorS(err, "Error when connecting to ClickHouse")
 		os.Exit(1)
 	}
+	if err := resolveLocalTables(connect); err != nil {
+		klog.ErrorS(err, "Error when resolving the local tables")
+		os.Exit(1)
+	}
+	if len(clusterName) > 0 {
+		shard, err = getShard(connect)
+		if err != nil {
+			klog.ErrorS(err, "Error when getting the shard of the ClickHouse server")
+			os.Exit(1)
+		}
+	}
 	checkStorageCondition(connect)
 	startMonitor(connect)
 }
 
 func startMonitor(connect *sql.DB) {
-	stopCh := signals.RegisterSignalHandlers()
 	// Set up signal capture: the first SIGINT signal is expected to be received from
 	// intentional SIGINT sending to collect coverage
-	runUntil(func() {
-		// The monitor stops working for several rounds after a deletion
-		// as the release of memory space by the ClickHouse MergeTree engine requires time
-		if remainingRoundsNum > 0 {
-			klog.InfoS("Skip rounds after a successful deletion", "remaining number of rounds", remainingRoundsNum)
-			remainingRoundsNum -= 1
-		} else if remainingRoundsNum == 0 {
-			monitorMemory(connect)
-		} else {
-			klog.ErrorS(nil, "Remaining rounds number to be skipped should be larger than or equal to 0", "number", remainingRoundsNum)
+	stopCh := signals.RegisterSignalHandlers()
+	if leaderElection {
+		if err := runWithLeaderElection(connect, stopCh); err != nil {
+			klog.ErrorS(err, "Error when running the monitor with leader election")
 			os.Exit(1)
 		}
+		return
+	}
+	runMonitor(connect, stopCh)
+}
+
+func runMonitor(connect *sql.DB, stopCh <-chan struct{}) {
+	runUntil(func() {
+		backoff := monitorRound(connect)
+		if backoff == 0 {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-stopCh:
+		}
 	}, monitorExecInterval, stopCh)
 }
 
+// monitorRound runs a round of monitoring while holding roundMutex, and
+// returns the time to wait before the next round if the round panicked. The
+// caller waits after roundMutex is released, so that a monitor which acquired
+// the leadership again is not blocked by the backoff.
+func monitorRound(connect *sql.DB) time.Duration {
+	roundMutex.Lock()
+	defer roundMutex.Unlock()
+	if runRound(connect) {
+		consecutivePanics = 0
+		return 0
+	}
+	consecutivePanics += 1
+	if consecutivePanics >= maxConsecutivePanics {
+		klog.ErrorS(nil, "Exit as rounds of monitoring keep panicking", "consecutivePanics", consecutivePanics)
+		exit(1)
+		return 0
+	}
+	backoff := getPanicBackoff(consecutivePanics)
+	klog.InfoS("Back off before the next round after a panic", "consecutivePanics", consecutivePanics, "duration", format.Duration(backoff))
+	return backoff
+}
+
+// runRound runs a round of monitoring. A panic in the round, e.g. caused by a
+// malformed query response, is recovered, so that the retention of records is
+// still enforced in the next rounds. It returns false if the round panicked.
+func runRound(connect *sql.DB) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			roundPanics.Inc()
+			klog.ErrorS(nil, "Recovered from a panic in a round of monitoring", "panic", r, "stack", string(debug.Stack()))
+			ok = false
+		}
+	}()
+	_, span := tracing.StartSpan(context.Background(), "clickhouse-monitor.round")
+	defer span.End()
+	// The monitor stops working for several rounds after a deletion
+	// as the release of memory space by the ClickHouse MergeTree engine requires time
+	if remainingRoundsNum > 0 {
+		klog.InfoS("Skip rounds after a successful deletion", "remaining number of rounds", remainingRoundsNum)
+		remainingRoundsNum -= 1
+	} else if remainingRoundsNum == 0 {
+		monitorMemory(connect)
+	} else {
+		klog.ErrorS(nil, "Remaining rounds number to be skipped should be larger than or equal to 0", "number", remainingRoundsNum)
+		exit(1)
+	}
+	return true
+}
+
+// Gets the time to wait before the next round after the given number of
+// consecutive rounds panicked.
+func getPanicBackoff(panics int) time.Duration {
+	backoff := initialPanicBackoff
+	for i := 1; i < panics && backoff < maxPanicBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxPanicBackoff {
+		backoff = maxPanicBackoff
+	}
+	return backoff
+}
+
+// runWithLeaderElection runs the monitor only while it is the leader among the
+// monitors of the replicas of its ClickHouse shard, so that a single delete
+// mutation is issued for the shard, while any replica can take over the
+// monitoring if the leader fails.
+func runWithLeaderElection(connect *sql.DB, stopCh <-chan struct{}) error {
+	podName := getEnv("POD_NAME")
+	podNamespace := getEnv("POD_NAMESPACE")
+	if len(podName) == 0 || len(podNamespace) == 0 {
+		return fmt.Errorf("unable to load environment variables, POD_NAME and POD_NAMESPACE must be defined for leader election")
+	}
+	shard, err := getShard(connect)
+	if err != nil {
+		return fmt.Errorf("error when getting the shard of the ClickHouse server: %v", err)
+	}
+	client, err := newKubeClient()
+	if err != nil {
+		return fmt.Errorf("error when creating K8s client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	config := leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      leaseNamePrefix + strings.ToLower(shard),
+				Namespace: podNamespace,
+			},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: podName},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   leaseRenewDeadline,
+		RetryPeriod:     leaseRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.InfoS("Started leading the monitoring of the shard", "shard", shard)
+				runMonitor(connect, ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				klog.InfoS("Stopped leading the monitoring of the shard", "shard", shard)
+			},
+		},
+	}
+	// Run for the leadership again after it is lost, until the monitor stops.
+	wait.Until(func() {
+		leaderelection.RunOrDie(ctx, config)
+	}, leaseRetryPeriod, ctx.Done())
+	return nil
+}
+
+// newPprofHandler returns the handler of the pprof endpoints, which capture
+// the CPU and memory profiles of the monitor, e.g. /debug/pprof/heap.
+func newPprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// newMetricsHandler returns the handler of the Prometheus metrics of the
+// monitor, e.g. theia_clickhouse_monitor_round_panics_total.
+func newMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.Handler())
+	return mux
+}
+
+func serve(name, address string, handler http.Handler) {
+	klog.InfoS("Serving endpoints", "name", name, "address", address)
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		klog.ErrorS(err, "Error when serving endpoints", "name", name, "address", address)
+	}
+}
+
+func getShard(connect *sql.DB) (string, error) {
+	var shard string
+	if err := connect.QueryRow("SELECT getMacro('shard')").Scan(&shard); err != nil {
+		return "", err
+	}
+	return shard, nil
+}
+
+// resolveLocalTables replaces the Distributed tables in TABLE_NAME and MV_NAMES
+// with their local tables. ClickHouse does not support deleting records from
+// Distributed tables, while deleting records from the local replicated table
+// of a shard is replicated to all the replicas of the shard.
+func resolveLocalTables(connect *sql.DB) error {
+	var err error
+	tableName, err = resolveLocalTable(connect, tableName)
+	if err != nil {
+		return err
+	}
+	for idx := range mvNames {
+		mvNames[idx], err = resolveLocalTable(connect, mvNames[idx])
+		if err != nil {
+			return err
+		}
+	}
+	// The local table of a Distributed table may be protected even if the
+	// Distributed table is not.
+	return checkDeletableTables()
+}
+
+// isProtectedTable checks whether table, with or without database, is one of
+// the protected tables. A protected table without database is protected in all
+// the databases.
+func isProtectedTable(table string) bool {
+	name := table
+	if parts := strings.Split(table, "."); len(parts) == 2 {
+		name = parts[1]
+	}
+	for _, protected := range protectedTables {
+		if protected == table || protected == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDeletableTables returns an error if TABLE_NAME or MV_NAMES refers to a
+// protected table.
+func checkDeletableTables() error {
+	for _, table := range append([]string{tableName}, mvNames...) {
+		if isProtectedTable(table) {
+			return fmt.Errorf("table %s is protected, records cannot be deleted from it: remove it from TABLE_NAME and MV_NAMES", table)
+		}
+	}
+	return nil
+}
+
+func resolveLocalTable(connect *sql.DB, table string) (string, error) {
+	var database, name string
+	if parts := strings.Split(table, "."); len(parts) == 2 {
+		database, name = parts[0], parts[1]
+	} else {
+		name = table
+	}
+	var engine string
+	if err := connect.QueryRow(distributedTableQuery, database, database, name).Scan(&engine); err != nil {
+		if err == sql.ErrNoRows {
+			return table, nil
+		}
+		return "", fmt.Errorf("error when getting the engine of table %s: %v", table, err)
+	}
+	matches := distributedEngineRegex.FindStringSubmatch(engine)
+	if matches == nil {
+		return "", fmt.Errorf("unexpected engine of Distributed table %s: %s", table, engine)
+	}
+	localTable := matches[1] + "." + matches[2]
+	klog.InfoS("Records are deleted from the local table of the Distributed table", "table", table, "localTable", localTable)
+	return localTable, nil
+}
+
 func loadEnvVariables() error {
 	// Check environment variables
 	tableName = getEnv("TABLE_NAME")
@@ -132,6 +559,15 @@ func loadEnvVariables() error {
 	deletePercentageStr := getEnv("DELETE_PERCENTAGE")
 	skipRoundsNumStr := getEnv("SKIP_ROUNDS_NUM")
 	monitorExecIntervalStr := getEnv("EXEC_INTERVAL")
+	jitterFactorStr := getEnv("JITTER_FACTOR")
+	leaderElectionStr := getEnv("LEADER_ELECTION")
+	protectedTablesStr := getEnv("PROTECTED_TABLES")
+	clusterName = getEnv("CLICKHOUSE_CLUSTER")
+	pprofAddress = getEnv("PPROF_ADDRESS")
+	metricsAddress = getEnv("METRICS_ADDRESS")
+	coldDisk = getEnv("COLD_DISK")
+	coldStorageSizeStr := getEnv("COLD_STORAGE_SIZE")
+	maxPartitionsPerRunStr := getEnv("MAX_PARTITIONS_PER_RUN")
 
 	if len(tableName) == 0 || len(mvNames) == 0 || len(allocatedSpaceStr) == 0 || len(thresholdStr) == 0 || len(deletePercentageStr) == 0 || len(skipRoundsNumStr) == 0 || len(monitorExecIntervalStr) == 0 {
 		return fmt.Errorf("unable to load environment variables, TABLE_NAME, MV_NAMES, STORAGE_SIZE, THRESHOLD, DELETE_PERCENTAGE, SKIP_ROUNDS_NUM, and EXEC_INTERVAL must be defined")
@@ -150,12 +586,34 @@ func loadEnvVariables() error {
 			return fmt.Errorf("invalid MV_NAMES: %v", err)
 		}
 	}
+	protectedTables = append([]string{}, defaultProtectedTables...)
+	for _, table := range strings.Fields(protectedTablesStr) {
+		table, err = sanitizeIdentifier(table)
+		if err != nil {
+			return fmt.Errorf("invalid PROTECTED_TABLES: %v", err)
+		}
+		protectedTables = append(protectedTables, table)
+	}
+	if err := checkDeletableTables(); err != nil {
+		return err
+	}
 
 	quantity, err := resource.ParseQuantity(allocatedSpaceStr)
 	if err != nil {
 		return fmt.Errorf("error when parsing STORAGE_SIZE: %v", err)
 	}
 	allocatedSpace = uint64(quantity.Value())
+	if len(coldDisk) > 0 && !identifierPartRegex.MatchString(coldDisk) {
+		return fmt.Errorf("invalid COLD_DISK: %v", errNotAValidIdentifier)
+	}
+	coldAllocatedSpace = 0
+	if len(coldStorageSizeStr) > 0 {
+		quantity, err := resource.ParseQuantity(coldStorageSizeStr)
+		if err != nil {
+			return fmt.Errorf("error when parsing COLD_STORAGE_SIZE: %v", err)
+		}
+		coldAllocatedSpace = uint64(quantity.Value())
+	}
 
 	threshold, err = strconv.ParseFloat(thresholdStr, 64)
 	if err != nil {
@@ -173,28 +631,57 @@ func loadEnvVariables() error {
 	if err != nil {
 		return fmt.Errorf("error when parsing EXEC_INTERVAL: %v", err)
 	}
-	return nil
+	jitterFactor = 0
+	if len(jitterFactorStr) > 0 {
+		jitterFactor, err = strconv.ParseFloat(jitterFactorStr, 64)
+		if err != nil || jitterFactor < 0 {
+			return fmt.Errorf("error when parsing JITTER_FACTOR: it should be a number >= 0")
+		}
+	}
+	maxPartitionsPerRun = 0
+	if len(maxPartitionsPerRunStr) > 0 {
+		maxPartitionsPerRun, err = strconv.Atoi(maxPartitionsPerRunStr)
+		if err != nil || maxPartitionsPerRun < 0 {
+			return fmt.Errorf("error when parsing MAX_PARTITIONS_PER_RUN: it should be an integer >= 0")
+		}
+	}
+	leaderElection = false
+	if len(leaderElectionStr) > 0 {
+		leaderElection, err = strconv.ParseBool(leaderElectionStr)
+		if err != nil {
+			return fmt.Errorf("error when parsing LEADER_ELECTION: %v", err)
+		}
+	}
+	return loadWebhookEnvVariables()
 }
 
 // Connects to ClickHouse in a loop
 func connectLoop() (*sql.DB, error) {
 	// ClickHouse configuration
-	userName := getEnv("CLICKHOUSE_USERNAME")
-	password := getEnv("CLICKHOUSE_PASSWORD")
+	credentials, err := clickhouseutil.NewCredentialsProviderFromEnv(getEnv)
+	if err != nil {
+		return nil, err
+	}
 	databaseURL := getEnv("DB_URL")
-	if len(userName) == 0 || len(password) == 0 || len(databaseURL) == 0 {
-		return nil, fmt.Errorf("unable to load environment variables, CLICKHOUSE_USERNAME, CLICKHOUSE_PASSWORD and DB_URL must be defined")
+	if credentials == nil || len(databaseURL) == 0 {
+		return nil, fmt.Errorf("unable to load environment variables, CLICKHOUSE_USERNAME and CLICKHOUSE_PASSWORD, or CLICKHOUSE_USERNAME_FILE and CLICKHOUSE_PASSWORD_FILE, and DB_URL must be defined")
 	}
-	var connect *sql.DB
+	dsnOptions, err := clickhouseutil.NewDSNOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	// Unqualified table names refer to the database storing the Theia
+	// tables, or to the default database of the user if it is not set.
+	dsnOptions.Credentials, dsnOptions.Database = credentials, getEnv("CLICKHOUSE_DATABASE")
+	if err := dsnOptions.RegisterTLSConfig(); err != nil {
+		return nil, err
+	}
+	// The connector gets the credentials again for every new connection,
+	// so that the credentials of rotated files are used without a restart.
+	connector := dsnOptions.Connector(databaseURL)
+	klog.InfoS("Connecting to ClickHouse", "dsn", connector)
+	connect := openDB(connector)
 	if err := wait.PollImmediate(connRetryInterval, connTimeout, func() (bool, error) {
-		// Open the database and ping it
-		dataSourceName := fmt.Sprintf("%s?debug=true&username=%s&password=%s", databaseURL, userName, password)
-		var err error
-		connect, err = openSql("clickhouse", dataSourceName)
-		if err != nil {
-			klog.ErrorS(err, "Failed to connect to ClickHouse")
-			return false, nil
-		}
 		if err := connect.Ping(); err != nil {
 			if exception, ok := err.(*clickhouse.Exception); ok {
 				klog.ErrorS(nil, "Failed to ping ClickHouse", "message", exception.Message)
@@ -218,17 +705,17 @@ func checkStorageCondition(connect *sql.DB) {
 		usedSpace  uint64
 		totalSpace uint64
 	)
-	getDiskUsage(connect, &freeSpace, &totalSpace)
-	getClickHouseUsage(connect, &usedSpace)
+	getDiskUsage(connect, hotDisk, &freeSpace, &totalSpace)
+	getClickHouseUsage(connect, hotDisk, &usedSpace)
 	availablePercentage := float64(freeSpace+usedSpace) / float64(totalSpace)
-	klog.InfoS("Low available percentage implies ClickHouse does not save data on a dedicated disk", "availablePercentage", availablePercentage)
+	klog.InfoS("Low available percentage implies ClickHouse does not save data on a dedicated disk", "availablePercentage", format.Percentage(availablePercentage*100))
 }
 
-func getDiskUsage(connect *sql.DB, freeSpace *uint64, totalSpace *uint64) {
+func getDiskUsage(connect *sql.DB, disk string, freeSpace *uint64, totalSpace *uint64) {
 	// Get free space from ClickHouse system table
 	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
-		if err := connect.QueryRow("SELECT free_space, total_space FROM system.disks").Scan(freeSpace, totalSpace); err != nil {
-			klog.ErrorS(err, "Failed to get the disk usage")
+		if err := connect.QueryRow(diskUsageQuery, disk).Scan(freeSpace, totalSpace); err != nil {
+			klog.ErrorS(err, "Failed to get the disk usage", "disk", disk)
 			return false, nil
 		} else {
 			return true, nil
@@ -239,11 +726,11 @@ func getDiskUsage(connect *sql.DB, freeSpace *uint64, totalSpace *uint64) {
 	}
 }
 
-func getClickHouseUsage(connect *sql.DB, usedSpace *uint64) {
+func getClickHouseUsage(connect *sql.DB, disk string, usedSpace *uint64) {
 	// Get space usage from ClickHouse system table
 	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
-		if err := connect.QueryRow("SELECT SUM(bytes) FROM system.parts").Scan(usedSpace); err != nil {
-			klog.ErrorS(err, "Failed to get the used space size by the ClickHouse")
+		if err := connect.QueryRow(clickHouseUsageQuery, disk).Scan(usedSpace); err != nil {
+			klog.ErrorS(err, "Failed to get the used space size by the ClickHouse", "disk", disk)
 			return false, nil
 		} else {
 			return true, nil
@@ -254,47 +741,493 @@ func getClickHouseUsage(connect *sql.DB, usedSpace *uint64) {
 	}
 }
 
-// Checks the memory usage in the ClickHouse, and deletes records when it exceeds the threshold.
-func monitorMemory(connect *sql.DB) {
-	var (
-		freeSpace  uint64
-		usedSpace  uint64
-		totalSpace uint64
-	)
-	getDiskUsage(connect, &freeSpace, &totalSpace)
-	getClickHouseUsage(connect, &usedSpace)
+// replicaUsage is the storage usage of a ClickHouse replica.
+type replicaUsage struct {
+	freeSpace  uint64
+	usedSpace  uint64
+	totalSpace uint64
+}
 
-	// Total space for ClickHouse is the smaller one of the user allocated space size and the actual space size on the disk
-	if (freeSpace + usedSpace) < allocatedSpace {
-		totalSpace = freeSpace + usedSpace
+// Gets the usage of a disk of all the replicas of the shard, keyed by replica
+// name.
+func getShardUsage(connect *sql.DB, disk string) (map[string]*replicaUsage, error) {
+	usages := make(map[string]*replicaUsage)
+	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
+		if err := scanShardUsage(connect, disk, usages); err != nil {
+			klog.ErrorS(err, "Failed to get the usage of the shard", "shard", shard, "disk", disk)
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get the usage of disk %s of shard %s: %v", disk, shard, err)
+	}
+	return usages, nil
+}
+
+func scanShardUsage(connect *sql.DB, disk string, usages map[string]*replicaUsage) error {
+	rows, err := connect.Query(shardDiskUsageQuery, clusterName, shard, disk)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var replica string
+		usage := &replicaUsage{}
+		if err := rows.Scan(&replica, &usage.freeSpace, &usage.totalSpace); err != nil {
+			return err
+		}
+		usages[replica] = usage
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows, err = connect.Query(shardClickHouseQuery, clusterName, shard, disk)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var replica string
+		var usedSpace uint64
+		if err := rows.Scan(&replica, &usedSpace); err != nil {
+			return err
+		}
+		if usage, ok := usages[replica]; ok {
+			usage.usedSpace = usedSpace
+		}
+	}
+	return rows.Err()
+}
+
+// Gets the usage percentage of a disk of a replica. Total space for ClickHouse
+// is the smaller one of the allocated space size, if any, and the actual space
+// size on the disk. The free space of an S3 disk is unlimited.
+func getUsagePercentage(usage *replicaUsage, allocated uint64) float64 {
+	diskSpace := usage.freeSpace + usage.usedSpace
+	if diskSpace < usage.freeSpace {
+		diskSpace = math.MaxUint64
+	}
+	if allocated == 0 || diskSpace < allocated {
+		usage.totalSpace = diskSpace
 	} else {
-		totalSpace = allocatedSpace
+		usage.totalSpace = allocated
 	}
+	return float64(usage.usedSpace) / float64(usage.totalSpace)
+}
 
-	// Calculate the memory usage
-	usagePercentage := float64(usedSpace) / float64(totalSpace)
-	klog.InfoS("Memory usage", "total", totalSpace, "used", usedSpace, "percentage", usagePercentage)
-	// Delete records when memory usage is larger than threshold
-	if usagePercentage > threshold {
-		timeBoundary, err := getTimeBoundary(connect)
+// storageUsage is the highest usage of a disk among the monitored replicas.
+type storageUsage struct {
+	percentage float64
+	usedSpace  uint64
+	totalSpace uint64
+	replica    string
+}
+
+// Gets the usage of a disk. If the ClickHouse cluster is known, the replica of
+// the shard using the highest percentage of the disk is returned.
+func getStorageUsage(connect *sql.DB, disk string, allocated uint64) (*storageUsage, error) {
+	result := &storageUsage{}
+	if len(clusterName) > 0 {
+		usages, err := getShardUsage(connect, disk)
 		if err != nil {
-			klog.ErrorS(err, "Failed to get timeInserted boundary")
+			return nil, err
+		}
+		for replica, usage := range usages {
+			percentage := getUsagePercentage(usage, allocated)
+			klog.InfoS("Memory usage", "shard", shard, "replica", replica, "disk", disk, "total", format.Bytes(usage.totalSpace), "used", format.Bytes(usage.usedSpace), "percentage", format.Percentage(percentage*100))
+			if percentage > result.percentage {
+				result.percentage = percentage
+				result.usedSpace, result.totalSpace = usage.usedSpace, usage.totalSpace
+				result.replica = replica
+			}
+		}
+		return result, nil
+	}
+	usage := &replicaUsage{}
+	getDiskUsage(connect, disk, &usage.freeSpace, &usage.totalSpace)
+	getClickHouseUsage(connect, disk, &usage.usedSpace)
+	result.percentage = getUsagePercentage(usage, allocated)
+	result.usedSpace, result.totalSpace = usage.usedSpace, usage.totalSpace
+	klog.InfoS("Memory usage", "disk", disk, "total", format.Bytes(usage.totalSpace), "used", format.Bytes(usage.usedSpace), "percentage", format.Percentage(result.percentage*100))
+	return result, nil
+}
+
+// Checks the memory usage in the ClickHouse, and deletes records when it exceeds the threshold.
+// If the ClickHouse cluster is known, the replica of the shard using the
+// highest percentage of storage decides the deletion, as records are deleted
+// from all the replicas of the shard.
+// When the tiered storage policy is used, the oldest records are stored in the
+// cold disk, so records are only deleted when the cold disk exceeds the
+// threshold. The oldest parts are moved to the cold disk instead when only the
+// default disk exceeds it.
+func monitorMemory(connect *sql.DB) {
+	usage, err := getStorageUsage(connect, hotDisk, allocatedSpace)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the memory usage")
+		return
+	}
+	var coldUsage *storageUsage
+	if len(coldDisk) > 0 {
+		if coldUsage, err = getStorageUsage(connect, coldDisk, coldAllocatedSpace); err != nil {
+			klog.ErrorS(err, "Failed to get the memory usage of the cold disk")
 			return
 		}
-		// Delete old data in the table storing records and related materialized views
-		tables := append([]string{tableName}, mvNames...)
-		for _, table := range tables {
-			// Delete all records inserted earlier than an upper boundary of timeInserted
-			query := fmt.Sprintf("ALTER TABLE %s DELETE WHERE timeInserted < toDateTime(?)", table)
-			// #nosec G201: table and view names were sanitized earlier
-			if _, err := connect.Exec(query, timeBoundary.Format(timeFormat)); err != nil {
-				klog.ErrorS(err, "Failed to delete records from ClickHouse", "table", table)
-				return
+		if coldUsage.percentage > threshold {
+			usage = coldUsage
+		}
+	}
+	if usage.percentage <= threshold {
+		aboveThreshold = false
+		return
+	}
+	usagePercentage, usedSpace := usage.percentage, usage.usedSpace
+	alert := &storageAlert{
+		Event:      thresholdExceededEvent,
+		Shard:      shard,
+		Replica:    usage.replica,
+		UsedBytes:  usedSpace,
+		TotalBytes: usage.totalSpace,
+		Usage:      usagePercentage,
+		Threshold:  threshold,
+	}
+	if coldUsage != nil && coldUsage.percentage <= threshold {
+		movedBytes, err := moveToColdDisk(connect)
+		if err != nil {
+			klog.ErrorS(err, "Failed to move records to the cold disk")
+			if !aboveThreshold {
+				alert.Action = "records could not be moved to the cold disk"
+				notifyWebhook(alert)
 			}
+			aboveThreshold = true
+			return
 		}
-		klog.InfoS("Skip rounds after a successful deletion", "skipRoundsNum", skipRoundsNum)
+		alert.Event, alert.Action = recordsMovedEvent, fmt.Sprintf("old records were moved to the cold disk (%s)", format.Bytes(movedBytes))
+		notifyWebhook(alert)
+		aboveThreshold = true
+		klog.InfoS("Skip rounds after moving records to the cold disk", "skipRoundsNum", skipRoundsNum, "duration", format.Duration(time.Duration(skipRoundsNum)*monitorExecInterval))
 		remainingRoundsNum = skipRoundsNum
+		return
+	}
+	// Delete records when memory usage is larger than threshold
+	// The webhook is notified when the threshold is crossed and when records
+	// are deleted, not in every round in which the deletion is skipped.
+	skipDeletion := func(action string) {
+		if !aboveThreshold {
+			alert.Action = action
+			notifyWebhook(alert)
+		}
+		aboveThreshold = true
+	}
+	// Deletions issued in previous rounds, possibly by another replica
+	// which was the leader, may not have released the space yet.
+	pendingDeletions, err := getPendingDeletions(connect)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the pending deletions")
+		skipDeletion("records were not deleted as the pending deletions could not be checked")
+		return
+	}
+	if pendingDeletions > 0 {
+		klog.InfoS("Skip deletion as previous deletions are not completed", "pendingDeletions", pendingDeletions)
+		skipDeletion("records were not deleted as previous deletions are not completed")
+		return
+	}
+	// Deleting records while the data schema is migrated would race with
+	// the mutations and the schema changes of the migrators.
+	migrationInProgress, err := isMigrationInProgress(connect)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the migration status")
+		skipDeletion("records were not deleted as the migration status could not be checked")
+		return
+	}
+	if migrationInProgress {
+		klog.InfoS("Skip deletion as the data schema is being migrated")
+		skipDeletion("records were not deleted as the data schema is being migrated")
+		return
 	}
+	timeBoundary, err := getTimeBoundary(connect)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get timeInserted boundary")
+		skipDeletion("records were not deleted as the records to delete could not be determined")
+		return
+	}
+	// The deletion is audited on a best-effort basis, it is not skipped
+	// if the deleted records cannot be counted.
+	audit, err := getDeletionAudit(connect, timeBoundary)
+	if err != nil {
+		klog.ErrorS(err, "Failed to count the records to be deleted")
+	} else {
+		audit.bytesReclaimed = uint64(float64(usedSpace) * deletePercentage)
+		audit.reason = fmt.Sprintf("storage usage %s above threshold %s", format.Percentage(usagePercentage*100), format.Percentage(threshold*100))
+	}
+	// Delete old data in the table storing records and related materialized views
+	tables := append([]string{tableName}, mvNames...)
+	for _, table := range tables {
+		// The partitions whose records are all older than the boundary
+		// are dropped, which is much cheaper than a mutation rewriting
+		// them.
+		deleteRecords, err := dropExpiredPartitions(connect, table, timeBoundary)
+		if err != nil {
+			klog.ErrorS(err, "Failed to drop the expired partitions", "table", table)
+			skipDeletion(fmt.Sprintf("records could not be deleted from table %s", table))
+			return
+		}
+		if !deleteRecords {
+			continue
+		}
+		// Delete all records inserted earlier than an upper boundary of
+		// timeInserted. The boundary is bound in UTC, which the driver
+		// sends as toDateTime('...', 'UTC'), so that the deleted range
+		// does not depend on the timezone of the ClickHouse server or of
+		// the monitor.
+		query := fmt.Sprintf("ALTER TABLE %s DELETE WHERE timeInserted < ?", table)
+		// #nosec G201: table and view names were sanitized earlier
+		_, span := tracing.StartClickHouseSpan(context.Background(), "exec", query)
+		_, err = connect.Exec(query, timeBoundary.UTC())
+		tracing.EndSpan(span, err)
+		if err != nil {
+			klog.ErrorS(err, "Failed to delete records from ClickHouse", "table", table)
+			skipDeletion(fmt.Sprintf("records could not be deleted from table %s", table))
+			return
+		}
+	}
+	alert.Event, alert.Action = recordsDeletedEvent, "old records were deleted"
+	alert.Deletion = &deletionEvent{Tables: tables}
+	if audit != nil {
+		if err := recordDeletion(connect, audit); err != nil {
+			klog.ErrorS(err, "Failed to record the deletion in the audit table")
+		}
+		alert.Deletion.RangeStart, alert.Deletion.RangeEnd = audit.rangeStart, audit.rangeEnd
+		alert.Deletion.RowCount, alert.Deletion.BytesReclaimed = audit.rowCount, audit.bytesReclaimed
+	}
+	notifyWebhook(alert)
+	aboveThreshold = true
+	klog.InfoS("Skip rounds after a successful deletion", "skipRoundsNum", skipRoundsNum, "duration", format.Duration(time.Duration(skipRoundsNum)*monitorExecInterval))
+	remainingRoundsNum = skipRoundsNum
+}
+
+// Moves the oldest parts of the table storing records and of the materialized
+// views from the default disk to the cold disk, about DELETE_PERCENTAGE of the
+// bytes of each table, and returns the number of bytes moved. Moves are not
+// replicated, the parts are only moved in the local replica, while the other
+// replicas move their parts according to the move factor of the storage
+// policy.
+func moveToColdDisk(connect *sql.DB) (uint64, error) {
+	var movedBytes uint64
+	for _, table := range append([]string{tableName}, mvNames...) {
+		parts, err := getDiskParts(connect, table, hotDisk)
+		if err != nil {
+			return movedBytes, err
+		}
+		var tableBytes, tableMovedBytes uint64
+		for _, part := range parts {
+			tableBytes += part.bytes
+		}
+		bytesToMove := uint64(float64(tableBytes) * deletePercentage)
+		for _, part := range parts {
+			if tableMovedBytes >= bytesToMove {
+				break
+			}
+			if !partNameRegex.MatchString(part.name) {
+				return movedBytes, fmt.Errorf("failed to move part %s of table %s to disk %s: %v", part.name, table, coldDisk, errNotAValidIdentifier)
+			}
+			// #nosec G201: table and view names and the cold disk were
+			// sanitized earlier, and the part name was validated
+			query := fmt.Sprintf("ALTER TABLE %s MOVE PART '%s' TO DISK '%s'", table, part.name, coldDisk)
+			_, span := tracing.StartClickHouseSpan(context.Background(), "exec", query)
+			_, err := connect.Exec(query)
+			tracing.EndSpan(span, err)
+			if err != nil {
+				return movedBytes, fmt.Errorf("failed to move part %s of table %s to disk %s: %v", part.name, table, coldDisk, err)
+			}
+			tableMovedBytes += part.bytes
+		}
+		movedBytes += tableMovedBytes
+		klog.InfoS("Moved records to the cold disk", "table", table, "disk", coldDisk, "bytes", format.Bytes(tableMovedBytes))
+	}
+	return movedBytes, nil
+}
+
+// dataPart is an active part of a table.
+type dataPart struct {
+	name  string
+	bytes uint64
+}
+
+// Gets the active parts of a table stored in a disk, oldest first.
+func getDiskParts(connect *sql.DB, table, disk string) ([]dataPart, error) {
+	database := ""
+	if parts := strings.Split(table, "."); len(parts) == 2 {
+		database, table = parts[0], parts[1]
+	}
+	var parts []dataPart
+	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
+		parts = nil
+		rows, err := connect.Query(diskPartsQuery, database, database, table, disk)
+		if err != nil {
+			klog.ErrorS(err, "Failed to get the parts of the table", "table", table, "disk", disk)
+			return false, nil
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var part dataPart
+			if err := rows.Scan(&part.name, &part.bytes); err != nil {
+				klog.ErrorS(err, "Failed to get the parts of the table", "table", table, "disk", disk)
+				return false, nil
+			}
+			parts = append(parts, part)
+		}
+		if err := rows.Err(); err != nil {
+			klog.ErrorS(err, "Failed to get the parts of the table", "table", table, "disk", disk)
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get the parts of table %s on disk %s: %v", table, disk, err)
+	}
+	return parts, nil
+}
+
+// Drops the partitions of a table whose records were all inserted before the
+// boundary, at most MAX_PARTITIONS_PER_RUN of them, and returns whether the
+// records inserted before the boundary still have to be deleted from the
+// remaining partitions. The default tables are not partitioned by
+// timeInserted, their records are always deleted.
+func dropExpiredPartitions(connect *sql.DB, table string, timeBoundary time.Time) (bool, error) {
+	partitions, err := getExpiredPartitions(connect, table, timeBoundary)
+	if err != nil {
+		// The records can still be deleted without dropping the
+		// partitions.
+		klog.ErrorS(err, "Failed to get the expired partitions, deleting the records instead", "table", table)
+		return true, nil
+	}
+	if len(partitions) == 0 {
+		return true, nil
+	}
+	dropped, partiallyExpired := 0, false
+	for _, partition := range partitions {
+		if !partition.expired {
+			partiallyExpired = true
+			continue
+		}
+		if maxPartitionsPerRun > 0 && dropped >= maxPartitionsPerRun {
+			// The older partitions are dropped in the next rounds
+			// before deleting the records of the newer ones.
+			klog.InfoS("Reached the maximum number of partitions dropped in a round", "table", table, "maxPartitionsPerRun", maxPartitionsPerRun)
+			return false, nil
+		}
+		if !partNameRegex.MatchString(partition.id) {
+			return false, fmt.Errorf("failed to drop partition %s of table %s: %v", partition.id, table, errNotAValidIdentifier)
+		}
+		// #nosec G201: table and view names were sanitized earlier, and the
+		// partition ID was validated
+		query := fmt.Sprintf("ALTER TABLE %s DROP PARTITION ID '%s'", table, partition.id)
+		_, span := tracing.StartClickHouseSpan(context.Background(), "exec", query)
+		_, err := connect.Exec(query)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return false, fmt.Errorf("failed to drop partition %s of table %s: %v", partition.id, table, err)
+		}
+		dropped++
+	}
+	klog.InfoS("Dropped the expired partitions", "table", table, "partitions", dropped)
+	return partiallyExpired, nil
+}
+
+// expiredPartition is a partition holding records inserted before a boundary.
+type expiredPartition struct {
+	id string
+	// Whether all the records of the partition were inserted before the
+	// boundary.
+	expired bool
+}
+
+// Gets the partitions of a table partitioned by timeInserted which hold
+// records inserted before the boundary, oldest first.
+func getExpiredPartitions(connect *sql.DB, table string, timeBoundary time.Time) ([]expiredPartition, error) {
+	database := ""
+	if parts := strings.Split(table, "."); len(parts) == 2 {
+		database, table = parts[0], parts[1]
+	}
+	var partitions []expiredPartition
+	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
+		partitions = nil
+		rows, err := connect.Query(expiredPartitionsQuery, timeBoundary.UTC(), database, database, table, timeBoundary.UTC())
+		if err != nil {
+			klog.ErrorS(err, "Failed to get the partitions of the table", "table", table)
+			return false, nil
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var partition expiredPartition
+			var expired uint8
+			if err := rows.Scan(&partition.id, &expired); err != nil {
+				klog.ErrorS(err, "Failed to get the partitions of the table", "table", table)
+				return false, nil
+			}
+			partition.expired = expired == 1
+			partitions = append(partitions, partition)
+		}
+		if err := rows.Err(); err != nil {
+			klog.ErrorS(err, "Failed to get the partitions of the table", "table", table)
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get the partitions of table %s: %v", table, err)
+	}
+	return partitions, nil
+}
+
+// Gets the number of deletions issued by the monitors which are not completed.
+func getPendingDeletions(connect *sql.DB) (uint64, error) {
+	var pendingDeletions uint64
+	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
+		if err := connect.QueryRow(pendingDeletionsQuery).Scan(&pendingDeletions); err != nil {
+			klog.ErrorS(err, "Failed to get the number of pending deletions")
+			return false, nil
+		} else {
+			return true, nil
+		}
+	}); err != nil {
+		return pendingDeletions, fmt.Errorf("failed to get the number of pending deletions: %v", err)
+	}
+	return pendingDeletions, nil
+}
+
+// Checks whether the schema management tool is migrating the data schema. In
+// a cluster, the migrations are applied by a single replica for the whole
+// cluster, so the status of all the replicas is checked. No migration is in
+// progress if the migration status table does not exist, as no migration was
+// applied since it was introduced.
+func isMigrationInProgress(connect *sql.DB) (bool, error) {
+	database, statusTable := "currentDatabase()", migrationStatusTable
+	if parts := strings.Split(tableName, "."); len(parts) == 2 {
+		database, statusTable = parts[0], parts[0]+"."+migrationStatusTable
+	}
+	var args []interface{}
+	if len(clusterName) > 0 {
+		statusTable = fmt.Sprintf("clusterAllReplicas(?, %s, %s)", database, migrationStatusTable)
+		args = append(args, clusterName)
+	}
+	args = append(args, int(migrationStatusTimeout.Seconds()))
+	// #nosec G201: the database name was sanitized earlier
+	query := fmt.Sprintf(migrationInProgressQuery, statusTable)
+	var inProgress uint8
+	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
+		if err := connect.QueryRow(query, args...).Scan(&inProgress); err != nil {
+			var exception *clickhouse.Exception
+			if errors.As(err, &exception) && exception.Code == unknownTableErrorCode {
+				inProgress = 0
+				return true, nil
+			}
+			klog.ErrorS(err, "Failed to get the migration status")
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return false, fmt.Errorf("failed to get the migration status: %v", err)
+	}
+	return inProgress == 1, nil
 }
 
 // Gets the timeInserted value of the latest row to be deleted.
@@ -337,3 +1270,63 @@ func getDeleteRowNum(connect *sql.DB) (uint64, error) {
 	deleteRowNum = uint64(float64(count) * deletePercentage)
 	return deleteRowNum, nil
 }
+
+// deletionAudit describes the records deleted by a round of monitoring.
+type deletionAudit struct {
+	rangeStart time.Time
+	rangeEnd   time.Time
+	rowCount   uint64
+	// bytesReclaimed is estimated from the storage used by ClickHouse and the
+	// percentage of records deleted, as the space is only released once the
+	// deletion is completed.
+	bytesReclaimed uint64
+	reason         string
+}
+
+// Gets the time range and the number of the records inserted before the
+// boundary, which are about to be deleted.
+func getDeletionAudit(connect *sql.DB, timeBoundary time.Time) (*deletionAudit, error) {
+	audit := &deletionAudit{rangeEnd: timeBoundary}
+	query := fmt.Sprintf("SELECT MIN(timeInserted), COUNT() FROM %s WHERE timeInserted < ?", tableName)
+	if err := wait.PollImmediate(queryRetryInterval, queryTimeout, func() (bool, error) {
+		// #nosec G201: table name was sanitized earlier
+		if err := connect.QueryRow(query, timeBoundary.UTC()).Scan(&audit.rangeStart, &audit.rowCount); err != nil {
+			klog.ErrorS(err, "Failed to count the records to be deleted", "table name", tableName)
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to count the records to be deleted from %s: %v", tableName, err)
+	}
+	return audit, nil
+}
+
+// Inserts an entry describing a deletion in the audit table, so that gaps in
+// the flow records can be explained.
+func recordDeletion(connect *sql.DB, audit *deletionAudit) error {
+	auditTable := deletionAuditTable
+	if parts := strings.Split(tableName, "."); len(parts) == 2 {
+		auditTable = parts[0] + "." + deletionAuditTable
+	}
+	// #nosec G201: the database name was sanitized earlier
+	query := fmt.Sprintf("INSERT INTO %s (tableName, rangeStart, rangeEnd, rowCount, bytesReclaimed, reason) VALUES (?, ?, ?, ?, ?, ?)", auditTable)
+	tx, err := connect.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin the insertion of the deletion audit: %v", err)
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare the insertion of the deletion audit: %v", err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(tableName, audit.rangeStart.UTC(), audit.rangeEnd.UTC(), audit.rowCount, audit.bytesReclaimed, audit.reason); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to insert the deletion audit: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit the insertion of the deletion audit: %v", err)
+	}
+	klog.InfoS("Recorded the deletion of records", "table", tableName, "from", audit.rangeStart, "to", audit.rangeEnd, "rows", audit.rowCount, "bytesReclaimed", format.Bytes(audit.bytesReclaimed))
+	return nil
+}
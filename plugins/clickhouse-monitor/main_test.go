@@ -15,13 +15,25 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/component-base/metrics/testutil"
 )
 
 func TestMonitorWithMockDB(t *testing.T) {
@@ -47,19 +59,31 @@ func TestMonitorWithMockDB(t *testing.T) {
 			remainingRoundsNum:         0,
 			expectedRemainingRoundsNum: 3,
 			setUpMock: func(mock sqlmock.Sqlmock) {
-				baseTime := time.Now()
+				// The boundary is scanned in the timezone of the ClickHouse
+				// server, and must be bound in UTC.
+				baseTime := time.Now().In(time.FixedZone("UTC+8", 8*60*60))
 				diskRow := sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(4, 10)
 				partsRow := sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(5)
 				countRow := sqlmock.NewRows([]string{"count"}).AddRow(10)
 				timeRow := sqlmock.NewRows([]string{"timeInserted"}).AddRow(baseTime.Add(5 * time.Second))
-				mock.ExpectQuery("SELECT free_space, total_space FROM system.disks").WillReturnRows(diskRow)
-				mock.ExpectQuery("SELECT SUM(bytes) FROM system.parts").WillReturnRows(partsRow)
+				mock.ExpectQuery(diskUsageQuery).WillReturnRows(diskRow)
+				mock.ExpectQuery(clickHouseUsageQuery).WillReturnRows(partsRow)
+				mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(fmt.Sprintf(migrationInProgressQuery, "migration_status")).WithArgs(300).WillReturnRows(sqlmock.NewRows([]string{"inProgress"}).AddRow(0))
 				mock.ExpectQuery("SELECT COUNT() FROM flows").WillReturnRows(countRow)
 				mock.ExpectQuery("SELECT timeInserted FROM flows LIMIT 1 OFFSET (?)").WithArgs(4).WillReturnRows(timeRow)
+				mock.ExpectQuery("SELECT MIN(timeInserted), COUNT() FROM flows WHERE timeInserted < ?").WithArgs(baseTime.Add(5 * time.Second).UTC()).WillReturnRows(
+					sqlmock.NewRows([]string{"MIN(timeInserted)", "COUNT()"}).AddRow(baseTime, 5))
 				for _, table := range []string{"flows", "flows_pod_view", "flows_node_view", "flows_policy_view"} {
-					query := fmt.Sprintf("ALTER TABLE %s DELETE WHERE timeInserted < toDateTime(?)", table)
-					mock.ExpectExec(query).WithArgs(baseTime.Add(5 * time.Second).Format(timeFormat)).WillReturnResult(sqlmock.NewResult(0, 5))
+					expectPartitions(mock, table, baseTime.Add(5*time.Second).UTC())
+					query := fmt.Sprintf("ALTER TABLE %s DELETE WHERE timeInserted < ?", table)
+					mock.ExpectExec(query).WithArgs(baseTime.Add(5 * time.Second).UTC()).WillReturnResult(sqlmock.NewResult(0, 5))
 				}
+				mock.ExpectBegin()
+				mock.ExpectPrepare("INSERT INTO deletion_audit (tableName, rangeStart, rangeEnd, rowCount, bytesReclaimed, reason) VALUES (?, ?, ?, ?, ?, ?)").
+					ExpectExec().WithArgs("flows", baseTime.UTC(), baseTime.Add(5*time.Second).UTC(), 5, 2, "storage usage 55.56 % above threshold 50.00 %").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
 			},
 		},
 		{
@@ -69,8 +93,33 @@ func TestMonitorWithMockDB(t *testing.T) {
 			setUpMock: func(mock sqlmock.Sqlmock) {
 				diskRow := sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(6, 10)
 				partsRow := sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(5)
-				mock.ExpectQuery("SELECT free_space, total_space FROM system.disks").WillReturnRows(diskRow)
-				mock.ExpectQuery("SELECT SUM(bytes) FROM system.parts").WillReturnRows(partsRow)
+				mock.ExpectQuery(diskUsageQuery).WillReturnRows(diskRow)
+				mock.ExpectQuery(clickHouseUsageQuery).WillReturnRows(partsRow)
+			},
+		},
+		{
+			name:                       "Monitor memory with pending deletions",
+			remainingRoundsNum:         0,
+			expectedRemainingRoundsNum: 0,
+			setUpMock: func(mock sqlmock.Sqlmock) {
+				diskRow := sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(4, 10)
+				partsRow := sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(5)
+				mock.ExpectQuery(diskUsageQuery).WillReturnRows(diskRow)
+				mock.ExpectQuery(clickHouseUsageQuery).WillReturnRows(partsRow)
+				mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+			},
+		},
+		{
+			name:                       "Monitor memory during a migration",
+			remainingRoundsNum:         0,
+			expectedRemainingRoundsNum: 0,
+			setUpMock: func(mock sqlmock.Sqlmock) {
+				diskRow := sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(4, 10)
+				partsRow := sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(5)
+				mock.ExpectQuery(diskUsageQuery).WillReturnRows(diskRow)
+				mock.ExpectQuery(clickHouseUsageQuery).WillReturnRows(partsRow)
+				mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(fmt.Sprintf(migrationInProgressQuery, "migration_status")).WithArgs(300).WillReturnRows(sqlmock.NewRows([]string{"inProgress"}).AddRow(1))
 			},
 		},
 		{
@@ -109,6 +158,17 @@ func initEnv() {
 	monitorExecInterval = 1 * time.Minute
 }
 
+// expectPartitions expects the query of the expired partitions of a table,
+// which returns the given partitions as pairs of their ID and whether they are
+// fully expired, and none for the tables which are not partitioned.
+func expectPartitions(mock sqlmock.Sqlmock, table string, timeBoundary time.Time, partitions ...interface{}) {
+	rows := sqlmock.NewRows([]string{"partition_id", "expired"})
+	for i := 0; i+1 < len(partitions); i += 2 {
+		rows.AddRow(partitions[i], partitions[i+1])
+	}
+	mock.ExpectQuery(expiredPartitionsQuery).WithArgs(timeBoundary, "", "", table, timeBoundary).WillReturnRows(rows)
+}
+
 func testConnection(t *testing.T, db *sql.DB, mock sqlmock.Sqlmock) {
 	mock.ExpectPing()
 
@@ -120,15 +180,17 @@ func testConnection(t *testing.T, db *sql.DB, mock sqlmock.Sqlmock) {
 			return "password"
 		case "DB_URL":
 			return "tcp://localhost:9000"
+		case "CLICKHOUSE_DATABASE":
+			return "theia"
 		default:
 			return ""
 		}
 	}
 
-	openSql = func(driverName, dataSourceName string) (*sql.DB, error) {
-		assert.Equal(t, driverName, "clickhouse")
-		assert.Equal(t, dataSourceName, "tcp://localhost:9000?debug=true&username=username&password=password")
-		return db, nil
+	openDB = func(c driver.Connector) *sql.DB {
+		// The password of the DSN is scrubbed when the connector is logged.
+		assert.Equal(t, "tcp://localhost:9000?debug=false&username=username&password=xxxxx&database=theia", fmt.Sprint(c))
+		return db
 	}
 
 	_, err := connectLoop()
@@ -141,10 +203,10 @@ func testConnection(t *testing.T, db *sql.DB, mock sqlmock.Sqlmock) {
 func testCheckStorageCondition(t *testing.T, db *sql.DB, mock sqlmock.Sqlmock) {
 	diskRow := sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(9, 10)
 	partsRow := sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(1)
-	mock.ExpectQuery("SELECT free_space, total_space FROM system.disks").WillReturnError(fmt.Errorf("error in database, please retry"))
-	mock.ExpectQuery("SELECT free_space, total_space FROM system.disks").WillReturnRows(diskRow)
-	mock.ExpectQuery("SELECT SUM(bytes) FROM system.parts").WillReturnError(fmt.Errorf("error in database, please retry"))
-	mock.ExpectQuery("SELECT SUM(bytes) FROM system.parts").WillReturnRows(partsRow)
+	mock.ExpectQuery(diskUsageQuery).WillReturnError(fmt.Errorf("error in database, please retry"))
+	mock.ExpectQuery(diskUsageQuery).WillReturnRows(diskRow)
+	mock.ExpectQuery(clickHouseUsageQuery).WillReturnError(fmt.Errorf("error in database, please retry"))
+	mock.ExpectQuery(clickHouseUsageQuery).WillReturnRows(partsRow)
 	checkStorageCondition(db)
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -202,6 +264,10 @@ func TestLoadEnvVariables(t *testing.T) {
 			return "3"
 		case "EXEC_INTERVAL":
 			return "1m"
+		case "JITTER_FACTOR":
+			return "0.1"
+		case "LEADER_ELECTION":
+			return "true"
 		default:
 			return ""
 		}
@@ -248,6 +314,39 @@ func TestLoadEnvVariables(t *testing.T) {
 			},
 			expectedError: fmt.Errorf("invalid MV_NAMES: "),
 		},
+		{
+			name: "protected view name",
+			getEnv: func(key string) string {
+				if key == "MV_NAMES" {
+					return "flows_pod_view default.recommendations_local"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("table default.recommendations_local is protected"),
+		},
+		{
+			name: "additional protected table",
+			getEnv: func(key string) string {
+				if key == "PROTECTED_TABLES" {
+					return "default.flows_local flows_node_view"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("table flows_node_view is protected"),
+		},
+		{
+			name: "invalid protected tables",
+			getEnv: func(key string) string {
+				if key == "PROTECTED_TABLES" {
+					return "a-b"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("invalid PROTECTED_TABLES: "),
+		},
 		{
 			name: "invalid storage size",
 			getEnv: func(key string) string {
@@ -292,6 +391,39 @@ func TestLoadEnvVariables(t *testing.T) {
 			},
 			expectedError: fmt.Errorf("error when parsing SKIP_ROUNDS_NUM: "),
 		},
+		{
+			name: "invalid jitter factor",
+			getEnv: func(key string) string {
+				if key == "JITTER_FACTOR" {
+					return "-0.1"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("error when parsing JITTER_FACTOR: "),
+		},
+		{
+			name: "invalid maximum partitions per run",
+			getEnv: func(key string) string {
+				if key == "MAX_PARTITIONS_PER_RUN" {
+					return "-1"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("error when parsing MAX_PARTITIONS_PER_RUN: "),
+		},
+		{
+			name: "invalid leader election",
+			getEnv: func(key string) string {
+				if key == "LEADER_ELECTION" {
+					return "yes"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("error when parsing LEADER_ELECTION: "),
+		},
 		{
 			name: "invalid execution interval",
 			getEnv: func(key string) string {
@@ -303,6 +435,28 @@ func TestLoadEnvVariables(t *testing.T) {
 			},
 			expectedError: fmt.Errorf("error when parsing EXEC_INTERVAL: "),
 		},
+		{
+			name: "invalid cold disk",
+			getEnv: func(key string) string {
+				if key == "COLD_DISK" {
+					return "cold'"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("invalid COLD_DISK: "),
+		},
+		{
+			name: "invalid cold storage size",
+			getEnv: func(key string) string {
+				if key == "COLD_STORAGE_SIZE" {
+					return "G64"
+				} else {
+					return defaultGetEnv(key)
+				}
+			},
+			expectedError: fmt.Errorf("error when parsing COLD_STORAGE_SIZE:"),
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -317,3 +471,362 @@ func TestLoadEnvVariables(t *testing.T) {
 		})
 	}
 }
+
+func TestRunWithLeaderElection(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	initEnv()
+	remainingRoundsNum = 1
+
+	fakeClient := fake.NewSimpleClientset()
+	oldNewKubeClient, oldGetEnv, oldRunUntil := newKubeClient, getEnv, runUntil
+	defer func() {
+		newKubeClient, getEnv, runUntil = oldNewKubeClient, oldGetEnv, oldRunUntil
+	}()
+	newKubeClient = func() (kubernetes.Interface, error) {
+		return fakeClient, nil
+	}
+	getEnv = func(key string) string {
+		switch key {
+		case "POD_NAME":
+			return "chi-clickhouse-clickhouse-0-1-0"
+		case "POD_NAMESPACE":
+			return "flow-visibility"
+		default:
+			return ""
+		}
+	}
+	stopCh := make(chan struct{})
+	runUntil = func(f func(), period time.Duration, stopCh2 <-chan struct{}) {
+		f()
+		// The leader runs a single round in this test.
+		close(stopCh)
+	}
+	mock.ExpectQuery("SELECT getMacro('shard')").WillReturnRows(sqlmock.NewRows([]string{"shard"}).AddRow("0"))
+
+	require.NoError(t, runWithLeaderElection(db, stopCh))
+	assert.Equal(t, 0, remainingRoundsNum)
+	// The Lease of the shard is released when the monitor stops.
+	lease, err := fakeClient.CoordinationV1().Leases("flow-visibility").Get(context.TODO(), "clickhouse-monitor-0", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "", *lease.Spec.HolderIdentity)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	getEnv = func(key string) string { return "" }
+	assert.ErrorContains(t, runWithLeaderElection(db, stopCh), "POD_NAME and POD_NAMESPACE must be defined")
+}
+
+func TestMonitorShardMemory(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	initEnv()
+	remainingRoundsNum = 0
+	clusterName, shard = "clickhouse", "0"
+	defer func() { clusterName, shard = "", "" }()
+
+	// Replica 0-1 is above the threshold while replica 0-0 is not, records
+	// are deleted from the shard.
+	baseTime := time.Now()
+	mock.ExpectQuery(shardDiskUsageQuery).WithArgs("clickhouse", "0", "default").WillReturnRows(
+		sqlmock.NewRows([]string{"replica", "free_space", "total_space"}).AddRow("0-0", 6, 10).AddRow("0-1", 4, 10))
+	mock.ExpectQuery(shardClickHouseQuery).WithArgs("clickhouse", "0", "default").WillReturnRows(
+		sqlmock.NewRows([]string{"replica", "SUM(bytes)"}).AddRow("0-0", 4).AddRow("0-1", 6))
+	mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	// No migration was applied since the migration status table was
+	// introduced.
+	mock.ExpectQuery(fmt.Sprintf(migrationInProgressQuery, "clusterAllReplicas(?, currentDatabase(), migration_status)")).WithArgs("clickhouse", 300).
+		WillReturnError(&clickhouse.Exception{Code: unknownTableErrorCode, Message: "Table default.migration_status doesn't exist"})
+	mock.ExpectQuery("SELECT COUNT() FROM flows").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	mock.ExpectQuery("SELECT timeInserted FROM flows LIMIT 1 OFFSET (?)").WithArgs(4).WillReturnRows(
+		sqlmock.NewRows([]string{"timeInserted"}).AddRow(baseTime))
+	// The records cannot be counted, the deletion is not audited but records
+	// are still deleted.
+	mock.ExpectQuery("SELECT MIN(timeInserted), COUNT() FROM flows WHERE timeInserted < ?").WithArgs(baseTime.UTC()).WillReturnError(fmt.Errorf("error in database"))
+	for _, table := range []string{"flows", "flows_pod_view", "flows_node_view", "flows_policy_view"} {
+		expectPartitions(mock, table, baseTime.UTC())
+		query := fmt.Sprintf("ALTER TABLE %s DELETE WHERE timeInserted < ?", table)
+		mock.ExpectExec(query).WithArgs(baseTime.UTC()).WillReturnResult(sqlmock.NewResult(0, 5))
+	}
+	monitorMemory(db)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 3, remainingRoundsNum)
+}
+
+func TestMonitorTieredStorage(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	initEnv()
+	coldDisk, coldAllocatedSpace = "cold", 100
+	defer func() { coldDisk, coldAllocatedSpace = "", 0 }()
+
+	t.Run("Move records to the cold disk", func(t *testing.T) {
+		remainingRoundsNum = 0
+		mock.ExpectQuery(diskUsageQuery).WithArgs("default").WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(4, 10))
+		mock.ExpectQuery(clickHouseUsageQuery).WithArgs("default").WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(6))
+		mock.ExpectQuery(diskUsageQuery).WithArgs("cold").WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(1000, 1000))
+		mock.ExpectQuery(clickHouseUsageQuery).WithArgs("cold").WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(20))
+		for _, table := range []string{"flows", "flows_pod_view", "flows_node_view", "flows_policy_view"} {
+			mock.ExpectQuery(diskPartsQuery).WithArgs("", "", table, "default").WillReturnRows(
+				sqlmock.NewRows([]string{"name", "bytes_on_disk"}).AddRow("all_1_1_0", 2).AddRow("all_2_2_0", 1).AddRow("all_3_3_0", 1))
+			// Half of the 4 bytes of the table are moved.
+			query := fmt.Sprintf("ALTER TABLE %s MOVE PART 'all_1_1_0' TO DISK 'cold'", table)
+			mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		monitorMemory(db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 3, remainingRoundsNum)
+	})
+
+	t.Run("Invalid part name", func(t *testing.T) {
+		remainingRoundsNum = 0
+		mock.ExpectQuery(diskUsageQuery).WithArgs("default").WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(4, 10))
+		mock.ExpectQuery(clickHouseUsageQuery).WithArgs("default").WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(6))
+		mock.ExpectQuery(diskUsageQuery).WithArgs("cold").WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(1000, 1000))
+		mock.ExpectQuery(clickHouseUsageQuery).WithArgs("cold").WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(20))
+		// The part name is quoted into the query, so it is never sent if
+		// it is not valid.
+		mock.ExpectQuery(diskPartsQuery).WithArgs("", "", "flows", "default").WillReturnRows(
+			sqlmock.NewRows([]string{"name", "bytes_on_disk"}).AddRow("all'1_1_0", 2))
+		monitorMemory(db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 0, remainingRoundsNum)
+	})
+
+	t.Run("Delete records when the cold disk is above the threshold", func(t *testing.T) {
+		remainingRoundsNum = 0
+		baseTime := time.Now()
+		mock.ExpectQuery(diskUsageQuery).WithArgs("default").WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(8, 10))
+		mock.ExpectQuery(clickHouseUsageQuery).WithArgs("default").WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(2))
+		mock.ExpectQuery(diskUsageQuery).WithArgs("cold").WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(1000, 1000))
+		mock.ExpectQuery(clickHouseUsageQuery).WithArgs("cold").WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(60))
+		mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery(fmt.Sprintf(migrationInProgressQuery, "migration_status")).WithArgs(300).WillReturnRows(sqlmock.NewRows([]string{"inProgress"}).AddRow(0))
+		mock.ExpectQuery("SELECT COUNT() FROM flows").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+		mock.ExpectQuery("SELECT timeInserted FROM flows LIMIT 1 OFFSET (?)").WithArgs(4).WillReturnRows(
+			sqlmock.NewRows([]string{"timeInserted"}).AddRow(baseTime))
+		mock.ExpectQuery("SELECT MIN(timeInserted), COUNT() FROM flows WHERE timeInserted < ?").WithArgs(baseTime.UTC()).WillReturnError(fmt.Errorf("error in database"))
+		for _, table := range []string{"flows", "flows_pod_view", "flows_node_view", "flows_policy_view"} {
+			expectPartitions(mock, table, baseTime.UTC())
+			query := fmt.Sprintf("ALTER TABLE %s DELETE WHERE timeInserted < ?", table)
+			mock.ExpectExec(query).WithArgs(baseTime.UTC()).WillReturnResult(sqlmock.NewResult(0, 5))
+		}
+		monitorMemory(db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 3, remainingRoundsNum)
+	})
+}
+
+func TestMonitorPartitionedTables(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	initEnv()
+	mvNames = []string{"flows_pod_view"}
+	defer func() { maxPartitionsPerRun = 0 }()
+
+	expectDeletion := func(baseTime time.Time) {
+		mock.ExpectQuery(diskUsageQuery).WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(4, 10))
+		mock.ExpectQuery(clickHouseUsageQuery).WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(5))
+		mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery(fmt.Sprintf(migrationInProgressQuery, "migration_status")).WithArgs(300).WillReturnRows(sqlmock.NewRows([]string{"inProgress"}).AddRow(0))
+		mock.ExpectQuery("SELECT COUNT() FROM flows").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+		mock.ExpectQuery("SELECT timeInserted FROM flows LIMIT 1 OFFSET (?)").WithArgs(4).WillReturnRows(
+			sqlmock.NewRows([]string{"timeInserted"}).AddRow(baseTime))
+		mock.ExpectQuery("SELECT MIN(timeInserted), COUNT() FROM flows WHERE timeInserted < ?").WithArgs(baseTime.UTC()).WillReturnRows(
+			sqlmock.NewRows([]string{"MIN(timeInserted)", "COUNT()"}).AddRow(baseTime, 5))
+	}
+
+	t.Run("Drop the expired partitions", func(t *testing.T) {
+		remainingRoundsNum = 0
+		baseTime := time.Now()
+		expectDeletion(baseTime)
+		// The records of the partially expired partition are deleted
+		// after the fully expired ones are dropped.
+		expectPartitions(mock, "flows", baseTime.UTC(), "20230501", 1, "20230502", 1, "20230503", 0)
+		mock.ExpectExec("ALTER TABLE flows DROP PARTITION ID '20230501'").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ALTER TABLE flows DROP PARTITION ID '20230502'").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ALTER TABLE flows DELETE WHERE timeInserted < ?").WithArgs(baseTime.UTC()).WillReturnResult(sqlmock.NewResult(0, 5))
+		// No record has to be deleted once the partitions are dropped.
+		expectPartitions(mock, "flows_pod_view", baseTime.UTC(), "20230501", 1)
+		mock.ExpectExec("ALTER TABLE flows_pod_view DROP PARTITION ID '20230501'").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin().WillReturnError(fmt.Errorf("audit failure"))
+		monitorMemory(db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 3, remainingRoundsNum)
+	})
+
+	t.Run("Maximum partitions per run", func(t *testing.T) {
+		remainingRoundsNum = 0
+		maxPartitionsPerRun = 1
+		baseTime := time.Now()
+		expectDeletion(baseTime)
+		// The records are not deleted until all the expired partitions
+		// are dropped.
+		expectPartitions(mock, "flows", baseTime.UTC(), "20230501", 1, "20230502", 1, "20230503", 0)
+		mock.ExpectExec("ALTER TABLE flows DROP PARTITION ID '20230501'").WillReturnResult(sqlmock.NewResult(0, 0))
+		expectPartitions(mock, "flows_pod_view", baseTime.UTC())
+		mock.ExpectExec("ALTER TABLE flows_pod_view DELETE WHERE timeInserted < ?").WithArgs(baseTime.UTC()).WillReturnResult(sqlmock.NewResult(0, 5))
+		mock.ExpectBegin().WillReturnError(fmt.Errorf("audit failure"))
+		monitorMemory(db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 3, remainingRoundsNum)
+	})
+
+	t.Run("Failed to drop a partition", func(t *testing.T) {
+		remainingRoundsNum = 0
+		maxPartitionsPerRun = 0
+		baseTime := time.Now()
+		expectDeletion(baseTime)
+		expectPartitions(mock, "flows", baseTime.UTC(), "20230501", 1)
+		mock.ExpectExec("ALTER TABLE flows DROP PARTITION ID '20230501'").WillReturnError(fmt.Errorf("error in database"))
+		monitorMemory(db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 0, remainingRoundsNum)
+	})
+
+	t.Run("Invalid partition ID", func(t *testing.T) {
+		remainingRoundsNum = 0
+		baseTime := time.Now()
+		expectDeletion(baseTime)
+		// The partition ID is quoted into the query, so it is never sent
+		// if it is not valid.
+		expectPartitions(mock, "flows", baseTime.UTC(), "2023'0501", 1)
+		monitorMemory(db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 0, remainingRoundsNum)
+	})
+}
+
+func TestGetUsagePercentage(t *testing.T) {
+	usage := &replicaUsage{freeSpace: 4, usedSpace: 6}
+	assert.Equal(t, 0.6, getUsagePercentage(usage, 0))
+	assert.Equal(t, uint64(10), usage.totalSpace)
+	assert.Equal(t, 0.75, getUsagePercentage(usage, 8))
+	// The free space of an S3 disk is unlimited.
+	usage = &replicaUsage{freeSpace: math.MaxUint64, usedSpace: 6}
+	assert.Less(t, getUsagePercentage(usage, 0), 0.01)
+	assert.Equal(t, uint64(math.MaxUint64), usage.totalSpace)
+}
+
+func TestResolveLocalTables(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	tableName = "flows"
+	mvNames = []string{"default.flows_pod_view_local"}
+
+	mock.ExpectQuery(distributedTableQuery).WithArgs("", "", "flows").WillReturnRows(
+		sqlmock.NewRows([]string{"engine_full"}).AddRow("Distributed('{cluster}', 'default', 'flows_local', rand())"))
+	mock.ExpectQuery(distributedTableQuery).WithArgs("default", "default", "flows_pod_view_local").WillReturnRows(
+		sqlmock.NewRows([]string{"engine_full"}))
+	require.NoError(t, resolveLocalTables(db))
+	assert.Equal(t, "default.flows_local", tableName)
+	assert.Equal(t, []string{"default.flows_pod_view_local"}, mvNames)
+
+	mock.ExpectQuery(distributedTableQuery).WithArgs("", "", "flows").WillReturnRows(
+		sqlmock.NewRows([]string{"engine_full"}).AddRow("Distributed(flows_local)"))
+	tableName = "flows"
+	assert.ErrorContains(t, resolveLocalTables(db), "unexpected engine of Distributed table flows")
+
+	// The local table of a Distributed table which is not protected may be.
+	protectedTables = []string{"flows_protected_local"}
+	defer func() { protectedTables = nil }()
+	mock.ExpectQuery(distributedTableQuery).WithArgs("", "", "flows").WillReturnRows(
+		sqlmock.NewRows([]string{"engine_full"}).AddRow("Distributed('{cluster}', 'default', 'flows_protected_local', rand())"))
+	mock.ExpectQuery(distributedTableQuery).WithArgs("default", "default", "flows_pod_view_local").WillReturnRows(
+		sqlmock.NewRows([]string{"engine_full"}))
+	tableName = "flows"
+	assert.ErrorContains(t, resolveLocalTables(db), "table default.flows_protected_local is protected")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPprofHandler(t *testing.T) {
+	server := httptest.NewServer(newPprofHandler())
+	defer server.Close()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline"} {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRunMonitorWithPanics(t *testing.T) {
+	initEnv()
+	remainingRoundsNum = 0
+	oldRunUntil, oldExit, oldInitialPanicBackoff := runUntil, exit, initialPanicBackoff
+	defer func() {
+		runUntil, exit, initialPanicBackoff = oldRunUntil, oldExit, oldInitialPanicBackoff
+		consecutivePanics = 0
+	}()
+	initialPanicBackoff = time.Millisecond
+	rounds := 0
+	runUntil = func(f func(), period time.Duration, stopCh <-chan struct{}) {
+		for rounds = 0; rounds < maxConsecutivePanics; rounds++ {
+			f()
+		}
+	}
+	exitCode := -1
+	exit = func(code int) {
+		exitCode = code
+	}
+
+	// Every round panics with a nil connection.
+	runMonitor(nil, make(chan struct{}))
+	assert.Equal(t, maxConsecutivePanics, consecutivePanics)
+	assert.Equal(t, 1, exitCode)
+	expected := fmt.Sprintf(`
+# HELP theia_clickhouse_monitor_round_panics_total [ALPHA] Number of rounds of monitoring which panicked and were recovered.
+# TYPE theia_clickhouse_monitor_round_panics_total counter
+theia_clickhouse_monitor_round_panics_total %d
+`, maxConsecutivePanics)
+	assert.NoError(t, testutil.CollectAndCompare(roundPanics, strings.NewReader(expected), "theia_clickhouse_monitor_round_panics_total"))
+
+	// A successful round resets the number of consecutive panics.
+	remainingRoundsNum = 1
+	runUntil = func(f func(), period time.Duration, stopCh <-chan struct{}) {
+		f()
+	}
+	runMonitor(nil, make(chan struct{}))
+	assert.Equal(t, 0, consecutivePanics)
+
+	// roundMutex is not held while backing off after a panic.
+	initialPanicBackoff = time.Hour
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runMonitor(nil, stopCh)
+	}()
+	assert.Eventually(t, func() bool {
+		if !roundMutex.TryLock() {
+			return false
+		}
+		defer roundMutex.Unlock()
+		return consecutivePanics == 1
+	}, time.Second, 10*time.Millisecond)
+	close(stopCh)
+	<-done
+}
+
+func TestGetPanicBackoff(t *testing.T) {
+	assert.Equal(t, initialPanicBackoff, getPanicBackoff(1))
+	assert.Equal(t, 4*initialPanicBackoff, getPanicBackoff(3))
+	assert.Equal(t, maxPanicBackoff, getPanicBackoff(100))
+}
+
+func TestMetricsHandler(t *testing.T) {
+	server := httptest.NewServer(newMetricsHandler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"antrea.io/theia/pkg/util/format"
+)
+
+const (
+	// The formats of the payloads posted to the webhook: a JSON object with
+	// a text field, accepted by Slack incoming webhooks, or a list of alerts
+	// accepted by the API of Alertmanager, e.g. /api/v2/alerts.
+	webhookFormatSlack        = "slack"
+	webhookFormatAlertmanager = "alertmanager"
+	// Posting to the webhook times out after 10 seconds, so that a slow
+	// webhook does not delay the round of monitoring.
+	webhookTimeout = 10 * time.Second
+	// The events notified to the webhook.
+	thresholdExceededEvent = "ThresholdExceeded"
+	recordsDeletedEvent    = "RecordsDeleted"
+	recordsMovedEvent      = "RecordsMoved"
+)
+
+var (
+	// The URL of the webhook which the alerts are posted to. No alert is
+	// posted if it is empty.
+	webhookURL string
+	// The format of the payloads posted to the webhook.
+	webhookFormat string
+	// Whether the storage usage was above the threshold in the previous round,
+	// so that the webhook is notified when the threshold is crossed instead
+	// of in every round.
+	aboveThreshold bool
+	webhookClient  = &http.Client{Timeout: webhookTimeout}
+)
+
+// storageAlert describes the storage usage of ClickHouse above the threshold
+// and the action the monitor took.
+type storageAlert struct {
+	Event      string  `json:"event"`
+	Shard      string  `json:"shard,omitempty"`
+	Replica    string  `json:"replica,omitempty"`
+	UsedBytes  uint64  `json:"usedBytes"`
+	TotalBytes uint64  `json:"totalBytes"`
+	Usage      float64 `json:"usage"`
+	Threshold  float64 `json:"threshold"`
+	// Action describes what the monitor did about the usage, e.g. why the
+	// deletion of records was skipped.
+	Action   string         `json:"action"`
+	Deletion *deletionEvent `json:"deletion,omitempty"`
+}
+
+// deletionEvent describes the records deleted by the monitor.
+type deletionEvent struct {
+	Tables         []string  `json:"tables"`
+	RangeStart     time.Time `json:"rangeStart"`
+	RangeEnd       time.Time `json:"rangeEnd"`
+	RowCount       uint64    `json:"rowCount"`
+	BytesReclaimed uint64    `json:"bytesReclaimed"`
+}
+
+// slackPayload is the payload of the slack format, which includes the alert
+// for the receivers other than Slack, which ignores the unknown fields.
+type slackPayload struct {
+	Text string `json:"text"`
+	*storageAlert
+}
+
+// alertmanagerAlert is an alert of the Alertmanager API.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+}
+
+func loadWebhookEnvVariables() error {
+	webhookURL = getEnv("WEBHOOK_URL")
+	webhookFormat = getEnv("WEBHOOK_FORMAT")
+	if len(webhookURL) == 0 {
+		return nil
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid WEBHOOK_URL: it should be an http or https URL")
+	}
+	if len(webhookFormat) == 0 {
+		webhookFormat = webhookFormatSlack
+	}
+	if webhookFormat != webhookFormatSlack && webhookFormat != webhookFormatAlertmanager {
+		return fmt.Errorf("invalid WEBHOOK_FORMAT: it should be %s or %s", webhookFormatSlack, webhookFormatAlertmanager)
+	}
+	return nil
+}
+
+// text returns the summary of the alert, e.g. the text of a Slack message.
+func (a *storageAlert) text() string {
+	location := "ClickHouse"
+	if len(a.Shard) > 0 {
+		location = fmt.Sprintf("ClickHouse shard %s (replica %s)", a.Shard, a.Replica)
+	}
+	text := fmt.Sprintf("%s storage usage %s (%s of %s) is above threshold %s: %s",
+		location, format.Percentage(a.Usage*100), format.Bytes(a.UsedBytes), format.Bytes(a.TotalBytes), format.Percentage(a.Threshold*100), a.Action)
+	if a.Deletion != nil && a.Deletion.RowCount > 0 {
+		text += fmt.Sprintf(" (%d records inserted from %s to %s, about %s to be reclaimed)",
+			a.Deletion.RowCount, a.Deletion.RangeStart.UTC().Format(time.RFC3339), a.Deletion.RangeEnd.UTC().Format(time.RFC3339), format.Bytes(a.Deletion.BytesReclaimed))
+	}
+	return text
+}
+
+func (a *storageAlert) payload() interface{} {
+	if webhookFormat == webhookFormatAlertmanager {
+		labels := map[string]string{
+			"alertname": "ClickHouseStorage" + a.Event,
+			"severity":  "warning",
+		}
+		if len(a.Shard) > 0 {
+			labels["shard"] = a.Shard
+			labels["replica"] = a.Replica
+		}
+		return []alertmanagerAlert{{
+			Labels: labels,
+			Annotations: map[string]string{
+				"summary":   a.text(),
+				"usage":     format.Percentage(a.Usage * 100),
+				"threshold": format.Percentage(a.Threshold * 100),
+				"action":    a.Action,
+			},
+			StartsAt: time.Now().UTC(),
+		}}
+	}
+	return &slackPayload{Text: a.text(), storageAlert: a}
+}
+
+// notifyWebhook posts the alert to the webhook, if any. The alert is posted on
+// a best-effort basis: failures are only logged.
+func notifyWebhook(alert *storageAlert) {
+	if len(webhookURL) == 0 {
+		return
+	}
+	if err := postWebhook(alert); err != nil {
+		klog.ErrorS(err, "Failed to notify the webhook", "event", alert.Event)
+		return
+	}
+	klog.InfoS("Notified the webhook", "event", alert.Event)
+}
+
+func postWebhook(alert *storageAlert) error {
+	body, err := json.Marshal(alert.payload())
+	if err != nil {
+		return fmt.Errorf("error when encoding the payload: %v", err)
+	}
+	resp, err := webhookClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error includes the URL, which may include a token.
+		if urlErr, ok := err.(*url.Error); ok {
+			return fmt.Errorf("error when posting to the webhook: %v", urlErr.Err)
+		}
+		return fmt.Errorf("error when posting to the webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadWebhookEnvVariables(t *testing.T) {
+	testCases := []struct {
+		name           string
+		env            map[string]string
+		expectedFormat string
+		expectedError  string
+	}{
+		{
+			name: "no webhook",
+			env:  map[string]string{},
+		},
+		{
+			name:           "default format",
+			env:            map[string]string{"WEBHOOK_URL": "https://hooks.slack.com/services/T0/B0/X"},
+			expectedFormat: webhookFormatSlack,
+		},
+		{
+			name:           "alertmanager format",
+			env:            map[string]string{"WEBHOOK_URL": "http://alertmanager:9093/api/v2/alerts", "WEBHOOK_FORMAT": "alertmanager"},
+			expectedFormat: webhookFormatAlertmanager,
+		},
+		{
+			name:          "invalid URL",
+			env:           map[string]string{"WEBHOOK_URL": "alertmanager:9093"},
+			expectedError: "invalid WEBHOOK_URL: it should be an http or https URL",
+		},
+		{
+			name:          "invalid format",
+			env:           map[string]string{"WEBHOOK_URL": "http://alertmanager:9093/api/v2/alerts", "WEBHOOK_FORMAT": "email"},
+			expectedError: "invalid WEBHOOK_FORMAT: it should be slack or alertmanager",
+		},
+	}
+	defer func() { webhookURL, webhookFormat = "", "" }()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			getEnv = func(key string) string { return tc.env[key] }
+			err := loadWebhookEnvVariables()
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFormat, webhookFormat)
+		})
+	}
+}
+
+func TestMonitorMemoryWebhook(t *testing.T) {
+	var payloads []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		payloads = append(payloads, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	initEnv()
+	webhookURL, webhookFormat, aboveThreshold = server.URL, webhookFormatSlack, false
+	defer func() { webhookURL, webhookFormat, aboveThreshold = "", "", false }()
+
+	expectUsage := func(free uint64) {
+		mock.ExpectQuery(diskUsageQuery).WillReturnRows(sqlmock.NewRows([]string{"free_space", "total_space"}).AddRow(free, 10))
+		mock.ExpectQuery(clickHouseUsageQuery).WillReturnRows(sqlmock.NewRows([]string{"SUM(bytes)"}).AddRow(5))
+	}
+	expectPendingDeletions := func() {
+		expectUsage(4)
+		mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	}
+
+	// The webhook is notified once while the deletion is skipped.
+	expectPendingDeletions()
+	monitorMemory(db)
+	expectPendingDeletions()
+	monitorMemory(db)
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Len(t, payloads, 1)
+	var alert map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payloads[0]), &alert))
+	assert.Equal(t, "ThresholdExceeded", alert["event"])
+	assert.Equal(t, "ClickHouse storage usage 55.56 % (5.00 B of 9.00 B) is above threshold 50.00 %: records were not deleted as previous deletions are not completed", alert["text"])
+	assert.Equal(t, 5.0, alert["usedBytes"])
+	assert.Equal(t, 9.0, alert["totalBytes"])
+	assert.NotContains(t, alert, "deletion")
+
+	// The threshold is crossed again after the usage is below it.
+	expectUsage(6)
+	monitorMemory(db)
+	assert.False(t, aboveThreshold)
+
+	// The webhook is notified of every deletion, and a failure is only logged.
+	status = http.StatusInternalServerError
+	baseTime := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	expectUsage(4)
+	mock.ExpectQuery(pendingDeletionsQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(fmt.Sprintf(migrationInProgressQuery, "migration_status")).WithArgs(300).WillReturnRows(sqlmock.NewRows([]string{"inProgress"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT() FROM flows").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	mock.ExpectQuery("SELECT timeInserted FROM flows LIMIT 1 OFFSET (?)").WithArgs(4).WillReturnRows(sqlmock.NewRows([]string{"timeInserted"}).AddRow(baseTime.Add(5 * time.Second)))
+	mock.ExpectQuery("SELECT MIN(timeInserted), COUNT() FROM flows WHERE timeInserted < ?").WithArgs(baseTime.Add(5 * time.Second)).WillReturnRows(
+		sqlmock.NewRows([]string{"MIN(timeInserted)", "COUNT()"}).AddRow(baseTime, 5))
+	for _, table := range []string{"flows", "flows_pod_view", "flows_node_view", "flows_policy_view"} {
+		expectPartitions(mock, table, baseTime.Add(5*time.Second))
+		mock.ExpectExec(fmt.Sprintf("ALTER TABLE %s DELETE WHERE timeInserted < ?", table)).WithArgs(baseTime.Add(5 * time.Second)).WillReturnResult(sqlmock.NewResult(0, 5))
+	}
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("audit failure"))
+	monitorMemory(db)
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.Len(t, payloads, 2)
+	require.NoError(t, json.Unmarshal([]byte(payloads[1]), &alert))
+	assert.Equal(t, "RecordsDeleted", alert["event"])
+	assert.Equal(t, "ClickHouse storage usage 55.56 % (5.00 B of 9.00 B) is above threshold 50.00 %: old records were deleted (5 records inserted from 2023-05-01T10:00:00Z to 2023-05-01T10:00:05Z, about 2.00 B to be reclaimed)", alert["text"])
+	assert.Equal(t, map[string]interface{}{
+		"tables":         []interface{}{"flows", "flows_pod_view", "flows_node_view", "flows_policy_view"},
+		"rangeStart":     "2023-05-01T10:00:00Z",
+		"rangeEnd":       "2023-05-01T10:00:05Z",
+		"rowCount":       5.0,
+		"bytesReclaimed": 2.0,
+	}, alert["deletion"])
+	assert.Equal(t, 3, remainingRoundsNum)
+	remainingRoundsNum = 0
+}
+
+func TestAlertmanagerPayload(t *testing.T) {
+	webhookFormat = webhookFormatAlertmanager
+	defer func() { webhookFormat = "" }()
+	alert := &storageAlert{
+		Event:      thresholdExceededEvent,
+		Shard:      "1",
+		Replica:    "chi-clickhouse-clickhouse-0-1",
+		UsedBytes:  6 * 1024 * 1024,
+		TotalBytes: 10 * 1024 * 1024,
+		Usage:      0.6,
+		Threshold:  0.5,
+		Action:     "records were not deleted as the data schema is being migrated",
+	}
+	alerts, ok := alert.payload().([]alertmanagerAlert)
+	require.True(t, ok)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, map[string]string{
+		"alertname": "ClickHouseStorageThresholdExceeded",
+		"severity":  "warning",
+		"shard":     "1",
+		"replica":   "chi-clickhouse-clickhouse-0-1",
+	}, alerts[0].Labels)
+	assert.Equal(t, "ClickHouse shard 1 (replica chi-clickhouse-clickhouse-0-1) storage usage 60.00 % (6.00 MiB of 10.00 MiB) is above threshold 50.00 %: records were not deleted as the data schema is being migrated", alerts[0].Annotations["summary"])
+	assert.Equal(t, alert.Action, alerts[0].Annotations["action"])
+}
@@ -0,0 +1,364 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Timeout for reading the headers of the requests.
+	readHeaderTimeout = 10 * time.Second
+	// Maximum size of the body of a request which is read to check whether
+	// its query can be cached. Larger bodies, e.g. INSERT data, are proxied
+	// without being cached.
+	maxQuerySize = 1 << 20
+	// cacheHeader is set in the responses to tell whether they were served
+	// from the cache (HIT), cached (MISS) or not cacheable (BYPASS).
+	cacheHeader = "X-Theia-Query-Cache"
+)
+
+var (
+	getEnv = os.Getenv
+	// The URL of the HTTP interface of ClickHouse.
+	clickHouseURL *url.URL
+	// The address to serve the proxy on.
+	listenAddress string
+	// The duration for which the result of a query is cached.
+	cacheTTL time.Duration
+	// The maximum number of query results in the cache.
+	cacheMaxEntries int
+	// The maximum size in bytes of a cached query result. Larger results are
+	// not cached.
+	cacheMaxResultSize int64
+	// The address to serve the Prometheus metrics on. The metrics are not
+	// served if it is empty.
+	metricsAddress string
+	// cacheableQueryRegex matches the read-only queries whose results can be
+	// cached.
+	cacheableQueryRegex = regexp.MustCompile(`(?is)^\s*(SELECT|WITH)\b`)
+	// keyHeaders are the request headers which select the user, database and
+	// format of a query, and thus are part of the cache key.
+	keyHeaders = []string{"Authorization", "X-ClickHouse-User", "X-ClickHouse-Key", "X-ClickHouse-Database", "X-ClickHouse-Format", "Accept-Encoding"}
+	// cacheRequests counts the requests proxied to ClickHouse by result.
+	cacheRequests = metrics.NewCounterVec(&metrics.CounterOpts{
+		Namespace:      "theia",
+		Subsystem:      "clickhouse_query_cache",
+		Name:           "requests_total",
+		Help:           "Number of requests to ClickHouse, by cache result: hit, miss or bypass.",
+		StabilityLevel: metrics.ALPHA,
+	}, []string{"result"})
+)
+
+type cacheKeyContextKey struct{}
+
+func init() {
+	legacyregistry.MustRegister(cacheRequests)
+}
+
+func main() {
+	if err := loadEnvVariables(); err != nil {
+		klog.ErrorS(err, "Error when loading environment variables")
+		os.Exit(1)
+	}
+	if len(metricsAddress) > 0 {
+		go serve("metrics", metricsAddress, newMetricsHandler())
+	}
+	cache := newQueryCache(cacheTTL, cacheMaxEntries)
+	serve("query cache", listenAddress, newCachingProxy(clickHouseURL, cache, cacheMaxResultSize))
+	os.Exit(1)
+}
+
+// cachedResponse is the response of ClickHouse to a cacheable query.
+type cachedResponse struct {
+	key    string
+	header http.Header
+	body   []byte
+	expiry time.Time
+}
+
+// queryCache is a LRU cache of query results which expire after a TTL.
+type queryCache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	now        func() time.Time
+}
+
+func newQueryCache(ttl time.Duration, maxEntries int) *queryCache {
+	return &queryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// get returns the response cached for the key, if it has not expired.
+func (c *queryCache) get(key string) (*cachedResponse, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	response := element.Value.(*cachedResponse)
+	if !c.now().Before(response.expiry) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return response, true
+}
+
+// add caches a response for the key, evicting the least recently used
+// response if the cache is full.
+func (c *queryCache) add(key string, header http.Header, body []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	response := &cachedResponse{key: key, header: header, body: body, expiry: c.now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = response
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(response)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// cachingProxy proxies the requests to the HTTP interface of ClickHouse, and
+// serves the results of the read-only queries from the cache until they
+// expire.
+type cachingProxy struct {
+	cache         *queryCache
+	proxy         *httputil.ReverseProxy
+	maxResultSize int64
+}
+
+func newCachingProxy(target *url.URL, cache *queryCache, maxResultSize int64) *cachingProxy {
+	p := &cachingProxy{
+		cache:         cache,
+		proxy:         httputil.NewSingleHostReverseProxy(target),
+		maxResultSize: maxResultSize,
+	}
+	p.proxy.ModifyResponse = p.modifyResponse
+	return p
+}
+
+func (p *cachingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, err := getCacheKey(r)
+	if err != nil {
+		klog.ErrorS(err, "Error when reading the request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if key == "" {
+		cacheRequests.WithLabelValues("bypass").Inc()
+		w.Header().Set(cacheHeader, "BYPASS")
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	if response, ok := p.cache.get(key); ok {
+		cacheRequests.WithLabelValues("hit").Inc()
+		for name, values := range response.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(cacheHeader, "HIT")
+		w.Header().Set("Content-Length", strconv.Itoa(len(response.body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(response.body)
+		return
+	}
+	cacheRequests.WithLabelValues("miss").Inc()
+	w.Header().Set(cacheHeader, "MISS")
+	p.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cacheKeyContextKey{}, key)))
+}
+
+// modifyResponse records the successful response to a cacheable query while
+// it is proxied, and caches it once it has been entirely read.
+func (p *cachingProxy) modifyResponse(resp *http.Response) error {
+	key, _ := resp.Request.Context().Value(cacheKeyContextKey{}).(string)
+	if key == "" || resp.StatusCode != http.StatusOK || resp.Header.Get("X-ClickHouse-Exception-Code") != "" {
+		return nil
+	}
+	header := resp.Header.Clone()
+	resp.Body = &recordingBody{
+		ReadCloser:    resp.Body,
+		contentLength: resp.ContentLength,
+		limit:         p.maxResultSize,
+		onEOF: func(body []byte) {
+			p.cache.add(key, header, body)
+		},
+	}
+	return nil
+}
+
+// recordingBody records the body of a response up to a limit, and calls onEOF
+// with the body once it has been entirely read without exceeding the limit.
+// When the length of the body is known, the body is complete as soon as this
+// length is read, as the client may send its next request before the proxy
+// reads the end of the body.
+type recordingBody struct {
+	io.ReadCloser
+	contentLength int64
+	buffer        bytes.Buffer
+	limit         int64
+	overflow      bool
+	done          bool
+	onEOF         func(body []byte)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if int64(b.buffer.Len()+n) > b.limit {
+			b.overflow = true
+			b.buffer = bytes.Buffer{}
+		} else {
+			b.buffer.Write(p[:n])
+		}
+	}
+	complete := err == io.EOF || (b.contentLength >= 0 && int64(b.buffer.Len()) == b.contentLength)
+	if complete && !b.overflow && !b.done {
+		b.done = true
+		b.onEOF(b.buffer.Bytes())
+	}
+	return n, err
+}
+
+// getCacheKey returns the key of the result of the query of a request in the
+// cache, or an empty string if the query is not cacheable. The query of a
+// ClickHouse HTTP request is the concatenation of its query parameter and its
+// body, so the body is read, and restored for the proxy.
+func getCacheKey(r *http.Request) (string, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return "", nil
+	}
+	params := r.URL.Query()
+	// Queries of a session may depend on its temporary tables.
+	if params.Has("session_id") {
+		return "", nil
+	}
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxQuerySize+1))
+		if err != nil {
+			return "", fmt.Errorf("error when reading the request body: %v", err)
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if len(body) > maxQuerySize {
+			return "", nil
+		}
+	}
+	if !cacheableQueryRegex.MatchString(params.Get("query") + string(body)) {
+		return "", nil
+	}
+	hash := sha256.New()
+	write := func(s string) {
+		hash.Write([]byte(s))
+		hash.Write([]byte{0})
+	}
+	write(r.URL.Path)
+	write(params.Encode())
+	write(string(body))
+	for _, name := range keyHeaders {
+		write(r.Header.Get(name))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newMetricsHandler returns the handler of the Prometheus metrics of the
+// query cache, e.g. theia_clickhouse_query_cache_requests_total.
+func newMetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", legacyregistry.Handler())
+	return mux
+}
+
+func serve(name, address string, handler http.Handler) {
+	klog.InfoS("Serving endpoints", "name", name, "address", address)
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		klog.ErrorS(err, "Error when serving endpoints", "name", name, "address", address)
+	}
+}
+
+func loadEnvVariables() error {
+	clickHouseURLStr := getEnv("CLICKHOUSE_URL")
+	listenAddress = getEnv("LISTEN_ADDRESS")
+	cacheTTLStr := getEnv("CACHE_TTL")
+	cacheMaxEntriesStr := getEnv("CACHE_MAX_ENTRIES")
+	cacheMaxResultSizeStr := getEnv("CACHE_MAX_RESULT_SIZE")
+	metricsAddress = getEnv("METRICS_ADDRESS")
+
+	if len(clickHouseURLStr) == 0 || len(listenAddress) == 0 || len(cacheTTLStr) == 0 || len(cacheMaxEntriesStr) == 0 || len(cacheMaxResultSizeStr) == 0 {
+		return fmt.Errorf("unable to load environment variables, CLICKHOUSE_URL, LISTEN_ADDRESS, CACHE_TTL, CACHE_MAX_ENTRIES and CACHE_MAX_RESULT_SIZE must be defined")
+	}
+
+	var err error
+	clickHouseURL, err = url.Parse(clickHouseURLStr)
+	if err != nil || (clickHouseURL.Scheme != "http" && clickHouseURL.Scheme != "https") {
+		return fmt.Errorf("error when parsing CLICKHOUSE_URL: it should be a http or https URL")
+	}
+	cacheTTL, err = time.ParseDuration(cacheTTLStr)
+	if err != nil || cacheTTL <= 0 {
+		return fmt.Errorf("error when parsing CACHE_TTL: it should be a positive duration")
+	}
+	cacheMaxEntries, err = strconv.Atoi(cacheMaxEntriesStr)
+	if err != nil || cacheMaxEntries <= 0 {
+		return fmt.Errorf("error when parsing CACHE_MAX_ENTRIES: it should be a positive integer")
+	}
+	quantity, err := resource.ParseQuantity(cacheMaxResultSizeStr)
+	if err != nil {
+		return fmt.Errorf("error when parsing CACHE_MAX_RESULT_SIZE: %v", err)
+	}
+	cacheMaxResultSize = quantity.Value()
+	return nil
+}
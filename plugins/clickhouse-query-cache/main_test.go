@@ -0,0 +1,349 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClickHouse returns a fake ClickHouse HTTP interface, which answers
+// every query with the query itself and the user, and counts the queries.
+func newTestClickHouse(t *testing.T, queries *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(queries, 1)
+		body, _ := io.ReadAll(r.Body)
+		query := r.URL.Query().Get("query") + string(body)
+		if strings.Contains(query, "error") {
+			w.Header().Set("X-ClickHouse-Exception-Code", "62")
+			http.Error(w, "Code: 62. DB::Exception: Syntax error", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-ClickHouse-Format", "TabSeparated")
+		fmt.Fprintf(w, "%s\t%s\n", r.Header.Get("X-ClickHouse-User"), query)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doQuery(t *testing.T, proxyURL, method, user, query string) (string, string, int) {
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		req, err = http.NewRequest(method, proxyURL+"/?query="+url.QueryEscape(query), nil)
+	} else {
+		req, err = http.NewRequest(method, proxyURL+"/", strings.NewReader(query))
+	}
+	require.NoError(t, err)
+	req.Header.Set("X-ClickHouse-User", user)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body), resp.Header.Get(cacheHeader), resp.StatusCode
+}
+
+func TestCachingProxy(t *testing.T) {
+	var queries int32
+	clickHouse := newTestClickHouse(t, &queries)
+	target, err := url.Parse(clickHouse.URL)
+	require.NoError(t, err)
+	cache := newQueryCache(time.Minute, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	proxy := httptest.NewServer(newCachingProxy(target, cache, 128))
+	defer proxy.Close()
+
+	topTalkers := "SELECT sourcePodName, SUM(octetDeltaCount) FROM flows GROUP BY sourcePodName"
+	testCases := []struct {
+		name            string
+		method          string
+		user            string
+		query           string
+		advance         time.Duration
+		expectedBody    string
+		expectedCache   string
+		expectedStatus  int
+		expectedQueries int32
+	}{
+		{
+			name:            "First query is a miss",
+			method:          http.MethodGet,
+			user:            "grafana",
+			query:           topTalkers,
+			expectedBody:    "grafana\t" + topTalkers + "\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 1,
+		},
+		{
+			name:            "Same query is a hit",
+			method:          http.MethodGet,
+			user:            "grafana",
+			query:           topTalkers,
+			expectedBody:    "grafana\t" + topTalkers + "\n",
+			expectedCache:   "HIT",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 1,
+		},
+		{
+			name:            "Same query of another user is a miss",
+			method:          http.MethodGet,
+			user:            "readonly",
+			query:           topTalkers,
+			expectedBody:    "readonly\t" + topTalkers + "\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 2,
+		},
+		{
+			name:            "Query in the body is cached",
+			method:          http.MethodPost,
+			user:            "grafana",
+			query:           "WITH 1 AS x SELECT x",
+			expectedBody:    "grafana\tWITH 1 AS x SELECT x\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 3,
+		},
+		{
+			name:            "Cached query in the body is a hit",
+			method:          http.MethodPost,
+			user:            "grafana",
+			query:           "WITH 1 AS x SELECT x",
+			expectedBody:    "grafana\tWITH 1 AS x SELECT x\n",
+			expectedCache:   "HIT",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 3,
+		},
+		{
+			name:            "Insert is not cached",
+			method:          http.MethodPost,
+			user:            "grafana",
+			query:           "INSERT INTO ip_names VALUES ('10.0.0.1', 'svc', 'Service')",
+			expectedBody:    "grafana\tINSERT INTO ip_names VALUES ('10.0.0.1', 'svc', 'Service')\n",
+			expectedCache:   "BYPASS",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 4,
+		},
+		{
+			name:            "Failed query is not cached",
+			method:          http.MethodGet,
+			user:            "grafana",
+			query:           "SELECT error",
+			expectedBody:    "Code: 62. DB::Exception: Syntax error\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusBadRequest,
+			expectedQueries: 5,
+		},
+		{
+			name:            "Failed query is sent again",
+			method:          http.MethodGet,
+			user:            "grafana",
+			query:           "SELECT error",
+			expectedBody:    "Code: 62. DB::Exception: Syntax error\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusBadRequest,
+			expectedQueries: 6,
+		},
+		{
+			name:            "Result larger than the limit is not cached",
+			method:          http.MethodGet,
+			user:            "grafana",
+			query:           "SELECT " + strings.Repeat("x", 128),
+			expectedBody:    "grafana\tSELECT " + strings.Repeat("x", 128) + "\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 7,
+		},
+		{
+			name:            "Large result is sent again",
+			method:          http.MethodGet,
+			user:            "grafana",
+			query:           "SELECT " + strings.Repeat("x", 128),
+			expectedBody:    "grafana\tSELECT " + strings.Repeat("x", 128) + "\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 8,
+		},
+		{
+			name:            "Expired result is a miss",
+			method:          http.MethodGet,
+			user:            "grafana",
+			query:           topTalkers,
+			advance:         time.Minute,
+			expectedBody:    "grafana\t" + topTalkers + "\n",
+			expectedCache:   "MISS",
+			expectedStatus:  http.StatusOK,
+			expectedQueries: 9,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.advance)
+			body, cacheResult, status := doQuery(t, proxy.URL, tc.method, tc.user, tc.query)
+			assert.Equal(t, tc.expectedBody, body)
+			assert.Equal(t, tc.expectedCache, cacheResult)
+			assert.Equal(t, tc.expectedStatus, status)
+			assert.Equal(t, tc.expectedQueries, atomic.LoadInt32(&queries))
+		})
+	}
+}
+
+func TestQueryCacheEviction(t *testing.T) {
+	cache := newQueryCache(time.Minute, 2)
+	cache.add("a", nil, []byte("a"))
+	cache.add("b", nil, []byte("b"))
+	_, ok := cache.get("a")
+	assert.True(t, ok)
+	// b is the least recently used entry.
+	cache.add("c", nil, []byte("c"))
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+	response, ok := cache.get("a")
+	require.True(t, ok)
+	assert.Equal(t, []byte("a"), response.body)
+	_, ok = cache.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.lru.Len())
+}
+
+func TestGetCacheKey(t *testing.T) {
+	newRequest := func(method, target, body string) *http.Request {
+		return httptest.NewRequest(method, target, strings.NewReader(body))
+	}
+	key, err := getCacheKey(newRequest(http.MethodGet, "/?query=SELECT+1", ""))
+	require.NoError(t, err)
+	assert.NotEmpty(t, key)
+
+	otherKey, err := getCacheKey(newRequest(http.MethodGet, "/?query=SELECT+1&database=theia", ""))
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherKey)
+
+	key, err = getCacheKey(newRequest(http.MethodGet, "/?query=SELECT+1&session_id=abc", ""))
+	require.NoError(t, err)
+	assert.Empty(t, key)
+
+	key, err = getCacheKey(newRequest(http.MethodPost, "/?query=ALTER+TABLE+flows+DELETE+WHERE+1", ""))
+	require.NoError(t, err)
+	assert.Empty(t, key)
+
+	// The body of a request which is too large to be cached is restored.
+	largeBody := "SELECT " + strings.Repeat("x", maxQuerySize)
+	req := newRequest(http.MethodPost, "/", largeBody)
+	key, err = getCacheKey(req)
+	require.NoError(t, err)
+	assert.Empty(t, key)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, string(body))
+}
+
+func TestLoadEnvVariables(t *testing.T) {
+	defaultGetEnv := func(key string) string {
+		switch key {
+		case "CLICKHOUSE_URL":
+			return "http://clickhouse-clickhouse.flow-visibility.svc:8123"
+		case "LISTEN_ADDRESS":
+			return ":8124"
+		case "CACHE_TTL":
+			return "30s"
+		case "CACHE_MAX_ENTRIES":
+			return "1000"
+		case "CACHE_MAX_RESULT_SIZE":
+			return "10Mi"
+		default:
+			return ""
+		}
+	}
+	withEnv := func(name, value string) func(key string) string {
+		return func(key string) string {
+			if key == name {
+				return value
+			}
+			return defaultGetEnv(key)
+		}
+	}
+	testCases := []struct {
+		name          string
+		getEnv        func(key string) string
+		expectedError string
+	}{
+		{
+			name:   "valid variables",
+			getEnv: defaultGetEnv,
+		},
+		{
+			name:          "missing variable",
+			getEnv:        withEnv("CACHE_TTL", ""),
+			expectedError: "unable to load environment variables",
+		},
+		{
+			name:          "invalid URL",
+			getEnv:        withEnv("CLICKHOUSE_URL", "tcp://clickhouse-clickhouse:9000"),
+			expectedError: "error when parsing CLICKHOUSE_URL",
+		},
+		{
+			name:          "invalid TTL",
+			getEnv:        withEnv("CACHE_TTL", "-1s"),
+			expectedError: "error when parsing CACHE_TTL",
+		},
+		{
+			name:          "invalid max entries",
+			getEnv:        withEnv("CACHE_MAX_ENTRIES", "0"),
+			expectedError: "error when parsing CACHE_MAX_ENTRIES",
+		},
+		{
+			name:          "invalid max result size",
+			getEnv:        withEnv("CACHE_MAX_RESULT_SIZE", "ten"),
+			expectedError: "error when parsing CACHE_MAX_RESULT_SIZE",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			getEnv = tc.getEnv
+			err := loadEnvVariables()
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "clickhouse-clickhouse.flow-visibility.svc:8123", clickHouseURL.Host)
+				assert.Equal(t, 30*time.Second, cacheTTL)
+				assert.Equal(t, 1000, cacheMaxEntries)
+				assert.Equal(t, int64(10<<20), cacheMaxResultSize)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	server := httptest.NewServer(newMetricsHandler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
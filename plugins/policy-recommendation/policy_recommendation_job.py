@@ -52,6 +52,13 @@ FLOW_TABLE_COLUMNS = [
     'flowType',
 ]
 
+# The conditions selecting the unprotected flows from the flow records, and
+# from the flows aggregated beforehand by the Theia Manager, which records if
+# the flows are unprotected.
+UNPROTECTED_CONDITION = "ingressNetworkPolicyName == '' \
+AND egressNetworkPolicyName == ''"
+PREAGGREGATED_UNPROTECTED_CONDITION = "unprotected == 1"
+
 NAMESPACE_ALLOW_LIST = [
     "kube-system",
     "flow-aggregator",
@@ -68,6 +75,12 @@ MEANINGLESS_LABELS = [
     "pod-template-generation",
 ]
 broadcast_ns_allow_list = None
+# The workload the recommendation is restricted to, as a dict with the
+# namespace and the podLabels of its Pods, or None.
+broadcast_workload = None
+# The evidence of the recommended rules, as returned by compute_rule_evidence,
+# or None.
+broadcast_rule_evidence = None
 
 logger = logging.getLogger("policy_recommendation")
 logger.setLevel(logging.INFO)
@@ -79,6 +92,23 @@ formatter = logging.Formatter(
 ch.setFormatter(formatter)
 logger.addHandler(ch)
 
+# The correlation ID of the job, set by the Theia Manager to trace the job
+# across the logs of the Theia components and the query log of ClickHouse.
+correlation_id = ""
+
+
+def set_correlation_id(value):
+    # The correlation ID is added to the logs of the job, and is the
+    # log_comment of its ClickHouse queries.
+    global correlation_id
+    correlation_id = value
+    ch.setFormatter(
+        logging.Formatter(
+            "%(asctime)s - %(name)s - %(levelname)s - correlation_id={} - "
+            "%(message)s".format(value)
+        )
+    )
+
 
 def get_flow_type(flowType, destinationServicePortName, destinationPodLabels):
     if flowType == 3:
@@ -107,6 +137,32 @@ def remove_meaningless_labels(podLabels):
     return json.dumps(labels_dict, sort_keys=True)
 
 
+def is_workload_applied_to(ns, labels, workload):
+    """
+    Check whether policies applied to the Pods of Namespace ns with the
+    labels, in json format, apply to the workload, i.e. whether these Pods
+    have all the labels of the Pods of the workload. Every policy applies to
+    the workload if it is None.
+    """
+    if not workload:
+        return True
+    if ns != workload["namespace"]:
+        return False
+    try:
+        labels_dict = json.loads(labels)
+    except Exception:
+        return False
+    return all(
+        labels_dict.get(key) == value
+        for key, value in workload["podLabels"].items()
+    )
+
+
+def applies_to_workload(ns, labels):
+    workload = broadcast_workload.value if broadcast_workload else None
+    return is_workload_applied_to(ns, labels, workload)
+
+
 def get_protocol_string(protocolIdentifier):
     if protocolIdentifier == 6:
         return "TCP"
@@ -250,6 +306,120 @@ def generate_policy_name(info):
     )
 
 
+def format_flow_count(count):
+    # Format a number of flow records, e.g. 1.2k for 1234.
+    for divisor, unit in [(1000000000, "G"), (1000000, "M"), (1000, "k")]:
+        if count >= divisor:
+            value = "{:.1f}".format(count / divisor)
+            if value.endswith(".0"):
+                value = value[:-2]
+            return value + unit
+    return str(count)
+
+
+def format_duration(first_seen, last_seen):
+    seconds = int((last_seen - first_seen).total_seconds())
+    for divisor, unit in [(86400, "d"), (3600, "h"), (60, "m")]:
+        if seconds >= divisor:
+            return "{}{}".format(seconds // divisor, unit)
+    return "{}s".format(max(seconds, 0))
+
+
+def describe_pods(ns, labels):
+    try:
+        labels_dict = json.loads(labels)
+    except Exception:
+        labels_dict = {}
+    if not labels_dict:
+        return ns
+    return "{}/{}".format(
+        ns,
+        ",".join(
+            "{}={}".format(key, value)
+            for key, value in sorted(labels_dict.items())
+        ),
+    )
+
+
+def describe_peer(peer):
+    # Describe a peer mapped from a flow, and its port if any.
+    fields = peer.split(ROW_DELIMITER)
+    if len(fields) == 4:
+        ns, labels, port, protocol = fields
+        return describe_pods(ns, labels), "{}/{}".format(port, protocol)
+    if len(fields) == 3:
+        address, port, protocol = fields
+        try:
+            get_IP_version(address)
+        except ValueError:
+            # The port name of a Service
+            address = "Service {}".format(address.partition(":")[0])
+        return address, "{}/{}".format(port, protocol)
+    return "Service {}".format("/".join(fields)), ""
+
+
+def get_rule_comment(direction, applied_to, peer):
+    """
+    Get the comment summarizing the evidence of a rule allowing the traffic
+    from or to the peer, in the given direction, for the Pods of applied_to,
+    or an empty string if there is no evidence of the rule.
+    """
+    if not broadcast_rule_evidence:
+        return ""
+    evidence = broadcast_rule_evidence.value.get(
+        (direction, applied_to, peer)
+    )
+    if not evidence:
+        return ""
+    flows, first_seen, last_seen = evidence
+    pods = describe_pods(*applied_to.split(ROW_DELIMITER))
+    peer, port = describe_peer(peer)
+    if direction == "ingress":
+        source, destination = peer, pods
+    else:
+        source, destination = pods, peer
+    comment = "Observed {} flow records over {} from {} to {}".format(
+        format_flow_count(flows),
+        format_duration(first_seen, last_seen),
+        source,
+        destination,
+    )
+    if port:
+        comment += " on port {}".format(port)
+    return comment
+
+
+def annotate_rules(policy_yaml, rule_comments):
+    """
+    Add a comment before every rule of a policy in YAML format.
+
+    Args:
+        policy_yaml: The policy, as returned by dict_to_yaml.
+        rule_comments: A dict mapping "ingress" and "egress" to the comments
+                       of the rules of the spec, in the same order. The empty
+                       comments are skipped.
+
+    Returns:
+        The policy in YAML format with the comments.
+    """
+    lines = []
+    comments = []
+    for line in policy_yaml.splitlines(keepends=True):
+        if not line.startswith(" "):
+            comments = []
+        elif not line.startswith("   "):
+            if line.startswith("  - "):
+                # An item of the list of a field of the spec
+                comment = comments.pop(0) if comments else ""
+                if comment:
+                    lines.append("  # {}\n".format(comment))
+            else:
+                field = line.strip().rstrip(":")
+                comments = list(rule_comments.get(field, []))
+        lines.append(line)
+    return "".join(lines)
+
+
 def generate_k8s_np(x):
     applied_to, (ingresses, egresses) = x
     ns, labels = applied_to.split(ROW_DELIMITER)
@@ -259,16 +429,26 @@ def generate_k8s_np(x):
     else:
         if ns in NAMESPACE_ALLOW_LIST:
             return []
+    if not applies_to_workload(ns, labels):
+        return []
     ingress_list = list(set(ingresses.split(PEER_DELIMITER)))
     egress_list = list(set(egresses.split(PEER_DELIMITER)))
     egressRules = []
+    egress_comments = []
     for egress in egress_list:
         if ROW_DELIMITER in egress:
             egressRules.append(generate_k8s_egress_rule(egress))
+            egress_comments.append(
+                get_rule_comment("egress", applied_to, egress)
+            )
     ingressRules = []
+    ingress_comments = []
     for ingress in ingress_list:
         if ROW_DELIMITER in ingress:
             ingressRules.append(generate_k8s_ingress_rule(ingress))
+            ingress_comments.append(
+                get_rule_comment("ingress", applied_to, ingress)
+            )
     if egressRules or ingressRules:
         policy_types = []
         if egressRules:
@@ -291,7 +471,12 @@ def generate_k8s_np(x):
                 policy_types=policy_types,
             ),
         )
-        return [dict_to_yaml(np.to_dict())]
+        return [
+            annotate_rules(
+                dict_to_yaml(np.to_dict()),
+                {"ingress": ingress_comments, "egress": egress_comments},
+            )
+        ]
     else:
         return []
 
@@ -397,6 +582,8 @@ def generate_anp(network_peers):
     else:
         if ns in NAMESPACE_ALLOW_LIST:
             return []
+    if not applies_to_workload(ns, labels):
+        return []
     try:
         labels_dict = json.loads(labels)
     except Exception as e:
@@ -410,17 +597,25 @@ def generate_anp(network_peers):
     ingress_list = list(set(ingresses.split(PEER_DELIMITER)))
     egress_list = list(set(egresses.split(PEER_DELIMITER)))
     egressRules = []
+    egress_comments = []
     for egress in egress_list:
         if ROW_DELIMITER in egress:
             egress_rule = generate_anp_egress_rule(egress)
             if egress_rule:
                 egressRules.append(egress_rule)
+                egress_comments.append(
+                    get_rule_comment("egress", applied_to, egress)
+                )
     ingressRules = []
+    ingress_comments = []
     for ingress in ingress_list:
         if ROW_DELIMITER in ingress:
             ingress_rule = generate_anp_ingress_rule(ingress)
             if ingress_rule:
                 ingressRules.append(ingress_rule)
+                ingress_comments.append(
+                    get_rule_comment("ingress", applied_to, ingress)
+                )
     if egressRules or ingressRules:
         np_name = generate_policy_name("recommend-allow-anp")
         np = antrea_crd.NetworkPolicy(
@@ -444,7 +639,12 @@ def generate_anp(network_peers):
                 ingress=ingressRules,
             ),
         )
-        return [dict_to_yaml(np.to_dict())]
+        return [
+            annotate_rules(
+                dict_to_yaml(np.to_dict()),
+                {"ingress": ingress_comments, "egress": egress_comments},
+            )
+        ]
     return []
 
 
@@ -506,6 +706,8 @@ def generate_svc_acnp(x):
     else:
         if ns in NAMESPACE_ALLOW_LIST:
             return []
+    if not applies_to_workload(ns, labels):
+        return []
     try:
         labels_dict = json.loads(labels)
     except Exception as e:
@@ -518,8 +720,10 @@ def generate_svc_acnp(x):
         return []
     egress_list = egresses.split(PEER_DELIMITER)
     egressRules = []
+    egress_comments = []
     for egress in egress_list:
         egressRules.append(generate_acnp_svc_egress_rule(egress))
+        egress_comments.append(get_rule_comment("egress", applied_to, egress))
     if egressRules:
         np_name = generate_policy_name("recommend-svc-allow-acnp")
         np = antrea_crd.ClusterNetworkPolicy(
@@ -544,7 +748,11 @@ def generate_svc_acnp(x):
                 egress=egressRules,
             ),
         )
-        return [dict_to_yaml(np.to_dict())]
+        return [
+            annotate_rules(
+                dict_to_yaml(np.to_dict()), {"egress": egress_comments}
+            )
+        ]
     else:
         return []
 
@@ -565,6 +773,8 @@ def generate_reject_acnp(applied_to):
         else:
             if ns in NAMESPACE_ALLOW_LIST:
                 return []
+        if not applies_to_workload(ns, labels):
+            return []
         try:
             labels_dict = json.loads(labels)
         except Exception as e:
@@ -782,13 +992,189 @@ def recommend_policies_for_ns_allow_list(ns_allow_list):
     return {antrea_crd.PolicyKind.ACNP: policies}
 
 
-def generate_sql_query(table_name, limit, start_time, end_time, unprotected):
-    sql_query = "SELECT {} FROM {}".format(
-        ", ".join(FLOW_TABLE_COLUMNS), table_name
+def get_flow_rules(flow, option=1, to_services=True):
+    """
+    Get the egress and ingress rules required to allow a flow, as (appliedTo,
+    peer) tuples mapped the same way as when recommending the policies. The
+    ingress rule is None for Pod-to-External flows.
+    """
+    if flow.flowType == "pod_to_svc" and option != 3 and not to_services:
+        egress = map_flow_to_egress_svc(flow)
+    else:
+        applied_to, (_, peer) = map_flow_to_egress(flow, k8s=option == 3)
+        egress = (applied_to, peer)
+    ingress = None
+    if flow.flowType != "pod_to_external":
+        applied_to, (peer, _) = map_flow_to_ingress(flow)
+        ingress = (applied_to, peer)
+    return egress, ingress
+
+
+def is_flow_matched(flow, rules, ns_allow_list, option=1, to_services=True):
+    """
+    Check whether a flow is allowed by the recommended rules, or by the allow
+    policies of the Namespaces of ns_allow_list, on both its egress and
+    ingress sides.
+    """
+    egress, ingress = get_flow_rules(flow, option, to_services)
+    if flow.sourcePodNamespace not in ns_allow_list and egress not in rules:
+        return False
+    if (
+        ingress
+        and flow.destinationPodNamespace not in ns_allow_list
+        and ingress not in rules
+    ):
+        return False
+    return True
+
+
+def compute_recommendation_coverage(
+    recommended_flows_df,
+    flows_df,
+    ns_allow_list,
+    option=1,
+    to_services=True,
+):
+    """
+    Compute the coverage of the recommended policies.
+
+    Args:
+        recommended_flows_df: The flows the policies were recommended for.
+        flows_df: All the unprotected flows of the time range of the
+                  recommendation, with the number of flow records of every
+                  flow in the flowCount column.
+        ns_allow_list: List of default traffic allow namespaces.
+        option: Option of network isolation preference in policy
+                recommendation.
+        to_services: Use the toServices feature in ANP.
+
+    Returns:
+        A sorted list of (namespace, matched flows, unmatched flows) tuples.
+        The flows are counted in the Namespace of their source Pod, or of
+        their destination Pod if the source is not a Pod. Flows may be
+        unmatched because of the limit on the number of flow records read,
+        or because the labels of their Pods were deduplicated.
+    """
+    rules = set(
+        recommended_flows_df.rdd.flatMap(
+            lambda flow: get_flow_rules(flow, option, to_services)
+        )
+        .filter(lambda rule: rule is not None)
+        .distinct()
+        .collect()
+    )
+
+    def map_flow_to_coverage(flow):
+        namespace = flow.sourcePodNamespace or flow.destinationPodNamespace
+        if is_flow_matched(flow, rules, ns_allow_list, option, to_services):
+            return (namespace, (flow.flowCount, 0))
+        return (namespace, (0, flow.flowCount))
+
+    coverage = (
+        flows_df.rdd.map(map_flow_to_coverage)
+        .reduceByKey(lambda a, b: (a[0] + b[0], a[1] + b[1]))
+        .collect()
+    )
+    return sorted(
+        (namespace, matched, unmatched)
+        for namespace, (matched, unmatched) in coverage
+    )
+
+
+def merge_rule_evidence(a, b):
+    return (a[0] + b[0], min(a[1], b[1]), max(a[2], b[2]))
+
+
+def compute_rule_evidence(flows_df, option=1, to_services=True):
+    """
+    Compute the evidence of the rules allowing the flows, to explain the
+    recommended rules.
+
+    Args:
+        flows_df: The flows, with the number of flow records of every flow in
+                  the flowCount column, and the start time of the first and
+                  the end time of the last flow record in the firstSeen and
+                  lastSeen columns.
+        option: Option of network isolation preference in policy
+                recommendation.
+        to_services: Use the toServices feature in ANP.
+
+    Returns:
+        A dict mapping the (direction, appliedTo, peer) tuples of the rules,
+        as returned by get_flow_rules, to the number of flow records they
+        allow and the time range these flow records were observed in.
+    """
+    def map_flow_to_evidence(flow):
+        egress, ingress = get_flow_rules(flow, option, to_services)
+        evidence = (flow.flowCount, flow.firstSeen, flow.lastSeen)
+        result = [(("egress",) + egress, evidence)]
+        if ingress:
+            result.append((("ingress",) + ingress, evidence))
+        return result
+
+    return dict(
+        flows_df.rdd.flatMap(map_flow_to_evidence)
+        .reduceByKey(merge_rule_evidence)
+        .collect()
     )
+
+
+def set_rule_evidence(spark, evidence):
+    global broadcast_rule_evidence
+    if broadcast_rule_evidence:
+        broadcast_rule_evidence.unpersist()
+    broadcast_rule_evidence = spark.sparkContext.broadcast(evidence)
+
+
+def generate_workload_condition(workload):
+    """
+    Generate the SQL condition selecting the flows whose source or
+    destination is a Pod of the workload.
+    """
+    def escape(value):
+        return value.replace("\\", "\\\\").replace("'", "\\'")
+
+    conditions = []
+    for prefix in ["source", "destination"]:
+        pod_conditions = ["{}PodNamespace = '{}'".format(
+            prefix, escape(workload["namespace"])
+        )]
+        for key, value in sorted(workload["podLabels"].items()):
+            pod_conditions.append(
+                "JSONExtractString({}PodLabels, '{}') = '{}'".format(
+                    prefix, escape(key), escape(value)
+                )
+            )
+        conditions.append("({})".format(" AND ".join(pod_conditions)))
+    return "({})".format(" OR ".join(conditions))
+
+
+def generate_sql_query(
+    table_name,
+    limit,
+    start_time,
+    end_time,
+    unprotected,
+    count_flows=False,
+    workload=None,
+    preaggregated=False,
+):
+    columns = ", ".join(FLOW_TABLE_COLUMNS)
+    if count_flows:
+        # Count the flow records of every distinct flow, and get the time
+        # range they were observed in
+        if preaggregated:
+            columns += ", sum(flowRecords) AS flowCount"
+        else:
+            columns += ", count() AS flowCount"
+        columns += ", min(flowStartSeconds) AS firstSeen, \
+max(flowEndSeconds) AS lastSeen"
+    sql_query = "SELECT {} FROM {}".format(columns, table_name)
     if unprotected:
-        sql_query += " WHERE ingressNetworkPolicyName == '' \
-AND egressNetworkPolicyName == ''"
+        sql_query += " WHERE {}".format(
+            PREAGGREGATED_UNPROTECTED_CONDITION if preaggregated
+            else UNPROTECTED_CONDITION
+        )
     else:
         # Select user trusted denied flows when unprotected equals False
         sql_query += " WHERE trusted == 1"
@@ -796,38 +1182,145 @@ AND egressNetworkPolicyName == ''"
         sql_query += " AND flowStartSeconds >= '{}'".format(start_time)
     if end_time:
         sql_query += " AND flowEndSeconds < '{}'".format(end_time)
+    if workload:
+        sql_query += " AND {}".format(generate_workload_condition(workload))
     sql_query += " GROUP BY {}".format(", ".join(FLOW_TABLE_COLUMNS))
     if limit:
         sql_query += " LIMIT {}".format(limit)
     return sql_query
 
 
-def read_flow_df(spark, db_jdbc_address, sql_query, rm_labels):
+def generate_data_window_query(
+    table_name,
+    start_time,
+    end_time,
+    include_trusted=False,
+    workload=None,
+    preaggregated=False,
+):
+    # The window, the number of flow records and the Nodes of the flows
+    # analyzed by the job, whatever the limit.
+    if preaggregated:
+        flows = "sum(flowRecords)"
+        node_names = "nodeNames"
+        unprotected = PREAGGREGATED_UNPROTECTED_CONDITION
+    else:
+        flows = "count()"
+        node_names = "[sourceNodeName, destinationNodeName]"
+        unprotected = UNPROTECTED_CONDITION
+    sql_query = "SELECT toString(min(flowStartSeconds)) AS minFlowTime, \
+toString(max(flowEndSeconds)) AS maxFlowTime, {} AS flows, \
+arrayStringConcat(arraySort(arrayFilter(x -> x != '', \
+groupUniqArrayArray({}))), ',') AS nodes FROM {}".format(
+        flows, node_names, table_name
+    )
+    if include_trusted:
+        sql_query += " WHERE (({}) OR trusted == 1)".format(unprotected)
+    else:
+        sql_query += " WHERE {}".format(unprotected)
+    if start_time:
+        sql_query += " AND flowStartSeconds >= '{}'".format(start_time)
+    if end_time:
+        sql_query += " AND flowEndSeconds < '{}'".format(end_time)
+    if workload:
+        sql_query += " AND {}".format(generate_workload_condition(workload))
+    return sql_query
+
+
+def get_jdbc_tls_options():
+    # The options of the ClickHouse JDBC driver to connect over TLS with the
+    # client certificate mounted by the Theia Manager, empty if TLS is
+    # disabled.
+    cert_file = os.getenv("CH_TLS_CERT_FILE")
+    if not cert_file:
+        return {}
+    options = {
+        "ssl": "true",
+        "sslcert": cert_file,
+        "sslkey": os.getenv("CH_TLS_KEY_FILE"),
+    }
+    if os.getenv("CH_TLS_INSECURE_SKIP_VERIFY", "").lower() == "true":
+        options["sslmode"] = "none"
+        return options
+    options["sslmode"] = "strict"
+    ca_file = os.getenv("CH_TLS_CA_FILE")
+    if ca_file and os.path.exists(ca_file):
+        options["sslrootcert"] = ca_file
+    return options
+
+
+def get_jdbc_options():
+    # The options of the ClickHouse JDBC driver: the TLS options, and the
+    # correlation ID of the job as the log_comment setting of its queries,
+    # which the driver sends as a parameter of its HTTP requests.
+    options = get_jdbc_tls_options()
+    if correlation_id:
+        options["custom_http_params"] = "log_comment={}".format(
+            correlation_id
+        )
+    return options
+
+
+def read_data_window(
+    spark,
+    db_jdbc_address,
+    table_name,
+    start_time,
+    end_time,
+    include_trusted=False,
+    workload=None,
+    preaggregated=False,
+):
+    sql_query = generate_data_window_query(
+        table_name, start_time, end_time, include_trusted, workload,
+        preaggregated
+    )
+    row = (
+        spark.read.format("jdbc")
+        .option("driver", "ru.yandex.clickhouse.ClickHouseDriver")
+        .option("url", db_jdbc_address)
+        .options(**get_jdbc_options())
+        .option("user", os.getenv("CH_USERNAME"))
+        .option("password", os.getenv("CH_PASSWORD"))
+        .option("query", sql_query)
+        .load()
+        .collect()[0]
+    )
+    return {
+        "minFlowTime": row.minFlowTime,
+        "maxFlowTime": row.maxFlowTime,
+        "flows": row.flows,
+        "nodes": row.nodes,
+    }
+
+
+def read_flow_df(
+    spark, db_jdbc_address, sql_query, rm_labels, drop_duplicates=True
+):
     flow_df = (
         spark.read.format("jdbc")
         .option("driver", "ru.yandex.clickhouse.ClickHouseDriver")
         .option("url", db_jdbc_address)
+        .options(**get_jdbc_options())
         .option("user", os.getenv("CH_USERNAME"))
         .option("password", os.getenv("CH_PASSWORD"))
         .option("query", sql_query)
         .load()
     )
     if rm_labels:
-        flow_df = (
-            flow_df.withColumn(
-                "sourcePodLabels",
-                udf(remove_meaningless_labels, StringType())(
-                    "sourcePodLabels"
-                ),
-            )
-            .withColumn(
-                "destinationPodLabels",
-                udf(remove_meaningless_labels, StringType())(
-                    "destinationPodLabels"
-                ),
-            )
-            .dropDuplicates(["sourcePodLabels", "destinationPodLabels"])
+        flow_df = flow_df.withColumn(
+            "sourcePodLabels",
+            udf(remove_meaningless_labels, StringType())("sourcePodLabels"),
+        ).withColumn(
+            "destinationPodLabels",
+            udf(remove_meaningless_labels, StringType())(
+                "destinationPodLabels"
+            ),
         )
+        if drop_duplicates:
+            flow_df = flow_df.dropDuplicates(
+                ["sourcePodLabels", "destinationPodLabels"]
+            )
     flow_df = flow_df.withColumn(
         "flowType",
         udf(get_flow_type, StringType())(
@@ -837,6 +1330,31 @@ def read_flow_df(spark, db_jdbc_address, sql_query, rm_labels):
     return flow_df
 
 
+def count_recommended_policies(result):
+    return sum(1 for value in result.values() for item in value if item)
+
+
+def get_empty_result_reason(result, data_window, workload=None):
+    # The reason is stored with the data window of a job which recommended
+    # no policy, so that its empty result is not mistaken for a failure.
+    if count_recommended_policies(result) > 0:
+        return ""
+    target = "of the workload " if workload else ""
+    flows = data_window["flows"] if data_window else 0
+    if flows == 0:
+        return (
+            "No flow record {}was found in the time range of the "
+            "job".format(target)
+        )
+    return (
+        "None of the {} flow records {}found in the time range of the job "
+        "requires a new policy, e.g. they are in the Namespaces of the "
+        "allow list or already allowed by the existing policies".format(
+            flows, target
+        )
+    )
+
+
 def write_recommendation_result(
     spark,
     result,
@@ -864,10 +1382,16 @@ def write_recommendation_result(
                     "kind": key,
                 }
                 result_dict_list.append(result_dict)
+    # A DataFrame cannot be created from an empty list, and there is nothing
+    # to write for a job which recommended no policy.
+    if not result_dict_list:
+        return recommendation_id
     result_df = spark.createDataFrame(result_dict_list)
     result_df.write.mode("append").format("jdbc").option(
         "driver", "ru.yandex.clickhouse.ClickHouseDriver"
-    ).option("url", db_jdbc_address).option(
+    ).option("url", db_jdbc_address).options(
+        **get_jdbc_options()
+    ).option(
         "user", os.getenv("CH_USERNAME")
     ).option(
         "password", os.getenv("CH_PASSWORD")
@@ -877,6 +1401,97 @@ def write_recommendation_result(
     return recommendation_id
 
 
+def write_recommendation_coverage(
+    spark,
+    coverage,
+    db_jdbc_address,
+    table_name,
+    recommendation_id,
+):
+    if not coverage:
+        return
+    time_created = datetime.datetime.now().strftime("%Y-%m-%d %H:%M:%S")
+    coverage_dict_list = [
+        {
+            "id": recommendation_id,
+            "namespace": namespace,
+            "matchedFlows": matched,
+            "unmatchedFlows": unmatched,
+            "timeCreated": time_created,
+        }
+        for namespace, matched, unmatched in coverage
+    ]
+    coverage_df = spark.createDataFrame(coverage_dict_list)
+    coverage_df.write.mode("append").format("jdbc").option(
+        "driver", "ru.yandex.clickhouse.ClickHouseDriver"
+    ).option("url", db_jdbc_address).options(
+        **get_jdbc_options()
+    ).option(
+        "user", os.getenv("CH_USERNAME")
+    ).option(
+        "password", os.getenv("CH_PASSWORD")
+    ).option(
+        "dbtable", table_name
+    ).save()
+
+
+def write_recommendation_data_window(
+    spark,
+    data_window,
+    db_jdbc_address,
+    table_name,
+    recommendation_id,
+):
+    if not data_window:
+        return
+    data_window_dict = dict(data_window)
+    data_window_dict["id"] = recommendation_id
+    data_window_dict["timeCreated"] = datetime.datetime.now().strftime(
+        "%Y-%m-%d %H:%M:%S"
+    )
+    data_window_df = spark.createDataFrame([data_window_dict])
+    data_window_df.write.mode("append").format("jdbc").option(
+        "driver", "ru.yandex.clickhouse.ClickHouseDriver"
+    ).option("url", db_jdbc_address).options(
+        **get_jdbc_options()
+    ).option(
+        "user", os.getenv("CH_USERNAME")
+    ).option(
+        "password", os.getenv("CH_PASSWORD")
+    ).option(
+        "dbtable", table_name
+    ).save()
+
+
+def read_coverage_flow_df(
+    spark,
+    db_jdbc_address,
+    table_name,
+    start_time,
+    end_time,
+    rm_labels,
+    workload=None,
+    preaggregated=False,
+    unprotected=True,
+):
+    # All the unprotected, or trusted denied, flows of the time range are
+    # read, whatever the limit, with their labels processed as for the
+    # recommendation but not deduplicated, so that every flow is counted.
+    sql_query = generate_sql_query(
+        table_name,
+        0,
+        start_time,
+        end_time,
+        unprotected,
+        count_flows=True,
+        workload=workload,
+        preaggregated=preaggregated,
+    )
+    return read_flow_df(
+        spark, db_jdbc_address, sql_query, rm_labels, drop_duplicates=False
+    )
+
+
 def initial_recommendation_job(
     spark,
     db_jdbc_address,
@@ -888,6 +1503,8 @@ def initial_recommendation_job(
     ns_allow_list=NAMESPACE_ALLOW_LIST,
     rm_labels=False,
     to_services=True,
+    workload=None,
+    preaggregated=False,
 ):
     """
     Start an initial policy recommendation Spark job on a cluster having no
@@ -922,23 +1539,58 @@ def initial_recommendation_job(
                    'pod-template-generation'.
         to_services: Use the toServices feature in ANP, only works when
                      option is 1 or 2.
+        workload: The workload the recommendation is restricted to, as a dict
+                  with the namespace and the podLabels of its Pods. Only its
+                  flows are read, and only the policies applied to its Pods
+                  are recommended. Default value is None, which means all the
+                  Pods of the cluster.
+        preaggregated: The table stores the flows of the time range
+                       aggregated by the Theia Manager instead of the flow
+                       records.
 
     Returns:
         A list of recommended policies, each recommended policy is a string of
-        YAML format.
+        YAML format, the coverage of the recommended policies by Namespace,
+        as returned by compute_recommendation_coverage, and the data window
+        analyzed, as returned by read_data_window.
     """
+    coverage_flows_df = read_coverage_flow_df(
+        spark, db_jdbc_address, table_name, start_time, end_time,
+        rm_labels, workload, preaggregated
+    )
+    set_rule_evidence(
+        spark,
+        compute_rule_evidence(coverage_flows_df, option, to_services),
+    )
     sql_query = generate_sql_query(
-        table_name, limit, start_time, end_time, True
+        table_name, limit, start_time, end_time, True, workload=workload,
+        preaggregated=preaggregated
     )
     unprotected_flows_df = read_flow_df(
         spark, db_jdbc_address, sql_query, rm_labels
     )
-    return merge_policy_dict(
-        recommend_policies_for_ns_allow_list(ns_allow_list),
-        recommend_policies_for_unprotected_flows(
-            unprotected_flows_df, option, to_services
+    recommend_policies = recommend_policies_for_unprotected_flows(
+        unprotected_flows_df, option, to_services
+    )
+    if not workload:
+        # The allow policies of the Namespaces of ns_allow_list do not apply
+        # to the workload.
+        recommend_policies = merge_policy_dict(
+            recommend_policies_for_ns_allow_list(ns_allow_list),
+            recommend_policies,
         )
+    coverage = compute_recommendation_coverage(
+        unprotected_flows_df,
+        coverage_flows_df,
+        ns_allow_list,
+        option,
+        to_services,
+    )
+    data_window = read_data_window(
+        spark, db_jdbc_address, table_name, start_time, end_time,
+        workload=workload, preaggregated=preaggregated
     )
+    return recommend_policies, coverage, data_window
 
 
 def subsequent_recommendation_job(
@@ -951,6 +1603,9 @@ def subsequent_recommendation_job(
     end_time=None,
     rm_labels=False,
     to_services=True,
+    ns_allow_list=NAMESPACE_ALLOW_LIST,
+    workload=None,
+    preaggregated=False,
 ):
     """
     Start a subsequent policy recommendation Spark job on a cluster having
@@ -983,14 +1638,42 @@ def subsequent_recommendation_job(
                    'pod-template-generation'.
         to_services: Use the toServices feature in ANP, only works when option
                      is 1 or 2.
+        ns_allow_list: List of default traffic allow namespaces, whose allow
+                       policies are recommended by the initial job. Only used
+                       to compute the coverage.
+        workload: The workload the recommendation is restricted to, as a dict
+                  with the namespace and the podLabels of its Pods. Default
+                  value is None, which means all the Pods of the cluster.
+        preaggregated: The table stores the flows of the time range
+                       aggregated by the Theia Manager instead of the flow
+                       records.
 
     Returns:
         A list of recommended policies, each recommended policy is a string of
-        YAML format.
+        YAML format, the coverage of the recommended policies by Namespace,
+        as returned by compute_recommendation_coverage, and the data window
+        analyzed, as returned by read_data_window.
     """
     recommend_policies = {}
+    coverage_flows_df = read_coverage_flow_df(
+        spark, db_jdbc_address, table_name, start_time, end_time,
+        rm_labels, workload, preaggregated
+    )
+    evidence_flows_df = coverage_flows_df
+    if option in [1, 2]:
+        evidence_flows_df = evidence_flows_df.union(
+            read_coverage_flow_df(
+                spark, db_jdbc_address, table_name, start_time, end_time,
+                rm_labels, workload, preaggregated, unprotected=False
+            )
+        )
+    set_rule_evidence(
+        spark,
+        compute_rule_evidence(evidence_flows_df, option, to_services),
+    )
     sql_query = generate_sql_query(
-        table_name, limit, start_time, end_time, True
+        table_name, limit, start_time, end_time, True, workload=workload,
+        preaggregated=preaggregated
     )
     unprotected_flows_df = read_flow_df(
         spark, db_jdbc_address, sql_query, rm_labels
@@ -1001,9 +1684,11 @@ def subsequent_recommendation_job(
             unprotected_flows_df, option, to_services
         )
     )
+    recommended_flows_df = unprotected_flows_df
     if option in [1, 2]:
         sql_query = generate_sql_query(
-            table_name, limit, start_time, end_time, False
+            table_name, limit, start_time, end_time, False, workload=workload,
+            preaggregated=preaggregated
         )
         trusted_denied_flows_df = read_flow_df(
             spark, db_jdbc_address, sql_query, rm_labels
@@ -1014,15 +1699,28 @@ def subsequent_recommendation_job(
                 trusted_denied_flows_df, to_services
             )
         )
-    return recommend_policies
+        recommended_flows_df = recommended_flows_df.union(
+            trusted_denied_flows_df
+        )
+    coverage = compute_recommendation_coverage(
+        recommended_flows_df,
+        coverage_flows_df,
+        ns_allow_list,
+        option,
+        to_services,
+    )
+    data_window = read_data_window(
+        spark, db_jdbc_address, table_name, start_time, end_time,
+        option in [1, 2], workload, preaggregated
+    )
+    return recommend_policies, coverage, data_window
 
 
 def main(argv):
     db_jdbc_address = (
         "jdbc:clickhouse://clickhouse-clickhouse.flow-visibility.svc:8123"
     )
-    flow_table_name = "default.flows"
-    result_table_name = "default.recommendations"
+    database = "default"
     recommendation_type = "initial"
     limit = 0
     option = 1
@@ -1031,6 +1729,8 @@ def main(argv):
     recommendation_id_input = ""
     rm_labels = True
     to_services = True
+    workload = None
+    preaggregated_table = ""
     help_message = """
     Start the policy recommendation spark job.
 
@@ -1042,6 +1742,8 @@ def main(argv):
         ClickHouse database for reading flow records and writing result.
         jdbc:clickhouse://clickhouse-clickhouse.flow-visibility.svc:8123 is
         the ClickHouse JDBC URL used by default.
+    --database=default: The ClickHouse database storing the flow records
+        and the recommendation results.
     -l, --limit=0: The limit on the number of flow records read from the
         database. 0 means no limit.
     -o, --option=1: Option of network isolation preference in policy
@@ -1072,6 +1774,17 @@ def main(argv):
         toServices rules for Pod-to-Service flows, only works when option is
         1 or 2. This feature is enabled by default, provide false to disable
         this feature.
+    --workload=None: Restrict the recommendation to the flows of the Pods of
+        a workload, and to the policies applied to them. The workload is a
+        json object with its namespace and the podLabels of its Pods, e.g.
+        '{"namespace":"default","podLabels":{"app":"foo"}}'. Option 2 is not
+        supported, as its deny rules apply to the whole cluster.
+    --preaggregated_table=None: The table of the database storing the flows
+        of the time range aggregated by the Theia Manager, read instead of
+        the flow records.
+    --correlation_id=None: The correlation ID of the job in UUID format,
+        added to the logs of the job and set as the log_comment of its
+        ClickHouse queries.
 
     Usage Example:
     python3 policy_recommendation_job.py
@@ -1083,6 +1796,7 @@ def main(argv):
         -n '["kube-system","flow-aggregator","flow-visibility"]'
     """
     global broadcast_ns_allow_list
+    global broadcast_workload
     spark = SparkSession.builder.getOrCreate()
     broadcast_ns_allow_list = spark.sparkContext.broadcast(
         NAMESPACE_ALLOW_LIST)
@@ -1104,6 +1818,10 @@ def main(argv):
                 "id=",
                 "rm_labels=",
                 "to_services=",
+                "database=",
+                "workload=",
+                "preaggregated_table=",
+                "correlation_id=",
             ],
         )
     except getopt.GetoptError as e:
@@ -1127,7 +1845,7 @@ def main(argv):
                 sys.exit(2)
             recommendation_type = arg
         elif opt in ("-d", "--db_jdbc_url"):
-            parse_url = urlparse("arg")
+            parse_url = urlparse(arg)
             if parse_url.scheme != "jdbc":
                 logger.error(
                     "Please provide a valid JDBC url for ClickHouse database"
@@ -1186,9 +1904,74 @@ def main(argv):
         elif opt in ("--to_services"):
             if arg == "false":
                 to_services = False
+        elif opt == "--database":
+            if not arg:
+                logger.error("database should not be empty.")
+                logger.info(help_message)
+                sys.exit(2)
+            database = arg
+        elif opt == "--workload":
+            try:
+                workload = json.loads(arg)
+            except ValueError:
+                workload = None
+            if (
+                not isinstance(workload, dict)
+                or not workload.get("namespace")
+                or not isinstance(workload.get("podLabels"), dict)
+                or not workload["podLabels"]
+            ):
+                logger.error(
+                    "workload should be a json object with a namespace and "
+                    "podLabels."
+                )
+                logger.info(help_message)
+                sys.exit(2)
+        elif opt == "--preaggregated_table":
+            if not arg:
+                logger.error("preaggregated_table should not be empty.")
+                logger.info(help_message)
+                sys.exit(2)
+            preaggregated_table = arg
+        elif opt == "--correlation_id":
+            try:
+                uuid.UUID(arg)
+            except ValueError:
+                logger.error("correlation_id should be a UUID.")
+                logger.info(help_message)
+                sys.exit(2)
+            set_correlation_id(arg)
+
+    if workload:
+        if option == 2:
+            logger.error("Option 2 is not supported with a workload.")
+            logger.info(help_message)
+            sys.exit(2)
+        applied_to_workload = workload
+        if rm_labels:
+            # The automatically generated labels are removed from the
+            # appliedTo of the policies, so they cannot be matched.
+            applied_to_workload = {
+                "namespace": workload["namespace"],
+                "podLabels": {
+                    key: value
+                    for key, value in workload["podLabels"].items()
+                    if key not in MEANINGLESS_LABELS
+                },
+            }
+        broadcast_workload = spark.sparkContext.broadcast(
+            applied_to_workload
+        )
+
+    flow_table_name = "{}.flows".format(database)
+    if preaggregated_table:
+        flow_table_name = "{}.{}".format(database, preaggregated_table)
+    result_table_name = "{}.recommendations".format(database)
+    coverage_table_name = "{}.recommendation_coverage".format(database)
+    data_window_table_name = "{}.recommendation_data_window".format(database)
 
     if recommendation_type == "initial":
-        result = initial_recommendation_job(
+        result, coverage, data_window = initial_recommendation_job(
             spark,
             db_jdbc_address,
             flow_table_name,
@@ -1199,6 +1982,11 @@ def main(argv):
             broadcast_ns_allow_list.value,
             rm_labels,
             to_services,
+            workload,
+            bool(preaggregated_table),
+        )
+        data_window["emptyResultReason"] = get_empty_result_reason(
+            result, data_window, workload
         )
         recommendation_id = write_recommendation_result(
             spark,
@@ -1208,14 +1996,28 @@ def main(argv):
             result_table_name,
             recommendation_id_input,
         )
+        write_recommendation_coverage(
+            spark,
+            coverage,
+            db_jdbc_address,
+            coverage_table_name,
+            recommendation_id,
+        )
+        write_recommendation_data_window(
+            spark,
+            data_window,
+            db_jdbc_address,
+            data_window_table_name,
+            recommendation_id,
+        )
         logger.info(
             "Initial policy recommendation completed, id: {}, policy number: \
             {}".format(
-                recommendation_id, len(result)
+                recommendation_id, count_recommended_policies(result)
             )
         )
     else:
-        result = subsequent_recommendation_job(
+        result, coverage, data_window = subsequent_recommendation_job(
             spark,
             db_jdbc_address,
             flow_table_name,
@@ -1225,6 +2027,12 @@ def main(argv):
             end_time,
             rm_labels,
             to_services,
+            broadcast_ns_allow_list.value,
+            workload,
+            bool(preaggregated_table),
+        )
+        data_window["emptyResultReason"] = get_empty_result_reason(
+            result, data_window, workload
         )
         recommendation_id = write_recommendation_result(
             spark,
@@ -1234,10 +2042,24 @@ def main(argv):
             result_table_name,
             recommendation_id_input,
         )
+        write_recommendation_coverage(
+            spark,
+            coverage,
+            db_jdbc_address,
+            coverage_table_name,
+            recommendation_id,
+        )
+        write_recommendation_data_window(
+            spark,
+            data_window,
+            db_jdbc_address,
+            data_window_table_name,
+            recommendation_id,
+        )
         logger.info(
             "Subsequent policy recommendation completed, id: {}, policy \
             number: {}".format(
-                recommendation_id, len(result)
+                recommendation_id, count_recommended_policies(result)
             )
         )
     spark.stop()
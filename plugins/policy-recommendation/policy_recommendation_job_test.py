@@ -12,6 +12,7 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+import datetime
 import pytest
 import random
 import yaml
@@ -156,6 +157,130 @@ def test_generate_sql_query(test_input, expected_sql_query):
     assert sql_query == expected_sql_query
 
 
+def test_generate_sql_query_count_flows():
+    sql_query = pr.generate_sql_query(
+        table_name, 0, "", "2022-01-01 23:59:59", True, count_flows=True
+    )
+    assert sql_query == "SELECT {}, count() AS flowCount, \
+min(flowStartSeconds) AS firstSeen, max(flowEndSeconds) AS lastSeen FROM {} \
+WHERE ingressNetworkPolicyName == '' AND egressNetworkPolicyName == '' AND \
+flowEndSeconds < '2022-01-01 23:59:59' GROUP BY {}".format(
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+        table_name,
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+    )
+
+
+def test_generate_sql_query_workload():
+    workload = {"namespace": "ns", "podLabels": {"tier": "web", "app": "a'b"}}
+    sql_query = pr.generate_sql_query(
+        table_name, 0, "", "", True, workload=workload
+    )
+    assert sql_query == "SELECT {} FROM {} WHERE \
+ingressNetworkPolicyName == '' AND egressNetworkPolicyName == '' AND \
+((sourcePodNamespace = 'ns' AND JSONExtractString(sourcePodLabels, 'app') = \
+'a\\'b' AND JSONExtractString(sourcePodLabels, 'tier') = 'web') OR \
+(destinationPodNamespace = 'ns' AND \
+JSONExtractString(destinationPodLabels, 'app') = 'a\\'b' AND \
+JSONExtractString(destinationPodLabels, 'tier') = 'web')) GROUP BY {}".format(
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+        table_name,
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+    )
+
+
+def test_generate_sql_query_preaggregated():
+    sql_query = pr.generate_sql_query(
+        table_name, 0, "", "", True, count_flows=True, preaggregated=True
+    )
+    assert sql_query == "SELECT {}, sum(flowRecords) AS flowCount, \
+min(flowStartSeconds) AS firstSeen, max(flowEndSeconds) AS lastSeen FROM {} \
+WHERE unprotected == 1 GROUP BY {}".format(
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+        table_name,
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+    )
+    sql_query = pr.generate_sql_query(
+        table_name, 100, "", "", False, preaggregated=True
+    )
+    assert sql_query == "SELECT {} FROM {} WHERE trusted == 1 GROUP BY {} \
+LIMIT 100".format(
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+        table_name,
+        ", ".join(pr.FLOW_TABLE_COLUMNS),
+    )
+
+
+def test_generate_data_window_query():
+    data_window_columns = "toString(min(flowStartSeconds)) AS minFlowTime, \
+toString(max(flowEndSeconds)) AS maxFlowTime, count() AS flows, \
+arrayStringConcat(arraySort(arrayFilter(x -> x != '', \
+groupUniqArrayArray([sourceNodeName, destinationNodeName]))), ',') AS nodes"
+    sql_query = pr.generate_data_window_query(
+        table_name, "2022-01-01 00:00:00", "", False
+    )
+    assert sql_query == "SELECT {} FROM {} WHERE \
+ingressNetworkPolicyName == '' AND egressNetworkPolicyName == '' AND \
+flowStartSeconds >= '2022-01-01 00:00:00'".format(
+        data_window_columns, table_name
+    )
+    sql_query = pr.generate_data_window_query(
+        table_name, "", "", True, {"namespace": "ns", "podLabels": {"a": "b"}}
+    )
+    assert sql_query == "SELECT {} FROM {} WHERE \
+((ingressNetworkPolicyName == '' AND egressNetworkPolicyName == '') OR \
+trusted == 1) AND ((sourcePodNamespace = 'ns' AND \
+JSONExtractString(sourcePodLabels, 'a') = 'b') OR \
+(destinationPodNamespace = 'ns' AND \
+JSONExtractString(destinationPodLabels, 'a') = 'b'))".format(
+        data_window_columns, table_name
+    )
+    sql_query = pr.generate_data_window_query(
+        table_name, "", "2022-01-01 23:59:59", True, preaggregated=True
+    )
+    assert sql_query == "SELECT toString(min(flowStartSeconds)) AS \
+minFlowTime, toString(max(flowEndSeconds)) AS maxFlowTime, \
+sum(flowRecords) AS flows, arrayStringConcat(arraySort(arrayFilter(\
+x -> x != '', groupUniqArrayArray(nodeNames))), ',') AS nodes FROM {} WHERE \
+((unprotected == 1) OR trusted == 1) AND \
+flowEndSeconds < '2022-01-01 23:59:59'".format(table_name)
+
+
+@pytest.mark.parametrize(
+    "test_input, expected_applied",
+    [
+        (("ns", '{"app": "foo", "tier": "web"}', None), True),
+        (
+            (
+                "ns",
+                '{"app": "foo", "tier": "web"}',
+                {"namespace": "ns", "podLabels": {"app": "foo"}},
+            ),
+            True,
+        ),
+        (
+            (
+                "ns",
+                '{"app": "bar"}',
+                {"namespace": "ns", "podLabels": {"app": "foo"}},
+            ),
+            False,
+        ),
+        (
+            (
+                "default",
+                '{"app": "foo"}',
+                {"namespace": "ns", "podLabels": {"app": "foo"}},
+            ),
+            False,
+        ),
+    ],
+)
+def test_is_workload_applied_to(test_input, expected_applied):
+    ns, labels, workload = test_input
+    assert pr.is_workload_applied_to(ns, labels, workload) == expected_applied
+
+
 @pytest.mark.parametrize(
     "test_input, expected_policies",
     [
@@ -437,6 +562,263 @@ def test_combine_network_peers(test_input, expected_peer):
     assert network_peer == expected_peer
 
 
+@pytest.mark.parametrize(
+    "test_input, expected_rules",
+    [
+        (
+            (flow_rows[0], 1, True),
+            (
+                (
+                    'antrea-test#{"podname":"perftest-a"}',
+                    'antrea-test#{"podname":"perftest-b"}#5201#TCP',
+                ),
+                (
+                    'antrea-test#{"podname":"perftest-b"}',
+                    'antrea-test#{"podname":"perftest-a"}#5201#TCP',
+                ),
+            ),
+        ),
+        (
+            (flow_rows[1], 1, False),
+            (
+                (
+                    'antrea-test#{"podname":"perftest-a"}',
+                    "antrea-e2e/perftestsvc:5201#5201#TCP",
+                ),
+                (
+                    'antrea-test#{"podname":"perftest-c"}',
+                    'antrea-test#{"podname":"perftest-a"}#5201#TCP',
+                ),
+            ),
+        ),
+        (
+            (flow_rows[2], 3, True),
+            (
+                (
+                    'antrea-test#{"podname":"perftest-a"}',
+                    "192.168.0.1#80#TCP",
+                ),
+                None,
+            ),
+        ),
+    ],
+)
+def test_get_flow_rules(test_input, expected_rules):
+    flow, option, to_services = test_input
+    rules = pr.get_flow_rules(flow, option, to_services)
+    assert rules == expected_rules
+
+
+def test_compute_recommendation_coverage(spark_session):
+    recommended_flows_df = spark_session.createDataFrame(
+        [flows_input[0], flows_input[2]], pr.FLOW_TABLE_COLUMNS
+    )
+    flows_df = spark_session.createDataFrame(
+        [
+            flows_input[0] + (10,),
+            flows_input[1] + (5,),
+            flows_input[2] + (3,),
+            (
+                "kube-system",
+                '{"k8s-app":"kube-dns"}',
+                "10.10.0.7",
+                "antrea-test",
+                '{"podname":"perftest-b"}',
+                "",
+                53,
+                17,
+                "pod_to_pod",
+                2,
+            ),
+        ],
+        pr.FLOW_TABLE_COLUMNS + ["flowCount"],
+    )
+    coverage = pr.compute_recommendation_coverage(
+        recommended_flows_df, flows_df, ["kube-system"]
+    )
+    # The Pod-to-Service flow was not read for the recommendation, and the
+    # ingress side of the flow from kube-system is not allowed.
+    assert coverage == [("antrea-test", 13, 5), ("kube-system", 0, 2)]
+
+
+def test_compute_rule_evidence(spark_session):
+    first_seen = datetime.datetime(2022, 1, 1)
+    flows_df = spark_session.createDataFrame(
+        [
+            flows_input[0] + (10, first_seen, first_seen),
+            flows_input[0][:2] + ("10.10.0.8",) + flows_input[0][3:] + (
+                5,
+                first_seen + datetime.timedelta(days=1),
+                first_seen + datetime.timedelta(days=2),
+            ),
+            flows_input[2] + (3, first_seen, first_seen),
+        ],
+        pr.FLOW_TABLE_COLUMNS + ["flowCount", "firstSeen", "lastSeen"],
+    )
+    evidence = pr.compute_rule_evidence(flows_df)
+    # The two flows between the same Pods are evidence of the same rules.
+    assert evidence == {
+        (
+            "egress",
+            'antrea-test#{"podname":"perftest-a"}',
+            'antrea-test#{"podname":"perftest-b"}#5201#TCP',
+        ): (15, first_seen, first_seen + datetime.timedelta(days=2)),
+        (
+            "ingress",
+            'antrea-test#{"podname":"perftest-b"}',
+            'antrea-test#{"podname":"perftest-a"}#5201#TCP',
+        ): (15, first_seen, first_seen + datetime.timedelta(days=2)),
+        (
+            "egress",
+            'antrea-test#{"podname":"perftest-a"}',
+            "192.168.0.1#80#TCP",
+        ): (3, first_seen, first_seen),
+    }
+
+
+@pytest.mark.parametrize(
+    "test_input, expected_count",
+    [
+        (999, "999"),
+        (1000, "1k"),
+        (1234, "1.2k"),
+        (5600000, "5.6M"),
+        (2000000000, "2G"),
+    ],
+)
+def test_format_flow_count(test_input, expected_count):
+    assert pr.format_flow_count(test_input) == expected_count
+
+
+class FakeBroadcast:
+    def __init__(self, value):
+        self.value = value
+
+
+@pytest.mark.parametrize(
+    "direction, peer, expected_comment",
+    [
+        (
+            "egress",
+            'antrea-test#{"podname":"perftest-b","app":"perf"}#5201#TCP',
+            "Observed 1.2k flow records over 7d from \
+antrea-test/podname=perftest-a to antrea-test/app=perf,podname=perftest-b on \
+port 5201/TCP",
+        ),
+        (
+            "ingress",
+            "kube-system#{}#53#UDP",
+            "Observed 1.2k flow records over 7d from kube-system to \
+antrea-test/podname=perftest-a on port 53/UDP",
+        ),
+        (
+            "egress",
+            "192.168.0.1#80#TCP",
+            "Observed 1.2k flow records over 7d from \
+antrea-test/podname=perftest-a to 192.168.0.1 on port 80/TCP",
+        ),
+        (
+            "egress",
+            "antrea-e2e/perftestsvc:5201#5201#TCP",
+            "Observed 1.2k flow records over 7d from \
+antrea-test/podname=perftest-a to Service antrea-e2e/perftestsvc on port \
+5201/TCP",
+        ),
+        (
+            "egress",
+            "antrea-e2e#perftestsvc",
+            "Observed 1.2k flow records over 7d from \
+antrea-test/podname=perftest-a to Service antrea-e2e/perftestsvc",
+        ),
+        ("ingress", "antrea-e2e#perftestsvc", ""),
+    ],
+)
+def test_get_rule_comment(monkeypatch, direction, peer, expected_comment):
+    applied_to = 'antrea-test#{"podname":"perftest-a"}'
+    first_seen = datetime.datetime(2022, 1, 1)
+    monkeypatch.setattr(
+        pr,
+        "broadcast_rule_evidence",
+        FakeBroadcast(
+            {
+                ("egress", applied_to, peer): (
+                    1234,
+                    first_seen,
+                    first_seen + datetime.timedelta(days=7, hours=3),
+                ),
+                ("ingress", applied_to, peer): (
+                    1234,
+                    first_seen,
+                    first_seen + datetime.timedelta(days=7),
+                ),
+            }
+            if expected_comment
+            else {}
+        ),
+    )
+    assert pr.get_rule_comment(direction, applied_to, peer) == (
+        expected_comment
+    )
+
+
+def test_generate_anp_with_rule_comments(monkeypatch):
+    applied_to = 'antrea-test#{"podname":"perftest-a"}'
+    egress = 'antrea-test#{"podname":"perftest-b"}#5201#TCP'
+    first_seen = datetime.datetime(2022, 1, 1)
+    anp = pr.generate_anp((applied_to, ("", egress)))[0]
+    monkeypatch.setattr(
+        pr,
+        "broadcast_rule_evidence",
+        FakeBroadcast(
+            {
+                ("egress", applied_to, egress): (
+                    42,
+                    first_seen,
+                    first_seen + datetime.timedelta(hours=5),
+                ),
+            }
+        ),
+    )
+    annotated_anp = pr.generate_anp((applied_to, ("", egress)))[0]
+    assert "\n  # Observed 42 flow records over 5h from \
+antrea-test/podname=perftest-a to antrea-test/podname=perftest-b on port \
+5201/TCP\n  - action: Allow\n" in annotated_anp
+    # The comments do not change the policy, except for its random name.
+    anp_dict = yaml.load(anp, Loader=yaml.FullLoader)
+    annotated_anp_dict = yaml.load(annotated_anp, Loader=yaml.FullLoader)
+    annotated_anp_dict["metadata"]["name"] = anp_dict["metadata"]["name"]
+    assert annotated_anp_dict == anp_dict
+
+
+def test_annotate_rules():
+    policy_yaml = """apiVersion: crd.antrea.io/v1alpha1
+kind: NetworkPolicy
+metadata:
+  name: recommend-allow-anp-abcde
+spec:
+  appliedTo:
+  - podSelector:
+      matchLabels:
+        app: a
+  egress:
+  - action: Allow
+    ports:
+    - port: 80
+  - action: Allow
+  ingress:
+  - action: Allow
+"""
+    assert pr.annotate_rules(
+        policy_yaml,
+        {"egress": ["", "egress 2"], "ingress": ["ingress 1"]},
+    ) == policy_yaml.replace(
+        "  - action: Allow\n  ingress:",
+        "  # egress 2\n  - action: Allow\n  ingress:",
+    ).replace(
+        "  ingress:\n", "  ingress:\n  # ingress 1\n"
+    )
+
+
 @pytest.mark.parametrize(
     "test_input, expected_egress_rule",
     [
@@ -1536,3 +1918,83 @@ def test_recommend_antrea_policies(
                 )
             policy["metadata"]["name"] = expect_policy["metadata"]["name"]
             assert policy == expect_policy
+
+
+def test_get_jdbc_tls_options(monkeypatch, tmp_path):
+    assert pr.get_jdbc_tls_options() == {}
+    ca_file = tmp_path / "ca.crt"
+    ca_file.write_text("")
+    monkeypatch.setenv("CH_TLS_CA_FILE", str(ca_file))
+    monkeypatch.setenv("CH_TLS_CERT_FILE", "/etc/clickhouse-tls/tls.crt")
+    monkeypatch.setenv("CH_TLS_KEY_FILE", "/etc/clickhouse-tls/tls.key")
+    assert pr.get_jdbc_tls_options() == {
+        "ssl": "true",
+        "sslcert": "/etc/clickhouse-tls/tls.crt",
+        "sslkey": "/etc/clickhouse-tls/tls.key",
+        "sslmode": "strict",
+        "sslrootcert": str(ca_file),
+    }
+    monkeypatch.setenv("CH_TLS_INSECURE_SKIP_VERIFY", "true")
+    assert pr.get_jdbc_tls_options()["sslmode"] == "none"
+    assert "sslrootcert" not in pr.get_jdbc_tls_options()
+
+
+def test_get_jdbc_options(monkeypatch):
+    assert pr.get_jdbc_options() == {}
+    monkeypatch.setattr(
+        pr, "correlation_id", "5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c"
+    )
+    assert pr.get_jdbc_options() == {
+        "custom_http_params":
+            "log_comment=5c0b2a4e-3f1d-4b8e-9a6c-7d2e1f0a9b8c",
+    }
+
+
+@pytest.mark.parametrize(
+    "result, data_window, workload, expected_reason",
+    [
+        ({"acnp": ["policy"]}, {"flows": 0}, None, ""),
+        (
+            {"acnp": [], "knp": [""]},
+            {"flows": 0},
+            None,
+            "No flow record was found in the time range of the job",
+        ),
+        (
+            {},
+            {"flows": 0},
+            {"namespace": "default", "podLabels": {"app": "nginx"}},
+            "No flow record of the workload was found in the time range of "
+            "the job",
+        ),
+        (
+            {"acnp": []},
+            {"flows": 12},
+            None,
+            "None of the 12 flow records found in the time range of the job "
+            "requires a new policy, e.g. they are in the Namespaces of the "
+            "allow list or already allowed by the existing policies",
+        ),
+    ],
+)
+def test_get_empty_result_reason(
+    result, data_window, workload, expected_reason
+):
+    assert (
+        pr.get_empty_result_reason(result, data_window, workload)
+        == expected_reason
+    )
+
+
+def test_write_empty_recommendation_result():
+    class FailingSpark:
+        def createDataFrame(self, data):
+            raise AssertionError("no DataFrame should be created")
+
+    assert (
+        pr.write_recommendation_result(
+            FailingSpark(), {"acnp": [""]}, "initial", "", "recommendations",
+            "mock-id",
+        )
+        == "mock-id"
+    )
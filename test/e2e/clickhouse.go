@@ -0,0 +1,278 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"antrea.io/theia/pkg/clickhouse/schema"
+	"antrea.io/theia/pkg/theia/portforwarder"
+)
+
+const (
+	countRowsQuery    = "SELECT count() FROM %s"
+	columnExistsQuery = `SELECT count() FROM system.columns
+		WHERE database = currentDatabase() AND table = ? AND name = ?`
+	columnsQuery = `SELECT name FROM system.columns
+		WHERE database = currentDatabase() AND table = ? ORDER BY position`
+	syntheticFlowCondition = `sourcePodNamespace = ? AND sourcePodName = ?
+		AND destinationIP = ? AND destinationTransportPort = ?`
+)
+
+// ClickHouseTestClient is a connection to the ClickHouse server of the test
+// cluster, through a port forwarding, with helpers to assert the content of
+// the database in the e2e tests.
+type ClickHouseTestClient struct {
+	db          *sql.DB
+	portForward *portforwarder.PortForwarder
+}
+
+// NewClickHouseTestClient connects to the ClickHouse server of the test
+// cluster with the credentials of the clickhouse-secret Secret. The
+// connection is closed when the test completes.
+func NewClickHouseTestClient(tb testing.TB, data *TestData) *ClickHouseTestClient {
+	kubeconfig, err := data.provider.GetKubeconfigPath()
+	require.NoError(tb, err)
+	db, portForward, err := SetupClickHouseConnection(data.clientset, kubeconfig)
+	if portForward != nil {
+		tb.Cleanup(portForward.Stop)
+	}
+	require.NoError(tb, err, "Error when connecting to ClickHouse")
+	tb.Cleanup(func() {
+		db.Close()
+	})
+	return &ClickHouseTestClient{db: db, portForward: portForward}
+}
+
+// DB returns the connection to ClickHouse, e.g. to insert records.
+func (c *ClickHouseTestClient) DB() *sql.DB {
+	return c.db
+}
+
+// QueryRows runs the query and returns its rows, with the values of the
+// columns as returned by the driver, e.g. uint64 for a UInt64 column.
+func (c *ClickHouseTestClient) QueryRows(tb testing.TB, query string, args ...interface{}) [][]interface{} {
+	rows, err := c.db.Query(query, args...)
+	require.NoError(tb, err, "Error when running query %q", query)
+	defer rows.Close()
+	columns, err := rows.Columns()
+	require.NoError(tb, err)
+	var result [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range row {
+			pointers[i] = &row[i]
+		}
+		require.NoError(tb, rows.Scan(pointers...), "Error when scanning the result of query %q", query)
+		result = append(result, row)
+	}
+	require.NoError(tb, rows.Err(), "Error when reading the result of query %q", query)
+	return result
+}
+
+// CountRows returns the number of rows of the table, restricted to the rows
+// matching the condition if it is not empty.
+func (c *ClickHouseTestClient) CountRows(table, condition string, args ...interface{}) (int, error) {
+	query := fmt.Sprintf(countRowsQuery, table)
+	if condition != "" {
+		query += " WHERE " + condition
+	}
+	var count int
+	if err := c.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error when counting the rows of table %s: %v", table, err)
+	}
+	return count, nil
+}
+
+// ExpectRowCount asserts that the table holds the expected number of rows
+// matching the condition, or in total if the condition is empty. As the
+// inserts into distributed tables are asynchronous, the rows are counted
+// until the count is reached or the default timeout expires.
+func (c *ClickHouseTestClient) ExpectRowCount(tb testing.TB, expected int, table, condition string, args ...interface{}) {
+	var count int
+	err := wait.PollImmediate(defaultInterval, defaultTimeout, func() (bool, error) {
+		var err error
+		count, err = c.CountRows(table, condition, args...)
+		if err != nil {
+			return false, err
+		}
+		return count == expected, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		assert.Equal(tb, expected, count, "Unexpected number of rows in table %s matching %q", table, condition)
+		return
+	}
+	require.NoError(tb, err)
+}
+
+// ExpectColumnExists asserts that the table of the current database has the
+// column.
+func (c *ClickHouseTestClient) ExpectColumnExists(tb testing.TB, table, column string) {
+	var count int
+	err := c.db.QueryRow(columnExistsQuery, table, column).Scan(&count)
+	require.NoError(tb, err, "Error when looking for column %s of table %s", column, table)
+	assert.Equal(tb, 1, count, "Column %s not found in table %s", column, table)
+}
+
+// ExpectLatestSchema asserts that the tables of the current database have the
+// columns of the tables created by the data schema of the latest version.
+func (c *ClickHouseTestClient) ExpectLatestSchema(tb testing.TB) {
+	for _, table := range schema.Tables() {
+		var columns []string
+		for _, row := range c.QueryRows(tb, columnsQuery, table.Name) {
+			columns = append(columns, fmt.Sprint(row[0]))
+		}
+		assert.Equal(tb, table.Columns, columns, "Unexpected columns of table %s", table.Name)
+	}
+}
+
+// SyntheticFlow is a flow record inserted into ClickHouse by InsertFlows, to
+// test the features reading the flows without generating the traffic in the
+// cluster. The flow is not protected by any NetworkPolicy, and the Pod labels
+// are in json format, as exported by the Flow Aggregator.
+type SyntheticFlow struct {
+	SourceIP                   string
+	DestinationIP              string
+	DestinationTransportPort   uint16
+	ProtocolIdentifier         uint8
+	SourcePodName              string
+	SourcePodNamespace         string
+	SourcePodLabels            string
+	DestinationPodName         string
+	DestinationPodNamespace    string
+	DestinationPodLabels       string
+	DestinationServicePortName string
+	// FlowType is 1 for intra-Node flows, 2 for inter-Node flows and 3 for
+	// Pod-to-External flows.
+	FlowType uint8
+}
+
+// InsertFlows inserts recordsPerFlow records of each of the flows into the
+// flows table, observed over the last minute, and waits for them to be
+// readable.
+func (c *ClickHouseTestClient) InsertFlows(tb testing.TB, flows []SyntheticFlow, recordsPerFlow int) {
+	// The table may also receive the records of the Flow Aggregator, so the
+	// records are counted by flow.
+	countsBefore := make([]int, len(flows))
+	for i := range flows {
+		count, err := c.CountRows("flows", syntheticFlowCondition, flows[i].conditionArgs()...)
+		require.NoError(tb, err)
+		countsBefore[i] = count
+	}
+	err := wait.PollImmediate(5*defaultInterval, defaultTimeout, func() (bool, error) {
+		if err := c.db.Ping(); err != nil {
+			return false, nil
+		}
+		tx, err := c.db.Begin()
+		if err != nil {
+			return false, nil
+		}
+		stmt, err := tx.Prepare(insertQueryflowtable)
+		if err != nil {
+			tx.Rollback()
+			return false, nil
+		}
+		defer stmt.Close()
+		endTime := time.Now()
+		startTime := endTime.Add(-time.Minute)
+		for i := range flows {
+			for j := 0; j < recordsPerFlow; j++ {
+				if _, err := stmt.Exec(flows[i].values(startTime, endTime, uint16(50000+j))...); err != nil {
+					tx.Rollback()
+					return false, nil
+				}
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return false, nil
+		}
+		return true, nil
+	})
+	require.NoError(tb, err, "Unable to commit the synthetic flows to ClickHouse")
+	for i := range flows {
+		c.ExpectRowCount(tb, countsBefore[i]+recordsPerFlow, "flows", syntheticFlowCondition, flows[i].conditionArgs()...)
+	}
+}
+
+// conditionArgs returns the arguments of syntheticFlowCondition selecting the
+// records of the flow.
+func (f *SyntheticFlow) conditionArgs() []interface{} {
+	return []interface{}{f.SourcePodNamespace, f.SourcePodName, f.DestinationIP, f.DestinationTransportPort}
+}
+
+// values returns the values of the columns of insertQueryflowtable for a
+// record of the flow.
+func (f *SyntheticFlow) values(startTime, endTime time.Time, sourceTransportPort uint16) []interface{} {
+	return []interface{}{
+		startTime,
+		endTime,
+		endTime,
+		endTime,
+		0,
+		f.SourceIP,
+		f.DestinationIP,
+		sourceTransportPort,
+		f.DestinationTransportPort,
+		f.ProtocolIdentifier,
+		uint64(10),
+		uint64(1000),
+		uint64(10),
+		uint64(1000),
+		uint64(10),
+		uint64(1000),
+		uint64(10),
+		uint64(1000),
+		f.SourcePodName,
+		f.SourcePodNamespace,
+		"",
+		f.DestinationPodName,
+		f.DestinationPodNamespace,
+		"",
+		"",
+		uint16(0),
+		f.DestinationServicePortName,
+		"",
+		"",
+		"",
+		uint8(0),
+		uint8(0),
+		"",
+		"",
+		"",
+		uint8(0),
+		uint8(0),
+		"",
+		f.FlowType,
+		f.SourcePodLabels,
+		f.DestinationPodLabels,
+		uint64(0),
+		uint64(0),
+		uint64(0),
+		uint64(0),
+		uint64(0),
+		uint64(0),
+		"",
+		"",
+		"",
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// The records inserted into ClickHouse by the Flow Aggregator after the
+	// restart of the ClickHouse Pod.
+	flowsInsertedAfterCondition = "sourceIP = ? AND destinationIP = ? AND timeInserted > ?"
+)
+
+// TestClickHouseRestart checks that the components using ClickHouse recover
+// when the ClickHouse Pod is restarted while they are running: the
+// ClickHouse monitor keeps monitoring the storage, the Flow Aggregator keeps
+// inserting flow records, and an in-flight policy recommendation job completes
+// and can be deleted along with its result.
+func TestClickHouseRestart(t *testing.T) {
+	config := FlowVisibilitySetUpConfig{
+		withSparkOperator:     true,
+		withGrafana:           false,
+		withClickHouseLocalPv: false,
+		withFlowAggregator:    true,
+	}
+	data, v4Enabled, _, err := setupTestForFlowVisibility(t, config)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer func() {
+		teardownTest(t, data)
+		deleteRecommendedPolicies(t, data)
+		TeardownFlowVisibility(t, data, config, controlPlaneNodeName())
+	}()
+
+	podAIPs, podBIPs, err := createTestPods(data)
+	if err != nil {
+		t.Fatalf("Error when creating test Pods: %v", err)
+	}
+
+	_, jobName, err := runJob(t, data)
+	require.NoError(t, err)
+	err = data.PodWaitForReady(defaultTimeout, jobName+"-driver", flowVisibilityNamespace)
+	require.NoError(t, err)
+
+	restartTime, err := data.restartClickHousePod()
+	require.NoError(t, err)
+
+	t.Run("testClickHouseMonitorAfterRestart", func(t *testing.T) {
+		testClickHouseMonitorAfterRestart(t, data)
+	})
+	t.Run("testFlowAggregatorInsertsAfterRestart", func(t *testing.T) {
+		if v4Enabled {
+			testFlowAggregatorInsertsAfterRestart(t, data, podAIPs.ipv4.String(), podBIPs.ipv4.String(), false, restartTime)
+		} else {
+			testFlowAggregatorInsertsAfterRestart(t, data, podAIPs.ipv6.String(), podBIPs.ipv6.String(), true, restartTime)
+		}
+	})
+	t.Run("testPolicyRecommendationAfterRestart", func(t *testing.T) {
+		testPolicyRecommendationAfterRestart(t, data, jobName)
+	})
+}
+
+// testClickHouseMonitorAfterRestart checks that the monitor of the recreated
+// ClickHouse Pod connects to ClickHouse and reports the memory usage.
+func testClickHouseMonitorAfterRestart(t *testing.T, data *TestData) {
+	var logString string
+	err := wait.PollImmediate(defaultInterval, 2*defaultTimeout, func() (bool, error) {
+		var err error
+		logString, err = data.GetPodLogs(flowVisibilityNamespace, clickHousePodName, &corev1.PodLogOptions{
+			Container: clickHouseMonitorContName,
+		})
+		if err != nil {
+			// Keep trying
+			return false, nil
+		}
+		return strings.Contains(logString, "Memory usage"), nil
+	})
+	assert.NoErrorf(t, err, "ClickHouse monitor did not report the memory usage after the restart, logs: %s", logString)
+}
+
+// testFlowAggregatorInsertsAfterRestart generates traffic between the test
+// Pods and checks that the Flow Aggregator inserts its records into the
+// recreated ClickHouse Pod.
+func testFlowAggregatorInsertsAfterRestart(t *testing.T, data *TestData, srcIP, dstIP string, isIPv6 bool, restartTime time.Time) {
+	cmdStr := fmt.Sprintf("iperf3 -c %s -t %d -b %s", dstIP, iperfTimeSec, iperfBandwidth)
+	if isIPv6 {
+		cmdStr = fmt.Sprintf("iperf3 -6 -c %s -t %d -b %s", dstIP, iperfTimeSec, iperfBandwidth)
+	}
+	stdout, stderr, err := data.RunCommandFromPod(testNamespace, "perftest-a", "perftool", []string{"bash", "-c", cmdStr})
+	require.NoErrorf(t, err, "Error when running iperf3 client: %v,\nstdout:%s\nstderr:%s", err, stdout, stderr)
+
+	clickHouse := NewClickHouseTestClient(t, data)
+	var count int
+	err = wait.PollImmediate(defaultInterval, 2*defaultTimeout, func() (bool, error) {
+		var err error
+		count, err = clickHouse.CountRows("flows", flowsInsertedAfterCondition, srcIP, dstIP, restartTime)
+		if err != nil {
+			return false, err
+		}
+		return count > 0, nil
+	})
+	assert.NoErrorf(t, err, "Flow Aggregator did not insert records into ClickHouse after the restart, found %d records", count)
+}
+
+// testPolicyRecommendationAfterRestart checks that the policy recommendation
+// job running during the restart completes, and that its result is removed
+// from ClickHouse when the job is deleted.
+func testPolicyRecommendationAfterRestart(t *testing.T, data *TestData, jobName string) {
+	err := waitJobComplete(t, data, jobName, jobCompleteTimeout)
+	require.NoError(t, err)
+	err = retrieveJobResult(t, data, jobName)
+	require.NoError(t, err)
+	_, err = deleteJob(t, data, jobName)
+	require.NoError(t, err)
+	err = VerifyJobCleaned(t, data, jobName, "recommendations", 3)
+	require.NoError(t, err)
+}
@@ -288,6 +288,9 @@ type TestOptions struct {
 	logsExportDir       string
 	logsExportOnSuccess bool
 	skipCases           string
+	// syntheticDenyPolicies lists the policies which the synthetic flow
+	// records of TestSyntheticDenyRecords are tagged as denied by.
+	syntheticDenyPolicies string
 }
 
 var testOptions TestOptions
@@ -1422,6 +1425,36 @@ func (data *TestData) waitForClickHousePod() error {
 	return nil
 }
 
+// restartClickHousePod deletes the ClickHouse Pod, as if the ClickHouse server
+// crashed, and waits for the StatefulSet to recreate it and for the new Pod to
+// be ready. It returns the time at which the Pod was deleted.
+func (data *TestData) restartClickHousePod() (time.Time, error) {
+	pod, err := data.clientset.CoreV1().Pods(flowVisibilityNamespace).Get(context.TODO(), clickHousePodName, metav1.GetOptions{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error when getting the ClickHouse Pod: %v", err)
+	}
+	restartTime := time.Now()
+	if err := data.DeletePod(flowVisibilityNamespace, clickHousePodName); err != nil {
+		return time.Time{}, fmt.Errorf("error when deleting the ClickHouse Pod: %v", err)
+	}
+	_, err = data.PodWaitFor(2*defaultTimeout, clickHousePodName, flowVisibilityNamespace, func(p *corev1.Pod) (bool, error) {
+		if p.UID == pod.UID {
+			return false, nil
+		}
+		for _, condition := range p.Status.Conditions {
+			if condition.Type == corev1.PodReady {
+				return condition.Status == corev1.ConditionTrue, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		_, stdout, _, _ := data.provider.RunCommandOnNode(controlPlaneNodeName(), fmt.Sprintf("kubectl -n %s describe pod %s", flowVisibilityNamespace, clickHousePodName))
+		return time.Time{}, fmt.Errorf("error when waiting for the ClickHouse Pod to be recreated: %v; kubectl describe pod output: %v", err, stdout)
+	}
+	return restartTime, nil
+}
+
 // deployFlowAggregator deploys the Flow Aggregator.
 func (data *TestData) deployFlowAggregator() error {
 	flowAggYaml := flowAggregatorYML
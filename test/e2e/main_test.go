@@ -59,6 +59,7 @@ func testMain(m *testing.M) int {
 	flag.StringVar(&testOptions.logsExportDir, "logs-export-dir", "", "Export directory for test logs")
 	flag.BoolVar(&testOptions.logsExportOnSuccess, "logs-export-on-success", false, "Export logs even when a test is successful")
 	flag.StringVar(&testOptions.skipCases, "skip", "", "Key words to skip cases")
+	flag.StringVar(&testOptions.syntheticDenyPolicies, "synthetic-deny-policies", "", "Comma-separated list of <ingress|egress>:<drop|reject>:[<namespace>/]<name> policies which synthetic flow records are tagged as denied by")
 	flag.Parse()
 
 	cleanupLogging := testOptions.setupLogging()
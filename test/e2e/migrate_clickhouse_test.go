@@ -22,6 +22,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/semver"
 	networkingv1 "k8s.io/api/networking/v1"
 	"sigs.k8s.io/yaml"
 
@@ -40,6 +41,9 @@ const (
 	latestAntreaYML              = "antrea-new.yml"
 	migrateToFlowVisibilityYML   = "flow-visibility-new.yml"
 	migrateToChOperatorYML       = "clickhouse-operator-install-bundle-new.yaml"
+	// flowMetadataSchemaVersion is the first version whose data schema has
+	// the Node labels and the names of the policy rules.
+	flowMetadataSchemaVersion = "v0.8.0"
 )
 
 func skipIfNotMigrateTest(t *testing.T) {
@@ -86,12 +90,14 @@ func TestMigrate(t *testing.T) {
 	if needCheckRecommendationsSchema(*migrateFromVersion) {
 		checkRecommendations(t, data, *migrateToVersion)
 	}
+	checkFlowMetadataSchema(t, data, *migrateToVersion)
 	// downgrade and check
 	ApplyNewVersion(t, data, latestAntreaYML, migrateFromChOperatorYML, migrateFromFlowVisibilityYML)
 	checkClickHouseVersionTable(t, data, *migrateFromVersion)
 	if needCheckRecommendationsSchema(*migrateFromVersion) {
 		checkRecommendations(t, data, *migrateFromVersion)
 	}
+	checkFlowMetadataSchema(t, data, *migrateFromVersion)
 }
 
 func checkClickHouseVersionTable(t *testing.T, data *TestData, version string) {
@@ -112,6 +118,48 @@ func checkClickHouseVersionTable(t *testing.T, data *TestData, version string) {
 	}
 }
 
+// hasFlowMetadataSchema returns whether the data schema of version has the
+// Node labels and the names of the policy rules. The version may be given
+// without its leading 'v'.
+func hasFlowMetadataSchema(version string) bool {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return semver.Compare(version, flowMetadataSchemaVersion) >= 0
+}
+
+// checkFlowMetadataSchema checks that the columns of the Node labels and of
+// the names of the policy rules are present and filled if the data schema of
+// version has them, and absent otherwise, i.e. once downgraded.
+func checkFlowMetadataSchema(t *testing.T, data *TestData, version string) {
+	runQuery := func(query string) string {
+		command := fmt.Sprintf("clickhouse client -q \"%s\"", query)
+		stdout, stderr, err := data.RunCommandFromPod(flowVisibilityNamespace, clickHousePodName, "clickhouse", []string{"bash", "-c", command})
+		require.NoErrorf(t, err, "Fail to run query %s in ClickHouse, stderr: %v", query, stderr)
+		return stdout
+	}
+	policyColumns := runQuery("SELECT name FROM system.columns WHERE database = 'default' AND table = 'policy_view_table_local'")
+	tables := runQuery("SHOW TABLES")
+	if !hasFlowMetadataSchema(version) {
+		assert.NotContains(t, policyColumns, "ingressNetworkPolicyRuleName")
+		assert.NotContains(t, policyColumns, "egressNetworkPolicyRuleName")
+		assert.NotContains(t, tables, "node_labels")
+		return
+	}
+	assert.Contains(t, policyColumns, "ingressNetworkPolicyRuleName")
+	assert.Contains(t, policyColumns, "egressNetworkPolicyRuleName")
+	require.Contains(t, tables, "node_labels")
+
+	runQuery("INSERT INTO node_labels (nodeName, labels) VALUES ('e2e-node', '{\\\"zone\\\":\\\"zone-a\\\"}')")
+	runQuery("SYSTEM RELOAD DICTIONARY node_labels_dict")
+	runQuery("INSERT INTO flows (sourceNodeName, destinationServicePortName, ingressNetworkPolicyName, ingressNetworkPolicyRuleName, egressNetworkPolicyName, egressNetworkPolicyRuleName) " +
+		"VALUES ('e2e-node', 'default/e2e-service:http', 'e2e-ingress-policy', 'e2e-ingress-rule', 'e2e-egress-policy', 'e2e-egress-rule')")
+	enriched := runQuery("SELECT destinationServicePortName, JSONExtractString(sourceNodeLabels, 'zone') FROM flows_enriched WHERE sourceNodeName = 'e2e-node'")
+	assert.Contains(t, enriched, "default/e2e-service:http\tzone-a")
+	policyView := runQuery("SELECT ingressNetworkPolicyRuleName, egressNetworkPolicyRuleName FROM flows_policy_view WHERE ingressNetworkPolicyName = 'e2e-ingress-policy'")
+	assert.Contains(t, policyView, "e2e-ingress-rule\te2e-egress-rule")
+}
+
 func needCheckRecommendationsSchema(fromVersion string) bool {
 	return fromVersion == "v0.3.0"
 }
@@ -168,6 +168,12 @@ func TestPolicyRecommendation(t *testing.T) {
 		})
 	}
 
+	// The synthetic flows are inserted after the retrieve tests, which count
+	// all the recommended policies.
+	t.Run("testPolicyRecommendationWorkflow", func(t *testing.T) {
+		testPolicyRecommendationWorkflow(t, data)
+	})
+
 	t.Run("testNPRCleanAfterTheiaMgrResync", func(t *testing.T) {
 		testNPRCleanAfterTheiaMgrResync(t, data)
 	})
@@ -0,0 +1,236 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	crdv1alpha1 "antrea.io/antrea/pkg/apis/crd/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// The label of the Pods of the synthetic flows, which selects the
+	// policies recommended for them.
+	syntheticPodLabel       = "policyreco-e2e"
+	syntheticServerPort     = uint16(8080)
+	syntheticExternalIP     = "192.0.2.10"
+	syntheticExternalPort   = uint16(443)
+	syntheticRecordsPerFlow = 10
+	syntheticClientPodName  = "policyreco-client"
+	syntheticServerPodName  = "policyreco-server"
+	syntheticClientPodIP    = "10.10.0.10"
+	syntheticServerPodIP    = "10.10.0.11"
+	// The format of the start and end time of the policy recommendation jobs.
+	jobTimeFormat = "2006-01-02 15:04:05"
+)
+
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// testPolicyRecommendationWorkflow seeds ClickHouse with synthetic flows
+// between a client and a server Pod, and from the client to an external IP,
+// runs a policy recommendation job, checks its status and retrieves its
+// result with the theia commands run in the test process, then checks that
+// the recommended policies are valid and allow the synthetic flows.
+func testPolicyRecommendationWorkflow(t *testing.T, data *TestData) {
+	clientLabels := map[string]string{syntheticPodLabel: "client"}
+	serverLabels := map[string]string{syntheticPodLabel: "server"}
+	startTime := time.Now().UTC().Add(-5 * time.Minute)
+	clickHouse := NewClickHouseTestClient(t, data)
+	clickHouse.InsertFlows(t, []SyntheticFlow{
+		{
+			SourceIP:                 syntheticClientPodIP,
+			DestinationIP:            syntheticServerPodIP,
+			DestinationTransportPort: syntheticServerPort,
+			ProtocolIdentifier:       6,
+			SourcePodName:            syntheticClientPodName,
+			SourcePodNamespace:       testNamespace,
+			SourcePodLabels:          fmt.Sprintf(`{"%s":"client"}`, syntheticPodLabel),
+			DestinationPodName:       syntheticServerPodName,
+			DestinationPodNamespace:  testNamespace,
+			DestinationPodLabels:     fmt.Sprintf(`{"%s":"server"}`, syntheticPodLabel),
+			FlowType:                 1,
+		},
+		{
+			SourceIP:                 syntheticClientPodIP,
+			DestinationIP:            syntheticExternalIP,
+			DestinationTransportPort: syntheticExternalPort,
+			ProtocolIdentifier:       6,
+			SourcePodName:            syntheticClientPodName,
+			SourcePodNamespace:       testNamespace,
+			SourcePodLabels:          fmt.Sprintf(`{"%s":"client"}`, syntheticPodLabel),
+			FlowType:                 3,
+		},
+	}, syntheticRecordsPerFlow)
+
+	nsAllowList := `["kube-system","flow-aggregator","flow-visibility"]`
+	if testOptions.providerName == "kind" {
+		nsAllowList = `["kube-system","flow-aggregator","flow-visibility","local-path-storage"]`
+	}
+	stdout, err := RunTheiaCommand(data, "policy-recommendation", "run",
+		"--type", "initial",
+		"--policy-type", "anp-deny-applied",
+		"--start-time", startTime.Format(jobTimeFormat),
+		"--ns-allow-list", nsAllowList)
+	require.NoError(t, err)
+	require.Contains(t, stdout, "Successfully created policy recommendation job with name")
+	jobName := stdout[strings.LastIndex(stdout, " ")+1:]
+	defer func() {
+		_, err := RunTheiaCommand(data, "policy-recommendation", "delete", jobName)
+		assert.NoError(t, err)
+	}()
+
+	err = WaitPolicyRecommendationJob(data, jobName, jobCompleteTimeout)
+	require.NoError(t, err)
+	result, err := RunTheiaCommand(data, "policy-recommendation", "retrieve", jobName, "--applied-to", syntheticPodLabel)
+	require.NoError(t, err)
+	anps, acnps := decodeRecommendedPolicies(t, result)
+
+	// An ANP allows the egress traffic of the client and another the ingress
+	// traffic of the server.
+	require.Len(t, anps, 2, "Recommended policies:\n%s", result)
+	var clientANP, serverANP *crdv1alpha1.NetworkPolicy
+	for i := range anps {
+		require.Len(t, anps[i].Spec.AppliedTo, 1, "Recommended policies:\n%s", result)
+		require.NotNil(t, anps[i].Spec.AppliedTo[0].PodSelector, "Recommended policies:\n%s", result)
+		switch anps[i].Spec.AppliedTo[0].PodSelector.MatchLabels[syntheticPodLabel] {
+		case "client":
+			clientANP = &anps[i]
+		case "server":
+			serverANP = &anps[i]
+		}
+	}
+	require.NotNil(t, clientANP, "No ANP recommended for the client. Recommended policies:\n%s", result)
+	require.NotNil(t, serverANP, "No ANP recommended for the server. Recommended policies:\n%s", result)
+	for _, anp := range []*crdv1alpha1.NetworkPolicy{clientANP, serverANP} {
+		assert.Equal(t, testNamespace, anp.Namespace)
+		assert.Equal(t, "Application", anp.Spec.Tier)
+		assert.True(t, strings.HasPrefix(anp.Name, "recommend-allow-anp-"), "Unexpected name of ANP %s", anp.Name)
+	}
+
+	assert.Empty(t, clientANP.Spec.Ingress)
+	require.Len(t, clientANP.Spec.Egress, 2, "Recommended policies:\n%s", result)
+	var toServer, toExternal *crdv1alpha1.Rule
+	for i := range clientANP.Spec.Egress {
+		rule := &clientANP.Spec.Egress[i]
+		require.Len(t, rule.To, 1, "Recommended policies:\n%s", result)
+		if rule.To[0].IPBlock != nil {
+			toExternal = rule
+		} else {
+			toServer = rule
+		}
+	}
+	require.NotNil(t, toServer, "No egress rule to the server. Recommended policies:\n%s", result)
+	require.NotNil(t, toExternal, "No egress rule to the external IP. Recommended policies:\n%s", result)
+	expectAllowRule(t, toServer, syntheticServerPort)
+	expectPodPeer(t, toServer.To[0], serverLabels)
+	expectAllowRule(t, toExternal, syntheticExternalPort)
+	assert.Equal(t, syntheticExternalIP+"/32", toExternal.To[0].IPBlock.CIDR)
+
+	assert.Empty(t, serverANP.Spec.Egress)
+	require.Len(t, serverANP.Spec.Ingress, 1, "Recommended policies:\n%s", result)
+	fromClient := &serverANP.Spec.Ingress[0]
+	require.Len(t, fromClient.From, 1, "Recommended policies:\n%s", result)
+	expectAllowRule(t, fromClient, syntheticServerPort)
+	expectPodPeer(t, fromClient.From[0], clientLabels)
+
+	// The client and the server, which have allow rules applied, reject the
+	// rest of their traffic.
+	require.Len(t, acnps, 2, "Recommended policies:\n%s", result)
+	var rejectedPods []string
+	for _, acnp := range acnps {
+		assert.True(t, strings.HasPrefix(acnp.Name, "recommend-reject-acnp-"), "Unexpected name of ACNP %s", acnp.Name)
+		assert.Equal(t, "Baseline", acnp.Spec.Tier)
+		require.Len(t, acnp.Spec.AppliedTo, 1, "Recommended policies:\n%s", result)
+		appliedTo := acnp.Spec.AppliedTo[0]
+		require.NotNil(t, appliedTo.PodSelector)
+		require.NotNil(t, appliedTo.NamespaceSelector)
+		assert.Equal(t, map[string]string{"kubernetes.io/metadata.name": testNamespace}, appliedTo.NamespaceSelector.MatchLabels)
+		rejectedPods = append(rejectedPods, appliedTo.PodSelector.MatchLabels[syntheticPodLabel])
+		for _, rule := range append(acnp.Spec.Ingress, acnp.Spec.Egress...) {
+			require.NotNil(t, rule.Action)
+			assert.Equal(t, crdv1alpha1.RuleActionReject, *rule.Action)
+		}
+	}
+	assert.ElementsMatch(t, []string{"client", "server"}, rejectedPods)
+
+	// The recommended policies are accepted by the Antrea webhooks.
+	dryRun := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	for i := range anps {
+		_, err := data.crdClient.CrdV1alpha1().NetworkPolicies(anps[i].Namespace).Create(context.TODO(), &anps[i], dryRun)
+		assert.NoError(t, err, "Recommended ANP %s is not valid", anps[i].Name)
+	}
+	for i := range acnps {
+		_, err := data.crdClient.CrdV1alpha1().ClusterNetworkPolicies().Create(context.TODO(), &acnps[i], dryRun)
+		assert.NoError(t, err, "Recommended ACNP %s is not valid", acnps[i].Name)
+	}
+}
+
+// decodeRecommendedPolicies decodes the YAML documents of a recommendation
+// result into Antrea NetworkPolicies and ClusterNetworkPolicies. Fields
+// unknown to the Antrea API fail the test.
+func decodeRecommendedPolicies(t *testing.T, result string) ([]crdv1alpha1.NetworkPolicy, []crdv1alpha1.ClusterNetworkPolicy) {
+	var anps []crdv1alpha1.NetworkPolicy
+	var acnps []crdv1alpha1.ClusterNetworkPolicy
+	for _, document := range yamlDocumentSeparator.Split(result, -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+		var typeMeta metav1.TypeMeta
+		require.NoError(t, yaml.Unmarshal([]byte(document), &typeMeta), "Error when decoding recommended policy:\n%s", document)
+		switch typeMeta.Kind {
+		case "NetworkPolicy":
+			var anp crdv1alpha1.NetworkPolicy
+			require.NoError(t, yaml.UnmarshalStrict([]byte(document), &anp), "Error when decoding recommended ANP:\n%s", document)
+			anps = append(anps, anp)
+		case "ClusterNetworkPolicy":
+			var acnp crdv1alpha1.ClusterNetworkPolicy
+			require.NoError(t, yaml.UnmarshalStrict([]byte(document), &acnp), "Error when decoding recommended ACNP:\n%s", document)
+			acnps = append(acnps, acnp)
+		default:
+			t.Fatalf("Unexpected kind %s of recommended policy:\n%s", typeMeta.Kind, document)
+		}
+	}
+	return anps, acnps
+}
+
+// expectAllowRule asserts that the rule allows the TCP traffic to the port.
+func expectAllowRule(t *testing.T, rule *crdv1alpha1.Rule, port uint16) {
+	require.NotNil(t, rule.Action)
+	assert.Equal(t, crdv1alpha1.RuleActionAllow, *rule.Action)
+	require.Len(t, rule.Ports, 1)
+	require.NotNil(t, rule.Ports[0].Protocol)
+	assert.Equal(t, corev1.ProtocolTCP, *rule.Ports[0].Protocol)
+	require.NotNil(t, rule.Ports[0].Port)
+	assert.Equal(t, int(port), rule.Ports[0].Port.IntValue())
+}
+
+// expectPodPeer asserts that the peer selects the Pods of testNamespace with
+// the labels.
+func expectPodPeer(t *testing.T, peer crdv1alpha1.NetworkPolicyPeer, labels map[string]string) {
+	require.NotNil(t, peer.PodSelector)
+	assert.Equal(t, labels, peer.PodSelector.MatchLabels)
+	require.NotNil(t, peer.NamespaceSelector)
+	assert.Equal(t, map[string]string{"kubernetes.io/metadata.name": testNamespace}, peer.NamespaceSelector.MatchLabels)
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Antrea Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2e
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// Values of the policy type and rule action fields of the flow records,
+	// as defined by the go-ipfix registry.
+	policyTypeAntreaNetworkPolicy        uint8 = 2
+	policyTypeAntreaClusterNetworkPolicy uint8 = 3
+	networkPolicyRuleActionDrop          uint8 = 2
+	networkPolicyRuleActionReject        uint8 = 3
+	syntheticDenyRuleName                      = "synthetic-deny-rule"
+	defaultSyntheticDenyRecordsPerPolicy       = 100
+	defaultSyntheticDenyPolicies               = "ingress:drop:default/synthetic-deny-ingress,egress:reject:synthetic-deny-egress"
+	syntheticDenyRecordsCondition              = `(ingressNetworkPolicyName = ? AND ingressNetworkPolicyNamespace = ? AND ingressNetworkPolicyRuleAction = ?)
+		OR (egressNetworkPolicyName = ? AND egressNetworkPolicyNamespace = ? AND egressNetworkPolicyRuleAction = ?)`
+)
+
+// policyFields holds the values of the ingress or egress policy fields of a
+// flow record.
+type policyFields struct {
+	name       string
+	namespace  string
+	ruleName   string
+	ruleAction uint8
+	policyType uint8
+}
+
+// syntheticDenyPolicy is a policy which synthetic flow records are tagged as
+// denied by, so that the reports on denied traffic can be tested without
+// generating real denied traffic in the cluster.
+type syntheticDenyPolicy struct {
+	namespace  string
+	name       string
+	ingress    bool
+	ruleAction uint8
+}
+
+func (p *syntheticDenyPolicy) fields() policyFields {
+	policyType := policyTypeAntreaNetworkPolicy
+	if p.namespace == "" {
+		policyType = policyTypeAntreaClusterNetworkPolicy
+	}
+	return policyFields{
+		name:       p.name,
+		namespace:  p.namespace,
+		ruleName:   syntheticDenyRuleName,
+		ruleAction: p.ruleAction,
+		policyType: policyType,
+	}
+}
+
+// parseSyntheticDenyPolicies parses a comma-separated list of policies in the
+// form <ingress|egress>:<drop|reject>:[<namespace>/]<name>. Policies without
+// a Namespace are Antrea ClusterNetworkPolicies, the others are Antrea
+// NetworkPolicies.
+func parseSyntheticDenyPolicies(value string) ([]syntheticDenyPolicy, error) {
+	var policies []syntheticDenyPolicy
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("synthetic deny policy %q should be in the form <ingress|egress>:<drop|reject>:[<namespace>/]<name>", item)
+		}
+		var policy syntheticDenyPolicy
+		switch parts[0] {
+		case "ingress":
+			policy.ingress = true
+		case "egress":
+		default:
+			return nil, fmt.Errorf("direction of synthetic deny policy %q should be ingress or egress", item)
+		}
+		switch parts[1] {
+		case "drop":
+			policy.ruleAction = networkPolicyRuleActionDrop
+		case "reject":
+			policy.ruleAction = networkPolicyRuleActionReject
+		default:
+			return nil, fmt.Errorf("action of synthetic deny policy %q should be drop or reject", item)
+		}
+		if namespace, name, ok := strings.Cut(parts[2], "/"); ok {
+			policy.namespace, policy.name = namespace, name
+		} else {
+			policy.name = parts[2]
+		}
+		if policy.name == "" {
+			return nil, fmt.Errorf("name of synthetic deny policy %q should not be empty", item)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// sendDenyRecords writes recordsPerPolicy random flow records denied by each
+// of the policies to ClickHouse.
+func sendDenyRecords(t *testing.T, connect *sql.DB, policies []syntheticDenyPolicy, recordsPerPolicy int) {
+	err := wait.PollImmediate(5*defaultInterval, defaultTimeout, func() (bool, error) {
+		if err := connect.Ping(); err != nil {
+			return false, nil
+		}
+		tx, err := connect.Begin()
+		if err != nil {
+			return false, nil
+		}
+		stmt, err := tx.Prepare(insertQueryflowtable)
+		if err != nil {
+			tx.Rollback()
+			return false, nil
+		}
+		defer stmt.Close()
+		for i := range policies {
+			for j := 0; j < recordsPerPolicy; j++ {
+				addFakeRecordDeniedBy(t, stmt, &policies[i])
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return false, nil
+		}
+		return true, nil
+	})
+	require.NoError(t, err, "Unable to commit the synthetic deny records to ClickHouse")
+}
+
+func TestSyntheticDenyRecords(t *testing.T) {
+	value := testOptions.syntheticDenyPolicies
+	if value == "" {
+		value = defaultSyntheticDenyPolicies
+	}
+	policies, err := parseSyntheticDenyPolicies(value)
+	require.NoError(t, err)
+	require.NotEmpty(t, policies, "No synthetic deny policy given")
+
+	config := FlowVisibilitySetUpConfig{
+		withSparkOperator:     false,
+		withGrafana:           false,
+		withClickHouseLocalPv: false,
+		withFlowAggregator:    false,
+	}
+	data, _, _, err := setupTestForFlowVisibility(t, config)
+	if err != nil {
+		t.Fatalf("Error when setting up test: %v", err)
+	}
+	defer func() {
+		teardownTest(t, data)
+		TeardownFlowVisibility(t, data, config, controlPlaneNodeName())
+	}()
+
+	clickHouse := NewClickHouseTestClient(t, data)
+	clickHouse.ExpectLatestSchema(t)
+	clickHouse.ExpectColumnExists(t, "flows", "trafficClass")
+	sendDenyRecords(t, clickHouse.DB(), policies, defaultSyntheticDenyRecordsPerPolicy)
+	for _, policy := range policies {
+		fields := policy.fields()
+		clickHouse.ExpectRowCount(t, defaultSyntheticDenyRecordsPerPolicy, "flows", syntheticDenyRecordsCondition,
+			fields.name, fields.namespace, fields.ruleAction,
+			fields.name, fields.namespace, fields.ruleAction)
+	}
+}
+
+func TestParseSyntheticDenyPolicies(t *testing.T) {
+	policies, err := parseSyntheticDenyPolicies(defaultSyntheticDenyPolicies)
+	require.NoError(t, err)
+	assert.Equal(t, []syntheticDenyPolicy{
+		{namespace: "default", name: "synthetic-deny-ingress", ingress: true, ruleAction: networkPolicyRuleActionDrop},
+		{name: "synthetic-deny-egress", ruleAction: networkPolicyRuleActionReject},
+	}, policies)
+	assert.Equal(t, policyTypeAntreaClusterNetworkPolicy, policies[1].fields().policyType)
+
+	for _, value := range []string{"ingress:drop", "inbound:drop:p", "ingress:allow:p", "ingress:drop:default/"} {
+		_, err := parseSyntheticDenyPolicies(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/util/wait"
+
+	"antrea.io/theia/pkg/clickhouse/schema"
 )
 
 const (
@@ -44,13 +46,15 @@ const (
 	flowsRelatedTableNum = 4
 )
 
-var tableColumnNumberMap = map[string]string{
-	".inner.flows_node_view_local":   "17",
-	".inner.flows_pod_view_local":    "21",
-	".inner.flows_policy_view_local": "28",
-	"flows_local":                    "52",
-	"recommendations_local":          "5",
-}
+// tableColumnNumberMap maps the tables created with an explicit list of
+// columns by the data schema to their expected number of columns.
+var tableColumnNumberMap = func() map[string]string {
+	columnNumbers := make(map[string]string)
+	for _, table := range schema.Tables() {
+		columnNumbers[table.Name] = strconv.Itoa(len(table.Columns))
+	}
+	return columnNumbers
+}()
 
 func TestTheiaClickHouseStatusCommand(t *testing.T) {
 	config := FlowVisibilitySetUpConfig{
@@ -152,13 +156,10 @@ func testTheiaGetClickHouseTableInfo(t *testing.T, data *TestData, connect *sql.
 	assert.Containsf(stdout, "TotalRows", "stdout: %s", stdout)
 	assert.Containsf(stdout, "TotalBytes", "stdout: %s", stdout)
 	assert.Containsf(stdout, "TotalCols", "stdout: %s", stdout)
-	// check four tables are in db
-	assert.Containsf(stdout, "node_view_table_local", "stdout: %s", stdout)
-	assert.Containsf(stdout, "pod_view_table_local", "stdout: %s", stdout)
-	assert.Containsf(stdout, "policy_view_table_local", "stdout: %s", stdout)
-	assert.Containsf(stdout, "flows_local", "stdout: %s", stdout)
-	assert.Containsf(stdout, "recommendations_local", "stdout: %s", stdout)
-	assert.Containsf(stdout, "tadetector_local", "stdout: %s", stdout)
+	// check the tables of the data schema are in db
+	for _, table := range schema.Tables() {
+		assert.Containsf(stdout, table.Name, "stdout: %s", stdout)
+	}
 
 	flowNum := 0
 	for i := 1; i < length; i++ {
@@ -238,6 +239,34 @@ func getRandIP(t *testing.T) string {
 }
 
 func addFakeRecord(t *testing.T, stmt *sql.Stmt) {
+	addFakeRecordDeniedBy(t, stmt, nil)
+}
+
+// addFakeRecordDeniedBy adds a random record to the statement. When policy is
+// not nil, the record is tagged as denied by the policy in the direction of
+// the policy, instead of being allowed by random ingress and egress policies.
+func addFakeRecordDeniedBy(t *testing.T, stmt *sql.Stmt, policy *syntheticDenyPolicy) {
+	ingress := policyFields{
+		name:       fmt.Sprintf("PolicyName-%d", randInt(t, MaxInt32)),
+		namespace:  fmt.Sprintf("PolicyNameSpace-%d", randInt(t, MaxInt32)),
+		ruleName:   fmt.Sprintf("PolicyRuleName-%d", randInt(t, MaxInt32)),
+		ruleAction: 1,
+		policyType: 1,
+	}
+	egress := policyFields{
+		name:       fmt.Sprintf("PolicyName-%d", randInt(t, MaxInt32)),
+		namespace:  fmt.Sprintf("PolicyNameSpace-%d", randInt(t, MaxInt32)),
+		ruleName:   fmt.Sprintf("PolicyRuleName-%d", randInt(t, MaxInt32)),
+		ruleAction: 1,
+		policyType: 1,
+	}
+	if policy != nil {
+		if policy.ingress {
+			ingress, egress = policy.fields(), policyFields{}
+		} else {
+			ingress, egress = policyFields{}, policy.fields()
+		}
+	}
 	_, err := stmt.Exec(
 		time.Now(),
 		time.Now(),
@@ -266,16 +295,16 @@ func addFakeRecord(t *testing.T, stmt *sql.Stmt) {
 		getRandIP(t),
 		uint16(randInt(t, 65535)),
 		fmt.Sprintf("ServicePortName-%d", randInt(t, MaxInt32)),
-		fmt.Sprintf("PolicyName-%d", randInt(t, MaxInt32)),
-		fmt.Sprintf("PolicyNameSpace-%d", randInt(t, MaxInt32)),
-		fmt.Sprintf("PolicyRuleName-%d", randInt(t, MaxInt32)),
-		1,
-		1,
-		fmt.Sprintf("PolicyName-%d", randInt(t, MaxInt32)),
-		fmt.Sprintf("PolicyNameSpace-%d", randInt(t, MaxInt32)),
-		fmt.Sprintf("PolicyRuleName-%d", randInt(t, MaxInt32)),
-		1,
-		1,
+		ingress.name,
+		ingress.namespace,
+		ingress.ruleName,
+		ingress.ruleAction,
+		ingress.policyType,
+		egress.name,
+		egress.namespace,
+		egress.ruleName,
+		egress.ruleAction,
+		egress.policyType,
 		"tcpState",
 		0,
 		fmt.Sprintf("PodLabels-%d", randInt(t, MaxInt32)),
@@ -40,6 +40,7 @@ func skipIfNotUpgradeTest(t *testing.T) {
 // that:
 //   - ClickHouse data schema version
 //   - Consistency of recommendations stored in ClickHouse
+//   - Node labels and policy rule names of the flow records
 //
 // To run the test, provide the -upgrade.toVersion flag.
 func TestUpgrade(t *testing.T) {
@@ -61,4 +62,5 @@ func TestUpgrade(t *testing.T) {
 	}()
 	// upgrade and check
 	ApplyNewVersion(t, data, upgradeToAntreaYML, upgradeToChOperatorYML, upgradeToFlowVisibilityYML)
+	checkFlowMetadataSchema(t, data, *upgradeToVersion)
 }
@@ -29,7 +29,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+
+	"antrea.io/theia/pkg/theia/commands"
 )
 
 const (
@@ -485,6 +488,70 @@ func RetrieveJobResult(t *testing.T, data *TestData, cmd string) (stdout string,
 	return strings.TrimSuffix(stdout, "\n"), nil
 }
 
+// RunTheiaCommand runs the theia command given by args in the test process,
+// against the test cluster, instead of running the theia binary on the
+// control-plane Node, and returns what the command printed to stdout.
+func RunTheiaCommand(data *TestData, args ...string) (string, error) {
+	kubeconfig, err := data.provider.GetKubeconfigPath()
+	if err != nil {
+		return "", fmt.Errorf("error when getting the kubeconfig of the test cluster: %v", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		output <- buf.String()
+	}()
+	cmdArgs := append(append([]string{}, args...), "--kubeconfig", kubeconfig)
+	err = commands.ExecuteArgs(cmdArgs)
+	w.Close()
+	os.Stdout = stdout
+	out := strings.TrimSuffix(<-output, "\n")
+	r.Close()
+	if err != nil {
+		return out, fmt.Errorf("error when running theia %s: %v\nstdout:%s", strings.Join(args, " "), err, out)
+	}
+	return out, nil
+}
+
+// WaitPolicyRecommendationJob waits for the policy recommendation job to
+// complete, checking its status with the theia command. When the job fails,
+// the error includes the logs of the driver Pod of its Spark application.
+func WaitPolicyRecommendationJob(data *TestData, jobName string, timeout time.Duration) error {
+	var status string
+	err := wait.PollImmediate(defaultInterval, timeout, func() (bool, error) {
+		var err error
+		status, err = RunTheiaCommand(data, "policy-recommendation", "status", jobName)
+		if err != nil {
+			return false, err
+		}
+		if strings.Contains(status, "Status of this policy recommendation job is FAILED") {
+			return false, fmt.Errorf("policy recommendation job %s failed\nstatus:%s\ndriver logs:%s", jobName, status, sparkDriverLogs(data, jobName))
+		}
+		return strings.Contains(status, "Status of this policy recommendation job is COMPLETED"), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("policy recommendation job %s not completed after %v\nstatus:%s\ndriver logs:%s", jobName, timeout, status, sparkDriverLogs(data, jobName))
+	}
+	return err
+}
+
+// sparkDriverLogs returns the logs of the driver Pod of the Spark application
+// of a job, or why they could not be read.
+func sparkDriverLogs(data *TestData, jobName string) string {
+	logs, err := data.GetPodLogs(flowVisibilityNamespace, jobName+"-driver", &corev1.PodLogOptions{})
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return logs
+}
+
 func TheiaManagerRestart(t *testing.T, data *TestData, jobName1 string, job string) error {
 	// Simulate the Theia Manager downtime
 	cmd := "kubectl delete deployment theia-manager -n flow-visibility"